@@ -82,14 +82,14 @@ export const adminAppsApi = {
     return handleResponse<AppsListResponse>(response);
   },
 
-  stop: async (id: string): Promise<{ message: string; app_id: number; stopped_containers: number }> => {
+  stop: async (id: string): Promise<{ message: string; app_id: string; status: string }> => {
     const response = await safeFetch(`${API_ENDPOINTS.admin.apps}/${id}/stop`, {
       method: 'POST',
     });
     return handleResponse(response);
   },
 
-  start: async (id: string): Promise<{ message: string; app_id: number }> => {
+  start: async (id: string): Promise<{ message: string; app_id: string; status: string }> => {
     const response = await safeFetch(`${API_ENDPOINTS.admin.apps}/${id}/start`, {
       method: 'POST',
     });
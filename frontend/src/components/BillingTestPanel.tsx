@@ -1,4 +1,5 @@
 import { useState } from 'react';
+import { apiErrorMessage } from '@/lib/api';
 
 interface BillingTestPanelProps {
   onUpdate?: () => void;
@@ -49,7 +50,7 @@ export default function BillingTestPanel({ onUpdate }: BillingTestPanelProps) {
       const data = await response.json();
 
       if (!response.ok) {
-        throw new Error(data.error || 'Failed to update billing state');
+        throw new Error(apiErrorMessage(data, 'Failed to update billing state'));
       }
 
       setMessage(`✅ Billing state updated: ${billingStatus} / ${plan}`);
@@ -1,6 +1,6 @@
 import { createContext, useContext, useState, useEffect, ReactNode } from 'react';
 import { API_BASE_URL } from '@/lib/config';
-import { authApi } from '@/lib/api';
+import { authApi, apiErrorMessage } from '@/lib/api';
 
 interface User {
   id: string;
@@ -123,7 +123,7 @@ export function AuthProvider({ children }: { children: ReactNode }) {
       let errorMessage = 'Invalid email or password';
       try {
         const error = await response.json();
-        errorMessage = error.error || errorMessage;
+        errorMessage = apiErrorMessage(error, errorMessage);
       } catch {
         // If response is not JSON, use status text
         if (response.status === 401) {
@@ -1,12 +1,29 @@
 import { API_ENDPOINTS, API_BASE_URL } from './config';
 import type { App, Deployment, DeploymentLogs, CreateAppRequest, CreateAppResponse, EnvVar, CreateEnvVarRequest, UserProfile } from './types';
 
+// API errors are {"error": {"code", "message", "details", "request_id"}}; branch on error.code
+export interface APIError {
+  code: string;
+  message: string;
+  details?: unknown;
+  request_id?: string;
+}
+
+// apiErrorMessage returns the message of an API error body, accepting the legacy {"error": "message"} too
+export function apiErrorMessage(body: unknown, fallback: string): string {
+  const error = (body as { error?: APIError | string } | null)?.error;
+  if (typeof error === 'string') {
+    return error || fallback;
+  }
+  return error?.message || fallback;
+}
+
 // Helper function to handle API responses
 async function handleResponse<T>(response: Response): Promise<T> {
   if (!response.ok) {
     // Check if response is JSON before trying to parse
     const contentType = response.headers.get('content-type');
-    let error: { error?: string } = { error: response.statusText };
+    let error: unknown = { error: response.statusText };
     
     if (contentType && contentType.includes('application/json')) {
       try {
@@ -28,7 +45,7 @@ async function handleResponse<T>(response: Response): Promise<T> {
       }
     }
     
-    throw new Error(error.error || `HTTP error! status: ${response.status}`);
+    throw new Error(apiErrorMessage(error, `HTTP error! status: ${response.status}`));
   }
   
   // Check content type before parsing JSON
@@ -130,7 +147,7 @@ export const appsApi = {
     }, true, 120000); // 2 minute timeout for delete operations
     if (!response.ok) {
       const error = await response.json().catch(() => ({ error: response.statusText }));
-      throw new Error(error.error || `HTTP error! status: ${response.status}`);
+      throw new Error(apiErrorMessage(error, `HTTP error! status: ${response.status}`));
     }
   },
 
@@ -177,7 +194,7 @@ export const appsApi = {
     }, true);
     if (!response.ok) {
       const error = await response.json().catch(() => ({ error: response.statusText }));
-      throw new Error(error.error || `HTTP error! status: ${response.status}`);
+      throw new Error(apiErrorMessage(error, `HTTP error! status: ${response.status}`));
     }
   },
 };
@@ -248,6 +265,18 @@ export const authApi = {
     return handleResponse<{ token: string; user: { id: string; email: string; full_name?: string; company_name?: string } }>(response);
   },
 
+  // Sign up with email and password - sends a verification code; verifyOTP creates the account
+  signup: async (email: string, password: string, fullName?: string): Promise<{ message: string; otp?: string }> => {
+    const response = await safeFetch(`${API_BASE_URL}/api/auth/signup`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ email, password, full_name: fullName }),
+    }, false);
+    return handleResponse<{ message: string; otp?: string }>(response);
+  },
+
   // Forgot password - sends OTP via Resend
   forgotPassword: async (email: string): Promise<{ message: string; otp?: string }> => {
     const response = await safeFetch(`${API_BASE_URL}/api/auth/forgot-password`, {
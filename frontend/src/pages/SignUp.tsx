@@ -1,6 +1,6 @@
 import { useState, useEffect } from 'react';
 import { useNavigate, Link } from 'react-router-dom';
-import { authApi } from '@/lib/api';
+import { authApi, apiErrorMessage } from '@/lib/api';
 import { API_BASE_URL } from '@/lib/config';
 import Logo from '@/components/Logo';
 
@@ -165,7 +165,7 @@ export default function SignUp() {
 
         if (!response.ok) {
           const error = await response.json().catch(() => ({ error: 'Failed to set password' }));
-          throw new Error(error.error || 'Failed to set password');
+          throw new Error(apiErrorMessage(error, 'Failed to set password'));
         }
       } catch (err) {
         setError(err instanceof Error ? err.message : 'Failed to set password');
@@ -213,7 +213,7 @@ export default function SignUp() {
 
       if (!response.ok) {
         const error = await response.json().catch(() => ({ error: 'Failed to update profile' }));
-        throw new Error(error.error || 'Failed to update profile');
+        throw new Error(apiErrorMessage(error, 'Failed to update profile'));
       }
 
       const updatedUser = await response.json();
@@ -9,11 +9,12 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/stdlib"
 	"stackyn/server/internal/api"
 	"stackyn/server/internal/db"
 	"stackyn/server/internal/infra"
+	"stackyn/server/internal/services"
 
 	"go.uber.org/zap"
 )
@@ -26,6 +27,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	// `api migrate <command>` manages the schema and exits instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(config, os.Args[2:]))
+	}
+
 	// Initialize logger
 	logger, err := initLogger(config.LogLevel)
 	if err != nil {
@@ -42,50 +48,37 @@ func main() {
 		zap.String("docker_host", config.Docker.Host),
 	)
 
-	// Initialize database connection pool with proper configuration
-	poolConfig, err := pgxpool.ParseConfig(config.Postgres.DSN)
-	if err != nil {
-		logger.Fatal("Failed to parse database connection string", zap.Error(err))
-	}
-	
-	// Configure connection pool settings
-	poolConfig.MaxConns = 25                    // Maximum number of connections in the pool
-	poolConfig.MinConns = 5                     // Minimum number of connections to maintain
-	poolConfig.MaxConnLifetime = 30 * time.Minute // Maximum lifetime of a connection
-	poolConfig.MaxConnIdleTime = 5 * time.Minute  // Maximum idle time before closing
-	poolConfig.HealthCheckPeriod = 1 * time.Minute // How often to check connection health
-	poolConfig.ConnConfig.ConnectTimeout = 5 * time.Second // Timeout for establishing new connections
-	
-	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	// Initialize database connection pool (sizes and query timeouts come from POSTGRES_* settings)
+	pool, err := db.NewPool(context.Background(), config.Postgres, "stackyn-api", logger)
 	if err != nil {
 		logger.Fatal("Failed to connect to database", zap.Error(err))
 	}
 	defer pool.Close()
 
-	// Test connection with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := pool.Ping(ctx); err != nil {
-		logger.Fatal("Failed to ping database", zap.Error(err))
-	}
-	logger.Info("Database connection established",
-		zap.Int("max_conns", int(poolConfig.MaxConns)),
-		zap.Int("min_conns", int(poolConfig.MinConns)),
-	)
-
 	// Run database migrations
-	// Convert pgxpool.Pool to *sql.DB for migrations
-	// We need to create a new connection for migrations since pgxpool doesn't directly expose *sql.DB
-	sqlDB := stdlib.OpenDB(*poolConfig.ConnConfig)
+	// Migrations get their own connection, without the pool's query timeout - building an index on a
+	// large table may take longer
+	migrationConnConfig, err := pgx.ParseConfig(config.Postgres.DSN)
+	if err != nil {
+		logger.Fatal("Failed to parse database connection string", zap.Error(err))
+	}
+	sqlDB := stdlib.OpenDB(*migrationConnConfig)
 	defer sqlDB.Close()
 	
 	if err := db.RunMigrations(sqlDB, logger); err != nil {
 		logger.Fatal("Failed to run database migrations", zap.Error(err))
 	}
-	logger.Info("Database migrations completed successfully")
+
+	// One Redis connection pool for the idempotency store, read cache and plan counters
+	redisClient, err := services.NewRedisClient(config.Redis.Addr, config.Redis.Password)
+	if err != nil {
+		logger.Warn("Redis unavailable - features that keep state in Redis are off", zap.Error(err))
+	} else {
+		defer redisClient.Close()
+	}
 
 	// Initialize HTTP server with chi router
-	router := api.Router(logger, config, pool)
+	router := api.Router(logger, config, pool, redisClient)
 	server := &http.Server{
 		Addr:         fmt.Sprintf("%s:%s", config.Server.Addr, config.Server.Port),
 		Handler:      router,
@@ -102,6 +95,42 @@ func main() {
 		}
 	}()
 
+	// Start the fallback page server for app hosts Traefik has no route to (building, failed, stopped, sleeping apps)
+	// Traefik sends them here through its lowest-priority catch-all router
+	var fallbackServer *http.Server
+	if config.Server.FallbackAddr != "" {
+		fallbackHandler := api.NewFallbackPageHandler(logger, pool, infra.GetEnv("APP_BASE_DOMAIN", "stackyn.local"))
+
+		// Wakes drop the owner's cached app list
+		if config.Cache.TTLSeconds > 0 && redisClient != nil {
+			fallbackHandler.SetCache(services.NewReadCache(redisClient, time.Duration(config.Cache.TTLSeconds)*time.Second, logger))
+		}
+
+		// Requests to sleeping apps queue a wake for the deploy worker
+		wakeEnqueue, err := services.NewTaskEnqueueService(config.Redis.Addr, config.Redis.Password, logger, nil)
+		if err != nil {
+			logger.Warn("Sleeping apps cannot be woken - failed to create task enqueue service", zap.Error(err))
+		} else {
+			defer wakeEnqueue.Close()
+			wakeEnqueue.SetHostScheduler(api.NewHostRepo(pool, logger))
+			fallbackHandler.SetTaskEnqueue(wakeEnqueue)
+		}
+
+		fallbackServer = &http.Server{
+			Addr:         config.Server.FallbackAddr,
+			Handler:      fallbackHandler,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+		go func() {
+			logger.Info("Starting fallback page server", zap.String("addr", fallbackServer.Addr))
+			if err := fallbackServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Fallback page server failed", zap.Error(err))
+			}
+		}()
+	}
+
 	// Start trial lifecycle cron job (runs daily at 2 AM)
 	// Note: In production, you may want to run this as a separate worker/service
 	// For MVP, running in the API server is acceptable
@@ -132,6 +161,11 @@ func main() {
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		logger.Error("Server forced to shutdown", zap.Error(err))
 	}
+	if fallbackServer != nil {
+		if err := fallbackServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Fallback page server forced to shutdown", zap.Error(err))
+		}
+	}
 
 	logger.Info("Server exited")
 }
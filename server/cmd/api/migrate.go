@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"stackyn/server/internal/db"
+	"stackyn/server/internal/infra"
+)
+
+const migrateUsage = `Usage: api migrate <command>
+
+Commands:
+  status        Show the applied version and the pending migrations
+  up            Apply every pending migration (the API also does this at startup)
+  down [N]      Roll back the last N migrations (default 1)
+  goto V        Migrate up or down to version V
+  force V       Mark version V as applied and clean, without running anything, after
+                fixing a failed (dirty) migration by hand
+`
+
+// runMigrateCommand runs `api migrate ...` and returns the process exit code
+func runMigrateCommand(config *infra.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	connConfig, err := pgx.ParseConfig(config.Postgres.DSN)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse database connection string: %v\n", err)
+		return 1
+	}
+	migrator, err := db.NewMigrator(stdlib.OpenDB(*connConfig))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer migrator.Close()
+
+	command, arg := args[0], ""
+	if len(args) > 1 {
+		arg = args[1]
+	}
+	switch command {
+	case "status":
+		// Printed below like after every command
+	case "up":
+		err = migrator.Up()
+	case "down":
+		steps := 1
+		if arg != "" {
+			if steps, err = strconv.Atoi(arg); err != nil || steps < 1 {
+				fmt.Fprintf(os.Stderr, "down takes a positive number of migrations, got %q\n", arg)
+				return 2
+			}
+		}
+		err = migrator.Down(steps)
+	case "goto":
+		version, parseErr := strconv.ParseUint(arg, 10, 32)
+		if parseErr != nil {
+			fmt.Fprintf(os.Stderr, "goto takes a version, got %q\n", arg)
+			return 2
+		}
+		err = migrator.Goto(uint(version))
+	case "force":
+		version, parseErr := strconv.Atoi(arg)
+		if parseErr != nil || version < 0 {
+			fmt.Fprintf(os.Stderr, "force takes a version, got %q\n", arg)
+			return 2
+		}
+		err = migrator.Force(version)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown migrate command %q\n\n%s", command, migrateUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		// Show where the database was left
+	}
+
+	status, statusErr := migrator.Status()
+	if statusErr != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", statusErr)
+		return 1
+	}
+	printMigrationStatus(status)
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+func printMigrationStatus(status db.MigrationStatus) {
+	state := "clean"
+	if status.Dirty {
+		state = "dirty - fix the schema by hand, then run: api migrate force <last fully applied version>"
+	}
+	fmt.Printf("Version: %d (%s)\n", status.Version, state)
+	fmt.Printf("Latest:  %d\n", status.Latest)
+	switch {
+	case status.Version > status.Latest:
+		fmt.Println("The database is ahead of this binary's migrations")
+	case len(status.Pending) == 0:
+		fmt.Println("Up to date")
+	default:
+		fmt.Printf("Pending: %d migration(s) %v\n", len(status.Pending), status.Pending)
+	}
+}
@@ -10,12 +10,13 @@ import (
 	"time"
 
 	"stackyn/server/internal/api"
+	"stackyn/server/internal/db"
 	"stackyn/server/internal/infra"
+	"stackyn/server/internal/metrics"
 	"stackyn/server/internal/services"
 	"stackyn/server/internal/tasks"
 	"stackyn/server/internal/workers"
 
-	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 )
 
@@ -77,9 +78,24 @@ func main() {
 	
 	logPersistence := services.NewLogPersistenceService(logger, logStorageDir, usePostgres, maxStoragePerAppMB)
 
+	// One Redis connection pool for the read cache and plan counters
+	redisClient, err := services.NewRedisClient(config.Redis.Addr, config.Redis.Password)
+	if err != nil {
+		logger.Warn("Redis unavailable - features that keep state in Redis are off", zap.Error(err))
+	} else {
+		defer redisClient.Close()
+	}
+
 	// Initialize plan enforcement service
 	planEnforcement := services.NewPlanEnforcementService(logger)
 
+	// Share the concurrent build and RAM counters with the API and the other workers through Redis
+	if redisClient != nil {
+		planEnforcement.SetCounters(services.NewRedisPlanCounters(redisClient))
+	} else {
+		logger.Warn("Plan counters are not shared - falling back to per-process counters")
+	}
+
 	// Initialize constraints service (MVP constraints)
 	maxBuildTimeMinutes := 15 // MVP: 15 minute max build time
 	constraintsService := services.NewConstraintsService(logger, maxBuildTimeMinutes)
@@ -92,33 +108,21 @@ func main() {
 	defer taskEnqueueService.Close()
 
 	// Initialize database connection for app repository
-	pgxConfig, err := pgxpool.ParseConfig(fmt.Sprintf(
-		"postgres://%s:%s@%s:%d/%s?sslmode=%s",
-		config.Postgres.User,
-		config.Postgres.Password,
-		config.Postgres.Host,
-		config.Postgres.Port,
-		config.Postgres.Database,
-		config.Postgres.SSLMode,
-	))
-	if err != nil {
-		logger.Fatal("Failed to parse database connection string", zap.Error(err))
-	}
-	
-	dbPool, err := pgxpool.NewWithConfig(ctx, pgxConfig)
+	dbPool, err := db.NewPool(ctx, config.Postgres, "stackyn-build-worker", logger)
 	if err != nil {
-		logger.Fatal("Failed to create database connection pool", zap.Error(err))
+		logger.Fatal("Failed to connect to database", zap.Error(err))
 	}
 	defer dbPool.Close()
-	
-	// Verify database connection
-	if err := dbPool.Ping(ctx); err != nil {
-		logger.Fatal("Failed to ping database", zap.Error(err))
-	}
-	logger.Info("Database connection established for build worker")
+
+	// Index build log lines for log search as they are persisted
+	logPersistence.SetLineIndex(api.NewLogSearchRepo(dbPool, logger))
 
 	// Initialize app repository for updating app status
 	appRepo := api.NewAppRepo(dbPool, logger)
+	// Status changes drop the API's cached app list of the owner
+	if config.Cache.TTLSeconds > 0 && redisClient != nil {
+		appRepo.SetCache(services.NewReadCache(redisClient, time.Duration(config.Cache.TTLSeconds)*time.Second, logger))
+	}
 
 	// Initialize deployment repository for creating failed deployments with error messages
 	deploymentRepo := api.NewDeploymentRepo(dbPool, logger)
@@ -151,19 +155,88 @@ func main() {
 		envVarRepo,         // Environment variables repository (required for interface, but not used during build)
 	)
 
-	// Initialize task state persistence (nil for now - wire up when DB is ready)
-	var taskPersistence *tasks.TaskStatePersistence
-	// TODO: Initialize with database repository when DB is connected
-	// taskPersistence = tasks.NewTaskStatePersistence(dbRepo, logger)
+	// Meter build wall-clock time into usage_records for build minutes enforcement
+	taskHandler.SetUsageRecorder(api.NewUsageRepo(dbPool, logger))
+
+	// Alert app owners about failures on the channels they opted into
+	emailService := services.NewEmailService(logger, config.Email.ResendAPIKey, config.Email.FromEmail)
+	emailService.SetSMTPFallback(config.Email.SMTPHost, config.Email.SMTPPort, config.Email.SMTPUsername, config.Email.SMTPPassword)
+	emailService.SetQueue(api.NewEmailLogRepo(dbPool, logger), taskEnqueueService)
+	taskHandler.SetNotifier(services.NewNotifier(logger, api.NewUserRepo(dbPool, logger), emailService))
+
+	// Queue build and deploy events for the app's outgoing webhooks (sent by the API server's dispatcher)
+	taskHandler.SetAppEventRecorder(api.NewAppWebhookRepo(dbPool, logger))
 
-	// Initialize Asynq server - only listen to build queue
+	// Record each step of a build on the app's events timeline
+	deployEventRepo := api.NewDeployEventRepo(dbPool, logger)
+	taskHandler.SetDeployEventRecorder(deployEventRepo)
+
+	// Record the Procfile processes of each build for the deploy worker to run
+	taskHandler.SetProcessRepo(appRepo)
+
+	// Build apps that chose buildpacks (CNB lifecycle) or nixpacks instead of a Dockerfile
+	taskHandler.SetBuildStrategyRepo(appRepo)
+	taskHandler.SetBuildpacksBuilder(services.NewBuildpacksBuilder(dockerBuild, config.Buildpacks.BuilderImage, config.Buildpacks.RunImage, config.Buildpacks.DockerSocket, logger))
+	if nixpacks := services.NewNixpacksBuilder(dockerBuild, config.Nixpacks.Binary, logger); nixpacks.Available() {
+		taskHandler.SetNixpacksBuilder(nixpacks)
+	} else {
+		logger.Warn("nixpacks CLI not found - apps using the nixpacks strategy are built from a Dockerfile", zap.String("binary", config.Nixpacks.Binary))
+	}
+
+	// Look for credentials committed to each app's source before building it
+	taskHandler.SetSecretScanner(services.NewSecretScanner())
+	taskHandler.SetSecretScanRepo(appRepo)
+
+	// Scan each built image for known vulnerabilities before it is deployed
+	taskHandler.SetImageScanRepo(api.NewImageScanRepo(dbPool, logger))
+	if scanner := services.NewVulnerabilityScanner(config.VulnScan.Binary, time.Duration(config.VulnScan.TimeoutMinutes)*time.Minute, logger); scanner.Available() {
+		taskHandler.SetImageScanner(scanner)
+	} else {
+		logger.Warn("trivy CLI not found - built images are not scanned for vulnerabilities", zap.String("binary", config.VulnScan.Binary))
+	}
+
+	// Consume injected faults from the chaos endpoints (config validation refuses this in production)
+	if config.Chaos.Enabled {
+		logger.Warn("Chaos fault injection enabled for builds")
+		taskHandler.SetFaultInjector(services.NewChaosInjector(api.NewChaosRepo(dbPool, logger), logger))
+	}
+
+	// Place the deploys of finished builds on a host; deploys on another node copy the image from this one,
+	// so NODE_NAME must match the deploy worker's on the same Docker host
+	taskHandler.SetNode(config.Node.Name, config.Node.Region)
+	taskEnqueueService.SetHostScheduler(api.NewHostRepo(dbPool, logger))
+
+	// Record the builds this worker runs (and the deploys it enqueues), so users can see where their deployment is
+	taskStateRepo := api.NewTaskStateRepo(dbPool, logger)
+	taskEnqueueService.SetTaskStateRecorder(taskStateRepo)
+	taskEnqueueService.SetDeployEventRecorder(deployEventRepo)
+	taskPersistence := tasks.NewTaskStatePersistence(taskStateRepo, logger)
+
+	// Initialize Asynq server - only listen to build queues, weighted by tier (see infra.QueueQoSConfig)
 	buildQueues := map[string]int{
-		tasks.QueueBuild: 10, // Only process build tasks
+		tasks.QueueBuildInteractive: config.QueueQoS.BuildWeightInteractive, // Builds someone is waiting on are picked first
+		tasks.QueueBuildCritical:    config.QueueQoS.BuildWeightCritical,
+		tasks.QueueBuildPro:         config.QueueQoS.BuildWeightPro,
+		tasks.QueueBuild:            config.QueueQoS.BuildWeightDefault,
+		tasks.QueueBuildFree:        config.QueueQoS.BuildWeightFree,
 	}
-	server := workers.NewAsynqServer(config.Redis.Addr, config.Redis.Password, logger, taskHandler, taskPersistence, buildQueues)
+	// On shutdown, running builds get the drain window to finish before they are requeued
+	drainTimeout := time.Duration(config.BuildDrain.TimeoutSeconds) * time.Second
+	server := workers.NewAsynqServer(config.Redis.Addr, config.Redis.Password, logger, taskHandler, taskPersistence, buildQueues, drainTimeout)
+	// Interactive builds also get workers of their own, so automated builds cannot starve them
+	server.ReserveQueues(config.QueueQoS.ReservedBuildWorkers, tasks.QueueBuildInteractive)
 	// Only register build task handler for build worker
 	server.RegisterBuildHandler()
 
+	// Serve Prometheus metrics (task outcomes and durations) for this worker
+	if config.Metrics.ListenAddr != "" {
+		go func() {
+			if err := metrics.Serve(ctx, config.Metrics.ListenAddr, config.Metrics.ScrapeToken, logger); err != nil {
+				logger.Error("Metrics server stopped", zap.Error(err))
+			}
+		}()
+	}
+
 	// Start server in goroutine
 	go func() {
 		logger.Info("Starting build worker server")
@@ -177,13 +250,13 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	logger.Info("Shutting down build worker...")
+	logger.Info("Shutting down build worker...", zap.Duration("drain_timeout", drainTimeout))
 
 	// Cancel context to signal server to stop
 	cancel()
 
-	// Wait for server to finish with timeout
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Wait for running builds to drain, plus time for interrupted ones to be requeued
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), drainTimeout+30*time.Second)
 	defer shutdownCancel()
 
 	if err := server.Stop(shutdownCtx); err != nil {
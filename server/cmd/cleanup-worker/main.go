@@ -9,7 +9,10 @@ import (
 	"syscall"
 	"time"
 
+	"stackyn/server/internal/api"
+	"stackyn/server/internal/db"
 	"stackyn/server/internal/infra"
+	"stackyn/server/internal/metrics"
 	"stackyn/server/internal/services"
 	"stackyn/server/internal/tasks"
 	"stackyn/server/internal/workers"
@@ -50,13 +53,12 @@ func main() {
 		filepath.Join(".", "builds"),     // Build artifacts
 	}
 
-	maxDiskUsagePercent := 85.0 // Start cleanup when disk usage exceeds 85%
-
-	cleanupService, err := services.NewCleanupService(config.Docker.Host, logger, tempDirs, maxDiskUsagePercent)
+	cleanupService, err := services.NewCleanupService(config.Docker.Host, logger, tempDirs, config.Cleanup.MaxDiskUsagePercent)
 	if err != nil {
 		logger.Fatal("Failed to create cleanup service", zap.Error(err))
 	}
 	defer cleanupService.Close()
+	cleanupService.SetDockerDataRoot(config.Cleanup.DockerDataRoot)
 
 	// Initialize plan enforcement service (not needed for cleanup, but required by interface)
 	planEnforcement := services.NewPlanEnforcementService(logger)
@@ -85,18 +87,91 @@ func main() {
 		nil, // No environment variables repository needed for cleanup worker
 	)
 
-	// Initialize task state persistence (nil for now - wire up when DB is ready)
-	var taskPersistence *tasks.TaskStatePersistence
-	// TODO: Initialize with database repository when DB is connected
+	// The database holds deployment history and task states
+	dbPool, err := db.NewPool(ctx, config.Postgres, "stackyn-cleanup-worker", logger)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	defer dbPool.Close()
+
+	// Prune old deployment rows and their images
+	if config.DeploymentRetention.MaxAgeDays > 0 {
+		taskHandler.SetDeploymentRetention(
+			api.NewDeploymentRepo(dbPool, logger),
+			config.DeploymentRetention.KeepPerApp,
+			time.Duration(config.DeploymentRetention.MaxAgeDays)*24*time.Hour,
+		)
+		logger.Info("Deployment history retention enabled",
+			zap.Int("keep_per_app", config.DeploymentRetention.KeepPerApp),
+			zap.Int("max_age_days", config.DeploymentRetention.MaxAgeDays),
+		)
+	}
+
+	// Prune log lines indexed for search (the log files are kept)
+	taskHandler.SetLogSearchRetention(
+		api.NewLogSearchRepo(dbPool, logger),
+		time.Duration(config.LogSearch.RetentionDays)*24*time.Hour,
+	)
+
+	// Keep cleanup runs of several cleanup workers apart; scheduled runs are skipped for half an
+	// interval after any run, so the fleet cleans up about once per interval
+	interval := time.Duration(config.Cleanup.IntervalMinutes) * time.Minute
+	redisClient, err := services.NewRedisClient(config.Redis.Addr, config.Redis.Password)
+	if err != nil {
+		logger.Warn("Failed to connect cleanup lock - runs are not coordinated with other cleanup workers", zap.Error(err))
+	} else {
+		defer redisClient.Close()
+		taskHandler.SetCleanupLock(services.NewCleanupLock(redisClient), interval/2)
+	}
+
+	// Record the cleanup runs this worker does in task states
+	taskPersistence := tasks.NewTaskStatePersistence(api.NewTaskStateRepo(dbPool, logger), logger)
 
 	// Initialize Asynq server - only listen to cleanup queue
 	cleanupQueues := map[string]int{
 		tasks.QueueCleanup: 5, // Only process cleanup tasks
 	}
-	server := workers.NewAsynqServer(config.Redis.Addr, config.Redis.Password, logger, taskHandler, taskPersistence, cleanupQueues)
+	server := workers.NewAsynqServer(config.Redis.Addr, config.Redis.Password, logger, taskHandler, taskPersistence, cleanupQueues, 0)
 	// Only register cleanup task handler for cleanup worker
 	server.RegisterCleanupHandler()
 
+	// Serve Prometheus metrics (task outcomes and durations, disk usage) for this worker
+	if config.Metrics.ListenAddr != "" {
+		metrics.WatchDiskUsage(cleanupService.MaxDiskUsagePercent()/100, func() ([]metrics.DiskSample, error) {
+			measureCtx, measureCancel := context.WithTimeout(ctx, 5*time.Second)
+			defer measureCancel()
+			usage, err := cleanupService.DiskUsage(measureCtx)
+			if err != nil {
+				return nil, err
+			}
+			samples := make([]metrics.DiskSample, 0, len(usage))
+			for _, u := range usage {
+				samples = append(samples, metrics.DiskSample{
+					Volume:         u.Volume,
+					Path:           u.Path,
+					SizeBytes:      u.TotalBytes,
+					AvailableBytes: u.AvailableBytes,
+					UsedRatio:      u.UsedPercent / 100,
+				})
+			}
+			return samples, nil
+		}, logger)
+
+		go func() {
+			if err := metrics.Serve(ctx, config.Metrics.ListenAddr, config.Metrics.ScrapeToken, logger); err != nil {
+				logger.Error("Metrics server stopped", zap.Error(err))
+			}
+		}()
+	}
+
+	// Run cleanup on a schedule; admins can trigger a run through the cleanup queue
+	cleanupScheduler := workers.NewCleanupScheduler(taskHandler, interval, time.Duration(config.Cleanup.JitterMinutes)*time.Minute, logger)
+	go func() {
+		if err := cleanupScheduler.Start(ctx); err != nil && err != context.Canceled {
+			logger.Error("Cleanup scheduler failed", zap.Error(err))
+		}
+	}()
+
 	// Start server in goroutine
 	go func() {
 		logger.Info("Starting cleanup worker server")
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
@@ -9,12 +10,14 @@ import (
 	"time"
 
 	"stackyn/server/internal/api"
+	"stackyn/server/internal/db"
+	"stackyn/server/internal/deploystate"
 	"stackyn/server/internal/infra"
+	"stackyn/server/internal/metrics"
 	"stackyn/server/internal/services"
 	"stackyn/server/internal/tasks"
 	"stackyn/server/internal/workers"
 
-	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 )
 
@@ -64,44 +67,59 @@ func main() {
 	}
 	defer deploymentService.Close()
 
+	// Zero-downtime deploys confirm via the Traefik API that the new container receives traffic
+	deploymentService.SetTraefikAPIURL(config.Traefik.APIURL)
+
+	// Sandbox runtime and seccomp profile of app containers confined by their plan or app isolation level
+	if err := deploymentService.SetIsolation(config.Isolation.Runtime, config.Isolation.SeccompProfile); err != nil {
+		logger.Fatal("Failed to configure container isolation", zap.Error(err))
+	}
+
+	// One Redis connection pool for the read cache and plan counters
+	redisClient, err := services.NewRedisClient(config.Redis.Addr, config.Redis.Password)
+	if err != nil {
+		logger.Warn("Redis unavailable - features that keep state in Redis are off", zap.Error(err))
+	} else {
+		defer redisClient.Close()
+	}
+
 	// Initialize plan enforcement service
 	planEnforcement := services.NewPlanEnforcementService(logger)
 
+	// Share the concurrent build and RAM counters with the API and the other workers through Redis
+	if redisClient != nil {
+		planEnforcement.SetCounters(services.NewRedisPlanCounters(redisClient))
+	} else {
+		logger.Warn("Plan counters are not shared - falling back to per-process counters")
+	}
+
 	// Initialize constraints service (MVP constraints)
 	maxBuildTimeMinutes := 15 // MVP: 15 minute max build time
 	constraintsService := services.NewConstraintsService(logger, maxBuildTimeMinutes)
 
 	// Initialize database connection for deployment repository
-	pgxConfig, err := pgxpool.ParseConfig(fmt.Sprintf(
-		"postgres://%s:%s@%s:%d/%s?sslmode=%s",
-		config.Postgres.User,
-		config.Postgres.Password,
-		config.Postgres.Host,
-		config.Postgres.Port,
-		config.Postgres.Database,
-		config.Postgres.SSLMode,
-	))
-	if err != nil {
-		logger.Fatal("Failed to parse database connection string", zap.Error(err))
-	}
-	
-	dbPool, err := pgxpool.NewWithConfig(ctx, pgxConfig)
+	dbPool, err := db.NewPool(ctx, config.Postgres, "stackyn-deploy-worker", logger)
 	if err != nil {
-		logger.Fatal("Failed to create database connection pool", zap.Error(err))
+		logger.Fatal("Failed to connect to database", zap.Error(err))
 	}
 	defer dbPool.Close()
-	
-	// Verify database connection
-	if err := dbPool.Ping(ctx); err != nil {
-		logger.Fatal("Failed to ping database", zap.Error(err))
-	}
-	logger.Info("Database connection established for deploy worker")
+
+	// Index runtime and release log lines for log search as they are persisted
+	logPersistence.SetLineIndex(api.NewLogSearchRepo(dbPool, logger))
+	// Ship runtime log lines to the apps' log drains (syslog, HTTP, Loki, Datadog)
+	logPersistence.SetLogDrains(services.NewLogDrainService(api.NewLogDrainRepo(dbPool, logger), logger))
 
 	// Initialize deployment repository
 	deploymentRepo := api.NewDeploymentRepo(dbPool, logger)
 
 	// Initialize app repository for updating app status and URL
 	appRepo := api.NewAppRepo(dbPool, logger)
+	// Status changes drop the API's cached app list of the owner
+	var readCache *services.ReadCache
+	if config.Cache.TTLSeconds > 0 && redisClient != nil {
+		readCache = services.NewReadCache(redisClient, time.Duration(config.Cache.TTLSeconds)*time.Second, logger)
+		appRepo.SetCache(readCache)
+	}
 
 	// Initialize build job repository (needed for TaskHandler interface, though deploy-worker doesn't create build_jobs)
 	buildJobRepo := api.NewBuildJobRepo(dbPool, logger)
@@ -112,38 +130,140 @@ func main() {
 	// Create adapter to convert api.EnvVarRepo to tasks.EnvVarRepository interface
 	envVarRepo := &envVarRepoAdapter{repo: apiEnvVarRepo}
 
+	// Load plan limits from the database (health checks are a plan feature)
+	api.ConfigurePlanEnforcement(planEnforcement, api.NewPlanRepo(dbPool, logger), api.NewSubscriptionRepo(dbPool, logger), api.NewUserPlanRepo(dbPool, logger), logger)
+
+	// Crashes and restarts go on the app's events timeline too
+	deployEventRepo := api.NewDeployEventRepo(dbPool, logger)
+	recordDeployEvent := func(event services.DeployEvent) {
+		if err := deployEventRepo.RecordDeployEvent(context.Background(), event); err != nil {
+			logger.Warn("Failed to record deploy event", zap.Error(err), zap.String("deployment_id", event.DeploymentID), zap.String("type", event.Type))
+		}
+	}
+
+	// Alert app owners about failures on the channels they opted into
+	emailService := services.NewEmailService(logger, config.Email.ResendAPIKey, config.Email.FromEmail)
+	emailService.SetSMTPFallback(config.Email.SMTPHost, config.Email.SMTPPort, config.Email.SMTPUsername, config.Email.SMTPPassword)
+	notifier := services.NewNotifier(logger, api.NewUserRepo(dbPool, logger), emailService)
+
+	// The crash watcher only knows containers; their deployment is looked up once the deploy has recorded it
+	resolveDeploymentID := func(containerID, deploymentID string) string {
+		if deploymentID != "" {
+			return deploymentID
+		}
+		id, err := deploymentRepo.GetDeploymentIDByContainerID(context.Background(), containerID)
+		if err != nil {
+			logger.Debug("No deployment recorded for container yet", zap.Error(err), zap.String("container_id", containerID))
+			return ""
+		}
+		return id
+	}
+
+	// Record restarts of crashed and unhealthy containers on their deployment
+	deploymentService.SetRestartCallback(func(appID, deploymentID, containerID string, restartCount int, reason string) {
+		deploymentID = resolveDeploymentID(containerID, deploymentID)
+		if deploymentID == "" {
+			return
+		}
+		if err := deploymentRepo.RecordRestart(context.Background(), deploymentID, restartCount, reason); err != nil {
+			logger.Error("Failed to record deployment restart",
+				zap.Error(err),
+				zap.String("deployment_id", deploymentID),
+				zap.Int("restart_count", restartCount),
+			)
+		}
+		recordDeployEvent(services.DeployEvent{
+			AppID:        appID,
+			DeploymentID: deploymentID,
+			Type:         services.DeployEventRestarted,
+			Message:      fmt.Sprintf("Container restarted (restart %d)", restartCount),
+			Data:         map[string]interface{}{"container_id": containerID, "restart_count": restartCount, "reason": reason},
+		})
+	})
+
 	// Set crash callback to update database when containers crash
 	// This must be after repositories are initialized
-	deploymentService.SetCrashCallback(func(appID, deploymentID, containerID string, exitCode int, errorMsg string) {
+	deploymentService.SetCrashCallback(func(crash services.ContainerCrash) {
 		logger.Info("Container crash detected, updating database",
-			zap.String("app_id", appID),
-			zap.String("deployment_id", deploymentID),
-			zap.String("container_id", containerID),
-			zap.Int("exit_code", exitCode),
-			zap.String("error", errorMsg),
+			zap.String("app_id", crash.AppID),
+			zap.String("deployment_id", crash.DeploymentID),
+			zap.String("container_id", crash.ContainerID),
+			zap.Int("exit_code", crash.ExitCode),
+			zap.String("error", crash.Reason),
 		)
 
-		// Update deployment status to failed
-		if deploymentRepo != nil {
-			err := deploymentRepo.UpdateDeployment(deploymentID, "failed", "", containerID, "", errorMsg)
-			if err != nil {
-				logger.Error("Failed to update deployment status to failed",
-					zap.Error(err),
-					zap.String("deployment_id", deploymentID),
-				)
-			}
+		// A container that crashes while it is being deployed is reported again once its deployment is recorded
+		deploymentID := resolveDeploymentID(crash.ContainerID, crash.DeploymentID)
+		if deploymentID == "" {
+			return
 		}
 
+		// Exited containers mark their deployment crashed; unhealthy ones that kept running mark it failed
+		// A container of a deployment that was already stopped or failed is not a new crash
+		status := deploystate.Crashed
+		if crash.Unhealthy {
+			status = deploystate.Failed
+		}
+		err := deploymentRepo.TransitionDeployment(context.Background(), deploymentID, status, deploystate.Change{
+			Actor:  deploystate.ActorCrashMonitor,
+			Reason: crash.Reason,
+		})
+		if errors.Is(err, deploystate.ErrIllegalTransition) {
+			logger.Info("Ignoring crash of inactive deployment", zap.Error(err), zap.String("deployment_id", deploymentID))
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to update deployment status",
+				zap.Error(err),
+				zap.String("deployment_id", deploymentID),
+				zap.String("status", string(status)),
+			)
+		}
+		if err := deploymentRepo.SetCrashLog(context.Background(), deploymentID, crash.Logs); err != nil {
+			logger.Warn("Failed to store crash log", zap.Error(err), zap.String("deployment_id", deploymentID))
+		}
+		recordDeployEvent(services.DeployEvent{
+			AppID:        crash.AppID,
+			DeploymentID: deploymentID,
+			Type:         services.DeployEventCrashed,
+			Message:      fmt.Sprintf("Container crashed (exit code %d)", crash.ExitCode),
+			Data: map[string]interface{}{
+				"container_id": crash.ContainerID,
+				"exit_code":    crash.ExitCode,
+				"error":        crash.Reason,
+				"restarts":     crash.Restarts,
+				"logs":         crash.Logs,
+			},
+		})
+
+		// A crashed container no longer holds RAM against the owner's plan
+		planEnforcement.ReleaseAppRAM(context.Background(), crash.AppID)
+
 		// Update app status to failed
-		if appRepo != nil {
-			err := appRepo.UpdateApp(appID, "failed", "")
+		if err := appRepo.UpdateApp(crash.AppID, "failed", ""); err != nil {
+			logger.Error("Failed to update app status to failed",
+				zap.Error(err),
+				zap.String("app_id", crash.AppID),
+			)
+		}
+
+		// Tell the owner, in the background so email/Slack latency doesn't hold up the crash watcher
+		go func() {
+			notifyCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			userID, err := appRepo.GetAppUserID(notifyCtx, crash.AppID)
 			if err != nil {
-				logger.Error("Failed to update app status to failed",
-					zap.Error(err),
-					zap.String("app_id", appID),
-				)
+				logger.Debug("Skipping crash notification for missing app", zap.Error(err), zap.String("app_id", crash.AppID))
+				return
 			}
-		}
+			appName := crash.AppID
+			if slug, err := appRepo.GetAppSlug(crash.AppID); err == nil {
+				appName = slug
+			}
+			if err := notifier.NotifyDeployFailed(notifyCtx, userID, appName, "Deployment", crash.Reason); err != nil {
+				logger.Warn("Failed to send crash notification", zap.Error(err), zap.String("app_id", crash.AppID))
+			}
+		}()
 	})
 
 	// Initialize task handler with deployment service and repository
@@ -166,17 +286,259 @@ func main() {
 		envVarRepo,     // Environment variables repository for retrieving env vars during deployment
 	)
 
-	// Initialize task state persistence (nil for now - wire up when DB is ready)
-	var taskPersistence *tasks.TaskStatePersistence
-	// TODO: Initialize with database repository when DB is connected
+	// Route verified custom domains to deployed containers
+	taskHandler.SetDomainRepo(api.NewDomainRepo(dbPool, logger))
+
+	// Per-app health check path and interval
+	taskHandler.SetHealthCheckRepo(&healthCheckRepoAdapter{repo: appRepo})
+
+	// Record the outcome of cron job runs
+	taskHandler.SetCronRunRepo(api.NewCronRepo(dbPool, logger))
+
+	// Record one-off exec runs and stream their output to the API
+	taskHandler.SetExecRunRepo(api.NewExecRepo(dbPool, logger))
+
+	// Write app export bundles (and delete apps exported before deletion)
+	taskHandler.SetAppExportRepo(api.NewAppExportRepo(dbPool, logger))
+
+	// Start sleeping apps again when a request arrives for them
+	appSleepRepo := api.NewAppSleepRepo(dbPool, logger)
+	appSleepRepo.SetCache(readCache)
+	taskHandler.SetAppSleepRepo(appSleepRepo)
+
+	// Stop and start apps when their owners ask for it
+	taskHandler.SetAppPowerRepo(appRepo)
+
+	// Pull the registry images of image apps with their owners' registry logins
+	taskHandler.SetImageAppRepo(appRepo)
+
+	// Run the enabled Procfile worker processes next to the web container
+	taskHandler.SetProcessRepo(appRepo)
+
+	// Run each app's release command before its new deployment takes traffic
+	taskHandler.SetReleaseCommandRepo(appRepo)
+
+	// Confine app containers more tightly than their plan does when the app opted into it
+	taskHandler.SetAppIsolationRepo(appRepo)
+
+	// Fail deploys of images with critical vulnerabilities when the app's organization blocks them
+	taskHandler.SetImageScanRepo(api.NewImageScanRepo(dbPool, logger))
+
+	// Put the opted-in WAF preset in front of the app's routes
+	taskHandler.SetWAFRepo(api.NewWAFRepo(dbPool, logger))
+
+	// Apply the app's edge options (HTTPS redirect, compression, body limit, headers, basic auth) to its routes
+	taskHandler.SetRoutingRepo(api.NewRoutingRepo(dbPool, logger))
+
+	// Record where containers run so maintenance windows reach the owners of affected apps
+	taskHandler.SetNode(config.Node.Name, config.Node.Region)
+	logger.Info("Deploying to node", zap.String("node", config.Node.Name), zap.String("region", config.Node.Region))
+
+	// Leave deploys to other nodes once an admin drains this one (POST /admin/hosts/{id}/drain), and copy
+	// images built on another node from its Docker daemon
+	hostRepo := api.NewHostRepo(dbPool, logger)
+	taskHandler.SetHostRepo(hostRepo)
+	if config.Docker.TLSEnabled {
+		deploymentService.SetRemoteDockerTLS(config.Docker.CAPath, config.Docker.CertPath, config.Docker.KeyPath)
+	}
+
+	// Alert app owners about failures on the channels they opted into
+	taskHandler.SetNotifier(notifier)
+
+	// Queue build and deploy events for the app's outgoing webhooks (sent by the API server's dispatcher)
+	taskHandler.SetAppEventRecorder(api.NewAppWebhookRepo(dbPool, logger))
+
+	// Record each step of a deploy, and later crashes and restarts, on the app's events timeline
+	taskHandler.SetDeployEventRecorder(deployEventRepo)
+
+	// Consume injected faults from the chaos endpoints (config validation refuses this in production)
+	if config.Chaos.Enabled {
+		logger.Warn("Chaos fault injection enabled for deploys")
+		taskHandler.SetFaultInjector(services.NewChaosInjector(api.NewChaosRepo(dbPool, logger), logger))
+	}
+
+	// Sample docker stats for every running app container (served by GET /api/v1/apps/{id}/metrics)
+	metricsCollector := workers.NewMetricsCollector(
+		dbPool,
+		deploymentService.GetDockerClient(),
+		time.Duration(config.Metrics.SampleIntervalSeconds)*time.Second,
+		time.Duration(config.Metrics.RetentionHours)*time.Hour,
+		logger,
+	)
+	go func() {
+		if err := metricsCollector.Start(ctx); err != nil && err != context.Canceled {
+			logger.Error("Metrics collector stopped", zap.Error(err))
+		}
+	}()
+
+	// Keep the plan RAM counters in line with the containers that are actually running
+	ramUsageReconciler := workers.NewRAMUsageReconciler(dbPool, deploymentService.GetDockerClient(), planEnforcement, logger)
+	go func() {
+		if err := ramUsageReconciler.Start(ctx); err != nil && err != context.Canceled {
+			logger.Error("RAM usage reconciler stopped", zap.Error(err))
+		}
+	}()
+
+	// Redeploy apps whose Traefik routing drifted from what the database says
+	driftEnqueue, err := services.NewTaskEnqueueService(config.Redis.Addr, config.Redis.Password, logger, planEnforcement)
+	if err != nil {
+		logger.Fatal("Failed to create task enqueue service", zap.Error(err))
+	}
+	defer driftEnqueue.Close()
+	taskStateRepo := api.NewTaskStateRepo(dbPool, logger)
+	driftEnqueue.SetTaskStateRecorder(taskStateRepo)
+	driftEnqueue.SetDeployEventRecorder(deployEventRepo)
+	driftEnqueue.SetHostScheduler(hostRepo)
+
+	// Deploys placed on this node while it is drained are placed on another host
+	taskHandler.SetTaskEnqueue(driftEnqueue)
+
+	// Queue this worker's emails too, and deliver everyone's queued emails from the email log
+	emailService.SetQueue(api.NewEmailLogRepo(dbPool, logger), driftEnqueue)
+	taskHandler.SetEmailDeliverer(emailService)
+	traefikDriftDetector := workers.NewTraefikDriftDetector(dbPool, deploymentService.GetDockerClient(), deploymentService, driftEnqueue, logger)
+	go func() {
+		if err := traefikDriftDetector.Start(ctx); err != nil && err != context.Canceled {
+			logger.Error("Traefik drift detector stopped", zap.Error(err))
+		}
+	}()
+
+	// Put idle apps of plans without always_on to sleep (needs Traefik's access log to see requests)
+	if config.Idle.AccessLogPath != "" {
+		appIdler := workers.NewAppIdler(dbPool, deploymentService, planEnforcement, config.Idle.AccessLogPath, config.Node.Name,
+			time.Duration(config.Idle.TimeoutMinutes)*time.Minute, logger)
+		appIdler.SetAppListCache(appRepo)
+		go func() {
+			if err := appIdler.Start(ctx); err != nil && err != context.Canceled {
+				logger.Error("App idler stopped", zap.Error(err))
+			}
+		}()
+	} else {
+		logger.Info("App idling disabled - IDLE_ACCESS_LOG_PATH is not set")
+	}
+
+	// Record per-app requests, latency and egress (served by GET /api/v1/apps/{id}/traffic)
+	if config.Traffic.AccessLogPath != "" {
+		trafficCollector := workers.NewTrafficCollector(dbPool, config.Traffic.AccessLogPath,
+			time.Duration(config.Traffic.RetentionDays)*24*time.Hour, logger)
+		go func() {
+			if err := trafficCollector.Start(ctx); err != nil && err != context.Canceled {
+				logger.Error("Traffic collector stopped", zap.Error(err))
+			}
+		}()
+	} else {
+		logger.Info("App traffic recording disabled - TRAFFIC_ACCESS_LOG_PATH is not set")
+	}
+
+	// Record the rule matches app WAFs log through Traefik (served by GET /api/v1/apps/{id}/waf/hits)
+	if config.Traefik.ContainerName != "" {
+		wafHitCollector := workers.NewWAFHitCollector(dbPool, deploymentService, config.Traefik.ContainerName, logger)
+		go func() {
+			if err := wafHitCollector.Start(ctx); err != nil && err != context.Canceled {
+				logger.Error("WAF hit collector stopped", zap.Error(err))
+			}
+		}()
+	} else {
+		logger.Info("WAF hit collection disabled - TRAEFIK_CONTAINER_NAME is not set")
+	}
+
+	// Sample whether apps are receiving traffic (served by GET /api/v1/apps/{id}/presence)
+	// Open connections are only counted when the Traefik container is known
+	if config.Traefik.APIURL != "" {
+		presenceSampler := workers.NewPresenceSampler(dbPool, deploymentService, config.Traefik.ContainerName, logger)
+		go func() {
+			if err := presenceSampler.Start(ctx); err != nil && err != context.Canceled {
+				logger.Error("Presence sampler stopped", zap.Error(err))
+			}
+		}()
+	} else {
+		logger.Info("App presence disabled - TRAEFIK_API_URL is not set")
+	}
 
-	// Initialize Asynq server - only listen to deploy queue
+	// Report this node's Docker host capacity (served by GET /admin/hosts)
+	hostReporter := workers.NewHostReporter(dbPool, deploymentService, config.Node.Name, config.Node.Region, logger)
+	hostReporter.SetAddresses(config.Node.Address, config.Node.DockerEndpoint)
+	go func() {
+		if err := hostReporter.Start(ctx); err != nil && err != context.Canceled {
+			logger.Error("Host reporter stopped", zap.Error(err))
+		}
+	}()
+
+	// Stop this node's containers of apps since deployed to another host
+	movedAppRetirer := workers.NewMovedAppRetirer(dbPool, deploymentService, config.Node.Name, logger)
+	go func() {
+		if err := movedAppRetirer.Start(ctx); err != nil && err != context.Canceled {
+			logger.Error("Moved app retirer stopped", zap.Error(err))
+		}
+	}()
+
+	// Restart app containers that exit with backoff, and mark their deployment crashed once they keep exiting
+	crashLoopPolicy := services.CrashLoopPolicy{
+		MaxRestarts: config.CrashLoop.MaxRestarts,
+		Backoff:     time.Duration(config.CrashLoop.BackoffSeconds) * time.Second,
+		MaxBackoff:  time.Duration(config.CrashLoop.MaxBackoffSeconds) * time.Second,
+	}
+	go func() {
+		if err := deploymentService.WatchContainerExits(ctx, crashLoopPolicy); err != nil && err != context.Canceled {
+			logger.Error("Container crash watcher stopped", zap.Error(err))
+		}
+	}()
+
+	// Flag image apps whose registry serves a newer image than the one deployed
+	imageUpdateChecker := workers.NewImageUpdateChecker(dbPool, deploymentService, logger)
+	imageUpdateChecker.SetAppListCache(appRepo)
+	go func() {
+		if err := imageUpdateChecker.Start(ctx); err != nil && err != context.Canceled {
+			logger.Error("Image update checker stopped", zap.Error(err))
+		}
+	}()
+
+	// Tell owners about new upstream builds of their apps' base images and rebuild apps that opted in
+	if config.BaseImages.CheckIntervalHours > 0 {
+		baseImageChecker := workers.NewBaseImageChecker(dbPool, deploymentService, driftEnqueue, notifier,
+			time.Duration(config.BaseImages.CheckIntervalHours)*time.Hour, logger)
+		go func() {
+			if err := baseImageChecker.Start(ctx); err != nil && err != context.Canceled {
+				logger.Error("Base image checker stopped", zap.Error(err))
+			}
+		}()
+	} else {
+		logger.Info("Base image checks disabled - BASE_IMAGE_CHECK_INTERVAL_HOURS is 0")
+	}
+
+	// Record the tasks this worker runs, so users can see where their deployment is
+	taskPersistence := tasks.NewTaskStatePersistence(taskStateRepo, logger)
+
+	// Initialize Asynq server - only listen to deploy queues
+	// Deploys the scheduler placed on this node come in on its own queues, the rest on the shared ones
 	deployQueues := map[string]int{
-		tasks.QueueDeploy: 10, // Only process deploy tasks
+		tasks.QueueDeployInteractive: 20, // Deploys someone is waiting on are picked first
+		tasks.QueueDeploy:            10, // Only process deploy tasks
+		tasks.QueueEmail:             5,  // Queued emails from the API and all workers
+		services.HostQueue(tasks.QueueDeployInteractive, config.Node.Name): 20,
+		services.HostQueue(tasks.QueueDeploy, config.Node.Name):            10,
 	}
-	server := workers.NewAsynqServer(config.Redis.Addr, config.Redis.Password, logger, taskHandler, taskPersistence, deployQueues)
+	server := workers.NewAsynqServer(config.Redis.Addr, config.Redis.Password, logger, taskHandler, taskPersistence, deployQueues, 0)
+	// Interactive deploys also get workers of their own, so automated deploys cannot starve them
+	server.ReserveQueues(config.QueueQoS.ReservedDeployWorkers, tasks.QueueDeployInteractive,
+		services.HostQueue(tasks.QueueDeployInteractive, config.Node.Name))
 	// Only register deploy task handler for deploy worker
 	server.RegisterDeployHandler()
+	server.RegisterCronRunHandler()
+	server.RegisterAppExportHandler()
+	server.RegisterAppWakeHandler()
+	server.RegisterAppPowerHandler()
+	server.RegisterEmailHandler()
+	server.RegisterExecHandler()
+
+	// Serve Prometheus metrics (task outcomes and durations) for this worker
+	if config.Metrics.ListenAddr != "" {
+		go func() {
+			if err := metrics.Serve(ctx, config.Metrics.ListenAddr, config.Metrics.ScrapeToken, logger); err != nil {
+				logger.Error("Metrics server stopped", zap.Error(err))
+			}
+		}()
+	}
 
 	// Start server in goroutine
 	go func() {
@@ -253,3 +615,19 @@ func (a *envVarRepoAdapter) GetEnvVarsByAppID(ctx context.Context, appID string)
 	}
 	return tasksEnvVars, nil
 }
+
+// healthCheckRepoAdapter adapts api.AppRepo to tasks.HealthCheckRepository interface
+type healthCheckRepoAdapter struct {
+	repo *api.AppRepo
+}
+
+func (a *healthCheckRepoAdapter) GetHealthCheckConfig(ctx context.Context, appID string) (*tasks.HealthCheckConfig, error) {
+	cfg, err := a.repo.GetHealthCheckConfig(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	return &tasks.HealthCheckConfig{
+		Path:            cfg.Path,
+		IntervalSeconds: cfg.IntervalSeconds,
+	}, nil
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/services"
+	"stackyn/server/internal/tasks"
+)
+
+// AppExportRequest is the body for POST /api/v1/apps/{id}/export (the body is optional)
+type AppExportRequest struct {
+	DeleteApp bool `json:"delete_app"` // Delete the app once the bundle has been written
+}
+
+// AppExportHandlers creates and serves export bundles of an app's persistent data
+type AppExportHandlers struct {
+	logger         *zap.Logger
+	appRepo        *AppRepo
+	exportRepo     *AppExportRepo
+	deploymentRepo *DeploymentRepo
+	envVarRepo     *EnvVarRepo
+	taskEnqueue    *services.TaskEnqueueService
+}
+
+// NewAppExportHandlers creates a new app export handlers instance
+func NewAppExportHandlers(logger *zap.Logger, appRepo *AppRepo, exportRepo *AppExportRepo, deploymentRepo *DeploymentRepo, envVarRepo *EnvVarRepo, taskEnqueue *services.TaskEnqueueService) *AppExportHandlers {
+	return &AppExportHandlers{
+		logger:         logger,
+		appRepo:        appRepo,
+		exportRepo:     exportRepo,
+		deploymentRepo: deploymentRepo,
+		envVarRepo:     envVarRepo,
+		taskEnqueue:    taskEnqueue,
+	}
+}
+
+// POST /api/v1/apps/{id}/export - Export the app's volumes, env var keys and last image reference
+// With delete_app the app is deleted once the bundle is written - the way to delete an app without
+// losing data that only lived on Stackyn. The bundle is downloadable for 7 days
+func (h *AppExportHandlers) CreateAppExport(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	var req AppExportRequest
+	if !decodeOptionalJSON(w, r, &req) {
+		return
+	}
+
+	if h.taskEnqueue == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Task queue is not available")
+		return
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+
+	active, err := h.exportRepo.HasActiveAppExport(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to create export")
+		return
+	}
+	if active {
+		h.writeError(w, http.StatusConflict, "An export of this app is already in progress")
+		return
+	}
+
+	manifest, err := h.snapshotApp(r, app)
+	if err != nil {
+		h.logger.Error("Failed to snapshot app for export", zap.Error(err), zap.String("app_id", app.ID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to create export")
+		return
+	}
+
+	export, err := h.exportRepo.CreateAppExport(r.Context(), userID, manifest, req.DeleteApp)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to create export")
+		return
+	}
+
+	payload := tasks.AppExportTaskPayload{
+		ExportID:  export.ID,
+		AppID:     app.ID,
+		UserID:    app.UserID,
+		DeleteApp: req.DeleteApp,
+	}
+	if _, err := h.taskEnqueue.EnqueueAppExportTask(r.Context(), export.ID, payload); err != nil {
+		h.logger.Error("Failed to enqueue app export", zap.Error(err), zap.String("export_id", export.ID))
+		if err := h.exportRepo.FinishAppExport(r.Context(), export.ID, "failed", 0, "Failed to queue the export"); err != nil {
+			h.logger.Warn("Failed to mark unqueued export as failed", zap.Error(err), zap.String("export_id", export.ID))
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to queue export")
+		return
+	}
+
+	h.logger.Info("App export requested",
+		zap.String("app_id", app.ID),
+		zap.String("export_id", export.ID),
+		zap.Bool("delete_app", req.DeleteApp),
+		zap.String("user_id", userID),
+	)
+	h.writeJSON(w, http.StatusAccepted, export)
+}
+
+// GET /api/v1/exports - List the user's app exports, newest first
+// Exports outlive the apps they were taken from, so they are listed per user
+func (h *AppExportHandlers) ListAppExports(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	exports, err := h.exportRepo.GetAppExportsByUserID(r.Context(), userID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve exports")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, exports)
+}
+
+// GET /api/v1/exports/{exportId} - Get an export and its progress
+func (h *AppExportHandlers) GetAppExport(w http.ResponseWriter, r *http.Request) {
+	export, ok := h.getAppExport(w, r)
+	if !ok {
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, export)
+}
+
+// GET /api/v1/exports/{exportId}/download - Download a ready export bundle (.tar.gz)
+func (h *AppExportHandlers) DownloadAppExport(w http.ResponseWriter, r *http.Request) {
+	export, ok := h.getAppExport(w, r)
+	if !ok {
+		return
+	}
+
+	switch export.Status {
+	case "ready":
+	case "expired":
+		h.writeError(w, http.StatusGone, "This export has expired")
+		return
+	case "failed":
+		h.writeError(w, http.StatusConflict, "This export failed: "+export.ErrorMessage)
+		return
+	default:
+		h.writeError(w, http.StatusConflict, "This export is not ready yet")
+		return
+	}
+
+	bundle, err := os.Open(services.AppExportPath(export.ID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			h.writeError(w, http.StatusGone, "This export is no longer available")
+			return
+		}
+		h.logger.Error("Failed to open export bundle", zap.Error(err), zap.String("export_id", export.ID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve export")
+		return
+	}
+	defer bundle.Close()
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"stackyn-export-%s.tar.gz\"", export.ID))
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, "", time.Time{}, bundle)
+}
+
+// snapshotApp captures what the bundle records about the app itself, while the app still exists
+func (h *AppExportHandlers) snapshotApp(r *http.Request, app *App) (*services.AppExportManifest, error) {
+	envVars, err := h.envVarRepo.GetEnvVarsByAppID(r.Context(), app.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get env vars: %w", err)
+	}
+	envVarKeys := make([]string, 0, len(envVars))
+	for _, envVar := range envVars {
+		envVarKeys = append(envVarKeys, envVar.Key)
+	}
+
+	_, lastImage, err := h.deploymentRepo.GetRestartTarget(r.Context(), app.ID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get last image: %w", err)
+	}
+
+	return &services.AppExportManifest{
+		FormatVersion: 1,
+		AppID:         app.ID,
+		AppName:       app.Name,
+		Slug:          app.Slug,
+		RepoURL:       app.RepoURL,
+		Branch:        app.Branch,
+		RootDir:       app.RootDir,
+		EnvVarKeys:    envVarKeys,
+		LastImage:     lastImage,
+		Volumes:       []string{},
+		CreatedAt:     time.Now().UTC(),
+	}, nil
+}
+
+// getAppExport loads the user's export from the URL, writing the error response and returning false on failure
+func (h *AppExportHandlers) getAppExport(w http.ResponseWriter, r *http.Request) (*AppExport, bool) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return nil, false
+	}
+
+	export, err := h.exportRepo.GetAppExportByID(r.Context(), userID, chi.URLParam(r, "exportId"))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Export not found")
+			return nil, false
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve export")
+		return nil, false
+	}
+	return export, true
+}
+
+func (h *AppExportHandlers) getUserIDFromContext(r *http.Request) string {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		h.logger.Warn("User ID not found in context")
+		return ""
+	}
+	return userID
+}
+
+func (h *AppExportHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *AppExportHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/services"
+)
+
+// Limits on app log drains
+const (
+	maxAppLogDrainsPerApp     = 5
+	maxAppLogDrainURLLength   = 2048
+	maxAppLogDrainTokenLength = 1024
+)
+
+// AppLogDrainRequest is the body for POST /api/v1/apps/{id}/log-drains and PATCH /api/v1/apps/{id}/log-drains/{drainId}
+// On PATCH, omitted fields keep their current value and an empty token removes it; the kind cannot change
+type AppLogDrainRequest struct {
+	Kind    *string `json:"kind"`
+	URL     *string `json:"url"`
+	Token   *string `json:"token"`
+	Enabled *bool   `json:"enabled"`
+}
+
+// AppLogDrainHandlers manages the endpoints the deploy worker ships an app's runtime logs to
+type AppLogDrainHandlers struct {
+	logger    *zap.Logger
+	appRepo   *AppRepo
+	drainRepo *LogDrainRepo
+}
+
+// NewAppLogDrainHandlers creates a new app log drain handlers instance
+func NewAppLogDrainHandlers(logger *zap.Logger, appRepo *AppRepo, drainRepo *LogDrainRepo) *AppLogDrainHandlers {
+	return &AppLogDrainHandlers{
+		logger:    logger,
+		appRepo:   appRepo,
+		drainRepo: drainRepo,
+	}
+}
+
+// GET /api/v1/apps/{id}/log-drains - List the app's log drains with their health
+func (h *AppLogDrainHandlers) ListAppLogDrains(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+
+	drains, err := h.drainRepo.GetLogDrainsByAppID(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve log drains")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, drains)
+}
+
+// POST /api/v1/apps/{id}/log-drains - Ship the app's runtime logs to a syslog (TLS), HTTP, Loki or Datadog endpoint
+// Datadog drains default to the US1 intake when no url is given
+func (h *AppLogDrainHandlers) CreateAppLogDrain(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+
+	var req AppLogDrainRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Kind == nil || !services.IsLogDrainKind(*req.Kind) {
+		h.writeError(w, http.StatusBadRequest, fmt.Sprintf("kind must be one of: %s", strings.Join(services.LogDrainKinds, ", ")))
+		return
+	}
+	if req.URL == nil && *req.Kind != services.LogDrainKindDatadog {
+		h.writeError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+
+	existing, err := h.drainRepo.GetLogDrainsByAppID(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve log drains")
+		return
+	}
+	if len(existing) >= maxAppLogDrainsPerApp {
+		h.writeError(w, http.StatusForbidden, fmt.Sprintf("Apps can have at most %d log drains", maxAppLogDrainsPerApp))
+		return
+	}
+
+	drain := &AppLogDrain{AppID: app.ID, Kind: *req.Kind, URL: services.DefaultDatadogLogsURL, Enabled: true}
+	if err := applyAppLogDrainRequest(drain, &req); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := h.drainRepo.CreateLogDrain(r.Context(), drain)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to create log drain")
+		return
+	}
+
+	h.logger.Info("App log drain created",
+		zap.String("app_id", app.ID),
+		zap.String("drain_id", created.ID),
+		zap.String("kind", created.Kind),
+		zap.String("user_id", h.getUserIDFromContext(r)),
+	)
+	h.writeJSON(w, http.StatusCreated, created)
+}
+
+// PATCH /api/v1/apps/{id}/log-drains/{drainId} - Change a drain's URL, token or enabled flag
+func (h *AppLogDrainHandlers) UpdateAppLogDrain(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+	drain, err := h.drainRepo.GetLogDrainByID(r.Context(), app.ID, chi.URLParam(r, "drainId"))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Log drain not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve log drain")
+		return
+	}
+
+	var req AppLogDrainRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Kind != nil && *req.Kind != drain.Kind {
+		h.writeError(w, http.StatusBadRequest, "kind cannot be changed - create another drain instead")
+		return
+	}
+	if err := applyAppLogDrainRequest(drain, &req); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	updated, err := h.drainRepo.UpdateLogDrain(r.Context(), drain)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Log drain not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to update log drain")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, updated)
+}
+
+// DELETE /api/v1/apps/{id}/log-drains/{drainId} - Stop shipping logs to a drain and delete it
+func (h *AppLogDrainHandlers) DeleteAppLogDrain(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+	drainID := chi.URLParam(r, "drainId")
+
+	if err := h.drainRepo.DeleteLogDrain(r.Context(), app.ID, drainID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Log drain not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to delete log drain")
+		return
+	}
+
+	h.logger.Info("App log drain deleted",
+		zap.String("app_id", app.ID),
+		zap.String("drain_id", drainID),
+		zap.String("user_id", h.getUserIDFromContext(r)),
+	)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyAppLogDrainRequest copies the request's URL, token and enabled flag onto drain and validates the result
+func applyAppLogDrainRequest(drain *AppLogDrain, req *AppLogDrainRequest) error {
+	if req.URL != nil {
+		url := strings.TrimSpace(*req.URL)
+		if len(url) > maxAppLogDrainURLLength {
+			return fmt.Errorf("url must be at most %d characters", maxAppLogDrainURLLength)
+		}
+		drain.URL = url
+	}
+	if req.Token != nil {
+		token := strings.TrimSpace(*req.Token)
+		if len(token) > maxAppLogDrainTokenLength {
+			return fmt.Errorf("token must be at most %d characters", maxAppLogDrainTokenLength)
+		}
+		drain.Token = token
+	}
+	if req.Enabled != nil {
+		drain.Enabled = *req.Enabled
+	}
+	return services.ValidateLogDrain(drain.Kind, drain.URL, drain.Token)
+}
+
+// getApp loads the app from the URL, writing the error response and returning false on failure
+func (h *AppLogDrainHandlers) getApp(w http.ResponseWriter, r *http.Request) (*App, bool) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return nil, false
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return nil, false
+		}
+		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return nil, false
+	}
+	return app, true
+}
+
+func (h *AppLogDrainHandlers) getUserIDFromContext(r *http.Request) string {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		h.logger.Warn("User ID not found in context")
+		return ""
+	}
+	return userID
+}
+
+func (h *AppLogDrainHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *AppLogDrainHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
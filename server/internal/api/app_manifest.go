@@ -0,0 +1,437 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+	"go.yaml.in/yaml/v3"
+
+	"stackyn/server/internal/services"
+)
+
+// appManifestVersion is the stackyn.yaml format version produced and accepted
+const appManifestVersion = 1
+
+// maxAppManifestBytes bounds POST /api/v1/apps/import bodies
+const maxAppManifestBytes = 1 << 20
+
+// AppManifest is the declarative description of an app (stackyn.yaml), used to recreate it elsewhere
+// It carries env var keys but never their values
+type AppManifest struct {
+	Version   int                   `yaml:"version" json:"version"`
+	Name      string                `yaml:"name" json:"name"`
+	Slug      string                `yaml:"slug,omitempty" json:"slug,omitempty"`
+	Source    AppManifestSource     `yaml:"source" json:"source"`
+	Build     *AppManifestBuild     `yaml:"build,omitempty" json:"build,omitempty"`
+	Resources *AppManifestResources `yaml:"resources,omitempty" json:"resources,omitempty"`
+	Env       []string              `yaml:"env,omitempty" json:"env,omitempty"` // Keys only
+	Domains   []string              `yaml:"domains,omitempty" json:"domains,omitempty"`
+	Cron      []AppManifestCronJob  `yaml:"cron,omitempty" json:"cron,omitempty"`
+}
+
+// AppManifestSource is where an app's code comes from: a repository or, for image apps, an image
+type AppManifestSource struct {
+	Repo    string `yaml:"repo,omitempty" json:"repo,omitempty"`
+	Branch  string `yaml:"branch,omitempty" json:"branch,omitempty"`
+	RootDir string `yaml:"root_dir,omitempty" json:"root_dir,omitempty"`
+	Image   string `yaml:"image,omitempty" json:"image,omitempty"`
+}
+
+// AppManifestBuild is how a repository app is built and released
+type AppManifestBuild struct {
+	Strategy       string `yaml:"strategy,omitempty" json:"strategy,omitempty"` // dockerfile, buildpacks or nixpacks
+	ReleaseCommand string `yaml:"release_command,omitempty" json:"release_command,omitempty"`
+}
+
+// AppManifestResources is the allocation of an app
+type AppManifestResources struct {
+	RAMMB  int `yaml:"ram_mb" json:"ram_mb"`
+	DiskGB int `yaml:"disk_gb" json:"disk_gb"`
+}
+
+// AppManifestCronJob is a scheduled command of an app
+type AppManifestCronJob struct {
+	Name           string `yaml:"name" json:"name"`
+	Schedule       string `yaml:"schedule" json:"schedule"`
+	Command        string `yaml:"command" json:"command"`
+	TimeoutSeconds int    `yaml:"timeout_seconds,omitempty" json:"timeout_seconds,omitempty"`
+	Enabled        *bool  `yaml:"enabled,omitempty" json:"enabled,omitempty"` // Defaults to true
+}
+
+// ImportAppRequest is the JSON body of POST /api/v1/apps/import
+// A YAML body is taken as the manifest itself, with organization_id as a query parameter
+type ImportAppRequest struct {
+	Manifest       string            `json:"manifest" validate:"notblank"`                      // stackyn.yaml content
+	Env            map[string]string `json:"env,omitempty" validate:"dive,keys,envkey,endkeys"` // Values of the manifest's env keys
+	OrganizationID string            `json:"organization_id,omitempty"`                         // Optional - import the app into an organization
+}
+
+// ImportAppResponse is the response of POST /api/v1/apps/import
+type ImportAppResponse struct {
+	App        App      `json:"app"`
+	BuildJobID string   `json:"build_job_id,omitempty"`
+	MissingEnv []string `json:"missing_env"` // Keys of the manifest that were given no value and were not created
+	Warnings   []string `json:"warnings"`    // Parts of the manifest that could not be applied
+}
+
+// GET /api/v1/apps/{id}/manifest - Describe the app as a stackyn.yaml manifest
+func (h *Handlers) GetAppManifest(w http.ResponseWriter, r *http.Request) {
+	app, err := h.appRepo.GetAppByID(chi.URLParam(r, "id"), h.getUserIDFromContext(r))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+
+	manifest, err := h.buildAppManifest(r, app)
+	if err != nil {
+		h.logger.Error("Failed to build app manifest", zap.Error(err), zap.String("app_id", app.ID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to build app manifest")
+		return
+	}
+	out, err := yaml.Marshal(manifest)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to build app manifest")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
+
+// buildAppManifest collects the settings of app that its manifest describes
+func (h *Handlers) buildAppManifest(r *http.Request, app *App) (*AppManifest, error) {
+	ctx := r.Context()
+	manifest := &AppManifest{Version: appManifestVersion, Name: app.Name, Slug: app.Slug}
+
+	if app.Source == services.AppSourceImage {
+		manifest.Source.Image = app.Image
+	} else {
+		manifest.Source = AppManifestSource{Repo: app.RepoURL, Branch: app.Branch, RootDir: app.RootDir}
+		strategy, err := h.appRepo.GetBuildStrategy(ctx, app.ID)
+		if err != nil {
+			return nil, err
+		}
+		release, err := h.appRepo.GetReleaseCommand(ctx, app.ID)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Build = &AppManifestBuild{Strategy: strategy, ReleaseCommand: release}
+	}
+
+	ramMB, diskGB, err := h.appRepo.GetAppResources(ctx, app.ID)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Resources = &AppManifestResources{RAMMB: ramMB, DiskGB: diskGB}
+
+	if h.envVarRepo != nil {
+		envVars, err := h.envVarRepo.GetEnvVarsByAppID(ctx, app.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, envVar := range envVars {
+			manifest.Env = append(manifest.Env, envVar.Key)
+		}
+	}
+
+	if h.domainRepo != nil {
+		domains, err := h.domainRepo.GetDomainsByAppID(ctx, app.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range domains {
+			manifest.Domains = append(manifest.Domains, d.Domain)
+		}
+	}
+
+	if h.cronRepo != nil {
+		jobs, err := h.cronRepo.GetCronJobsByAppID(ctx, app.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range jobs {
+			enabled := job.Enabled
+			manifest.Cron = append(manifest.Cron, AppManifestCronJob{
+				Name:           job.Name,
+				Schedule:       job.Schedule,
+				Command:        job.Command,
+				TimeoutSeconds: job.TimeoutSeconds,
+				Enabled:        &enabled,
+			})
+		}
+	}
+
+	return manifest, nil
+}
+
+// POST /api/v1/apps/import - Create an app from a stackyn.yaml manifest and deploy it
+// The body is either the manifest as YAML or an ImportAppRequest, which can also carry env var values.
+// Env keys given no value are reported in missing_env rather than created empty; domains are added
+// unverified, and domains already attached to another app are reported in warnings
+func (h *Handlers) ImportApp(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxAppManifestBytes+1))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	if len(body) > maxAppManifestBytes {
+		h.writeError(w, http.StatusRequestEntityTooLarge, "Manifest too large")
+		return
+	}
+
+	req := ImportAppRequest{Manifest: string(body), OrganizationID: r.URL.Query().Get("organization_id")}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		req = ImportAppRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			h.writeError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	if !validateRequest(w, &req) {
+		return
+	}
+
+	manifest, err := parseAppManifest([]byte(req.Manifest))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	plan, err := h.planAppImport(manifest, req.Env)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	createReq := CreateAppRequest{
+		Name:           manifest.Name,
+		Slug:           manifest.Slug,
+		RepoURL:        manifest.Source.Repo,
+		Branch:         manifest.Source.Branch,
+		RootDir:        manifest.Source.RootDir,
+		EnvVars:        plan.envVars,
+		OrganizationID: req.OrganizationID,
+	}
+	if manifest.Source.Image != "" {
+		createReq.Source = services.AppSourceImage
+		createReq.Image = manifest.Source.Image
+	}
+
+	response := ImportAppResponse{MissingEnv: plan.missingEnv, Warnings: []string{}}
+	app, buildJobID, ok := h.createApp(w, r, &createReq, func(app *App) error {
+		warnings, err := h.applyAppImport(r, app, manifest, plan)
+		response.Warnings = append(response.Warnings, warnings...)
+		return err
+	})
+	if !ok {
+		return
+	}
+
+	h.logger.Info("App imported from manifest",
+		zap.String("app_id", app.ID),
+		zap.String("user_id", h.getUserIDFromContext(r)),
+		zap.Int("missing_env", len(plan.missingEnv)),
+		zap.Int("warnings", len(response.Warnings)),
+	)
+	response.App = *app
+	response.BuildJobID = buildJobID
+	h.writeJSON(w, http.StatusCreated, response)
+}
+
+// parseAppManifest decodes a stackyn.yaml manifest, rejecting unknown fields so typos are not silently ignored
+func parseAppManifest(data []byte) (*AppManifest, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("manifest is required")
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var manifest AppManifest
+	if err := decoder.Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if manifest.Version != appManifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d (expected %d)", manifest.Version, appManifestVersion)
+	}
+	if strings.TrimSpace(manifest.Name) == "" {
+		return nil, fmt.Errorf("manifest name is required")
+	}
+	if manifest.Source.Image != "" && (manifest.Source.Repo != "" || manifest.Source.Branch != "" || manifest.Source.RootDir != "") {
+		return nil, fmt.Errorf("manifest source must be either a repo or an image, not both")
+	}
+	if manifest.Source.Image == "" && manifest.Source.Repo == "" {
+		return nil, fmt.Errorf("manifest source needs a repo or an image")
+	}
+	return &manifest, nil
+}
+
+// appImportPlan is a validated manifest turned into what the import creates
+type appImportPlan struct {
+	envVars        []CreateEnvVarRequest
+	missingEnv     []string
+	buildStrategy  string
+	releaseCommand string
+	domains        []string
+	cronJobs       []*CronJob
+}
+
+// planAppImport validates everything the manifest asks for before the app is created, so a bad manifest
+// does not leave a half-imported app behind. env holds the values supplied for the manifest's env keys
+func (h *Handlers) planAppImport(manifest *AppManifest, env map[string]string) (*appImportPlan, error) {
+	plan := &appImportPlan{missingEnv: []string{}}
+
+	declared := make(map[string]bool, len(manifest.Env))
+	for _, key := range manifest.Env {
+		if err := services.ValidateEnvKey(key); err != nil {
+			return nil, err
+		}
+		if declared[key] {
+			return nil, fmt.Errorf("env key %s is listed more than once", key)
+		}
+		declared[key] = true
+		if value, ok := env[key]; ok {
+			plan.envVars = append(plan.envVars, CreateEnvVarRequest{Key: key, Value: value})
+		} else {
+			plan.missingEnv = append(plan.missingEnv, key)
+		}
+	}
+	for key := range env {
+		if !declared[key] {
+			return nil, fmt.Errorf("env key %s is not declared in the manifest", key)
+		}
+	}
+
+	if build := manifest.Build; build != nil {
+		if manifest.Source.Image != "" {
+			return nil, fmt.Errorf("image apps are not built - omit build from the manifest")
+		}
+		if build.Strategy != "" {
+			plan.buildStrategy = strings.ToLower(strings.TrimSpace(build.Strategy))
+			if !services.ValidBuildStrategy(plan.buildStrategy) {
+				return nil, fmt.Errorf("build strategy must be dockerfile, buildpacks or nixpacks")
+			}
+		}
+		plan.releaseCommand = strings.TrimSpace(build.ReleaseCommand)
+		if len(plan.releaseCommand) > maxExecCommandLength {
+			return nil, fmt.Errorf("release_command must be at most %d characters", maxExecCommandLength)
+		}
+	}
+
+	if len(manifest.Domains) > 0 && h.domainRepo == nil {
+		return nil, fmt.Errorf("custom domains are not available")
+	}
+	seenDomains := make(map[string]bool, len(manifest.Domains))
+	for _, d := range manifest.Domains {
+		domain, err := h.domainVerifier.NormalizeDomain(d)
+		if err != nil {
+			return nil, err
+		}
+		if !seenDomains[domain] {
+			seenDomains[domain] = true
+			plan.domains = append(plan.domains, domain)
+		}
+	}
+
+	if len(manifest.Cron) > 0 && h.cronRepo == nil {
+		return nil, fmt.Errorf("cron jobs are not available")
+	}
+	if len(manifest.Cron) > maxCronJobsPerApp {
+		return nil, fmt.Errorf("apps can have at most %d cron jobs", maxCronJobsPerApp)
+	}
+	seenJobs := make(map[string]bool, len(manifest.Cron))
+	for i := range manifest.Cron {
+		c := &manifest.Cron[i]
+		job := &CronJob{TimeoutSeconds: defaultCronTimeout, Enabled: true}
+		req := CronJobRequest{Name: &c.Name, Schedule: &c.Schedule, Command: &c.Command, Enabled: c.Enabled}
+		if c.TimeoutSeconds != 0 {
+			req.TimeoutSeconds = &c.TimeoutSeconds
+		}
+		if _, err := applyCronJobRequest(job, &req); err != nil {
+			return nil, fmt.Errorf("cron job %q: %v", c.Name, err)
+		}
+		if seenJobs[job.Name] {
+			return nil, fmt.Errorf("cron job %q is listed more than once", job.Name)
+		}
+		seenJobs[job.Name] = true
+		plan.cronJobs = append(plan.cronJobs, job)
+	}
+
+	return plan, nil
+}
+
+// applyAppImport applies the parts of an import plan that CreateApp does not cover to the new app,
+// before its first deployment. It returns what could not be applied as warnings
+func (h *Handlers) applyAppImport(r *http.Request, app *App, manifest *AppManifest, plan *appImportPlan) ([]string, error) {
+	ctx := r.Context()
+	var warnings []string
+
+	if plan.buildStrategy != "" {
+		if err := h.appRepo.SetBuildStrategy(ctx, app.ID, plan.buildStrategy); err != nil {
+			return warnings, err
+		}
+	}
+	if plan.releaseCommand != "" {
+		if err := h.appRepo.SetReleaseCommand(ctx, app.ID, plan.releaseCommand); err != nil {
+			return warnings, err
+		}
+	}
+
+	// Allocations are not configurable, so a manifest from an app with a different one only gets a warning
+	if res := manifest.Resources; res != nil {
+		ramMB, diskGB, err := h.appRepo.GetAppResources(ctx, app.ID)
+		if err != nil {
+			return warnings, err
+		}
+		if res.RAMMB != ramMB || res.DiskGB != diskGB {
+			warnings = append(warnings, fmt.Sprintf("resources: apps are allocated %d MB RAM and %d GB disk - the manifest's allocation was not applied", ramMB, diskGB))
+		}
+	}
+
+	if len(plan.domains) > 0 && h.planEnforcement != nil {
+		if err := h.planEnforcement.CheckCustomDomains(ctx, app.UserID); err != nil {
+			warnings = append(warnings, "domains: "+planLimitMessage(err))
+			plan.domains = nil
+		}
+	}
+	for _, domain := range plan.domains {
+		token, err := h.domainVerifier.GenerateVerificationToken()
+		if err != nil {
+			return warnings, err
+		}
+		if _, err := h.domainRepo.CreateDomain(ctx, app.ID, domain, token); err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				warnings = append(warnings, fmt.Sprintf("domains: %s is already attached to an app", domain))
+				continue
+			}
+			return warnings, err
+		}
+	}
+
+	for _, job := range plan.cronJobs {
+		job.AppID = app.ID
+		nextRunAt, err := applyCronJobRequest(job, &CronJobRequest{})
+		if err != nil {
+			return warnings, err
+		}
+		if _, err := h.cronRepo.CreateCronJob(ctx, job, nextRunAt); err != nil {
+			return warnings, err
+		}
+	}
+
+	return warnings, nil
+}
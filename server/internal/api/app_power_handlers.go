@@ -0,0 +1,178 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/tasks"
+)
+
+// AppPowerResponse is the response of stopping or starting an app. The deploy worker does the work;
+// the app's status moves on to stopped or running (or failed) once it is done
+type AppPowerResponse struct {
+	Message string `json:"message"`
+	AppID   string `json:"app_id"`
+	Status  string `json:"status"` // stopping or starting
+}
+
+// POST /api/v1/apps/{id}/stop - Stop the app's containers; they no longer count against the plan's RAM
+func (h *Handlers) StopApp(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getAppForPowerChange(w, r, false)
+	if !ok {
+		return
+	}
+	h.stopApp(w, r, app)
+}
+
+// POST /api/v1/apps/{id}/start - Start a stopped app's containers again
+func (h *Handlers) StartApp(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getAppForPowerChange(w, r, false)
+	if !ok {
+		return
+	}
+	h.startApp(w, r, app)
+}
+
+// getAppForPowerChange loads the app being stopped or started, checking ownership unless an admin asks
+func (h *Handlers) getAppForPowerChange(w http.ResponseWriter, r *http.Request, admin bool) (*App, bool) {
+	appID := chi.URLParam(r, "id")
+
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return nil, false
+	}
+	if h.appRepo == nil {
+		h.logger.Error("App repository not initialized")
+		h.writeError(w, http.StatusInternalServerError, "App repository not available")
+		return nil, false
+	}
+
+	var app *App
+	var err error
+	if admin {
+		app, err = h.appRepo.GetAppByIDWithoutUserCheck(appID)
+	} else {
+		app, err = h.appRepo.GetAppByID(appID, userID)
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return nil, false
+		}
+		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to get app")
+		return nil, false
+	}
+	if admin {
+		noteAuditSubject(r, app.UserID, "")
+	}
+	return app, true
+}
+
+// stopApp moves the app to stopping and queues stopping its containers on the deploy worker
+func (h *Handlers) stopApp(w http.ResponseWriter, r *http.Request, app *App) {
+	if app.Status == "disabled" {
+		h.writeError(w, http.StatusForbidden, app.StatusReason)
+		return
+	}
+	if h.taskEnqueue == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Task queue not available")
+		return
+	}
+
+	started, err := h.appRepo.StartAppStop(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to stop app")
+		return
+	}
+	if !started {
+		h.writeError(w, http.StatusConflict, fmt.Sprintf("App cannot be stopped while it is %s", app.Status))
+		return
+	}
+
+	h.queueAppPowerChange(w, r, app, tasks.AppPowerStop, "stopping")
+}
+
+// startApp checks the owner's plan has room for the app's RAM again, moves the app to starting and queues
+// starting its containers on the deploy worker
+func (h *Handlers) startApp(w http.ResponseWriter, r *http.Request, app *App) {
+	if app.Status == "disabled" {
+		h.writeError(w, http.StatusForbidden, app.StatusReason)
+		return
+	}
+	if app.Status != "stopped" {
+		h.writeError(w, http.StatusConflict, fmt.Sprintf("Only stopped apps can be started - the app is %s", app.Status))
+		return
+	}
+	if h.taskEnqueue == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Task queue not available")
+		return
+	}
+
+	// The app's RAM was handed back when it stopped, so it has to fit in the plan again
+	if h.planEnforcement != nil {
+		ramMB, _, err := h.appRepo.GetAppResources(r.Context(), app.ID)
+		if err != nil {
+			h.logger.Error("Failed to get app resources", zap.Error(err), zap.String("app_id", app.ID))
+			h.writeError(w, http.StatusInternalServerError, "Failed to start app")
+			return
+		}
+		if err := h.planEnforcement.CheckMaxRAM(r.Context(), app.UserID, ramMB); err != nil {
+			if planErr, ok := GetPlanLimitError(err); ok {
+				writePlanLimitError(w, planErr)
+				return
+			}
+			h.logger.Error("Failed to check RAM quota", zap.Error(err), zap.String("app_id", app.ID))
+			h.writeError(w, http.StatusInternalServerError, "Failed to start app")
+			return
+		}
+	}
+
+	started, err := h.appRepo.StartAppStart(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to start app")
+		return
+	}
+	if !started {
+		h.writeError(w, http.StatusConflict, "Only stopped apps can be started - the app's status changed meanwhile")
+		return
+	}
+
+	h.queueAppPowerChange(w, r, app, tasks.AppPowerStart, "starting")
+}
+
+// queueAppPowerChange queues the stop or start of an app already moved to status, putting the app back
+// in its previous status when the task cannot be queued
+func (h *Handlers) queueAppPowerChange(w http.ResponseWriter, r *http.Request, app *App, action, status string) {
+	payload := tasks.AppPowerTaskPayload{
+		AppID:       app.ID,
+		UserID:      app.UserID,
+		Action:      action,
+		TriggeredBy: h.getUserIDFromContext(r),
+	}
+	if _, err := h.taskEnqueue.EnqueueAppPowerTask(r.Context(), app.ID, action, payload); err != nil {
+		h.logger.Error("Failed to enqueue app power task", zap.Error(err), zap.String("app_id", app.ID), zap.String("action", action))
+		if err := h.appRepo.RevertAppPowerChange(r.Context(), app.ID, app.Status); err != nil {
+			h.logger.Error("Failed to restore app status", zap.Error(err), zap.String("app_id", app.ID))
+		}
+		h.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to %s app", action))
+		return
+	}
+
+	h.logger.Info("App power change queued",
+		zap.String("app_id", app.ID),
+		zap.String("action", action),
+		zap.String("triggered_by", payload.TriggeredBy),
+	)
+	h.writeJSON(w, http.StatusAccepted, AppPowerResponse{
+		Message: fmt.Sprintf("App is %s", status),
+		AppID:   app.ID,
+		Status:  status,
+	})
+}
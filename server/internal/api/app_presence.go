@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// presenceStaleAfter is how old a presence snapshot may be before it no longer says anything about right
+// now (the deploy worker samples every 10 seconds)
+const presenceStaleAfter = 30 * time.Second
+
+// AppPresence is the response for GET /api/v1/apps/{id}/presence
+type AppPresence struct {
+	AppID              string `json:"app_id"`
+	Serving            bool   `json:"serving"`              // Requests in the window or connections open right now
+	RequestsLastMinute int64  `json:"requests_last_minute"` // Requests Traefik routed to the app over window_seconds
+	OpenConnections    *int   `json:"open_connections"`     // Connections Traefik holds to the app (WebSockets, keep-alive); null when unknown
+	WindowSeconds      int    `json:"window_seconds"`       // Up to 60; shorter just after the deploy worker started
+	SampledAt          string `json:"sampled_at,omitempty"`
+	Stale              bool   `json:"stale"` // No recent snapshot - presence is unknown, not idle
+}
+
+// GetAppPresence reports whether an app is actually receiving traffic right now
+// GET /api/v1/apps/{id}/presence - Derived from Traefik's metrics and connections, sampled by the deploy worker
+func (h *Handlers) GetAppPresence(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+
+	presence, err := h.appRepo.GetAppPresence(r.Context(), app.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Nothing sampled yet: the deploy worker is not sampling or the app never ran
+			h.writeJSON(w, http.StatusOK, AppPresence{AppID: app.ID, Stale: true})
+			return
+		}
+		h.logger.Error("Failed to get app presence", zap.Error(err), zap.String("app_id", app.ID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app presence")
+		return
+	}
+
+	presence.Serving = !presence.Stale &&
+		(presence.RequestsLastMinute > 0 || (presence.OpenConnections != nil && *presence.OpenConnections > 0))
+	h.writeJSON(w, http.StatusOK, presence)
+}
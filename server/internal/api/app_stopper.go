@@ -7,10 +7,19 @@ import (
 	"go.uber.org/zap"
 )
 
+// billingInactiveReason is shown on apps stopped because the trial or subscription ended
+const billingInactiveReason = "Disabled: your trial or subscription has ended. Upgrade your plan to re-enable this app."
+
+// RAMReleaser releases the plan RAM an app holds once its containers are gone
+type RAMReleaser interface {
+	ReleaseAppRAM(ctx context.Context, appID string)
+}
+
 // AppStopperImpl implements services.AppStopper to stop all apps for a user
 type AppStopperImpl struct {
 	appRepo          *AppRepo
 	deploymentService DeploymentService
+	ramReleaser      RAMReleaser // Optional - stopped apps stop counting against the RAM quota
 	logger           *zap.Logger
 }
 
@@ -23,6 +32,11 @@ func NewAppStopper(appRepo *AppRepo, deploymentService DeploymentService, logger
 	}
 }
 
+// SetRAMReleaser releases an app's RAM quota when its containers are stopped
+func (s *AppStopperImpl) SetRAMReleaser(ramReleaser RAMReleaser) {
+	s.ramReleaser = ramReleaser
+}
+
 // StopAllUserApps stops all running apps for a user
 func (s *AppStopperImpl) StopAllUserApps(ctx context.Context, userID string) error {
 	// Get all apps for the user
@@ -44,7 +58,7 @@ func (s *AppStopperImpl) StopAllUserApps(ctx context.Context, userID string) err
 	// Stop each app and mark as disabled
 	for _, app := range apps {
 		// Mark app as disabled in database (idempotent - safe to run multiple times)
-		if err := s.appRepo.UpdateApp(app.ID, "disabled", ""); err != nil {
+		if err := s.appRepo.DisableApp(ctx, app.ID, billingInactiveReason); err != nil {
 			s.logger.Warn("Failed to mark app as disabled",
 				zap.Error(err),
 				zap.String("app_id", app.ID),
@@ -65,6 +79,7 @@ func (s *AppStopperImpl) StopAllUserApps(ctx context.Context, userID string) err
 				)
 				// Continue stopping other apps even if one fails
 			} else {
+				s.releaseRAM(ctx, app.ID)
 				s.logger.Info("Stopped app containers",
 					zap.String("app_id", app.ID),
 					zap.String("app_name", app.Name),
@@ -88,3 +103,41 @@ func (s *AppStopperImpl) StopAllUserApps(ctx context.Context, userID string) err
 	return nil
 }
 
+
+// PauseApp disables a single app and stops its containers, recording the reason on the app
+func (s *AppStopperImpl) PauseApp(ctx context.Context, appID, reason string) error {
+	if err := s.appRepo.DisableApp(ctx, appID, reason); err != nil {
+		return fmt.Errorf("failed to disable app: %w", err)
+	}
+
+	if s.deploymentService != nil {
+		// Cleanup app resources (stops containers)
+		if err := s.deploymentService.CleanupAppResources(ctx, appID); err != nil {
+			s.logger.Warn("Failed to stop app containers",
+				zap.Error(err),
+				zap.String("app_id", appID),
+			)
+			// App is already marked disabled - containers will be cleaned up on next cleanup run
+		} else {
+			s.releaseRAM(ctx, appID)
+		}
+	} else {
+		s.logger.Warn("Deployment service not available, cannot stop app containers",
+			zap.String("app_id", appID),
+		)
+	}
+
+	s.logger.Info("App paused",
+		zap.String("app_id", appID),
+		zap.String("reason", reason),
+	)
+
+	return nil
+}
+
+// releaseRAM hands back the RAM quota of an app whose containers were stopped
+func (s *AppStopperImpl) releaseRAM(ctx context.Context, appID string) {
+	if s.ramReleaser != nil {
+		s.ramReleaser.ReleaseAppRAM(ctx, appID)
+	}
+}
@@ -0,0 +1,417 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/services"
+)
+
+// appTransferTTL is how long a transfer can be accepted
+const appTransferTTL = 7 * 24 * time.Hour
+
+// AppTransferRequest is the body for POST /api/v1/apps/{id}/transfer
+// Exactly one of ToEmail (a user's account email) and ToOrganizationID is required
+type AppTransferRequest struct {
+	ToEmail          string `json:"to_email,omitempty"`
+	ToOrganizationID string `json:"to_organization_id,omitempty"`
+}
+
+// AppTransferHandlers handles moving apps between users and organizations
+// The sender offers the app; it only moves once the recipient accepts and its plan has room for it
+type AppTransferHandlers struct {
+	logger          *zap.Logger
+	appRepo         *AppRepo
+	orgRepo         *OrganizationRepo
+	userRepo        *UserRepo
+	transferRepo    *AppTransferRepo
+	planEnforcement PlanEnforcementService
+	usageService    *services.UsageService
+}
+
+// NewAppTransferHandlers creates a new app transfer handlers instance
+func NewAppTransferHandlers(logger *zap.Logger, appRepo *AppRepo, orgRepo *OrganizationRepo, userRepo *UserRepo, transferRepo *AppTransferRepo, planEnforcement PlanEnforcementService, usageService *services.UsageService) *AppTransferHandlers {
+	return &AppTransferHandlers{
+		logger:          logger,
+		appRepo:         appRepo,
+		orgRepo:         orgRepo,
+		userRepo:        userRepo,
+		transferRepo:    transferRepo,
+		planEnforcement: planEnforcement,
+		usageService:    usageService,
+	}
+}
+
+// POST /api/v1/apps/{id}/transfer - Offer the app to another user or an organization (admin or owner)
+// Nothing moves until the recipient accepts at /api/v1/transfers/{transferId}/accept
+func (h *AppTransferHandlers) CreateAppTransfer(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+	userID := h.getUserIDFromContext(r)
+
+	var req AppTransferRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.ToEmail))
+	if (email == "") == (req.ToOrganizationID == "") {
+		h.writeError(w, http.StatusBadRequest, "Exactly one of to_email and to_organization_id is required")
+		return
+	}
+
+	var toUserID string
+	if email != "" {
+		recipient, err := h.userRepo.GetUserByEmail(email)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				h.writeError(w, http.StatusNotFound, fmt.Sprintf("No Stackyn account uses %s", email))
+				return
+			}
+			h.writeError(w, http.StatusInternalServerError, "Failed to look up recipient")
+			return
+		}
+		if recipient.ID == app.UserID && app.OrganizationID == "" {
+			h.writeError(w, http.StatusBadRequest, "The app already belongs to this user")
+			return
+		}
+		toUserID = recipient.ID
+	} else {
+		if _, err := h.orgRepo.GetOrganizationByID(r.Context(), req.ToOrganizationID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				h.writeError(w, http.StatusNotFound, "Organization not found")
+				return
+			}
+			h.writeError(w, http.StatusInternalServerError, "Failed to look up organization")
+			return
+		}
+		if req.ToOrganizationID == app.OrganizationID {
+			h.writeError(w, http.StatusBadRequest, "The app already belongs to this organization")
+			return
+		}
+	}
+
+	transfer, err := h.transferRepo.CreateAppTransfer(r.Context(), app, toUserID, req.ToOrganizationID, userID, time.Now().Add(appTransferTTL))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			h.writeError(w, http.StatusConflict, "The app already has a pending transfer. Cancel it before starting another")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to create transfer")
+		return
+	}
+	noteAuditDetail(r, "transfer_id", transfer.ID)
+
+	h.logger.Info("App transfer requested",
+		zap.String("app_id", app.ID),
+		zap.String("transfer_id", transfer.ID),
+		zap.String("to_user_id", toUserID),
+		zap.String("to_organization_id", req.ToOrganizationID),
+		zap.String("requested_by", userID),
+	)
+
+	h.writeJSON(w, http.StatusCreated, transfer)
+}
+
+// GET /api/v1/apps/{id}/transfer - Get the app's pending transfer
+func (h *AppTransferHandlers) GetAppTransfer(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+
+	transfer, err := h.transferRepo.GetPendingAppTransfer(r.Context(), app.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "The app has no pending transfer")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve transfer")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, transfer)
+}
+
+// DELETE /api/v1/apps/{id}/transfer - Cancel the app's pending transfer (admin or owner)
+func (h *AppTransferHandlers) CancelAppTransfer(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+
+	transfer, err := h.transferRepo.GetPendingAppTransfer(r.Context(), app.ID)
+	if err == nil {
+		err = h.transferRepo.ResolveAppTransfer(r.Context(), transfer.ID, "cancelled", h.getUserIDFromContext(r))
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "The app has no pending transfer")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to cancel transfer")
+		return
+	}
+
+	h.logger.Info("App transfer cancelled", zap.String("app_id", app.ID), zap.String("transfer_id", transfer.ID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/v1/transfers - List pending transfers the user can accept (to them, or to organizations they administer)
+func (h *AppTransferHandlers) ListIncomingTransfers(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	transfers, err := h.transferRepo.ListIncomingAppTransfers(r.Context(), userID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve transfers")
+		return
+	}
+	if transfers == nil {
+		transfers = []*AppTransfer{}
+	}
+	h.writeJSON(w, http.StatusOK, transfers)
+}
+
+// POST /api/v1/transfers/{transferId}/accept - Accept a transfer, moving the app to the recipient
+// The recipient's plan must have room for the app (apps, RAM, and the custom domains and workers it uses)
+func (h *AppTransferHandlers) AcceptTransfer(w http.ResponseWriter, r *http.Request) {
+	transfer, ownerID, ok := h.getIncomingTransfer(w, r)
+	if !ok {
+		return
+	}
+	userID := h.getUserIDFromContext(r)
+	noteAuditDetail(r, "app_id", transfer.AppID)
+
+	// Moving between the owner's own account and organizations changes no one's plan usage
+	if ownerID != transfer.FromUserID {
+		if !h.checkDestinationPlan(w, r, transfer, ownerID) {
+			return
+		}
+	}
+
+	if err := h.transferRepo.CompleteAppTransfer(r.Context(), transfer, ownerID, transfer.ToOrganizationID, userID); err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			h.writeError(w, http.StatusConflict, fmt.Sprintf("The recipient already has an app named %s. Rename one of them before accepting", transfer.AppName))
+		case errors.Is(err, pgx.ErrNoRows):
+			h.writeError(w, http.StatusConflict, "The transfer is no longer pending, or the app changed owner since it was offered")
+		default:
+			h.writeError(w, http.StatusInternalServerError, "Failed to transfer app")
+		}
+		return
+	}
+
+	if ownerID != transfer.FromUserID {
+		// The sender stops paying for the app's RAM; RAM reconciliation charges the new owner for its running containers
+		if h.planEnforcement != nil {
+			h.planEnforcement.ReleaseAppRAM(r.Context(), transfer.AppID)
+		}
+		if h.usageService != nil {
+			h.usageService.InvalidateUser(transfer.FromUserID)
+			h.usageService.InvalidateUser(ownerID)
+		}
+	}
+
+	h.logger.Info("App transfer accepted",
+		zap.String("app_id", transfer.AppID),
+		zap.String("transfer_id", transfer.ID),
+		zap.String("from_user_id", transfer.FromUserID),
+		zap.String("owner_id", ownerID),
+		zap.String("organization_id", transfer.ToOrganizationID),
+		zap.String("accepted_by", userID),
+	)
+
+	accepted, err := h.transferRepo.GetAppTransfer(r.Context(), transfer.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve transfer")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, accepted)
+}
+
+// POST /api/v1/transfers/{transferId}/decline - Decline a transfer; the app stays where it is
+func (h *AppTransferHandlers) DeclineTransfer(w http.ResponseWriter, r *http.Request) {
+	transfer, _, ok := h.getIncomingTransfer(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.transferRepo.ResolveAppTransfer(r.Context(), transfer.ID, "declined", h.getUserIDFromContext(r)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusConflict, "The transfer is no longer pending")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to decline transfer")
+		return
+	}
+
+	h.logger.Info("App transfer declined", zap.String("app_id", transfer.AppID), zap.String("transfer_id", transfer.ID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkDestinationPlan checks the new owner's billing and plan have room for the transferred app,
+// writing the error response when they do not
+func (h *AppTransferHandlers) checkDestinationPlan(w http.ResponseWriter, r *http.Request, transfer *AppTransfer, ownerID string) bool {
+	owner, err := h.userRepo.GetUserByID(ownerID)
+	if err != nil {
+		h.logger.Error("Failed to get transfer recipient", zap.Error(err), zap.String("user_id", ownerID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to verify billing status")
+		return false
+	}
+	if err := RequireWritableBilling(owner, http.MethodPost); err != nil {
+		h.writeError(w, http.StatusPaymentRequired, err.Error())
+		return false
+	}
+	if h.planEnforcement == nil {
+		return true
+	}
+
+	footprint, err := h.transferRepo.GetAppFootprint(r.Context(), transfer.AppID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to check plan limits")
+		return false
+	}
+
+	appCount := func() (int, error) { return h.appRepo.GetAppCountByUserID(ownerID) }
+	if err := checkPlanRoom(r.Context(), h.planEnforcement, ownerID, footprint, appCount); err != nil {
+		if planErr, ok := GetPlanLimitError(err); ok {
+			h.logger.Info("App transfer blocked by recipient plan",
+				zap.String("transfer_id", transfer.ID),
+				zap.String("owner_id", ownerID),
+				zap.String("limit", planErr.Limit),
+			)
+			writePlanLimitError(w, planErr)
+			return false
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to check plan limits")
+		return false
+	}
+	return true
+}
+
+// checkPlanRoom checks ownerID's plan has room for an app with footprint, returning the first limit it
+// exceeds. Disabled apps only count for the features they use; appCount is the owner's current app count
+func checkPlanRoom(ctx context.Context, plan PlanEnforcementService, ownerID string, footprint *AppFootprint, appCount func() (int, error)) error {
+	if footprint.Enabled {
+		count, err := appCount()
+		if err != nil {
+			return err
+		}
+		if err := plan.CheckMaxApps(ctx, ownerID, count); err != nil {
+			return err
+		}
+		if err := plan.CheckMaxRAM(ctx, ownerID, footprint.RAMMB); err != nil {
+			return err
+		}
+	}
+	if footprint.CustomDomains > 0 {
+		if err := plan.CheckCustomDomains(ctx, ownerID); err != nil {
+			return err
+		}
+	}
+	if footprint.Workers > 0 {
+		if err := plan.CheckWorkers(ctx, ownerID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getIncomingTransfer loads the {transferId} transfer if the user may accept it, and the user the app will
+// belong to (the recipient, or the owner of the recipient organization)
+// Transfers the user cannot act on get 404 so transfer IDs can't be probed
+func (h *AppTransferHandlers) getIncomingTransfer(w http.ResponseWriter, r *http.Request) (*AppTransfer, string, bool) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return nil, "", false
+	}
+
+	transfer, err := h.transferRepo.GetAppTransfer(r.Context(), chi.URLParam(r, "transferId"))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Transfer not found")
+			return nil, "", false
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve transfer")
+		return nil, "", false
+	}
+
+	ownerID := transfer.ToUserID
+	if transfer.ToOrganizationID != "" {
+		org, err := h.orgRepo.GetOrganizationForMember(r.Context(), transfer.ToOrganizationID, userID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusInternalServerError, "Failed to retrieve organization")
+			return nil, "", false
+		}
+		if err != nil || !HasOrgRole(org.Role, OrgRoleAdmin) {
+			h.writeError(w, http.StatusNotFound, "Transfer not found")
+			return nil, "", false
+		}
+		ownerID = org.OwnerID
+	} else if transfer.ToUserID != userID {
+		h.writeError(w, http.StatusNotFound, "Transfer not found")
+		return nil, "", false
+	}
+
+	if transfer.Status != "pending" {
+		h.writeError(w, http.StatusConflict, fmt.Sprintf("The transfer was already %s", transfer.Status))
+		return nil, "", false
+	}
+	if transfer.Expired {
+		h.writeError(w, http.StatusGone, "This transfer has expired. Ask the sender to transfer the app again")
+		return nil, "", false
+	}
+	return transfer, ownerID, true
+}
+
+// getApp loads the {id} app (access is checked by AppAccessMiddleware), writing the error response when it cannot
+func (h *AppTransferHandlers) getApp(w http.ResponseWriter, r *http.Request) (*App, bool) {
+	app, err := h.appRepo.GetAppByID(chi.URLParam(r, "id"), h.getUserIDFromContext(r))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return nil, false
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return nil, false
+	}
+	return app, true
+}
+
+func (h *AppTransferHandlers) getUserIDFromContext(r *http.Request) string {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		h.logger.Warn("User ID not found in context")
+		return ""
+	}
+	return userID
+}
+
+func (h *AppTransferHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *AppTransferHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
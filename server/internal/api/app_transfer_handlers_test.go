@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"stackyn/server/internal/services"
+)
+
+// recipientPlan is a PlanEnforcementService for a recipient with maxApps apps and maxRAMMB of RAM, already
+// using usedRAMMB, whose plan may or may not include custom domains and workers. It records the checks made
+type recipientPlan struct {
+	PlanEnforcementService // Checks the transfer does not make panic
+	maxApps                int
+	maxRAMMB, usedRAMMB    int
+	customDomains, workers bool
+	checked                []string
+}
+
+func (p *recipientPlan) CheckMaxApps(ctx context.Context, userID string, currentAppCount int) error {
+	p.checked = append(p.checked, "apps")
+	if currentAppCount >= p.maxApps {
+		return &services.PlanLimitError{Limit: "apps", Current: currentAppCount, Max: p.maxApps, UserID: userID}
+	}
+	return nil
+}
+
+func (p *recipientPlan) CheckMaxRAM(ctx context.Context, userID string, requestedRAMMB int) error {
+	p.checked = append(p.checked, "ram")
+	if p.usedRAMMB+requestedRAMMB > p.maxRAMMB {
+		return &services.PlanLimitError{Limit: "ram", Current: p.usedRAMMB, Requested: requestedRAMMB, Max: p.maxRAMMB, UserID: userID}
+	}
+	return nil
+}
+
+func (p *recipientPlan) CheckCustomDomains(ctx context.Context, userID string) error {
+	p.checked = append(p.checked, "custom_domains")
+	if !p.customDomains {
+		return &services.PlanLimitError{Limit: "custom_domains", UserID: userID}
+	}
+	return nil
+}
+
+func (p *recipientPlan) CheckWorkers(ctx context.Context, userID string) error {
+	p.checked = append(p.checked, "workers")
+	if !p.workers {
+		return &services.PlanLimitError{Limit: "workers", UserID: userID}
+	}
+	return nil
+}
+
+func TestCheckPlanRoom(t *testing.T) {
+	roomy := recipientPlan{maxApps: 5, maxRAMMB: 2048, usedRAMMB: 512, customDomains: true, workers: true}
+	tests := []struct {
+		name        string
+		plan        recipientPlan
+		appCount    int
+		footprint   AppFootprint
+		wantLimit   string // "" when the app fits
+		wantChecked []string
+	}{
+		{"fits", roomy, 1, AppFootprint{Enabled: true, RAMMB: 512, CustomDomains: 1, Workers: 1}, "",
+			[]string{"apps", "ram", "custom_domains", "workers"}},
+		{"no app slot", recipientPlan{maxApps: 1, maxRAMMB: 2048}, 1, AppFootprint{Enabled: true, RAMMB: 512}, "apps",
+			[]string{"apps"}},
+		{"not enough RAM", recipientPlan{maxApps: 5, maxRAMMB: 1024, usedRAMMB: 768}, 1, AppFootprint{Enabled: true, RAMMB: 512}, "ram",
+			[]string{"apps", "ram"}},
+		{"plan without custom domains", recipientPlan{maxApps: 5, maxRAMMB: 2048, workers: true}, 1,
+			AppFootprint{Enabled: true, RAMMB: 512, CustomDomains: 2}, "custom_domains",
+			[]string{"apps", "ram", "custom_domains"}},
+		{"plan without workers", recipientPlan{maxApps: 5, maxRAMMB: 2048, customDomains: true}, 1,
+			AppFootprint{Enabled: true, RAMMB: 512, Workers: 1}, "workers",
+			[]string{"apps", "ram", "workers"}},
+		{"disabled app takes no app slot or RAM", recipientPlan{maxApps: 1, maxRAMMB: 0, customDomains: true}, 1,
+			AppFootprint{RAMMB: 512, CustomDomains: 1}, "",
+			[]string{"custom_domains"}},
+		{"disabled app still needs the features it uses", recipientPlan{maxApps: 5, maxRAMMB: 2048}, 1,
+			AppFootprint{Workers: 1}, "workers",
+			[]string{"workers"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := tt.plan
+			appCount := func() (int, error) { return tt.appCount, nil }
+			err := checkPlanRoom(context.Background(), &plan, "owner-1", &tt.footprint, appCount)
+
+			if tt.wantLimit == "" {
+				if err != nil {
+					t.Errorf("checkPlanRoom: %v", err)
+				}
+			} else if planErr, ok := GetPlanLimitError(err); !ok || planErr.Limit != tt.wantLimit || planErr.UserID != "owner-1" {
+				t.Errorf("checkPlanRoom err = %v, want the owner's %s limit", err, tt.wantLimit)
+			}
+			if !reflect.DeepEqual(plan.checked, tt.wantChecked) {
+				t.Errorf("checked %v, want %v", plan.checked, tt.wantChecked)
+			}
+		})
+	}
+}
+
+func TestCheckPlanRoomAppCountFailure(t *testing.T) {
+	countErr := errors.New("connection refused")
+	plan := recipientPlan{maxApps: 5, maxRAMMB: 2048}
+	err := checkPlanRoom(context.Background(), &plan, "owner-1", &AppFootprint{Enabled: true, RAMMB: 512},
+		func() (int, error) { return 0, countErr })
+	if !errors.Is(err, countErr) {
+		t.Errorf("checkPlanRoom err = %v, want %v", err, countErr)
+	}
+	if _, ok := GetPlanLimitError(err); ok {
+		t.Error("a failed app count was reported as a plan limit")
+	}
+}
@@ -0,0 +1,300 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/services"
+)
+
+// Limits on app webhooks
+const (
+	maxAppWebhooksPerApp                = 10
+	maxAppWebhookURLLength              = 2048
+	defaultAppWebhookDeliveriesPageSize = 20
+	maxAppWebhookDeliveriesPageSize     = 100
+)
+
+// AppWebhookRequest is the body for POST /api/v1/apps/{id}/webhooks and PATCH /api/v1/apps/{id}/webhooks/{webhookId}
+// On POST, omitted events subscribe to every event; on PATCH, omitted fields keep their current value
+type AppWebhookRequest struct {
+	URL     *string   `json:"url"`
+	Events  *[]string `json:"events"`
+	Enabled *bool     `json:"enabled"`
+}
+
+// AppWebhookHandlers manages outgoing deploy notification webhooks and their delivery log
+type AppWebhookHandlers struct {
+	logger      *zap.Logger
+	appRepo     *AppRepo
+	webhookRepo *AppWebhookRepo
+}
+
+// NewAppWebhookHandlers creates a new app webhook handlers instance
+func NewAppWebhookHandlers(logger *zap.Logger, appRepo *AppRepo, webhookRepo *AppWebhookRepo) *AppWebhookHandlers {
+	return &AppWebhookHandlers{
+		logger:      logger,
+		appRepo:     appRepo,
+		webhookRepo: webhookRepo,
+	}
+}
+
+// GET /api/v1/apps/{id}/webhooks - List the app's webhooks
+func (h *AppWebhookHandlers) ListAppWebhooks(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+
+	hooks, err := h.webhookRepo.GetAppWebhooksByAppID(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve webhooks")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, hooks)
+}
+
+// POST /api/v1/apps/{id}/webhooks - Register a URL for signed build and deploy events
+// The signing secret is only returned in this response
+func (h *AppWebhookHandlers) CreateAppWebhook(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+
+	var req AppWebhookRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.URL == nil {
+		h.writeError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+
+	existing, err := h.webhookRepo.GetAppWebhooksByAppID(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve webhooks")
+		return
+	}
+	if len(existing) >= maxAppWebhooksPerApp {
+		h.writeError(w, http.StatusForbidden, fmt.Sprintf("Apps can have at most %d webhooks", maxAppWebhooksPerApp))
+		return
+	}
+
+	hook := &AppWebhook{AppID: app.ID, Events: services.AppWebhookEvents, Enabled: true}
+	if err := applyAppWebhookRequest(hook, &req); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	secret, err := services.GenerateAppWebhookSecret()
+	if err != nil {
+		h.logger.Error("Failed to generate webhook secret", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+
+	created, err := h.webhookRepo.CreateAppWebhook(r.Context(), app.ID, hook.URL, secret, hook.Events)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+
+	h.logger.Info("App webhook created",
+		zap.String("app_id", app.ID),
+		zap.String("webhook_id", created.ID),
+		zap.Strings("events", created.Events),
+		zap.String("user_id", h.getUserIDFromContext(r)),
+	)
+	h.writeJSON(w, http.StatusCreated, created)
+}
+
+// PATCH /api/v1/apps/{id}/webhooks/{webhookId} - Change a webhook's URL, events or enabled flag
+func (h *AppWebhookHandlers) UpdateAppWebhook(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+	hook, ok := h.getAppWebhook(w, r, app)
+	if !ok {
+		return
+	}
+
+	var req AppWebhookRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := applyAppWebhookRequest(hook, &req); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	updated, err := h.webhookRepo.UpdateAppWebhook(r.Context(), hook)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Webhook not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to update webhook")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, updated)
+}
+
+// DELETE /api/v1/apps/{id}/webhooks/{webhookId} - Delete a webhook and its delivery log
+func (h *AppWebhookHandlers) DeleteAppWebhook(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+	webhookID := chi.URLParam(r, "webhookId")
+
+	if err := h.webhookRepo.DeleteAppWebhook(r.Context(), app.ID, webhookID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Webhook not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to delete webhook")
+		return
+	}
+
+	h.logger.Info("App webhook deleted",
+		zap.String("app_id", app.ID),
+		zap.String("webhook_id", webhookID),
+		zap.String("user_id", h.getUserIDFromContext(r)),
+	)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/v1/apps/{id}/webhooks/{webhookId}/deliveries - List recent deliveries with their
+// attempts, last response and error (?limit=, default 20, max 100)
+func (h *AppWebhookHandlers) ListAppWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+	hook, ok := h.getAppWebhook(w, r, app)
+	if !ok {
+		return
+	}
+
+	limit := defaultAppWebhookDeliveriesPageSize
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxAppWebhookDeliveriesPageSize {
+			h.writeError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := h.webhookRepo.GetAppWebhookDeliveries(r.Context(), hook.ID, limit)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve webhook deliveries")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, deliveries)
+}
+
+// applyAppWebhookRequest validates the request fields that are set and copies them onto hook
+func applyAppWebhookRequest(hook *AppWebhook, req *AppWebhookRequest) error {
+	if req.URL != nil {
+		url := strings.TrimSpace(*req.URL)
+		if len(url) > maxAppWebhookURLLength {
+			return fmt.Errorf("url must be at most %d characters", maxAppWebhookURLLength)
+		}
+		if err := services.ValidateAppWebhookURL(url); err != nil {
+			return err
+		}
+		hook.URL = url
+	}
+	if req.Events != nil {
+		if len(*req.Events) == 0 {
+			return fmt.Errorf("events must not be empty (valid events: %s)", strings.Join(services.AppWebhookEvents, ", "))
+		}
+		seen := make(map[string]bool)
+		events := make([]string, 0, len(*req.Events))
+		for _, event := range *req.Events {
+			if !services.IsAppWebhookEvent(event) {
+				return fmt.Errorf("unknown event %q (valid events: %s)", event, strings.Join(services.AppWebhookEvents, ", "))
+			}
+			if !seen[event] {
+				seen[event] = true
+				events = append(events, event)
+			}
+		}
+		hook.Events = events
+	}
+	if req.Enabled != nil {
+		hook.Enabled = *req.Enabled
+	}
+	return nil
+}
+
+// getApp loads the app from the URL, writing the error response and returning false on failure
+func (h *AppWebhookHandlers) getApp(w http.ResponseWriter, r *http.Request) (*App, bool) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return nil, false
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return nil, false
+		}
+		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return nil, false
+	}
+	return app, true
+}
+
+// getAppWebhook loads the webhook from the URL, writing the error response and returning false on failure
+func (h *AppWebhookHandlers) getAppWebhook(w http.ResponseWriter, r *http.Request, app *App) (*AppWebhook, bool) {
+	hook, err := h.webhookRepo.GetAppWebhookByID(r.Context(), app.ID, chi.URLParam(r, "webhookId"))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Webhook not found")
+			return nil, false
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve webhook")
+		return nil, false
+	}
+	return hook, true
+}
+
+func (h *AppWebhookHandlers) getUserIDFromContext(r *http.Request) string {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		h.logger.Warn("User ID not found in context")
+		return ""
+	}
+	return userID
+}
+
+func (h *AppWebhookHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *AppWebhookHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
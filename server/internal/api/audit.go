@@ -0,0 +1,275 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+)
+
+// Audit actions recorded for security-relevant requests
+const (
+	AuditActionSignup             = "auth.signup"
+	AuditActionLogin              = "auth.login"
+	AuditActionOTPLogin           = "auth.otp_login"
+	AuditActionPasswordReset      = "auth.password_reset"
+	AuditActionTokenCreate        = "token.create"
+	AuditActionTokenRevoke        = "token.revoke"
+	AuditActionEnvVarCreate       = "env_var.create"
+	AuditActionEnvVarImport       = "env_var.import"
+	AuditActionEnvVarUpdate       = "env_var.update"
+	AuditActionEnvVarDelete       = "env_var.delete"
+	AuditActionAppDelete          = "app.delete"
+	AuditActionAppImageUpdate     = "app.image_update"
+	AuditActionAppExec            = "app.exec"
+	AuditActionAppReleaseUpdate   = "app.release_command_update"
+	AuditActionAppIsolationUpdate = "app.isolation_update"
+	AuditActionAppSecretsUpdate   = "app.secret_scan_update"
+	AuditActionAppTransfer        = "app.transfer"
+	AuditActionAppTransferAccept  = "app.transfer_accept"
+	AuditActionAppRoutingUpdate   = "app.routing_update"
+	AuditActionOrgPolicyUpdate    = "org.security_policy_update"
+	AuditActionPlanChange         = "plan.change"
+	AuditActionAdminPlanChange    = "admin.user.plan_change"
+	AuditActionAdminUserDelete    = "admin.user.delete"
+	AuditActionAdminAppStop       = "admin.app.stop"
+	AuditActionAdminAppStart      = "admin.app.start"
+	AuditActionAdminAppRedeploy   = "admin.app.redeploy"
+	AuditActionAdminAppDelete     = "admin.app.delete"
+	AuditActionAdminBillingFix    = "admin.billing.resolve"
+	AuditActionAdminWebhookReplay = "admin.billing.webhook_replay"
+	AuditActionAdminMaintenance   = "admin.maintenance.create"
+	AuditActionAdminCleanup       = "admin.cleanup"
+	AuditActionAdminHostDrain     = "admin.host.drain"
+	AuditActionAdminHostUndrain   = "admin.host.undrain"
+)
+
+// auditNoteKey is the context key of the *auditNote a handler can fill in for its audit entry
+type auditNoteKey struct{}
+
+// auditNote is what a handler knows that the audit middleware does not: who signed in on a public
+// route, and details such as the plan a user moved to
+type auditNote struct {
+	subjectUserID string
+	email         string
+	details       map[string]interface{}
+}
+
+// noteAuditSubject records which account a request acted on, for routes without a signed-in user (login)
+// Does nothing outside Auditor.Record
+func noteAuditSubject(r *http.Request, userID, email string) {
+	if note, ok := r.Context().Value(auditNoteKey{}).(*auditNote); ok {
+		if userID != "" {
+			note.subjectUserID = userID
+		}
+		if email != "" {
+			note.email = email
+		}
+	}
+}
+
+// noteAuditDetail adds a detail to the request's audit entry. Does nothing outside Auditor.Record
+func noteAuditDetail(r *http.Request, key string, value interface{}) {
+	if note, ok := r.Context().Value(auditNoteKey{}).(*auditNote); ok {
+		note.details[key] = value
+	}
+}
+
+// Auditor writes security-relevant requests to the append-only audit log
+type Auditor struct {
+	auditRepo *AuditRepo
+	logger    *zap.Logger
+}
+
+// NewAuditor creates a new auditor
+func NewAuditor(auditRepo *AuditRepo, logger *zap.Logger) *Auditor {
+	return &Auditor{
+		auditRepo: auditRepo,
+		logger:    logger,
+	}
+}
+
+// Record audits every request to the route as action, successful or not, once the handler is done
+// The signed-in user is the actor and, unless the handler notes another account, the subject.
+// Impersonated requests name the admin as the actor. URL parameters (app ID, env var key, token ID)
+// are kept in the details; request bodies never are
+func (a *Auditor) Record(action string) func(http.Handler) http.Handler {
+	return a.record(action, "")
+}
+
+// RecordForUser audits requests that act on the user named by the URL parameter param (admin routes)
+func (a *Auditor) RecordForUser(action, param string) func(http.Handler) http.Handler {
+	return a.record(action, param)
+}
+
+func (a *Auditor) record(action, subjectParam string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			note := &auditNote{details: make(map[string]interface{})}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), auditNoteKey{}, note)))
+
+			entry := AuditEntry{
+				Action:     action,
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				StatusCode: ww.Status(),
+				IP:         requestIP(r),
+				RequestID:  middleware.GetReqID(r.Context()),
+			}
+
+			userID, _ := r.Context().Value("user_id").(string)
+			email, _ := r.Context().Value("user_email").(string)
+			entry.SubjectUserID = userID
+			if impersonationID, ok := r.Context().Value("impersonation_id").(string); ok {
+				entry.ImpersonationID = impersonationID
+				entry.ActorEmail, _ = r.Context().Value("impersonator_email").(string)
+			} else {
+				entry.ActorUserID = userID
+				entry.ActorEmail = email
+			}
+
+			params := make(map[string]string)
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				for i, key := range rctx.URLParams.Keys {
+					if key == subjectParam {
+						entry.SubjectUserID = rctx.URLParams.Values[i]
+						continue
+					}
+					params[key] = rctx.URLParams.Values[i]
+				}
+			}
+			if len(params) > 0 {
+				note.details["params"] = params
+			}
+			if note.subjectUserID != "" {
+				entry.SubjectUserID = note.subjectUserID
+			}
+			if note.email != "" && entry.ActorEmail == "" {
+				entry.ActorEmail = note.email
+			}
+			if note.subjectUserID != "" && entry.ActorUserID == "" && entry.ImpersonationID == "" && entry.StatusCode < 400 {
+				entry.ActorUserID = note.subjectUserID // Signing in, the user acts on their own account
+			}
+			if len(note.details) > 0 {
+				entry.Details = note.details
+			}
+
+			// The request context may be cancelled by now
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			a.RecordEvent(ctx, entry)
+		})
+	}
+}
+
+// RecordEvent writes an entry that does not come from a user request (billing webhooks)
+// A failed write is logged, not returned - auditing never fails the action itself
+func (a *Auditor) RecordEvent(ctx context.Context, entry AuditEntry) {
+	if err := a.auditRepo.RecordAuditEntry(ctx, entry); err != nil {
+		a.logger.Error("Failed to write audit entry",
+			zap.Error(err),
+			zap.String("action", entry.Action),
+			zap.String("subject_user_id", entry.SubjectUserID),
+		)
+	}
+}
+
+// parseAuditQuery reads the filters shared by the audit log listings:
+// ?action= (exact, or a prefix such as auth.*), ?since= and ?until= (RFC 3339) and ?limit= (default 100)
+func parseAuditQuery(r *http.Request) (AuditFilter, int, error) {
+	query := r.URL.Query()
+	filter := AuditFilter{Action: strings.TrimSpace(query.Get("action"))}
+
+	var err error
+	if filter.Since, err = parseAuditTime(query.Get("since"), "since"); err != nil {
+		return filter, 0, err
+	}
+	if filter.Until, err = parseAuditTime(query.Get("until"), "until"); err != nil {
+		return filter, 0, err
+	}
+	if filter.Since != nil && filter.Until != nil && !filter.Until.After(*filter.Since) {
+		return filter, 0, errors.New("until must be after since")
+	}
+
+	limit := 100
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxAuditPageSize {
+			return filter, 0, errors.New("limit must be between 1 and 500")
+		}
+		limit = n
+	}
+	return filter, limit, nil
+}
+
+// parseAuditTime parses an optional RFC 3339 query parameter; audit_log stores UTC
+func parseAuditTime(raw, name string) (*time.Time, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	at, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+	}
+	at = at.UTC()
+	return &at, nil
+}
+
+// AuditHandlers lets users review the audit log of their own account
+type AuditHandlers struct {
+	logger    *zap.Logger
+	auditRepo *AuditRepo
+}
+
+// NewAuditHandlers creates a new audit handlers instance
+func NewAuditHandlers(logger *zap.Logger, auditRepo *AuditRepo) *AuditHandlers {
+	return &AuditHandlers{
+		logger:    logger,
+		auditRepo: auditRepo,
+	}
+}
+
+// GET /api/v1/audit - Audit log entries about the signed-in user's account, newest first
+// Includes what support did while impersonating them. Filters as GET /admin/audit, without user_id
+func (h *AuditHandlers) ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("user_id").(string)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	filter, limit, err := parseAuditQuery(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.InvolvedUserID = userID
+
+	entries, err := h.auditRepo.ListAuditEntries(r.Context(), filter, limit)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve audit log")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, entries)
+}
+
+func (h *AuditHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *AuditHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -19,8 +20,8 @@ type AuthHandlers struct {
 	otpService         *services.OTPService
 	jwtService         *services.JWTService
 	userRepo           UserRepository
-	otpRepo            OTPRepository
 	subscriptionService *services.SubscriptionService
+	authMode           string // builtin | header (see infra.AuthConfig)
 }
 
 // GetJWTService returns the JWT service (for use in handlers)
@@ -34,27 +35,27 @@ type User struct {
 	FullName       string     `json:"full_name,omitempty"`
 	CompanyName    string     `json:"company_name,omitempty"`
 	PasswordHash   string     `json:"-"` // Never return password hash in JSON
-	BillingStatus  string     `json:"billing_status,omitempty"` // trial | active | expired
+	BillingStatus  string     `json:"billing_status,omitempty"` // trial | active | grace | expired
 	Plan           string     `json:"plan,omitempty"`           // free_trial | starter | pro
 	TrialStartedAt *time.Time `json:"trial_started_at,omitempty"`
 	TrialEndsAt    *time.Time `json:"trial_ends_at,omitempty"`
 	SubscriptionID string     `json:"subscription_id,omitempty"`
+	GraceEndsAt    *time.Time `json:"grace_ends_at,omitempty"` // Read-only mode ends and apps stop (billing_status = grace)
+	Timezone       string     `json:"timezone,omitempty"`      // IANA zone name, e.g. Europe/Berlin
+	Locale         string     `json:"locale,omitempty"`        // Language of transactional emails (en, es, de, fr)
+	AvatarURL      string     `json:"avatar_url,omitempty"`
+	AvatarKey      string     `json:"-"` // Object storage key of the current avatar
+	NotificationPreferences services.NotificationPreferences `json:"notification_preferences"`
 }
 
 type UserRepository interface {
 	GetUserByEmail(email string) (*User, error)
 	GetUserByID(userID string) (*User, error)
-	CreateUser(email, fullName, companyName, passwordHash string) (*User, error)
+	CreateUser(email, fullName, companyName, passwordHash, locale string) (*User, error)
 	UpdateUser(userID, fullName, companyName, passwordHash string) (*User, error)
 	UpdateUserBilling(ctx context.Context, userID, billingStatus, plan, subscriptionID string, trialStartedAt, trialEndsAt *time.Time) error
 }
 
-type OTPRepository interface {
-	CreateOTP(email, otpHash string, expiresAt time.Time) error
-	GetOTPByEmail(email string) (otpID, otpHash string, expiresAt time.Time, err error)
-	MarkOTPAsUsed(otpID string) error
-}
-
 type SendOTPRequest struct {
 	Email string `json:"email" validate:"required,email"`
 }
@@ -66,8 +67,19 @@ type SendOTPResponse struct {
 
 type VerifyOTPRequest struct {
 	Email    string `json:"email" validate:"required,email"`
-	OTP      string `json:"otp" validate:"required,len=6"`
-	Password string `json:"password,omitempty"` // Optional password for signup
+	OTP      string `json:"otp" validate:"required,len=6"` // From /send-otp or /signup
+	Password string `json:"password,omitempty" validate:"omitempty,min=8"` // Optional password for signup
+}
+
+type SignupRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8"`
+	FullName string `json:"full_name,omitempty" validate:"max=255"`
+}
+
+type SignupResponse struct {
+	Message string `json:"message"`
+	OTP     string `json:"otp,omitempty"` // Only in development
 }
 
 type VerifyOTPResponse struct {
@@ -86,13 +98,12 @@ type LoginResponse struct {
 	User  User   `json:"user"`
 }
 
-func NewAuthHandlers(logger *zap.Logger, otpService *services.OTPService, jwtService *services.JWTService, userRepo UserRepository, otpRepo OTPRepository, subscriptionService *services.SubscriptionService) *AuthHandlers {
+func NewAuthHandlers(logger *zap.Logger, otpService *services.OTPService, jwtService *services.JWTService, userRepo UserRepository, subscriptionService *services.SubscriptionService) *AuthHandlers {
 	return &AuthHandlers{
 		logger:              logger,
 		otpService:          otpService,
 		jwtService:          jwtService,
 		userRepo:            userRepo,
-		otpRepo:             otpRepo,
 		subscriptionService: subscriptionService,
 	}
 }
@@ -101,8 +112,7 @@ func NewAuthHandlers(logger *zap.Logger, otpService *services.OTPService, jwtSer
 // POST /api/auth/send-otp
 func (h *AuthHandlers) SendOTP(w http.ResponseWriter, r *http.Request) {
 	var req SendOTPRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
@@ -113,19 +123,14 @@ func (h *AuthHandlers) SendOTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate and send OTP
-	otp, err := h.otpService.SendOTP(req.Email)
+	otp, err := h.otpService.SendOTP(req.Email, h.emailLocale(r, req.Email))
 	if err != nil {
 		h.logger.Error("Failed to send OTP", 
 			zap.Error(err), 
 			zap.String("email", req.Email),
 			zap.String("error_type", fmt.Sprintf("%T", err)),
 		)
-		// Return more detailed error message for debugging
-		errorMsg := "Failed to send OTP"
-		if err != nil {
-			errorMsg = fmt.Sprintf("Failed to send OTP: %v", err)
-		}
-		h.writeError(w, http.StatusInternalServerError, errorMsg)
+		h.writeError(w, http.StatusInternalServerError, "Failed to send OTP")
 		return
 	}
 
@@ -146,63 +151,111 @@ func (h *AuthHandlers) SendOTP(w http.ResponseWriter, r *http.Request) {
 	h.writeJSON(w, http.StatusOK, response)
 }
 
-// VerifyOTP verifies an OTP and returns a JWT token
-// POST /api/auth/verify-otp
-func (h *AuthHandlers) VerifyOTP(w http.ResponseWriter, r *http.Request) {
-	var req VerifyOTPRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+// Signup starts an email+password signup by emailing a code to verify the address
+// The account is created, with its trial, when the code is verified at /api/auth/verify-otp
+// POST /api/auth/signup
+func (h *AuthHandlers) Signup(w http.ResponseWriter, r *http.Request) {
+	var req SignupRequest
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
-	// Validate email
 	if !ValidateEmail(req.Email) {
 		h.writeError(w, http.StatusBadRequest, "Invalid email address")
 		return
 	}
+	noteAuditSubject(r, "", req.Email)
 
-	// Validate OTP format
-	if len(req.OTP) != 6 {
-		h.writeError(w, http.StatusBadRequest, "OTP must be 6 digits")
+	req.FullName = strings.TrimSpace(req.FullName)
+
+	if _, err := h.userRepo.GetUserByEmail(req.Email); err == nil {
+		h.writeError(w, http.StatusConflict, "An account with this email already exists. Sign in or reset your password.")
+		return
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		h.logger.Error("Failed to check user existence", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Failed to sign up")
 		return
 	}
 
-	// Get OTP from database
-	otpID, otpHash, expiresAt, err := h.otpRepo.GetOTPByEmail(req.Email)
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			h.writeError(w, http.StatusUnauthorized, "Invalid or expired OTP")
-			return
-		}
-		h.logger.Error("Failed to get OTP", zap.Error(err))
-		h.writeError(w, http.StatusInternalServerError, "Failed to verify OTP")
+		h.logger.Error("Failed to hash password", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Failed to process password")
 		return
 	}
 
-	// Check if expired
-	if time.Now().After(expiresAt) {
-		h.writeError(w, http.StatusUnauthorized, "OTP has expired")
+	locale := services.LocaleFromAcceptLanguage(r.Header.Get("Accept-Language"))
+	otp, err := h.otpService.SendSignupOTP(req.Email, locale, req.FullName, string(hashedBytes))
+	if err != nil {
+		h.logger.Error("Failed to send signup OTP", zap.Error(err), zap.String("email", req.Email))
+		h.writeError(w, http.StatusInternalServerError, "Failed to send verification code. Please try again later.")
 		return
 	}
 
-	// Verify OTP
-	if !h.otpService.VerifyOTP(req.OTP, otpHash) {
+	response := SignupResponse{
+		Message: "Verification code sent to email",
+	}
+
+	// Only include OTP in development mode
+	if r.URL.Query().Get("dev") == "true" {
+		response.OTP = otp
+		h.logger.Info("Signup OTP generated (dev mode)", zap.String("email", req.Email), zap.String("otp", otp))
+	} else {
+		h.logger.Info("Signup OTP sent", zap.String("email", req.Email))
+	}
+
+	h.writeJSON(w, http.StatusOK, response)
+}
+
+// checkOTP verifies and uses up a code issued for one of purposes
+// It writes the error response and returns nil when the code is not accepted
+func (h *AuthHandlers) checkOTP(w http.ResponseWriter, email, otp string, purposes ...string) *services.OTPRecord {
+	if len(otp) != 6 {
+		h.writeError(w, http.StatusBadRequest, "OTP must be 6 digits")
+		return nil
+	}
+
+	record, err := h.otpService.CheckOTP(email, otp, purposes...)
+	switch {
+	case err == nil:
+		return record
+	case errors.Is(err, services.ErrOTPNotFound):
+		h.writeError(w, http.StatusUnauthorized, "Invalid or expired OTP")
+	case errors.Is(err, services.ErrOTPInvalid):
 		h.writeError(w, http.StatusUnauthorized, "Invalid OTP")
+	case errors.Is(err, services.ErrOTPAttemptsExceeded):
+		h.writeError(w, http.StatusTooManyRequests, fmt.Sprintf("Too many incorrect codes (%d). Request a new code.", services.MaxOTPAttempts))
+	default:
+		h.logger.Error("Failed to verify OTP", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Failed to verify OTP")
+	}
+	return nil
+}
+
+// VerifyOTP verifies an OTP and returns a JWT token
+// POST /api/auth/verify-otp
+func (h *AuthHandlers) VerifyOTP(w http.ResponseWriter, r *http.Request) {
+	var req VerifyOTPRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	// Validate email
+	if !ValidateEmail(req.Email) {
+		h.writeError(w, http.StatusBadRequest, "Invalid email address")
 		return
 	}
+	noteAuditSubject(r, "", req.Email)
 
-	// Mark OTP as used
-	if err := h.otpRepo.MarkOTPAsUsed(otpID); err != nil {
-		h.logger.Warn("Failed to mark OTP as used", zap.Error(err))
+	// Sign-in codes and signup codes are both accepted here
+	record := h.checkOTP(w, req.Email, req.OTP, services.OTPPurposeLogin, services.OTPPurposeSignup)
+	if record == nil {
+		return
 	}
 
-	// Hash password if provided
-	var passwordHash string
+	// A signup code carries the name and password given at /signup
+	fullName, passwordHash := record.FullName, record.PasswordHash
 	if req.Password != "" {
-		if len(req.Password) < 8 {
-			h.writeError(w, http.StatusBadRequest, "Password must be at least 8 characters")
-			return
-		}
 		hashedBytes, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
 			h.logger.Error("Failed to hash password", zap.Error(err))
@@ -217,50 +270,19 @@ func (h *AuthHandlers) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			// Create new user with password if provided
-			user, err = h.userRepo.CreateUser(req.Email, "", "", passwordHash)
+			user, err = h.createUserWithTrial(r.Context(), req.Email, fullName, passwordHash, services.LocaleFromAcceptLanguage(r.Header.Get("Accept-Language")))
 			if err != nil {
-				h.logger.Error("Failed to create user", 
-					zap.Error(err), 
-					zap.String("email", req.Email),
-					zap.String("error_type", fmt.Sprintf("%T", err)),
-				)
-				errorMsg := fmt.Sprintf("Failed to create user: %v", err)
-				h.writeError(w, http.StatusInternalServerError, errorMsg)
+				h.logger.Error("Failed to create user", zap.Error(err), zap.String("email", req.Email))
+				h.writeError(w, http.StatusInternalServerError, "Failed to create user")
 				return
 			}
-			
-			// Create 7-day free trial for new user
-			// Email failures must NOT block signup
-			ctx := r.Context()
-			if err := h.subscriptionService.CreateTrial(ctx, user.ID, user.Email); err != nil {
-				h.logger.Error("Failed to create trial subscription",
-					zap.Error(err),
-					zap.String("user_id", user.ID),
-					zap.String("email", user.Email),
-				)
-				// Don't fail signup if trial creation fails - log and continue
-				// User can still sign up, but trial may need manual intervention
-			} else {
-				// Sync billing fields to users table for fast access
-				// Trial was created successfully, update user billing fields
-				now := time.Now()
-				trialEndsAt := now.Add(7 * 24 * time.Hour)
-				if updateErr := h.userRepo.UpdateUserBilling(ctx, user.ID, "trial", "free_trial", "", &now, &trialEndsAt); updateErr != nil {
-					h.logger.Warn("Failed to sync billing fields to users table",
-						zap.Error(updateErr),
-						zap.String("user_id", user.ID),
-					)
-					// Non-critical - subscription table is source of truth
-				}
-			}
 		} else {
 			h.logger.Error("Failed to get user", 
 				zap.Error(err), 
 				zap.String("email", req.Email),
 				zap.String("error_type", fmt.Sprintf("%T", err)),
 			)
-			errorMsg := fmt.Sprintf("Failed to get user: %v", err)
-			h.writeError(w, http.StatusInternalServerError, errorMsg)
+			h.writeError(w, http.StatusInternalServerError, "Failed to get user")
 			return
 		}
 	} else if passwordHash != "" {
@@ -272,12 +294,13 @@ func (h *AuthHandlers) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 				zap.String("user_id", user.ID),
 				zap.String("error_type", fmt.Sprintf("%T", err)),
 			)
-			errorMsg := fmt.Sprintf("Failed to update password: %v", err)
-			h.writeError(w, http.StatusInternalServerError, errorMsg)
+			h.writeError(w, http.StatusInternalServerError, "Failed to update password")
 			return
 		}
 	}
 
+	noteAuditSubject(r, user.ID, user.Email)
+
 	// Generate JWT token
 	token, err := h.jwtService.GenerateToken(user.ID, user.Email, 3600) // 1 hour expiration
 	if err != nil {
@@ -294,12 +317,93 @@ func (h *AuthHandlers) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 	h.writeJSON(w, http.StatusOK, response)
 }
 
+// createUserWithTrial creates a user and starts their 7-day free trial
+// Trial and email failures must NOT block signup - they are logged and left for manual intervention
+// locale is the language the user's emails are written in, starting with the trial welcome email
+func (h *AuthHandlers) createUserWithTrial(ctx context.Context, email, fullName, passwordHash, locale string) (*User, error) {
+	user, err := h.userRepo.CreateUser(email, fullName, "", passwordHash, locale)
+	if err != nil {
+		h.logger.Error("Failed to create user", 
+			zap.Error(err), 
+			zap.String("email", email),
+			zap.String("error_type", fmt.Sprintf("%T", err)),
+		)
+		return nil, err
+	}
+
+	// Create 7-day free trial for new user
+	if err := h.subscriptionService.CreateTrial(ctx, user.ID, user.Email); err != nil {
+		h.logger.Error("Failed to create trial subscription",
+			zap.Error(err),
+			zap.String("user_id", user.ID),
+			zap.String("email", user.Email),
+		)
+		// Don't fail signup if trial creation fails - log and continue
+		// User can still sign up, but trial may need manual intervention
+	} else {
+		// Sync billing fields to users table for fast access
+		// Trial was created successfully, update user billing fields
+		now := time.Now()
+		trialEndsAt := now.Add(7 * 24 * time.Hour)
+		if updateErr := h.userRepo.UpdateUserBilling(ctx, user.ID, "trial", "free_trial", "", &now, &trialEndsAt); updateErr != nil {
+			h.logger.Warn("Failed to sync billing fields to users table",
+				zap.Error(updateErr),
+				zap.String("user_id", user.ID),
+			)
+			// Non-critical - subscription table is source of truth
+		}
+	}
+
+	return user, nil
+}
+
+// SetAuthMode records the configured auth mode (reported by GET /api/auth/config)
+func (h *AuthHandlers) SetAuthMode(mode string) {
+	h.authMode = mode
+}
+
+// GetOrProvisionUser returns the user for an identity asserted by a trusted auth proxy,
+// creating the account (with a trial, as for OTP signup) the first time the email is seen
+func (h *AuthHandlers) GetOrProvisionUser(ctx context.Context, email, fullName, locale string) (*User, error) {
+	user, err := h.userRepo.GetUserByEmail(email)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	h.logger.Info("Provisioning user from trusted auth header", zap.String("email", email))
+	user, err = h.createUserWithTrial(ctx, email, fullName, "", locale)
+	if err != nil {
+		// Concurrent first requests for the same identity race on the unique email - use the winner
+		if existing, getErr := h.userRepo.GetUserByEmail(email); getErr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// GET /api/auth/config - Report how users sign in (builtin OTP/password or upstream proxy headers)
+func (h *AuthHandlers) GetAuthConfig(w http.ResponseWriter, r *http.Request) {
+	mode := h.authMode
+	if mode == "" {
+		mode = "builtin"
+	}
+	h.writeJSON(w, http.StatusOK, map[string]string{"mode": mode})
+}
+
+// BuiltinAuthDisabled rejects OTP/password endpoints when identity comes from an upstream auth proxy
+func (h *AuthHandlers) BuiltinAuthDisabled(w http.ResponseWriter, r *http.Request) {
+	h.writeError(w, http.StatusForbidden, "Password and OTP sign-in are disabled on this server. Sign in through your identity provider.")
+}
+
 // Login handles login with OTP or password
 // POST /api/auth/login
 func (h *AuthHandlers) Login(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
@@ -308,6 +412,7 @@ func (h *AuthHandlers) Login(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, http.StatusBadRequest, "Invalid email address")
 		return
 	}
+	noteAuditSubject(r, "", req.Email)
 
 	// Get user
 	user, err := h.userRepo.GetUserByEmail(req.Email)
@@ -320,6 +425,8 @@ func (h *AuthHandlers) Login(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, http.StatusInternalServerError, "Failed to get user")
 		return
 	}
+	// Failed attempts on an existing account show up in that account's audit log
+	noteAuditSubject(r, user.ID, user.Email)
 
 	// Authenticate with password or OTP
 	if req.Password != "" {
@@ -335,39 +442,9 @@ func (h *AuthHandlers) Login(w http.ResponseWriter, r *http.Request) {
 		}
 	} else if req.OTP != "" {
 		// OTP authentication
-		if len(req.OTP) != 6 {
-			h.writeError(w, http.StatusBadRequest, "OTP must be 6 digits")
+		if h.checkOTP(w, req.Email, req.OTP, services.OTPPurposeLogin) == nil {
 			return
 		}
-
-		// Get OTP from database
-		otpID, otpHash, expiresAt, err := h.otpRepo.GetOTPByEmail(req.Email)
-		if err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
-				h.writeError(w, http.StatusUnauthorized, "Invalid email or OTP")
-				return
-			}
-			h.logger.Error("Failed to get OTP", zap.Error(err))
-			h.writeError(w, http.StatusInternalServerError, "Failed to verify OTP")
-			return
-		}
-
-		// Check if expired
-		if time.Now().After(expiresAt) {
-			h.writeError(w, http.StatusUnauthorized, "OTP has expired")
-			return
-		}
-
-		// Verify OTP
-		if !h.otpService.VerifyOTP(req.OTP, otpHash) {
-			h.writeError(w, http.StatusUnauthorized, "Invalid email or OTP")
-			return
-		}
-
-		// Mark OTP as used
-		if err := h.otpRepo.MarkOTPAsUsed(otpID); err != nil {
-			h.logger.Warn("Failed to mark OTP as used", zap.Error(err))
-		}
 	} else {
 		h.writeError(w, http.StatusBadRequest, "Either password or OTP is required")
 		return
@@ -390,6 +467,15 @@ func (h *AuthHandlers) Login(w http.ResponseWriter, r *http.Request) {
 }
 
 // Helper to write JSON response
+// emailLocale returns the locale to email an address in: the account's locale when it exists,
+// otherwise the browser's Accept-Language (the address is signing up)
+func (h *AuthHandlers) emailLocale(r *http.Request, email string) string {
+	if user, err := h.userRepo.GetUserByEmail(email); err == nil && user.Locale != "" {
+		return user.Locale
+	}
+	return services.LocaleFromAcceptLanguage(r.Header.Get("Accept-Language"))
+}
+
 func (h *AuthHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -400,7 +486,7 @@ func (h *AuthHandlers) writeJSON(w http.ResponseWriter, status int, data interfa
 
 // Helper to write error response
 func (h *AuthHandlers) writeError(w http.ResponseWriter, status int, message string) {
-	h.writeJSON(w, status, map[string]string{"error": message})
+	writeAPIError(w, status, "", message, nil)
 }
 
 // Helper function to validate email
@@ -436,7 +522,7 @@ func ValidateEmail(email string) bool {
 type UpdateUserRequest struct {
 	FullName    string `json:"full_name"`
 	CompanyName string `json:"company_name"`
-	Password    string `json:"password,omitempty"` // Optional: to update password
+	Password    string `json:"password,omitempty" validate:"omitempty,min=8"` // Optional: to update password
 }
 
 // UpdateUserProfile updates user profile details
@@ -451,18 +537,13 @@ func (h *AuthHandlers) UpdateUserProfile(w http.ResponseWriter, r *http.Request)
 	}
 
 	var req UpdateUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
 	// Hash password if provided
 	var passwordHash string
 	if req.Password != "" {
-		if len(req.Password) < 8 {
-			h.writeError(w, http.StatusBadRequest, "Password must be at least 8 characters")
-			return
-		}
 		hashedBytes, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
 			h.logger.Error("Failed to hash password", zap.Error(err))
@@ -506,8 +587,7 @@ type ResetPasswordResponse struct {
 // POST /api/auth/forgot-password
 func (h *AuthHandlers) ForgotPassword(w http.ResponseWriter, r *http.Request) {
 	var req ForgotPasswordRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
@@ -518,7 +598,7 @@ func (h *AuthHandlers) ForgotPassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user exists (for security, don't reveal if email exists or not)
-	_, err := h.userRepo.GetUserByEmail(req.Email)
+	user, err := h.userRepo.GetUserByEmail(req.Email)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			// Silently succeed to prevent email enumeration attacks
@@ -539,7 +619,7 @@ func (h *AuthHandlers) ForgotPassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate and send OTP for password reset
-	otp, err := h.otpService.SendPasswordResetOTP(req.Email)
+	otp, err := h.otpService.SendPasswordResetOTP(req.Email, user.Locale)
 	if err != nil {
 		h.logger.Error("Failed to send password reset OTP",
 			zap.Error(err),
@@ -570,8 +650,7 @@ func (h *AuthHandlers) ForgotPassword(w http.ResponseWriter, r *http.Request) {
 // POST /api/auth/reset-password
 func (h *AuthHandlers) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	var req ResetPasswordRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
@@ -580,18 +659,7 @@ func (h *AuthHandlers) ResetPassword(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, http.StatusBadRequest, "Invalid email address")
 		return
 	}
-
-	// Validate OTP format
-	if len(req.OTP) != 6 {
-		h.writeError(w, http.StatusBadRequest, "OTP must be 6 digits")
-		return
-	}
-
-	// Validate password
-	if len(req.Password) < 8 {
-		h.writeError(w, http.StatusBadRequest, "Password must be at least 8 characters")
-		return
-	}
+	noteAuditSubject(r, "", req.Email)
 
 	// Get user
 	user, err := h.userRepo.GetUserByEmail(req.Email)
@@ -604,36 +672,13 @@ func (h *AuthHandlers) ResetPassword(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, http.StatusInternalServerError, "Failed to reset password")
 		return
 	}
+	noteAuditSubject(r, user.ID, user.Email)
 
-	// Get OTP from database
-	otpID, otpHash, expiresAt, err := h.otpRepo.GetOTPByEmail(req.Email)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			h.writeError(w, http.StatusUnauthorized, "Invalid or expired OTP")
-			return
-		}
-		h.logger.Error("Failed to get OTP", zap.Error(err))
-		h.writeError(w, http.StatusInternalServerError, "Failed to verify OTP")
+	// Only codes from /forgot-password reset passwords
+	if h.checkOTP(w, req.Email, req.OTP, services.OTPPurposePasswordReset) == nil {
 		return
 	}
 
-	// Check if expired
-	if time.Now().After(expiresAt) {
-		h.writeError(w, http.StatusUnauthorized, "OTP has expired")
-		return
-	}
-
-	// Verify OTP
-	if !h.otpService.VerifyOTP(req.OTP, otpHash) {
-		h.writeError(w, http.StatusUnauthorized, "Invalid OTP")
-		return
-	}
-
-	// Mark OTP as used
-	if err := h.otpRepo.MarkOTPAsUsed(otpID); err != nil {
-		h.logger.Warn("Failed to mark OTP as used", zap.Error(err))
-	}
-
 	// Hash new password
 	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
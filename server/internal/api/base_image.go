@@ -0,0 +1,88 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// BaseImageStatus is the base image an app's latest build used and whether upstream has a newer build of it
+// The deploy worker checks the registry daily; Digest is assumed current at the first check when the
+// build could not read it
+type BaseImageStatus struct {
+	Image           string `json:"image,omitempty"` // Empty until a Dockerfile build with a trackable base (not scratch or digest-pinned) succeeds
+	Digest          string `json:"digest,omitempty"`
+	LatestDigest    string `json:"latest_digest,omitempty"`
+	CheckedAt       string `json:"checked_at,omitempty"`
+	UpdateAvailable bool   `json:"update_available"`
+	AutoRebuild     bool   `json:"auto_rebuild"` // Rebuild and redeploy automatically when a new digest is published
+}
+
+// UpdateBaseImageRequest is the request body for PUT /api/v1/apps/{id}/base-image
+type UpdateBaseImageRequest struct {
+	AutoRebuild *bool `json:"auto_rebuild"`
+}
+
+// GET /api/v1/apps/{id}/base-image - Base image of the latest build and whether a security update is available
+func (h *Handlers) GetBaseImage(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+
+	status, err := h.appRepo.GetBaseImageStatus(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve base image")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, status)
+}
+
+// PUT /api/v1/apps/{id}/base-image - Turn automatic security rebuilds on new base image digests on or off
+func (h *Handlers) UpdateBaseImage(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+
+	var req UpdateBaseImageRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.AutoRebuild == nil {
+		h.writeError(w, http.StatusBadRequest, "auto_rebuild is required")
+		return
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+
+	if err := h.appRepo.SetAutoSecurityRebuild(r.Context(), app.ID, *req.AutoRebuild); err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to update security rebuilds")
+		return
+	}
+	h.logger.Info("Auto security rebuild updated", zap.String("app_id", app.ID), zap.Bool("enabled", *req.AutoRebuild))
+
+	status, err := h.appRepo.GetBaseImageStatus(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve base image")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, status)
+}
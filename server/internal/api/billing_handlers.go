@@ -0,0 +1,222 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// ChangePlanRequest is the body for POST /api/billing/change-plan
+type ChangePlanRequest struct {
+	Plan string `json:"plan" validate:"notblank"` // e.g. "starter", "pro"
+}
+
+// ChangePlanResponse describes a completed plan change
+type ChangePlanResponse struct {
+	Plan         string `json:"plan"`
+	PreviousPlan string `json:"previous_plan"`
+	Upgrade      bool   `json:"upgrade"`
+	Proration    string `json:"proration"` // invoiced_now (upgrades) | next_invoice (downgrades)
+	MaxApps      int    `json:"max_apps"`  // Limits of the new plan, already in effect
+	MaxRAMMB     int    `json:"max_ram_mb"`
+}
+
+// BillingHandlers changes the plan of existing subscriptions and serves billing history
+type BillingHandlers struct {
+	logger              *zap.Logger
+	subscriptionService *services.SubscriptionService
+	planEnforcement     *services.PlanEnforcementService
+	planRepo            *PlanRepo
+	appRepo             *AppRepo
+	lemonSqueezy        *services.LemonSqueezyClient
+	invoiceService      *services.InvoiceService
+	variants            map[string]int // Plan name -> Lemon Squeezy variant ID
+}
+
+// NewBillingHandlers creates a new billing handlers instance
+func NewBillingHandlers(logger *zap.Logger, subscriptionService *services.SubscriptionService, planEnforcement *services.PlanEnforcementService, planRepo *PlanRepo, appRepo *AppRepo, lemonSqueezy *services.LemonSqueezyClient, invoiceService *services.InvoiceService, variants map[string]int) *BillingHandlers {
+	return &BillingHandlers{
+		logger:              logger,
+		subscriptionService: subscriptionService,
+		planEnforcement:     planEnforcement,
+		planRepo:            planRepo,
+		appRepo:             appRepo,
+		lemonSqueezy:        lemonSqueezy,
+		invoiceService:      invoiceService,
+		variants:            variants,
+	}
+}
+
+// POST /api/billing/change-plan - Switch an active subscription to another plan in place
+// Lemon Squeezy prorates the change: upgrades are invoiced immediately, downgrades are credited on the
+// next invoice. The new limits apply right away, so downgrades whose limits the user's enabled apps
+// exceed are refused until apps are removed or resized
+func (h *BillingHandlers) ChangePlan(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	var req ChangePlanRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Plan = strings.ToLower(strings.TrimSpace(req.Plan))
+
+	if !h.lemonSqueezy.IsConfigured() {
+		h.writeError(w, http.StatusServiceUnavailable, "Plan changes are not available")
+		return
+	}
+	variantID, ok := h.variants[req.Plan]
+	if !ok {
+		h.writeError(w, http.StatusBadRequest, fmt.Sprintf("Plan %q cannot be subscribed to", req.Plan))
+		return
+	}
+
+	ctx := r.Context()
+	sub, err := h.subscriptionService.GetSubscriptionByUserID(ctx, userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve subscription")
+		return
+	}
+	if sub == nil || sub.Status != "active" || sub.LemonSubscriptionID == nil || *sub.LemonSubscriptionID == "" {
+		h.writeError(w, http.StatusConflict, "Plan changes need an active paid subscription - subscribe through checkout instead")
+		return
+	}
+	if sub.CancelAtPeriodEnd {
+		h.writeError(w, http.StatusConflict, "Subscription is cancelled at the end of the billing period - resume it before changing plans")
+		return
+	}
+	if sub.Plan == req.Plan {
+		h.writeError(w, http.StatusConflict, fmt.Sprintf("Already on the %s plan", req.Plan))
+		return
+	}
+
+	newPlan, err := h.planRepo.GetPlanByName(ctx, req.Plan)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown plan %q", req.Plan))
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve plan")
+		return
+	}
+	upgrade := true
+	if currentPlan, err := h.planRepo.GetPlanByName(ctx, sub.Plan); err == nil {
+		upgrade = newPlan.Price > currentPlan.Price
+	}
+
+	// The new limits apply immediately, so a downgrade must fit the apps already running
+	appCount, ramMB, err := h.appRepo.GetEnabledAppUsage(ctx, userID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to check app usage")
+		return
+	}
+	limits, err := h.planEnforcement.CheckPlanChange(ctx, userID, req.Plan, appCount, ramMB)
+	if err != nil {
+		if planErr, ok := GetPlanLimitError(err); ok && !upgrade {
+			writePlanLimitError(w, planErr)
+			return
+		} else if !ok {
+			h.writeError(w, http.StatusInternalServerError, "Failed to check plan limits")
+			return
+		}
+		// Upgrades are never refused - they only bring the user closer to their limits
+	}
+
+	if err := h.lemonSqueezy.UpdateSubscriptionVariant(ctx, *sub.LemonSubscriptionID, variantID, upgrade); err != nil {
+		h.logger.Error("Failed to change subscription plan with Lemon Squeezy",
+			zap.Error(err),
+			zap.String("user_id", userID),
+			zap.String("plan", req.Plan),
+		)
+		h.writeError(w, http.StatusBadGateway, "Failed to change plan with the billing provider")
+		return
+	}
+
+	// The subscription_updated webhook applies the same change; applying it now makes the new limits
+	// take effect without waiting for it
+	if err := h.subscriptionService.ChangePlan(ctx, userID, req.Plan); err != nil {
+		h.logger.Error("Plan changed with Lemon Squeezy but not applied - the webhook will apply it",
+			zap.Error(err),
+			zap.String("user_id", userID),
+			zap.String("plan", req.Plan),
+		)
+	}
+
+	// The plan change creates an invoice (or a credit on the next one)
+	h.invoiceService.InvalidateUser(userID)
+
+	proration := "next_invoice"
+	if upgrade {
+		proration = "invoiced_now"
+	}
+	noteAuditDetail(r, "plan", req.Plan)
+	noteAuditDetail(r, "previous_plan", sub.Plan)
+	h.logger.Info("Subscription plan changed",
+		zap.String("user_id", userID),
+		zap.String("plan", req.Plan),
+		zap.String("previous_plan", sub.Plan),
+		zap.Bool("upgrade", upgrade),
+	)
+
+	h.writeJSON(w, http.StatusOK, ChangePlanResponse{
+		Plan:         req.Plan,
+		PreviousPlan: sub.Plan,
+		Upgrade:      upgrade,
+		Proration:    proration,
+		MaxApps:      limits.MaxApps,
+		MaxRAMMB:     limits.MaxRAMMB,
+	})
+}
+
+// GET /api/billing/invoices - Get the user's billing history (amount, status, date and hosted invoice URL)
+func (h *BillingHandlers) ListInvoices(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	if !h.lemonSqueezy.IsConfigured() {
+		h.writeError(w, http.StatusServiceUnavailable, "Billing history is not available")
+		return
+	}
+
+	invoices, err := h.invoiceService.GetInvoices(r.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to get invoices", zap.Error(err), zap.String("user_id", userID))
+		h.writeError(w, http.StatusBadGateway, "Failed to retrieve billing history")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, invoices)
+}
+
+func (h *BillingHandlers) getUserIDFromContext(r *http.Request) string {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		h.logger.Warn("User ID not found in context")
+		return ""
+	}
+	return userID
+}
+
+func (h *BillingHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *BillingHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
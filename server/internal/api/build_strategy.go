@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/services"
+)
+
+// BuildStrategySettings is how an app's source is built into an image
+// It is the request and response body of /api/v1/apps/{id}/build-strategy
+type BuildStrategySettings struct {
+	BuildStrategy string `json:"build_strategy"` // dockerfile (default), buildpacks or nixpacks
+}
+
+// GET /api/v1/apps/{id}/build-strategy - Get how the app's source is built into an image
+func (h *Handlers) GetBuildStrategy(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+
+	strategy, err := h.appRepo.GetBuildStrategy(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve build strategy")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, BuildStrategySettings{BuildStrategy: strategy})
+}
+
+// PUT /api/v1/apps/{id}/build-strategy - Choose between Dockerfile, buildpacks and nixpacks builds
+// It takes effect on the next build
+func (h *Handlers) UpdateBuildStrategy(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+
+	var req BuildStrategySettings
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.BuildStrategy = strings.ToLower(strings.TrimSpace(req.BuildStrategy))
+	if !services.ValidBuildStrategy(req.BuildStrategy) {
+		h.writeError(w, http.StatusBadRequest, "build_strategy must be dockerfile, buildpacks or nixpacks")
+		return
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+	if app.Source == services.AppSourceImage {
+		h.writeError(w, http.StatusBadRequest, "Image apps are not built - they have no build strategy")
+		return
+	}
+
+	if err := h.appRepo.SetBuildStrategy(r.Context(), app.ID, req.BuildStrategy); err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to update build strategy")
+		return
+	}
+	h.logger.Info("Build strategy updated",
+		zap.String("app_id", app.ID),
+		zap.String("build_strategy", req.BuildStrategy),
+		zap.String("user_id", userID),
+	)
+
+	h.writeJSON(w, http.StatusOK, req)
+}
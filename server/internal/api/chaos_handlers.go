@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/services"
+)
+
+// Limits on injected faults so a forgotten fault cannot stall a dev environment for long
+const (
+	maxChaosDeployDelaySeconds = 300
+	maxChaosFaultCount         = 100
+	defaultChaosFaultTTL       = time.Hour
+	maxChaosFaultTTL           = 24 * time.Hour
+)
+
+// CreateChaosFaultRequest is the body for POST /api/v1/dev/chaos/faults
+type CreateChaosFaultRequest struct {
+	Kind         string `json:"kind"`          // fail_build, delay_deploy or drop_webhooks
+	AppID        string `json:"app_id"`        // Omit to apply to every one of your apps (not allowed for drop_webhooks)
+	DelaySeconds int    `json:"delay_seconds"` // Required for delay_deploy
+	Count        int    `json:"count"`         // How many times the fault fires (default 1)
+	TTLSeconds   int    `json:"ttl_seconds"`   // Expiry even if never fired (default 1 hour)
+}
+
+// ChaosHandlers injects failures into builds, deploys and webhook processing
+// Only routed for admins when CHAOS_ENABLED is set, which config validation refuses outside development,
+// test and staging
+type ChaosHandlers struct {
+	logger    *zap.Logger
+	chaosRepo *ChaosRepo
+	appRepo   *AppRepo
+}
+
+// NewChaosHandlers creates a new chaos handlers instance
+func NewChaosHandlers(logger *zap.Logger, chaosRepo *ChaosRepo, appRepo *AppRepo) *ChaosHandlers {
+	return &ChaosHandlers{
+		logger:    logger,
+		chaosRepo: chaosRepo,
+		appRepo:   appRepo,
+	}
+}
+
+// GET /api/v1/dev/chaos/faults - List the user's active faults
+func (h *ChaosHandlers) ListFaults(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	faults, err := h.chaosRepo.ListChaosFaults(r.Context(), userID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve chaos faults")
+		return
+	}
+	if faults == nil {
+		faults = []*services.ChaosFault{}
+	}
+
+	h.writeJSON(w, http.StatusOK, faults)
+}
+
+// POST /api/v1/dev/chaos/faults - Inject a fault (fail next build, delay deploys, drop webhooks)
+func (h *ChaosHandlers) CreateFault(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	var req CreateChaosFaultRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	switch req.Kind {
+	case services.ChaosFailBuild:
+		req.DelaySeconds = 0
+	case services.ChaosDelayDeploy:
+		if req.DelaySeconds < 1 || req.DelaySeconds > maxChaosDeployDelaySeconds {
+			h.writeError(w, http.StatusBadRequest, "delay_seconds must be between 1 and 300")
+			return
+		}
+	case services.ChaosDropWebhooks:
+		if req.AppID != "" {
+			h.writeError(w, http.StatusBadRequest, "drop_webhooks faults cannot be scoped to an app")
+			return
+		}
+		req.DelaySeconds = 0
+	default:
+		h.writeError(w, http.StatusBadRequest, "Invalid kind. Use fail_build, delay_deploy or drop_webhooks")
+		return
+	}
+
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	if req.Count < 1 || req.Count > maxChaosFaultCount {
+		h.writeError(w, http.StatusBadRequest, "count must be between 1 and 100")
+		return
+	}
+	ttl := defaultChaosFaultTTL
+	if req.TTLSeconds != 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl <= 0 || ttl > maxChaosFaultTTL {
+		h.writeError(w, http.StatusBadRequest, "ttl_seconds must be between 1 and 86400")
+		return
+	}
+
+	if req.AppID != "" {
+		if _, err := h.appRepo.GetAppByID(req.AppID, userID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				h.writeError(w, http.StatusNotFound, "App not found")
+				return
+			}
+			h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+			return
+		}
+	}
+
+	fault, err := h.chaosRepo.CreateChaosFault(r.Context(), userID, req.Kind, req.AppID, req.DelaySeconds, req.Count, time.Now().UTC().Add(ttl))
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to create chaos fault")
+		return
+	}
+
+	h.logger.Warn("Chaos fault injected",
+		zap.String("user_id", userID),
+		zap.String("fault_id", fault.ID),
+		zap.String("kind", fault.Kind),
+		zap.String("app_id", fault.AppID),
+		zap.Int("count", fault.Remaining),
+	)
+	h.writeJSON(w, http.StatusCreated, fault)
+}
+
+// DELETE /api/v1/dev/chaos/faults/{faultId} - Remove a fault
+func (h *ChaosHandlers) DeleteFault(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+	faultID := chi.URLParam(r, "faultId")
+
+	if err := h.chaosRepo.DeleteChaosFault(r.Context(), userID, faultID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Chaos fault not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to delete chaos fault")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /api/v1/dev/chaos/faults - Remove all of the user's faults
+func (h *ChaosHandlers) ClearFaults(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	removed, err := h.chaosRepo.ClearChaosFaults(r.Context(), userID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to clear chaos faults")
+		return
+	}
+
+	h.logger.Info("Chaos faults cleared", zap.String("user_id", userID), zap.Int64("removed", removed))
+	h.writeJSON(w, http.StatusOK, map[string]int64{"removed": removed})
+}
+
+func (h *ChaosHandlers) getUserIDFromContext(r *http.Request) string {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		h.logger.Warn("User ID not found in context")
+		return ""
+	}
+	return userID
+}
+
+func (h *ChaosHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *ChaosHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
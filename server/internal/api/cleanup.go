@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/tasks"
+)
+
+// CleanupTriggerResponse is the response of POST /admin/cleanup
+type CleanupTriggerResponse struct {
+	TaskID string `json:"task_id"`
+	State  string `json:"state"` // pending, or active when a run was already under way
+}
+
+// POST /admin/cleanup - Run cleanup on a cleanup worker now instead of waiting for the schedule
+func (h *Handlers) AdminTriggerCleanup(w http.ResponseWriter, r *http.Request) {
+	if h.taskEnqueue == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Task queue not available")
+		return
+	}
+
+	info, err := h.taskEnqueue.EnqueueCleanupTask(r.Context(), tasks.CleanupTaskPayload{Trigger: tasks.CleanupTriggerAdmin})
+	if err != nil {
+		h.logger.Error("Failed to enqueue cleanup task", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Failed to queue cleanup")
+		return
+	}
+	noteAuditDetail(r, "task_id", info.ID)
+
+	h.writeJSON(w, http.StatusAccepted, CleanupTriggerResponse{TaskID: info.ID, State: info.State.String()})
+}
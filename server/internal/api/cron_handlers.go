@@ -0,0 +1,410 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/services"
+	"stackyn/server/internal/tasks"
+)
+
+// Limits on cron jobs so schedules cannot monopolise the deploy worker
+const (
+	maxCronJobsPerApp       = 20
+	minCronInterval         = 5 * time.Minute
+	defaultCronTimeout      = 600
+	maxCronTimeout          = 3600
+	maxCronCommandLength    = 4096
+	defaultCronRunsPageSize = 20
+	maxCronRunsPageSize     = 100
+)
+
+// CronJobRequest is the body for POST /api/v1/apps/{id}/cron and PATCH /api/v1/apps/{id}/cron/{cronId}
+// On PATCH, omitted fields keep their current value
+type CronJobRequest struct {
+	Name           *string `json:"name"`
+	Schedule       *string `json:"schedule"`
+	Command        *string `json:"command"`
+	TimeoutSeconds *int    `json:"timeout_seconds"`
+	Enabled        *bool   `json:"enabled"`
+}
+
+// CronHandlers manages scheduled cron jobs for apps and their run history
+type CronHandlers struct {
+	logger         *zap.Logger
+	appRepo        *AppRepo
+	cronRepo       *CronRepo
+	deploymentRepo *DeploymentRepo
+	taskEnqueue    *services.TaskEnqueueService
+}
+
+// NewCronHandlers creates a new cron handlers instance
+func NewCronHandlers(logger *zap.Logger, appRepo *AppRepo, cronRepo *CronRepo, deploymentRepo *DeploymentRepo, taskEnqueue *services.TaskEnqueueService) *CronHandlers {
+	return &CronHandlers{
+		logger:         logger,
+		appRepo:        appRepo,
+		cronRepo:       cronRepo,
+		deploymentRepo: deploymentRepo,
+		taskEnqueue:    taskEnqueue,
+	}
+}
+
+// GET /api/v1/apps/{id}/cron - List the app's cron jobs
+func (h *CronHandlers) ListCronJobs(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+
+	jobs, err := h.cronRepo.GetCronJobsByAppID(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve cron jobs")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, jobs)
+}
+
+// POST /api/v1/apps/{id}/cron - Schedule a command to run in a one-off container of the app
+func (h *CronHandlers) CreateCronJob(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+
+	var req CronJobRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Name == nil || req.Schedule == nil || req.Command == nil {
+		h.writeError(w, http.StatusBadRequest, "name, schedule and command are required")
+		return
+	}
+
+	existing, err := h.cronRepo.GetCronJobsByAppID(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve cron jobs")
+		return
+	}
+	if len(existing) >= maxCronJobsPerApp {
+		h.writeError(w, http.StatusForbidden, fmt.Sprintf("Apps can have at most %d cron jobs", maxCronJobsPerApp))
+		return
+	}
+
+	job := &CronJob{AppID: app.ID, TimeoutSeconds: defaultCronTimeout, Enabled: true}
+	nextRunAt, err := applyCronJobRequest(job, &req)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := h.cronRepo.CreateCronJob(r.Context(), job, nextRunAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			h.writeError(w, http.StatusConflict, "A cron job with this name already exists")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to create cron job")
+		return
+	}
+
+	h.logger.Info("Cron job created",
+		zap.String("app_id", app.ID),
+		zap.String("cron_job_id", created.ID),
+		zap.String("schedule", created.Schedule),
+		zap.String("user_id", h.getUserIDFromContext(r)),
+	)
+	h.writeJSON(w, http.StatusCreated, created)
+}
+
+// PATCH /api/v1/apps/{id}/cron/{cronId} - Update a cron job (schedule changes recompute the next run)
+func (h *CronHandlers) UpdateCronJob(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+	job, ok := h.getCronJob(w, r, app)
+	if !ok {
+		return
+	}
+
+	var req CronJobRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	nextRunAt, err := applyCronJobRequest(job, &req)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	updated, err := h.cronRepo.UpdateCronJob(r.Context(), job, nextRunAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			h.writeError(w, http.StatusNotFound, "Cron job not found")
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			h.writeError(w, http.StatusConflict, "A cron job with this name already exists")
+		default:
+			h.writeError(w, http.StatusInternalServerError, "Failed to update cron job")
+		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, updated)
+}
+
+// DELETE /api/v1/apps/{id}/cron/{cronId} - Delete a cron job and its run history
+func (h *CronHandlers) DeleteCronJob(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+	cronJobID := chi.URLParam(r, "cronId")
+
+	if err := h.cronRepo.DeleteCronJob(r.Context(), app.ID, cronJobID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Cron job not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to delete cron job")
+		return
+	}
+
+	h.logger.Info("Cron job deleted",
+		zap.String("app_id", app.ID),
+		zap.String("cron_job_id", cronJobID),
+		zap.String("user_id", h.getUserIDFromContext(r)),
+	)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/v1/apps/{id}/cron/{cronId}/run - Run a cron job now, outside its schedule
+func (h *CronHandlers) TriggerCronJob(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+	job, ok := h.getCronJob(w, r, app)
+	if !ok {
+		return
+	}
+	if h.taskEnqueue == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Task queue not available")
+		return
+	}
+
+	deploymentID, imageName, err := h.deploymentRepo.GetCurrentDeployment(r.Context(), app.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusConflict, "App has no running deployment to run the command in")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve current deployment")
+		return
+	}
+
+	run, err := h.cronRepo.CreateCronRun(r.Context(), job.ID, app.ID, "manual", "queued", imageName, "")
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to create cron run")
+		return
+	}
+
+	payload := tasks.CronRunTaskPayload{
+		RunID:          run.ID,
+		CronJobID:      job.ID,
+		AppID:          app.ID,
+		UserID:         app.UserID,
+		DeploymentID:   deploymentID,
+		ImageName:      imageName,
+		Command:        job.Command,
+		TimeoutSeconds: job.TimeoutSeconds,
+	}
+	if _, err := h.taskEnqueue.EnqueueCronRunTask(r.Context(), run.ID, job.TimeoutSeconds, payload); err != nil {
+		h.logger.Error("Failed to enqueue cron run", zap.Error(err), zap.String("run_id", run.ID))
+		h.cronRepo.MarkCronRunFailed(r.Context(), run.ID, "Failed to queue the run")
+		h.writeError(w, http.StatusInternalServerError, "Failed to queue cron run")
+		return
+	}
+
+	h.logger.Info("Cron job triggered manually",
+		zap.String("app_id", app.ID),
+		zap.String("cron_job_id", job.ID),
+		zap.String("run_id", run.ID),
+		zap.String("user_id", h.getUserIDFromContext(r)),
+	)
+	h.writeJSON(w, http.StatusAccepted, run)
+}
+
+// GET /api/v1/apps/{id}/cron/{cronId}/runs - List recent runs (?limit=, default 20, max 100)
+func (h *CronHandlers) ListCronRuns(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+	job, ok := h.getCronJob(w, r, app)
+	if !ok {
+		return
+	}
+
+	limit := defaultCronRunsPageSize
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxCronRunsPageSize {
+			h.writeError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+
+	runs, err := h.cronRepo.GetCronRuns(r.Context(), job.ID, limit)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve cron runs")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, runs)
+}
+
+// GET /api/v1/apps/{id}/cron/{cronId}/runs/{runId} - Get a run with its exit code and output
+func (h *CronHandlers) GetCronRun(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+	job, ok := h.getCronJob(w, r, app)
+	if !ok {
+		return
+	}
+
+	run, err := h.cronRepo.GetCronRunByID(r.Context(), job.ID, chi.URLParam(r, "runId"))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Cron run not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve cron run")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, run)
+}
+
+// applyCronJobRequest validates the request fields that are set and copies them onto job
+// Returns the job's next run time (nil while the job is disabled)
+func applyCronJobRequest(job *CronJob, req *CronJobRequest) (*time.Time, error) {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > 100 {
+			return nil, fmt.Errorf("name must be between 1 and 100 characters")
+		}
+		job.Name = name
+	}
+	if req.Command != nil {
+		command := strings.TrimSpace(*req.Command)
+		if command == "" || len(command) > maxCronCommandLength {
+			return nil, fmt.Errorf("command must be between 1 and %d characters", maxCronCommandLength)
+		}
+		job.Command = command
+	}
+	if req.TimeoutSeconds != nil {
+		if *req.TimeoutSeconds < 1 || *req.TimeoutSeconds > maxCronTimeout {
+			return nil, fmt.Errorf("timeout_seconds must be between 1 and %d", maxCronTimeout)
+		}
+		job.TimeoutSeconds = *req.TimeoutSeconds
+	}
+	if req.Enabled != nil {
+		job.Enabled = *req.Enabled
+	}
+	if req.Schedule != nil {
+		job.Schedule = strings.TrimSpace(*req.Schedule)
+	}
+
+	schedule, err := services.ParseCronSchedule(job.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule: %v", err)
+	}
+	now := time.Now().UTC()
+	next := schedule.Next(now)
+	if next.IsZero() {
+		return nil, fmt.Errorf("invalid schedule: it never runs")
+	}
+	if interval := schedule.MinInterval(now); interval > 0 && interval < minCronInterval {
+		return nil, fmt.Errorf("schedule runs too often: cron jobs can run at most every %d minutes", int(minCronInterval.Minutes()))
+	}
+
+	if !job.Enabled {
+		return nil, nil
+	}
+	return &next, nil
+}
+
+// getApp loads the app from the URL, writing the error response and returning false on failure
+func (h *CronHandlers) getApp(w http.ResponseWriter, r *http.Request) (*App, bool) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return nil, false
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return nil, false
+		}
+		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return nil, false
+	}
+	return app, true
+}
+
+// getCronJob loads the cron job from the URL, writing the error response and returning false on failure
+func (h *CronHandlers) getCronJob(w http.ResponseWriter, r *http.Request, app *App) (*CronJob, bool) {
+	job, err := h.cronRepo.GetCronJobByID(r.Context(), app.ID, chi.URLParam(r, "cronId"))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Cron job not found")
+			return nil, false
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve cron job")
+		return nil, false
+	}
+	return job, true
+}
+
+func (h *CronHandlers) getUserIDFromContext(r *http.Request) string {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		h.logger.Warn("User ID not found in context")
+		return ""
+	}
+	return userID
+}
+
+func (h *CronHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *CronHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
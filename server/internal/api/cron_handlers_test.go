@@ -0,0 +1,38 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyCronJobRequestSchedule(t *testing.T) {
+	tests := []struct {
+		schedule string
+		wantErr  string
+	}{
+		{"*/5 * * * *", ""},
+		{"0 3 * * *", ""},
+		{"@hourly", ""},
+		{"* * * * *", "runs too often"},
+		{"*/2 * * * *", "runs too often"},
+		{"0,1 3 * * *", "runs too often"},
+		{"0 0 30 2 *", "never runs"},
+		{"0 0 * *", "invalid schedule"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.schedule, func(t *testing.T) {
+			job := &CronJob{Enabled: true}
+			next, err := applyCronJobRequest(job, &CronJobRequest{Schedule: &tt.schedule})
+			if tt.wantErr == "" {
+				if err != nil || next == nil {
+					t.Fatalf("applyCronJobRequest = %v, %v; want a next run", next, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("applyCronJobRequest err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
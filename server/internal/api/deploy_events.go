@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Page sizes of GET /api/v1/apps/{id}/events
+const (
+	defaultDeployEventsPageSize = 50
+	maxDeployEventsPageSize     = 100
+)
+
+// SetDeployEventRepo sets the repository of deploy events shown on the app's events timeline
+func (h *Handlers) SetDeployEventRepo(deployEventRepo *DeployEventRepo) {
+	h.deployEventRepo = deployEventRepo
+}
+
+// GET /api/v1/apps/{id}/events - List the steps the app's deploys went through, oldest first
+// From the build being queued to traffic being switched, plus crashes and restarts afterwards, so users can
+// see where a deploy is or which step it failed at. ?build_job_id= or ?deployment_id= narrow it to one deploy;
+// ?before=<event id> pages back through older events
+func (h *Handlers) GetAppEvents(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+
+	if h.deployEventRepo == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Deploy events are not available")
+		return
+	}
+
+	query := r.URL.Query()
+	buildJobID := query.Get("build_job_id")
+	deploymentID := query.Get("deployment_id")
+	for _, id := range []string{buildJobID, deploymentID} {
+		if id == "" {
+			continue
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			h.writeError(w, http.StatusBadRequest, "build_job_id and deployment_id must be UUIDs")
+			return
+		}
+	}
+
+	var before int64
+	if raw := query.Get("before"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 {
+			h.writeError(w, http.StatusBadRequest, "before must be an event ID")
+			return
+		}
+		before = n
+	}
+
+	limit := defaultDeployEventsPageSize
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxDeployEventsPageSize {
+			h.writeError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+
+	events, err := h.deployEventRepo.ListDeployEvents(r.Context(), appID, buildJobID, deploymentID, before, limit)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deploy events")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/deploystate"
+	"stackyn/server/internal/services"
+)
+
+// maxPushHookBodyBytes bounds push webhook deliveries (GitLab caps the commits it lists at 20)
+const maxPushHookBodyBytes = 5 << 20
+
+// Where Git hosts deliver push events
+const (
+	gitLabPushHookPath    = "/api/v1/hooks/gitlab"
+	bitbucketPushHookPath = "/api/v1/hooks/bitbucket"
+)
+
+// DeployHookSettings is the response of /api/v1/apps/{id}/deploy-hook
+// The secret is only returned when it is generated
+type DeployHookSettings struct {
+	Enabled      bool   `json:"enabled"`
+	Secret       string `json:"secret,omitempty"`
+	GitLabURL    string `json:"gitlab_url"`
+	BitbucketURL string `json:"bitbucket_url"`
+}
+
+// PushHookDeployment is what a push webhook did for one app of the pushed repository and branch
+type PushHookDeployment struct {
+	AppID      string `json:"app_id"`
+	Branch     string `json:"branch"`
+	CommitSHA  string `json:"commit_sha"`
+	BuildJobID string `json:"build_job_id,omitempty"`
+	InFlight   bool   `json:"in_flight,omitempty"` // The build was already queued or running
+	Skipped    string `json:"skipped,omitempty"`   // Why no build was started
+}
+
+// PushHookResponse is the response of the push webhook receivers
+type PushHookResponse struct {
+	Deployments []PushHookDeployment `json:"deployments"`
+}
+
+// GET /api/v1/apps/{id}/deploy-hook - Get whether pushes to the app's branch deploy it
+func (h *Handlers) GetDeployHook(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getDeployHookApp(w, r)
+	if !ok {
+		return
+	}
+
+	secret, err := h.appRepo.GetDeployHookSecret(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deploy hook")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, newDeployHookSettings(secret != "", ""))
+}
+
+// POST /api/v1/apps/{id}/deploy-hook - Turn push deploys on, or rotate the secret when they already are
+// The secret goes into the GitLab webhook's secret token or the Bitbucket webhook's secret
+func (h *Handlers) EnableDeployHook(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getDeployHookApp(w, r)
+	if !ok {
+		return
+	}
+	if app.Source == services.AppSourceImage {
+		h.writeError(w, http.StatusBadRequest, "Image apps are not built from a repository - they cannot be deployed on push")
+		return
+	}
+
+	secret, err := services.GenerateDeployHookSecret()
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to generate deploy hook secret")
+		return
+	}
+	if err := h.appRepo.SetDeployHookSecret(r.Context(), app.ID, secret); err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to enable deploy hook")
+		return
+	}
+	h.logger.Info("Deploy hook secret generated",
+		zap.String("app_id", app.ID),
+		zap.String("user_id", h.getUserIDFromContext(r)),
+	)
+
+	h.writeJSON(w, http.StatusOK, newDeployHookSettings(true, secret))
+}
+
+// DELETE /api/v1/apps/{id}/deploy-hook - Turn push deploys off
+func (h *Handlers) DeleteDeployHook(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getDeployHookApp(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.appRepo.SetDeployHookSecret(r.Context(), app.ID, ""); err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to disable deploy hook")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, newDeployHookSettings(false, ""))
+}
+
+// getDeployHookApp loads the app of a deploy hook request, writing the error response when it cannot
+func (h *Handlers) getDeployHookApp(w http.ResponseWriter, r *http.Request) (*App, bool) {
+	app, err := h.appRepo.GetAppByID(chi.URLParam(r, "id"), h.getUserIDFromContext(r))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return nil, false
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return nil, false
+	}
+	return app, true
+}
+
+func newDeployHookSettings(enabled bool, secret string) DeployHookSettings {
+	return DeployHookSettings{
+		Enabled:      enabled,
+		Secret:       secret,
+		GitLabURL:    gitLabPushHookPath,
+		BitbucketURL: bitbucketPushHookPath,
+	}
+}
+
+// POST /api/v1/hooks/gitlab - GitLab push webhook
+// X-Gitlab-Token must be the deploy hook secret of the apps it deploys
+func (h *Handlers) GitLabPushHook(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get("X-Gitlab-Token")
+	h.receivePushHook(w, r,
+		func(body []byte) ([]services.PushEvent, error) {
+			return services.ParseGitLabPush(r.Header.Get("X-Gitlab-Event"), body)
+		},
+		func(secret string, _ []byte) bool {
+			return services.VerifyGitLabToken(secret, token)
+		},
+	)
+}
+
+// POST /api/v1/hooks/bitbucket - Bitbucket Cloud push webhook
+// X-Hub-Signature must be the HMAC-SHA256 of the body keyed with the deploy hook secret of the apps it deploys
+func (h *Handlers) BitbucketPushHook(w http.ResponseWriter, r *http.Request) {
+	signature := r.Header.Get("X-Hub-Signature")
+	h.receivePushHook(w, r,
+		func(body []byte) ([]services.PushEvent, error) {
+			return services.ParseBitbucketPush(r.Header.Get("X-Event-Key"), body)
+		},
+		func(secret string, body []byte) bool {
+			return services.VerifyBitbucketSignature(secret, body, signature)
+		},
+	)
+}
+
+// receivePushHook deploys the apps of the pushed repository and branch whose secret verifies the delivery
+// Deliveries that are not branch pushes are acknowledged and ignored; a push that verifies against no app
+// is rejected, so callers cannot tell which repositories are deployed on Stackyn
+func (h *Handlers) receivePushHook(w http.ResponseWriter, r *http.Request,
+	parse func(body []byte) ([]services.PushEvent, error),
+	verify func(secret string, body []byte) bool,
+) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPushHookBodyBytes+1))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	if len(body) > maxPushHookBodyBytes {
+		h.writeError(w, http.StatusRequestEntityTooLarge, "Webhook payload too large")
+		return
+	}
+
+	pushes, err := parse(body)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	response := PushHookResponse{Deployments: []PushHookDeployment{}}
+	if len(pushes) == 0 {
+		h.writeJSON(w, http.StatusAccepted, response)
+		return
+	}
+
+	verified := false
+	for _, push := range pushes {
+		apps, err := h.appRepo.GetDeployHookApps(r.Context(), repoKeys(push.RepoURLs), push.Branch)
+		if err != nil {
+			h.writeError(w, http.StatusInternalServerError, "Failed to look up apps")
+			return
+		}
+		for i := range apps {
+			if !verify(apps[i].Secret, body) {
+				continue
+			}
+			verified = true
+			response.Deployments = append(response.Deployments, h.deployPush(r, &apps[i].App, push))
+		}
+	}
+	if !verified {
+		h.writeError(w, http.StatusUnauthorized, "Invalid webhook signature")
+		return
+	}
+
+	h.writeJSON(w, http.StatusAccepted, response)
+}
+
+// deployPush builds and deploys app for a verified push, unless its owner's billing or plan rules it out
+func (h *Handlers) deployPush(r *http.Request, app *App, push services.PushEvent) PushHookDeployment {
+	result := PushHookDeployment{AppID: app.ID, Branch: push.Branch, CommitSHA: push.CommitSHA}
+	logger := h.logger.With(
+		zap.String("app_id", app.ID),
+		zap.String("provider", push.Provider),
+		zap.String("branch", push.Branch),
+		zap.String("commit_sha", push.CommitSHA),
+	)
+
+	if app.Status == "disabled" {
+		result.Skipped = "App is disabled"
+		return result
+	}
+	// Monorepo apps only deploy on pushes that change their root directory
+	if !services.RootDirAffected(app.RootDir, push.ChangedPaths) {
+		result.Skipped = "No changes under the app's root directory"
+		return result
+	}
+
+	// The owner pays for the build, as for redeploys of org apps
+	user, err := h.userRepo.GetUserByID(app.UserID)
+	if err != nil {
+		logger.Error("Failed to get app owner for push deploy", zap.Error(err))
+		result.Skipped = "Failed to verify billing status"
+		return result
+	}
+	if err := RequireWritableBilling(user, http.MethodPost); err != nil {
+		result.Skipped = err.Error()
+		return result
+	}
+
+	if h.planEnforcement != nil {
+		if err := h.planEnforcement.CheckAutoDeploy(r.Context(), app.UserID); err != nil {
+			result.Skipped = planLimitMessage(err)
+			return result
+		}
+		if err := h.planEnforcement.CheckMaxConcurrentBuilds(r.Context(), app.UserID); err != nil {
+			result.Skipped = planLimitMessage(err)
+			return result
+		}
+	}
+
+	// The push's branch is the app's branch, so the build picks up its head like a redeploy
+	ctx := context.WithValue(r.Context(), "deploy_trigger", deploystate.TriggerWebhook)
+	buildJobID, inFlight, err := h.enqueueRedeploy(r.WithContext(ctx), app, app.UserID, nil)
+	if err != nil {
+		result.Skipped = planLimitMessage(err)
+		return result
+	}
+
+	logger.Info("Push deploy enqueued", zap.String("build_job_id", buildJobID), zap.Bool("in_flight", inFlight))
+	result.BuildJobID = buildJobID
+	result.InFlight = inFlight
+	return result
+}
+
+// planLimitMessage is the user-facing reason a push deploy was not started
+func planLimitMessage(err error) string {
+	if planErr, ok := GetPlanLimitError(err); ok {
+		return planErr.Message
+	}
+	return "Failed to start deployment"
+}
+
+// repoKeys turns repository URLs into the form apps are matched by: lowercase host/owner/repo
+func repoKeys(urls []string) []string {
+	keys := make([]string, 0, len(urls))
+	for _, u := range urls {
+		if key := strings.ToLower(strings.TrimPrefix(repoWebURL(u), "https://")); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
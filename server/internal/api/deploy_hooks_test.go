@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/services"
+)
+
+func TestDeployPushSkipsUnaffectedRootDir(t *testing.T) {
+	h := &Handlers{logger: zap.NewNop()}
+	app := &App{ID: "app-1", Status: "running", RootDir: "apps/api"}
+	push := services.PushEvent{
+		Provider:     services.PushProviderGitLab,
+		Branch:       "main",
+		CommitSHA:    "b2",
+		ChangedPaths: []string{"apps/web/index.js"},
+	}
+
+	// The handlers have no repos, so reaching the billing check would panic
+	result := h.deployPush(httptest.NewRequest(http.MethodPost, gitLabPushHookPath, nil), app, push)
+	if result.Skipped == "" || result.BuildJobID != "" {
+		t.Errorf("deployPush = %+v, want skipped", result)
+	}
+}
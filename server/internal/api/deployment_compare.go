@@ -0,0 +1,249 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// DeploymentComparison is the response for GET /api/v1/apps/{id}/deployments/{a}/compare/{b}
+type DeploymentComparison struct {
+	AppID   string               `json:"app_id"`
+	From    DeploymentRef        `json:"from"`
+	To      DeploymentRef        `json:"to"`
+	Commits CommitRange          `json:"commits"`
+	EnvVars EnvVarChanges        `json:"env_vars"`
+	Config  DeploymentConfigDiff `json:"config"`
+}
+
+// DeploymentRef identifies one side of a comparison
+type DeploymentRef struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	CommitSHA string `json:"commit_sha,omitempty"`
+	ImageName string `json:"image_name,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// CommitRange is the source change between two deployments
+type CommitRange struct {
+	From       string `json:"from,omitempty"`
+	To         string `json:"to,omitempty"`
+	Known      bool   `json:"known"` // False when either deployment predates commit tracking
+	Changed    bool   `json:"changed"`
+	CompareURL string `json:"compare_url,omitempty"` // Commit list on the Git host (GitHub and GitLab)
+}
+
+// EnvVarChanges lists the env var keys that differ; values are never returned since they hold secrets
+type EnvVarChanges struct {
+	Known     bool     `json:"known"` // False when either deployment predates env snapshots
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Changed   []string `json:"changed"`
+	Unchanged int      `json:"unchanged"`
+}
+
+// DeploymentConfigDiff lists the runtime settings that differ between two deployments
+type DeploymentConfigDiff struct {
+	Known   bool           `json:"known"` // False when either deployment predates config snapshots
+	Changes []ConfigChange `json:"changes"`
+}
+
+// ConfigChange is one runtime setting that differs
+type ConfigChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// CompareDeployments reports what changed between two of an app's deployments
+// GET /api/v1/apps/{id}/deployments/{a}/compare/{b} - {a} is the older side, {b} the newer one
+func (h *Handlers) CompareDeployments(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	fromID := chi.URLParam(r, "a")
+	toID := chi.URLParam(r, "b")
+
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	if h.appRepo == nil || h.deploymentRepo == nil {
+		h.logger.Error("Repositories not initialized")
+		h.writeError(w, http.StatusInternalServerError, "Deployment repository not available")
+		return
+	}
+
+	// Get app from database (verifies ownership)
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to get app")
+		return
+	}
+
+	from, ok := h.getDeploymentSnapshot(w, r, app.ID, fromID)
+	if !ok {
+		return
+	}
+	to, ok := h.getDeploymentSnapshot(w, r, app.ID, toID)
+	if !ok {
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, DeploymentComparison{
+		AppID:   app.ID,
+		From:    deploymentRefFromSnapshot(from),
+		To:      deploymentRefFromSnapshot(to),
+		Commits: compareCommits(app.RepoURL, from.CommitSHA, to.CommitSHA),
+		EnvVars: compareEnvVars(from.EnvVars, to.EnvVars),
+		Config:  compareDeploymentConfigs(from.Config, to.Config),
+	})
+}
+
+// getDeploymentSnapshot loads one side of a comparison, writing the error response on failure
+func (h *Handlers) getDeploymentSnapshot(w http.ResponseWriter, r *http.Request, appID, deploymentID string) (*DeploymentSnapshot, bool) {
+	snapshot, err := h.deploymentRepo.GetDeploymentSnapshot(r.Context(), appID, deploymentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, fmt.Sprintf("Deployment %s not found", deploymentID))
+			return nil, false
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deployment")
+		return nil, false
+	}
+	return snapshot, true
+}
+
+func deploymentRefFromSnapshot(s *DeploymentSnapshot) DeploymentRef {
+	return DeploymentRef{
+		ID:        s.ID,
+		Status:    s.Status,
+		CommitSHA: s.CommitSHA,
+		ImageName: s.ImageName,
+		CreatedAt: s.CreatedAt,
+	}
+}
+
+// compareCommits describes the commit range, linking to the host's compare view when the repo is on GitHub or GitLab
+func compareCommits(repoURL, from, to string) CommitRange {
+	commits := CommitRange{From: from, To: to}
+	if from == "" || to == "" {
+		return commits
+	}
+	commits.Known = true
+	commits.Changed = from != to
+	if !commits.Changed {
+		return commits
+	}
+
+	base := repoWebURL(repoURL)
+	switch {
+	case strings.HasPrefix(base, "https://github.com/"):
+		commits.CompareURL = fmt.Sprintf("%s/compare/%s...%s", base, from, to)
+	case strings.HasPrefix(base, "https://gitlab.com/"):
+		commits.CompareURL = fmt.Sprintf("%s/-/compare/%s...%s", base, from, to)
+	}
+	return commits
+}
+
+// repoWebURL turns an HTTPS or SSH clone URL into the repository's web URL
+func repoWebURL(repoURL string) string {
+	url := strings.TrimSuffix(strings.TrimSpace(repoURL), "/")
+	url = strings.TrimSuffix(url, ".git")
+	if rest, ok := strings.CutPrefix(url, "git@"); ok {
+		host, path, found := strings.Cut(rest, ":")
+		if !found {
+			return ""
+		}
+		return "https://" + host + "/" + path
+	}
+	if rest, ok := strings.CutPrefix(url, "http://"); ok {
+		url = "https://" + rest
+	}
+	return url
+}
+
+// compareEnvVars diffs two env snapshots by key
+func compareEnvVars(from, to map[string]string) EnvVarChanges {
+	changes := EnvVarChanges{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	if from == nil || to == nil {
+		return changes
+	}
+	changes.Known = true
+
+	for key, value := range to {
+		previous, ok := from[key]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, key)
+		case previous != value:
+			changes.Changed = append(changes.Changed, key)
+		default:
+			changes.Unchanged++
+		}
+	}
+	for key := range from {
+		if _, ok := to[key]; !ok {
+			changes.Removed = append(changes.Removed, key)
+		}
+	}
+
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Removed)
+	sort.Strings(changes.Changed)
+	return changes
+}
+
+// compareDeploymentConfigs diffs two config snapshots field by field (by their JSON names)
+func compareDeploymentConfigs(from, to *services.DeploymentConfigSnapshot) DeploymentConfigDiff {
+	diff := DeploymentConfigDiff{Changes: []ConfigChange{}}
+	if from == nil || to == nil {
+		return diff
+	}
+	diff.Known = true
+
+	fromFields, toFields := configFields(from), configFields(to)
+	names := make([]string, 0, len(fromFields)+len(toFields))
+	for name := range fromFields {
+		names = append(names, name)
+	}
+	for name := range toFields {
+		if _, ok := fromFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !reflect.DeepEqual(fromFields[name], toFields[name]) {
+			diff.Changes = append(diff.Changes, ConfigChange{Field: name, From: fromFields[name], To: toFields[name]})
+		}
+	}
+	return diff
+}
+
+// configFields flattens a config snapshot into its JSON fields; fields left out by omitempty are absent
+func configFields(config *services.DeploymentConfigSnapshot) map[string]interface{} {
+	fields := map[string]interface{}{}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fields
+	}
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/services"
+	"stackyn/server/internal/tasks"
+)
+
+// DeploymentQueueStatus is where a deployment's build stands in the build queues, with an ETA
+// The ETA assumes builds take as long as recent successful builds of the same runtime
+type DeploymentQueueStatus struct {
+	Status                string `json:"status"` // queued, building, or not_queued once the build has left the queues
+	Queue                 string `json:"queue,omitempty"`
+	Priority              int    `json:"priority"`           // Queue priority of the owner's plan
+	Position              int    `json:"position,omitempty"` // 1-based place among builds waiting for a worker
+	BuildsAhead           int    `json:"builds_ahead"`       // Builds that start before this one
+	BuildsRunning         int    `json:"builds_running"`
+	Workers               int    `json:"workers"`           // Build worker slots serving the queue
+	Runtime               string `json:"runtime,omitempty"` // Runtime the estimate is based on
+	AverageBuildSeconds   int    `json:"average_build_seconds,omitempty"`
+	EstimatedStartSeconds *int   `json:"estimated_start_seconds,omitempty"` // Until a worker picks the build up (queued builds)
+	ETASeconds            *int   `json:"eta_seconds,omitempty"`             // Until the build is done; omitted without recent builds or workers
+}
+
+// GET /api/v1/deployments/{id}/queue - Get the build's place in the queue and an ETA
+// {id} is a deployment ID, or the build_job_id of a build still in the queue
+func (h *Handlers) GetDeploymentQueue(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+	if h.deploymentRepo == nil || h.appRepo == nil || h.taskEnqueue == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Build queue not available")
+		return
+	}
+
+	// Find the build and the app it belongs to
+	var appID, buildJobID string
+	var pos *services.BuildQueuePosition
+	deploymentData, err := h.deploymentRepo.GetDeploymentByID(id)
+	switch {
+	case err == nil:
+		appID, _ = deploymentData["app_id"].(string)
+		buildJobID, _ = deploymentData["build_job_id"].(string)
+	case errors.Is(err, pgx.ErrNoRows):
+		buildJobID = id
+		appID, _, err = h.deploymentRepo.GetBuildJob(r.Context(), buildJobID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Not started yet - only the queued task knows which app it builds
+			pos, err = h.taskEnqueue.GetBuildQueuePosition(r.Context(), buildJobID)
+			if err == nil && pos == nil {
+				h.writeError(w, http.StatusNotFound, "Deployment not found")
+				return
+			}
+			if err == nil {
+				var payload tasks.BuildTaskPayload
+				if err = json.Unmarshal(pos.Task.Payload, &payload); err == nil {
+					appID = payload.AppID
+				}
+			}
+		}
+		if err != nil {
+			h.logger.Error("Failed to find build", zap.Error(err), zap.String("build_job_id", buildJobID))
+			h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deployment")
+			return
+		}
+	default:
+		h.logger.Error("Failed to get deployment", zap.Error(err), zap.String("deployment_id", id))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deployment")
+		return
+	}
+
+	// Verify app ownership
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Deployment not found or access denied")
+			return
+		}
+		h.logger.Error("Failed to verify app ownership", zap.Error(err), zap.String("app_id", appID), zap.String("user_id", userID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to verify deployment access")
+		return
+	}
+
+	if pos == nil && buildJobID != "" {
+		if pos, err = h.taskEnqueue.GetBuildQueuePosition(r.Context(), buildJobID); err != nil {
+			h.logger.Error("Failed to inspect build queue", zap.Error(err), zap.String("build_job_id", buildJobID))
+			h.writeError(w, http.StatusInternalServerError, "Failed to inspect build queue")
+			return
+		}
+	}
+
+	status := DeploymentQueueStatus{Status: "not_queued"}
+	if h.planEnforcement != nil {
+		if priority, err := h.planEnforcement.GetQueuePriority(r.Context(), app.UserID); err == nil {
+			status.Priority = priority
+		}
+	}
+	if pos == nil {
+		h.writeJSON(w, http.StatusOK, status)
+		return
+	}
+
+	status.Status = "queued"
+	if pos.Building {
+		status.Status = "building"
+	}
+	status.Queue = pos.Task.Queue
+	status.Position = pos.Position
+	status.BuildsAhead = pos.Ahead
+	status.BuildsRunning = pos.Running
+	status.Workers = pos.Workers
+
+	estimate, err := h.deploymentRepo.GetBuildEstimate(r.Context(), app.ID, buildJobID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to estimate build duration")
+		return
+	}
+	status.Runtime = estimate.Runtime
+	if estimate.Samples > 0 {
+		status.AverageBuildSeconds = int(estimate.AverageDuration / time.Second)
+		start, eta, ok := buildETA(pos, estimate)
+		if ok {
+			startSeconds, etaSeconds := int(start/time.Second), int(eta/time.Second)
+			if !pos.Building {
+				status.EstimatedStartSeconds = &startSeconds
+			}
+			status.ETASeconds = &etaSeconds
+		}
+	}
+	h.writeJSON(w, http.StatusOK, status)
+}
+
+// buildETA estimates how long until a build starts and until it is done
+// Builds ahead are started in rounds as worker slots free up, each round taking an average build.
+// A running build is done an average build after it started (or soon, once it overran the average)
+func buildETA(pos *services.BuildQueuePosition, estimate *BuildEstimate) (start, eta time.Duration, ok bool) {
+	average := estimate.AverageDuration
+	if pos.Building {
+		eta = average
+		if estimate.StartedAt != nil {
+			eta = max(average-time.Since(*estimate.StartedAt), 0)
+		}
+		return 0, eta, true
+	}
+	if pos.Workers == 0 {
+		return 0, 0, false
+	}
+	if free := pos.Workers - pos.Running; pos.Ahead >= free {
+		rounds := (pos.Ahead-free)/pos.Workers + 1
+		start = time.Duration(rounds) * average
+	}
+	return start, start + average, true
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// SetTaskStateRepo sets the repository of task states used to show a deployment's tasks
+func (h *Handlers) SetTaskStateRepo(taskStateRepo *TaskStateRepo) {
+	h.taskStateRepo = taskStateRepo
+}
+
+// GET /api/v1/deployments/{id}/tasks - List the build and deploy tasks of a deployment with their status
+// Shows where a deployment is stuck: waiting in a queue, running, being retried or failed with an error
+func (h *Handlers) GetDeploymentTasks(w http.ResponseWriter, r *http.Request) {
+	deploymentID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+	if h.taskStateRepo == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Task states not available")
+		return
+	}
+
+	deploymentData, err := h.deploymentRepo.GetDeploymentByID(deploymentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Deployment not found")
+			return
+		}
+		h.logger.Error("Failed to get deployment", zap.Error(err), zap.String("deployment_id", deploymentID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deployment")
+		return
+	}
+
+	appID, _ := deploymentData["app_id"].(string)
+	if _, err := h.appRepo.GetAppByID(appID, userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Deployment not found or access denied")
+			return
+		}
+		h.logger.Error("Failed to verify app ownership", zap.Error(err), zap.String("app_id", appID), zap.String("user_id", userID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to verify deployment access")
+		return
+	}
+
+	buildJobID, _ := deploymentData["build_job_id"].(string)
+	taskList, err := h.taskStateRepo.ListDeploymentTasks(r.Context(), deploymentID, buildJobID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deployment tasks")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, taskList)
+}
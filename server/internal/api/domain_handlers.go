@@ -0,0 +1,373 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+	"stackyn/server/internal/deploystate"
+	"stackyn/server/internal/services"
+	"stackyn/server/internal/tasks"
+)
+
+// AppDomain represents a custom domain attached to an app
+type AppDomain struct {
+	ID                 string `json:"id"`
+	AppID              string `json:"app_id"`
+	Domain             string `json:"domain"`
+	VerificationToken  string `json:"-"`
+	Status             string `json:"status"` // pending, verified, failed
+	VerificationMethod string `json:"verification_method,omitempty"`
+	VerificationError  string `json:"verification_error,omitempty"`
+	VerifiedAt         string `json:"verified_at,omitempty"`
+	CreatedAt          string `json:"created_at"`
+	UpdatedAt          string `json:"updated_at"`
+}
+
+// DomainDNSRecord is a DNS record the user must create to verify/route a custom domain
+type DomainDNSRecord struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// AppDomainResponse is a custom domain with the DNS records needed to verify it
+type AppDomainResponse struct {
+	*AppDomain
+	DNSRecords []DomainDNSRecord `json:"dns_records"`
+}
+
+// CreateDomainRequest is the body for POST /api/v1/apps/{id}/domains
+type CreateDomainRequest struct {
+	Domain string `json:"domain" validate:"required,max=253"`
+}
+
+// DomainHandlers handles custom domain management for apps
+type DomainHandlers struct {
+	logger          *zap.Logger
+	appRepo         *AppRepo
+	domainRepo      *DomainRepo
+	deploymentRepo  *DeploymentRepo
+	planEnforcement PlanEnforcementService
+	verifier        *services.DomainVerificationService
+	taskEnqueue     *services.TaskEnqueueService
+	baseDomain      string // Platform base domain used for the CNAME target
+}
+
+// NewDomainHandlers creates a new domain handlers instance
+func NewDomainHandlers(logger *zap.Logger, appRepo *AppRepo, domainRepo *DomainRepo, deploymentRepo *DeploymentRepo, planEnforcement PlanEnforcementService, verifier *services.DomainVerificationService, taskEnqueue *services.TaskEnqueueService, baseDomain string) *DomainHandlers {
+	return &DomainHandlers{
+		logger:          logger,
+		appRepo:         appRepo,
+		domainRepo:      domainRepo,
+		deploymentRepo:  deploymentRepo,
+		planEnforcement: planEnforcement,
+		verifier:        verifier,
+		taskEnqueue:     taskEnqueue,
+		baseDomain:      baseDomain,
+	}
+}
+
+// GET /api/v1/apps/{id}/domains - List custom domains for app
+func (h *DomainHandlers) ListDomains(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getOwnedApp(w, r)
+	if !ok {
+		return
+	}
+
+	domains, err := h.domainRepo.GetDomainsByAppID(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve domains")
+		return
+	}
+
+	response := make([]AppDomainResponse, 0, len(domains))
+	for _, d := range domains {
+		response = append(response, h.toResponse(app, d))
+	}
+	h.writeJSON(w, http.StatusOK, response)
+}
+
+// POST /api/v1/apps/{id}/domains - Add custom domain to app
+func (h *DomainHandlers) CreateDomain(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getOwnedApp(w, r)
+	if !ok {
+		return
+	}
+	// Custom domains are gated by the custom_domains plan feature (the owner's plan for org apps)
+	if h.planEnforcement != nil {
+		if err := h.planEnforcement.CheckCustomDomains(r.Context(), app.UserID); err != nil {
+			if planErr, ok := GetPlanLimitError(err); ok {
+				writePlanLimitError(w, planErr)
+				return
+			}
+			h.writeError(w, http.StatusForbidden, "Plan limit exceeded")
+			return
+		}
+	}
+
+	var req CreateDomainRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	domain, err := h.verifier.NormalizeDomain(req.Domain)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, err := h.verifier.GenerateVerificationToken()
+	if err != nil {
+		h.logger.Error("Failed to generate domain verification token", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Failed to add domain")
+		return
+	}
+
+	created, err := h.domainRepo.CreateDomain(r.Context(), app.ID, domain, token)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			h.writeError(w, http.StatusConflict, "Domain is already attached to an app")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to add domain")
+		return
+	}
+
+	h.logger.Info("Custom domain added",
+		zap.String("app_id", app.ID),
+		zap.String("domain_id", created.ID),
+		zap.String("domain", domain),
+		zap.String("user_id", h.getUserIDFromContext(r)),
+	)
+
+	h.writeJSON(w, http.StatusCreated, h.toResponse(app, created))
+}
+
+// POST /api/v1/apps/{id}/domains/{domainId}/verify - Verify custom domain DNS
+func (h *DomainHandlers) VerifyDomain(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getOwnedApp(w, r)
+	if !ok {
+		return
+	}
+	userID := h.getUserIDFromContext(r)
+	domainID := chi.URLParam(r, "domainId")
+
+	domain, err := h.domainRepo.GetDomainByID(r.Context(), app.ID, domainID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Domain not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve domain")
+		return
+	}
+
+	if domain.Status == "verified" {
+		h.writeJSON(w, http.StatusOK, h.toResponse(app, domain))
+		return
+	}
+
+	method, verifyErr := h.verifier.VerifyDomain(r.Context(), domain.Domain, domain.VerificationToken, h.platformHostname(app))
+	status, errorMsg := "verified", ""
+	if verifyErr != nil {
+		status, errorMsg = "failed", verifyErr.Error()
+	}
+
+	if err := h.domainRepo.UpdateDomainVerification(r.Context(), domain.ID, status, method, errorMsg); err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to update domain")
+		return
+	}
+
+	domain, err = h.domainRepo.GetDomainByID(r.Context(), app.ID, domainID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve domain")
+		return
+	}
+
+	if verifyErr != nil {
+		h.writeJSON(w, http.StatusUnprocessableEntity, h.toResponse(app, domain))
+		return
+	}
+
+	// Redeploy the running image so the container's Traefik labels include the new host
+	// Traefik's ACME resolver issues (and later renews) the Let's Encrypt certificate on first request
+	h.refreshRoutes(r.Context(), app, userID)
+
+	h.writeJSON(w, http.StatusOK, h.toResponse(app, domain))
+}
+
+// DELETE /api/v1/apps/{id}/domains/{domainId} - Remove custom domain from app
+func (h *DomainHandlers) DeleteDomain(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getOwnedApp(w, r)
+	if !ok {
+		return
+	}
+	userID := h.getUserIDFromContext(r)
+	domainID := chi.URLParam(r, "domainId")
+
+	domain, err := h.domainRepo.GetDomainByID(r.Context(), app.ID, domainID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Domain not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve domain")
+		return
+	}
+
+	if err := h.domainRepo.DeleteDomain(r.Context(), app.ID, domainID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Domain not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to delete domain")
+		return
+	}
+
+	h.logger.Info("Custom domain removed",
+		zap.String("app_id", app.ID),
+		zap.String("domain_id", domainID),
+		zap.String("domain", domain.Domain),
+		zap.String("user_id", userID),
+	)
+
+	// Only verified domains are routed, so only those need a route refresh
+	if domain.Status == "verified" {
+		h.refreshRoutes(r.Context(), app, userID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refreshRoutes enqueues a deploy of the app's running image so Traefik labels pick up domain changes
+// Best-effort: if the app isn't running, the next deployment will include the domains
+func (h *DomainHandlers) refreshRoutes(ctx context.Context, app *App, userID string) {
+	enqueueRouteRefresh(ctx, h.logger, h.taskEnqueue, h.deploymentRepo, app.ID, userID, "custom domain")
+}
+
+// enqueueRouteRefresh enqueues a deploy of the app's running image with the env it runs with, so its
+// Traefik labels are regenerated from the routing state on record (domains, WAF) and its worker processes
+// match the app's settings. Container labels cannot change in place. Best-effort: an app that isn't running picks the state up on its next deploy
+func enqueueRouteRefresh(ctx context.Context, logger *zap.Logger, taskEnqueue *services.TaskEnqueueService, deploymentRepo *DeploymentRepo, appID, userID, reason string) {
+	if taskEnqueue == nil || deploymentRepo == nil {
+		logger.Warn("Cannot refresh routes - task enqueue not available",
+			zap.String("app_id", appID),
+			zap.String("reason", reason),
+		)
+		return
+	}
+
+	currentDeploymentID, fullImageName, err := deploymentRepo.GetCurrentDeployment(ctx, appID)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			logger.Warn("Failed to get current image for route refresh", zap.Error(err), zap.String("app_id", appID))
+		}
+		return
+	}
+
+	// Image is stored as "imageName:tag" where tag is the build job ID
+	imageName, imageTag := fullImageName, ""
+	if idx := strings.LastIndex(fullImageName, ":"); idx > 0 {
+		imageName = fullImageName[:idx]
+		imageTag = fullImageName[idx+1:]
+	}
+
+	payload := tasks.DeployTaskPayload{
+		AppID:               appID,
+		DeploymentID:        uuid.New().String(),
+		BuildJobID:          imageTag,
+		ImageName:           imageName,
+		UserID:              userID,
+		RequestedRAMMB:      512,
+		EnvFromDeploymentID: currentDeploymentID, // Only the routes change - keep the env the container runs with
+		Trigger:             deploystate.TriggerConfigChange,
+		TriggeredBy:         userID,
+	}
+	if _, err := taskEnqueue.EnqueueDeployTask(ctx, payload, userID); err != nil {
+		logger.Warn("Failed to enqueue deploy task for route refresh", zap.Error(err), zap.String("app_id", appID))
+		return
+	}
+
+	logger.Info("Enqueued deploy task to refresh routes",
+		zap.String("app_id", appID),
+		zap.String("image", fullImageName),
+		zap.String("reason", reason),
+	)
+}
+
+// getOwnedApp loads the app from the URL and verifies the current user owns it
+// Writes the error response and returns false on failure
+func (h *DomainHandlers) getOwnedApp(w http.ResponseWriter, r *http.Request) (*App, bool) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return nil, false
+	}
+
+	if h.appRepo == nil || h.domainRepo == nil {
+		h.logger.Error("Repositories not initialized")
+		h.writeError(w, http.StatusInternalServerError, "Domain repository not available")
+		return nil, false
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return nil, false
+		}
+		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return nil, false
+	}
+	return app, true
+}
+
+// platformHostname returns the app's default hostname (CNAME target for custom domains)
+func (h *DomainHandlers) platformHostname(app *App) string {
+	return fmt.Sprintf("%s.%s", app.Slug, h.baseDomain)
+}
+
+// toResponse attaches the DNS records the user needs to configure
+func (h *DomainHandlers) toResponse(app *App, d *AppDomain) AppDomainResponse {
+	txtName, txtValue := h.verifier.VerificationRecord(d.Domain, d.VerificationToken)
+	return AppDomainResponse{
+		AppDomain: d,
+		DNSRecords: []DomainDNSRecord{
+			{Type: "TXT", Name: txtName, Value: txtValue},
+			{Type: "CNAME", Name: d.Domain, Value: h.platformHostname(app)},
+		},
+	}
+}
+
+func (h *DomainHandlers) getUserIDFromContext(r *http.Request) string {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		h.logger.Warn("User ID not found in context")
+		return ""
+	}
+	return userID
+}
+
+func (h *DomainHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *DomainHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
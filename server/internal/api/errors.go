@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	stackynerrors "stackyn/server/internal/errors"
+	"stackyn/server/internal/services"
+)
+
+// ErrorResponse is the body of every API error response. Clients branch on error.code, which is stable;
+// error.message is meant for people and may change
+type ErrorResponse struct {
+	Error   ErrorDetail `json:"error"`
+	Message string      `json:"message,omitempty"` // Deprecated: use error.message
+}
+
+// ErrorDetail describes what went wrong
+type ErrorDetail struct {
+	Code      string      `json:"code"` // e.g. NOT_FOUND, PLAN_LIMIT_EXCEEDED (see ERROR_CATALOG.md)
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`    // Depends on the code, e.g. the fields of VALIDATION_FAILED
+	RequestID string      `json:"request_id,omitempty"` // Also sent as the X-Request-Id header; quote it to support
+}
+
+// PlanLimitDetails are the details of PLAN_LIMIT_EXCEEDED errors
+type PlanLimitDetails struct {
+	Limit     string `json:"limit"` // e.g. max_apps, max_ram, build_minutes
+	Current   int    `json:"current"`
+	Max       int    `json:"max"`
+	Requested int    `json:"requested,omitempty"` // Only set for RAM limits
+}
+
+// ConstraintDetails are the details of errors for apps that break a platform constraint
+type ConstraintDetails struct {
+	Constraint string `json:"constraint"` // e.g. git_host, single_container_only
+	Details    string `json:"details,omitempty"`
+}
+
+// requestIDHeader carries the ID chi's RequestID middleware gave the request
+const requestIDHeader = "X-Request-Id"
+
+// statusErrorCodes are the codes of errors written without a more specific one
+var statusErrorCodes = map[int]stackynerrors.ErrorCode{
+	http.StatusBadRequest:            stackynerrors.ErrorCodeBadRequest,
+	http.StatusUnauthorized:          stackynerrors.ErrorCodeUnauthorized,
+	http.StatusPaymentRequired:       stackynerrors.ErrorCodePaymentRequired,
+	http.StatusForbidden:             stackynerrors.ErrorCodeForbidden,
+	http.StatusNotFound:              stackynerrors.ErrorCodeNotFound,
+	http.StatusMethodNotAllowed:      stackynerrors.ErrorCodeMethodNotAllowed,
+	http.StatusConflict:              stackynerrors.ErrorCodeConflict,
+	http.StatusGone:                  stackynerrors.ErrorCodeGone,
+	http.StatusRequestEntityTooLarge: stackynerrors.ErrorCodePayloadTooLarge,
+	http.StatusUnsupportedMediaType:  stackynerrors.ErrorCodeUnsupportedMediaType,
+	http.StatusUnprocessableEntity:   stackynerrors.ErrorCodeValidationFailed,
+	http.StatusTooManyRequests:       stackynerrors.ErrorCodeRateLimited,
+	http.StatusInternalServerError:   stackynerrors.ErrorCodeInternalPlatformError,
+	http.StatusNotImplemented:        stackynerrors.ErrorCodeNotImplemented,
+	http.StatusBadGateway:            stackynerrors.ErrorCodeUpstreamError,
+	http.StatusServiceUnavailable:    stackynerrors.ErrorCodeServiceUnavailable,
+	http.StatusGatewayTimeout:        stackynerrors.ErrorCodeUpstreamTimeout,
+}
+
+// errorCodeForStatus returns the code of errors of an HTTP status that have no more specific one
+func errorCodeForStatus(status int) stackynerrors.ErrorCode {
+	if code, ok := statusErrorCodes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return stackynerrors.ErrorCodeInternalPlatformError
+	}
+	return stackynerrors.ErrorCodeBadRequest
+}
+
+// writeAPIError writes an ErrorResponse; an empty code is derived from status. The request ID comes from
+// the X-Request-Id header RequestIDHeader sets, so writers don't need the request
+func writeAPIError(w http.ResponseWriter, status int, code stackynerrors.ErrorCode, message string, details interface{}) {
+	if code == "" {
+		code = errorCodeForStatus(status)
+	}
+	if message == "" {
+		message = stackynerrors.GetMessage(code)
+	}
+	response := ErrorResponse{
+		Error: ErrorDetail{
+			Code:      string(code),
+			Message:   message,
+			Details:   details,
+			RequestID: w.Header().Get(requestIDHeader),
+		},
+		Message: message,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// writePlanLimitError answers a request refused by the plan enforcement service
+func writePlanLimitError(w http.ResponseWriter, err *services.PlanLimitError) {
+	writeAPIError(w, http.StatusForbidden, stackynerrors.ErrorCodePlanLimitExceeded, err.Message, PlanLimitDetails{
+		Limit:     err.Limit,
+		Current:   err.Current,
+		Max:       err.Max,
+		Requested: err.Requested,
+	})
+}
+
+// writeConstraintError answers a request for an app that breaks a platform constraint
+func writeConstraintError(w http.ResponseWriter, err *services.ConstraintError) {
+	writeAPIError(w, http.StatusBadRequest, constraintErrorCode(err.Constraint), err.Message, ConstraintDetails{
+		Constraint: err.Constraint,
+		Details:    err.Details,
+	})
+}
+
+// constraintErrorCode maps a constraint to the code of the catalog describing it, CONSTRAINT_VIOLATED for
+// those without one
+func constraintErrorCode(constraint string) stackynerrors.ErrorCode {
+	switch constraint {
+	case "repo_url", "invalid_repo_url":
+		return stackynerrors.ErrorCodeRepoNotFound
+	case "private_repo":
+		return stackynerrors.ErrorCodeRepoPrivateUnsupported
+	case "repo_size", "repo_too_large":
+		return stackynerrors.ErrorCodeRepoTooLarge
+	case "monorepo":
+		return stackynerrors.ErrorCodeMonorepoDetected
+	case "dockerfile", "no_dockerfile":
+		return stackynerrors.ErrorCodeDockerfilePresent
+	case "docker_compose", "no_docker_compose":
+		return stackynerrors.ErrorCodeDockerComposePresent
+	case "max_build_time":
+		return stackynerrors.ErrorCodeBuildTimeout
+	}
+	return stackynerrors.ErrorCodeConstraintViolated
+}
+
+// RequestIDHeader echoes the request ID in the X-Request-Id response header, where error responses and
+// clients reporting problems pick it up. Must run after chi's RequestID middleware
+func RequestIDHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestID := middleware.GetReqID(r.Context()); requestID != "" {
+			w.Header().Set(requestIDHeader, requestID)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// notFoundHandler and methodNotAllowedHandler answer requests no route matches in the error format
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, "", "No such API route", nil)
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusMethodNotAllowed, "", "Method not allowed", nil)
+}
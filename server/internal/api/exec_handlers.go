@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/services"
+	"stackyn/server/internal/tasks"
+)
+
+// Limits on one-off exec commands; the longest a command may run comes from the owner's plan
+const (
+	maxExecCommandLength = 4096 // Also the validate tag of ExecRequest.Command
+	execPollInterval     = 500 * time.Millisecond
+	execQueueGrace       = 2 * time.Minute // Time to get a worker and pull the image on top of the timeout
+)
+
+// ExecRequest is the body for POST /api/v1/apps/{id}/exec
+type ExecRequest struct {
+	Command        string `json:"command" validate:"notblank,max=4096"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"` // Defaults to (and may not exceed) the plan's limit
+}
+
+// ExecHandlers runs one-off commands in temporary containers of apps' running images
+type ExecHandlers struct {
+	logger          *zap.Logger
+	appRepo         *AppRepo
+	execRepo        *ExecRepo
+	deploymentRepo  *DeploymentRepo
+	taskEnqueue     *services.TaskEnqueueService
+	planEnforcement PlanEnforcementService
+}
+
+// NewExecHandlers creates a new exec handlers instance
+func NewExecHandlers(logger *zap.Logger, appRepo *AppRepo, execRepo *ExecRepo, deploymentRepo *DeploymentRepo, taskEnqueue *services.TaskEnqueueService, planEnforcement PlanEnforcementService) *ExecHandlers {
+	return &ExecHandlers{
+		logger:          logger,
+		appRepo:         appRepo,
+		execRepo:        execRepo,
+		deploymentRepo:  deploymentRepo,
+		taskEnqueue:     taskEnqueue,
+		planEnforcement: planEnforcement,
+	}
+}
+
+// POST /api/v1/apps/{id}/exec - Run a one-off command (e.g. rails db:migrate) with the app's image and env vars
+// The command's output is streamed back as plain text while it runs. The run ID is sent in the
+// X-Exec-Run-Id header and the outcome in the X-Exec-Status, X-Exec-Exit-Code and X-Exec-Error trailers.
+// A command keeps running if the client disconnects; GET /api/v1/apps/{id}/exec/{runId} has its outcome
+func (h *ExecHandlers) RunExec(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+	userID := h.getUserIDFromContext(r)
+
+	var req ExecRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Command = strings.TrimSpace(req.Command)
+
+	timeout := 5 * time.Minute
+	if h.planEnforcement != nil {
+		planTimeout, err := h.planEnforcement.GetExecTimeout(r.Context(), app.UserID)
+		if err != nil {
+			h.writeError(w, http.StatusInternalServerError, "Failed to check plan limits")
+			return
+		}
+		timeout = planTimeout
+	}
+	timeoutSeconds := int(timeout / time.Second)
+	if req.TimeoutSeconds != 0 {
+		if req.TimeoutSeconds < 1 || req.TimeoutSeconds > timeoutSeconds {
+			h.writeError(w, http.StatusBadRequest, fmt.Sprintf("timeout_seconds must be between 1 and %d on your plan", timeoutSeconds))
+			return
+		}
+		timeoutSeconds = req.TimeoutSeconds
+	}
+
+	if h.taskEnqueue == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Task queue not available")
+		return
+	}
+
+	deploymentID, imageName, err := h.deploymentRepo.GetCurrentDeployment(r.Context(), app.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusConflict, "App has no running deployment to run the command in")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve current deployment")
+		return
+	}
+
+	run, err := h.execRepo.CreateExecRun(r.Context(), app.ID, userID, req.Command, imageName, timeoutSeconds)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to create exec run")
+		return
+	}
+
+	payload := tasks.ExecTaskPayload{
+		RunID:          run.ID,
+		AppID:          app.ID,
+		UserID:         app.UserID,
+		DeploymentID:   deploymentID,
+		ImageName:      imageName,
+		Command:        req.Command,
+		TimeoutSeconds: timeoutSeconds,
+	}
+	if _, err := h.taskEnqueue.EnqueueExecTask(r.Context(), run.ID, timeoutSeconds, payload); err != nil {
+		h.logger.Error("Failed to enqueue exec run", zap.Error(err), zap.String("run_id", run.ID))
+		h.execRepo.MarkExecRunFailed(r.Context(), run.ID, "Failed to queue the command")
+		h.writeError(w, http.StatusInternalServerError, "Failed to queue command")
+		return
+	}
+
+	h.logger.Info("Exec command started",
+		zap.String("app_id", app.ID),
+		zap.String("run_id", run.ID),
+		zap.String("user_id", userID),
+		zap.Int("timeout_seconds", timeoutSeconds),
+	)
+	noteAuditDetail(r, "run_id", run.ID)
+
+	h.streamExecOutput(w, r, run.ID, time.Duration(timeoutSeconds)*time.Second+execQueueGrace)
+}
+
+// streamExecOutput writes a run's output to the client as the worker records it, until the run finishes
+// or maxWait passes. The request context is cut short by the router timeout, so the stream runs on its own
+// deadline and ends early only when the client goes away (a failed write)
+func (h *ExecHandlers) streamExecOutput(w http.ResponseWriter, r *http.Request, runID string, maxWait time.Duration) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Now().Add(maxWait + time.Minute)); err != nil {
+		h.logger.Debug("Cannot extend write deadline for exec stream", zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Exec-Run-Id", runID)
+	w.Header().Set("Trailer", "X-Exec-Status, X-Exec-Exit-Code, X-Exec-Error")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), maxWait)
+	defer cancel()
+
+	ticker := time.NewTicker(execPollInterval)
+	defer ticker.Stop()
+
+	offset := 0
+	for {
+		run, next, err := h.execRepo.GetExecRunOutput(ctx, runID, offset)
+		if err != nil {
+			h.logger.Warn("Failed to read exec output", zap.Error(err), zap.String("run_id", runID))
+			w.Header().Set("X-Exec-Error", "Failed to read command output")
+			return
+		}
+		if run.Output != "" {
+			if _, err := w.Write([]byte(run.Output)); err != nil {
+				h.logger.Info("Exec client disconnected - the command keeps running", zap.String("run_id", runID))
+				return
+			}
+			rc.Flush()
+		}
+		offset = next
+
+		if run.Status == "succeeded" || run.Status == "failed" {
+			w.Header().Set("X-Exec-Status", run.Status)
+			if run.ExitCode != nil {
+				w.Header().Set("X-Exec-Exit-Code", strconv.Itoa(*run.ExitCode))
+			}
+			if run.ErrorMessage != "" {
+				w.Header().Set("X-Exec-Error", run.ErrorMessage)
+			}
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			w.Header().Set("X-Exec-Status", run.Status)
+			w.Header().Set("X-Exec-Error", "Stopped waiting for the command; check the run for its outcome")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GET /api/v1/apps/{id}/exec/{runId} - Get an exec run with its exit code and output
+func (h *ExecHandlers) GetExecRun(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getApp(w, r)
+	if !ok {
+		return
+	}
+
+	run, err := h.execRepo.GetExecRun(r.Context(), app.ID, chi.URLParam(r, "runId"))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Exec run not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve exec run")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, run)
+}
+
+// getApp loads the app from the URL, writing the error response and returning false on failure
+func (h *ExecHandlers) getApp(w http.ResponseWriter, r *http.Request) (*App, bool) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return nil, false
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return nil, false
+		}
+		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return nil, false
+	}
+	return app, true
+}
+
+func (h *ExecHandlers) getUserIDFromContext(r *http.Request) string {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		h.logger.Warn("User ID not found in context")
+		return ""
+	}
+	return userID
+}
+
+func (h *ExecHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *ExecHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
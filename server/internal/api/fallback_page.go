@@ -0,0 +1,207 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/services"
+	"stackyn/server/internal/tasks"
+)
+
+// fallbackPageRefreshSeconds is how often pages for apps that are on their way up reload themselves
+const fallbackPageRefreshSeconds = 15
+
+// fallbackWakeRefreshSeconds is how often the page for a waking app reloads (containers start in seconds)
+const fallbackWakeRefreshSeconds = 5
+
+// fallbackPage is what the fallback handler tells a visitor about an app without a route
+type fallbackPage struct {
+	Status  int
+	Title   string
+	Heading string
+	Message string
+	AppName string
+	Refresh int // Seconds until the page reloads (0 = never)
+}
+
+// fallbackPageTemplate is the branded page shown instead of Traefik's generic 404
+var fallbackPageTemplate = template.Must(template.New("fallback").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{if .Refresh}}<meta http-equiv="refresh" content="{{.Refresh}}">{{end}}
+<title>{{.Title}} - Stackyn</title>
+<style>
+body { margin: 0; min-height: 100vh; display: flex; align-items: center; justify-content: center; font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; background: linear-gradient(135deg, #667eea 0%, #764ba2 100%); }
+.card { background: white; border-radius: 12px; padding: 40px; max-width: 480px; margin: 20px; text-align: center; box-shadow: 0 10px 40px rgba(0, 0, 0, 0.2); }
+h1 { color: #333; font-size: 24px; margin: 0 0 10px 0; }
+p { color: #666; font-size: 16px; line-height: 1.5; }
+.app { color: #667eea; font-weight: 600; }
+.spinner { width: 36px; height: 36px; margin: 0 auto 20px; border: 4px solid #eee; border-top-color: #667eea; border-radius: 50%; animation: spin 1s linear infinite; }
+.footer { color: #999; font-size: 13px; margin-top: 30px; }
+.footer a { color: #667eea; text-decoration: none; }
+@keyframes spin { to { transform: rotate(360deg); } }
+</style>
+</head>
+<body>
+<div class="card">
+{{if .Refresh}}<div class="spinner"></div>{{end}}
+<h1>{{.Heading}}</h1>
+{{if .AppName}}<p class="app">{{.AppName}}</p>{{end}}
+<p>{{.Message}}</p>
+{{if .Refresh}}<p class="footer">This page refreshes automatically.</p>{{end}}
+<p class="footer">Hosted on <a href="https://stackyn.com">Stackyn</a></p>
+</div>
+</body>
+</html>
+`))
+
+// FallbackPageHandler serves requests Traefik has no app route for
+// Traefik forwards app hosts to it through a lowest-priority catch-all router, so it only sees
+// requests for apps that are building, failed, stopped or asleep, and for hosts no app uses. The page
+// explains the app's state instead of Traefik's generic 404. Failure details stay private -
+// visitors only learn the state, owners see the reason in the dashboard. A request to a sleeping
+// app is what wakes it
+type FallbackPageHandler struct {
+	logger      *zap.Logger
+	appRepo     *AppRepo
+	sleepRepo   *AppSleepRepo
+	taskEnqueue *services.TaskEnqueueService // Optional: without it sleeping apps cannot be woken
+	baseDomain  string
+}
+
+// NewFallbackPageHandler creates a fallback page handler for app subdomains of baseDomain and custom domains
+func NewFallbackPageHandler(logger *zap.Logger, pool *pgxpool.Pool, baseDomain string) *FallbackPageHandler {
+	return &FallbackPageHandler{
+		logger:     logger,
+		appRepo:    NewAppRepo(pool, logger),
+		sleepRepo:  NewAppSleepRepo(pool, logger),
+		baseDomain: strings.ToLower(baseDomain),
+	}
+}
+
+// SetTaskEnqueue enables waking sleeping apps (the deploy worker starts their containers)
+func (h *FallbackPageHandler) SetTaskEnqueue(taskEnqueue *services.TaskEnqueueService) {
+	h.taskEnqueue = taskEnqueue
+}
+
+// SetCache lets wakes drop the owner's cached app list, so the app shows as waking right away
+func (h *FallbackPageHandler) SetCache(cache *services.ReadCache) {
+	h.sleepRepo.SetCache(cache)
+}
+
+// ServeHTTP renders the page for the app the request's host belongs to
+func (h *FallbackPageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := strings.ToLower(r.Host)
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	var page fallbackPage
+	app, err := h.appRepo.GetAppStatusByHost(r.Context(), host, h.baseDomain)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		page = fallbackPage{
+			Status:  http.StatusNotFound,
+			Title:   "Not found",
+			Heading: "There's no app here",
+			Message: "No app is deployed at " + host + ". Check the address, or deploy an app to this domain from your Stackyn dashboard.",
+		}
+	case err != nil:
+		page = fallbackPage{
+			Status:  http.StatusServiceUnavailable,
+			Title:   "Unavailable",
+			Heading: "This app is temporarily unavailable",
+			Message: "Please try again in a moment.",
+			Refresh: fallbackPageRefreshSeconds,
+		}
+	case app.Status == "sleeping" || app.Status == "waking":
+		page = h.wakeApp(r.Context(), app)
+	default:
+		page = fallbackPageForApp(app)
+	}
+
+	var body bytes.Buffer
+	if err := fallbackPageTemplate.Execute(&body, page); err != nil {
+		h.logger.Error("Failed to render fallback page", zap.Error(err), zap.String("host", host))
+		http.Error(w, http.StatusText(page.Status), page.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if page.Refresh > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(page.Refresh))
+	}
+	w.WriteHeader(page.Status)
+	if r.Method != http.MethodHead {
+		w.Write(body.Bytes())
+	}
+}
+
+// wakeApp starts waking a sleeping app and returns the interstitial shown while it starts
+// The wake is requested again while the app is waking, so a wake task that was lost or gave up
+// is retried by the next visit (requests share the task while it is queued or running)
+func (h *FallbackPageHandler) wakeApp(ctx context.Context, app *App) fallbackPage {
+	page := fallbackPage{
+		Status:  http.StatusServiceUnavailable,
+		Title:   "Waking up",
+		Heading: "Waking up",
+		AppName: app.Name,
+		Message: "This app was asleep after a period of inactivity and is starting now. It will be available here in a few seconds.",
+		Refresh: fallbackWakeRefreshSeconds,
+	}
+	if h.taskEnqueue == nil {
+		h.logger.Warn("Cannot wake sleeping app - task queue not configured", zap.String("app_id", app.ID))
+		return page
+	}
+
+	if app.Status == "sleeping" {
+		if _, err := h.sleepRepo.StartAppWake(ctx, app.ID); err != nil {
+			return page // Logged by the repository; the next refresh tries again
+		}
+	}
+	payload := tasks.AppWakeTaskPayload{AppID: app.ID, UserID: app.UserID}
+	if _, err := h.taskEnqueue.EnqueueAppWakeTask(ctx, app.ID, payload); err != nil {
+		h.logger.Error("Failed to enqueue app wake", zap.Error(err), zap.String("app_id", app.ID))
+	}
+	return page
+}
+
+// fallbackPageForApp describes an app whose route is missing, by its status
+func fallbackPageForApp(app *App) fallbackPage {
+	page := fallbackPage{Status: http.StatusServiceUnavailable, AppName: app.Name}
+	switch app.Status {
+	case "pending", "building", "deploying":
+		page.Title = "Deploy in progress"
+		page.Heading = "Deploy in progress"
+		page.Message = "This app is being built and deployed. It will be available here as soon as the deploy finishes."
+		page.Refresh = fallbackPageRefreshSeconds
+	case "running", "starting":
+		// The container is starting, or is up but Traefik has not picked up its route yet
+		page.Title = "Starting up"
+		page.Heading = "Starting up"
+		page.Message = "This app is starting. It will be available here in a few seconds."
+		page.Refresh = fallbackPageRefreshSeconds
+	case "failed":
+		page.Title = "Build failed"
+		page.Heading = "The latest deploy failed"
+		page.Message = "This app could not be built or started. If you own it, check the build logs in your Stackyn dashboard."
+	default:
+		page.Title = "App unavailable"
+		page.Heading = "This app is not running"
+		page.Message = "This app has been stopped by its owner or is currently unavailable."
+	}
+	return page
+}
@@ -1,25 +1,29 @@
 package api
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
+	_ "time/tzdata" // Embedded zone database so profile timezones validate on images without tzdata
 
-	"github.com/docker/docker/client"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"go.uber.org/zap"
+	"stackyn/server/internal/deploystate"
 	stackynerrors "stackyn/server/internal/errors"
 	"stackyn/server/internal/services"
 	"stackyn/server/internal/tasks"
@@ -32,11 +36,21 @@ type App struct {
 	Name      string    `json:"name"`
 	Slug      string    `json:"slug"`
 	Status    string    `json:"status"`
+	StatusReason string `json:"status_reason,omitempty"` // Why the app is disabled (billing, plan limits)
+	OrganizationID string `json:"organization_id,omitempty"` // Set for org-scoped apps
+	UserID    string    `json:"-"`                          // Owning (billed) user - the org owner for org apps
 	URL       string    `json:"url"`
 	RepoURL   string    `json:"repo_url"`
 	Branch    string    `json:"branch"`
+	RootDir   string    `json:"root_dir,omitempty"` // Repository subdirectory the app is built from (monorepos)
 	CreatedAt string    `json:"created_at"`
 	UpdatedAt string    `json:"updated_at"`
+	FirstDeployedAt string `json:"first_deployed_at,omitempty"` // First successful deployment; empty until the app has gone live
+	Source    string    `json:"source"`                    // "git" (built from RepoURL) or "image" (runs Image from a registry)
+	Image     string    `json:"image,omitempty"`           // Image reference of image apps, e.g. ghcr.io/acme/api:1.4
+	ImageDigest string  `json:"image_digest,omitempty"`    // Digest the running deployment of an image app is pinned to
+	ImageUpdateAvailable bool `json:"image_update_available,omitempty"` // The registry serves a newer digest for Image; redeploy to pick it up
+	ImageLatestDigest string `json:"-"`
 	Deployment *AppDeployment `json:"deployment,omitempty"`
 }
 
@@ -62,6 +76,58 @@ type UsageStats struct {
 	RestartCount       int     `json:"restart_count"`
 }
 
+// AppMetricSample is one point of an app's resource usage, sampled from docker stats by the deploy worker
+type AppMetricSample struct {
+	Timestamp          string    `json:"timestamp"`
+	CPUPercent         float64   `json:"cpu_percent"` // 100 = one full core
+	CPULimit           float64   `json:"cpu_limit"`   // Cores allowed (0 = unlimited)
+	MemoryUsageMB      float64   `json:"memory_usage_mb"`
+	MemoryLimitMB      float64   `json:"memory_limit_mb"`
+	MemoryUsagePercent float64   `json:"memory_usage_percent"`
+	DiskUsageMB        *float64  `json:"disk_usage_mb,omitempty"` // Container writable layer; measured every few minutes
+	NetworkRxBytes     int64     `json:"network_rx_bytes"`
+	NetworkTxBytes     int64     `json:"network_tx_bytes"`
+	RestartCount       int       `json:"restart_count"`
+	sampledAt          time.Time
+}
+
+// AppMetrics is the response for GET /api/v1/apps/{id}/metrics
+type AppMetrics struct {
+	AppID             string            `json:"app_id"`
+	Current           *AppMetricSample  `json:"current"` // Null when no container has been sampled recently
+	Window            string            `json:"window"`
+	ResolutionSeconds int               `json:"resolution_seconds"`
+	Samples           []AppMetricSample `json:"samples"` // Averaged per resolution bucket, oldest first
+}
+
+// AppTrafficBucket is an app's traffic over one span, as recorded from Traefik's access log
+type AppTrafficBucket struct {
+	Timestamp         string             `json:"timestamp,omitempty"` // Start of the span (omitted for totals)
+	Requests          int64              `json:"requests"`
+	RequestsPerSecond float64            `json:"requests_per_second"`
+	P95LatencyMs      float64            `json:"p95_latency_ms"` // Estimated from a latency histogram
+	Status            AppTrafficStatuses `json:"status"`
+	EgressBytes       int64              `json:"egress_bytes"` // Response bytes sent to clients
+	latency           []int64
+}
+
+// AppTrafficStatuses counts responses by status class
+type AppTrafficStatuses struct {
+	Status2xx int64 `json:"2xx"`
+	Status3xx int64 `json:"3xx"`
+	Status4xx int64 `json:"4xx"`
+	Status5xx int64 `json:"5xx"`
+}
+
+// AppTraffic is the response for GET /api/v1/apps/{id}/traffic
+type AppTraffic struct {
+	AppID             string             `json:"app_id"`
+	Window            string             `json:"window"`
+	ResolutionSeconds int                `json:"resolution_seconds"`
+	Totals            AppTrafficBucket   `json:"totals"`
+	Buckets           []AppTrafficBucket `json:"buckets"` // Only spans with requests, oldest first
+}
+
 type Deployment struct {
 	ID          interface{} `json:"id"` // UUID string from database
 	AppID       interface{} `json:"app_id"` // UUID string from database
@@ -72,10 +138,34 @@ type Deployment struct {
 	BuildLog    interface{} `json:"build_log,omitempty"`
 	RuntimeLog  interface{} `json:"runtime_log,omitempty"`
 	ErrorMessage interface{} `json:"error_message,omitempty"`
+	RollbackFromDeploymentID interface{} `json:"rollback_from_deployment_id,omitempty"` // Set when this deployment was a rollback
+	EnvFromDeploymentID interface{} `json:"env_from_deployment_id,omitempty"` // Set when the env snapshot was reused from an earlier deployment
+	EnvSnapshot map[string]string `json:"env_snapshot,omitempty"` // Env vars the container was started with (single deployment only)
+	CrashLog    string      `json:"crash_log,omitempty"` // Last stderr lines of a crashed deployment's container (single deployment only)
+	Trigger     string      `json:"trigger,omitempty"` // What started the deployment (manual, cli, webhook, rollback, ...); empty for older deployments
+	TriggeredBy string      `json:"triggered_by,omitempty"` // User who started it; empty when the platform did
+	TriggeredByEmail string `json:"triggered_by_email,omitempty"`
+	CommitSHA   string      `json:"commit_sha,omitempty"`
+	CommitAuthor  string    `json:"commit_author,omitempty"`
+	CommitMessage string    `json:"commit_message,omitempty"`
+	CommitBranch  string    `json:"commit_branch,omitempty"`
+	CommitSummary string    `json:"commit_summary,omitempty"` // Short SHA and message title, e.g. "abc1234: fix login bug"
+	BuildStrategy string    `json:"build_strategy,omitempty"` // Strategy that built the image (dockerfile, buildpacks, nixpacks); empty for older deployments
 	CreatedAt   string      `json:"created_at"`
 	UpdatedAt   string      `json:"updated_at"`
 }
 
+// RedeployRequest is the optional body for POST /api/v1/apps/{id}/redeploy
+type RedeployRequest struct {
+	Ref string `json:"ref,omitempty"` // Branch, tag or commit SHA to deploy once (defaults to the app's branch head)
+}
+
+// RollbackRequest is the optional body for POST /api/v1/apps/{id}/rollback
+type RollbackRequest struct {
+	DeploymentID  string `json:"deployment_id,omitempty"`   // Target deployment (defaults to the previous successful one)
+	UseCurrentEnv bool   `json:"use_current_env,omitempty"` // Start with the app's current env vars instead of the target's snapshot
+}
+
 type DeploymentLogs struct {
 	DeploymentID int    `json:"deployment_id"`
 	Status      string `json:"status"`
@@ -85,16 +175,23 @@ type DeploymentLogs struct {
 }
 
 type CreateAppRequest struct {
-	Name    string            `json:"name"`
-	Slug    string            `json:"slug,omitempty"` // Optional slug (will be auto-generated from name if not provided)
-	RepoURL string            `json:"repo_url"`
-	Branch  string            `json:"branch"`
-	EnvVars []CreateEnvVarRequest `json:"env_vars,omitempty"` // Optional environment variables
+	Name    string            `json:"name" validate:"notblank,max=100"`
+	Slug    string            `json:"slug,omitempty" validate:"omitempty,slug"` // Optional slug (will be auto-generated from name if not provided)
+	RepoURL string            `json:"repo_url" validate:"omitempty,repourl,max=500"` // Required for git apps (checked against the supported hosts)
+	Branch  string            `json:"branch" validate:"max=255"`
+	RootDir string            `json:"root_dir,omitempty" validate:"max=255"` // Optional - build from this subdirectory of the repo (e.g. apps/api)
+	EnvVars []CreateEnvVarRequest `json:"env_vars,omitempty" validate:"dive"` // Optional environment variables
+	OrganizationID string     `json:"organization_id,omitempty" validate:"omitempty,uuid"` // Optional - create the app in an organization
+	Source  string            `json:"source,omitempty" validate:"omitempty,oneof=git image"` // "git" (default) or "image" - run Image instead of building RepoURL
+	Image   string            `json:"image,omitempty" validate:"max=500"`  // Image apps: registry image, e.g. nginx:1.27 or ghcr.io/acme/api:1.4
+	RegistryCredentials *RegistryCredentialsRequest `json:"registry_credentials,omitempty"` // Image apps: login for a private registry
 }
 
 type CreateAppResponse struct {
 	App       App        `json:"app"`
 	Deployment Deployment `json:"deployment"`
+	BuildJobID string    `json:"build_job_id,omitempty"`
+	InFlight  bool       `json:"in_flight,omitempty"` // Redeploy returned a build that was already queued or running
 	Error     string     `json:"error,omitempty"`
 }
 
@@ -108,10 +205,21 @@ type EnvVar struct {
 }
 
 type CreateEnvVarRequest struct {
-	Key   string `json:"key"`
+	Key   string `json:"key" validate:"required,envkey,max=255"`
+	Value string `json:"value"`
+}
+
+type UpdateEnvVarRequest struct {
 	Value string `json:"value"`
 }
 
+type BulkEnvVarResponse struct {
+	EnvVars    []EnvVar `json:"env_vars"`
+	Count      int      `json:"count"`
+	Redeployed bool     `json:"redeployed"`
+	BuildJobID string   `json:"build_job_id,omitempty"`
+}
+
 type UserProfile struct {
 	ID            string             `json:"id"`
 	Email         string             `json:"email"`
@@ -122,6 +230,10 @@ type UserProfile struct {
 	BillingStatus string             `json:"billing_status,omitempty"` // trial | active | expired
 	CreatedAt     string             `json:"created_at"`
 	UpdatedAt     string             `json:"updated_at"`
+	Timezone      string             `json:"timezone"`
+	Locale        string             `json:"locale"`
+	AvatarURL     string             `json:"avatar_url,omitempty"`
+	NotificationPreferences services.NotificationPreferences `json:"notification_preferences"`
 	Quota         *Quota             `json:"quota,omitempty"`
 	Subscription  *SubscriptionInfo  `json:"subscription,omitempty"`
 }
@@ -131,6 +243,9 @@ type SubscriptionInfo struct {
 	Plan           string  `json:"plan"`            // starter, pro
 	TrialStartedAt *string `json:"trial_started_at,omitempty"`
 	TrialEndsAt    *string `json:"trial_ends_at,omitempty"`
+	CurrentPeriodStart *string `json:"current_period_start,omitempty"`
+	CurrentPeriodEnd   *string `json:"current_period_end,omitempty"`
+	CancelAtPeriodEnd  bool    `json:"cancel_at_period_end"` // Cancelled; access ends at current_period_end
 	RAMLimitMB     int     `json:"ram_limit_mb"`
 	DiskLimitGB    int     `json:"disk_limit_gb"`
 }
@@ -158,6 +273,10 @@ type PlanInfo struct {
 	Workers         bool   `json:"workers"`
 	PriorityBuilds  bool   `json:"priority_builds"`
 	ManualDeployOnly bool  `json:"manual_deploy_only"`
+	BuildMinutes     int   `json:"build_minutes"`
+	TeamMembers      int   `json:"team_members"`
+	AccessRules      bool  `json:"access_rules"`
+	Isolation        string `json:"isolation"`
 }
 
 type HealthResponse struct {
@@ -184,6 +303,22 @@ type Handlers struct {
 	taskEnqueue        *services.TaskEnqueueService
 	wsHub              *services.Hub
 	deploymentService  DeploymentService
+	usageService       *services.UsageService
+	orgRepo            *OrganizationRepo
+	objectStorage      services.ObjectStorage
+	metricsRepo        *AppMetricsRepo
+	trafficRepo        *AppTrafficRepo
+	deployEventRepo    *DeployEventRepo
+	logSearchRepo      *LogSearchRepo // Optional: log lines indexed for search
+	hostRepo           *HostRepo
+	traefikProviderToken string // Optional: enables GET /api/v1/traefik/routes
+	logDownloadSigner  *services.LogDownloadSigner
+	taskStateRepo      *TaskStateRepo
+	gitService         *services.GitService
+	domainRepo         *DomainRepo
+	domainVerifier     *services.DomainVerificationService
+	cronRepo           *CronRepo
+	imageScanRepo      *ImageScanRepo // Optional: vulnerability scans of built images
 }
 
 // DeploymentService interface for deployment operations
@@ -213,6 +348,8 @@ type LogPersistenceService interface {
 	GetLogsByDeploymentID(ctx context.Context, appID string, deploymentID string) (string, error)
 	GetLogsByBuildJobID(ctx context.Context, appID string, buildJobID string) (string, error)
 	GetLatestBuildLogs(ctx context.Context, appID string) (string, error)
+	OpenBuildLog(ctx context.Context, appID string, buildJobID string) (io.ReadCloser, error)
+	OpenRuntimeLog(ctx context.Context, appID string, containerID string) (*services.RuntimeLogReader, error)
 	DeleteOldLogs(ctx context.Context, appID string, before time.Time) error
 }
 
@@ -227,11 +364,21 @@ type PlanEnforcementService interface {
 	CheckMaxApps(ctx context.Context, userID string, currentAppCount int) error
 	CheckMaxRAM(ctx context.Context, userID string, requestedRAMMB int) error
 	CheckMaxConcurrentBuilds(ctx context.Context, userID string) error
+	CheckCustomDomains(ctx context.Context, userID string) error
+	CheckBuildMinutes(ctx context.Context, userID string) error
+	CheckTeamMembers(ctx context.Context, userID string, currentSeats int) error
+	CheckHealthChecks(ctx context.Context, userID string) error
+	CheckWorkers(ctx context.Context, userID string) error
+	CheckAutoDeploy(ctx context.Context, userID string) error
+	CheckAccessRules(ctx context.Context, userID string) error
+	GetExecTimeout(ctx context.Context, userID string) (time.Duration, error)
+	GetIsolationLevel(ctx context.Context, userID string) (services.IsolationLevel, error)
 	GetQueuePriority(ctx context.Context, userID string) (int, error)
 	IncrementBuildCount(ctx context.Context, userID string) error
 	DecrementBuildCount(ctx context.Context, userID string) error
 	IncrementRAMUsage(ctx context.Context, userID string, ramMB int) error
 	DecrementRAMUsage(ctx context.Context, userID string, ramMB int) error
+	ReleaseAppRAM(ctx context.Context, appID string)
 }
 
 // GetPlanLimitError extracts PlanLimitError from error
@@ -282,6 +429,66 @@ func NewHandlers(logger *zap.Logger, logPersistence LogPersistenceService, conta
 	}
 }
 
+// SetUsageService sets the usage service used for quota figures on profile responses
+func (h *Handlers) SetUsageService(usageService *services.UsageService) {
+	h.usageService = usageService
+}
+
+// SetOrganizationRepo sets the organization repository used for org-scoped app creation
+func (h *Handlers) SetOrganizationRepo(orgRepo *OrganizationRepo) {
+	h.orgRepo = orgRepo
+}
+
+// SetObjectStorage sets the object storage used for avatar uploads
+func (h *Handlers) SetObjectStorage(objectStorage services.ObjectStorage) {
+	h.objectStorage = objectStorage
+}
+
+// SetMetricsRepo sets the repository of docker stats samples used for app usage figures
+func (h *Handlers) SetMetricsRepo(metricsRepo *AppMetricsRepo) {
+	h.metricsRepo = metricsRepo
+}
+
+// SetTrafficRepo sets the repository of per-app traffic recorded from Traefik's access log
+func (h *Handlers) SetTrafficRepo(trafficRepo *AppTrafficRepo) {
+	h.trafficRepo = trafficRepo
+}
+
+// SetLogDownloadSigner sets the signer for time-limited build log download URLs
+func (h *Handlers) SetLogDownloadSigner(signer *services.LogDownloadSigner) {
+	h.logDownloadSigner = signer
+}
+
+// SetGitService sets the git service used to validate refs of pinned redeploys
+func (h *Handlers) SetGitService(gitService *services.GitService) {
+	h.gitService = gitService
+}
+
+// SetDomainRepo sets the custom domain repository and verifier used to import app manifests
+func (h *Handlers) SetDomainRepo(domainRepo *DomainRepo, verifier *services.DomainVerificationService) {
+	h.domainRepo = domainRepo
+	h.domainVerifier = verifier
+}
+
+// SetCronRepo sets the cron job repository used to export and import app manifests
+func (h *Handlers) SetCronRepo(cronRepo *CronRepo) {
+	h.cronRepo = cronRepo
+}
+
+// getAllocatedUsage returns a user's app count, allocated RAM (MB) and allocated disk (MB)
+// Figures come from the usage service (cached) rather than live container stats
+func (h *Handlers) getAllocatedUsage(ctx context.Context, userID string) (appCount, totalRAMMB, totalDiskMB int) {
+	if h.usageService == nil {
+		return 0, 0, 0
+	}
+	summary, err := h.usageService.GetUsageSummary(ctx, userID)
+	if err != nil {
+		h.logger.Warn("Failed to get usage summary for quota calculation", zap.Error(err), zap.String("user_id", userID))
+		return 0, 0, 0
+	}
+	return int(summary.Apps.Used), int(summary.RAM.Used), int(summary.Disk.Used * 1024)
+}
+
 // getUserIDFromContext extracts user ID from request context
 func (h *Handlers) getUserIDFromContext(r *http.Request) string {
 	userID, ok := r.Context().Value("user_id").(string)
@@ -292,6 +499,19 @@ func (h *Handlers) getUserIDFromContext(r *http.Request) string {
 	return userID
 }
 
+// requestTrigger is the deployment trigger for a deploy a user starts with this request: cli when the
+// request was authenticated with an API token, manual otherwise
+// Push webhooks set deploy_trigger in the context instead
+func requestTrigger(ctx context.Context) string {
+	if trigger, ok := ctx.Value("deploy_trigger").(string); ok && trigger != "" {
+		return trigger
+	}
+	if _, viaToken := ctx.Value("api_token_id").(string); viaToken {
+		return deploystate.TriggerCLI
+	}
+	return deploystate.TriggerManual
+}
+
 // getCurrentAppCount gets the current number of apps for a user
 func (h *Handlers) getCurrentAppCount(ctx context.Context, userID string) (int, error) {
 	if h.appRepo == nil {
@@ -335,22 +555,9 @@ func (h *Handlers) writeJSON(w http.ResponseWriter, status int, data interface{}
 	}
 }
 
-// ErrorResponse represents a standardized error response
-type ErrorResponse struct {
-	Error   ErrorDetail `json:"error"`
-	Message string      `json:"message,omitempty"` // Deprecated: use error.message
-}
-
-// ErrorDetail contains error code and message
-type ErrorDetail struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
-	Details string `json:"details,omitempty"`
-}
-
-// Helper to write error response (legacy format for backward compatibility)
+// Helper to write error response; the code is derived from the status (see writeAPIError)
 func (h *Handlers) writeError(w http.ResponseWriter, status int, message string) {
-	h.writeJSON(w, status, map[string]string{"error": message})
+	writeAPIError(w, status, "", message, nil)
 }
 
 // writeStackynError writes a StackynError in the standardized format
@@ -366,14 +573,11 @@ func (h *Handlers) writeStackynError(w http.ResponseWriter, r *http.Request, sta
 		zap.Error(err.Err),
 	)
 
-	response := ErrorResponse{
-		Error: ErrorDetail{
-			Code:    string(err.Code),
-			Message: err.Message,
-			Details: err.Details,
-		},
+	var details interface{}
+	if err.Details != "" {
+		details = err.Details
 	}
-	h.writeJSON(w, status, response)
+	writeAPIError(w, status, err.Code, err.Message, details)
 }
 
 // handleError processes an error and writes appropriate response
@@ -386,6 +590,7 @@ func (h *Handlers) handleError(w http.ResponseWriter, r *http.Request, err error
 		// Map error codes to HTTP status codes
 		switch stackynErr.Code {
 		case stackynerrors.ErrorCodeRepoNotFound,
+			stackynerrors.ErrorCodeRootDirNotFound,
 			stackynerrors.ErrorCodePlanLimitExceeded,
 			stackynerrors.ErrorCodeDeployLocked:
 			status = http.StatusBadRequest
@@ -412,33 +617,13 @@ func (h *Handlers) handleError(w http.ResponseWriter, r *http.Request, err error
 
 	// Check for plan limit errors
 	if planErr, ok := GetPlanLimitError(err); ok {
-		stackynErr := stackynerrors.New(stackynerrors.ErrorCodePlanLimitExceeded, planErr.Message)
-		h.writeStackynError(w, r, http.StatusForbidden, stackynErr)
+		writePlanLimitError(w, planErr)
 		return
 	}
 
 	// Check for constraint errors
 	if constraintErr, ok := GetConstraintError(err); ok {
-		// Map constraint errors to appropriate error codes based on constraint name
-		var code stackynerrors.ErrorCode
-		switch constraintErr.Constraint {
-		case "repo_url", "invalid_repo_url":
-			code = stackynerrors.ErrorCodeRepoNotFound
-		case "private_repo":
-			code = stackynerrors.ErrorCodeRepoPrivateUnsupported
-		case "repo_size", "repo_too_large":
-			code = stackynerrors.ErrorCodeRepoTooLarge
-		case "monorepo":
-			code = stackynerrors.ErrorCodeMonorepoDetected
-		case "dockerfile", "no_dockerfile":
-			code = stackynerrors.ErrorCodeDockerfilePresent
-		case "docker_compose", "no_docker_compose":
-			code = stackynerrors.ErrorCodeDockerComposePresent
-		default:
-			code = stackynerrors.ErrorCodeInternalPlatformError
-		}
-		stackynErr := stackynerrors.New(code, constraintErr.Message)
-		h.writeStackynError(w, r, http.StatusBadRequest, stackynErr)
+		writeConstraintError(w, constraintErr)
 		return
 	}
 
@@ -447,8 +632,8 @@ func (h *Handlers) handleError(w http.ResponseWriter, r *http.Request, err error
 		zap.Error(err),
 		zap.String("request_id", requestID),
 	)
-	stackynErr := stackynerrors.Wrap(stackynerrors.ErrorCodeInternalPlatformError, err, "An unexpected error occurred")
-	h.writeStackynError(w, r, defaultStatus, stackynErr)
+	// The error itself stays in the logs - it may hold SQL, hostnames or paths
+	writeAPIError(w, defaultStatus, "", "An unexpected error occurred", nil)
 }
 
 // GET /api/apps - List all apps for authenticated user
@@ -525,26 +710,104 @@ func (h *Handlers) GetAppByID(w http.ResponseWriter, r *http.Request) {
 // POST /api/v1/apps - Create app
 func (h *Handlers) CreateApp(w http.ResponseWriter, r *http.Request) {
 	var req CreateAppRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	app, _, ok := h.createApp(w, r, &req, nil)
+	if !ok {
 		return
 	}
 
+	// Create a deployment response
+	now := time.Now().Format(time.RFC3339)
+	deployment := Deployment{
+		ID:        0, // Will be set by deployment system
+		AppID:     0, // Will be set by deployment system
+		Status:    "pending",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	response := CreateAppResponse{
+		App:       *app,
+		Deployment: deployment,
+	}
+	h.writeJSON(w, http.StatusCreated, response)
+}
+
+// createApp creates the app described by req and starts its first deployment, returning the app and
+// the build job ID. configure, when set, runs once the app and its env vars are saved and before the
+// first deployment is enqueued. Error responses are written here; the caller writes the success response
+func (h *Handlers) createApp(w http.ResponseWriter, r *http.Request, req *CreateAppRequest, configure func(app *App) error) (*App, string, bool) {
+	// Image apps run an existing image from a registry and skip the build pipeline
+	var imageRef string
+	switch req.Source {
+	case "", services.AppSourceGit:
+	case services.AppSourceImage:
+		var err error
+		if imageRef, err = services.ParseSourceImage(req.Image); err != nil {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return nil, "", false
+		}
+		if req.RepoURL != "" || req.Branch != "" || req.RootDir != "" {
+			h.writeError(w, http.StatusBadRequest, "Image apps have no repository - omit repo_url, branch and root_dir")
+			return nil, "", false
+		}
+		if req.RegistryCredentials != nil {
+			if err := req.RegistryCredentials.validate(); err != nil {
+				h.writeError(w, http.StatusBadRequest, err.Error())
+				return nil, "", false
+			}
+		}
+	default:
+		h.writeError(w, http.StatusBadRequest, `source must be "git" or "image"`)
+		return nil, "", false
+	}
+
 	// Validate MVP constraints - repository URL
-	if h.constraintsService != nil {
+	if h.constraintsService != nil && imageRef == "" {
 		if err := h.constraintsService.ValidateRepoURL(r.Context(), req.RepoURL); err != nil {
 			if constraintErr, ok := GetConstraintError(err); ok {
-				h.writeError(w, http.StatusBadRequest, constraintErr.Message)
-				return
+				writeConstraintError(w, constraintErr)
+				return nil, "", false
 			}
 			h.writeError(w, http.StatusBadRequest, "Repository URL validation failed")
-			return
+			return nil, "", false
 		}
 	}
 
 	// Get user ID from context
 	userID := h.getUserIDFromContext(r)
 
+	// Org apps are owned by (and count against the plan of) the organization owner
+	if req.OrganizationID != "" {
+		if h.orgRepo == nil {
+			h.writeError(w, http.StatusServiceUnavailable, "Organizations are not available")
+			return nil, "", false
+		}
+		org, err := h.orgRepo.GetOrganizationForMember(r.Context(), req.OrganizationID, userID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				h.writeError(w, http.StatusNotFound, "Organization not found")
+				return nil, "", false
+			}
+			h.logger.Error("Failed to get organization", zap.Error(err), zap.String("organization_id", req.OrganizationID))
+			h.writeError(w, http.StatusInternalServerError, "Failed to get organization")
+			return nil, "", false
+		}
+		if !HasOrgRole(org.Role, OrgRoleMember) {
+			h.writeError(w, http.StatusForbidden, "Viewers cannot create apps in this organization")
+			return nil, "", false
+		}
+		h.logger.Info("Creating app in organization",
+			zap.String("organization_id", org.ID),
+			zap.String("requested_by", userID),
+			zap.String("owner_id", org.OwnerID),
+		)
+		userID = org.OwnerID
+	}
+
 	// Check subscription status and resource limits before creating app
 	// Default app resource allocation (can be made configurable later)
 	defaultAppRAMMB := 256  // 256 MB per app
@@ -555,7 +818,7 @@ func (h *Handlers) CreateApp(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		h.logger.Error("Failed to get user resource usage", zap.Error(err))
 		h.writeError(w, http.StatusInternalServerError, "Failed to check resource limits")
-		return
+		return nil, "", false
 	}
 
 	// Check resource limits (subscription service will check subscription status too)
@@ -571,7 +834,7 @@ func (h *Handlers) CreateApp(w http.ResponseWriter, r *http.Request) {
 			defaultAppDiskGB,
 		); err != nil {
 			h.writeError(w, http.StatusForbidden, err.Error())
-			return
+			return nil, "", false
 		}
 	}
 
@@ -581,7 +844,7 @@ func (h *Handlers) CreateApp(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			h.logger.Error("Failed to get current app count", zap.Error(err))
 			h.writeError(w, http.StatusInternalServerError, "Failed to check plan limits")
-			return
+			return nil, "", false
 		}
 
 		h.logger.Info("Checking max apps limit",
@@ -596,11 +859,22 @@ func (h *Handlers) CreateApp(w http.ResponseWriter, r *http.Request) {
 				zap.Error(err),
 			)
 			if planErr, ok := GetPlanLimitError(err); ok {
-				h.writeError(w, http.StatusForbidden, planErr.Message)
-				return
+				writePlanLimitError(w, planErr)
+				return nil, "", false
 			}
 			h.writeError(w, http.StatusForbidden, "Plan limit exceeded")
-			return
+			return nil, "", false
+		}
+
+		// A new app immediately builds, so it needs build minutes left this month (image apps never build)
+		if err := h.planEnforcement.CheckBuildMinutes(r.Context(), userID); err != nil && imageRef == "" {
+			h.logger.Warn("Build minutes exhausted", zap.String("user_id", userID), zap.Error(err))
+			if planErr, ok := GetPlanLimitError(err); ok {
+				writePlanLimitError(w, planErr)
+				return nil, "", false
+			}
+			h.writeError(w, http.StatusInternalServerError, "Failed to check plan limits")
+			return nil, "", false
 		}
 	} else {
 		h.logger.Warn("Plan enforcement service not available - skipping max apps check",
@@ -612,30 +886,36 @@ func (h *Handlers) CreateApp(w http.ResponseWriter, r *http.Request) {
 	if h.appRepo == nil {
 		h.logger.Error("App repository not initialized")
 		h.writeError(w, http.StatusInternalServerError, "App repository not available")
-		return
+		return nil, "", false
 	}
 
 	// Default branch to "main" if not provided
 	branch := req.Branch
-	if branch == "" {
+	if branch == "" && imageRef == "" {
 		branch = "main"
 	}
 
+	// Monorepo apps build from a subdirectory of the repository
+	rootDir, err := services.NormalizeRootDir(req.RootDir)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid root directory: %s", err.Error()))
+		return nil, "", false
+	}
+
 	// Validate and process slug
 	slug := req.Slug
 	if slug == "" {
 		// Auto-generate slug from name if not provided
 		slug = generateSlugFromName(req.Name)
 	} else {
-		// Validate slug format: ^[a-z0-9]([a-z0-9-]{1,30}[a-z0-9])?$
-		slugRegex := regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{1,30}[a-z0-9])?$`)
-		if !slugRegex.MatchString(slug) {
+		// Templates and manifest imports get here without request validation
+		if !slugPattern.MatchString(slug) {
 			h.writeError(w, http.StatusBadRequest, "Invalid slug format. Slug must start and end with alphanumeric characters, can contain hyphens, and be 1-32 characters long.")
-			return
+			return nil, "", false
 		}
 	}
 
-	app, err := h.appRepo.CreateApp(userID, req.Name, slug, req.RepoURL, branch)
+	app, err := h.appRepo.CreateApp(userID, req.Name, slug, req.RepoURL, branch, rootDir)
 	if err != nil {
 		// Check for duplicate key violation
 		var pgErr *pgconn.PgError
@@ -643,14 +923,32 @@ func (h *Handlers) CreateApp(w http.ResponseWriter, r *http.Request) {
 			// Check if it's a slug conflict or name conflict
 			if strings.Contains(pgErr.ConstraintName, "slug") || strings.Contains(pgErr.Message, "slug") {
 				h.writeError(w, http.StatusConflict, fmt.Sprintf("An app with the slug '%s' already exists. Please choose a different slug.", slug))
-				return
+				return nil, "", false
 			}
 			h.writeError(w, http.StatusConflict, fmt.Sprintf("An app with the name '%s' already exists", req.Name))
-			return
+			return nil, "", false
 		}
 		h.logger.Error("Failed to create app", zap.Error(err), zap.String("user_id", userID))
 		h.writeError(w, http.StatusInternalServerError, "Failed to create app")
-		return
+		return nil, "", false
+	}
+	if req.OrganizationID != "" {
+		if err := h.appRepo.AssignAppToOrganization(r.Context(), app.ID, req.OrganizationID); err != nil {
+			h.logger.Error("Failed to assign app to organization", zap.Error(err), zap.String("app_id", app.ID))
+			h.writeError(w, http.StatusInternalServerError, "Failed to create app")
+			return nil, "", false
+		}
+		app.OrganizationID = req.OrganizationID
+	}
+	if imageRef != "" {
+		if err := h.setupImageApp(r, app, imageRef, req.RegistryCredentials); err != nil {
+			h.logger.Error("Failed to set up image app", zap.Error(err), zap.String("app_id", app.ID))
+			h.writeError(w, http.StatusInternalServerError, "Failed to create app")
+			return nil, "", false
+		}
+	}
+	if h.usageService != nil {
+		h.usageService.InvalidateUser(userID)
 	}
 
 	// Save environment variables BEFORE enqueueing build task
@@ -683,18 +981,40 @@ func (h *Handlers) CreateApp(w http.ResponseWriter, r *http.Request) {
 		)
 	}
 
+	// Settings beyond what the request carries must be in place for the first build
+	if configure != nil {
+		if err := configure(app); err != nil {
+			h.logger.Error("Failed to configure app", zap.Error(err), zap.String("app_id", app.ID))
+			h.writeError(w, http.StatusInternalServerError, "App created but could not be configured")
+			return nil, "", false
+		}
+	}
+
 	// Generate build job ID
 	buildJobID := uuid.New().String()
 
 	// Enqueue build task to trigger deployment
 	requestID := middleware.GetReqID(r.Context())
-	if h.taskEnqueue != nil {
+	if h.taskEnqueue != nil && imageRef != "" {
+		imageTag, err := h.enqueueImageDeploy(r, app, userID)
+		if err != nil {
+			// Don't fail the app creation - user can manually redeploy
+			h.logger.Warn("App created but deployment not started",
+				zap.String("app_id", app.ID),
+				zap.String("request_id", requestID),
+			)
+		}
+		buildJobID = imageTag
+	} else if h.taskEnqueue != nil {
 		buildPayload := tasks.BuildTaskPayload{
-			AppID:      app.ID,
-			BuildJobID: buildJobID,
-			RepoURL:    req.RepoURL,
-			Branch:     branch,
-			UserID:     userID,
+			AppID:       app.ID,
+			BuildJobID:  buildJobID,
+			RepoURL:     req.RepoURL,
+			Branch:      branch,
+			RootDir:     rootDir,
+			UserID:      userID,
+			Trigger:     requestTrigger(r.Context()),
+			TriggeredBy: userID,
 		}
 
 		taskInfo, err := h.taskEnqueue.EnqueueBuildTask(r.Context(), buildPayload, userID)
@@ -710,6 +1030,7 @@ func (h *Handlers) CreateApp(w http.ResponseWriter, r *http.Request) {
 				zap.String("app_id", app.ID),
 				zap.String("request_id", requestID),
 			)
+			buildJobID = ""
 		} else {
 			h.logger.Info("Build task enqueued successfully",
 				zap.String("app_id", app.ID),
@@ -724,23 +1045,10 @@ func (h *Handlers) CreateApp(w http.ResponseWriter, r *http.Request) {
 			zap.String("app_id", app.ID),
 			zap.String("request_id", requestID),
 		)
+		buildJobID = ""
 	}
 
-	// Create a deployment response
-	now := time.Now().Format(time.RFC3339)
-	deployment := Deployment{
-		ID:        0, // Will be set by deployment system
-		AppID:     0, // Will be set by deployment system
-		Status:    "pending",
-		CreatedAt: now,
-		UpdatedAt: now,
-	}
-
-	response := CreateAppResponse{
-		App:       *app,
-		Deployment: deployment,
-	}
-	h.writeJSON(w, http.StatusCreated, response)
+	return app, buildJobID, true
 }
 
 // DELETE /api/v1/apps/{id} - Delete app
@@ -780,9 +1088,15 @@ func (h *Handlers) DeleteApp(w http.ResponseWriter, r *http.Request) {
 	} else {
 		h.logger.Warn("Deployment service not available, skipping Docker resource cleanup", zap.String("app_id", appID))
 	}
+
+	// The app's containers are gone, so its RAM no longer counts against the plan
+	if h.planEnforcement != nil {
+		h.planEnforcement.ReleaseAppRAM(r.Context(), appID)
+	}
 	
 	// Step 2: Delete the app from database (this will also delete app_logs, and cascade will handle: deployments, env_vars, build_jobs, runtime_instances)
-	err = h.appRepo.DeleteApp(appID, userID)
+	// Org apps are deleted on behalf of their owner - AppAccessMiddleware has already required the admin role
+	err = h.appRepo.DeleteApp(appID, app.UserID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			h.writeError(w, http.StatusNotFound, "App not found or you don't have permission to delete it")
@@ -792,6 +1106,9 @@ func (h *Handlers) DeleteApp(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, http.StatusInternalServerError, "Failed to delete app")
 		return
 	}
+	if h.usageService != nil {
+		h.usageService.InvalidateUser(app.UserID)
+	}
 	
 	// Step 3: Clean up cloned repositories
 	// Note: This is best-effort cleanup. Cloned repos are typically cleaned up after builds,
@@ -812,6 +1129,8 @@ func (h *Handlers) DeleteApp(w http.ResponseWriter, r *http.Request) {
 }
 
 // POST /api/v1/apps/{id}/redeploy - Redeploy app
+// An optional ref (branch, tag or commit) deploys that instead of the configured branch head, without
+// changing the app's branch
 func (h *Handlers) RedeployApp(w http.ResponseWriter, r *http.Request) {
 	appID := chi.URLParam(r, "id")
 	
@@ -822,11 +1141,19 @@ func (h *Handlers) RedeployApp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Body is optional - an empty body redeploys the app's branch head
+	var req RedeployRequest
+	if r.ContentLength != 0 {
+		if !decodeOptionalJSON(w, r, &req) {
+			return
+		}
+	}
+
 	// Check max concurrent builds limit
 	if h.planEnforcement != nil {
 		if err := h.planEnforcement.CheckMaxConcurrentBuilds(r.Context(), userID); err != nil {
 			if planErr, ok := GetPlanLimitError(err); ok {
-				h.writeError(w, http.StatusForbidden, planErr.Message)
+				writePlanLimitError(w, planErr)
 				return
 			}
 			h.writeError(w, http.StatusForbidden, "Plan limit exceeded")
@@ -846,46 +1173,41 @@ func (h *Handlers) RedeployApp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate new build job ID
-	buildJobID := uuid.New().String()
-
-	// Enqueue build task to trigger deployment
-	// This will: 1) Clone the latest code from the repository branch, 2) Build the Docker image, 3) Deploy the container
-	requestID := middleware.GetReqID(r.Context())
-	if h.taskEnqueue != nil {
-		buildPayload := tasks.BuildTaskPayload{
-			AppID:      app.ID,
-			BuildJobID: buildJobID,
-			RepoURL:    app.RepoURL,    // Always use current repo URL from database
-			Branch:     app.Branch,      // Always use current branch from database (ensures latest code from this branch)
-			UserID:     userID,
+	// Check the pinned ref exists before queueing a build that would fail to clone it
+	var ref *services.ResolvedRef
+	if req.Ref != "" {
+		if app.Source == services.AppSourceImage {
+			h.writeError(w, http.StatusBadRequest, "ref is only supported for apps deployed from a repository")
+			return
 		}
-
-		taskInfo, err := h.taskEnqueue.EnqueueBuildTask(r.Context(), buildPayload, userID)
+		if h.gitService == nil {
+			h.writeError(w, http.StatusInternalServerError, "Git service not available")
+			return
+		}
+		ref, err = h.gitService.ResolveRef(r.Context(), app.RepoURL, req.Ref)
 		if err != nil {
-			h.logger.Error("Failed to enqueue build task for redeploy", 
-				zap.Error(err), 
-				zap.String("app_id", appID),
-				zap.String("request_id", requestID),
-				zap.String("user_id", userID),
-			)
-			h.writeError(w, http.StatusInternalServerError, "Failed to start deployment")
+			if errors.Is(err, services.ErrRefNotFound) {
+				h.writeError(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+			h.logger.Warn("Failed to resolve redeploy ref", zap.Error(err), zap.String("app_id", appID), zap.String("ref", req.Ref))
+			h.writeError(w, http.StatusBadGateway, "Failed to look up ref in the repository")
 			return
 		}
+	}
 
-		h.logger.Info("Redeploy build task enqueued successfully",
-			zap.String("app_id", app.ID),
-			zap.String("build_job_id", buildJobID),
-			zap.String("task_id", taskInfo.ID),
-			zap.String("request_id", requestID),
-			zap.String("user_id", userID),
-		)
-	} else {
-		h.logger.Error("Task enqueue service not available - cannot redeploy", 
-			zap.String("app_id", appID),
-			zap.String("request_id", requestID),
-		)
-		h.writeError(w, http.StatusInternalServerError, "Deployment service not available")
+	// Enqueue build task to trigger deployment
+	buildJobID, inFlight, err := h.enqueueRedeploy(r, app, userID, ref)
+	if err != nil {
+		if planErr, ok := GetPlanLimitError(err); ok {
+			writePlanLimitError(w, planErr)
+			return
+		}
+		if h.taskEnqueue == nil {
+			h.writeError(w, http.StatusInternalServerError, "Deployment service not available")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to start deployment")
 		return
 	}
 
@@ -894,7 +1216,7 @@ func (h *Handlers) RedeployApp(w http.ResponseWriter, r *http.Request) {
 	deployment := Deployment{
 		ID:        0, // Will be set by deployment system
 		AppID:     0, // Will be set by deployment system
-		Status:    "building",
+		Status:    string(deploystate.Building),
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
@@ -902,92 +1224,459 @@ func (h *Handlers) RedeployApp(w http.ResponseWriter, r *http.Request) {
 	response := CreateAppResponse{
 		App:       *app,
 		Deployment: deployment,
+		BuildJobID: buildJobID,
+		InFlight:  inFlight,
 	}
 	h.writeJSON(w, http.StatusOK, response)
 }
 
-// GET /api/v1/apps/{id}/deployments - Get deployments for app
-func (h *Handlers) GetAppDeployments(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	appID := id // Use string ID directly
-	
-	if h.deploymentRepo == nil {
-		h.logger.Error("Deployment repository not initialized")
-		h.writeError(w, http.StatusInternalServerError, "Deployment repository not available")
-		return
+// enqueueRedeploy enqueues a build task that rebuilds and redeploys the app from its current repo and branch
+// This will: 1) Clone the latest code from the repository branch, 2) Build the Docker image, 3) Deploy the container
+// A non-nil ref builds that branch, tag or commit instead of the app's branch head
+// Returns the new build job ID, or the in-flight one (inFlight=true) when the same build is already queued or running
+func (h *Handlers) enqueueRedeploy(r *http.Request, app *App, userID string, ref *services.ResolvedRef) (buildJobID string, inFlight bool, err error) {
+	requestID := middleware.GetReqID(r.Context())
+	if h.taskEnqueue == nil {
+		h.logger.Error("Task enqueue service not available - cannot redeploy", 
+			zap.String("app_id", app.ID),
+			zap.String("request_id", requestID),
+		)
+		return "", false, fmt.Errorf("task enqueue service not available")
 	}
-	
-	deploymentsData, err := h.deploymentRepo.GetDeploymentsByAppID(appID)
-	if err != nil {
-		h.logger.Error("Failed to get deployments", zap.Error(err), zap.String("app_id", appID))
-		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deployments")
-		return
+
+	// Org apps build against the owner's plan and build minutes, whoever triggered them
+	if app.UserID != "" {
+		userID = app.UserID
 	}
-	
-	// Convert to Deployment structs for response
-	deployments := make([]Deployment, 0, len(deploymentsData))
-	for _, d := range deploymentsData {
-		var status, createdAt, updatedAt string
-		if statusVal, ok := d["status"].(string); ok {
-			status = statusVal
-		}
-		if createdAtVal, ok := d["created_at"].(string); ok {
-			createdAt = createdAtVal
-		}
-		if updatedAtVal, ok := d["updated_at"].(string); ok {
-			updatedAt = updatedAtVal
-		}
-		
-		deployment := Deployment{
-			ID:        d["id"], // Keep as-is (UUID string)
-			AppID:     d["app_id"], // Keep as-is (UUID string)
-			Status:    status,
-			CreatedAt: createdAt,
-			UpdatedAt: updatedAt,
-		}
-		
-		if img, ok := d["image_name"].(map[string]interface{}); ok {
-			deployment.ImageName = img
-		}
-		if cid, ok := d["container_id"].(map[string]interface{}); ok {
-			deployment.ContainerID = cid
-		}
-		if sub, ok := d["subdomain"].(map[string]interface{}); ok {
-			deployment.Subdomain = sub
-		}
-		if buildLog, ok := d["build_log"].(map[string]interface{}); ok {
-			deployment.BuildLog = buildLog
-		}
-		if runtimeLog, ok := d["runtime_log"].(map[string]interface{}); ok {
-			deployment.RuntimeLog = runtimeLog
+
+	// Image apps pull their image again (picking up a moved tag) instead of building
+	if app.Source == services.AppSourceImage {
+		buildJobID, err = h.enqueueImageDeploy(r, app, userID)
+		return buildJobID, false, err
+	}
+
+	// Reject the build up front if the monthly build minutes allowance is used up
+	if h.planEnforcement != nil {
+		if err := h.planEnforcement.CheckBuildMinutes(r.Context(), userID); err != nil {
+			h.logger.Warn("Redeploy rejected - build minutes exhausted",
+				zap.Error(err),
+				zap.String("app_id", app.ID),
+				zap.String("user_id", userID),
+			)
+			return "", false, err
 		}
-		if errMsg, ok := d["error_message"].(map[string]interface{}); ok {
-			deployment.ErrorMessage = errMsg
+	}
+
+	// Generate new build job ID
+	buildJobID = uuid.New().String()
+
+	buildPayload := tasks.BuildTaskPayload{
+		AppID:       app.ID,
+		BuildJobID:  buildJobID,
+		RepoURL:     app.RepoURL,    // Always use current repo URL from database
+		Branch:      app.Branch,      // Always use current branch from database (ensures latest code from this branch)
+		RootDir:     app.RootDir,
+		UserID:      userID,
+		Trigger:     requestTrigger(r.Context()),
+		TriggeredBy: h.getUserIDFromContext(r), // userID is the owner for org apps
+	}
+	if ref != nil {
+		switch ref.Kind {
+		case services.RefKindBranch:
+			buildPayload.Branch = ref.Name
+		case services.RefKindTag:
+			buildPayload.Tag = ref.Name
+		case services.RefKindCommit:
+			buildPayload.CommitSHA = ref.SHA
 		}
-		
-		deployments = append(deployments, deployment)
 	}
-	
-	h.writeJSON(w, http.StatusOK, deployments)
+
+	taskInfo, err := h.taskEnqueue.EnqueueBuildTask(r.Context(), buildPayload, userID)
+	if err != nil {
+		h.logger.Error("Failed to enqueue build task for redeploy", 
+			zap.Error(err), 
+			zap.String("app_id", app.ID),
+			zap.String("request_id", requestID),
+			zap.String("user_id", userID),
+		)
+		return "", false, err
+	}
+
+	// A double-clicked redeploy gets the build that is already queued or running
+	var existing tasks.BuildTaskPayload
+	if err := json.Unmarshal(taskInfo.Payload, &existing); err == nil && existing.BuildJobID != "" && existing.BuildJobID != buildJobID {
+		h.logger.Info("Redeploy already in flight, returning existing build",
+			zap.String("app_id", app.ID),
+			zap.String("build_job_id", existing.BuildJobID),
+			zap.String("task_id", taskInfo.ID),
+			zap.String("state", taskInfo.State.String()),
+			zap.String("request_id", requestID),
+		)
+		return existing.BuildJobID, true, nil
+	}
+
+	h.logger.Info("Redeploy build task enqueued successfully",
+		zap.String("app_id", app.ID),
+		zap.String("build_job_id", buildJobID),
+		zap.String("task_id", taskInfo.ID),
+		zap.String("request_id", requestID),
+		zap.String("user_id", userID),
+	)
+
+	return buildJobID, false, nil
 }
 
-// GET /api/v1/apps/{id}/env - Get environment variables
-func (h *Handlers) GetEnvVars(w http.ResponseWriter, r *http.Request) {
+// POST /api/v1/apps/{id}/rollback - Roll back app to a previous successful deployment
+func (h *Handlers) RollbackApp(w http.ResponseWriter, r *http.Request) {
 	appID := chi.URLParam(r, "id")
+
+	// Get user ID from context
 	userID := h.getUserIDFromContext(r)
 	if userID == "" {
 		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
 		return
 	}
 
-	// Verify app belongs to user
-	if h.appRepo == nil {
-		h.logger.Error("App repository not initialized")
-		h.writeError(w, http.StatusInternalServerError, "App repository not available")
+	if h.appRepo == nil || h.deploymentRepo == nil {
+		h.logger.Error("Repositories not initialized")
+		h.writeError(w, http.StatusInternalServerError, "Deployment repository not available")
 		return
 	}
 
-	_, err := h.appRepo.GetAppByID(appID, userID)
+	// Body is optional - an empty body rolls back to the previous successful deployment
+	var req RollbackRequest
+	if r.ContentLength != 0 {
+		if !decodeOptionalJSON(w, r, &req) {
+			return
+		}
+	}
+
+	// Get app from database (verifies ownership)
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found or you don't have permission to roll it back")
+			return
+		}
+		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to get app")
+		return
+	}
+
+	// Look up the image of the deployment to roll back to
+	targetID, fullImageName, err := h.deploymentRepo.GetRollbackTarget(r.Context(), app.ID, req.DeploymentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			if req.DeploymentID != "" {
+				h.writeError(w, http.StatusNotFound, "Deployment not found or was not successful")
+			} else {
+				h.writeError(w, http.StatusNotFound, "No previous successful deployment to roll back to")
+			}
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to find deployment to roll back to")
+		return
+	}
+
+	// Image is stored as "imageName:tag" where tag is the build job ID
+	imageName := fullImageName
+	imageTag := ""
+	if idx := strings.LastIndex(fullImageName, ":"); idx > 0 {
+		imageName = fullImageName[:idx]
+		imageTag = fullImageName[idx+1:]
+	}
+
+	requestID := middleware.GetReqID(r.Context())
+	if h.taskEnqueue == nil {
+		h.logger.Error("Task enqueue service not available - cannot roll back",
+			zap.String("app_id", appID),
+			zap.String("request_id", requestID),
+		)
+		h.writeError(w, http.StatusInternalServerError, "Deployment service not available")
+		return
+	}
+
+	// Enqueue deploy task with the previous image (no rebuild needed)
+	// The target's env snapshot comes back with it unless the current env vars are asked for explicitly
+	deployPayload := tasks.DeployTaskPayload{
+		AppID:                    app.ID,
+		DeploymentID:             uuid.New().String(),
+		BuildJobID:               imageTag,
+		ImageName:                imageName,
+		UserID:                   userID,
+		RequestedRAMMB:           512,
+		RollbackFromDeploymentID: targetID,
+		Trigger:                  deploystate.TriggerRollback,
+		TriggeredBy:              userID,
+	}
+	if !req.UseCurrentEnv {
+		deployPayload.EnvFromDeploymentID = targetID
+	}
+
+	taskInfo, err := h.taskEnqueue.EnqueueDeployTask(r.Context(), deployPayload, userID)
+	if err != nil {
+		h.logger.Error("Failed to enqueue deploy task for rollback",
+			zap.Error(err),
+			zap.String("app_id", appID),
+			zap.String("request_id", requestID),
+			zap.String("user_id", userID),
+		)
+		h.writeError(w, http.StatusInternalServerError, "Failed to start rollback")
+		return
+	}
+
+	h.logger.Info("Rollback deploy task enqueued successfully",
+		zap.String("app_id", app.ID),
+		zap.String("rollback_from_deployment_id", targetID),
+		zap.String("image", fullImageName),
+		zap.Bool("use_current_env", req.UseCurrentEnv),
+		zap.String("task_id", taskInfo.ID),
+		zap.String("request_id", requestID),
+		zap.String("user_id", userID),
+	)
+
+	now := time.Now().Format(time.RFC3339)
+	response := CreateAppResponse{
+		App: *app,
+		Deployment: Deployment{
+			ID:                       0, // Will be set by deployment system
+			AppID:                    app.ID,
+			Status:                   string(deploystate.Deploying),
+			ImageName:                fullImageName,
+			RollbackFromDeploymentID: targetID,
+			CreatedAt:                now,
+			UpdatedAt:                now,
+		},
+	}
+	h.writeJSON(w, http.StatusOK, response)
+}
+
+// POST /api/v1/apps/{id}/restart - Recreate the app's container from its current image
+// No clone or build: the container is started again with the app's latest env vars and resource limits,
+// so env-only changes take effect in seconds
+func (h *Handlers) RestartApp(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+
+	// Get user ID from context
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	if h.appRepo == nil || h.deploymentRepo == nil {
+		h.logger.Error("Repositories not initialized")
+		h.writeError(w, http.StatusInternalServerError, "Deployment repository not available")
+		return
+	}
+
+	// Get app from database (verifies ownership)
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found or you don't have permission to restart it")
+			return
+		}
+		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to get app")
+		return
+	}
+	if app.Status == "disabled" {
+		h.writeError(w, http.StatusForbidden, app.StatusReason)
+		return
+	}
+
+	sourceID, fullImageName, err := h.deploymentRepo.GetRestartTarget(r.Context(), app.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusConflict, "App has no built image to restart - redeploy it instead")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to find deployment to restart")
+		return
+	}
+
+	// Image is stored as "imageName:tag" where tag is the build job ID
+	imageName := fullImageName
+	imageTag := ""
+	if idx := strings.LastIndex(fullImageName, ":"); idx > 0 {
+		imageName = fullImageName[:idx]
+		imageTag = fullImageName[idx+1:]
+	}
+
+	requestID := middleware.GetReqID(r.Context())
+	if h.taskEnqueue == nil {
+		h.logger.Error("Task enqueue service not available - cannot restart",
+			zap.String("app_id", appID),
+			zap.String("request_id", requestID),
+		)
+		h.writeError(w, http.StatusInternalServerError, "Deployment service not available")
+		return
+	}
+
+	// Org apps deploy against the owner's plan, whoever restarted them
+	ownerID := userID
+	if app.UserID != "" {
+		ownerID = app.UserID
+	}
+
+	// No EnvFromDeploymentID - the deploy task reads the app's current env vars and snapshots them
+	deployPayload := tasks.DeployTaskPayload{
+		AppID:          app.ID,
+		DeploymentID:   uuid.New().String(),
+		BuildJobID:     imageTag,
+		ImageName:      imageName,
+		UserID:         ownerID,
+		RequestedRAMMB: 512,
+		Trigger:        deploystate.TriggerRestart,
+		TriggeredBy:    userID,
+	}
+
+	taskInfo, err := h.taskEnqueue.EnqueueDeployTask(r.Context(), deployPayload, ownerID)
+	if err != nil {
+		h.logger.Error("Failed to enqueue deploy task for restart",
+			zap.Error(err),
+			zap.String("app_id", appID),
+			zap.String("request_id", requestID),
+			zap.String("user_id", userID),
+		)
+		h.writeError(w, http.StatusInternalServerError, "Failed to start restart")
+		return
+	}
+
+	h.logger.Info("Restart deploy task enqueued successfully",
+		zap.String("app_id", app.ID),
+		zap.String("source_deployment_id", sourceID),
+		zap.String("image", fullImageName),
+		zap.String("task_id", taskInfo.ID),
+		zap.String("request_id", requestID),
+		zap.String("user_id", userID),
+	)
+
+	now := time.Now().Format(time.RFC3339)
+	response := CreateAppResponse{
+		App: *app,
+		Deployment: Deployment{
+			ID:        0, // Will be set by deployment system
+			AppID:     app.ID,
+			Status:    string(deploystate.Deploying),
+			ImageName: fullImageName,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+	}
+	h.writeJSON(w, http.StatusOK, response)
+}
+
+// GET /api/v1/apps/{id}/deployments - Get deployments for app (optionally ?trigger=manual, cli, webhook, rollback, ...)
+func (h *Handlers) GetAppDeployments(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	appID := id // Use string ID directly
+	
+	if h.deploymentRepo == nil {
+		h.logger.Error("Deployment repository not initialized")
+		h.writeError(w, http.StatusInternalServerError, "Deployment repository not available")
+		return
+	}
+
+	// ?trigger=rollback lists only the deployments started that way
+	trigger := r.URL.Query().Get("trigger")
+	if trigger != "" && !deploystate.ValidTrigger(trigger) {
+		h.writeError(w, http.StatusBadRequest, "trigger must be one of: "+strings.Join(deploystate.Triggers, ", "))
+		return
+	}
+	
+	deploymentsData, err := h.deploymentRepo.GetDeploymentsByTrigger(appID, trigger)
+	if err != nil {
+		h.logger.Error("Failed to get deployments", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deployments")
+		return
+	}
+	
+	// Convert to Deployment structs for response
+	deployments := make([]Deployment, 0, len(deploymentsData))
+	for _, d := range deploymentsData {
+		deployments = append(deployments, deploymentFromRecord(d))
+	}
+	
+	h.writeJSON(w, http.StatusOK, deployments)
+}
+
+// deploymentFromRecord converts a deployment row returned by DeploymentRepo into the API response
+func deploymentFromRecord(d map[string]interface{}) Deployment {
+	var status, createdAt, updatedAt string
+	if statusVal, ok := d["status"].(string); ok {
+		status = statusVal
+	}
+	if createdAtVal, ok := d["created_at"].(string); ok {
+		createdAt = createdAtVal
+	}
+	if updatedAtVal, ok := d["updated_at"].(string); ok {
+		updatedAt = updatedAtVal
+	}
+
+	deployment := Deployment{
+		ID:        d["id"], // Keep as-is (UUID string)
+		AppID:     d["app_id"], // Keep as-is (UUID string)
+		Status:    status,
+		CreatedAt: createdAt,
+		UpdatedAt: updatedAt,
+	}
+
+	if img, ok := d["image_name"].(map[string]interface{}); ok {
+		deployment.ImageName = img
+	}
+	if cid, ok := d["container_id"].(map[string]interface{}); ok {
+		deployment.ContainerID = cid
+	}
+	if sub, ok := d["subdomain"].(map[string]interface{}); ok {
+		deployment.Subdomain = sub
+	}
+	if buildLog, ok := d["build_log"].(map[string]interface{}); ok {
+		deployment.BuildLog = buildLog
+	}
+	if runtimeLog, ok := d["runtime_log"].(map[string]interface{}); ok {
+		deployment.RuntimeLog = runtimeLog
+	}
+	if errMsg, ok := d["error_message"].(map[string]interface{}); ok {
+		deployment.ErrorMessage = errMsg
+	}
+	if rollbackFrom, ok := d["rollback_from_deployment_id"].(string); ok {
+		deployment.RollbackFromDeploymentID = rollbackFrom
+	}
+	if envFrom, ok := d["env_from_deployment_id"].(string); ok {
+		deployment.EnvFromDeploymentID = envFrom
+	}
+	deployment.Trigger, _ = d["trigger"].(string)
+	deployment.TriggeredBy, _ = d["triggered_by"].(string)
+	deployment.TriggeredByEmail, _ = d["triggered_by_email"].(string)
+	deployment.CommitSHA, _ = d["commit_sha"].(string)
+	deployment.CommitAuthor, _ = d["commit_author"].(string)
+	deployment.CommitMessage, _ = d["commit_message"].(string)
+	deployment.CommitBranch, _ = d["commit_branch"].(string)
+	deployment.CommitSummary, _ = d["commit_summary"].(string)
+	deployment.BuildStrategy, _ = d["build_strategy"].(string)
+	deployment.CrashLog, _ = d["crash_log"].(string)
+	return deployment
+}
+
+// GET /api/v1/apps/{id}/env - Get environment variables
+func (h *Handlers) GetEnvVars(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	// Verify app belongs to user
+	if h.appRepo == nil {
+		h.logger.Error("App repository not initialized")
+		h.writeError(w, http.StatusInternalServerError, "App repository not available")
+		return
+	}
+
+	_, err := h.appRepo.GetAppByID(appID, userID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			h.writeError(w, http.StatusNotFound, "App not found")
@@ -1061,14 +1750,7 @@ func (h *Handlers) CreateEnvVar(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req CreateEnvVarRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid request body")
-		return
-	}
-
-	// Validate key and value
-	if req.Key == "" {
-		h.writeError(w, http.StatusBadRequest, "Environment variable key is required")
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
@@ -1126,7 +1808,7 @@ func (h *Handlers) CreateEnvVar(w http.ResponseWriter, r *http.Request) {
 					zap.String("pg_error_message", pgErr.Message),
 					zap.String("pg_error_detail", pgErr.Detail),
 				)
-				h.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create environment variable: %s", pgErr.Message))
+				h.writeError(w, http.StatusInternalServerError, "Failed to create environment variable")
 				return
 			}
 		}
@@ -1137,13 +1819,180 @@ func (h *Handlers) CreateEnvVar(w http.ResponseWriter, r *http.Request) {
 			zap.String("key", req.Key),
 			zap.String("error_type", fmt.Sprintf("%T", err)),
 		)
-		h.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create environment variable: %v", err))
+		h.writeError(w, http.StatusInternalServerError, "Failed to create environment variable")
 		return
 	}
 
 	h.writeJSON(w, http.StatusCreated, envVar)
 }
 
+// PUT /api/v1/apps/{id}/env/{key} - Update environment variable
+// Pass ?redeploy=true to rebuild the app so the new value takes effect
+func (h *Handlers) UpdateEnvVar(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	key := chi.URLParam(r, "key")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	// Verify app belongs to user
+	if h.appRepo == nil {
+		h.logger.Error("App repository not initialized")
+		h.writeError(w, http.StatusInternalServerError, "App repository not available")
+		return
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+
+	var req UpdateEnvVarRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if h.envVarRepo == nil {
+		h.logger.Error("Env var repository not initialized")
+		h.writeError(w, http.StatusInternalServerError, "Env var repository not available")
+		return
+	}
+
+	envVar, err := h.envVarRepo.UpdateEnvVar(r.Context(), appID, key, req.Value)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.logger.Error("Timeout updating env var", zap.Error(err), zap.String("app_id", appID), zap.String("key", key))
+			h.writeError(w, http.StatusGatewayTimeout, "Request timed out while updating environment variable")
+			return
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Environment variable not found")
+			return
+		}
+		h.logger.Error("Failed to update env var", zap.Error(err), zap.String("app_id", appID), zap.String("key", key))
+		h.writeError(w, http.StatusInternalServerError, "Failed to update environment variable")
+		return
+	}
+
+	if r.URL.Query().Get("redeploy") == "true" {
+		if _, _, err := h.enqueueRedeploy(r, app, userID, nil); err != nil {
+			// The value is saved - report the redeploy failure without failing the update
+			h.logger.Warn("Env var updated but redeploy could not be started", zap.Error(err), zap.String("app_id", appID))
+		}
+	}
+
+	h.writeJSON(w, http.StatusOK, envVar)
+}
+
+// POST /api/v1/apps/{id}/env/bulk - Import many environment variables at once
+// Accepts a raw .env file (text/plain) or a JSON object of key/value pairs (application/json)
+// All keys are upserted in one transaction. Pass ?redeploy=true to rebuild the app afterwards
+func (h *Handlers) BulkImportEnvVars(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	// Verify app belongs to user
+	if h.appRepo == nil {
+		h.logger.Error("App repository not initialized")
+		h.writeError(w, http.StatusInternalServerError, "App repository not available")
+		return
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+
+	// Limit payload size (1MB is plenty for any .env file)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		h.writeError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+		return
+	}
+
+	var vars map[string]string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.Unmarshal(body, &vars); err != nil {
+			h.writeError(w, http.StatusBadRequest, "Invalid request body: expected a JSON object of string values")
+			return
+		}
+		for key := range vars {
+			if err := services.ValidateEnvKey(key); err != nil {
+				h.writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+	} else {
+		vars, err = services.ParseEnvFile(string(body))
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid .env file: %v", err))
+			return
+		}
+	}
+
+	if len(vars) == 0 {
+		h.writeError(w, http.StatusBadRequest, "No environment variables provided")
+		return
+	}
+
+	if h.envVarRepo == nil {
+		h.logger.Error("Env var repository not initialized")
+		h.writeError(w, http.StatusInternalServerError, "Env var repository not available")
+		return
+	}
+
+	envVars, err := h.envVarRepo.BulkUpsertEnvVars(r.Context(), appID, vars)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.logger.Error("Timeout importing env vars", zap.Error(err), zap.String("app_id", appID))
+			h.writeError(w, http.StatusGatewayTimeout, "Request timed out while importing environment variables")
+			return
+		}
+		h.logger.Error("Failed to import env vars", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to import environment variables")
+		return
+	}
+
+	response := BulkEnvVarResponse{
+		EnvVars: make([]EnvVar, len(envVars)),
+		Count:   len(envVars),
+	}
+	for i, v := range envVars {
+		response.EnvVars[i] = *v
+	}
+
+	if r.URL.Query().Get("redeploy") == "true" {
+		buildJobID, _, err := h.enqueueRedeploy(r, app, userID, nil)
+		if err != nil {
+			// The variables are saved - report the redeploy failure without failing the import
+			h.logger.Warn("Env vars imported but redeploy could not be started", zap.Error(err), zap.String("app_id", appID))
+		} else {
+			response.Redeployed = true
+			response.BuildJobID = buildJobID
+		}
+	}
+
+	h.writeJSON(w, http.StatusOK, response)
+}
+
 // DELETE /api/v1/apps/{id}/env/{key} - Delete environment variable
 func (h *Handlers) DeleteEnvVar(w http.ResponseWriter, r *http.Request) {
 	appID := chi.URLParam(r, "id")
@@ -1198,27 +2047,186 @@ func (h *Handlers) DeleteEnvVar(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// GET /api/v1/deployments/{id} - Get deployment by ID
+// GET /api/v1/deployments/{id} - Get deployment by ID, including the env vars its container was started with
 func (h *Handlers) GetDeploymentByID(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	deploymentID, _ := strconv.Atoi(id)
-	now := time.Now().Format(time.RFC3339)
-	
-	deployment := Deployment{
-		ID:        deploymentID,
-		AppID:     1,
-		Status:    "running",
-		ImageName: map[string]interface{}{"String": "my-app:latest", "Valid": true},
-		ContainerID: map[string]interface{}{"String": "container-123", "Valid": true},
-		Subdomain: map[string]interface{}{"String": "my-app", "Valid": true},
-		BuildLog: map[string]interface{}{"String": "Building...", "Valid": true},
-		RuntimeLog: map[string]interface{}{"String": "Running...", "Valid": true},
-		CreatedAt: now,
-		UpdatedAt: now,
+	deploymentID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	if h.deploymentRepo == nil || h.appRepo == nil {
+		h.logger.Error("Repositories not initialized")
+		h.writeError(w, http.StatusInternalServerError, "Deployment repository not available")
+		return
+	}
+
+	deploymentData, err := h.deploymentRepo.GetDeploymentByID(deploymentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Deployment not found")
+			return
+		}
+		h.logger.Error("Failed to get deployment", zap.Error(err), zap.String("deployment_id", deploymentID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deployment")
+		return
 	}
+
+	// Verify app ownership
+	appID, _ := deploymentData["app_id"].(string)
+	if _, err := h.appRepo.GetAppByID(appID, userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Deployment not found or access denied")
+			return
+		}
+		h.logger.Error("Failed to verify app ownership", zap.Error(err), zap.String("app_id", appID), zap.String("user_id", userID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to verify deployment access")
+		return
+	}
+
+	deployment := deploymentFromRecord(deploymentData)
+	snapshot, err := h.deploymentRepo.GetEnvSnapshot(r.Context(), deploymentID)
+	if err != nil {
+		h.logger.Error("Failed to get env snapshot", zap.Error(err), zap.String("deployment_id", deploymentID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deployment environment")
+		return
+	}
+	deployment.EnvSnapshot = snapshot
+
 	h.writeJSON(w, http.StatusOK, deployment)
 }
 
+// POST /api/v1/deployments/{id}/cancel - Cancel a queued or running build
+// {id} is a deployment ID or, for a build still waiting in the queue (which has no deployment yet),
+// the build_job_id returned when the build was triggered
+func (h *Handlers) CancelDeployment(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	if h.deploymentRepo == nil || h.orgRepo == nil || h.taskEnqueue == nil {
+		h.logger.Error("Build cancellation not available - repositories or task queue not initialized")
+		h.writeError(w, http.StatusInternalServerError, "Build cancellation not available")
+		return
+	}
+
+	// Find the build and the app it belongs to
+	var appID, buildJobID, status string
+	var task *asynq.TaskInfo
+	deploymentData, err := h.deploymentRepo.GetDeploymentByID(id)
+	switch {
+	case err == nil:
+		appID, _ = deploymentData["app_id"].(string)
+		buildJobID, _ = deploymentData["build_job_id"].(string)
+		status, _ = deploymentData["status"].(string)
+	case errors.Is(err, pgx.ErrNoRows):
+		buildJobID = id
+		appID, status, err = h.deploymentRepo.GetBuildJob(r.Context(), buildJobID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Not started yet - only the queued task knows which app it builds
+			task, err = h.taskEnqueue.FindBuildTask(r.Context(), buildJobID)
+			if err == nil && task == nil {
+				h.writeError(w, http.StatusNotFound, "Deployment not found")
+				return
+			}
+			if err == nil {
+				var payload tasks.BuildTaskPayload
+				if err = json.Unmarshal(task.Payload, &payload); err == nil {
+					appID, status = payload.AppID, "pending"
+				}
+			}
+		}
+		if err != nil {
+			h.logger.Error("Failed to find build", zap.Error(err), zap.String("build_job_id", buildJobID))
+			h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deployment")
+			return
+		}
+	default:
+		h.logger.Error("Failed to get deployment", zap.Error(err), zap.String("deployment_id", id))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deployment")
+		return
+	}
+
+	// The route is not under /apps/{id}, so it checks the role AppAccessMiddleware requires for writes there:
+	// org viewers can see builds but not cancel them
+	ownerID, denied, message, err := appWriteAccess(r.Context(), h.orgRepo, appID, userID)
+	if denied != 0 {
+		if err != nil {
+			h.logger.Error("Failed to verify app access", zap.Error(err), zap.String("app_id", appID), zap.String("user_id", userID))
+		}
+		h.writeError(w, denied, message)
+		return
+	}
+
+	// Only the build can be cancelled - a deploy in progress is already replacing containers
+	if buildJobID == "" || (status != "pending" && status != "building") {
+		h.writeError(w, http.StatusConflict, fmt.Sprintf("Deployment is %s and can no longer be cancelled", status))
+		return
+	}
+
+	if task == nil {
+		task, err = h.taskEnqueue.FindBuildTask(r.Context(), buildJobID)
+		if err != nil {
+			h.logger.Error("Failed to find build task", zap.Error(err), zap.String("build_job_id", buildJobID))
+			h.writeError(w, http.StatusInternalServerError, "Failed to cancel deployment")
+			return
+		}
+	}
+
+	// Record the cancellation first - the build worker checks it before it records any outcome
+	deploymentID, err := h.deploymentRepo.CancelBuild(r.Context(), buildJobID, appID, "Build cancelled by user")
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusConflict, "Build already finished and can no longer be cancelled")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to cancel deployment")
+		return
+	}
+
+	// A build whose worker died has no task left; the cancellation above is all it needs
+	running := status == "building"
+	if task != nil {
+		cancellation, err := h.taskEnqueue.CancelBuildTask(r.Context(), task)
+		if err != nil {
+			// The worker still sees the cancelled build job and stops before deploying
+			h.logger.Warn("Failed to stop build task - it will stop once the build finishes",
+				zap.Error(err),
+				zap.String("build_job_id", buildJobID),
+				zap.String("task_id", task.ID),
+			)
+		} else {
+			running = cancellation == services.BuildCancellationSignalled
+		}
+	}
+
+	// Free the concurrent build slot of a build whose worker died - a live build task frees its own
+	// slot when it stops. Org apps build against the owner's plan
+	if running && task == nil && h.planEnforcement != nil {
+		h.planEnforcement.DecrementBuildCount(r.Context(), ownerID)
+	}
+
+	h.logger.Info("Deployment cancelled",
+		zap.String("app_id", appID),
+		zap.String("build_job_id", buildJobID),
+		zap.String("deployment_id", deploymentID),
+		zap.Bool("was_running", running),
+		zap.String("user_id", userID),
+	)
+
+	deploymentData, err = h.deploymentRepo.GetDeploymentByID(deploymentID)
+	if err != nil {
+		h.logger.Error("Failed to get cancelled deployment", zap.Error(err), zap.String("deployment_id", deploymentID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deployment")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, deploymentFromRecord(deploymentData))
+}
+
 // GET /api/v1/deployments/{id}/logs - Get deployment logs
 func (h *Handlers) GetDeploymentLogs(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
@@ -1439,29 +2447,160 @@ func (h *Handlers) GetDeploymentLogs(w http.ResponseWriter, r *http.Request) {
 		)
 	}
 
-	// Get status from deployment
-	status := "unknown"
-	if statusVal, ok := deploymentData["status"].(string); ok {
-		status = statusVal
+	// Get status from deployment
+	status := "unknown"
+	if statusVal, ok := deploymentData["status"].(string); ok {
+		status = statusVal
+	}
+
+	logs := DeploymentLogs{
+		DeploymentID: 0, // Not needed in response
+		Status:       status,
+		BuildLog:     buildLog,
+		RuntimeLog:   runtimeLog,
+		ErrorMessage: errorMsg,
+	}
+	h.logger.Info("Returning deployment logs response",
+		zap.String("deployment_id", deploymentID),
+		zap.String("app_id", appID),
+		zap.Int("runtime_log_length", len(runtimeLog)),
+		zap.Int("build_log_length", len(buildLog)),
+		zap.Bool("has_runtime_log", len(runtimeLog) > 0),
+		zap.Bool("has_build_log", len(buildLog) > 0),
+		zap.Any("build_job_id_in_deployment", deploymentData["build_job_id"]),
+	)
+	h.writeJSON(w, http.StatusOK, logs)
+}
+
+// GET /api/v1/deployments/{id}/logs/download - Get a time-limited signed URL for the complete build log
+// The JSON logs endpoint embeds the whole log in the response; this URL streams the raw file instead
+func (h *Handlers) GetBuildLogDownloadURL(w http.ResponseWriter, r *http.Request) {
+	deploymentID := chi.URLParam(r, "id")
+
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+	if h.logDownloadSigner == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Build log downloads are not available")
+		return
+	}
+
+	deploymentData, err := h.deploymentRepo.GetDeploymentByID(deploymentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Deployment not found")
+			return
+		}
+		h.logger.Error("Failed to get deployment", zap.Error(err), zap.String("deployment_id", deploymentID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deployment")
+		return
+	}
+
+	// Verify app ownership
+	appID, _ := deploymentData["app_id"].(string)
+	if _, err := h.appRepo.GetAppByID(appID, userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Deployment not found or access denied")
+			return
+		}
+		h.logger.Error("Failed to verify app ownership", zap.Error(err), zap.String("app_id", appID), zap.String("user_id", userID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to verify deployment access")
+		return
+	}
+
+	expiresAt := time.Now().Add(services.BuildLogDownloadTTL)
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", h.logDownloadSigner.Sign(deploymentID, expiresAt))
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"url":        fmt.Sprintf("/api/v1/downloads/build-logs/%s?%s", url.PathEscape(deploymentID), query.Encode()),
+		"expires_at": expiresAt.UTC(),
+	})
+}
+
+// GET /api/v1/downloads/build-logs/{id}?expires=&signature= - Stream the complete raw build log
+// Unauthenticated: the signature from GetBuildLogDownloadURL grants access until it expires.
+// The log is gzip-compressed on the wire when the client accepts it
+func (h *Handlers) DownloadBuildLog(w http.ResponseWriter, r *http.Request) {
+	deploymentID := chi.URLParam(r, "id")
+
+	if h.logDownloadSigner == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Build log downloads are not available")
+		return
+	}
+	if err := h.logDownloadSigner.Verify(deploymentID, r.URL.Query().Get("expires"), r.URL.Query().Get("signature")); err != nil {
+		h.writeError(w, http.StatusForbidden, fmt.Sprintf("Invalid download link: %s", err.Error()))
+		return
+	}
+
+	deploymentData, err := h.deploymentRepo.GetDeploymentByID(deploymentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Deployment not found")
+			return
+		}
+		h.logger.Error("Failed to get deployment", zap.Error(err), zap.String("deployment_id", deploymentID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deployment")
+		return
+	}
+
+	buildLog, err := h.openBuildLog(r.Context(), deploymentData)
+	if err != nil {
+		h.logger.Error("Failed to open build log", zap.Error(err), zap.String("deployment_id", deploymentID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve build log")
+		return
 	}
+	if buildLog == nil {
+		h.writeError(w, http.StatusNotFound, "Build log not found")
+		return
+	}
+	defer buildLog.Close()
 
-	logs := DeploymentLogs{
-		DeploymentID: 0, // Not needed in response
-		Status:       status,
-		BuildLog:     buildLog,
-		RuntimeLog:   runtimeLog,
-		ErrorMessage: errorMsg,
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"build-%s.log\"", deploymentID))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Vary", "Accept-Encoding")
+
+	var out io.Writer = w
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
 	}
-	h.logger.Info("Returning deployment logs response",
-		zap.String("deployment_id", deploymentID),
-		zap.String("app_id", appID),
-		zap.Int("runtime_log_length", len(runtimeLog)),
-		zap.Int("build_log_length", len(buildLog)),
-		zap.Bool("has_runtime_log", len(runtimeLog) > 0),
-		zap.Bool("has_build_log", len(buildLog) > 0),
-		zap.Any("build_job_id_in_deployment", deploymentData["build_job_id"]),
-	)
-	h.writeJSON(w, http.StatusOK, logs)
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(out, buildLog); err != nil {
+		h.logger.Warn("Build log download interrupted", zap.Error(err), zap.String("deployment_id", deploymentID))
+	}
+}
+
+// openBuildLog opens a deployment's build log: the persisted file of its build job, falling back to
+// the build_log column for older deployments. Returns nil when the deployment has no build log
+func (h *Handlers) openBuildLog(ctx context.Context, deploymentData map[string]interface{}) (io.ReadCloser, error) {
+	appID, _ := deploymentData["app_id"].(string)
+	buildJobID, _ := deploymentData["build_job_id"].(string)
+	if h.logPersistence != nil && buildJobID != "" {
+		file, err := h.logPersistence.OpenBuildLog(ctx, appID, buildJobID)
+		if err == nil {
+			return file, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	if buildLogVal, ok := deploymentData["build_log"].(map[string]interface{}); ok {
+		if valid, ok := buildLogVal["Valid"].(bool); ok && valid {
+			if str, ok := buildLogVal["String"].(string); ok && str != "" {
+				return io.NopCloser(strings.NewReader(str)), nil
+			}
+		}
+	}
+	return nil, nil
 }
 
 // GET /api/v1/apps/{id}/logs/build - Get build logs for an app
@@ -1487,7 +2626,8 @@ func (h *Handlers) GetBuildLogs(w http.ResponseWriter, r *http.Request) {
 
 	logs, err := h.logPersistence.GetLogs(r.Context(), appID, LogType("build"), limit, offset)
 	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get build logs: %v", err))
+		h.logger.Error("Failed to get build logs", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to get build logs")
 		return
 	}
 
@@ -1517,7 +2657,8 @@ func (h *Handlers) GetRuntimeLogs(w http.ResponseWriter, r *http.Request) {
 
 	logs, err := h.logPersistence.GetLogs(r.Context(), appID, LogType("runtime"), limit, offset)
 	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get runtime logs: %v", err))
+		h.logger.Error("Failed to get runtime logs", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to get runtime logs")
 		return
 	}
 
@@ -1544,7 +2685,8 @@ func (h *Handlers) StreamRuntimeLogs(w http.ResponseWriter, r *http.Request) {
 
 	reader, err := h.containerLogs.StreamContainerLogs(r.Context(), containerID, since, tail, follow)
 	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to stream logs: %v", err))
+		h.logger.Error("Failed to stream logs", zap.Error(err), zap.String("container_id", containerID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to stream logs")
 		return
 	}
 	defer reader.Close()
@@ -1663,6 +2805,8 @@ func (h *Handlers) GetUserProfile(w http.ResponseWriter, r *http.Request) {
 				Workers:      false,
 				PriorityBuilds: false,
 				ManualDeployOnly: false,
+				BuildMinutes:     300,
+				TeamMembers:      1,
 			}
 		} else {
 			plan = defaultPlan
@@ -1687,95 +2831,483 @@ func (h *Handlers) GetUserProfile(w http.ResponseWriter, r *http.Request) {
 			Workers:      false,
 			PriorityBuilds: false,
 			ManualDeployOnly: false,
+			BuildMinutes:     300,
+			TeamMembers:      1,
+		}
+		planName = "starter"
+	}
+
+	// Get user's allocated resources (same figures as GET /api/v1/usage)
+	appCount, totalRAMMB, totalDiskMB := h.getAllocatedUsage(r.Context(), userID)
+
+	// Build subscription info if available
+	var subscriptionInfo *SubscriptionInfo
+	if subscription != nil {
+		var trialStartedAt, trialEndsAt *string
+		if subscription.TrialStartedAt != nil {
+			startedAt := subscription.TrialStartedAt.Format(time.RFC3339)
+			trialStartedAt = &startedAt
+		}
+		if subscription.TrialEndsAt != nil {
+			endsAt := subscription.TrialEndsAt.Format(time.RFC3339)
+			trialEndsAt = &endsAt
+		}
+		var periodStart, periodEnd *string
+		if subscription.CurrentPeriodStart != nil {
+			start := subscription.CurrentPeriodStart.Format(time.RFC3339)
+			periodStart = &start
+		}
+		if subscription.CurrentPeriodEnd != nil {
+			end := subscription.CurrentPeriodEnd.Format(time.RFC3339)
+			periodEnd = &end
+		}
+		subscriptionInfo = &SubscriptionInfo{
+			Status:             subscription.Status,
+			Plan:               subscription.Plan,
+			TrialStartedAt:     trialStartedAt,
+			TrialEndsAt:        trialEndsAt,
+			CurrentPeriodStart: periodStart,
+			CurrentPeriodEnd:   periodEnd,
+			CancelAtPeriodEnd:  subscription.CancelAtPeriodEnd,
+			RAMLimitMB:         subscription.RAMLimitMB,
+			DiskLimitGB:        subscription.DiskLimitGB,
+		}
+	}
+
+	// Build profile response with plan and quota information
+	profile := UserProfile{
+		ID:            user.ID,
+		Email:         user.Email,
+		FullName:      user.FullName,
+		CompanyName:   user.CompanyName,
+		EmailVerified: false, // TODO: Implement email verification check
+		Plan:          planName,
+		BillingStatus: user.BillingStatus, // Include billing_status from users table
+		CreatedAt:     createdAt.Format(time.RFC3339),
+		UpdatedAt:     updatedAt.Format(time.RFC3339),
+		Timezone:      user.Timezone,
+		Locale:        user.Locale,
+		AvatarURL:     user.AvatarURL,
+		NotificationPreferences: user.NotificationPreferences,
+		Quota: &Quota{
+			PlanName:    plan.Name,
+			AppCount:    appCount,
+			TotalRAMMB:  totalRAMMB,
+			TotalDiskMB: totalDiskMB,
+			Plan: PlanInfo{
+				Name:            plan.Name,
+				DisplayName:     plan.DisplayName,
+				Price:           plan.Price,
+				MaxRAMMB:        plan.MaxRAMMB,
+				MaxDiskMB:       plan.MaxDiskMB,
+				MaxApps:         plan.MaxApps,
+				AlwaysOn:        plan.AlwaysOn,
+				AutoDeploy:      plan.AutoDeploy,
+				HealthChecks:    plan.HealthChecks,
+				Logs:            plan.Logs,
+				ZeroDowntime:    plan.ZeroDowntime,
+				Workers:         plan.Workers,
+				PriorityBuilds:  plan.PriorityBuilds,
+				ManualDeployOnly: plan.ManualDeployOnly,
+				BuildMinutes:     plan.BuildMinutes,
+				TeamMembers:      plan.TeamMembers,
+				AccessRules:      plan.AccessRules,
+				Isolation:        plan.Isolation,
+			},
+		},
+		Subscription: subscriptionInfo,
+	}
+
+	h.writeJSON(w, http.StatusOK, profile)
+}
+
+// Avatar upload limits
+const (
+	maxAvatarBytes = 2 << 20 // 2 MB
+)
+
+// avatarContentTypes maps accepted avatar image types to file extensions
+var avatarContentTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// UpdateProfileRequest is a partial profile update - omitted fields are left unchanged
+type UpdateProfileRequest struct {
+	FullName                *string                         `json:"full_name"`
+	CompanyName             *string                         `json:"company_name"`
+	Timezone                *string                         `json:"timezone"`
+	Locale                  *string                         `json:"locale"`
+	NotificationPreferences *NotificationPreferencesRequest `json:"notification_preferences"`
+}
+
+// NotificationPreferencesRequest updates the channels of individual notification categories
+type NotificationPreferencesRequest struct {
+	DeployFailures *ChannelPreferencesRequest `json:"deploy_failures"`
+	WeeklyDigest   *ChannelPreferencesRequest `json:"weekly_digest"`
+	Marketing      *ChannelPreferencesRequest `json:"marketing"`
+	Billing        *ChannelPreferencesRequest `json:"billing"`
+	Maintenance    *ChannelPreferencesRequest `json:"maintenance"`
+	FirstDeploy    *ChannelPreferencesRequest `json:"first_deploy"`
+	BaseImage      *ChannelPreferencesRequest `json:"base_image"`
+}
+
+// ChannelPreferencesRequest toggles channels for one category - omitted channels are left unchanged
+type ChannelPreferencesRequest struct {
+	Email *bool `json:"email"`
+	Slack *bool `json:"slack"`
+}
+
+func (c *ChannelPreferencesRequest) applyTo(channels *services.ChannelPreferences) {
+	if c == nil {
+		return
+	}
+	if c.Email != nil {
+		channels.Email = *c.Email
+	}
+	if c.Slack != nil {
+		channels.Slack = *c.Slack
+	}
+}
+
+// applyTo merges the requested changes into prefs
+func (req *NotificationPreferencesRequest) applyTo(prefs *services.NotificationPreferences) error {
+	if req.Billing != nil && req.Billing.Email != nil && !*req.Billing.Email {
+		return fmt.Errorf("billing emails cannot be disabled")
+	}
+	req.DeployFailures.applyTo(&prefs.DeployFailures)
+	req.WeeklyDigest.applyTo(&prefs.WeeklyDigest)
+	req.Marketing.applyTo(&prefs.Marketing)
+	req.Billing.applyTo(&prefs.Billing)
+	req.Maintenance.applyTo(&prefs.Maintenance)
+	req.FirstDeploy.applyTo(&prefs.FirstDeploy)
+	req.BaseImage.applyTo(&prefs.BaseImage)
+	return nil
+}
+
+// PATCH /api/user/me - Update profile fields (full_name, company_name, timezone, locale, notification_preferences)
+func (h *Handlers) UpdateUserProfile(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	if h.userRepo == nil {
+		h.logger.Error("User repository not initialized")
+		h.writeError(w, http.StatusInternalServerError, "User repository not available")
+		return
+	}
+
+	var req UpdateProfileRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	update := UserProfileUpdate{}
+	if req.FullName != nil {
+		fullName := strings.TrimSpace(*req.FullName)
+		if len(fullName) > 255 {
+			h.writeError(w, http.StatusBadRequest, "full_name must be at most 255 characters")
+			return
+		}
+		update.FullName = &fullName
+	}
+	if req.CompanyName != nil {
+		companyName := strings.TrimSpace(*req.CompanyName)
+		if len(companyName) > 255 {
+			h.writeError(w, http.StatusBadRequest, "company_name must be at most 255 characters")
+			return
+		}
+		update.CompanyName = &companyName
+	}
+	if req.Timezone != nil {
+		timezone := strings.TrimSpace(*req.Timezone)
+		// "Local" would resolve to the server's zone, not the user's
+		if _, err := time.LoadLocation(timezone); err != nil || timezone == "" || timezone == "Local" {
+			h.writeError(w, http.StatusBadRequest, "timezone must be an IANA time zone name, e.g. Europe/Berlin")
+			return
+		}
+		update.Timezone = &timezone
+	}
+	if req.Locale != nil {
+		locale := services.NormalizeLocale(*req.Locale)
+		if locale == "" {
+			h.writeError(w, http.StatusBadRequest, "locale must be one of: "+strings.Join(services.SupportedLocales, ", "))
+			return
+		}
+		update.Locale = &locale
+	}
+
+	if req.NotificationPreferences != nil {
+		// Merge onto the current preferences so clients can flip a single toggle
+		user, err := h.userRepo.GetUserByID(userID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				h.writeError(w, http.StatusNotFound, "User not found")
+				return
+			}
+			h.logger.Error("Failed to get user", zap.Error(err), zap.String("user_id", userID))
+			h.writeError(w, http.StatusInternalServerError, "Failed to retrieve user")
+			return
+		}
+		prefs := user.NotificationPreferences
+		if err := req.NotificationPreferences.applyTo(&prefs); err != nil {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		update.NotificationPreferences = &prefs
+	}
+
+	if err := h.userRepo.UpdateUserProfile(r.Context(), userID, update); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to update profile")
+		return
+	}
+
+	h.logger.Info("User profile updated", zap.String("user_id", userID))
+	h.GetUserProfile(w, r)
+}
+
+// POST /api/user/me/avatar - Upload an avatar image (multipart field "avatar", PNG/JPEG/GIF/WebP, max 2 MB)
+func (h *Handlers) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	if h.userRepo == nil || h.objectStorage == nil {
+		h.logger.Error("Avatar upload not configured")
+		h.writeError(w, http.StatusServiceUnavailable, "Avatar uploads are not available")
+		return
+	}
+
+	// Allow some headroom for multipart framing on top of the image itself
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarBytes+64*1024)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.writeError(w, http.StatusRequestEntityTooLarge, "Avatar must be at most 2 MB")
+			return
+		}
+		h.writeError(w, http.StatusBadRequest, "Expected a multipart form with an \"avatar\" file")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAvatarBytes+1))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Failed to read avatar")
+		return
+	}
+	if len(data) > maxAvatarBytes {
+		h.writeError(w, http.StatusRequestEntityTooLarge, "Avatar must be at most 2 MB")
+		return
+	}
+
+	// Trust the bytes, not the client's Content-Type
+	contentType := http.DetectContentType(data)
+	ext, ok := avatarContentTypes[contentType]
+	if !ok {
+		h.writeError(w, http.StatusUnsupportedMediaType, "Avatar must be a PNG, JPEG, GIF or WebP image")
+		return
+	}
+
+	user, err := h.userRepo.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		h.logger.Error("Failed to get user", zap.Error(err), zap.String("user_id", userID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve user")
+		return
+	}
+
+	// A fresh key per upload so CDNs and browsers never serve a stale avatar
+	key := fmt.Sprintf("avatars/%s/%s%s", userID, uuid.New().String(), ext)
+	avatarURL, err := h.objectStorage.Put(r.Context(), key, contentType, data)
+	if err != nil {
+		h.logger.Error("Failed to store avatar", zap.Error(err), zap.String("user_id", userID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to store avatar")
+		return
+	}
+
+	if err := h.userRepo.UpdateUserAvatar(r.Context(), userID, key, avatarURL); err != nil {
+		h.logger.Error("Failed to save avatar", zap.Error(err), zap.String("user_id", userID))
+		if delErr := h.objectStorage.Delete(r.Context(), key); delErr != nil {
+			h.logger.Warn("Failed to delete orphaned avatar", zap.Error(delErr), zap.String("key", key))
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to save avatar")
+		return
+	}
+
+	// Best-effort removal of the previous avatar
+	if user.AvatarKey != "" {
+		if err := h.objectStorage.Delete(r.Context(), user.AvatarKey); err != nil {
+			h.logger.Warn("Failed to delete previous avatar", zap.Error(err), zap.String("key", user.AvatarKey))
+		}
+	}
+
+	h.logger.Info("User avatar updated", zap.String("user_id", userID), zap.Int("size", len(data)))
+	h.GetUserProfile(w, r)
+}
+
+// DELETE /api/user/me/avatar - Remove the current avatar
+func (h *Handlers) DeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	if h.userRepo == nil || h.objectStorage == nil {
+		h.logger.Error("Avatar upload not configured")
+		h.writeError(w, http.StatusServiceUnavailable, "Avatar uploads are not available")
+		return
+	}
+
+	user, err := h.userRepo.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		h.logger.Error("Failed to get user", zap.Error(err), zap.String("user_id", userID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve user")
+		return
+	}
+
+	if user.AvatarKey != "" {
+		if err := h.userRepo.UpdateUserAvatar(r.Context(), userID, "", ""); err != nil {
+			h.writeError(w, http.StatusInternalServerError, "Failed to remove avatar")
+			return
+		}
+		if err := h.objectStorage.Delete(r.Context(), user.AvatarKey); err != nil {
+			h.logger.Warn("Failed to delete avatar object", zap.Error(err), zap.String("key", user.AvatarKey))
+		}
+	}
+
+	h.GetUserProfile(w, r)
+}
+
+// NotificationSettings is the notification preference center view
+type NotificationSettings struct {
+	Preferences    services.NotificationPreferences `json:"preferences"`
+	SlackConnected bool                             `json:"slack_connected"` // The webhook URL itself is never returned
+}
+
+// UpdateNotificationSettingsRequest changes preferences and/or the Slack webhook
+type UpdateNotificationSettingsRequest struct {
+	Preferences     *NotificationPreferencesRequest `json:"preferences"`
+	SlackWebhookURL *string                         `json:"slack_webhook_url"` // "" disconnects Slack
+}
+
+// GET /api/user/me/notifications - Get notification preferences per category and channel
+func (h *Handlers) GetNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	if h.userRepo == nil {
+		h.logger.Error("User repository not initialized")
+		h.writeError(w, http.StatusInternalServerError, "User repository not available")
+		return
+	}
+
+	recipient, err := h.userRepo.GetNotificationRecipient(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "User not found")
+			return
 		}
-		planName = "starter"
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve notification settings")
+		return
 	}
 
-	// Get user's apps to calculate usage
-	var appCount int
-	var totalRAMMB int
-	var totalDiskMB int
-	
-	if h.appRepo != nil {
-		apps, err := h.appRepo.GetAppsByUserID(userID)
-		if err != nil {
-			h.logger.Warn("Failed to get user apps for quota calculation", zap.Error(err), zap.String("user_id", userID))
-		} else {
-			appCount = len(apps)
-			
-			// Calculate total RAM and disk usage from apps' deployments
-			for _, app := range apps {
-				// Enrich app with deployment data to get usage stats
-				h.enrichAppWithDeployment(r.Context(), &app)
-				
-				if app.Deployment != nil && app.Deployment.UsageStats != nil {
-					totalRAMMB += app.Deployment.UsageStats.MemoryUsageMB
-					// Convert disk usage from GB to MB
-					totalDiskMB += int(app.Deployment.UsageStats.DiskUsageGB * 1024)
-				}
-			}
+	h.writeJSON(w, http.StatusOK, NotificationSettings{
+		Preferences:    recipient.Preferences,
+		SlackConnected: recipient.SlackWebhookURL != "",
+	})
+}
+
+// PATCH /api/user/me/notifications - Update notification preferences and the Slack webhook
+func (h *Handlers) UpdateNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	if h.userRepo == nil {
+		h.logger.Error("User repository not initialized")
+		h.writeError(w, http.StatusInternalServerError, "User repository not available")
+		return
+	}
+
+	var req UpdateNotificationSettingsRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.SlackWebhookURL != nil {
+		webhookURL := strings.TrimSpace(*req.SlackWebhookURL)
+		if webhookURL != "" && !services.IsSlackWebhookURL(webhookURL) {
+			h.writeError(w, http.StatusBadRequest, "slack_webhook_url must be a Slack incoming webhook (https://hooks.slack.com/...)")
+			return
 		}
+		req.SlackWebhookURL = &webhookURL
 	}
 
-	// Build subscription info if available
-	var subscriptionInfo *SubscriptionInfo
-	if subscription != nil {
-		var trialStartedAt, trialEndsAt *string
-		if subscription.TrialStartedAt != nil {
-			startedAt := subscription.TrialStartedAt.Format(time.RFC3339)
-			trialStartedAt = &startedAt
+	recipient, err := h.userRepo.GetNotificationRecipient(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "User not found")
+			return
 		}
-		if subscription.TrialEndsAt != nil {
-			endsAt := subscription.TrialEndsAt.Format(time.RFC3339)
-			trialEndsAt = &endsAt
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve notification settings")
+		return
+	}
+
+	prefs := recipient.Preferences
+	if req.Preferences != nil {
+		if err := req.Preferences.applyTo(&prefs); err != nil {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
 		}
-		subscriptionInfo = &SubscriptionInfo{
-			Status:         subscription.Status,
-			Plan:           subscription.Plan,
-			TrialStartedAt: trialStartedAt,
-			TrialEndsAt:    trialEndsAt,
-			RAMLimitMB:     subscription.RAMLimitMB,
-			DiskLimitGB:    subscription.DiskLimitGB,
+		if err := h.userRepo.UpdateUserProfile(r.Context(), userID, UserProfileUpdate{NotificationPreferences: &prefs}); err != nil {
+			h.writeError(w, http.StatusInternalServerError, "Failed to update notification preferences")
+			return
 		}
 	}
 
-	// Build profile response with plan and quota information
-	profile := UserProfile{
-		ID:            user.ID,
-		Email:         user.Email,
-		FullName:      user.FullName,
-		CompanyName:   user.CompanyName,
-		EmailVerified: false, // TODO: Implement email verification check
-		Plan:          planName,
-		BillingStatus: user.BillingStatus, // Include billing_status from users table
-		CreatedAt:     createdAt.Format(time.RFC3339),
-		UpdatedAt:     updatedAt.Format(time.RFC3339),
-		Quota: &Quota{
-			PlanName:    plan.Name,
-			AppCount:    appCount,
-			TotalRAMMB:  totalRAMMB,
-			TotalDiskMB: totalDiskMB,
-			Plan: PlanInfo{
-				Name:            plan.Name,
-				DisplayName:     plan.DisplayName,
-				Price:           plan.Price,
-				MaxRAMMB:        plan.MaxRAMMB,
-				MaxDiskMB:       plan.MaxDiskMB,
-				MaxApps:         plan.MaxApps,
-				AlwaysOn:        plan.AlwaysOn,
-				AutoDeploy:      plan.AutoDeploy,
-				HealthChecks:    plan.HealthChecks,
-				Logs:            plan.Logs,
-				ZeroDowntime:    plan.ZeroDowntime,
-				Workers:         plan.Workers,
-				PriorityBuilds:  plan.PriorityBuilds,
-				ManualDeployOnly: plan.ManualDeployOnly,
-			},
-		},
-		Subscription: subscriptionInfo,
+	slackConnected := recipient.SlackWebhookURL != ""
+	if req.SlackWebhookURL != nil {
+		if err := h.userRepo.UpdateSlackWebhookURL(r.Context(), userID, *req.SlackWebhookURL); err != nil {
+			h.writeError(w, http.StatusInternalServerError, "Failed to update Slack webhook")
+			return
+		}
+		slackConnected = *req.SlackWebhookURL != ""
 	}
 
-	h.writeJSON(w, http.StatusOK, profile)
+	h.logger.Info("Notification settings updated",
+		zap.String("user_id", userID),
+		zap.Bool("slack_connected", slackConnected),
+	)
+
+	h.writeJSON(w, http.StatusOK, NotificationSettings{
+		Preferences:    prefs,
+		SlackConnected: slackConnected,
+	})
 }
 
 // GET /api/v1/apps/{id}/verify - Verify deployment status
@@ -1941,179 +3473,280 @@ func (h *Handlers) enrichAppWithDeployment(ctx context.Context, app *App) {
 		}
 	}
 
-	// Set default resource limits and usage stats (will be updated if container stats are available)
-	defaultMemoryMB := 512
-	defaultCPU := 1
-	defaultDiskGB := 10
-	defaultMemoryUsageMB := 0
-	defaultMemoryUsagePercent := 0.0
-	defaultDiskUsageGB := 0.0
-	defaultDiskUsagePercent := 0.0
-	defaultRestartCount := 0
-
-	// Only try to get container stats if container ID is available and deployment service exists
-	if containerID == "" || h.deploymentService == nil {
-		// Set defaults when container stats aren't available
-		if app.Deployment != nil {
-			app.Deployment.ResourceLimits = &ResourceLimits{
-				MemoryMB: defaultMemoryMB,
-				CPU:      defaultCPU,
-				DiskGB:   defaultDiskGB,
+	// Limits and usage come from the deploy worker's latest docker stats sample
+	// Without a recent sample (no running container, collector not caught up) usage is reported as zero
+	restartCount, _ := activeDeployment["restart_count"].(int) // Also counts health monitor restarts, which Docker doesn't
+	limits := &ResourceLimits{
+		MemoryMB: 512,
+		CPU:      1,
+		DiskGB:   10, // Disk is not capped per container
+	}
+	usage := &UsageStats{RestartCount: restartCount}
+
+	if h.metricsRepo != nil && containerID != "" {
+		sample, err := h.metricsRepo.GetLatestSample(ctx, app.ID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			h.logger.Debug("Failed to get latest metrics sample", zap.Error(err), zap.String("app_id", app.ID))
+		}
+		if sample != nil && time.Since(sample.sampledAt) < metricsFreshness {
+			if sample.MemoryLimitMB > 0 {
+				limits.MemoryMB = int(sample.MemoryLimitMB)
 			}
-			app.Deployment.UsageStats = &UsageStats{
-				MemoryUsageMB:      defaultMemoryUsageMB,
-				MemoryUsagePercent: defaultMemoryUsagePercent,
-				DiskUsageGB:        defaultDiskUsageGB,
-				DiskUsagePercent:   defaultDiskUsagePercent,
-				RestartCount:       defaultRestartCount,
+			if sample.CPULimit >= 1 {
+				limits.CPU = int(sample.CPULimit)
+			}
+			usage.MemoryUsageMB = int(sample.MemoryUsageMB)
+			usage.MemoryUsagePercent = sample.MemoryUsagePercent
+			if sample.DiskUsageMB != nil {
+				usage.DiskUsageGB = *sample.DiskUsageMB / 1024
+				usage.DiskUsagePercent = usage.DiskUsageGB / float64(limits.DiskGB) * 100
+			}
+			if sample.RestartCount > usage.RestartCount {
+				usage.RestartCount = sample.RestartCount
 			}
 		}
-		return
 	}
 
-	// Try to get Docker client via type assertion to the concrete type
-	// The deploymentService is actually *services.DeploymentService
-	type DockerClientGetter interface {
-		GetDockerClient() *client.Client
-	}
-	
-	var dockerClient *client.Client
-	if getter, ok := h.deploymentService.(DockerClientGetter); ok {
-		dockerClient = getter.GetDockerClient()
-	} else {
-		// Try reflection-based approach as fallback
-		h.logger.Debug("Cannot get Docker client via interface, trying reflection")
-		// Set defaults when Docker client can't be obtained
-		if app.Deployment != nil {
-			app.Deployment.ResourceLimits = &ResourceLimits{
-				MemoryMB: defaultMemoryMB,
-				CPU:      defaultCPU,
-				DiskGB:   defaultDiskGB,
-			}
-			app.Deployment.UsageStats = &UsageStats{
-				MemoryUsageMB:      defaultMemoryUsageMB,
-				MemoryUsagePercent: defaultMemoryUsagePercent,
-				DiskUsageGB:        defaultDiskUsageGB,
-				DiskUsagePercent:   defaultDiskUsagePercent,
-				RestartCount:       defaultRestartCount,
-			}
+	if app.Deployment == nil {
+		app.Deployment = &AppDeployment{
+			ActiveDeploymentID: fmt.Sprintf("dep_%s", deploymentID),
+			LastDeployedAt:     lastDeployedAt,
+			State:              state,
 		}
+	}
+	app.Deployment.ResourceLimits = limits
+	app.Deployment.UsageStats = usage
+}
+
+// metricsFreshness is how old the latest sample may be and still describe the running container
+const metricsFreshness = 2 * time.Minute
+
+// metricsWindows are the supported ?window= values for app metrics
+var metricsWindows = map[string]time.Duration{
+	"15m": 15 * time.Minute,
+	"1h":  time.Hour,
+	"6h":  6 * time.Hour,
+	"24h": 24 * time.Hour,
+}
+
+// GET /api/v1/apps/{id}/metrics - Get current and recent CPU, memory, disk and network usage
+// ?window=15m|1h|6h|24h (default 1h); samples are averaged into ~120 points
+func (h *Handlers) GetAppMetrics(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+
+	if h.metricsRepo == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Metrics are not available")
 		return
 	}
 
-	if dockerClient == nil {
-		// Set defaults when Docker client is nil
-		if app.Deployment != nil {
-			app.Deployment.ResourceLimits = &ResourceLimits{
-				MemoryMB: defaultMemoryMB,
-				CPU:      defaultCPU,
-				DiskGB:   defaultDiskGB,
-			}
-			app.Deployment.UsageStats = &UsageStats{
-				MemoryUsageMB:      defaultMemoryUsageMB,
-				MemoryUsagePercent: defaultMemoryUsagePercent,
-				DiskUsageGB:        defaultDiskUsageGB,
-				DiskUsagePercent:   defaultDiskUsagePercent,
-				RestartCount:       defaultRestartCount,
-			}
-		}
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "1h"
+	}
+	windowDuration, ok := metricsWindows[window]
+	if !ok {
+		h.writeError(w, http.StatusBadRequest, "Invalid window. Use 15m, 1h, 6h or 24h")
 		return
 	}
+	resolution := int(windowDuration.Seconds()) / 120
+	if resolution < 15 {
+		resolution = 15
+	}
 
-	// Get container stats (one-shot, not streaming)
-	stats, err := dockerClient.ContainerStats(ctx, containerID, false)
+	samples, err := h.metricsRepo.GetSamples(r.Context(), appID, time.Now().UTC().Add(-windowDuration), resolution)
 	if err != nil {
-		h.logger.Debug("Failed to get container stats", zap.Error(err), zap.String("container_id", containerID))
-		// Continue without stats - we can still get basic info from inspect
-	} else {
-		defer stats.Body.Close()
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve metrics")
+		return
+	}
+	if samples == nil {
+		samples = []AppMetricSample{}
+	}
+
+	metrics := AppMetrics{
+		AppID:             appID,
+		Window:            window,
+		ResolutionSeconds: resolution,
+		Samples:           samples,
+	}
+	latest, err := h.metricsRepo.GetLatestSample(r.Context(), appID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve metrics")
+		return
+	}
+	if latest != nil && time.Since(latest.sampledAt) < metricsFreshness {
+		metrics.Current = latest
+	}
+
+	h.writeJSON(w, http.StatusOK, metrics)
+}
+
+// trafficWindows are the supported ?window= values for app traffic
+var trafficWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"6h":  6 * time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// GET /api/v1/apps/{id}/traffic - Get the app's requests/sec, p95 latency, status codes and egress
+// ?window=1h|6h|24h|7d|30d (default 24h); buckets are whole minutes, merged into ~120 points
+func (h *Handlers) GetAppTraffic(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+
+	if h.trafficRepo == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Traffic metrics are not available")
+		return
 	}
 
-	// Inspect container to get resource limits and restart count
-	containerJSON, err := dockerClient.ContainerInspect(ctx, containerID)
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "24h"
+	}
+	windowDuration, ok := trafficWindows[window]
+	if !ok {
+		h.writeError(w, http.StatusBadRequest, "Invalid window. Use 1h, 6h, 24h, 7d or 30d")
+		return
+	}
+	bucketSeconds := int(services.TrafficBucketSize.Seconds())
+	resolution := (int(windowDuration.Seconds())/120 + bucketSeconds - 1) / bucketSeconds * bucketSeconds
+
+	buckets, err := h.trafficRepo.GetTraffic(r.Context(), appID, time.Now().UTC().Add(-windowDuration), resolution)
 	if err != nil {
-		h.logger.Debug("Failed to inspect container", zap.Error(err))
-		// Set defaults when container inspection fails
-		if app.Deployment != nil {
-			app.Deployment.ResourceLimits = &ResourceLimits{
-				MemoryMB: defaultMemoryMB,
-				CPU:      defaultCPU,
-				DiskGB:   defaultDiskGB,
-			}
-			app.Deployment.UsageStats = &UsageStats{
-				MemoryUsageMB:      defaultMemoryUsageMB,
-				MemoryUsagePercent: defaultMemoryUsagePercent,
-				DiskUsageGB:        defaultDiskUsageGB,
-				DiskUsagePercent:   defaultDiskUsagePercent,
-				RestartCount:       defaultRestartCount,
-			}
-		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve traffic")
 		return
 	}
 
-	// Calculate memory usage from stats if available
-	memoryLimit := float64(containerJSON.HostConfig.Memory)
-	memoryUsageMB := 0
-	memoryUsagePercent := 0.0
-	
-	if stats.Body != nil {
-		// Parse stats JSON
-		var statsJSON map[string]interface{}
-		if err := json.NewDecoder(stats.Body).Decode(&statsJSON); err == nil {
-			// Extract memory usage from stats
-			if memoryStats, ok := statsJSON["memory_stats"].(map[string]interface{}); ok {
-				if usage, ok := memoryStats["usage"].(float64); ok {
-					memoryUsageMB = int(usage / 1024 / 1024)
-					if memoryLimit > 0 {
-						memoryUsagePercent = (usage / memoryLimit) * 100
-					}
-				}
-			}
+	traffic := AppTraffic{
+		AppID:             appID,
+		Window:            window,
+		ResolutionSeconds: resolution,
+		Buckets:           []AppTrafficBucket{},
+	}
+	totalLatency := services.NewLatencyHistogram()
+	for _, bucket := range buckets {
+		bucket.RequestsPerSecond = float64(bucket.Requests) / float64(resolution)
+		bucket.P95LatencyMs = services.LatencyPercentile(bucket.latency, 0.95)
+		traffic.Buckets = append(traffic.Buckets, bucket)
+
+		traffic.Totals.Requests += bucket.Requests
+		traffic.Totals.Status.Status2xx += bucket.Status.Status2xx
+		traffic.Totals.Status.Status3xx += bucket.Status.Status3xx
+		traffic.Totals.Status.Status4xx += bucket.Status.Status4xx
+		traffic.Totals.Status.Status5xx += bucket.Status.Status5xx
+		traffic.Totals.EgressBytes += bucket.EgressBytes
+		services.AddLatencyHistograms(totalLatency, bucket.latency)
+	}
+	traffic.Totals.RequestsPerSecond = float64(traffic.Totals.Requests) / windowDuration.Seconds()
+	traffic.Totals.P95LatencyMs = services.LatencyPercentile(totalLatency, 0.95)
+
+	h.writeJSON(w, http.StatusOK, traffic)
+}
+
+// UpdateHealthCheckRequest is the body for PUT /api/v1/apps/{id}/health-check
+type UpdateHealthCheckRequest struct {
+	Path            string `json:"path"`
+	IntervalSeconds int    `json:"interval_seconds"`
+}
+
+// GET /api/v1/apps/{id}/health-check - Get the app's health check settings
+func (h *Handlers) GetHealthCheck(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
 		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
 	}
 
-	// If stats weren't available, use a default/estimated value
-	if memoryUsageMB == 0 && memoryLimit > 0 {
-		// Estimate based on container state (rough estimate)
-		memoryUsageMB = int(memoryLimit / 1024 / 1024 / 4) // Assume 25% usage as placeholder
-		memoryUsagePercent = 25.0
+	cfg, err := h.appRepo.GetHealthCheckConfig(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve health check settings")
+		return
 	}
 
-	// Calculate disk usage (Docker stats don't provide this directly)
-	// We'll use a placeholder or estimate based on container size
-	diskUsageGB := 0.5 // Default placeholder
-	diskUsagePercent := 5.0 // Default placeholder
+	// Settings only take effect on plans with health checks
+	enabled := h.planEnforcement == nil || h.planEnforcement.CheckHealthChecks(r.Context(), app.UserID) == nil
 
-	// Get restart count
-	restartCount := containerJSON.RestartCount
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"path":             cfg.Path,
+		"interval_seconds": cfg.IntervalSeconds,
+		"enabled":          enabled,
+	})
+}
 
-	// Get resource limits from container config
-	memoryMB := int(containerJSON.HostConfig.Memory / 1024 / 1024)
-	cpuLimit := float64(containerJSON.HostConfig.NanoCPUs) / 1e9
-	diskGB := 10 // Default, could be calculated from container size or config
+// PUT /api/v1/apps/{id}/health-check - Set the health check path and interval (applies on next deploy)
+func (h *Handlers) UpdateHealthCheck(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
 
-	// Update deployment data with container stats (if Deployment wasn't created above, create it now)
-	if app.Deployment == nil {
-		app.Deployment = &AppDeployment{
-			ActiveDeploymentID: fmt.Sprintf("dep_%s", deploymentID),
-			LastDeployedAt:     lastDeployedAt,
-			State:              state,
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+
+	// Health checks are gated by the owner's plan
+	if h.planEnforcement != nil {
+		if err := h.planEnforcement.CheckHealthChecks(r.Context(), app.UserID); err != nil {
+			if planErr, ok := GetPlanLimitError(err); ok {
+				writePlanLimitError(w, planErr)
+				return
+			}
+			h.writeError(w, http.StatusInternalServerError, "Failed to check plan limits")
+			return
 		}
 	}
 
-	// Add resource limits and usage stats
-	app.Deployment.ResourceLimits = &ResourceLimits{
-		MemoryMB: memoryMB,
-		CPU:      int(cpuLimit),
-		DiskGB:   diskGB,
+	var req UpdateHealthCheckRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.Path == "" {
+		req.Path = "/"
+	}
+	// The path is embedded in the container's health check command - keep it to plain URL path characters
+	if !regexp.MustCompile(`^/[A-Za-z0-9/_.~%-]*$`).MatchString(req.Path) || len(req.Path) > 255 {
+		h.writeError(w, http.StatusBadRequest, "Health check path must start with / and contain only letters, digits and / _ . ~ % -")
+		return
+	}
+	if req.IntervalSeconds == 0 {
+		req.IntervalSeconds = 30
+	}
+	if req.IntervalSeconds < 5 || req.IntervalSeconds > 300 {
+		h.writeError(w, http.StatusBadRequest, "Health check interval must be between 5 and 300 seconds")
+		return
 	}
-	app.Deployment.UsageStats = &UsageStats{
-		MemoryUsageMB:      memoryUsageMB,
-		MemoryUsagePercent: memoryUsagePercent,
-		DiskUsageGB:        diskUsageGB,
-		DiskUsagePercent:   diskUsagePercent,
-		RestartCount:       restartCount,
+
+	cfg := HealthCheckConfig{Path: req.Path, IntervalSeconds: req.IntervalSeconds}
+	if err := h.appRepo.UpdateHealthCheckConfig(r.Context(), app.ID, cfg); err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to update health check settings")
+		return
 	}
+
+	h.logger.Info("Health check settings updated",
+		zap.String("app_id", app.ID),
+		zap.String("path", cfg.Path),
+		zap.Int("interval_seconds", cfg.IntervalSeconds),
+		zap.String("user_id", userID),
+	)
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"path":             cfg.Path,
+		"interval_seconds": cfg.IntervalSeconds,
+		"enabled":          true,
+		"message":          "Health check settings saved. Redeploy the app to apply them.",
+	})
 }
 
 // Admin handlers
@@ -2219,6 +3852,8 @@ func (h *Handlers) AdminListUsers(w http.ResponseWriter, r *http.Request) {
 					Workers:      false,
 					PriorityBuilds: false,
 					ManualDeployOnly: false,
+					BuildMinutes:     300,
+					TeamMembers:      1,
 				}
 			} else {
 				plan = defaultPlan
@@ -2226,25 +3861,8 @@ func (h *Handlers) AdminListUsers(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		
-		// Get user's apps to calculate usage
-		var appCount int
-		var totalRAMMB int
-		var totalDiskMB int
-		if h.appRepo != nil {
-			apps, err := h.appRepo.GetAppsByUserID(user.ID)
-			if err != nil {
-				h.logger.Warn("Failed to get user apps for quota calculation", zap.Error(err), zap.String("user_id", user.ID))
-			} else {
-				appCount = len(apps)
-				for _, app := range apps {
-					h.enrichAppWithDeployment(r.Context(), &app)
-					if app.Deployment != nil && app.Deployment.UsageStats != nil {
-						totalRAMMB += app.Deployment.UsageStats.MemoryUsageMB
-						totalDiskMB += int(app.Deployment.UsageStats.DiskUsageGB * 1024)
-					}
-				}
-			}
-		}
+		// Get user's allocated resources
+		appCount, totalRAMMB, totalDiskMB := h.getAllocatedUsage(r.Context(), user.ID)
 		
 		// Final fallback if plan is still nil
 		if plan == nil {
@@ -2263,6 +3881,8 @@ func (h *Handlers) AdminListUsers(w http.ResponseWriter, r *http.Request) {
 				Workers:      false,
 				PriorityBuilds: false,
 				ManualDeployOnly: false,
+				BuildMinutes:     300,
+				TeamMembers:      1,
 			}
 			planName = "starter"
 		}
@@ -2297,6 +3917,10 @@ func (h *Handlers) AdminListUsers(w http.ResponseWriter, r *http.Request) {
 					Workers:         plan.Workers,
 					PriorityBuilds:  plan.PriorityBuilds,
 					ManualDeployOnly: plan.ManualDeployOnly,
+					BuildMinutes:     plan.BuildMinutes,
+					TeamMembers:      plan.TeamMembers,
+					AccessRules:      plan.AccessRules,
+					Isolation:        plan.Isolation,
 				},
 			},
 		})
@@ -2400,8 +4024,7 @@ func (h *Handlers) AdminUpdateUserPlan(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Plan string `json:"plan"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 	
@@ -2434,6 +4057,7 @@ func (h *Handlers) AdminUpdateUserPlan(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, http.StatusInternalServerError, "Failed to update user plan")
 		return
 	}
+	noteAuditDetail(r, "plan", req.Plan)
 	
 	response := map[string]interface{}{
 		"message": "User plan updated successfully",
@@ -2446,55 +4070,20 @@ func (h *Handlers) AdminUpdateUserPlan(w http.ResponseWriter, r *http.Request) {
 
 // POST /admin/apps/{id}/stop - Stop app (admin version, no ownership check)
 func (h *Handlers) AdminStopApp(w http.ResponseWriter, r *http.Request) {
-	appID := chi.URLParam(r, "id")
-	
-	// Get app (no ownership check for admin)
-	_, err := h.appRepo.GetAppByIDWithoutUserCheck(appID)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			h.writeError(w, http.StatusNotFound, "App not found")
-			return
-		}
-		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
-		h.writeError(w, http.StatusInternalServerError, "Failed to get app")
+	app, ok := h.getAppForPowerChange(w, r, true)
+	if !ok {
 		return
 	}
-	
-	// TODO: Implement stop logic
-	// For now, return success
-	response := map[string]interface{}{
-		"message":           "App stopped successfully",
-		"app_id":            appID,
-		"stopped_containers": 0,
-	}
-	
-	h.writeJSON(w, http.StatusOK, response)
+	h.stopApp(w, r, app)
 }
 
 // POST /admin/apps/{id}/start - Start app (admin version, no ownership check)
 func (h *Handlers) AdminStartApp(w http.ResponseWriter, r *http.Request) {
-	appID := chi.URLParam(r, "id")
-	
-	// Get app (no ownership check for admin)
-	_, err := h.appRepo.GetAppByIDWithoutUserCheck(appID)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			h.writeError(w, http.StatusNotFound, "App not found")
-			return
-		}
-		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
-		h.writeError(w, http.StatusInternalServerError, "Failed to get app")
+	app, ok := h.getAppForPowerChange(w, r, true)
+	if !ok {
 		return
 	}
-	
-	// TODO: Implement start logic
-	// For now, return success
-	response := map[string]interface{}{
-		"message": "App started successfully",
-		"app_id":  appID,
-	}
-	
-	h.writeJSON(w, http.StatusOK, response)
+	h.startApp(w, r, app)
 }
 
 // POST /admin/apps/{id}/redeploy - Redeploy app (admin version, no ownership check)
@@ -2502,7 +4091,7 @@ func (h *Handlers) AdminRedeployApp(w http.ResponseWriter, r *http.Request) {
 	appID := chi.URLParam(r, "id")
 	
 	// Get app (no ownership check for admin)
-	_, err := h.appRepo.GetAppByIDWithoutUserCheck(appID)
+	app, err := h.appRepo.GetAppByIDWithoutUserCheck(appID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			h.writeError(w, http.StatusNotFound, "App not found")
@@ -2512,6 +4101,7 @@ func (h *Handlers) AdminRedeployApp(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, http.StatusInternalServerError, "Failed to get app")
 		return
 	}
+	noteAuditSubject(r, app.UserID, "")
 	
 	// Reuse existing redeploy logic but skip ownership check
 	// For now, return success (full implementation would trigger redeploy)
@@ -2541,6 +4131,7 @@ func (h *Handlers) AdminDeleteApp(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, http.StatusInternalServerError, "Failed to get app")
 		return
 	}
+	noteAuditSubject(r, app.UserID, "")
 	
 	// Clean up deployment resources if deployment service is available
 	if h.deploymentService != nil {
@@ -2549,6 +4140,9 @@ func (h *Handlers) AdminDeleteApp(w http.ResponseWriter, r *http.Request) {
 			// Continue with deletion even if cleanup fails
 		}
 	}
+	if h.planEnforcement != nil {
+		h.planEnforcement.ReleaseAppRAM(r.Context(), appID)
+	}
 	
 	// Delete app from database (no ownership check - admin can delete any app)
 	// We need to get the user_id from the app to pass to DeleteApp
@@ -2634,10 +4228,7 @@ func (h *Handlers) AdminDeleteUser(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Delete user (this will cascade delete related records: apps, subscriptions, etc.)
-	// We need to delete from database directly since there's no DeleteUser method
-	// Let's add a direct SQL delete with CASCADE
-	ctx := r.Context()
-	_, err = h.userRepo.pool.Exec(ctx, "DELETE FROM users WHERE id = $1", userID)
+	err = h.userRepo.DeleteUser(r.Context(), userID)
 	if err != nil {
 		h.logger.Error("Failed to delete user", zap.Error(err), zap.String("user_id", userID))
 		h.writeError(w, http.StatusInternalServerError, "Failed to delete user")
@@ -2680,8 +4271,7 @@ func (h *Handlers) TestBillingState(w http.ResponseWriter, r *http.Request) {
 		TrialEndsAt   *time.Time `json:"trial_ends_at,omitempty"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"crypto/hmac"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// DrainHostRequest is the optional body of POST /admin/hosts/{id}/drain
+type DrainHostRequest struct {
+	Reason string `json:"reason" validate:"max=500"` // Shown on GET /admin/hosts, e.g. the maintenance planned
+}
+
+// SetHostRepo sets the repository of Docker hosts reported by the deploy workers
+func (h *Handlers) SetHostRepo(hostRepo *HostRepo) {
+	h.hostRepo = hostRepo
+}
+
+// SetTraefikProviderToken enables GET /api/v1/traefik/routes for Traefik HTTP providers sending token
+func (h *Handlers) SetTraefikProviderToken(token string) {
+	h.traefikProviderToken = token
+}
+
+// GET /api/v1/traefik/routes - Traefik dynamic configuration for the apps running on other hosts
+// Polled by each host's Traefik HTTP provider with ?node=<its NODE_NAME> and the X-Provider-Token header
+// (TRAEFIK_PROVIDER_TOKEN). Requests for those apps are forwarded to the Traefik of the host they run on
+func (h *Handlers) TraefikRoutes(w http.ResponseWriter, r *http.Request) {
+	if h.hostRepo == nil || h.traefikProviderToken == "" {
+		h.writeError(w, http.StatusServiceUnavailable, "Traefik routes are not available")
+		return
+	}
+	if !hmac.Equal([]byte(r.Header.Get("X-Provider-Token")), []byte(h.traefikProviderToken)) {
+		h.writeError(w, http.StatusUnauthorized, "Invalid provider token")
+		return
+	}
+	node := r.URL.Query().Get("node")
+	if node == "" {
+		h.writeError(w, http.StatusBadRequest, "node is required")
+		return
+	}
+
+	routes, err := h.hostRepo.RemoteAppRoutes(r.Context(), node)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to list app routes")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, services.ForwardingConfig(routes))
+}
+
+// GET /admin/hosts - List the Docker hosts running app containers with their capacity
+// CPU, memory, disk, containers and images as last reported by each host's deploy worker, plus how much
+// CPU and memory the app containers there reserve and whether the host is drained
+func (h *Handlers) AdminListHosts(w http.ResponseWriter, r *http.Request) {
+	if h.hostRepo == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Hosts are not available")
+		return
+	}
+
+	hosts, err := h.hostRepo.ListHosts(r.Context())
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to list hosts")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, hosts)
+}
+
+// POST /admin/hosts/{id}/drain - Stop scheduling new deploys to a host
+// {id} is the host's name. Its deploy workers leave new deploys in the queue for other hosts; containers
+// already running there keep running until they are redeployed elsewhere
+func (h *Handlers) AdminDrainHost(w http.ResponseWriter, r *http.Request) {
+	h.setHostDraining(w, r, true)
+}
+
+// DELETE /admin/hosts/{id}/drain - Let a drained host take new deploys again
+func (h *Handlers) AdminUndrainHost(w http.ResponseWriter, r *http.Request) {
+	h.setHostDraining(w, r, false)
+}
+
+// setHostDraining drains the host named in the URL or returns it to service
+func (h *Handlers) setHostDraining(w http.ResponseWriter, r *http.Request, draining bool) {
+	name := chi.URLParam(r, "id")
+
+	if h.hostRepo == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Hosts are not available")
+		return
+	}
+
+	var req DrainHostRequest
+	if draining {
+		if !decodeOptionalJSON(w, r, &req) {
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+	}
+
+	host, err := h.hostRepo.SetHostDraining(r.Context(), name, draining, req.Reason, h.getUserIDFromContext(r))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Host not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to update host")
+		return
+	}
+	if req.Reason != "" {
+		noteAuditDetail(r, "reason", req.Reason)
+	}
+
+	h.logger.Info("Host draining changed",
+		zap.String("host", name),
+		zap.Bool("draining", draining),
+		zap.String("reason", req.Reason),
+	)
+	h.writeJSON(w, http.StatusOK, host)
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+
+	stackynerrors "stackyn/server/internal/errors"
+	"stackyn/server/internal/services"
+)
+
+const (
+	// idempotencyKeyHeader is the request header clients name a retryable request with (Stripe's name)
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader marks responses replayed from the first request with the key
+	idempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentResponseBytes is the largest response stored for replay; larger ones are not replayed
+	maxIdempotentResponseBytes = 1 << 20
+)
+
+// IdempotencyStoreService stores the responses IdempotencyMiddleware replays (services.IdempotencyStore)
+type IdempotencyStoreService interface {
+	Claim(ctx context.Context, key, fingerprint string) (*services.IdempotentResponse, error)
+	Complete(ctx context.Context, key string, response services.IdempotentResponse) error
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyMiddleware makes POST requests sent with an Idempotency-Key safe to retry: the first
+// response is stored per user, route and key, and replayed to later requests with the same key instead
+// of running the handler again. A retry while the first request still runs gets 409, and reusing a
+// key with a different body gets 422.
+// Server errors (5xx) are not stored so they can be retried. Requests without the header, and every
+// request when the store is nil or Redis fails, run as usual. Must run after authentication
+func IdempotencyMiddleware(store IdempotencyStoreService, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyKeyHeader)
+			userID, _ := r.Context().Value("user_id").(string)
+			if store == nil || key == "" || userID == "" || r.Method != http.MethodPost {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				writeAPIError(w, http.StatusBadRequest, "", fmt.Sprintf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength), nil)
+				return
+			}
+
+			// Retries must send the same body - the body is read here and handed on to the handler
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					writeAPIError(w, http.StatusRequestEntityTooLarge, "", fmt.Sprintf("Request body must be at most %d bytes", tooLarge.Limit), nil)
+					return
+				}
+				writeAPIError(w, http.StatusBadRequest, "", "Failed to read request body", nil)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			sum := sha256.Sum256(body)
+			fingerprint := hex.EncodeToString(sum[:])
+
+			storeKey := services.IdempotencyKey(userID, r.Method+" "+r.URL.Path, key)
+			existing, err := store.Claim(r.Context(), storeKey, fingerprint)
+			if err != nil {
+				logger.Warn("Idempotency store unavailable - running request without replay protection",
+					zap.Error(err),
+					zap.String("path", r.URL.Path),
+				)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if existing != nil {
+				switch {
+				case existing.Fingerprint != fingerprint:
+					writeAPIError(w, http.StatusUnprocessableEntity, stackynerrors.ErrorCodeIdempotencyKeyReused, "", nil)
+				case existing.Status == 0:
+					writeAPIError(w, http.StatusConflict, stackynerrors.ErrorCodeIdempotencyKeyInUse, "", nil)
+				default:
+					if existing.ContentType != "" {
+						w.Header().Set("Content-Type", existing.ContentType)
+					}
+					w.Header().Set(idempotentReplayedHeader, "true")
+					w.WriteHeader(existing.Status)
+					w.Write(existing.Body)
+				}
+				return
+			}
+
+			// The client may be gone - which is when its retry needs the stored response most
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+			defer cancel()
+			release := func() {
+				if err := store.Release(ctx, storeKey); err != nil {
+					logger.Warn("Failed to release idempotency key", zap.Error(err), zap.String("path", r.URL.Path))
+				}
+			}
+
+			// Recoverer runs outside this middleware, so a panicking handler releases the key here; otherwise
+			// retries would get 409 until the claim expired
+			defer func() {
+				if p := recover(); p != nil {
+					release()
+					panic(p)
+				}
+			}()
+
+			var response bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&response)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK // Handler wrote nothing
+			}
+			if status >= http.StatusInternalServerError || response.Len() > maxIdempotentResponseBytes {
+				release()
+				return
+			}
+			err = store.Complete(ctx, storeKey, services.IdempotentResponse{
+				Fingerprint: fingerprint,
+				Status:      status,
+				ContentType: ww.Header().Get("Content-Type"),
+				Body:        response.Bytes(),
+			})
+			if err != nil {
+				logger.Warn("Failed to store idempotent response", zap.Error(err), zap.String("path", r.URL.Path))
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/services"
+)
+
+// memoryIdempotencyStore is an IdempotencyStoreService kept in memory
+type memoryIdempotencyStore struct {
+	mu        sync.Mutex
+	responses map[string]services.IdempotentResponse
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{responses: make(map[string]services.IdempotentResponse)}
+}
+
+func (s *memoryIdempotencyStore) Claim(ctx context.Context, key, fingerprint string) (*services.IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.responses[key]; ok {
+		return &existing, nil
+	}
+	s.responses[key] = services.IdempotentResponse{Fingerprint: fingerprint}
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(ctx context.Context, key string, response services.IdempotentResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[key] = response
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.responses, key)
+	return nil
+}
+
+func (s *memoryIdempotencyStore) size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.responses)
+}
+
+// idempotentTestServer runs handler behind IdempotencyMiddleware, signed in as user-1
+func idempotentTestServer(store IdempotencyStoreService, handler http.HandlerFunc) http.Handler {
+	return signedInAs("user@example.com")(IdempotencyMiddleware(store, zap.NewNop())(handler))
+}
+
+func idempotentRequest(key, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/apps", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(idempotencyKeyHeader, key)
+	}
+	return r
+}
+
+func TestIdempotencyMiddlewareReplays(t *testing.T) {
+	calls := 0
+	server := idempotentTestServer(newMemoryIdempotencyStore(), func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"app-1"}`))
+	})
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, idempotentRequest("key-1", `{"name":"web"}`))
+		if rec.Code != http.StatusCreated || rec.Body.String() != `{"id":"app-1"}` || rec.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("request %d: %d %q", i+1, rec.Code, rec.Body.String())
+		}
+		if replayed := rec.Header().Get(idempotentReplayedHeader) == "true"; replayed != (i > 0) {
+			t.Errorf("request %d: replayed = %v", i+1, replayed)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+
+	// A different body with the same key is a client bug
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, idempotentRequest("key-1", `{"name":"api"}`))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused key: got %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	// Requests without a key always run
+	server.ServeHTTP(httptest.NewRecorder(), idempotentRequest("", `{"name":"web"}`))
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+}
+
+func TestIdempotencyMiddlewareInFlight(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	sum := sha256.Sum256(nil)
+	store.Claim(context.Background(), services.IdempotencyKey("user-1", "POST /api/v1/apps", "key-1"), hex.EncodeToString(sum[:]))
+
+	rec := httptest.NewRecorder()
+	idempotentTestServer(store, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler ran while the first request with the key was running")
+	}).ServeHTTP(rec, idempotentRequest("key-1", ""))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("got %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestIdempotencyMiddlewareReleasesServerErrors(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	calls := 0
+	server := idempotentTestServer(store, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	for i := 0; i < 2; i++ {
+		server.ServeHTTP(httptest.NewRecorder(), idempotentRequest("key-1", ""))
+	}
+	if calls != 2 || store.size() != 0 {
+		t.Errorf("handler ran %d times with %d keys held, want 2 runs and no keys", calls, store.size())
+	}
+}
+
+func TestIdempotencyMiddlewareReleasesOnPanic(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	server := idempotentTestServer(store, func(w http.ResponseWriter, r *http.Request) {
+		panic("handler bug")
+	})
+
+	func() {
+		defer func() {
+			if p := recover(); p != "handler bug" {
+				t.Errorf("recovered %v, want the handler's panic", p)
+			}
+		}()
+		server.ServeHTTP(httptest.NewRecorder(), idempotentRequest("key-1", ""))
+	}()
+	if store.size() != 0 {
+		t.Errorf("the key is still claimed after the handler panicked")
+	}
+}
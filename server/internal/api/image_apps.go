@@ -0,0 +1,173 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+	"stackyn/server/internal/tasks"
+)
+
+// RegistryCredentialsRequest is the login an image app pulls a private image with
+// Stored like env vars and never returned by the API
+type RegistryCredentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"` // Password or access token (e.g. a GHCR personal access token)
+}
+
+// validate checks that both halves of the login are set
+func (c *RegistryCredentialsRequest) validate() error {
+	if strings.TrimSpace(c.Username) == "" || c.Password == "" {
+		return errors.New("registry_credentials needs a username and a password")
+	}
+	return nil
+}
+
+// UpdateAppImageRequest is the request body for PUT /api/v1/apps/{id}/image
+type UpdateAppImageRequest struct {
+	Image                    string                      `json:"image"`
+	RegistryCredentials      *RegistryCredentialsRequest `json:"registry_credentials,omitempty"`       // Replaces the stored login
+	ClearRegistryCredentials bool                        `json:"clear_registry_credentials,omitempty"` // Pull anonymously from now on
+}
+
+// setImage fills in the image fields of an app read from the database
+func (a *App) setImage(image, digest, latestDigest sql.NullString) {
+	if a.Source == "" {
+		a.Source = services.AppSourceGit
+	}
+	a.Image = image.String
+	a.ImageDigest = digest.String
+	a.ImageLatestDigest = latestDigest.String
+	a.ImageUpdateAvailable = a.ImageDigest != "" && a.ImageLatestDigest != "" && a.ImageLatestDigest != a.ImageDigest
+}
+
+// setupImageApp stores the image and registry login of a newly created image app
+func (h *Handlers) setupImageApp(r *http.Request, app *App, imageRef string, credentials *RegistryCredentialsRequest) error {
+	if err := h.appRepo.SetAppImage(r.Context(), app.ID, imageRef); err != nil {
+		return err
+	}
+	if credentials != nil {
+		if err := h.appRepo.SetRegistryCredentials(r.Context(), app.ID, strings.TrimSpace(credentials.Username), credentials.Password); err != nil {
+			return err
+		}
+	}
+	app.Source = services.AppSourceImage
+	app.Image = imageRef
+	return nil
+}
+
+// enqueueImageDeploy enqueues a deploy task that pulls an image app's image and runs it - there is no
+// build, so no build minutes are used. The pulled image is tagged with a new ID like a build's image,
+// so rollbacks and restarts work the same for both kinds of app. Returns that ID
+func (h *Handlers) enqueueImageDeploy(r *http.Request, app *App, userID string) (string, error) {
+	requestID := middleware.GetReqID(r.Context())
+	imageTag := uuid.New().String()
+
+	deployPayload := tasks.DeployTaskPayload{
+		AppID:          app.ID,
+		DeploymentID:   uuid.New().String(),
+		BuildJobID:     imageTag,
+		ImageName:      fmt.Sprintf("stackyn-%s", app.ID),
+		UserID:         userID,
+		RequestedRAMMB: 512,
+		SourceImage:    app.Image,
+		Trigger:        requestTrigger(r.Context()),
+		TriggeredBy:    h.getUserIDFromContext(r), // userID is the owner for org apps
+	}
+
+	taskInfo, err := h.taskEnqueue.EnqueueDeployTask(r.Context(), deployPayload, userID)
+	if err != nil {
+		h.logger.Error("Failed to enqueue deploy task for image app",
+			zap.Error(err),
+			zap.String("app_id", app.ID),
+			zap.String("request_id", requestID),
+			zap.String("user_id", userID),
+		)
+		return "", err
+	}
+
+	h.logger.Info("Image deploy task enqueued successfully",
+		zap.String("app_id", app.ID),
+		zap.String("image", app.Image),
+		zap.String("task_id", taskInfo.ID),
+		zap.String("request_id", requestID),
+		zap.String("user_id", userID),
+	)
+	return imageTag, nil
+}
+
+// PUT /api/v1/apps/{id}/image - Change the image of an image app (and its registry login)
+// Takes effect on the next deploy; the running deployment keeps its digest until then
+func (h *Handlers) UpdateAppImage(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+
+	var req UpdateAppImageRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+	if app.Source != services.AppSourceImage {
+		h.writeError(w, http.StatusBadRequest, "Only image apps run a registry image - this app is built from its repository")
+		return
+	}
+
+	imageRef, err := services.ParseSourceImage(req.Image)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.RegistryCredentials != nil {
+		if req.ClearRegistryCredentials {
+			h.writeError(w, http.StatusBadRequest, "Set registry_credentials or clear_registry_credentials, not both")
+			return
+		}
+		if err := req.RegistryCredentials.validate(); err != nil {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if err := h.appRepo.SetAppImage(r.Context(), app.ID, imageRef); err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to update image")
+		return
+	}
+	switch {
+	case req.RegistryCredentials != nil:
+		err = h.appRepo.SetRegistryCredentials(r.Context(), app.ID, strings.TrimSpace(req.RegistryCredentials.Username), req.RegistryCredentials.Password)
+	case req.ClearRegistryCredentials:
+		err = h.appRepo.DeleteRegistryCredentials(r.Context(), app.ID)
+	}
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to update registry credentials")
+		return
+	}
+	noteAuditDetail(r, "image", imageRef)
+
+	h.logger.Info("App image updated",
+		zap.String("app_id", app.ID),
+		zap.String("image", imageRef),
+		zap.Bool("credentials_changed", req.RegistryCredentials != nil || req.ClearRegistryCredentials),
+	)
+
+	app.Image = imageRef
+	app.ImageUpdateAvailable = false
+	h.writeJSON(w, http.StatusOK, app)
+}
@@ -0,0 +1,283 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// ImpersonationHeader is set on every response to an impersonated request so clients can show who is acting
+const ImpersonationHeader = "X-Impersonated-By"
+
+// maxAuditPageSize bounds GET /admin/audit
+const maxAuditPageSize = 500
+
+// ImpersonateRequest is the body for POST /admin/users/{id}/impersonate
+type ImpersonateRequest struct {
+	Reason string `json:"reason" validate:"notblank,max=500"` // Why support needs the user's view (ticket link, issue summary)
+}
+
+// ImpersonateResponse is returned when an impersonation session starts
+type ImpersonateResponse struct {
+	Token     string                `json:"token"` // Bearer token acting as the user until expires_at
+	ExpiresAt string                `json:"expires_at"`
+	Session   *ImpersonationSession `json:"session"`
+}
+
+// ImpersonationHandlers lets admins act as a user for support and review what was done
+type ImpersonationHandlers struct {
+	logger      *zap.Logger
+	jwtService  *services.JWTService
+	auditRepo   *AuditRepo
+	userRepo    *UserRepo
+	adminEmails map[string]bool
+	ttl         time.Duration
+}
+
+// NewImpersonationHandlers creates a new impersonation handlers instance
+func NewImpersonationHandlers(logger *zap.Logger, jwtService *services.JWTService, auditRepo *AuditRepo, userRepo *UserRepo, adminEmails []string, ttl time.Duration) *ImpersonationHandlers {
+	admins := make(map[string]bool, len(adminEmails))
+	for _, email := range adminEmails {
+		admins[strings.ToLower(email)] = true
+	}
+	return &ImpersonationHandlers{
+		logger:      logger,
+		jwtService:  jwtService,
+		auditRepo:   auditRepo,
+		userRepo:    userRepo,
+		adminEmails: admins,
+		ttl:         ttl,
+	}
+}
+
+// isAdmin reports whether an email belongs to an admin (ADMIN_EMAILS)
+func (h *ImpersonationHandlers) isAdmin(email string) bool {
+	return h.adminEmails[strings.ToLower(strings.TrimSpace(email))]
+}
+
+// RequireAdmin only lets admins through; impersonated requests are refused even when the target is an admin
+func (h *ImpersonationHandlers) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		email, _ := r.Context().Value("user_email").(string)
+		if _, impersonated := r.Context().Value("impersonation_id").(string); impersonated || !h.isAdmin(email) {
+			h.writeError(w, http.StatusForbidden, "Admin access required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// POST /admin/users/{id}/impersonate - Mint a short-lived token acting as the user
+// The session and every request made with its token are written to the audit log
+func (h *ImpersonationHandlers) ImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	targetID := chi.URLParam(r, "id")
+	adminID, _ := r.Context().Value("user_id").(string)
+	adminEmail, _ := r.Context().Value("user_email").(string)
+
+	var req ImpersonateRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	target, err := h.userRepo.GetUserByID(targetID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve user")
+		return
+	}
+	if target.ID == adminID {
+		h.writeError(w, http.StatusBadRequest, "You cannot impersonate yourself")
+		return
+	}
+	// Acting as another admin would blur who did what in the audit log
+	if h.isAdmin(target.Email) {
+		h.writeError(w, http.StatusForbidden, "Admins cannot be impersonated")
+		return
+	}
+
+	expiresAt := time.Now().UTC().Add(h.ttl)
+	session, err := h.auditRepo.CreateImpersonation(r.Context(), adminID, adminEmail, target.ID, target.Email, req.Reason, expiresAt)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to start impersonation")
+		return
+	}
+
+	token, err := h.jwtService.GenerateImpersonationToken(target.ID, target.Email, adminEmail, session.ID, expiresAt)
+	if err != nil {
+		h.logger.Error("Failed to generate impersonation token", zap.Error(err), zap.String("impersonation_id", session.ID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to start impersonation")
+		return
+	}
+
+	h.recordAdminAction(r, "impersonation.start", target.ID, session.ID, map[string]interface{}{
+		"reason":     req.Reason,
+		"expires_at": session.ExpiresAt,
+	})
+	h.logger.Warn("Admin impersonation started",
+		zap.String("impersonation_id", session.ID),
+		zap.String("admin_email", adminEmail),
+		zap.String("target_user_id", target.ID),
+		zap.Time("expires_at", expiresAt),
+	)
+
+	h.writeJSON(w, http.StatusCreated, ImpersonateResponse{
+		Token:     token,
+		ExpiresAt: session.ExpiresAt,
+		Session:   session,
+	})
+}
+
+// DELETE /admin/impersonations/{id} - End an impersonation session before it expires
+func (h *ImpersonationHandlers) EndImpersonation(w http.ResponseWriter, r *http.Request) {
+	impersonationID := chi.URLParam(r, "id")
+
+	session, err := h.auditRepo.EndImpersonation(r.Context(), impersonationID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Impersonation session not found or already ended")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to end impersonation")
+		return
+	}
+
+	h.recordAdminAction(r, "impersonation.end", session.TargetUserID, session.ID, nil)
+	h.writeJSON(w, http.StatusOK, session)
+}
+
+// GET /admin/audit - Review the audit log across all accounts, newest first
+// ?user_id= limits it to one account, ?impersonation_id= to one session, ?action= to an action or
+// prefix (auth.*), ?since=/?until= to a time range, ?limit= caps the page (default 100)
+func (h *ImpersonationHandlers) ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	filter, limit, err := parseAuditQuery(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.SubjectUserID = r.URL.Query().Get("user_id")
+	filter.ImpersonationID = r.URL.Query().Get("impersonation_id")
+
+	entries, err := h.auditRepo.ListAuditEntries(r.Context(), filter, limit)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve audit log")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, entries)
+}
+
+// recordAdminAction writes an admin's own action to the audit log; a failed write is logged, not returned
+func (h *ImpersonationHandlers) recordAdminAction(r *http.Request, action, subjectUserID, impersonationID string, details map[string]interface{}) {
+	adminID, _ := r.Context().Value("user_id").(string)
+	adminEmail, _ := r.Context().Value("user_email").(string)
+	if err := h.auditRepo.RecordAuditEntry(r.Context(), AuditEntry{
+		Action:          action,
+		ActorUserID:     adminID,
+		ActorEmail:      adminEmail,
+		SubjectUserID:   subjectUserID,
+		ImpersonationID: impersonationID,
+		Method:          r.Method,
+		Path:            r.URL.Path,
+		IP:              requestIP(r),
+		RequestID:       middleware.GetReqID(r.Context()),
+		Details:         details,
+	}); err != nil {
+		h.logger.Error("Failed to audit admin action", zap.Error(err), zap.String("action", action))
+	}
+}
+
+// ImpersonationMiddleware authenticates impersonation tokens and hands every other request to sessionAuth
+// Impersonated requests run as the target user, carry the admin in the context and the ImpersonationHeader,
+// and are each written to the audit log once handled
+func ImpersonationMiddleware(jwtService *services.JWTService, auditRepo *AuditRepo, sessionAuth func(http.Handler) http.Handler, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		sessionHandler := sessionAuth(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == "" || isAPIToken(token) {
+				sessionHandler.ServeHTTP(w, r)
+				return
+			}
+			claims, err := jwtService.ValidateToken(token)
+			if err != nil || claims.ImpersonationID == "" {
+				sessionHandler.ServeHTTP(w, r)
+				return
+			}
+
+			// Sessions ended by an admin stop working before the token expires
+			active, err := auditRepo.IsImpersonationActive(r.Context(), claims.ImpersonationID)
+			if err != nil {
+				writeAPIError(w, http.StatusInternalServerError, "", "Failed to verify impersonation session", nil)
+				return
+			}
+			if !active {
+				writeAPIError(w, http.StatusUnauthorized, "", "Impersonation session has ended", nil)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
+			ctx = context.WithValue(ctx, "user_email", claims.Email)
+			ctx = context.WithValue(ctx, "impersonator_email", claims.ImpersonatorEmail)
+			ctx = context.WithValue(ctx, "impersonation_id", claims.ImpersonationID)
+
+			w.Header().Set(ImpersonationHeader, claims.ImpersonatorEmail)
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			// Recorded after the handler so the outcome is known; the request context may be cancelled by now
+			auditCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := auditRepo.RecordAuditEntry(auditCtx, AuditEntry{
+				Action:          "impersonation.request",
+				ActorEmail:      claims.ImpersonatorEmail,
+				SubjectUserID:   claims.UserID,
+				ImpersonationID: claims.ImpersonationID,
+				Method:          r.Method,
+				Path:            r.URL.Path,
+				StatusCode:      ww.Status(),
+				IP:              requestIP(r),
+				RequestID:       middleware.GetReqID(r.Context()),
+			}); err != nil {
+				logger.Error("Failed to audit impersonated request",
+					zap.Error(err),
+					zap.String("impersonation_id", claims.ImpersonationID),
+					zap.String("path", r.URL.Path),
+				)
+			}
+		})
+	}
+}
+
+// requestIP is the client IP of a request (RemoteAddr has been rewritten by middleware.RealIP)
+func requestIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr // RealIP leaves a bare IP
+	}
+	return host
+}
+
+func (h *ImpersonationHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *ImpersonationHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
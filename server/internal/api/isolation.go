@@ -0,0 +1,124 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// AppIsolation is how tightly an app's containers are confined, as returned by /api/v1/apps/{id}/isolation
+type AppIsolation struct {
+	Isolation     string `json:"isolation"`      // Level the app opted into ("" follows the plan)
+	PlanIsolation string `json:"plan_isolation"` // Level the owner's plan requires
+	Effective     string `json:"effective"`      // The stricter of the two, which the app's containers run with
+}
+
+// UpdateIsolationRequest is the body for PUT /api/v1/apps/{id}/isolation
+type UpdateIsolationRequest struct {
+	Isolation string `json:"isolation"` // standard, hardened or strict; empty follows the plan
+}
+
+// GET /api/v1/apps/{id}/isolation - Get the isolation level the app's containers run with
+func (h *Handlers) GetAppIsolation(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getIsolationApp(w, r)
+	if !ok {
+		return
+	}
+
+	isolation, err := h.appRepo.GetIsolation(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve isolation")
+		return
+	}
+	planIsolation, err := h.planIsolation(r, app.UserID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve plan isolation")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, newAppIsolation(isolation, planIsolation))
+}
+
+// PUT /api/v1/apps/{id}/isolation - Confine the app's containers more tightly than its plan requires
+// Levels below the plan's are refused. The running deployment is redeployed to apply the level
+func (h *Handlers) UpdateAppIsolation(w http.ResponseWriter, r *http.Request) {
+	var req UpdateIsolationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Isolation = strings.TrimSpace(req.Isolation)
+	if req.Isolation != "" {
+		if _, err := services.ParseIsolationLevel(req.Isolation); err != nil {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	app, ok := h.getIsolationApp(w, r)
+	if !ok {
+		return
+	}
+	userID := h.getUserIDFromContext(r)
+
+	planIsolation, err := h.planIsolation(r, app.UserID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve plan isolation")
+		return
+	}
+	level := services.IsolationLevel(req.Isolation)
+	if level != "" && services.StricterIsolation(level, planIsolation) != level {
+		h.writeError(w, http.StatusForbidden, fmt.Sprintf("Your plan runs apps with %s isolation; choose %s or stricter", planIsolation, planIsolation))
+		return
+	}
+
+	if err := h.appRepo.SetIsolation(r.Context(), app.ID, req.Isolation); err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to update isolation")
+		return
+	}
+	h.logger.Info("App isolation updated",
+		zap.String("app_id", app.ID),
+		zap.String("isolation", req.Isolation),
+		zap.String("plan_isolation", string(planIsolation)),
+		zap.String("user_id", userID),
+	)
+
+	enqueueRouteRefresh(r.Context(), h.logger, h.taskEnqueue, h.deploymentRepo, app.ID, userID, "isolation")
+
+	h.writeJSON(w, http.StatusOK, newAppIsolation(req.Isolation, planIsolation))
+}
+
+// getIsolationApp loads the app from the URL, writing the error response and returning false on failure
+func (h *Handlers) getIsolationApp(w http.ResponseWriter, r *http.Request) (*App, bool) {
+	app, err := h.appRepo.GetAppByID(chi.URLParam(r, "id"), h.getUserIDFromContext(r))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return nil, false
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return nil, false
+	}
+	return app, true
+}
+
+// planIsolation returns the isolation level the plan of the app's owner requires
+func (h *Handlers) planIsolation(r *http.Request, ownerID string) (services.IsolationLevel, error) {
+	if h.planEnforcement == nil {
+		return services.DefaultIsolationLevel, nil
+	}
+	return h.planEnforcement.GetIsolationLevel(r.Context(), ownerID)
+}
+
+// newAppIsolation builds the API view of an app's isolation
+func newAppIsolation(isolation string, planIsolation services.IsolationLevel) AppIsolation {
+	return AppIsolation{
+		Isolation:     isolation,
+		PlanIsolation: string(planIsolation),
+		Effective:     string(services.StricterIsolation(planIsolation, services.IsolationLevel(isolation))),
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"stackyn/server/internal/services"
+)
+
+// Limits of GET /api/v1/apps/{id}/logs/search
+const (
+	defaultLogSearchPageSize = 100
+	maxLogSearchPageSize     = 500
+	maxLogSearchQueryLength  = 256
+)
+
+// SetLogSearchRepo sets the repository of log lines indexed by the workers for search
+func (h *Handlers) SetLogSearchRepo(logSearchRepo *LogSearchRepo) {
+	h.logSearchRepo = logSearchRepo
+}
+
+// GET /api/v1/apps/{id}/logs/search - Search the app's build, runtime and release log lines, newest first
+// ?q= matches a case-insensitive substring (a POSIX regex with ?regex=true); ?from= and ?to= (RFC 3339) bound
+// the time range, ?level= (error, warn, info, debug, comma-separated) and ?type= (build, runtime, release)
+// narrow it further. ?before=<line id> pages back through older lines
+func (h *Handlers) SearchLogs(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+
+	if h.logSearchRepo == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Log search is not available")
+		return
+	}
+
+	params := r.URL.Query()
+	query := LogSearchQuery{Limit: defaultLogSearchPageSize}
+
+	// The pattern is compiled here too: it highlights the matches and rejects bad regexes before Postgres sees them
+	var highlight *regexp.Regexp
+	if q := params.Get("q"); q != "" {
+		if len(q) > maxLogSearchQueryLength {
+			h.writeError(w, http.StatusBadRequest, "q must be at most 256 characters")
+			return
+		}
+		pattern := regexp.QuoteMeta(q)
+		if params.Get("regex") == "true" {
+			pattern = q
+			query.Regex = q
+		} else {
+			query.Substring = q
+		}
+		var err error
+		if highlight, err = regexp.Compile("(?i)" + pattern); err != nil {
+			h.writeError(w, http.StatusBadRequest, "q is not a valid regular expression")
+			return
+		}
+	}
+
+	for _, bound := range []struct {
+		name string
+		dest *time.Time
+	}{{"from", &query.From}, {"to", &query.To}} {
+		raw := params.Get(bound.name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, bound.name+" must be an RFC 3339 time")
+			return
+		}
+		*bound.dest = parsed
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && query.To.Before(query.From) {
+		h.writeError(w, http.StatusBadRequest, "to must not be before from")
+		return
+	}
+
+	levels, err := parseLogLevels(params.Get("level"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query.Levels = levels
+
+	if logType := params.Get("type"); logType != "" {
+		switch services.LogType(logType) {
+		case services.LogTypeBuild, services.LogTypeRuntime, services.LogTypeRelease:
+			query.LogType = logType
+		default:
+			h.writeError(w, http.StatusBadRequest, "type must be build, runtime or release")
+			return
+		}
+	}
+
+	if raw := params.Get("before"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 {
+			h.writeError(w, http.StatusBadRequest, "before must be a line ID")
+			return
+		}
+		query.Before = n
+	}
+
+	if raw := params.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxLogSearchPageSize {
+			h.writeError(w, http.StatusBadRequest, "limit must be between 1 and 500")
+			return
+		}
+		query.Limit = n
+	}
+
+	lines, err := h.logSearchRepo.SearchLogs(r.Context(), appID, query)
+	if err != nil {
+		// Postgres regexes differ from Go's in a few corners, so it can still refuse one
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "2201B" {
+			h.writeError(w, http.StatusBadRequest, "q is not a valid regular expression")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to search logs")
+		return
+	}
+
+	if highlight != nil {
+		for i := range lines {
+			lines[i].Highlights = highlightLogLine(lines[i].Line, highlight)
+		}
+	}
+	h.writeJSON(w, http.StatusOK, lines)
+}
+
+// parseLogLevels parses a comma-separated ?level= (error, warn, info, debug); an empty one selects every level
+func parseLogLevels(raw string) ([]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var levels []string
+	for _, level := range strings.Split(raw, ",") {
+		level = strings.ToLower(strings.TrimSpace(level))
+		switch level {
+		case services.LogLevelError, services.LogLevelWarn, services.LogLevelInfo, services.LogLevelDebug:
+			levels = append(levels, level)
+		default:
+			return nil, errors.New("level must be error, warn, info or debug")
+		}
+	}
+	return levels, nil
+}
+
+// highlightLogLine splits line into the parts pattern matches and those between them
+func highlightLogLine(line string, pattern *regexp.Regexp) []LogLineSegment {
+	var segments []LogLineSegment
+	last := 0
+	for _, match := range pattern.FindAllStringIndex(line, -1) {
+		if match[0] == match[1] {
+			continue // Empty matches (a regex like a*) highlight nothing
+		}
+		if match[0] > last {
+			segments = append(segments, LogLineSegment{Text: line[last:match[0]]})
+		}
+		segments = append(segments, LogLineSegment{Text: line[match[0]:match[1]], Match: true})
+		last = match[1]
+	}
+	if last < len(line) {
+		segments = append(segments, LogLineSegment{Text: line[last:]})
+	}
+	return segments
+}
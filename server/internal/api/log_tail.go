@@ -0,0 +1,305 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/services"
+)
+
+// Limits and timings of GET /api/v1/apps/{id}/logs/ws
+const (
+	defaultLogTailLines = 100
+	maxLogTailLines     = 1000
+	// logTailPollInterval is how often the runtime log is checked for new lines
+	logTailPollInterval = 500 * time.Millisecond
+	// logTailResolveInterval is how often the app's running container is looked up again, to follow redeploys
+	logTailResolveInterval = 5 * time.Second
+	logTailWriteWait       = 10 * time.Second
+	logTailPongWait        = 60 * time.Second
+	logTailPingPeriod      = (logTailPongWait * 9) / 10
+)
+
+// logTailUpgrader accepts the subprotocol browsers send their token with. Behind an auth proxy
+// (AUTH_MODE=header) browsers are authenticated by cookie, so only the origins CORS allows may open a
+// socket; clients that send no Origin (the CLI) are not browsers and are let through
+var logTailUpgrader = websocket.Upgrader{
+	Subprotocols: []string{websocketBearerProtocol},
+	CheckOrigin:  checkLogTailOrigin,
+}
+
+func checkLogTailOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || isAllowedOrigin(origin)
+}
+
+// RuntimeLogFrame is a JSON message sent by GET /api/v1/apps/{id}/logs/ws
+type RuntimeLogFrame struct {
+	Type string `json:"type"` // container, log or error
+	// container: the container whose log follows, sent first and whenever a deploy replaces it
+	ContainerID  string `json:"container_id,omitempty"`
+	DeploymentID string `json:"deployment_id,omitempty"`
+	// log: one line of the container's output
+	Stream    string `json:"stream,omitempty"` // stdout or stderr
+	Timestamp string `json:"timestamp,omitempty"`
+	Level     string `json:"level,omitempty"`
+	Line      string `json:"line,omitempty"`
+	// log: the fields of lines that are JSON objects, besides their level and message
+	Fields map[string]interface{} `json:"fields,omitempty"`
+	// log: the message of lines that are JSON objects; error: why the server is closing the socket
+	Message string `json:"message,omitempty"`
+}
+
+// GET /api/v1/apps/{id}/logs/ws - Tail the runtime log of the app's running container over a WebSocket
+// Every line is a JSON frame with its stream and timestamp. The last ?tail= lines (default 100, max 1000)
+// come first, leaving out those before ?since= (RFC 3339, or a duration such as 10m); new lines follow,
+// across redeploys, unless ?follow=false. ?level= (error, warn, info, debug, comma-separated) sends only
+// lines of those levels. Browsers authenticate by offering ["stackyn.bearer", <token>]
+// as subprotocols
+func (h *Handlers) TailRuntimeLogs(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+
+	if h.logPersistence == nil || h.deploymentRepo == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Log tailing is not available")
+		return
+	}
+
+	params := r.URL.Query()
+	tail := defaultLogTailLines
+	if raw := params.Get("tail"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > maxLogTailLines {
+			h.writeError(w, http.StatusBadRequest, "tail must be between 0 and 1000")
+			return
+		}
+		tail = n
+	}
+
+	var since time.Time
+	if raw := params.Get("since"); raw != "" {
+		if parsed, err := time.Parse(time.RFC3339, raw); err == nil {
+			since = parsed
+		} else if age, err := time.ParseDuration(raw); err == nil && age > 0 {
+			since = time.Now().Add(-age)
+		} else {
+			h.writeError(w, http.StatusBadRequest, "since must be an RFC 3339 time or a duration such as 10m")
+			return
+		}
+	}
+
+	levels, err := parseLogLevels(params.Get("level"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	follow := true
+	if raw := params.Get("follow"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, "follow must be true or false")
+			return
+		}
+		follow = parsed
+	}
+
+	deploymentID, containerID, err := h.deploymentRepo.GetCurrentContainer(r.Context(), appID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App has no running container")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to get the app's container")
+		return
+	}
+
+	conn, err := logTailUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // The upgrader has answered the request
+	}
+	defer conn.Close()
+
+	// The request context ends with the router's request timeout; the socket lives until a side closes it
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	defer cancel()
+	go readLogTailControl(conn, cancel)
+
+	t := &runtimeLogTail{
+		h:            h,
+		conn:         conn,
+		appID:        appID,
+		deploymentID: deploymentID,
+		containerID:  containerID,
+		since:        since,
+		levels:       levels,
+	}
+	defer t.closeReader()
+	t.run(ctx, tail, follow)
+}
+
+// readLogTailControl discards what the client sends, moving the read deadline on with its pongs, and
+// cancels the tail once the client goes away
+func readLogTailControl(conn *websocket.Conn, cancel context.CancelFunc) {
+	defer cancel()
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(logTailPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(logTailPongWait))
+	})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// runtimeLogTail sends the lines of the app's running container to one socket
+type runtimeLogTail struct {
+	h            *Handlers
+	conn         *websocket.Conn
+	appID        string
+	deploymentID string
+	containerID  string
+	since        time.Time                  // Lines logged before are left out (none when zero)
+	levels       []string                   // Only lines of these levels are sent (all when empty)
+	reader       *services.RuntimeLogReader // nil until the deploy worker has written the container's log
+}
+
+// run sends the last lines of the log, then new ones as they are persisted until ctx ends
+func (t *runtimeLogTail) run(ctx context.Context, tail int, follow bool) {
+	if t.send(RuntimeLogFrame{Type: "container", ContainerID: t.containerID, DeploymentID: t.deploymentID}) != nil {
+		return
+	}
+	if !t.openReader(ctx) && !follow {
+		t.close(websocket.CloseNormalClosure)
+		return
+	}
+	if t.reader != nil {
+		lines, err := t.reader.Tail(tail, t.since, t.levels)
+		if err != nil || t.sendLines(lines) != nil {
+			t.fail(err)
+			return
+		}
+	}
+	if !follow {
+		t.close(websocket.CloseNormalClosure)
+		return
+	}
+
+	poll := time.NewTicker(logTailPollInterval)
+	defer poll.Stop()
+	resolve := time.NewTicker(logTailResolveInterval)
+	defer resolve.Stop()
+	ping := time.NewTicker(logTailPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ping.C:
+			if t.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(logTailWriteWait)) != nil {
+				return
+			}
+		case <-resolve.C:
+			deploymentID, containerID, err := t.h.deploymentRepo.GetCurrentContainer(ctx, t.appID)
+			if err != nil || containerID == t.containerID {
+				continue // Between deploys the app briefly has no running container; keep the old log
+			}
+			// Lines the old container wrote last go out before the switch
+			if t.reader != nil {
+				lines, err := t.reader.Next()
+				if err != nil || t.sendLines(lines) != nil {
+					t.fail(err)
+					return
+				}
+				t.closeReader()
+			}
+			t.deploymentID, t.containerID = deploymentID, containerID
+			if t.send(RuntimeLogFrame{Type: "container", ContainerID: containerID, DeploymentID: deploymentID}) != nil {
+				return
+			}
+		case <-poll.C:
+			if t.reader == nil && !t.openReader(ctx) {
+				continue
+			}
+			lines, err := t.reader.Next()
+			if err != nil || t.sendLines(lines) != nil {
+				t.fail(err)
+				return
+			}
+		}
+	}
+}
+
+// openReader opens the container's log, reporting whether it exists yet
+func (t *runtimeLogTail) openReader(ctx context.Context) bool {
+	reader, err := t.h.logPersistence.OpenRuntimeLog(ctx, t.appID, t.containerID)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			t.h.logger.Warn("Failed to open runtime log", zap.Error(err), zap.String("app_id", t.appID), zap.String("container_id", t.containerID))
+		}
+		return false
+	}
+	t.reader = reader
+	return true
+}
+
+func (t *runtimeLogTail) closeReader() {
+	if t.reader != nil {
+		t.reader.Close()
+		t.reader = nil
+	}
+}
+
+// sendLines sends the lines the tail selects as log frames
+func (t *runtimeLogTail) sendLines(lines []services.RuntimeLogLine) error {
+	for _, line := range lines {
+		if !line.Selected(t.since, t.levels) {
+			continue
+		}
+		err := t.send(RuntimeLogFrame{
+			Type:      "log",
+			Stream:    line.Stream,
+			Timestamp: line.Timestamp.Format(time.RFC3339Nano),
+			Level:     line.Level,
+			Line:      line.Line,
+			Message:   line.Message,
+			Fields:    line.Fields,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *runtimeLogTail) send(frame RuntimeLogFrame) error {
+	t.conn.SetWriteDeadline(time.Now().Add(logTailWriteWait))
+	return t.conn.WriteJSON(frame)
+}
+
+// fail tells the client the log could not be read (err is nil when the client is gone) and closes the socket
+func (t *runtimeLogTail) fail(err error) {
+	if err == nil {
+		return
+	}
+	t.h.logger.Warn("Failed to tail runtime log", zap.Error(err), zap.String("app_id", t.appID), zap.String("container_id", t.containerID))
+	if t.send(RuntimeLogFrame{Type: "error", Message: "Failed to read the runtime log"}) == nil {
+		t.close(websocket.CloseInternalServerErr)
+	}
+}
+
+// close starts the closing handshake; the read loop ends once the client answers
+func (t *runtimeLogTail) close(code int) {
+	t.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(logTailWriteWait))
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckLogTailOrigin(t *testing.T) {
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"https://console.stackyn.com", true},
+		{"https://staging.stackyn.com", true},
+		{"http://localhost:5173", true},
+		{"https://evil.example.com", false},
+		{"https://stackyn.com.evil.example.com", false},
+		{"https://notstackyn.com", false},
+		{"http://localhost:8080", false},
+		{"null", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/apps/app-1/logs/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := checkLogTailOrigin(r); got != tt.want {
+				t.Errorf("checkLogTailOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
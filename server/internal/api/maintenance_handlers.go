@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// CreateMaintenanceWindowRequest is the body for POST /admin/maintenance
+type CreateMaintenanceWindowRequest struct {
+	Title       string   `json:"title" validate:"notblank,max=200"`
+	Description string   `json:"description"`
+	Nodes       []string `json:"nodes"`                         // Affected nodes (NODE_NAME of the deploy workers)
+	Regions     []string `json:"regions"`                       // Affected regions (NODE_REGION of the deploy workers)
+	StartsAt    string   `json:"starts_at" validate:"required"` // RFC3339
+	EndsAt      string   `json:"ends_at" validate:"required"`   // RFC3339
+}
+
+// MaintenanceHandlers schedules platform maintenance and serves app activity feeds
+type MaintenanceHandlers struct {
+	logger          *zap.Logger
+	appRepo         *AppRepo
+	maintenanceRepo *MaintenanceRepo
+}
+
+// NewMaintenanceHandlers creates a new maintenance handlers instance
+func NewMaintenanceHandlers(logger *zap.Logger, appRepo *AppRepo, maintenanceRepo *MaintenanceRepo) *MaintenanceHandlers {
+	return &MaintenanceHandlers{
+		logger:          logger,
+		appRepo:         appRepo,
+		maintenanceRepo: maintenanceRepo,
+	}
+}
+
+// POST /admin/maintenance - Schedule maintenance for nodes and/or regions
+// Owners of apps running there are notified in their own timezone shortly after
+func (h *MaintenanceHandlers) AdminCreateMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	var req CreateMaintenanceWindowRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	req.Title = strings.TrimSpace(req.Title)
+	nodes := compactStrings(req.Nodes)
+	regions := compactStrings(req.Regions)
+	if len(nodes) == 0 && len(regions) == 0 {
+		h.writeError(w, http.StatusBadRequest, "At least one node or region is required")
+		return
+	}
+
+	startsAt, err := time.Parse(time.RFC3339, req.StartsAt)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "starts_at must be an RFC3339 timestamp")
+		return
+	}
+	endsAt, err := time.Parse(time.RFC3339, req.EndsAt)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "ends_at must be an RFC3339 timestamp")
+		return
+	}
+	if !endsAt.After(startsAt) {
+		h.writeError(w, http.StatusBadRequest, "ends_at must be after starts_at")
+		return
+	}
+	if !endsAt.After(time.Now()) {
+		h.writeError(w, http.StatusBadRequest, "Maintenance window is already over")
+		return
+	}
+
+	window, err := h.maintenanceRepo.CreateMaintenanceWindow(r.Context(), userID, req.Title, strings.TrimSpace(req.Description), nodes, regions, startsAt, endsAt)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to schedule maintenance")
+		return
+	}
+
+	h.logger.Info("Maintenance scheduled",
+		zap.String("maintenance_id", window.ID),
+		zap.Strings("nodes", nodes),
+		zap.Strings("regions", regions),
+		zap.Time("starts_at", startsAt),
+		zap.Time("ends_at", endsAt),
+	)
+	h.writeJSON(w, http.StatusCreated, window)
+}
+
+// GET /admin/maintenance - List scheduled maintenance windows
+func (h *MaintenanceHandlers) AdminListMaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	windows, err := h.maintenanceRepo.ListMaintenanceWindows(r.Context())
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to list maintenance windows")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, windows)
+}
+
+// GET /api/v1/apps/{id}/activity - Get the app's activity feed, newest first
+func (h *MaintenanceHandlers) GetAppActivity(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	if _, err := h.appRepo.GetAppByID(appID, userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+
+	activity, err := h.maintenanceRepo.GetAppActivity(r.Context(), appID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app activity")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, activity)
+}
+
+// compactStrings trims the values and drops empty ones
+func compactStrings(values []string) []string {
+	compacted := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			compacted = append(compacted, value)
+		}
+	}
+	return compacted
+}
+
+func (h *MaintenanceHandlers) getUserIDFromContext(r *http.Request) string {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		h.logger.Warn("User ID not found in context")
+		return ""
+	}
+	return userID
+}
+
+func (h *MaintenanceHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *MaintenanceHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
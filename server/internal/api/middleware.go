@@ -2,12 +2,17 @@ package api
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 	"stackyn/server/internal/services"
 )
@@ -19,16 +24,14 @@ func AuthMiddleware(jwtService *services.JWTService, logger *zap.Logger) func(ht
 			// Get token from Authorization header
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				w.WriteHeader(http.StatusUnauthorized)
-				w.Write([]byte(`{"error":"Authorization header required"}`))
+				writeAPIError(w, http.StatusUnauthorized, "", "Authorization header required", nil)
 				return
 			}
 
 			// Extract token from "Bearer <token>"
 			parts := strings.Split(authHeader, " ")
 			if len(parts) != 2 || parts[0] != "Bearer" {
-				w.WriteHeader(http.StatusUnauthorized)
-				w.Write([]byte(`{"error":"Invalid authorization header format"}`))
+				writeAPIError(w, http.StatusUnauthorized, "", "Invalid authorization header format", nil)
 				return
 			}
 
@@ -38,8 +41,13 @@ func AuthMiddleware(jwtService *services.JWTService, logger *zap.Logger) func(ht
 			claims, err := jwtService.ValidateToken(token)
 			if err != nil {
 				logger.Warn("JWT token validation failed", zap.Error(err))
-				w.WriteHeader(http.StatusUnauthorized)
-				w.Write([]byte(`{"error":"Invalid or expired token"}`))
+				writeAPIError(w, http.StatusUnauthorized, "", "Invalid or expired token", nil)
+				return
+			}
+
+			// Impersonation tokens are only honoured by ImpersonationMiddleware, which audits every request
+			if claims.ImpersonationID != "" {
+				writeAPIError(w, http.StatusUnauthorized, "", "Impersonation tokens are not accepted here", nil)
 				return
 			}
 
@@ -51,6 +59,161 @@ func AuthMiddleware(jwtService *services.JWTService, logger *zap.Logger) func(ht
 	}
 }
 
+// PeerAddrMiddleware records the TCP peer address before middleware.RealIP rewrites RemoteAddr
+// Header auth uses it to check that identity headers come from a trusted proxy
+func PeerAddrMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "peer_addr", r.RemoteAddr)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// limitedBody is a request body MaxBodyBytes capped, which keeps the original so a route can allow more
+type limitedBody struct {
+	io.ReadCloser
+	raw io.ReadCloser
+}
+
+// websocketBearerProtocol is the subprotocol browsers offer before their token on WebSocket handshakes:
+// new WebSocket(url, ["stackyn.bearer", token])
+const websocketBearerProtocol = "stackyn.bearer"
+
+// WebSocketAuthMiddleware moves the token of a WebSocket handshake offered as subprotocol (browsers cannot
+// set headers on them) into the Authorization header, where the auth middleware looks for it
+func WebSocketAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" && websocket.IsWebSocketUpgrade(r) {
+			protocols := websocket.Subprotocols(r)
+			for i := 0; i+1 < len(protocols); i++ {
+				if protocols[i] == websocketBearerProtocol {
+					r.Header.Set("Authorization", "Bearer "+protocols[i+1])
+					break
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// MaxBodyBytes caps request bodies at limit bytes: reading past it fails with *http.MaxBytesError, which
+// decodeJSON answers with 413. Applied again on a route, it replaces the limit the router set
+func MaxBodyBytes(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body != nil && r.Body != http.NoBody {
+				raw := r.Body
+				if limited, ok := raw.(*limitedBody); ok {
+					raw = limited.raw
+				}
+				r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, raw, limit), raw: raw}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UserProvisioner resolves the user for an identity asserted by an auth proxy, creating it on first sight
+type UserProvisioner interface {
+	GetOrProvisionUser(ctx context.Context, email, fullName, locale string) (*User, error)
+}
+
+// HeaderAuthConfig configures HeaderAuthMiddleware
+type HeaderAuthConfig struct {
+	EmailHeader    string       // e.g. X-Auth-Request-Email (oauth2-proxy) or Remote-Email (Authelia)
+	NameHeader     string       // Optional display name header used when provisioning
+	TrustedProxies []*net.IPNet // Peers allowed to assert identity; empty trusts none
+}
+
+// ParseTrustedProxies parses CIDRs or bare IPs into networks
+func ParseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipNet)
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: must be an IP or CIDR", entry)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+		nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return nets, nil
+}
+
+// isTrustedPeer checks the request's TCP peer (captured by PeerAddrMiddleware) against the trusted proxies
+func (c HeaderAuthConfig) isTrustedPeer(r *http.Request) bool {
+	addr, ok := r.Context().Value("peer_addr").(string)
+	if !ok || addr == "" {
+		addr = r.RemoteAddr
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, trusted := range c.TrustedProxies {
+		if trusted.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// HeaderAuthMiddleware authenticates requests using an identity header set by an upstream auth proxy
+// (oauth2-proxy, Authelia, ...). Users are provisioned on first request. Adds the same context
+// values as AuthMiddleware so handlers are unaware of the auth mode
+func HeaderAuthMiddleware(provisioner UserProvisioner, config HeaderAuthConfig, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !config.isTrustedPeer(r) {
+				logger.Warn("Identity header from untrusted peer rejected",
+					zap.String("peer_addr", fmt.Sprint(r.Context().Value("peer_addr"))),
+					zap.String("path", r.URL.Path),
+				)
+				writeAPIError(w, http.StatusUnauthorized, "", "Request did not come through the authentication proxy", nil)
+				return
+			}
+
+			email := strings.ToLower(strings.TrimSpace(r.Header.Get(config.EmailHeader)))
+			if email == "" {
+				writeAPIError(w, http.StatusUnauthorized, "", "Authentication required", nil)
+				return
+			}
+			if !ValidateEmail(email) {
+				logger.Warn("Invalid email in identity header", zap.String("header", config.EmailHeader), zap.String("email", email))
+				writeAPIError(w, http.StatusUnauthorized, "", "Invalid identity header", nil)
+				return
+			}
+
+			var fullName string
+			if config.NameHeader != "" {
+				fullName = strings.TrimSpace(r.Header.Get(config.NameHeader))
+			}
+
+			user, err := provisioner.GetOrProvisionUser(r.Context(), email, fullName, services.LocaleFromAcceptLanguage(r.Header.Get("Accept-Language")))
+			if err != nil {
+				logger.Error("Failed to resolve user from identity header", zap.Error(err), zap.String("email", email))
+				writeAPIError(w, http.StatusInternalServerError, "", "Failed to authenticate user", nil)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "user_id", user.ID)
+			ctx = context.WithValue(ctx, "user_email", user.Email)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 // RequireActiveBilling checks if a user has active billing (trial or active subscription)
 // Returns error if billing is inactive
 func RequireActiveBilling(user *User) error {
@@ -80,8 +243,28 @@ func RequireActiveBilling(user *User) error {
 	return errors.New("billing inactive. Upgrade to continue")
 }
 
+// RequireWritableBilling allows read-only requests during a payment grace period
+// Apps keep running while billing_status is "grace", but deploys, scaling and env changes are blocked
+func RequireWritableBilling(user *User, method string) error {
+	if user == nil || user.BillingStatus != "grace" {
+		return RequireActiveBilling(user)
+	}
+
+	if user.GraceEndsAt == nil || time.Now().After(*user.GraceEndsAt) {
+		return errors.New("billing inactive. Update your payment method to continue")
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	return fmt.Errorf("your last payment failed, so your account is read-only until %s. Your apps keep running, but deploys and configuration changes are paused. Update your payment method to continue", user.GraceEndsAt.Format(time.RFC1123))
+}
+
 // BillingMiddleware enforces active billing for protected endpoints
 // Must be used after AuthMiddleware (requires user_id in context)
+// On app routes it must also run after AppAccessMiddleware so org apps check the owner's billing
 func BillingMiddleware(userRepo *UserRepo, logger *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -89,32 +272,31 @@ func BillingMiddleware(userRepo *UserRepo, logger *zap.Logger) func(http.Handler
 			userID, ok := r.Context().Value("user_id").(string)
 			if !ok || userID == "" {
 				logger.Error("BillingMiddleware: user_id not found in context")
-				w.WriteHeader(http.StatusUnauthorized)
-				json.NewEncoder(w).Encode(map[string]string{"error": "User not authenticated"})
+				writeAPIError(w, http.StatusUnauthorized, "", "User not authenticated", nil)
 				return
 			}
 
+			// Org apps are billed to the organization owner (set by AppAccessMiddleware)
+			if billingUserID, ok := r.Context().Value("billing_user_id").(string); ok && billingUserID != "" {
+				userID = billingUserID
+			}
+
 			// Get user with billing info
 			user, err := userRepo.GetUserByID(userID)
 			if err != nil {
 				logger.Error("BillingMiddleware: failed to get user", zap.Error(err), zap.String("user_id", userID))
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(map[string]string{"error": "Failed to verify billing status"})
+				writeAPIError(w, http.StatusInternalServerError, "", "Failed to verify billing status", nil)
 				return
 			}
 
-			// Check billing status
-			if err := RequireActiveBilling(user); err != nil {
+			// Check billing status (read-only requests are allowed during a payment grace period)
+			if err := RequireWritableBilling(user, r.Method); err != nil {
 				logger.Info("BillingMiddleware: billing check failed",
 					zap.String("user_id", userID),
 					zap.String("billing_status", user.BillingStatus),
 					zap.Error(err),
 				)
-				w.WriteHeader(http.StatusPaymentRequired)
-				json.NewEncoder(w).Encode(map[string]string{
-					"error":         err.Error(),
-					"billing_status": user.BillingStatus,
-				})
+				writeAPIError(w, http.StatusPaymentRequired, "", err.Error(), map[string]string{"billing_status": user.BillingStatus})
 				return
 			}
 
@@ -123,3 +305,93 @@ func BillingMiddleware(userRepo *UserRepo, logger *zap.Logger) func(http.Handler
 		})
 	}
 }
+
+// AppAccessMiddleware authorizes /api/v1/apps/{id} routes by ownership or organization membership
+// Must be used after AuthMiddleware and inside a route that defines the {id} URL param
+// Viewers may only read; members and above may also deploy and change configuration
+// Sets "app_role" and "billing_user_id" (the app owner) in the request context
+func AppAccessMiddleware(orgRepo *OrganizationRepo, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := r.Context().Value("user_id").(string)
+			if !ok || userID == "" {
+				logger.Error("AppAccessMiddleware: user_id not found in context")
+				writeAPIError(w, http.StatusUnauthorized, "", "User not authenticated", nil)
+				return
+			}
+
+			appID := chi.URLParam(r, "id")
+			role, ownerID, err := orgRepo.GetAppAccess(r.Context(), appID, userID)
+			if err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					// Same response as a missing app - don't reveal apps in other organizations
+					writeAPIError(w, http.StatusNotFound, "", "App not found", nil)
+					return
+				}
+				logger.Error("AppAccessMiddleware: failed to resolve app access", zap.Error(err), zap.String("app_id", appID), zap.String("user_id", userID))
+				writeAPIError(w, http.StatusInternalServerError, "", "Failed to verify app access", nil)
+				return
+			}
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				if !HasOrgRole(role, OrgRoleMember) {
+					logger.Info("AppAccessMiddleware: write denied",
+						zap.String("app_id", appID),
+						zap.String("user_id", userID),
+						zap.String("role", role),
+					)
+					writeAPIError(w, http.StatusForbidden, "", "Your role in this organization is read-only", nil)
+					return
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), "app_role", role)
+			ctx = context.WithValue(ctx, "billing_user_id", ownerID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// appAccessResolver looks up a user's role on an app (OrganizationRepo)
+type appAccessResolver interface {
+	GetAppAccess(ctx context.Context, appID, userID string) (role, ownerID string, err error)
+}
+
+// appWriteAccess applies AppAccessMiddleware's write check for routes outside /apps/{id}: the user needs at
+// least OrgRoleMember on the app. Returns the app's owner, or the status and message to refuse with (err is
+// set when the lookup itself failed)
+func appWriteAccess(ctx context.Context, access appAccessResolver, appID, userID string) (ownerID string, status int, message string, err error) {
+	role, ownerID, err := access.GetAppAccess(ctx, appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", http.StatusNotFound, "Deployment not found or access denied", nil
+		}
+		return "", http.StatusInternalServerError, "Failed to verify deployment access", err
+	}
+	if !HasOrgRole(role, OrgRoleMember) {
+		return "", http.StatusForbidden, "Your role in this organization is read-only", nil
+	}
+	return ownerID, 0, "", nil
+}
+
+// RequireAppRole restricts a route to users with at least the given role on the app
+// Must be used after AppAccessMiddleware
+func RequireAppRole(minRole string, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, _ := r.Context().Value("app_role").(string)
+			if !HasOrgRole(role, minRole) {
+				logger.Info("RequireAppRole: insufficient role",
+					zap.String("role", role),
+					zap.String("required", minRole),
+					zap.String("path", r.URL.Path),
+				)
+				writeAPIError(w, http.StatusForbidden, "", fmt.Sprintf("This action requires the %s role", minRole), nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
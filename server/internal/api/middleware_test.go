@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// fakeAppAccess resolves every app to role, owned by owner-1 (err instead, when set)
+type fakeAppAccess struct {
+	role string
+	err  error
+}
+
+func (f fakeAppAccess) GetAppAccess(ctx context.Context, appID, userID string) (string, string, error) {
+	if f.err != nil {
+		return "", "", f.err
+	}
+	return f.role, "owner-1", nil
+}
+
+func TestAppWriteAccess(t *testing.T) {
+	tests := []struct {
+		name       string
+		access     fakeAppAccess
+		wantStatus int
+		wantErr    bool
+	}{
+		{"owner", fakeAppAccess{role: OrgRoleOwner}, 0, false},
+		{"org admin", fakeAppAccess{role: OrgRoleAdmin}, 0, false},
+		{"org member", fakeAppAccess{role: OrgRoleMember}, 0, false},
+		{"org viewer", fakeAppAccess{role: OrgRoleViewer}, http.StatusForbidden, false},
+		{"unknown role", fakeAppAccess{role: "guest"}, http.StatusForbidden, false},
+		{"no access", fakeAppAccess{err: pgx.ErrNoRows}, http.StatusNotFound, false},
+		{"lookup failure", fakeAppAccess{err: errors.New("connection refused")}, http.StatusInternalServerError, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ownerID, status, message, err := appWriteAccess(context.Background(), tt.access, "app-1", "user-1")
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if status == 0 && ownerID != "owner-1" {
+				t.Errorf("ownerID = %q, want owner-1", ownerID)
+			}
+			if status != 0 && (ownerID != "" || message == "") {
+				t.Errorf("refused with ownerID %q and message %q", ownerID, message)
+			}
+		})
+	}
+}
@@ -0,0 +1,596 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/services"
+)
+
+// openAPIOperation documents the request and response bodies of one route
+// Routes without an entry are still listed, with a summary derived from the handler name
+type openAPIOperation struct {
+	Request     interface{} // Zero value of the JSON request body type (nil when there is no body)
+	Response    interface{} // Zero value of the JSON response body type (nil when there is no body)
+	Status      int         // Success status (defaults to 200, or 204 without a response body)
+	Description string
+	Idempotent  bool // Accepts an Idempotency-Key header (IdempotencyMiddleware)
+}
+
+// openAPIOperations are keyed by "METHOD /path", with chi path parameters and no trailing slash
+var openAPIOperations = map[string]openAPIOperation{
+	// Auth
+	"POST /api/auth/signup":          {Request: SignupRequest{}, Response: SignupResponse{}, Description: "Starts an email+password signup by emailing a verification code. The account and its trial are created when the code is verified at /api/auth/verify-otp. 409 if the email already has an account."},
+	"POST /api/auth/send-otp":        {Request: SendOTPRequest{}, Response: SendOTPResponse{}, Description: "Emails a one-time sign-in code. Emails are written in the account's locale, or the Accept-Language of a new signup."},
+	"POST /api/auth/verify-otp":      {Request: VerifyOTPRequest{}, Response: VerifyOTPResponse{}, Description: "Verifies a sign-in or signup code and returns a session token, creating the account (with a trial) on first sign-in. A code is used up after 5 wrong guesses (429)."},
+	"POST /api/auth/login":           {Request: LoginRequest{}, Response: LoginResponse{}},
+	"POST /api/auth/forgot-password": {Request: ForgotPasswordRequest{}, Response: ForgotPasswordResponse{}},
+	"POST /api/auth/reset-password":  {Request: ResetPasswordRequest{}, Response: ResetPasswordResponse{}},
+	"POST /api/auth/update-profile":  {Request: UpdateUserRequest{}, Response: User{}},
+	"GET /health":                    {Response: HealthResponse{}},
+
+	// User
+	"GET /api/user/me":                 {Response: UserProfile{}, Description: "The signed-in user with their plan, quota and subscription."},
+	"PATCH /api/user/me":               {Request: UpdateProfileRequest{}, Response: UserProfile{}, Description: "Partial update - omitted fields are left unchanged."},
+	"GET /api/user/me/notifications":   {Response: NotificationSettings{}},
+	"PATCH /api/user/me/notifications": {Request: UpdateNotificationSettingsRequest{}, Response: NotificationSettings{}},
+	"GET /api/v1/usage":                {Response: services.UsageSummary{}},
+	"GET /api/v1/usage/build-minutes":  {Response: services.BuildMinutesUsage{}},
+	"GET /api/v1/tokens":               {Response: []APIToken{}},
+	"POST /api/v1/tokens":              {Request: CreateAPITokenRequest{}, Response: CreateAPITokenResponse{}, Status: http.StatusCreated, Idempotent: true, Description: "The token value is only returned in this response."},
+	"GET /api/v1/audit":                {Response: []AuditEntry{}, Description: "Audit log entries about your account (sign-ins, tokens, env var changes, deletions, plan changes, support access), newest first. Filter with ?action= (exact or a prefix such as auth.*) and ?since=/?until= (RFC 3339)."},
+	"GET /api/v1/exports":              {Response: []AppExport{}},
+	"GET /api/v1/exports/{exportId}":   {Response: AppExport{}},
+
+	// Apps
+	"GET /api/v1/apps":                                      {Response: []App{}},
+	"GET /api/v1/templates":                                 {Response: []services.AppTemplate{}},
+	"GET /api/v1/templates/from-repo":                       {Response: services.AppJSON{}, Description: "Reads the env vars and add-ons the repository (repo_url, branch and root_dir query parameters) declares in its stackyn.json or, failing that, app.json, in the app.json format. 404 when it has neither."},
+	"POST /api/v1/templates/{id}/deploy":                    {Request: DeployTemplateRequest{}, Response: DeployTemplateResponse{}, Status: http.StatusCreated, Idempotent: true, Description: "Creates an app from the template and queues its first build. Env vars without a supplied value get their generated (secret) or default value; a required one without any value is a 400. Add-ons are not provisioned - supply their URLs as env vars."},
+	"POST /api/v1/apps/import":                              {Request: ImportAppRequest{}, Response: ImportAppResponse{}, Status: http.StatusCreated, Idempotent: true, Description: "Creates an app from a stackyn.yaml manifest (see GET /api/v1/apps/{id}/manifest) and queues its first deployment. The body is the manifest as YAML, or this JSON object when env var values are supplied. Env keys without a value are listed in missing_env; domains are added unverified."},
+	"GET /api/v1/apps/{id}/manifest":                        {Description: "Returns the app as a stackyn.yaml manifest (application/yaml): source, build settings, resources, env var keys without values, domains and cron jobs."},
+	"POST /api/v1/apps":                                     {Request: CreateAppRequest{}, Response: CreateAppResponse{}, Status: http.StatusCreated, Idempotent: true, Description: "Creates the app and queues its first build."},
+	"GET /api/v1/apps/{id}":                                 {Response: App{}},
+	"POST /api/v1/apps/{id}/redeploy":                       {Request: RedeployRequest{}, Response: CreateAppResponse{}, Idempotent: true, Description: "The body is optional; a ref (branch, tag or commit SHA) deploys that once instead of the app's branch head. Unknown refs return 422."},
+	"POST /api/v1/apps/{id}/rollback":                       {Request: RollbackRequest{}, Response: CreateAppResponse{}, Idempotent: true, Description: "The body is optional; without it the app rolls back to the previous successful deployment."},
+	"GET /api/v1/apps/{id}/deployments/{a}/compare/{b}":     {Response: DeploymentComparison{}, Description: "Commit range, env var changes (keys only) and config changes from deployment {a} to deployment {b}."},
+	"POST /api/v1/apps/{id}/restart":                        {Response: CreateAppResponse{}, Idempotent: true},
+	"POST /api/v1/apps/{id}/stop":                           {Response: AppPowerResponse{}, Status: http.StatusAccepted, Idempotent: true, Description: "Stops a running, sleeping or failed app's containers without removing them; its RAM stops counting against the plan. The app is stopping until the deploy worker is done, then stopped. 409 while it is deploying or being stopped or started."},
+	"POST /api/v1/apps/{id}/start":                          {Response: AppPowerResponse{}, Status: http.StatusAccepted, Idempotent: true, Description: "Starts a stopped app's containers again with the image and env vars it was stopped with. The app is starting until the deploy worker is done, then running. 409 unless the app is stopped; 403 PLAN_LIMIT_EXCEEDED when its RAM no longer fits in the plan."},
+	"GET /api/v1/apps/{id}/deployments":                     {Response: []Deployment{}},
+	"GET /api/v1/apps/{id}/env":                             {Response: []EnvVar{}},
+	"POST /api/v1/apps/{id}/env":                            {Request: CreateEnvVarRequest{}, Response: EnvVar{}, Status: http.StatusCreated},
+	"POST /api/v1/apps/{id}/env/bulk":                       {Response: BulkEnvVarResponse{}, Description: "Imports a .env file (KEY=value lines) sent as the request body."},
+	"PUT /api/v1/apps/{id}/env/{key}":                       {Request: UpdateEnvVarRequest{}, Response: EnvVar{}},
+	"GET /api/v1/apps/{id}/metrics":                         {Response: AppMetrics{}},
+	"GET /api/v1/apps/{id}/events":                          {Response: []DeploymentEvent{}, Description: "The steps the app's deploys went through, oldest first: build_queued, build_started, clone_finished, image_built, build_failed, container_started, route_switched, deploy_failed, health_check_passed, health_check_failed, crashed, restarted, stopped, started. ?build_job_id= or ?deployment_id= for one deploy, ?before=<event id> for older events, ?limit= (default 50, max 100)."},
+	"GET /api/v1/apps/{id}/traffic":                         {Response: AppTraffic{}, Description: "Requests/sec, p95 latency, status classes and egress bytes from Traefik's access log. ?window=1h|6h|24h|7d|30d (default 24h)."},
+	"GET /api/v1/apps/{id}/presence":                        {Response: AppPresence{}},
+	"PUT /api/v1/apps/{id}/health-check":                    {Request: UpdateHealthCheckRequest{}},
+	"PUT /api/v1/apps/{id}/image":                           {Request: UpdateAppImageRequest{}, Response: App{}},
+	"GET /api/v1/apps/{id}/base-image":                      {Response: BaseImageStatus{}},
+	"PUT /api/v1/apps/{id}/base-image":                      {Request: UpdateBaseImageRequest{}, Response: BaseImageStatus{}},
+	"GET /api/v1/apps/{id}/processes":                       {Response: []AppProcess{}, Description: "Non-web entries of the Procfile of the app's latest build."},
+	"PUT /api/v1/apps/{id}/processes/{name}":                {Request: UpdateAppProcessRequest{}, Response: AppProcess{}, Description: "Enabling requires a plan with workers. The running deployment is redeployed so its worker containers match."},
+	"GET /api/v1/apps/{id}/release-command":                 {Response: ReleaseCommandSettings{}},
+	"GET /api/v1/apps/{id}/secret-scan":                     {Response: SecretScanSettings{}},
+	"PUT /api/v1/apps/{id}/secret-scan":                     {Request: SecretScanSettings{}, Response: SecretScanSettings{}, Description: "What builds do about credentials committed to the source (AWS keys, private keys, API tokens, high-entropy secrets): warn (default) writes the redacted findings to the build log, block fails the build with SECRETS_DETECTED before the image is built, off skips the scan. A line containing stackyn:allow-secret is never reported. Takes effect on the next build."},
+	"GET /api/v1/apps/{id}/build-strategy":                  {Response: BuildStrategySettings{}},
+	"PUT /api/v1/apps/{id}/build-strategy":                  {Request: BuildStrategySettings{}, Response: BuildStrategySettings{}, Description: "dockerfile builds the repo's Dockerfile, or one generated for the detected runtime; buildpacks builds the source with Cloud Native Buildpacks and nixpacks with Nixpacks, both ignoring any Dockerfile. A nixpacks app whose source Nixpacks cannot plan is built from a Dockerfile when it has one or a supported runtime. Takes effect on the next build; deployments report the strategy that built their image."},
+	"GET /api/v1/apps/{id}/deploy-hook":                     {Response: DeployHookSettings{}},
+	"POST /api/v1/apps/{id}/deploy-hook":                    {Response: DeployHookSettings{}, Description: "Generates the secret that GitLab (secret token) and Bitbucket (webhook secret) push webhooks to gitlab_url and bitbucket_url must use; pushes to the app's branch then build and deploy it, on plans with auto-deploy. Calling it again rotates the secret, which is only returned in this response."},
+	"DELETE /api/v1/apps/{id}/deploy-hook":                  {Response: DeployHookSettings{}},
+	"PUT /api/v1/apps/{id}/release-command":                 {Request: ReleaseCommandSettings{}, Response: ReleaseCommandSettings{}, Description: "The command runs in a one-off container of each new deployment's image before it takes traffic; a non-zero exit fails the deployment and the previous one stays live. An empty command removes it."},
+	"GET /api/v1/apps/{id}/isolation":                       {Response: AppIsolation{}, Description: "How tightly the app's containers are confined on the host: standard (Docker's defaults), hardened (no-new-privileges, seccomp, minimal capabilities, process limit) or strict (hardened plus a read-only root filesystem and the sandbox runtime). effective is the stricter of the app's and its plan's level."},
+	"PUT /api/v1/apps/{id}/isolation":                       {Request: UpdateIsolationRequest{}, Response: AppIsolation{}, Description: "Opts the app into a stricter level than its plan requires; levels below the plan's are refused and an empty level follows the plan. The running deployment is redeployed to apply it."},
+	"GET /api/v1/apps/{id}/logs/release":                    {Response: []LogEntry{}, Description: "Output of the release command, one entry per deploy attempt."},
+	"GET /api/v1/apps/{id}/logs/ws":                         {Response: RuntimeLogFrame{}, Status: http.StatusSwitchingProtocols, Description: "WebSocket tailing the runtime log of the app's running container; each message is one frame. A container frame comes first and whenever a redeploy replaces the container, then one log frame per line with its stream (stdout, stderr), timestamp and level, plus the message and fields of lines that are JSON objects. ?tail= lines are sent first (default 100, max 1000), ?since= (RFC 3339 or a duration such as 10m) leaves out older ones, ?follow=false closes the socket after them, ?level= (error, warn, info, debug, comma-separated) sends only lines of those levels. Browsers, which cannot set headers on WebSockets, authenticate by offering the subprotocols stackyn.bearer and their token."},
+	"GET /api/v1/apps/{id}/logs/search":                     {Response: []LogSearchLine{}, Description: "Build, runtime and release log lines, newest first. ?q= matches a case-insensitive substring, or a POSIX regex with ?regex=true; matches are returned split out in highlights. Lines that are JSON objects also carry their message and other fields. ?from= and ?to= (RFC 3339) bound the time range, ?level= (error, warn, info, debug, comma-separated; read from the level field of JSON lines, guessed from the text of others) and ?type= (build, runtime, release) narrow it. ?before=<line id> for older lines, ?limit= (default 100, max 500). Lines are kept for LOG_SEARCH_RETENTION_DAYS."},
+	"GET /api/v1/apps/{id}/domains":                         {Response: []AppDomainResponse{}},
+	"POST /api/v1/apps/{id}/domains":                        {Request: CreateDomainRequest{}, Response: AppDomainResponse{}, Status: http.StatusCreated, Idempotent: true},
+	"POST /api/v1/apps/{id}/domains/{domainId}/verify":      {Response: AppDomainResponse{}},
+	"GET /api/v1/apps/{id}/cron":                            {Response: []CronJob{}},
+	"POST /api/v1/apps/{id}/cron":                           {Request: CronJobRequest{}, Response: CronJob{}, Status: http.StatusCreated},
+	"PATCH /api/v1/apps/{id}/cron/{cronId}":                 {Request: CronJobRequest{}, Response: CronJob{}},
+	"POST /api/v1/apps/{id}/cron/{cronId}/run":              {Response: CronJobRun{}, Status: http.StatusAccepted},
+	"GET /api/v1/apps/{id}/cron/{cronId}/runs":              {Response: []CronJobRun{}},
+	"GET /api/v1/apps/{id}/cron/{cronId}/runs/{runId}":      {Response: CronJobRun{}},
+	"POST /api/v1/apps/{id}/exec":                           {Request: ExecRequest{}, Description: "Runs a one-off command in a temporary container of the app's running image with its env vars and streams the output as text/plain. The X-Exec-Run-Id header names the run; the X-Exec-Status, X-Exec-Exit-Code and X-Exec-Error trailers carry its outcome. Commands may run as long as the plan allows."},
+	"GET /api/v1/apps/{id}/exec/{runId}":                    {Response: ExecRun{}},
+	"GET /api/v1/apps/{id}/webhooks":                        {Response: []AppWebhook{}},
+	"POST /api/v1/apps/{id}/webhooks":                       {Request: AppWebhookRequest{}, Response: AppWebhook{}, Status: http.StatusCreated, Description: "The signing secret is only returned in this response."},
+	"PATCH /api/v1/apps/{id}/webhooks/{webhookId}":          {Request: AppWebhookRequest{}, Response: AppWebhook{}},
+	"GET /api/v1/apps/{id}/webhooks/{webhookId}/deliveries": {Response: []AppWebhookDelivery{}},
+	"GET /api/v1/apps/{id}/log-drains":                      {Response: []AppLogDrain{}, Description: "Each drain's health as the deploy worker last recorded it: status (pending, healthy, failing), the last error, when lines were last delivered and how many were dropped because the drain's buffer was full."},
+	"POST /api/v1/apps/{id}/log-drains":                     {Request: AppLogDrainRequest{}, Response: AppLogDrain{}, Status: http.StatusCreated, Description: "Ships the app's runtime logs to kind syslog (url syslog+tls://host:port, RFC 5424 over TLS), http (JSON arrays POSTed to an https url, token sent as a bearer token), loki (push API url, token as bearer or user:password basic auth) or datadog (token is the API key, url defaults to the US1 intake). Lines are buffered while an endpoint is slow or down and dropped once the buffer is full. At most 5 drains per app."},
+	"PATCH /api/v1/apps/{id}/log-drains/{drainId}":          {Request: AppLogDrainRequest{}, Response: AppLogDrain{}, Description: "A new url or token resets the drain's health to pending. The kind cannot change; an empty token removes it."},
+	"GET /api/v1/apps/{id}/transfer":                        {Response: AppTransfer{}, Description: "The app's pending transfer; 404 when there is none."},
+	"POST /api/v1/apps/{id}/transfer":                       {Request: AppTransferRequest{}, Response: AppTransfer{}, Status: http.StatusCreated, Description: "Offers the app to another Stackyn user (to_email) or an organization (to_organization_id). The app, with its deployments, env vars, domains and logs, moves when the recipient accepts within 7 days. Admins and owners only; 409 if a transfer is already pending."},
+	"POST /api/v1/apps/{id}/export":                         {Request: AppExportRequest{}, Response: AppExport{}, Status: http.StatusAccepted},
+	"GET /api/v1/apps/{id}/activity":                        {Response: []AppActivity{}},
+	"GET /api/v1/apps/{id}/waf":                             {Response: AppWAF{}},
+	"PUT /api/v1/apps/{id}/waf":                             {Request: UpdateWAFRequest{}, Response: AppWAF{}, Description: "Enables the WAF or changes its preset and mode. The running deployment is redeployed to apply it."},
+	"GET /api/v1/apps/{id}/routing":                         {Response: AppRouting{}, Description: "The app's edge options; apps that never changed them get the defaults (HTTPS forced, nothing else)."},
+	"PATCH /api/v1/apps/{id}/routing":                       {Request: UpdateRoutingRequest{}, Response: AppRouting{}, Description: "Changes the app's edge options: HTTPS redirect, brotli/gzip compression, request body limit, response headers, and the access rules (IP allowlist, basic auth - plans with access_rules only). Omitted fields are unchanged. The running deployment is redeployed to apply them."},
+	"GET /api/v1/apps/{id}/waf/hits":                        {Response: []WAFHit{}, Description: "Recent WAF rule matches, newest first. Filter with ?action=detected|blocked."},
+
+	// Git host push webhooks
+	"POST /api/v1/hooks/gitlab":    {Response: PushHookResponse{}, Status: http.StatusAccepted, Description: "GitLab push webhook. X-Gitlab-Token must be the deploy hook secret of an app on the pushed repository and branch; each such app is built and deployed. Tag pushes, branch deletions and other events are ignored. 401 when the token matches no app."},
+	"POST /api/v1/hooks/bitbucket": {Response: PushHookResponse{}, Status: http.StatusAccepted, Description: "Bitbucket Cloud push webhook (repo:push). X-Hub-Signature must be sha256=<HMAC-SHA256 of the body> keyed with the deploy hook secret of an app on a pushed repository and branch; each such app is built and deployed. 401 when the signature matches no app."},
+
+	// Traefik HTTP provider
+	"GET /api/v1/traefik/routes": {Description: "Traefik dynamic configuration (HTTP provider) forwarding the apps running on other hosts to those hosts' Traefik. ?node= is the polling host's NODE_NAME; X-Provider-Token must be TRAEFIK_PROVIDER_TOKEN. 503 when no token is configured."},
+
+	// Deployments
+	"GET /api/v1/deployments/{id}":                 {Response: Deployment{}, Description: "The deployment. A deployment whose container kept exiting has status crashed and the last lines it wrote to stderr in crash_log."},
+	"GET /api/v1/deployments/{id}/logs":            {Response: DeploymentLogs{}},
+	"GET /api/v1/deployments/{id}/queue":           {Response: DeploymentQueueStatus{}, Description: "Where the build stands in the build queues (position, builds ahead and running, worker slots) with an ETA from recent builds of the same runtime. {id} is a deployment ID, or the build_job_id of a build still in the queue."},
+	"GET /api/v1/deployments/{id}/vulnerabilities": {Response: DeploymentVulnerabilities{}, Description: "Known vulnerabilities in the deployment's image, most severe first, from the Trivy scan the build worker runs after each build. status is not_scanned for registry images and builds that were not scanned, and failed when the scanner could not run."},
+	"GET /api/v1/deployments/{id}/tasks":           {Response: []DeploymentTask{}, Description: "Build and deploy tasks of the deployment, oldest first, with their status (pending, processing, retrying, completed, failed), attempts and last error."},
+	"POST /api/v1/deployments/{id}/cancel":         {Response: Deployment{}, Description: "Cancels a queued or running build. {id} is a deployment ID, or the build_job_id of a build still in the queue."},
+
+	// Organizations
+	"POST /api/v1/orgs":                           {Request: CreateOrganizationRequest{}, Response: Organization{}, Status: http.StatusCreated},
+	"GET /api/v1/orgs":                            {Response: []Organization{}},
+	"GET /api/v1/orgs/{orgId}":                    {Response: Organization{}},
+	"GET /api/v1/orgs/{orgId}/apps":               {Response: []App{}},
+	"GET /api/v1/orgs/{orgId}/security-policy":    {Response: OrgSecurityPolicy{}},
+	"PUT /api/v1/orgs/{orgId}/security-policy":    {Request: OrgSecurityPolicy{}, Response: OrgSecurityPolicy{}, Description: "With block_critical_vulnerabilities, deploys of the organization's apps fail when their image's scan found critical vulnerabilities - including redeploys and rollbacks. Admins and the owner only."},
+	"GET /api/v1/orgs/{orgId}/members":            {Response: []OrganizationMember{}},
+	"PATCH /api/v1/orgs/{orgId}/members/{userId}": {Request: UpdateMemberRoleRequest{}},
+	"POST /api/v1/orgs/{orgId}/invitations":       {Request: CreateInvitationRequest{}, Response: OrganizationInvitation{}, Status: http.StatusCreated},
+	"GET /api/v1/orgs/{orgId}/invitations":        {Response: []OrganizationInvitation{}},
+	"POST /api/v1/invitations/{token}/accept":     {Response: Organization{}},
+
+	// App transfers
+	"GET /api/v1/transfers":                       {Response: []AppTransfer{}, Description: "Pending transfers to you, and to organizations you are an admin or owner of, newest first."},
+	"POST /api/v1/transfers/{transferId}/accept":  {Response: AppTransfer{}, Description: "Moves the app to you or your organization. The new owner's plan is checked again first: 403 when it has no room for the app (apps, RAM, custom domains, workers), 402 when its billing is not active, 409 when it already has an app of the same name."},
+	"POST /api/v1/transfers/{transferId}/decline": {Description: "Declines the transfer; the app stays with its current owner."},
+
+	// Admin
+	"GET /admin/maintenance":                         {Response: []MaintenanceWindow{}},
+	"POST /admin/cleanup":                            {Response: CleanupTriggerResponse{}, Status: http.StatusAccepted, Description: "Runs cleanup (old containers, images, build cache and temp files) on a cleanup worker now, even if one ran recently. Requests made while a run is queued or running share it."},
+	"GET /admin/hosts":                               {Response: []Host{}, Description: "Docker hosts running app containers with their CPU, memory, disk, containers and images as last reported by their deploy worker (every 30 seconds), the CPU and memory reserved by app containers, and whether they are drained."},
+	"POST /admin/hosts/{id}/drain":                   {Request: DrainHostRequest{}, Response: Host{}, Description: "Stops the host named {id} from taking new deploys; they wait in the queue for a host that is not drained. Running containers are left alone. The body is optional."},
+	"DELETE /admin/hosts/{id}/drain":                 {Response: Host{}, Description: "Lets a drained host take new deploys again."},
+	"POST /admin/maintenance":                        {Request: CreateMaintenanceWindowRequest{}, Response: MaintenanceWindow{}, Status: http.StatusCreated, Description: "Schedules maintenance for nodes and/or regions. Owners of apps running there are notified with the window in their own timezone."},
+	"POST /admin/users/{id}/impersonate":             {Request: ImpersonateRequest{}, Response: ImpersonateResponse{}, Status: http.StatusCreated, Description: "Admins only (ADMIN_EMAILS). Returns a short-lived token acting as the user; responses to it carry X-Impersonated-By and every request is audited."},
+	"DELETE /admin/impersonations/{id}":              {Response: ImpersonationSession{}, Description: "Ends an impersonation session before it expires. Admins only."},
+	"GET /api/billing/invoices":                      {Response: []services.Invoice{}, Description: "Billing history of the user's subscription from Lemon Squeezy, newest first. Cached for a few minutes; billing events refresh it."},
+	"POST /api/billing/change-plan":                  {Request: ChangePlanRequest{}, Response: ChangePlanResponse{}, Description: "Switches an active subscription to another plan in place. Upgrades are invoiced immediately with proration; downgrades are credited on the next invoice and refused (403) while enabled apps exceed the new plan's app or RAM limits."},
+	"GET /admin/billing/webhook-events":              {Response: []BillingWebhookEvent{}, Description: "Billing webhook inbox, newest first. ?status= is pending, processed, failed (default) or all. Admins only."},
+	"POST /admin/billing/webhook-events/{id}/replay": {Response: BillingWebhookEvent{}, Description: "Applies a failed billing webhook event again from its stored payload and returns it with the outcome. Only failed events can be replayed (409 otherwise). Admins only."},
+	"GET /admin/audit":                               {Response: []AuditEntry{}, Description: "Audit log across all accounts, newest first. Filter with ?user_id=, ?impersonation_id=, ?action= (exact or a prefix such as auth.*) and ?since=/?until= (RFC 3339). Admins only."},
+}
+
+// openAPIPublicPrefixes are the routes that need no session or API token
+var openAPIPublicPrefixes = []string{
+	"/health",
+	"/api/auth/config",
+	"/api/auth/signup",
+	"/api/auth/send-otp",
+	"/api/auth/verify-otp",
+	"/api/auth/login",
+	"/api/auth/forgot-password",
+	"/api/auth/reset-password",
+	"/api/webhooks/",
+	"/api/v1/hooks/",
+	"/api/v1/downloads/",
+	"/api/v1/traefik/",
+	"/api/v1/openapi.json",
+	"/api/v1/docs",
+}
+
+// openAPIParamPattern matches chi path parameters, including regexp ones ({id:[0-9]+})
+var openAPIParamPattern = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// OpenAPIDocs serves the OpenAPI 3 description of the router and a Swagger UI for it
+// The spec is generated from the registered chi routes on first request, so it always matches
+// what the server actually routes
+type OpenAPIDocs struct {
+	routes chi.Routes
+	logger *zap.Logger
+	once   sync.Once
+	spec   []byte
+	err    error
+}
+
+// NewOpenAPIDocs creates docs for routes; routes may still be added until the first request
+func NewOpenAPIDocs(routes chi.Routes, logger *zap.Logger) *OpenAPIDocs {
+	return &OpenAPIDocs{routes: routes, logger: logger}
+}
+
+// GET /api/v1/openapi.json - OpenAPI 3 description of the API
+func (d *OpenAPIDocs) ServeSpec(w http.ResponseWriter, r *http.Request) {
+	d.once.Do(func() {
+		var spec map[string]interface{}
+		spec, d.err = BuildOpenAPISpec(d.routes)
+		if d.err == nil {
+			d.spec, d.err = json.MarshalIndent(spec, "", "  ")
+		}
+		if d.err != nil {
+			d.logger.Error("Failed to generate OpenAPI spec", zap.Error(d.err))
+		}
+	})
+	if d.err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "", "Failed to generate API specification", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*") // Lets hosted editors and codegen tools fetch it
+	w.Write(d.spec)
+}
+
+// GET /api/v1/docs - Swagger UI for the OpenAPI spec
+func (d *OpenAPIDocs) ServeUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
+
+// swaggerUIPage loads Swagger UI from a CDN so the server ships no frontend assets
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>Stackyn API</title>
+	<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+	<script>
+		window.onload = function () {
+			window.ui = SwaggerUIBundle({ url: "/api/v1/openapi.json", dom_id: "#swagger-ui", persistAuthorization: true });
+		};
+	</script>
+</body>
+</html>`
+
+// BuildOpenAPISpec describes every API route registered on routes
+// Request and response schemas come from openAPIOperations, reflected from the handlers' JSON types
+func BuildOpenAPISpec(routes chi.Routes) (map[string]interface{}, error) {
+	schemas := newOpenAPISchemas()
+	paths := make(map[string]map[string]interface{})
+	operationIDs := make(map[string]bool)
+
+	err := chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route = openAPIParamPattern.ReplaceAllString(route, "{$1}")
+		if route != "/" {
+			route = strings.TrimSuffix(route, "/")
+		}
+		if !strings.HasPrefix(route, "/api/") && !strings.HasPrefix(route, "/admin/") && route != "/health" {
+			return nil // Metrics, uploads and other non-API routes
+		}
+		switch method {
+		case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return nil
+		}
+
+		doc := openAPIOperations[method+" "+route]
+		name := openAPIHandlerName(handler)
+		operationID := name
+		if operationID == "" || operationIDs[operationID] {
+			operationID = strings.ToLower(method) + strings.NewReplacer("/", "_", "{", "", "}", "", "-", "_").Replace(route)
+		}
+		operationIDs[operationID] = true
+
+		operation := map[string]interface{}{
+			"operationId": operationID,
+			"summary":     openAPISummary(name, method, route),
+			"tags":        []string{openAPITag(route)},
+		}
+		if doc.Description != "" {
+			operation["description"] = doc.Description
+		}
+		params := openAPIPathParams(route)
+		if doc.Idempotent {
+			params = append(params, map[string]interface{}{
+				"name":        idempotencyKeyHeader,
+				"in":          "header",
+				"description": "Retries with the same key (and body) within the replay window (24 hours by default) get the first response, with an Idempotent-Replayed header, instead of repeating the request. 409 while the first is still running; 422 if the body differs.",
+				"schema":      map[string]interface{}{"type": "string", "maxLength": maxIdempotencyKeyLength},
+			})
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if doc.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemas.schemaFor(reflect.TypeOf(doc.Request))},
+				},
+			}
+		}
+
+		responses := map[string]interface{}{
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemas.schemaFor(reflect.TypeOf(ErrorResponse{}))},
+				},
+			},
+		}
+		if doc.Request != nil {
+			responses[fmt.Sprint(http.StatusUnprocessableEntity)] = map[string]interface{}{
+				"description": "Validation failed (error.code VALIDATION_FAILED; error.details lists a FieldViolation per broken rule)",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemas.schemaFor(reflect.TypeOf(ErrorResponse{}))},
+				},
+			}
+		}
+		status := doc.Status
+		switch {
+		case doc.Response != nil:
+			if status == 0 {
+				status = http.StatusOK
+			}
+			responses[fmt.Sprint(status)] = map[string]interface{}{
+				"description": http.StatusText(status),
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemas.schemaFor(reflect.TypeOf(doc.Response))},
+				},
+			}
+		case method == http.MethodDelete && status == 0:
+			responses["204"] = map[string]interface{}{"description": http.StatusText(http.StatusNoContent)}
+		default:
+			if status == 0 {
+				status = http.StatusOK
+			}
+			responses[fmt.Sprint(status)] = map[string]interface{}{"description": http.StatusText(status)}
+		}
+		operation["responses"] = responses
+
+		if openAPIIsPublic(route) {
+			operation["security"] = []interface{}{}
+		}
+
+		if paths[route] == nil {
+			paths[route] = make(map[string]interface{})
+		}
+		paths[route][strings.ToLower(method)] = operation
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk routes: %w", err)
+	}
+
+	// error.details is untyped; register the shapes of the codes that have one so clients can find them
+	schemas.schemaFor(reflect.TypeOf(FieldViolation{}))
+	schemas.schemaFor(reflect.TypeOf(PlanLimitDetails{}))
+	schemas.schemaFor(reflect.TypeOf(ConstraintDetails{}))
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Stackyn API",
+			"version":     "1.0.0",
+			"description": "Deploy and manage apps on Stackyn. Authenticate with a session token from /api/auth or an API token from /api/v1/tokens, sent as a Bearer token.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"bearerAuth": []string{}}},
+	}, nil
+}
+
+// openAPISchemas reflects Go types into JSON schemas, collecting named structs as components
+type openAPISchemas struct {
+	components map[string]interface{}
+	names      map[reflect.Type]string
+}
+
+func newOpenAPISchemas() *openAPISchemas {
+	return &openAPISchemas{
+		components: make(map[string]interface{}),
+		names:      make(map[reflect.Type]string),
+	}
+}
+
+var (
+	openAPITimeType    = reflect.TypeOf(time.Time{})
+	openAPIRawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaFor returns the schema of t, as a $ref for named structs
+func (s *openAPISchemas) schemaFor(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == openAPITimeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == openAPIRawJSONType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.objectSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + s.register(t)}
+	default:
+		// interface{} fields hold whatever the database returned
+		return map[string]interface{}{}
+	}
+}
+
+// register adds a named struct to the components, returning its component name
+func (s *openAPISchemas) register(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := s.components[name]; taken {
+		name = strings.Title(path.Base(t.PkgPath())) + name
+	}
+	s.names[t] = name
+	s.components[name] = map[string]interface{}{} // Placeholder so recursive types terminate
+	s.components[name] = s.objectSchema(t)
+	return name
+}
+
+// objectSchema describes a struct by its JSON fields; fields without omitempty are required
+func (s *openAPISchemas) objectSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	s.addFields(t, properties, &required)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (s *openAPISchemas) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		// Untagged embedded structs are flattened into the parent, as encoding/json does
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.addFields(embedded, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = s.schemaFor(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// openAPIHandlerName returns the method name of a handler ("ListApps"), or "" for closures
+func openAPIHandlerName(handler http.Handler) string {
+	if chain, ok := handler.(*chi.ChainHandler); ok {
+		handler = chain.Endpoint
+	}
+	value := reflect.ValueOf(handler)
+	if value.Kind() != reflect.Func {
+		return ""
+	}
+	fn := runtime.FuncForPC(value.Pointer())
+	if fn == nil {
+		return ""
+	}
+	name := strings.TrimSuffix(fn.Name(), "-fm") // Method values are suffixed -fm
+	name = name[strings.LastIndex(name, ".")+1:]
+	if strings.HasPrefix(name, "func") {
+		return ""
+	}
+	return name
+}
+
+// openAPISummary turns a handler name into a sentence ("GetAppByID" -> "Get app by ID")
+func openAPISummary(name, method, route string) string {
+	if name == "" {
+		return method + " " + route
+	}
+	var words []string
+	runes := []rune(name)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		lowerToUpper := unicode.IsLower(runes[i-1]) && unicode.IsUpper(runes[i])
+		acronymEnd := unicode.IsUpper(runes[i-1]) && unicode.IsUpper(runes[i]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if lowerToUpper || acronymEnd {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	words = append(words, string(runes[start:]))
+	for i, word := range words {
+		if i > 0 && strings.ToUpper(word) != word {
+			words[i] = strings.ToLower(word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// openAPITag groups operations by resource: /api/v1/apps/{id}/env -> "apps"
+func openAPITag(route string) string {
+	trimmed := strings.TrimPrefix(route, "/api/v1/")
+	trimmed = strings.TrimPrefix(trimmed, "/api/")
+	trimmed = strings.TrimPrefix(trimmed, "/")
+	tag, _, _ := strings.Cut(trimmed, "/")
+	return tag
+}
+
+// openAPIPathParams lists the route's path parameters (all strings)
+func openAPIPathParams(route string) []interface{} {
+	var params []interface{}
+	for _, match := range openAPIParamPattern.FindAllStringSubmatch(route, -1) {
+		params = append(params, map[string]interface{}{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+	return params
+}
+
+func openAPIIsPublic(route string) bool {
+	for _, prefix := range openAPIPublicPrefixes {
+		if strings.HasPrefix(route, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// AppProcess is a background process declared in the Procfile of an app's latest build (worker, cron, ...)
+// Enabled processes run as worker containers next to the web container; they receive no traffic
+type AppProcess struct {
+	Name      string `json:"name"`
+	Command   string `json:"command"`
+	Enabled   bool   `json:"enabled"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// UpdateAppProcessRequest is the request body for PUT /api/v1/apps/{id}/processes/{name}
+type UpdateAppProcessRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// GET /api/v1/apps/{id}/processes - List the app's Procfile processes and which ones run as workers
+func (h *Handlers) ListAppProcesses(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+
+	processes, err := h.appRepo.ListAppProcesses(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve processes")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, processes)
+}
+
+// PUT /api/v1/apps/{id}/processes/{name} - Turn a worker process on or off
+// The running deployment is redeployed so its worker containers match
+func (h *Handlers) UpdateAppProcess(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	name := strings.ToLower(chi.URLParam(r, "name"))
+	userID := h.getUserIDFromContext(r)
+
+	var req UpdateAppProcessRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Enabled == nil {
+		h.writeError(w, http.StatusBadRequest, "enabled is required")
+		return
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+
+	// Workers are gated by the owner's plan; turning one off is always allowed
+	if *req.Enabled && h.planEnforcement != nil {
+		if err := h.planEnforcement.CheckWorkers(r.Context(), app.UserID); err != nil {
+			if planErr, ok := GetPlanLimitError(err); ok {
+				writePlanLimitError(w, planErr)
+				return
+			}
+			h.writeError(w, http.StatusInternalServerError, "Failed to check plan limits")
+			return
+		}
+	}
+
+	process, err := h.appRepo.SetAppProcessEnabled(r.Context(), app.ID, name, *req.Enabled)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Process not found in the app's Procfile")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to update process")
+		return
+	}
+
+	h.logger.Info("App process updated",
+		zap.String("app_id", app.ID),
+		zap.String("process", process.Name),
+		zap.Bool("enabled", process.Enabled),
+		zap.String("user_id", userID),
+	)
+
+	enqueueRouteRefresh(r.Context(), h.logger, h.taskEnqueue, h.deploymentRepo, app.ID, userID, "worker processes")
+
+	h.writeJSON(w, http.StatusOK, process)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// ReleaseCommandSettings is an app's release phase command, run before each new deployment takes traffic
+// It is the request and response body of /api/v1/apps/{id}/release-command
+type ReleaseCommandSettings struct {
+	ReleaseCommand string `json:"release_command"` // Empty when the app has no release phase
+}
+
+// GET /api/v1/apps/{id}/release-command - Get the command run before a new deployment takes traffic
+func (h *Handlers) GetReleaseCommand(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+
+	command, err := h.appRepo.GetReleaseCommand(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve release command")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, ReleaseCommandSettings{ReleaseCommand: command})
+}
+
+// PUT /api/v1/apps/{id}/release-command - Set or remove (empty command) the release phase command
+// It takes effect on the next deployment
+func (h *Handlers) UpdateReleaseCommand(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+
+	var req ReleaseCommandSettings
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.ReleaseCommand = strings.TrimSpace(req.ReleaseCommand)
+	if len(req.ReleaseCommand) > maxExecCommandLength {
+		h.writeError(w, http.StatusBadRequest, fmt.Sprintf("release_command must be at most %d characters", maxExecCommandLength))
+		return
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+
+	if err := h.appRepo.SetReleaseCommand(r.Context(), app.ID, req.ReleaseCommand); err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to update release command")
+		return
+	}
+	h.logger.Info("Release command updated",
+		zap.String("app_id", app.ID),
+		zap.Bool("enabled", req.ReleaseCommand != ""),
+		zap.String("user_id", userID),
+	)
+
+	h.writeJSON(w, http.StatusOK, req)
+}
+
+// GET /api/v1/apps/{id}/logs/release - Get release command output for an app, one entry per deploy attempt
+func (h *Handlers) GetReleaseLogs(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+
+	limit := 100
+	offset := 0
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil {
+		offset = o
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+
+	logs, err := h.logPersistence.GetLogs(r.Context(), app.ID, LogType("release"), limit, offset)
+	if err != nil {
+		h.logger.Error("Failed to get release logs", zap.Error(err), zap.String("app_id", app.ID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to get release logs")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, logs)
+}
@@ -3,15 +3,22 @@ package api
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
+	"stackyn/server/internal/deploystate"
+	"stackyn/server/internal/services"
+	"stackyn/server/internal/tasks"
 )
 
 // OTPRepo implements OTPRepository interface using database
@@ -28,56 +35,88 @@ func NewOTPRepo(pool *pgxpool.Pool, logger *zap.Logger) *OTPRepo {
 	}
 }
 
-// CreateOTP creates a new OTP record
-func (r *OTPRepo) CreateOTP(email, otpHash string, expiresAt time.Time) error {
+// CreateOTP stores a code, retiring the email's earlier unused codes for the same purpose
+// so a used-up code never hands its guesses on to an older one
+func (r *OTPRepo) CreateOTP(record services.OTPRecord) error {
 	ctx := context.Background()
 	_, err := r.pool.Exec(ctx,
-		"INSERT INTO otps (email, otp_hash, expires_at) VALUES ($1, $2, $3)",
-		email, otpHash, expiresAt,
+		`WITH retired AS (
+			UPDATE otps SET used = true WHERE email = $1 AND purpose = $2 AND used = false
+		)
+		INSERT INTO otps (email, purpose, otp_hash, expires_at, signup_full_name, signup_password_hash)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''))`,
+		record.Email, record.Purpose, record.Hash, record.ExpiresAt, record.FullName, record.PasswordHash,
 	)
 	if err != nil {
-		r.logger.Error("Failed to create OTP", zap.Error(err), zap.String("email", email))
+		r.logger.Error("Failed to create OTP", zap.Error(err), zap.String("email", record.Email))
 		return err
 	}
 	return nil
 }
 
-// GetOTPByEmail retrieves the most recent unused OTP for an email
-func (r *OTPRepo) GetOTPByEmail(email string) (otpID, otpHash string, expiresAt time.Time, err error) {
+// GetLatestOTP retrieves the most recent unused, unexpired OTP for an email issued for any of purposes
+func (r *OTPRepo) GetLatestOTP(email string, purposes []string) (*services.OTPRecord, error) {
 	ctx := context.Background()
-	var id string
-	err = r.pool.QueryRow(ctx,
-		"SELECT id, otp_hash, expires_at FROM otps WHERE email = $1 AND used = false AND expires_at > NOW() ORDER BY created_at DESC LIMIT 1",
-		email,
-	).Scan(&id, &otpHash, &expiresAt)
+	var record services.OTPRecord
+	err := r.pool.QueryRow(ctx,
+		`SELECT id, email, purpose, otp_hash, expires_at, attempts,
+		        COALESCE(signup_full_name, ''), COALESCE(signup_password_hash, '')
+		 FROM otps
+		 WHERE email = $1 AND purpose = ANY($2) AND used = false AND expires_at > NOW()
+		 ORDER BY created_at DESC LIMIT 1`,
+		email, purposes,
+	).Scan(&record.ID, &record.Email, &record.Purpose, &record.Hash, &record.ExpiresAt, &record.Attempts,
+		&record.FullName, &record.PasswordHash)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return "", "", time.Time{}, pgx.ErrNoRows
+		if !errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error("Failed to get OTP", zap.Error(err), zap.String("email", email))
 		}
-		r.logger.Error("Failed to get OTP", zap.Error(err), zap.String("email", email))
-		return "", "", time.Time{}, err
+		return nil, err
 	}
-	return id, otpHash, expiresAt, nil
+	return &record, nil
 }
 
-// MarkOTPAsUsed marks an OTP as used
-func (r *OTPRepo) MarkOTPAsUsed(otpID string) error {
+// RecordFailedOTPAttempt counts a wrong guess and uses the code up once it reaches maxAttempts
+func (r *OTPRepo) RecordFailedOTPAttempt(otpID string, maxAttempts int) (int, error) {
 	ctx := context.Background()
-	_, err := r.pool.Exec(ctx,
-		"UPDATE otps SET used = true WHERE id = $1",
+	var attempts int
+	err := r.pool.QueryRow(ctx,
+		`UPDATE otps SET attempts = attempts + 1, used = used OR attempts + 1 >= $2
+		 WHERE id = $1
+		 RETURNING attempts`,
+		otpID, maxAttempts,
+	).Scan(&attempts)
+	if err != nil {
+		r.logger.Error("Failed to record OTP attempt", zap.Error(err), zap.String("otp_id", otpID))
+		return 0, err
+	}
+	return attempts, nil
+}
+
+// ConsumeOTP marks an OTP as used; false when it already was (a concurrent request got there first)
+func (r *OTPRepo) ConsumeOTP(otpID string) (bool, error) {
+	ctx := context.Background()
+	tag, err := r.pool.Exec(ctx,
+		"UPDATE otps SET used = true WHERE id = $1 AND used = false",
 		otpID,
 	)
 	if err != nil {
 		r.logger.Error("Failed to mark OTP as used", zap.Error(err), zap.String("otp_id", otpID))
-		return err
+		return false, err
 	}
-	return nil
+	return tag.RowsAffected() == 1, nil
 }
 
+// Keys of the reads UserRepo, SubscriptionRepo and AppRepo keep in the read cache
+func userCacheKey(userID string) string         { return "user:" + userID }
+func subscriptionCacheKey(userID string) string { return "subscription:" + userID }
+func appsCacheKey(userID string) string         { return "apps:" + userID }
+
 // UserRepo implements UserRepository interface using database
 type UserRepo struct {
 	pool   *pgxpool.Pool
 	logger *zap.Logger
+	cache  *services.ReadCache // Optional - see SetCache
 }
 
 // NewUserRepo creates a new user repository
@@ -88,20 +127,29 @@ func NewUserRepo(pool *pgxpool.Pool, logger *zap.Logger) *UserRepo {
 	}
 }
 
+// SetCache serves GetUserByID from cache; the repository's writes drop the user's entry
+func (r *UserRepo) SetCache(cache *services.ReadCache) {
+	r.cache = cache
+}
+
 // GetUserByEmail retrieves a user by email
 func (r *UserRepo) GetUserByEmail(email string) (*User, error) {
 	ctx := context.Background()
 	var user User
 	var passwordHash sql.NullString
 	var billingStatus, plan, subscriptionID sql.NullString
-	var trialStartedAt, trialEndsAt sql.NullTime
+	var trialStartedAt, trialEndsAt, graceEndsAt sql.NullTime
+	var avatarKey, avatarURL sql.NullString
+	var notificationPrefs []byte
 	err := r.pool.QueryRow(ctx,
 		`SELECT id, email, full_name, company_name, password_hash, 
-		        billing_status, plan, trial_started_at, trial_ends_at, subscription_id 
+		        billing_status, plan, trial_started_at, trial_ends_at, subscription_id, grace_ends_at,
+		        timezone, notification_preferences, avatar_key, avatar_url, locale 
 		 FROM users WHERE email = $1`,
 		email,
 	).Scan(&user.ID, &user.Email, &user.FullName, &user.CompanyName, &passwordHash,
-		&billingStatus, &plan, &trialStartedAt, &trialEndsAt, &subscriptionID)
+		&billingStatus, &plan, &trialStartedAt, &trialEndsAt, &subscriptionID, &graceEndsAt,
+		&user.Timezone, &notificationPrefs, &avatarKey, &avatarURL, &user.Locale)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, pgx.ErrNoRows
@@ -127,23 +175,41 @@ func (r *UserRepo) GetUserByEmail(email string) (*User, error) {
 	if trialEndsAt.Valid {
 		user.TrialEndsAt = &trialEndsAt.Time
 	}
+	if graceEndsAt.Valid {
+		user.GraceEndsAt = &graceEndsAt.Time
+	}
+	if avatarKey.Valid {
+		user.AvatarKey = avatarKey.String
+	}
+	if avatarURL.Valid {
+		user.AvatarURL = avatarURL.String
+	}
+	user.NotificationPreferences = services.ParseNotificationPreferences(notificationPrefs)
 	return &user, nil
 }
 
 // GetUserByID retrieves a user by ID
 func (r *UserRepo) GetUserByID(userID string) (*User, error) {
 	ctx := context.Background()
+	var cached User
+	if r.cache.Get(ctx, userCacheKey(userID), &cached) {
+		return &cached, nil
+	}
 	var user User
 	var passwordHash sql.NullString
 	var billingStatus, plan, subscriptionID sql.NullString
-	var trialStartedAt, trialEndsAt sql.NullTime
+	var trialStartedAt, trialEndsAt, graceEndsAt sql.NullTime
+	var avatarKey, avatarURL sql.NullString
+	var notificationPrefs []byte
 	err := r.pool.QueryRow(ctx,
 		`SELECT id, email, full_name, company_name, password_hash, 
-		        billing_status, plan, trial_started_at, trial_ends_at, subscription_id 
+		        billing_status, plan, trial_started_at, trial_ends_at, subscription_id, grace_ends_at,
+		        timezone, notification_preferences, avatar_key, avatar_url, locale 
 		 FROM users WHERE id = $1`,
 		userID,
 	).Scan(&user.ID, &user.Email, &user.FullName, &user.CompanyName, &passwordHash,
-		&billingStatus, &plan, &trialStartedAt, &trialEndsAt, &subscriptionID)
+		&billingStatus, &plan, &trialStartedAt, &trialEndsAt, &subscriptionID, &graceEndsAt,
+		&user.Timezone, &notificationPrefs, &avatarKey, &avatarURL, &user.Locale)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, pgx.ErrNoRows
@@ -169,6 +235,17 @@ func (r *UserRepo) GetUserByID(userID string) (*User, error) {
 	if trialEndsAt.Valid {
 		user.TrialEndsAt = &trialEndsAt.Time
 	}
+	if graceEndsAt.Valid {
+		user.GraceEndsAt = &graceEndsAt.Time
+	}
+	if avatarKey.Valid {
+		user.AvatarKey = avatarKey.String
+	}
+	if avatarURL.Valid {
+		user.AvatarURL = avatarURL.String
+	}
+	user.NotificationPreferences = services.ParseNotificationPreferences(notificationPrefs)
+	r.cache.Set(ctx, userCacheKey(userID), &user)
 	return &user, nil
 }
 
@@ -179,6 +256,8 @@ func (r *UserRepo) DeleteUser(ctx context.Context, userID string) error {
 		r.logger.Error("Failed to delete user", zap.Error(err), zap.String("user_id", userID))
 		return err
 	}
+	// The delete cascades to the user's subscriptions and apps
+	r.cache.Invalidate(ctx, userCacheKey(userID), subscriptionCacheKey(userID), appsCacheKey(userID))
 	if result.RowsAffected() == 0 {
 		return pgx.ErrNoRows
 	}
@@ -203,7 +282,8 @@ func (r *UserRepo) GetUserDates(ctx context.Context, userID string) (createdAt,
 }
 
 // CreateUser creates a new user (no default plan - trial is created separately)
-func (r *UserRepo) CreateUser(email, fullName, companyName, passwordHash string) (*User, error) {
+// An unsupported locale is stored as the default
+func (r *UserRepo) CreateUser(email, fullName, companyName, passwordHash, locale string) (*User, error) {
 	ctx := context.Background()
 	var user User
 	var hash sql.NullString
@@ -214,11 +294,16 @@ func (r *UserRepo) CreateUser(email, fullName, companyName, passwordHash string)
 	// No default plan - users get a trial subscription instead
 	var planID sql.NullString
 	planID = sql.NullString{Valid: false}
+
+	locale = services.NormalizeLocale(locale)
+	if locale == "" {
+		locale = services.DefaultLocale
+	}
 	
 	err := r.pool.QueryRow(ctx,
-		"INSERT INTO users (email, full_name, company_name, password_hash, plan_id) VALUES ($1, $2, $3, $4, $5) RETURNING id, email, full_name, company_name, password_hash",
-		email, fullName, companyName, hash, planID,
-	).Scan(&user.ID, &user.Email, &user.FullName, &user.CompanyName, &hash)
+		"INSERT INTO users (email, full_name, company_name, password_hash, plan_id, locale) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, email, full_name, company_name, password_hash, locale",
+		email, fullName, companyName, hash, planID, locale,
+	).Scan(&user.ID, &user.Email, &user.FullName, &user.CompanyName, &hash, &user.Locale)
 	if err != nil {
 		r.logger.Error("Failed to create user", zap.Error(err), zap.String("email", email))
 		return nil, err
@@ -259,9 +344,117 @@ func (r *UserRepo) UpdateUser(userID, fullName, companyName, passwordHash string
 	if hash.Valid {
 		user.PasswordHash = hash.String
 	}
+	r.cache.Invalidate(ctx, userCacheKey(userID))
 	return &user, nil
 }
 
+// UserProfileUpdate holds the profile fields to change; nil fields are left as they are
+type UserProfileUpdate struct {
+	FullName                *string
+	CompanyName             *string
+	Timezone                *string
+	Locale                  *string
+	NotificationPreferences *services.NotificationPreferences
+}
+
+// UpdateUserProfile applies a partial profile update
+func (r *UserRepo) UpdateUserProfile(ctx context.Context, userID string, update UserProfileUpdate) error {
+	var prefs []byte
+	if update.NotificationPreferences != nil {
+		var err error
+		prefs, err = json.Marshal(update.NotificationPreferences)
+		if err != nil {
+			return fmt.Errorf("failed to encode notification preferences: %w", err)
+		}
+	}
+
+	result, err := r.pool.Exec(ctx,
+		`UPDATE users SET
+		    full_name = COALESCE($2, full_name),
+		    company_name = COALESCE($3, company_name),
+		    timezone = COALESCE($4, timezone),
+		    notification_preferences = COALESCE($5::jsonb, notification_preferences),
+		    locale = COALESCE($6, locale),
+		    updated_at = NOW()
+		 WHERE id = $1`,
+		userID, update.FullName, update.CompanyName, update.Timezone, prefs, update.Locale,
+	)
+	if err != nil {
+		r.logger.Error("Failed to update user profile", zap.Error(err), zap.String("user_id", userID))
+		return err
+	}
+	r.cache.Invalidate(ctx, userCacheKey(userID))
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateUserAvatar records a user's avatar object (empty key and URL clear it)
+func (r *UserRepo) UpdateUserAvatar(ctx context.Context, userID, avatarKey, avatarURL string) error {
+	var key, url sql.NullString
+	if avatarKey != "" {
+		key = sql.NullString{String: avatarKey, Valid: true}
+		url = sql.NullString{String: avatarURL, Valid: true}
+	}
+	result, err := r.pool.Exec(ctx,
+		"UPDATE users SET avatar_key = $2, avatar_url = $3, updated_at = NOW() WHERE id = $1",
+		userID, key, url,
+	)
+	if err != nil {
+		r.logger.Error("Failed to update user avatar", zap.Error(err), zap.String("user_id", userID))
+		return err
+	}
+	r.cache.Invalidate(ctx, userCacheKey(userID))
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// GetNotificationRecipient loads a user's email, Slack webhook and notification preferences
+func (r *UserRepo) GetNotificationRecipient(ctx context.Context, userID string) (*services.NotificationRecipient, error) {
+	recipient := services.NotificationRecipient{UserID: userID}
+	var slackWebhookURL sql.NullString
+	var notificationPrefs []byte
+	err := r.pool.QueryRow(ctx,
+		"SELECT email, locale, slack_webhook_url, notification_preferences FROM users WHERE id = $1",
+		userID,
+	).Scan(&recipient.Email, &recipient.Locale, &slackWebhookURL, &notificationPrefs)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get notification recipient", zap.Error(err), zap.String("user_id", userID))
+		return nil, err
+	}
+	if slackWebhookURL.Valid {
+		recipient.SlackWebhookURL = slackWebhookURL.String
+	}
+	recipient.Preferences = services.ParseNotificationPreferences(notificationPrefs)
+	return &recipient, nil
+}
+
+// UpdateSlackWebhookURL sets the Slack incoming webhook notifications are posted to (empty disconnects Slack)
+func (r *UserRepo) UpdateSlackWebhookURL(ctx context.Context, userID, webhookURL string) error {
+	var url sql.NullString
+	if webhookURL != "" {
+		url = sql.NullString{String: webhookURL, Valid: true}
+	}
+	result, err := r.pool.Exec(ctx,
+		"UPDATE users SET slack_webhook_url = $2, updated_at = NOW() WHERE id = $1",
+		userID, url,
+	)
+	if err != nil {
+		r.logger.Error("Failed to update Slack webhook", zap.Error(err), zap.String("user_id", userID))
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
 // UpdateUserPassword updates a user's password
 func (r *UserRepo) UpdateUserPassword(userID, passwordHash string) error {
 	ctx := context.Background()
@@ -274,6 +467,7 @@ func (r *UserRepo) UpdateUserPassword(userID, passwordHash string) error {
 		r.logger.Error("Failed to update user password", zap.Error(err), zap.String("user_id", userID))
 		return err
 	}
+	r.cache.Invalidate(ctx, userCacheKey(userID))
 	return nil
 }
 
@@ -287,6 +481,8 @@ func (r *UserRepo) UpdateUserBilling(ctx context.Context, userID, billingStatus,
 		setParts = append(setParts, fmt.Sprintf("billing_status = $%d", argNum))
 		args = append(args, billingStatus)
 		argNum++
+		// Any status change ends a payment grace period (grace is set via UpdateUserGracePeriod)
+		setParts = append(setParts, "grace_ends_at = NULL")
 	}
 	if plan != "" {
 		setParts = append(setParts, fmt.Sprintf("plan = $%d", argNum))
@@ -322,6 +518,21 @@ func (r *UserRepo) UpdateUserBilling(ctx context.Context, userID, billingStatus,
 		r.logger.Error("Failed to update user billing", zap.Error(err), zap.String("user_id", userID))
 		return err
 	}
+	r.cache.Invalidate(ctx, userCacheKey(userID))
+	return nil
+}
+
+// UpdateUserGracePeriod puts a user into read-only grace mode until graceEndsAt
+func (r *UserRepo) UpdateUserGracePeriod(ctx context.Context, userID string, graceEndsAt time.Time) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE users SET billing_status = 'grace', grace_ends_at = $2, updated_at = NOW() WHERE id = $1`,
+		userID, graceEndsAt,
+	)
+	if err != nil {
+		r.logger.Error("Failed to update user grace period", zap.Error(err), zap.String("user_id", userID))
+		return err
+	}
+	r.cache.Invalidate(ctx, userCacheKey(userID))
 	return nil
 }
 
@@ -391,6 +602,7 @@ func (r *UserRepo) ListAllUsers(limit, offset int, search string) ([]User, int,
 type AppRepo struct {
 	pool   *pgxpool.Pool
 	logger *zap.Logger
+	cache  *services.ReadCache // Optional - see SetCache
 }
 
 // NewAppRepo creates a new app repository
@@ -401,11 +613,57 @@ func NewAppRepo(pool *pgxpool.Pool, logger *zap.Logger) *AppRepo {
 	}
 }
 
+// SetCache serves GetAppsByUserID from cache; the repository's writes to the listed columns (create,
+// delete, status, organization, image) drop the owner's entry
+func (r *AppRepo) SetCache(cache *services.ReadCache) {
+	r.cache = cache
+}
+
+// InvalidateAppLists drops the cached app lists of users, for workers that change apps without the repository
+func (r *AppRepo) InvalidateAppLists(ctx context.Context, userIDs ...string) {
+	keys := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		keys[i] = appsCacheKey(userID)
+	}
+	r.cache.Invalidate(ctx, keys...)
+}
+
+// invalidateOwnerApps drops the cached app list of the app's owner
+func (r *AppRepo) invalidateOwnerApps(ctx context.Context, appID string) {
+	if r.cache == nil {
+		return
+	}
+	userID, err := r.GetAppUserID(ctx, appID)
+	if err != nil {
+		return
+	}
+	r.cache.Invalidate(ctx, appsCacheKey(userID))
+}
+
+// GetEnabledAppUsage counts a user's enabled (not disabled) apps and the RAM they are sized for
+// These are the apps counted against plan limits when the plan changes
+func (r *AppRepo) GetEnabledAppUsage(ctx context.Context, userID string) (appCount, ramMB int, err error) {
+	err = r.pool.QueryRow(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(ram_mb), 0) FROM apps WHERE user_id = $1 AND status <> 'disabled'`,
+		userID,
+	).Scan(&appCount, &ramMB)
+	if err != nil {
+		r.logger.Error("Failed to get enabled app usage", zap.Error(err), zap.String("user_id", userID))
+		return 0, 0, err
+	}
+	return appCount, ramMB, nil
+}
+
 // GetAppsByUserID retrieves all apps for a user
 func (r *AppRepo) GetAppsByUserID(userID string) ([]App, error) {
 	ctx := context.Background()
+	var cached []App
+	if r.cache.Get(ctx, appsCacheKey(userID), &cached) {
+		return cached, nil
+	}
 	rows, err := r.pool.Query(ctx,
-		`SELECT id, name, slug, status, url, repo_url, branch, created_at, updated_at 
+		`SELECT id, name, slug, status, status_reason, url, repo_url, branch, root_dir, organization_id, created_at, updated_at, first_deployed_at,
+		        source_type, image_ref, image_digest, image_latest_digest 
 		 FROM apps 
 		 WHERE user_id = $1 
 		 ORDER BY created_at DESC`,
@@ -420,26 +678,45 @@ func (r *AppRepo) GetAppsByUserID(userID string) ([]App, error) {
 	var apps []App
 	for rows.Next() {
 		var app App
-		var url sql.NullString
+		var url, statusReason, organizationID sql.NullString
 		var createdAt, updatedAt time.Time
+		var firstDeployedAt sql.NullTime
+		var image, imageDigest, imageLatestDigest sql.NullString
 		err := rows.Scan(
 			&app.ID,
 			&app.Name,
 			&app.Slug,
 			&app.Status,
+			&statusReason,
 			&url,
 			&app.RepoURL,
 			&app.Branch,
+			&app.RootDir,
+			&organizationID,
 			&createdAt,
 			&updatedAt,
+			&firstDeployedAt,
+			&app.Source,
+			&image,
+			&imageDigest,
+			&imageLatestDigest,
 		)
 		if err != nil {
 			r.logger.Error("Failed to scan app", zap.Error(err))
 			continue
 		}
+		if firstDeployedAt.Valid {
+			app.FirstDeployedAt = firstDeployedAt.Time.Format(time.RFC3339)
+		}
+		app.setImage(image, imageDigest, imageLatestDigest)
+		app.UserID = userID
 		if url.Valid {
 			app.URL = url.String
 		}
+		if statusReason.Valid {
+			app.StatusReason = statusReason.String
+		}
+		app.OrganizationID = organizationID.String
 		app.CreatedAt = createdAt.Format(time.RFC3339)
 		app.UpdatedAt = updatedAt.Format(time.RFC3339)
 		apps = append(apps, app)
@@ -450,6 +727,7 @@ func (r *AppRepo) GetAppsByUserID(userID string) ([]App, error) {
 		return nil, err
 	}
 
+	r.cache.Set(ctx, appsCacheKey(userID), apps)
 	return apps, nil
 }
 
@@ -482,7 +760,7 @@ func (r *AppRepo) ListAllApps(limit, offset int) ([]App, int, error) {
 	
 	// Get apps
 	rows, err := r.pool.Query(ctx,
-		`SELECT id, name, slug, status, url, repo_url, branch, created_at, updated_at 
+		`SELECT id, name, slug, status, status_reason, url, repo_url, branch, created_at, updated_at 
 		 FROM apps 
 		 ORDER BY created_at DESC 
 		 LIMIT $1 OFFSET $2`,
@@ -497,13 +775,14 @@ func (r *AppRepo) ListAllApps(limit, offset int) ([]App, int, error) {
 	var apps []App
 	for rows.Next() {
 		var app App
-		var url sql.NullString
+		var url, statusReason sql.NullString
 		var createdAt, updatedAt time.Time
 		err := rows.Scan(
 			&app.ID,
 			&app.Name,
 			&app.Slug,
 			&app.Status,
+			&statusReason,
 			&url,
 			&app.RepoURL,
 			&app.Branch,
@@ -517,6 +796,9 @@ func (r *AppRepo) ListAllApps(limit, offset int) ([]App, int, error) {
 		if url.Valid {
 			app.URL = url.String
 		}
+		if statusReason.Valid {
+			app.StatusReason = statusReason.String
+		}
 		app.CreatedAt = createdAt.Format(time.RFC3339)
 		app.UpdatedAt = updatedAt.Format(time.RFC3339)
 		apps = append(apps, app)
@@ -534,10 +816,12 @@ func (r *AppRepo) ListAllApps(limit, offset int) ([]App, int, error) {
 func (r *AppRepo) GetAppByIDWithoutUserCheck(appID string) (*App, error) {
 	ctx := context.Background()
 	var app App
-	var url sql.NullString
+	var url, statusReason sql.NullString
 	var createdAt, updatedAt time.Time
+	var image, imageDigest, imageLatestDigest sql.NullString
 	err := r.pool.QueryRow(ctx,
-		`SELECT id, name, slug, status, url, repo_url, branch, created_at, updated_at 
+		`SELECT id, name, slug, status, status_reason, url, repo_url, branch, root_dir, created_at, updated_at,
+		        source_type, image_ref, image_digest, image_latest_digest 
 		 FROM apps 
 		 WHERE id = $1`,
 		appID,
@@ -546,11 +830,17 @@ func (r *AppRepo) GetAppByIDWithoutUserCheck(appID string) (*App, error) {
 		&app.Name,
 		&app.Slug,
 		&app.Status,
+		&statusReason,
 		&url,
 		&app.RepoURL,
 		&app.Branch,
+		&app.RootDir,
 		&createdAt,
 		&updatedAt,
+		&app.Source,
+		&image,
+		&imageDigest,
+		&imageLatestDigest,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -559,35 +849,53 @@ func (r *AppRepo) GetAppByIDWithoutUserCheck(appID string) (*App, error) {
 		r.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
 		return nil, err
 	}
+	app.setImage(image, imageDigest, imageLatestDigest)
 	if url.Valid {
 		app.URL = url.String
 	}
+	if statusReason.Valid {
+		app.StatusReason = statusReason.String
+	}
 	app.CreatedAt = createdAt.Format(time.RFC3339)
 	app.UpdatedAt = updatedAt.Format(time.RFC3339)
 	return &app, nil
 }
 
-// GetAppByID retrieves an app by ID (must belong to the user)
+// GetAppByID retrieves an app by ID (must belong to the user, or to an organization the user is a member of)
+// Role-based restrictions for org members are enforced by AppAccessMiddleware
 func (r *AppRepo) GetAppByID(appID, userID string) (*App, error) {
 	ctx := context.Background()
 	var app App
-	var url sql.NullString
+	var url, statusReason, organizationID sql.NullString
 	var createdAt, updatedAt time.Time
+	var firstDeployedAt sql.NullTime
+	var image, imageDigest, imageLatestDigest sql.NullString
 	err := r.pool.QueryRow(ctx,
-		`SELECT id, name, slug, status, url, repo_url, branch, created_at, updated_at 
+		`SELECT id, name, slug, status, status_reason, url, repo_url, branch, root_dir, user_id, organization_id, created_at, updated_at, first_deployed_at,
+		        source_type, image_ref, image_digest, image_latest_digest 
 		 FROM apps 
-		 WHERE id = $1 AND user_id = $2`,
+		 WHERE id = $1 AND (user_id = $2 OR organization_id IN (
+		       SELECT organization_id FROM organization_members WHERE user_id = $2))`,
 		appID, userID,
 	).Scan(
 		&app.ID,
 		&app.Name,
 		&app.Slug,
 		&app.Status,
+		&statusReason,
 		&url,
 		&app.RepoURL,
 		&app.Branch,
+		&app.RootDir,
+		&app.UserID,
+		&organizationID,
 		&createdAt,
 		&updatedAt,
+		&firstDeployedAt,
+		&app.Source,
+		&image,
+		&imageDigest,
+		&imageLatestDigest,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -596,9 +904,17 @@ func (r *AppRepo) GetAppByID(appID, userID string) (*App, error) {
 		r.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID), zap.String("user_id", userID))
 		return nil, err
 	}
+	if firstDeployedAt.Valid {
+		app.FirstDeployedAt = firstDeployedAt.Time.Format(time.RFC3339)
+	}
+	app.setImage(image, imageDigest, imageLatestDigest)
 	if url.Valid {
 		app.URL = url.String
 	}
+	if statusReason.Valid {
+		app.StatusReason = statusReason.String
+	}
+	app.OrganizationID = organizationID.String
 	app.CreatedAt = createdAt.Format(time.RFC3339)
 	app.UpdatedAt = updatedAt.Format(time.RFC3339)
 	return &app, nil
@@ -606,17 +922,18 @@ func (r *AppRepo) GetAppByID(appID, userID string) (*App, error) {
 
 // CreateApp creates a new app in the database
 // slug is now a required parameter (validated and generated in the handler if not provided)
-func (r *AppRepo) CreateApp(userID, name, slug, repoURL, branch string) (*App, error) {
+// rootDir is the normalized repository subdirectory to build from ("" for the repository root)
+func (r *AppRepo) CreateApp(userID, name, slug, repoURL, branch, rootDir string) (*App, error) {
 	ctx := context.Background()
 	
 	var app App
 	var url sql.NullString
 	var createdAt, updatedAt time.Time
 	err := r.pool.QueryRow(ctx,
-		`INSERT INTO apps (user_id, name, slug, repo_url, branch, status) 
-		 VALUES ($1, $2, $3, $4, $5, 'pending') 
-		 RETURNING id, name, slug, status, url, repo_url, branch, created_at, updated_at`,
-		userID, name, slug, repoURL, branch,
+		`INSERT INTO apps (user_id, name, slug, repo_url, branch, root_dir, status) 
+		 VALUES ($1, $2, $3, $4, $5, $6, 'pending') 
+		 RETURNING id, name, slug, status, url, repo_url, branch, root_dir, created_at, updated_at`,
+		userID, name, slug, repoURL, branch, rootDir,
 	).Scan(
 		&app.ID,
 		&app.Name,
@@ -625,6 +942,7 @@ func (r *AppRepo) CreateApp(userID, name, slug, repoURL, branch string) (*App, e
 		&url,
 		&app.RepoURL,
 		&app.Branch,
+		&app.RootDir,
 		&createdAt,
 		&updatedAt,
 	)
@@ -635,12 +953,28 @@ func (r *AppRepo) CreateApp(userID, name, slug, repoURL, branch string) (*App, e
 	if url.Valid {
 		app.URL = url.String
 	}
+	app.Source = services.AppSourceGit
 	app.CreatedAt = createdAt.Format(time.RFC3339)
 	app.UpdatedAt = updatedAt.Format(time.RFC3339)
+	r.cache.Invalidate(ctx, appsCacheKey(userID))
 	
 	return &app, nil
 }
 
+// AssignAppToOrganization makes an app org-scoped
+func (r *AppRepo) AssignAppToOrganization(ctx context.Context, appID, organizationID string) error {
+	_, err := r.pool.Exec(ctx,
+		"UPDATE apps SET organization_id = $2, updated_at = NOW() WHERE id = $1",
+		appID, organizationID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to assign app to organization", zap.Error(err), zap.String("app_id", appID), zap.String("organization_id", organizationID))
+		return err
+	}
+	r.invalidateOwnerApps(ctx, appID)
+	return nil
+}
+
 // GetAppUserID gets the user_id for an app (for admin operations)
 func (r *AppRepo) GetAppUserID(ctx context.Context, appID string) (string, error) {
 	var userID string
@@ -658,6 +992,35 @@ func (r *AppRepo) GetAppUserID(ctx context.Context, appID string) (string, error
 	return userID, nil
 }
 
+// GetAppStatusByHost finds the app served on host - a subdomain of baseDomain or a verified custom domain
+// Only the public fields needed to explain a missing route are loaded
+// Returns pgx.ErrNoRows if no app uses the host
+func (r *AppRepo) GetAppStatusByHost(ctx context.Context, host, baseDomain string) (*App, error) {
+	// App subdomains are a single label under the base domain
+	slug := ""
+	if label, ok := strings.CutSuffix(host, "."+baseDomain); ok && !strings.Contains(label, ".") {
+		slug = label
+	}
+
+	var app App
+	err := r.pool.QueryRow(ctx,
+		`SELECT a.id, a.name, a.slug, a.status, a.user_id
+		 FROM apps a
+		 WHERE ($2 <> '' AND a.slug = $2)
+		    OR a.id = (SELECT app_id FROM app_domains WHERE domain = $1 AND status = 'verified')
+		 LIMIT 1`,
+		host, slug,
+	).Scan(&app.ID, &app.Name, &app.Slug, &app.Status, &app.UserID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get app by host", zap.Error(err), zap.String("host", host))
+		return nil, err
+	}
+	return &app, nil
+}
+
 // GetAppSlug gets the slug for an app (for subdomain generation)
 func (r *AppRepo) GetAppSlug(appID string) (string, error) {
 	ctx := context.Background()
@@ -676,1036 +1039,6992 @@ func (r *AppRepo) GetAppSlug(appID string) (string, error) {
 	return slug, nil
 }
 
-// DeleteApp deletes an app by ID (must belong to the user)
-func (r *AppRepo) DeleteApp(appID, userID string) error {
-	ctx := context.Background()
-	
-	// First verify the app exists and belongs to the user
-	var exists bool
+// HealthCheckConfig is an app's HTTP health check settings
+type HealthCheckConfig struct {
+	Path            string `json:"path"`
+	IntervalSeconds int    `json:"interval_seconds"`
+}
+
+// GetHealthCheckConfig gets an app's health check path and interval
+func (r *AppRepo) GetHealthCheckConfig(ctx context.Context, appID string) (*HealthCheckConfig, error) {
+	var cfg HealthCheckConfig
 	err := r.pool.QueryRow(ctx,
-		"SELECT EXISTS(SELECT 1 FROM apps WHERE id = $1 AND user_id = $2)",
-		appID, userID,
-	).Scan(&exists)
-	if err != nil {
-		r.logger.Error("Failed to check app ownership", zap.Error(err), zap.String("app_id", appID), zap.String("user_id", userID))
-		return err
-	}
-	if !exists {
-		return pgx.ErrNoRows
-	}
-	
-	// Begin transaction to ensure atomic deletion of app and logs
-	tx, err := r.pool.Begin(ctx)
-	if err != nil {
-		r.logger.Error("Failed to begin transaction for app deletion", zap.Error(err), zap.String("app_id", appID))
-		return err
-	}
-	// Defer rollback - will be a no-op if Commit succeeds
-	defer func() {
-		if err := tx.Rollback(ctx); err != nil && err != pgx.ErrTxClosed {
-			r.logger.Warn("Transaction rollback error (may be expected if commit succeeded)", zap.Error(err))
-		}
-	}()
-	
-	// Step 1: Delete all app_logs associated with this app
-	// Note: app_logs uses TEXT for app_id, so it doesn't cascade automatically
-	// Note: app_logs table is optional (only exists if Postgres log persistence is enabled)
-	// Check if table exists before attempting to delete
-	var tableExists bool
-	err = tx.QueryRow(ctx,
-		`SELECT EXISTS (
-			SELECT FROM information_schema.tables 
-			WHERE table_schema = 'public' 
-			AND table_name = 'app_logs'
-		)`,
-	).Scan(&tableExists)
+		"SELECT health_check_path, health_check_interval_seconds FROM apps WHERE id = $1",
+		appID,
+	).Scan(&cfg.Path, &cfg.IntervalSeconds)
 	if err != nil {
-		r.logger.Error("Failed to check if app_logs table exists", zap.Error(err), zap.String("app_id", appID))
-		return err
-	}
-	
-	if tableExists {
-		logsResult, err := tx.Exec(ctx,
-			"DELETE FROM app_logs WHERE app_id = $1",
-			appID,
-		)
-		if err != nil {
-			r.logger.Error("Failed to delete app logs", zap.Error(err), zap.String("app_id", appID))
-			return err
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
 		}
-		r.logger.Info("Deleted app logs", 
-			zap.String("app_id", appID), 
-			zap.Int64("logs_deleted", logsResult.RowsAffected()),
-		)
-	} else {
-		r.logger.Debug("app_logs table does not exist, skipping log deletion", zap.String("app_id", appID))
+		r.logger.Error("Failed to get health check config", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
 	}
-	
-	// Step 2: Delete the app (cascade will handle related records: build_jobs, deployments, env_vars, runtime_instances)
-	result, err := tx.Exec(ctx,
-		"DELETE FROM apps WHERE id = $1 AND user_id = $2",
-		appID, userID,
+	return &cfg, nil
+}
+
+// UpdateHealthCheckConfig sets an app's health check path and interval (applies from the next deployment)
+func (r *AppRepo) UpdateHealthCheckConfig(ctx context.Context, appID string, cfg HealthCheckConfig) error {
+	result, err := r.pool.Exec(ctx,
+		`UPDATE apps SET health_check_path = $2, health_check_interval_seconds = $3, updated_at = NOW()
+		 WHERE id = $1`,
+		appID, cfg.Path, cfg.IntervalSeconds,
 	)
 	if err != nil {
-		// Transaction is aborted, return error (defer will handle rollback)
-		r.logger.Error("Failed to delete app", zap.Error(err), zap.String("app_id", appID), zap.String("user_id", userID))
+		r.logger.Error("Failed to update health check config", zap.Error(err), zap.String("app_id", appID))
 		return err
 	}
-	
 	if result.RowsAffected() == 0 {
-		r.logger.Warn("No app deleted", zap.String("app_id", appID), zap.String("user_id", userID))
 		return pgx.ErrNoRows
 	}
-	
-	// Commit transaction (this will prevent the defer rollback from executing)
-	if err := tx.Commit(ctx); err != nil {
-		r.logger.Error("Failed to commit transaction for app deletion", zap.Error(err), zap.String("app_id", appID))
-		return err
-	}
-	
-	r.logger.Info("App and all associated resources deleted successfully", 
-		zap.String("app_id", appID), 
-		zap.String("user_id", userID),
-	)
 	return nil
 }
 
-// UpdateApp updates app status and URL
-func (r *AppRepo) UpdateApp(appID, status, url string) error {
-	ctx := context.Background()
-	
-	var urlValue sql.NullString
-	if url != "" {
-		urlValue = sql.NullString{String: url, Valid: true}
+// MarkFirstDeployed records an app's first successful deployment
+// Reports whether this call set it, so exactly one deployment of each app counts as the first
+func (r *AppRepo) MarkFirstDeployed(ctx context.Context, appID string) (bool, error) {
+	result, err := r.pool.Exec(ctx,
+		`UPDATE apps SET first_deployed_at = NOW() WHERE id = $1 AND first_deployed_at IS NULL`,
+		appID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to mark app first deployed", zap.Error(err), zap.String("app_id", appID))
+		return false, err
 	}
-	
+	if result.RowsAffected() == 0 {
+		return false, nil
+	}
+	r.invalidateOwnerApps(ctx, appID)
+	return true, nil
+}
+
+// SetAppImage makes an app an image app running imageRef. Takes effect on the next deployment; the
+// digest the current deployment runs stays until then
+func (r *AppRepo) SetAppImage(ctx context.Context, appID, imageRef string) error {
 	_, err := r.pool.Exec(ctx,
-		`UPDATE apps SET status = $1, url = $2, updated_at = NOW() WHERE id = $3`,
-		status, urlValue, appID,
+		`UPDATE apps SET source_type = 'image', image_ref = $2, image_latest_digest = NULL, image_checked_at = NULL, updated_at = NOW()
+		 WHERE id = $1`,
+		appID, imageRef,
 	)
 	if err != nil {
-		r.logger.Error("Failed to update app", zap.Error(err), zap.String("app_id", appID), zap.String("status", status))
+		r.logger.Error("Failed to set app image", zap.Error(err), zap.String("app_id", appID))
 		return err
 	}
-	
-	r.logger.Info("App updated successfully", zap.String("app_id", appID), zap.String("status", status), zap.String("url", url))
+	r.invalidateOwnerApps(ctx, appID)
 	return nil
 }
 
-// DeploymentRepo implements deployment repository using database
-type DeploymentRepo struct {
-	pool   *pgxpool.Pool
-	logger *zap.Logger
-}
-
-// NewDeploymentRepo creates a new deployment repository
-func NewDeploymentRepo(pool *pgxpool.Pool, logger *zap.Logger) *DeploymentRepo {
-	return &DeploymentRepo{
-		pool:   pool,
-		logger: logger,
+// GetBaseImageStatus returns the base image an app was last built from and what its registry serves now
+func (r *AppRepo) GetBaseImageStatus(ctx context.Context, appID string) (*BaseImageStatus, error) {
+	var image, digest, latestDigest sql.NullString
+	var checkedAt sql.NullTime
+	status := &BaseImageStatus{}
+	err := r.pool.QueryRow(ctx,
+		`SELECT base_image, base_image_digest, base_image_latest_digest, base_image_checked_at, auto_security_rebuild
+		 FROM apps WHERE id = $1`,
+		appID,
+	).Scan(&image, &digest, &latestDigest, &checkedAt, &status.AutoRebuild)
+	if err != nil {
+		return nil, err
+	}
+	status.Image = image.String
+	status.Digest = digest.String
+	status.LatestDigest = latestDigest.String
+	if checkedAt.Valid {
+		status.CheckedAt = checkedAt.Time.Format(time.RFC3339)
 	}
+	status.UpdateAvailable = status.Digest != "" && status.LatestDigest != "" && status.LatestDigest != status.Digest
+	return status, nil
 }
 
-// CreateDeployment creates a new deployment record
-// Returns the deployment UUID as a string
-// build_job_id is optional (can be NULL) since it has a foreign key constraint
-func (r *DeploymentRepo) CreateDeployment(appID, buildJobID, status, imageName, containerID, subdomain string) (string, error) {
-	ctx := context.Background()
-	var id string
-	// Build job ID is optional - verify it exists in build_jobs table before using it
-	// This prevents foreign key constraint violations
-	var buildJobIDPtr interface{}
-	if buildJobID != "" {
-		// Verify build_job exists before using it
-		var exists bool
-		err := r.pool.QueryRow(ctx,
-			`SELECT EXISTS(SELECT 1 FROM build_jobs WHERE id = $1)`,
-			buildJobID,
-		).Scan(&exists)
-		if err == nil && exists {
-			buildJobIDPtr = buildJobID
-			r.logger.Debug("Build job found in database, using build_job_id",
-				zap.String("build_job_id", buildJobID),
-				zap.String("app_id", appID),
-			)
-		} else {
-			// Build job doesn't exist, use NULL instead
-			// This prevents foreign key constraint violations
-			// NOTE: This means build logs won't be retrievable for this deployment
-			// TODO: Create build_job record in database before creating deployment
-			if err != nil {
-				r.logger.Warn("Failed to check if build job exists, using NULL for build_job_id",
-					zap.Error(err),
-					zap.String("build_job_id", buildJobID),
-					zap.String("app_id", appID),
-				)
-			} else {
-				r.logger.Warn("Build job not found in database, using NULL for build_job_id (build logs won't be retrievable)",
-					zap.String("build_job_id", buildJobID),
-					zap.String("app_id", appID),
-					zap.String("suggestion", "Ensure build_job is created in build_jobs table before creating deployment"),
-				)
-			}
-			buildJobIDPtr = nil
-		}
-	} else {
-		buildJobIDPtr = nil
+// SetAutoSecurityRebuild turns automatic rebuilds on new base image digests on or off
+func (r *AppRepo) SetAutoSecurityRebuild(ctx context.Context, appID string, enabled bool) error {
+	_, err := r.pool.Exec(ctx, `UPDATE apps SET auto_security_rebuild = $2, updated_at = NOW() WHERE id = $1`, appID, enabled)
+	if err != nil {
+		r.logger.Error("Failed to set auto security rebuild", zap.Error(err), zap.String("app_id", appID))
+		return err
 	}
-	
-	err := r.pool.QueryRow(ctx,
-		`INSERT INTO deployments (app_id, build_job_id, status, image_name, container_id, subdomain)
-		 VALUES ($1, $2, $3, $4, $5, $6)
-		 RETURNING id`,
-		appID, buildJobIDPtr, status, imageName, containerID, subdomain,
-	).Scan(&id)
+	return nil
+}
+
+// GetAppResources returns the RAM (MB) and disk (GB) allocated to an app
+func (r *AppRepo) GetAppResources(ctx context.Context, appID string) (ramMB, diskGB int, err error) {
+	err = r.pool.QueryRow(ctx, `SELECT ram_mb, disk_gb FROM apps WHERE id = $1`, appID).Scan(&ramMB, &diskGB)
+	return ramMB, diskGB, err
+}
+
+// GetReleaseCommand returns the command an app's deployments run before taking traffic ("" when none is set)
+func (r *AppRepo) GetReleaseCommand(ctx context.Context, appID string) (string, error) {
+	var command sql.NullString
+	err := r.pool.QueryRow(ctx, `SELECT release_command FROM apps WHERE id = $1`, appID).Scan(&command)
 	if err != nil {
-		r.logger.Error("Failed to create deployment",
-			zap.Error(err),
-			zap.String("app_id", appID),
-			zap.String("build_job_id", buildJobID),
-			zap.String("build_job_id_ptr", fmt.Sprintf("%v", buildJobIDPtr)),
-		)
 		return "", err
 	}
-	
-	r.logger.Info("Deployment created successfully",
-		zap.String("deployment_id", id),
-		zap.String("app_id", appID),
-		zap.String("build_job_id", buildJobID),
-		zap.Bool("has_build_job_id", buildJobID != "" && buildJobIDPtr != nil),
-	)
-	return id, nil
+	return command.String, nil
 }
 
-// UpdateDeployment updates deployment status and details
-func (r *DeploymentRepo) UpdateDeployment(deploymentID, status, imageName, containerID, subdomain, errorMsg string) error {
-	ctx := context.Background()
-	// Sanitize error message to remove NULL bytes (PostgreSQL TEXT cannot contain 0x00)
-	if errorMsg != "" {
-		errorMsg = strings.ReplaceAll(errorMsg, "\x00", "")
-	}
+// SetReleaseCommand sets the release phase command of an app; an empty command removes it
+func (r *AppRepo) SetReleaseCommand(ctx context.Context, appID, command string) error {
 	_, err := r.pool.Exec(ctx,
-		`UPDATE deployments 
-		 SET status = COALESCE(NULLIF($2, ''), status),
-		     image_name = COALESCE(NULLIF($3, ''), image_name),
-		     container_id = COALESCE(NULLIF($4, ''), container_id),
-		     subdomain = COALESCE(NULLIF($5, ''), subdomain),
-		     error_message = COALESCE(NULLIF($6, ''), error_message),
-		     updated_at = NOW()
-		 WHERE id = $1`,
-		deploymentID, status, imageName, containerID, subdomain, errorMsg,
+		`UPDATE apps SET release_command = NULLIF($2, ''), updated_at = NOW() WHERE id = $1`,
+		appID, command,
 	)
 	if err != nil {
-		r.logger.Error("Failed to update deployment", zap.Error(err), zap.String("deployment_id", deploymentID))
+		r.logger.Error("Failed to set release command", zap.Error(err), zap.String("app_id", appID))
 		return err
 	}
 	return nil
 }
 
-// GetDeploymentsByAppID retrieves all deployments for an app
-func (r *DeploymentRepo) GetDeploymentsByAppID(appID string) ([]map[string]interface{}, error) {
-	ctx := context.Background()
-	rows, err := r.pool.Query(ctx,
-		`SELECT id, app_id, build_job_id, status, image_name, container_id, subdomain, 
-		        build_log, runtime_log, error_message, created_at, updated_at
-		 FROM deployments
-		 WHERE app_id = $1
-		 ORDER BY created_at DESC`,
-		appID,
-	)
+// GetIsolation returns the isolation level an app opted into on top of its plan's ("" when none)
+func (r *AppRepo) GetIsolation(ctx context.Context, appID string) (string, error) {
+	var isolation sql.NullString
+	err := r.pool.QueryRow(ctx, `SELECT isolation FROM apps WHERE id = $1`, appID).Scan(&isolation)
 	if err != nil {
-		r.logger.Error("Failed to get deployments", zap.Error(err), zap.String("app_id", appID))
-		return nil, err
+		return "", err
 	}
-	defer rows.Close()
-
-	var deployments []map[string]interface{}
-	for rows.Next() {
-		var id, appID string // UUIDs are strings
-		var status string
-		var buildJobID, imageName, containerID, subdomain sql.NullString
-		var buildLog, runtimeLog, errorMsg sql.NullString
-		var createdAt, updatedAt time.Time
-
-		err := rows.Scan(
-			&id, &appID, &buildJobID, &status, &imageName, &containerID, &subdomain,
-			&buildLog, &runtimeLog, &errorMsg, &createdAt, &updatedAt,
-		)
-		if err != nil {
-			r.logger.Error("Failed to scan deployment", zap.Error(err))
-			continue
-		}
+	return isolation.String, nil
+}
 
-		deployment := map[string]interface{}{
-			"id":         id,
-			"app_id":     appID,
-			"status":     status,
-			"created_at": createdAt.Format(time.RFC3339),
-			"updated_at": updatedAt.Format(time.RFC3339),
-		}
+// SetIsolation sets the isolation level of an app; an empty level leaves it to the plan
+func (r *AppRepo) SetIsolation(ctx context.Context, appID, isolation string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE apps SET isolation = NULLIF($2, ''), updated_at = NOW() WHERE id = $1`,
+		appID, isolation,
+	)
+	if err != nil {
+		r.logger.Error("Failed to set isolation", zap.Error(err), zap.String("app_id", appID))
+		return err
+	}
+	return nil
+}
 
-		if buildJobID.Valid {
-			deployment["build_job_id"] = buildJobID.String
-		}
-		if imageName.Valid {
-			deployment["image_name"] = map[string]interface{}{"String": imageName.String, "Valid": true}
-		} else {
-			deployment["image_name"] = map[string]interface{}{"String": "", "Valid": false}
-		}
-		if containerID.Valid {
-			deployment["container_id"] = map[string]interface{}{"String": containerID.String, "Valid": true}
-		} else {
-			deployment["container_id"] = map[string]interface{}{"String": "", "Valid": false}
-		}
-		if subdomain.Valid {
-			deployment["subdomain"] = map[string]interface{}{"String": subdomain.String, "Valid": true}
-		} else {
-			deployment["subdomain"] = map[string]interface{}{"String": "", "Valid": false}
-		}
-		if buildLog.Valid {
-			deployment["build_log"] = map[string]interface{}{"String": buildLog.String, "Valid": true}
-		} else {
-			deployment["build_log"] = map[string]interface{}{"String": "", "Valid": false}
-		}
-		if runtimeLog.Valid {
-			deployment["runtime_log"] = map[string]interface{}{"String": runtimeLog.String, "Valid": true}
-		} else {
-			deployment["runtime_log"] = map[string]interface{}{"String": "", "Valid": false}
-		}
-		if errorMsg.Valid {
-			deployment["error_message"] = map[string]interface{}{"String": errorMsg.String, "Valid": true}
-		} else {
-			deployment["error_message"] = map[string]interface{}{"String": "", "Valid": false}
-		}
+// GetBuildStrategy returns how an app's source is built into an image (services.BuildStrategy*)
+func (r *AppRepo) GetBuildStrategy(ctx context.Context, appID string) (string, error) {
+	var strategy string
+	err := r.pool.QueryRow(ctx, `SELECT build_strategy FROM apps WHERE id = $1`, appID).Scan(&strategy)
+	if err != nil {
+		return "", err
+	}
+	return strategy, nil
+}
 
-		deployments = append(deployments, deployment)
+// SetBuildStrategy sets how an app's source is built into an image
+func (r *AppRepo) SetBuildStrategy(ctx context.Context, appID, strategy string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE apps SET build_strategy = $2, updated_at = NOW() WHERE id = $1`,
+		appID, strategy,
+	)
+	if err != nil {
+		r.logger.Error("Failed to set build strategy", zap.Error(err), zap.String("app_id", appID))
+		return err
 	}
+	return nil
+}
 
-	if err := rows.Err(); err != nil {
-		r.logger.Error("Error iterating deployments", zap.Error(err))
-		return nil, err
+// GetSecretScanMode returns what builds of an app do about committed credentials (services.SecretScan*)
+func (r *AppRepo) GetSecretScanMode(ctx context.Context, appID string) (string, error) {
+	var mode string
+	err := r.pool.QueryRow(ctx, `SELECT secret_scan FROM apps WHERE id = $1`, appID).Scan(&mode)
+	if err != nil {
+		return "", err
 	}
+	return mode, nil
+}
 
-	return deployments, nil
+// SetSecretScanMode sets what builds of an app do about committed credentials
+func (r *AppRepo) SetSecretScanMode(ctx context.Context, appID, mode string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE apps SET secret_scan = $2, updated_at = NOW() WHERE id = $1`,
+		appID, mode,
+	)
+	if err != nil {
+		r.logger.Error("Failed to set secret scan mode", zap.Error(err), zap.String("app_id", appID))
+		return err
+	}
+	return nil
 }
 
-// UpdateDeploymentsByContainerIDs updates deployment status for multiple containers
-func (r *DeploymentRepo) UpdateDeploymentsByContainerIDs(ctx context.Context, containerIDs []string, status string) error {
-	if len(containerIDs) == 0 {
-		return nil
+// GetDeployHookSecret returns the secret of an app's push webhooks ("" when they are off)
+func (r *AppRepo) GetDeployHookSecret(ctx context.Context, appID string) (string, error) {
+	var secret sql.NullString
+	err := r.pool.QueryRow(ctx, `SELECT deploy_hook_secret FROM apps WHERE id = $1`, appID).Scan(&secret)
+	if err != nil {
+		return "", err
 	}
-	
+	return secret.String, nil
+}
+
+// SetDeployHookSecret sets the secret of an app's push webhooks; an empty secret turns them off
+func (r *AppRepo) SetDeployHookSecret(ctx context.Context, appID, secret string) error {
 	_, err := r.pool.Exec(ctx,
-		`UPDATE deployments 
-		 SET status = $1, updated_at = NOW()
-		 WHERE container_id = ANY($2::text[])`,
-		status, containerIDs,
+		`UPDATE apps SET deploy_hook_secret = NULLIF($2, ''), updated_at = NOW() WHERE id = $1`,
+		appID, secret,
 	)
 	if err != nil {
-		r.logger.Error("Failed to update deployments by container IDs", 
-			zap.Error(err), 
-			zap.Strings("container_ids", containerIDs),
-			zap.String("status", status),
-		)
+		r.logger.Error("Failed to set deploy hook secret", zap.Error(err), zap.String("app_id", appID))
 		return err
 	}
-	
-	r.logger.Info("Updated deployments to stopped status",
-		zap.Int("count", len(containerIDs)),
-		zap.String("status", status),
-	)
 	return nil
 }
 
-// GetDeploymentByID retrieves a deployment by ID
-func (r *DeploymentRepo) GetDeploymentByID(deploymentID string) (map[string]interface{}, error) {
-	ctx := context.Background()
-	var id, appID string // UUIDs are strings
-	var status string
-	var buildJobID, imageName, containerID, subdomain sql.NullString
-	var buildLog, runtimeLog, errorMsg sql.NullString
-	var createdAt, updatedAt time.Time
+// DeployHookApp is an app a push webhook may deploy, with the secret deliveries for it are verified against
+type DeployHookApp struct {
+	App    App
+	Secret string
+}
 
-	err := r.pool.QueryRow(ctx,
-		`SELECT id, app_id, build_job_id, status, image_name, container_id, subdomain,
-		        build_log, runtime_log, error_message, created_at, updated_at
-		 FROM deployments
-		 WHERE id = $1`,
-		deploymentID,
-	).Scan(
-		&id, &appID, &buildJobID, &status, &imageName, &containerID, &subdomain,
-		&buildLog, &runtimeLog, &errorMsg, &createdAt, &updatedAt,
+// GetDeployHookApps returns the repository apps with push webhooks on that deploy branch of one of the
+// repositories in repoKeys (lowercase host/owner/repo, see repoKey)
+func (r *AppRepo) GetDeployHookApps(ctx context.Context, repoKeys []string, branch string) ([]DeployHookApp, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, name, slug, status, repo_url, branch, root_dir, user_id, organization_id, source_type, deploy_hook_secret
+		 FROM apps
+		 WHERE deploy_hook_secret IS NOT NULL AND branch = $2 AND source_type <> 'image'
+		   AND lower(regexp_replace(regexp_replace(repo_url, '^https?://', ''), '(\.git)?/*$', '')) = ANY($1)`,
+		repoKeys, branch,
 	)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, pgx.ErrNoRows
-		}
-		r.logger.Error("Failed to get deployment", zap.Error(err), zap.String("deployment_id", deploymentID))
+		r.logger.Error("Failed to get deploy hook apps", zap.Error(err), zap.Strings("repo_keys", repoKeys), zap.String("branch", branch))
 		return nil, err
 	}
+	defer rows.Close()
 
-	deployment := map[string]interface{}{
-		"id":         id,
-		"app_id":     appID,
-		"status":     status,
-		"created_at": createdAt.Format(time.RFC3339),
-		"updated_at": updatedAt.Format(time.RFC3339),
+	var apps []DeployHookApp
+	for rows.Next() {
+		var hookApp DeployHookApp
+		var organizationID sql.NullString
+		app := &hookApp.App
+		if err := rows.Scan(&app.ID, &app.Name, &app.Slug, &app.Status, &app.RepoURL, &app.Branch, &app.RootDir,
+			&app.UserID, &organizationID, &app.Source, &hookApp.Secret); err != nil {
+			return nil, err
+		}
+		app.OrganizationID = organizationID.String
+		apps = append(apps, hookApp)
 	}
+	return apps, rows.Err()
+}
 
-	// Always include build_job_id, even if NULL (for debugging and API consistency)
-	if buildJobID.Valid {
-		deployment["build_job_id"] = buildJobID.String
-	} else {
-		deployment["build_job_id"] = nil // Explicitly set to nil so we know it exists but is NULL
+// SyncAppProcesses replaces an app's Procfile processes with those of its latest build
+// Processes that are still declared keep their enabled flag; removed ones are dropped
+func (r *AppRepo) SyncAppProcesses(ctx context.Context, appID string, processes []services.ProcessType) error {
+	names := make([]string, 0, len(processes))
+	commands := make([]string, 0, len(processes))
+	for _, process := range processes {
+		names = append(names, process.Name)
+		commands = append(commands, process.Command)
 	}
-	if imageName.Valid {
-		deployment["image_name"] = map[string]interface{}{"String": imageName.String, "Valid": true}
-	} else {
-		deployment["image_name"] = map[string]interface{}{"String": "", "Valid": false}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("Failed to begin transaction for app processes", zap.Error(err), zap.String("app_id", appID))
+		return err
 	}
-	if containerID.Valid {
-		deployment["container_id"] = map[string]interface{}{"String": containerID.String, "Valid": true}
-	} else {
-		deployment["container_id"] = map[string]interface{}{"String": "", "Valid": false}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && err != pgx.ErrTxClosed {
+			r.logger.Warn("Transaction rollback error (may be expected if commit succeeded)", zap.Error(err))
+		}
+	}()
+
+	if _, err := tx.Exec(ctx, `DELETE FROM app_processes WHERE app_id = $1 AND name <> ALL($2)`, appID, names); err != nil {
+		r.logger.Error("Failed to delete removed app processes", zap.Error(err), zap.String("app_id", appID))
+		return err
 	}
-	if subdomain.Valid {
-		deployment["subdomain"] = map[string]interface{}{"String": subdomain.String, "Valid": true}
-	} else {
-		deployment["subdomain"] = map[string]interface{}{"String": "", "Valid": false}
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO app_processes (app_id, name, command)
+		 SELECT $1, name, command FROM UNNEST($2::text[], $3::text[]) AS p(name, command)
+		 ON CONFLICT (app_id, name) DO UPDATE SET command = EXCLUDED.command, updated_at = NOW()
+		 WHERE app_processes.command <> EXCLUDED.command`,
+		appID, names, commands,
+	); err != nil {
+		r.logger.Error("Failed to store app processes", zap.Error(err), zap.String("app_id", appID))
+		return err
 	}
-	if buildLog.Valid {
-		deployment["build_log"] = map[string]interface{}{"String": buildLog.String, "Valid": true}
-	} else {
-		deployment["build_log"] = map[string]interface{}{"String": "", "Valid": false}
+
+	if err := tx.Commit(ctx); err != nil {
+		r.logger.Error("Failed to commit app processes", zap.Error(err), zap.String("app_id", appID))
+		return err
 	}
-	if runtimeLog.Valid {
-		deployment["runtime_log"] = map[string]interface{}{"String": runtimeLog.String, "Valid": true}
-	} else {
-		deployment["runtime_log"] = map[string]interface{}{"String": "", "Valid": false}
-	}
-	if errorMsg.Valid {
-		deployment["error_message"] = map[string]interface{}{"String": errorMsg.String, "Valid": true}
-	} else {
-		deployment["error_message"] = map[string]interface{}{"String": "", "Valid": false}
-	}
-
-	return deployment, nil
-}
-
-// PlanRepo implements plan repository using database
-type PlanRepo struct {
-	pool   *pgxpool.Pool
-	logger *zap.Logger
+	return nil
 }
 
-// NewPlanRepo creates a new plan repository
-func NewPlanRepo(pool *pgxpool.Pool, logger *zap.Logger) *PlanRepo {
-	return &PlanRepo{
-		pool:   pool,
-		logger: logger,
+// ListAppProcesses lists the Procfile processes of an app's latest build by name
+func (r *AppRepo) ListAppProcesses(ctx context.Context, appID string) ([]AppProcess, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT name, command, enabled, updated_at FROM app_processes WHERE app_id = $1 ORDER BY name`,
+		appID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to list app processes", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
 	}
-}
+	defer rows.Close()
 
-// Plan represents a plan from the database
-type Plan struct {
-	ID               string    `json:"id"`
-	Name             string    `json:"name"`
-	DisplayName      string    `json:"display_name"`
-	Price            int       `json:"price"`
-	MaxRAMMB         int       `json:"max_ram_mb"`
-	MaxDiskMB        int       `json:"max_disk_mb"`
-	MaxApps          int       `json:"max_apps"`
-	AlwaysOn         bool      `json:"always_on"`
-	AutoDeploy       bool      `json:"auto_deploy"`
-	HealthChecks     bool      `json:"health_checks"`
-	Logs             bool      `json:"logs"`
-	ZeroDowntime     bool      `json:"zero_downtime"`
-	Workers          bool      `json:"workers"`
-	PriorityBuilds   bool      `json:"priority_builds"`
-	ManualDeployOnly bool      `json:"manual_deploy_only"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
+	processes := []AppProcess{}
+	for rows.Next() {
+		process, err := scanAppProcess(rows)
+		if err != nil {
+			return nil, err
+		}
+		processes = append(processes, *process)
+	}
+	return processes, rows.Err()
 }
 
-// GetPlanByID retrieves a plan by ID
-func (r *PlanRepo) GetPlanByID(ctx context.Context, planID string) (*Plan, error) {
-	var plan Plan
-	err := r.pool.QueryRow(ctx,
-		`SELECT id, name, display_name, price, max_ram_mb, max_disk_mb, max_apps,
-		        always_on, auto_deploy, health_checks, logs, zero_downtime,
-		        workers, priority_builds, manual_deploy_only, created_at, updated_at
-		 FROM plans
-		 WHERE id = $1`,
-		planID,
-	).Scan(
-		&plan.ID, &plan.Name, &plan.DisplayName, &plan.Price,
-		&plan.MaxRAMMB, &plan.MaxDiskMB, &plan.MaxApps,
-		&plan.AlwaysOn, &plan.AutoDeploy, &plan.HealthChecks, &plan.Logs,
-		&plan.ZeroDowntime, &plan.Workers, &plan.PriorityBuilds,
-		&plan.ManualDeployOnly, &plan.CreatedAt, &plan.UpdatedAt,
-	)
+// SetAppProcessEnabled turns a worker process on or off; returns pgx.ErrNoRows when the app's
+// Procfile does not declare it
+func (r *AppRepo) SetAppProcessEnabled(ctx context.Context, appID, name string, enabled bool) (*AppProcess, error) {
+	process, err := scanAppProcess(r.pool.QueryRow(ctx,
+		`UPDATE app_processes SET enabled = $3, updated_at = NOW()
+		 WHERE app_id = $1 AND name = $2
+		 RETURNING name, command, enabled, updated_at`,
+		appID, name, enabled,
+	))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, pgx.ErrNoRows
 		}
-		r.logger.Error("Failed to get plan by ID", zap.Error(err), zap.String("plan_id", planID))
+		r.logger.Error("Failed to update app process", zap.Error(err), zap.String("app_id", appID), zap.String("process", name))
 		return nil, err
 	}
-	return &plan, nil
+	return process, nil
 }
 
-// GetPlanByName retrieves a plan by name
-func (r *PlanRepo) GetPlanByName(ctx context.Context, planName string) (*Plan, error) {
-	var plan Plan
-	err := r.pool.QueryRow(ctx,
-		`SELECT id, name, display_name, price, max_ram_mb, max_disk_mb, max_apps,
-		        always_on, auto_deploy, health_checks, logs, zero_downtime,
-		        workers, priority_builds, manual_deploy_only, created_at, updated_at
-		 FROM plans
-		 WHERE name = $1`,
-		planName,
-	).Scan(
-		&plan.ID, &plan.Name, &plan.DisplayName, &plan.Price,
-		&plan.MaxRAMMB, &plan.MaxDiskMB, &plan.MaxApps,
-		&plan.AlwaysOn, &plan.AutoDeploy, &plan.HealthChecks, &plan.Logs,
-		&plan.ZeroDowntime, &plan.Workers, &plan.PriorityBuilds,
-		&plan.ManualDeployOnly, &plan.CreatedAt, &plan.UpdatedAt,
+// GetEnabledProcesses returns the worker processes a deploy of the app should start
+func (r *AppRepo) GetEnabledProcesses(ctx context.Context, appID string) ([]services.ProcessType, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT name, command FROM app_processes WHERE app_id = $1 AND enabled ORDER BY name`,
+		appID,
 	)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, pgx.ErrNoRows
-		}
-		r.logger.Error("Failed to get plan by name", zap.Error(err), zap.String("plan_name", planName))
 		return nil, err
 	}
-	return &plan, nil
+	defer rows.Close()
+
+	var processes []services.ProcessType
+	for rows.Next() {
+		var process services.ProcessType
+		if err := rows.Scan(&process.Name, &process.Command); err != nil {
+			return nil, err
+		}
+		processes = append(processes, process)
+	}
+	return processes, rows.Err()
 }
 
-// GetDefaultPlan retrieves the default (starter) plan
-func (r *PlanRepo) GetDefaultPlan(ctx context.Context) (*Plan, error) {
-	return r.GetPlanByName(ctx, "starter")
+// scanAppProcess scans a name, command, enabled, updated_at row into an AppProcess
+func scanAppProcess(row pgx.Row) (*AppProcess, error) {
+	var process AppProcess
+	var updatedAt time.Time
+	if err := row.Scan(&process.Name, &process.Command, &process.Enabled, &updatedAt); err != nil {
+		return nil, err
+	}
+	process.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &process, nil
 }
 
-// SubscriptionRepo implements subscription repository using database
-type SubscriptionRepo struct {
-	pool   *pgxpool.Pool
-	logger *zap.Logger
+// SetImageDigest records the digest an image app's new deployment runs. The registry served it just now,
+// so it is also the latest digest known
+func (r *AppRepo) SetImageDigest(ctx context.Context, appID, digest string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE apps SET image_digest = $2, image_latest_digest = $2, image_checked_at = NOW() WHERE id = $1`,
+		appID, digest,
+	)
+	if err != nil {
+		r.logger.Error("Failed to set image digest", zap.Error(err), zap.String("app_id", appID))
+		return err
+	}
+	r.invalidateOwnerApps(ctx, appID)
+	return nil
 }
 
-// NewSubscriptionRepo creates a new subscription repository
-func NewSubscriptionRepo(pool *pgxpool.Pool, logger *zap.Logger) *SubscriptionRepo {
-	return &SubscriptionRepo{
-		pool:   pool,
-		logger: logger,
+// SetRegistryCredentials stores the login an image app pulls its image with, replacing any earlier one
+func (r *AppRepo) SetRegistryCredentials(ctx context.Context, appID, username, password string) error {
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO app_registry_credentials (app_id, username, password)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT (app_id) DO UPDATE SET username = EXCLUDED.username, password = EXCLUDED.password, updated_at = NOW()`,
+		appID, username, password,
+	)
+	if err != nil {
+		r.logger.Error("Failed to set registry credentials", zap.Error(err), zap.String("app_id", appID))
+		return err
 	}
+	return nil
 }
 
-// Subscription represents a subscription from the database
-type Subscription struct {
-	ID                 string     `json:"id"`
-	UserID             string     `json:"user_id"`
-	LemonSubscriptionID *string    `json:"lemon_subscription_id,omitempty"` // External subscription ID (e.g., Lemon Squeezy) - nullable
-	Plan               string     `json:"plan"`                             // Plan name (starter | pro)
-	Status             string     `json:"status"`                           // trial | active | expired | cancelled
-	TrialStartedAt     *time.Time `json:"trial_started_at,omitempty"`       // When trial started
-	TrialEndsAt        *time.Time `json:"trial_ends_at,omitempty"`          // When trial ends
-	RAMLimitMB         int        `json:"ram_limit_mb"`                     // RAM limit in MB
-	DiskLimitGB        int        `json:"disk_limit_gb"`                    // Disk limit in GB
-	CreatedAt          time.Time  `json:"created_at"`
-	UpdatedAt          time.Time  `json:"updated_at"`
+// DeleteRegistryCredentials removes an image app's registry login; its image is pulled anonymously after
+func (r *AppRepo) DeleteRegistryCredentials(ctx context.Context, appID string) error {
+	_, err := r.pool.Exec(ctx, "DELETE FROM app_registry_credentials WHERE app_id = $1", appID)
+	if err != nil {
+		r.logger.Error("Failed to delete registry credentials", zap.Error(err), zap.String("app_id", appID))
+		return err
+	}
+	return nil
 }
 
-// GetSubscriptionByUserID retrieves a subscription for a user
-// Prefers active or trial subscriptions over expired/cancelled ones
-func (r *SubscriptionRepo) GetSubscriptionByUserID(ctx context.Context, userID string) (*Subscription, error) {
-	var sub Subscription
-	var lemonSubID sql.NullString
-	var trialStartedAt, trialEndsAt sql.NullTime
-	
-	// First try to get an active or trial subscription
+// GetRegistryAuth gets the login an image app pulls its image with, or nil for public images
+func (r *AppRepo) GetRegistryAuth(ctx context.Context, appID string) (*services.RegistryAuth, error) {
+	var auth services.RegistryAuth
 	err := r.pool.QueryRow(ctx,
-		`SELECT id, user_id, lemon_subscription_id, plan, status, trial_started_at, trial_ends_at, 
-		        ram_limit_mb, disk_limit_gb, created_at, updated_at
-		 FROM subscriptions
-		 WHERE user_id = $1 AND status IN ('trial', 'active')
-		 ORDER BY created_at DESC
-		 LIMIT 1`,
-		userID,
-	).Scan(
-		&sub.ID, &sub.UserID, &lemonSubID, &sub.Plan, &sub.Status,
-		&trialStartedAt, &trialEndsAt, &sub.RAMLimitMB, &sub.DiskLimitGB,
-		&sub.CreatedAt, &sub.UpdatedAt,
-	)
-	
-	// If no active/trial subscription found, get the most recent one (might be expired)
-	if err != nil && errors.Is(err, pgx.ErrNoRows) {
-		err = r.pool.QueryRow(ctx,
-			`SELECT id, user_id, lemon_subscription_id, plan, status, trial_started_at, trial_ends_at, 
-			        ram_limit_mb, disk_limit_gb, created_at, updated_at
-			 FROM subscriptions
-			 WHERE user_id = $1
-			 ORDER BY created_at DESC
-			 LIMIT 1`,
-			userID,
-		).Scan(
-			&sub.ID, &sub.UserID, &lemonSubID, &sub.Plan, &sub.Status,
-			&trialStartedAt, &trialEndsAt, &sub.RAMLimitMB, &sub.DiskLimitGB,
-			&sub.CreatedAt, &sub.UpdatedAt,
-		)
-	}
+		"SELECT username, password FROM app_registry_credentials WHERE app_id = $1",
+		appID,
+	).Scan(&auth.Username, &auth.Password)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, pgx.ErrNoRows
+			return nil, nil
 		}
-		r.logger.Error("Failed to get subscription", zap.Error(err), zap.String("user_id", userID))
+		r.logger.Error("Failed to get registry credentials", zap.Error(err), zap.String("app_id", appID))
 		return nil, err
 	}
-	if lemonSubID.Valid {
-		sub.LemonSubscriptionID = &lemonSubID.String
-	}
-	if trialStartedAt.Valid {
-		sub.TrialStartedAt = &trialStartedAt.Time
-	}
-	if trialEndsAt.Valid {
-		sub.TrialEndsAt = &trialEndsAt.Time
-	}
-	return &sub, nil
+	return &auth, nil
 }
 
-// CreateSubscription creates a new subscription
-// If creating a trial, subscriptionID should be empty string and trial_started_at/trial_ends_at should be set
-func (r *SubscriptionRepo) CreateSubscription(ctx context.Context, userID, lemonSubscriptionID, plan, status string, trialStartedAt, trialEndsAt *time.Time, ramLimitMB, diskLimitGB int) (*Subscription, error) {
-	var sub Subscription
-	var lemonSubID sql.NullString
-	var trialStart, trialEnd sql.NullTime
-	
-	// Handle nullable lemon_subscription_id
-	var lemonSubIDPtr interface{}
-	if lemonSubscriptionID != "" {
-		lemonSubIDPtr = lemonSubscriptionID
-	} else {
-		lemonSubIDPtr = nil
-	}
-	
-	// Handle nullable trial dates
-	var trialStartPtr, trialEndPtr interface{}
-	if trialStartedAt != nil {
-		trialStartPtr = *trialStartedAt
-	} else {
-		trialStartPtr = nil
-	}
-	if trialEndsAt != nil {
-		trialEndPtr = *trialEndsAt
-	} else {
-		trialEndPtr = nil
-	}
-	
+// GetAppPresence gets the latest traffic snapshot the deploy worker stored for an app
+// Returns pgx.ErrNoRows when none has been taken
+func (r *AppRepo) GetAppPresence(ctx context.Context, appID string) (*AppPresence, error) {
+	var presence AppPresence
+	var sampledAt time.Time
 	err := r.pool.QueryRow(ctx,
-		`INSERT INTO subscriptions (user_id, lemon_subscription_id, plan, status, trial_started_at, trial_ends_at, ram_limit_mb, disk_limit_gb)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		 RETURNING id, user_id, lemon_subscription_id, plan, status, trial_started_at, trial_ends_at, ram_limit_mb, disk_limit_gb, created_at, updated_at`,
-		userID, lemonSubIDPtr, plan, status, trialStartPtr, trialEndPtr, ramLimitMB, diskLimitGB,
-	).Scan(
-		&sub.ID, &sub.UserID, &lemonSubID, &sub.Plan, &sub.Status,
-		&trialStart, &trialEnd, &sub.RAMLimitMB, &sub.DiskLimitGB,
-		&sub.CreatedAt, &sub.UpdatedAt,
-	)
+		`SELECT requests_last_minute, open_connections, window_seconds, sampled_at,
+		        sampled_at < NOW() - make_interval(secs => $2)
+		 FROM app_presence WHERE app_id = $1`,
+		appID, presenceStaleAfter.Seconds(),
+	).Scan(&presence.RequestsLastMinute, &presence.OpenConnections, &presence.WindowSeconds, &sampledAt, &presence.Stale)
 	if err != nil {
-		// Check if error is due to unique constraint (user already has active/trial subscription)
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-			// Unique constraint violation - user already has an active/trial subscription
-			// Try to get the existing subscription
-			r.logger.Warn("Unique constraint violation creating subscription, fetching existing",
-				zap.String("user_id", userID),
-				zap.String("pg_error_code", pgErr.Code),
-			)
-			existingSub, getErr := r.GetSubscriptionByUserID(ctx, userID)
-			if getErr == nil {
-				return existingSub, nil
-			}
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
 		}
-		r.logger.Error("Failed to create subscription", zap.Error(err), zap.String("user_id", userID))
+		r.logger.Error("Failed to get app presence", zap.Error(err), zap.String("app_id", appID))
 		return nil, err
 	}
-	if lemonSubID.Valid {
-		sub.LemonSubscriptionID = &lemonSubID.String
-	}
-	if trialStart.Valid {
-		sub.TrialStartedAt = &trialStart.Time
-	}
-	if trialEnd.Valid {
-		sub.TrialEndsAt = &trialEnd.Time
-	}
-	return &sub, nil
+	presence.AppID = appID
+	presence.SampledAt = sampledAt.Format(time.RFC3339)
+	return &presence, nil
 }
 
-// UpdateSubscription updates a subscription by internal ID
-func (r *SubscriptionRepo) UpdateSubscription(ctx context.Context, subscriptionID, plan, status string, ramLimitMB, diskLimitGB *int, lemonSubID *string) error {
-	setParts := []string{"updated_at = NOW()"}
-	args := []interface{}{subscriptionID}
-	argNum := 2
+// DeleteApp deletes an app by ID (must belong to the user)
+func (r *AppRepo) DeleteApp(appID, userID string) error {
+	ctx := context.Background()
 	
-	if plan != "" {
-		setParts = append(setParts, fmt.Sprintf("plan = $%d", argNum))
-		args = append(args, plan)
-		argNum++
+	// First verify the app exists and belongs to the user
+	var exists bool
+	err := r.pool.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM apps WHERE id = $1 AND user_id = $2)",
+		appID, userID,
+	).Scan(&exists)
+	if err != nil {
+		r.logger.Error("Failed to check app ownership", zap.Error(err), zap.String("app_id", appID), zap.String("user_id", userID))
+		return err
+	}
+	if !exists {
+		return pgx.ErrNoRows
+	}
+	
+	// Begin transaction to ensure atomic deletion of app and logs
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("Failed to begin transaction for app deletion", zap.Error(err), zap.String("app_id", appID))
+		return err
+	}
+	// Defer rollback - will be a no-op if Commit succeeds
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && err != pgx.ErrTxClosed {
+			r.logger.Warn("Transaction rollback error (may be expected if commit succeeded)", zap.Error(err))
+		}
+	}()
+	
+	// Step 1: Delete all app_logs associated with this app
+	// Note: app_logs uses TEXT for app_id, so it doesn't cascade automatically
+	// Note: app_logs table is optional (only exists if Postgres log persistence is enabled)
+	// Check if table exists before attempting to delete
+	var tableExists bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS (
+			SELECT FROM information_schema.tables 
+			WHERE table_schema = 'public' 
+			AND table_name = 'app_logs'
+		)`,
+	).Scan(&tableExists)
+	if err != nil {
+		r.logger.Error("Failed to check if app_logs table exists", zap.Error(err), zap.String("app_id", appID))
+		return err
+	}
+	
+	if tableExists {
+		logsResult, err := tx.Exec(ctx,
+			"DELETE FROM app_logs WHERE app_id = $1",
+			appID,
+		)
+		if err != nil {
+			r.logger.Error("Failed to delete app logs", zap.Error(err), zap.String("app_id", appID))
+			return err
+		}
+		r.logger.Info("Deleted app logs", 
+			zap.String("app_id", appID), 
+			zap.Int64("logs_deleted", logsResult.RowsAffected()),
+		)
+	} else {
+		r.logger.Debug("app_logs table does not exist, skipping log deletion", zap.String("app_id", appID))
+	}
+	
+	// Step 2: Delete the app (cascade will handle related records: build_jobs, deployments, env_vars, runtime_instances)
+	result, err := tx.Exec(ctx,
+		"DELETE FROM apps WHERE id = $1 AND user_id = $2",
+		appID, userID,
+	)
+	if err != nil {
+		// Transaction is aborted, return error (defer will handle rollback)
+		r.logger.Error("Failed to delete app", zap.Error(err), zap.String("app_id", appID), zap.String("user_id", userID))
+		return err
+	}
+	
+	if result.RowsAffected() == 0 {
+		r.logger.Warn("No app deleted", zap.String("app_id", appID), zap.String("user_id", userID))
+		return pgx.ErrNoRows
+	}
+	
+	// Commit transaction (this will prevent the defer rollback from executing)
+	if err := tx.Commit(ctx); err != nil {
+		r.logger.Error("Failed to commit transaction for app deletion", zap.Error(err), zap.String("app_id", appID))
+		return err
+	}
+	r.cache.Invalidate(ctx, appsCacheKey(userID))
+	
+	r.logger.Info("App and all associated resources deleted successfully", 
+		zap.String("app_id", appID), 
+		zap.String("user_id", userID),
+	)
+	return nil
+}
+
+// UpdateApp updates app status and URL
+func (r *AppRepo) UpdateApp(appID, status, url string) error {
+	ctx := context.Background()
+	
+	var urlValue sql.NullString
+	if url != "" {
+		urlValue = sql.NullString{String: url, Valid: true}
+	}
+	
+	_, err := r.pool.Exec(ctx,
+		`UPDATE apps SET status = $1, url = $2, status_reason = NULL, updated_at = NOW() WHERE id = $3`,
+		status, urlValue, appID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to update app", zap.Error(err), zap.String("app_id", appID), zap.String("status", status))
+		return err
+	}
+	r.invalidateOwnerApps(ctx, appID)
+	
+	r.logger.Info("App updated successfully", zap.String("app_id", appID), zap.String("status", status), zap.String("url", url))
+	return nil
+}
+
+// DisableApp marks an app as disabled and records why (shown to the user alongside the status)
+// Unlike UpdateApp, the app URL is preserved so it can be restored when the app is re-enabled
+func (r *AppRepo) DisableApp(ctx context.Context, appID, reason string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE apps SET status = 'disabled', status_reason = $1, updated_at = NOW() WHERE id = $2`,
+		reason, appID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to disable app", zap.Error(err), zap.String("app_id", appID))
+		return err
+	}
+	r.invalidateOwnerApps(ctx, appID)
+
+	r.logger.Info("App disabled", zap.String("app_id", appID), zap.String("reason", reason))
+	return nil
+}
+
+// StartAppStop moves a running, sleeping or failed app to stopping. Returns false when the app is in
+// none of those states (already stopped, mid-deploy, or another stop or start is under way)
+func (r *AppRepo) StartAppStop(ctx context.Context, appID string) (bool, error) {
+	return r.startAppPowerChange(ctx, appID, "stopping", "running", "sleeping", "failed")
+}
+
+// StartAppStart moves a stopped app to starting. Returns false when the app was not stopped
+func (r *AppRepo) StartAppStart(ctx context.Context, appID string) (bool, error) {
+	return r.startAppPowerChange(ctx, appID, "starting", "stopped")
+}
+
+// startAppPowerChange moves an app in one of the from states to status
+func (r *AppRepo) startAppPowerChange(ctx context.Context, appID, status string, from ...string) (bool, error) {
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE apps SET status = $2, status_reason = NULL, updated_at = NOW() WHERE id = $1 AND status = ANY($3)`,
+		appID, status, from,
+	)
+	if err != nil {
+		r.logger.Error("Failed to update app status", zap.Error(err), zap.String("app_id", appID), zap.String("status", status))
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+	r.invalidateOwnerApps(ctx, appID)
+	return true, nil
+}
+
+// MarkAppStopped marks a stopping app as stopped once its containers are stopped
+func (r *AppRepo) MarkAppStopped(ctx context.Context, appID string) error {
+	return r.finishAppPowerChange(ctx, appID, "stopping", "stopped", "")
+}
+
+// MarkAppStarted marks a starting app as running. Its idle time restarts from now
+func (r *AppRepo) MarkAppStarted(ctx context.Context, appID string) error {
+	return r.finishAppPowerChange(ctx, appID, "starting", "running", "")
+}
+
+// MarkAppPowerFailed marks an app that could not be stopped or started as failed, with the reason shown to its owner
+func (r *AppRepo) MarkAppPowerFailed(ctx context.Context, appID, reason string) error {
+	if err := r.finishAppPowerChange(ctx, appID, "stopping", "failed", reason); err != nil {
+		return err
+	}
+	return r.finishAppPowerChange(ctx, appID, "starting", "failed", reason)
+}
+
+// RevertAppPowerChange puts a stopping or starting app back in status, for a stop or start that was never queued
+func (r *AppRepo) RevertAppPowerChange(ctx context.Context, appID, status string) error {
+	if err := r.finishAppPowerChange(ctx, appID, "stopping", status, ""); err != nil {
+		return err
+	}
+	return r.finishAppPowerChange(ctx, appID, "starting", status, "")
+}
+
+// finishAppPowerChange moves an app that is still in from to status. A deploy or another change that
+// took over the app in the meantime is left alone
+func (r *AppRepo) finishAppPowerChange(ctx context.Context, appID, from, status, reason string) error {
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE apps SET status = $3, status_reason = NULLIF($4, ''),
+		        last_request_at = CASE WHEN $3 = 'running' THEN NOW() ELSE last_request_at END,
+		        updated_at = NOW()
+		 WHERE id = $1 AND status = $2`,
+		appID, from, status, reason,
+	)
+	if err != nil {
+		r.logger.Error("Failed to update app status", zap.Error(err), zap.String("app_id", appID), zap.String("status", status))
+		return err
+	}
+	if tag.RowsAffected() > 0 {
+		r.invalidateOwnerApps(ctx, appID)
+	}
+	return nil
+}
+
+// DeploymentRepo implements deployment repository using database
+type DeploymentRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+	cache  *services.ReadCache // Optional - see SetCache
+}
+
+// NewDeploymentRepo creates a new deployment repository
+func NewDeploymentRepo(pool *pgxpool.Pool, logger *zap.Logger) *DeploymentRepo {
+	return &DeploymentRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// SetCache lets app status changes made here (build cancellation) drop the owner's cached app list
+func (r *DeploymentRepo) SetCache(cache *services.ReadCache) {
+	r.cache = cache
+}
+
+// CreateDeployment creates a new deployment record in its first state and records the creation event
+// Returns the deployment UUID as a string
+// build_job_id is optional (can be NULL) since it has a foreign key constraint
+func (r *DeploymentRepo) CreateDeployment(appID, buildJobID string, status deploystate.Status, imageName, containerID, subdomain string, change deploystate.Change) (string, error) {
+	ctx := context.Background()
+	// Build job ID is optional - verify it exists in build_jobs table before using it
+	// This prevents foreign key constraint violations
+	var buildJobIDPtr *string
+	if buildJobID != "" {
+		// Verify build_job exists before using it
+		var exists bool
+		err := r.pool.QueryRow(ctx,
+			`SELECT EXISTS(SELECT 1 FROM build_jobs WHERE id = $1)`,
+			buildJobID,
+		).Scan(&exists)
+		if err == nil && exists {
+			buildJobIDPtr = &buildJobID
+			r.logger.Debug("Build job found in database, using build_job_id",
+				zap.String("build_job_id", buildJobID),
+				zap.String("app_id", appID),
+			)
+		} else {
+			// Build job doesn't exist, use NULL instead
+			// This prevents foreign key constraint violations
+			// NOTE: This means build logs won't be retrievable for this deployment
+			// TODO: Create build_job record in database before creating deployment
+			if err != nil {
+				r.logger.Warn("Failed to check if build job exists, using NULL for build_job_id",
+					zap.Error(err),
+					zap.String("build_job_id", buildJobID),
+					zap.String("app_id", appID),
+				)
+			} else {
+				r.logger.Warn("Build job not found in database, using NULL for build_job_id (build logs won't be retrievable)",
+					zap.String("build_job_id", buildJobID),
+					zap.String("app_id", appID),
+					zap.String("suggestion", "Ensure build_job is created in build_jobs table before creating deployment"),
+				)
+			}
+			buildJobIDPtr = nil
+		}
+	} else {
+		buildJobIDPtr = nil
+	}
+	
+	id, err := deploystate.Insert(ctx, r.pool, deploystate.NewDeployment{
+		AppID:       appID,
+		BuildJobID:  buildJobIDPtr,
+		Status:      status,
+		ImageName:   imageName,
+		ContainerID: containerID,
+		Subdomain:   subdomain,
+	}, change)
+	if err != nil {
+		r.logger.Error("Failed to create deployment",
+			zap.Error(err),
+			zap.String("app_id", appID),
+			zap.String("build_job_id", buildJobID),
+			zap.String("status", string(status)),
+			zap.Bool("has_build_job_id", buildJobIDPtr != nil),
+		)
+		return "", err
+	}
+	
+	r.logger.Info("Deployment created successfully",
+		zap.String("deployment_id", id),
+		zap.String("app_id", appID),
+		zap.String("build_job_id", buildJobID),
+		zap.Bool("has_build_job_id", buildJobID != "" && buildJobIDPtr != nil),
+	)
+	return id, nil
+}
+
+// TransitionDeployment moves a deployment to a new status through the state machine
+// Returns a *deploystate.TransitionError if its current status does not allow it (e.g. a crash
+// reported for a deployment that was already stopped), or pgx.ErrNoRows if it does not exist
+func (r *DeploymentRepo) TransitionDeployment(ctx context.Context, deploymentID string, to deploystate.Status, change deploystate.Change) error {
+	from, err := deploystate.Transition(ctx, r.pool, deploymentID, to, change)
+	if err != nil {
+		if !errors.Is(err, deploystate.ErrIllegalTransition) && !errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error("Failed to transition deployment",
+				zap.Error(err),
+				zap.String("deployment_id", deploymentID),
+				zap.String("to", string(to)),
+			)
+		}
+		return err
+	}
+	r.logger.Debug("Deployment transitioned",
+		zap.String("deployment_id", deploymentID),
+		zap.String("from", string(from)),
+		zap.String("to", string(to)),
+		zap.String("actor", change.Actor),
+	)
+	return nil
+}
+
+// RecordRestart stores a deployment's total restart count and the reason for the latest restart
+func (r *DeploymentRepo) RecordRestart(ctx context.Context, deploymentID string, restartCount int, reason string) error {
+	reason = strings.ReplaceAll(reason, "\x00", "")
+	_, err := r.pool.Exec(ctx,
+		`UPDATE deployments
+		 SET restart_count = GREATEST(restart_count, $2),
+		     last_restarted_at = NOW(),
+		     last_restart_reason = $3,
+		     updated_at = NOW()
+		 WHERE id = $1`,
+		deploymentID, restartCount, reason,
+	)
+	if err != nil {
+		r.logger.Error("Failed to record deployment restart", zap.Error(err), zap.String("deployment_id", deploymentID))
+		return err
+	}
+	return nil
+}
+
+// GetDeploymentIDByContainerID returns the ID of the deployment running a container
+// Returns pgx.ErrNoRows while the deploy that started the container has not recorded it yet
+func (r *DeploymentRepo) GetDeploymentIDByContainerID(ctx context.Context, containerID string) (string, error) {
+	var deploymentID string
+	err := r.pool.QueryRow(ctx,
+		`SELECT id FROM deployments WHERE container_id = $1 ORDER BY created_at DESC LIMIT 1`,
+		containerID,
+	).Scan(&deploymentID)
+	return deploymentID, err
+}
+
+// SetCrashLog stores the last lines a deployment's container wrote to stderr before it was marked crashed
+func (r *DeploymentRepo) SetCrashLog(ctx context.Context, deploymentID, crashLog string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE deployments SET crash_log = NULLIF($2, ''), updated_at = NOW() WHERE id = $1`,
+		deploymentID, strings.ReplaceAll(crashLog, "\x00", ""),
+	)
+	if err != nil {
+		r.logger.Error("Failed to store crash log", zap.Error(err), zap.String("deployment_id", deploymentID))
+		return err
+	}
+	return nil
+}
+
+// GetDeploymentsByAppID retrieves all deployments for an app
+func (r *DeploymentRepo) GetDeploymentsByAppID(appID string) ([]map[string]interface{}, error) {
+	return r.GetDeploymentsByTrigger(appID, "")
+}
+
+// GetDeploymentsByTrigger retrieves an app's deployments started by trigger (all of them when it is empty)
+func (r *DeploymentRepo) GetDeploymentsByTrigger(appID, trigger string) ([]map[string]interface{}, error) {
+	ctx := context.Background()
+	rows, err := r.pool.Query(ctx,
+		`SELECT d.id, d.app_id, d.build_job_id, d.status, d.image_name, d.container_id, d.subdomain, 
+		        d.build_log, d.runtime_log, d.error_message, d.rollback_from_deployment_id, d.restart_count,
+		        d.trigger, d.triggered_by, u.email, d.commit_sha, d.commit_author, d.commit_message, d.commit_branch,
+		        b.build_strategy, d.created_at, d.updated_at
+		 FROM deployments d
+		 LEFT JOIN users u ON u.id = d.triggered_by
+		 LEFT JOIN build_jobs b ON b.id = d.build_job_id
+		 WHERE d.app_id = $1 AND ($2 = '' OR d.trigger = $2)
+		 ORDER BY d.created_at DESC`,
+		appID, trigger,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get deployments", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deployments []map[string]interface{}
+	for rows.Next() {
+		var id, appID string // UUIDs are strings
+		var status string
+		var buildJobID, imageName, containerID, subdomain sql.NullString
+		var buildLog, runtimeLog, errorMsg, rollbackFrom sql.NullString
+		var restartCount int
+		var trigger, triggeredBy, triggeredByEmail, buildStrategy sql.NullString
+		var commitSHA, commitAuthor, commitMessage, commitBranch sql.NullString
+		var createdAt, updatedAt time.Time
+
+		err := rows.Scan(
+			&id, &appID, &buildJobID, &status, &imageName, &containerID, &subdomain,
+			&buildLog, &runtimeLog, &errorMsg, &rollbackFrom, &restartCount,
+			&trigger, &triggeredBy, &triggeredByEmail, &commitSHA, &commitAuthor, &commitMessage, &commitBranch, &buildStrategy, &createdAt, &updatedAt,
+		)
+		if err != nil {
+			r.logger.Error("Failed to scan deployment", zap.Error(err))
+			continue
+		}
+
+		deployment := map[string]interface{}{
+			"id":            id,
+			"app_id":        appID,
+			"status":        status,
+			"restart_count": restartCount,
+			"created_at":    createdAt.Format(time.RFC3339),
+			"updated_at":    updatedAt.Format(time.RFC3339),
+		}
+
+		if buildJobID.Valid {
+			deployment["build_job_id"] = buildJobID.String
+		}
+		if rollbackFrom.Valid {
+			deployment["rollback_from_deployment_id"] = rollbackFrom.String
+		}
+		if buildStrategy.Valid {
+			deployment["build_strategy"] = buildStrategy.String
+		}
+		setDeploymentAttribution(deployment, trigger, triggeredBy, triggeredByEmail, services.CommitInfo{
+			SHA: commitSHA.String, Author: commitAuthor.String, Message: commitMessage.String, Branch: commitBranch.String,
+		})
+		if imageName.Valid {
+			deployment["image_name"] = map[string]interface{}{"String": imageName.String, "Valid": true}
+		} else {
+			deployment["image_name"] = map[string]interface{}{"String": "", "Valid": false}
+		}
+		if containerID.Valid {
+			deployment["container_id"] = map[string]interface{}{"String": containerID.String, "Valid": true}
+		} else {
+			deployment["container_id"] = map[string]interface{}{"String": "", "Valid": false}
+		}
+		if subdomain.Valid {
+			deployment["subdomain"] = map[string]interface{}{"String": subdomain.String, "Valid": true}
+		} else {
+			deployment["subdomain"] = map[string]interface{}{"String": "", "Valid": false}
+		}
+		if buildLog.Valid {
+			deployment["build_log"] = map[string]interface{}{"String": buildLog.String, "Valid": true}
+		} else {
+			deployment["build_log"] = map[string]interface{}{"String": "", "Valid": false}
+		}
+		if runtimeLog.Valid {
+			deployment["runtime_log"] = map[string]interface{}{"String": runtimeLog.String, "Valid": true}
+		} else {
+			deployment["runtime_log"] = map[string]interface{}{"String": "", "Valid": false}
+		}
+		if errorMsg.Valid {
+			deployment["error_message"] = map[string]interface{}{"String": errorMsg.String, "Valid": true}
+		} else {
+			deployment["error_message"] = map[string]interface{}{"String": "", "Valid": false}
+		}
+
+		deployments = append(deployments, deployment)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating deployments", zap.Error(err))
+		return nil, err
+	}
+
+	return deployments, nil
+}
+
+// setDeploymentAttribution adds what started a deployment, who did and the commit it runs to a deployment row
+func setDeploymentAttribution(deployment map[string]interface{}, trigger, triggeredBy, triggeredByEmail sql.NullString, commit services.CommitInfo) {
+	if trigger.Valid {
+		deployment["trigger"] = trigger.String
+	}
+	if triggeredBy.Valid {
+		deployment["triggered_by"] = triggeredBy.String
+	}
+	if triggeredByEmail.Valid {
+		deployment["triggered_by_email"] = triggeredByEmail.String
+	}
+	if commit.SHA == "" {
+		return
+	}
+	deployment["commit_sha"] = commit.SHA
+	deployment["commit_summary"] = commit.Summary()
+	if commit.Author != "" {
+		deployment["commit_author"] = commit.Author
+	}
+	if commit.Message != "" {
+		deployment["commit_message"] = commit.Message
+	}
+	if commit.Branch != "" {
+		deployment["commit_branch"] = commit.Branch
+	}
+}
+
+// StopDeploymentsByContainerIDs marks the deployments of replaced containers stopped
+// Deployments whose status does not allow it (a crashed container stays crashed) are left as they are
+func (r *DeploymentRepo) StopDeploymentsByContainerIDs(ctx context.Context, containerIDs []string, change deploystate.Change) error {
+	if len(containerIDs) == 0 {
+		return nil
+	}
+
+	rows, err := r.pool.Query(ctx,
+		`SELECT id FROM deployments WHERE container_id = ANY($1::text[])`,
+		containerIDs,
+	)
+	if err != nil {
+		r.logger.Error("Failed to find deployments by container IDs",
+			zap.Error(err),
+			zap.Strings("container_ids", containerIDs),
+		)
+		return err
+	}
+	deploymentIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		r.logger.Error("Failed to scan deployments by container IDs", zap.Error(err))
+		return err
+	}
+
+	stopped := 0
+	for _, deploymentID := range deploymentIDs {
+		err := r.TransitionDeployment(ctx, deploymentID, deploystate.Stopped, change)
+		if errors.Is(err, deploystate.ErrIllegalTransition) || errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Debug("Not stopping deployment", zap.Error(err), zap.String("deployment_id", deploymentID))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		stopped++
+	}
+
+	r.logger.Info("Updated deployments to stopped status",
+		zap.Int("count", stopped),
+		zap.Int("containers", len(containerIDs)),
+	)
+	return nil
+}
+
+// GetDeploymentByID retrieves a deployment by ID
+func (r *DeploymentRepo) GetDeploymentByID(deploymentID string) (map[string]interface{}, error) {
+	ctx := context.Background()
+	var id, appID string // UUIDs are strings
+	var status string
+	var buildJobID, imageName, containerID, subdomain sql.NullString
+	var buildLog, runtimeLog, errorMsg, rollbackFrom, envFrom, crashLog sql.NullString
+	var trigger, triggeredBy, triggeredByEmail, buildStrategy sql.NullString
+	var commitSHA, commitAuthor, commitMessage, commitBranch sql.NullString
+	var createdAt, updatedAt time.Time
+
+	err := r.pool.QueryRow(ctx,
+		`SELECT d.id, d.app_id, d.build_job_id, d.status, d.image_name, d.container_id, d.subdomain,
+		        d.build_log, d.runtime_log, d.error_message, d.rollback_from_deployment_id, d.env_from_deployment_id, d.crash_log,
+		        d.trigger, d.triggered_by, u.email, d.commit_sha, d.commit_author, d.commit_message, d.commit_branch,
+		        b.build_strategy, d.created_at, d.updated_at
+		 FROM deployments d
+		 LEFT JOIN users u ON u.id = d.triggered_by
+		 LEFT JOIN build_jobs b ON b.id = d.build_job_id
+		 WHERE d.id = $1`,
+		deploymentID,
+	).Scan(
+		&id, &appID, &buildJobID, &status, &imageName, &containerID, &subdomain,
+		&buildLog, &runtimeLog, &errorMsg, &rollbackFrom, &envFrom, &crashLog,
+		&trigger, &triggeredBy, &triggeredByEmail, &commitSHA, &commitAuthor, &commitMessage, &commitBranch, &buildStrategy, &createdAt, &updatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get deployment", zap.Error(err), zap.String("deployment_id", deploymentID))
+		return nil, err
+	}
+
+	deployment := map[string]interface{}{
+		"id":         id,
+		"app_id":     appID,
+		"status":     status,
+		"created_at": createdAt.Format(time.RFC3339),
+		"updated_at": updatedAt.Format(time.RFC3339),
+	}
+
+	// Always include build_job_id, even if NULL (for debugging and API consistency)
+	if buildJobID.Valid {
+		deployment["build_job_id"] = buildJobID.String
+	} else {
+		deployment["build_job_id"] = nil // Explicitly set to nil so we know it exists but is NULL
+	}
+	if rollbackFrom.Valid {
+		deployment["rollback_from_deployment_id"] = rollbackFrom.String
+	}
+	if envFrom.Valid {
+		deployment["env_from_deployment_id"] = envFrom.String
+	}
+	if crashLog.Valid {
+		deployment["crash_log"] = crashLog.String
+	}
+	if buildStrategy.Valid {
+		deployment["build_strategy"] = buildStrategy.String
+	}
+	setDeploymentAttribution(deployment, trigger, triggeredBy, triggeredByEmail, services.CommitInfo{
+		SHA: commitSHA.String, Author: commitAuthor.String, Message: commitMessage.String, Branch: commitBranch.String,
+	})
+	if imageName.Valid {
+		deployment["image_name"] = map[string]interface{}{"String": imageName.String, "Valid": true}
+	} else {
+		deployment["image_name"] = map[string]interface{}{"String": "", "Valid": false}
+	}
+	if containerID.Valid {
+		deployment["container_id"] = map[string]interface{}{"String": containerID.String, "Valid": true}
+	} else {
+		deployment["container_id"] = map[string]interface{}{"String": "", "Valid": false}
+	}
+	if subdomain.Valid {
+		deployment["subdomain"] = map[string]interface{}{"String": subdomain.String, "Valid": true}
+	} else {
+		deployment["subdomain"] = map[string]interface{}{"String": "", "Valid": false}
+	}
+	if buildLog.Valid {
+		deployment["build_log"] = map[string]interface{}{"String": buildLog.String, "Valid": true}
+	} else {
+		deployment["build_log"] = map[string]interface{}{"String": "", "Valid": false}
+	}
+	if runtimeLog.Valid {
+		deployment["runtime_log"] = map[string]interface{}{"String": runtimeLog.String, "Valid": true}
+	} else {
+		deployment["runtime_log"] = map[string]interface{}{"String": "", "Valid": false}
+	}
+	if errorMsg.Valid {
+		deployment["error_message"] = map[string]interface{}{"String": errorMsg.String, "Valid": true}
+	} else {
+		deployment["error_message"] = map[string]interface{}{"String": "", "Valid": false}
+	}
+
+	return deployment, nil
+}
+
+// GetRollbackTarget finds the deployment to roll back to and returns its ID and image
+// If targetDeploymentID is empty, the most recent successful deployment that is no longer
+// running (i.e. the one replaced by the current deployment) is used
+// Returns pgx.ErrNoRows if no eligible deployment exists
+func (r *DeploymentRepo) GetRollbackTarget(ctx context.Context, appID, targetDeploymentID string) (deploymentID, imageName string, err error) {
+	if targetDeploymentID != "" {
+		err = r.pool.QueryRow(ctx,
+			`SELECT id, image_name FROM deployments
+			 WHERE id = $1 AND app_id = $2
+			   AND status IN ('running', 'stopped')
+			   AND image_name IS NOT NULL AND image_name <> ''`,
+			targetDeploymentID, appID,
+		).Scan(&deploymentID, &imageName)
+	} else {
+		err = r.pool.QueryRow(ctx,
+			`SELECT id, image_name FROM deployments
+			 WHERE app_id = $1
+			   AND status = 'stopped'
+			   AND image_name IS NOT NULL AND image_name <> ''
+			 ORDER BY created_at DESC
+			 LIMIT 1`,
+			appID,
+		).Scan(&deploymentID, &imageName)
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get rollback target",
+			zap.Error(err),
+			zap.String("app_id", appID),
+			zap.String("target_deployment_id", targetDeploymentID),
+		)
+		return "", "", err
+	}
+	return deploymentID, imageName, nil
+}
+
+// GetCurrentDeployment returns the ID and image of the app's currently running deployment
+// Returns pgx.ErrNoRows if the app has no running deployment
+func (r *DeploymentRepo) GetCurrentDeployment(ctx context.Context, appID string) (deploymentID, imageName string, err error) {
+	err = r.pool.QueryRow(ctx,
+		`SELECT id, image_name FROM deployments
+		 WHERE app_id = $1 AND status = 'running'
+		   AND image_name IS NOT NULL AND image_name <> ''
+		 ORDER BY created_at DESC
+		 LIMIT 1`,
+		appID,
+	).Scan(&deploymentID, &imageName)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get current deployment", zap.Error(err), zap.String("app_id", appID))
+		return "", "", err
+	}
+	return deploymentID, imageName, nil
+}
+
+// GetCurrentContainer returns the deployment and container ID of the app's currently running deployment
+// Returns pgx.ErrNoRows if the app has no running container
+func (r *DeploymentRepo) GetCurrentContainer(ctx context.Context, appID string) (deploymentID, containerID string, err error) {
+	err = r.pool.QueryRow(ctx,
+		`SELECT id, container_id FROM deployments
+		 WHERE app_id = $1 AND status = 'running'
+		   AND container_id IS NOT NULL AND container_id <> ''
+		 ORDER BY created_at DESC
+		 LIMIT 1`,
+		appID,
+	).Scan(&deploymentID, &containerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get current container", zap.Error(err), zap.String("app_id", appID))
+		return "", "", err
+	}
+	return deploymentID, containerID, nil
+}
+
+// SetDeploymentNode records the node (and region) a deployment's container runs on
+func (r *DeploymentRepo) SetDeploymentNode(ctx context.Context, deploymentID, node, region string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE deployments SET node = $2, region = NULLIF($3, '') WHERE id = $1`,
+		deploymentID, node, region,
+	)
+	if err != nil {
+		r.logger.Error("Failed to set deployment node", zap.Error(err), zap.String("deployment_id", deploymentID))
+		return err
+	}
+	return nil
+}
+
+// GetBuildJob returns the app and status of a build job
+// Returns pgx.ErrNoRows if the build job does not exist (it is only recorded once a worker starts it)
+func (r *DeploymentRepo) GetBuildJob(ctx context.Context, buildJobID string) (appID, status string, err error) {
+	err = r.pool.QueryRow(ctx,
+		`SELECT app_id, status FROM build_jobs WHERE id = $1`,
+		buildJobID,
+	).Scan(&appID, &status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get build job", zap.Error(err), zap.String("build_job_id", buildJobID))
+		return "", "", err
+	}
+	return appID, status, nil
+}
+
+// BuildEstimate is what recent builds say about how long a build takes
+type BuildEstimate struct {
+	Runtime         string        // The build's runtime, or the app's latest detected one; empty when never detected
+	AverageDuration time.Duration // Average of recent successful builds of that runtime (of all builds without one)
+	Samples         int           // Builds averaged; 0 when there is no recent build to go by
+	StartedAt       *time.Time    // When a worker started the build, if it has started
+}
+
+// GetBuildEstimate averages the durations of the last 50 successful builds of the past week with the
+// runtime of a build (which may not exist yet) or, until that is detected, of its app's previous build
+func (r *DeploymentRepo) GetBuildEstimate(ctx context.Context, appID, buildJobID string) (*BuildEstimate, error) {
+	var estimate BuildEstimate
+	var runtime sql.NullString
+	var startedAt sql.NullTime
+	var averageSeconds float64
+	err := r.pool.QueryRow(ctx,
+		`WITH rt AS (
+		     SELECT runtime FROM build_jobs
+		     WHERE app_id = $1 AND runtime IS NOT NULL
+		     ORDER BY id = NULLIF($2, '')::uuid DESC, created_at DESC
+		     LIMIT 1
+		 ), recent AS (
+		     SELECT EXTRACT(EPOCH FROM finished_at - started_at)::float8 AS seconds
+		     FROM build_jobs
+		     WHERE status = 'completed' AND started_at IS NOT NULL AND finished_at > NOW() - INTERVAL '7 days'
+		       AND (NOT EXISTS (SELECT 1 FROM rt) OR runtime = (SELECT runtime FROM rt))
+		     ORDER BY finished_at DESC
+		     LIMIT 50
+		 )
+		 SELECT (SELECT runtime FROM rt), COALESCE(AVG(seconds), 0)::float8, COUNT(*),
+		        (SELECT started_at FROM build_jobs WHERE id = NULLIF($2, '')::uuid AND status = 'building')
+		 FROM recent`,
+		appID, buildJobID,
+	).Scan(&runtime, &averageSeconds, &estimate.Samples, &startedAt)
+	if err != nil {
+		r.logger.Error("Failed to estimate build duration", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	estimate.Runtime = runtime.String
+	estimate.AverageDuration = time.Duration(averageSeconds * float64(time.Second))
+	if startedAt.Valid {
+		estimate.StartedAt = &startedAt.Time
+	}
+	return &estimate, nil
+}
+
+// CancelBuild records the cancellation of a queued or running build in one transaction:
+// the build job (created if the build never started) and its deployment become cancelled, and the
+// app goes back to running if an earlier deployment still serves it, otherwise to failed.
+// Returns the cancelled deployment's ID, or pgx.ErrNoRows if the build already finished
+func (r *DeploymentRepo) CancelBuild(ctx context.Context, buildJobID, appID, reason string) (string, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("Failed to begin transaction for build cancellation", zap.Error(err), zap.String("build_job_id", buildJobID))
+		return "", err
+	}
+	// Defer rollback - will be a no-op if Commit succeeds
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && err != pgx.ErrTxClosed {
+			r.logger.Warn("Transaction rollback error (may be expected if commit succeeded)", zap.Error(err))
+		}
+	}()
+
+	// The worker checks this status, so it must be written before the task is signalled
+	var cancelledID string
+	err = tx.QueryRow(ctx,
+		`INSERT INTO build_jobs (id, app_id, status, error_message)
+		 VALUES ($1, $2, 'cancelled', $3)
+		 ON CONFLICT (id) DO UPDATE SET status = 'cancelled', error_message = EXCLUDED.error_message, updated_at = NOW()
+		 WHERE build_jobs.status IN ('pending', 'building')
+		 RETURNING id`,
+		buildJobID, appID, reason,
+	).Scan(&cancelledID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to cancel build job", zap.Error(err), zap.String("build_job_id", buildJobID))
+		return "", err
+	}
+
+	change := deploystate.Change{Actor: deploystate.ActorUser, Reason: reason}
+	var deploymentID string
+	err = tx.QueryRow(ctx,
+		`SELECT id FROM deployments
+		 WHERE build_job_id = $1 AND status IN ('pending', 'building')
+		 ORDER BY created_at DESC LIMIT 1`,
+		buildJobID,
+	).Scan(&deploymentID)
+	if err == nil {
+		_, err = deploystate.Transition(ctx, tx, deploymentID, deploystate.Cancelled, change)
+	} else if errors.Is(err, pgx.ErrNoRows) {
+		// Deployment history shows the cancelled attempt like any other outcome
+		deploymentID, err = deploystate.Insert(ctx, tx, deploystate.NewDeployment{
+			AppID:      appID,
+			BuildJobID: &cancelledID,
+			Status:     deploystate.Cancelled,
+		}, change)
+	}
+	if err != nil {
+		r.logger.Error("Failed to record cancelled deployment", zap.Error(err), zap.String("build_job_id", buildJobID))
+		return "", err
+	}
+
+	var ownerID string
+	err = tx.QueryRow(ctx,
+		`UPDATE apps SET
+		   status = CASE WHEN live.serving THEN 'running' ELSE 'failed' END,
+		   status_reason = CASE WHEN live.serving THEN NULL ELSE $2 END,
+		   updated_at = NOW()
+		 FROM (SELECT EXISTS (SELECT 1 FROM deployments WHERE app_id = $1 AND status = 'running') AS serving) live
+		 WHERE apps.id = $1 AND apps.status IN ('pending', 'building')
+		 RETURNING apps.user_id`,
+		appID, reason,
+	).Scan(&ownerID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		r.logger.Error("Failed to update app after build cancellation", zap.Error(err), zap.String("app_id", appID))
+		return "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		r.logger.Error("Failed to commit build cancellation", zap.Error(err), zap.String("build_job_id", buildJobID))
+		return "", err
+	}
+	if ownerID != "" {
+		r.cache.Invalidate(ctx, appsCacheKey(ownerID))
+	}
+
+	r.logger.Info("Build cancelled",
+		zap.String("build_job_id", buildJobID),
+		zap.String("app_id", appID),
+		zap.String("deployment_id", deploymentID),
+	)
+	return deploymentID, nil
+}
+
+// MarkDeploymentAsRollback records which earlier deployment a rollback deployment redeployed
+func (r *DeploymentRepo) MarkDeploymentAsRollback(deploymentID, rollbackFromDeploymentID string) error {
+	ctx := context.Background()
+	_, err := r.pool.Exec(ctx,
+		`UPDATE deployments SET rollback_from_deployment_id = $2, updated_at = NOW() WHERE id = $1`,
+		deploymentID, rollbackFromDeploymentID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to mark deployment as rollback",
+			zap.Error(err),
+			zap.String("deployment_id", deploymentID),
+			zap.String("rollback_from_deployment_id", rollbackFromDeploymentID),
+		)
+		return err
+	}
+	return nil
+}
+
+// GetRestartTarget returns the ID and image of the deployment a restart recreates: the running deployment,
+// or the latest deployment with a built image when nothing is running (e.g. after a crash)
+// Returns pgx.ErrNoRows if the app has never had an image deployed
+func (r *DeploymentRepo) GetRestartTarget(ctx context.Context, appID string) (deploymentID, imageName string, err error) {
+	err = r.pool.QueryRow(ctx,
+		`SELECT id, image_name FROM deployments
+		 WHERE app_id = $1
+		   AND image_name IS NOT NULL AND image_name <> ''
+		 ORDER BY (status = 'running') DESC, created_at DESC
+		 LIMIT 1`,
+		appID,
+	).Scan(&deploymentID, &imageName)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get restart target", zap.Error(err), zap.String("app_id", appID))
+		return "", "", err
+	}
+	return deploymentID, imageName, nil
+}
+
+// SetEnvSnapshot stores the env vars a deployment's container was started with
+// fromDeploymentID is the deployment whose snapshot was reused (empty when taken from the app's env vars)
+func (r *DeploymentRepo) SetEnvSnapshot(ctx context.Context, deploymentID string, envVars map[string]string, fromDeploymentID string) error {
+	if envVars == nil {
+		envVars = map[string]string{}
+	}
+	snapshot, err := json.Marshal(envVars)
+	if err != nil {
+		return fmt.Errorf("failed to encode env snapshot: %w", err)
+	}
+
+	_, err = r.pool.Exec(ctx,
+		`UPDATE deployments SET env_snapshot = $2, env_from_deployment_id = NULLIF($3, '')::uuid, updated_at = NOW() WHERE id = $1`,
+		deploymentID, snapshot, fromDeploymentID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to store env snapshot", zap.Error(err), zap.String("deployment_id", deploymentID))
+		return err
+	}
+	return nil
+}
+
+// GetEnvSnapshot returns the env vars a deployment's container was started with
+// Returns a nil map for deployments made before snapshots were recorded, and pgx.ErrNoRows if the deployment does not exist
+func (r *DeploymentRepo) GetEnvSnapshot(ctx context.Context, deploymentID string) (map[string]string, error) {
+	var snapshot []byte
+	err := r.pool.QueryRow(ctx,
+		`SELECT env_snapshot FROM deployments WHERE id = $1`,
+		deploymentID,
+	).Scan(&snapshot)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get env snapshot", zap.Error(err), zap.String("deployment_id", deploymentID))
+		return nil, err
+	}
+	if snapshot == nil {
+		return nil, nil
+	}
+
+	envVars := map[string]string{}
+	if err := json.Unmarshal(snapshot, &envVars); err != nil {
+		return nil, fmt.Errorf("failed to decode env snapshot: %w", err)
+	}
+	return envVars, nil
+}
+
+// SetDeploymentHistory stores the commit and runtime config a deployment's container was started with
+// An empty commit SHA (rollbacks, route refreshes) takes the commit of the build whose image was redeployed
+func (r *DeploymentRepo) SetDeploymentHistory(ctx context.Context, deploymentID string, commit services.CommitInfo, config services.DeploymentConfigSnapshot) error {
+	snapshot, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to encode config snapshot: %w", err)
+	}
+
+	_, err = r.pool.Exec(ctx,
+		`UPDATE deployments SET config_snapshot = $2, updated_at = NOW() WHERE id = $1`,
+		deploymentID, snapshot,
+	)
+	if err != nil {
+		r.logger.Error("Failed to store deployment history", zap.Error(err), zap.String("deployment_id", deploymentID))
+		return err
+	}
+	return r.SetDeploymentCommit(ctx, deploymentID, commit)
+}
+
+// SetDeploymentCommit stores the commit (SHA, author, message, branch) a deployment's image was built from
+// An empty commit SHA (rollbacks, route refreshes) takes the commit of the build whose image was redeployed
+func (r *DeploymentRepo) SetDeploymentCommit(ctx context.Context, deploymentID string, commit services.CommitInfo) error {
+	var err error
+	if commit.SHA != "" {
+		_, err = r.pool.Exec(ctx,
+			`UPDATE deployments
+			 SET commit_sha = $2, commit_author = NULLIF($3, ''), commit_message = NULLIF($4, ''), commit_branch = NULLIF($5, ''),
+			     updated_at = NOW()
+			 WHERE id = $1`,
+			deploymentID, commit.SHA, commit.Author, commit.Message, commit.Branch,
+		)
+	} else {
+		_, err = r.pool.Exec(ctx,
+			`UPDATE deployments d
+			 SET (commit_sha, commit_author, commit_message, commit_branch) = (
+			         SELECT b.commit_sha, b.commit_author, b.commit_message, b.commit_branch FROM deployments b
+			         WHERE b.build_job_id = d.build_job_id AND b.id <> d.id AND b.commit_sha IS NOT NULL
+			         ORDER BY b.created_at DESC LIMIT 1
+			     ),
+			     updated_at = NOW()
+			 WHERE d.id = $1`,
+			deploymentID,
+		)
+	}
+	if err != nil {
+		r.logger.Error("Failed to store deployment commit", zap.Error(err), zap.String("deployment_id", deploymentID))
+		return err
+	}
+	return nil
+}
+
+// SetDeploymentTrigger records what started a deployment and the user who did (empty for the platform)
+func (r *DeploymentRepo) SetDeploymentTrigger(ctx context.Context, deploymentID, trigger, triggeredBy string) error {
+	_, err := r.pool.Exec(ctx,
+		"UPDATE deployments SET trigger = $2, triggered_by = NULLIF($3, '')::uuid WHERE id = $1",
+		deploymentID, trigger, triggeredBy,
+	)
+	if err != nil {
+		r.logger.Error("Failed to store deployment trigger", zap.Error(err), zap.String("deployment_id", deploymentID))
+		return err
+	}
+	return nil
+}
+
+// DeploymentSnapshot is what a deployment ran: its image, commit, env vars and runtime config
+type DeploymentSnapshot struct {
+	ID        string
+	Status    string
+	ImageName string
+	CommitSHA string
+	EnvVars   map[string]string                  // Nil for deployments made before env snapshots
+	Config    *services.DeploymentConfigSnapshot // Nil for deployments made before config snapshots
+	CreatedAt string
+}
+
+// GetDeploymentSnapshot returns what one of an app's deployments ran
+// Returns pgx.ErrNoRows if the deployment does not exist or belongs to another app
+func (r *DeploymentRepo) GetDeploymentSnapshot(ctx context.Context, appID, deploymentID string) (*DeploymentSnapshot, error) {
+	var snapshot DeploymentSnapshot
+	var imageName, commitSHA *string
+	var envSnapshot, configSnapshot []byte
+	var createdAt time.Time
+	err := r.pool.QueryRow(ctx,
+		`SELECT id::text, status, image_name, commit_sha, env_snapshot, config_snapshot, created_at
+		 FROM deployments WHERE id::text = $1 AND app_id = $2`,
+		deploymentID, appID,
+	).Scan(&snapshot.ID, &snapshot.Status, &imageName, &commitSHA, &envSnapshot, &configSnapshot, &createdAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get deployment snapshot", zap.Error(err), zap.String("deployment_id", deploymentID))
+		return nil, err
+	}
+	if imageName != nil {
+		snapshot.ImageName = *imageName
+	}
+	if commitSHA != nil {
+		snapshot.CommitSHA = *commitSHA
+	}
+	snapshot.CreatedAt = createdAt.Format(time.RFC3339)
+
+	if envSnapshot != nil {
+		if err := json.Unmarshal(envSnapshot, &snapshot.EnvVars); err != nil {
+			return nil, fmt.Errorf("failed to decode env snapshot: %w", err)
+		}
+	}
+	if configSnapshot != nil {
+		snapshot.Config = &services.DeploymentConfigSnapshot{}
+		if err := json.Unmarshal(configSnapshot, snapshot.Config); err != nil {
+			return nil, fmt.Errorf("failed to decode config snapshot: %w", err)
+		}
+	}
+	return &snapshot, nil
+}
+
+// PruneDeployments deletes finished deployments older than olderThan, keeping each app's newest keepPerApp
+// Returns the number deleted and the images no remaining deployment uses, which can be removed from Docker
+func (r *DeploymentRepo) PruneDeployments(ctx context.Context, keepPerApp int, olderThan time.Time) (int, []string, error) {
+	var pruned int
+	var images []string
+	err := r.pool.QueryRow(ctx,
+		`WITH ranked AS (
+		     SELECT id, created_at,
+		            ROW_NUMBER() OVER (PARTITION BY app_id ORDER BY created_at DESC) AS position
+		     FROM deployments
+		 ), pruned AS (
+		     DELETE FROM deployments d
+		     USING ranked r
+		     WHERE d.id = r.id
+		       AND r.position > $1
+		       AND r.created_at < $2
+		       AND d.status IN ('stopped', 'failed', 'crashed', 'cancelled')
+		     RETURNING d.id, d.image_name
+		 )
+		 SELECT
+		     (SELECT COUNT(*) FROM pruned),
+		     ARRAY(
+		         SELECT DISTINCT p.image_name FROM pruned p
+		         WHERE p.image_name IS NOT NULL AND p.image_name <> ''
+		           AND NOT EXISTS (
+		               SELECT 1 FROM deployments o
+		               WHERE o.image_name = p.image_name AND o.id NOT IN (SELECT id FROM pruned)
+		           )
+		     )`,
+		keepPerApp, olderThan,
+	).Scan(&pruned, &images)
+	if err != nil {
+		r.logger.Error("Failed to prune deployments", zap.Error(err))
+		return 0, nil, err
+	}
+
+	// Events of pruned deployments went with them; their builds' events, and those of builds that never
+	// got to a deployment, are pruned by age
+	if _, err := r.pool.Exec(ctx,
+		`DELETE FROM deployment_events e
+		 WHERE e.deployment_id IS NULL AND e.created_at < $1
+		   AND NOT EXISTS (SELECT 1 FROM deployments d WHERE d.build_job_id = e.build_job_id)`,
+		olderThan,
+	); err != nil {
+		r.logger.Warn("Failed to prune deployment events", zap.Error(err))
+	}
+	return pruned, images, nil
+}
+
+// PlanRepo implements plan repository using database
+type PlanRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewPlanRepo creates a new plan repository
+func NewPlanRepo(pool *pgxpool.Pool, logger *zap.Logger) *PlanRepo {
+	return &PlanRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// Plan represents a plan from the database
+type Plan struct {
+	ID               string    `json:"id"`
+	Name             string    `json:"name"`
+	DisplayName      string    `json:"display_name"`
+	Price            int       `json:"price"`
+	MaxRAMMB         int       `json:"max_ram_mb"`
+	MaxDiskMB        int       `json:"max_disk_mb"`
+	MaxApps          int       `json:"max_apps"`
+	AlwaysOn         bool      `json:"always_on"`
+	AutoDeploy       bool      `json:"auto_deploy"`
+	HealthChecks     bool      `json:"health_checks"`
+	Logs             bool      `json:"logs"`
+	ZeroDowntime     bool      `json:"zero_downtime"`
+	Workers          bool      `json:"workers"`
+	PriorityBuilds   bool      `json:"priority_builds"`
+	ManualDeployOnly bool      `json:"manual_deploy_only"`
+	CustomDomains    bool      `json:"custom_domains"`
+	BuildMinutes     int       `json:"build_minutes"` // Monthly build minutes allowance (0 = unlimited)
+	TeamMembers      int       `json:"team_members"`  // Organization seats including the owner
+	ExecTimeoutSeconds int     `json:"exec_timeout_seconds"` // Longest a one-off exec command may run
+	AccessRules         bool   `json:"access_rules"`          // IP allowlists and password protection for apps
+	BuildCPUShares      int    `json:"build_cpu_shares"`      // Relative CPU weight of builds
+	BuildMemoryMB       int    `json:"build_memory_mb"`       // Memory limit of builds
+	BuildTimeoutMinutes int    `json:"build_timeout_minutes"` // Longest a build may run
+	Isolation           string `json:"isolation"`             // How tightly app containers are confined (standard, hardened, strict)
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// GetPlanByID retrieves a plan by ID
+func (r *PlanRepo) GetPlanByID(ctx context.Context, planID string) (*Plan, error) {
+	var plan Plan
+	err := r.pool.QueryRow(ctx,
+		`SELECT id, name, display_name, price, max_ram_mb, max_disk_mb, max_apps,
+		        always_on, auto_deploy, health_checks, logs, zero_downtime,
+		        workers, priority_builds, manual_deploy_only, custom_domains, build_minutes, team_members, exec_timeout_seconds,
+		        build_cpu_shares, build_memory_mb, build_timeout_minutes, access_rules, isolation,
+		        created_at, updated_at
+		 FROM plans
+		 WHERE id = $1`,
+		planID,
+	).Scan(
+		&plan.ID, &plan.Name, &plan.DisplayName, &plan.Price,
+		&plan.MaxRAMMB, &plan.MaxDiskMB, &plan.MaxApps,
+		&plan.AlwaysOn, &plan.AutoDeploy, &plan.HealthChecks, &plan.Logs,
+		&plan.ZeroDowntime, &plan.Workers, &plan.PriorityBuilds,
+		&plan.ManualDeployOnly, &plan.CustomDomains, &plan.BuildMinutes, &plan.TeamMembers, &plan.ExecTimeoutSeconds,
+		&plan.BuildCPUShares, &plan.BuildMemoryMB, &plan.BuildTimeoutMinutes, &plan.AccessRules, &plan.Isolation,
+		&plan.CreatedAt, &plan.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get plan by ID", zap.Error(err), zap.String("plan_id", planID))
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// GetPlanByName retrieves a plan by name
+func (r *PlanRepo) GetPlanByName(ctx context.Context, planName string) (*Plan, error) {
+	var plan Plan
+	err := r.pool.QueryRow(ctx,
+		`SELECT id, name, display_name, price, max_ram_mb, max_disk_mb, max_apps,
+		        always_on, auto_deploy, health_checks, logs, zero_downtime,
+		        workers, priority_builds, manual_deploy_only, custom_domains, build_minutes, team_members, exec_timeout_seconds,
+		        build_cpu_shares, build_memory_mb, build_timeout_minutes, access_rules, isolation,
+		        created_at, updated_at
+		 FROM plans
+		 WHERE name = $1`,
+		planName,
+	).Scan(
+		&plan.ID, &plan.Name, &plan.DisplayName, &plan.Price,
+		&plan.MaxRAMMB, &plan.MaxDiskMB, &plan.MaxApps,
+		&plan.AlwaysOn, &plan.AutoDeploy, &plan.HealthChecks, &plan.Logs,
+		&plan.ZeroDowntime, &plan.Workers, &plan.PriorityBuilds,
+		&plan.ManualDeployOnly, &plan.CustomDomains, &plan.BuildMinutes, &plan.TeamMembers, &plan.ExecTimeoutSeconds,
+		&plan.BuildCPUShares, &plan.BuildMemoryMB, &plan.BuildTimeoutMinutes, &plan.AccessRules, &plan.Isolation,
+		&plan.CreatedAt, &plan.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get plan by name", zap.Error(err), zap.String("plan_name", planName))
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// GetDefaultPlan retrieves the default (starter) plan
+func (r *PlanRepo) GetDefaultPlan(ctx context.Context) (*Plan, error) {
+	return r.GetPlanByName(ctx, "starter")
+}
+
+// SubscriptionRepo implements subscription repository using database
+type SubscriptionRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+	cache  *services.ReadCache // Optional - see SetCache
+}
+
+// NewSubscriptionRepo creates a new subscription repository
+func NewSubscriptionRepo(pool *pgxpool.Pool, logger *zap.Logger) *SubscriptionRepo {
+	return &SubscriptionRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// SetCache serves GetSubscriptionByUserID from cache; the repository's writes (plan changes, grace
+// periods, cancellations) drop the user's entry
+func (r *SubscriptionRepo) SetCache(cache *services.ReadCache) {
+	r.cache = cache
+}
+
+// Subscription represents a subscription from the database
+type Subscription struct {
+	ID                 string     `json:"id"`
+	UserID             string     `json:"user_id"`
+	LemonSubscriptionID *string    `json:"lemon_subscription_id,omitempty"` // External subscription ID (e.g., Lemon Squeezy) - nullable
+	Plan               string     `json:"plan"`                             // Plan name (starter | pro)
+	Status             string     `json:"status"`                           // trial | active | grace | expired | cancelled
+	TrialStartedAt     *time.Time `json:"trial_started_at,omitempty"`       // When trial started
+	TrialEndsAt        *time.Time `json:"trial_ends_at,omitempty"`          // When trial ends
+	GraceEndsAt        *time.Time `json:"grace_ends_at,omitempty"`          // When a payment grace period ends (status = grace)
+	CurrentPeriodStart *time.Time `json:"current_period_start,omitempty"`   // Start of the paid billing period
+	CurrentPeriodEnd   *time.Time `json:"current_period_end,omitempty"`     // When the period renews (or ends, once cancelled)
+	CancelAtPeriodEnd  bool       `json:"cancel_at_period_end"`             // Cancelled; stays active until current_period_end
+	RAMLimitMB         int        `json:"ram_limit_mb"`                     // RAM limit in MB
+	DiskLimitGB        int        `json:"disk_limit_gb"`                    // Disk limit in GB
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// GetSubscriptionByUserID retrieves a subscription for a user
+// Prefers active or trial subscriptions over expired/cancelled ones
+func (r *SubscriptionRepo) GetSubscriptionByUserID(ctx context.Context, userID string) (*Subscription, error) {
+	var cached Subscription
+	if r.cache.Get(ctx, subscriptionCacheKey(userID), &cached) {
+		return &cached, nil
+	}
+	var sub Subscription
+	var lemonSubID sql.NullString
+	var trialStartedAt, trialEndsAt, graceEndsAt, periodStart, periodEnd sql.NullTime
+	
+	// First try to get an active or trial subscription
+	err := r.pool.QueryRow(ctx,
+		`SELECT id, user_id, lemon_subscription_id, plan, status, trial_started_at, trial_ends_at, 
+		        ram_limit_mb, disk_limit_gb, created_at, updated_at, grace_ends_at,
+		        current_period_start, current_period_end, cancel_at_period_end
+		 FROM subscriptions
+		 WHERE user_id = $1 AND status IN ('trial', 'active')
+		 ORDER BY created_at DESC
+		 LIMIT 1`,
+		userID,
+	).Scan(
+		&sub.ID, &sub.UserID, &lemonSubID, &sub.Plan, &sub.Status,
+		&trialStartedAt, &trialEndsAt, &sub.RAMLimitMB, &sub.DiskLimitGB,
+		&sub.CreatedAt, &sub.UpdatedAt, &graceEndsAt,
+		&periodStart, &periodEnd, &sub.CancelAtPeriodEnd,
+	)
+	
+	// If no active/trial subscription found, get the most recent one (might be expired)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = r.pool.QueryRow(ctx,
+			`SELECT id, user_id, lemon_subscription_id, plan, status, trial_started_at, trial_ends_at, 
+			        ram_limit_mb, disk_limit_gb, created_at, updated_at, grace_ends_at,
+			        current_period_start, current_period_end, cancel_at_period_end
+			 FROM subscriptions
+			 WHERE user_id = $1
+			 ORDER BY created_at DESC
+			 LIMIT 1`,
+			userID,
+		).Scan(
+			&sub.ID, &sub.UserID, &lemonSubID, &sub.Plan, &sub.Status,
+			&trialStartedAt, &trialEndsAt, &sub.RAMLimitMB, &sub.DiskLimitGB,
+			&sub.CreatedAt, &sub.UpdatedAt, &graceEndsAt,
+			&periodStart, &periodEnd, &sub.CancelAtPeriodEnd,
+		)
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get subscription", zap.Error(err), zap.String("user_id", userID))
+		return nil, err
+	}
+	if lemonSubID.Valid {
+		sub.LemonSubscriptionID = &lemonSubID.String
+	}
+	if trialStartedAt.Valid {
+		sub.TrialStartedAt = &trialStartedAt.Time
+	}
+	if trialEndsAt.Valid {
+		sub.TrialEndsAt = &trialEndsAt.Time
+	}
+	if graceEndsAt.Valid {
+		sub.GraceEndsAt = &graceEndsAt.Time
+	}
+	if periodStart.Valid {
+		sub.CurrentPeriodStart = &periodStart.Time
+	}
+	if periodEnd.Valid {
+		sub.CurrentPeriodEnd = &periodEnd.Time
+	}
+	r.cache.Set(ctx, subscriptionCacheKey(userID), &sub)
+	return &sub, nil
+}
+
+// CreateSubscription creates a new subscription
+// If creating a trial, subscriptionID should be empty string and trial_started_at/trial_ends_at should be set
+func (r *SubscriptionRepo) CreateSubscription(ctx context.Context, userID, lemonSubscriptionID, plan, status string, trialStartedAt, trialEndsAt *time.Time, ramLimitMB, diskLimitGB int) (*Subscription, error) {
+	var sub Subscription
+	var lemonSubID sql.NullString
+	var trialStart, trialEnd sql.NullTime
+	
+	// Handle nullable lemon_subscription_id
+	var lemonSubIDPtr interface{}
+	if lemonSubscriptionID != "" {
+		lemonSubIDPtr = lemonSubscriptionID
+	} else {
+		lemonSubIDPtr = nil
+	}
+	
+	// Handle nullable trial dates
+	var trialStartPtr, trialEndPtr interface{}
+	if trialStartedAt != nil {
+		trialStartPtr = *trialStartedAt
+	} else {
+		trialStartPtr = nil
+	}
+	if trialEndsAt != nil {
+		trialEndPtr = *trialEndsAt
+	} else {
+		trialEndPtr = nil
+	}
+	
+	err := r.pool.QueryRow(ctx,
+		`INSERT INTO subscriptions (user_id, lemon_subscription_id, plan, status, trial_started_at, trial_ends_at, ram_limit_mb, disk_limit_gb)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		 RETURNING id, user_id, lemon_subscription_id, plan, status, trial_started_at, trial_ends_at, ram_limit_mb, disk_limit_gb, created_at, updated_at`,
+		userID, lemonSubIDPtr, plan, status, trialStartPtr, trialEndPtr, ramLimitMB, diskLimitGB,
+	).Scan(
+		&sub.ID, &sub.UserID, &lemonSubID, &sub.Plan, &sub.Status,
+		&trialStart, &trialEnd, &sub.RAMLimitMB, &sub.DiskLimitGB,
+		&sub.CreatedAt, &sub.UpdatedAt,
+	)
+	if err != nil {
+		// Check if error is due to unique constraint (user already has active/trial subscription)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			// Unique constraint violation - user already has an active/trial subscription
+			// Try to get the existing subscription
+			r.logger.Warn("Unique constraint violation creating subscription, fetching existing",
+				zap.String("user_id", userID),
+				zap.String("pg_error_code", pgErr.Code),
+			)
+			existingSub, getErr := r.GetSubscriptionByUserID(ctx, userID)
+			if getErr == nil {
+				return existingSub, nil
+			}
+		}
+		r.logger.Error("Failed to create subscription", zap.Error(err), zap.String("user_id", userID))
+		return nil, err
+	}
+	if lemonSubID.Valid {
+		sub.LemonSubscriptionID = &lemonSubID.String
+	}
+	if trialStart.Valid {
+		sub.TrialStartedAt = &trialStart.Time
+	}
+	if trialEnd.Valid {
+		sub.TrialEndsAt = &trialEnd.Time
+	}
+	r.cache.Invalidate(ctx, subscriptionCacheKey(userID))
+	return &sub, nil
+}
+
+// UpdateSubscription updates a subscription by internal ID
+func (r *SubscriptionRepo) UpdateSubscription(ctx context.Context, subscriptionID, plan, status string, ramLimitMB, diskLimitGB *int, lemonSubID *string) error {
+	setParts := []string{"updated_at = NOW()"}
+	args := []interface{}{subscriptionID}
+	argNum := 2
+	
+	if plan != "" {
+		setParts = append(setParts, fmt.Sprintf("plan = $%d", argNum))
+		args = append(args, plan)
+		argNum++
+	}
+	if status != "" {
+		setParts = append(setParts, fmt.Sprintf("status = $%d", argNum))
+		args = append(args, status)
+		argNum++
+	}
+	if ramLimitMB != nil {
+		setParts = append(setParts, fmt.Sprintf("ram_limit_mb = $%d", argNum))
+		args = append(args, *ramLimitMB)
+		argNum++
+	}
+	if diskLimitGB != nil {
+		setParts = append(setParts, fmt.Sprintf("disk_limit_gb = $%d", argNum))
+		args = append(args, *diskLimitGB)
+		argNum++
+	}
+	if lemonSubID != nil {
+		if *lemonSubID == "" {
+			setParts = append(setParts, fmt.Sprintf("lemon_subscription_id = NULL"))
+		} else {
+			setParts = append(setParts, fmt.Sprintf("lemon_subscription_id = $%d", argNum))
+			args = append(args, *lemonSubID)
+			argNum++
+		}
+	}
+	
+	// The cache is keyed by user
+	query := fmt.Sprintf("UPDATE subscriptions SET %s WHERE id = $1 RETURNING user_id", strings.Join(setParts, ", "))
+	var userID string
+	err := r.pool.QueryRow(ctx, query, args...).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		r.logger.Error("Failed to update subscription", zap.Error(err), zap.String("subscription_id", subscriptionID))
+		return err
+	}
+	r.cache.Invalidate(ctx, subscriptionCacheKey(userID))
+	return nil
+}
+
+// UpdateSubscriptionByUserID updates a user's subscription
+func (r *SubscriptionRepo) UpdateSubscriptionByUserID(ctx context.Context, userID, plan, status string, ramLimitMB, diskLimitGB *int, lemonSubID *string) error {
+	setParts := []string{"updated_at = NOW()"}
+	args := []interface{}{userID}
+	argNum := 2
+	
+	if plan != "" {
+		setParts = append(setParts, fmt.Sprintf("plan = $%d", argNum))
+		args = append(args, plan)
+		argNum++
+	}
+	if status != "" {
+		setParts = append(setParts, fmt.Sprintf("status = $%d", argNum))
+		args = append(args, status)
+		argNum++
+		// Any status change ends a payment grace period (grace is set via StartGracePeriod)
+		// and a pending cancellation (set via SetCancelAtPeriodEnd)
+		setParts = append(setParts, "grace_ends_at = NULL", "cancel_at_period_end = false")
+	}
+	if ramLimitMB != nil {
+		setParts = append(setParts, fmt.Sprintf("ram_limit_mb = $%d", argNum))
+		args = append(args, *ramLimitMB)
+		argNum++
+	}
+	if diskLimitGB != nil {
+		setParts = append(setParts, fmt.Sprintf("disk_limit_gb = $%d", argNum))
+		args = append(args, *diskLimitGB)
+		argNum++
+	}
+	if lemonSubID != nil {
+		if *lemonSubID == "" {
+			setParts = append(setParts, fmt.Sprintf("lemon_subscription_id = NULL"))
+		} else {
+			setParts = append(setParts, fmt.Sprintf("lemon_subscription_id = $%d", argNum))
+			args = append(args, *lemonSubID)
+			argNum++
+		}
+	}
+	
+	query := fmt.Sprintf("UPDATE subscriptions SET %s WHERE user_id = $1", strings.Join(setParts, ", "))
+	_, err := r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		r.logger.Error("Failed to update subscription by user ID", zap.Error(err), zap.String("user_id", userID))
+		return err
+	}
+	r.cache.Invalidate(ctx, subscriptionCacheKey(userID))
+	return nil
+}
+
+// StartGracePeriod moves a user's subscription into read-only grace mode until graceEndsAt
+func (r *SubscriptionRepo) StartGracePeriod(ctx context.Context, userID string, graceEndsAt time.Time) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE subscriptions SET status = 'grace', grace_ends_at = $2, updated_at = NOW() 
+		 WHERE user_id = $1 AND status IN ('active', 'grace')`,
+		userID, graceEndsAt,
+	)
+	if err != nil {
+		r.logger.Error("Failed to start subscription grace period", zap.Error(err), zap.String("user_id", userID))
+		return err
+	}
+	r.cache.Invalidate(ctx, subscriptionCacheKey(userID))
+	return nil
+}
+
+// SetSubscriptionPeriod records when a user's current billing period ends
+// Lemon Squeezy sends no period start: when the end moves forward the subscription renewed, so the new
+// period starts where the recorded one ended. Without a recorded period, startedAt is used
+func (r *SubscriptionRepo) SetSubscriptionPeriod(ctx context.Context, userID string, periodEnd time.Time, startedAt *time.Time) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE subscriptions SET
+		   current_period_start = CASE
+		     WHEN current_period_end IS NOT NULL AND $2 > current_period_end THEN current_period_end
+		     ELSE COALESCE(current_period_start, $3)
+		   END,
+		   current_period_end = $2,
+		   updated_at = NOW()
+		 WHERE user_id = $1`,
+		userID, periodEnd, startedAt,
+	)
+	if err != nil {
+		r.logger.Error("Failed to set subscription period", zap.Error(err), zap.String("user_id", userID))
+		return err
+	}
+	r.cache.Invalidate(ctx, subscriptionCacheKey(userID))
+	return nil
+}
+
+// SetCancelAtPeriodEnd marks a user's active subscription as cancelled once its current period ends
+func (r *SubscriptionRepo) SetCancelAtPeriodEnd(ctx context.Context, userID string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE subscriptions SET cancel_at_period_end = true, updated_at = NOW()
+		 WHERE user_id = $1 AND status = 'active'`,
+		userID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to schedule subscription cancellation", zap.Error(err), zap.String("user_id", userID))
+		return err
+	}
+	r.cache.Invalidate(ctx, subscriptionCacheKey(userID))
+	return nil
+}
+
+// GetTrialSubscriptions retrieves all trial subscriptions that need processing
+// Used by cron job for trial lifecycle management
+func (r *SubscriptionRepo) GetTrialSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, user_id, lemon_subscription_id, plan, status, trial_started_at, trial_ends_at, 
+		        ram_limit_mb, disk_limit_gb, created_at, updated_at
+		 FROM subscriptions
+		 WHERE status = 'trial'
+		 ORDER BY trial_ends_at ASC`,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get trial subscriptions", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []*Subscription
+	for rows.Next() {
+		var sub Subscription
+		var lemonSubID sql.NullString
+		var trialStartedAt, trialEndsAt sql.NullTime
+		
+		err := rows.Scan(
+			&sub.ID, &sub.UserID, &lemonSubID, &sub.Plan, &sub.Status,
+			&trialStartedAt, &trialEndsAt, &sub.RAMLimitMB, &sub.DiskLimitGB,
+			&sub.CreatedAt, &sub.UpdatedAt,
+		)
+		if err != nil {
+			r.logger.Error("Failed to scan subscription", zap.Error(err))
+			continue
+		}
+		
+		if lemonSubID.Valid {
+			sub.LemonSubscriptionID = &lemonSubID.String
+		}
+		if trialStartedAt.Valid {
+			sub.TrialStartedAt = &trialStartedAt.Time
+		}
+		if trialEndsAt.Valid {
+			sub.TrialEndsAt = &trialEndsAt.Time
+		}
+		
+		subscriptions = append(subscriptions, &sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating subscriptions", zap.Error(err))
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+// UserPlanRepo implements user plan repository for getting plan_id from users table
+type UserPlanRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewUserPlanRepo creates a new user plan repository
+func NewUserPlanRepo(pool *pgxpool.Pool, logger *zap.Logger) *UserPlanRepo {
+	return &UserPlanRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// GetUserPlanID retrieves the plan_id for a user
+func (r *UserPlanRepo) GetUserPlanID(ctx context.Context, userID string) (string, error) {
+	var planID sql.NullString
+	err := r.pool.QueryRow(ctx,
+		"SELECT plan_id FROM users WHERE id = $1",
+		userID,
+	).Scan(&planID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get user plan_id", zap.Error(err), zap.String("user_id", userID))
+		return "", err
+	}
+	if !planID.Valid {
+		return "", nil // No plan assigned
+	}
+	return planID.String, nil
+}
+
+// UpdateUserPlanID updates a user's plan_id
+func (r *UserPlanRepo) UpdateUserPlanID(ctx context.Context, userID, planID string) error {
+	var planIDPtr interface{}
+	if planID != "" {
+		planIDPtr = planID
+	} else {
+		planIDPtr = nil
+	}
+	_, err := r.pool.Exec(ctx,
+		"UPDATE users SET plan_id = $1, updated_at = NOW() WHERE id = $2",
+		planIDPtr, userID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to update user plan_id", zap.Error(err), zap.String("user_id", userID), zap.String("plan_id", planID))
+		return err
+	}
+	return nil
+}
+
+// EnvVarRepo implements environment variables repository using database
+type EnvVarRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewEnvVarRepo creates a new environment variables repository
+func NewEnvVarRepo(pool *pgxpool.Pool, logger *zap.Logger) *EnvVarRepo {
+	return &EnvVarRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// GetEnvVarsByAppID retrieves all environment variables for an app
+func (r *EnvVarRepo) GetEnvVarsByAppID(ctx context.Context, appID string) ([]*EnvVar, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, app_id, key, value, created_at, updated_at 
+		 FROM env_vars 
+		 WHERE app_id = $1 
+		 ORDER BY created_at DESC`,
+		appID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get env vars", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var envVars []*EnvVar
+	for rows.Next() {
+		var envVar EnvVar
+		var createdAt, updatedAt time.Time
+		err := rows.Scan(
+			&envVar.ID,
+			&envVar.AppID,
+			&envVar.Key,
+			&envVar.Value,
+			&createdAt,
+			&updatedAt,
+		)
+		if err != nil {
+			r.logger.Error("Failed to scan env var", zap.Error(err))
+			continue
+		}
+		envVar.CreatedAt = createdAt.Format(time.RFC3339)
+		envVar.UpdatedAt = updatedAt.Format(time.RFC3339)
+		envVars = append(envVars, &envVar)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating env vars", zap.Error(err))
+		return nil, err
+	}
+
+	return envVars, nil
+}
+
+// CreateEnvVar creates a new environment variable
+func (r *EnvVarRepo) CreateEnvVar(ctx context.Context, appID, key, value string) (*EnvVar, error) {
+	var envVar EnvVar
+	var createdAt, updatedAt time.Time
+	
+	err := r.pool.QueryRow(ctx,
+		`INSERT INTO env_vars (app_id, key, value) 
+		 VALUES ($1, $2, $3) 
+		 ON CONFLICT (app_id, key) 
+		 DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()
+		 RETURNING id, app_id, key, value, created_at, updated_at`,
+		appID, key, value,
+	).Scan(
+		&envVar.ID,
+		&envVar.AppID,
+		&envVar.Key,
+		&envVar.Value,
+		&createdAt,
+		&updatedAt,
+	)
+	if err != nil {
+		r.logger.Error("Failed to create env var", zap.Error(err), zap.String("app_id", appID), zap.String("key", key))
+		return nil, err
+	}
+	
+	envVar.CreatedAt = createdAt.Format(time.RFC3339)
+	envVar.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &envVar, nil
+}
+
+// UpdateEnvVar updates the value of an existing environment variable
+// Returns pgx.ErrNoRows if the key does not exist for the app
+func (r *EnvVarRepo) UpdateEnvVar(ctx context.Context, appID, key, value string) (*EnvVar, error) {
+	var envVar EnvVar
+	var createdAt, updatedAt time.Time
+
+	err := r.pool.QueryRow(ctx,
+		`UPDATE env_vars 
+		 SET value = $3, updated_at = NOW() 
+		 WHERE app_id = $1 AND key = $2
+		 RETURNING id, app_id, key, value, created_at, updated_at`,
+		appID, key, value,
+	).Scan(
+		&envVar.ID,
+		&envVar.AppID,
+		&envVar.Key,
+		&envVar.Value,
+		&createdAt,
+		&updatedAt,
+	)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error("Failed to update env var", zap.Error(err), zap.String("app_id", appID), zap.String("key", key))
+		}
+		return nil, err
+	}
+
+	envVar.CreatedAt = createdAt.Format(time.RFC3339)
+	envVar.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &envVar, nil
+}
+
+// BulkUpsertEnvVars creates or updates many environment variables in a single transaction
+// Either all keys are written or none are
+func (r *EnvVarRepo) BulkUpsertEnvVars(ctx context.Context, appID string, vars map[string]string) ([]*EnvVar, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("Failed to begin transaction for env var import", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	// Defer rollback - will be a no-op if Commit succeeds
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && err != pgx.ErrTxClosed {
+			r.logger.Warn("Transaction rollback error (may be expected if commit succeeded)", zap.Error(err))
+		}
+	}()
+
+	// Write keys in a stable order so concurrent imports lock rows consistently
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	envVars := make([]*EnvVar, 0, len(keys))
+	for _, key := range keys {
+		var envVar EnvVar
+		var createdAt, updatedAt time.Time
+		err := tx.QueryRow(ctx,
+			`INSERT INTO env_vars (app_id, key, value) 
+			 VALUES ($1, $2, $3) 
+			 ON CONFLICT (app_id, key) 
+			 DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()
+			 RETURNING id, app_id, key, value, created_at, updated_at`,
+			appID, key, vars[key],
+		).Scan(
+			&envVar.ID,
+			&envVar.AppID,
+			&envVar.Key,
+			&envVar.Value,
+			&createdAt,
+			&updatedAt,
+		)
+		if err != nil {
+			r.logger.Error("Failed to upsert env var", zap.Error(err), zap.String("app_id", appID), zap.String("key", key))
+			return nil, err
+		}
+		envVar.CreatedAt = createdAt.Format(time.RFC3339)
+		envVar.UpdatedAt = updatedAt.Format(time.RFC3339)
+		envVars = append(envVars, &envVar)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		r.logger.Error("Failed to commit env var import", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+
+	r.logger.Info("Imported env vars", zap.String("app_id", appID), zap.Int("count", len(envVars)))
+	return envVars, nil
+}
+
+// DeleteEnvVar deletes an environment variable by app ID and key
+func (r *EnvVarRepo) DeleteEnvVar(ctx context.Context, appID, key string) error {
+	result, err := r.pool.Exec(ctx,
+		"DELETE FROM env_vars WHERE app_id = $1 AND key = $2",
+		appID, key,
+	)
+	if err != nil {
+		r.logger.Error("Failed to delete env var", zap.Error(err), zap.String("app_id", appID), zap.String("key", key))
+		return err
+	}
+	
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	
+	return nil
+}
+
+// BuildJobRepo handles build_jobs table operations
+type BuildJobRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewBuildJobRepo creates a new BuildJob repository
+func NewBuildJobRepo(pool *pgxpool.Pool, logger *zap.Logger) *BuildJobRepo {
+	return &BuildJobRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// CreateBuildJob creates a new build_job record in the database
+// This ensures the build_job_id exists when CreateDeployment is called
+func (r *BuildJobRepo) CreateBuildJob(ctx context.Context, buildJobID, appID, status string) error {
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO build_jobs (id, app_id, status, started_at)
+		 VALUES ($1, $2, $3, CASE WHEN $3 = 'building' THEN NOW() END)
+		 ON CONFLICT (id) DO UPDATE SET status = EXCLUDED.status, started_at = EXCLUDED.started_at, updated_at = NOW()
+		 WHERE build_jobs.status = 'pending'`,
+		buildJobID, appID, status,
+	)
+	if err != nil {
+		r.logger.Error("Failed to create build_job",
+			zap.Error(err),
+			zap.String("build_job_id", buildJobID),
+			zap.String("app_id", appID),
+			zap.String("status", status),
+		)
+		return err
+	}
+	
+	r.logger.Info("Build job created in database",
+		zap.String("build_job_id", buildJobID),
+		zap.String("app_id", appID),
+		zap.String("status", status),
+	)
+	return nil
+}
+
+// UpdateBuildJob updates a build_job record
+func (r *BuildJobRepo) UpdateBuildJob(ctx context.Context, buildJobID, status, buildLog, errorMsg string) error {
+	// Sanitize error message to remove NULL bytes
+	if errorMsg != "" {
+		errorMsg = strings.ReplaceAll(errorMsg, "\x00", "")
+	}
+	
+	_, err := r.pool.Exec(ctx,
+		`UPDATE build_jobs 
+		 SET status = COALESCE(NULLIF($2, ''), status),
+		     build_log = COALESCE(NULLIF($3, ''), build_log),
+		     error_message = COALESCE(NULLIF($4, ''), error_message),
+		     finished_at = CASE WHEN $2 IN ('completed', 'failed', 'cancelled') THEN NOW() ELSE finished_at END,
+		     updated_at = NOW()
+		 WHERE id = $1`,
+		buildJobID, status, buildLog, errorMsg,
+	)
+	if err != nil {
+		r.logger.Error("Failed to update build_job",
+			zap.Error(err),
+			zap.String("build_job_id", buildJobID),
+		)
+		return err
+	}
+	return nil
+}
+
+// SetBuildJobBaseImage records the base image a successful build used, which also becomes its app's
+// current base image. An unknown digest keeps the app's digest only if the base image did not change
+func (r *BuildJobRepo) SetBuildJobBaseImage(ctx context.Context, buildJobID, image, digest string) error {
+	_, err := r.pool.Exec(ctx,
+		`WITH job AS (
+		     UPDATE build_jobs SET base_image = $2, base_image_digest = NULLIF($3, ''), updated_at = NOW()
+		     WHERE id = $1
+		     RETURNING app_id
+		 )
+		 UPDATE apps SET
+		     base_image_digest = CASE
+		         WHEN $3 <> '' THEN $3
+		         WHEN apps.base_image = $2 THEN apps.base_image_digest
+		     END,
+		     base_image = $2
+		 FROM job WHERE apps.id = job.app_id`,
+		buildJobID, image, digest,
+	)
+	if err != nil {
+		r.logger.Error("Failed to record build base image", zap.Error(err), zap.String("build_job_id", buildJobID))
+		return err
+	}
+	return nil
+}
+
+// SetBuildJobRuntime records the runtime detected in a build's source
+func (r *BuildJobRepo) SetBuildJobRuntime(ctx context.Context, buildJobID, runtime string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE build_jobs SET runtime = $2, updated_at = NOW() WHERE id = $1`,
+		buildJobID, runtime,
+	)
+	if err != nil {
+		r.logger.Error("Failed to record build runtime", zap.Error(err), zap.String("build_job_id", buildJobID))
+		return err
+	}
+	return nil
+}
+
+// SetBuildJobStrategy records the build strategy that produced a build's image
+func (r *BuildJobRepo) SetBuildJobStrategy(ctx context.Context, buildJobID, strategy string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE build_jobs SET build_strategy = $2, updated_at = NOW() WHERE id = $1`,
+		buildJobID, strategy,
+	)
+	if err != nil {
+		r.logger.Error("Failed to record build strategy", zap.Error(err), zap.String("build_job_id", buildJobID))
+		return err
+	}
+	return nil
+}
+
+// MarkBuildJobDraining records that the worker running a build has started draining
+func (r *BuildJobRepo) MarkBuildJobDraining(ctx context.Context, buildJobID string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE build_jobs SET draining_since = NOW(), updated_at = NOW() WHERE id = $1 AND status = 'building'`,
+		buildJobID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to mark build_job draining", zap.Error(err), zap.String("build_job_id", buildJobID))
+		return err
+	}
+	return nil
+}
+
+// RequeueBuildJob puts a build its worker's drain window cut off back to pending; the task is back on the
+// queue, and the next worker to pick it up starts it over (CreateBuildJob moves it to building again)
+func (r *BuildJobRepo) RequeueBuildJob(ctx context.Context, buildJobID string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE build_jobs SET status = 'pending', draining_since = NULL, interruptions = interruptions + 1, updated_at = NOW()
+		 WHERE id = $1 AND status = 'building'`,
+		buildJobID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to requeue build_job", zap.Error(err), zap.String("build_job_id", buildJobID))
+		return err
+	}
+	return nil
+}
+
+// GetBuildJobStatus returns the status of a build_job record
+// Returns pgx.ErrNoRows if the build job does not exist
+func (r *BuildJobRepo) GetBuildJobStatus(ctx context.Context, buildJobID string) (string, error) {
+	var status string
+	err := r.pool.QueryRow(ctx,
+		`SELECT status FROM build_jobs WHERE id = $1`,
+		buildJobID,
+	).Scan(&status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get build_job status", zap.Error(err), zap.String("build_job_id", buildJobID))
+		return "", err
+	}
+	return status, nil
+}
+
+// WebhookEventRepo keeps the inbox of billing webhook deliveries: it stops duplicate deliveries from being
+// applied twice and keeps the payloads of events that failed to apply so they can be retried
+type WebhookEventRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewWebhookEventRepo creates a new webhook event repository
+func NewWebhookEventRepo(pool *pgxpool.Pool, logger *zap.Logger) *WebhookEventRepo {
+	return &WebhookEventRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// BillingWebhookEvent is a billing webhook delivery in the inbox
+type BillingWebhookEvent struct {
+	ID             string          `json:"id"`
+	Provider       string          `json:"provider"`
+	EventID        string          `json:"event_id"`
+	EventName      string          `json:"event_name"`
+	EventTimestamp string          `json:"event_timestamp,omitempty"`
+	Status         string          `json:"status"` // pending | processed | failed
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"last_error,omitempty"`
+	NextAttemptAt  string          `json:"next_attempt_at,omitempty"` // When a pending event is retried
+	Payload        json.RawMessage `json:"payload,omitempty"`         // Missing for events received before the inbox existed
+	ReceivedAt     string          `json:"received_at"`
+	ProcessedAt    string          `json:"processed_at,omitempty"`
+}
+
+// billingWebhookEventColumns is the column list shared by inbox queries
+const billingWebhookEventColumns = `id, provider, event_id, event_name, event_timestamp, status, attempts, last_error,
+		        next_attempt_at, payload, received_at, processed_at`
+
+// scanBillingWebhookEvent scans a row selected with billingWebhookEventColumns
+func scanBillingWebhookEvent(row pgx.Row) (*BillingWebhookEvent, error) {
+	var e BillingWebhookEvent
+	var lastError sql.NullString
+	var eventTimestamp, nextAttemptAt, processedAt sql.NullTime
+	var payload []byte
+	var receivedAt time.Time
+	if err := row.Scan(
+		&e.ID, &e.Provider, &e.EventID, &e.EventName, &eventTimestamp, &e.Status, &e.Attempts, &lastError,
+		&nextAttemptAt, &payload, &receivedAt, &processedAt,
+	); err != nil {
+		return nil, err
+	}
+	e.LastError = lastError.String
+	if eventTimestamp.Valid {
+		e.EventTimestamp = eventTimestamp.Time.Format(time.RFC3339)
+	}
+	if nextAttemptAt.Valid {
+		e.NextAttemptAt = nextAttemptAt.Time.Format(time.RFC3339)
+	}
+	if len(payload) > 0 {
+		e.Payload = json.RawMessage(payload)
+	}
+	e.ReceivedAt = receivedAt.Format(time.RFC3339)
+	if processedAt.Valid {
+		e.ProcessedAt = processedAt.Time.Format(time.RFC3339)
+	}
+	return &e, nil
+}
+
+// ReceiveEvent records a webhook delivery and its payload as pending, leased to the caller until leaseUntil
+// so the retry worker leaves it alone while it is being applied
+// Returns the inbox ID and false if the event was already received (duplicate delivery)
+func (r *WebhookEventRepo) ReceiveEvent(ctx context.Context, provider, eventID, eventName string, eventTimestamp *time.Time, payload []byte, leaseUntil time.Time) (string, bool, error) {
+	var id string
+	err := r.pool.QueryRow(ctx,
+		`INSERT INTO billing_webhook_events (provider, event_id, event_name, event_timestamp, payload, status, next_attempt_at)
+		 VALUES ($1, $2, $3, $4, $5, 'pending', $6)
+		 ON CONFLICT (provider, event_id) DO NOTHING
+		 RETURNING id`,
+		provider, eventID, eventName, eventTimestamp, payload, leaseUntil,
+	).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		r.logger.Error("Failed to record webhook event", zap.Error(err), zap.String("event_id", eventID))
+		return "", false, err
+	}
+	return id, true, nil
+}
+
+// RecordEventAttempt records the outcome of applying an inbox event
+// A failed event is retried at nextAttemptAt, or marked failed when nextAttemptAt is nil
+func (r *WebhookEventRepo) RecordEventAttempt(ctx context.Context, id string, processErr error, nextAttemptAt *time.Time) error {
+	var err error
+	switch {
+	case processErr == nil:
+		_, err = r.pool.Exec(ctx,
+			`UPDATE billing_webhook_events
+			 SET status = 'processed', attempts = attempts + 1, last_error = NULL, next_attempt_at = NULL, processed_at = NOW()
+			 WHERE id = $1`,
+			id,
+		)
+	case nextAttemptAt != nil:
+		_, err = r.pool.Exec(ctx,
+			`UPDATE billing_webhook_events
+			 SET status = 'pending', attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+			 WHERE id = $1`,
+			id, processErr.Error(), *nextAttemptAt,
+		)
+	default:
+		_, err = r.pool.Exec(ctx,
+			`UPDATE billing_webhook_events
+			 SET status = 'failed', attempts = attempts + 1, last_error = $2, next_attempt_at = NULL
+			 WHERE id = $1`,
+			id, processErr.Error(),
+		)
+	}
+	if err != nil {
+		r.logger.Error("Failed to record webhook event attempt", zap.Error(err), zap.String("id", id))
+		return err
+	}
+	return nil
+}
+
+// ClaimDueEvents leases up to limit pending events whose retry is due until leaseUntil
+// SKIP LOCKED keeps concurrent API instances from applying the same attempt twice
+func (r *WebhookEventRepo) ClaimDueEvents(ctx context.Context, limit int, leaseUntil time.Time) ([]*BillingWebhookEvent, error) {
+	rows, err := r.pool.Query(ctx,
+		`WITH due AS (
+			SELECT id AS due_id FROM billing_webhook_events
+			WHERE status = 'pending' AND next_attempt_at <= NOW() AND payload IS NOT NULL
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		 )
+		 UPDATE billing_webhook_events SET next_attempt_at = $2
+		 FROM due
+		 WHERE id = due.due_id
+		 RETURNING `+billingWebhookEventColumns,
+		limit, leaseUntil,
+	)
+	if err != nil {
+		r.logger.Error("Failed to claim due webhook events", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*BillingWebhookEvent
+	for rows.Next() {
+		event, err := scanBillingWebhookEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// ClaimFailedEvent leases a failed event for a replay until leaseUntil
+// Returns pgx.ErrNoRows unless the event failed and its payload was recorded
+func (r *WebhookEventRepo) ClaimFailedEvent(ctx context.Context, id string, leaseUntil time.Time) (*BillingWebhookEvent, error) {
+	event, err := scanBillingWebhookEvent(r.pool.QueryRow(ctx,
+		`UPDATE billing_webhook_events SET status = 'pending', next_attempt_at = $2
+		 WHERE id = $1 AND status = 'failed' AND payload IS NOT NULL
+		 RETURNING `+billingWebhookEventColumns,
+		id, leaseUntil,
+	))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		r.logger.Error("Failed to claim webhook event for replay", zap.Error(err), zap.String("id", id))
+	}
+	return event, err
+}
+
+// GetEvent returns an inbox event
+func (r *WebhookEventRepo) GetEvent(ctx context.Context, id string) (*BillingWebhookEvent, error) {
+	return scanBillingWebhookEvent(r.pool.QueryRow(ctx,
+		`SELECT `+billingWebhookEventColumns+` FROM billing_webhook_events WHERE id = $1`,
+		id,
+	))
+}
+
+// ListEvents lists inbox events with the given status (empty = all), newest first
+func (r *WebhookEventRepo) ListEvents(ctx context.Context, status string, limit, offset int) ([]*BillingWebhookEvent, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+billingWebhookEventColumns+`
+		 FROM billing_webhook_events
+		 WHERE ($1 = '' OR status = $1)
+		 ORDER BY received_at DESC
+		 LIMIT $2 OFFSET $3`,
+		status, limit, offset,
+	)
+	if err != nil {
+		r.logger.Error("Failed to list webhook events", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]*BillingWebhookEvent, 0)
+	for rows.Next() {
+		event, err := scanBillingWebhookEvent(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan webhook event", zap.Error(err))
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// ReleaseEvent removes a recorded webhook event so a retried delivery can be processed again
+// Used when an event failed to apply and its failure could not be recorded for a retry
+func (r *WebhookEventRepo) ReleaseEvent(ctx context.Context, provider, eventID string) error {
+	_, err := r.pool.Exec(ctx,
+		"DELETE FROM billing_webhook_events WHERE provider = $1 AND event_id = $2",
+		provider, eventID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to release webhook event", zap.Error(err), zap.String("event_id", eventID))
+		return err
+	}
+	return nil
+}
+
+// DomainRepo handles app_domains table operations (custom domains)
+type DomainRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewDomainRepo creates a new custom domain repository
+func NewDomainRepo(pool *pgxpool.Pool, logger *zap.Logger) *DomainRepo {
+	return &DomainRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// domainColumns is the column list shared by custom domain queries
+const domainColumns = `id, app_id, domain, verification_token, status, verification_method,
+		        verification_error, verified_at, created_at, updated_at`
+
+// scanDomain scans a row selected with domainColumns into an AppDomain
+func scanDomain(row pgx.Row) (*AppDomain, error) {
+	var d AppDomain
+	var method, verifyErr sql.NullString
+	var verifiedAt sql.NullTime
+	var createdAt, updatedAt time.Time
+	if err := row.Scan(
+		&d.ID, &d.AppID, &d.Domain, &d.VerificationToken, &d.Status, &method,
+		&verifyErr, &verifiedAt, &createdAt, &updatedAt,
+	); err != nil {
+		return nil, err
+	}
+	d.VerificationMethod = method.String
+	d.VerificationError = verifyErr.String
+	if verifiedAt.Valid {
+		d.VerifiedAt = verifiedAt.Time.Format(time.RFC3339)
+	}
+	d.CreatedAt = createdAt.Format(time.RFC3339)
+	d.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &d, nil
+}
+
+// CreateDomain attaches a custom domain to an app in pending state
+// Returns a *pgconn.PgError with code 23505 if the domain is already attached to an app
+func (r *DomainRepo) CreateDomain(ctx context.Context, appID, domain, verificationToken string) (*AppDomain, error) {
+	d, err := scanDomain(r.pool.QueryRow(ctx,
+		`INSERT INTO app_domains (app_id, domain, verification_token)
+		 VALUES ($1, $2, $3)
+		 RETURNING `+domainColumns,
+		appID, domain, verificationToken,
+	))
+	if err != nil {
+		r.logger.Error("Failed to create domain", zap.Error(err), zap.String("app_id", appID), zap.String("domain", domain))
+		return nil, err
+	}
+	return d, nil
+}
+
+// GetDomainsByAppID retrieves all custom domains for an app
+func (r *DomainRepo) GetDomainsByAppID(ctx context.Context, appID string) ([]*AppDomain, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+domainColumns+`
+		 FROM app_domains
+		 WHERE app_id = $1
+		 ORDER BY created_at ASC`,
+		appID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get domains", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := make([]*AppDomain, 0)
+	for rows.Next() {
+		d, err := scanDomain(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan domain", zap.Error(err))
+			continue
+		}
+		domains = append(domains, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating domains", zap.Error(err))
+		return nil, err
+	}
+
+	return domains, nil
+}
+
+// GetDomainByID retrieves a custom domain belonging to an app
+func (r *DomainRepo) GetDomainByID(ctx context.Context, appID, domainID string) (*AppDomain, error) {
+	d, err := scanDomain(r.pool.QueryRow(ctx,
+		`SELECT `+domainColumns+`
+		 FROM app_domains
+		 WHERE id = $1 AND app_id = $2`,
+		domainID, appID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get domain", zap.Error(err), zap.String("domain_id", domainID))
+		return nil, err
+	}
+	return d, nil
+}
+
+// GetVerifiedDomainsByAppID returns the hostnames of all verified custom domains for an app
+func (r *DomainRepo) GetVerifiedDomainsByAppID(ctx context.Context, appID string) ([]string, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT domain FROM app_domains WHERE app_id = $1 AND status = 'verified' ORDER BY created_at ASC`,
+		appID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get verified domains", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []string
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			r.logger.Error("Failed to scan verified domain", zap.Error(err))
+			continue
+		}
+		domains = append(domains, domain)
+	}
+	return domains, rows.Err()
+}
+
+// UpdateDomainVerification records the outcome of a DNS verification attempt
+func (r *DomainRepo) UpdateDomainVerification(ctx context.Context, domainID, status, method, errorMsg string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE app_domains
+		 SET status = $2,
+		     verification_method = NULLIF($3, ''),
+		     verification_error = NULLIF($4, ''),
+		     verified_at = CASE WHEN $2 = 'verified' THEN NOW() ELSE verified_at END,
+		     updated_at = NOW()
+		 WHERE id = $1`,
+		domainID, status, method, errorMsg,
+	)
+	if err != nil {
+		r.logger.Error("Failed to update domain verification", zap.Error(err), zap.String("domain_id", domainID))
+		return err
+	}
+	return nil
+}
+
+// DeleteDomain removes a custom domain from an app
+func (r *DomainRepo) DeleteDomain(ctx context.Context, appID, domainID string) error {
+	result, err := r.pool.Exec(ctx,
+		"DELETE FROM app_domains WHERE id = $1 AND app_id = $2",
+		domainID, appID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to delete domain", zap.Error(err), zap.String("domain_id", domainID))
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// BillingReviewItem is an unmatched billing webhook event awaiting admin review
+type BillingReviewItem struct {
+	ID             string          `json:"id"`
+	Provider       string          `json:"provider"`
+	EventID        string          `json:"event_id,omitempty"`
+	EventName      string          `json:"event_name"`
+	CustomerID     string          `json:"customer_id,omitempty"`
+	SubscriptionID string          `json:"subscription_id,omitempty"`
+	CustomerEmail  string          `json:"customer_email,omitempty"`
+	Reason         string          `json:"reason"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	CreatedAt      string          `json:"created_at"`
+	ResolvedAt     string          `json:"resolved_at,omitempty"`
+}
+
+// BillingReviewRepo handles the billing_review_queue table
+type BillingReviewRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewBillingReviewRepo creates a new billing review queue repository
+func NewBillingReviewRepo(pool *pgxpool.Pool, logger *zap.Logger) *BillingReviewRepo {
+	return &BillingReviewRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// CreateReviewItem adds an unmatched webhook event to the review queue
+func (r *BillingReviewRepo) CreateReviewItem(ctx context.Context, item *BillingReviewItem) error {
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO billing_review_queue
+		 (provider, event_id, event_name, customer_id, subscription_id, customer_email, reason, payload)
+		 VALUES ($1, NULLIF($2, ''), $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), $7, $8)`,
+		item.Provider, item.EventID, item.EventName, item.CustomerID, item.SubscriptionID,
+		item.CustomerEmail, item.Reason, []byte(item.Payload),
+	)
+	if err != nil {
+		r.logger.Error("Failed to create billing review item",
+			zap.Error(err),
+			zap.String("event_name", item.EventName),
+			zap.String("customer_id", item.CustomerID),
+		)
+		return err
+	}
+	return nil
+}
+
+// ListReviewItems lists review queue items with the given status (empty = all), newest first
+func (r *BillingReviewRepo) ListReviewItems(ctx context.Context, status string, limit, offset int) ([]BillingReviewItem, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, provider, event_id, event_name, customer_id, subscription_id, customer_email,
+		        reason, payload, status, created_at, resolved_at
+		 FROM billing_review_queue
+		 WHERE ($1 = '' OR status = $1)
+		 ORDER BY created_at DESC
+		 LIMIT $2 OFFSET $3`,
+		status, limit, offset,
+	)
+	if err != nil {
+		r.logger.Error("Failed to list billing review items", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]BillingReviewItem, 0)
+	for rows.Next() {
+		var item BillingReviewItem
+		var eventID, customerID, subscriptionID, customerEmail sql.NullString
+		var payload []byte
+		var createdAt time.Time
+		var resolvedAt sql.NullTime
+		if err := rows.Scan(
+			&item.ID, &item.Provider, &eventID, &item.EventName, &customerID, &subscriptionID, &customerEmail,
+			&item.Reason, &payload, &item.Status, &createdAt, &resolvedAt,
+		); err != nil {
+			r.logger.Error("Failed to scan billing review item", zap.Error(err))
+			continue
+		}
+		item.EventID = eventID.String
+		item.CustomerID = customerID.String
+		item.SubscriptionID = subscriptionID.String
+		item.CustomerEmail = customerEmail.String
+		item.Payload = json.RawMessage(payload)
+		item.CreatedAt = createdAt.Format(time.RFC3339)
+		if resolvedAt.Valid {
+			item.ResolvedAt = resolvedAt.Time.Format(time.RFC3339)
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating billing review items", zap.Error(err))
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// ResolveReviewItem marks a review queue item as resolved
+func (r *BillingReviewRepo) ResolveReviewItem(ctx context.Context, itemID string) error {
+	result, err := r.pool.Exec(ctx,
+		`UPDATE billing_review_queue SET status = 'resolved', resolved_at = NOW() WHERE id = $1 AND status = 'open'`,
+		itemID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to resolve billing review item", zap.Error(err), zap.String("item_id", itemID))
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// UsageRepo handles usage_records (metering) and allocation queries
+type UsageRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewUsageRepo creates a new usage repository
+func NewUsageRepo(pool *pgxpool.Pool, logger *zap.Logger) *UsageRepo {
+	return &UsageRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// GetAllocatedResources returns the app count and RAM/disk reserved by a user's apps
+// Disabled (paused) apps do not hold resources and are excluded
+func (r *UsageRepo) GetAllocatedResources(ctx context.Context, userID string) (*services.AllocatedResources, error) {
+	var res services.AllocatedResources
+	err := r.pool.QueryRow(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(ram_mb), 0), COALESCE(SUM(disk_gb), 0)
+		 FROM apps
+		 WHERE user_id = $1 AND status != 'disabled'`,
+		userID,
+	).Scan(&res.AppCount, &res.RAMMB, &res.DiskGB)
+	if err != nil {
+		r.logger.Error("Failed to get allocated resources", zap.Error(err), zap.String("user_id", userID))
+		return nil, err
+	}
+	return &res, nil
+}
+
+// SumUsage returns the total quantity of a metric recorded for a user in [since, until)
+func (r *UsageRepo) SumUsage(ctx context.Context, userID, metric string, since, until time.Time) (int64, error) {
+	var total int64
+	err := r.pool.QueryRow(ctx,
+		`SELECT COALESCE(SUM(quantity), 0)::BIGINT
+		 FROM usage_records
+		 WHERE user_id = $1 AND metric = $2 AND recorded_at >= $3 AND recorded_at < $4`,
+		userID, metric, since, until,
+	).Scan(&total)
+	if err != nil {
+		r.logger.Error("Failed to sum usage", zap.Error(err), zap.String("user_id", userID), zap.String("metric", metric))
+		return 0, err
+	}
+	return total, nil
+}
+
+// RecordUsage inserts a metered usage record (appID may be empty for account-level usage)
+func (r *UsageRepo) RecordUsage(ctx context.Context, userID, appID, metric string, quantity int64) error {
+	var appIDParam interface{}
+	if appID != "" {
+		appIDParam = appID
+	}
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO usage_records (user_id, app_id, metric, quantity) VALUES ($1, $2, $3, $4)`,
+		userID, appIDParam, metric, quantity,
+	)
+	if err != nil {
+		r.logger.Error("Failed to record usage", zap.Error(err), zap.String("user_id", userID), zap.String("metric", metric))
+		return err
+	}
+	return nil
+}
+
+// GetUsageByApp returns per-app totals of a metric for a user in [since, until), largest first
+// Usage from deleted apps is grouped under an empty app ID
+func (r *UsageRepo) GetUsageByApp(ctx context.Context, userID, metric string, since, until time.Time) ([]services.AppUsage, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT ur.app_id, COALESCE(a.name, ''), COALESCE(SUM(ur.quantity), 0)::BIGINT, COUNT(*)
+		 FROM usage_records ur
+		 LEFT JOIN apps a ON a.id = ur.app_id
+		 WHERE ur.user_id = $1 AND ur.metric = $2 AND ur.recorded_at >= $3 AND ur.recorded_at < $4
+		 GROUP BY ur.app_id, a.name
+		 ORDER BY 3 DESC`,
+		userID, metric, since, until,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get usage by app", zap.Error(err), zap.String("user_id", userID), zap.String("metric", metric))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []services.AppUsage
+	for rows.Next() {
+		var u services.AppUsage
+		var appID sql.NullString
+		if err := rows.Scan(&appID, &u.AppName, &u.Quantity, &u.Records); err != nil {
+			r.logger.Error("Failed to scan app usage", zap.Error(err))
+			return nil, err
+		}
+		u.AppID = appID.String
+		if !appID.Valid {
+			u.AppName = "Deleted apps"
+		}
+		usage = append(usage, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating app usage", zap.Error(err))
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// OrganizationRepo handles organizations, memberships and invitations
+type OrganizationRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewOrganizationRepo creates a new organization repository
+func NewOrganizationRepo(pool *pgxpool.Pool, logger *zap.Logger) *OrganizationRepo {
+	return &OrganizationRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// CreateOrganization creates an organization and its owner membership in one transaction
+func (r *OrganizationRepo) CreateOrganization(ctx context.Context, ownerID, name, slug string) (*Organization, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("Failed to begin transaction for organization creation", zap.Error(err))
+		return nil, err
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && err != pgx.ErrTxClosed {
+			r.logger.Warn("Transaction rollback error (may be expected if commit succeeded)", zap.Error(err))
+		}
+	}()
+
+	var org Organization
+	var createdAt, updatedAt time.Time
+	err = tx.QueryRow(ctx,
+		`INSERT INTO organizations (name, slug, owner_id) VALUES ($1, $2, $3)
+		 RETURNING id, name, slug, owner_id, created_at, updated_at`,
+		name, slug, ownerID,
+	).Scan(&org.ID, &org.Name, &org.Slug, &org.OwnerID, &createdAt, &updatedAt)
+	if err != nil {
+		r.logger.Error("Failed to create organization", zap.Error(err), zap.String("owner_id", ownerID), zap.String("slug", slug))
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, 'owner')`,
+		org.ID, ownerID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to create organization owner membership", zap.Error(err), zap.String("organization_id", org.ID))
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		r.logger.Error("Failed to commit organization creation", zap.Error(err), zap.String("organization_id", org.ID))
+		return nil, err
+	}
+
+	org.Role = OrgRoleOwner
+	org.CreatedAt = createdAt.Format(time.RFC3339)
+	org.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &org, nil
+}
+
+// GetOrganizationsByUserID lists organizations the user belongs to, with the user's role in each
+func (r *OrganizationRepo) GetOrganizationsByUserID(ctx context.Context, userID string) ([]*Organization, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT o.id, o.name, o.slug, o.owner_id, m.role, o.created_at, o.updated_at
+		 FROM organizations o
+		 JOIN organization_members m ON m.organization_id = o.id
+		 WHERE m.user_id = $1
+		 ORDER BY o.name`,
+		userID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get organizations", zap.Error(err), zap.String("user_id", userID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []*Organization
+	for rows.Next() {
+		var org Organization
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&org.ID, &org.Name, &org.Slug, &org.OwnerID, &org.Role, &createdAt, &updatedAt); err != nil {
+			r.logger.Error("Failed to scan organization", zap.Error(err))
+			return nil, err
+		}
+		org.CreatedAt = createdAt.Format(time.RFC3339)
+		org.UpdatedAt = updatedAt.Format(time.RFC3339)
+		orgs = append(orgs, &org)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating organizations", zap.Error(err))
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// GetOrganizationForMember retrieves an organization with the user's role (pgx.ErrNoRows if not a member)
+func (r *OrganizationRepo) GetOrganizationForMember(ctx context.Context, orgID, userID string) (*Organization, error) {
+	var org Organization
+	var createdAt, updatedAt time.Time
+	err := r.pool.QueryRow(ctx,
+		`SELECT o.id, o.name, o.slug, o.owner_id, m.role, o.created_at, o.updated_at
+		 FROM organizations o
+		 JOIN organization_members m ON m.organization_id = o.id
+		 WHERE o.id = $1 AND m.user_id = $2`,
+		orgID, userID,
+	).Scan(&org.ID, &org.Name, &org.Slug, &org.OwnerID, &org.Role, &createdAt, &updatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get organization", zap.Error(err), zap.String("organization_id", orgID), zap.String("user_id", userID))
+		return nil, err
+	}
+	org.CreatedAt = createdAt.Format(time.RFC3339)
+	org.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &org, nil
+}
+
+// GetOrganizationByID retrieves an organization whatever the requesting user's membership (Role is empty)
+func (r *OrganizationRepo) GetOrganizationByID(ctx context.Context, orgID string) (*Organization, error) {
+	var org Organization
+	var createdAt, updatedAt time.Time
+	err := r.pool.QueryRow(ctx,
+		`SELECT id, name, slug, owner_id, created_at, updated_at FROM organizations WHERE id = $1`,
+		orgID,
+	).Scan(&org.ID, &org.Name, &org.Slug, &org.OwnerID, &createdAt, &updatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get organization", zap.Error(err), zap.String("organization_id", orgID))
+		return nil, err
+	}
+	org.CreatedAt = createdAt.Format(time.RFC3339)
+	org.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &org, nil
+}
+
+// DeleteOrganization deletes an organization (its apps become personal apps of the owner)
+func (r *OrganizationRepo) DeleteOrganization(ctx context.Context, orgID string) error {
+	result, err := r.pool.Exec(ctx, `DELETE FROM organizations WHERE id = $1`, orgID)
+	if err != nil {
+		r.logger.Error("Failed to delete organization", zap.Error(err), zap.String("organization_id", orgID))
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// ListMembers lists an organization's members with their emails
+func (r *OrganizationRepo) ListMembers(ctx context.Context, orgID string) ([]*OrganizationMember, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT m.user_id, u.email, COALESCE(u.full_name, ''), m.role, m.created_at
+		 FROM organization_members m
+		 JOIN users u ON u.id = m.user_id
+		 WHERE m.organization_id = $1
+		 ORDER BY m.created_at`,
+		orgID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to list organization members", zap.Error(err), zap.String("organization_id", orgID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []*OrganizationMember
+	for rows.Next() {
+		var m OrganizationMember
+		var joinedAt time.Time
+		if err := rows.Scan(&m.UserID, &m.Email, &m.FullName, &m.Role, &joinedAt); err != nil {
+			r.logger.Error("Failed to scan organization member", zap.Error(err))
+			return nil, err
+		}
+		m.JoinedAt = joinedAt.Format(time.RFC3339)
+		members = append(members, &m)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating organization members", zap.Error(err))
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// UpdateMemberRole changes a member's role (the owner's membership cannot be changed)
+func (r *OrganizationRepo) UpdateMemberRole(ctx context.Context, orgID, userID, role string) error {
+	result, err := r.pool.Exec(ctx,
+		`UPDATE organization_members SET role = $3, updated_at = NOW()
+		 WHERE organization_id = $1 AND user_id = $2 AND role != 'owner'`,
+		orgID, userID, role,
+	)
+	if err != nil {
+		r.logger.Error("Failed to update member role", zap.Error(err), zap.String("organization_id", orgID), zap.String("user_id", userID))
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// RemoveMember removes a member (the owner cannot be removed)
+func (r *OrganizationRepo) RemoveMember(ctx context.Context, orgID, userID string) error {
+	result, err := r.pool.Exec(ctx,
+		`DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2 AND role != 'owner'`,
+		orgID, userID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to remove member", zap.Error(err), zap.String("organization_id", orgID), zap.String("user_id", userID))
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// CountSeats counts members plus unexpired pending invitations (seats are reserved when inviting)
+func (r *OrganizationRepo) CountSeats(ctx context.Context, orgID string) (int, error) {
+	var seats int
+	err := r.pool.QueryRow(ctx,
+		`SELECT (SELECT COUNT(*) FROM organization_members WHERE organization_id = $1)
+		      + (SELECT COUNT(*) FROM organization_invitations
+		         WHERE organization_id = $1 AND accepted_at IS NULL AND expires_at > NOW())`,
+		orgID,
+	).Scan(&seats)
+	if err != nil {
+		r.logger.Error("Failed to count organization seats", zap.Error(err), zap.String("organization_id", orgID))
+		return 0, err
+	}
+	return seats, nil
+}
+
+// CreateInvitation creates a pending invitation, replacing an expired one for the same email
+func (r *OrganizationRepo) CreateInvitation(ctx context.Context, orgID, email, role, tokenHash, invitedBy string, expiresAt time.Time) (*OrganizationInvitation, error) {
+	// Expired invitations still hold the pending unique index - clear them first
+	if _, err := r.pool.Exec(ctx,
+		`DELETE FROM organization_invitations
+		 WHERE organization_id = $1 AND email = $2 AND accepted_at IS NULL AND expires_at <= NOW()`,
+		orgID, email,
+	); err != nil {
+		r.logger.Error("Failed to clear expired invitation", zap.Error(err), zap.String("organization_id", orgID))
+		return nil, err
+	}
+
+	var inv OrganizationInvitation
+	var createdAt time.Time
+	err := r.pool.QueryRow(ctx,
+		`INSERT INTO organization_invitations (organization_id, email, role, token_hash, invited_by, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING id, organization_id, email, role, expires_at, created_at`,
+		orgID, email, role, tokenHash, invitedBy, expiresAt,
+	).Scan(&inv.ID, &inv.OrganizationID, &inv.Email, &inv.Role, &expiresAt, &createdAt)
+	if err != nil {
+		r.logger.Error("Failed to create invitation", zap.Error(err), zap.String("organization_id", orgID), zap.String("email", email))
+		return nil, err
+	}
+	inv.ExpiresAt = expiresAt.Format(time.RFC3339)
+	inv.CreatedAt = createdAt.Format(time.RFC3339)
+	return &inv, nil
+}
+
+// ListPendingInvitations lists invitations that have not been accepted yet
+func (r *OrganizationRepo) ListPendingInvitations(ctx context.Context, orgID string) ([]*OrganizationInvitation, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, organization_id, email, role, expires_at, created_at
+		 FROM organization_invitations
+		 WHERE organization_id = $1 AND accepted_at IS NULL
+		 ORDER BY created_at DESC`,
+		orgID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to list invitations", zap.Error(err), zap.String("organization_id", orgID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []*OrganizationInvitation
+	for rows.Next() {
+		var inv OrganizationInvitation
+		var expiresAt, createdAt time.Time
+		if err := rows.Scan(&inv.ID, &inv.OrganizationID, &inv.Email, &inv.Role, &expiresAt, &createdAt); err != nil {
+			r.logger.Error("Failed to scan invitation", zap.Error(err))
+			return nil, err
+		}
+		inv.ExpiresAt = expiresAt.Format(time.RFC3339)
+		inv.CreatedAt = createdAt.Format(time.RFC3339)
+		inv.Expired = time.Now().After(expiresAt)
+		invitations = append(invitations, &inv)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating invitations", zap.Error(err))
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// DeleteInvitation revokes a pending invitation
+func (r *OrganizationRepo) DeleteInvitation(ctx context.Context, orgID, invitationID string) error {
+	result, err := r.pool.Exec(ctx,
+		`DELETE FROM organization_invitations WHERE id = $1 AND organization_id = $2 AND accepted_at IS NULL`,
+		invitationID, orgID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to delete invitation", zap.Error(err), zap.String("invitation_id", invitationID))
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// GetPendingInvitationByTokenHash finds an unaccepted invitation by its token hash
+func (r *OrganizationRepo) GetPendingInvitationByTokenHash(ctx context.Context, tokenHash string) (*OrganizationInvitation, error) {
+	var inv OrganizationInvitation
+	var expiresAt, createdAt time.Time
+	err := r.pool.QueryRow(ctx,
+		`SELECT i.id, i.organization_id, o.name, i.email, i.role, i.expires_at, i.created_at
+		 FROM organization_invitations i
+		 JOIN organizations o ON o.id = i.organization_id
+		 WHERE i.token_hash = $1 AND i.accepted_at IS NULL`,
+		tokenHash,
+	).Scan(&inv.ID, &inv.OrganizationID, &inv.OrganizationName, &inv.Email, &inv.Role, &expiresAt, &createdAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get invitation", zap.Error(err))
+		return nil, err
+	}
+	inv.ExpiresAt = expiresAt.Format(time.RFC3339)
+	inv.CreatedAt = createdAt.Format(time.RFC3339)
+	inv.Expired = time.Now().After(expiresAt)
+	return &inv, nil
+}
+
+// AcceptInvitation adds the user as a member and marks the invitation accepted in one transaction
+// An existing membership is left unchanged
+func (r *OrganizationRepo) AcceptInvitation(ctx context.Context, inv *OrganizationInvitation, userID string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("Failed to begin transaction for invitation acceptance", zap.Error(err))
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && err != pgx.ErrTxClosed {
+			r.logger.Warn("Transaction rollback error (may be expected if commit succeeded)", zap.Error(err))
+		}
+	}()
+
+	result, err := tx.Exec(ctx,
+		`UPDATE organization_invitations SET accepted_at = NOW() WHERE id = $1 AND accepted_at IS NULL`,
+		inv.ID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to mark invitation accepted", zap.Error(err), zap.String("invitation_id", inv.ID))
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows // Accepted concurrently
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, $3)
+		 ON CONFLICT (organization_id, user_id) DO NOTHING`,
+		inv.OrganizationID, userID, inv.Role,
+	)
+	if err != nil {
+		r.logger.Error("Failed to add organization member", zap.Error(err), zap.String("organization_id", inv.OrganizationID), zap.String("user_id", userID))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		r.logger.Error("Failed to commit invitation acceptance", zap.Error(err), zap.String("invitation_id", inv.ID))
+		return err
+	}
+	return nil
+}
+
+// GetAppAccess returns the user's role on an app and the app's owning (billed) user
+// Personal app owners get OrgRoleOwner; org members get their membership role; pgx.ErrNoRows otherwise
+func (r *OrganizationRepo) GetAppAccess(ctx context.Context, appID, userID string) (role, ownerID string, err error) {
+	var memberRole sql.NullString
+	err = r.pool.QueryRow(ctx,
+		`SELECT a.user_id, m.role
+		 FROM apps a
+		 LEFT JOIN organization_members m ON m.organization_id = a.organization_id AND m.user_id = $2
+		 WHERE a.id = $1`,
+		appID, userID,
+	).Scan(&ownerID, &memberRole)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get app access", zap.Error(err), zap.String("app_id", appID), zap.String("user_id", userID))
+		return "", "", err
+	}
+
+	switch {
+	case ownerID == userID:
+		return OrgRoleOwner, ownerID, nil
+	case memberRole.Valid:
+		return memberRole.String, ownerID, nil
+	default:
+		return "", "", pgx.ErrNoRows
+	}
+}
+
+// GetAppsByOrganizationID lists an organization's apps
+func (r *OrganizationRepo) GetAppsByOrganizationID(ctx context.Context, orgID string) ([]App, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, name, slug, status, status_reason, url, repo_url, branch, user_id, created_at, updated_at
+		 FROM apps
+		 WHERE organization_id = $1
+		 ORDER BY created_at DESC`,
+		orgID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get organization apps", zap.Error(err), zap.String("organization_id", orgID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var apps []App
+	for rows.Next() {
+		var app App
+		var url, statusReason sql.NullString
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&app.ID, &app.Name, &app.Slug, &app.Status, &statusReason, &url,
+			&app.RepoURL, &app.Branch, &app.UserID, &createdAt, &updatedAt); err != nil {
+			r.logger.Error("Failed to scan organization app", zap.Error(err))
+			return nil, err
+		}
+		app.URL = url.String
+		app.StatusReason = statusReason.String
+		app.OrganizationID = orgID
+		app.CreatedAt = createdAt.Format(time.RFC3339)
+		app.UpdatedAt = updatedAt.Format(time.RFC3339)
+		apps = append(apps, app)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating organization apps", zap.Error(err))
+		return nil, err
+	}
+
+	return apps, nil
+}
+
+// GetSecurityPolicy returns the policy the deploys of an organization's apps are held to
+func (r *OrganizationRepo) GetSecurityPolicy(ctx context.Context, orgID string) (*OrgSecurityPolicy, error) {
+	var policy OrgSecurityPolicy
+	err := r.pool.QueryRow(ctx,
+		`SELECT block_critical_vulnerabilities FROM organizations WHERE id = $1`,
+		orgID,
+	).Scan(&policy.BlockCriticalVulnerabilities)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get organization security policy", zap.Error(err), zap.String("organization_id", orgID))
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// SetSecurityPolicy replaces the policy the deploys of an organization's apps are held to
+func (r *OrganizationRepo) SetSecurityPolicy(ctx context.Context, orgID string, policy OrgSecurityPolicy) error {
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE organizations SET block_critical_vulnerabilities = $2, updated_at = NOW() WHERE id = $1`,
+		orgID, policy.BlockCriticalVulnerabilities,
+	)
+	if err != nil {
+		r.logger.Error("Failed to set organization security policy", zap.Error(err), zap.String("organization_id", orgID))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// APITokenRepo handles API tokens
+type APITokenRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewAPITokenRepo creates a new API token repository
+func NewAPITokenRepo(pool *pgxpool.Pool, logger *zap.Logger) *APITokenRepo {
+	return &APITokenRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// CreateAPIToken stores a new token (only its hash and display prefix are kept)
+func (r *APITokenRepo) CreateAPIToken(ctx context.Context, userID, name, prefix, tokenHash string, sandbox bool) (*APIToken, error) {
+	var token APIToken
+	var createdAt time.Time
+	err := r.pool.QueryRow(ctx,
+		`INSERT INTO api_tokens (user_id, name, token_prefix, token_hash, sandbox)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING id, name, token_prefix, sandbox, created_at`,
+		userID, name, prefix, tokenHash, sandbox,
+	).Scan(&token.ID, &token.Name, &token.Prefix, &token.Sandbox, &createdAt)
+	if err != nil {
+		r.logger.Error("Failed to create API token", zap.Error(err), zap.String("user_id", userID))
+		return nil, err
+	}
+	token.CreatedAt = createdAt.Format(time.RFC3339)
+	return &token, nil
+}
+
+// ListAPITokens lists a user's active (unrevoked) tokens, newest first
+func (r *APITokenRepo) ListAPITokens(ctx context.Context, userID string) ([]*APIToken, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, name, token_prefix, sandbox, last_used_at, created_at
+		 FROM api_tokens
+		 WHERE user_id = $1 AND revoked_at IS NULL
+		 ORDER BY created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to list API tokens", zap.Error(err), zap.String("user_id", userID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*APIToken
+	for rows.Next() {
+		var token APIToken
+		var lastUsedAt *time.Time
+		var createdAt time.Time
+		if err := rows.Scan(&token.ID, &token.Name, &token.Prefix, &token.Sandbox, &lastUsedAt, &createdAt); err != nil {
+			r.logger.Error("Failed to scan API token", zap.Error(err))
+			return nil, err
+		}
+		if lastUsedAt != nil {
+			token.LastUsedAt = lastUsedAt.Format(time.RFC3339)
+		}
+		token.CreatedAt = createdAt.Format(time.RFC3339)
+		tokens = append(tokens, &token)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating API tokens", zap.Error(err))
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// RevokeAPIToken revokes one of the user's tokens
+func (r *APITokenRepo) RevokeAPIToken(ctx context.Context, userID, tokenID string) error {
+	result, err := r.pool.Exec(ctx,
+		`UPDATE api_tokens SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		tokenID, userID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to revoke API token", zap.Error(err), zap.String("token_id", tokenID))
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// GetAPITokenOwner resolves an active token hash to its token ID, owner and mode
+func (r *APITokenRepo) GetAPITokenOwner(ctx context.Context, tokenHash string) (*APITokenOwner, error) {
+	var owner APITokenOwner
+	err := r.pool.QueryRow(ctx,
+		`SELECT t.id, t.user_id, u.email, t.sandbox
+		 FROM api_tokens t
+		 JOIN users u ON u.id = t.user_id
+		 WHERE t.token_hash = $1 AND t.revoked_at IS NULL`,
+		tokenHash,
+	).Scan(&owner.TokenID, &owner.UserID, &owner.Email, &owner.Sandbox)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get API token", zap.Error(err))
+		return nil, err
+	}
+	return &owner, nil
+}
+
+// TouchAPIToken records token use, writing at most once a minute per token
+func (r *APITokenRepo) TouchAPIToken(ctx context.Context, tokenID string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE api_tokens SET last_used_at = NOW()
+		 WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`,
+		tokenID,
+	)
+	return err
+}
+
+// AppMetricsRepo reads the docker stats samples written by the deploy worker's metrics collector
+type AppMetricsRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewAppMetricsRepo creates a new app metrics repository
+func NewAppMetricsRepo(pool *pgxpool.Pool, logger *zap.Logger) *AppMetricsRepo {
+	return &AppMetricsRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// GetLatestSample returns the app's most recent sample
+func (r *AppMetricsRepo) GetLatestSample(ctx context.Context, appID string) (*AppMetricSample, error) {
+	row := r.pool.QueryRow(ctx,
+		`SELECT sampled_at, cpu_percent, cpu_limit, memory_usage_bytes, memory_limit_bytes,
+		        disk_usage_bytes, network_rx_bytes, network_tx_bytes, restart_count
+		 FROM app_metric_samples
+		 WHERE app_id = $1
+		 ORDER BY sampled_at DESC
+		 LIMIT 1`,
+		appID,
+	)
+	sample, err := scanAppMetricSample(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get latest metrics sample", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	return sample, nil
+}
+
+// GetSamples returns the app's samples since the given time, averaged into buckets of resolutionSeconds
+// Counters (network bytes, restarts) and disk size take the bucket maximum
+func (r *AppMetricsRepo) GetSamples(ctx context.Context, appID string, since time.Time, resolutionSeconds int) ([]AppMetricSample, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT to_timestamp(floor(extract(epoch FROM sampled_at) / $3::int) * $3::int) AT TIME ZONE 'UTC' AS bucket,
+		        AVG(cpu_percent), MAX(cpu_limit), AVG(memory_usage_bytes)::BIGINT, MAX(memory_limit_bytes),
+		        MAX(disk_usage_bytes), MAX(network_rx_bytes), MAX(network_tx_bytes), MAX(restart_count)
+		 FROM app_metric_samples
+		 WHERE app_id = $1 AND sampled_at >= $2
+		 GROUP BY bucket
+		 ORDER BY bucket`,
+		appID, since, resolutionSeconds,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get metrics samples", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []AppMetricSample
+	for rows.Next() {
+		sample, err := scanAppMetricSample(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan metrics sample", zap.Error(err))
+			return nil, err
+		}
+		samples = append(samples, *sample)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating metrics samples", zap.Error(err))
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// scanAppMetricSample scans the column list shared by the metrics queries
+func scanAppMetricSample(row pgx.Row) (*AppMetricSample, error) {
+	var sample AppMetricSample
+	var memoryUsage, memoryLimit int64
+	var diskUsage *int64
+	err := row.Scan(&sample.sampledAt, &sample.CPUPercent, &sample.CPULimit, &memoryUsage, &memoryLimit,
+		&diskUsage, &sample.NetworkRxBytes, &sample.NetworkTxBytes, &sample.RestartCount)
+	if err != nil {
+		return nil, err
+	}
+
+	sample.Timestamp = sample.sampledAt.Format(time.RFC3339)
+	sample.MemoryUsageMB = float64(memoryUsage) / 1024 / 1024
+	sample.MemoryLimitMB = float64(memoryLimit) / 1024 / 1024
+	if memoryLimit > 0 {
+		sample.MemoryUsagePercent = float64(memoryUsage) / float64(memoryLimit) * 100
+	}
+	if diskUsage != nil {
+		diskMB := float64(*diskUsage) / 1024 / 1024
+		sample.DiskUsageMB = &diskMB
+	}
+	return &sample, nil
+}
+
+// AppTrafficRepo reads the per-minute traffic buckets written by the deploy worker's traffic collector
+type AppTrafficRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewAppTrafficRepo creates a new app traffic repository
+func NewAppTrafficRepo(pool *pgxpool.Pool, logger *zap.Logger) *AppTrafficRepo {
+	return &AppTrafficRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// GetTraffic returns the app's traffic since the given time, summed into buckets of resolutionSeconds
+// Latency histograms are summed too, so percentiles can be estimated per bucket and over the whole range
+func (r *AppTrafficRepo) GetTraffic(ctx context.Context, appID string, since time.Time, resolutionSeconds int) ([]AppTrafficBucket, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT to_timestamp(floor(extract(epoch FROM bucket_start) / $3::int) * $3::int) AT TIME ZONE 'UTC' AS bucket,
+		        SUM(requests)::BIGINT, SUM(status_2xx)::BIGINT, SUM(status_3xx)::BIGINT, SUM(status_4xx)::BIGINT,
+		        SUM(status_5xx)::BIGINT, SUM(egress_bytes)::BIGINT, array_agg(latency_histogram)
+		 FROM app_traffic
+		 WHERE app_id = $1 AND bucket_start >= $2
+		 GROUP BY bucket
+		 ORDER BY bucket`,
+		appID, since, resolutionSeconds,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get app traffic", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []AppTrafficBucket
+	for rows.Next() {
+		var bucket AppTrafficBucket
+		var start time.Time
+		var histograms [][]int64
+		if err := rows.Scan(&start, &bucket.Requests, &bucket.Status.Status2xx, &bucket.Status.Status3xx,
+			&bucket.Status.Status4xx, &bucket.Status.Status5xx, &bucket.EgressBytes, &histograms); err != nil {
+			r.logger.Error("Failed to scan app traffic", zap.Error(err))
+			return nil, err
+		}
+		bucket.Timestamp = start.Format(time.RFC3339)
+		bucket.latency = services.NewLatencyHistogram()
+		for _, histogram := range histograms {
+			services.AddLatencyHistograms(bucket.latency, histogram)
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating app traffic", zap.Error(err))
+		return nil, err
+	}
+	return buckets, nil
+}
+
+// ChaosRepo handles database operations for injected chaos faults
+type ChaosRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewChaosRepo creates a new chaos fault repository
+func NewChaosRepo(pool *pgxpool.Pool, logger *zap.Logger) *ChaosRepo {
+	return &ChaosRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// chaosFaultColumns are the columns scanned by scanChaosFault
+const chaosFaultColumns = `id, kind, app_id, delay_seconds, remaining, expires_at, created_at`
+
+// CreateChaosFault stores a new fault (appID empty for a global fault) and prunes spent ones
+func (r *ChaosRepo) CreateChaosFault(ctx context.Context, userID, kind, appID string, delaySeconds, count int, expiresAt time.Time) (*services.ChaosFault, error) {
+	if _, err := r.pool.Exec(ctx, `DELETE FROM chaos_faults WHERE remaining <= 0 OR expires_at <= NOW()`); err != nil {
+		r.logger.Warn("Failed to prune spent chaos faults", zap.Error(err))
+	}
+
+	var appIDParam *string
+	if appID != "" {
+		appIDParam = &appID
+	}
+	fault, err := scanChaosFault(r.pool.QueryRow(ctx,
+		`INSERT INTO chaos_faults (kind, app_id, delay_seconds, remaining, expires_at, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING `+chaosFaultColumns,
+		kind, appIDParam, delaySeconds, count, expiresAt, userID,
+	))
+	if err != nil {
+		r.logger.Error("Failed to create chaos fault", zap.Error(err), zap.String("kind", kind))
+		return nil, err
+	}
+	return fault, nil
+}
+
+// ListChaosFaults lists the active faults a user injected, newest first
+func (r *ChaosRepo) ListChaosFaults(ctx context.Context, userID string) ([]*services.ChaosFault, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+chaosFaultColumns+`
+		 FROM chaos_faults
+		 WHERE created_by = $1 AND remaining > 0 AND expires_at > NOW()
+		 ORDER BY created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to list chaos faults", zap.Error(err), zap.String("user_id", userID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var faults []*services.ChaosFault
+	for rows.Next() {
+		fault, err := scanChaosFault(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan chaos fault", zap.Error(err))
+			return nil, err
+		}
+		faults = append(faults, fault)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating chaos faults", zap.Error(err))
+		return nil, err
+	}
+
+	return faults, nil
+}
+
+// DeleteChaosFault removes one of the user's faults
+func (r *ChaosRepo) DeleteChaosFault(ctx context.Context, userID, faultID string) error {
+	result, err := r.pool.Exec(ctx,
+		`DELETE FROM chaos_faults WHERE id = $1 AND created_by = $2`,
+		faultID, userID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to delete chaos fault", zap.Error(err), zap.String("fault_id", faultID))
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// ClearChaosFaults removes all of the user's faults and returns how many were removed
+func (r *ChaosRepo) ClearChaosFaults(ctx context.Context, userID string) (int64, error) {
+	result, err := r.pool.Exec(ctx, `DELETE FROM chaos_faults WHERE created_by = $1`, userID)
+	if err != nil {
+		r.logger.Error("Failed to clear chaos faults", zap.Error(err), zap.String("user_id", userID))
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// ConsumeChaosFault uses up one firing of a matching unexpired fault, preferring one scoped to
+// appID over one its owner created for all their apps (userID's, when there is no app). SKIP LOCKED keeps concurrent workers from firing the same last count twice
+func (r *ChaosRepo) ConsumeChaosFault(ctx context.Context, kind, appID, userID string) (*services.ChaosFault, error) {
+	fault, err := scanChaosFault(r.pool.QueryRow(ctx,
+		`UPDATE chaos_faults SET remaining = remaining - 1
+		 WHERE id = (
+			SELECT id FROM chaos_faults
+			WHERE kind = $1 AND remaining > 0 AND expires_at > NOW()
+			  AND (app_id::text = $2 OR (app_id IS NULL AND created_by::text =
+				COALESCE((SELECT user_id::text FROM apps WHERE id::text = $2), NULLIF($3, ''))))
+			ORDER BY (app_id IS NULL), created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING `+chaosFaultColumns,
+		kind, appID, userID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return fault, nil
+}
+
+func scanChaosFault(row pgx.Row) (*services.ChaosFault, error) {
+	var fault services.ChaosFault
+	var appID *string
+	var expiresAt, createdAt time.Time
+	if err := row.Scan(&fault.ID, &fault.Kind, &appID, &fault.DelaySeconds, &fault.Remaining, &expiresAt, &createdAt); err != nil {
+		return nil, err
+	}
+	if appID != nil {
+		fault.AppID = *appID
+	}
+	fault.ExpiresAt = expiresAt.Format(time.RFC3339)
+	fault.CreatedAt = createdAt.Format(time.RFC3339)
+	return &fault, nil
+}
+
+// CronJob is a scheduled command run in a one-off container of the app's running image
+type CronJob struct {
+	ID             string `json:"id"`
+	AppID          string `json:"app_id"`
+	Name           string `json:"name"`
+	Schedule       string `json:"schedule"` // Five-field cron expression, evaluated in UTC
+	Command        string `json:"command"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+	Enabled        bool   `json:"enabled"`
+	NextRunAt      string `json:"next_run_at,omitempty"`
+	LastRunAt      string `json:"last_run_at,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
+}
+
+// CronJobRun is one execution of a cron job
+type CronJobRun struct {
+	ID           string `json:"id"`
+	CronJobID    string `json:"cron_job_id"`
+	Trigger      string `json:"trigger"` // schedule or manual
+	Status       string `json:"status"`  // queued, running, succeeded, failed
+	ImageName    string `json:"image_name,omitempty"`
+	ExitCode     *int   `json:"exit_code,omitempty"`
+	Output       string `json:"output,omitempty"` // Only returned for a single run
+	ErrorMessage string `json:"error_message,omitempty"`
+	ScheduledFor string `json:"scheduled_for"`
+	StartedAt    string `json:"started_at,omitempty"`
+	FinishedAt   string `json:"finished_at,omitempty"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// CronRepo handles cron_jobs and cron_job_runs table operations
+type CronRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewCronRepo creates a new cron job repository
+func NewCronRepo(pool *pgxpool.Pool, logger *zap.Logger) *CronRepo {
+	return &CronRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// cronJobColumns is the column list shared by cron job queries
+const cronJobColumns = `id, app_id, name, schedule, command, timeout_seconds, enabled,
+		        next_run_at, last_run_at, created_at, updated_at`
+
+// scanCronJob scans a row selected with cronJobColumns into a CronJob
+func scanCronJob(row pgx.Row) (*CronJob, error) {
+	var j CronJob
+	var nextRunAt, lastRunAt sql.NullTime
+	var createdAt, updatedAt time.Time
+	if err := row.Scan(
+		&j.ID, &j.AppID, &j.Name, &j.Schedule, &j.Command, &j.TimeoutSeconds, &j.Enabled,
+		&nextRunAt, &lastRunAt, &createdAt, &updatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if nextRunAt.Valid {
+		j.NextRunAt = nextRunAt.Time.Format(time.RFC3339)
+	}
+	if lastRunAt.Valid {
+		j.LastRunAt = lastRunAt.Time.Format(time.RFC3339)
+	}
+	j.CreatedAt = createdAt.Format(time.RFC3339)
+	j.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &j, nil
+}
+
+// CreateCronJob adds a cron job to an app
+// Returns a *pgconn.PgError with code 23505 if the app already has a job with this name
+func (r *CronRepo) CreateCronJob(ctx context.Context, job *CronJob, nextRunAt *time.Time) (*CronJob, error) {
+	created, err := scanCronJob(r.pool.QueryRow(ctx,
+		`INSERT INTO cron_jobs (app_id, name, schedule, command, timeout_seconds, enabled, next_run_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING `+cronJobColumns,
+		job.AppID, job.Name, job.Schedule, job.Command, job.TimeoutSeconds, job.Enabled, nextRunAt,
+	))
+	if err != nil {
+		r.logger.Error("Failed to create cron job", zap.Error(err), zap.String("app_id", job.AppID))
+		return nil, err
+	}
+	return created, nil
+}
+
+// GetCronJobsByAppID retrieves all cron jobs of an app
+func (r *CronRepo) GetCronJobsByAppID(ctx context.Context, appID string) ([]*CronJob, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+cronJobColumns+`
+		 FROM cron_jobs
+		 WHERE app_id = $1
+		 ORDER BY created_at ASC`,
+		appID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get cron jobs", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]*CronJob, 0)
+	for rows.Next() {
+		j, err := scanCronJob(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan cron job", zap.Error(err))
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating cron jobs", zap.Error(err))
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// GetCronJobByID retrieves a cron job belonging to an app
+// Returns pgx.ErrNoRows if it does not exist
+func (r *CronRepo) GetCronJobByID(ctx context.Context, appID, cronJobID string) (*CronJob, error) {
+	j, err := scanCronJob(r.pool.QueryRow(ctx,
+		`SELECT `+cronJobColumns+`
+		 FROM cron_jobs
+		 WHERE id = $1 AND app_id = $2`,
+		cronJobID, appID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get cron job", zap.Error(err), zap.String("cron_job_id", cronJobID))
+		return nil, err
+	}
+	return j, nil
+}
+
+// UpdateCronJob saves a cron job's settings and its recomputed next run
+// Returns a *pgconn.PgError with code 23505 if the new name is taken
+func (r *CronRepo) UpdateCronJob(ctx context.Context, job *CronJob, nextRunAt *time.Time) (*CronJob, error) {
+	updated, err := scanCronJob(r.pool.QueryRow(ctx,
+		`UPDATE cron_jobs
+		 SET name = $3, schedule = $4, command = $5, timeout_seconds = $6, enabled = $7,
+		     next_run_at = $8, updated_at = NOW()
+		 WHERE id = $1 AND app_id = $2
+		 RETURNING `+cronJobColumns,
+		job.ID, job.AppID, job.Name, job.Schedule, job.Command, job.TimeoutSeconds, job.Enabled, nextRunAt,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to update cron job", zap.Error(err), zap.String("cron_job_id", job.ID))
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteCronJob removes a cron job and its run history
+func (r *CronRepo) DeleteCronJob(ctx context.Context, appID, cronJobID string) error {
+	result, err := r.pool.Exec(ctx,
+		"DELETE FROM cron_jobs WHERE id = $1 AND app_id = $2",
+		cronJobID, appID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to delete cron job", zap.Error(err), zap.String("cron_job_id", cronJobID))
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// cronRunColumns is the column list shared by cron run queries (output is selected separately)
+const cronRunColumns = `id, cron_job_id, trigger, status, image_name, exit_code, error_message,
+		        scheduled_for, started_at, finished_at, created_at`
+
+// scanCronRun scans a row selected with cronRunColumns (plus optional extra destinations) into a CronJobRun
+func scanCronRun(row pgx.Row, extra ...interface{}) (*CronJobRun, error) {
+	var run CronJobRun
+	var imageName, errorMsg sql.NullString
+	var exitCode sql.NullInt32
+	var startedAt, finishedAt sql.NullTime
+	var scheduledFor, createdAt time.Time
+	dest := []interface{}{
+		&run.ID, &run.CronJobID, &run.Trigger, &run.Status, &imageName, &exitCode, &errorMsg,
+		&scheduledFor, &startedAt, &finishedAt, &createdAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	run.ImageName = imageName.String
+	run.ErrorMessage = errorMsg.String
+	if exitCode.Valid {
+		code := int(exitCode.Int32)
+		run.ExitCode = &code
+	}
+	run.ScheduledFor = scheduledFor.Format(time.RFC3339)
+	if startedAt.Valid {
+		run.StartedAt = startedAt.Time.Format(time.RFC3339)
+	}
+	if finishedAt.Valid {
+		run.FinishedAt = finishedAt.Time.Format(time.RFC3339)
+	}
+	run.CreatedAt = createdAt.Format(time.RFC3339)
+	return &run, nil
+}
+
+// CreateCronRun records a run of a cron job
+// A run that cannot start (no running deployment) is created as failed with errorMsg
+func (r *CronRepo) CreateCronRun(ctx context.Context, cronJobID, appID, trigger, status, imageName, errorMsg string) (*CronJobRun, error) {
+	run, err := scanCronRun(r.pool.QueryRow(ctx,
+		`INSERT INTO cron_job_runs (cron_job_id, app_id, trigger, status, image_name, error_message, finished_at)
+		 VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), CASE WHEN $4 = 'failed' THEN NOW() END)
+		 RETURNING `+cronRunColumns,
+		cronJobID, appID, trigger, status, imageName, errorMsg,
+	))
+	if err != nil {
+		r.logger.Error("Failed to create cron run", zap.Error(err), zap.String("cron_job_id", cronJobID))
+		return nil, err
+	}
+	return run, nil
+}
+
+// GetCronRuns retrieves the most recent runs of a cron job, newest first (without output)
+func (r *CronRepo) GetCronRuns(ctx context.Context, cronJobID string, limit int) ([]*CronJobRun, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+cronRunColumns+`
+		 FROM cron_job_runs
+		 WHERE cron_job_id = $1
+		 ORDER BY created_at DESC
+		 LIMIT $2`,
+		cronJobID, limit,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get cron runs", zap.Error(err), zap.String("cron_job_id", cronJobID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]*CronJobRun, 0)
+	for rows.Next() {
+		run, err := scanCronRun(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan cron run", zap.Error(err))
+			continue
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating cron runs", zap.Error(err))
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// GetCronRunByID retrieves a run of a cron job including its output
+// Returns pgx.ErrNoRows if it does not exist
+func (r *CronRepo) GetCronRunByID(ctx context.Context, cronJobID, runID string) (*CronJobRun, error) {
+	var output sql.NullString
+	run, err := scanCronRun(r.pool.QueryRow(ctx,
+		`SELECT `+cronRunColumns+`, output
+		 FROM cron_job_runs
+		 WHERE id = $1 AND cron_job_id = $2`,
+		runID, cronJobID,
+	), &output)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get cron run", zap.Error(err), zap.String("run_id", runID))
+		return nil, err
+	}
+	run.Output = output.String
+	return run, nil
+}
+
+// MarkCronRunFailed fails a queued run that could not be handed to a worker
+func (r *CronRepo) MarkCronRunFailed(ctx context.Context, runID, errorMsg string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE cron_job_runs SET status = 'failed', error_message = $2, finished_at = NOW()
+		 WHERE id = $1 AND status = 'queued'`,
+		runID, errorMsg,
+	)
+	if err != nil {
+		r.logger.Error("Failed to mark cron run as failed", zap.Error(err), zap.String("run_id", runID))
+		return err
+	}
+	return nil
+}
+
+// StartCronRun marks a run as running (implements tasks.CronRunRepository)
+func (r *CronRepo) StartCronRun(ctx context.Context, runID string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE cron_job_runs SET status = 'running', started_at = NOW() WHERE id = $1`,
+		runID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to start cron run", zap.Error(err), zap.String("run_id", runID))
+		return err
+	}
+	return nil
+}
+
+// FinishCronRun records a run's outcome (implements tasks.CronRunRepository)
+func (r *CronRepo) FinishCronRun(ctx context.Context, runID, status string, exitCode *int, output, errorMsg string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE cron_job_runs
+		 SET status = $2, exit_code = $3, output = NULLIF($4, ''), error_message = NULLIF($5, ''), finished_at = NOW()
+		 WHERE id = $1`,
+		runID, status, exitCode, output, errorMsg,
+	)
+	if err != nil {
+		r.logger.Error("Failed to finish cron run", zap.Error(err), zap.String("run_id", runID))
+		return err
+	}
+	return nil
+}
+
+// ExecRun is a one-off command run in a temporary container of an app's running image
+type ExecRun struct {
+	ID             string `json:"id"`
+	AppID          string `json:"app_id"`
+	Command        string `json:"command"`
+	Status         string `json:"status"` // queued, running, succeeded, failed
+	ImageName      string `json:"image_name,omitempty"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+	ExitCode       *int   `json:"exit_code,omitempty"`
+	Output         string `json:"output,omitempty"` // Combined stdout and stderr, cut off after 1 MB
+	ErrorMessage   string `json:"error_message,omitempty"`
+	StartedAt      string `json:"started_at,omitempty"`
+	FinishedAt     string `json:"finished_at,omitempty"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// ExecRepo handles exec_runs table operations
+type ExecRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewExecRepo creates a new exec run repository
+func NewExecRepo(pool *pgxpool.Pool, logger *zap.Logger) *ExecRepo {
+	return &ExecRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// execRunColumns is the column list shared by exec run queries
+const execRunColumns = `id, app_id, command, status, image_name, timeout_seconds, exit_code, output, error_message,
+		        started_at, finished_at, created_at`
+
+// scanExecRun scans a row selected with execRunColumns into an ExecRun
+func scanExecRun(row pgx.Row) (*ExecRun, error) {
+	var run ExecRun
+	var imageName, errorMsg sql.NullString
+	var exitCode sql.NullInt32
+	var startedAt, finishedAt sql.NullTime
+	var createdAt time.Time
+	if err := row.Scan(&run.ID, &run.AppID, &run.Command, &run.Status, &imageName, &run.TimeoutSeconds, &exitCode,
+		&run.Output, &errorMsg, &startedAt, &finishedAt, &createdAt); err != nil {
+		return nil, err
+	}
+	run.ImageName = imageName.String
+	run.ErrorMessage = errorMsg.String
+	if exitCode.Valid {
+		code := int(exitCode.Int32)
+		run.ExitCode = &code
+	}
+	if startedAt.Valid {
+		run.StartedAt = startedAt.Time.Format(time.RFC3339)
+	}
+	if finishedAt.Valid {
+		run.FinishedAt = finishedAt.Time.Format(time.RFC3339)
+	}
+	run.CreatedAt = createdAt.Format(time.RFC3339)
+	return &run, nil
+}
+
+// CreateExecRun records a queued exec run started by userID
+func (r *ExecRepo) CreateExecRun(ctx context.Context, appID, userID, command, imageName string, timeoutSeconds int) (*ExecRun, error) {
+	run, err := scanExecRun(r.pool.QueryRow(ctx,
+		`INSERT INTO exec_runs (app_id, user_id, command, image_name, timeout_seconds)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING `+execRunColumns,
+		appID, userID, command, imageName, timeoutSeconds,
+	))
+	if err != nil {
+		r.logger.Error("Failed to create exec run", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	return run, nil
+}
+
+// GetExecRun retrieves an app's exec run including its output; returns pgx.ErrNoRows if it does not exist
+func (r *ExecRepo) GetExecRun(ctx context.Context, appID, runID string) (*ExecRun, error) {
+	run, err := scanExecRun(r.pool.QueryRow(ctx,
+		`SELECT `+execRunColumns+` FROM exec_runs WHERE id = $1 AND app_id = $2`,
+		runID, appID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get exec run", zap.Error(err), zap.String("run_id", runID))
+		return nil, err
+	}
+	return run, nil
+}
+
+// GetExecRunOutput returns a run's status and the output after the first offset characters
+// Returns the offset to continue from
+func (r *ExecRepo) GetExecRunOutput(ctx context.Context, runID string, offset int) (*ExecRun, int, error) {
+	var run ExecRun
+	var errorMsg sql.NullString
+	var exitCode sql.NullInt32
+	var length int
+	err := r.pool.QueryRow(ctx,
+		`SELECT status, exit_code, error_message, substr(output, $2 + 1), char_length(output)
+		 FROM exec_runs WHERE id = $1`,
+		runID, offset,
+	).Scan(&run.Status, &exitCode, &errorMsg, &run.Output, &length)
+	if err != nil {
+		return nil, offset, err
+	}
+	run.ID = runID
+	run.ErrorMessage = errorMsg.String
+	if exitCode.Valid {
+		code := int(exitCode.Int32)
+		run.ExitCode = &code
+	}
+	return &run, length, nil
+}
+
+// MarkExecRunFailed fails a queued run that could not be handed to a worker
+func (r *ExecRepo) MarkExecRunFailed(ctx context.Context, runID, errorMsg string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE exec_runs SET status = 'failed', error_message = $2, finished_at = NOW()
+		 WHERE id = $1 AND status = 'queued'`,
+		runID, errorMsg,
+	)
+	if err != nil {
+		r.logger.Error("Failed to mark exec run as failed", zap.Error(err), zap.String("run_id", runID))
+		return err
+	}
+	return nil
+}
+
+// StartExecRun marks a run as running (implements tasks.ExecRunRepository)
+func (r *ExecRepo) StartExecRun(ctx context.Context, runID string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE exec_runs SET status = 'running', started_at = NOW() WHERE id = $1`,
+		runID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to start exec run", zap.Error(err), zap.String("run_id", runID))
+		return err
+	}
+	return nil
+}
+
+// AppendExecOutput adds output a running command produced (implements tasks.ExecRunRepository)
+func (r *ExecRepo) AppendExecOutput(ctx context.Context, runID, output string) error {
+	_, err := r.pool.Exec(ctx, `UPDATE exec_runs SET output = output || $2 WHERE id = $1`, runID, output)
+	if err != nil {
+		r.logger.Error("Failed to append exec output", zap.Error(err), zap.String("run_id", runID))
+		return err
+	}
+	return nil
+}
+
+// FinishExecRun records a run's outcome (implements tasks.ExecRunRepository)
+func (r *ExecRepo) FinishExecRun(ctx context.Context, runID, status string, exitCode *int, errorMsg string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE exec_runs
+		 SET status = $2, exit_code = $3, error_message = NULLIF($4, ''), finished_at = NOW()
+		 WHERE id = $1`,
+		runID, status, exitCode, errorMsg,
+	)
+	if err != nil {
+		r.logger.Error("Failed to finish exec run", zap.Error(err), zap.String("run_id", runID))
+		return err
+	}
+	return nil
+}
+
+// AppWebhook is a user URL that receives signed JSON events about an app's builds and deploys
+type AppWebhook struct {
+	ID        string   `json:"id"`
+	AppID     string   `json:"app_id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Enabled   bool     `json:"enabled"`
+	Secret    string   `json:"secret,omitempty"` // Only returned when the webhook is created
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+}
+
+// AppWebhookDelivery is one event sent (or being retried) to an app webhook
+type AppWebhookDelivery struct {
+	ID             string          `json:"id"`
+	WebhookID      string          `json:"webhook_id"`
+	EventID        string          `json:"event_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"` // pending, succeeded, failed
+	Attempts       int             `json:"attempts"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	NextAttemptAt  string          `json:"next_attempt_at,omitempty"` // Only while pending
+	DeliveredAt    string          `json:"delivered_at,omitempty"`
+	CreatedAt      string          `json:"created_at"`
+}
+
+// AppWebhookRepo handles app_webhooks and app_webhook_deliveries table operations
+type AppWebhookRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewAppWebhookRepo creates a new app webhook repository
+func NewAppWebhookRepo(pool *pgxpool.Pool, logger *zap.Logger) *AppWebhookRepo {
+	return &AppWebhookRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// appWebhookColumns is the column list shared by app webhook queries (the secret is selected separately)
+const appWebhookColumns = `id, app_id, url, events, enabled, created_at, updated_at`
+
+// scanAppWebhook scans a row selected with appWebhookColumns (plus optional extra destinations) into an AppWebhook
+func scanAppWebhook(row pgx.Row, extra ...interface{}) (*AppWebhook, error) {
+	var hook AppWebhook
+	var createdAt, updatedAt time.Time
+	dest := []interface{}{&hook.ID, &hook.AppID, &hook.URL, &hook.Events, &hook.Enabled, &createdAt, &updatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+	hook.CreatedAt = createdAt.Format(time.RFC3339)
+	hook.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &hook, nil
+}
+
+// CreateAppWebhook registers a webhook for an app; the returned webhook includes its secret
+func (r *AppWebhookRepo) CreateAppWebhook(ctx context.Context, appID, url, secret string, events []string) (*AppWebhook, error) {
+	hook, err := scanAppWebhook(r.pool.QueryRow(ctx,
+		`INSERT INTO app_webhooks (app_id, url, secret, events)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+appWebhookColumns+`, secret`,
+		appID, url, secret, events,
+	), &secret)
+	if err != nil {
+		r.logger.Error("Failed to create app webhook", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	hook.Secret = secret
+	return hook, nil
+}
+
+// GetAppWebhooksByAppID retrieves all webhooks of an app (without secrets)
+func (r *AppWebhookRepo) GetAppWebhooksByAppID(ctx context.Context, appID string) ([]*AppWebhook, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+appWebhookColumns+`
+		 FROM app_webhooks
+		 WHERE app_id = $1
+		 ORDER BY created_at ASC`,
+		appID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get app webhooks", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := make([]*AppWebhook, 0)
+	for rows.Next() {
+		hook, err := scanAppWebhook(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan app webhook", zap.Error(err))
+			continue
+		}
+		hooks = append(hooks, hook)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating app webhooks", zap.Error(err))
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+// GetAppWebhookByID retrieves a webhook belonging to an app (without its secret)
+// Returns pgx.ErrNoRows if it does not exist
+func (r *AppWebhookRepo) GetAppWebhookByID(ctx context.Context, appID, webhookID string) (*AppWebhook, error) {
+	hook, err := scanAppWebhook(r.pool.QueryRow(ctx,
+		`SELECT `+appWebhookColumns+`
+		 FROM app_webhooks
+		 WHERE id = $1 AND app_id = $2`,
+		webhookID, appID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get app webhook", zap.Error(err), zap.String("webhook_id", webhookID))
+		return nil, err
+	}
+	return hook, nil
+}
+
+// UpdateAppWebhook saves a webhook's URL, events and enabled flag
+func (r *AppWebhookRepo) UpdateAppWebhook(ctx context.Context, hook *AppWebhook) (*AppWebhook, error) {
+	updated, err := scanAppWebhook(r.pool.QueryRow(ctx,
+		`UPDATE app_webhooks
+		 SET url = $3, events = $4, enabled = $5, updated_at = NOW()
+		 WHERE id = $1 AND app_id = $2
+		 RETURNING `+appWebhookColumns,
+		hook.ID, hook.AppID, hook.URL, hook.Events, hook.Enabled,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to update app webhook", zap.Error(err), zap.String("webhook_id", hook.ID))
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteAppWebhook removes a webhook and its delivery log
+func (r *AppWebhookRepo) DeleteAppWebhook(ctx context.Context, appID, webhookID string) error {
+	result, err := r.pool.Exec(ctx,
+		"DELETE FROM app_webhooks WHERE id = $1 AND app_id = $2",
+		webhookID, appID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to delete app webhook", zap.Error(err), zap.String("webhook_id", webhookID))
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetAppWebhookDeliveries retrieves the most recent deliveries of a webhook, newest first
+func (r *AppWebhookRepo) GetAppWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]*AppWebhookDelivery, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, webhook_id, event_id, event, payload, status, attempts, response_status, last_error,
+		        next_attempt_at, delivered_at, created_at
+		 FROM app_webhook_deliveries
+		 WHERE webhook_id = $1
+		 ORDER BY created_at DESC
+		 LIMIT $2`,
+		webhookID, limit,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get app webhook deliveries", zap.Error(err), zap.String("webhook_id", webhookID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]*AppWebhookDelivery, 0)
+	for rows.Next() {
+		var d AppWebhookDelivery
+		var responseStatus sql.NullInt32
+		var lastError sql.NullString
+		var deliveredAt sql.NullTime
+		var nextAttemptAt, createdAt time.Time
+		if err := rows.Scan(
+			&d.ID, &d.WebhookID, &d.EventID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &responseStatus, &lastError,
+			&nextAttemptAt, &deliveredAt, &createdAt,
+		); err != nil {
+			r.logger.Error("Failed to scan app webhook delivery", zap.Error(err))
+			continue
+		}
+		if responseStatus.Valid {
+			status := int(responseStatus.Int32)
+			d.ResponseStatus = &status
+		}
+		d.LastError = lastError.String
+		if d.Status == "pending" {
+			d.NextAttemptAt = nextAttemptAt.Format(time.RFC3339)
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = deliveredAt.Time.Format(time.RFC3339)
+		}
+		d.CreatedAt = createdAt.Format(time.RFC3339)
+		deliveries = append(deliveries, &d)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating app webhook deliveries", zap.Error(err))
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RecordAppEvent queues an event for delivery to every enabled webhook of the app subscribed to it
+// (implements tasks.AppEventRecorder). The API server's dispatcher sends it
+func (r *AppWebhookRepo) RecordAppEvent(ctx context.Context, appID, event string, data map[string]interface{}) error {
+	eventID := uuid.New().String()
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":         eventID,
+		"event":      event,
+		"app_id":     appID,
+		"created_at": time.Now().UTC().Format(time.RFC3339),
+		"data":       data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal app event: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx,
+		`INSERT INTO app_webhook_deliveries (webhook_id, app_id, event_id, event, payload)
+		 SELECT id, app_id, $2, $3, $4
+		 FROM app_webhooks
+		 WHERE app_id = $1 AND enabled AND $3 = ANY(events)`,
+		appID, eventID, event, payload,
+	); err != nil {
+		r.logger.Error("Failed to record app event", zap.Error(err), zap.String("app_id", appID), zap.String("event", event))
+		return err
+	}
+	return nil
+}
+
+// AppExport is a downloadable bundle of an app's persistent data, usually taken before deleting the app
+type AppExport struct {
+	ID           string          `json:"id"`
+	AppID        string          `json:"app_id"`
+	AppName      string          `json:"app_name"`
+	Manifest     json.RawMessage `json:"manifest"`
+	DeleteApp    bool            `json:"delete_app"`
+	Status       string          `json:"status"` // pending, running, ready, failed, expired
+	SizeBytes    *int64          `json:"size_bytes,omitempty"`
+	ErrorMessage string          `json:"error_message,omitempty"`
+	ExpiresAt    string          `json:"expires_at,omitempty"` // Set once the bundle is ready
+	CreatedAt    string          `json:"created_at"`
+	CompletedAt  string          `json:"completed_at,omitempty"`
+}
+
+// AppExportRepo handles app_exports table operations
+type AppExportRepo struct {
+	pool    *pgxpool.Pool
+	logger  *zap.Logger
+	appRepo *AppRepo
+}
+
+// NewAppExportRepo creates a new app export repository
+func NewAppExportRepo(pool *pgxpool.Pool, logger *zap.Logger) *AppExportRepo {
+	return &AppExportRepo{
+		pool:    pool,
+		logger:  logger,
+		appRepo: NewAppRepo(pool, logger),
+	}
+}
+
+// appExportColumns is the column list shared by app export queries
+const appExportColumns = `id, app_id, app_name, manifest, delete_app, status, size_bytes, error_message, expires_at, created_at, completed_at`
+
+// scanAppExport scans a row selected with appExportColumns into an AppExport
+func scanAppExport(row pgx.Row) (*AppExport, error) {
+	var export AppExport
+	var errorMessage *string
+	var expiresAt, completedAt *time.Time
+	var createdAt time.Time
+	if err := row.Scan(&export.ID, &export.AppID, &export.AppName, &export.Manifest, &export.DeleteApp, &export.Status,
+		&export.SizeBytes, &errorMessage, &expiresAt, &createdAt, &completedAt); err != nil {
+		return nil, err
+	}
+	if errorMessage != nil {
+		export.ErrorMessage = *errorMessage
+	}
+	if expiresAt != nil {
+		export.ExpiresAt = expiresAt.Format(time.RFC3339)
+	}
+	export.CreatedAt = createdAt.Format(time.RFC3339)
+	if completedAt != nil {
+		export.CompletedAt = completedAt.Format(time.RFC3339)
+	}
+	return &export, nil
+}
+
+// CreateAppExport records a requested export with the app snapshot its bundle is built from
+func (r *AppExportRepo) CreateAppExport(ctx context.Context, userID string, manifest *services.AppExportManifest, deleteApp bool) (*AppExport, error) {
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal export manifest: %w", err)
+	}
+
+	export, err := scanAppExport(r.pool.QueryRow(ctx,
+		`INSERT INTO app_exports (user_id, app_id, app_name, manifest, delete_app)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING `+appExportColumns,
+		userID, manifest.AppID, manifest.AppName, manifestJSON, deleteApp,
+	))
+	if err != nil {
+		r.logger.Error("Failed to create app export", zap.Error(err), zap.String("app_id", manifest.AppID))
+		return nil, err
+	}
+	return export, nil
+}
+
+// GetAppExportsByUserID retrieves a user's most recent exports, newest first
+func (r *AppExportRepo) GetAppExportsByUserID(ctx context.Context, userID string) ([]*AppExport, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+appExportColumns+`
+		 FROM app_exports
+		 WHERE user_id = $1
+		 ORDER BY created_at DESC
+		 LIMIT 50`,
+		userID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get app exports", zap.Error(err), zap.String("user_id", userID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	exports := make([]*AppExport, 0)
+	for rows.Next() {
+		export, err := scanAppExport(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan app export", zap.Error(err))
+			continue
+		}
+		exports = append(exports, export)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating app exports", zap.Error(err))
+		return nil, err
+	}
+
+	return exports, nil
+}
+
+// GetAppExportByID retrieves an export belonging to a user
+// Returns pgx.ErrNoRows if it does not exist
+func (r *AppExportRepo) GetAppExportByID(ctx context.Context, userID, exportID string) (*AppExport, error) {
+	export, err := scanAppExport(r.pool.QueryRow(ctx,
+		`SELECT `+appExportColumns+`
+		 FROM app_exports
+		 WHERE id = $1 AND user_id = $2`,
+		exportID, userID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get app export", zap.Error(err), zap.String("export_id", exportID))
+		return nil, err
+	}
+	return export, nil
+}
+
+// HasActiveAppExport reports whether an export of the app is still pending or running
+func (r *AppExportRepo) HasActiveAppExport(ctx context.Context, appID string) (bool, error) {
+	var active bool
+	err := r.pool.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM app_exports WHERE app_id = $1 AND status IN ('pending', 'running'))`,
+		appID,
+	).Scan(&active)
+	if err != nil {
+		r.logger.Error("Failed to check for active app export", zap.Error(err), zap.String("app_id", appID))
+		return false, err
+	}
+	return active, nil
+}
+
+// StartAppExport marks a pending export as running and returns the manifest to build its bundle from
+// (implements tasks.AppExportRepository)
+func (r *AppExportRepo) StartAppExport(ctx context.Context, exportID string) (*services.AppExportManifest, error) {
+	var manifestJSON []byte
+	err := r.pool.QueryRow(ctx,
+		`UPDATE app_exports SET status = 'running'
+		 WHERE id = $1 AND status = 'pending'
+		 RETURNING manifest`,
+		exportID,
+	).Scan(&manifestJSON)
+	if err != nil {
+		r.logger.Error("Failed to start app export", zap.Error(err), zap.String("export_id", exportID))
+		return nil, err
+	}
+
+	var manifest services.AppExportManifest
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal export manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// FinishAppExport records an export's outcome; ready bundles expire after services.AppExportRetention
+func (r *AppExportRepo) FinishAppExport(ctx context.Context, exportID, status string, sizeBytes int64, errorMsg string) error {
+	var size *int64
+	var expiresAt *time.Time
+	if status == "ready" {
+		size = &sizeBytes
+		expires := time.Now().Add(services.AppExportRetention)
+		expiresAt = &expires
+	}
+
+	_, err := r.pool.Exec(ctx,
+		`UPDATE app_exports
+		 SET status = $2, size_bytes = $3, error_message = NULLIF($4, ''), expires_at = $5, completed_at = NOW()
+		 WHERE id = $1`,
+		exportID, status, size, errorMsg, expiresAt,
+	)
+	if err != nil {
+		r.logger.Error("Failed to finish app export", zap.Error(err), zap.String("export_id", exportID))
+		return err
+	}
+	return nil
+}
+
+// DeleteExportedApp deletes an app once its export bundle has been written
+// An app that is already gone is not an error
+func (r *AppExportRepo) DeleteExportedApp(ctx context.Context, appID, userID string) error {
+	if err := r.appRepo.DeleteApp(appID, userID); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+// ExpireAppExports marks ready exports past their expiry as expired and returns their IDs,
+// so their bundles can be removed
+func (r *AppExportRepo) ExpireAppExports(ctx context.Context) ([]string, error) {
+	rows, err := r.pool.Query(ctx,
+		`UPDATE app_exports SET status = 'expired'
+		 WHERE status = 'ready' AND expires_at <= NOW()
+		 RETURNING id`,
+	)
+	if err != nil {
+		r.logger.Error("Failed to expire app exports", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// MaintenanceWindow is scheduled platform maintenance affecting specific nodes and/or regions
+type MaintenanceWindow struct {
+	ID           string   `json:"id"`
+	Title        string   `json:"title"`
+	Description  string   `json:"description"`
+	Nodes        []string `json:"nodes"`
+	Regions      []string `json:"regions"`
+	StartsAt     string   `json:"starts_at"`
+	EndsAt       string   `json:"ends_at"`
+	NotifiedAt   string   `json:"notified_at,omitempty"` // Set once owners of affected apps were notified
+	AffectedApps int      `json:"affected_apps"`
+	CreatedAt    string   `json:"created_at"`
+}
+
+// AppActivity is an entry in an app's activity feed
+type AppActivity struct {
+	ID                  string          `json:"id"`
+	Kind                string          `json:"kind"`
+	Title               string          `json:"title"`
+	Message             string          `json:"message"`
+	Data                json.RawMessage `json:"data"`
+	MaintenanceWindowID *string         `json:"maintenance_window_id,omitempty"`
+	CreatedAt           string          `json:"created_at"`
+}
+
+// MaintenanceRepo handles maintenance_windows and app_activity table operations
+type MaintenanceRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewMaintenanceRepo creates a new maintenance repository
+func NewMaintenanceRepo(pool *pgxpool.Pool, logger *zap.Logger) *MaintenanceRepo {
+	return &MaintenanceRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// maintenanceWindowColumns is the column list shared by maintenance window queries
+const maintenanceWindowColumns = `id, title, description, nodes, regions, starts_at, ends_at, notified_at, affected_apps, created_at`
+
+// scanMaintenanceWindow scans a row selected with maintenanceWindowColumns into a MaintenanceWindow
+func scanMaintenanceWindow(row pgx.Row) (*MaintenanceWindow, error) {
+	var window MaintenanceWindow
+	var startsAt, endsAt, createdAt time.Time
+	var notifiedAt *time.Time
+	if err := row.Scan(&window.ID, &window.Title, &window.Description, &window.Nodes, &window.Regions,
+		&startsAt, &endsAt, &notifiedAt, &window.AffectedApps, &createdAt); err != nil {
+		return nil, err
+	}
+	window.StartsAt = startsAt.Format(time.RFC3339)
+	window.EndsAt = endsAt.Format(time.RFC3339)
+	if notifiedAt != nil {
+		window.NotifiedAt = notifiedAt.Format(time.RFC3339)
+	}
+	window.CreatedAt = createdAt.Format(time.RFC3339)
+	return &window, nil
+}
+
+// CreateMaintenanceWindow schedules maintenance - startsAt and endsAt are stored in UTC
+// The maintenance notifier picks the window up and notifies owners of affected apps
+func (r *MaintenanceRepo) CreateMaintenanceWindow(ctx context.Context, createdBy, title, description string, nodes, regions []string, startsAt, endsAt time.Time) (*MaintenanceWindow, error) {
+	window, err := scanMaintenanceWindow(r.pool.QueryRow(ctx,
+		`INSERT INTO maintenance_windows (title, description, nodes, regions, starts_at, ends_at, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING `+maintenanceWindowColumns,
+		title, description, nodes, regions, startsAt.UTC(), endsAt.UTC(), createdBy,
+	))
+	if err != nil {
+		r.logger.Error("Failed to create maintenance window", zap.Error(err))
+		return nil, err
+	}
+	return window, nil
+}
+
+// ListMaintenanceWindows retrieves the most recently scheduled maintenance windows, latest start first
+func (r *MaintenanceRepo) ListMaintenanceWindows(ctx context.Context) ([]*MaintenanceWindow, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+maintenanceWindowColumns+`
+		 FROM maintenance_windows
+		 ORDER BY starts_at DESC
+		 LIMIT 100`,
+	)
+	if err != nil {
+		r.logger.Error("Failed to list maintenance windows", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := make([]*MaintenanceWindow, 0)
+	for rows.Next() {
+		window, err := scanMaintenanceWindow(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan maintenance window", zap.Error(err))
+			continue
+		}
+		windows = append(windows, window)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating maintenance windows", zap.Error(err))
+		return nil, err
+	}
+
+	return windows, nil
+}
+
+// GetAppActivity retrieves an app's most recent activity, newest first
+func (r *MaintenanceRepo) GetAppActivity(ctx context.Context, appID string) ([]*AppActivity, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, kind, title, message, data, maintenance_window_id, created_at
+		 FROM app_activity
+		 WHERE app_id = $1
+		 ORDER BY created_at DESC
+		 LIMIT 50`,
+		appID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get app activity", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	activity := make([]*AppActivity, 0)
+	for rows.Next() {
+		var entry AppActivity
+		var createdAt time.Time
+		if err := rows.Scan(&entry.ID, &entry.Kind, &entry.Title, &entry.Message, &entry.Data,
+			&entry.MaintenanceWindowID, &createdAt); err != nil {
+			r.logger.Error("Failed to scan app activity", zap.Error(err))
+			continue
+		}
+		entry.CreatedAt = createdAt.Format(time.RFC3339)
+		activity = append(activity, &entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating app activity", zap.Error(err))
+		return nil, err
+	}
+
+	return activity, nil
+}
+
+// AppSleepRepo handles the sleep/wake transitions of idle apps
+// Transitions are conditional on the current status, so a wake racing a deploy or a delete never
+// overwrites the newer status
+type AppSleepRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+	cache  *services.ReadCache // Optional - see SetCache
+}
+
+// NewAppSleepRepo creates a new app sleep repository
+func NewAppSleepRepo(pool *pgxpool.Pool, logger *zap.Logger) *AppSleepRepo {
+	return &AppSleepRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// SetCache lets the transitions drop the owner's cached app list
+func (r *AppSleepRepo) SetCache(cache *services.ReadCache) {
+	r.cache = cache
+}
+
+// StartAppWake moves a sleeping app to waking. Returns false when the app was not sleeping
+// (another request already started the wake, or the app was redeployed meanwhile)
+func (r *AppSleepRepo) StartAppWake(ctx context.Context, appID string) (bool, error) {
+	return r.transition(ctx, "start app wake", appID,
+		`UPDATE apps SET status = 'waking', updated_at = NOW() WHERE id = $1 AND status = 'sleeping' RETURNING user_id`,
+		appID,
+	)
+}
+
+// MarkAppAwake marks a woken app as running. Its idle time restarts from now
+func (r *AppSleepRepo) MarkAppAwake(ctx context.Context, appID string) error {
+	_, err := r.transition(ctx, "mark app awake", appID,
+		`UPDATE apps SET status = 'running', status_reason = NULL, last_request_at = NOW(), updated_at = NOW()
+		 WHERE id = $1 AND status IN ('sleeping', 'waking')
+		 RETURNING user_id`,
+		appID,
+	)
+	return err
+}
+
+// MarkAppWakeFailed marks an app that could not be woken as failed, with the reason shown to its owner
+func (r *AppSleepRepo) MarkAppWakeFailed(ctx context.Context, appID, reason string) error {
+	_, err := r.transition(ctx, "mark app wake as failed", appID,
+		`UPDATE apps SET status = 'failed', status_reason = $2, updated_at = NOW()
+		 WHERE id = $1 AND status IN ('sleeping', 'waking')
+		 RETURNING user_id`,
+		appID, reason,
+	)
+	return err
+}
+
+// transition runs a status update returning the app's owner, whose cached app list it drops. Returns false
+// when the app was not in a status the update applies to
+func (r *AppSleepRepo) transition(ctx context.Context, what, appID, query string, args ...interface{}) (bool, error) {
+	var ownerID string
+	if err := r.pool.QueryRow(ctx, query, args...).Scan(&ownerID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		r.logger.Error("Failed to "+what, zap.Error(err), zap.String("app_id", appID))
+		return false, err
+	}
+	r.cache.Invalidate(ctx, appsCacheKey(ownerID))
+	return true, nil
+}
+
+// AppWAF is an app's WAF preset and mode
+type AppWAF struct {
+	AppID     string `json:"app_id"`
+	Preset    string `json:"preset"`
+	Mode      string `json:"mode"` // monitor | block
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// WAFHit is a WAF rule match recorded for an app
+type WAFHit struct {
+	ID        string `json:"id"`
+	RuleID    string `json:"rule_id"`
+	Message   string `json:"message"`
+	Severity  string `json:"severity,omitempty"`
+	Action    string `json:"action"` // detected | blocked
+	Mode      string `json:"mode"`   // App's WAF mode when the hit was recorded
+	ClientIP  string `json:"client_ip,omitempty"`
+	URI       string `json:"uri"`
+	CreatedAt string `json:"created_at"`
+}
+
+// WAFRepo handles app_waf_settings and waf_hits table operations
+type WAFRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewWAFRepo creates a new WAF repository
+func NewWAFRepo(pool *pgxpool.Pool, logger *zap.Logger) *WAFRepo {
+	return &WAFRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// appWAFColumns is the column list shared by app WAF settings queries
+const appWAFColumns = `app_id, preset, mode, created_at, updated_at`
+
+// scanAppWAF scans a row selected with appWAFColumns into an AppWAF
+func scanAppWAF(row pgx.Row) (*AppWAF, error) {
+	var waf AppWAF
+	var createdAt, updatedAt time.Time
+	if err := row.Scan(&waf.AppID, &waf.Preset, &waf.Mode, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	waf.CreatedAt = createdAt.Format(time.RFC3339)
+	waf.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &waf, nil
+}
+
+// GetAppWAFSettings retrieves an app's WAF settings, or pgx.ErrNoRows when the app has no WAF
+func (r *WAFRepo) GetAppWAFSettings(ctx context.Context, appID string) (*AppWAF, error) {
+	waf, err := scanAppWAF(r.pool.QueryRow(ctx,
+		`SELECT `+appWAFColumns+` FROM app_waf_settings WHERE app_id = $1`,
+		appID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get WAF settings", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	return waf, nil
+}
+
+// GetAppWAF returns the WAF a deploy should put in front of the app, or nil when it has none
+func (r *WAFRepo) GetAppWAF(ctx context.Context, appID string) (*services.WAFConfig, error) {
+	waf, err := r.GetAppWAFSettings(ctx, appID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &services.WAFConfig{Preset: waf.Preset, Mode: waf.Mode}, nil
+}
+
+// SetAppWAF enables the WAF for an app or changes its preset and mode
+func (r *WAFRepo) SetAppWAF(ctx context.Context, appID, preset, mode string) (*AppWAF, error) {
+	waf, err := scanAppWAF(r.pool.QueryRow(ctx,
+		`INSERT INTO app_waf_settings (app_id, preset, mode)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT (app_id) DO UPDATE SET preset = EXCLUDED.preset, mode = EXCLUDED.mode, updated_at = NOW()
+		 RETURNING `+appWAFColumns,
+		appID, preset, mode,
+	))
+	if err != nil {
+		r.logger.Error("Failed to set WAF settings", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	return waf, nil
+}
+
+// DeleteAppWAF disables the WAF for an app; returns pgx.ErrNoRows when it was not enabled
+// Recorded hits are kept until they expire
+func (r *WAFRepo) DeleteAppWAF(ctx context.Context, appID string) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM app_waf_settings WHERE app_id = $1`, appID)
+	if err != nil {
+		r.logger.Error("Failed to delete WAF settings", zap.Error(err), zap.String("app_id", appID))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// ListWAFHits retrieves an app's most recent WAF hits, optionally only those with the given action
+func (r *WAFRepo) ListWAFHits(ctx context.Context, appID, action string, limit int) ([]*WAFHit, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, rule_id, message, severity, action, mode, client_ip, uri, created_at
+		 FROM waf_hits
+		 WHERE app_id = $1 AND ($2 = '' OR action = $2)
+		 ORDER BY created_at DESC
+		 LIMIT $3`,
+		appID, action, limit,
+	)
+	if err != nil {
+		r.logger.Error("Failed to list WAF hits", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := make([]*WAFHit, 0)
+	for rows.Next() {
+		var hit WAFHit
+		var createdAt time.Time
+		if err := rows.Scan(&hit.ID, &hit.RuleID, &hit.Message, &hit.Severity, &hit.Action, &hit.Mode,
+			&hit.ClientIP, &hit.URI, &createdAt); err != nil {
+			r.logger.Error("Failed to scan WAF hit", zap.Error(err))
+			continue
+		}
+		hit.CreatedAt = createdAt.Format(time.RFC3339)
+		hits = append(hits, &hit)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating WAF hits", zap.Error(err))
+		return nil, err
+	}
+	return hits, nil
+}
+
+// RoutingRepo handles app_routing_settings table operations (implements tasks.RoutingRepository)
+type RoutingRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewRoutingRepo creates a new routing repository
+func NewRoutingRepo(pool *pgxpool.Pool, logger *zap.Logger) *RoutingRepo {
+	return &RoutingRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// GetAppRouting retrieves an app's routing options, or nil when it is served with the defaults
+func (r *RoutingRepo) GetAppRouting(ctx context.Context, appID string) (*services.RoutingConfig, error) {
+	var cfg services.RoutingConfig
+	err := r.pool.QueryRow(ctx,
+		`SELECT force_https, compression, max_request_body_bytes, headers, basic_auth_user, ip_allowlist
+		 FROM app_routing_settings WHERE app_id = $1`,
+		appID,
+	).Scan(&cfg.ForceHTTPS, &cfg.Compression, &cfg.MaxRequestBodyBytes, &cfg.Headers, &cfg.BasicAuthUser, &cfg.IPAllowlist)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get routing settings", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// SetAppRouting creates or replaces an app's routing options
+func (r *RoutingRepo) SetAppRouting(ctx context.Context, appID string, cfg services.RoutingConfig) error {
+	headers := cfg.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	ipAllowlist := cfg.IPAllowlist
+	if ipAllowlist == nil {
+		ipAllowlist = []string{}
+	}
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO app_routing_settings (app_id, force_https, compression, max_request_body_bytes, headers, basic_auth_user, ip_allowlist)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (app_id) DO UPDATE SET
+		   force_https = EXCLUDED.force_https,
+		   compression = EXCLUDED.compression,
+		   max_request_body_bytes = EXCLUDED.max_request_body_bytes,
+		   headers = EXCLUDED.headers,
+		   basic_auth_user = EXCLUDED.basic_auth_user,
+		   ip_allowlist = EXCLUDED.ip_allowlist,
+		   updated_at = NOW()`,
+		appID, cfg.ForceHTTPS, cfg.Compression, cfg.MaxRequestBodyBytes, headers, cfg.BasicAuthUser, ipAllowlist,
+	)
+	if err != nil {
+		r.logger.Error("Failed to set routing settings", zap.Error(err), zap.String("app_id", appID))
+		return err
+	}
+	return nil
+}
+
+// ImpersonationSession is an admin acting as a user through a short-lived token
+type ImpersonationSession struct {
+	ID           string  `json:"id"`
+	AdminUserID  string  `json:"admin_user_id,omitempty"`
+	AdminEmail   string  `json:"admin_email"`
+	TargetUserID string  `json:"target_user_id,omitempty"`
+	TargetEmail  string  `json:"target_email"`
+	Reason       string  `json:"reason"`
+	ExpiresAt    string  `json:"expires_at"`
+	EndedAt      *string `json:"ended_at,omitempty"`
+	CreatedAt    string  `json:"created_at"`
+}
+
+// AuditEntry is one append-only audit log record
+type AuditEntry struct {
+	ID              string                 `json:"id"`
+	Action          string                 `json:"action"`
+	ActorUserID     string                 `json:"actor_user_id,omitempty"`
+	ActorEmail      string                 `json:"actor_email,omitempty"`
+	SubjectUserID   string                 `json:"subject_user_id,omitempty"`
+	ImpersonationID string                 `json:"impersonation_id,omitempty"`
+	Method          string                 `json:"method,omitempty"`
+	Path            string                 `json:"path,omitempty"`
+	StatusCode      int                    `json:"status_code,omitempty"`
+	IP              string                 `json:"ip,omitempty"`
+	RequestID       string                 `json:"request_id,omitempty"`
+	Details         map[string]interface{} `json:"details,omitempty"`
+	CreatedAt       string                 `json:"created_at"`
+}
+
+// AuditFilter narrows audit log listings; empty fields match everything
+type AuditFilter struct {
+	SubjectUserID   string     // Account acted on or as
+	InvolvedUserID  string     // Account acted on, as or by (GET /api/v1/audit)
+	ImpersonationID string
+	Action          string     // Exact action, or a prefix ending in ".*" (e.g. "auth.*")
+	Since           *time.Time // Inclusive
+	Until           *time.Time // Exclusive
+}
+
+// AuditRepo handles impersonation_sessions and audit_log table operations
+type AuditRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewAuditRepo creates a new audit repository
+func NewAuditRepo(pool *pgxpool.Pool, logger *zap.Logger) *AuditRepo {
+	return &AuditRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// impersonationColumns is the column list shared by impersonation session queries
+const impersonationColumns = `id, COALESCE(admin_user_id::text, ''), admin_email, COALESCE(target_user_id::text, ''), target_email, reason, expires_at, ended_at, created_at`
+
+// scanImpersonation scans a row selected with impersonationColumns into an ImpersonationSession
+func scanImpersonation(row pgx.Row) (*ImpersonationSession, error) {
+	var session ImpersonationSession
+	var expiresAt, createdAt time.Time
+	var endedAt *time.Time
+	if err := row.Scan(&session.ID, &session.AdminUserID, &session.AdminEmail, &session.TargetUserID, &session.TargetEmail,
+		&session.Reason, &expiresAt, &endedAt, &createdAt); err != nil {
+		return nil, err
+	}
+	session.ExpiresAt = expiresAt.Format(time.RFC3339)
+	session.CreatedAt = createdAt.Format(time.RFC3339)
+	if endedAt != nil {
+		ended := endedAt.Format(time.RFC3339)
+		session.EndedAt = &ended
+	}
+	return &session, nil
+}
+
+// CreateImpersonation starts an impersonation session that lasts until expiresAt
+func (r *AuditRepo) CreateImpersonation(ctx context.Context, adminUserID, adminEmail, targetUserID, targetEmail, reason string, expiresAt time.Time) (*ImpersonationSession, error) {
+	session, err := scanImpersonation(r.pool.QueryRow(ctx,
+		`INSERT INTO impersonation_sessions (admin_user_id, admin_email, target_user_id, target_email, reason, expires_at)
+		 VALUES (NULLIF($1, '')::uuid, $2, $3, $4, $5, $6)
+		 RETURNING `+impersonationColumns,
+		adminUserID, adminEmail, targetUserID, targetEmail, reason, expiresAt,
+	))
+	if err != nil {
+		r.logger.Error("Failed to create impersonation session", zap.Error(err), zap.String("target_user_id", targetUserID))
+		return nil, err
+	}
+	return session, nil
+}
+
+// IsImpersonationActive reports whether a session exists, has not expired and was not ended
+func (r *AuditRepo) IsImpersonationActive(ctx context.Context, impersonationID string) (bool, error) {
+	var active bool
+	err := r.pool.QueryRow(ctx,
+		`SELECT EXISTS (
+		     SELECT 1 FROM impersonation_sessions
+		     WHERE id::text = $1 AND ended_at IS NULL AND expires_at > $2
+		 )`,
+		impersonationID, time.Now().UTC(),
+	).Scan(&active)
+	if err != nil {
+		r.logger.Error("Failed to check impersonation session", zap.Error(err), zap.String("impersonation_id", impersonationID))
+		return false, err
+	}
+	return active, nil
+}
+
+// EndImpersonation ends a session early; returns pgx.ErrNoRows when it does not exist or already ended
+func (r *AuditRepo) EndImpersonation(ctx context.Context, impersonationID string) (*ImpersonationSession, error) {
+	session, err := scanImpersonation(r.pool.QueryRow(ctx,
+		`UPDATE impersonation_sessions SET ended_at = NOW()
+		 WHERE id::text = $1 AND ended_at IS NULL
+		 RETURNING `+impersonationColumns,
+		impersonationID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to end impersonation session", zap.Error(err), zap.String("impersonation_id", impersonationID))
+		return nil, err
+	}
+	return session, nil
+}
+
+// RecordAuditEntry appends an entry to the audit log
+func (r *AuditRepo) RecordAuditEntry(ctx context.Context, entry AuditEntry) error {
+	var details []byte
+	if entry.Details != nil {
+		encoded, err := json.Marshal(entry.Details)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit details: %w", err)
+		}
+		details = encoded
+	}
+
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO audit_log (action, actor_user_id, actor_email, subject_user_id, impersonation_id,
+		                        method, path, status_code, ip, request_id, details)
+		 VALUES ($1, NULLIF($2, '')::uuid, $3, NULLIF($4, '')::uuid, NULLIF($5, '')::uuid,
+		         $6, $7, NULLIF($8, 0), $9, $10, $11)`,
+		entry.Action, entry.ActorUserID, entry.ActorEmail, entry.SubjectUserID, entry.ImpersonationID,
+		entry.Method, entry.Path, entry.StatusCode, entry.IP, entry.RequestID, details,
+	)
+	if err != nil {
+		r.logger.Error("Failed to record audit entry", zap.Error(err), zap.String("action", entry.Action))
+		return err
+	}
+	return nil
+}
+
+// ListAuditEntries retrieves the most recent audit entries matching the filter
+func (r *AuditRepo) ListAuditEntries(ctx context.Context, filter AuditFilter, limit int) ([]*AuditEntry, error) {
+	// "auth.*" matches every action starting with "auth."
+	action, actionPrefix := filter.Action, false
+	if prefix, ok := strings.CutSuffix(action, "*"); ok {
+		action, actionPrefix = prefix, true
+	}
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, action, COALESCE(actor_user_id::text, ''), actor_email, COALESCE(subject_user_id::text, ''),
+		        COALESCE(impersonation_id::text, ''), method, path, COALESCE(status_code, 0), ip, request_id, details, created_at
+		 FROM audit_log
+		 WHERE ($1 = '' OR subject_user_id::text = $1)
+		   AND ($2 = '' OR impersonation_id::text = $2)
+		   AND ($3 = '' OR subject_user_id::text = $3 OR actor_user_id::text = $3)
+		   AND ($4 = '' OR action = $4 OR ($5 AND left(action, length($4)) = $4))
+		   AND ($6::timestamp IS NULL OR created_at >= $6)
+		   AND ($7::timestamp IS NULL OR created_at < $7)
+		 ORDER BY created_at DESC
+		 LIMIT $8`,
+		filter.SubjectUserID, filter.ImpersonationID, filter.InvolvedUserID, action, actionPrefix,
+		filter.Since, filter.Until, limit,
+	)
+	if err != nil {
+		r.logger.Error("Failed to list audit entries", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*AuditEntry, 0)
+	for rows.Next() {
+		var entry AuditEntry
+		var details []byte
+		var createdAt time.Time
+		if err := rows.Scan(&entry.ID, &entry.Action, &entry.ActorUserID, &entry.ActorEmail, &entry.SubjectUserID,
+			&entry.ImpersonationID, &entry.Method, &entry.Path, &entry.StatusCode, &entry.IP, &entry.RequestID,
+			&details, &createdAt); err != nil {
+			r.logger.Error("Failed to scan audit entry", zap.Error(err))
+			continue
+		}
+		if details != nil {
+			if err := json.Unmarshal(details, &entry.Details); err != nil {
+				r.logger.Warn("Failed to decode audit details", zap.Error(err), zap.String("audit_id", entry.ID))
+			}
+		}
+		entry.CreatedAt = createdAt.Format(time.RFC3339)
+		entries = append(entries, &entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating audit entries", zap.Error(err))
+		return nil, err
+	}
+	return entries, nil
+}
+
+// EmailLogRepo handles email_log table operations (implements services.EmailLogRepository)
+type EmailLogRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewEmailLogRepo creates a new email log repository
+func NewEmailLogRepo(pool *pgxpool.Pool, logger *zap.Logger) *EmailLogRepo {
+	return &EmailLogRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// CreateQueuedEmail records an email to deliver; created is false when one with idempotencyKey exists
+func (r *EmailLogRepo) CreateQueuedEmail(ctx context.Context, idempotencyKey, recipient string, email *services.RenderedEmail) (string, bool, error) {
+	var id string
+	err := r.pool.QueryRow(ctx,
+		`INSERT INTO email_log (idempotency_key, recipient, subject, html_body, text_body)
+		 VALUES (NULLIF($1, ''), $2, $3, $4, $5)
+		 ON CONFLICT (idempotency_key) DO NOTHING
+		 RETURNING id`,
+		idempotencyKey, recipient, email.Subject, email.HTML, email.Text,
+	).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", false, nil
+		}
+		r.logger.Error("Failed to record queued email", zap.Error(err))
+		return "", false, err
+	}
+	return id, true, nil
+}
+
+// GetQueuedEmail retrieves a logged email
+func (r *EmailLogRepo) GetQueuedEmail(ctx context.Context, id string) (*services.QueuedEmail, error) {
+	var email services.QueuedEmail
+	err := r.pool.QueryRow(ctx,
+		`SELECT id, recipient, subject, html_body, text_body, status, attempts FROM email_log WHERE id = $1`,
+		id,
+	).Scan(&email.ID, &email.Recipient, &email.Subject, &email.HTMLBody, &email.TextBody, &email.Status, &email.Attempts)
+	if err != nil {
+		return nil, err
+	}
+	return &email, nil
+}
+
+// RecordEmailAttempt records a delivery attempt: a success marks the email sent and drops its bodies,
+// a failure keeps it queued for the next retry unless final, which leaves it dead
+func (r *EmailLogRepo) RecordEmailAttempt(ctx context.Context, id, provider, providerMessageID string, sendErr error, final bool) error {
+	var err error
+	if sendErr == nil {
+		_, err = r.pool.Exec(ctx,
+			`UPDATE email_log
+			 SET status = 'sent', attempts = attempts + 1, provider = $2, provider_message_id = NULLIF($3, ''),
+			     last_error = NULL, html_body = '', text_body = '', sent_at = NOW()
+			 WHERE id = $1`,
+			id, provider, providerMessageID,
+		)
+	} else {
+		_, err = r.pool.Exec(ctx,
+			`UPDATE email_log
+			 SET attempts = attempts + 1, last_error = $2, status = CASE WHEN $3 THEN 'dead' ELSE status END
+			 WHERE id = $1`,
+			id, sendErr.Error(), final,
+		)
+	}
+	if err != nil {
+		r.logger.Error("Failed to record email attempt", zap.Error(err), zap.String("email_id", id))
+		return err
+	}
+	return nil
+}
+
+// HasEmail reports whether an email with idempotencyKey was queued (whether or not it went out)
+func (r *EmailLogRepo) HasEmail(ctx context.Context, idempotencyKey string) (bool, error) {
+	var exists bool
+	err := r.pool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM email_log WHERE idempotency_key = $1)`,
+		idempotencyKey,
+	).Scan(&exists)
+	return exists, err
+}
+
+// DeploymentTask is a build or deploy task of a deployment, as last recorded by the API or a worker
+type DeploymentTask struct {
+	TaskID       string `json:"task_id"`
+	Type         string `json:"type"` // build_task or deploy_task
+	Queue        string `json:"queue"`
+	Status       string `json:"status"`   // pending, processing, retrying, completed, failed
+	Attempts     int    `json:"attempts"` // Attempts started so far (0 while pending)
+	MaxRetries   int    `json:"max_retries"`
+	ErrorMessage string `json:"error_message,omitempty"` // Error of the last failed attempt
+	QueuedAt     string `json:"queued_at"`
+	StartedAt    string `json:"started_at,omitempty"` // Start of the latest attempt
+	FinishedAt   string `json:"finished_at,omitempty"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+// TaskStateRepo handles task_states table operations
+type TaskStateRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewTaskStateRepo creates a new task state repository
+func NewTaskStateRepo(pool *pgxpool.Pool, logger *zap.Logger) *TaskStateRepo {
+	return &TaskStateRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// taskStateLinks takes the app, deployment and build job a task belongs to from its payload ($5)
+const taskStateLinks = `NULLIF($5::jsonb->>'app_id', '')::uuid, NULLIF($5::jsonb->>'deployment_id', '')::uuid,
+		         NULLIF($5::jsonb->>'build_job_id', '')::uuid`
+
+// RecordTaskEnqueued records an enqueued task as pending (implements services.TaskStateRecorder)
+// A task ID already recorded is only replaced once that task has finished - deduplicated enqueues
+// return the task in flight, whose state must not be reset
+func (r *TaskStateRepo) RecordTaskEnqueued(ctx context.Context, taskID, taskType, queue string, payload []byte, maxRetries int) error {
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO task_states (task_id, task_type, queue_name, max_retries, payload, app_id, deployment_id, build_job_id, status)
+		 VALUES ($1, $2, $3, $4, $5::jsonb, `+taskStateLinks+`, 'pending')
+		 ON CONFLICT (task_id) DO UPDATE
+		 SET task_type = EXCLUDED.task_type, queue_name = EXCLUDED.queue_name, max_retries = EXCLUDED.max_retries,
+		     payload = EXCLUDED.payload, app_id = EXCLUDED.app_id, deployment_id = EXCLUDED.deployment_id,
+		     build_job_id = EXCLUDED.build_job_id, status = 'pending', retry_count = 0, error_message = NULL,
+		     created_at = NOW(), updated_at = NOW(), started_at = NULL, completed_at = NULL, failed_at = NULL
+		 WHERE task_states.status IN ('completed', 'failed')`,
+		taskID, taskType, queue, maxRetries, payload,
+	)
+	if err != nil {
+		r.logger.Error("Failed to record enqueued task", zap.Error(err), zap.String("task_id", taskID))
+		return err
+	}
+	return nil
+}
+
+// StartTaskState marks a task as processing (implements tasks.TaskStateRepository)
+// The error of a previous attempt is kept while the task is retried
+func (r *TaskStateRepo) StartTaskState(ctx context.Context, state *tasks.TaskState) error {
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO task_states (task_id, task_type, queue_name, max_retries, payload, app_id, deployment_id, build_job_id,
+		                          status, retry_count, started_at)
+		 VALUES ($1, $2, $3, $4, $5::jsonb, `+taskStateLinks+`, 'processing', $6, NOW())
+		 ON CONFLICT (task_id) DO UPDATE
+		 SET queue_name = EXCLUDED.queue_name, max_retries = EXCLUDED.max_retries, status = 'processing',
+		     retry_count = EXCLUDED.retry_count, started_at = NOW(), updated_at = NOW(),
+		     error_message = CASE WHEN task_states.status = 'retrying' THEN task_states.error_message END,
+		     completed_at = NULL, failed_at = NULL`,
+		state.TaskID, state.TaskType, state.QueueName, state.MaxRetries, []byte(state.Payload), state.RetryCount,
+	)
+	if err != nil {
+		r.logger.Error("Failed to start task state", zap.Error(err), zap.String("task_id", state.TaskID))
+		return err
+	}
+	return nil
+}
+
+// FinishTaskState records the outcome of a task's attempt (implements tasks.TaskStateRepository)
+func (r *TaskStateRepo) FinishTaskState(ctx context.Context, taskID, status, errorMsg string) error {
+	_, err := r.pool.Exec(ctx,
+		`UPDATE task_states
+		 SET status = $2, error_message = NULLIF($3, ''), updated_at = NOW(),
+		     completed_at = CASE WHEN $2 = 'completed' THEN NOW() END,
+		     failed_at = CASE WHEN $2 = 'failed' THEN NOW() END
+		 WHERE task_id = $1`,
+		taskID, status, errorMsg,
+	)
+	if err != nil {
+		r.logger.Error("Failed to finish task state", zap.Error(err), zap.String("task_id", taskID))
+		return err
+	}
+	return nil
+}
+
+// PruneTaskStates deletes finished task states last updated before the given time (implements tasks.TaskStateRepository)
+func (r *TaskStateRepo) PruneTaskStates(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.pool.Exec(ctx,
+		`DELETE FROM task_states WHERE status IN ('completed', 'failed') AND updated_at < $1`,
+		before,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ListDeploymentTasks lists the tasks of a deployment and of the build job that produced it, oldest first
+func (r *TaskStateRepo) ListDeploymentTasks(ctx context.Context, deploymentID, buildJobID string) ([]DeploymentTask, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT task_id, task_type, queue_name, status,
+		        CASE WHEN status = 'pending' THEN 0 ELSE retry_count + 1 END, max_retries, error_message,
+		        created_at, started_at, COALESCE(completed_at, failed_at), updated_at
+		 FROM task_states
+		 WHERE deployment_id = $1 OR build_job_id = NULLIF($2, '')::uuid
+		 ORDER BY created_at, id`,
+		deploymentID, buildJobID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to list deployment tasks", zap.Error(err), zap.String("deployment_id", deploymentID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	taskList := []DeploymentTask{}
+	for rows.Next() {
+		var task DeploymentTask
+		var errorMsg sql.NullString
+		var createdAt, updatedAt time.Time
+		var startedAt, finishedAt sql.NullTime
+		if err := rows.Scan(&task.TaskID, &task.Type, &task.Queue, &task.Status, &task.Attempts, &task.MaxRetries,
+			&errorMsg, &createdAt, &startedAt, &finishedAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		task.ErrorMessage = errorMsg.String
+		task.QueuedAt = createdAt.Format(time.RFC3339)
+		if startedAt.Valid {
+			task.StartedAt = startedAt.Time.Format(time.RFC3339)
+		}
+		if finishedAt.Valid {
+			task.FinishedAt = finishedAt.Time.Format(time.RFC3339)
+		}
+		task.UpdatedAt = updatedAt.Format(time.RFC3339)
+		taskList = append(taskList, task)
+	}
+	return taskList, rows.Err()
+}
+
+// DeploymentEvent is one entry of an app's events timeline, recorded by the build and deploy workers
+type DeploymentEvent struct {
+	ID           int64                  `json:"id"` // Increases in recording order - pass as ?before= for older events
+	Type         string                 `json:"type"`
+	Message      string                 `json:"message"`
+	BuildJobID   string                 `json:"build_job_id,omitempty"`
+	DeploymentID string                 `json:"deployment_id,omitempty"`
+	Data         map[string]interface{} `json:"data"`
+	CreatedAt    string                 `json:"created_at"`
+}
+
+// DeployEventRepo handles deployment_events table operations
+type DeployEventRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewDeployEventRepo creates a new deploy event repository
+func NewDeployEventRepo(pool *pgxpool.Pool, logger *zap.Logger) *DeployEventRepo {
+	return &DeployEventRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// RecordDeployEvent stores a deploy event (implements services.DeployEventRecorder)
+// Events of apps deleted in the meantime are dropped; a deployment that no longer exists is left out
+func (r *DeployEventRepo) RecordDeployEvent(ctx context.Context, event services.DeployEvent) error {
+	data := event.Data
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deploy event data: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx,
+		`INSERT INTO deployment_events (app_id, build_job_id, deployment_id, type, message, data)
+		 SELECT id, NULLIF($2, '')::uuid, (SELECT d.id FROM deployments d WHERE d.id = NULLIF($3, '')::uuid), $4, $5, $6
+		 FROM apps WHERE id = $1`,
+		event.AppID, event.BuildJobID, event.DeploymentID, event.Type, event.Message, dataJSON,
+	); err != nil {
+		r.logger.Error("Failed to record deploy event", zap.Error(err), zap.String("app_id", event.AppID), zap.String("type", event.Type))
+		return err
+	}
+	return nil
+}
+
+// ListDeployEvents returns up to limit of the app's latest events, oldest first
+// Optionally only those of one build job or deployment (a deployment includes the events of its build),
+// and only those recorded before the event with ID before (0 for the latest)
+func (r *DeployEventRepo) ListDeployEvents(ctx context.Context, appID, buildJobID, deploymentID string, before int64, limit int) ([]DeploymentEvent, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, type, message, COALESCE(build_job_id::text, ''), COALESCE(deployment_id::text, ''), data, created_at
+		 FROM (
+		     SELECT * FROM deployment_events
+		     WHERE app_id = $1
+		       AND ($2 = '' OR build_job_id = NULLIF($2, '')::uuid)
+		       AND ($3 = '' OR deployment_id = NULLIF($3, '')::uuid
+		            OR build_job_id = (SELECT build_job_id FROM deployments WHERE id = NULLIF($3, '')::uuid))
+		       AND ($4 = 0 OR id < $4)
+		     ORDER BY id DESC
+		     LIMIT $5
+		 ) latest
+		 ORDER BY id`,
+		appID, buildJobID, deploymentID, before, limit,
+	)
+	if err != nil {
+		r.logger.Error("Failed to list deploy events", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []DeploymentEvent{}
+	for rows.Next() {
+		var event DeploymentEvent
+		var createdAt time.Time
+		if err := rows.Scan(&event.ID, &event.Type, &event.Message, &event.BuildJobID, &event.DeploymentID, &event.Data, &createdAt); err != nil {
+			return nil, err
+		}
+		if event.Data == nil {
+			event.Data = map[string]interface{}{}
+		}
+		event.CreatedAt = createdAt.Format(time.RFC3339)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// LogSearchQuery filters an app's indexed log lines; zero fields don't filter
+type LogSearchQuery struct {
+	Substring string    // Case-insensitive substring the line contains
+	Regex     string    // Case-insensitive POSIX regex the line matches
+	From      time.Time // Lines logged at or after
+	To        time.Time // Lines logged at or before
+	Levels    []string  // Lines of one of these levels
+	LogType   string    // build, runtime or release
+	Before    int64     // Lines indexed before the line with this ID
+	Limit     int
+}
+
+// LogSearchLine is an indexed log line found by a search
+type LogSearchLine struct {
+	ID        int64  `json:"id"` // Increases in indexing order - pass as ?before= for older lines
+	LogType   string `json:"log_type"`
+	SourceID  string `json:"source_id,omitempty"` // Build job ID (build), container ID (runtime) or deployment ID (release)
+	Level     string `json:"level,omitempty"`
+	Timestamp string `json:"timestamp"`
+	Line      string `json:"line"`
+	// The message and remaining fields of lines that are JSON objects
+	Message string          `json:"message,omitempty"`
+	Fields  json.RawMessage `json:"fields,omitempty"`
+	// The line split into the parts that matched the search and those that didn't, in order
+	Highlights []LogLineSegment `json:"highlights,omitempty"`
+}
+
+// LogLineSegment is part of a found line
+type LogLineSegment struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match,omitempty"`
+}
+
+// LogSearchRepo handles app_log_lines table operations
+type LogSearchRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewLogSearchRepo creates a new log search repository
+func NewLogSearchRepo(pool *pgxpool.Pool, logger *zap.Logger) *LogSearchRepo {
+	return &LogSearchRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// IndexLogLines stores lines of one log for search. Lines of apps deleted meanwhile are dropped
+func (r *LogSearchRepo) IndexLogLines(ctx context.Context, appID, logType, sourceID string, lines []services.LogLine) error {
+	timestamps := make([]time.Time, len(lines))
+	levels := make([]string, len(lines))
+	texts := make([]string, len(lines))
+	messages := make([]*string, len(lines)) // NULL for plain text lines
+	fields := make([]*string, len(lines))
+	for i, line := range lines {
+		timestamps[i] = line.Timestamp.UTC()
+		levels[i] = line.Level
+		texts[i] = line.Line
+		if line.Message != "" {
+			messages[i] = &line.Message
+		}
+		if len(line.Fields) > 0 {
+			encoded, err := json.Marshal(line.Fields)
+			if err != nil {
+				return fmt.Errorf("failed to encode log line fields: %w", err)
+			}
+			text := string(encoded)
+			fields[i] = &text
+		}
+	}
+
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO app_log_lines (app_id, log_type, source_id, level, logged_at, line, message, fields)
+		 SELECT a.id, $2, $3, l.level, l.logged_at, l.line, l.message, l.fields::jsonb
+		 FROM apps a, unnest($4::timestamp[], $5::text[], $6::text[], $7::text[], $8::text[]) AS l(logged_at, level, line, message, fields)
+		 WHERE a.id = $1`,
+		appID, logType, sourceID, timestamps, levels, texts, messages, fields,
+	)
+	return err
+}
+
+// SearchLogs returns up to query.Limit of the app's latest lines matching query, newest first
+// The statement is built from the filters that are set, so Postgres plans each search for the indexes
+// it can use (the trigram index for patterns, the time index for ranges)
+func (r *LogSearchRepo) SearchLogs(ctx context.Context, appID string, query LogSearchQuery) ([]LogSearchLine, error) {
+	conditions := []string{"app_id = $1"}
+	args := []interface{}{appID}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if query.Substring != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query.Substring)
+		where("line ILIKE $%d", "%"+escaped+"%")
+	}
+	if query.Regex != "" {
+		where("line ~* $%d", query.Regex)
+	}
+	if !query.From.IsZero() {
+		where("logged_at >= $%d", query.From.UTC())
+	}
+	if !query.To.IsZero() {
+		where("logged_at <= $%d", query.To.UTC())
+	}
+	if len(query.Levels) > 0 {
+		where("level = ANY($%d)", query.Levels)
+	}
+	if query.LogType != "" {
+		where("log_type = $%d", query.LogType)
+	}
+	if query.Before > 0 {
+		where("id < $%d", query.Before)
+	}
+	args = append(args, query.Limit)
+
+	rows, err := r.pool.Query(ctx,
+		fmt.Sprintf(`SELECT id, log_type, source_id, level, logged_at, line, COALESCE(message, ''), fields
+		 FROM app_log_lines
+		 WHERE %s
+		 ORDER BY id DESC
+		 LIMIT $%d`, strings.Join(conditions, " AND "), len(args)),
+		args...,
+	)
+	if err != nil {
+		r.logger.Error("Failed to search logs", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []LogSearchLine{}
+	for rows.Next() {
+		var line LogSearchLine
+		var loggedAt time.Time
+		var fields []byte
+		if err := rows.Scan(&line.ID, &line.LogType, &line.SourceID, &line.Level, &loggedAt, &line.Line, &line.Message, &fields); err != nil {
+			return nil, err
+		}
+		line.Timestamp = loggedAt.Format(time.RFC3339Nano)
+		line.Fields = fields
+		lines = append(lines, line)
 	}
-	if status != "" {
-		setParts = append(setParts, fmt.Sprintf("status = $%d", argNum))
-		args = append(args, status)
-		argNum++
+	return lines, rows.Err()
+}
+
+// PruneLogLines deletes lines logged before before and returns how many
+// Lines are deleted in batches, so a large backlog never runs into the statement timeout
+func (r *LogSearchRepo) PruneLogLines(ctx context.Context, before time.Time) (int64, error) {
+	const batchSize = 10000
+	var pruned int64
+	for {
+		tag, err := r.pool.Exec(ctx,
+			`DELETE FROM app_log_lines
+			 WHERE id IN (SELECT id FROM app_log_lines WHERE logged_at < $1 LIMIT $2)`,
+			before.UTC(), batchSize,
+		)
+		if err != nil {
+			r.logger.Error("Failed to prune log lines", zap.Error(err))
+			return pruned, err
+		}
+		pruned += tag.RowsAffected()
+		if tag.RowsAffected() < batchSize {
+			return pruned, nil
+		}
 	}
-	if ramLimitMB != nil {
-		setParts = append(setParts, fmt.Sprintf("ram_limit_mb = $%d", argNum))
-		args = append(args, *ramLimitMB)
-		argNum++
+}
+
+// AppLogDrain is an endpoint an app's runtime logs are shipped to, with its health as the deploy worker last recorded it
+type AppLogDrain struct {
+	ID              string  `json:"id"`
+	AppID           string  `json:"app_id"`
+	Kind            string  `json:"kind"` // syslog, http, loki or datadog
+	URL             string  `json:"url"`
+	HasToken        bool    `json:"has_token"` // The token itself is never returned
+	Enabled         bool    `json:"enabled"`
+	Status          string  `json:"status"` // pending, healthy or failing
+	LastError       string  `json:"last_error,omitempty"`
+	LastErrorAt     *string `json:"last_error_at,omitempty"`
+	LastDeliveredAt *string `json:"last_delivered_at,omitempty"`
+	DroppedLines    int64   `json:"dropped_lines"` // Lines dropped because the drain's buffer was full
+	CreatedAt       string  `json:"created_at"`
+	UpdatedAt       string  `json:"updated_at"`
+	Token           string  `json:"-"`
+}
+
+// LogDrainRepo handles app_log_drains table operations
+type LogDrainRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+// NewLogDrainRepo creates a new log drain repository
+func NewLogDrainRepo(pool *pgxpool.Pool, logger *zap.Logger) *LogDrainRepo {
+	return &LogDrainRepo{
+		pool:   pool,
+		logger: logger,
 	}
-	if diskLimitGB != nil {
-		setParts = append(setParts, fmt.Sprintf("disk_limit_gb = $%d", argNum))
-		args = append(args, *diskLimitGB)
-		argNum++
+}
+
+// appLogDrainColumns is the column list shared by app log drain queries
+const appLogDrainColumns = `id, app_id, kind, url, COALESCE(token, ''), enabled, status, last_error, last_error_at,
+	last_delivered_at, dropped_lines, created_at, updated_at`
+
+// scanAppLogDrain scans a row selected with appLogDrainColumns into an AppLogDrain
+func scanAppLogDrain(row pgx.Row) (*AppLogDrain, error) {
+	var drain AppLogDrain
+	var lastError sql.NullString
+	var lastErrorAt, lastDeliveredAt sql.NullTime
+	var createdAt, updatedAt time.Time
+	if err := row.Scan(&drain.ID, &drain.AppID, &drain.Kind, &drain.URL, &drain.Token, &drain.Enabled, &drain.Status,
+		&lastError, &lastErrorAt, &lastDeliveredAt, &drain.DroppedLines, &createdAt, &updatedAt); err != nil {
+		return nil, err
 	}
-	if lemonSubID != nil {
-		if *lemonSubID == "" {
-			setParts = append(setParts, fmt.Sprintf("lemon_subscription_id = NULL"))
-		} else {
-			setParts = append(setParts, fmt.Sprintf("lemon_subscription_id = $%d", argNum))
-			args = append(args, *lemonSubID)
-			argNum++
-		}
+	drain.HasToken = drain.Token != ""
+	drain.LastError = lastError.String
+	if lastErrorAt.Valid {
+		formatted := lastErrorAt.Time.Format(time.RFC3339)
+		drain.LastErrorAt = &formatted
 	}
-	
-	query := fmt.Sprintf("UPDATE subscriptions SET %s WHERE id = $1", strings.Join(setParts, ", "))
-	_, err := r.pool.Exec(ctx, query, args...)
+	if lastDeliveredAt.Valid {
+		formatted := lastDeliveredAt.Time.Format(time.RFC3339)
+		drain.LastDeliveredAt = &formatted
+	}
+	drain.CreatedAt = createdAt.Format(time.RFC3339)
+	drain.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &drain, nil
+}
+
+// CreateLogDrain adds a log drain to an app
+func (r *LogDrainRepo) CreateLogDrain(ctx context.Context, drain *AppLogDrain) (*AppLogDrain, error) {
+	created, err := scanAppLogDrain(r.pool.QueryRow(ctx,
+		`INSERT INTO app_log_drains (app_id, kind, url, token, enabled)
+		 VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		 RETURNING `+appLogDrainColumns,
+		drain.AppID, drain.Kind, drain.URL, drain.Token, drain.Enabled,
+	))
 	if err != nil {
-		r.logger.Error("Failed to update subscription", zap.Error(err), zap.String("subscription_id", subscriptionID))
-		return err
+		r.logger.Error("Failed to create log drain", zap.Error(err), zap.String("app_id", drain.AppID))
+		return nil, err
 	}
-	return nil
+	return created, nil
 }
 
-// UpdateSubscriptionByUserID updates a user's subscription
-func (r *SubscriptionRepo) UpdateSubscriptionByUserID(ctx context.Context, userID, plan, status string, ramLimitMB, diskLimitGB *int, lemonSubID *string) error {
-	setParts := []string{"updated_at = NOW()"}
-	args := []interface{}{userID}
-	argNum := 2
-	
-	if plan != "" {
-		setParts = append(setParts, fmt.Sprintf("plan = $%d", argNum))
-		args = append(args, plan)
-		argNum++
+// GetLogDrainsByAppID retrieves all log drains of an app
+func (r *LogDrainRepo) GetLogDrainsByAppID(ctx context.Context, appID string) ([]*AppLogDrain, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+appLogDrainColumns+`
+		 FROM app_log_drains
+		 WHERE app_id = $1
+		 ORDER BY created_at ASC`,
+		appID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to get log drains", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
 	}
-	if status != "" {
-		setParts = append(setParts, fmt.Sprintf("status = $%d", argNum))
-		args = append(args, status)
-		argNum++
+	defer rows.Close()
+
+	drains := make([]*AppLogDrain, 0)
+	for rows.Next() {
+		drain, err := scanAppLogDrain(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan log drain", zap.Error(err))
+			continue
+		}
+		drains = append(drains, drain)
 	}
-	if ramLimitMB != nil {
-		setParts = append(setParts, fmt.Sprintf("ram_limit_mb = $%d", argNum))
-		args = append(args, *ramLimitMB)
-		argNum++
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating log drains", zap.Error(err))
+		return nil, err
 	}
-	if diskLimitGB != nil {
-		setParts = append(setParts, fmt.Sprintf("disk_limit_gb = $%d", argNum))
-		args = append(args, *diskLimitGB)
-		argNum++
+
+	return drains, nil
+}
+
+// GetLogDrainByID retrieves a log drain of an app
+// Returns pgx.ErrNoRows if the drain doesn't exist or belongs to another app
+func (r *LogDrainRepo) GetLogDrainByID(ctx context.Context, appID, drainID string) (*AppLogDrain, error) {
+	drain, err := scanAppLogDrain(r.pool.QueryRow(ctx,
+		`SELECT `+appLogDrainColumns+`
+		 FROM app_log_drains
+		 WHERE id = $1 AND app_id = $2`,
+		drainID, appID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get log drain", zap.Error(err), zap.String("drain_id", drainID))
+		return nil, err
 	}
-	if lemonSubID != nil {
-		if *lemonSubID == "" {
-			setParts = append(setParts, fmt.Sprintf("lemon_subscription_id = NULL"))
-		} else {
-			setParts = append(setParts, fmt.Sprintf("lemon_subscription_id = $%d", argNum))
-			args = append(args, *lemonSubID)
-			argNum++
+	return drain, nil
+}
+
+// UpdateLogDrain saves a drain's URL, token and enabled flag. A new URL or token puts the drain's health
+// back to pending, since the last error no longer applies
+func (r *LogDrainRepo) UpdateLogDrain(ctx context.Context, drain *AppLogDrain) (*AppLogDrain, error) {
+	updated, err := scanAppLogDrain(r.pool.QueryRow(ctx,
+		`UPDATE app_log_drains
+		 SET url = $3, token = NULLIF($4, ''), enabled = $5,
+		     status = CASE WHEN url <> $3 OR COALESCE(token, '') <> $4 THEN 'pending' ELSE status END,
+		     last_error = CASE WHEN url <> $3 OR COALESCE(token, '') <> $4 THEN NULL ELSE last_error END,
+		     updated_at = NOW()
+		 WHERE id = $1 AND app_id = $2
+		 RETURNING `+appLogDrainColumns,
+		drain.ID, drain.AppID, drain.URL, drain.Token, drain.Enabled,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
 		}
+		r.logger.Error("Failed to update log drain", zap.Error(err), zap.String("drain_id", drain.ID))
+		return nil, err
 	}
-	
-	query := fmt.Sprintf("UPDATE subscriptions SET %s WHERE user_id = $1", strings.Join(setParts, ", "))
-	_, err := r.pool.Exec(ctx, query, args...)
+	return updated, nil
+}
+
+// DeleteLogDrain removes a log drain; the deploy worker stops shipping to it within a minute
+func (r *LogDrainRepo) DeleteLogDrain(ctx context.Context, appID, drainID string) error {
+	result, err := r.pool.Exec(ctx,
+		"DELETE FROM app_log_drains WHERE id = $1 AND app_id = $2",
+		drainID, appID,
+	)
 	if err != nil {
-		r.logger.Error("Failed to update subscription by user ID", zap.Error(err), zap.String("user_id", userID))
+		r.logger.Error("Failed to delete log drain", zap.Error(err), zap.String("drain_id", drainID))
 		return err
 	}
+
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
 	return nil
 }
 
-// GetTrialSubscriptions retrieves all trial subscriptions that need processing
-// Used by cron job for trial lifecycle management
-func (r *SubscriptionRepo) GetTrialSubscriptions(ctx context.Context) ([]*Subscription, error) {
+// GetEnabledLogDrains retrieves the enabled drains of an app for the deploy worker to ship to
+func (r *LogDrainRepo) GetEnabledLogDrains(ctx context.Context, appID string) ([]services.LogDrain, error) {
 	rows, err := r.pool.Query(ctx,
-		`SELECT id, user_id, lemon_subscription_id, plan, status, trial_started_at, trial_ends_at, 
-		        ram_limit_mb, disk_limit_gb, created_at, updated_at
-		 FROM subscriptions
-		 WHERE status = 'trial'
-		 ORDER BY trial_ends_at ASC`,
+		`SELECT d.id, d.app_id, a.name, d.kind, d.url, COALESCE(d.token, ''), d.updated_at
+		 FROM app_log_drains d
+		 JOIN apps a ON a.id = d.app_id
+		 WHERE d.app_id = $1 AND d.enabled`,
+		appID,
 	)
 	if err != nil {
-		r.logger.Error("Failed to get trial subscriptions", zap.Error(err))
 		return nil, err
 	}
 	defer rows.Close()
 
-	var subscriptions []*Subscription
+	var drains []services.LogDrain
 	for rows.Next() {
-		var sub Subscription
-		var lemonSubID sql.NullString
-		var trialStartedAt, trialEndsAt sql.NullTime
-		
-		err := rows.Scan(
-			&sub.ID, &sub.UserID, &lemonSubID, &sub.Plan, &sub.Status,
-			&trialStartedAt, &trialEndsAt, &sub.RAMLimitMB, &sub.DiskLimitGB,
-			&sub.CreatedAt, &sub.UpdatedAt,
-		)
-		if err != nil {
-			r.logger.Error("Failed to scan subscription", zap.Error(err))
-			continue
+		var drain services.LogDrain
+		if err := rows.Scan(&drain.ID, &drain.AppID, &drain.AppName, &drain.Kind, &drain.URL, &drain.Token, &drain.UpdatedAt); err != nil {
+			return nil, err
 		}
-		
-		if lemonSubID.Valid {
-			sub.LemonSubscriptionID = &lemonSubID.String
+		drains = append(drains, drain)
+	}
+	return drains, rows.Err()
+}
+
+// RecordLogDrainHealth marks a drain healthy, or failing with deliveryErr, and adds dropped to its
+// dropped line count. The last error is kept once the drain recovers, to show what went wrong
+func (r *LogDrainRepo) RecordLogDrainHealth(ctx context.Context, drainID string, deliveryErr error, dropped int64) error {
+	var lastError *string
+	if deliveryErr != nil {
+		message := deliveryErr.Error()
+		if len(message) > 500 {
+			message = strings.ToValidUTF8(message[:500], "")
 		}
-		if trialStartedAt.Valid {
-			sub.TrialStartedAt = &trialStartedAt.Time
+		lastError = &message
+	}
+	_, err := r.pool.Exec(ctx,
+		`UPDATE app_log_drains
+		 SET status = CASE WHEN $2::text IS NULL THEN 'healthy' ELSE 'failing' END,
+		     last_error = COALESCE($2, last_error),
+		     last_error_at = CASE WHEN $2::text IS NULL THEN last_error_at ELSE NOW() END,
+		     last_delivered_at = CASE WHEN $2::text IS NULL THEN NOW() ELSE last_delivered_at END,
+		     dropped_lines = dropped_lines + $3
+		 WHERE id = $1`,
+		drainID, lastError, dropped,
+	)
+	return err
+}
+
+// AppTransfer is an offer to move an app to another user or organization
+// Exactly one of ToUserID and ToOrganizationID is set
+type AppTransfer struct {
+	ID                 string `json:"id"`
+	AppID              string `json:"app_id"`
+	AppName            string `json:"app_name"`
+	FromUserID         string `json:"from_user_id"`
+	FromOrganizationID string `json:"from_organization_id,omitempty"`
+	ToUserID           string `json:"to_user_id,omitempty"`
+	ToEmail            string `json:"to_email,omitempty"`
+	ToOrganizationID   string `json:"to_organization_id,omitempty"`
+	ToOrganizationName string `json:"to_organization_name,omitempty"`
+	RequestedBy        string `json:"requested_by,omitempty"`
+	Status             string `json:"status"` // pending, accepted, declined, cancelled
+	Expired            bool   `json:"expired"`
+	ExpiresAt          string `json:"expires_at"`
+	ResolvedAt         string `json:"resolved_at,omitempty"`
+	CreatedAt          string `json:"created_at"`
+}
+
+// AppFootprint is what an app brings to the plan of the account it is transferred to
+type AppFootprint struct {
+	RAMMB         int
+	Enabled       bool // Not disabled, so it counts against app and RAM limits
+	CustomDomains int
+	Workers       int // Enabled non-web processes
+}
+
+// AppTransferRepo handles app_transfers table operations
+type AppTransferRepo struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+	cache  *services.ReadCache // Optional - see SetCache
+}
+
+// NewAppTransferRepo creates a new app transfer repository
+func NewAppTransferRepo(pool *pgxpool.Pool, logger *zap.Logger) *AppTransferRepo {
+	return &AppTransferRepo{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// SetCache lets completed transfers drop the cached app lists of the old and new owners
+func (r *AppTransferRepo) SetCache(cache *services.ReadCache) {
+	r.cache = cache
+}
+
+// appTransferSelect selects transfers with the app, recipient email and organization names scanAppTransfer expects
+const appTransferSelect = `SELECT t.id, t.app_id, a.name, t.from_user_id, t.from_organization_id, t.to_user_id, u.email,
+        t.to_organization_id, o.name, t.requested_by, t.status, t.expires_at, t.resolved_at, t.created_at
+ FROM app_transfers t
+ JOIN apps a ON a.id = t.app_id
+ LEFT JOIN users u ON u.id = t.to_user_id
+ LEFT JOIN organizations o ON o.id = t.to_organization_id`
+
+// scanAppTransfer scans a row selected with appTransferSelect into an AppTransfer
+func scanAppTransfer(row pgx.Row) (*AppTransfer, error) {
+	var t AppTransfer
+	var fromOrgID, toUserID, toEmail, toOrgID, toOrgName, requestedBy sql.NullString
+	var expiresAt, createdAt time.Time
+	var resolvedAt sql.NullTime
+	if err := row.Scan(&t.ID, &t.AppID, &t.AppName, &t.FromUserID, &fromOrgID, &toUserID, &toEmail,
+		&toOrgID, &toOrgName, &requestedBy, &t.Status, &expiresAt, &resolvedAt, &createdAt); err != nil {
+		return nil, err
+	}
+	t.FromOrganizationID = fromOrgID.String
+	t.ToUserID = toUserID.String
+	t.ToEmail = toEmail.String
+	t.ToOrganizationID = toOrgID.String
+	t.ToOrganizationName = toOrgName.String
+	t.RequestedBy = requestedBy.String
+	t.ExpiresAt = expiresAt.Format(time.RFC3339)
+	if resolvedAt.Valid {
+		t.ResolvedAt = resolvedAt.Time.Format(time.RFC3339)
+	}
+	t.CreatedAt = createdAt.Format(time.RFC3339)
+	t.Expired = t.Status == "pending" && time.Now().After(expiresAt)
+	return &t, nil
+}
+
+// CreateAppTransfer offers app to a user (toUserID) or an organization (toOrganizationID)
+// Fails with a unique violation when the app already has a pending transfer
+func (r *AppTransferRepo) CreateAppTransfer(ctx context.Context, app *App, toUserID, toOrganizationID, requestedBy string, expiresAt time.Time) (*AppTransfer, error) {
+	var id string
+	err := r.pool.QueryRow(ctx,
+		`INSERT INTO app_transfers (app_id, from_user_id, from_organization_id, to_user_id, to_organization_id, requested_by, expires_at)
+		 VALUES ($1, $2, NULLIF($3, '')::uuid, NULLIF($4, '')::uuid, NULLIF($5, '')::uuid, $6, $7)
+		 RETURNING id`,
+		app.ID, app.UserID, app.OrganizationID, toUserID, toOrganizationID, requestedBy, expiresAt,
+	).Scan(&id)
+	if err != nil {
+		r.logger.Error("Failed to create app transfer", zap.Error(err), zap.String("app_id", app.ID))
+		return nil, err
+	}
+	return r.GetAppTransfer(ctx, id)
+}
+
+// GetAppTransfer retrieves a transfer by ID
+func (r *AppTransferRepo) GetAppTransfer(ctx context.Context, transferID string) (*AppTransfer, error) {
+	t, err := scanAppTransfer(r.pool.QueryRow(ctx, appTransferSelect+` WHERE t.id = $1`, transferID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
 		}
-		if trialEndsAt.Valid {
-			sub.TrialEndsAt = &trialEndsAt.Time
+		r.logger.Error("Failed to get app transfer", zap.Error(err), zap.String("transfer_id", transferID))
+		return nil, err
+	}
+	return t, nil
+}
+
+// GetPendingAppTransfer retrieves the open transfer of an app
+func (r *AppTransferRepo) GetPendingAppTransfer(ctx context.Context, appID string) (*AppTransfer, error) {
+	t, err := scanAppTransfer(r.pool.QueryRow(ctx, appTransferSelect+` WHERE t.app_id = $1 AND t.status = 'pending'`, appID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
 		}
-		
-		subscriptions = append(subscriptions, &sub)
+		r.logger.Error("Failed to get pending app transfer", zap.Error(err), zap.String("app_id", appID))
+		return nil, err
+	}
+	return t, nil
+}
+
+// ListIncomingAppTransfers lists the pending transfers the user can accept: those to the user and those
+// to organizations the user is an admin or owner of, newest first
+func (r *AppTransferRepo) ListIncomingAppTransfers(ctx context.Context, userID string) ([]*AppTransfer, error) {
+	rows, err := r.pool.Query(ctx,
+		appTransferSelect+`
+		 WHERE t.status = 'pending'
+		   AND (t.to_user_id = $1 OR t.to_organization_id IN (
+		       SELECT organization_id FROM organization_members WHERE user_id = $1 AND role IN ('admin', 'owner')))
+		 ORDER BY t.created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to list incoming app transfers", zap.Error(err), zap.String("user_id", userID))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []*AppTransfer
+	for rows.Next() {
+		t, err := scanAppTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, t)
+	}
+	return transfers, rows.Err()
+}
+
+// ResolveAppTransfer closes a pending transfer without moving the app (status declined or cancelled)
+// Returns pgx.ErrNoRows when the transfer is no longer pending
+func (r *AppTransferRepo) ResolveAppTransfer(ctx context.Context, transferID, status, userID string) error {
+	result, err := r.pool.Exec(ctx,
+		`UPDATE app_transfers SET status = $2, resolved_by = $3, resolved_at = NOW()
+		 WHERE id = $1 AND status = 'pending'`,
+		transferID, status, userID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to resolve app transfer", zap.Error(err), zap.String("transfer_id", transferID))
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// CompleteAppTransfer moves the app to ownerID (and organizationID, empty for a personal app) and marks the
+// transfer accepted in one transaction. Everything else about the app is keyed by its ID and moves with it
+// Returns pgx.ErrNoRows when the transfer is no longer pending or the app changed hands since it was offered
+func (r *AppTransferRepo) CompleteAppTransfer(ctx context.Context, t *AppTransfer, ownerID, organizationID, acceptedBy string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("Failed to begin transaction for app transfer", zap.Error(err))
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && err != pgx.ErrTxClosed {
+			r.logger.Warn("Transaction rollback error (may be expected if commit succeeded)", zap.Error(err))
+		}
+	}()
+
+	result, err := tx.Exec(ctx,
+		`UPDATE app_transfers SET status = 'accepted', resolved_by = $2, resolved_at = NOW()
+		 WHERE id = $1 AND status = 'pending'`,
+		t.ID, acceptedBy,
+	)
+	if err != nil {
+		r.logger.Error("Failed to mark app transfer accepted", zap.Error(err), zap.String("transfer_id", t.ID))
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows // Resolved concurrently
+	}
+
+	result, err = tx.Exec(ctx,
+		`UPDATE apps SET user_id = $2, organization_id = NULLIF($3, '')::uuid, updated_at = NOW()
+		 WHERE id = $1 AND user_id = $4 AND organization_id IS NOT DISTINCT FROM NULLIF($5, '')::uuid`,
+		t.AppID, ownerID, organizationID, t.FromUserID, t.FromOrganizationID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to move app", zap.Error(err), zap.String("app_id", t.AppID), zap.String("transfer_id", t.ID))
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
 	}
 
-	if err := rows.Err(); err != nil {
-		r.logger.Error("Error iterating subscriptions", zap.Error(err))
+	if err := tx.Commit(ctx); err != nil {
+		r.logger.Error("Failed to commit app transfer", zap.Error(err), zap.String("transfer_id", t.ID))
+		return err
+	}
+	r.cache.Invalidate(ctx, appsCacheKey(t.FromUserID), appsCacheKey(ownerID))
+	return nil
+}
+
+// GetAppFootprint returns the resources and plan features an app uses
+func (r *AppTransferRepo) GetAppFootprint(ctx context.Context, appID string) (*AppFootprint, error) {
+	var fp AppFootprint
+	err := r.pool.QueryRow(ctx,
+		`SELECT a.ram_mb, a.status <> 'disabled',
+		        (SELECT COUNT(*) FROM app_domains d WHERE d.app_id = a.id),
+		        (SELECT COUNT(*) FROM app_processes p WHERE p.app_id = a.id AND p.enabled)
+		 FROM apps a WHERE a.id = $1`,
+		appID,
+	).Scan(&fp.RAMMB, &fp.Enabled, &fp.CustomDomains, &fp.Workers)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get app footprint", zap.Error(err), zap.String("app_id", appID))
 		return nil, err
 	}
+	return &fp, nil
+}
 
-	return subscriptions, nil
+// hostOfflineAfter is how long a host can go without its deploy worker reporting before it is shown offline
+// (deploy workers report every 30 seconds)
+const hostOfflineAfter = "2 minutes"
+
+// Host is a Docker host running app containers, as last reported by its deploy worker
+type Host struct {
+	Name                string   `json:"name"` // NODE_NAME of its deploy worker, as recorded on deployments
+	Region              string   `json:"region,omitempty"`
+	Online              bool     `json:"online"` // Its deploy worker reported in the last two minutes
+	DockerVersion       string   `json:"docker_version"`
+	OperatingSystem     string   `json:"operating_system"`
+	CPUs                int      `json:"cpus"`
+	CPUsReserved        float64  `json:"cpus_reserved"` // CPU limits of the app containers running on it
+	MemoryBytes         int64    `json:"memory_bytes"`
+	MemoryReservedBytes int64    `json:"memory_reserved_bytes"` // Memory limits of the app containers running on it
+	DiskTotalBytes      *int64   `json:"disk_total_bytes,omitempty"` // Docker data root; missing when the worker cannot see it
+	DiskUsedBytes       *int64   `json:"disk_used_bytes,omitempty"`
+	DiskUsedPercent     *float64 `json:"disk_used_percent,omitempty"`
+	Containers          int      `json:"containers"`
+	ContainersRunning   int      `json:"containers_running"`
+	AppContainers       int      `json:"app_containers"`
+	RunningDeployments  int      `json:"running_deployments"`
+	Images              int      `json:"images"`
+	ImagesBytes         int64    `json:"images_bytes"`
+	Draining            bool     `json:"draining"` // Its deploy workers take no new deploys
+	DrainReason         string   `json:"drain_reason,omitempty"`
+	DrainedAt           string   `json:"drained_at,omitempty"`
+	ReportedAt          string   `json:"reported_at"`
+	Address             string   `json:"address,omitempty"`         // Where other hosts forward requests for the apps placed here
+	DockerEndpoint      string   `json:"docker_endpoint,omitempty"` // Where other hosts copy images built here from
 }
 
-// UserPlanRepo implements user plan repository for getting plan_id from users table
-type UserPlanRepo struct {
+// HostRepo handles hosts table operations
+type HostRepo struct {
 	pool   *pgxpool.Pool
 	logger *zap.Logger
 }
 
-// NewUserPlanRepo creates a new user plan repository
-func NewUserPlanRepo(pool *pgxpool.Pool, logger *zap.Logger) *UserPlanRepo {
-	return &UserPlanRepo{
+// NewHostRepo creates a new host repository
+func NewHostRepo(pool *pgxpool.Pool, logger *zap.Logger) *HostRepo {
+	return &HostRepo{
 		pool:   pool,
 		logger: logger,
 	}
 }
 
-// GetUserPlanID retrieves the plan_id for a user
-func (r *UserPlanRepo) GetUserPlanID(ctx context.Context, userID string) (string, error) {
-	var planID sql.NullString
-	err := r.pool.QueryRow(ctx,
-		"SELECT plan_id FROM users WHERE id = $1",
-		userID,
-	).Scan(&planID)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return "", pgx.ErrNoRows
-		}
-		r.logger.Error("Failed to get user plan_id", zap.Error(err), zap.String("user_id", userID))
-		return "", err
+// hostColumns is the column list shared by host queries (h is hosts)
+const hostColumns = `h.name, COALESCE(h.region, ''), h.reported_at > NOW() - INTERVAL '` + hostOfflineAfter + `',
+	COALESCE(h.docker_version, ''), COALESCE(h.operating_system, ''), h.cpus, h.cpus_reserved, h.memory_bytes,
+	h.memory_reserved_bytes, h.disk_total_bytes, h.disk_used_bytes, h.containers, h.containers_running,
+	h.app_containers, (SELECT COUNT(*) FROM deployments d WHERE d.node = h.name AND d.status = 'running'),
+	h.images, h.images_bytes, h.draining, COALESCE(h.drain_reason, ''), h.drained_at, h.reported_at,
+	COALESCE(h.address, ''), COALESCE(h.docker_endpoint, '')`
+
+// scanHost scans a row selected with hostColumns into a Host
+func scanHost(row pgx.Row) (*Host, error) {
+	var host Host
+	var drainedAt *time.Time
+	var reportedAt time.Time
+	if err := row.Scan(&host.Name, &host.Region, &host.Online, &host.DockerVersion, &host.OperatingSystem,
+		&host.CPUs, &host.CPUsReserved, &host.MemoryBytes, &host.MemoryReservedBytes, &host.DiskTotalBytes,
+		&host.DiskUsedBytes, &host.Containers, &host.ContainersRunning, &host.AppContainers, &host.RunningDeployments,
+		&host.Images, &host.ImagesBytes, &host.Draining, &host.DrainReason, &drainedAt, &reportedAt,
+		&host.Address, &host.DockerEndpoint); err != nil {
+		return nil, err
 	}
-	if !planID.Valid {
-		return "", nil // No plan assigned
+	if host.DiskTotalBytes != nil && host.DiskUsedBytes != nil && *host.DiskTotalBytes > 0 {
+		percent := math.Round(float64(*host.DiskUsedBytes)/float64(*host.DiskTotalBytes)*1000) / 10
+		host.DiskUsedPercent = &percent
 	}
-	return planID.String, nil
+	if drainedAt != nil {
+		host.DrainedAt = drainedAt.Format(time.RFC3339)
+	}
+	host.ReportedAt = reportedAt.Format(time.RFC3339)
+	return &host, nil
 }
 
-// UpdateUserPlanID updates a user's plan_id
-func (r *UserPlanRepo) UpdateUserPlanID(ctx context.Context, userID, planID string) error {
-	var planIDPtr interface{}
-	if planID != "" {
-		planIDPtr = planID
-	} else {
-		planIDPtr = nil
-	}
-	_, err := r.pool.Exec(ctx,
-		"UPDATE users SET plan_id = $1, updated_at = NOW() WHERE id = $2",
-		planIDPtr, userID,
-	)
+// ListHosts returns every host a deploy worker has reported, by name
+func (r *HostRepo) ListHosts(ctx context.Context) ([]Host, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+hostColumns+` FROM hosts h ORDER BY h.name`)
 	if err != nil {
-		r.logger.Error("Failed to update user plan_id", zap.Error(err), zap.String("user_id", userID), zap.String("plan_id", planID))
-		return err
+		r.logger.Error("Failed to list hosts", zap.Error(err))
+		return nil, err
 	}
-	return nil
+	defer rows.Close()
+
+	hosts := []Host{}
+	for rows.Next() {
+		host, err := scanHost(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan host", zap.Error(err))
+			return nil, err
+		}
+		hosts = append(hosts, *host)
+	}
+	return hosts, rows.Err()
 }
 
-// EnvVarRepo implements environment variables repository using database
-type EnvVarRepo struct {
-	pool   *pgxpool.Pool
-	logger *zap.Logger
+// SetHostDraining drains a host (its deploy workers stop taking new deploys) or returns it to service
+// Returns pgx.ErrNoRows if no deploy worker has reported the host
+func (r *HostRepo) SetHostDraining(ctx context.Context, name string, draining bool, reason, adminID string) (*Host, error) {
+	host, err := scanHost(r.pool.QueryRow(ctx,
+		`WITH updated AS (
+		     UPDATE hosts
+		     SET draining = $2,
+		         drain_reason = CASE WHEN $2 THEN NULLIF($3, '') END,
+		         drained_at = CASE WHEN $2 THEN COALESCE(CASE WHEN draining THEN drained_at END, NOW()) END,
+		         drained_by = CASE WHEN $2 THEN NULLIF($4, '')::uuid END
+		     WHERE name = $1
+		     RETURNING *
+		 )
+		 SELECT `+hostColumns+` FROM updated h`,
+		name, draining, reason, adminID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to update host draining", zap.Error(err), zap.String("host", name))
+		return nil, err
+	}
+	return host, nil
 }
 
-// NewEnvVarRepo creates a new environment variables repository
-func NewEnvVarRepo(pool *pgxpool.Pool, logger *zap.Logger) *EnvVarRepo {
-	return &EnvVarRepo{
-		pool:   pool,
-		logger: logger,
+// IsHostDraining reports whether an admin drained the host; hosts that never reported are not
+func (r *HostRepo) IsHostDraining(ctx context.Context, name string) (bool, error) {
+	var draining bool
+	err := r.pool.QueryRow(ctx, `SELECT draining FROM hosts WHERE name = $1`, name).Scan(&draining)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		r.logger.Error("Failed to check host draining", zap.Error(err), zap.String("host", name))
+		return false, err
 	}
+	return draining, nil
 }
 
-// GetEnvVarsByAppID retrieves all environment variables for an app
-func (r *EnvVarRepo) GetEnvVarsByAppID(ctx context.Context, appID string) ([]*EnvVar, error) {
+// hostDiskFullPercent is the disk use above which a host takes no new deploys
+const hostDiskFullPercent = 90
+
+// ScheduleDeploy picks the host a deploy of the app goes to: of the online, undrained hosts with ramMB of
+// memory and diskMB of disk free (the app's plan limits), the one the app runs on now, or else the one with
+// the most free memory. Memory the app's own containers reserve counts as free on the host they run on,
+// since the deploy replaces them
+// Returns "" while at most one host has reported (every deploy worker serves the shared queues), or when
+// no host has room - the deploy is then left to whichever deploy worker picks it up
+func (r *HostRepo) ScheduleDeploy(ctx context.Context, appID string, ramMB, diskMB int) (string, error) {
 	rows, err := r.pool.Query(ctx,
-		`SELECT id, app_id, key, value, created_at, updated_at 
-		 FROM env_vars 
-		 WHERE app_id = $1 
-		 ORDER BY created_at DESC`,
+		`WITH current AS (
+		     SELECT node FROM deployments
+		     WHERE app_id = $1 AND status = 'running' AND node IS NOT NULL
+		     ORDER BY created_at DESC
+		     LIMIT 1
+		 )
+		 SELECT h.name, h.name = (SELECT node FROM current), h.memory_bytes - h.memory_reserved_bytes,
+		        h.disk_total_bytes, h.disk_used_bytes,
+		        h.reported_at > NOW() - INTERVAL '`+hostOfflineAfter+`' AND NOT h.draining
+		 FROM hosts h`,
 		appID,
 	)
 	if err != nil {
-		r.logger.Error("Failed to get env vars", zap.Error(err), zap.String("app_id", appID))
-		return nil, err
+		r.logger.Error("Failed to list hosts to schedule on", zap.Error(err), zap.String("app_id", appID))
+		return "", err
 	}
 	defer rows.Close()
 
-	var envVars []*EnvVar
+	ramBytes := int64(ramMB) * 1024 * 1024
+	diskBytes := int64(diskMB) * 1024 * 1024
+	var hosts int
+	var best string
+	var bestFree int64
+	bestCurrent := false
 	for rows.Next() {
-		var envVar EnvVar
-		var createdAt, updatedAt time.Time
-		err := rows.Scan(
-			&envVar.ID,
-			&envVar.AppID,
-			&envVar.Key,
-			&envVar.Value,
-			&createdAt,
-			&updatedAt,
-		)
-		if err != nil {
-			r.logger.Error("Failed to scan env var", zap.Error(err))
+		var name string
+		var current, available bool
+		var freeMemory int64
+		var diskTotal, diskUsed *int64
+		if err := rows.Scan(&name, &current, &freeMemory, &diskTotal, &diskUsed, &available); err != nil {
+			r.logger.Error("Failed to scan host to schedule on", zap.Error(err))
+			return "", err
+		}
+		hosts++
+		if !available {
 			continue
 		}
-		envVar.CreatedAt = createdAt.Format(time.RFC3339)
-		envVar.UpdatedAt = updatedAt.Format(time.RFC3339)
-		envVars = append(envVars, &envVar)
+		if current {
+			freeMemory += ramBytes
+		}
+		if freeMemory < ramBytes {
+			continue
+		}
+		// Hosts whose worker cannot see the Docker data root are placed on memory alone
+		if diskTotal != nil && diskUsed != nil && *diskTotal > 0 {
+			if *diskTotal-*diskUsed < diskBytes || *diskUsed*100 >= *diskTotal*hostDiskFullPercent {
+				continue
+			}
+		}
+		if bestCurrent {
+			continue
+		}
+		if current || best == "" || freeMemory > bestFree {
+			best, bestFree, bestCurrent = name, freeMemory, current
+		}
 	}
-
 	if err := rows.Err(); err != nil {
-		r.logger.Error("Error iterating env vars", zap.Error(err))
-		return nil, err
+		return "", err
 	}
 
-	return envVars, nil
+	if hosts <= 1 {
+		return "", nil
+	}
+	if best == "" {
+		r.logger.Warn("No host has room for the deploy, leaving it to any deploy worker",
+			zap.String("app_id", appID),
+			zap.Int("ram_mb", ramMB),
+			zap.Int("disk_mb", diskMB),
+		)
+	}
+	return best, nil
 }
 
-// CreateEnvVar creates a new environment variable
-func (r *EnvVarRepo) CreateEnvVar(ctx context.Context, appID, key, value string) (*EnvVar, error) {
-	var envVar EnvVar
-	var createdAt, updatedAt time.Time
-	
+// AppHost returns the host the app's latest running deployment is on, or "" while at most one host has
+// reported (every deploy worker serves the shared queues) or the app runs nowhere
+func (r *HostRepo) AppHost(ctx context.Context, appID string) (string, error) {
+	var multiHost bool
+	var node *string
 	err := r.pool.QueryRow(ctx,
-		`INSERT INTO env_vars (app_id, key, value) 
-		 VALUES ($1, $2, $3) 
-		 ON CONFLICT (app_id, key) 
-		 DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()
-		 RETURNING id, app_id, key, value, created_at, updated_at`,
-		appID, key, value,
-	).Scan(
-		&envVar.ID,
-		&envVar.AppID,
-		&envVar.Key,
-		&envVar.Value,
-		&createdAt,
-		&updatedAt,
-	)
+		`SELECT (SELECT COUNT(*) FROM hosts) > 1,
+		        (SELECT node FROM deployments
+		         WHERE app_id = $1 AND status IN ('running', 'error') AND node IS NOT NULL
+		         ORDER BY created_at DESC
+		         LIMIT 1)`,
+		appID,
+	).Scan(&multiHost, &node)
 	if err != nil {
-		r.logger.Error("Failed to create env var", zap.Error(err), zap.String("app_id", appID), zap.String("key", key))
-		return nil, err
+		r.logger.Error("Failed to get app host", zap.Error(err), zap.String("app_id", appID))
+		return "", err
 	}
-	
-	envVar.CreatedAt = createdAt.Format(time.RFC3339)
-	envVar.UpdatedAt = updatedAt.Format(time.RFC3339)
-	return &envVar, nil
+	if !multiHost || node == nil {
+		return "", nil
+	}
+	return *node, nil
 }
 
-// DeleteEnvVar deletes an environment variable by app ID and key
-func (r *EnvVarRepo) DeleteEnvVar(ctx context.Context, appID, key string) error {
-	result, err := r.pool.Exec(ctx,
-		"DELETE FROM env_vars WHERE app_id = $1 AND key = $2",
-		appID, key,
+// HostDockerEndpoint returns the Docker endpoint a host advertised ("" when it advertised none)
+// Returns pgx.ErrNoRows if no deploy worker has reported the host
+func (r *HostRepo) HostDockerEndpoint(ctx context.Context, name string) (string, error) {
+	var endpoint string
+	err := r.pool.QueryRow(ctx, `SELECT COALESCE(docker_endpoint, '') FROM hosts WHERE name = $1`, name).Scan(&endpoint)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", pgx.ErrNoRows
+		}
+		r.logger.Error("Failed to get host Docker endpoint", zap.Error(err), zap.String("host", name))
+		return "", err
+	}
+	return endpoint, nil
+}
+
+// ImageHost returns the host that last ran the image for the app ("" when it never ran), where a redeploy
+// of an earlier build can copy it from
+func (r *HostRepo) ImageHost(ctx context.Context, appID, imageName string) (string, error) {
+	var node string
+	err := r.pool.QueryRow(ctx,
+		`SELECT node FROM deployments
+		 WHERE app_id = $1 AND image_name = $2 AND node IS NOT NULL
+		 ORDER BY created_at DESC
+		 LIMIT 1`,
+		appID, imageName,
+	).Scan(&node)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		r.logger.Error("Failed to get image host", zap.Error(err), zap.String("app_id", appID))
+		return "", err
+	}
+	return node, nil
+}
+
+// RemoteAppRoutes returns the apps running on hosts other than node, with the address of their host
+// Apps on hosts that advertise no address are left out - other hosts cannot forward to them
+func (r *HostRepo) RemoteAppRoutes(ctx context.Context, node string) ([]services.RemoteAppRoute, error) {
+	rows, err := r.pool.Query(ctx,
+		`WITH latest AS (
+		     SELECT DISTINCT ON (app_id) app_id, subdomain, node
+		     FROM deployments
+		     WHERE status = 'running' AND node IS NOT NULL
+		     ORDER BY app_id, created_at DESC
+		 )
+		 SELECT l.app_id, COALESCE(l.subdomain, ''), l.node, h.address,
+		        COALESCE((SELECT array_agg(ad.domain ORDER BY ad.created_at) FROM app_domains ad
+		                  WHERE ad.app_id = l.app_id AND ad.status = 'verified'), '{}')
+		 FROM latest l
+		 JOIN hosts h ON h.name = l.node
+		 WHERE l.node <> $1 AND h.address IS NOT NULL
+		 ORDER BY l.app_id`,
+		node,
 	)
 	if err != nil {
-		r.logger.Error("Failed to delete env var", zap.Error(err), zap.String("app_id", appID), zap.String("key", key))
-		return err
+		r.logger.Error("Failed to list remote app routes", zap.Error(err), zap.String("node", node))
+		return nil, err
 	}
-	
-	if result.RowsAffected() == 0 {
-		return pgx.ErrNoRows
+	defer rows.Close()
+
+	routes := []services.RemoteAppRoute{}
+	for rows.Next() {
+		var route services.RemoteAppRoute
+		if err := rows.Scan(&route.AppID, &route.Subdomain, &route.Host, &route.Address, &route.CustomDomains); err != nil {
+			r.logger.Error("Failed to scan remote app route", zap.Error(err))
+			return nil, err
+		}
+		routes = append(routes, route)
 	}
-	
-	return nil
+	return routes, rows.Err()
 }
 
-// BuildJobRepo handles build_jobs table operations
-type BuildJobRepo struct {
+// ImageScanRepo handles image_scans table operations (implements tasks.ImageScanRepository)
+type ImageScanRepo struct {
 	pool   *pgxpool.Pool
 	logger *zap.Logger
 }
 
-// NewBuildJobRepo creates a new BuildJob repository
-func NewBuildJobRepo(pool *pgxpool.Pool, logger *zap.Logger) *BuildJobRepo {
-	return &BuildJobRepo{
+// NewImageScanRepo creates a new image scan repository
+func NewImageScanRepo(pool *pgxpool.Pool, logger *zap.Logger) *ImageScanRepo {
+	return &ImageScanRepo{
 		pool:   pool,
 		logger: logger,
 	}
 }
 
-// CreateBuildJob creates a new build_job record in the database
-// This ensures the build_job_id exists when CreateDeployment is called
-func (r *BuildJobRepo) CreateBuildJob(ctx context.Context, buildJobID, appID, status string) error {
-	_, err := r.pool.Exec(ctx,
-		`INSERT INTO build_jobs (id, app_id, status)
-		 VALUES ($1, $2, $3)
-		 ON CONFLICT (id) DO NOTHING`,
-		buildJobID, appID, status,
+// SaveImageScan records the vulnerability scan of a build's image, replacing an earlier scan of it
+func (r *ImageScanRepo) SaveImageScan(ctx context.Context, scan services.ImageScan) error {
+	vulnerabilities := scan.Vulnerabilities
+	if vulnerabilities == nil {
+		vulnerabilities = []services.Vulnerability{}
+	}
+	findings, err := json.Marshal(vulnerabilities)
+	if err != nil {
+		return fmt.Errorf("failed to marshal vulnerabilities: %w", err)
+	}
+
+	_, err = r.pool.Exec(ctx,
+		`INSERT INTO image_scans (build_job_id, app_id, image_name, scanner, status,
+		                          critical_count, high_count, medium_count, low_count, unknown_count,
+		                          vulnerabilities, error_message, scanned_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''), $13)
+		 ON CONFLICT (build_job_id) DO UPDATE SET
+		   image_name = EXCLUDED.image_name,
+		   scanner = EXCLUDED.scanner,
+		   status = EXCLUDED.status,
+		   critical_count = EXCLUDED.critical_count,
+		   high_count = EXCLUDED.high_count,
+		   medium_count = EXCLUDED.medium_count,
+		   low_count = EXCLUDED.low_count,
+		   unknown_count = EXCLUDED.unknown_count,
+		   vulnerabilities = EXCLUDED.vulnerabilities,
+		   error_message = EXCLUDED.error_message,
+		   scanned_at = EXCLUDED.scanned_at`,
+		scan.BuildJobID, scan.AppID, scan.ImageName, scan.Scanner, scan.Status,
+		scan.Counts.Critical, scan.Counts.High, scan.Counts.Medium, scan.Counts.Low, scan.Counts.Unknown,
+		findings, scan.Error, scan.ScannedAt,
 	)
 	if err != nil {
-		r.logger.Error("Failed to create build_job",
-			zap.Error(err),
-			zap.String("build_job_id", buildJobID),
-			zap.String("app_id", appID),
-			zap.String("status", status),
-		)
+		r.logger.Error("Failed to save image scan", zap.Error(err), zap.String("build_job_id", scan.BuildJobID))
 		return err
 	}
-	
-	r.logger.Info("Build job created in database",
-		zap.String("build_job_id", buildJobID),
-		zap.String("app_id", appID),
-		zap.String("status", status),
-	)
 	return nil
 }
 
-// UpdateBuildJob updates a build_job record
-func (r *BuildJobRepo) UpdateBuildJob(ctx context.Context, buildJobID, status, buildLog, errorMsg string) error {
-	// Sanitize error message to remove NULL bytes
-	if errorMsg != "" {
-		errorMsg = strings.ReplaceAll(errorMsg, "\x00", "")
-	}
-	
-	_, err := r.pool.Exec(ctx,
-		`UPDATE build_jobs 
-		 SET status = COALESCE(NULLIF($2, ''), status),
-		     build_log = COALESCE(NULLIF($3, ''), build_log),
-		     error_message = COALESCE(NULLIF($4, ''), error_message),
-		     updated_at = NOW()
-		 WHERE id = $1`,
-		buildJobID, status, buildLog, errorMsg,
-	)
+// GetImageScan returns the vulnerability scan of a build's image, or nil when it was not scanned
+func (r *ImageScanRepo) GetImageScan(ctx context.Context, buildJobID string) (*services.ImageScan, error) {
+	var scan services.ImageScan
+	var findings []byte
+	var errorMessage sql.NullString
+	err := r.pool.QueryRow(ctx,
+		`SELECT build_job_id, app_id, image_name, scanner, status,
+		        critical_count, high_count, medium_count, low_count, unknown_count,
+		        vulnerabilities, error_message, scanned_at
+		 FROM image_scans WHERE build_job_id = $1`,
+		buildJobID,
+	).Scan(&scan.BuildJobID, &scan.AppID, &scan.ImageName, &scan.Scanner, &scan.Status,
+		&scan.Counts.Critical, &scan.Counts.High, &scan.Counts.Medium, &scan.Counts.Low, &scan.Counts.Unknown,
+		&findings, &errorMessage, &scan.ScannedAt)
 	if err != nil {
-		r.logger.Error("Failed to update build_job",
-			zap.Error(err),
-			zap.String("build_job_id", buildJobID),
-		)
-		return err
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get image scan", zap.Error(err), zap.String("build_job_id", buildJobID))
+		return nil, err
 	}
-	return nil
+	if err := json.Unmarshal(findings, &scan.Vulnerabilities); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal vulnerabilities: %w", err)
+	}
+	scan.Error = errorMessage.String
+	return &scan, nil
 }
 
+// BlocksCriticalVulnerabilities reports whether the organization of an app refuses to deploy images with
+// critical vulnerabilities. Apps outside an organization have no such policy
+func (r *ImageScanRepo) BlocksCriticalVulnerabilities(ctx context.Context, appID string) (bool, error) {
+	var blocks bool
+	err := r.pool.QueryRow(ctx,
+		`SELECT COALESCE(o.block_critical_vulnerabilities, FALSE)
+		 FROM apps a
+		 LEFT JOIN organizations o ON o.id = a.organization_id
+		 WHERE a.id = $1`,
+		appID,
+	).Scan(&blocks)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return blocks, nil
+}
@@ -12,8 +12,11 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"stackyn/server/internal/infra"
+	"stackyn/server/internal/metrics"
 	"stackyn/server/internal/services"
 	"stackyn/server/internal/workers"
 )
@@ -86,6 +89,14 @@ func (a *logPersistenceAdapter) GetLatestBuildLogs(ctx context.Context, appID st
 	return a.service.GetLatestBuildLogs(ctx, appID)
 }
 
+func (a *logPersistenceAdapter) OpenBuildLog(ctx context.Context, appID string, buildJobID string) (io.ReadCloser, error) {
+	return a.service.OpenBuildLog(ctx, appID, buildJobID)
+}
+
+func (a *logPersistenceAdapter) OpenRuntimeLog(ctx context.Context, appID string, containerID string) (*services.RuntimeLogReader, error) {
+	return a.service.OpenRuntimeLog(ctx, appID, containerID)
+}
+
 func (a *logPersistenceAdapter) DeleteOldLogs(ctx context.Context, appID string, before time.Time) error {
 	return a.service.DeleteOldLogs(ctx, appID, before)
 }
@@ -114,40 +125,54 @@ func (w *subscriptionRepoInterfaceWrapper) GetSubscriptionByUserID(ctx context.C
 	return w.repo.GetSubscriptionByUserID(ctx, userID)
 }
 
+// ConfigurePlanEnforcement wires the plan, subscription and user plan repositories into a plan enforcement service
+// Without repositories the service falls back to hardcoded free plan limits
+func ConfigurePlanEnforcement(planEnforcement *services.PlanEnforcementService, planRepo *PlanRepo, subscriptionRepo *SubscriptionRepo, userPlanRepo *UserPlanRepo, logger *zap.Logger) {
+	// Use type assertion wrappers to match adapter interface
+	planRepoAdapter := services.NewPlanRepoAdapter(&planRepoInterfaceWrapper{repo: planRepo}, logger)
+	subRepoAdapter := services.NewSubscriptionRepoAdapter(&subscriptionRepoInterfaceWrapper{repo: subscriptionRepo}, logger)
+	planEnforcement.SetRepositories(planRepoAdapter, subRepoAdapter, userPlanRepo)
+}
+
+// allowedOrigins are the frontend origins allowed to call the API from a browser, besides *.stackyn.com
+var allowedOrigins = []string{
+	"https://stackyn.com",
+	"https://console.stackyn.com",
+	"http://localhost:3000",
+	"http://localhost:3001",
+	"http://localhost:5173",
+}
+
+// isAllowedOrigin reports whether a browser page on origin may call the API (CORS) or open its WebSockets
+// Any stackyn.com subdomain is allowed, to support staging subdomains
+func isAllowedOrigin(origin string) bool {
+	for _, allowed := range allowedOrigins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return strings.HasSuffix(origin, ".stackyn.com")
+}
+
+// isDevelopmentEnv reports whether ENV names a local environment, where /metrics may be scraped without a token
+func isDevelopmentEnv(env string) bool {
+	return env == "development" || env == "test"
+}
+
 // Router sets up the HTTP router with all routes and middleware
-func Router(logger *zap.Logger, config *infra.Config, pool *pgxpool.Pool) http.Handler {
+// redisClient is shared by the services that keep state in Redis; without it (nil) they fall back or are off
+func Router(logger *zap.Logger, config *infra.Config, pool *pgxpool.Pool, redisClient *redis.Client) http.Handler {
 	r := chi.NewRouter()
 
 	// CORS middleware - allow frontend origins
 	// Use AllowOriginFunc to support staging subdomains dynamically
 	r.Use(cors.Handler(cors.Options{
 		AllowOriginFunc: func(r *http.Request, origin string) bool {
-			// Allow specific origins
-			allowedOrigins := []string{
-				"https://stackyn.com",
-				"https://console.stackyn.com",
-				"http://localhost:3000",
-				"http://localhost:3001",
-				"http://localhost:5173",
-			}
-			
-			// Check exact matches first
-			for _, allowed := range allowedOrigins {
-				if origin == allowed {
-					return true
-				}
-			}
-			
-			// Allow any stackyn.com subdomain
-			if strings.HasSuffix(origin, ".stackyn.com") || origin == "https://stackyn.com" {
-				return true
-			}
-			
-			return false
+			return isAllowedOrigin(origin)
 		},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Requested-With"},
-		ExposedHeaders:   []string{"Link", "Content-Length"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Requested-With", idempotencyKeyHeader},
+		ExposedHeaders:   []string{"Link", "Content-Length", ImpersonationHeader, requestIDHeader, idempotentReplayedHeader},
 		AllowCredentials: true, // Allow credentials for JWT tokens
 		MaxAge:           300,
 		Debug:            false,
@@ -155,10 +180,17 @@ func Router(logger *zap.Logger, config *infra.Config, pool *pgxpool.Pool) http.H
 
 	// Middleware
 	r.Use(middleware.RequestID)
+	r.Use(RequestIDHeader) // Error responses quote the request ID
+	r.Use(PeerAddrMiddleware) // Must run before RealIP (header auth trusts the real TCP peer only)
 	r.Use(middleware.RealIP)
 	r.Use(loggingMiddleware(logger))
+	r.Use(metricsMiddleware)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(70 * time.Second)) // Slightly less than HTTP server timeout (75s)
+	r.Use(MaxBodyBytes(int64(config.Server.MaxBodyKB) << 10))
+	r.Use(WebSocketAuthMiddleware)
+	r.NotFound(notFoundHandler)
+	r.MethodNotAllowed(methodNotAllowedHandler)
 
 	// Initialize log persistence service
 	// Use /app/logs to match the volume mount in docker-compose (shared with deploy-worker)
@@ -185,6 +217,22 @@ func Router(logger *zap.Logger, config *infra.Config, pool *pgxpool.Pool) http.H
 	
 	// Initialize plan enforcement service
 	planEnforcement := services.NewPlanEnforcementService(logger)
+
+	// Share the concurrent build and RAM counters with the API and the other workers through Redis
+	if redisClient != nil {
+		planEnforcement.SetCounters(services.NewRedisPlanCounters(redisClient))
+	} else {
+		logger.Warn("Plan counters are not shared - falling back to per-process counters")
+	}
+
+	// Responses to requests sent with an Idempotency-Key, replayed to their retries on any instance
+	var idempotencyStore IdempotencyStoreService
+	if redisClient != nil {
+		idempotencyStore = services.NewIdempotencyStore(redisClient, time.Duration(config.Server.IdempotencyTTLHours)*time.Hour)
+	} else {
+		logger.Warn("Idempotency store not initialized - Idempotency-Key headers are ignored")
+	}
+	idempotent := IdempotencyMiddleware(idempotencyStore, logger)
 	
 	// Initialize billing service
 	billingService := services.NewBillingService(logger)
@@ -195,6 +243,7 @@ func Router(logger *zap.Logger, config *infra.Config, pool *pgxpool.Pool) http.H
 	
 	// Initialize email service
 	emailService := services.NewEmailService(logger, config.Email.ResendAPIKey, config.Email.FromEmail)
+	emailService.SetSMTPFallback(config.Email.SMTPHost, config.Email.SMTPPort, config.Email.SMTPUsername, config.Email.SMTPPassword)
 	
 	// Initialize repositories (use pool directly)
 	otpRepo := NewOTPRepo(pool, logger)
@@ -205,14 +254,23 @@ func Router(logger *zap.Logger, config *infra.Config, pool *pgxpool.Pool) http.H
 	planRepo := NewPlanRepo(pool, logger)
 	subscriptionRepo := NewSubscriptionRepo(pool, logger)
 	userPlanRepo := NewUserPlanRepo(pool, logger)
-	
-	// Create adapters for plan enforcement service
-	// Use type assertion wrappers to match adapter interface
-	planRepoAdapter := services.NewPlanRepoAdapter(&planRepoInterfaceWrapper{repo: planRepo}, logger)
-	planEnforcementSubRepoAdapter := services.NewSubscriptionRepoAdapter(&subscriptionRepoInterfaceWrapper{repo: subscriptionRepo}, logger)
+
+	// User profiles, subscriptions and app lists are read on most requests - serve them from Redis
+	// between writes
+	var readCache *services.ReadCache // nil without Redis; repositories then skip the cache
+	if config.Cache.TTLSeconds > 0 {
+		if redisClient != nil {
+			readCache = services.NewReadCache(redisClient, time.Duration(config.Cache.TTLSeconds)*time.Second, logger)
+			userRepo.SetCache(readCache)
+			appRepo.SetCache(readCache)
+			subscriptionRepo.SetCache(readCache)
+		} else {
+			logger.Warn("Read cache not initialized - reading users, subscriptions and apps from Postgres")
+		}
+	}
 	
 	// Wire up plan enforcement service with repositories
-	planEnforcement.SetRepositories(planRepoAdapter, planEnforcementSubRepoAdapter, userPlanRepo)
+	ConfigurePlanEnforcement(planEnforcement, planRepo, subscriptionRepo, userPlanRepo, logger)
 	
 	// Initialize subscription service for trial management
 	// Create adapters to convert api repositories to services.SubscriptionRepo interface
@@ -230,9 +288,15 @@ func Router(logger *zap.Logger, config *infra.Config, pool *pgxpool.Pool) http.H
 	// Note: deploymentService is nil in API server, so app stopper will log warnings
 	// In production, you may want to use a message queue to trigger app stopping
 	appStopper := NewAppStopper(appRepo, nil, logger) // deploymentService is nil in API server
+	appStopper.SetRAMReleaser(planEnforcement)
 	subscriptionService.SetAppStopper(appStopper)
 	// Set billing updater to sync billing fields to users table
 	subscriptionService.SetBillingUpdater(userRepoAdapter)
+	// Failed payments put the account in read-only mode for this long before apps are stopped
+	subscriptionService.SetGracePeriod(time.Duration(config.Billing.PaymentGraceHours) * time.Hour)
+	// Billing emails go through the notifier so users' channel preferences (Slack) apply
+	notifier := services.NewNotifier(logger, userRepo, emailService)
+	subscriptionService.SetNotifier(notifier)
 	
 	// Initialize task enqueue service for triggering builds/deployments
 	taskEnqueue, err := services.NewTaskEnqueueService(config.Redis.Addr, config.Redis.Password, logger, planEnforcement)
@@ -241,6 +305,19 @@ func Router(logger *zap.Logger, config *infra.Config, pool *pgxpool.Pool) http.H
 		// Continue without task enqueue - deployments will need to be triggered manually
 		taskEnqueue = nil
 	}
+
+	// Builds and deploys are recorded as pending when enqueued; workers record the rest of their life
+	taskStateRepo := NewTaskStateRepo(pool, logger)
+	deployEventRepo := NewDeployEventRepo(pool, logger)
+	if taskEnqueue != nil {
+		taskEnqueue.SetTaskStateRecorder(taskStateRepo)
+		taskEnqueue.SetDeployEventRecorder(deployEventRepo)
+	}
+
+	// Queue emails in the email log for the deploy worker to deliver with retries (sent directly without a queue)
+	if taskEnqueue != nil {
+		emailService.SetQueue(NewEmailLogRepo(pool, logger), taskEnqueue)
+	}
 	
 	// Initialize OTP service
 	otpService := services.NewOTPService(logger, otpRepo, emailService)
@@ -250,6 +327,7 @@ func Router(logger *zap.Logger, config *infra.Config, pool *pgxpool.Pool) http.H
 	
 	// Initialize deployment repository
 	deploymentRepo := NewDeploymentRepo(pool, logger)
+	deploymentRepo.SetCache(readCache)
 
 	// Initialize environment variables repository
 	envVarRepo := NewEnvVarRepo(pool, logger)
@@ -271,8 +349,145 @@ func Router(logger *zap.Logger, config *infra.Config, pool *pgxpool.Pool) http.H
 	// WebSocket removed - DB is single source of truth
 	handlers := NewHandlers(logger, logPersistence, containerLogs, planEnforcement, billingService, constraintsService, subscriptionService, subscriptionRepo, appRepo, deploymentRepo, envVarRepo, userRepo, planRepo, userPlanRepo, taskEnqueue, nil, nil)
 
+	// Initialize usage service (quota dashboard, computed from apps + usage_records)
+	usageRepo := NewUsageRepo(pool, logger)
+	planEnforcement.SetUsageRepo(usageRepo)
+	usageService := services.NewUsageService(logger, usageRepo, planEnforcement, time.Duration(config.Billing.UsageCacheSeconds)*time.Second)
+	handlers.SetUsageService(usageService)
+	usageHandlers := NewUsageHandlers(logger, usageService)
+
+	// Signed build log download URLs, keyed from the JWT secret
+	handlers.SetLogDownloadSigner(services.NewLogDownloadSigner(config.JWT.Secret))
+
+	// Container resource usage sampled by the deploy worker's metrics collector
+	handlers.SetMetricsRepo(NewAppMetricsRepo(pool, logger))
+	handlers.SetTrafficRepo(NewAppTrafficRepo(pool, logger))
+	handlers.SetDeployEventRepo(deployEventRepo)
+
+	// Log lines the build and deploy workers index as they persist logs
+	handlers.SetLogSearchRepo(NewLogSearchRepo(pool, logger))
+
+	// Docker hosts and their capacity, reported by the deploy workers
+	// With several hosts, deploys are placed on one and Traefik forwards apps to the host they run on
+	hostRepo := NewHostRepo(pool, logger)
+	handlers.SetHostRepo(hostRepo)
+	handlers.SetTraefikProviderToken(config.Traefik.ProviderToken)
+	if taskEnqueue != nil {
+		taskEnqueue.SetHostScheduler(hostRepo)
+	}
+
+	// Build and deploy task states, for showing where a deployment is stuck
+	handlers.SetTaskStateRepo(taskStateRepo)
+
+	// Vulnerability scans of the images builds produced
+	handlers.SetImageScanRepo(NewImageScanRepo(pool, logger))
+
+	// Refs of pinned redeploys are checked against the repository; nothing is cloned by the API
+	handlers.SetGitService(services.NewGitService(logger, ""))
+
+	// Initialize organizations (teams with role-based access to org apps)
+	orgRepo := NewOrganizationRepo(pool, logger)
+	handlers.SetOrganizationRepo(orgRepo)
+	orgHandlers := NewOrganizationHandlers(logger, orgRepo, userRepo, planEnforcement, emailService)
+
+	// Initialize object storage for user uploads (avatars)
+	objectStorage, storageErr := services.NewObjectStorage(logger, services.ObjectStorageConfig{
+		Driver:      config.Storage.Driver,
+		LocalDir:    config.Storage.LocalDir,
+		PublicURL:   config.Storage.PublicURL,
+		S3Endpoint:  config.Storage.S3Endpoint,
+		S3Region:    config.Storage.S3Region,
+		S3Bucket:    config.Storage.S3Bucket,
+		S3AccessKey: config.Storage.S3AccessKey,
+		S3SecretKey: config.Storage.S3SecretKey,
+	})
+	if storageErr != nil {
+		logger.Error("Object storage unavailable - avatar uploads disabled", zap.Error(storageErr))
+	} else {
+		handlers.SetObjectStorage(objectStorage)
+	}
+
+	// Initialize custom domain handlers
+	// Base domain matches the one deploy-worker uses for app subdomains (CNAME target)
+	appBaseDomain := infra.GetEnv("APP_BASE_DOMAIN", "stackyn.local")
+	domainRepo := NewDomainRepo(pool, logger)
+	domainVerifier := services.NewDomainVerificationService(logger, appBaseDomain)
+	domainHandlers := NewDomainHandlers(logger, appRepo, domainRepo, deploymentRepo, planEnforcement, domainVerifier, taskEnqueue, appBaseDomain)
+	handlers.SetDomainRepo(domainRepo, domainVerifier)
+
+	// Initialize cron job handlers (runs execute on the deploy worker)
+	cronRepo := NewCronRepo(pool, logger)
+	cronHandlers := NewCronHandlers(logger, appRepo, cronRepo, deploymentRepo, taskEnqueue)
+	handlers.SetCronRepo(cronRepo)
+
+	// Initialize one-off exec handlers (commands run on the deploy worker, output is streamed from the database)
+	execHandlers := NewExecHandlers(logger, appRepo, NewExecRepo(pool, logger), deploymentRepo, taskEnqueue, planEnforcement)
+
+	// Initialize app webhook handlers (events are recorded by the workers, sent by the dispatcher below)
+	appWebhookRepo := NewAppWebhookRepo(pool, logger)
+	appWebhookHandlers := NewAppWebhookHandlers(logger, appRepo, appWebhookRepo)
+
+	// Initialize app log drain handlers (runtime logs are shipped by the deploy worker)
+	appLogDrainHandlers := NewAppLogDrainHandlers(logger, appRepo, NewLogDrainRepo(pool, logger))
+
+	// Initialize app transfer handlers (apps move between users and organizations once the recipient accepts)
+	appTransferRepo := NewAppTransferRepo(pool, logger)
+	appTransferRepo.SetCache(readCache)
+	appTransferHandlers := NewAppTransferHandlers(logger, appRepo, orgRepo, userRepo, appTransferRepo, planEnforcement, usageService)
+
+	// Initialize app export handlers (bundles are written by the deploy worker)
+	appExportRepo := NewAppExportRepo(pool, logger)
+	appExportHandlers := NewAppExportHandlers(logger, appRepo, appExportRepo, deploymentRepo, envVarRepo, taskEnqueue)
+
+	// Initialize WAF handlers (changes are applied by redeploying the running image)
+	wafHandlers := NewWAFHandlers(logger, appRepo, NewWAFRepo(pool, logger), deploymentRepo, taskEnqueue)
+
+	// Initialize routing handlers (changes are applied the same way)
+	routingHandlers := NewRoutingHandlers(logger, appRepo, NewRoutingRepo(pool, logger), deploymentRepo, planEnforcement, taskEnqueue)
+
+	// Initialize maintenance handlers (owners are notified by the maintenance notifier)
+	maintenanceHandlers := NewMaintenanceHandlers(logger, appRepo, NewMaintenanceRepo(pool, logger))
+
 	// Initialize auth handlers
-	authHandlers := NewAuthHandlers(logger, otpService, jwtService, userRepo, otpRepo, subscriptionService)
+	authHandlers := NewAuthHandlers(logger, otpService, jwtService, userRepo, subscriptionService)
+	authHandlers.SetAuthMode(config.Auth.Mode)
+
+	// Select how requests are authenticated
+	// builtin: JWTs issued by the OTP/password endpoints
+	// header: identity header from an upstream auth proxy (self-hosting behind oauth2-proxy/Authelia)
+	authMiddleware := AuthMiddleware(jwtService, logger)
+	headerAuth := config.Auth.Mode == infra.AuthModeHeader
+	if headerAuth {
+		trustedProxies, err := ParseTrustedProxies(config.Auth.TrustedProxies)
+		if err != nil {
+			logger.Fatal("Invalid trusted proxies for header auth", zap.Error(err))
+		}
+		authMiddleware = HeaderAuthMiddleware(authHandlers, HeaderAuthConfig{
+			EmailHeader:    config.Auth.EmailHeader,
+			NameHeader:     config.Auth.NameHeader,
+			TrustedProxies: trustedProxies,
+		}, logger)
+		logger.Info("Header authentication enabled - built-in password/OTP sign-in disabled",
+			zap.String("email_header", config.Auth.EmailHeader),
+			zap.Strings("trusted_proxies", config.Auth.TrustedProxies),
+		)
+	}
+
+	// API tokens (SDKs, CI) are accepted alongside session auth
+	// Sandbox tokens are only accepted on the apps/deployments routes, where the simulator serves them
+	apiTokenRepo := NewAPITokenRepo(pool, logger)
+	apiTokenHandlers := NewAPITokenHandlers(logger, apiTokenRepo)
+	// Impersonation tokens minted by admins are checked first; every request made with one is audited
+	auditRepo := NewAuditRepo(pool, logger)
+	// Security-relevant requests (sign-ins, tokens, env vars, deletions, plan and admin changes) are audited too
+	auditor := NewAuditor(auditRepo, logger)
+	auditHandlers := NewAuditHandlers(logger, auditRepo)
+	impersonationHandlers := NewImpersonationHandlers(logger, jwtService, auditRepo, userRepo,
+		config.Admin.Emails, time.Duration(config.Admin.ImpersonationTTLMinutes)*time.Minute)
+	sessionAuth := ImpersonationMiddleware(jwtService, auditRepo, authMiddleware, logger)
+	authMiddleware = APITokenMiddleware(apiTokenRepo, false, sessionAuth, logger)
+	sandboxAuthMiddleware := APITokenMiddleware(apiTokenRepo, true, sessionAuth, logger)
+	sandboxHandlers := NewSandboxHandlers(logger, services.NewSandboxService(logger, appBaseDomain))
 
 	// Start billing worker for trial expiration (runs every 30 minutes)
 	// This worker checks for expired trials and stops apps
@@ -284,99 +499,490 @@ func Router(logger *zap.Logger, config *infra.Config, pool *pgxpool.Pool) http.H
 		}
 	}()
 
+	// Start downgrade reconciler (runs every 30 minutes)
+	// Warns users whose apps exceed their plan after a downgrade, then pauses excess apps at the deadline
+	go func() {
+		ctx := context.Background()
+		gracePeriod := time.Duration(config.Billing.DowngradeGraceHours) * time.Hour
+		downgradeReconciler := workers.NewDowngradeReconciler(pool, planEnforcement, emailService, appStopper, gracePeriod, logger)
+		downgradeReconciler.SetNotifier(notifier)
+		if err := downgradeReconciler.Start(ctx); err != nil {
+			logger.Error("Downgrade reconciler stopped", zap.Error(err))
+		}
+	}()
+
+	// Start cron scheduler (runs every 30 seconds)
+	// Enqueues due cron job runs for the deploy worker
+	if taskEnqueue != nil {
+		go func() {
+			ctx := context.Background()
+			cronScheduler := workers.NewCronScheduler(pool, taskEnqueue, logger)
+			if err := cronScheduler.Start(ctx); err != nil {
+				logger.Error("Cron scheduler stopped", zap.Error(err))
+			}
+		}()
+	}
+
+	// Start app webhook dispatcher (runs every 10 seconds)
+	// Sends recorded build and deploy events to user webhooks, retrying failures with backoff
+	go func() {
+		ctx := context.Background()
+		dispatcher := workers.NewAppWebhookDispatcher(pool, services.NewAppWebhookSender(logger), logger)
+		if err := dispatcher.Start(ctx); err != nil {
+			logger.Error("App webhook dispatcher stopped", zap.Error(err))
+		}
+	}()
+
+	// Removes export bundles once their 7 days of availability are over
+	go func() {
+		ctx := context.Background()
+		reaper := workers.NewAppExportReaper(appExportRepo, logger)
+		if err := reaper.Start(ctx); err != nil {
+			logger.Error("App export reaper stopped", zap.Error(err))
+		}
+	}()
+
+	// Start build count reconciler (runs every 5 minutes)
+	// Frees concurrent build slots leaked by build workers that died mid-build
+	go func() {
+		ctx := context.Background()
+		buildCountReconciler := workers.NewBuildCountReconciler(pool, planEnforcement, logger)
+		if err := buildCountReconciler.Start(ctx); err != nil {
+			logger.Error("Build count reconciler stopped", zap.Error(err))
+		}
+	}()
+
+	// Start maintenance notifier (runs every minute)
+	// Notifies owners of apps on nodes/regions under newly scheduled maintenance and annotates their activity feeds
+	go func() {
+		ctx := context.Background()
+		maintenanceNotifier := workers.NewMaintenanceNotifier(pool, notifier, logger)
+		if err := maintenanceNotifier.Start(ctx); err != nil {
+			logger.Error("Maintenance notifier stopped", zap.Error(err))
+		}
+	}()
+
+	// Start stale deployment watchdog (runs every minute)
+	// Fails apps left building/deploying by a dead worker and releases the plan counters they held
+	go func() {
+		ctx := context.Background()
+		threshold := time.Duration(config.StaleDeployments.ThresholdMinutes) * time.Minute
+		var buildEnqueuer workers.BuildEnqueuer
+		if taskEnqueue != nil {
+			buildEnqueuer = taskEnqueue
+		}
+		watchdog := workers.NewStaleDeploymentWatchdog(pool, planEnforcement, buildEnqueuer, threshold, config.StaleDeployments.Requeue, logger)
+		watchdog.SetNotifier(notifier)
+		watchdog.SetAppListCache(appRepo)
+		if err := watchdog.Start(ctx); err != nil {
+			logger.Error("Stale deployment watchdog stopped", zap.Error(err))
+		}
+	}()
+
 	// Health check
 	r.Get("/health", handlers.HealthCheck)
 
+	// Prometheus metrics for the control plane (queue depth is read from Redis on each scrape)
+	// The API's /metrics is as public as the API itself, so outside development it requires a scrape token
+	if config.Metrics.ScrapeToken != "" || isDevelopmentEnv(os.Getenv("ENV")) {
+		metrics.WatchQueueDepth(asynq.NewInspector(asynq.RedisClientOpt{
+			Addr:     config.Redis.Addr,
+			Password: config.Redis.Password,
+		}), logger)
+		r.Method(http.MethodGet, "/metrics", metrics.Handler(config.Metrics.ScrapeToken))
+	} else {
+		logger.Warn("METRICS_SCRAPE_TOKEN is not set: /metrics is not served (set it, or ENV=development or test)")
+	}
+
+	// Uploaded files (avatars) when stored on local disk and no external public URL is configured
+	if localStorage, ok := objectStorage.(*services.LocalObjectStorage); ok && config.Storage.PublicURL == "" {
+		fileServer := http.StripPrefix("/uploads/", http.FileServer(http.Dir(localStorage.Dir())))
+		r.Get("/uploads/*", func(w http.ResponseWriter, r *http.Request) {
+			// No directory listings - object keys are only known to their owners
+			if strings.HasSuffix(r.URL.Path, "/") {
+				http.NotFound(w, r)
+				return
+			}
+			fileServer.ServeHTTP(w, r)
+		})
+	}
+
 	// Auth routes (no auth required)
 	r.Route("/api/auth", func(r chi.Router) {
-		// OTP authentication endpoints
-		r.Post("/send-otp", authHandlers.SendOTP)
-		r.Post("/verify-otp", authHandlers.VerifyOTP)
-		r.Post("/login", authHandlers.Login)
-		
-		// Password reset endpoints
-		r.Post("/forgot-password", authHandlers.ForgotPassword)
-		r.Post("/reset-password", authHandlers.ResetPassword)
+		// Tells the frontend whether to show the sign-in form
+		r.Get("/config", authHandlers.GetAuthConfig)
+
+		if headerAuth {
+			// Identity comes from the auth proxy - built-in sign-in flows are disabled
+			r.Post("/signup", authHandlers.BuiltinAuthDisabled)
+			r.Post("/send-otp", authHandlers.BuiltinAuthDisabled)
+			r.Post("/verify-otp", authHandlers.BuiltinAuthDisabled)
+			r.Post("/login", authHandlers.BuiltinAuthDisabled)
+			r.Post("/forgot-password", authHandlers.BuiltinAuthDisabled)
+			r.Post("/reset-password", authHandlers.BuiltinAuthDisabled)
+		} else {
+			// Signup and OTP authentication endpoints
+			r.With(auditor.Record(AuditActionSignup)).Post("/signup", authHandlers.Signup)
+			r.Post("/send-otp", authHandlers.SendOTP)
+			r.With(auditor.Record(AuditActionOTPLogin)).Post("/verify-otp", authHandlers.VerifyOTP)
+			r.With(auditor.Record(AuditActionLogin)).Post("/login", authHandlers.Login)
+			
+			// Password reset endpoints
+			r.Post("/forgot-password", authHandlers.ForgotPassword)
+			r.With(auditor.Record(AuditActionPasswordReset)).Post("/reset-password", authHandlers.ResetPassword)
+		}
 		
 		// Update user profile (requires auth)
-		r.With(AuthMiddleware(jwtService, logger)).Post("/update-profile", authHandlers.UpdateUserProfile)
+		r.With(authMiddleware).Post("/update-profile", authHandlers.UpdateUserProfile)
 	})
 
 	// User routes - requires authentication
 	r.Route("/api/user", func(r chi.Router) {
-		r.Use(AuthMiddleware(jwtService, logger))
+		r.Use(authMiddleware)
 		r.Get("/me", handlers.GetUserProfile)
+		r.Patch("/me", handlers.UpdateUserProfile)
+		r.With(MaxBodyBytes(maxAvatarBytes+64*1024)).Post("/me/avatar", handlers.UploadAvatar)
+		r.Delete("/me/avatar", handlers.DeleteAvatar)
+		r.Get("/me/notifications", handlers.GetNotificationSettings)
+		r.Patch("/me/notifications", handlers.UpdateNotificationSettings)
+	})
+
+	// Usage routes - requires authentication only (read-only, available during grace/expired billing)
+	r.Route("/api/v1/usage", func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Get("/", usageHandlers.GetUsage)
+		r.Get("/build-minutes", usageHandlers.GetBuildMinutes)
+	})
+
+	// API token routes - tokens can only be managed from a signed-in session
+	r.Route("/api/v1/tokens", func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Get("/", apiTokenHandlers.ListTokens)
+		r.With(idempotent, auditor.Record(AuditActionTokenCreate)).Post("/", apiTokenHandlers.CreateToken)
+		r.With(auditor.Record(AuditActionTokenRevoke)).Delete("/{tokenId}", apiTokenHandlers.RevokeToken)
+	})
+
+	// Audit log of the signed-in user's account
+	r.With(authMiddleware).Get("/api/v1/audit", auditHandlers.ListAuditLog)
+
+	// App export routes - exports belong to the user and outlive the exported app
+	r.Route("/api/v1/exports", func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Get("/", appExportHandlers.ListAppExports)
+		r.Get("/{exportId}", appExportHandlers.GetAppExport)
+		r.Get("/{exportId}/download", appExportHandlers.DownloadAppExport)
 	})
 
+	// App templates - deploying one creates an app, so it needs active billing
+	r.Route("/api/v1/templates", func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Get("/", handlers.ListTemplates)
+		r.Get("/from-repo", handlers.GetRepoAppJSON)
+		r.With(BillingMiddleware(userRepo, logger), idempotent).Post("/{id}/deploy", handlers.DeployTemplate)
+	})
+
+	// WAF preset catalog - requires authentication only
+	r.With(authMiddleware).Get("/api/v1/waf/presets", wafHandlers.ListWAFPresets)
+
 	// Apps routes - /api/apps (for listing) - requires authentication only (no billing check for read-only)
-	r.With(AuthMiddleware(jwtService, logger)).Get("/api/apps", handlers.ListApps)
+	r.With(sandboxAuthMiddleware, SandboxMiddleware(http.HandlerFunc(sandboxHandlers.ListApps))).Get("/api/apps", handlers.ListApps)
 
 	// Apps routes - /api/v1/apps (for CRUD operations) - requires authentication and active billing
 	r.Route("/api/v1/apps", func(r chi.Router) {
 		// Apply authentication middleware to all routes
-		r.Use(AuthMiddleware(jwtService, logger))
-		// Apply billing middleware to enforce active billing for deployments
-		r.Use(BillingMiddleware(userRepo, logger))
-		
-		r.Get("/{id}", handlers.GetAppByID)
-		r.Post("/", handlers.CreateApp)
-		r.Delete("/{id}", handlers.DeleteApp)
-		r.Post("/{id}/redeploy", handlers.RedeployApp)
-		r.Get("/{id}/deployments", handlers.GetAppDeployments)
-		r.Get("/{id}/env", handlers.GetEnvVars)
-		r.Post("/{id}/env", handlers.CreateEnvVar)
-		r.Delete("/{id}/env/{key}", handlers.DeleteEnvVar)
+		// Sandbox tokens are served by the simulator and never reach the handlers below
+		r.Use(sandboxAuthMiddleware)
+		r.Use(SandboxMiddleware(sandboxHandlers.AppRoutes()))
 		
-		// Log endpoints
-		r.Get("/{id}/logs/build", handlers.GetBuildLogs)
-		r.Get("/{id}/logs/runtime", handlers.GetRuntimeLogs)
-		r.Get("/{id}/logs/runtime/stream", handlers.StreamRuntimeLogs)
-		
-		// Verification endpoint
-		r.Get("/{id}/verify", handlers.VerifyDeployment)
+		// Apply billing middleware to enforce active billing for deployments
+		// Retried creates and deploys replay the first response (Idempotency-Key) instead of repeating it
+		r.With(BillingMiddleware(userRepo, logger), idempotent).Post("/", handlers.CreateApp)
+		r.With(BillingMiddleware(userRepo, logger), idempotent).Post("/import", handlers.ImportApp)
+
+		// Per-app routes are authorized by ownership or org role (viewers are read-only)
+		// Access runs before billing so org apps are checked against the owner's billing
+		r.Route("/{id}", func(r chi.Router) {
+			r.Use(AppAccessMiddleware(orgRepo, logger))
+			r.Use(BillingMiddleware(userRepo, logger))
+
+			r.Get("/", handlers.GetAppByID)
+			r.With(RequireAppRole(OrgRoleAdmin, logger), auditor.Record(AuditActionAppDelete)).Delete("/", handlers.DeleteApp)
+			r.With(idempotent).Post("/redeploy", handlers.RedeployApp)
+			r.With(idempotent).Post("/rollback", handlers.RollbackApp)
+			r.With(idempotent).Post("/restart", handlers.RestartApp)
+			r.With(idempotent).Post("/stop", handlers.StopApp)
+			r.With(idempotent).Post("/start", handlers.StartApp)
+			r.Get("/deployments", handlers.GetAppDeployments)
+			r.Get("/deployments/{a}/compare/{b}", handlers.CompareDeployments)
+			r.Get("/env", handlers.GetEnvVars)
+			r.With(auditor.Record(AuditActionEnvVarCreate)).Post("/env", handlers.CreateEnvVar)
+			r.With(auditor.Record(AuditActionEnvVarImport)).Post("/env/bulk", handlers.BulkImportEnvVars)
+			r.With(auditor.Record(AuditActionEnvVarUpdate)).Put("/env/{key}", handlers.UpdateEnvVar)
+			r.With(auditor.Record(AuditActionEnvVarDelete)).Delete("/env/{key}", handlers.DeleteEnvVar)
+			r.Get("/metrics", handlers.GetAppMetrics)
+			r.Get("/traffic", handlers.GetAppTraffic)
+			r.Get("/events", handlers.GetAppEvents)
+			r.Get("/presence", handlers.GetAppPresence)
+			r.Get("/health-check", handlers.GetHealthCheck)
+			r.Put("/health-check", handlers.UpdateHealthCheck)
+			r.With(auditor.Record(AuditActionAppImageUpdate)).Put("/image", handlers.UpdateAppImage)
+			r.Get("/base-image", handlers.GetBaseImage)
+			r.Put("/base-image", handlers.UpdateBaseImage)
+			r.Get("/processes", handlers.ListAppProcesses)
+			r.Put("/processes/{name}", handlers.UpdateAppProcess)
+			r.Get("/release-command", handlers.GetReleaseCommand)
+			r.With(auditor.Record(AuditActionAppReleaseUpdate)).Put("/release-command", handlers.UpdateReleaseCommand)
+			r.Get("/isolation", handlers.GetAppIsolation)
+			r.With(auditor.Record(AuditActionAppIsolationUpdate)).Put("/isolation", handlers.UpdateAppIsolation)
+			r.Get("/build-strategy", handlers.GetBuildStrategy)
+			r.Put("/build-strategy", handlers.UpdateBuildStrategy)
+			r.Get("/secret-scan", handlers.GetSecretScan)
+			r.With(auditor.Record(AuditActionAppSecretsUpdate)).Put("/secret-scan", handlers.UpdateSecretScan)
+			r.Get("/deploy-hook", handlers.GetDeployHook)
+			r.Post("/deploy-hook", handlers.EnableDeployHook)
+			r.Delete("/deploy-hook", handlers.DeleteDeployHook)
+			r.Get("/manifest", handlers.GetAppManifest)
+			
+			// Custom domain endpoints
+			r.Get("/domains", domainHandlers.ListDomains)
+			r.With(idempotent).Post("/domains", domainHandlers.CreateDomain)
+			r.Post("/domains/{domainId}/verify", domainHandlers.VerifyDomain)
+			r.Delete("/domains/{domainId}", domainHandlers.DeleteDomain)
+
+			// Cron job endpoints
+			r.Get("/cron", cronHandlers.ListCronJobs)
+			r.Post("/cron", cronHandlers.CreateCronJob)
+			r.Patch("/cron/{cronId}", cronHandlers.UpdateCronJob)
+			r.Delete("/cron/{cronId}", cronHandlers.DeleteCronJob)
+			r.Post("/cron/{cronId}/run", cronHandlers.TriggerCronJob)
+			r.Get("/cron/{cronId}/runs", cronHandlers.ListCronRuns)
+			r.Get("/cron/{cronId}/runs/{runId}", cronHandlers.GetCronRun)
+
+			// One-off commands (database migrations, maintenance scripts) in the app's image
+			r.With(auditor.Record(AuditActionAppExec)).Post("/exec", execHandlers.RunExec)
+			r.Get("/exec/{runId}", execHandlers.GetExecRun)
+
+			// Outgoing webhook endpoints
+			r.Get("/webhooks", appWebhookHandlers.ListAppWebhooks)
+			r.Post("/webhooks", appWebhookHandlers.CreateAppWebhook)
+			r.Patch("/webhooks/{webhookId}", appWebhookHandlers.UpdateAppWebhook)
+			r.Delete("/webhooks/{webhookId}", appWebhookHandlers.DeleteAppWebhook)
+			r.Get("/webhooks/{webhookId}/deliveries", appWebhookHandlers.ListAppWebhookDeliveries)
+
+			// Log drains - runtime logs shipped to syslog, HTTP, Loki or Datadog endpoints
+			r.Get("/log-drains", appLogDrainHandlers.ListAppLogDrains)
+			r.Post("/log-drains", appLogDrainHandlers.CreateAppLogDrain)
+			r.Patch("/log-drains/{drainId}", appLogDrainHandlers.UpdateAppLogDrain)
+			r.Delete("/log-drains/{drainId}", appLogDrainHandlers.DeleteAppLogDrain)
+
+			// Transfer to another user or organization (completed when the recipient accepts)
+			r.Get("/transfer", appTransferHandlers.GetAppTransfer)
+			r.With(RequireAppRole(OrgRoleAdmin, logger), auditor.Record(AuditActionAppTransfer)).Post("/transfer", appTransferHandlers.CreateAppTransfer)
+			r.With(RequireAppRole(OrgRoleAdmin, logger)).Delete("/transfer", appTransferHandlers.CancelAppTransfer)
+
+			// Export bundle (optionally deleting the app afterwards)
+			r.With(RequireAppRole(OrgRoleAdmin, logger)).Post("/export", appExportHandlers.CreateAppExport)
+
+			// Activity feed (maintenance notices)
+			r.Get("/activity", maintenanceHandlers.GetAppActivity)
+
+			// WAF presets and hits log
+			r.Get("/waf", wafHandlers.GetAppWAF)
+			r.Put("/waf", wafHandlers.UpdateAppWAF)
+			r.Delete("/waf", wafHandlers.DeleteAppWAF)
+			r.Get("/waf/hits", wafHandlers.ListWAFHits)
+
+			// Edge routing options (HTTPS redirect, compression, body limit, headers) and access rules (IP allowlist, basic auth)
+			r.Get("/routing", routingHandlers.GetAppRouting)
+			r.With(RequireAppRole(OrgRoleAdmin, logger), auditor.Record(AuditActionAppRoutingUpdate)).Patch("/routing", routingHandlers.UpdateAppRouting)
+			
+			// Log endpoints
+			r.Get("/logs/build", handlers.GetBuildLogs)
+			r.Get("/logs/runtime", handlers.GetRuntimeLogs)
+			r.Get("/logs/runtime/stream", handlers.StreamRuntimeLogs)
+			r.Get("/logs/ws", handlers.TailRuntimeLogs)
+			r.Get("/logs/release", handlers.GetReleaseLogs)
+			r.Get("/logs/search", handlers.SearchLogs)
+			
+			// Verification endpoint
+			r.Get("/verify", handlers.VerifyDeployment)
+		})
+	})
+
+	// Organization routes - requires authentication (roles are checked per organization)
+	r.Route("/api/v1/orgs", func(r chi.Router) {
+		r.Use(authMiddleware)
+
+		r.Post("/", orgHandlers.CreateOrganization)
+		r.Get("/", orgHandlers.ListOrganizations)
+		r.Get("/{orgId}", orgHandlers.GetOrganization)
+		r.Delete("/{orgId}", orgHandlers.DeleteOrganization)
+		r.Get("/{orgId}/apps", orgHandlers.ListApps)
+
+		// Security policy of the organization's deploys
+		r.Get("/{orgId}/security-policy", orgHandlers.GetSecurityPolicy)
+		r.With(auditor.Record(AuditActionOrgPolicyUpdate)).Put("/{orgId}/security-policy", orgHandlers.UpdateSecurityPolicy)
+
+		// Members
+		r.Get("/{orgId}/members", orgHandlers.ListMembers)
+		r.Patch("/{orgId}/members/{userId}", orgHandlers.UpdateMemberRole)
+		r.Delete("/{orgId}/members/{userId}", orgHandlers.RemoveMember)
+
+		// Invitations
+		r.Post("/{orgId}/invitations", orgHandlers.CreateInvitation)
+		r.Get("/{orgId}/invitations", orgHandlers.ListInvitations)
+		r.Delete("/{orgId}/invitations/{inviteId}", orgHandlers.DeleteInvitation)
+	})
+
+	// Incoming app transfers - requires authentication as the recipient (or an admin of the recipient organization)
+	r.Route("/api/v1/transfers", func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Get("/", appTransferHandlers.ListIncomingTransfers)
+		r.With(auditor.Record(AuditActionAppTransferAccept)).Post("/{transferId}/accept", appTransferHandlers.AcceptTransfer)
+		r.Post("/{transferId}/decline", appTransferHandlers.DeclineTransfer)
 	})
 
+	// Invitation acceptance - requires authentication as the invited email
+	r.With(authMiddleware).Post("/api/v1/invitations/{token}/accept", orgHandlers.AcceptInvitation)
+
 	// Deployments routes - requires authentication
 	r.Route("/api/v1/deployments", func(r chi.Router) {
 		// Apply authentication middleware to all routes
-		r.Use(AuthMiddleware(jwtService, logger))
+		r.Use(sandboxAuthMiddleware)
+		r.Use(SandboxMiddleware(sandboxHandlers.DeploymentRoutes()))
 		
 		r.Get("/{id}", handlers.GetDeploymentByID)
 		r.Get("/{id}/logs", handlers.GetDeploymentLogs)
+		r.Get("/{id}/logs/download", handlers.GetBuildLogDownloadURL)
+		r.Get("/{id}/tasks", handlers.GetDeploymentTasks)
+		r.Get("/{id}/vulnerabilities", handlers.GetDeploymentVulnerabilities)
+		r.Get("/{id}/queue", handlers.GetDeploymentQueue)
+		r.Post("/{id}/cancel", handlers.CancelDeployment)
 	})
 
+	// Git host push webhooks - the app's deploy hook secret authorizes the request
+	r.Route("/api/v1/hooks", func(r chi.Router) {
+		r.Use(MaxBodyBytes(maxPushHookBodyBytes + 1))
+		r.Post("/gitlab", handlers.GitLabPushHook)
+		r.Post("/bitbucket", handlers.BitbucketPushHook)
+	})
+
+	// Signed build log downloads - the signature in the URL authorizes the request
+	r.Get("/api/v1/downloads/build-logs/{id}", handlers.DownloadBuildLog)
+
+	// Traefik HTTP provider - the provider token authorizes the request
+	r.Get("/api/v1/traefik/routes", handlers.TraefikRoutes)
+
 	// Billing webhooks routes
 	// Initialize webhook handlers
-	webhookSecret := "" // TODO: Load from config
-	webhookHandlers := NewWebhookHandlers(logger, subscriptionService, userRepo, webhookSecret)
+	webhookEventRepo := NewWebhookEventRepo(pool, logger)
+	webhookTolerance := time.Duration(config.Billing.WebhookToleranceSeconds) * time.Second
+	billingReviewRepo := NewBillingReviewRepo(pool, logger)
+	lemonSqueezyClient := services.NewLemonSqueezyClient(logger, config.Billing.LemonSqueezyAPIKey)
+	webhookHandlers := NewWebhookHandlers(logger, subscriptionService, userRepo, webhookEventRepo, billingReviewRepo, lemonSqueezyClient, config.Billing.LemonSqueezyWebhookSecret, webhookTolerance)
+	webhookHandlers.SetAuditor(auditor)
+	chaosRepo := NewChaosRepo(pool, logger)
+	if config.Chaos.Enabled {
+		webhookHandlers.SetChaosInjector(services.NewChaosInjector(chaosRepo, logger))
+	}
 	r.Route("/api/webhooks", func(r chi.Router) {
 		r.Post("/lemon-squeezy", webhookHandlers.LemonSqueezyWebhook)
 	})
 
+	// Billing routes - requires authentication only (plan changes are checked against the subscription)
+	invoiceService := services.NewInvoiceService(logger, lemonSqueezyClient, subscriptionService, time.Duration(config.Billing.InvoiceCacheSeconds)*time.Second)
+	webhookHandlers.SetInvoiceService(invoiceService)
+	billingHandlers := NewBillingHandlers(logger, subscriptionService, planEnforcement, planRepo, appRepo, lemonSqueezyClient, invoiceService, config.Billing.LemonSqueezyVariants)
+	r.Route("/api/billing", func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Get("/invoices", billingHandlers.ListInvoices)
+		r.With(auditor.Record(AuditActionPlanChange)).Post("/change-plan", billingHandlers.ChangePlan)
+	})
+
+	// Start billing webhook retrier (runs every minute)
+	// Applies inbox events that failed when they arrived, with backoff, until they succeed or fail for good
+	go func() {
+		ctx := context.Background()
+		webhookRetrier := workers.NewBillingWebhookRetrier(webhookHandlers, logger)
+		if err := webhookRetrier.Start(ctx); err != nil {
+			logger.Error("Billing webhook retrier stopped", zap.Error(err))
+		}
+	}()
+
 	// Test endpoints - for testing billing states (disabled in production)
 	r.Route("/api/v1/test", func(r chi.Router) {
-		r.Use(AuthMiddleware(jwtService, logger))
+		r.Use(authMiddleware)
 		r.Post("/billing", handlers.TestBillingState)
 	})
 
-	// Admin routes - requires authentication
-	r.Route("/admin", func(r chi.Router) {
-		r.Use(AuthMiddleware(jwtService, logger))
-		
+	// Chaos routes - inject build, deploy and webhook failures (admins only, when CHAOS_ENABLED, never in production)
+	if config.Chaos.Enabled {
+		logger.Warn("Chaos endpoints enabled - injected faults will fail builds, delay deploys and drop webhooks")
+		chaosHandlers := NewChaosHandlers(logger, chaosRepo, appRepo)
+		r.Route("/api/v1/dev/chaos", func(r chi.Router) {
+			r.Use(authMiddleware)
+			r.Use(impersonationHandlers.RequireAdmin)
+			r.Get("/faults", chaosHandlers.ListFaults)
+			r.Post("/faults", chaosHandlers.CreateFault)
+			r.Delete("/faults", chaosHandlers.ClearFaults)
+			r.Delete("/faults/{faultId}", chaosHandlers.DeleteFault)
+		})
+	}
+
+	// Admin routes - restricted to ADMIN_EMAILS
+	r.Route("/admin", adminRoutes(authMiddleware, auditor, handlers, webhookHandlers, maintenanceHandlers, impersonationHandlers))
+
+	// API documentation - public; the spec is generated from the routes above on first request
+	openAPIDocs := NewOpenAPIDocs(r, logger)
+	r.Get("/api/v1/openapi.json", openAPIDocs.ServeSpec)
+	r.Get("/api/v1/docs", openAPIDocs.ServeUI)
+
+	return r
+}
+
+// adminRoutes registers the /admin endpoints. Every one of them is behind RequireAdmin, not only those
+// that act as or on other users: listing hosts or replaying billing events is just as platform-wide
+func adminRoutes(authMiddleware func(http.Handler) http.Handler, auditor *Auditor, handlers *Handlers, webhookHandlers *WebhookHandlers,
+	maintenanceHandlers *MaintenanceHandlers, impersonationHandlers *ImpersonationHandlers) func(chi.Router) {
+	return func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Use(impersonationHandlers.RequireAdmin)
+
 		// Users
 		r.Get("/users", handlers.AdminListUsers)
-		r.Patch("/users/{id}/plan", handlers.AdminUpdateUserPlan)
-		r.Delete("/users/{id}", handlers.AdminDeleteUser)
-		
+		r.With(auditor.RecordForUser(AuditActionAdminPlanChange, "id")).Patch("/users/{id}/plan", handlers.AdminUpdateUserPlan)
+		r.With(auditor.RecordForUser(AuditActionAdminUserDelete, "id")).Delete("/users/{id}", handlers.AdminDeleteUser)
+
 		// Apps
 		r.Get("/apps", handlers.AdminListApps)
-		r.Post("/apps/{id}/stop", handlers.AdminStopApp)
-		r.Post("/apps/{id}/start", handlers.AdminStartApp)
-		r.Post("/apps/{id}/redeploy", handlers.AdminRedeployApp)
-		r.Delete("/apps/{id}", handlers.AdminDeleteApp)
-	})
-
-	return r
+		r.With(auditor.Record(AuditActionAdminAppStop)).Post("/apps/{id}/stop", handlers.AdminStopApp)
+		r.With(auditor.Record(AuditActionAdminAppStart)).Post("/apps/{id}/start", handlers.AdminStartApp)
+		r.With(auditor.Record(AuditActionAdminAppRedeploy)).Post("/apps/{id}/redeploy", handlers.AdminRedeployApp)
+		r.With(auditor.Record(AuditActionAdminAppDelete)).Delete("/apps/{id}", handlers.AdminDeleteApp)
+
+		// Billing
+		r.Get("/billing/review-queue", webhookHandlers.AdminListBillingReviewQueue)
+		r.With(auditor.Record(AuditActionAdminBillingFix)).Post("/billing/review-queue/{id}/resolve", webhookHandlers.AdminResolveBillingReviewItem)
+		r.Get("/billing/webhook-events", webhookHandlers.AdminListWebhookEvents)
+		r.With(auditor.Record(AuditActionAdminWebhookReplay)).Post("/billing/webhook-events/{id}/replay", webhookHandlers.AdminReplayWebhookEvent)
+
+		// Maintenance
+		r.Get("/maintenance", maintenanceHandlers.AdminListMaintenanceWindows)
+		r.With(auditor.Record(AuditActionAdminMaintenance)).Post("/maintenance", maintenanceHandlers.AdminCreateMaintenanceWindow)
+
+		// Cleanup
+		r.With(auditor.Record(AuditActionAdminCleanup)).Post("/cleanup", handlers.AdminTriggerCleanup)
+
+		// Hosts
+		r.Get("/hosts", handlers.AdminListHosts)
+		r.With(auditor.Record(AuditActionAdminHostDrain)).Post("/hosts/{id}/drain", handlers.AdminDrainHost)
+		r.With(auditor.Record(AuditActionAdminHostUndrain)).Delete("/hosts/{id}/drain", handlers.AdminUndrainHost)
+
+		// Impersonation and audit log
+		r.Post("/users/{id}/impersonate", impersonationHandlers.ImpersonateUser)
+		r.Delete("/impersonations/{id}", impersonationHandlers.EndImpersonation)
+		r.Get("/audit", impersonationHandlers.ListAuditLog)
+	}
 }
 
 func loggingMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
@@ -397,3 +1003,17 @@ func loggingMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
 	}
 }
 
+// metricsMiddleware records request counts and latency by matched route pattern
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startedAt := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := ""
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			route = rctx.RoutePattern()
+		}
+		metrics.ObserveHTTPRequest(r.Method, route, ww.Status(), time.Since(startedAt))
+	})
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+)
+
+// signedInAs stands in for the auth middleware, signing every request in as email
+func signedInAs(email string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), "user_id", "user-1")
+			ctx = context.WithValue(ctx, "user_email", email)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func adminTestRouter(email string) http.Handler {
+	logger := zap.NewNop()
+	impersonationHandlers := NewImpersonationHandlers(logger, nil, nil, nil, []string{"admin@stackyn.com"}, time.Hour)
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer) // The handlers have no repos: reaching one fails the test instead of the run
+	r.Route("/admin", adminRoutes(signedInAs(email), NewAuditor(nil, logger), &Handlers{}, &WebhookHandlers{},
+		&MaintenanceHandlers{}, impersonationHandlers))
+	return r
+}
+
+func TestAdminRoutesRequireAdmin(t *testing.T) {
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/admin/billing/webhook-events"},
+		{http.MethodPost, "/admin/billing/webhook-events/evt-1/replay"},
+		{http.MethodGet, "/admin/billing/review-queue"},
+		{http.MethodPost, "/admin/billing/review-queue/item-1/resolve"},
+		{http.MethodGet, "/admin/hosts"},
+		{http.MethodPost, "/admin/hosts/host-1/drain"},
+		{http.MethodDelete, "/admin/hosts/host-1/drain"},
+		{http.MethodPost, "/admin/cleanup"},
+		{http.MethodGet, "/admin/maintenance"},
+		{http.MethodPost, "/admin/maintenance"},
+	}
+
+	router := adminTestRouter("user@example.com")
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(route.method, route.path, nil))
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("non-admin got %d, want %d", rec.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
+
+func TestAdminRoutesLetAdminsThrough(t *testing.T) {
+	rec := httptest.NewRecorder()
+	adminTestRouter("Admin@Stackyn.com").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/no-such-route", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("admin got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
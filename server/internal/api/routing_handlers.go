@@ -0,0 +1,255 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// AppRouting is an app's edge options as returned by the routing endpoints
+type AppRouting struct {
+	AppID               string            `json:"app_id"`
+	ForceHTTPS          bool              `json:"force_https"`
+	Compression         bool              `json:"compression"`
+	MaxRequestBodyBytes int64             `json:"max_request_body_bytes"` // 0 = no limit
+	Headers             map[string]string `json:"headers"`
+	BasicAuth           AppBasicAuth      `json:"basic_auth"`
+	IPAllowlist         []string          `json:"ip_allowlist"` // Empty allows every address
+}
+
+// AppBasicAuth is the basic auth part of AppRouting (the password is never returned)
+type AppBasicAuth struct {
+	Enabled  bool   `json:"enabled"`
+	Username string `json:"username,omitempty"`
+}
+
+// UpdateRoutingRequest is the body for PATCH /api/v1/apps/{id}/routing
+// Omitted fields are left unchanged; headers and ip_allowlist replace the whole set when present
+type UpdateRoutingRequest struct {
+	ForceHTTPS          *bool                   `json:"force_https,omitempty"`
+	Compression         *bool                   `json:"compression,omitempty"`
+	MaxRequestBodyBytes *int64                  `json:"max_request_body_bytes,omitempty"` // 0 removes the limit
+	Headers             map[string]string       `json:"headers,omitempty"`
+	BasicAuth           *UpdateBasicAuthRequest `json:"basic_auth,omitempty"`
+	IPAllowlist         []string                `json:"ip_allowlist,omitempty"` // Addresses or CIDRs; [] allows every address
+}
+
+// UpdateBasicAuthRequest turns basic auth on (username and password required) or off
+type UpdateBasicAuthRequest struct {
+	Enabled  bool   `json:"enabled"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// RoutingHandlers manages per-app edge options (HTTPS redirect, compression, body limit, headers) and
+// access rules (IP allowlist, basic auth)
+type RoutingHandlers struct {
+	logger          *zap.Logger
+	appRepo         *AppRepo
+	routingRepo     *RoutingRepo
+	deploymentRepo  *DeploymentRepo
+	planEnforcement PlanEnforcementService
+	taskEnqueue     *services.TaskEnqueueService
+}
+
+// NewRoutingHandlers creates a new routing handlers instance
+func NewRoutingHandlers(logger *zap.Logger, appRepo *AppRepo, routingRepo *RoutingRepo, deploymentRepo *DeploymentRepo, planEnforcement PlanEnforcementService, taskEnqueue *services.TaskEnqueueService) *RoutingHandlers {
+	return &RoutingHandlers{
+		logger:          logger,
+		appRepo:         appRepo,
+		routingRepo:     routingRepo,
+		deploymentRepo:  deploymentRepo,
+		planEnforcement: planEnforcement,
+		taskEnqueue:     taskEnqueue,
+	}
+}
+
+// GET /api/v1/apps/{id}/routing - Get the app's routing options (the defaults when it has none)
+func (h *RoutingHandlers) GetAppRouting(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getOwnedApp(w, r)
+	if !ok {
+		return
+	}
+
+	cfg, err := h.currentRouting(r, app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve routing settings")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, newAppRouting(app.ID, cfg))
+}
+
+// PATCH /api/v1/apps/{id}/routing - Change the app's routing options
+// The running deployment is redeployed so its routes pass through the new middlewares
+// Adding access rules (an IP allowlist or basic auth) needs the access_rules plan feature; removing them does not
+func (h *RoutingHandlers) UpdateAppRouting(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getOwnedApp(w, r)
+	if !ok {
+		return
+	}
+	userID := h.getUserIDFromContext(r)
+
+	var req UpdateRoutingRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	cfg, err := h.currentRouting(r, app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve routing settings")
+		return
+	}
+	if req.ForceHTTPS != nil {
+		cfg.ForceHTTPS = *req.ForceHTTPS
+	}
+	if req.Compression != nil {
+		cfg.Compression = *req.Compression
+	}
+	if req.MaxRequestBodyBytes != nil {
+		cfg.MaxRequestBodyBytes = *req.MaxRequestBodyBytes
+	}
+	if req.Headers != nil {
+		cfg.Headers = req.Headers
+	}
+	if req.IPAllowlist != nil {
+		ipAllowlist, err := services.NormalizeIPAllowlist(req.IPAllowlist)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		cfg.IPAllowlist = ipAllowlist
+	}
+	if req.BasicAuth != nil {
+		cfg.BasicAuthUser = ""
+		if req.BasicAuth.Enabled {
+			entry, err := services.HashBasicAuthUser(strings.TrimSpace(req.BasicAuth.Username), req.BasicAuth.Password)
+			if err != nil {
+				h.writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			cfg.BasicAuthUser = entry
+		}
+	}
+	if err := services.ValidateRoutingConfig(cfg); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Access rules are gated by the access_rules plan feature (the owner's plan for org apps)
+	addsAccessRules := len(req.IPAllowlist) > 0 || (req.BasicAuth != nil && req.BasicAuth.Enabled)
+	if addsAccessRules && h.planEnforcement != nil {
+		if err := h.planEnforcement.CheckAccessRules(r.Context(), app.UserID); err != nil {
+			if planErr, ok := GetPlanLimitError(err); ok {
+				writePlanLimitError(w, planErr)
+				return
+			}
+			h.writeError(w, http.StatusForbidden, "Plan limit exceeded")
+			return
+		}
+	}
+
+	if err := h.routingRepo.SetAppRouting(r.Context(), app.ID, cfg); err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to save routing settings")
+		return
+	}
+
+	h.logger.Info("App routing updated",
+		zap.String("app_id", app.ID),
+		zap.Bool("force_https", cfg.ForceHTTPS),
+		zap.Bool("compression", cfg.Compression),
+		zap.Int64("max_request_body_bytes", cfg.MaxRequestBodyBytes),
+		zap.Int("headers", len(cfg.Headers)),
+		zap.Bool("basic_auth", cfg.BasicAuthUser != ""),
+		zap.Strings("ip_allowlist", cfg.IPAllowlist),
+		zap.String("user_id", userID),
+	)
+
+	enqueueRouteRefresh(r.Context(), h.logger, h.taskEnqueue, h.deploymentRepo, app.ID, userID, "routing")
+
+	h.writeJSON(w, http.StatusOK, newAppRouting(app.ID, cfg))
+}
+
+// currentRouting returns the app's saved routing options, or the defaults when it has none
+func (h *RoutingHandlers) currentRouting(r *http.Request, appID string) (services.RoutingConfig, error) {
+	saved, err := h.routingRepo.GetAppRouting(r.Context(), appID)
+	if err != nil {
+		return services.RoutingConfig{}, err
+	}
+	if saved == nil {
+		return services.DefaultRoutingConfig(), nil
+	}
+	return *saved, nil
+}
+
+// newAppRouting builds the API view of a routing config, keeping the basic auth hash out of it
+func newAppRouting(appID string, cfg services.RoutingConfig) AppRouting {
+	routing := AppRouting{
+		AppID:               appID,
+		ForceHTTPS:          cfg.ForceHTTPS,
+		Compression:         cfg.Compression,
+		MaxRequestBodyBytes: cfg.MaxRequestBodyBytes,
+		Headers:             cfg.Headers,
+		IPAllowlist:         cfg.IPAllowlist,
+	}
+	if routing.Headers == nil {
+		routing.Headers = map[string]string{}
+	}
+	if routing.IPAllowlist == nil {
+		routing.IPAllowlist = []string{}
+	}
+	if cfg.BasicAuthUser != "" {
+		username, _, _ := strings.Cut(cfg.BasicAuthUser, ":")
+		routing.BasicAuth = AppBasicAuth{Enabled: true, Username: username}
+	}
+	return routing
+}
+
+// getOwnedApp loads the app from the URL and verifies the current user owns it
+// Writes the error response and returns false on failure
+func (h *RoutingHandlers) getOwnedApp(w http.ResponseWriter, r *http.Request) (*App, bool) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return nil, false
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return nil, false
+		}
+		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return nil, false
+	}
+	return app, true
+}
+
+func (h *RoutingHandlers) getUserIDFromContext(r *http.Request) string {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		h.logger.Warn("User ID not found in context")
+		return ""
+	}
+	return userID
+}
+
+func (h *RoutingHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *RoutingHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
@@ -0,0 +1,363 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// SandboxHandlers serves the apps and deployments API for sandbox API tokens
+// Responses use the same shapes as the real handlers; state comes from services.SandboxService
+type SandboxHandlers struct {
+	logger  *zap.Logger
+	sandbox *services.SandboxService
+}
+
+// NewSandboxHandlers creates a new sandbox handlers instance
+func NewSandboxHandlers(logger *zap.Logger, sandbox *services.SandboxService) *SandboxHandlers {
+	return &SandboxHandlers{
+		logger:  logger,
+		sandbox: sandbox,
+	}
+}
+
+// SandboxMiddleware serves sandbox-token requests with sandboxHandler instead of the real handlers
+// Must run after APITokenMiddleware; session and live-token requests pass through untouched
+func SandboxMiddleware(sandboxHandler http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if sandbox, _ := r.Context().Value("sandbox").(bool); sandbox {
+				w.Header().Set("X-Stackyn-Sandbox", "true")
+				sandboxHandler.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AppRoutes returns the sandbox counterpart of /api/v1/apps (paths are relative to the mount point)
+func (h *SandboxHandlers) AppRoutes() http.Handler {
+	r := chi.NewRouter()
+	r.Post("/", h.CreateApp)
+	r.Get("/{id}", h.GetApp)
+	r.Delete("/{id}", h.DeleteApp)
+	r.Post("/{id}/redeploy", h.RedeployApp)
+	r.Get("/{id}/deployments", h.GetAppDeployments)
+	r.Get("/{id}/logs/build", h.GetBuildLogs)
+	r.NotFound(h.notAvailable)
+	r.MethodNotAllowed(h.notAvailable)
+	return r
+}
+
+// DeploymentRoutes returns the sandbox counterpart of /api/v1/deployments
+func (h *SandboxHandlers) DeploymentRoutes() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/{id}", h.GetDeployment)
+	r.Get("/{id}/logs", h.GetDeploymentLogs)
+	r.NotFound(h.notAvailable)
+	r.MethodNotAllowed(h.notAvailable)
+	return r
+}
+
+// GET /api/apps - List sandbox apps
+func (h *SandboxHandlers) ListApps(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	sandboxApps := h.sandbox.ListApps(userID)
+	apps := make([]App, 0, len(sandboxApps))
+	for _, app := range sandboxApps {
+		apps = append(apps, sandboxAppResponse(app))
+	}
+	h.writeJSON(w, http.StatusOK, apps)
+}
+
+// POST /api/v1/apps - Create a sandbox app and start its simulated first deployment
+// Deploy branch "sandbox-fail-build" or "sandbox-fail-deploy" to simulate failures
+func (h *SandboxHandlers) CreateApp(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	var req CreateAppRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		h.writeError(w, http.StatusBadRequest, "App name is required")
+		return
+	}
+	if !strings.HasPrefix(req.RepoURL, "https://") {
+		h.writeError(w, http.StatusBadRequest, "Repository URL must be an https:// URL")
+		return
+	}
+	if req.OrganizationID != "" {
+		h.writeError(w, http.StatusBadRequest, "Organizations are not available in sandbox mode")
+		return
+	}
+
+	branch := req.Branch
+	if branch == "" {
+		branch = "main"
+	}
+	slug := req.Slug
+	if slug == "" {
+		slug = generateSlugFromName(req.Name)
+	} else {
+		slugRegex := regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{1,30}[a-z0-9])?$`)
+		if !slugRegex.MatchString(slug) {
+			h.writeError(w, http.StatusBadRequest, "Invalid slug format. Slug must start and end with alphanumeric characters, can contain hyphens, and be 1-32 characters long.")
+			return
+		}
+	}
+
+	app, deployment, err := h.sandbox.CreateApp(userID, req.Name, slug, req.RepoURL, branch)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrSandboxSlugTaken):
+			h.writeError(w, http.StatusConflict, fmt.Sprintf("An app with the slug '%s' already exists. Please choose a different slug.", slug))
+		case errors.Is(err, services.ErrSandboxAppLimit):
+			h.writeError(w, http.StatusForbidden, err.Error())
+		default:
+			h.writeError(w, http.StatusInternalServerError, "Failed to create app")
+		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, CreateAppResponse{
+		App:        sandboxAppResponse(app),
+		Deployment: sandboxDeploymentResponse(deployment),
+	})
+}
+
+// GET /api/v1/apps/{id} - Get a sandbox app
+func (h *SandboxHandlers) GetApp(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	app, err := h.sandbox.GetApp(userID, chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, "App not found")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, sandboxAppResponse(app))
+}
+
+// DELETE /api/v1/apps/{id} - Delete a sandbox app
+func (h *SandboxHandlers) DeleteApp(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	if err := h.sandbox.DeleteApp(userID, chi.URLParam(r, "id")); err != nil {
+		h.writeError(w, http.StatusNotFound, "App not found or you don't have permission to delete it")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/v1/apps/{id}/redeploy - Start a new simulated deployment
+func (h *SandboxHandlers) RedeployApp(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	app, deployment, err := h.sandbox.Redeploy(userID, chi.URLParam(r, "id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrSandboxNotFound):
+			h.writeError(w, http.StatusNotFound, "App not found or you don't have permission to redeploy it")
+		case errors.Is(err, services.ErrSandboxDeployActive):
+			h.writeError(w, http.StatusConflict, "A deployment is already in progress for this app")
+		default:
+			h.writeError(w, http.StatusInternalServerError, "Failed to start redeploy")
+		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, CreateAppResponse{
+		App:        sandboxAppResponse(app),
+		Deployment: sandboxDeploymentResponse(deployment),
+	})
+}
+
+// GET /api/v1/apps/{id}/deployments - List a sandbox app's deployments
+func (h *SandboxHandlers) GetAppDeployments(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	sandboxDeployments, err := h.sandbox.ListDeployments(userID, chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, "App not found")
+		return
+	}
+	deployments := make([]Deployment, 0, len(sandboxDeployments))
+	for _, d := range sandboxDeployments {
+		deployments = append(deployments, sandboxDeploymentResponse(d))
+	}
+	h.writeJSON(w, http.StatusOK, deployments)
+}
+
+// GET /api/v1/apps/{id}/logs/build - Get simulated build logs, newest deployment first
+func (h *SandboxHandlers) GetBuildLogs(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	sandboxDeployments, err := h.sandbox.ListDeployments(userID, chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, "App not found")
+		return
+	}
+	logs := make([]LogEntry, 0, len(sandboxDeployments))
+	for _, d := range sandboxDeployments {
+		logs = append(logs, LogEntry{
+			AppID:        d.AppID,
+			BuildJobID:   d.BuildJobID,
+			DeploymentID: d.ID,
+			LogType:      "build",
+			Timestamp:    d.UpdatedAt,
+			Content:      d.BuildLog,
+			Size:         int64(len(d.BuildLog)),
+		})
+	}
+	h.writeJSON(w, http.StatusOK, logs)
+}
+
+// GET /api/v1/deployments/{id} - Get a sandbox deployment
+func (h *SandboxHandlers) GetDeployment(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	deployment, err := h.sandbox.GetDeployment(userID, chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, "Deployment not found")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, sandboxDeploymentResponse(deployment))
+}
+
+// GET /api/v1/deployments/{id}/logs - Get a sandbox deployment's logs
+func (h *SandboxHandlers) GetDeploymentLogs(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	deployment, err := h.sandbox.GetDeployment(userID, chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, "Deployment not found or access denied")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, DeploymentLogs{
+		Status:       deployment.Status,
+		BuildLog:     deployment.BuildLog,
+		ErrorMessage: deployment.ErrorMessage,
+	})
+}
+
+// notAvailable answers endpoints the sandbox does not simulate
+func (h *SandboxHandlers) notAvailable(w http.ResponseWriter, r *http.Request) {
+	h.writeError(w, http.StatusNotImplemented, "This endpoint is not available in sandbox mode")
+}
+
+// sandboxAppResponse converts a simulated app to the API's app shape
+func sandboxAppResponse(app *services.SandboxApp) App {
+	resp := App{
+		ID:        app.ID,
+		Name:      app.Name,
+		Slug:      app.Slug,
+		Status:    app.Status,
+		URL:       app.URL,
+		RepoURL:   app.RepoURL,
+		Branch:    app.Branch,
+		CreatedAt: app.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: app.UpdatedAt.Format(time.RFC3339),
+	}
+	if app.Active != nil {
+		resp.Deployment = &AppDeployment{
+			ActiveDeploymentID: fmt.Sprintf("dep_%s", app.Active.ID), // Same prefix as real apps
+			LastDeployedAt:     app.Active.UpdatedAt.Format(time.RFC3339),
+			State:              app.Active.Status,
+			ResourceLimits: &ResourceLimits{
+				MemoryMB: 512,
+				CPU:      1,
+				DiskGB:   10,
+			},
+			UsageStats: &UsageStats{},
+		}
+	}
+	return resp
+}
+
+// sandboxDeploymentResponse converts a simulated deployment to the API's deployment shape
+func sandboxDeploymentResponse(d *services.SandboxDeployment) Deployment {
+	resp := Deployment{
+		ID:        d.ID,
+		AppID:     d.AppID,
+		Status:    d.Status,
+		CreatedAt: d.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: d.UpdatedAt.Format(time.RFC3339),
+	}
+	if d.ImageName != "" {
+		resp.ImageName = d.ImageName
+	}
+	if d.BuildLog != "" {
+		resp.BuildLog = d.BuildLog
+	}
+	if d.ErrorMessage != "" {
+		resp.ErrorMessage = d.ErrorMessage
+	}
+	return resp
+}
+
+func (h *SandboxHandlers) getUserIDFromContext(r *http.Request) string {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		h.logger.Warn("User ID not found in context")
+		return ""
+	}
+	return userID
+}
+
+func (h *SandboxHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *SandboxHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/services"
+)
+
+// SecretScanSettings is what an app's builds do about credentials committed to its source
+// It is the request and response body of /api/v1/apps/{id}/secret-scan
+type SecretScanSettings struct {
+	SecretScan string `json:"secret_scan"` // warn (default), block or off
+}
+
+// GET /api/v1/apps/{id}/secret-scan - Get what the app's builds do about committed credentials
+func (h *Handlers) GetSecretScan(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+
+	mode, err := h.appRepo.GetSecretScanMode(r.Context(), app.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve secret scan mode")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, SecretScanSettings{SecretScan: mode})
+}
+
+// PUT /api/v1/apps/{id}/secret-scan - Warn about committed credentials, fail builds on them, or skip the scan
+// It takes effect on the next build
+func (h *Handlers) UpdateSecretScan(w http.ResponseWriter, r *http.Request) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+
+	var req SecretScanSettings
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.SecretScan = strings.ToLower(strings.TrimSpace(req.SecretScan))
+	if !services.ValidSecretScanMode(req.SecretScan) {
+		h.writeError(w, http.StatusBadRequest, "secret_scan must be warn, block or off")
+		return
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return
+	}
+	if app.Source == services.AppSourceImage {
+		h.writeError(w, http.StatusBadRequest, "Image apps are not built from source - there is nothing to scan")
+		return
+	}
+
+	if err := h.appRepo.SetSecretScanMode(r.Context(), app.ID, req.SecretScan); err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to update secret scan mode")
+		return
+	}
+	h.logger.Info("Secret scan mode updated",
+		zap.String("app_id", app.ID),
+		zap.String("secret_scan", req.SecretScan),
+		zap.String("user_id", userID),
+	)
+
+	h.writeJSON(w, http.StatusOK, req)
+}
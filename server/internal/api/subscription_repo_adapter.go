@@ -40,6 +40,21 @@ func (a *SubscriptionRepoAdapter) UpdateSubscriptionByUserID(ctx context.Context
 	return a.repo.UpdateSubscriptionByUserID(ctx, userID, plan, status, ramLimitMB, diskLimitGB, lemonSubID)
 }
 
+// StartGracePeriod moves a user's subscription into read-only grace mode
+func (a *SubscriptionRepoAdapter) StartGracePeriod(ctx context.Context, userID string, graceEndsAt time.Time) error {
+	return a.repo.StartGracePeriod(ctx, userID, graceEndsAt)
+}
+
+// SetSubscriptionPeriod records when a user's current billing period ends
+func (a *SubscriptionRepoAdapter) SetSubscriptionPeriod(ctx context.Context, userID string, periodEnd time.Time, startedAt *time.Time) error {
+	return a.repo.SetSubscriptionPeriod(ctx, userID, periodEnd, startedAt)
+}
+
+// SetCancelAtPeriodEnd marks a user's active subscription as cancelled once its current period ends
+func (a *SubscriptionRepoAdapter) SetCancelAtPeriodEnd(ctx context.Context, userID string) error {
+	return a.repo.SetCancelAtPeriodEnd(ctx, userID)
+}
+
 // GetTrialSubscriptions retrieves all trial subscriptions that need processing
 func (a *SubscriptionRepoAdapter) GetTrialSubscriptions(ctx context.Context) ([]*services.Subscription, error) {
 	subs, err := a.repo.GetTrialSubscriptions(ctx)
@@ -63,6 +78,10 @@ func (a *SubscriptionRepoAdapter) convertSubscription(sub *Subscription) *servic
 		Status:             sub.Status,
 		TrialStartedAt:     sub.TrialStartedAt,
 		TrialEndsAt:        sub.TrialEndsAt,
+		GraceEndsAt:        sub.GraceEndsAt,
+		CurrentPeriodStart: sub.CurrentPeriodStart,
+		CurrentPeriodEnd:   sub.CurrentPeriodEnd,
+		CancelAtPeriodEnd:  sub.CancelAtPeriodEnd,
 		RAMLimitMB:         sub.RAMLimitMB,
 		DiskLimitGB:        sub.DiskLimitGB,
 		CreatedAt:          sub.CreatedAt,
@@ -109,3 +128,7 @@ func (a *UserRepoAdapter) UpdateUserBilling(ctx context.Context, userID, billing
 	return a.repo.UpdateUserBilling(ctx, userID, billingStatus, plan, subscriptionID, trialStartedAt, trialEndsAt)
 }
 
+// UpdateUserGracePeriod implements services.UserBillingUpdater interface
+func (a *UserRepoAdapter) UpdateUserGracePeriod(ctx context.Context, userID string, graceEndsAt time.Time) error {
+	return a.repo.UpdateUserGracePeriod(ctx, userID, graceEndsAt)
+}
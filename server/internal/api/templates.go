@@ -0,0 +1,148 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/services"
+)
+
+// DeployTemplateRequest is the body for POST /api/v1/templates/{id}/deploy (the body is optional)
+type DeployTemplateRequest struct {
+	Name           string            `json:"name,omitempty" validate:"max=100"`                 // Defaults to the template ID
+	Slug           string            `json:"slug,omitempty" validate:"omitempty,slug"`          // Optional (generated from the name if not provided)
+	OrganizationID string            `json:"organization_id,omitempty"`                         // Optional - deploy the app in an organization
+	Env            map[string]string `json:"env,omitempty" validate:"dive,keys,envkey,endkeys"` // Values for the template's env vars, and any others to set
+}
+
+// DeployTemplateResponse is the response of POST /api/v1/templates/{id}/deploy
+type DeployTemplateResponse struct {
+	App        App      `json:"app"`
+	BuildJobID string   `json:"build_job_id,omitempty"`
+	Env        []string `json:"env"`    // Keys of the env vars created, including generated secrets
+	Addons     []string `json:"addons"` // Services the app needs - their URLs were supplied as env vars
+}
+
+// GET /api/v1/templates - List the templates that can be deployed in one call
+func (h *Handlers) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, services.AppTemplates())
+}
+
+// GET /api/v1/templates/from-repo?repo_url=&branch=&root_dir= - Read the env vars and add-ons a repository
+// declares in its stackyn.json or app.json, to prompt for before creating the app
+func (h *Handlers) GetRepoAppJSON(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	repoURL := strings.TrimSpace(query.Get("repo_url"))
+	branch := strings.TrimSpace(query.Get("branch"))
+	if branch == "" {
+		branch = "main"
+	}
+	rootDir, err := services.NormalizeRootDir(query.Get("root_dir"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid root directory: %s", err.Error()))
+		return
+	}
+
+	if h.constraintsService != nil {
+		if err := h.constraintsService.ValidateRepoURL(r.Context(), repoURL); err != nil {
+			if constraintErr, ok := GetConstraintError(err); ok {
+				writeConstraintError(w, constraintErr)
+				return
+			}
+			h.writeError(w, http.StatusBadRequest, "Repository URL validation failed")
+			return
+		}
+	}
+	if h.gitService == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Repository lookups are not available")
+		return
+	}
+
+	appJSON, err := h.gitService.FetchAppJSON(r.Context(), repoURL, branch, rootDir)
+	if err != nil {
+		if errors.Is(err, services.ErrRepoFileNotFound) {
+			h.writeError(w, http.StatusNotFound, "The repository has no stackyn.json or app.json")
+			return
+		}
+		h.logger.Warn("Failed to read app.json", zap.Error(err), zap.String("repo_url", repoURL))
+		h.writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	h.writeJSON(w, http.StatusOK, appJSON)
+}
+
+// POST /api/v1/templates/{id}/deploy - Create an app from a template and deploy it
+// Env vars without a supplied value get their generated or default value; required ones left without
+// a value fail the request before the app is created
+func (h *Handlers) DeployTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := services.GetAppTemplate(chi.URLParam(r, "id"))
+	if !ok {
+		h.writeError(w, http.StatusNotFound, "Template not found")
+		return
+	}
+
+	var req DeployTemplateRequest
+	if r.ContentLength != 0 {
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+	}
+	env, missing, err := services.ResolveTemplateEnv(template.Env, req.Env)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to generate env vars")
+		return
+	}
+	if len(missing) > 0 {
+		h.writeError(w, http.StatusBadRequest, fmt.Sprintf("Values are required for: %s", strings.Join(missing, ", ")))
+		return
+	}
+	for key, value := range req.Env {
+		env[key] = value
+	}
+
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	envVars := make([]CreateEnvVarRequest, 0, len(keys))
+	for _, key := range keys {
+		envVars = append(envVars, CreateEnvVarRequest{Key: key, Value: env[key]})
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = template.ID
+	}
+	createReq := CreateAppRequest{
+		Name:           name,
+		Slug:           req.Slug,
+		RepoURL:        template.RepoURL,
+		Branch:         template.Branch,
+		RootDir:        template.RootDir,
+		EnvVars:        envVars,
+		OrganizationID: req.OrganizationID,
+	}
+	app, buildJobID, ok := h.createApp(w, r, &createReq, nil)
+	if !ok {
+		return
+	}
+
+	h.logger.Info("App deployed from template",
+		zap.String("app_id", app.ID),
+		zap.String("template", template.ID),
+		zap.String("user_id", h.getUserIDFromContext(r)),
+	)
+	h.writeJSON(w, http.StatusCreated, DeployTemplateResponse{
+		App:        *app,
+		BuildJobID: buildJobID,
+		Env:        keys,
+		Addons:     template.Addons,
+	})
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// API token prefixes - the mode is visible in the token itself so a leaked token is easy to triage
+const (
+	APITokenLivePrefix    = "stk_live_"
+	APITokenSandboxPrefix = "stk_test_" // Served by the in-memory sandbox; never touches real apps
+)
+
+// maxAPITokensPerUser bounds how many active tokens a user can hold
+const maxAPITokensPerUser = 25
+
+// APIToken is an API token as listed to its owner (the secret is never stored)
+type APIToken struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Prefix     string `json:"prefix"` // First characters of the token, to tell tokens apart
+	Sandbox    bool   `json:"sandbox"`
+	LastUsedAt string `json:"last_used_at,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// APITokenOwner is who an API token authenticates as
+type APITokenOwner struct {
+	TokenID string
+	UserID  string
+	Email   string
+	Sandbox bool
+}
+
+// CreateAPITokenRequest is the body for POST /api/v1/tokens
+type CreateAPITokenRequest struct {
+	Name    string `json:"name" validate:"notblank,max=255"`
+	Sandbox bool   `json:"sandbox"`
+}
+
+// CreateAPITokenResponse includes the raw token, which is only ever returned here
+type CreateAPITokenResponse struct {
+	APIToken
+	Token string `json:"token"`
+}
+
+// APITokenHandlers manages a user's API tokens
+type APITokenHandlers struct {
+	logger    *zap.Logger
+	tokenRepo *APITokenRepo
+}
+
+// NewAPITokenHandlers creates a new API token handlers instance
+func NewAPITokenHandlers(logger *zap.Logger, tokenRepo *APITokenRepo) *APITokenHandlers {
+	return &APITokenHandlers{
+		logger:    logger,
+		tokenRepo: tokenRepo,
+	}
+}
+
+// GET /api/v1/tokens - List the user's API tokens
+func (h *APITokenHandlers) ListTokens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.tokenRepo.ListAPITokens(r.Context(), userID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve API tokens")
+		return
+	}
+	if tokens == nil {
+		tokens = []*APIToken{}
+	}
+
+	h.writeJSON(w, http.StatusOK, tokens)
+}
+
+// POST /api/v1/tokens - Create an API token (sandbox tokens simulate apps, builds and deploys)
+func (h *APITokenHandlers) CreateToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateAPITokenRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+
+	existing, err := h.tokenRepo.ListAPITokens(r.Context(), userID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to create API token")
+		return
+	}
+	if len(existing) >= maxAPITokensPerUser {
+		h.writeError(w, http.StatusForbidden, "API token limit reached. Revoke an unused token first.")
+		return
+	}
+
+	raw, prefix, tokenHash, err := generateAPIToken(req.Sandbox)
+	if err != nil {
+		h.logger.Error("Failed to generate API token", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Failed to create API token")
+		return
+	}
+
+	token, err := h.tokenRepo.CreateAPIToken(r.Context(), userID, req.Name, prefix, tokenHash, req.Sandbox)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to create API token")
+		return
+	}
+
+	h.logger.Info("API token created",
+		zap.String("user_id", userID),
+		zap.String("token_id", token.ID),
+		zap.Bool("sandbox", token.Sandbox),
+	)
+	h.writeJSON(w, http.StatusCreated, CreateAPITokenResponse{APIToken: *token, Token: raw})
+}
+
+// DELETE /api/v1/tokens/{tokenId} - Revoke an API token
+func (h *APITokenHandlers) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireSession(w, r)
+	if !ok {
+		return
+	}
+	tokenID := chi.URLParam(r, "tokenId")
+
+	if err := h.tokenRepo.RevokeAPIToken(r.Context(), userID, tokenID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "API token not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to revoke API token")
+		return
+	}
+
+	h.logger.Info("API token revoked", zap.String("user_id", userID), zap.String("token_id", tokenID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireSession returns the user ID, rejecting requests authenticated with an API token or made while
+// impersonating. Tokens cannot mint or revoke tokens, so a leaked token cannot entrench itself, and an admin
+// cannot mint a long-lived token that outlives the impersonation session
+func (h *APITokenHandlers) requireSession(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return "", false
+	}
+	if _, viaToken := r.Context().Value("api_token_id").(string); viaToken {
+		h.writeError(w, http.StatusForbidden, "API tokens cannot be managed with an API token")
+		return "", false
+	}
+	if _, impersonated := r.Context().Value("impersonation_id").(string); impersonated {
+		h.writeError(w, http.StatusForbidden, "API tokens cannot be managed while impersonating")
+		return "", false
+	}
+	return userID, true
+}
+
+func (h *APITokenHandlers) getUserIDFromContext(r *http.Request) string {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		h.logger.Warn("User ID not found in context")
+		return ""
+	}
+	return userID
+}
+
+func (h *APITokenHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *APITokenHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
+
+// generateAPIToken returns a new raw token, its display prefix and the SHA-256 hash stored for it
+func generateAPIToken(sandbox bool) (token, prefix, tokenHash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	mode := APITokenLivePrefix
+	if sandbox {
+		mode = APITokenSandboxPrefix
+	}
+	token = mode + hex.EncodeToString(b)
+	return token, token[:len(mode)+8], hashAPIToken(token), nil
+}
+
+func hashAPIToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// isAPIToken reports whether a bearer credential is an API token rather than a session JWT
+func isAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenLivePrefix) || strings.HasPrefix(token, APITokenSandboxPrefix)
+}
+
+// APITokenMiddleware authenticates "Bearer stk_..." API tokens and hands every other request to
+// sessionAuth (JWT or header auth). Adds the same context values as the session middlewares plus
+// api_token_id and sandbox. Sandbox tokens are only accepted where allowSandbox is set - routes
+// that serve them from the simulator - so they can never reach real resources
+func APITokenMiddleware(tokenRepo *APITokenRepo, allowSandbox bool, sessionAuth func(http.Handler) http.Handler, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		sessionHandler := sessionAuth(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !isAPIToken(token) {
+				sessionHandler.ServeHTTP(w, r)
+				return
+			}
+
+			owner, err := tokenRepo.GetAPITokenOwner(r.Context(), hashAPIToken(token))
+			if err != nil {
+				if !errors.Is(err, pgx.ErrNoRows) {
+					logger.Error("Failed to look up API token", zap.Error(err))
+				}
+				writeAPIError(w, http.StatusUnauthorized, "", "Invalid or revoked API token", nil)
+				return
+			}
+			if owner.Sandbox && !allowSandbox {
+				writeAPIError(w, http.StatusForbidden, "", "Sandbox tokens can only be used with the apps and deployments API", nil)
+				return
+			}
+
+			if err := tokenRepo.TouchAPIToken(r.Context(), owner.TokenID); err != nil {
+				logger.Warn("Failed to record API token use", zap.Error(err), zap.String("token_id", owner.TokenID))
+			}
+
+			ctx := context.WithValue(r.Context(), "user_id", owner.UserID)
+			ctx = context.WithValue(ctx, "user_email", owner.Email)
+			ctx = context.WithValue(ctx, "api_token_id", owner.TokenID)
+			ctx = context.WithValue(ctx, "sandbox", owner.Sandbox)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestRequireSession(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]string
+		want   int
+	}{
+		{"session", map[string]string{"user_id": "user-1"}, http.StatusOK},
+		{"signed out", nil, http.StatusUnauthorized},
+		{"API token", map[string]string{"user_id": "user-1", "api_token_id": "token-1"}, http.StatusForbidden},
+		{"impersonating", map[string]string{"user_id": "user-1", "impersonation_id": "imp-1"}, http.StatusForbidden},
+	}
+
+	h := NewAPITokenHandlers(zap.NewNop(), nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			for key, value := range tt.values {
+				ctx = context.WithValue(ctx, key, value)
+			}
+			rec := httptest.NewRecorder()
+			userID, ok := h.requireSession(rec, httptest.NewRequest(http.MethodPost, "/api/v1/tokens", nil).WithContext(ctx))
+			if ok != (tt.want == http.StatusOK) {
+				t.Fatalf("requireSession ok = %v, want status %d", ok, tt.want)
+			}
+			if ok && userID != "user-1" {
+				t.Errorf("userID = %q, want user-1", userID)
+			}
+			if !ok && rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
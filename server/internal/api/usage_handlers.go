@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// UsageHandlers serves per-user usage and quota information
+type UsageHandlers struct {
+	logger       *zap.Logger
+	usageService *services.UsageService
+}
+
+// NewUsageHandlers creates a new usage handlers instance
+func NewUsageHandlers(logger *zap.Logger, usageService *services.UsageService) *UsageHandlers {
+	return &UsageHandlers{
+		logger:       logger,
+		usageService: usageService,
+	}
+}
+
+// GET /api/v1/usage - Get usage vs plan limits for the current billing period
+func (h *UsageHandlers) GetUsage(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	summary, err := h.usageService.GetUsageSummary(r.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to get usage summary", zap.Error(err), zap.String("user_id", userID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve usage")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, summary)
+}
+
+// GET /api/v1/usage/build-minutes - Get build minutes used this month, broken down by app
+func (h *UsageHandlers) GetBuildMinutes(w http.ResponseWriter, r *http.Request) {
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+
+	usage, err := h.usageService.GetBuildMinutesUsage(r.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to get build minutes usage", zap.Error(err), zap.String("user_id", userID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve build minutes usage")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, usage)
+}
+
+func (h *UsageHandlers) getUserIDFromContext(r *http.Request) string {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		h.logger.Warn("User ID not found in context")
+		return ""
+	}
+	return userID
+}
+
+func (h *UsageHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *UsageHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
@@ -1,39 +1,170 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
-	"go.uber.org/zap"
+
+	stackynerrors "stackyn/server/internal/errors"
+	"stackyn/server/internal/services"
 )
 
+// slugPattern is the format of app and organization slugs: 1-32 lowercase letters, digits and hyphens,
+// starting and ending with a letter or digit
+var slugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,30}[a-z0-9])?$`)
+
 var validate *validator.Validate
 
 func init() {
-	validate = validator.New()
+	validate = validator.New(validator.WithRequiredStructEnabled())
+
+	// Violations name fields as clients send them (env_vars[0].key rather than EnvVars[0].Key)
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	// Rules of the request DTOs beyond the validator's own
+	validate.RegisterValidation("notblank", func(fl validator.FieldLevel) bool {
+		return strings.TrimSpace(fl.Field().String()) != ""
+	})
+	validate.RegisterValidation("slug", func(fl validator.FieldLevel) bool {
+		return slugPattern.MatchString(fl.Field().String())
+	})
+	validate.RegisterValidation("envkey", func(fl validator.FieldLevel) bool {
+		return services.ValidateEnvKey(fl.Field().String()) == nil
+	})
+	validate.RegisterValidation("repourl", func(fl validator.FieldLevel) bool {
+		return validRepoURL(fl.Field().String())
+	})
+}
+
+// validRepoURL reports whether s is an HTTP(S) repository URL naming an owner and a repository
+// Which Git hosts are accepted is up to the constraints service
+func validRepoURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return false
+	}
+	owner, repo, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	return owner != "" && repo != ""
+}
+
+// FieldViolation is one rule a request field broke; the details of VALIDATION_FAILED errors list them
+type FieldViolation struct {
+	Field   string `json:"field"` // JSON path of the field, e.g. env_vars[0].key
+	Rule    string `json:"rule"`  // Rule it broke, e.g. required, max, slug
+	Message string `json:"message"`
+}
+
+// decodeJSON decodes the JSON body of r into dst and validates it against dst's validate tags, writing the
+// error response and returning false when it can't be used: 413 past the body limit (MaxBodyBytes),
+// 400 for malformed JSON and 422 VALIDATION_FAILED listing the fields that break their rules
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	return decodeJSONBody(w, r, dst, false)
 }
 
-// ValidateRequest validates a struct using the validator package
-func ValidateRequest(logger *zap.Logger, w http.ResponseWriter, r *http.Request, req interface{}) bool {
-	if err := validate.Struct(req); err != nil {
-		validationErrors := err.(validator.ValidationErrors)
-		logger.Warn("Validation failed",
-			zap.String("path", r.URL.Path),
-			zap.Error(err),
-		)
+// decodeOptionalJSON is decodeJSON for endpoints whose body may be left out; an empty body validates
+// the zero value of dst
+func decodeOptionalJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	return decodeJSONBody(w, r, dst, true)
+}
 
-		// Return validation errors
-		respondWithError(w, http.StatusBadRequest, "Validation failed", validationErrors)
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}, optional bool) bool {
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil && !(optional && errors.Is(err, io.EOF)) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, "", fmt.Sprintf("Request body must be at most %d bytes", tooLarge.Limit), nil)
+			return false
+		}
+		writeAPIError(w, http.StatusBadRequest, "", "Invalid request body", nil)
 		return false
 	}
-	return true
+	return validateRequest(w, dst)
 }
 
-// respondWithError is a helper to send error responses
-func respondWithError(w http.ResponseWriter, status int, message string, details interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	// TODO: Implement proper JSON error response
-	w.Write([]byte(`{"error":"` + message + `"}`))
+// validateRequest validates req against its validate tags, writing a 422 listing the violations and
+// returning false when it breaks any
+func validateRequest(w http.ResponseWriter, req interface{}) bool {
+	err := validate.Struct(req)
+	if err == nil {
+		return true
+	}
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		writeAPIError(w, http.StatusBadRequest, "", "Invalid request body", nil)
+		return false
+	}
+
+	violations := make([]FieldViolation, 0, len(validationErrors))
+	for _, fieldErr := range validationErrors {
+		field := fieldErr.Namespace()
+		if _, rest, ok := strings.Cut(field, "."); ok {
+			field = rest // Drop the request type
+		}
+		violations = append(violations, FieldViolation{
+			Field:   field,
+			Rule:    fieldErr.Tag(),
+			Message: violationMessage(field, fieldErr),
+		})
+	}
+	writeAPIError(w, http.StatusUnprocessableEntity, stackynerrors.ErrorCodeValidationFailed, "Validation failed", violations)
+	return false
 }
 
+// violationMessage describes a broken rule for people
+func violationMessage(field string, fieldErr validator.FieldError) string {
+	unit := "characters"
+	switch fieldErr.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = "items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		unit = ""
+	}
+
+	switch fieldErr.Tag() {
+	case "required", "notblank":
+		return field + " is required"
+	case "max":
+		if unit == "" {
+			return fmt.Sprintf("%s must be at most %s", field, fieldErr.Param())
+		}
+		return fmt.Sprintf("%s must be at most %s %s", field, fieldErr.Param(), unit)
+	case "min":
+		if unit == "" {
+			return fmt.Sprintf("%s must be at least %s", field, fieldErr.Param())
+		}
+		return fmt.Sprintf("%s must be at least %s %s", field, fieldErr.Param(), unit)
+	case "len":
+		return fmt.Sprintf("%s must be exactly %s %s", field, fieldErr.Param(), unit)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.Join(strings.Fields(fieldErr.Param()), ", "))
+	case "email":
+		return field + " must be a valid email address"
+	case "url", "http_url":
+		return field + " must be a valid URL"
+	case "uuid", "uuid4":
+		return field + " must be a UUID"
+	case "slug":
+		return field + " must be 1-32 lowercase letters, digits and hyphens, starting and ending with a letter or digit"
+	case "envkey":
+		return field + " must start with a letter or underscore and contain only letters, digits and underscores"
+	case "repourl":
+		return field + " must be a repository URL such as https://github.com/owner/repo"
+	}
+	return fmt.Sprintf("%s is invalid (%s)", field, fieldErr.Tag())
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlugValidation(t *testing.T) {
+	tests := []struct {
+		slug  string
+		valid bool
+	}{
+		{"a", true},
+		{"7", true},
+		{"ab", true},
+		{"a-b", true},
+		{"my-app-2", true},
+		{strings.Repeat("a", 32), true},
+		{"a" + strings.Repeat("-", 30) + "b", true},
+		{strings.Repeat("a", 33), false},
+		{"", false},
+		{"-", false},
+		{"a-", false},
+		{"-a", false},
+		{"My-App", false},
+		{"my_app", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.slug, func(t *testing.T) {
+			if got := slugPattern.MatchString(tt.slug); got != tt.valid {
+				t.Errorf("slugPattern.MatchString(%q) = %v, want %v", tt.slug, got, tt.valid)
+			}
+			if err := validate.Var(tt.slug, "slug"); (err == nil) != tt.valid {
+				t.Errorf("validate %q with the slug tag: err = %v, want valid %v", tt.slug, err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// DeploymentVulnerabilities is the vulnerability scan of a deployment's image
+type DeploymentVulnerabilities struct {
+	DeploymentID    string                       `json:"deployment_id"`
+	BuildJobID      string                       `json:"build_job_id,omitempty"`
+	Status          string                       `json:"status"` // completed, failed or not_scanned
+	Scanner         string                       `json:"scanner,omitempty"`
+	Image           string                       `json:"image,omitempty"`
+	Counts          services.VulnerabilityCounts `json:"counts"`
+	Vulnerabilities []services.Vulnerability     `json:"vulnerabilities"` // Most severe first
+	Error           string                       `json:"error,omitempty"`
+	ScannedAt       string                       `json:"scanned_at,omitempty"`
+}
+
+// imageNotScanned is the status of deployments whose image has no scan (registry images, builds before
+// scanning was enabled, workers without the scanner)
+const imageNotScanned = "not_scanned"
+
+// SetImageScanRepo sets the repository of image vulnerability scans
+func (h *Handlers) SetImageScanRepo(imageScanRepo *ImageScanRepo) {
+	h.imageScanRepo = imageScanRepo
+}
+
+// GET /api/v1/deployments/{id}/vulnerabilities - Known vulnerabilities in the deployment's image
+// Found by the scan the build worker runs after each successful build
+func (h *Handlers) GetDeploymentVulnerabilities(w http.ResponseWriter, r *http.Request) {
+	deploymentID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return
+	}
+	if h.imageScanRepo == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Vulnerability scans are not available")
+		return
+	}
+
+	deploymentData, err := h.deploymentRepo.GetDeploymentByID(deploymentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Deployment not found")
+			return
+		}
+		h.logger.Error("Failed to get deployment", zap.Error(err), zap.String("deployment_id", deploymentID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve deployment")
+		return
+	}
+
+	appID, _ := deploymentData["app_id"].(string)
+	if _, err := h.appRepo.GetAppByID(appID, userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Deployment not found or access denied")
+			return
+		}
+		h.logger.Error("Failed to verify app ownership", zap.Error(err), zap.String("app_id", appID), zap.String("user_id", userID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to verify deployment access")
+		return
+	}
+
+	result := DeploymentVulnerabilities{
+		DeploymentID:    deploymentID,
+		Status:          imageNotScanned,
+		Vulnerabilities: []services.Vulnerability{},
+	}
+	buildJobID, _ := deploymentData["build_job_id"].(string)
+	if buildJobID == "" {
+		h.writeJSON(w, http.StatusOK, result)
+		return
+	}
+	result.BuildJobID = buildJobID
+
+	scan, err := h.imageScanRepo.GetImageScan(r.Context(), buildJobID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve vulnerability scan")
+		return
+	}
+	if scan != nil {
+		result.Status = scan.Status
+		result.Scanner = scan.Scanner
+		result.Image = scan.ImageName
+		result.Counts = scan.Counts
+		result.Error = scan.Error
+		result.ScannedAt = scan.ScannedAt.Format(time.RFC3339)
+		if scan.Vulnerabilities != nil {
+			result.Vulnerabilities = scan.Vulnerabilities
+		}
+	}
+	h.writeJSON(w, http.StatusOK, result)
+}
+
+// OrgSecurityPolicy is the policy the deploys of an organization's apps are held to
+// It is the request and response body of /api/v1/orgs/{orgId}/security-policy
+type OrgSecurityPolicy struct {
+	BlockCriticalVulnerabilities bool `json:"block_critical_vulnerabilities"` // Fail deploys of images whose scan found critical vulnerabilities
+}
+
+// GET /api/v1/orgs/{orgId}/security-policy - Get the organization's deploy security policy
+func (h *OrganizationHandlers) GetSecurityPolicy(w http.ResponseWriter, r *http.Request) {
+	org, ok := h.getOrgWithRole(w, r, OrgRoleViewer)
+	if !ok {
+		return
+	}
+
+	policy, err := h.orgRepo.GetSecurityPolicy(r.Context(), org.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve security policy")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, policy)
+}
+
+// PUT /api/v1/orgs/{orgId}/security-policy - Change the organization's deploy security policy (admin or owner)
+// It applies to the next deploy of each of its apps, including redeploys and rollbacks of scanned images
+func (h *OrganizationHandlers) UpdateSecurityPolicy(w http.ResponseWriter, r *http.Request) {
+	org, ok := h.getOrgWithRole(w, r, OrgRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req OrgSecurityPolicy
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := h.orgRepo.SetSecurityPolicy(r.Context(), org.ID, req); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Organization not found")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to update security policy")
+		return
+	}
+
+	h.logger.Info("Organization security policy updated",
+		zap.String("organization_id", org.ID),
+		zap.Bool("block_critical_vulnerabilities", req.BlockCriticalVulnerabilities),
+		zap.String("updated_by", h.getUserIDFromContext(r)),
+	)
+	h.writeJSON(w, http.StatusOK, req)
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// maxWAFHitsPageSize bounds GET /api/v1/apps/{id}/waf/hits
+const maxWAFHitsPageSize = 100
+
+// UpdateWAFRequest is the body for PUT /api/v1/apps/{id}/waf
+type UpdateWAFRequest struct {
+	Preset string `json:"preset"`
+	Mode   string `json:"mode"` // monitor (default) | block
+}
+
+// WAFHandlers manages per-app WAF presets and serves their hits log
+type WAFHandlers struct {
+	logger         *zap.Logger
+	appRepo        *AppRepo
+	wafRepo        *WAFRepo
+	deploymentRepo *DeploymentRepo
+	taskEnqueue    *services.TaskEnqueueService
+}
+
+// NewWAFHandlers creates a new WAF handlers instance
+func NewWAFHandlers(logger *zap.Logger, appRepo *AppRepo, wafRepo *WAFRepo, deploymentRepo *DeploymentRepo, taskEnqueue *services.TaskEnqueueService) *WAFHandlers {
+	return &WAFHandlers{
+		logger:         logger,
+		appRepo:        appRepo,
+		wafRepo:        wafRepo,
+		deploymentRepo: deploymentRepo,
+		taskEnqueue:    taskEnqueue,
+	}
+}
+
+// GET /api/v1/waf/presets - List the WAF presets apps can opt into
+func (h *WAFHandlers) ListWAFPresets(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, services.WAFPresets())
+}
+
+// GET /api/v1/apps/{id}/waf - Get the app's WAF settings (404 when the WAF is off)
+func (h *WAFHandlers) GetAppWAF(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getOwnedApp(w, r)
+	if !ok {
+		return
+	}
+
+	waf, err := h.wafRepo.GetAppWAFSettings(r.Context(), app.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "WAF is not enabled for this app")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve WAF settings")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, waf)
+}
+
+// PUT /api/v1/apps/{id}/waf - Enable the WAF or change its preset and mode
+// The running deployment is redeployed so its routes pass through the new middleware
+func (h *WAFHandlers) UpdateAppWAF(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getOwnedApp(w, r)
+	if !ok {
+		return
+	}
+	userID := h.getUserIDFromContext(r)
+
+	var req UpdateWAFRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Preset = strings.TrimSpace(req.Preset)
+	req.Mode = strings.ToLower(strings.TrimSpace(req.Mode))
+	if req.Mode == "" {
+		req.Mode = services.WAFModeMonitor // Monitor first so false positives show up before anything is blocked
+	}
+	if err := services.ValidateWAFConfig(services.WAFConfig{Preset: req.Preset, Mode: req.Mode}); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	waf, err := h.wafRepo.SetAppWAF(r.Context(), app.ID, req.Preset, req.Mode)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to save WAF settings")
+		return
+	}
+
+	h.logger.Info("App WAF updated",
+		zap.String("app_id", app.ID),
+		zap.String("preset", waf.Preset),
+		zap.String("mode", waf.Mode),
+		zap.String("user_id", userID),
+	)
+
+	enqueueRouteRefresh(r.Context(), h.logger, h.taskEnqueue, h.deploymentRepo, app.ID, userID, "WAF")
+
+	h.writeJSON(w, http.StatusOK, waf)
+}
+
+// DELETE /api/v1/apps/{id}/waf - Turn the WAF off (recorded hits are kept until they expire)
+func (h *WAFHandlers) DeleteAppWAF(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getOwnedApp(w, r)
+	if !ok {
+		return
+	}
+	userID := h.getUserIDFromContext(r)
+
+	if err := h.wafRepo.DeleteAppWAF(r.Context(), app.ID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "WAF is not enabled for this app")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to disable WAF")
+		return
+	}
+
+	h.logger.Info("App WAF disabled", zap.String("app_id", app.ID), zap.String("user_id", userID))
+
+	enqueueRouteRefresh(r.Context(), h.logger, h.taskEnqueue, h.deploymentRepo, app.ID, userID, "WAF")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/v1/apps/{id}/waf/hits - List recent WAF rule matches, newest first
+// ?action=detected|blocked filters by what the WAF did, ?limit= caps the page (default 50)
+func (h *WAFHandlers) ListWAFHits(w http.ResponseWriter, r *http.Request) {
+	app, ok := h.getOwnedApp(w, r)
+	if !ok {
+		return
+	}
+
+	action := r.URL.Query().Get("action")
+	if action != "" && action != "detected" && action != "blocked" {
+		h.writeError(w, http.StatusBadRequest, "action must be \"detected\" or \"blocked\"")
+		return
+	}
+
+	limit := 50
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxWAFHitsPageSize {
+			h.writeError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+
+	hits, err := h.wafRepo.ListWAFHits(r.Context(), app.ID, action, limit)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve WAF hits")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, hits)
+}
+
+// getOwnedApp loads the app from the URL and verifies the current user owns it
+// Writes the error response and returns false on failure
+func (h *WAFHandlers) getOwnedApp(w http.ResponseWriter, r *http.Request) (*App, bool) {
+	appID := chi.URLParam(r, "id")
+	userID := h.getUserIDFromContext(r)
+	if userID == "" {
+		h.writeError(w, http.StatusUnauthorized, "User ID not found in context")
+		return nil, false
+	}
+
+	app, err := h.appRepo.GetAppByID(appID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "App not found")
+			return nil, false
+		}
+		h.logger.Error("Failed to get app", zap.Error(err), zap.String("app_id", appID))
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve app")
+		return nil, false
+	}
+	return app, true
+}
+
+func (h *WAFHandlers) getUserIDFromContext(r *http.Request) string {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		h.logger.Warn("User ID not found in context")
+		return ""
+	}
+	return userID
+}
+
+func (h *WAFHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (h *WAFHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, "", message, nil)
+}
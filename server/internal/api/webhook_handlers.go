@@ -6,32 +6,110 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 	"stackyn/server/internal/services"
 )
 
+// lemonSqueezyProvider identifies Lemon Squeezy events in the billing_webhook_events table
+const lemonSqueezyProvider = "lemon_squeezy"
+
+// defaultWebhookTolerance is used when no replay window is configured
+const defaultWebhookTolerance = 15 * time.Minute
+
+// Inbox retry policy: failed attempt n (1-based) is retried after 1m * 2^(n-1), capped at six hours, so the
+// last of 8 attempts happens about 2 hours after the event arrived. An event being applied is leased so
+// concurrent API instances leave it alone
+const (
+	maxBillingWebhookAttempts    = 8
+	billingWebhookBaseRetryDelay = time.Minute
+	billingWebhookMaxRetryDelay  = 6 * time.Hour
+	billingWebhookLease          = 2 * time.Minute
+	billingWebhookRetryBatch     = 20
+)
+
+// billingWebhookRetryDelay returns how long to wait after failed attempt n before the next one
+func billingWebhookRetryDelay(attempt int) time.Duration {
+	delay := billingWebhookBaseRetryDelay
+	for i := 1; i < attempt && delay < billingWebhookMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > billingWebhookMaxRetryDelay {
+		delay = billingWebhookMaxRetryDelay
+	}
+	return delay
+}
+
 // WebhookHandlers handles webhook requests from external services (e.g., Lemon Squeezy)
 type WebhookHandlers struct {
 	logger              *zap.Logger
 	subscriptionService *services.SubscriptionService
 	userRepo            *UserRepo
-	webhookSecret       string // Lemon Squeezy webhook signing secret
+	webhookEventRepo    *WebhookEventRepo            // Records processed event IDs (replay protection)
+	reviewRepo          *BillingReviewRepo           // Admin review queue for events that can't be matched to a user
+	lemonClient         *services.LemonSqueezyClient // Optional: customer email lookup fallback
+	webhookSecret       string                       // Lemon Squeezy webhook signing secret
+	tolerance           time.Duration                // Events older than this are rejected as replays
+	chaos               *services.ChaosInjector      // Optional: drops events on purpose when chaos is enabled
+	auditor             *Auditor                     // Optional: records plan changes in the audit log
+	invoices            *services.InvoiceService     // Optional: billing histories refreshed on billing events
 }
 
 // NewWebhookHandlers creates a new webhook handlers instance
-func NewWebhookHandlers(logger *zap.Logger, subscriptionService *services.SubscriptionService, userRepo *UserRepo, webhookSecret string) *WebhookHandlers {
+func NewWebhookHandlers(logger *zap.Logger, subscriptionService *services.SubscriptionService, userRepo *UserRepo, webhookEventRepo *WebhookEventRepo, reviewRepo *BillingReviewRepo, lemonClient *services.LemonSqueezyClient, webhookSecret string, tolerance time.Duration) *WebhookHandlers {
+	if tolerance <= 0 {
+		tolerance = defaultWebhookTolerance
+	}
 	return &WebhookHandlers{
 		logger:              logger,
 		subscriptionService: subscriptionService,
 		userRepo:            userRepo,
+		webhookEventRepo:    webhookEventRepo,
+		reviewRepo:          reviewRepo,
+		lemonClient:         lemonClient,
 		webhookSecret:       webhookSecret,
+		tolerance:           tolerance,
 	}
 }
 
+// SetChaosInjector enables dropping webhook events on purpose (chaos testing only)
+func (h *WebhookHandlers) SetChaosInjector(chaos *services.ChaosInjector) {
+	h.chaos = chaos
+}
+
+// SetAuditor records the plan changes webhook events make in the audit log
+func (h *WebhookHandlers) SetAuditor(auditor *Auditor) {
+	h.auditor = auditor
+}
+
+// SetInvoiceService drops users' cached billing history when their billing events arrive
+func (h *WebhookHandlers) SetInvoiceService(invoices *services.InvoiceService) {
+	h.invoices = invoices
+}
+
+// auditPlanChange records a plan change made by a billing event
+func (h *WebhookHandlers) auditPlanChange(ctx context.Context, user *User, eventID string, details map[string]interface{}) {
+	if h.auditor == nil {
+		return
+	}
+	details["provider"] = lemonSqueezyProvider
+	details["event_id"] = eventID
+	h.auditor.RecordEvent(ctx, AuditEntry{
+		Action:        AuditActionPlanChange,
+		SubjectUserID: user.ID,
+		Details:       details,
+	})
+}
+
 // LemonSqueezyWebhook handles webhook events from Lemon Squeezy
 // POST /api/webhooks/lemon-squeezy
 func (h *WebhookHandlers) LemonSqueezyWebhook(w http.ResponseWriter, r *http.Request) {
@@ -66,31 +144,109 @@ func (h *WebhookHandlers) LemonSqueezyWebhook(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// Chaos: acknowledge without processing, as if the event had been lost
+	if h.chaos != nil && h.chaos.ShouldDropWebhook(r.Context(), payload.Meta.CustomData.UserID) {
+		h.logger.Warn("Dropping webhook event (chaos fault)", zap.String("event", payload.Meta.EventName))
+		h.writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		return
+	}
+
+	eventID := payload.eventID(body)
+	eventTime := payload.eventTimestamp()
+
 	h.logger.Info("Received Lemon Squeezy webhook",
 		zap.String("event", payload.Meta.EventName),
 		zap.String("type", payload.Data.Type),
+		zap.String("event_id", eventID),
 	)
 
-	// Process webhook event based on type
+	// Reject events outside the replay window (HMAC alone doesn't stop a captured request being resent)
+	if eventTime != nil {
+		age := time.Since(*eventTime)
+		if age > h.tolerance || age < -h.tolerance {
+			h.logger.Warn("Rejecting webhook outside replay window",
+				zap.String("event", payload.Meta.EventName),
+				zap.String("event_id", eventID),
+				zap.Time("event_timestamp", *eventTime),
+				zap.Duration("tolerance", h.tolerance),
+			)
+			h.writeError(w, http.StatusBadRequest, "Webhook event timestamp outside allowed window")
+			return
+		}
+	} else {
+		h.logger.Warn("Webhook event has no timestamp - relying on event ID deduplication only",
+			zap.String("event", payload.Meta.EventName),
+			zap.String("event_id", eventID),
+		)
+	}
+
+	// Record the event and its payload before applying it so duplicate deliveries never double-apply plan
+	// changes and an event that fails to apply is not lost
 	ctx := r.Context()
+	var inboxID string
+	if h.webhookEventRepo != nil {
+		id, received, err := h.webhookEventRepo.ReceiveEvent(ctx, lemonSqueezyProvider, eventID, payload.Meta.EventName, eventTime, body, time.Now().Add(billingWebhookLease))
+		if err != nil {
+			h.writeError(w, http.StatusInternalServerError, "Failed to process webhook")
+			return
+		}
+		if !received {
+			h.logger.Info("Duplicate webhook delivery ignored",
+				zap.String("event", payload.Meta.EventName),
+				zap.String("event_id", eventID),
+			)
+			// Return 200 OK so Lemon Squeezy stops retrying
+			h.writeJSON(w, http.StatusOK, map[string]string{"status": "duplicate"})
+			return
+		}
+		inboxID = id
+	}
+
+	processErr := h.processEvent(ctx, payload, body, eventID)
+	if inboxID != "" {
+		// The outcome is recorded even if the client went away mid-request
+		recordCtx := context.WithoutCancel(ctx)
+		if err := h.recordAttempt(recordCtx, inboxID, 1, processErr); err != nil && processErr != nil {
+			// The retry could not be scheduled - release the event so Lemon Squeezy's retry can apply it
+			h.webhookEventRepo.ReleaseEvent(recordCtx, lemonSqueezyProvider, eventID)
+			h.writeError(w, http.StatusInternalServerError, "Failed to process webhook")
+			return
+		}
+		if processErr != nil {
+			// Kept in the inbox and retried by the API - Lemon Squeezy need not resend it
+			h.writeJSON(w, http.StatusOK, map[string]string{"status": "retrying"})
+			return
+		}
+	}
+
+	if processErr != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to process webhook")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// processEvent applies a billing webhook event based on its type
+// Unhandled event types are accepted without changes
+func (h *WebhookHandlers) processEvent(ctx context.Context, payload LemonSqueezyWebhookPayload, body []byte, eventID string) error {
+	var processErr error
 	switch payload.Meta.EventName {
 	case "subscription_created", "subscription_updated", "invoice_paid":
-		if err := h.handleSubscriptionEvent(ctx, payload); err != nil {
+		if err := h.handleSubscriptionEvent(ctx, payload, body, eventID); err != nil {
 			h.logger.Error("Failed to handle subscription event",
 				zap.Error(err),
 				zap.String("event", payload.Meta.EventName),
 			)
-			h.writeError(w, http.StatusInternalServerError, "Failed to process webhook")
-			return
+			processErr = err
 		}
 	case "subscription_cancelled", "subscription_expired", "invoice_failed":
-		if err := h.handleSubscriptionCancellation(ctx, payload); err != nil {
+		if err := h.handleSubscriptionCancellation(ctx, payload, body, eventID); err != nil {
 			h.logger.Error("Failed to handle subscription cancellation",
 				zap.Error(err),
 				zap.String("event", payload.Meta.EventName),
 			)
-			h.writeError(w, http.StatusInternalServerError, "Failed to process webhook")
-			return
+			processErr = err
 		}
 	default:
 		h.logger.Info("Unhandled webhook event",
@@ -98,8 +254,67 @@ func (h *WebhookHandlers) LemonSqueezyWebhook(w http.ResponseWriter, r *http.Req
 		)
 		// Return 200 OK even for unhandled events (to avoid webhook retries)
 	}
+	return processErr
+}
 
-	h.writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+// recordAttempt records the outcome of attempt (1-based) at applying an inbox event
+// Failed attempts are retried with backoff until maxBillingWebhookAttempts, then the event is failed
+func (h *WebhookHandlers) recordAttempt(ctx context.Context, inboxID string, attempt int, processErr error) error {
+	var nextAttemptAt *time.Time
+	if processErr != nil && attempt < maxBillingWebhookAttempts {
+		next := time.Now().Add(billingWebhookRetryDelay(attempt))
+		nextAttemptAt = &next
+	}
+	if err := h.webhookEventRepo.RecordEventAttempt(ctx, inboxID, processErr, nextAttemptAt); err != nil {
+		h.logger.Error("Failed to record billing webhook attempt", zap.Error(err), zap.String("inbox_id", inboxID), zap.Int("attempt", attempt))
+		return err
+	}
+	return nil
+}
+
+// processStoredEvent applies an event from the inbox; its signature and age were checked when it arrived
+func (h *WebhookHandlers) processStoredEvent(ctx context.Context, event *BillingWebhookEvent) error {
+	var payload LemonSqueezyWebhookPayload
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid stored payload: %w", err)
+	}
+	return h.processEvent(ctx, payload, event.Payload, event.EventID)
+}
+
+// RetryDueWebhookEvents applies the inbox events whose retry is due; returns how many were attempted
+// Called periodically by the billing webhook retrier
+func (h *WebhookHandlers) RetryDueWebhookEvents(ctx context.Context) (int, error) {
+	if h.webhookEventRepo == nil {
+		return 0, nil
+	}
+	events, err := h.webhookEventRepo.ClaimDueEvents(ctx, billingWebhookRetryBatch, time.Now().Add(billingWebhookLease))
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim due webhook events: %w", err)
+	}
+
+	for _, event := range events {
+		attempt := event.Attempts + 1
+		processErr := h.processStoredEvent(ctx, event)
+		if err := h.recordAttempt(ctx, event.ID, attempt, processErr); err != nil {
+			continue
+		}
+		if processErr != nil {
+			h.logger.Warn("Billing webhook event retry failed",
+				zap.Error(processErr),
+				zap.String("event", event.EventName),
+				zap.String("event_id", event.EventID),
+				zap.Int("attempt", attempt),
+				zap.Bool("final", attempt >= maxBillingWebhookAttempts),
+			)
+			continue
+		}
+		h.logger.Info("Billing webhook event applied on retry",
+			zap.String("event", event.EventName),
+			zap.String("event_id", event.EventID),
+			zap.Int("attempt", attempt),
+		)
+	}
+	return len(events), nil
 }
 
 // verifyLemonSqueezySignature verifies the webhook signature using HMAC-SHA256
@@ -124,11 +339,11 @@ func (h *WebhookHandlers) verifyLemonSqueezySignature(body []byte, signature str
 }
 
 // handleSubscriptionEvent handles subscription created/updated events
-func (h *WebhookHandlers) handleSubscriptionEvent(ctx context.Context, payload LemonSqueezyWebhookPayload) error {
+func (h *WebhookHandlers) handleSubscriptionEvent(ctx context.Context, payload LemonSqueezyWebhookPayload, body []byte, eventID string) error {
 	// Extract subscription data from payload
 	// Note: Lemon Squeezy webhook payload structure may vary - adjust as needed
-	subscriptionID := payload.Data.Attributes.SubscriptionID
-	customerID := payload.Data.Attributes.CustomerID
+	subscriptionID := payload.subscriptionID()
+	customerID := string(payload.Data.Attributes.CustomerID)
 	planName := payload.Data.Attributes.PlanName // e.g., "starter", "pro"
 	status := payload.Data.Attributes.Status     // e.g., "active", "cancelled"
 
@@ -139,12 +354,20 @@ func (h *WebhookHandlers) handleSubscriptionEvent(ctx context.Context, payload L
 		zap.String("status", status),
 	)
 
-	// Get user by customer ID (Lemon Squeezy customer ID should be stored in user metadata)
-	// For MVP, we'll use customer ID as email or lookup by external ID
-	// TODO: Add customer_id field to users table or create mapping table
-	user, err := h.userRepo.GetUserByEmail(customerID) // Assuming customerID is email for MVP
+	user, err := h.resolveUser(ctx, payload, body, eventID)
 	if err != nil {
-		return fmt.Errorf("failed to find user for customer ID %s: %w", customerID, err)
+		return err
+	}
+	if user == nil {
+		// Unmatched - parked in the admin review queue
+		return nil
+	}
+	if h.invoices != nil {
+		h.invoices.InvalidateUser(user.ID)
+	}
+
+	if err := h.recordBillingPeriod(ctx, payload, user); err != nil {
+		return err
 	}
 
 	// Get plan limits based on plan name
@@ -163,25 +386,32 @@ func (h *WebhookHandlers) handleSubscriptionEvent(ctx context.Context, payload L
 		); err != nil {
 			return fmt.Errorf("failed to activate subscription: %w", err)
 		}
+		h.auditPlanChange(ctx, user, eventID, map[string]interface{}{"plan": planName, "status": status})
 	} else if status == "cancelled" {
-		// Handle cancellation (set status to cancelled)
-		if err := h.subscriptionService.CancelSubscription(ctx, user.ID); err != nil {
+		// Cancelled subscriptions stay active until the period the user paid for ends
+		if err := h.subscriptionService.CancelAtPeriodEnd(ctx, user.ID); err != nil {
 			return fmt.Errorf("failed to cancel subscription: %w", err)
 		}
+		h.auditPlanChange(ctx, user, eventID, map[string]interface{}{"plan": planName, "status": status})
 	}
 
 	return nil
 }
 
 // handleSubscriptionCancellation handles subscription cancellation/expiration events
-func (h *WebhookHandlers) handleSubscriptionCancellation(ctx context.Context, payload LemonSqueezyWebhookPayload) error {
-	customerID := payload.Data.Attributes.CustomerID
+func (h *WebhookHandlers) handleSubscriptionCancellation(ctx context.Context, payload LemonSqueezyWebhookPayload, body []byte, eventID string) error {
 	eventName := payload.Meta.EventName
 
-	// Get user by customer ID
-	user, err := h.userRepo.GetUserByEmail(customerID) // Assuming customerID is email for MVP
+	user, err := h.resolveUser(ctx, payload, body, eventID)
 	if err != nil {
-		return fmt.Errorf("failed to find user for customer ID %s: %w", customerID, err)
+		return err
+	}
+	if user == nil {
+		// Unmatched - parked in the admin review queue
+		return nil
+	}
+	if h.invoices != nil {
+		h.invoices.InvalidateUser(user.ID)
 	}
 
 	// Handle invoice_failed differently - mark as expired and stop apps
@@ -190,33 +420,371 @@ func (h *WebhookHandlers) handleSubscriptionCancellation(ctx context.Context, pa
 		if err := h.subscriptionService.ExpireSubscription(ctx, user.ID, user.Email); err != nil {
 			return fmt.Errorf("failed to expire subscription: %w", err)
 		}
+		h.auditPlanChange(ctx, user, eventID, map[string]interface{}{"status": "expired", "event": eventName})
+	} else if eventName == "subscription_cancelled" {
+		// User-initiated cancellation - the subscription stays active until the paid period ends
+		if err := h.recordBillingPeriod(ctx, payload, user); err != nil {
+			return err
+		}
+		if err := h.subscriptionService.CancelAtPeriodEnd(ctx, user.ID); err != nil {
+			return fmt.Errorf("failed to cancel subscription: %w", err)
+		}
+		h.auditPlanChange(ctx, user, eventID, map[string]interface{}{"status": "cancelled", "event": eventName})
 	} else {
-		// Cancel subscription (user-initiated cancellation)
+		// The subscription ended - cancel it now
 		if err := h.subscriptionService.CancelSubscription(ctx, user.ID); err != nil {
 			return fmt.Errorf("failed to cancel subscription: %w", err)
 		}
+		h.auditPlanChange(ctx, user, eventID, map[string]interface{}{"status": "cancelled", "event": eventName})
 	}
 
 	return nil
 }
 
+// recordBillingPeriod stores the end of the current billing period from a subscription event
+// Invoice events carry no period and are skipped
+func (h *WebhookHandlers) recordBillingPeriod(ctx context.Context, payload LemonSqueezyWebhookPayload, user *User) error {
+	periodEnd := payload.currentPeriodEnd()
+	if payload.Data.Type != "subscriptions" || periodEnd == nil {
+		return nil
+	}
+	return h.subscriptionService.RecordBillingPeriod(ctx, user.ID, *periodEnd, payload.Data.Attributes.CreatedAt)
+}
+
+// resolveUser finds the Stackyn user a webhook event belongs to
+// Lookup order: custom_data.user_id (set at checkout), the email in the payload,
+// then the Lemon Squeezy customers API by customer_id
+// Returns (nil, nil) when no user matches - the event is added to the admin review queue
+func (h *WebhookHandlers) resolveUser(ctx context.Context, payload LemonSqueezyWebhookPayload, body []byte, eventID string) (*User, error) {
+	customerID := string(payload.Data.Attributes.CustomerID)
+
+	// 1. Explicit user ID passed through checkout custom data
+	if userID := payload.Meta.CustomData.UserID; userID != "" {
+		user, err := h.userRepo.GetUserByID(userID)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to look up user %s: %w", userID, err)
+		}
+		h.logger.Warn("Webhook custom_data.user_id does not match a user - trying email fallback",
+			zap.String("user_id", userID),
+			zap.String("event_id", eventID),
+		)
+	}
+
+	// 2. Email included in the payload (customer_id is kept as a legacy email fallback for MVP payloads)
+	var lastErr error
+	for _, email := range []string{payload.Data.Attributes.UserEmail, customerID} {
+		if email == "" || !strings.Contains(email, "@") {
+			continue
+		}
+		user, err := h.userRepo.GetUserByEmail(email)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to look up user by email: %w", err)
+		}
+	}
+
+	// 3. Ask Lemon Squeezy for the customer's email
+	customerEmail := payload.Data.Attributes.UserEmail
+	if customerID != "" && h.lemonClient.IsConfigured() {
+		email, err := h.lemonClient.GetCustomerEmail(ctx, customerID)
+		if err != nil {
+			lastErr = err
+			h.logger.Warn("Lemon Squeezy customer lookup failed",
+				zap.Error(err),
+				zap.String("customer_id", customerID),
+				zap.String("event_id", eventID),
+			)
+		} else {
+			customerEmail = email
+			user, err := h.userRepo.GetUserByEmail(email)
+			if err == nil {
+				h.logger.Info("Matched webhook to user via Lemon Squeezy customer lookup",
+					zap.String("customer_id", customerID),
+					zap.String("user_id", user.ID),
+					zap.String("event_id", eventID),
+				)
+				return user, nil
+			}
+			if !errors.Is(err, pgx.ErrNoRows) {
+				return nil, fmt.Errorf("failed to look up user by email: %w", err)
+			}
+		}
+	}
+
+	// 4. No match - park the event for manual reconciliation
+	reason := "no user matches custom_data.user_id, payload email, or Lemon Squeezy customer email"
+	if lastErr != nil {
+		reason = fmt.Sprintf("%s (customer lookup error: %v)", reason, lastErr)
+	} else if !h.lemonClient.IsConfigured() {
+		reason += " (Lemon Squeezy API key not configured)"
+	}
+
+	h.logger.Warn("Unmatched billing webhook - adding to admin review queue",
+		zap.String("event", payload.Meta.EventName),
+		zap.String("event_id", eventID),
+		zap.String("customer_id", customerID),
+		zap.String("customer_email", customerEmail),
+	)
+
+	if h.reviewRepo == nil {
+		return nil, fmt.Errorf("failed to find user for customer ID %s", customerID)
+	}
+	if err := h.reviewRepo.CreateReviewItem(ctx, &BillingReviewItem{
+		Provider:       lemonSqueezyProvider,
+		EventID:        eventID,
+		EventName:      payload.Meta.EventName,
+		CustomerID:     customerID,
+		SubscriptionID: payload.subscriptionID(),
+		CustomerEmail:  customerEmail,
+		Reason:         reason,
+		Payload:        json.RawMessage(body),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to queue unmatched webhook for review: %w", err)
+	}
+
+	return nil, nil
+}
+
+// GET /admin/billing/review-queue - List unmatched billing webhook events
+func (h *WebhookHandlers) AdminListBillingReviewQueue(w http.ResponseWriter, r *http.Request) {
+	if h.reviewRepo == nil {
+		h.writeError(w, http.StatusInternalServerError, "Billing review queue not available")
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "open"
+	} else if status == "all" {
+		status = ""
+	}
+
+	limit := 50
+	offset := 0
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 100 {
+		limit = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && v >= 0 {
+		offset = v
+	}
+
+	items, err := h.reviewRepo.ListReviewItems(r.Context(), status, limit, offset)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve billing review queue")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":  items,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// POST /admin/billing/review-queue/{id}/resolve - Mark an unmatched billing event as reconciled
+func (h *WebhookHandlers) AdminResolveBillingReviewItem(w http.ResponseWriter, r *http.Request) {
+	if h.reviewRepo == nil {
+		h.writeError(w, http.StatusInternalServerError, "Billing review queue not available")
+		return
+	}
+
+	itemID := chi.URLParam(r, "id")
+	if err := h.reviewRepo.ResolveReviewItem(r.Context(), itemID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusNotFound, "Review item not found or already resolved")
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, "Failed to resolve review item")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]string{"status": "resolved"})
+}
+
+// GET /admin/billing/webhook-events - List billing webhook events in the inbox (?status=failed by default)
+func (h *WebhookHandlers) AdminListWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	if h.webhookEventRepo == nil {
+		h.writeError(w, http.StatusInternalServerError, "Webhook inbox not available")
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "failed"
+	} else if status == "all" {
+		status = ""
+	}
+
+	limit := 50
+	offset := 0
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 100 {
+		limit = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && v >= 0 {
+		offset = v
+	}
+
+	events, err := h.webhookEventRepo.ListEvents(r.Context(), status, limit, offset)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve webhook events")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"events": events,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// POST /admin/billing/webhook-events/{id}/replay - Apply a failed billing webhook event again
+// The outcome is recorded on the event; a replay that fails leaves it failed
+func (h *WebhookHandlers) AdminReplayWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	if h.webhookEventRepo == nil {
+		h.writeError(w, http.StatusInternalServerError, "Webhook inbox not available")
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	event, err := h.webhookEventRepo.ClaimFailedEvent(r.Context(), id, time.Now().Add(billingWebhookLease))
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			h.writeError(w, http.StatusInternalServerError, "Failed to replay webhook event")
+			return
+		}
+		existing, getErr := h.webhookEventRepo.GetEvent(r.Context(), id)
+		switch {
+		case errors.Is(getErr, pgx.ErrNoRows):
+			h.writeError(w, http.StatusNotFound, "Webhook event not found")
+		case getErr != nil:
+			h.writeError(w, http.StatusInternalServerError, "Failed to replay webhook event")
+		case existing.Status != "failed":
+			h.writeError(w, http.StatusConflict, fmt.Sprintf("Webhook event is %s; only failed events can be replayed", existing.Status))
+		default:
+			h.writeError(w, http.StatusConflict, "Webhook event was received before payloads were recorded and cannot be replayed")
+		}
+		return
+	}
+
+	ctx := context.WithoutCancel(r.Context())
+	processErr := h.processStoredEvent(ctx, event)
+	if err := h.webhookEventRepo.RecordEventAttempt(ctx, event.ID, processErr, nil); err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to record replay outcome")
+		return
+	}
+	noteAuditDetail(r, "event_id", event.EventID)
+	h.logger.Info("Billing webhook event replayed",
+		zap.String("event", event.EventName),
+		zap.String("event_id", event.EventID),
+		zap.Bool("succeeded", processErr == nil),
+	)
+
+	event, err = h.webhookEventRepo.GetEvent(ctx, event.ID)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve webhook event")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, event)
+}
+
 // LemonSqueezyWebhookPayload represents the structure of a Lemon Squeezy webhook payload
 // Adjust fields based on actual Lemon Squeezy webhook format
 type LemonSqueezyWebhookPayload struct {
 	Meta struct {
-		EventName string `json:"event_name"`
+		EventName  string `json:"event_name"`
+		EventID    string `json:"event_id,omitempty"`
+		CustomData struct {
+			UserID string `json:"user_id,omitempty"` // Passed through checkout by the frontend
+		} `json:"custom_data"`
 	} `json:"meta"`
 	Data struct {
 		Type       string `json:"type"`
+		ID         string `json:"id"`
 		Attributes struct {
-			SubscriptionID string `json:"subscription_id,omitempty"`
-			CustomerID     string `json:"customer_id,omitempty"`
-			PlanName       string `json:"plan_name,omitempty"`
-			Status         string `json:"status,omitempty"`
+			SubscriptionID lemonSqueezyID `json:"subscription_id,omitempty"`
+			CustomerID     lemonSqueezyID `json:"customer_id,omitempty"`
+			UserEmail      string         `json:"user_email,omitempty"`
+			PlanName       string         `json:"plan_name,omitempty"`
+			Status         string         `json:"status,omitempty"`
+			RenewsAt       *time.Time     `json:"renews_at,omitempty"` // End of the current billing period
+			EndsAt         *time.Time     `json:"ends_at,omitempty"`   // Set once cancelled: when the subscription ends
+			CreatedAt      *time.Time     `json:"created_at,omitempty"`
+			UpdatedAt      *time.Time     `json:"updated_at,omitempty"`
 		} `json:"attributes"`
 	} `json:"data"`
 }
 
+// lemonSqueezyID accepts IDs sent either as JSON numbers or strings
+type lemonSqueezyID string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (id *lemonSqueezyID) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*id = ""
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*id = lemonSqueezyID(str)
+		return nil
+	}
+	var num json.Number
+	if err := json.Unmarshal(data, &num); err != nil {
+		return err
+	}
+	*id = lemonSqueezyID(num.String())
+	return nil
+}
+
+// subscriptionID returns the Lemon Squeezy subscription ID for subscription and invoice events
+func (p *LemonSqueezyWebhookPayload) subscriptionID() string {
+	if p.Data.Attributes.SubscriptionID != "" {
+		return string(p.Data.Attributes.SubscriptionID)
+	}
+	if p.Data.Type == "subscriptions" {
+		return p.Data.ID
+	}
+	return ""
+}
+
+// eventID returns a stable identifier for the webhook event
+// Uses the provider event ID when present, otherwise event name + object ID + update time,
+// falling back to a hash of the raw body (retries resend an identical body)
+func (p *LemonSqueezyWebhookPayload) eventID(body []byte) string {
+	if p.Meta.EventID != "" {
+		return p.Meta.EventID
+	}
+	if p.Data.ID != "" {
+		if ts := p.eventTimestamp(); ts != nil {
+			return fmt.Sprintf("%s:%s:%s:%d", p.Meta.EventName, p.Data.Type, p.Data.ID, ts.UnixNano())
+		}
+	}
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// currentPeriodEnd returns when the subscription's current billing period ends: ends_at once it is
+// cancelled, renews_at otherwise
+func (p *LemonSqueezyWebhookPayload) currentPeriodEnd() *time.Time {
+	if p.Data.Attributes.EndsAt != nil {
+		return p.Data.Attributes.EndsAt
+	}
+	return p.Data.Attributes.RenewsAt
+}
+
+// eventTimestamp returns when the event happened (updated_at, falling back to created_at)
+func (p *LemonSqueezyWebhookPayload) eventTimestamp() *time.Time {
+	if p.Data.Attributes.UpdatedAt != nil {
+		return p.Data.Attributes.UpdatedAt
+	}
+	return p.Data.Attributes.CreatedAt
+}
+
 // CancelSubscription cancels a subscription
 func (h *WebhookHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -227,6 +795,6 @@ func (h *WebhookHandlers) writeJSON(w http.ResponseWriter, status int, data inte
 }
 
 func (h *WebhookHandlers) writeError(w http.ResponseWriter, status int, message string) {
-	h.writeJSON(w, status, map[string]string{"error": message})
+	writeAPIError(w, status, "", message, nil)
 }
 
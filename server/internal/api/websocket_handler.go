@@ -35,7 +35,7 @@ func (h *WebSocketHandler) HandleWebSocket(w http.ResponseWriter, r *http.Reques
 	// Get app ID from query parameter
 	appID := r.URL.Query().Get("app_id")
 	if appID == "" {
-		http.Error(w, "app_id query parameter is required", http.StatusBadRequest)
+		writeAPIError(w, http.StatusBadRequest, "", "app_id query parameter is required", nil)
 		return
 	}
 
@@ -3,57 +3,163 @@ package db
 import (
 	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"go.uber.org/zap"
 )
 
+// Migrations are versioned NNNNNN_name.up.sql / NNNNNN_name.down.sql pairs; other .sql files in the
+// directory (one-off fix scripts) are not migrations and are ignored
+//
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
-// RunMigrations runs database migrations using golang-migrate
-func RunMigrations(db *sql.DB, logger *zap.Logger) error {
+// Migrator applies the migrations embedded in the binary with golang-migrate, which records the
+// applied version in the schema_migrations table and holds an advisory lock while it migrates
+type Migrator struct {
+	m      *migrate.Migrate
+	source source.Driver
+}
+
+// MigrationStatus is where the database stands against the embedded migrations
+type MigrationStatus struct {
+	Version uint   // Last applied migration (0 for an empty database)
+	Dirty   bool   // Migration Version failed halfway and must be fixed by hand
+	Latest  uint   // Last embedded migration
+	Pending []uint // Embedded migrations newer than Version
+}
+
+// NewMigrator creates a migrator for db. Closing it closes db
+func NewMigrator(db *sql.DB) (*Migrator, error) {
 	driver, err := postgres.WithInstance(db, &postgres.Config{})
 	if err != nil {
-		return fmt.Errorf("failed to create postgres driver: %w", err)
+		return nil, fmt.Errorf("failed to create postgres driver: %w", err)
 	}
 
-	source, err := iofs.New(migrationsFS, "migrations")
+	src, err := iofs.New(migrationsFS, "migrations")
 	if err != nil {
-		return fmt.Errorf("failed to create migration source: %w", err)
+		return nil, fmt.Errorf("failed to create migration source: %w", err)
 	}
 
-	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	m, err := migrate.NewWithInstance("iofs", src, "postgres", driver)
 	if err != nil {
-		return fmt.Errorf("failed to create migrate instance: %w", err)
+		return nil, fmt.Errorf("failed to create migrate instance: %w", err)
 	}
+	return &Migrator{m: m, source: src}, nil
+}
 
-	version, dirty, err := m.Version()
-	if err != nil && err != migrate.ErrNilVersion {
-		return fmt.Errorf("failed to get migration version: %w", err)
+// Status reports the applied version and the migrations still to apply
+func (mg *Migrator) Status() (MigrationStatus, error) {
+	var status MigrationStatus
+	version, dirty, err := mg.m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return status, fmt.Errorf("failed to get migration version: %w", err)
 	}
+	status.Version = version
+	status.Dirty = dirty
 
-	if dirty {
-		logger.Warn("Database is in a dirty state, forcing version", zap.Uint("version", version))
-		if err := m.Force(int(version)); err != nil {
-			return fmt.Errorf("failed to force migration version: %w", err)
+	next, err := mg.source.First()
+	for err == nil {
+		status.Latest = next
+		if next > status.Version {
+			status.Pending = append(status.Pending, next)
 		}
+		next, err = mg.source.Next(next)
 	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return status, fmt.Errorf("failed to list migrations: %w", err)
+	}
+	return status, nil
+}
 
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+// Up applies every pending migration
+func (mg *Migrator) Up() error {
+	if err := mg.m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
+	return nil
+}
+
+// Down rolls back the last steps migrations
+func (mg *Migrator) Down(steps int) error {
+	if err := mg.m.Steps(-steps); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to roll back migrations: %w", err)
+	}
+	return nil
+}
 
-	if err == migrate.ErrNoChange {
-		logger.Info("Database is up to date")
-	} else {
-		newVersion, _, _ := m.Version()
-		logger.Info("Migrations completed", zap.Uint("version", newVersion))
+// Goto migrates up or down to version
+func (mg *Migrator) Goto(version uint) error {
+	if err := mg.m.Migrate(version); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to migrate to version %d: %w", version, err)
 	}
+	return nil
+}
 
+// Force records version as applied and clean without running anything - for after a failed
+// migration has been fixed (or rolled back) by hand
+func (mg *Migrator) Force(version int) error {
+	if err := mg.m.Force(version); err != nil {
+		return fmt.Errorf("failed to force migration version: %w", err)
+	}
 	return nil
 }
 
+// Close releases the database connection
+func (mg *Migrator) Close() error {
+	sourceErr, dbErr := mg.m.Close()
+	return errors.Join(sourceErr, dbErr)
+}
+
+// RunMigrations applies the pending migrations at startup, logging where the database stood and
+// where it ends up. A dirty database (a migration failed halfway) is refused: which of its statements
+// ran is unknown, so it has to be fixed by hand and marked with `api migrate force`
+func RunMigrations(db *sql.DB, logger *zap.Logger) error {
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	status, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	logger.Info("Database migration status",
+		zap.Uint("version", status.Version),
+		zap.Uint("latest", status.Latest),
+		zap.Int("pending", len(status.Pending)),
+		zap.Bool("dirty", status.Dirty),
+	)
+	if status.Dirty {
+		return fmt.Errorf("migration %d failed halfway (database is dirty): fix the schema by hand, then run `api migrate force <version>` with the last version that is fully applied", status.Version)
+	}
+	if status.Version > status.Latest {
+		// A newer binary migrated the database; this one may not understand the schema
+		logger.Warn("Database is ahead of this binary's migrations",
+			zap.Uint("version", status.Version),
+			zap.Uint("latest", status.Latest),
+		)
+		return nil
+	}
+	if len(status.Pending) == 0 {
+		logger.Info("Database is up to date", zap.Uint("version", status.Version))
+		return nil
+	}
+
+	// Up (not Goto) so an instance starting alongside that already migrated is never rolled back
+	logger.Info("Applying migrations", zap.Uints("versions", status.Pending))
+	if err := migrator.Up(); err != nil {
+		return err
+	}
+	logger.Info("Migrations completed",
+		zap.Uint("from_version", status.Version),
+		zap.Uint("version", status.Latest),
+	)
+	return nil
+}
@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove billing_webhook_events table
+DROP INDEX IF EXISTS idx_billing_webhook_events_processed_at;
+DROP TABLE IF EXISTS billing_webhook_events;
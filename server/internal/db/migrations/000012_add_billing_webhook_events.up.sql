@@ -0,0 +1,16 @@
+-- Add billing_webhook_events table for webhook replay protection
+-- Every Lemon Squeezy delivery is recorded here before it is applied.
+-- The UNIQUE constraint on event_id guarantees that retried/duplicate deliveries
+-- of the same event are only ever applied once (INSERT ... ON CONFLICT DO NOTHING).
+CREATE TABLE IF NOT EXISTS billing_webhook_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    provider VARCHAR(50) NOT NULL DEFAULT 'lemon_squeezy', -- Webhook source
+    event_id VARCHAR(255) NOT NULL, -- Provider event ID (or derived fingerprint)
+    event_name VARCHAR(100) NOT NULL, -- e.g., subscription_created, invoice_paid
+    event_timestamp TIMESTAMP, -- Timestamp reported by the provider
+    processed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE(provider, event_id)
+);
+
+-- Index for pruning old events
+CREATE INDEX IF NOT EXISTS idx_billing_webhook_events_processed_at ON billing_webhook_events(processed_at);
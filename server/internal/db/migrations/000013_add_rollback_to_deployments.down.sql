@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove rollback tracking from deployments table
+ALTER TABLE deployments
+DROP COLUMN IF EXISTS rollback_from_deployment_id;
@@ -0,0 +1,7 @@
+-- Add rollback tracking to deployments table
+-- When a deployment is created by rolling back, this references the earlier
+-- deployment whose image was redeployed, so deployment history shows the rollback
+ALTER TABLE deployments
+ADD COLUMN IF NOT EXISTS rollback_from_deployment_id UUID REFERENCES deployments(id) ON DELETE SET NULL;
+
+COMMENT ON COLUMN deployments.rollback_from_deployment_id IS 'Deployment whose image was redeployed by a rollback (NULL for regular deployments)';
@@ -0,0 +1,7 @@
+-- Migration Rollback: Remove custom domains support
+DROP INDEX IF EXISTS idx_app_domains_status;
+DROP INDEX IF EXISTS idx_app_domains_app_id;
+DROP TABLE IF EXISTS app_domains;
+
+ALTER TABLE plans
+DROP COLUMN IF EXISTS custom_domains;
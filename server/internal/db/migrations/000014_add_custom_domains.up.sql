@@ -0,0 +1,27 @@
+-- Add custom domains support
+-- Apps can be reached on user-owned hostnames once ownership is verified via DNS.
+-- TLS certificates for verified domains are issued and renewed by Traefik's ACME
+-- (Let's Encrypt) resolver, so only the domain and its verification state live here.
+
+-- Step 1: Plan feature flag (custom domains are a paid feature)
+ALTER TABLE plans
+ADD COLUMN IF NOT EXISTS custom_domains BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE plans SET custom_domains = true WHERE name = 'pro';
+
+-- Step 2: Custom domains table
+CREATE TABLE IF NOT EXISTS app_domains (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    domain VARCHAR(253) NOT NULL UNIQUE, -- A hostname can only be attached to one app
+    verification_token VARCHAR(255) NOT NULL, -- Expected in the _stackyn-challenge TXT record
+    status VARCHAR(50) NOT NULL DEFAULT 'pending', -- pending, verified, failed
+    verification_method VARCHAR(20), -- txt or cname (set once verified)
+    verification_error TEXT, -- Last verification failure reason
+    verified_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_domains_app_id ON app_domains(app_id);
+CREATE INDEX IF NOT EXISTS idx_app_domains_status ON app_domains(status);
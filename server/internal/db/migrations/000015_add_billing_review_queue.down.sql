@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove billing_review_queue table
+DROP INDEX IF EXISTS idx_billing_review_queue_status;
+DROP TABLE IF EXISTS billing_review_queue;
@@ -0,0 +1,20 @@
+-- Add billing_review_queue table
+-- Webhook events that could not be matched to a Stackyn user (no custom_data.user_id,
+-- no matching email, and the Lemon Squeezy customer lookup failed) are parked here
+-- so an admin can reconcile the subscription manually instead of it being lost.
+CREATE TABLE IF NOT EXISTS billing_review_queue (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    provider VARCHAR(50) NOT NULL DEFAULT 'lemon_squeezy',
+    event_id VARCHAR(255), -- billing_webhook_events.event_id of the unmatched delivery
+    event_name VARCHAR(100) NOT NULL,
+    customer_id VARCHAR(255), -- Provider customer ID
+    subscription_id VARCHAR(255), -- Provider subscription ID
+    customer_email VARCHAR(255), -- Email from payload or customer lookup (if any)
+    reason TEXT NOT NULL, -- Why the event could not be applied
+    payload JSONB NOT NULL, -- Raw webhook payload for manual replay
+    status VARCHAR(50) NOT NULL DEFAULT 'open', -- open, resolved
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_billing_review_queue_status ON billing_review_queue(status, created_at);
@@ -0,0 +1,6 @@
+-- Migration Rollback: Remove plan_downgrades table and apps.status_reason
+DROP INDEX IF EXISTS idx_plan_downgrades_status_deadline;
+DROP INDEX IF EXISTS idx_plan_downgrades_user_pending;
+DROP TABLE IF EXISTS plan_downgrades;
+
+ALTER TABLE apps DROP COLUMN IF EXISTS status_reason;
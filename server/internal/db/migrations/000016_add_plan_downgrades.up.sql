@@ -0,0 +1,25 @@
+-- Track plan downgrades that leave a user over their new plan limits
+-- The downgrade reconciler warns the user, waits for the deadline, then pauses excess apps
+
+-- Human-readable reason shown alongside app status (e.g. why an app was disabled)
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS status_reason TEXT;
+
+CREATE TABLE IF NOT EXISTS plan_downgrades (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    plan VARCHAR(50) NOT NULL, -- Plan whose limits are exceeded
+    max_apps INTEGER NOT NULL,
+    max_ram_mb INTEGER NOT NULL,
+    app_count INTEGER NOT NULL, -- Enabled apps when the violation was detected
+    total_ram_mb INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'enforced', 'resolved')),
+    deadline TIMESTAMP NOT NULL, -- Excess apps are paused after this time
+    notified_at TIMESTAMP,
+    enforced_at TIMESTAMP,
+    resolved_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- At most one open downgrade per user
+CREATE UNIQUE INDEX IF NOT EXISTS idx_plan_downgrades_user_pending ON plan_downgrades(user_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_plan_downgrades_status_deadline ON plan_downgrades(status, deadline);
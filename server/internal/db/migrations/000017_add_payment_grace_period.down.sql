@@ -0,0 +1,9 @@
+-- Migration Rollback: Remove payment grace period columns
+DROP INDEX IF EXISTS idx_users_grace_expiration;
+
+-- Users still in grace fall back to expired
+UPDATE users SET billing_status = 'expired' WHERE billing_status = 'grace';
+UPDATE subscriptions SET status = 'expired' WHERE status = 'grace';
+
+ALTER TABLE users DROP COLUMN IF EXISTS grace_ends_at;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS grace_ends_at;
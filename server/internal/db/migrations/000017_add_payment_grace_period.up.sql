@@ -0,0 +1,11 @@
+-- Add payment grace period (read-only mode) after a failed payment
+-- While status/billing_status is 'grace', apps keep running but deploys and configuration changes are blocked
+-- The billing worker expires the subscription and stops apps once grace_ends_at passes
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS grace_ends_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS grace_ends_at TIMESTAMP;
+
+-- Index for grace period expiration checks (used by billing worker)
+CREATE INDEX IF NOT EXISTS idx_users_grace_expiration 
+  ON users(billing_status, grace_ends_at) 
+  WHERE billing_status = 'grace' AND grace_ends_at IS NOT NULL;
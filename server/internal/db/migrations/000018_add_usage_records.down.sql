@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove usage_records table
+DROP INDEX IF EXISTS idx_usage_records_user_metric_time;
+DROP TABLE IF EXISTS usage_records;
@@ -0,0 +1,14 @@
+-- Add usage metering table
+-- Each row is one metered quantity (e.g. seconds of build time, bytes of egress) attributed to a user
+-- Usage for a period is the SUM of quantity over recorded_at in that period
+
+CREATE TABLE IF NOT EXISTS usage_records (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    app_id UUID REFERENCES apps(id) ON DELETE SET NULL, -- Usage survives app deletion (still billable)
+    metric VARCHAR(50) NOT NULL, -- build_seconds | egress_bytes
+    quantity BIGINT NOT NULL CHECK (quantity >= 0),
+    recorded_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_records_user_metric_time ON usage_records(user_id, metric, recorded_at);
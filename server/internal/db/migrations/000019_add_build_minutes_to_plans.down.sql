@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove monthly build minutes allowance from plans
+ALTER TABLE plans
+DROP COLUMN IF EXISTS build_minutes;
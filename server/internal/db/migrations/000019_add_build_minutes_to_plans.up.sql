@@ -0,0 +1,9 @@
+-- Add monthly build minutes allowance to plans
+-- Build wall-clock time is metered into usage_records (metric = 'build_seconds');
+-- new builds are rejected once a user's usage for the calendar month reaches this allowance.
+-- 0 means unlimited.
+
+ALTER TABLE plans
+ADD COLUMN IF NOT EXISTS build_minutes INTEGER NOT NULL DEFAULT 300;
+
+UPDATE plans SET build_minutes = 1000 WHERE name = 'pro';
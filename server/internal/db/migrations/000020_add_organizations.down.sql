@@ -0,0 +1,14 @@
+-- Migration Rollback: Remove organizations and role-based access
+DROP INDEX IF EXISTS idx_apps_organization_id;
+ALTER TABLE apps
+DROP COLUMN IF EXISTS organization_id;
+
+DROP INDEX IF EXISTS idx_organization_invitations_pending;
+DROP TABLE IF EXISTS organization_invitations;
+DROP INDEX IF EXISTS idx_organization_members_user_id;
+DROP TABLE IF EXISTS organization_members;
+DROP INDEX IF EXISTS idx_organizations_owner_id;
+DROP TABLE IF EXISTS organizations;
+
+ALTER TABLE plans
+DROP COLUMN IF EXISTS team_members;
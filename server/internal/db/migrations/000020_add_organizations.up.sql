@@ -0,0 +1,61 @@
+-- Add organizations (teams) with role-based access
+-- An organization is owned (and billed) by one user. Org apps keep user_id = the owner so plan
+-- limits and billing apply to the owner's subscription; members act on them according to role:
+--   owner  - everything, including deleting the organization
+--   admin  - manage members/invitations and delete apps
+--   member - deploy and configure apps
+--   viewer - read-only access to apps, deployments and logs
+
+-- Step 1: Plan seat limit (includes the owner)
+ALTER TABLE plans
+ADD COLUMN IF NOT EXISTS team_members INTEGER NOT NULL DEFAULT 1;
+
+UPDATE plans SET team_members = 10 WHERE name = 'pro';
+
+-- Step 2: Organizations
+CREATE TABLE IF NOT EXISTS organizations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(255) NOT NULL UNIQUE,
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_organizations_owner_id ON organizations(owner_id);
+
+-- Step 3: Memberships (the owner also has a row with role 'owner')
+CREATE TABLE IF NOT EXISTS organization_members (
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('owner', 'admin', 'member', 'viewer')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON organization_members(user_id);
+
+-- Step 4: Pending invitations (token is stored hashed; the raw token is only in the email)
+CREATE TABLE IF NOT EXISTS organization_invitations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('admin', 'member', 'viewer')),
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    invited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- One open invitation per email per organization
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organization_invitations_pending
+ON organization_invitations(organization_id, email)
+WHERE accepted_at IS NULL;
+
+-- Step 5: Org-scoped apps (NULL = personal app)
+ALTER TABLE apps
+ADD COLUMN IF NOT EXISTS organization_id UUID REFERENCES organizations(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_apps_organization_id ON apps(organization_id);
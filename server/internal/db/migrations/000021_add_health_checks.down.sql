@@ -0,0 +1,9 @@
+-- Migration Rollback: Remove HTTP health checks and restart tracking
+ALTER TABLE deployments
+DROP COLUMN IF EXISTS last_restart_reason,
+DROP COLUMN IF EXISTS last_restarted_at,
+DROP COLUMN IF EXISTS restart_count;
+
+ALTER TABLE apps
+DROP COLUMN IF EXISTS health_check_interval_seconds,
+DROP COLUMN IF EXISTS health_check_path;
@@ -0,0 +1,12 @@
+-- Add HTTP health checks and restart tracking
+-- Apps on plans with health_checks choose the probed path and interval;
+-- unhealthy containers are restarted and the restarts are recorded on the deployment.
+
+ALTER TABLE apps
+ADD COLUMN IF NOT EXISTS health_check_path VARCHAR(255) NOT NULL DEFAULT '/',
+ADD COLUMN IF NOT EXISTS health_check_interval_seconds INTEGER NOT NULL DEFAULT 30;
+
+ALTER TABLE deployments
+ADD COLUMN IF NOT EXISTS restart_count INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS last_restarted_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS last_restart_reason TEXT;
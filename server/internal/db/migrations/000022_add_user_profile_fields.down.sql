@@ -0,0 +1,6 @@
+-- Migration Rollback: Remove editable profile fields from users
+ALTER TABLE users
+DROP COLUMN IF EXISTS avatar_url,
+DROP COLUMN IF EXISTS avatar_key,
+DROP COLUMN IF EXISTS notification_preferences,
+DROP COLUMN IF EXISTS timezone;
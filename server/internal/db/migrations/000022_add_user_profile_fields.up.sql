@@ -0,0 +1,9 @@
+-- Add editable profile fields to users
+-- Timezone is an IANA zone name; notification preferences are a JSON object of toggles;
+-- avatars live in object storage (avatar_key) and are served from avatar_url.
+
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+ADD COLUMN IF NOT EXISTS notification_preferences JSONB NOT NULL DEFAULT '{}'::jsonb,
+ADD COLUMN IF NOT EXISTS avatar_key VARCHAR(512),
+ADD COLUMN IF NOT EXISTS avatar_url TEXT;
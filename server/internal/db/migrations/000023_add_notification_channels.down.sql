@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove Slack delivery for user notifications
+ALTER TABLE users
+DROP COLUMN IF EXISTS slack_webhook_url;
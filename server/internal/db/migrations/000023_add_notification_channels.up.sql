@@ -0,0 +1,5 @@
+-- Add Slack delivery for user notifications
+-- Preferences choose email/slack per category; Slack messages go to the user's incoming webhook.
+
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS slack_webhook_url TEXT;
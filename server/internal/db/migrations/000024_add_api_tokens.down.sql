@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove API tokens
+DROP INDEX IF EXISTS idx_api_tokens_user_id;
+DROP TABLE IF EXISTS api_tokens;
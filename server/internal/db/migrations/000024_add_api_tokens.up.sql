@@ -0,0 +1,17 @@
+-- Add API tokens for programmatic access (SDKs, CI)
+-- Tokens are stored hashed; the raw token is only shown once at creation. Sandbox tokens
+-- (stk_test_ prefix) are served by an in-memory simulator and never touch real apps or Docker.
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    token_prefix VARCHAR(32) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    sandbox BOOLEAN NOT NULL DEFAULT FALSE,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
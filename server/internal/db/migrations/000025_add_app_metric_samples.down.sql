@@ -0,0 +1,4 @@
+-- Migration Rollback: Remove container resource usage samples
+DROP INDEX IF EXISTS idx_app_metric_samples_sampled_at;
+DROP INDEX IF EXISTS idx_app_metric_samples_app_sampled_at;
+DROP TABLE IF EXISTS app_metric_samples;
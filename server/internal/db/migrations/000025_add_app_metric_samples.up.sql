@@ -0,0 +1,21 @@
+-- Add container resource usage samples
+-- The deploy worker samples docker stats for every running app container; samples older than
+-- METRICS_RETENTION_HOURS are pruned by the collector.
+
+CREATE TABLE IF NOT EXISTS app_metric_samples (
+    id BIGSERIAL PRIMARY KEY,
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    container_id VARCHAR(64) NOT NULL,
+    sampled_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    cpu_percent DOUBLE PRECISION NOT NULL DEFAULT 0,        -- Percent of one core (can exceed 100 on multi-core limits)
+    cpu_limit DOUBLE PRECISION NOT NULL DEFAULT 0,          -- CPU cores allowed (0 = unlimited)
+    memory_usage_bytes BIGINT NOT NULL DEFAULT 0,           -- Excludes reclaimable page cache, like `docker stats`
+    memory_limit_bytes BIGINT NOT NULL DEFAULT 0,
+    disk_usage_bytes BIGINT,                                -- Writable layer size (NULL when not measured this sample)
+    network_rx_bytes BIGINT NOT NULL DEFAULT 0,
+    network_tx_bytes BIGINT NOT NULL DEFAULT 0,
+    restart_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_metric_samples_app_sampled_at ON app_metric_samples(app_id, sampled_at DESC);
+CREATE INDEX IF NOT EXISTS idx_app_metric_samples_sampled_at ON app_metric_samples(sampled_at);
@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove chaos faults
+DROP INDEX IF EXISTS idx_chaos_faults_kind;
+DROP TABLE IF EXISTS chaos_faults;
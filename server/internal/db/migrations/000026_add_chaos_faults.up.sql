@@ -0,0 +1,16 @@
+-- Add chaos faults for failure injection testing
+-- Only read when CHAOS_ENABLED is set (refused in production). Each fault applies to one app or,
+-- with a NULL app_id, to everything, and is consumed once per matching build, deploy or webhook.
+
+CREATE TABLE IF NOT EXISTS chaos_faults (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind VARCHAR(32) NOT NULL CHECK (kind IN ('fail_build', 'delay_deploy', 'drop_webhooks')),
+    app_id UUID REFERENCES apps(id) ON DELETE CASCADE,
+    delay_seconds INTEGER NOT NULL DEFAULT 0,
+    remaining INTEGER NOT NULL DEFAULT 1,
+    expires_at TIMESTAMP NOT NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_chaos_faults_kind ON chaos_faults(kind, app_id);
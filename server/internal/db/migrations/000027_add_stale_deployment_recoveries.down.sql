@@ -0,0 +1,4 @@
+-- Migration Rollback: Remove stale deployment recoveries
+DROP INDEX IF EXISTS idx_stale_deployment_recoveries_requeued;
+DROP INDEX IF EXISTS idx_stale_deployment_recoveries_app_id;
+DROP TABLE IF EXISTS stale_deployment_recoveries;
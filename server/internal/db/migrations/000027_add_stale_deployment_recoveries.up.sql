@@ -0,0 +1,16 @@
+-- Add stale deployment recoveries
+-- The watchdog records every app it pulls out of a stuck building/deploying state. When it
+-- re-enqueues the work, requeued_build_job_id marks the retry so the same app is retried only once.
+
+CREATE TABLE IF NOT EXISTS stale_deployment_recoveries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    build_job_id UUID REFERENCES build_jobs(id) ON DELETE SET NULL,
+    stuck_status VARCHAR(50) NOT NULL,
+    stuck_since TIMESTAMP NOT NULL,
+    requeued_build_job_id UUID,
+    recovered_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_stale_deployment_recoveries_app_id ON stale_deployment_recoveries(app_id);
+CREATE INDEX IF NOT EXISTS idx_stale_deployment_recoveries_requeued ON stale_deployment_recoveries(requeued_build_job_id);
@@ -0,0 +1,5 @@
+-- Migration Rollback: Remove scheduled cron jobs
+DROP INDEX IF EXISTS idx_cron_job_runs_job_created;
+DROP TABLE IF EXISTS cron_job_runs;
+DROP INDEX IF EXISTS idx_cron_jobs_due;
+DROP TABLE IF EXISTS cron_jobs;
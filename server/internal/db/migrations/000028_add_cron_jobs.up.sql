@@ -0,0 +1,38 @@
+-- Add scheduled cron jobs
+-- Each job runs a command in a one-off container of the app's running image. The scheduler claims
+-- due jobs by next_run_at and records every run (exit code and output) in cron_job_runs.
+
+CREATE TABLE IF NOT EXISTS cron_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    schedule VARCHAR(100) NOT NULL,
+    command TEXT NOT NULL,
+    timeout_seconds INTEGER NOT NULL DEFAULT 600,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMP,
+    last_run_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (app_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_cron_jobs_due ON cron_jobs(next_run_at) WHERE enabled;
+
+CREATE TABLE IF NOT EXISTS cron_job_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    cron_job_id UUID NOT NULL REFERENCES cron_jobs(id) ON DELETE CASCADE,
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    trigger VARCHAR(20) NOT NULL DEFAULT 'schedule' CHECK (trigger IN ('schedule', 'manual')),
+    status VARCHAR(20) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'succeeded', 'failed')),
+    image_name VARCHAR(500),
+    exit_code INTEGER,
+    output TEXT,
+    error_message TEXT,
+    scheduled_for TIMESTAMP NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_cron_job_runs_job_created ON cron_job_runs(cron_job_id, created_at DESC);
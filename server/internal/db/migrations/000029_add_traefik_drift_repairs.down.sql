@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove Traefik drift repairs
+DROP INDEX IF EXISTS idx_traefik_drift_repairs_app_created;
+DROP TABLE IF EXISTS traefik_drift_repairs;
@@ -0,0 +1,16 @@
+-- Add Traefik drift repairs
+-- The deploy worker compares each running container's Traefik labels (and, with a Traefik API, the
+-- routers Traefik loaded) with the subdomain and verified domains on record. Drift is repaired by
+-- redeploying the current image; every repair is recorded here and rate-limits the next one.
+
+CREATE TABLE IF NOT EXISTS traefik_drift_repairs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    deployment_id UUID REFERENCES deployments(id) ON DELETE SET NULL, -- Deployment whose routing drifted
+    container_id VARCHAR(255),
+    drift TEXT[] NOT NULL DEFAULT '{}',                               -- One entry per difference found
+    repair_deployment_id UUID,                                        -- Redeploy enqueued to repair it (NULL if enqueueing failed)
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_traefik_drift_repairs_app_created ON traefik_drift_repairs(app_id, created_at DESC);
@@ -0,0 +1,4 @@
+-- Migration Rollback: Remove environment snapshots from deployments table
+ALTER TABLE deployments
+DROP COLUMN IF EXISTS env_from_deployment_id,
+DROP COLUMN IF EXISTS env_snapshot;
@@ -0,0 +1,10 @@
+-- Add environment snapshots to deployments table
+-- The full env var set a container was started with is stored on its deployment, so a running
+-- container is reproducible and later env var edits only apply to deployments that ask for them.
+-- Rollbacks and route refreshes reuse an earlier deployment's snapshot instead of the current env vars.
+ALTER TABLE deployments
+ADD COLUMN IF NOT EXISTS env_snapshot JSONB,
+ADD COLUMN IF NOT EXISTS env_from_deployment_id UUID REFERENCES deployments(id) ON DELETE SET NULL;
+
+COMMENT ON COLUMN deployments.env_snapshot IS 'Env vars the container was started with (NULL for deployments made before snapshots)';
+COMMENT ON COLUMN deployments.env_from_deployment_id IS 'Deployment whose env snapshot was reused (NULL when taken from the app env vars at deploy time)';
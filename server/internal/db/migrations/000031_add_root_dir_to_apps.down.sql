@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove root_dir from apps table
+ALTER TABLE apps
+DROP COLUMN IF EXISTS root_dir;
@@ -0,0 +1,8 @@
+-- Add root_dir to apps table
+-- Monorepo apps build from a subdirectory of the repository (e.g. apps/api). The whole repo is
+-- cloned, but runtime detection, Dockerfile generation and the Docker build context use root_dir.
+-- Empty means the repository root.
+ALTER TABLE apps
+ADD COLUMN IF NOT EXISTS root_dir VARCHAR(255) NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN apps.root_dir IS 'Repository subdirectory the app is built from (empty for the repository root)';
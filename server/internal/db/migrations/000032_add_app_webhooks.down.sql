@@ -0,0 +1,6 @@
+-- Migration Rollback: Remove outgoing app webhooks
+DROP INDEX IF EXISTS idx_app_webhook_deliveries_webhook_created;
+DROP INDEX IF EXISTS idx_app_webhook_deliveries_due;
+DROP TABLE IF EXISTS app_webhook_deliveries;
+DROP INDEX IF EXISTS idx_app_webhooks_app_id;
+DROP TABLE IF EXISTS app_webhooks;
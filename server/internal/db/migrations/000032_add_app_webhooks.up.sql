@@ -0,0 +1,37 @@
+-- Add outgoing app webhooks
+-- Users register URLs per app that receive signed JSON events (build_started, build_failed,
+-- deploy_succeeded, deploy_failed). Workers record one delivery per webhook and event; the API
+-- server sends due deliveries and retries failures with exponential backoff. Deliveries double
+-- as the log users debug failed notifications with.
+
+CREATE TABLE IF NOT EXISTS app_webhooks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret VARCHAR(100) NOT NULL,                -- HMAC-SHA256 signing secret
+    events TEXT[] NOT NULL DEFAULT '{}',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_webhooks_app_id ON app_webhooks(app_id);
+
+CREATE TABLE IF NOT EXISTS app_webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    webhook_id UUID NOT NULL REFERENCES app_webhooks(id) ON DELETE CASCADE,
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    event_id UUID NOT NULL,                      -- Shared by the deliveries of one event
+    event VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_status INTEGER,                     -- HTTP status of the last attempt
+    last_error TEXT,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_webhook_deliveries_due ON app_webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_app_webhook_deliveries_webhook_created ON app_webhook_deliveries(webhook_id, created_at DESC);
@@ -0,0 +1,4 @@
+-- Migration Rollback: Remove app export bundles
+DROP INDEX IF EXISTS idx_app_exports_expires_at;
+DROP INDEX IF EXISTS idx_app_exports_user_created;
+DROP TABLE IF EXISTS app_exports;
@@ -0,0 +1,23 @@
+-- Add app export bundles
+-- Before deleting an app, users can export what only lived on Stackyn: the contents of its
+-- Docker volumes, its env var keys and its last image reference. The deploy worker writes the
+-- bundle to shared storage; it stays downloadable for 7 days. Exports belong to the user rather
+-- than the app, so they outlive the app they were taken from.
+
+CREATE TABLE IF NOT EXISTS app_exports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    app_id UUID NOT NULL,                        -- No foreign key: the app may be deleted after the export
+    app_name VARCHAR(255) NOT NULL,
+    manifest JSONB NOT NULL,                     -- App snapshot taken when the export was requested
+    delete_app BOOLEAN NOT NULL DEFAULT FALSE,   -- Delete the app once the bundle is written
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'ready', 'failed', 'expired')),
+    size_bytes BIGINT,
+    error_message TEXT,
+    expires_at TIMESTAMP,                        -- Set when the bundle is ready
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_exports_user_created ON app_exports(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_app_exports_expires_at ON app_exports(expires_at) WHERE status = 'ready';
@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove the preferred locale from users
+ALTER TABLE users
+DROP COLUMN IF EXISTS locale;
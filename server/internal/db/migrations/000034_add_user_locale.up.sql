@@ -0,0 +1,6 @@
+-- Add a preferred locale to users
+-- Transactional emails are rendered in this locale (en, es, de, fr). It is taken from the
+-- browser's Accept-Language at signup and can be changed on the profile.
+
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS locale VARCHAR(10) NOT NULL DEFAULT 'en';
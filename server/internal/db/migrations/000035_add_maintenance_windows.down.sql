@@ -0,0 +1,10 @@
+-- Migration Rollback: Remove scheduled maintenance windows and app activity feeds
+DROP INDEX IF EXISTS idx_app_activity_app_maintenance;
+DROP INDEX IF EXISTS idx_app_activity_app_created;
+DROP TABLE IF EXISTS app_activity;
+DROP INDEX IF EXISTS idx_maintenance_windows_pending;
+DROP TABLE IF EXISTS maintenance_windows;
+DROP INDEX IF EXISTS idx_deployments_region_running;
+DROP INDEX IF EXISTS idx_deployments_node_running;
+ALTER TABLE deployments DROP COLUMN IF EXISTS region;
+ALTER TABLE deployments DROP COLUMN IF EXISTS node;
@@ -0,0 +1,44 @@
+-- Add scheduled maintenance windows and app activity feeds
+-- Admins schedule platform maintenance for specific nodes and/or regions. Deployments record the
+-- node and region their container was started on, so the maintenance notifier can find the apps a
+-- window affects, email their owners the window in their own timezone, and annotate each affected
+-- app's activity feed with the maintenance event.
+
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS node VARCHAR(255);
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS region VARCHAR(100);
+
+CREATE INDEX IF NOT EXISTS idx_deployments_node_running ON deployments(node) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS idx_deployments_region_running ON deployments(region) WHERE status = 'running';
+
+CREATE TABLE IF NOT EXISTS maintenance_windows (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    title VARCHAR(200) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    nodes TEXT[] NOT NULL DEFAULT '{}',          -- Affected nodes (deployments.node)
+    regions TEXT[] NOT NULL DEFAULT '{}',        -- Affected regions (deployments.region)
+    starts_at TIMESTAMP NOT NULL,                -- UTC
+    ends_at TIMESTAMP NOT NULL,                  -- UTC
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    notified_at TIMESTAMP,                       -- Set when the notifier claimed the window
+    affected_apps INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK (ends_at > starts_at),
+    CHECK (cardinality(nodes) > 0 OR cardinality(regions) > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_maintenance_windows_pending ON maintenance_windows(created_at) WHERE notified_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS app_activity (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    kind VARCHAR(50) NOT NULL,                   -- e.g. maintenance
+    title VARCHAR(200) NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    data JSONB NOT NULL DEFAULT '{}',
+    maintenance_window_id UUID REFERENCES maintenance_windows(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_activity_app_created ON app_activity(app_id, created_at DESC);
+-- An app is annotated once per maintenance window
+CREATE UNIQUE INDEX IF NOT EXISTS idx_app_activity_app_maintenance ON app_activity(app_id, maintenance_window_id) WHERE maintenance_window_id IS NOT NULL;
@@ -0,0 +1,6 @@
+-- Migration Rollback: Remove app sleep/wake
+-- Sleeping apps have no running container, so they are left stopped
+UPDATE apps SET status = 'stopped' WHERE status IN ('sleeping', 'waking');
+DROP INDEX IF EXISTS idx_apps_running_last_request;
+ALTER TABLE apps DROP COLUMN IF EXISTS slept_at;
+ALTER TABLE apps DROP COLUMN IF EXISTS last_request_at;
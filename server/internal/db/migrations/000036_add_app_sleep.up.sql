@@ -0,0 +1,10 @@
+-- Add app sleep/wake for plans that are not always-on
+-- The deploy worker reads Traefik's access log and records when each app last served a request.
+-- Running apps of owners whose plan has always_on = false are put to sleep (status 'sleeping',
+-- containers stopped but kept) once idle for longer than the configured timeout. The next request
+-- reaches the fallback page server, which marks the app 'waking' and queues its containers to start.
+
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS last_request_at TIMESTAMP; -- Last request Traefik routed to the app (UTC)
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS slept_at TIMESTAMP;        -- When the app was last put to sleep (UTC)
+
+CREATE INDEX IF NOT EXISTS idx_apps_running_last_request ON apps(last_request_at) WHERE status = 'running';
@@ -0,0 +1,5 @@
+-- Migration Rollback: Remove per-app WAF presets and their hits log
+DROP INDEX IF EXISTS idx_waf_hits_created;
+DROP INDEX IF EXISTS idx_waf_hits_app_created;
+DROP TABLE IF EXISTS waf_hits;
+DROP TABLE IF EXISTS app_waf_settings;
@@ -0,0 +1,28 @@
+-- Add per-app WAF presets and their hits log
+-- Apps opt into a preset (a subset of the OWASP Core Rule Set) run by a Coraza middleware in front
+-- of their Traefik routers, in monitor mode (log only) or block mode. The deploy worker reads rule
+-- matches from Traefik's log into waf_hits so owners can review them before switching to block.
+
+CREATE TABLE IF NOT EXISTS app_waf_settings (
+    app_id UUID PRIMARY KEY REFERENCES apps(id) ON DELETE CASCADE,
+    preset VARCHAR(50) NOT NULL,
+    mode VARCHAR(20) NOT NULL DEFAULT 'monitor' CHECK (mode IN ('monitor', 'block')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS waf_hits (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    rule_id VARCHAR(20) NOT NULL,                -- CRS rule ID (949110 = anomaly threshold exceeded)
+    message TEXT NOT NULL DEFAULT '',
+    severity VARCHAR(20) NOT NULL DEFAULT '',
+    action VARCHAR(20) NOT NULL CHECK (action IN ('detected', 'blocked')),
+    mode VARCHAR(20) NOT NULL DEFAULT '',        -- App's WAF mode when the hit was recorded
+    client_ip VARCHAR(64) NOT NULL DEFAULT '',
+    uri TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_waf_hits_app_created ON waf_hits(app_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_waf_hits_created ON waf_hits(created_at);
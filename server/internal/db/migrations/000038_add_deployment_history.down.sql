@@ -0,0 +1,7 @@
+-- Migration Rollback: Remove commit and config snapshots from deployments table
+
+DROP INDEX IF EXISTS idx_deployments_app_created;
+
+ALTER TABLE deployments
+DROP COLUMN IF EXISTS config_snapshot,
+DROP COLUMN IF EXISTS commit_sha;
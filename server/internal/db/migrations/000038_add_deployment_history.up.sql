@@ -0,0 +1,13 @@
+-- Add commit and config snapshots to deployments table
+-- Together with the env snapshot they describe exactly what a deployment ran, so two deployments
+-- can be compared (commit range, env var changes, config changes). Rollbacks and route refreshes
+-- reuse the commit of the build whose image they redeploy.
+ALTER TABLE deployments
+ADD COLUMN IF NOT EXISTS commit_sha VARCHAR(64),
+ADD COLUMN IF NOT EXISTS config_snapshot JSONB;
+
+COMMENT ON COLUMN deployments.commit_sha IS 'Git commit the deployed image was built from (NULL for deployments made before commits were recorded)';
+COMMENT ON COLUMN deployments.config_snapshot IS 'Runtime config the container was started with: port, resources, health check, domains, WAF';
+
+-- Retention pruning walks each app's history newest first
+CREATE INDEX IF NOT EXISTS idx_deployments_app_created ON deployments(app_id, created_at DESC);
@@ -0,0 +1,6 @@
+-- Migration Rollback: Remove admin impersonation sessions and the audit log
+
+DROP TRIGGER IF EXISTS audit_log_no_update ON audit_log;
+DROP FUNCTION IF EXISTS audit_log_append_only();
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS impersonation_sessions;
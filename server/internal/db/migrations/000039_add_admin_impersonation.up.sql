@@ -0,0 +1,50 @@
+-- Add admin impersonation sessions and the audit log
+-- Support staff can mint a short-lived token that acts as a user. Each impersonation is a session
+-- (who, whom, why, until when) and every request made with its token is written to audit_log,
+-- which is append-only and reviewed through GET /admin/audit.
+
+CREATE TABLE IF NOT EXISTS impersonation_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    admin_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    admin_email VARCHAR(255) NOT NULL,
+    target_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    target_email VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP,                          -- Set when the admin ends the session early
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonation_sessions_target ON impersonation_sessions(target_user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    action VARCHAR(100) NOT NULL,                -- e.g. impersonation.start, impersonation.request
+    actor_user_id UUID,                          -- Who acted (the admin for impersonated requests); no FK so entries outlive users
+    actor_email VARCHAR(255) NOT NULL DEFAULT '',
+    subject_user_id UUID,                        -- Account acted on or as
+    impersonation_id UUID REFERENCES impersonation_sessions(id),
+    method VARCHAR(10) NOT NULL DEFAULT '',
+    path TEXT NOT NULL DEFAULT '',
+    status_code INTEGER,
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    request_id VARCHAR(100) NOT NULL DEFAULT '',
+    details JSONB,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_subject ON audit_log(subject_user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_impersonation ON audit_log(impersonation_id, created_at);
+
+-- Append-only: entries can be added but never changed or removed
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_no_update ON audit_log;
+CREATE TRIGGER audit_log_no_update
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,4 @@
+-- Migration Rollback: Remove deployment state-change events
+
+DROP INDEX IF EXISTS idx_deployment_state_events_deployment;
+DROP TABLE IF EXISTS deployment_state_events;
@@ -0,0 +1,20 @@
+-- Add deployment state-change events
+-- Deployment statuses only change through the state machine in internal/deploystate, which rejects
+-- illegal transitions and records every accepted one here in the same statement. Existing
+-- deployments get one event for the status they are in, so every history has a starting point.
+
+CREATE TABLE IF NOT EXISTS deployment_state_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    deployment_id UUID NOT NULL REFERENCES deployments(id) ON DELETE CASCADE,
+    from_status VARCHAR(20),                     -- NULL for the event that created the deployment
+    to_status VARCHAR(20) NOT NULL,
+    actor VARCHAR(50) NOT NULL,                  -- Component that made the change, e.g. deploy-worker, health-check
+    reason TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_deployment_state_events_deployment ON deployment_state_events(deployment_id, created_at);
+
+INSERT INTO deployment_state_events (deployment_id, from_status, to_status, actor, reason, created_at)
+SELECT id, NULL, status, 'migration', 'Status before state events were recorded', updated_at
+FROM deployments;
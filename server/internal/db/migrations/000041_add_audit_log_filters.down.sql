@@ -0,0 +1,4 @@
+-- Migration Rollback: Remove audit log filter indexes
+
+DROP INDEX IF EXISTS idx_audit_log_action;
+DROP INDEX IF EXISTS idx_audit_log_actor;
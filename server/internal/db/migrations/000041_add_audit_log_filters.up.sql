@@ -0,0 +1,7 @@
+-- Add audit log indexes for the platform-wide audit subsystem
+-- Sign-ins, API tokens, env var changes, app deletions, plan changes and admin actions are now
+-- audited alongside impersonation. Users list the entries about their own account (as subject or
+-- actor) and both listings filter by action and time range.
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor_user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action, created_at DESC);
@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove app presence snapshots
+
+DROP TABLE IF EXISTS app_presence;
@@ -0,0 +1,12 @@
+-- Add app presence snapshots
+-- The deploy worker samples Traefik every few seconds: requests routed to each app over the last
+-- minute (from its Prometheus counters) and connections open from Traefik to the app's containers
+-- (WebSockets and keep-alive). GET /api/v1/apps/{id}/presence reads the latest snapshot.
+
+CREATE TABLE IF NOT EXISTS app_presence (
+    app_id UUID PRIMARY KEY REFERENCES apps(id) ON DELETE CASCADE,
+    requests_last_minute BIGINT NOT NULL DEFAULT 0,
+    open_connections INTEGER, -- NULL when Traefik's sockets could not be read
+    window_seconds INTEGER NOT NULL DEFAULT 0, -- Span the request count covers (shorter while the sampler warms up)
+    sampled_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove first_deployed_at from apps
+
+ALTER TABLE apps DROP COLUMN IF EXISTS first_deployed_at;
@@ -0,0 +1,15 @@
+-- Add first_deployed_at to apps
+-- Set by the deploy worker on an app's first successful deployment, which sends the owner a
+-- first deployment email. Apps that already deployed are backfilled so they never get one.
+
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS first_deployed_at TIMESTAMP;
+
+UPDATE apps a
+SET first_deployed_at = d.first_at
+FROM (
+    SELECT app_id, MIN(created_at) AS first_at
+    FROM deployments
+    WHERE status IN ('running', 'error', 'stopped')
+    GROUP BY app_id
+) d
+WHERE d.app_id = a.id AND a.first_deployed_at IS NULL;
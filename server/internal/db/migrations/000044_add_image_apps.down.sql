@@ -0,0 +1,9 @@
+-- Migration Rollback: Remove bring-your-own image apps
+
+DROP TABLE IF EXISTS app_registry_credentials;
+
+ALTER TABLE apps DROP COLUMN IF EXISTS image_checked_at;
+ALTER TABLE apps DROP COLUMN IF EXISTS image_latest_digest;
+ALTER TABLE apps DROP COLUMN IF EXISTS image_digest;
+ALTER TABLE apps DROP COLUMN IF EXISTS image_ref;
+ALTER TABLE apps DROP COLUMN IF EXISTS source_type;
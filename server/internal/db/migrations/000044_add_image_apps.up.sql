@@ -0,0 +1,20 @@
+-- Add bring-your-own image apps
+-- Image apps run an existing image from a container registry instead of building a repository.
+-- Each deployment resolves the image reference to a digest and runs exactly that digest; the deploy
+-- worker periodically asks the registry for the reference's current digest to flag updates.
+-- Registry logins for private images are write-only through the API.
+
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS source_type VARCHAR(10) NOT NULL DEFAULT 'git'
+    CHECK (source_type IN ('git', 'image'));
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS image_ref VARCHAR(500);            -- e.g. ghcr.io/acme/api:1.4 (image apps only)
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS image_digest VARCHAR(100);         -- Digest the last successful deployment runs
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS image_latest_digest VARCHAR(100);  -- Digest the registry last served for image_ref
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS image_checked_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS app_registry_credentials (
+    app_id UUID PRIMARY KEY REFERENCES apps(id) ON DELETE CASCADE,
+    username VARCHAR(255) NOT NULL,
+    password TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,4 @@
+-- Migration Rollback: Remove build draining checkpoints
+
+ALTER TABLE build_jobs DROP COLUMN IF EXISTS interruptions;
+ALTER TABLE build_jobs DROP COLUMN IF EXISTS draining_since;
@@ -0,0 +1,7 @@
+-- Add build draining checkpoints
+-- A build worker shutting down (e.g. during a rolling update) lets running builds finish within its drain
+-- window. Builds still running are marked when the drain starts; those the window cuts off go back on the
+-- queue as pending and are counted, instead of failing the deployment.
+
+ALTER TABLE build_jobs ADD COLUMN IF NOT EXISTS draining_since TIMESTAMP;                 -- Set while the worker running the build drains
+ALTER TABLE build_jobs ADD COLUMN IF NOT EXISTS interruptions INTEGER NOT NULL DEFAULT 0; -- Times the build was requeued by a worker shutdown
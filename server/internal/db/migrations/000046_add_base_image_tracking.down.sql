@@ -0,0 +1,13 @@
+-- Migration Rollback: Remove base image tracking and security rebuilds
+
+ALTER TABLE deployments DROP COLUMN IF EXISTS trigger;
+
+ALTER TABLE apps DROP COLUMN IF EXISTS auto_security_rebuild;
+ALTER TABLE apps DROP COLUMN IF EXISTS base_image_handled_digest;
+ALTER TABLE apps DROP COLUMN IF EXISTS base_image_checked_at;
+ALTER TABLE apps DROP COLUMN IF EXISTS base_image_latest_digest;
+ALTER TABLE apps DROP COLUMN IF EXISTS base_image_digest;
+ALTER TABLE apps DROP COLUMN IF EXISTS base_image;
+
+ALTER TABLE build_jobs DROP COLUMN IF EXISTS base_image_digest;
+ALTER TABLE build_jobs DROP COLUMN IF EXISTS base_image;
@@ -0,0 +1,16 @@
+-- Add base image tracking and security rebuilds
+-- Builds record the base image (FROM of the final Dockerfile stage) and the digest they used. The deploy
+-- worker checks the registry for new digests of each app's base image, tells the owner once per new digest
+-- and, for apps that opted in, rebuilds and redeploys them. Deployments record what triggered them.
+
+ALTER TABLE build_jobs ADD COLUMN IF NOT EXISTS base_image VARCHAR(500);
+ALTER TABLE build_jobs ADD COLUMN IF NOT EXISTS base_image_digest VARCHAR(100);
+
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS base_image VARCHAR(500);                  -- Base image of the latest successful build
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS base_image_digest VARCHAR(100);           -- Digest that build used
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS base_image_latest_digest VARCHAR(100);    -- Digest the registry last served for base_image
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS base_image_checked_at TIMESTAMP;
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS base_image_handled_digest VARCHAR(100);   -- Latest digest the owner was told about (and rebuilt for)
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS auto_security_rebuild BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS trigger VARCHAR(30);                -- What started the deployment (NULL when not recorded)
@@ -0,0 +1,5 @@
+-- Migration Rollback: Remove who triggered each deployment
+
+DROP INDEX IF EXISTS idx_deployments_app_trigger;
+
+ALTER TABLE deployments DROP COLUMN IF EXISTS triggered_by;
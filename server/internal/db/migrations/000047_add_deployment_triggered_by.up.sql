@@ -0,0 +1,10 @@
+-- Add who triggered each deployment
+-- deployments.trigger (000046) records what started a deployment; triggered_by records the user for
+-- deployments a person started. Rollbacks from before triggers were recorded are backfilled.
+
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS triggered_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+UPDATE deployments SET trigger = 'rollback' WHERE trigger IS NULL AND rollback_from_deployment_id IS NOT NULL;
+
+-- Deployment lists filter by trigger within an app
+CREATE INDEX IF NOT EXISTS idx_deployments_app_trigger ON deployments(app_id, trigger, created_at DESC);
@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove Procfile processes per app
+
+DROP TABLE IF EXISTS app_processes;
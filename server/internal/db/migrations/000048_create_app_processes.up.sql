@@ -0,0 +1,13 @@
+-- Add Procfile processes per app
+-- The build records the non-web entries of the app's Procfile (worker, cron, ...). Enabled ones run as
+-- worker containers next to the web container on plans with workers; they are never routed.
+
+CREATE TABLE IF NOT EXISTS app_processes (
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    name VARCHAR(63) NOT NULL,
+    command TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (app_id, name)
+);
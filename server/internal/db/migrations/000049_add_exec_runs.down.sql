@@ -0,0 +1,5 @@
+-- Migration Rollback: Remove one-off exec runs
+
+DROP TABLE IF EXISTS exec_runs;
+
+ALTER TABLE plans DROP COLUMN IF EXISTS exec_timeout_seconds;
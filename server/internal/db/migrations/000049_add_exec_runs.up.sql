@@ -0,0 +1,27 @@
+-- Add one-off exec runs
+-- POST /api/v1/apps/{id}/exec runs a command (database migrations, maintenance scripts) in a temporary container of
+-- the app's running image. The deploy worker appends output to the run as it is produced so the API can
+-- stream it; exec_timeout_seconds caps how long a run may take on each plan.
+
+ALTER TABLE plans
+ADD COLUMN IF NOT EXISTS exec_timeout_seconds INTEGER NOT NULL DEFAULT 300;
+
+UPDATE plans SET exec_timeout_seconds = 1800 WHERE name = 'pro';
+
+CREATE TABLE IF NOT EXISTS exec_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    command TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'succeeded', 'failed')),
+    image_name VARCHAR(500),
+    timeout_seconds INTEGER NOT NULL,
+    exit_code INTEGER,
+    output TEXT NOT NULL DEFAULT '',
+    error_message TEXT,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_exec_runs_app_created ON exec_runs(app_id, created_at DESC);
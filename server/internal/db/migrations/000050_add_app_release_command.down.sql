@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove release phase command from apps
+
+ALTER TABLE apps DROP COLUMN IF EXISTS release_command;
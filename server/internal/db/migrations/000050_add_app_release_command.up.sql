@@ -0,0 +1,6 @@
+-- Add release phase command to apps
+-- When set, the deploy worker runs release_command (e.g. database migrations) in a one-off container of the
+-- new image before it routes traffic to it. A failing command fails the deployment and the previous one stays live.
+
+ALTER TABLE apps
+ADD COLUMN IF NOT EXISTS release_command TEXT;
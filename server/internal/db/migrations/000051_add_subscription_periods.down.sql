@@ -0,0 +1,8 @@
+-- Migration Rollback: Remove billing periods from subscriptions
+
+DROP INDEX IF EXISTS idx_subscriptions_period_end;
+
+ALTER TABLE subscriptions
+DROP COLUMN IF EXISTS cancel_at_period_end,
+DROP COLUMN IF EXISTS current_period_end,
+DROP COLUMN IF EXISTS current_period_start;
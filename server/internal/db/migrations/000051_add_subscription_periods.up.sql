@@ -0,0 +1,14 @@
+-- Add billing periods to subscriptions
+-- current_period_end comes from Lemon Squeezy's renews_at (ends_at once cancelled). Lemon Squeezy sends no period
+-- start, so a period starts where the previous one ended (or when the subscription was created).
+-- A cancelled subscription stays active with cancel_at_period_end set until current_period_end passes.
+
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS current_period_start TIMESTAMP,
+ADD COLUMN IF NOT EXISTS current_period_end TIMESTAMP,
+ADD COLUMN IF NOT EXISTS cancel_at_period_end BOOLEAN NOT NULL DEFAULT false;
+
+-- Index for period end checks (used by billing worker)
+CREATE INDEX IF NOT EXISTS idx_subscriptions_period_end
+  ON subscriptions(current_period_end)
+  WHERE status = 'active' AND cancel_at_period_end = true;
@@ -0,0 +1,18 @@
+-- Migration Rollback: Remove the billing webhook inbox columns
+
+DROP INDEX IF EXISTS idx_billing_webhook_events_due;
+
+-- Events that were never applied are dropped so their redelivery is processed again
+DELETE FROM billing_webhook_events WHERE status != 'processed';
+
+UPDATE billing_webhook_events SET processed_at = received_at WHERE processed_at IS NULL;
+ALTER TABLE billing_webhook_events ALTER COLUMN processed_at SET DEFAULT NOW();
+ALTER TABLE billing_webhook_events ALTER COLUMN processed_at SET NOT NULL;
+
+ALTER TABLE billing_webhook_events
+DROP COLUMN IF EXISTS received_at,
+DROP COLUMN IF EXISTS next_attempt_at,
+DROP COLUMN IF EXISTS last_error,
+DROP COLUMN IF EXISTS attempts,
+DROP COLUMN IF EXISTS status,
+DROP COLUMN IF EXISTS payload;
@@ -0,0 +1,23 @@
+-- Turn billing_webhook_events into an inbox of billing webhook deliveries
+-- Each delivery's payload is kept with its processing status. An event that fails to apply stays 'pending'
+-- and the API retries it with backoff at next_attempt_at; after the last attempt it is 'failed' until an
+-- admin replays it. Events recorded before this migration were processed and have no payload.
+
+ALTER TABLE billing_webhook_events
+ADD COLUMN IF NOT EXISTS payload JSONB,
+ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'processed' CHECK (status IN ('pending', 'processed', 'failed')),
+ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS last_error TEXT,
+ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS received_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+UPDATE billing_webhook_events SET attempts = 1, received_at = processed_at WHERE payload IS NULL;
+
+-- processed_at is only set once an event has been applied
+ALTER TABLE billing_webhook_events ALTER COLUMN processed_at DROP NOT NULL;
+ALTER TABLE billing_webhook_events ALTER COLUMN processed_at DROP DEFAULT;
+
+-- Index for the retry worker
+CREATE INDEX IF NOT EXISTS idx_billing_webhook_events_due
+  ON billing_webhook_events(next_attempt_at)
+  WHERE status = 'pending';
@@ -0,0 +1,4 @@
+-- Migration Rollback: Remove email log
+
+DROP INDEX IF EXISTS idx_email_log_status;
+DROP TABLE IF EXISTS email_log;
@@ -0,0 +1,21 @@
+-- Add email log for queued email delivery
+-- Every email is recorded here and delivered by the email task, which retries failed deliveries and
+-- leaves emails that never went out as 'dead'. Emails with an idempotency key (e.g. trial reminders)
+-- are only ever queued once. Bodies are emptied once sent since they may hold one-time codes.
+
+CREATE TABLE IF NOT EXISTS email_log (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    idempotency_key VARCHAR(255) UNIQUE, -- NULL for emails that may repeat (OTPs, alerts)
+    recipient VARCHAR(255) NOT NULL,
+    subject TEXT NOT NULL,
+    html_body TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued', -- queued | sent | dead
+    attempts INTEGER NOT NULL DEFAULT 0,
+    provider VARCHAR(20), -- resend | smtp (the provider that took the email)
+    provider_message_id VARCHAR(255),
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_log_status ON email_log(status, created_at);
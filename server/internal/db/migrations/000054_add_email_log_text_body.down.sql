@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove plaintext bodies from the email log
+
+ALTER TABLE email_log DROP COLUMN IF EXISTS text_body;
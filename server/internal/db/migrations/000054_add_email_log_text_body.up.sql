@@ -0,0 +1,5 @@
+-- Add plaintext bodies to the email log
+-- Emails are sent with a plaintext alternative of their HTML body. Like the HTML body it is emptied
+-- once the email is sent.
+
+ALTER TABLE email_log ADD COLUMN IF NOT EXISTS text_body TEXT NOT NULL DEFAULT '';
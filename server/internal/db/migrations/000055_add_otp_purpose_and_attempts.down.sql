@@ -0,0 +1,7 @@
+-- Migration Rollback: Remove purposes and attempt counts from one-time codes
+
+DROP INDEX IF EXISTS idx_otps_email_purpose;
+ALTER TABLE otps DROP COLUMN IF EXISTS signup_password_hash;
+ALTER TABLE otps DROP COLUMN IF EXISTS signup_full_name;
+ALTER TABLE otps DROP COLUMN IF EXISTS attempts;
+ALTER TABLE otps DROP COLUMN IF EXISTS purpose;
@@ -0,0 +1,14 @@
+-- Add purposes and attempt counts to one-time codes
+-- A code only verifies the flow it was issued for (login, signup or password_reset), and is used up
+-- after too many wrong guesses. Signup codes carry the account to create once the address is verified.
+
+ALTER TABLE otps ADD COLUMN IF NOT EXISTS purpose VARCHAR(20) NOT NULL DEFAULT 'login';
+ALTER TABLE otps ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE otps ADD COLUMN IF NOT EXISTS signup_full_name VARCHAR(255);
+ALTER TABLE otps ADD COLUMN IF NOT EXISTS signup_password_hash VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_otps_email_purpose ON otps(email, purpose) WHERE used = false;
+
+-- Outstanding codes were issued before codes had a purpose; retire them rather than let e.g. a
+-- password reset code pass as a sign-in code
+UPDATE otps SET used = true WHERE used = false;
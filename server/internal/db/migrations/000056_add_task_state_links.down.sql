@@ -0,0 +1,9 @@
+-- Migration Rollback: Remove deployment links and start times from task states
+
+DROP INDEX IF EXISTS idx_task_states_updated_at;
+DROP INDEX IF EXISTS idx_task_states_build_job_id;
+DROP INDEX IF EXISTS idx_task_states_deployment_id;
+ALTER TABLE task_states DROP COLUMN IF EXISTS started_at;
+ALTER TABLE task_states DROP COLUMN IF EXISTS build_job_id;
+ALTER TABLE task_states DROP COLUMN IF EXISTS deployment_id;
+ALTER TABLE task_states DROP COLUMN IF EXISTS app_id;
@@ -0,0 +1,14 @@
+-- Add deployment links and start times to task states
+-- Workers record each task they run in task_states (and the API each build and deploy it enqueues),
+-- so a deployment's build and deploy tasks can be listed with their status, attempts and last error.
+-- Task IDs are reused by deduplicated tasks (e.g. builds of the same commit); a new run replaces the row.
+
+ALTER TABLE task_states ADD COLUMN IF NOT EXISTS app_id UUID;
+ALTER TABLE task_states ADD COLUMN IF NOT EXISTS deployment_id UUID;
+ALTER TABLE task_states ADD COLUMN IF NOT EXISTS build_job_id UUID;
+ALTER TABLE task_states ADD COLUMN IF NOT EXISTS started_at TIMESTAMP;
+ALTER TABLE task_states ALTER COLUMN task_type TYPE VARCHAR(100);
+
+CREATE INDEX IF NOT EXISTS idx_task_states_deployment_id ON task_states(deployment_id) WHERE deployment_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_task_states_build_job_id ON task_states(build_job_id) WHERE build_job_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_task_states_updated_at ON task_states(updated_at);
@@ -0,0 +1,6 @@
+-- Migration Rollback: Remove runtimes and start/finish times from build jobs
+
+DROP INDEX IF EXISTS idx_build_jobs_finished_at;
+ALTER TABLE build_jobs DROP COLUMN IF EXISTS finished_at;
+ALTER TABLE build_jobs DROP COLUMN IF EXISTS started_at;
+ALTER TABLE build_jobs DROP COLUMN IF EXISTS runtime;
@@ -0,0 +1,8 @@
+-- Add runtimes and start/finish times to build jobs
+-- Recent build durations per runtime give queued and running builds an ETA.
+
+ALTER TABLE build_jobs ADD COLUMN IF NOT EXISTS runtime VARCHAR(50);     -- Runtime detected in the source (NULL until detected)
+ALTER TABLE build_jobs ADD COLUMN IF NOT EXISTS started_at TIMESTAMP;    -- When a worker started the build (reset when a drained build restarts)
+ALTER TABLE build_jobs ADD COLUMN IF NOT EXISTS finished_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_build_jobs_finished_at ON build_jobs(finished_at) WHERE status = 'completed';
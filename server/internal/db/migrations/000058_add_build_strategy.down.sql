@@ -0,0 +1,4 @@
+-- Migration Rollback: Remove build strategy from apps and build jobs
+
+ALTER TABLE build_jobs DROP COLUMN IF EXISTS build_strategy;
+ALTER TABLE apps DROP COLUMN IF EXISTS build_strategy;
@@ -0,0 +1,11 @@
+-- Add build strategy to apps and build jobs
+-- apps.build_strategy picks how the build worker turns an app's source into an image: 'dockerfile' uses the repo's
+-- Dockerfile (or one generated for the detected runtime), 'buildpacks' runs Cloud Native Buildpacks on the source.
+-- build_jobs.build_strategy records the strategy that produced each build's image.
+
+ALTER TABLE apps
+ADD COLUMN IF NOT EXISTS build_strategy VARCHAR(20) NOT NULL DEFAULT 'dockerfile'
+    CHECK (build_strategy IN ('dockerfile', 'buildpacks'));
+
+ALTER TABLE build_jobs
+ADD COLUMN IF NOT EXISTS build_strategy VARCHAR(20);
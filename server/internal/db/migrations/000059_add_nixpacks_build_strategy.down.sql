@@ -0,0 +1,6 @@
+-- Migration Rollback: Remove nixpacks from the build strategies apps can choose
+
+UPDATE apps SET build_strategy = 'dockerfile' WHERE build_strategy = 'nixpacks';
+ALTER TABLE apps DROP CONSTRAINT IF EXISTS apps_build_strategy_check;
+ALTER TABLE apps ADD CONSTRAINT apps_build_strategy_check
+    CHECK (build_strategy IN ('dockerfile', 'buildpacks'));
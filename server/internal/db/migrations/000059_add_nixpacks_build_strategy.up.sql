@@ -0,0 +1,5 @@
+-- Add nixpacks to the build strategies apps can choose
+
+ALTER TABLE apps DROP CONSTRAINT IF EXISTS apps_build_strategy_check;
+ALTER TABLE apps ADD CONSTRAINT apps_build_strategy_check
+    CHECK (build_strategy IN ('dockerfile', 'buildpacks', 'nixpacks'));
@@ -0,0 +1,6 @@
+-- Migration Rollback: Remove per-plan build resource limits
+
+ALTER TABLE plans
+DROP COLUMN IF EXISTS build_timeout_minutes,
+DROP COLUMN IF EXISTS build_memory_mb,
+DROP COLUMN IF EXISTS build_cpu_shares;
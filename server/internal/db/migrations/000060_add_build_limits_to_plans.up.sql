@@ -0,0 +1,11 @@
+-- Add per-plan build resource limits
+-- Builds run with these CPU shares (relative weight, 1024 = one full share), memory limit and
+-- wall-clock timeout; a build past its timeout is stopped and fails with "build timed out after Xm".
+-- Timeouts are capped at 25 minutes by the build worker.
+
+ALTER TABLE plans
+ADD COLUMN IF NOT EXISTS build_cpu_shares INTEGER NOT NULL DEFAULT 512,
+ADD COLUMN IF NOT EXISTS build_memory_mb INTEGER NOT NULL DEFAULT 2048,
+ADD COLUMN IF NOT EXISTS build_timeout_minutes INTEGER NOT NULL DEFAULT 15;
+
+UPDATE plans SET build_cpu_shares = 1024, build_memory_mb = 4096, build_timeout_minutes = 25 WHERE name = 'pro';
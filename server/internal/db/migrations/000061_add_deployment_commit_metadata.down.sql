@@ -0,0 +1,6 @@
+-- Migration Rollback: Remove commit metadata from deployments table
+
+ALTER TABLE deployments
+DROP COLUMN IF EXISTS commit_branch,
+DROP COLUMN IF EXISTS commit_message,
+DROP COLUMN IF EXISTS commit_author;
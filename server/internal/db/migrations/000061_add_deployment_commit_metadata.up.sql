@@ -0,0 +1,8 @@
+-- Add commit metadata to deployments table
+-- Next to commit_sha, deployments record the author, message and branch of the commit their image was
+-- built from, so the dashboard can show e.g. "deploying abc1234: fix login bug". Rollbacks and route
+-- refreshes reuse the metadata of the build whose image they redeploy, like commit_sha.
+ALTER TABLE deployments
+ADD COLUMN IF NOT EXISTS commit_author VARCHAR(255),
+ADD COLUMN IF NOT EXISTS commit_message TEXT,
+ADD COLUMN IF NOT EXISTS commit_branch VARCHAR(255);
@@ -0,0 +1,6 @@
+-- Migration Rollback: Remove deploy hook secret from apps table
+
+DROP INDEX IF EXISTS idx_apps_deploy_hooks;
+
+ALTER TABLE apps
+DROP COLUMN IF EXISTS deploy_hook_secret;
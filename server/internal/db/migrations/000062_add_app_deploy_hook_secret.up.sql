@@ -0,0 +1,8 @@
+-- Add deploy hook secret to apps
+-- Push webhooks from GitLab (/api/v1/hooks/gitlab) and Bitbucket (/api/v1/hooks/bitbucket) build and deploy
+-- apps whose repo and branch were pushed. GitLab sends the secret in X-Gitlab-Token, Bitbucket signs the
+-- body with it. Apps without a secret ignore push webhooks.
+ALTER TABLE apps
+ADD COLUMN IF NOT EXISTS deploy_hook_secret VARCHAR(100);
+
+CREATE INDEX IF NOT EXISTS idx_apps_deploy_hooks ON apps(branch) WHERE deploy_hook_secret IS NOT NULL;
@@ -0,0 +1,3 @@
+-- Migration Rollback: Drop app transfers table
+
+DROP TABLE IF EXISTS app_transfers;
@@ -0,0 +1,28 @@
+-- Add app transfers between users and organizations
+-- An app admin offers the app to another user or an organization; it moves when the recipient (the user,
+-- or an admin or owner of the organization) accepts. Deployments, env vars, domains and logs belong to the
+-- app, so they move with it. The destination's plan quotas are checked again on acceptance.
+CREATE TABLE IF NOT EXISTS app_transfers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    from_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    from_organization_id UUID REFERENCES organizations(id) ON DELETE SET NULL,
+    to_user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    to_organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+    requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'accepted', 'declined', 'cancelled')),
+    resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK ((to_user_id IS NULL) <> (to_organization_id IS NULL))
+);
+
+-- One open transfer per app
+CREATE UNIQUE INDEX IF NOT EXISTS idx_app_transfers_pending
+ON app_transfers(app_id)
+WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_app_transfers_to_user ON app_transfers(to_user_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_app_transfers_to_organization ON app_transfers(to_organization_id) WHERE status = 'pending';
@@ -0,0 +1,2 @@
+-- Migration Rollback: Remove per-app routing settings
+DROP TABLE IF EXISTS app_routing_settings;
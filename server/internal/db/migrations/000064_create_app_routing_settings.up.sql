@@ -0,0 +1,15 @@
+-- Add per-app routing settings
+-- Edge options applied as Traefik middlewares on an app's routers: HTTP to HTTPS redirect, response
+-- compression, a request body limit, custom response headers and basic auth. Apps without a row are
+-- served with the defaults (HTTPS forced, nothing else).
+
+CREATE TABLE IF NOT EXISTS app_routing_settings (
+    app_id UUID PRIMARY KEY REFERENCES apps(id) ON DELETE CASCADE,
+    force_https BOOLEAN NOT NULL DEFAULT TRUE,
+    compression BOOLEAN NOT NULL DEFAULT FALSE,
+    max_request_body_bytes BIGINT NOT NULL DEFAULT 0,  -- 0 = no limit
+    headers JSONB NOT NULL DEFAULT '{}',               -- Response headers added to every response
+    basic_auth_user TEXT NOT NULL DEFAULT '',          -- htpasswd entry (user:bcrypt hash), empty = no basic auth
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,5 @@
+-- Migration Rollback: Remove per-app access rules
+
+ALTER TABLE plans DROP COLUMN IF EXISTS access_rules;
+
+ALTER TABLE app_routing_settings DROP COLUMN IF EXISTS ip_allowlist;
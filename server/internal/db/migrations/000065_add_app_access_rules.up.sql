@@ -0,0 +1,11 @@
+-- Add per-app access rules
+-- Apps can be restricted to IP ranges (a Traefik ipallowlist middleware in front of the basic auth one).
+-- Restricting who reaches an app - IP ranges or a shared password - is a plan feature (access_rules).
+
+ALTER TABLE app_routing_settings
+ADD COLUMN IF NOT EXISTS ip_allowlist TEXT[] NOT NULL DEFAULT '{}';  -- CIDRs, empty = every address
+
+ALTER TABLE plans
+ADD COLUMN IF NOT EXISTS access_rules BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE plans SET access_rules = TRUE WHERE name = 'pro';
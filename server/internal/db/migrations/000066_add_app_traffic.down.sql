@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove per-app traffic buckets
+
+DROP TABLE IF EXISTS app_traffic;
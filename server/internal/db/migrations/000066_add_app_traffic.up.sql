@@ -0,0 +1,20 @@
+-- Add per-app traffic buckets
+-- The deploy worker reads Traefik's JSON access log and adds every request to its app's one-minute bucket:
+-- request count, status classes, response bytes sent (egress) and a latency histogram (bounds in
+-- services.TrafficLatencyBoundsMs; histograms add up, so percentiles are computed over any window).
+-- GET /api/v1/apps/{id}/traffic reads them; buckets older than TRAFFIC_RETENTION_DAYS are purged.
+
+CREATE TABLE IF NOT EXISTS app_traffic (
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    bucket_start TIMESTAMP NOT NULL,                 -- UTC, truncated to the minute
+    requests BIGINT NOT NULL DEFAULT 0,
+    status_2xx BIGINT NOT NULL DEFAULT 0,
+    status_3xx BIGINT NOT NULL DEFAULT 0,
+    status_4xx BIGINT NOT NULL DEFAULT 0,
+    status_5xx BIGINT NOT NULL DEFAULT 0,
+    egress_bytes BIGINT NOT NULL DEFAULT 0,          -- Response body bytes sent to clients
+    latency_histogram BIGINT[] NOT NULL,             -- Counts per latency slot, same length in every row
+    PRIMARY KEY (app_id, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_traffic_bucket_start ON app_traffic(bucket_start);
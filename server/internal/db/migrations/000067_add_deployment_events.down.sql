@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove deployment events
+
+DROP TABLE IF EXISTS deployment_events;
@@ -0,0 +1,21 @@
+-- Add deployment events
+-- The build and deploy workers record each step a deploy goes through (build queued, clone finished,
+-- image built, container started, health check passed, route switched) and what happens to the running
+-- container afterwards (crashed, restarted). GET /api/v1/apps/{id}/events returns them in order, so users
+-- can see where a deploy is or which step it failed at. Build steps carry the build job ID only; steps
+-- from the deployment record on carry the deployment too and are removed with it.
+
+CREATE TABLE IF NOT EXISTS deployment_events (
+    id BIGSERIAL PRIMARY KEY,                        -- Increases in recording order
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    build_job_id UUID,                               -- Not a reference: builds are queued before their build job is recorded
+    deployment_id UUID REFERENCES deployments(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,                       -- services.DeployEvent* constants
+    message TEXT NOT NULL DEFAULT '',
+    data JSONB NOT NULL DEFAULT '{}'::jsonb,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_deployment_events_app_id ON deployment_events(app_id, id);
+CREATE INDEX IF NOT EXISTS idx_deployment_events_build_job_id ON deployment_events(build_job_id) WHERE build_job_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_deployment_events_deployment_id ON deployment_events(deployment_id) WHERE deployment_id IS NOT NULL;
@@ -0,0 +1,6 @@
+-- Migration Rollback: Remove crash logs from deployments
+
+UPDATE deployments SET status = 'failed' WHERE status = 'crashed';
+
+ALTER TABLE deployments
+DROP COLUMN IF EXISTS crash_log;
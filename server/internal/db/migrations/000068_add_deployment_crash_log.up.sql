@@ -0,0 +1,7 @@
+-- Add crash logs to deployments
+-- The deploy worker watches app containers for exits and restarts them with exponential backoff. After
+-- CRASH_LOOP_MAX_RESTARTS restarts without the container staying up, the deployment moves to the new
+-- 'crashed' status and keeps the last lines the container wrote to stderr, shown with the deployment.
+
+ALTER TABLE deployments
+ADD COLUMN IF NOT EXISTS crash_log TEXT;
@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove Docker hosts
+
+DROP TABLE IF EXISTS hosts;
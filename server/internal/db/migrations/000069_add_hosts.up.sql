@@ -0,0 +1,29 @@
+-- Add Docker hosts
+-- Each deploy worker reports the capacity of the Docker host it runs app containers on every 30 seconds,
+-- keyed by its node name (NODE_NAME, the name deployments.node records). GET /admin/hosts lists them.
+-- POST /admin/hosts/{id}/drain stops the host's deploy workers from taking new deploys, so it can be
+-- maintained without new containers landing on it; deploys wait in the queue for another host.
+
+CREATE TABLE IF NOT EXISTS hosts (
+    name VARCHAR(255) PRIMARY KEY,                  -- Node name of the deploy worker (deployments.node)
+    region VARCHAR(100),
+    docker_version VARCHAR(50),
+    operating_system VARCHAR(255),
+    cpus INTEGER NOT NULL DEFAULT 0,
+    memory_bytes BIGINT NOT NULL DEFAULT 0,
+    cpus_reserved DOUBLE PRECISION NOT NULL DEFAULT 0, -- CPU limits of the app containers running on it
+    memory_reserved_bytes BIGINT NOT NULL DEFAULT 0,   -- Memory limits of the app containers running on it
+    disk_total_bytes BIGINT,                         -- Docker data root; NULL when it is not mounted into the worker
+    disk_used_bytes BIGINT,
+    containers INTEGER NOT NULL DEFAULT 0,
+    containers_running INTEGER NOT NULL DEFAULT 0,
+    app_containers INTEGER NOT NULL DEFAULT 0,       -- Running app (web) containers
+    images INTEGER NOT NULL DEFAULT 0,
+    images_bytes BIGINT NOT NULL DEFAULT 0,
+    draining BOOLEAN NOT NULL DEFAULT FALSE,
+    drain_reason TEXT,
+    drained_at TIMESTAMP,
+    drained_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    reported_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,4 @@
+-- Migration Rollback: Remove host scheduling
+
+ALTER TABLE hosts DROP COLUMN IF EXISTS docker_endpoint;
+ALTER TABLE hosts DROP COLUMN IF EXISTS address;
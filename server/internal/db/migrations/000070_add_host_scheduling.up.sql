@@ -0,0 +1,9 @@
+-- Add host scheduling
+-- With more than one Docker host reporting, deploys are placed on the online, undrained host with the
+-- most free memory that fits the app's plan-limited RAM (the app's current host wins while it fits) and
+-- queued for that host's deploy workers. deployments.node records where each container ended up.
+-- address is where other hosts' Traefik forwards requests for the apps running here; docker_endpoint is
+-- how other deploy workers reach this host's Docker daemon to copy images built here.
+
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS address VARCHAR(255);
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS docker_endpoint VARCHAR(255);
@@ -0,0 +1,4 @@
+-- Migration Rollback: Remove container isolation levels
+
+ALTER TABLE apps DROP COLUMN IF EXISTS isolation;
+ALTER TABLE plans DROP COLUMN IF EXISTS isolation;
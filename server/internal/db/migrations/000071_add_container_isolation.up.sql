@@ -0,0 +1,17 @@
+-- Add container isolation levels
+-- App containers run on the host Docker daemon. Each plan sets how tightly they are confined:
+--   standard - Docker's defaults
+--   hardened - no-new-privileges, the configured seccomp profile, a minimal capability set, a process limit
+--   strict   - hardened with a read-only root filesystem and the sandbox runtime (e.g. gVisor's runsc)
+-- Untrusted workloads (trials and the free starter plan) get strict; paid plans default to hardened.
+-- apps.isolation lets an app opt into a stricter level than its plan's (NULL = the plan's).
+
+ALTER TABLE plans
+ADD COLUMN IF NOT EXISTS isolation VARCHAR(20) NOT NULL DEFAULT 'strict'
+    CHECK (isolation IN ('standard', 'hardened', 'strict'));
+
+UPDATE plans SET isolation = 'hardened' WHERE name = 'pro';
+
+ALTER TABLE apps
+ADD COLUMN IF NOT EXISTS isolation VARCHAR(20)
+    CHECK (isolation IN ('standard', 'hardened', 'strict'));
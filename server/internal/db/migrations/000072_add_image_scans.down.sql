@@ -0,0 +1,5 @@
+-- Migration Rollback: Remove image vulnerability scans
+
+ALTER TABLE organizations DROP COLUMN IF EXISTS block_critical_vulnerabilities;
+
+DROP TABLE IF EXISTS image_scans;
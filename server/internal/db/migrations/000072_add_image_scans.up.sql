@@ -0,0 +1,26 @@
+-- Add image vulnerability scans
+-- After a successful build the build worker scans the image with Trivy and records the findings against
+-- the build job; GET /api/v1/deployments/{id}/vulnerabilities returns them for the deployments of that
+-- build. Organizations can set block_critical_vulnerabilities to fail deploys of images whose scan found
+-- critical vulnerabilities. Builds that were not scanned, or whose scan failed, deploy as before.
+
+CREATE TABLE IF NOT EXISTS image_scans (
+    build_job_id UUID PRIMARY KEY,                   -- Not a reference: builds are queued before their build job is recorded
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    image_name TEXT NOT NULL,
+    scanner VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('completed', 'failed')),
+    critical_count INTEGER NOT NULL DEFAULT 0,
+    high_count INTEGER NOT NULL DEFAULT 0,
+    medium_count INTEGER NOT NULL DEFAULT 0,
+    low_count INTEGER NOT NULL DEFAULT 0,
+    unknown_count INTEGER NOT NULL DEFAULT 0,
+    vulnerabilities JSONB NOT NULL DEFAULT '[]'::jsonb, -- services.Vulnerability, most severe first
+    error_message TEXT,
+    scanned_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_image_scans_app_id ON image_scans(app_id);
+
+ALTER TABLE organizations
+ADD COLUMN IF NOT EXISTS block_critical_vulnerabilities BOOLEAN NOT NULL DEFAULT FALSE;
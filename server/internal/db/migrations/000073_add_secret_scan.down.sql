@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove secret scan mode from apps
+
+ALTER TABLE apps DROP COLUMN IF EXISTS secret_scan;
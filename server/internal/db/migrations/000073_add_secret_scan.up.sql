@@ -0,0 +1,8 @@
+-- Add secret scan mode to apps
+-- Before each build the build worker scans the app's source for committed credentials (cloud keys, private keys,
+-- high-entropy tokens). apps.secret_scan picks what findings do: 'warn' writes them to the build log, 'block'
+-- fails the build before the image is built, 'off' skips the scan.
+
+ALTER TABLE apps
+ADD COLUMN IF NOT EXISTS secret_scan VARCHAR(10) NOT NULL DEFAULT 'warn'
+    CHECK (secret_scan IN ('off', 'warn', 'block'));
@@ -0,0 +1,4 @@
+-- Migration Rollback: Remove app log lines
+-- pg_trgm is left installed; other database objects may have come to rely on it
+
+DROP TABLE IF EXISTS app_log_lines;
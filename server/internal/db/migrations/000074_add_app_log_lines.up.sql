@@ -0,0 +1,22 @@
+-- Add app log lines for log search
+-- The build and deploy workers still write each build, release and runtime log to a file; as they do, every
+-- line is also indexed here with its timestamp (Docker's for runtime logs, the time it was written otherwise)
+-- and a level guessed from its text. GET /api/v1/apps/{id}/logs/search filters them by time range and level
+-- and matches a substring or regex, which the trigram index serves without scanning the app's whole history.
+-- The cleanup worker prunes lines older than LOG_SEARCH_RETENTION_DAYS.
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE TABLE IF NOT EXISTS app_log_lines (
+    id BIGSERIAL PRIMARY KEY,                        -- Increases in indexing order
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    log_type VARCHAR(20) NOT NULL,                   -- build | runtime | release
+    source_id VARCHAR(100) NOT NULL DEFAULT '',      -- Build job ID (build), container ID (runtime) or deployment ID (release)
+    level VARCHAR(10) NOT NULL DEFAULT '',           -- error | warn | info | debug, '' when the line names none
+    logged_at TIMESTAMP NOT NULL,                    -- UTC
+    line TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_log_lines_app_logged_at ON app_log_lines(app_id, logged_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_app_log_lines_line_trgm ON app_log_lines USING GIN (line gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_app_log_lines_logged_at ON app_log_lines(logged_at);
@@ -0,0 +1,3 @@
+-- Migration Rollback: Remove app log drains
+DROP INDEX IF EXISTS idx_app_log_drains_app_id;
+DROP TABLE IF EXISTS app_log_drains;
@@ -0,0 +1,23 @@
+-- Add per-app log drains
+-- Users point an app's runtime logs at their own endpoints: syslog over TLS, plain HTTP (JSON),
+-- Loki push or Datadog intake. The deploy worker ships lines as it persists them, buffering
+-- while an endpoint is slow and dropping (and counting) lines once the buffer is full, and
+-- records each drain's health here for the API to show.
+
+CREATE TABLE IF NOT EXISTS app_log_drains (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('syslog', 'http', 'loki', 'datadog')),
+    url TEXT NOT NULL,                           -- syslog+tls://host:port or an https endpoint
+    token TEXT,                                  -- Bearer token, Loki user:password or Datadog API key
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'healthy', 'failing')),
+    last_error TEXT,
+    last_error_at TIMESTAMP,
+    last_delivered_at TIMESTAMP,
+    dropped_lines BIGINT NOT NULL DEFAULT 0,     -- Lines dropped because the drain's buffer was full
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_log_drains_app_id ON app_log_drains(app_id);
@@ -0,0 +1,4 @@
+-- Migration Rollback: Remove structured fields from app log lines
+
+ALTER TABLE app_log_lines DROP COLUMN IF EXISTS fields;
+ALTER TABLE app_log_lines DROP COLUMN IF EXISTS message;
@@ -0,0 +1,8 @@
+-- Add structured fields to app log lines
+-- Lines that are JSON objects (zap, logrus, pino, structlog and most other structured loggers) are parsed as
+-- they are indexed: their level comes from the level field instead of being guessed from the text, their
+-- message is stored in message and their other fields in fields. Plain text lines leave both NULL.
+
+ALTER TABLE app_log_lines
+ADD COLUMN IF NOT EXISTS message TEXT,
+ADD COLUMN IF NOT EXISTS fields JSONB;
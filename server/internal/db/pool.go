@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/infra"
+	"stackyn/server/internal/metrics"
+)
+
+// NewPool connects the connection pool of a process (name shows up as application_name in
+// pg_stat_activity) with the pool settings of cfg, and reports its state on /metrics.
+// Every query gets a deadline of cfg.QueryTimeoutSeconds and every wait for a connection one of
+// cfg.AcquireTimeoutSeconds, on top of the caller's context, so a slow query fails instead of holding
+// its connection until the pool is exhausted. Postgres enforces the same limit with statement_timeout
+func NewPool(ctx context.Context, cfg infra.PostgresConfig, name string, logger *zap.Logger) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database connection string: %w", err)
+	}
+
+	queryTimeout := time.Duration(cfg.QueryTimeoutSeconds) * time.Second
+	poolConfig.MaxConns = int32(cfg.MaxConns)
+	poolConfig.MinConns = int32(cfg.MinConns)
+	poolConfig.MaxConnLifetime = time.Duration(cfg.MaxConnLifetimeMinutes) * time.Minute
+	poolConfig.MaxConnIdleTime = time.Duration(cfg.MaxConnIdleMinutes) * time.Minute
+	poolConfig.HealthCheckPeriod = time.Duration(cfg.HealthCheckPeriodSeconds) * time.Second
+	poolConfig.ConnConfig.ConnectTimeout = 5 * time.Second
+	poolConfig.ConnConfig.RuntimeParams["application_name"] = name
+	poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(queryTimeout.Milliseconds(), 10)
+	poolConfig.ConnConfig.Tracer = &timeoutTracer{
+		queryTimeout:   queryTimeout,
+		acquireTimeout: time.Duration(cfg.AcquireTimeoutSeconds) * time.Second,
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database connection pool: %w", err)
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := pool.Ping(pingCtx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	metrics.WatchDBPool(pool)
+	logger.Info("Database connection established",
+		zap.String("application_name", name),
+		zap.Int32("max_conns", poolConfig.MaxConns),
+		zap.Int32("min_conns", poolConfig.MinConns),
+		zap.Duration("query_timeout", queryTimeout),
+	)
+	return pool, nil
+}
+
+// timeoutTracer bounds every query and every wait for a pooled connection with a deadline. pgx runs
+// the query (and reads its rows) with the context TraceQueryStart returns, and calls TraceQueryEnd
+// when the rows are closed, which releases the timer
+type timeoutTracer struct {
+	queryTimeout   time.Duration
+	acquireTimeout time.Duration
+}
+
+type cancelKey struct{}
+
+func (t *timeoutTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return withDeadline(ctx, t.queryTimeout)
+}
+
+func (t *timeoutTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	endDeadline(ctx, data.Err, "query")
+}
+
+func (t *timeoutTracer) TraceAcquireStart(ctx context.Context, _ *pgxpool.Pool, _ pgxpool.TraceAcquireStartData) context.Context {
+	return withDeadline(ctx, t.acquireTimeout)
+}
+
+func (t *timeoutTracer) TraceAcquireEnd(ctx context.Context, _ *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	endDeadline(ctx, data.Err, "acquire")
+}
+
+func withDeadline(ctx context.Context, timeout time.Duration) context.Context {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return context.WithValue(ctx, cancelKey{}, cancel)
+}
+
+// endDeadline releases the deadline withDeadline set and counts the operations it cut off
+func endDeadline(ctx context.Context, err error, stage string) {
+	if cancel, ok := ctx.Value(cancelKey{}).(context.CancelFunc); ok {
+		cancel()
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		metrics.DBTimeoutsTotal.Inc(stage)
+	}
+}
@@ -0,0 +1,236 @@
+// Package deploystate is the deployment status state machine.
+//
+// Every write to deployments.status goes through Insert or Transition: a status is only written when
+// the transition table allows it, and each accepted change is recorded in deployment_state_events by
+// the same statement, so a deployment's status and its history cannot disagree.
+package deploystate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Status is a deployment status as stored in deployments.status
+type Status string
+
+// Deployment statuses
+const (
+	Pending   Status = "pending"   // Queued, build not started
+	Building  Status = "building"  // Image is being built
+	Deploying Status = "deploying" // Container is being started and health checked
+	Running   Status = "running"   // Serving traffic
+	Error     Status = "error"     // Running, but failing its health checks
+	Stopped   Status = "stopped"   // Replaced by a newer deployment
+	Failed    Status = "failed"    // Build or deploy failed, or the container remained unhealthy
+	Crashed   Status = "crashed"   // The container kept exiting and crash-loop restarts gave up
+	Cancelled Status = "cancelled" // Build cancelled by the user
+)
+
+// Actors recorded on state events
+const (
+	ActorDeployWorker = "deploy-worker"
+	ActorHealthCheck  = "health-check"
+	ActorCrashMonitor = "crash-monitor"
+	ActorWatchdog     = "stale-deployment-watchdog"
+	ActorUser         = "user"
+)
+
+// Triggers recorded on deployments: what started them
+// Deployments started by a person also record who (triggered_by); the others were started by the platform
+const (
+	TriggerManual          = "manual"           // Deploy, redeploy or app creation from the dashboard
+	TriggerCLI             = "cli"              // The same, authenticated with an API token (CLI, CI scripts)
+	TriggerWebhook         = "webhook"          // A push to the app's branch; the deployment records the pushed commit
+	TriggerRollback        = "rollback"         // Rollback to an earlier deployment's image
+	TriggerRestart         = "restart"          // Restart of the running image with the current env vars
+	TriggerConfigChange    = "config_change"    // Routes regenerated after a domain or WAF change
+	TriggerSecurityRebuild = "security_rebuild" // Rebuilt on a new digest of the app's base image
+	TriggerSystem          = "system"           // Recovery of a stuck deployment or repair of drifted routing
+)
+
+// Triggers lists every trigger, in the order above (deployment lists can be filtered by them)
+var Triggers = []string{
+	TriggerManual, TriggerCLI, TriggerWebhook, TriggerRollback, TriggerRestart,
+	TriggerConfigChange, TriggerSecurityRebuild, TriggerSystem,
+}
+
+// InteractiveTrigger reports whether someone is waiting on a deployment started by trigger
+// Interactive builds and deploys run on reserved queues so automated ones (pushes, security rebuilds,
+// recoveries) cannot starve them
+func InteractiveTrigger(trigger string) bool {
+	switch trigger {
+	case TriggerManual, TriggerCLI, TriggerRollback, TriggerRestart, TriggerConfigChange:
+		return true
+	default:
+		return false
+	}
+}
+
+// ValidTrigger reports whether trigger is one of Triggers
+func ValidTrigger(trigger string) bool {
+	for _, t := range Triggers {
+		if t == trigger {
+			return true
+		}
+	}
+	return false
+}
+
+// initial is the "from" state of a deployment that does not exist yet
+const initial Status = ""
+
+// transitions lists the states each state may move to. Stopped, failed, crashed and cancelled are final
+var transitions = map[Status][]Status{
+	initial:   {Pending, Building, Deploying, Running, Failed, Cancelled},
+	Pending:   {Building, Failed, Cancelled},
+	Building:  {Deploying, Failed, Cancelled},
+	Deploying: {Running, Failed, Crashed},
+	Running:   {Error, Stopped, Failed, Crashed},
+	Error:     {Running, Stopped, Failed, Crashed},
+}
+
+// ErrIllegalTransition is wrapped by every *TransitionError
+var ErrIllegalTransition = errors.New("illegal deployment state transition")
+
+// TransitionError is returned when a deployment cannot move from its current state to the requested one
+type TransitionError struct {
+	DeploymentID string
+	From         Status
+	To           Status
+}
+
+func (e *TransitionError) Error() string {
+	from := string(e.From)
+	if e.From == initial {
+		from = "(new)"
+	}
+	if e.DeploymentID == "" {
+		return fmt.Sprintf("%s: %s -> %s", ErrIllegalTransition, from, e.To)
+	}
+	return fmt.Sprintf("%s: deployment %s %s -> %s", ErrIllegalTransition, e.DeploymentID, from, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrIllegalTransition
+}
+
+// CanTransition reports whether a deployment in from may move to to
+func CanTransition(from, to Status) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Failure reports whether s is an unsuccessful outcome whose reason belongs in error_message
+func (s Status) Failure() bool {
+	return s == Error || s == Failed || s == Crashed || s == Cancelled
+}
+
+// sources returns the states to may be reached from (excluding creation)
+func sources(to Status) []string {
+	var from []string
+	for state, nexts := range transitions {
+		if state == initial {
+			continue
+		}
+		for _, next := range nexts {
+			if next == to {
+				from = append(from, string(state))
+			}
+		}
+	}
+	return from
+}
+
+// Change describes who made a state change and why
+// For failure states the reason is also stored as the deployment's error message
+type Change struct {
+	Actor  string
+	Reason string
+}
+
+// DB is satisfied by *pgxpool.Pool, *pgx.Conn and pgx.Tx
+type DB interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// NewDeployment is a deployment row to insert
+type NewDeployment struct {
+	AppID       string
+	BuildJobID  *string // nil when there is no build job row to reference
+	Status      Status
+	ImageName   string
+	ContainerID string
+	Subdomain   string
+}
+
+// Insert creates a deployment in its first state and records the creation event
+func Insert(ctx context.Context, db DB, d NewDeployment, change Change) (string, error) {
+	if !CanTransition(initial, d.Status) {
+		return "", &TransitionError{From: initial, To: d.Status}
+	}
+
+	var id string
+	err := db.QueryRow(ctx,
+		`WITH created AS (
+		     INSERT INTO deployments (app_id, build_job_id, status, image_name, container_id, subdomain, error_message)
+		     VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), CASE WHEN $8 THEN NULLIF($7, '') END)
+		     RETURNING id
+		 ), event AS (
+		     INSERT INTO deployment_state_events (deployment_id, from_status, to_status, actor, reason)
+		     SELECT id, NULL, $3, $9, NULLIF($7, '') FROM created
+		 )
+		 SELECT id FROM created`,
+		d.AppID, d.BuildJobID, string(d.Status), d.ImageName, d.ContainerID, d.Subdomain,
+		sanitize(change.Reason), d.Status.Failure(), change.Actor,
+	).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Transition moves a deployment to a new state and records the event, returning the state it left
+// Returns a *TransitionError if the current state does not allow it, or pgx.ErrNoRows if the
+// deployment does not exist. Moving to the state a deployment is already in is a no-op
+func Transition(ctx context.Context, db DB, deploymentID string, to Status, change Change) (Status, error) {
+	var from string
+	var applied bool
+	err := db.QueryRow(ctx,
+		`WITH current AS (
+		     SELECT id, status FROM deployments WHERE id = $1 FOR UPDATE
+		 ), changed AS (
+		     UPDATE deployments d
+		     SET status = $2,
+		         error_message = CASE WHEN $5 THEN COALESCE(NULLIF($4, ''), d.error_message) ELSE d.error_message END,
+		         updated_at = NOW()
+		     FROM current c
+		     WHERE d.id = c.id AND c.status = ANY($3::text[])
+		     RETURNING d.id, c.status AS from_status
+		 ), event AS (
+		     INSERT INTO deployment_state_events (deployment_id, from_status, to_status, actor, reason)
+		     SELECT id, from_status, $2, $6, NULLIF($4, '') FROM changed
+		 )
+		 SELECT c.status, EXISTS (SELECT 1 FROM changed) FROM current c`,
+		deploymentID, string(to), sources(to), sanitize(change.Reason), to.Failure(), change.Actor,
+	).Scan(&from, &applied)
+	if err != nil {
+		return "", err
+	}
+	if !applied && Status(from) != to {
+		return Status(from), &TransitionError{DeploymentID: deploymentID, From: Status(from), To: to}
+	}
+	return Status(from), nil
+}
+
+// sanitize removes NULL bytes, which PostgreSQL TEXT cannot contain
+func sanitize(s string) string {
+	return strings.ReplaceAll(s, "\x00", "")
+}
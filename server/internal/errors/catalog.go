@@ -14,6 +14,8 @@ const (
 	ErrorCodeRepoPrivateUnsupported  ErrorCode = "REPO_PRIVATE_UNSUPPORTED"
 	ErrorCodeRepoTooLarge            ErrorCode = "REPO_TOO_LARGE"
 	ErrorCodeMonorepoDetected        ErrorCode = "MONOREPO_DETECTED"
+	ErrorCodeRootDirNotFound         ErrorCode = "ROOT_DIR_NOT_FOUND"
+	ErrorCodeSecretsDetected         ErrorCode = "SECRETS_DETECTED"
 
 	// Build Detection Errors
 	ErrorCodeRuntimeNotDetected      ErrorCode = "RUNTIME_NOT_DETECTED"
@@ -47,6 +49,7 @@ const (
 	ErrorCodeDeployLocked            ErrorCode = "DEPLOY_LOCKED"
 	ErrorCodeZeroDowntimeNotSupported ErrorCode = "ZERO_DOWNTIME_NOT_SUPPORTED"
 	ErrorCodePlanLimitExceeded       ErrorCode = "PLAN_LIMIT_EXCEEDED"
+	ErrorCodeDeployStalled           ErrorCode = "DEPLOY_STALLED"
 
 	// Logging & Observability Errors
 	ErrorCodeLogStreamFailed         ErrorCode = "LOG_STREAM_FAILED"
@@ -60,18 +63,41 @@ const (
 	ErrorCodeHostOutOfMemory         ErrorCode = "HOST_OUT_OF_MEMORY"
 	ErrorCodeBuildNodeUnavailable     ErrorCode = "BUILD_NODE_UNAVAILABLE"
 	ErrorCodeInternalPlatformError    ErrorCode = "INTERNAL_PLATFORM_ERROR"
+
+	// API Request Errors - the codes of API errors that have no more specific one above
+	ErrorCodeBadRequest              ErrorCode = "BAD_REQUEST"
+	ErrorCodeUnauthorized            ErrorCode = "UNAUTHORIZED"
+	ErrorCodePaymentRequired         ErrorCode = "PAYMENT_REQUIRED"
+	ErrorCodeForbidden               ErrorCode = "FORBIDDEN"
+	ErrorCodeNotFound                ErrorCode = "NOT_FOUND"
+	ErrorCodeMethodNotAllowed        ErrorCode = "METHOD_NOT_ALLOWED"
+	ErrorCodeConflict                ErrorCode = "CONFLICT"
+	ErrorCodeGone                    ErrorCode = "GONE"
+	ErrorCodePayloadTooLarge         ErrorCode = "PAYLOAD_TOO_LARGE"
+	ErrorCodeUnsupportedMediaType    ErrorCode = "UNSUPPORTED_MEDIA_TYPE"
+	ErrorCodeValidationFailed        ErrorCode = "VALIDATION_FAILED"
+	ErrorCodeConstraintViolated      ErrorCode = "CONSTRAINT_VIOLATED"
+	ErrorCodeRateLimited             ErrorCode = "RATE_LIMITED"
+	ErrorCodeNotImplemented          ErrorCode = "NOT_IMPLEMENTED"
+	ErrorCodeUpstreamError           ErrorCode = "UPSTREAM_ERROR"
+	ErrorCodeServiceUnavailable      ErrorCode = "SERVICE_UNAVAILABLE"
+	ErrorCodeUpstreamTimeout         ErrorCode = "UPSTREAM_TIMEOUT"
+	ErrorCodeIdempotencyKeyInUse     ErrorCode = "IDEMPOTENCY_KEY_IN_USE"
+	ErrorCodeIdempotencyKeyReused    ErrorCode = "IDEMPOTENCY_KEY_REUSED"
 )
 
 // Error messages map
 var errorMessages = map[ErrorCode]string{
 	// Git & Repo Errors
-	ErrorCodeRepoNotFound:            "Repository not found. Please check the GitHub URL and branch.",
+	ErrorCodeRepoNotFound:            "Repository not found. Please check the repository URL and branch.",
 	ErrorCodeRepoPrivateUnsupported:   "Private repositories are not supported in Stackyn MVP.",
 	ErrorCodeRepoTooLarge:            "Repository is too large to build on Stackyn MVP.",
-	ErrorCodeMonorepoDetected:        "Monorepos are not supported in Stackyn MVP.",
+	ErrorCodeMonorepoDetected:        "This repository contains several apps. Set the app's root directory to the one to build.",
+	ErrorCodeRootDirNotFound:         "Root directory not found in the repository. Please check the root directory and branch.",
+	ErrorCodeSecretsDetected:         "Credentials are committed to the repository. Remove and rotate them, or mark false positives with stackyn:allow-secret.",
 
 	// Build Detection Errors
-	ErrorCodeRuntimeNotDetected:      "Couldn't detect a supported runtime. Supported: Node.js, Python, Go, Java.",
+	ErrorCodeRuntimeNotDetected:      "Couldn't detect a supported runtime. Supported: Node.js, Python, Go, Java, Ruby, PHP, Rust, Elixir, Deno, Bun, static sites.",
 	ErrorCodeUnsupportedLanguage:     "This runtime is not supported yet.",
 	ErrorCodeCustomSystemDependency:   "This app requires system dependencies not supported in MVP.",
 
@@ -79,7 +105,7 @@ var errorMessages = map[ErrorCode]string{
 	ErrorCodeDockerfilePresent:       "Custom Dockerfiles are not supported in Stackyn MVP.",
 	ErrorCodeDockerComposePresent:    "Multi-container apps are not supported in Stackyn MVP.",
 	ErrorCodeBuildFailed:             "Build failed during dependency installation.",
-	ErrorCodeBuildTimeout:            "Build exceeded the maximum allowed time.",
+	ErrorCodeBuildTimeout:            "Build exceeded the time limit of your plan.",
 	ErrorCodeImageTooLarge:           "Built image exceeds size limits.",
 
 	// Runtime & Startup Errors
@@ -102,6 +128,7 @@ var errorMessages = map[ErrorCode]string{
 	ErrorCodeDeployLocked:            "A deployment is already running for this app.",
 	ErrorCodeZeroDowntimeNotSupported: "Zero-downtime deploys are not available on your plan.",
 	ErrorCodePlanLimitExceeded:       "You've reached the maximum number of apps for your plan.",
+	ErrorCodeDeployStalled:           "The build or deployment stopped responding and was marked as failed.",
 
 	// Logging & Observability Errors
 	ErrorCodeLogStreamFailed:         "Failed to stream application logs.",
@@ -115,6 +142,27 @@ var errorMessages = map[ErrorCode]string{
 	ErrorCodeHostOutOfMemory:          "Temporary infrastructure issue. Please retry later.",
 	ErrorCodeBuildNodeUnavailable:     "No build capacity available right now.",
 	ErrorCodeInternalPlatformError:    "Something went wrong on Stackyn's side.",
+
+	// API Request Errors
+	ErrorCodeBadRequest:               "The request is malformed.",
+	ErrorCodeUnauthorized:             "Authentication is required.",
+	ErrorCodePaymentRequired:          "This action requires an active subscription.",
+	ErrorCodeForbidden:                "You don't have permission to do this.",
+	ErrorCodeNotFound:                 "The requested resource was not found.",
+	ErrorCodeMethodNotAllowed:         "This method is not allowed on the resource.",
+	ErrorCodeConflict:                 "The request conflicts with the current state of the resource.",
+	ErrorCodeGone:                     "The resource is no longer available.",
+	ErrorCodePayloadTooLarge:          "The request body is too large.",
+	ErrorCodeUnsupportedMediaType:     "The request body has an unsupported content type.",
+	ErrorCodeValidationFailed:         "One or more request fields are invalid.",
+	ErrorCodeConstraintViolated:       "The app doesn't meet the platform's constraints.",
+	ErrorCodeRateLimited:              "Too many requests. Please retry later.",
+	ErrorCodeNotImplemented:           "This feature is not available yet.",
+	ErrorCodeUpstreamError:            "An upstream service returned an error.",
+	ErrorCodeServiceUnavailable:       "The service is temporarily unavailable. Please retry later.",
+	ErrorCodeUpstreamTimeout:          "An upstream service timed out.",
+	ErrorCodeIdempotencyKeyInUse:      "A request with this Idempotency-Key is still being processed. Retry once it has finished.",
+	ErrorCodeIdempotencyKeyReused:     "This Idempotency-Key was already used with a different request.",
 }
 
 // StackynError represents a structured error with code and message
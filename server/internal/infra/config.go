@@ -3,7 +3,9 @@ package infra
 import (
 	"errors"
 	"fmt"
+	"net"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/viper"
@@ -23,6 +25,9 @@ type Config struct {
 	// Docker configuration
 	Docker DockerConfig
 
+	// Node identity (where deploy workers run app containers)
+	Node NodeConfig
+
 	// Traefik configuration
 	Traefik TraefikConfig
 
@@ -37,11 +42,80 @@ type Config struct {
 
 	// Email configuration
 	Email EmailConfig
+
+	// Billing configuration
+	Billing BillingConfig
+
+	// Authentication mode configuration
+	Auth AuthConfig
+
+	// Object storage configuration (user uploads such as avatars)
+	Storage StorageConfig
+
+	// Container resource metrics configuration
+	Metrics MetricsConfig
+
+	// Failure injection for testing (never allowed in production)
+	Chaos ChaosConfig
+
+	// Recovery of builds/deploys left in progress by a dead worker
+	StaleDeployments StaleDeploymentConfig
+
+	// Letting running builds finish when the build worker shuts down
+	BuildDrain BuildDrainConfig
+
+	// Watching build base images for new upstream digests (security rebuilds)
+	BaseImages BaseImageConfig
+
+	// Images of apps using the buildpacks build strategy
+	Buildpacks BuildpacksConfig
+
+	// CLI building apps using the nixpacks build strategy
+	Nixpacks NixpacksConfig
+
+	// Vulnerability scanning of built images
+	VulnScan VulnScanConfig
+
+	// Worker capacity reserved for builds and deploys someone is waiting on
+	QueueQoS QueueQoSConfig
+
+	// Sleeping idle apps on plans that are not always-on
+	Idle IdleConfig
+
+	// Per-app request metrics and bandwidth from Traefik's access log
+	Traffic TrafficConfig
+
+	// Restarting app containers that exit, before giving up on them as crashed
+	CrashLoop CrashLoopConfig
+
+	// Sandboxing of app containers on hardened and strict isolation levels
+	Isolation IsolationConfig
+
+	// Pruning of old deployment rows and their images during cleanup
+	DeploymentRetention DeploymentRetentionConfig
+
+	// When the cleanup worker removes old images and containers to free disk space
+	Cleanup CleanupConfig
+
+	// Support staff access (impersonation, audit review)
+	Admin AdminConfig
+
+	// Redis cache of hot database reads (user profiles, subscriptions, app lists)
+	Cache CacheConfig
+
+	// Log lines indexed in Postgres for GET /api/v1/apps/{id}/logs/search
+	LogSearch LogSearchConfig
 }
 
 type ServerConfig struct {
 	Addr string
 	Port string
+	// Address the fallback page for app hosts Traefik has no route to is served on (empty disables)
+	FallbackAddr string
+	// Largest request body the API reads, in KB (push webhooks and avatar uploads allow more)
+	MaxBodyKB int
+	// How long responses to requests with an Idempotency-Key are replayed to retries, in hours
+	IdempotencyTTLHours int
 }
 
 type PostgresConfig struct {
@@ -53,6 +127,18 @@ type PostgresConfig struct {
 	SSLMode  string
 	// Computed connection string
 	DSN string
+
+	// Connection pool of each process (the API and every worker has its own)
+	MaxConns                 int
+	MinConns                 int
+	MaxConnLifetimeMinutes   int
+	MaxConnIdleMinutes       int
+	HealthCheckPeriodSeconds int
+	// How long a query may wait for a pooled connection before failing, in seconds
+	AcquireTimeoutSeconds int
+	// How long a single query may run before it is cancelled, in seconds (also set as the server-side
+	// statement_timeout, so a query stuck in Postgres never holds its connection longer)
+	QueryTimeoutSeconds int
 }
 
 type RedisConfig struct {
@@ -73,10 +159,21 @@ type DockerConfig struct {
 	CAPath     string
 }
 
+// NodeConfig identifies the host a deploy worker runs app containers on
+// Deployments record it so maintenance windows can target the apps on a node or region
+type NodeConfig struct {
+	Name           string // Defaults to the hostname
+	Region         string // Optional
+	Address        string // URL of this host's Traefik (websecure) other hosts forward its apps' requests to; needed with more than one host
+	DockerEndpoint string // Docker daemon of this host as other deploy workers reach it, to copy images built here (TLS per DOCKER_TLS_ENABLED)
+}
+
 type TraefikConfig struct {
-	APIURL      string
-	EntryPoint  string
-	NetworkName string
+	APIURL        string
+	EntryPoint    string
+	NetworkName   string
+	ContainerName string // Traefik container whose logs carry app WAF hits (empty disables collecting them)
+	ProviderToken string // Token Traefik's HTTP provider sends for the routes to apps on other hosts (empty disables the endpoint)
 }
 
 type JWTConfig struct {
@@ -87,6 +184,175 @@ type JWTConfig struct {
 type EmailConfig struct {
 	ResendAPIKey string
 	FromEmail   string
+	// SMTP relay used when Resend fails (disabled without a host)
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// Auth modes
+const (
+	AuthModeBuiltin = "builtin" // Email OTP / password sign-in with JWTs
+	AuthModeHeader  = "header"  // Trust an identity header set by an upstream auth proxy (oauth2-proxy, Authelia)
+)
+
+type AuthConfig struct {
+	Mode           string   // builtin | header
+	EmailHeader    string   // Header carrying the authenticated user's email (header mode)
+	NameHeader     string   // Optional header carrying the user's display name (header mode)
+	TrustedProxies []string // CIDRs/IPs allowed to set identity headers (required in header mode)
+}
+
+type StorageConfig struct {
+	Driver      string // local | s3
+	LocalDir    string // Directory for the local driver
+	PublicURL   string // Base URL uploaded objects are served from
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+}
+
+type MetricsConfig struct {
+	SampleIntervalSeconds int // How often the deploy worker samples docker stats for app containers
+	RetentionHours        int // How long samples are kept
+
+	// Prometheus /metrics for the control plane itself
+	ListenAddr  string // Address workers serve /metrics on (empty disables; the API serves it on its own router)
+	ScrapeToken string // Bearer token scrapers must send (empty allows unauthenticated scrapes; the API then serves /metrics only when ENV=development or test)
+}
+
+type StaleDeploymentConfig struct {
+	ThresholdMinutes int  // An app building/deploying for longer than this is marked failed
+	Requeue          bool // Re-enqueue the build once after recovering a stuck app
+}
+
+// BuildDrainConfig controls how the build worker shuts down (e.g. during a rolling update)
+// Builds still running after the drain window go back onto the queue for another worker
+type BuildDrainConfig struct {
+	TimeoutSeconds int // How long running builds may take to finish after SIGTERM (set the container's stop grace period above it)
+}
+
+// BaseImageConfig controls how often the deploy worker checks app base images for new upstream digests
+type BaseImageConfig struct {
+	CheckIntervalHours int // Hours between registry checks (0 disables checking, notices and security rebuilds)
+}
+
+// BuildpacksConfig selects the builder that builds apps using the buildpacks strategy
+// The lifecycle exports images to the Docker daemon through its socket, so DockerSocket is the socket's
+// path on the Docker host (it is mounted into the builder container by the daemon, not by the worker)
+type BuildpacksConfig struct {
+	BuilderImage string // CNB builder image carrying the lifecycle and buildpacks
+	RunImage     string // Base image of the built app images
+	DockerSocket string
+}
+
+// NixpacksConfig locates the nixpacks CLI; the build worker also needs the docker CLI it drives
+type NixpacksConfig struct {
+	Binary string // Path, or name looked up in PATH
+}
+
+// VulnScanConfig locates the Trivy CLI the build worker scans each built image with
+type VulnScanConfig struct {
+	Binary         string // Path, or name looked up in PATH; builds are not scanned when it is missing
+	TimeoutMinutes int    // Longest a scan may take, including refreshing the vulnerability database
+}
+
+// QueueQoSConfig reserves workers for interactive builds and deploys (dashboard, CLI, rollbacks, restarts)
+// Each build/deploy worker runs this many extra workers that only take interactive tasks, so a storm of
+// pushes or security rebuilds cannot starve a user clicking Deploy. The general pool serves both kinds,
+// preferring interactive ones
+//
+// Builds nobody is waiting on are queued by tier: critical (security rebuilds and recoveries), pro (plans
+// with priority_builds), default (other paid plans) and free (trials and accounts without a paid plan).
+// The general pool of 10 build workers takes its next build from a queue with builds waiting with
+// probability weight / sum of those queues' weights. With every queue busy, the default weights
+// (interactive 20, critical 8, pro 6, default 3, free 1) split the pool into about 5.3 workers on
+// interactive builds, 2.1 on critical, 1.6 on pro, 0.8 on default and 0.3 on free; an idle queue's share
+// goes to the others
+type QueueQoSConfig struct {
+	ReservedBuildWorkers  int // Extra concurrent builds per build worker for interactive builds (0 disables)
+	ReservedDeployWorkers int // Extra concurrent deploys per deploy worker for interactive deploys (0 disables)
+
+	BuildWeightInteractive int // Weight of builds someone is waiting on (dashboard, CLI, rollbacks)
+	BuildWeightCritical    int // Weight of security rebuilds and recoveries of stuck deployments
+	BuildWeightPro         int // Weight of automated builds on plans with priority_builds
+	BuildWeightDefault     int // Weight of automated builds on other paid plans
+	BuildWeightFree        int // Weight of automated builds of trials and accounts without a paid plan
+}
+
+// IdleConfig controls sleeping apps nobody has requested for a while (plans without always_on)
+// Request times come from Traefik's JSON access log, so idling stays off until the deploy worker can read it
+type IdleConfig struct {
+	AccessLogPath  string // Traefik access log (JSON format) read by the deploy worker (empty disables idling)
+	TimeoutMinutes int    // Apps without requests for this long are put to sleep
+}
+
+// TrafficConfig controls recording per-app requests, latency and egress from Traefik's JSON access log
+type TrafficConfig struct {
+	AccessLogPath string // Traefik access log (JSON format) read by the deploy worker (empty disables traffic recording)
+	RetentionDays int    // How long per-minute traffic buckets are kept
+}
+
+// CrashLoopConfig controls how the deploy worker restarts app containers that keep exiting (plans with auto-restart)
+type CrashLoopConfig struct {
+	MaxRestarts       int // Restarts before the deployment is marked crashed
+	BackoffSeconds    int // Delay before the first restart, doubled for each one after it
+	MaxBackoffSeconds int // Longest delay between restarts
+}
+
+// IsolationConfig controls what the deploy worker confines app containers with (plans.isolation, apps.isolation)
+// Rootless mode is configured on the daemon itself: point DOCKER_HOST at a rootless Docker daemon
+type IsolationConfig struct {
+	Runtime        string // OCI runtime of strict containers, registered with the Docker daemon (e.g. "runsc" for gVisor); empty uses the daemon's default
+	SeccompProfile string // Path of a seccomp profile (JSON) for hardened and strict containers; empty uses Docker's default profile
+}
+
+// AdminConfig identifies support staff allowed to impersonate users and review the audit log
+type AdminConfig struct {
+	Emails                  []string // Lowercased admin account emails (empty locks every admin endpoint)
+	ImpersonationTTLMinutes int      // Lifetime of an impersonation token
+}
+
+// CacheConfig controls the read cache in front of the user, subscription and app list queries
+type CacheConfig struct {
+	TTLSeconds int // How long a cached read is served; writes through the repositories drop it sooner (0 disables)
+}
+
+// LogSearchConfig controls the searchable copy of app logs the workers index as they persist them
+type LogSearchConfig struct {
+	RetentionDays int // How long indexed lines are kept; the cleanup worker prunes older ones (log files are kept)
+}
+
+// DeploymentRetentionConfig controls how much deployment history the cleanup worker keeps
+type DeploymentRetentionConfig struct {
+	KeepPerApp int // Newest deployments of each app that are never pruned
+	MaxAgeDays int // Finished deployments beyond those older than this are pruned (0 keeps them forever)
+}
+
+// CleanupConfig controls when the cleanup worker frees disk space
+type CleanupConfig struct {
+	MaxDiskUsagePercent float64 // Old images, containers and build cache are removed above this usage
+	DockerDataRoot      string  // Where the Docker data root is mounted in the worker; empty uses the path the daemon reports
+	IntervalMinutes     int     // Time between scheduled cleanup runs
+	JitterMinutes       int     // Up to this much is added to each interval, so workers do not run in lockstep
+}
+
+type ChaosConfig struct {
+	Enabled bool // Exposes /api/v1/dev/chaos and lets workers consume injected faults
+}
+
+type BillingConfig struct {
+	LemonSqueezyAPIKey        string // Used to look up customers when webhooks lack a user ID
+	LemonSqueezyWebhookSecret string
+	LemonSqueezyVariants      map[string]int // Plan name -> Lemon Squeezy variant ID, for in-place plan changes
+	WebhookToleranceSeconds   int // Max age of a webhook event before it is rejected as a replay
+	DowngradeGraceHours       int // Time a user has to get within plan limits before excess apps are paused
+	PaymentGraceHours         int // Read-only window after a failed payment before apps are stopped (0 = stop immediately)
+	UsageCacheSeconds         int // How long usage summaries are cached per user
+	InvoiceCacheSeconds       int // How long billing histories from Lemon Squeezy are cached per user
 }
 
 // LoadConfig loads configuration using viper with support for:
@@ -112,9 +378,101 @@ func LoadConfig() (*Config, error) {
 	viper.BindEnv("redis.db", "REDIS_DB")
 	viper.BindEnv("redis.addr", "REDIS_ADDR")
 	
+	// Explicitly bind environment variables for node config
+	viper.BindEnv("node.name", "NODE_NAME")
+	viper.BindEnv("node.region", "NODE_REGION")
+	viper.BindEnv("node.address", "NODE_ADDRESS")
+	viper.BindEnv("node.docker_endpoint", "NODE_DOCKER_ENDPOINT")
+	viper.BindEnv("traefik.provider_token", "TRAEFIK_PROVIDER_TOKEN")
+	
 	// Explicitly bind environment variables for email config
 	viper.BindEnv("email.resend_api_key", "EMAIL_RESEND_API_KEY")
 	viper.BindEnv("email.from_email", "EMAIL_FROM_EMAIL")
+	viper.BindEnv("email.smtp_host", "EMAIL_SMTP_HOST")
+	viper.BindEnv("email.smtp_port", "EMAIL_SMTP_PORT")
+	viper.BindEnv("email.smtp_username", "EMAIL_SMTP_USERNAME")
+	viper.BindEnv("email.smtp_password", "EMAIL_SMTP_PASSWORD")
+
+	// Explicitly bind environment variables for billing config
+	viper.BindEnv("billing.lemon_squeezy_api_key", "LEMON_SQUEEZY_API_KEY")
+	viper.BindEnv("billing.lemon_squeezy_webhook_secret", "LEMON_SQUEEZY_WEBHOOK_SECRET")
+	viper.BindEnv("billing.lemon_squeezy_variants", "LEMON_SQUEEZY_VARIANTS")
+	viper.BindEnv("billing.webhook_tolerance_seconds", "BILLING_WEBHOOK_TOLERANCE_SECONDS")
+	viper.BindEnv("billing.downgrade_grace_hours", "BILLING_DOWNGRADE_GRACE_HOURS")
+	viper.BindEnv("billing.payment_grace_hours", "BILLING_PAYMENT_GRACE_HOURS")
+	viper.BindEnv("billing.usage_cache_seconds", "BILLING_USAGE_CACHE_SECONDS")
+	viper.BindEnv("billing.invoice_cache_seconds", "BILLING_INVOICE_CACHE_SECONDS")
+
+	// Explicitly bind environment variables for auth mode config
+	viper.BindEnv("auth.mode", "AUTH_MODE")
+	viper.BindEnv("auth.email_header", "AUTH_EMAIL_HEADER")
+	viper.BindEnv("auth.name_header", "AUTH_NAME_HEADER")
+	viper.BindEnv("auth.trusted_proxies", "AUTH_TRUSTED_PROXIES")
+
+	// Explicitly bind environment variables for object storage config
+	viper.BindEnv("storage.driver", "STORAGE_DRIVER")
+	viper.BindEnv("storage.local_dir", "STORAGE_LOCAL_DIR")
+	viper.BindEnv("storage.public_url", "STORAGE_PUBLIC_URL")
+	viper.BindEnv("storage.s3_endpoint", "STORAGE_S3_ENDPOINT")
+	viper.BindEnv("storage.s3_region", "STORAGE_S3_REGION")
+	viper.BindEnv("storage.s3_bucket", "STORAGE_S3_BUCKET")
+	viper.BindEnv("storage.s3_access_key", "STORAGE_S3_ACCESS_KEY")
+	viper.BindEnv("storage.s3_secret_key", "STORAGE_S3_SECRET_KEY")
+
+	// Explicitly bind environment variables for metrics config
+	viper.BindEnv("metrics.sample_interval_seconds", "METRICS_SAMPLE_INTERVAL_SECONDS")
+	viper.BindEnv("metrics.retention_hours", "METRICS_RETENTION_HOURS")
+	viper.BindEnv("metrics.listen_addr", "METRICS_LISTEN_ADDR")
+	viper.BindEnv("metrics.scrape_token", "METRICS_SCRAPE_TOKEN")
+
+	// Explicitly bind environment variables for chaos config
+	viper.BindEnv("chaos.enabled", "CHAOS_ENABLED")
+
+	// Explicitly bind environment variables for stale deployment recovery
+	viper.BindEnv("stale_deployments.threshold_minutes", "STALE_DEPLOYMENT_THRESHOLD_MINUTES")
+	viper.BindEnv("stale_deployments.requeue", "STALE_DEPLOYMENT_REQUEUE")
+
+	// Explicitly bind environment variables for build draining
+	viper.BindEnv("build_drain.timeout_seconds", "BUILD_DRAIN_TIMEOUT_SECONDS")
+
+	// Explicitly bind environment variables for base image checks
+	viper.BindEnv("base_images.check_interval_hours", "BASE_IMAGE_CHECK_INTERVAL_HOURS")
+
+	// Explicitly bind environment variables for queue QoS
+	viper.BindEnv("queue_qos.reserved_build_workers", "QUEUE_RESERVED_BUILD_WORKERS")
+	viper.BindEnv("queue_qos.reserved_deploy_workers", "QUEUE_RESERVED_DEPLOY_WORKERS")
+	viper.BindEnv("queue_qos.build_weight_interactive", "QUEUE_BUILD_WEIGHT_INTERACTIVE")
+	viper.BindEnv("queue_qos.build_weight_critical", "QUEUE_BUILD_WEIGHT_CRITICAL")
+	viper.BindEnv("queue_qos.build_weight_pro", "QUEUE_BUILD_WEIGHT_PRO")
+	viper.BindEnv("queue_qos.build_weight_default", "QUEUE_BUILD_WEIGHT_DEFAULT")
+	viper.BindEnv("queue_qos.build_weight_free", "QUEUE_BUILD_WEIGHT_FREE")
+
+	// Explicitly bind environment variables for app idling
+	viper.BindEnv("idle.access_log_path", "IDLE_ACCESS_LOG_PATH")
+	viper.BindEnv("idle.timeout_minutes", "IDLE_TIMEOUT_MINUTES")
+
+	// Explicitly bind environment variables for app traffic
+	viper.BindEnv("traffic.access_log_path", "TRAFFIC_ACCESS_LOG_PATH")
+	viper.BindEnv("traffic.retention_days", "TRAFFIC_RETENTION_DAYS")
+
+	// Explicitly bind environment variables for crash loop restarts
+	viper.BindEnv("crash_loop.max_restarts", "CRASH_LOOP_MAX_RESTARTS")
+	viper.BindEnv("crash_loop.backoff_seconds", "CRASH_LOOP_BACKOFF_SECONDS")
+	viper.BindEnv("crash_loop.max_backoff_seconds", "CRASH_LOOP_MAX_BACKOFF_SECONDS")
+
+	// Explicitly bind environment variables for container isolation
+	viper.BindEnv("isolation.runtime", "ISOLATION_RUNTIME")
+	viper.BindEnv("isolation.seccomp_profile", "ISOLATION_SECCOMP_PROFILE")
+
+	// Explicitly bind environment variables for admin access
+	viper.BindEnv("admin.emails", "ADMIN_EMAILS")
+	viper.BindEnv("admin.impersonation_ttl_minutes", "ADMIN_IMPERSONATION_TTL_MINUTES")
+
+	// Explicitly bind environment variables for the read cache
+	viper.BindEnv("cache.ttl_seconds", "CACHE_TTL_SECONDS")
+
+	// Explicitly bind environment variables for log search
+	viper.BindEnv("log_search.retention_days", "LOG_SEARCH_RETENTION_DAYS")
 
 	// Set default values (env vars will override these)
 	setDefaults()
@@ -160,6 +518,9 @@ func LoadConfig() (*Config, error) {
 		Server: ServerConfig{
 			Addr: viper.GetString("server.addr"),
 			Port: viper.GetString("server.port"),
+			FallbackAddr: viper.GetString("server.fallback_addr"),
+			MaxBodyKB: viper.GetInt("server.max_body_kb"),
+			IdempotencyTTLHours: viper.GetInt("server.idempotency_ttl_hours"),
 		},
 		Postgres: PostgresConfig{
 			Host:     viper.GetString("postgres.host"),
@@ -168,6 +529,13 @@ func LoadConfig() (*Config, error) {
 			Password: viper.GetString("postgres.password"),
 			Database: viper.GetString("postgres.database"),
 			SSLMode:  viper.GetString("postgres.sslmode"),
+			MaxConns:                 viper.GetInt("postgres.max_conns"),
+			MinConns:                 viper.GetInt("postgres.min_conns"),
+			MaxConnLifetimeMinutes:   viper.GetInt("postgres.max_conn_lifetime_minutes"),
+			MaxConnIdleMinutes:       viper.GetInt("postgres.max_conn_idle_minutes"),
+			HealthCheckPeriodSeconds: viper.GetInt("postgres.health_check_period_seconds"),
+			AcquireTimeoutSeconds:    viper.GetInt("postgres.acquire_timeout_seconds"),
+			QueryTimeoutSeconds:      viper.GetInt("postgres.query_timeout_seconds"),
 		},
 		Redis: RedisConfig{
 			// Read directly from environment variables (bypass viper completely)
@@ -205,10 +573,24 @@ func LoadConfig() (*Config, error) {
 			KeyPath:    viper.GetString("docker.key_path"),
 			CAPath:     viper.GetString("docker.ca_path"),
 		},
+		Node: NodeConfig{
+			Name: func() string {
+				if name := viper.GetString("node.name"); name != "" {
+					return name
+				}
+				hostname, _ := os.Hostname()
+				return hostname
+			}(),
+			Region:         viper.GetString("node.region"),
+			Address:        viper.GetString("node.address"),
+			DockerEndpoint: viper.GetString("node.docker_endpoint"),
+		},
 		Traefik: TraefikConfig{
-			APIURL:      viper.GetString("traefik.api_url"),
-			EntryPoint:  viper.GetString("traefik.entry_point"),
-			NetworkName: viper.GetString("traefik.network_name"),
+			APIURL:        viper.GetString("traefik.api_url"),
+			EntryPoint:    viper.GetString("traefik.entry_point"),
+			NetworkName:   viper.GetString("traefik.network_name"),
+			ContainerName: viper.GetString("traefik.container_name"),
+			ProviderToken: viper.GetString("traefik.provider_token"),
 		},
 		JWT: JWTConfig{
 			Secret:     viper.GetString("jwt.secret"),
@@ -220,6 +602,113 @@ func LoadConfig() (*Config, error) {
 			// Check both dot notation and direct env var name
 			ResendAPIKey: viper.GetString("email.resend_api_key"),
 			FromEmail:   viper.GetString("email.from_email"),
+			SMTPHost:     viper.GetString("email.smtp_host"),
+			SMTPPort:     viper.GetInt("email.smtp_port"),
+			SMTPUsername: viper.GetString("email.smtp_username"),
+			SMTPPassword: viper.GetString("email.smtp_password"),
+		},
+		Billing: BillingConfig{
+			LemonSqueezyAPIKey:        viper.GetString("billing.lemon_squeezy_api_key"),
+			LemonSqueezyWebhookSecret: viper.GetString("billing.lemon_squeezy_webhook_secret"),
+			LemonSqueezyVariants:      parseVariantList(viper.GetString("billing.lemon_squeezy_variants")),
+			WebhookToleranceSeconds:   viper.GetInt("billing.webhook_tolerance_seconds"),
+			DowngradeGraceHours:       viper.GetInt("billing.downgrade_grace_hours"),
+			PaymentGraceHours:         viper.GetInt("billing.payment_grace_hours"),
+			UsageCacheSeconds:         viper.GetInt("billing.usage_cache_seconds"),
+			InvoiceCacheSeconds:       viper.GetInt("billing.invoice_cache_seconds"),
+		},
+		Auth: AuthConfig{
+			Mode:           strings.ToLower(strings.TrimSpace(viper.GetString("auth.mode"))),
+			EmailHeader:    viper.GetString("auth.email_header"),
+			NameHeader:     viper.GetString("auth.name_header"),
+			TrustedProxies: splitCommaList(viper.GetString("auth.trusted_proxies")),
+		},
+		Storage: StorageConfig{
+			Driver:      strings.ToLower(strings.TrimSpace(viper.GetString("storage.driver"))),
+			LocalDir:    viper.GetString("storage.local_dir"),
+			PublicURL:   viper.GetString("storage.public_url"),
+			S3Endpoint:  viper.GetString("storage.s3_endpoint"),
+			S3Region:    viper.GetString("storage.s3_region"),
+			S3Bucket:    viper.GetString("storage.s3_bucket"),
+			S3AccessKey: viper.GetString("storage.s3_access_key"),
+			S3SecretKey: viper.GetString("storage.s3_secret_key"),
+		},
+		Metrics: MetricsConfig{
+			SampleIntervalSeconds: viper.GetInt("metrics.sample_interval_seconds"),
+			RetentionHours:        viper.GetInt("metrics.retention_hours"),
+			ListenAddr:            viper.GetString("metrics.listen_addr"),
+			ScrapeToken:           viper.GetString("metrics.scrape_token"),
+		},
+		Chaos: ChaosConfig{
+			Enabled: viper.GetBool("chaos.enabled"),
+		},
+		StaleDeployments: StaleDeploymentConfig{
+			ThresholdMinutes: viper.GetInt("stale_deployments.threshold_minutes"),
+			Requeue:          viper.GetBool("stale_deployments.requeue"),
+		},
+		BuildDrain: BuildDrainConfig{
+			TimeoutSeconds: viper.GetInt("build_drain.timeout_seconds"),
+		},
+		BaseImages: BaseImageConfig{
+			CheckIntervalHours: viper.GetInt("base_images.check_interval_hours"),
+		},
+		Buildpacks: BuildpacksConfig{
+			BuilderImage: viper.GetString("buildpacks.builder_image"),
+			RunImage:     viper.GetString("buildpacks.run_image"),
+			DockerSocket: viper.GetString("buildpacks.docker_socket"),
+		},
+		Nixpacks: NixpacksConfig{
+			Binary: viper.GetString("nixpacks.binary"),
+		},
+		VulnScan: VulnScanConfig{
+			Binary:         viper.GetString("vuln_scan.binary"),
+			TimeoutMinutes: viper.GetInt("vuln_scan.timeout_minutes"),
+		},
+		QueueQoS: QueueQoSConfig{
+			ReservedBuildWorkers:  viper.GetInt("queue_qos.reserved_build_workers"),
+			ReservedDeployWorkers: viper.GetInt("queue_qos.reserved_deploy_workers"),
+			BuildWeightInteractive: viper.GetInt("queue_qos.build_weight_interactive"),
+			BuildWeightCritical:    viper.GetInt("queue_qos.build_weight_critical"),
+			BuildWeightPro:         viper.GetInt("queue_qos.build_weight_pro"),
+			BuildWeightDefault:     viper.GetInt("queue_qos.build_weight_default"),
+			BuildWeightFree:        viper.GetInt("queue_qos.build_weight_free"),
+		},
+		Idle: IdleConfig{
+			AccessLogPath:  viper.GetString("idle.access_log_path"),
+			TimeoutMinutes: viper.GetInt("idle.timeout_minutes"),
+		},
+		Traffic: TrafficConfig{
+			AccessLogPath: viper.GetString("traffic.access_log_path"),
+			RetentionDays: viper.GetInt("traffic.retention_days"),
+		},
+		DeploymentRetention: DeploymentRetentionConfig{
+			KeepPerApp: viper.GetInt("deployment_retention.keep_per_app"),
+			MaxAgeDays: viper.GetInt("deployment_retention.max_age_days"),
+		},
+		CrashLoop: CrashLoopConfig{
+			MaxRestarts:       viper.GetInt("crash_loop.max_restarts"),
+			BackoffSeconds:    viper.GetInt("crash_loop.backoff_seconds"),
+			MaxBackoffSeconds: viper.GetInt("crash_loop.max_backoff_seconds"),
+		},
+		Isolation: IsolationConfig{
+			Runtime:        viper.GetString("isolation.runtime"),
+			SeccompProfile: viper.GetString("isolation.seccomp_profile"),
+		},
+		Cleanup: CleanupConfig{
+			MaxDiskUsagePercent: viper.GetFloat64("cleanup.max_disk_usage_percent"),
+			DockerDataRoot:      viper.GetString("cleanup.docker_data_root"),
+			IntervalMinutes:     viper.GetInt("cleanup.interval_minutes"),
+			JitterMinutes:       viper.GetInt("cleanup.jitter_minutes"),
+		},
+		Admin: AdminConfig{
+			Emails:                  splitCommaList(strings.ToLower(viper.GetString("admin.emails"))),
+			ImpersonationTTLMinutes: viper.GetInt("admin.impersonation_ttl_minutes"),
+		},
+		Cache: CacheConfig{
+			TTLSeconds: viper.GetInt("cache.ttl_seconds"),
+		},
+		LogSearch: LogSearchConfig{
+			RetentionDays: viper.GetInt("log_search.retention_days"),
 		},
 	}
 
@@ -246,6 +735,9 @@ func setDefaults() {
 	// Server defaults
 	viper.SetDefault("server.addr", "0.0.0.0")
 	viper.SetDefault("server.port", "8080")
+	viper.SetDefault("server.fallback_addr", ":8082")
+	viper.SetDefault("server.max_body_kb", 1024)
+	viper.SetDefault("server.idempotency_ttl_hours", 24)
 
 	// Postgres defaults
 	viper.SetDefault("postgres.host", "localhost")
@@ -254,6 +746,13 @@ func setDefaults() {
 	viper.SetDefault("postgres.password", "")
 	viper.SetDefault("postgres.database", "stackyn")
 	viper.SetDefault("postgres.sslmode", "disable")
+	viper.SetDefault("postgres.max_conns", 25)
+	viper.SetDefault("postgres.min_conns", 5)
+	viper.SetDefault("postgres.max_conn_lifetime_minutes", 30)
+	viper.SetDefault("postgres.max_conn_idle_minutes", 5)
+	viper.SetDefault("postgres.health_check_period_seconds", 60)
+	viper.SetDefault("postgres.acquire_timeout_seconds", 10)
+	viper.SetDefault("postgres.query_timeout_seconds", 30)
 
 	// Redis defaults
 	viper.SetDefault("redis.host", "localhost")
@@ -274,6 +773,7 @@ func setDefaults() {
 	viper.SetDefault("traefik.api_url", "http://localhost:8080")
 	viper.SetDefault("traefik.entry_point", "web")
 	viper.SetDefault("traefik.network_name", "traefik")
+	viper.SetDefault("traefik.container_name", "stackyn-traefik")
 
 	// JWT defaults
 	viper.SetDefault("jwt.secret", "")
@@ -288,6 +788,132 @@ func setDefaults() {
 	// Email defaults
 	viper.SetDefault("email.resend_api_key", "")
 	viper.SetDefault("email.from_email", "noreply@stackyn.com")
+	viper.SetDefault("email.smtp_host", "") // No SMTP fallback until set
+	viper.SetDefault("email.smtp_port", 587)
+
+	// Billing defaults
+	viper.SetDefault("billing.lemon_squeezy_api_key", "")
+	viper.SetDefault("billing.lemon_squeezy_webhook_secret", "")
+	viper.SetDefault("billing.lemon_squeezy_variants", "") // e.g. starter=123456,pro=123457 (plan changes are off until set)
+	viper.SetDefault("billing.webhook_tolerance_seconds", 900) // 15 minutes (covers Lemon Squeezy retry backoff)
+	viper.SetDefault("billing.downgrade_grace_hours", 72)      // 3 days to fix plan limit violations before apps are paused
+	viper.SetDefault("billing.payment_grace_hours", 72)        // 3 days of read-only mode after a failed payment
+	viper.SetDefault("billing.usage_cache_seconds", 60)        // Usage dashboard figures may be up to a minute stale
+	viper.SetDefault("billing.invoice_cache_seconds", 900)     // Billing webhooks drop a user's cached invoices sooner
+
+	// Auth defaults
+	viper.SetDefault("auth.mode", AuthModeBuiltin)
+	viper.SetDefault("auth.email_header", "X-Auth-Request-Email") // oauth2-proxy default
+	viper.SetDefault("auth.name_header", "")
+	viper.SetDefault("auth.trusted_proxies", "")
+
+	// Object storage defaults (local disk; set STORAGE_DRIVER=s3 for a bucket)
+	viper.SetDefault("storage.driver", "local")
+	viper.SetDefault("storage.local_dir", "./uploads")
+	viper.SetDefault("storage.public_url", "")
+	viper.SetDefault("storage.s3_region", "us-east-1")
+
+	// Metrics defaults
+	viper.SetDefault("metrics.sample_interval_seconds", 15)
+	viper.SetDefault("metrics.retention_hours", 24)
+	viper.SetDefault("metrics.listen_addr", ":9091")
+	viper.SetDefault("metrics.scrape_token", "")
+
+	// Chaos defaults (off; only for local and staging environments)
+	viper.SetDefault("chaos.enabled", false)
+
+	// Stale deployment defaults (well above the 15 minute build limit plus deploy health checks)
+	viper.SetDefault("stale_deployments.threshold_minutes", 30)
+	viper.SetDefault("stale_deployments.requeue", false)
+
+	// Build drain defaults (most builds finish within 5 minutes; longer ones are requeued)
+	viper.SetDefault("build_drain.timeout_seconds", 300)
+
+	// Base image defaults (daily keeps anonymous Docker Hub lookups well under its rate limits)
+	viper.SetDefault("base_images.check_interval_hours", 24)
+
+	// Buildpacks defaults (the Paketo builder the generated Dockerfiles use)
+	viper.SetDefault("buildpacks.builder_image", "paketobuildpacks/builder-jammy-base:latest")
+	viper.SetDefault("buildpacks.run_image", "paketobuildpacks/run-jammy-base:latest")
+	viper.SetDefault("buildpacks.docker_socket", "/var/run/docker.sock")
+
+	viper.SetDefault("nixpacks.binary", "nixpacks")
+
+	// Vulnerability scan defaults
+	viper.SetDefault("vuln_scan.binary", "trivy")
+	viper.SetDefault("vuln_scan.timeout_minutes", 10)
+
+	// Queue QoS defaults (builds are heavy, so fewer of them are reserved than deploys)
+	viper.SetDefault("queue_qos.reserved_build_workers", 2)
+	viper.SetDefault("queue_qos.reserved_deploy_workers", 4)
+	viper.SetDefault("queue_qos.build_weight_interactive", 20)
+	viper.SetDefault("queue_qos.build_weight_critical", 8)
+	viper.SetDefault("queue_qos.build_weight_pro", 6)
+	viper.SetDefault("queue_qos.build_weight_default", 3)
+	viper.SetDefault("queue_qos.build_weight_free", 1)
+
+	// Idle defaults (off until the deploy worker is given Traefik's access log)
+	viper.SetDefault("idle.access_log_path", "")
+	viper.SetDefault("idle.timeout_minutes", 30)
+
+	// Traffic defaults (off until the deploy worker is given Traefik's access log)
+	viper.SetDefault("traffic.access_log_path", "")
+	viper.SetDefault("traffic.retention_days", 90)
+
+	// Crash loop defaults (5s, 10s, 20s, 40s, 80s between restarts, then the deployment is marked crashed)
+	viper.SetDefault("crash_loop.max_restarts", 5)
+	viper.SetDefault("crash_loop.backoff_seconds", 5)
+	viper.SetDefault("crash_loop.max_backoff_seconds", 300)
+
+	// Isolation defaults (the daemon's default runtime and Docker's seccomp profile until an admin installs gVisor)
+	viper.SetDefault("isolation.runtime", "")
+	viper.SetDefault("isolation.seccomp_profile", "")
+
+	// Deployment retention defaults
+	viper.SetDefault("deployment_retention.keep_per_app", 20)
+	viper.SetDefault("deployment_retention.max_age_days", 90)
+	viper.SetDefault("cleanup.max_disk_usage_percent", 85)
+	viper.SetDefault("cleanup.docker_data_root", "")
+	viper.SetDefault("cleanup.interval_minutes", 60)
+	viper.SetDefault("cleanup.jitter_minutes", 10)
+
+	// Admin defaults (no admins until ADMIN_EMAILS is set)
+	viper.SetDefault("admin.emails", "")
+	viper.SetDefault("admin.impersonation_ttl_minutes", 30)
+
+	// Read cache defaults
+	viper.SetDefault("cache.ttl_seconds", 30)
+
+	// Log search defaults
+	viper.SetDefault("log_search.retention_days", 7)
+}
+
+// splitCommaList splits a comma-separated config value, dropping empty entries
+func splitCommaList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseVariantList parses plan=variant_id pairs separated by commas, dropping malformed entries
+func parseVariantList(value string) map[string]int {
+	variants := make(map[string]int)
+	for _, item := range splitCommaList(value) {
+		plan, id, ok := strings.Cut(item, "=")
+		if !ok {
+			continue
+		}
+		variantID, err := strconv.Atoi(strings.TrimSpace(id))
+		if err != nil || variantID <= 0 {
+			continue
+		}
+		variants[strings.ToLower(strings.TrimSpace(plan))] = variantID
+	}
+	return variants
 }
 
 func buildPostgresDSN(pg PostgresConfig) string {
@@ -358,6 +984,173 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("missing required configuration: %s", strings.Join(missing, ", "))
 	}
 
+	// Auth mode must be known; header mode needs a header to trust
+	switch config.Auth.Mode {
+	case AuthModeBuiltin:
+	case AuthModeHeader:
+		if config.Auth.EmailHeader == "" {
+			return fmt.Errorf("AUTH_EMAIL_HEADER is required when AUTH_MODE=%s", AuthModeHeader)
+		}
+		// Without them any client that can reach the API could sign in as anyone, admins included
+		if len(config.Auth.TrustedProxies) == 0 {
+			return fmt.Errorf("AUTH_TRUSTED_PROXIES is required when AUTH_MODE=%s", AuthModeHeader)
+		}
+		for _, proxy := range config.Auth.TrustedProxies {
+			if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+				return fmt.Errorf("invalid AUTH_TRUSTED_PROXIES entry %q: must be an IP or CIDR", proxy)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid AUTH_MODE %q: must be %q or %q", config.Auth.Mode, AuthModeBuiltin, AuthModeHeader)
+	}
+
+	// S3 storage needs a bucket and credentials
+	switch config.Storage.Driver {
+	case "local":
+	case "s3":
+		if config.Storage.S3Endpoint == "" || config.Storage.S3Bucket == "" || config.Storage.S3AccessKey == "" || config.Storage.S3SecretKey == "" {
+			return fmt.Errorf("STORAGE_S3_ENDPOINT, STORAGE_S3_BUCKET, STORAGE_S3_ACCESS_KEY and STORAGE_S3_SECRET_KEY are required when STORAGE_DRIVER=s3")
+		}
+	default:
+		return fmt.Errorf("invalid STORAGE_DRIVER %q: must be \"local\" or \"s3\"", config.Storage.Driver)
+	}
+
+	if config.Metrics.SampleIntervalSeconds < 5 {
+		return fmt.Errorf("METRICS_SAMPLE_INTERVAL_SECONDS must be at least 5")
+	}
+	if config.Metrics.RetentionHours < 1 {
+		return fmt.Errorf("METRICS_RETENTION_HOURS must be at least 1")
+	}
+
+	// Builds may legitimately run for up to 25 minutes (the longest plan build timeout); a lower
+	// threshold would fail live builds
+	if config.StaleDeployments.ThresholdMinutes < 30 {
+		return fmt.Errorf("STALE_DEPLOYMENT_THRESHOLD_MINUTES must be at least 30")
+	}
+
+	// Builds are capped at 25 minutes, so a longer drain window only delays shutdown
+	if config.BuildDrain.TimeoutSeconds < 0 || config.BuildDrain.TimeoutSeconds > 1500 {
+		return fmt.Errorf("BUILD_DRAIN_TIMEOUT_SECONDS must be between 0 and 1500")
+	}
+
+	// 0 turns base image checks off
+	if config.BaseImages.CheckIntervalHours < 0 {
+		return fmt.Errorf("BASE_IMAGE_CHECK_INTERVAL_HOURS must not be negative")
+	}
+
+	// Reserved workers run alongside the general pool of 10, so a large reservation overloads the host
+	if config.QueueQoS.ReservedBuildWorkers < 0 || config.QueueQoS.ReservedBuildWorkers > 10 {
+		return fmt.Errorf("QUEUE_RESERVED_BUILD_WORKERS must be between 0 and 10")
+	}
+	if config.QueueQoS.ReservedDeployWorkers < 0 || config.QueueQoS.ReservedDeployWorkers > 10 {
+		return fmt.Errorf("QUEUE_RESERVED_DEPLOY_WORKERS must be between 0 and 10")
+	}
+	// A queue with weight 0 would never be served
+	for name, weight := range map[string]int{
+		"QUEUE_BUILD_WEIGHT_INTERACTIVE": config.QueueQoS.BuildWeightInteractive,
+		"QUEUE_BUILD_WEIGHT_CRITICAL":    config.QueueQoS.BuildWeightCritical,
+		"QUEUE_BUILD_WEIGHT_PRO":         config.QueueQoS.BuildWeightPro,
+		"QUEUE_BUILD_WEIGHT_DEFAULT":     config.QueueQoS.BuildWeightDefault,
+		"QUEUE_BUILD_WEIGHT_FREE":        config.QueueQoS.BuildWeightFree,
+	} {
+		if weight < 1 {
+			return fmt.Errorf("%s must be at least 1", name)
+		}
+	}
+
+	// Apps take a few seconds to wake, so sleeping them after moments of quiet would make every visit slow
+	if config.Idle.TimeoutMinutes < 5 {
+		return fmt.Errorf("IDLE_TIMEOUT_MINUTES must be at least 5")
+	}
+
+	// The traffic endpoint serves windows of up to 30 days
+	if config.Traffic.RetentionDays < 30 {
+		return fmt.Errorf("TRAFFIC_RETENTION_DAYS must be at least 30")
+	}
+
+	// Rollbacks need at least the running deployment and the one before it
+	if config.DeploymentRetention.KeepPerApp < 2 {
+		return fmt.Errorf("DEPLOYMENT_RETENTION_KEEP_PER_APP must be at least 2")
+	}
+	if config.DeploymentRetention.MaxAgeDays < 0 {
+		return fmt.Errorf("DEPLOYMENT_RETENTION_MAX_AGE_DAYS cannot be negative")
+	}
+
+	if config.Server.MaxBodyKB < 16 {
+		return fmt.Errorf("SERVER_MAX_BODY_KB must be at least 16")
+	}
+
+	if config.Server.IdempotencyTTLHours < 1 {
+		return fmt.Errorf("SERVER_IDEMPOTENCY_TTL_HOURS must be at least 1")
+	}
+
+	if config.Postgres.MaxConns < 1 {
+		return fmt.Errorf("POSTGRES_MAX_CONNS must be at least 1")
+	}
+	if config.Postgres.MinConns < 0 || config.Postgres.MinConns > config.Postgres.MaxConns {
+		return fmt.Errorf("POSTGRES_MIN_CONNS must be between 0 and POSTGRES_MAX_CONNS")
+	}
+	for name, value := range map[string]int{
+		"POSTGRES_MAX_CONN_LIFETIME_MINUTES":   config.Postgres.MaxConnLifetimeMinutes,
+		"POSTGRES_MAX_CONN_IDLE_MINUTES":       config.Postgres.MaxConnIdleMinutes,
+		"POSTGRES_HEALTH_CHECK_PERIOD_SECONDS": config.Postgres.HealthCheckPeriodSeconds,
+		"POSTGRES_ACQUIRE_TIMEOUT_SECONDS":     config.Postgres.AcquireTimeoutSeconds,
+		"POSTGRES_QUERY_TIMEOUT_SECONDS":       config.Postgres.QueryTimeoutSeconds,
+	} {
+		if value < 1 {
+			return fmt.Errorf("%s must be at least 1", name)
+		}
+	}
+
+	if config.VulnScan.TimeoutMinutes < 1 {
+		return fmt.Errorf("VULN_SCAN_TIMEOUT_MINUTES must be at least 1")
+	}
+
+	if config.CrashLoop.MaxRestarts < 0 {
+		return fmt.Errorf("CRASH_LOOP_MAX_RESTARTS cannot be negative")
+	}
+	if config.CrashLoop.BackoffSeconds < 1 {
+		return fmt.Errorf("CRASH_LOOP_BACKOFF_SECONDS must be at least 1")
+	}
+	if config.CrashLoop.MaxBackoffSeconds < config.CrashLoop.BackoffSeconds {
+		return fmt.Errorf("CRASH_LOOP_MAX_BACKOFF_SECONDS must be at least CRASH_LOOP_BACKOFF_SECONDS")
+	}
+
+	if config.Cleanup.MaxDiskUsagePercent <= 0 || config.Cleanup.MaxDiskUsagePercent > 100 {
+		return fmt.Errorf("CLEANUP_MAX_DISK_USAGE_PERCENT must be between 0 and 100")
+	}
+	if config.Cleanup.IntervalMinutes < 1 {
+		return fmt.Errorf("CLEANUP_INTERVAL_MINUTES must be at least 1")
+	}
+	if config.Cleanup.JitterMinutes < 0 {
+		return fmt.Errorf("CLEANUP_JITTER_MINUTES cannot be negative")
+	}
+
+	// Impersonation tokens act as the user with an admin behind them, so they must stay short-lived
+	if config.Admin.ImpersonationTTLMinutes < 1 || config.Admin.ImpersonationTTLMinutes > 60 {
+		return fmt.Errorf("ADMIN_IMPERSONATION_TTL_MINUTES must be between 1 and 60")
+	}
+
+	// Writes the repositories don't see (workers updating apps directly) are only picked up on expiry
+	if config.Cache.TTLSeconds < 0 || config.Cache.TTLSeconds > 300 {
+		return fmt.Errorf("CACHE_TTL_SECONDS must be between 0 and 300")
+	}
+
+	// Every line is a row, so the index is kept to a window users search within
+	if config.LogSearch.RetentionDays < 1 || config.LogSearch.RetentionDays > 90 {
+		return fmt.Errorf("LOG_SEARCH_RETENTION_DAYS must be between 1 and 90")
+	}
+
+	// Fault injection must never be reachable in production, whatever else is misconfigured, so ENV has to
+	// name another environment: deployments that leave it unset count as production
+	if config.Chaos.Enabled {
+		switch os.Getenv("ENV") {
+		case "development", "test", "staging":
+		default:
+			return fmt.Errorf("CHAOS_ENABLED requires ENV=development, test or staging")
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,245 @@
+// Package metrics exposes control plane metrics (HTTP traffic, task outcomes, queue depth, database
+// pool and cleanup results) in the Prometheus text format. The API serves them on /metrics and each worker
+// on its own METRICS_LISTEN_ADDR.
+package metrics
+
+import (
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+var (
+	// HTTP requests served by the API, by chi route pattern (not raw path, to bound cardinality)
+	HTTPRequestsTotal = NewCounterVec("stackyn_http_requests_total",
+		"HTTP requests served by the API.", "method", "route", "status")
+	HTTPRequestDuration = NewHistogramVec("stackyn_http_request_duration_seconds",
+		"HTTP request latency.", []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}, "method", "route")
+
+	// Task outcomes by task type (build_task, deploy_task, cleanup_task) - builds and deploys fail
+	// by returning an error, so result=failure is the deploy failure rate operators alert on
+	TasksTotal = NewCounterVec("stackyn_tasks_total",
+		"Background tasks processed, by outcome.", "task", "result")
+	TaskDuration = NewHistogramVec("stackyn_task_duration_seconds",
+		"Background task duration (build_task is the full clone and image build).",
+		[]float64{1, 5, 15, 30, 60, 120, 300, 600, 900, 1800}, "task", "result")
+
+	// Builds and deploys by queue and trigger - compare the wait of the interactive queues (reserved
+	// workers) with the general ones to check that automated deploys do not starve interactive ones
+	TasksEnqueuedTotal = NewCounterVec("stackyn_tasks_enqueued_total",
+		"Build and deploy tasks enqueued, by queue and trigger.", "task", "queue", "trigger")
+	TaskQueueWait = NewHistogramVec("stackyn_task_queue_wait_seconds",
+		"Time build and deploy tasks waited in their queue before a worker picked them up.",
+		[]float64{0.1, 0.5, 1, 5, 15, 30, 60, 120, 300, 600, 1800}, "task", "queue", "trigger")
+
+	// Queue depth read from Redis on every scrape (registered by WatchQueueDepth)
+	QueueTasks = NewGaugeVec("stackyn_queue_tasks",
+		"Tasks in each asynq queue, by state.", "queue", "state")
+
+	// Cleanup results
+	CleanupRunsTotal = NewCounterVec("stackyn_cleanup_runs_total",
+		"Cleanup runs, by outcome.", "result")
+	CleanupRemovedTotal = NewCounterVec("stackyn_cleanup_removed_total",
+		"Resources removed by cleanup runs.", "resource")
+	CleanupFreedBytesTotal = NewCounterVec("stackyn_cleanup_freed_bytes_total",
+		"Disk space freed by cleanup runs.")
+	CleanupErrorsTotal = NewCounterVec("stackyn_cleanup_errors_total",
+		"Individual errors reported by cleanup runs.")
+	CleanupDuration = NewHistogramVec("stackyn_cleanup_duration_seconds",
+		"Time cleanup runs took, by outcome.",
+		[]float64{1, 5, 15, 30, 60, 120, 300, 600}, "result")
+	CleanupLastSuccess = NewGaugeVec("stackyn_cleanup_last_success_timestamp_seconds",
+		"Unix time the last successful cleanup run finished - alert when it falls behind the interval.")
+
+	// Filesystems the cleanup worker keeps below its usage limit (volume=work|docker), measured on
+	// every scrape (registered by WatchDiskUsage) - alert before used_ratio reaches the limit
+	DiskSizeBytes = NewGaugeVec("stackyn_disk_size_bytes",
+		"Size of the filesystems cleanup frees space on.", "volume", "path")
+	DiskAvailableBytes = NewGaugeVec("stackyn_disk_available_bytes",
+		"Free space on the filesystems cleanup frees space on.", "volume", "path")
+	DiskUsedRatio = NewGaugeVec("stackyn_disk_used_ratio",
+		"Used share (0-1) of the filesystems cleanup frees space on.", "volume", "path")
+	DiskUsedRatioLimit = NewGaugeVec("stackyn_disk_used_ratio_limit",
+		"Used share above which cleanup removes old images and containers.")
+
+	// Traefik drift repairs (result=repaired|failed|skipped) - any increase means routing was broken
+	TraefikDriftRepairsTotal = NewCounterVec("stackyn_traefik_drift_repairs_total",
+		"Running deployments whose Traefik routing drifted from the database, by repair outcome.", "result")
+
+	// App webhook delivery attempts (result=succeeded|retrying|failed)
+	AppWebhookDeliveriesTotal = NewCounterVec("stackyn_app_webhook_deliveries_total",
+		"Delivery attempts of user app webhooks, by outcome.", "result")
+
+	// Database connection pool, read from the pool on every scrape (registered by WatchDBPool) -
+	// acquired near max with a growing empty_acquires means requests are queueing for connections
+	DBPoolConnections = NewGaugeVec("stackyn_db_pool_connections",
+		"Connections in the database pool, by state.", "state")
+	DBPoolMaxConnections = NewGaugeVec("stackyn_db_pool_max_connections",
+		"Maximum size of the database pool.")
+	DBPoolAcquiresTotal = NewCounterVec("stackyn_db_pool_acquires_total",
+		"Connections acquired from the database pool, by outcome (empty: had to wait for one).", "result")
+	DBPoolAcquireSecondsTotal = NewCounterVec("stackyn_db_pool_acquire_seconds_total",
+		"Total time spent acquiring connections from the database pool.")
+	// Queries and connection waits cut off by POSTGRES_QUERY_TIMEOUT_SECONDS and
+	// POSTGRES_ACQUIRE_TIMEOUT_SECONDS (stage=query|acquire)
+	DBTimeoutsTotal = NewCounterVec("stackyn_db_timeouts_total",
+		"Database queries and connection acquisitions that hit their deadline.", "stage")
+
+	// Read cache lookups by kind (user, subscription, apps) - a low hit ratio means writes invalidate
+	// entries faster than they are read, or CACHE_TTL_SECONDS is too short
+	CacheRequestsTotal = NewCounterVec("stackyn_cache_requests_total",
+		"Read cache lookups, by kind and result (hit|miss).", "kind", "result")
+
+	// Process stats, refreshed on every scrape
+	goroutines = NewGaugeVec("go_goroutines", "Number of goroutines that currently exist.")
+	heapBytes  = NewGaugeVec("go_memstats_heap_alloc_bytes", "Heap bytes allocated and still in use.")
+	startTime  = NewGaugeVec("process_start_time_seconds", "Start time of the process since unix epoch in seconds.")
+)
+
+func init() {
+	startTime.Set(float64(time.Now().Unix()))
+	Default.OnScrape(func() {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		goroutines.Set(float64(runtime.NumGoroutine()))
+		heapBytes.Set(float64(mem.HeapAlloc))
+	})
+}
+
+// ObserveTask records the outcome and duration of a background task
+func ObserveTask(taskType string, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	TasksTotal.Inc(taskType, result)
+	TaskDuration.Observe(duration.Seconds(), taskType, result)
+}
+
+// ObserveTaskEnqueued records a build or deploy task put on queue (trigger is empty when not recorded)
+func ObserveTaskEnqueued(taskType, queue, trigger string) {
+	TasksEnqueuedTotal.Inc(taskType, queue, triggerLabel(trigger))
+}
+
+// ObserveTaskWait records how long a build or deploy task waited in queue before it started
+func ObserveTaskWait(taskType, queue, trigger string, wait time.Duration) {
+	TaskQueueWait.Observe(wait.Seconds(), taskType, queue, triggerLabel(trigger))
+}
+
+// triggerLabel keeps tasks queued without a trigger countable
+func triggerLabel(trigger string) string {
+	if trigger == "" {
+		return "unknown"
+	}
+	return trigger
+}
+
+// ObserveHTTPRequest records one API request
+// route is the matched chi route pattern, or empty when no route matched
+func ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	route = strings.TrimSuffix(route, "/*")
+	if status == 0 {
+		status = http.StatusOK // Handler wrote a body without an explicit WriteHeader
+	}
+	HTTPRequestsTotal.Inc(method, route, strconv.Itoa(status))
+	HTTPRequestDuration.Observe(duration.Seconds(), method, route)
+}
+
+// WatchQueueDepth reports the size of every asynq queue on each scrape
+func WatchQueueDepth(inspector *asynq.Inspector, logger *zap.Logger) {
+	Default.OnScrape(func() {
+		queues, err := inspector.Queues()
+		if err != nil {
+			logger.Warn("Failed to list queues for metrics", zap.Error(err))
+			return
+		}
+		QueueTasks.Reset()
+		for _, queue := range queues {
+			info, err := inspector.GetQueueInfo(queue)
+			if err != nil {
+				logger.Warn("Failed to get queue info for metrics", zap.String("queue", queue), zap.Error(err))
+				continue
+			}
+			QueueTasks.Set(float64(info.Pending), queue, "pending")
+			QueueTasks.Set(float64(info.Active), queue, "active")
+			QueueTasks.Set(float64(info.Scheduled), queue, "scheduled")
+			QueueTasks.Set(float64(info.Retry), queue, "retry")
+			QueueTasks.Set(float64(info.Archived), queue, "archived")
+		}
+	})
+}
+
+// WatchDBPool reports the state of the database connection pool on each scrape
+func WatchDBPool(pool *pgxpool.Pool) {
+	Default.OnScrape(func() {
+		stat := pool.Stat()
+		DBPoolConnections.Set(float64(stat.AcquiredConns()), "acquired")
+		DBPoolConnections.Set(float64(stat.IdleConns()), "idle")
+		DBPoolConnections.Set(float64(stat.ConstructingConns()), "constructing")
+		DBPoolMaxConnections.Set(float64(stat.MaxConns()))
+		DBPoolAcquiresTotal.Set(float64(stat.AcquireCount()-stat.EmptyAcquireCount()), "immediate")
+		DBPoolAcquiresTotal.Set(float64(stat.EmptyAcquireCount()), "empty")
+		DBPoolAcquiresTotal.Set(float64(stat.CanceledAcquireCount()), "canceled")
+		DBPoolAcquireSecondsTotal.Set(stat.AcquireDuration().Seconds())
+	})
+}
+
+// DiskSample is one filesystem's usage for WatchDiskUsage
+type DiskSample struct {
+	Volume         string
+	Path           string
+	SizeBytes      uint64
+	AvailableBytes uint64
+	UsedRatio      float64
+}
+
+// WatchDiskUsage reports the filesystems measure returns, and the usage limit, on each scrape
+func WatchDiskUsage(limitRatio float64, measure func() ([]DiskSample, error), logger *zap.Logger) {
+	DiskUsedRatioLimit.Set(limitRatio)
+	Default.OnScrape(func() {
+		samples, err := measure()
+		if err != nil {
+			logger.Warn("Failed to measure disk usage for metrics", zap.Error(err))
+			return
+		}
+		DiskSizeBytes.Reset()
+		DiskAvailableBytes.Reset()
+		DiskUsedRatio.Reset()
+		for _, sample := range samples {
+			DiskSizeBytes.Set(float64(sample.SizeBytes), sample.Volume, sample.Path)
+			DiskAvailableBytes.Set(float64(sample.AvailableBytes), sample.Volume, sample.Path)
+			DiskUsedRatio.Set(sample.UsedRatio, sample.Volume, sample.Path)
+		}
+	})
+}
+
+// ObserveCleanup records the results of a cleanup run (err is set when the run itself failed)
+func ObserveCleanup(containersRemoved, imagesRemoved, tempDirsPruned int, spaceFreedMB int64, errorCount int, duration time.Duration, err error) {
+	if err != nil {
+		CleanupRunsTotal.Inc("failure")
+		CleanupDuration.Observe(duration.Seconds(), "failure")
+		return
+	}
+	CleanupRunsTotal.Inc("success")
+	CleanupDuration.Observe(duration.Seconds(), "success")
+	CleanupLastSuccess.Set(float64(time.Now().Unix()))
+	CleanupRemovedTotal.Add(float64(containersRemoved), "containers")
+	CleanupRemovedTotal.Add(float64(imagesRemoved), "images")
+	CleanupRemovedTotal.Add(float64(tempDirsPruned), "temp_dirs")
+	CleanupFreedBytesTotal.Add(float64(spaceFreedMB) * 1024 * 1024)
+	CleanupErrorsTotal.Add(float64(errorCount))
+}
+
+// ObserveCleanupSkipped records a cleanup run skipped because another worker held the cleanup lock
+func ObserveCleanupSkipped() {
+	CleanupRunsTotal.Inc("skipped")
+}
@@ -0,0 +1,346 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// collector is a metric family that can write itself in the Prometheus text format
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds the metric families exposed on /metrics
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	hooks      []func() // Run before every scrape (gauges read from Redis, runtime stats)
+}
+
+// Default is the registry used by the metrics defined in this package
+var Default = &Registry{}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// OnScrape registers fn to run before every scrape, to refresh gauges that are read on demand
+func (r *Registry) OnScrape(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, fn)
+}
+
+// Write writes all metric families in the Prometheus text exposition format
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	hooks := append([]func(){}, r.hooks...)
+	collectors := append([]collector{}, r.collectors...)
+	r.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+	buf := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buf)
+	}
+	buf.Flush()
+}
+
+// Handler serves the registry on /metrics
+// When token is set, scrapers must send "Authorization: Bearer <token>"
+func Handler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":"UNAUTHORIZED","message":"Invalid metrics scrape token"},"message":"Invalid metrics scrape token"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Default.Write(w)
+	})
+}
+
+// Serve exposes /metrics on addr until ctx is cancelled (workers have no other HTTP server)
+func Serve(ctx context.Context, addr, token string, logger *zap.Logger) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler(token))
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Serving Prometheus metrics", zap.String("addr", addr))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("metrics server failed: %w", err)
+	}
+	return nil
+}
+
+// family holds the shared name, help text and label names of a metric family
+type family struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+}
+
+func (f *family) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+}
+
+// key joins label values into a map key (values are validated against the label count)
+func (f *family) key(labelValues []string) string {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// labels formats label pairs as {a="x",b="y"}, with extra pairs (such as le) appended
+func (f *family) labels(labelValues []string, extra ...string) string {
+	if len(f.labelNames) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range f.labelNames {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", name, escapeLabelValue(labelValues[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extra[i], escapeLabelValue(extra[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	family
+	mu     sync.Mutex
+	values map[string]*sample
+}
+
+type sample struct {
+	labelValues []string
+	value       float64
+}
+
+// NewCounterVec creates and registers a counter
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{
+		family: family{name: name, help: help, kind: "counter", labelNames: labelNames},
+		values: make(map[string]*sample),
+	}
+	Default.register(c)
+	return c
+}
+
+// Inc adds one to the counter for the label values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v (which must not be negative) to the counter for the label values
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.values[key]
+	if !ok {
+		s = &sample{labelValues: append([]string{}, labelValues...)}
+		c.values[key] = s
+	}
+	s.value += v
+}
+
+// Set sets the counter for the label values, for counters read from a source that already
+// accumulates them (like the connection pool's acquire count)
+func (c *CounterVec) Set(v float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.values[key]
+	if !ok {
+		s = &sample{labelValues: append([]string{}, labelValues...)}
+		c.values[key] = s
+	}
+	s.value = v
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.writeHeader(w)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range sortedKeys(c.values) {
+		s := c.values[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labels(s.labelValues), formatFloat(s.value))
+	}
+}
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct {
+	family
+	mu     sync.Mutex
+	values map[string]*sample
+}
+
+// NewGaugeVec creates and registers a gauge
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{
+		family: family{name: name, help: help, kind: "gauge", labelNames: labelNames},
+		values: make(map[string]*sample),
+	}
+	Default.register(g)
+	return g
+}
+
+// Set sets the gauge for the label values
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, ok := g.values[key]
+	if !ok {
+		s = &sample{labelValues: append([]string{}, labelValues...)}
+		g.values[key] = s
+	}
+	s.value = v
+}
+
+// Reset removes all label combinations (for gauges rebuilt on every scrape)
+func (g *GaugeVec) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values = make(map[string]*sample)
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.writeHeader(w)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, key := range sortedKeys(g.values) {
+		s := g.values[key]
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labels(s.labelValues), formatFloat(s.value))
+	}
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	family
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramSample
+}
+
+type histogramSample struct {
+	labelValues []string
+	counts      []uint64 // Per bucket (not cumulative)
+	count       uint64
+	sum         float64
+}
+
+// NewHistogramVec creates and registers a histogram with the given upper bucket bounds
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{
+		family:  family{name: name, help: help, kind: "histogram", labelNames: labelNames},
+		buckets: append([]float64{}, buckets...),
+		values:  make(map[string]*histogramSample),
+	}
+	sort.Float64s(h.buckets)
+	Default.register(h)
+	return h
+}
+
+// Observe records one observation for the label values
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.values[key]
+	if !ok {
+		s = &histogramSample{labelValues: append([]string{}, labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.writeHeader(w)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.values) {
+		s := h.values[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(s.labelValues, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labels(s.labelValues), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labels(s.labelValues), s.count)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
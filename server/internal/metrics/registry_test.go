@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterVecFormat(t *testing.T) {
+	c := NewCounterVec("test_requests_total", "Requests served.", "route", "status")
+	c.Inc("/apps/{id}", "200")
+	c.Add(2, "/apps/{id}", "200")
+	c.Add(-1, "/apps/{id}", "200") // Counters never go down
+	c.Inc(`C:\path "quoted"`+"\nnext", "500")
+
+	var b strings.Builder
+	c.write(&b)
+	want := `# HELP test_requests_total Requests served.
+# TYPE test_requests_total counter
+test_requests_total{route="/apps/{id}",status="200"} 3
+test_requests_total{route="C:\\path \"quoted\"\nnext",status="500"} 1
+`
+	if b.String() != want {
+		t.Errorf("counter output:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestGaugeVecFormat(t *testing.T) {
+	g := NewGaugeVec("test_queue_depth", "Tasks waiting.")
+	g.Set(0.25)
+
+	var b strings.Builder
+	g.write(&b)
+	want := "# HELP test_queue_depth Tasks waiting.\n# TYPE test_queue_depth gauge\ntest_queue_depth 0.25\n"
+	if b.String() != want {
+		t.Errorf("gauge output:\n%s\nwant:\n%s", b.String(), want)
+	}
+
+	g.Reset()
+	g.Set(math.Inf(1))
+	b.Reset()
+	g.write(&b)
+	if !strings.HasSuffix(b.String(), "test_queue_depth +Inf\n") {
+		t.Errorf("gauge output after reset:\n%s", b.String())
+	}
+}
+
+func TestHistogramVecFormat(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "Request duration.", []float64{1, 0.1, 0.5}, "method")
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 2} {
+		h.Observe(v, "GET")
+	}
+
+	var b strings.Builder
+	h.write(&b)
+	// Buckets are sorted and cumulative, le is appended after the family's labels and +Inf counts everything
+	want := `# HELP test_duration_seconds Request duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{method="GET",le="0.1"} 2
+test_duration_seconds_bucket{method="GET",le="0.5"} 3
+test_duration_seconds_bucket{method="GET",le="1"} 4
+test_duration_seconds_bucket{method="GET",le="+Inf"} 5
+test_duration_seconds_sum{method="GET"} 3.15
+test_duration_seconds_count{method="GET"} 5
+`
+	if b.String() != want {
+		t.Errorf("histogram output:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestHistogramVecWithoutLabels(t *testing.T) {
+	h := NewHistogramVec("test_job_seconds", "Job duration.", []float64{10})
+	h.Observe(4)
+
+	var b strings.Builder
+	h.write(&b)
+	for _, line := range []string{
+		`test_job_seconds_bucket{le="10"} 1`,
+		`test_job_seconds_bucket{le="+Inf"} 1`,
+		`test_job_seconds_sum 4`,
+		`test_job_seconds_count 1`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("histogram output is missing %q:\n%s", line, b.String())
+		}
+	}
+}
+
+func TestHandlerScrapeToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		want          int
+	}{
+		{"no token configured", "", "", http.StatusOK},
+		{"valid token", "s3cret", "Bearer s3cret", http.StatusOK},
+		{"missing token", "s3cret", "", http.StatusUnauthorized},
+		{"wrong token", "s3cret", "Bearer s3cre", http.StatusUnauthorized},
+		{"wrong scheme", "s3cret", "Basic s3cret", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			Handler(tt.token).ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+				t.Errorf("Content-Type = %q", rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
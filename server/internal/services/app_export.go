@@ -0,0 +1,187 @@
+package services
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+	"go.uber.org/zap"
+)
+
+const (
+	// AppExportRetention is how long an export bundle stays downloadable
+	AppExportRetention = 7 * 24 * time.Hour
+	// AppExportDir is where bundles are written; mounted into both the deploy worker (which writes
+	// them) and the API server (which serves and expires them)
+	AppExportDir = "/app/exports"
+)
+
+// AppExportManifest describes an export bundle. It is written to the bundle as manifest.json
+// Env var values are deliberately left out: bundles are plain files, and the keys are enough to
+// recreate the configuration elsewhere
+type AppExportManifest struct {
+	FormatVersion int       `json:"format_version"`
+	AppID         string    `json:"app_id"`
+	AppName       string    `json:"app_name"`
+	Slug          string    `json:"slug"`
+	RepoURL       string    `json:"repo_url"`
+	Branch        string    `json:"branch"`
+	RootDir       string    `json:"root_dir,omitempty"`
+	EnvVarKeys    []string  `json:"env_var_keys"`
+	LastImage     string    `json:"last_image,omitempty"` // Image of the last deployment that had one
+	Volumes       []string  `json:"volumes"`              // Filled in when the bundle is written
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// AppExportPath returns where the bundle of an export is stored
+func AppExportPath(exportID string) string {
+	return filepath.Join(AppExportDir, exportID+".tar.gz")
+}
+
+// WriteAppExport writes an app's export bundle to w as a gzipped tarball:
+//
+//	volumes/<volume>/...   contents of every Docker volume mounted by the app's containers
+//	env-var-keys.txt       one env var key per line
+//	manifest.json          the manifest, with the exported volumes filled in
+//
+// Volumes are read with the Docker copy API, which works on stopped containers too
+func (s *DeploymentService) WriteAppExport(ctx context.Context, w io.Writer, manifest *AppExportManifest) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	volumes, err := s.exportAppVolumes(ctx, manifest.AppID, tw)
+	if err != nil {
+		return err
+	}
+	manifest.Volumes = volumes
+
+	envKeys := strings.Join(manifest.EnvVarKeys, "\n")
+	if envKeys != "" {
+		envKeys += "\n"
+	}
+	if err := writeTarFile(tw, "env-var-keys.txt", []byte(envKeys)); err != nil {
+		return err
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal export manifest: %w", err)
+	}
+	if err := writeTarFile(tw, "manifest.json", manifestJSON); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish export archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to finish export archive: %w", err)
+	}
+	return nil
+}
+
+// exportAppVolumes copies every named volume mounted by the app's containers (and its running
+// docker-compose services) into tw under volumes/<name>/ and returns the volume names
+func (s *DeploymentService) exportAppVolumes(ctx context.Context, appID string, tw *tar.Writer) ([]string, error) {
+	containers, err := s.findContainersByAppID(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	composeContainers, err := s.findContainersByComposeProject(ctx, fmt.Sprintf("stackyn-%s", appID))
+	if err != nil {
+		return nil, err
+	}
+	containers = append(containers, composeContainers...)
+
+	// A volume is copied once, through the first container found that mounts it
+	sources := make(map[string]types.Container)
+	destinations := make(map[string]string)
+	for _, c := range containers {
+		for _, m := range c.Mounts {
+			if m.Type != mount.TypeVolume || m.Name == "" {
+				continue
+			}
+			if _, seen := sources[m.Name]; !seen {
+				sources[m.Name] = c
+				destinations[m.Name] = m.Destination
+			}
+		}
+	}
+
+	volumes := make([]string, 0, len(sources))
+	for name := range sources {
+		volumes = append(volumes, name)
+	}
+	sort.Strings(volumes)
+
+	for _, name := range volumes {
+		if err := s.copyVolume(ctx, sources[name].ID, destinations[name], "volumes/"+name+"/", tw); err != nil {
+			return nil, fmt.Errorf("failed to export volume %s: %w", name, err)
+		}
+		s.logger.Info("Exported app volume",
+			zap.String("app_id", appID),
+			zap.String("volume", name),
+			zap.String("container_id", sources[name].ID),
+		)
+	}
+	return volumes, nil
+}
+
+// copyVolume streams the directory dir inside a container into tw, re-rooted under prefix
+func (s *DeploymentService) copyVolume(ctx context.Context, containerID, dir, prefix string, tw *tar.Writer) error {
+	reader, _, err := s.client.CopyFromContainer(ctx, containerID, dir+"/.")
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read volume archive: %w", err)
+		}
+
+		// Entries are named relative to the copied directory ("./", "./db/data")
+		hdr.Name = prefix + strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = prefix + strings.TrimPrefix(path.Clean("/"+hdr.Linkname), "/")
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write export archive: %w", err)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return fmt.Errorf("failed to write export archive: %w", err)
+		}
+	}
+}
+
+// writeTarFile adds a regular file to tw
+func writeTarFile(tw *tar.Writer, name string, content []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to write export archive: %w", err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		return fmt.Errorf("failed to write export archive: %w", err)
+	}
+	return nil
+}
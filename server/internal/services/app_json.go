@@ -0,0 +1,178 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// AppJSONFiles are the files a repository can describe its env vars and add-ons in, in order of precedence.
+// stackyn.json uses the app.json format (https://devcenter.heroku.com/articles/app-json-schema)
+var AppJSONFiles = []string{"stackyn.json", "app.json"}
+
+// maxAppJSONBytes bounds the app.json files read from repositories
+const maxAppJSONBytes = 512 << 10
+
+// ErrRepoFileNotFound is returned by FetchRepoFile when the repository has no such file on the branch
+var ErrRepoFileNotFound = errors.New("file not found in repository")
+
+// AppJSON is the part of an app.json (or stackyn.json) Stackyn uses
+type AppJSON struct {
+	File        string           `json:"file"` // Which of AppJSONFiles it was read from
+	Name        string           `json:"name,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Env         []TemplateEnvVar `json:"env"`
+	Addons      []string         `json:"addons"`
+}
+
+// appJSONEnvVar is an env entry of app.json in its object form (the short form is just the value)
+type appJSONEnvVar struct {
+	Description string `json:"description"`
+	Value       string `json:"value"`
+	Required    *bool  `json:"required"` // Defaults to true, as on Heroku
+	Generator   string `json:"generator"`
+}
+
+// ParseAppJSON parses an app.json document. Env entries are sorted by key; add-ons are reduced to
+// their service name ("heroku-postgresql:mini" and {"plan": "heroku-postgresql"} both give "heroku-postgresql")
+func ParseAppJSON(data []byte) (*AppJSON, error) {
+	var doc struct {
+		Name        string                     `json:"name"`
+		Description string                     `json:"description"`
+		Env         map[string]json.RawMessage `json:"env"`
+		Addons      []json.RawMessage          `json:"addons"`
+	}
+	if err := json.Unmarshal([]byte(NormalizeText(data)), &doc); err != nil {
+		return nil, fmt.Errorf("invalid app.json: %w", err)
+	}
+
+	appJSON := &AppJSON{Name: doc.Name, Description: doc.Description, Env: []TemplateEnvVar{}, Addons: []string{}}
+	for key, raw := range doc.Env {
+		if err := ValidateEnvKey(key); err != nil {
+			return nil, fmt.Errorf("invalid app.json: %w", err)
+		}
+		prompt := TemplateEnvVar{Key: key}
+		var value string
+		if err := json.Unmarshal(raw, &value); err == nil {
+			prompt.Value, prompt.Required = value, true
+		} else {
+			var entry appJSONEnvVar
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return nil, fmt.Errorf("invalid app.json: env %s must be a string or an object", key)
+			}
+			prompt.Description = entry.Description
+			prompt.Value = entry.Value
+			prompt.Required = entry.Required == nil || *entry.Required
+			if entry.Generator == EnvGeneratorSecret {
+				prompt.Generator = EnvGeneratorSecret
+			}
+		}
+		appJSON.Env = append(appJSON.Env, prompt)
+	}
+	sort.Slice(appJSON.Env, func(i, j int) bool { return appJSON.Env[i].Key < appJSON.Env[j].Key })
+
+	for _, raw := range doc.Addons {
+		var plan string
+		if err := json.Unmarshal(raw, &plan); err != nil {
+			var entry struct {
+				Plan string `json:"plan"`
+			}
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return nil, fmt.Errorf("invalid app.json: addons must be strings or objects with a plan")
+			}
+			plan = entry.Plan
+		}
+		if service, _, _ := strings.Cut(plan, ":"); service != "" {
+			appJSON.Addons = append(appJSON.Addons, service)
+		}
+	}
+	return appJSON, nil
+}
+
+// FetchAppJSON reads the first of AppJSONFiles found in rootDir of the repository's branch
+// Returns ErrRepoFileNotFound when there is none
+func (s *GitService) FetchAppJSON(ctx context.Context, repoURL, branch, rootDir string) (*AppJSON, error) {
+	for _, name := range AppJSONFiles {
+		data, err := s.FetchRepoFile(ctx, repoURL, branch, path.Join(rootDir, name))
+		if errors.Is(err, ErrRepoFileNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		appJSON, err := ParseAppJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		appJSON.File = name
+		return appJSON, nil
+	}
+	return nil, ErrRepoFileNotFound
+}
+
+// FetchRepoFile downloads one file of a public repository's branch from its host, without cloning it
+func (s *GitService) FetchRepoFile(ctx context.Context, repoURL, branch, filePath string) ([]byte, error) {
+	rawURL, err := s.rawFileURL(repoURL, branch, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", filePath, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrRepoFileNotFound
+	case resp.StatusCode >= 400:
+		s.logger.Warn("Repository file download failed", zap.Int("status_code", resp.StatusCode), zap.String("repo_url", repoURL), zap.String("path", filePath))
+		return nil, fmt.Errorf("failed to fetch %s (status: %d)", filePath, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAppJSONBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	if len(data) > maxAppJSONBytes {
+		return nil, fmt.Errorf("%s is larger than %d KB", filePath, maxAppJSONBytes>>10)
+	}
+	return bytes.TrimSpace(data), nil
+}
+
+// rawFileURL returns where the host of repoURL serves the raw content of a file on a branch
+func (s *GitService) rawFileURL(repoURL, branch, filePath string) (string, error) {
+	parts := strings.Split(strings.TrimPrefix(s.normalizeGitHubURL(repoURL), "https://"), "/")
+	if len(parts) < 3 || parts[1] == "" || parts[2] == "" {
+		return "", fmt.Errorf("invalid repository URL %q", repoURL)
+	}
+	host, repo := parts[0], parts[1]+"/"+parts[2]
+	filePath = strings.TrimPrefix(path.Clean("/"+filePath), "/")
+
+	switch host {
+	case "github.com":
+		return fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s", repo, branch, filePath), nil
+	case "gitlab.com":
+		return fmt.Sprintf("https://gitlab.com/%s/-/raw/%s/%s", repo, branch, filePath), nil
+	case "bitbucket.org":
+		return fmt.Sprintf("https://bitbucket.org/%s/raw/%s/%s", repo, branch, filePath), nil
+	}
+	return "", fmt.Errorf("only GitHub, GitLab and Bitbucket repositories are supported")
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"go.uber.org/zap"
+)
+
+// ErrNoAppContainer is returned when waking an app whose stopped container no longer exists
+// (removed by hand or by a Docker restart); the app has to be redeployed
+var ErrNoAppContainer = errors.New("app has no container to start")
+
+// SleepAppContainers stops an idle app's running containers without removing them, so they can be
+// started again on the next request. Health and crash monitors pause while the app sleeps
+func (s *DeploymentService) SleepAppContainers(ctx context.Context, appID string) error {
+	stopped, err := s.StopAppContainers(ctx, appID)
+	if err != nil {
+		return err
+	}
+	if stopped == 0 {
+		return fmt.Errorf("app %s has no running container", appID)
+	}
+
+	s.logger.Info("App put to sleep", zap.String("app_id", appID), zap.Int("containers", stopped))
+	return nil
+}
+
+// StopAppContainers stops an app's running containers without removing them and returns how many it
+// stopped. Health and crash monitors pause until WakeAppContainers starts them again
+func (s *DeploymentService) StopAppContainers(ctx context.Context, appID string) (int, error) {
+	containers, err := s.findContainersByAppID(ctx, appID)
+	if err != nil {
+		return 0, err
+	}
+
+	stopped := 0
+	for _, c := range containers {
+		if c.State != "running" {
+			continue
+		}
+
+		s.sleeping.Store(c.ID, true)
+		stopCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		timeout := 10
+		err := s.client.ContainerStop(stopCtx, c.ID, container.StopOptions{Timeout: &timeout})
+		cancel()
+		if err != nil {
+			s.sleeping.Delete(c.ID)
+			return stopped, fmt.Errorf("failed to stop container %s: %w", c.ID, err)
+		}
+		stopped++
+	}
+	return stopped, nil
+}
+
+// WakeAppContainers starts the containers SleepAppContainers or StopAppContainers stopped and returns the RAM they are
+// limited to, so it can be counted against the owner's plan again
+func (s *DeploymentService) WakeAppContainers(ctx context.Context, appID string) (int, error) {
+	containers, err := s.findContainersByAppID(ctx, appID)
+	if err != nil {
+		return 0, err
+	}
+	if len(containers) == 0 {
+		return 0, ErrNoAppContainer
+	}
+
+	ramMB := 0
+	for _, c := range containers {
+		if c.State != "running" {
+			if err := s.client.ContainerStart(ctx, c.ID, container.StartOptions{}); err != nil {
+				return 0, fmt.Errorf("failed to start container %s: %w", c.ID, err)
+			}
+		}
+		s.sleeping.Delete(c.ID)
+
+		inspect, err := s.client.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			s.logger.Warn("Failed to inspect woken container", zap.Error(err), zap.String("container_id", c.ID))
+			continue
+		}
+		if inspect.HostConfig != nil && inspect.HostConfig.Memory > 0 {
+			ramMB += int(inspect.HostConfig.Memory / (1024 * 1024))
+		}
+	}
+
+	s.logger.Info("App woken", zap.String("app_id", appID), zap.Int("containers", len(containers)))
+	return ramMB, nil
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// EnvGeneratorSecret generates a random value for an env var nobody supplied (app.json "generator": "secret")
+const EnvGeneratorSecret = "secret"
+
+// AppTemplate is an app that can be deployed in one call: a sample repository with the env vars it expects
+type AppTemplate struct {
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	RepoURL     string           `json:"repo_url"`
+	Branch      string           `json:"branch"`
+	RootDir     string           `json:"root_dir,omitempty"`
+	Env         []TemplateEnvVar `json:"env"`
+	Addons      []string         `json:"addons"` // Services the app needs, e.g. postgres - they are not provisioned, their URL is an env var
+}
+
+// TemplateEnvVar is an env var a template or a repository's app.json prompts for
+type TemplateEnvVar struct {
+	Key         string `json:"key"`
+	Description string `json:"description,omitempty"`
+	Value       string `json:"value,omitempty"`     // Default value
+	Required    bool   `json:"required"`            // Deploys fail without a value (a generator or default counts)
+	Generator   string `json:"generator,omitempty"` // EnvGeneratorSecret, or empty
+}
+
+// appTemplates is the curated template registry
+var appTemplates = map[string]AppTemplate{
+	"node-express": {
+		ID:          "node-express",
+		Name:        "Node.js (Express)",
+		Description: "A minimal Express web app",
+		RepoURL:     "https://github.com/heroku/node-js-getting-started",
+		Branch:      "main",
+		Env: []TemplateEnvVar{
+			{Key: "NODE_ENV", Description: "Node.js environment", Value: "production"},
+		},
+	},
+	"python-django": {
+		ID:          "python-django",
+		Name:        "Python (Django)",
+		Description: "A Django web app with a PostgreSQL database",
+		RepoURL:     "https://github.com/heroku/python-getting-started",
+		Branch:      "main",
+		Env: []TemplateEnvVar{
+			{Key: "DATABASE_URL", Description: "Connection URL of a PostgreSQL database", Required: true},
+			{Key: "DJANGO_SECRET_KEY", Description: "Django's cryptographic signing key", Required: true, Generator: EnvGeneratorSecret},
+		},
+		Addons: []string{"postgres"},
+	},
+	"go-gin": {
+		ID:          "go-gin",
+		Name:        "Go (Gin)",
+		Description: "A minimal Gin web app",
+		RepoURL:     "https://github.com/heroku/go-getting-started",
+		Branch:      "main",
+		Env: []TemplateEnvVar{
+			{Key: "GIN_MODE", Description: "Gin's mode", Value: "release"},
+		},
+	},
+	"ruby-rails": {
+		ID:          "ruby-rails",
+		Name:        "Ruby (Rails)",
+		Description: "A Rails web app with a PostgreSQL database",
+		RepoURL:     "https://github.com/heroku/ruby-getting-started",
+		Branch:      "main",
+		Env: []TemplateEnvVar{
+			{Key: "DATABASE_URL", Description: "Connection URL of a PostgreSQL database", Required: true},
+			{Key: "SECRET_KEY_BASE", Description: "Rails' secret key base", Required: true, Generator: EnvGeneratorSecret},
+			{Key: "RAILS_ENV", Description: "Rails environment", Value: "production"},
+		},
+		Addons: []string{"postgres"},
+	},
+	"php": {
+		ID:          "php",
+		Name:        "PHP",
+		Description: "A minimal PHP web app",
+		RepoURL:     "https://github.com/heroku/php-getting-started",
+		Branch:      "main",
+	},
+}
+
+// AppTemplates returns the template registry sorted by ID
+func AppTemplates() []AppTemplate {
+	templates := make([]AppTemplate, 0, len(appTemplates))
+	for _, template := range appTemplates {
+		templates = append(templates, withTemplateDefaults(template))
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].ID < templates[j].ID })
+	return templates
+}
+
+// GetAppTemplate returns the template with the given ID
+func GetAppTemplate(id string) (AppTemplate, bool) {
+	template, ok := appTemplates[id]
+	return withTemplateDefaults(template), ok
+}
+
+// withTemplateDefaults gives templates empty lists rather than null ones in responses
+func withTemplateDefaults(template AppTemplate) AppTemplate {
+	if template.Env == nil {
+		template.Env = []TemplateEnvVar{}
+	}
+	if template.Addons == nil {
+		template.Addons = []string{}
+	}
+	return template
+}
+
+// ResolveTemplateEnv works out the env vars to create for prompts given the supplied values: a supplied
+// value wins, then a generated one, then the default. Prompts left without a value are skipped, and the
+// keys of required ones are returned as missing
+func ResolveTemplateEnv(prompts []TemplateEnvVar, supplied map[string]string) (map[string]string, []string, error) {
+	env := make(map[string]string, len(prompts))
+	missing := []string{}
+	for _, prompt := range prompts {
+		value, ok := supplied[prompt.Key]
+		if !ok && prompt.Generator == EnvGeneratorSecret {
+			generated, err := GenerateEnvSecret()
+			if err != nil {
+				return nil, nil, err
+			}
+			value, ok = generated, true
+		}
+		if !ok && prompt.Value != "" {
+			value, ok = prompt.Value, true
+		}
+		if !ok || (value == "" && prompt.Required) {
+			if prompt.Required {
+				missing = append(missing, prompt.Key)
+			}
+			continue
+		}
+		env[prompt.Key] = value
+	}
+	return env, missing, nil
+}
+
+// GenerateEnvSecret returns a random value for an env var with the secret generator (64 hex characters, as on Heroku)
+func GenerateEnvSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
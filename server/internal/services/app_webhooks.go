@@ -0,0 +1,197 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Events an app webhook can subscribe to
+const (
+	AppEventBuildStarted    = "build_started"
+	AppEventBuildFailed     = "build_failed"
+	AppEventDeploySucceeded = "deploy_succeeded"
+	AppEventDeployFailed    = "deploy_failed"
+)
+
+// AppWebhookEvents lists every event an app webhook can subscribe to
+var AppWebhookEvents = []string{AppEventBuildStarted, AppEventBuildFailed, AppEventDeploySucceeded, AppEventDeployFailed}
+
+// Delivery retry policy: attempt n (1-based) that fails is retried after 30s * 2^(n-1), capped at
+// six hours, so the last of 8 attempts happens roughly 2 hours after the event
+const (
+	MaxAppWebhookAttempts    = 8
+	appWebhookBaseRetryDelay = 30 * time.Second
+	appWebhookMaxRetryDelay  = 6 * time.Hour
+)
+
+// IsAppWebhookEvent reports whether event is one an app webhook can subscribe to
+func IsAppWebhookEvent(event string) bool {
+	for _, e := range AppWebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateAppWebhookURL checks that a webhook URL is an absolute http(s) URL of a public host
+// Hostnames are resolved again at delivery time, where private addresses are refused too
+func ValidateAppWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return fmt.Errorf("url must not contain credentials")
+	}
+	return checkPublicHost(u.Hostname())
+}
+
+// checkPublicHost refuses hostnames and IP literals that name local or private hosts
+func checkPublicHost(host string) error {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".local") || strings.HasSuffix(host, ".internal") {
+		return fmt.Errorf("url must point to a public host")
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublicIP(ip) {
+		return fmt.Errorf("url must point to a public host")
+	}
+	return nil
+}
+
+// GenerateAppWebhookSecret returns a new signing secret for an app webhook
+func GenerateAppWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// SignAppWebhook signs a delivery body: hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret
+// Receivers recompute it from the X-Stackyn-Timestamp header and the raw body, and should reject
+// old timestamps to stop replays
+func SignAppWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// AppWebhookRetryDelay returns how long to wait before retrying after the given failed attempt
+func AppWebhookRetryDelay(attempt int) time.Duration {
+	delay := appWebhookBaseRetryDelay
+	for i := 1; i < attempt && delay < appWebhookMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > appWebhookMaxRetryDelay {
+		delay = appWebhookMaxRetryDelay
+	}
+	return delay
+}
+
+// AppWebhookSender posts signed events to user webhook URLs
+type AppWebhookSender struct {
+	logger *zap.Logger
+	client *http.Client
+}
+
+// NewAppWebhookSender creates a sender that never connects to private, loopback or link-local
+// addresses (webhook URLs are user input) and does not follow redirects
+func NewAppWebhookSender(logger *zap.Logger) *AppWebhookSender {
+	dialer := publicDialer("deliver webhook")
+	return &AppWebhookSender{
+		logger: logger,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: 5 * time.Second,
+				MaxIdleConns:        10,
+				IdleConnTimeout:     30 * time.Second,
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Send delivers one event. Any 2xx response is a success; the returned status is 0 when no
+// response was received. The error describes why the delivery failed
+func (s *AppWebhookSender) Send(ctx context.Context, webhookURL, secret, event, deliveryID string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook request: %w", err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Stackyn-Webhooks/1.0")
+	req.Header.Set("X-Stackyn-Event", event)
+	req.Header.Set("X-Stackyn-Delivery", deliveryID)
+	req.Header.Set("X-Stackyn-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Stackyn-Signature", SignAppWebhook(secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err // The URL is in the delivery log already
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("endpoint returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024)) // Let the connection be reused
+	return resp.StatusCode, nil
+}
+
+// publicDialer returns a dialer that refuses to connect to non-public addresses once hostnames are
+// resolved; what names the refused action in its errors
+func publicDialer(what string) *net.Dialer {
+	return &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("refusing to %s to non-public address %s", what, host)
+			}
+			return nil
+		},
+	}
+}
+
+// isPublicIP reports whether ip is routable on the public internet
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	// Carrier-grade NAT range, used by some cloud metadata and internal networks
+	if ip4 := ip.To4(); ip4 != nil && ip4[0] == 100 && ip4[1]&0xc0 == 64 {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+// DockerfileBaseImage returns the base image of the final stage of the Dockerfile in contextPath, fully
+// qualified ("node:20-alpine" becomes "docker.io/library/node:20-alpine"). A final stage built FROM an
+// earlier stage resolves to that stage's base. Returns "" when there is none to track: FROM scratch, a
+// base chosen by build args, or a base pinned to a digest (it can never get updates)
+func DockerfileBaseImage(contextPath string) (string, error) {
+	file, err := os.Open(filepath.Join(contextPath, "Dockerfile"))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	stages := make(map[string]string) // Stage name -> base image
+	var final string
+	var instruction strings.Builder
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if continued, ok := strings.CutSuffix(line, `\`); ok {
+			instruction.WriteString(continued + " ")
+			continue
+		}
+		instruction.WriteString(line)
+		fields := strings.Fields(instruction.String())
+		instruction.Reset()
+
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+		args := fields[1:]
+		for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+			args = args[1:] // --platform=...
+		}
+		if len(args) == 0 {
+			continue
+		}
+		base := args[0]
+		if parent, ok := stages[strings.ToLower(base)]; ok {
+			base = parent
+		}
+		if len(args) >= 3 && strings.EqualFold(args[1], "AS") {
+			stages[strings.ToLower(args[2])] = base
+		}
+		final = base
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if final == "" || strings.EqualFold(final, "scratch") || strings.Contains(final, "$") {
+		return "", nil
+	}
+	named, err := reference.ParseNormalizedNamed(final)
+	if err != nil {
+		return "", nil
+	}
+	if _, ok := named.(reference.Canonical); ok {
+		return "", nil
+	}
+	return reference.TagNameOnly(named).String(), nil
+}
+
+// localImageDigest returns the registry digest of a locally stored image, i.e. the digest it was pulled at
+// Returns "" for images that were never pulled from a registry
+func (s *DockerBuildService) localImageDigest(ctx context.Context, ref string) string {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return ""
+	}
+	inspect, _, err := s.client.ImageInspectWithRaw(ctx, ref)
+	if err != nil {
+		return ""
+	}
+	for _, repoDigest := range inspect.RepoDigests {
+		pulled, err := reference.ParseNormalizedNamed(repoDigest)
+		if err != nil || pulled.Name() != named.Name() {
+			continue
+		}
+		if canonical, ok := pulled.(reference.Canonical); ok {
+			return canonical.Digest().String()
+		}
+	}
+	return ""
+}
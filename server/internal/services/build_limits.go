@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Build limits of plans that do not set their own (and of builds without a plan)
+const (
+	DefaultBuildCPUShares = 512
+	DefaultBuildMemoryMB  = 2048
+	DefaultBuildTimeout   = 15 * time.Minute
+)
+
+// MaxBuildTimeout caps plan build timeouts; stale deployment detection and the build drain window
+// assume no build runs longer
+const MaxBuildTimeout = 25 * time.Minute
+
+// ErrBuildTimeout is wrapped by the error of builds stopped for running past their plan's timeout
+var ErrBuildTimeout = errors.New("build timed out")
+
+// BuildLimits constrains the resources and wall-clock time of one build
+// Zero values fall back to the defaults above
+type BuildLimits struct {
+	CPUShares int64         // Relative CPU weight of the build against other containers on the host (1024 = one full share)
+	MemoryMB  int           // Memory limit of the build's containers (swap included)
+	Timeout   time.Duration // Longest the build may run
+}
+
+// DefaultBuildLimits returns the limits builds get when their plan sets none
+func DefaultBuildLimits() BuildLimits {
+	return BuildLimits{
+		CPUShares: DefaultBuildCPUShares,
+		MemoryMB:  DefaultBuildMemoryMB,
+		Timeout:   DefaultBuildTimeout,
+	}
+}
+
+// withDefaults fills unset limits in and caps the timeout at MaxBuildTimeout
+func (l BuildLimits) withDefaults() BuildLimits {
+	if l.CPUShares <= 0 {
+		l.CPUShares = DefaultBuildCPUShares
+	}
+	if l.MemoryMB <= 0 {
+		l.MemoryMB = DefaultBuildMemoryMB
+	}
+	if l.Timeout <= 0 {
+		l.Timeout = DefaultBuildTimeout
+	}
+	if l.Timeout > MaxBuildTimeout {
+		l.Timeout = MaxBuildTimeout
+	}
+	return l
+}
+
+// memoryBytes is the memory limit in the unit the Docker API expects
+func (l BuildLimits) memoryBytes() int64 {
+	return int64(l.MemoryMB) * 1024 * 1024
+}
+
+// buildTimeoutError is the error of a build that ran out of time, e.g. "build timed out after 15m"
+func buildTimeoutError(timeout time.Duration) error {
+	return fmt.Errorf("%w after %s. Please optimize your build process or upgrade your plan for longer builds", ErrBuildTimeout, formatBuildTimeout(timeout))
+}
+
+// formatBuildTimeout formats whole minutes as "15m" rather than time.Duration's "15m0s"
+func formatBuildTimeout(timeout time.Duration) string {
+	if timeout%time.Minute == 0 {
+		return fmt.Sprintf("%dm", int(timeout/time.Minute))
+	}
+	return timeout.String()
+}
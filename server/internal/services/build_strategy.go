@@ -0,0 +1,17 @@
+package services
+
+// Build strategies an app can choose between (apps.build_strategy)
+const (
+	BuildStrategyDockerfile = "dockerfile" // The repo's Dockerfile, or one generated for the detected runtime
+	BuildStrategyBuildpacks = "buildpacks" // Cloud Native Buildpacks; any Dockerfile in the repo is ignored
+	BuildStrategyNixpacks   = "nixpacks"   // Nixpacks plans; any Dockerfile in the repo is ignored
+)
+
+// ValidBuildStrategy reports whether strategy is one apps can be built with
+func ValidBuildStrategy(strategy string) bool {
+	switch strategy {
+	case BuildStrategyDockerfile, BuildStrategyBuildpacks, BuildStrategyNixpacks:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"go.uber.org/zap"
+)
+
+// Default images of the Paketo builder the generated Dockerfiles also use
+const (
+	DefaultBuildpacksBuilderImage = "paketobuildpacks/builder-jammy-base:latest"
+	DefaultBuildpacksRunImage     = "paketobuildpacks/run-jammy-base:latest"
+)
+
+// cnbPlatformAPI is the CNB platform API the lifecycle is driven with (as in the generated Dockerfiles)
+const cnbPlatformAPI = "0.12"
+
+// BuildpacksBuilder builds images with Cloud Native Buildpacks instead of a Dockerfile
+// It runs the lifecycle's creator in a container of the builder image, which detects and runs the
+// buildpacks and exports the image straight to the Docker daemon through its socket. It shares the
+// Docker client of the DockerBuildService it is created from
+type BuildpacksBuilder struct {
+	docker       *DockerBuildService
+	builderImage string
+	runImage     string
+	dockerSocket string // Daemon socket on the Docker host, mounted into the creator container
+	logger       *zap.Logger
+}
+
+// NewBuildpacksBuilder creates a buildpacks builder; empty images default to the Paketo jammy base builder
+func NewBuildpacksBuilder(docker *DockerBuildService, builderImage, runImage, dockerSocket string, logger *zap.Logger) *BuildpacksBuilder {
+	if builderImage == "" {
+		builderImage = DefaultBuildpacksBuilderImage
+	}
+	if runImage == "" {
+		runImage = DefaultBuildpacksRunImage
+	}
+	if dockerSocket == "" {
+		dockerSocket = "/var/run/docker.sock"
+	}
+	return &BuildpacksBuilder{
+		docker:       docker,
+		builderImage: builderImage,
+		runImage:     runImage,
+		dockerSocket: dockerSocket,
+		logger:       logger,
+	}
+}
+
+// Close is a no-op; the Docker client belongs to the DockerBuildService
+func (b *BuildpacksBuilder) Close() error {
+	return nil
+}
+
+// BuildImage builds opts.ContextPath with the builder's buildpacks and tags the result like a Dockerfile build
+// The run image is recorded as the base image, so security rebuilds pick up its upstream updates
+func (b *BuildpacksBuilder) BuildImage(ctx context.Context, opts BuildOptions, logWriter io.Writer) (*BuildResult, error) {
+	// Same limits as Dockerfile builds
+	limits := opts.Limits.withDefaults()
+	buildCtx, cancel := context.WithTimeout(ctx, limits.Timeout)
+	defer cancel()
+
+	imageTag := opts.ImageName
+	if opts.Tag != "" {
+		imageTag = fmt.Sprintf("%s:%s", opts.ImageName, opts.Tag)
+	} else {
+		imageTag = fmt.Sprintf("%s:latest", opts.ImageName)
+	}
+
+	b.logger.Info("Building image with buildpacks",
+		zap.String("context_path", opts.ContextPath),
+		zap.String("image_tag", imageTag),
+		zap.String("builder", b.builderImage),
+	)
+
+	if err := b.ensureImage(buildCtx, b.builderImage, false, logWriter); err != nil {
+		return nil, fmt.Errorf("failed to pull builder image: %w", err)
+	}
+	// The creator exports onto the run image cached on the daemon; a security rebuild refreshes it first
+	if err := b.ensureImage(buildCtx, b.runImage, opts.PullParent, logWriter); err != nil {
+		return nil, fmt.Errorf("failed to pull run image: %w", err)
+	}
+
+	uid, gid := b.builderUser(buildCtx)
+	source, err := b.docker.createTarArchive(opts.ContextPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tar archive: %w", err)
+	}
+	defer source.Close()
+
+	cli := b.docker.client
+	createResp, err := cli.ContainerCreate(buildCtx,
+		&container.Config{
+			Image: b.builderImage,
+			User:  "root", // The creator needs the daemon socket and drops to the builder's user for the buildpacks
+			Env:   []string{"CNB_PLATFORM_API=" + cnbPlatformAPI},
+			Cmd: []string{
+				"/cnb/lifecycle/creator",
+				"-daemon",
+				"-app=/workspace",
+				"-run-image=" + b.runImage,
+				"-uid=" + strconv.Itoa(uid),
+				"-gid=" + strconv.Itoa(gid),
+				"-log-level=info",
+				imageTag,
+			},
+			Labels: map[string]string{"stackyn.build.image": imageTag},
+		},
+		&container.HostConfig{
+			Binds: []string{b.dockerSocket + ":/var/run/docker.sock"},
+			// The buildpacks run inside the creator container, so its limits are the build's
+			Resources: container.Resources{
+				CPUShares:  limits.CPUShares,
+				Memory:     limits.memoryBytes(),
+				MemorySwap: limits.memoryBytes(),
+			},
+		},
+		nil, nil, "",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create buildpacks container: %w", err)
+	}
+	containerID := createResp.ID
+	defer func() {
+		// Removal must happen even when the build was cancelled or timed out
+		removeCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := cli.ContainerRemove(removeCtx, containerID, container.RemoveOptions{Force: true}); err != nil {
+			b.logger.Warn("Failed to remove buildpacks container", zap.Error(err), zap.String("container_id", containerID))
+		}
+	}()
+
+	// The source is owned by the user the buildpacks run as, like COPY --chown in the generated Dockerfiles
+	if err := cli.CopyToContainer(buildCtx, containerID, "/workspace", chownTar(source, uid, gid), container.CopyToContainerOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to copy source into buildpacks container: %w", err)
+	}
+
+	waitCh, errCh := cli.ContainerWait(buildCtx, containerID, container.WaitConditionNextExit)
+	if err := cli.ContainerStart(buildCtx, containerID, container.StartOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to start buildpacks container: %w", err)
+	}
+
+	var buildLogs strings.Builder
+	output := io.MultiWriter(logWriter, &buildLogs)
+	streamed := make(chan struct{})
+	go func() {
+		defer close(streamed)
+		reader, err := cli.ContainerLogs(buildCtx, containerID, container.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: true})
+		if err != nil {
+			b.logger.Warn("Failed to stream buildpacks output", zap.Error(err), zap.String("container_id", containerID))
+			return
+		}
+		defer reader.Close()
+		stdcopy.StdCopy(output, output, reader)
+	}()
+
+	var exitCode int64
+	select {
+	case status := <-waitCh:
+		if status.Error != nil {
+			return nil, fmt.Errorf("failed waiting for buildpacks container: %s", status.Error.Message)
+		}
+		exitCode = status.StatusCode
+	case err := <-errCh:
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return nil, fmt.Errorf("image build cancelled: %w", ctx.Err())
+		}
+		if buildCtx.Err() == context.DeadlineExceeded {
+			fmt.Fprintf(logWriter, "ERROR: Build timed out after %s\n", formatBuildTimeout(limits.Timeout))
+			return nil, buildTimeoutError(limits.Timeout)
+		}
+		return nil, fmt.Errorf("failed waiting for buildpacks container: %w", err)
+	}
+	<-streamed
+
+	// Exit code 137 is the kernel's OOM kill of the creator
+	if exitCode == 137 {
+		fmt.Fprintf(output, "ERROR: Build ran out of memory (limit %d MB)\n", limits.MemoryMB)
+	}
+	if exitCode != 0 {
+		// Matches the message of failed generated Dockerfile builds, so the user gets the same hint
+		fmt.Fprintf(output, "ERROR: Paketo Buildpacks build failed (lifecycle exited with code %d)\n", exitCode)
+		return nil, fmt.Errorf("buildpacks build failed with exit code %d", exitCode)
+	}
+
+	imageInspect, _, err := cli.ImageInspectWithRaw(buildCtx, imageTag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect built image: %w", err)
+	}
+
+	b.logger.Info("Image built with buildpacks",
+		zap.String("image_id", imageInspect.ID),
+		zap.String("image_tag", imageTag),
+	)
+
+	return &BuildResult{
+		ImageID:         imageInspect.ID,
+		ImageName:       imageTag,
+		Logs:            buildLogs.String(),
+		BaseImage:       b.runImage,
+		BaseImageDigest: b.docker.localImageDigest(buildCtx, b.runImage),
+	}, nil
+}
+
+// ensureImage pulls ref unless it is already on the daemon (always when refresh is set)
+func (b *BuildpacksBuilder) ensureImage(ctx context.Context, ref string, refresh bool, logWriter io.Writer) error {
+	if !refresh {
+		if _, _, err := b.docker.client.ImageInspectWithRaw(ctx, ref); err == nil {
+			return nil
+		} else if !client.IsErrNotFound(err) {
+			return err
+		}
+	}
+
+	fmt.Fprintf(logWriter, "Pulling %s\n", ref)
+	reader, err := b.docker.client.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	// The pull only completes once its progress stream has been read to the end
+	_, err = io.Copy(io.Discard, reader)
+	return err
+}
+
+// builderUser returns the user the builder image runs buildpacks as (CNB_USER_ID/CNB_GROUP_ID), 1000:1000
+// when the image does not say
+func (b *BuildpacksBuilder) builderUser(ctx context.Context) (int, int) {
+	uid, gid := 1000, 1000
+	inspect, _, err := b.docker.client.ImageInspectWithRaw(ctx, b.builderImage)
+	if err != nil || inspect.Config == nil {
+		return uid, gid
+	}
+	for _, env := range inspect.Config.Env {
+		key, value, _ := strings.Cut(env, "=")
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "CNB_USER_ID":
+			uid = n
+		case "CNB_GROUP_ID":
+			gid = n
+		}
+	}
+	return uid, gid
+}
+
+// chownTar rewrites the owner of every entry in the tar stream r
+func chownTar(r io.Reader, uid, gid int) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		tr := tar.NewReader(r)
+		tw := tar.NewWriter(pw)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				pw.CloseWithError(tw.Close())
+				return
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			header.Uid, header.Gid = uid, gid
+			header.Uname, header.Gname = "", ""
+			if err := tw.WriteHeader(header); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := io.Copy(tw, tr); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return pr
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Chaos fault kinds that can be injected when CHAOS_ENABLED is set
+const (
+	ChaosFailBuild    = "fail_build"    // The next build fails before the image is built
+	ChaosDelayDeploy  = "delay_deploy"  // The next deploy waits DelaySeconds before starting the container
+	ChaosDropWebhooks = "drop_webhooks" // The creator's billing webhooks are acknowledged but not processed
+)
+
+// ChaosFault is an injected failure
+// AppID is empty for faults that apply to every app of the user who created them (always the case for drop_webhooks)
+type ChaosFault struct {
+	ID           string `json:"id"`
+	Kind         string `json:"kind"`
+	AppID        string `json:"app_id,omitempty"`
+	DelaySeconds int    `json:"delay_seconds,omitempty"`
+	Remaining    int    `json:"remaining"` // How many more times the fault fires
+	ExpiresAt    string `json:"expires_at"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// ChaosFaultStore consumes injected faults
+type ChaosFaultStore interface {
+	// ConsumeChaosFault uses up one firing of a matching unexpired fault, preferring one scoped to
+	// appID over one its owner created for all their apps. Faults without an app only fire for their
+	// creator: the owner of appID, or userID when there is no app. Returns nil when no fault matches
+	ConsumeChaosFault(ctx context.Context, kind, appID, userID string) (*ChaosFault, error)
+}
+
+// ChaosInjector tells workers and handlers when to fail on purpose
+// Only constructed when chaos is enabled; store errors never inject a fault
+type ChaosInjector struct {
+	store  ChaosFaultStore
+	logger *zap.Logger
+}
+
+// NewChaosInjector creates a new chaos injector
+func NewChaosInjector(store ChaosFaultStore, logger *zap.Logger) *ChaosInjector {
+	return &ChaosInjector{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// ShouldFailBuild reports whether the build for appID should fail
+func (c *ChaosInjector) ShouldFailBuild(ctx context.Context, appID string) bool {
+	return c.consume(ctx, ChaosFailBuild, appID, "") != nil
+}
+
+// DeployDelay returns how long the deploy for appID should stall (0 for no delay)
+func (c *ChaosInjector) DeployDelay(ctx context.Context, appID string) time.Duration {
+	fault := c.consume(ctx, ChaosDelayDeploy, appID, "")
+	if fault == nil {
+		return 0
+	}
+	return time.Duration(fault.DelaySeconds) * time.Second
+}
+
+// ShouldDropWebhook reports whether an incoming webhook for userID should be dropped
+// Webhooks that name no user are never dropped
+func (c *ChaosInjector) ShouldDropWebhook(ctx context.Context, userID string) bool {
+	if userID == "" {
+		return false
+	}
+	return c.consume(ctx, ChaosDropWebhooks, "", userID) != nil
+}
+
+func (c *ChaosInjector) consume(ctx context.Context, kind, appID, userID string) *ChaosFault {
+	fault, err := c.store.ConsumeChaosFault(ctx, kind, appID, userID)
+	if err != nil {
+		c.logger.Warn("Failed to check for chaos fault", zap.Error(err), zap.String("kind", kind))
+		return nil
+	}
+	if fault != nil {
+		c.logger.Warn("Injecting chaos fault",
+			zap.String("fault_id", fault.ID),
+			zap.String("kind", kind),
+			zap.String("app_id", appID),
+			zap.Int("remaining", fault.Remaining),
+		)
+	}
+	return fault
+}
@@ -2,9 +2,11 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -21,6 +23,9 @@ type CleanupService struct {
 	logger     *zap.Logger
 	tempDirs   []string // Directories to prune
 	maxDiskUsagePercent float64 // Maximum disk usage percentage
+
+	dockerRootMu sync.Mutex
+	dockerRoot   string // Docker data root to measure; looked up from the daemon when not set
 }
 
 // NewCleanupService creates a new cleanup service
@@ -331,67 +336,90 @@ func (s *CleanupService) enforceDiskQuotas(ctx context.Context) (bool, error) {
 	return true, nil
 }
 
-// getDiskUsage gets the current disk usage percentage
-// Note: This is a simplified implementation. For production, consider using
-// a library like github.com/shirou/gopsutil/v3/disk for cross-platform support
-func (s *CleanupService) getDiskUsage(ctx context.Context) (float64, error) {
-	// Get current working directory to check its filesystem
-	wd, err := os.Getwd()
+// SetDockerDataRoot sets where the Docker data root is mounted in this container, for when it is not
+// at the path the daemon reports (see docker info). Empty keeps asking the daemon
+func (s *CleanupService) SetDockerDataRoot(path string) {
+	s.dockerRootMu.Lock()
+	defer s.dockerRootMu.Unlock()
+	s.dockerRoot = path
+}
+
+// MaxDiskUsagePercent is the usage above which cleanup removes old images and containers
+func (s *CleanupService) MaxDiskUsagePercent() float64 {
+	return s.maxDiskUsagePercent
+}
+
+// DiskUsage measures the filesystems cleanup frees space on: the working directory the temp
+// directories live in, and the Docker data root where images, containers and build cache take
+// most of the space. A filesystem that can't be measured (e.g. the data root is not mounted into
+// this container) is left out; the error is only returned when none could be
+func (s *CleanupService) DiskUsage(ctx context.Context) ([]DiskUsage, error) {
+	var usage []DiskUsage
+	var errs []error
+
+	if wd, err := os.Getwd(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to get working directory: %w", err))
+	} else if work, err := statDisk("work", wd); err != nil {
+		errs = append(errs, err)
+	} else {
+		usage = append(usage, work)
+	}
+
+	if root, err := s.dockerDataRoot(ctx); err != nil {
+		errs = append(errs, err)
+	} else if docker, err := statDisk("docker", root); err != nil {
+		errs = append(errs, err)
+	} else {
+		usage = append(usage, docker)
+	}
+
+	if len(usage) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	for _, err := range errs {
+		s.logger.Debug("Skipping a filesystem in disk usage", zap.Error(err))
+	}
+	return usage, nil
+}
+
+// dockerDataRoot returns the configured Docker data root, asking the daemon the first time
+func (s *CleanupService) dockerDataRoot(ctx context.Context) (string, error) {
+	s.dockerRootMu.Lock()
+	defer s.dockerRootMu.Unlock()
+	if s.dockerRoot != "" {
+		return s.dockerRoot, nil
+	}
+	info, err := s.client.Info(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get working directory: %w", err)
+		return "", fmt.Errorf("failed to get Docker data root: %w", err)
+	}
+	if info.DockerRootDir == "" {
+		return "", fmt.Errorf("Docker daemon did not report its data root")
 	}
+	s.dockerRoot = info.DockerRootDir
+	return s.dockerRoot, nil
+}
 
-	// Calculate disk usage by walking temp directories and Docker data
-	// This is a simplified approach - in production, use proper filesystem stats
-	var totalSize int64
-	var fileCount int64
+// getDiskUsage returns the usage percentage of the fullest filesystem cleanup watches
+func (s *CleanupService) getDiskUsage(ctx context.Context) (float64, error) {
+	usage, err := s.DiskUsage(ctx)
+	if err != nil {
+		return 0, err
+	}
 
-	// Walk temp directories to estimate usage
-	for _, dir := range s.tempDirs {
-		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return nil // Skip errors
-			}
-			if !info.IsDir() {
-				totalSize += info.Size()
-				fileCount++
-			}
-			return nil
-		})
-		if err != nil && !os.IsNotExist(err) {
-			s.logger.Debug("Failed to walk directory", zap.String("dir", dir), zap.Error(err))
+	fullest := usage[0]
+	for _, u := range usage[1:] {
+		if u.UsedPercent > fullest.UsedPercent {
+			fullest = u
 		}
 	}
-
-	// For now, we'll use a heuristic based on temp directory sizes
-	// In production, you'd want to use actual filesystem statistics
-	// This is a placeholder that estimates usage based on temp directories
-	// A real implementation would use syscall.Statfs (Unix) or GetDiskFreeSpaceEx (Windows)
-	
-	// Return a conservative estimate - if temp dirs are large, assume high usage
-	// This will trigger cleanup more aggressively
-	estimatedUsageMB := float64(totalSize) / (1024 * 1024)
-	
-	// Assume 100GB total disk, calculate percentage
-	// TODO: Get actual disk size from filesystem
-	assumedTotalDiskGB := 100.0
-	estimatedUsagePercent := (estimatedUsageMB / 1024.0 / assumedTotalDiskGB) * 100.0
-
-	// Cap at reasonable values
-	if estimatedUsagePercent > 100 {
-		estimatedUsagePercent = 100
-	}
-	if estimatedUsagePercent < 0 {
-		estimatedUsagePercent = 0
-	}
-
-	s.logger.Debug("Estimated disk usage",
-		zap.Float64("usage_percent", estimatedUsagePercent),
-		zap.Int64("temp_size_mb", totalSize/(1024*1024)),
-		zap.String("working_dir", wd),
+	s.logger.Debug("Disk usage",
+		zap.String("volume", fullest.Volume),
+		zap.String("path", fullest.Path),
+		zap.Float64("usage_percent", fullest.UsedPercent),
+		zap.Uint64("available_mb", fullest.AvailableBytes/(1024*1024)),
 	)
-
-	return estimatedUsagePercent, nil
+	return fullest.UsedPercent, nil
 }
 
 // removeOldContainers removes containers older than the specified age
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// cleanupLockKey holds "running:<token>" while a cleanup runs and "done:<token>" during the
+// cooldown after it
+const cleanupLockKey = "stackyn:cleanup:lock"
+
+// cleanupLockTTL frees the lock of a worker that died mid-run; runs are cut off well before it
+const cleanupLockTTL = 15 * time.Minute
+
+// cleanupAcquireScript takes the lock unless a run holds it, or (scheduled runs only) a run
+// finished within the cooldown. ARGV: token, ttl ms, force (1/0)
+var cleanupAcquireScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if current and (ARGV[3] == '0' or string.sub(current, 1, 8) == 'running:') then
+	return 0
+end
+redis.call('SET', KEYS[1], 'running:' .. ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+// cleanupReleaseScript ends a run that still holds the lock, leaving it in cooldown. ARGV: token, cooldown ms
+var cleanupReleaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= 'running:' .. ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call('SET', KEYS[1], 'done:' .. ARGV[1], 'PX', ARGV[2])
+else
+	redis.call('DEL', KEYS[1])
+end
+return 1
+`)
+
+// CleanupLock keeps cleanup runs on different workers from overlapping, and spaces out scheduled
+// runs: after a run the lock stays taken for a cooldown, so the other workers' schedulers skip
+type CleanupLock struct {
+	client *redis.Client
+}
+
+// NewCleanupLock keeps the cleanup lock in Redis through client (see NewRedisClient)
+func NewCleanupLock(client *redis.Client) *CleanupLock {
+	return &CleanupLock{client: client}
+}
+
+// Acquire takes the lock for a run, returning false when another run holds it. A forced run
+// (an admin asking for one) ignores the cooldown of the previous run
+func (l *CleanupLock) Acquire(ctx context.Context, force bool) (string, bool, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", false, fmt.Errorf("failed to generate lock token: %w", err)
+	}
+	token := hex.EncodeToString(b)
+
+	forceArg := "0"
+	if force {
+		forceArg = "1"
+	}
+	taken, err := cleanupAcquireScript.Run(ctx, l.client, []string{cleanupLockKey}, token, cleanupLockTTL.Milliseconds(), forceArg).Int()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to take cleanup lock: %w", err)
+	}
+	return token, taken == 1, nil
+}
+
+// Release ends a run, keeping scheduled runs off for cooldown
+func (l *CleanupLock) Release(ctx context.Context, token string, cooldown time.Duration) error {
+	if err := cleanupReleaseScript.Run(ctx, l.client, []string{cleanupLockKey}, token, cooldown.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("failed to release cleanup lock: %w", err)
+	}
+	return nil
+}
+
@@ -47,32 +47,32 @@ func GetConstraintError(err error) (*ConstraintError, bool) {
 	return constraintErr, ok
 }
 
-// ValidateRepoURL validates that the repository URL is a public GitHub repository
+// ValidateRepoURL validates that the repository URL is a public GitHub, GitLab or Bitbucket repository
 func (s *ConstraintsService) ValidateRepoURL(ctx context.Context, repoURL string) error {
-	// Must be a GitHub repository
-	if !strings.Contains(repoURL, "github.com") {
+	// Must be on a supported Git host
+	if !isSupportedGitHost(repoURL) {
 		return &ConstraintError{
-			Constraint: "github_only",
-			Message:    "Only public GitHub repositories are supported. Please provide a GitHub repository URL.",
-			Details:    fmt.Sprintf("Repository URL must be from github.com. Provided: %s", repoURL),
+			Constraint: "git_host",
+			Message:    "Only public GitHub, GitLab and Bitbucket repositories are supported. Please provide a repository URL from one of them.",
+			Details:    fmt.Sprintf("Repository URL must be from github.com, gitlab.com or bitbucket.org. Provided: %s", repoURL),
 		}
 	}
 
 	// Must be HTTPS (not SSH)
 	if strings.HasPrefix(repoURL, "git@") || strings.HasPrefix(repoURL, "ssh://") {
 		return &ConstraintError{
-			Constraint: "github_only",
-			Message:    "Only HTTPS GitHub URLs are supported. SSH URLs are not allowed.",
-			Details:    fmt.Sprintf("Please use HTTPS URL format: https://github.com/owner/repo. Provided: %s", repoURL),
+			Constraint: "git_host",
+			Message:    "Only HTTPS repository URLs are supported. SSH URLs are not allowed.",
+			Details:    fmt.Sprintf("Please use HTTPS URL format, e.g. https://github.com/owner/repo. Provided: %s", repoURL),
 		}
 	}
 
 	// Must be public (this is validated in GitService, but we check format here)
-	if !strings.HasPrefix(repoURL, "https://github.com/") {
+	if !hasGitHostPrefix(repoURL) {
 		return &ConstraintError{
-			Constraint: "github_only",
-			Message:    "Invalid GitHub repository URL format.",
-			Details:    fmt.Sprintf("URL must be in format: https://github.com/owner/repo. Provided: %s", repoURL),
+			Constraint: "git_host",
+			Message:    "Invalid repository URL format.",
+			Details:    fmt.Sprintf("URL must be in format: https://<github.com|gitlab.com|bitbucket.org>/owner/repo. Provided: %s", repoURL),
 		}
 	}
 
@@ -174,9 +174,9 @@ func (s *ConstraintsService) ValidateNoBackgroundWorkers(ctx context.Context, re
 	// Check package.json for worker scripts
 	packageJsonPath := filepath.Join(repoPath, "package.json")
 	if _, err := os.Stat(packageJsonPath); err == nil {
-		content, err := os.ReadFile(packageJsonPath)
+		content, err := readTextFile(packageJsonPath)
 		if err == nil {
-			contentStr := strings.ToLower(string(content))
+			contentStr := strings.ToLower(content)
 			for _, indicator := range workerIndicators {
 				if strings.Contains(contentStr, indicator) {
 					// Check if it's in scripts section (more likely to be a worker)
@@ -192,22 +192,7 @@ func (s *ConstraintsService) ValidateNoBackgroundWorkers(ctx context.Context, re
 		}
 	}
 
-	// Check for Procfile (common in Heroku-style deployments with workers)
-	procfilePath := filepath.Join(repoPath, "Procfile")
-	if _, err := os.Stat(procfilePath); err == nil {
-		content, err := os.ReadFile(procfilePath)
-		if err == nil {
-			contentStr := strings.ToLower(string(content))
-			// Check for worker processes
-			if strings.Contains(contentStr, "worker:") || strings.Contains(contentStr, "worker ") {
-				return &ConstraintError{
-					Constraint: "no_background_workers",
-					Message:    "Background workers defined in Procfile are not supported. MVP supports single HTTP applications only.",
-					Details:    "Found worker process in Procfile. Please remove worker processes and use HTTP-only application.",
-				}
-			}
-		}
-	}
+	// Procfile worker entries are not checked: they run as separate worker processes (see ParseProcfile)
 
 	// Check for common worker configuration files
 	workerConfigFiles := []string{
@@ -270,9 +255,9 @@ func (s *ConstraintsService) ValidateHTTPOnly(ctx context.Context, repoPath stri
 	for _, filename := range configFiles {
 		filePath := filepath.Join(repoPath, filename)
 		if _, err := os.Stat(filePath); err == nil {
-			content, err := os.ReadFile(filePath)
+			content, err := readTextFile(filePath)
 			if err == nil {
-				contentStr := strings.ToLower(string(content))
+				contentStr := strings.ToLower(content)
 				// Check for SSL/HTTPS configuration
 				if strings.Contains(contentStr, "ssl") || 
 				   strings.Contains(contentStr, "https") ||
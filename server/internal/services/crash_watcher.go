@@ -0,0 +1,285 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"go.uber.org/zap"
+)
+
+const (
+	// autoRestartLabel marks app containers whose crashes are restarted (the health_checks plan feature)
+	autoRestartLabel = "app.auto_restart"
+	// crashLoopResetAfter is how long a container has to stay up for its crash count to start over
+	crashLoopResetAfter = 10 * time.Minute
+	// crashLogLines is how many stderr lines of a crashed container are kept on its deployment
+	crashLogLines = 50
+	// maxCrashLogBytes bounds the stderr read from a crashed container
+	maxCrashLogBytes = 64 << 10
+	// crashWatcherReconnectDelay is waited before subscribing to Docker events again after the stream ends
+	crashWatcherReconnectDelay = 5 * time.Second
+)
+
+// CrashLoopPolicy controls how the crash watcher restarts app containers that exit
+type CrashLoopPolicy struct {
+	MaxRestarts int           // Restarts before the deployment is marked crashed
+	Backoff     time.Duration // Delay before the first restart, doubled for each one after it
+	MaxBackoff  time.Duration // Longest delay between restarts
+}
+
+// backoff returns the delay before the n-th (1-based) restart of a crash loop
+func (p CrashLoopPolicy) backoff(n int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < n && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// ContainerCrash describes an app container the platform gave up on
+type ContainerCrash struct {
+	AppID        string
+	DeploymentID string // Set by the health monitor only - look the deployment up by ContainerID otherwise
+	ContainerID  string
+	ExitCode     int
+	Reason       string
+	Restarts     int    // Restarts made since the container last stayed up
+	Logs         string // Last lines the container wrote to stderr
+	Unhealthy    bool   // Still running but failing its health checks, rather than exited
+}
+
+// crashLoop tracks the exits of one container
+type crashLoop struct {
+	crashes  int // Exits since the container last stayed up for crashLoopResetAfter
+	restarts int // Restarts made by the watcher over the container's lifetime
+}
+
+// WatchContainerExits watches Docker events for app containers that exit without being stopped on purpose
+// Containers of plans with auto-restart are started again after a delay that doubles with each crash; once
+// a container has crashed more than policy.MaxRestarts times without staying up, or straight away without
+// auto-restart, the crash callback reports it with its last stderr lines. Containers Docker restarts
+// itself (those with a restart policy) are left to Docker and their health monitor. Runs until ctx is done
+func (s *DeploymentService) WatchContainerExits(ctx context.Context, policy CrashLoopPolicy) error {
+	s.logger.Info("Starting container crash watcher",
+		zap.Int("max_restarts", policy.MaxRestarts),
+		zap.Duration("backoff", policy.Backoff),
+		zap.Duration("max_backoff", policy.MaxBackoff),
+	)
+
+	loops := make(map[string]*crashLoop)
+	for {
+		err := s.watchContainerEvents(ctx, policy, loops)
+		if ctx.Err() != nil {
+			s.logger.Info("Container crash watcher stopped")
+			return ctx.Err()
+		}
+		s.logger.Warn("Docker event stream ended, subscribing again", zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Container crash watcher stopped")
+			return ctx.Err()
+		case <-time.After(crashWatcherReconnectDelay):
+		}
+	}
+}
+
+// watchContainerEvents handles the exits of app containers until the event stream ends
+func (s *DeploymentService) watchContainerEvents(ctx context.Context, policy CrashLoopPolicy, loops map[string]*crashLoop) error {
+	filter := filters.NewArgs(
+		filters.Arg("type", string(events.ContainerEventType)),
+		filters.Arg("event", string(events.ActionDie)),
+		filters.Arg("event", string(events.ActionDestroy)),
+		filters.Arg("label", "app.id"),
+	)
+	messages, errs := s.client.Events(ctx, events.ListOptions{Filters: filter})
+
+	for {
+		select {
+		case err := <-errs:
+			return err
+		case msg := <-messages:
+			if msg.Action == events.ActionDestroy {
+				delete(loops, msg.Actor.ID)
+				s.crashed.Delete(msg.Actor.ID)
+				continue
+			}
+			s.handleContainerExit(ctx, policy, loops, msg.Actor.ID, msg.Actor.Attributes["app.id"])
+		}
+	}
+}
+
+// handleContainerExit restarts an exited app container after its backoff delay, or reports it crashed
+func (s *DeploymentService) handleContainerExit(ctx context.Context, policy CrashLoopPolicy, loops map[string]*crashLoop, containerID, appID string) {
+	if _, retired := s.retired.Load(containerID); retired {
+		return // Replaced by a newer deployment or being cleaned up
+	}
+	if _, asleep := s.sleeping.Load(containerID); asleep {
+		return // Stopped because the app is idle
+	}
+	if _, restarting := s.restarting.Load(containerID); restarting {
+		return // Restarted by the health monitor for being unhealthy
+	}
+
+	inspect, err := s.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		if !client.IsErrNotFound(err) {
+			s.logger.Warn("Failed to inspect exited container", zap.Error(err), zap.String("container_id", containerID))
+		}
+		return
+	}
+	state := inspect.State
+	if state == nil || state.Running || state.Restarting || dockerRestarts(inspect) {
+		return
+	}
+
+	loop := loops[containerID]
+	if loop == nil {
+		loop = &crashLoop{}
+		loops[containerID] = loop
+	}
+	startedAt, startErr := time.Parse(time.RFC3339Nano, state.StartedAt)
+	finishedAt, finishErr := time.Parse(time.RFC3339Nano, state.FinishedAt)
+	if startErr == nil && finishErr == nil && finishedAt.Sub(startedAt) >= crashLoopResetAfter {
+		loop.crashes = 0
+	}
+	loop.crashes++
+
+	reason := fmt.Sprintf("Process exited with code %d", state.ExitCode)
+	if state.OOMKilled {
+		reason = "Process was killed for running out of memory"
+	} else if state.Error != "" {
+		reason = state.Error
+	}
+
+	autoRestart := inspect.Config != nil && inspect.Config.Labels[autoRestartLabel] == "true"
+	if autoRestart && loop.crashes <= policy.MaxRestarts {
+		loop.restarts++
+		delay := policy.backoff(loop.crashes)
+		s.logger.Warn("App container exited, restarting after backoff",
+			zap.String("container_id", containerID),
+			zap.String("app_id", appID),
+			zap.Int("exit_code", state.ExitCode),
+			zap.Int("crashes", loop.crashes),
+			zap.Duration("backoff", delay),
+		)
+		go s.restartCrashedContainer(ctx, appID, containerID, loop.restarts, delay, reason)
+		return
+	}
+
+	crash := ContainerCrash{
+		AppID:       appID,
+		ContainerID: containerID,
+		ExitCode:    state.ExitCode,
+		Reason:      reason,
+		Restarts:    loop.crashes - 1,
+		Logs:        s.crashLog(ctx, containerID),
+	}
+	if crash.Restarts > 0 {
+		crash.Reason = fmt.Sprintf("Container kept crashing after %d restarts: %s", crash.Restarts, reason)
+	}
+	s.reportCrash(crash)
+}
+
+// restartCrashedContainer starts an exited container again once its backoff delay has passed
+// A container that cannot be started is reported crashed, as no further exit would be seen for it
+func (s *DeploymentService) restartCrashedContainer(ctx context.Context, appID, containerID string, restartCount int, delay time.Duration, reason string) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(delay):
+	}
+	if _, retired := s.retired.Load(containerID); retired {
+		return
+	}
+	if _, asleep := s.sleeping.Load(containerID); asleep {
+		return
+	}
+
+	if err := s.client.ContainerStart(ctx, containerID, container.StartOptions{}); err != nil {
+		if client.IsErrNotFound(err) {
+			return
+		}
+		s.logger.Error("Failed to restart crashed container", zap.Error(err), zap.String("container_id", containerID))
+		s.reportCrash(ContainerCrash{
+			AppID:       appID,
+			ContainerID: containerID,
+			Reason:      fmt.Sprintf("%s, and the container could not be restarted: %v", reason, err),
+			Restarts:    restartCount - 1,
+			Logs:        s.crashLog(ctx, containerID),
+		})
+		return
+	}
+	s.reportRestart(appID, "", containerID, restartCount, reason)
+}
+
+// reportCrash remembers a crashed container (see ReplayContainerCrash) and calls the crash callback
+func (s *DeploymentService) reportCrash(crash ContainerCrash) {
+	s.crashed.Store(crash.ContainerID, crash)
+	s.logger.Error("App container crashed",
+		zap.String("container_id", crash.ContainerID),
+		zap.String("app_id", crash.AppID),
+		zap.Int("exit_code", crash.ExitCode),
+		zap.Int("restarts", crash.Restarts),
+		zap.String("reason", crash.Reason),
+	)
+	if s.crashCallback != nil {
+		s.crashCallback(crash)
+	}
+}
+
+// ReplayContainerCrash calls the crash callback again for a container the crash watcher already gave up on
+// A container that exits while its deploy is still running crashes before its deployment is recorded, so
+// the deploy calls this once it has recorded the deployment. Returns whether the container had crashed
+func (s *DeploymentService) ReplayContainerCrash(containerID string) bool {
+	value, ok := s.crashed.Load(containerID)
+	if !ok {
+		return false
+	}
+	if s.crashCallback != nil {
+		s.crashCallback(value.(ContainerCrash))
+	}
+	return true
+}
+
+// crashLog returns the last lines a container wrote to stderr
+func (s *DeploymentService) crashLog(ctx context.Context, containerID string) string {
+	reader, err := s.client.ContainerLogs(ctx, containerID, container.LogsOptions{
+		ShowStderr: true,
+		Tail:       strconv.Itoa(crashLogLines),
+	})
+	if err != nil {
+		s.logger.Warn("Failed to read logs of crashed container", zap.Error(err), zap.String("container_id", containerID))
+		return ""
+	}
+	defer reader.Close()
+
+	var stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(io.Discard, &stderr, io.LimitReader(reader, maxCrashLogBytes)); err != nil {
+		s.logger.Debug("Failed to demultiplex logs of crashed container", zap.Error(err), zap.String("container_id", containerID))
+	}
+	return strings.TrimSpace(stderr.String())
+}
+
+// dockerRestarts reports whether a container has a Docker restart policy, so its exits are left to Docker
+// App containers have none; those created before the crash watcher were given on-failure on some plans
+func dockerRestarts(inspect container.InspectResponse) bool {
+	if inspect.HostConfig == nil {
+		return false
+	}
+	policy := inspect.HostConfig.RestartPolicy
+	return policy.Name != "" && !policy.IsNone()
+}
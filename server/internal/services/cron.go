@@ -0,0 +1,188 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearchLimit bounds the search for the next run (a schedule such as "0 0 30 2 *" never fires)
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// cronMacros are the shorthand schedules accepted in place of five fields
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField describes the allowed range of one schedule field
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are both Sunday
+}
+
+// CronSchedule is a parsed five-field cron expression (minute hour day-of-month month day-of-week)
+// Schedules are evaluated in UTC
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64 // Bit sets of allowed values
+	domStar, dowStar              bool   // Unrestricted day fields (cron ORs the two when both are restricted)
+}
+
+// ParseCronSchedule parses a standard cron expression or one of the @hourly/@daily/@weekly/@monthly/@yearly macros
+// Fields support *, lists (1,15), ranges (1-5) and steps (*/10, 0-30/5)
+func ParseCronSchedule(expr string) (*CronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("schedule must have 5 fields (minute hour day-of-month month day-of-week), got %d", len(parts))
+	}
+
+	sets := make([]uint64, len(parts))
+	for i, part := range parts {
+		set, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+
+	// Sunday may be written as 7
+	dow := sets[4]
+	if dow&(1<<7) != 0 {
+		dow = (dow | 1) &^ (1 << 7)
+	}
+
+	return &CronSchedule{
+		minute:  sets[0],
+		hour:    sets[1],
+		dom:     sets[2],
+		month:   sets[3],
+		dow:     dow,
+		domStar: strings.HasPrefix(parts[2], "*"),
+		dowStar: strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+func parseCronField(expr string, field cronField) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(expr, ",") {
+		rangeExpr, step := item, 1
+		if idx := strings.Index(item, "/"); idx >= 0 {
+			rangeExpr = item[:idx]
+			n, err := strconv.Atoi(item[idx+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %s field: %q", field.name, item)
+			}
+			step = n
+		}
+
+		lo, hi := field.min, field.max
+		switch {
+		case rangeExpr == "*":
+		case strings.Contains(rangeExpr, "-"):
+			bounds := strings.SplitN(rangeExpr, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid %s field: %q", field.name, item)
+			}
+			if hi, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, fmt.Errorf("invalid %s field: %q", field.name, item)
+			}
+		default:
+			n, err := strconv.Atoi(rangeExpr)
+			if err != nil {
+				return 0, fmt.Errorf("invalid %s field: %q", field.name, item)
+			}
+			lo, hi = n, n
+			if step > 1 {
+				hi = field.max // "5/15" means every 15 starting at 5
+			}
+		}
+
+		if lo < field.min || hi > field.max || lo > hi {
+			return 0, fmt.Errorf("%s field out of range (%d-%d): %q", field.name, field.min, field.max, item)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// Next returns the first time strictly after t at which the schedule fires, or the zero time if
+// it never does within the next five years
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches applies cron's day rule: when both day fields are restricted, either may match
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// MinInterval returns the shortest gap between two consecutive runs over the next day, used to
+// reject schedules that fire more often than allowed
+func (s *CronSchedule) MinInterval(from time.Time) time.Duration {
+	var minGap time.Duration
+	prev := s.Next(from)
+	if prev.IsZero() {
+		return 0
+	}
+	end := prev.Add(24 * time.Hour)
+	for prev.Before(end) {
+		next := s.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		if gap := next.Sub(prev); minGap == 0 || gap < minGap {
+			minGap = gap
+		}
+		prev = next
+	}
+	return minGap
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParseCron(t *testing.T, expr string) *CronSchedule {
+	t.Helper()
+	schedule, err := ParseCronSchedule(expr)
+	if err != nil {
+		t.Fatalf("ParseCronSchedule(%q): %v", expr, err)
+	}
+	return schedule
+}
+
+func TestParseCronScheduleRejects(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"@every 5m",
+	} {
+		if _, err := ParseCronSchedule(expr); err == nil {
+			t.Errorf("ParseCronSchedule(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// 2026-01-15 is a Thursday
+	from := time.Date(2026, 1, 15, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", from, time.Date(2026, 1, 15, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", from, time.Date(2026, 1, 15, 10, 15, 0, 0, time.UTC)},
+		{"5/20 * * * *", from, time.Date(2026, 1, 15, 10, 25, 0, 0, time.UTC)},
+		{"0-30/10 * * * *", from, time.Date(2026, 1, 15, 10, 10, 0, 0, time.UTC)},
+		{"7 * * * *", from, time.Date(2026, 1, 15, 11, 7, 0, 0, time.UTC)}, // Strictly after from
+		{"0 9-17 * * *", from, time.Date(2026, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"30 2,14 * * *", from, time.Date(2026, 1, 15, 14, 30, 0, 0, time.UTC)},
+		{"@hourly", from, time.Date(2026, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@daily", from, time.Date(2026, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", from, time.Date(2026, 1, 18, 0, 0, 0, 0, time.UTC)},
+		{"@MONTHLY", from, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", from, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// Sunday is 0 or 7
+		{"0 0 * * 7", from, time.Date(2026, 1, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1-5", time.Date(2026, 1, 16, 12, 0, 0, 0, time.UTC), time.Date(2026, 1, 19, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either matches (the 20th, or the next Monday the 19th)
+		{"0 0 20 * 1", from, time.Date(2026, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 16 * 1", from, time.Date(2026, 1, 16, 0, 0, 0, 0, time.UTC)},
+		// One day field restricted: it alone decides
+		{"0 0 20 * *", from, time.Date(2026, 1, 20, 0, 0, 0, 0, time.UTC)},
+		// A field starting with * counts as unrestricted, as in Vixie cron: both must match (a Monday the 1st, 11th, 21st or 31st)
+		{"0 0 */10 * 1", from, time.Date(2026, 5, 11, 0, 0, 0, 0, time.UTC)},
+		// Month and year rollover
+		{"0 0 31 * *", time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC), time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 12, 31, 23, 59, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * 2 *", from, time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", from, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Evaluated in UTC
+		{"0 12 * * *", time.Date(2026, 1, 15, 11, 0, 0, 0, time.FixedZone("CET", 3600)), time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)},
+		// Never fires
+		{"0 0 30 2 *", from, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			if got := mustParseCron(t, tt.expr).Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronScheduleMinInterval(t *testing.T) {
+	from := time.Date(2026, 1, 15, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Duration
+	}{
+		{"* * * * *", time.Minute},
+		{"*/5 * * * *", 5 * time.Minute},
+		{"0,5,30 * * * *", 5 * time.Minute},
+		{"0-4 3 * * *", time.Minute}, // Bursts count, however rarely they happen
+		{"0 */2 * * *", 2 * time.Hour},
+		{"@daily", 24 * time.Hour},
+		{"@weekly", 7 * 24 * time.Hour},
+		{"0 0 30 2 *", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			if got := mustParseCron(t, tt.expr).MinInterval(from); got != tt.want {
+				t.Errorf("MinInterval = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package services
+
+import "context"
+
+// Steps of a deploy recorded on the app's events timeline (GET /api/v1/apps/{id}/events), along with
+// the app being stopped and started by its owner
+const (
+	DeployEventBuildQueued       = "build_queued"
+	DeployEventBuildStarted      = "build_started"
+	DeployEventCloneFinished     = "clone_finished"
+	DeployEventImageBuilt        = "image_built"
+	DeployEventImageScanned      = "image_scanned"
+	DeployEventSecretsDetected   = "secrets_detected"
+	DeployEventBuildFailed       = "build_failed"
+	DeployEventContainerStarted  = "container_started"
+	DeployEventRouteSwitched     = "route_switched"
+	DeployEventDeployFailed      = "deploy_failed"
+	DeployEventHealthCheckPassed = "health_check_passed"
+	DeployEventHealthCheckFailed = "health_check_failed"
+	DeployEventCrashed           = "crashed"
+	DeployEventRestarted         = "restarted"
+	DeployEventStopped           = "stopped"
+	DeployEventStarted           = "started"
+)
+
+// DeployEvent is one step of a deploy, or something that happened to its container afterwards
+// DeploymentID is the deployment record's ID and is only known from the deploy step on
+type DeployEvent struct {
+	AppID        string
+	BuildJobID   string
+	DeploymentID string
+	Type         string
+	Message      string
+	Data         map[string]interface{}
+}
+
+// DeployEventRecorder persists deploy events (api.DeployEventRepo)
+type DeployEventRecorder interface {
+	RecordDeployEvent(ctx context.Context, event DeployEvent) error
+}
@@ -2,13 +2,16 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"net/http"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -17,12 +20,29 @@ import (
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"go.uber.org/zap"
 )
 
-// CrashCallback is a function that gets called when a container crashes
-// Parameters: appID, deploymentID, containerID, exitCode, error message
-type CrashCallback func(appID, deploymentID, containerID string, exitCode int, errorMsg string)
+// CrashCallback is a function that gets called when a container crashes and is not restarted again
+type CrashCallback func(crash ContainerCrash)
+
+// RestartCallback is a function that gets called when a container is restarted
+// Parameters: appID, deploymentID, containerID, total restarts of this deployment, reason
+type RestartCallback func(appID, deploymentID, containerID string, restartCount int, reason string)
+
+const (
+	// defaultHealthCheckInterval is how often the container is probed when no interval is configured
+	defaultHealthCheckInterval = 10 * time.Second
+	// onFailureRestartRetries is how many times Docker restarts a crashed worker process container
+	onFailureRestartRetries = 3
+	// maxUnhealthyRestarts is how many restarts an unhealthy container gets without recovering before it is marked failed
+	maxUnhealthyRestarts = 5
+	// routeSwitchTimeout is how long a zero-downtime deploy waits for Traefik to route to the new container
+	routeSwitchTimeout = 30 * time.Second
+	// routeSettleDelay is waited instead when the Traefik API is not configured (covers the provider throttle)
+	routeSettleDelay = 5 * time.Second
+)
 
 // DeploymentService handles container deployment operations
 type DeploymentService struct {
@@ -31,6 +51,17 @@ type DeploymentService struct {
 	logPersistence RuntimeLogPersistence // Optional: for persisting runtime logs
 	networkName    string                 // Docker network name (e.g., "stackyn-network")
 	crashCallback  CrashCallback          // Optional: callback for crash events
+	restartCallback RestartCallback       // Optional: callback for restarts
+	retired        sync.Map               // Container IDs being stopped on purpose (monitors must not restart them)
+	sleeping       sync.Map               // Container IDs stopped while their app sleeps or is stopped (monitors pause until it starts)
+	restarting     sync.Map               // Container IDs the health monitor is restarting (the crash watcher ignores their exit)
+	crashed        sync.Map               // ContainerCrash of app containers the crash watcher gave up on, by container ID
+	traefikAPIURL  string                 // Optional: Traefik API used to confirm route switches
+	remoteTLS      *remoteDockerTLS       // Optional: client certificate for other hosts' Docker daemons (CopyImage)
+	isolationRuntime string               // Optional: OCI runtime of strict containers (SetIsolation)
+	seccompProfile   string               // Optional: seccomp profile (JSON) of hardened and strict containers
+	routing        *RoutingService        // Traefik labels of app containers
+	httpClient     *http.Client
 }
 
 // GetDockerClient returns the Docker client (for use by other services)
@@ -65,6 +96,10 @@ func NewDeploymentService(dockerHost string, logger *zap.Logger, logPersistence
 		logPersistence: logPersistence,
 		networkName:    networkName,
 		crashCallback:  nil,
+		routing:        NewRoutingService(networkName),
+		httpClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
 	}, nil
 }
 
@@ -73,6 +108,16 @@ func (s *DeploymentService) SetCrashCallback(callback CrashCallback) {
 	s.crashCallback = callback
 }
 
+// SetTraefikAPIURL sets the Traefik API zero-downtime deploys poll to confirm the new container receives traffic
+func (s *DeploymentService) SetTraefikAPIURL(apiURL string) {
+	s.traefikAPIURL = strings.TrimSuffix(apiURL, "/")
+}
+
+// SetRestartCallback sets the callback function for container restart events
+func (s *DeploymentService) SetRestartCallback(callback RestartCallback) {
+	s.restartCallback = callback
+}
+
 // Close closes the Docker client
 func (s *DeploymentService) Close() error {
 	return s.client.Close()
@@ -96,6 +141,19 @@ type DeploymentOptions struct {
 	EnvVars      map[string]string
 	UseDockerCompose bool   // Whether to use docker-compose for deployment
 	ComposeFilePath string  // Path to docker-compose.yml file (if using docker-compose)
+	CustomDomains []string  // Verified custom domains the container should also answer on
+	HealthCheck  HealthCheckOptions // HTTP health check and restart policy
+	ZeroDowntime bool               // Require the new container to be healthy and routed before the old one stops; roll back otherwise
+	WAF          *WAFConfig         // Optional: WAF middleware in front of the app's routers
+	Routing      *RoutingConfig     // Optional: edge options of the app's routers (nil for DefaultRoutingConfig)
+	Isolation    IsolationLevel     // How tightly the container is confined (the stricter of the plan's and the app's; not applied to docker-compose deployments)
+}
+
+// HealthCheckOptions configures the container's HTTP health check
+type HealthCheckOptions struct {
+	Path        string        // Path probed inside the container (default "/")
+	Interval    time.Duration // Probe interval (default 10s)
+	AutoRestart bool          // Restart the container when it crashes or turns unhealthy (health_checks plan feature)
 }
 
 // DeploymentResult represents the result of a deployment
@@ -183,15 +241,26 @@ func (s *DeploymentService) DeployContainer(ctx context.Context, opts Deployment
 	containerConfig := &container.Config{
 		Image:  imageRef,
 		Env:    envVars,
-		Labels: s.generateTraefikLabels(opts.Subdomain, opts.Port, opts.AppID),
+		Labels: s.routing.Labels(AppRoute{
+			AppID:         opts.AppID,
+			Subdomain:     opts.Subdomain,
+			Port:          opts.Port,
+			HealthPath:    healthCheckPath(opts),
+			CustomDomains: opts.CustomDomains,
+			WAF:           opts.WAF,
+			Routing:       opts.Routing,
+		}),
 		// Docker health check (complements Traefik health check)
-		Healthcheck: &container.HealthConfig{
-			Test:        []string{"CMD-SHELL", fmt.Sprintf("wget --no-verbose --tries=1 --spider http://localhost:%d/ || exit 1", opts.Port)},
-			Interval:    10 * time.Second,
-			Timeout:     3 * time.Second,
-			Retries:     3,
-			StartPeriod: 10 * time.Second,
-		},
+		Healthcheck: s.healthConfig(opts),
+	}
+
+	// Crashed processes are restarted by the crash watcher (with backoff) on health-checked plans, not by Docker
+	if opts.HealthCheck.AutoRestart {
+		containerConfig.Labels[autoRestartLabel] = "true"
+	}
+	restartPolicy := container.RestartPolicy{
+		Name:              container.RestartPolicyDisabled,
+		MaximumRetryCount: 0,
 	}
 
 	// Create host config with resource limits
@@ -201,13 +270,11 @@ func (s *DeploymentService) DeployContainer(ctx context.Context, opts Deployment
 			NanoCPUs:   int64(opts.Limits.CPU * 1e9),      // Convert CPU to nanoseconds
 			MemorySwap: opts.Limits.MemoryMB * 1024 * 1024, // Same as memory (no swap)
 		},
-		RestartPolicy: container.RestartPolicy{
-			Name:              "no", // Don't restart on failure - try once only
-			MaximumRetryCount: 0,
-		},
+		RestartPolicy: restartPolicy,
 		// Auto-remove on stop (for cleanup)
 		AutoRemove: false, // We'll manage cleanup manually
 	}
+	s.applyIsolation(hostConfig, opts.Isolation)
 
 	// Create network config (connect to the specified network)
 	networkConfig := &network.NetworkingConfig{
@@ -225,6 +292,7 @@ func (s *DeploymentService) DeployContainer(ctx context.Context, opts Deployment
 		zap.String("image", imageRef),
 		zap.Int64("memory_mb", opts.Limits.MemoryMB),
 		zap.Float64("cpu", opts.Limits.CPU),
+		zap.String("isolation", string(opts.Isolation)),
 	)
 
 	// Create container
@@ -248,19 +316,52 @@ func (s *DeploymentService) DeployContainer(ctx context.Context, opts Deployment
 		zap.String("app_id", opts.AppID),
 	)
 
-	// Step 4.5: Wait for container to be healthy before stopping old containers (zero-downtime deployment)
-	// This ensures the new container is ready to serve traffic before old one is stopped
+	// Step 4.5: Wait for container to be healthy before stopping old containers
+	// Traefik only adds a container to the app's load balancer once Docker reports it healthy,
+	// so the old container keeps serving until then
 	healthCtx, healthCancel := context.WithTimeout(ctx, 2*time.Minute) // Allow up to 2 minutes for health check
 	defer healthCancel()
 	
-	if err := s.waitForContainerHealth(healthCtx, createResp.ID, opts.Port); err != nil {
+	healthErr := s.waitForContainerHealth(healthCtx, createResp.ID, opts.Port)
+	if opts.ZeroDowntime {
+		// Zero-downtime: never replace a serving container with one that isn't healthy
+		if healthErr != nil {
+			if previous := s.runningPredecessors(ctx, opts.AppID, createResp.ID); previous > 0 {
+				s.logger.Warn("New container never became healthy, rolling back to the running deployment",
+					zap.String("container_id", createResp.ID),
+					zap.String("app_id", opts.AppID),
+					zap.Int("running_previous", previous),
+					zap.Error(healthErr),
+				)
+				s.rollbackContainer(ctx, createResp.ID, opts.AppID)
+				return nil, fmt.Errorf("rolled back: new container did not become healthy (%v); the previous deployment is still serving traffic", healthErr)
+			}
+			// First deployment - nothing to roll back to
+			s.logger.Warn("Container health check failed on first deployment, keeping it running",
+				zap.String("container_id", createResp.ID),
+				zap.String("app_id", opts.AppID),
+				zap.Error(healthErr),
+			)
+		} else if err := s.waitForRouteSwitch(ctx, opts.AppID, createResp.ID); err != nil {
+			// Healthy but not yet visible in Traefik - stopping the old container now would drop traffic briefly
+			s.logger.Warn("Could not confirm Traefik routes to the new container, stopping old containers anyway",
+				zap.String("container_id", createResp.ID),
+				zap.String("app_id", opts.AppID),
+				zap.Error(err),
+			)
+		} else {
+			s.logger.Info("Traffic switched to new container, draining old containers",
+				zap.String("container_id", createResp.ID),
+				zap.String("app_id", opts.AppID),
+			)
+		}
+	} else if healthErr != nil {
 		s.logger.Warn("Container health check failed or timed out, but continuing deployment",
 			zap.String("container_id", createResp.ID),
 			zap.String("app_id", opts.AppID),
-			zap.Error(err),
+			zap.Error(healthErr),
 		)
 		// Continue anyway - container might still work, just not passing health checks yet
-		// In production, you might want to fail here for strict zero-downtime
 	} else {
 		s.logger.Info("Container passed health check, safe to stop old containers",
 			zap.String("container_id", createResp.ID),
@@ -285,12 +386,11 @@ func (s *DeploymentService) DeployContainer(ctx context.Context, opts Deployment
 		)
 	}
 
-	// Step 5: Start crash detection monitoring
-	// Use app-scoped context that can be cancelled when app is deleted
-	monitorCtx, monitorCancel := context.WithCancel(ctx)
-	// Note: monitorCancel should be called when app is deleted (not implemented here)
-	_ = monitorCancel // Suppress unused variable warning for now
-	go s.monitorContainerCrash(monitorCtx, createResp.ID, opts.AppID, opts.DeploymentID)
+	// Step 5: Start health monitoring (exits are handled by the crash watcher, see WatchContainerExits)
+	if opts.HealthCheck.AutoRestart {
+		// Runs for the container's lifetime (exits once the container is removed)
+		go s.monitorContainerHealth(context.Background(), createResp.ID, opts.AppID, opts.DeploymentID, s.healthCheckInterval(opts))
+	}
 
 	// Step 6: Start runtime log streaming and persistence
 	// Use background context so log streaming continues after deploy task completes
@@ -556,6 +656,7 @@ func (s *DeploymentService) ensureOneContainerPerApp(ctx context.Context, appID
 			zap.String("container_id", c.ID),
 			zap.String("app_id", appID),
 		)
+		s.retired.Store(c.ID, true)
 
 		// Stop container with timeout
 		stopCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
@@ -571,6 +672,8 @@ func (s *DeploymentService) ensureOneContainerPerApp(ctx context.Context, appID
 		removeOpts := container.RemoveOptions{Force: true}
 		if err := s.client.ContainerRemove(ctx, c.ID, removeOpts); err != nil {
 			s.logger.Warn("Failed to remove container", zap.Error(err), zap.String("container_id", c.ID))
+		} else {
+			s.retired.Delete(c.ID) // Gone - its monitor exits on the next inspect
 		}
 	}
 
@@ -600,6 +703,7 @@ func (s *DeploymentService) stopOldContainersForApp(ctx context.Context, appID s
 			zap.String("app_id", appID),
 			zap.String("new_container_id", newContainerID),
 		)
+		s.retired.Store(c.ID, true)
 
 		// Stop container with timeout
 		stopCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
@@ -634,12 +738,139 @@ func (s *DeploymentService) stopOldContainersForApp(ctx context.Context, appID s
 				zap.String("container_id", c.ID),
 				zap.String("app_id", appID),
 			)
+			s.retired.Delete(c.ID) // Gone - its monitor exits on the next inspect
 		}
 	}
 
 	return stoppedContainerIDs, nil
 }
 
+// runningPredecessors counts the app's running containers other than newContainerID
+func (s *DeploymentService) runningPredecessors(ctx context.Context, appID, newContainerID string) int {
+	containers, err := s.findContainersByAppID(ctx, appID)
+	if err != nil {
+		s.logger.Warn("Failed to list containers for rollback check", zap.Error(err), zap.String("app_id", appID))
+		return 0
+	}
+	running := 0
+	for _, c := range containers {
+		if c.ID != newContainerID && c.State == "running" {
+			running++
+		}
+	}
+	return running
+}
+
+// rollbackContainer removes a new container that failed its health gate, leaving the previous deployment in place
+func (s *DeploymentService) rollbackContainer(ctx context.Context, containerID, appID string) {
+	s.retired.Store(containerID, true)
+	if err := s.client.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true}); err != nil {
+		s.logger.Warn("Failed to remove rolled back container",
+			zap.Error(err),
+			zap.String("container_id", containerID),
+			zap.String("app_id", appID),
+		)
+		return
+	}
+	s.retired.Delete(containerID)
+}
+
+// traefikService is the subset of Traefik's /api/http/services/{name} response used to confirm routing
+type traefikService struct {
+	LoadBalancer struct {
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+	} `json:"loadBalancer"`
+	ServerStatus map[string]string `json:"serverStatus"`
+}
+
+// waitForRouteSwitch waits until Traefik load-balances the app to the new container
+// Without a Traefik API it waits a fixed delay for the Docker provider to pick up the health change
+func (s *DeploymentService) waitForRouteSwitch(ctx context.Context, appID, containerID string) error {
+	if s.traefikAPIURL == "" {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(routeSettleDelay):
+			return nil
+		}
+	}
+
+	containerJSON, err := s.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container: %w", err)
+	}
+	var containerIP string
+	if containerJSON.NetworkSettings != nil {
+		if networkInfo, ok := containerJSON.NetworkSettings.Networks[s.networkName]; ok {
+			containerIP = networkInfo.IPAddress
+		}
+	}
+	if containerIP == "" {
+		return fmt.Errorf("container has no address on network %s", s.networkName)
+	}
+
+	// Matches the service name in RoutingService.Labels
+	serviceURL := fmt.Sprintf("%s/api/http/services/app-%s@docker", s.traefikAPIURL, appID)
+	serverPrefix := fmt.Sprintf("http://%s:", containerIP)
+
+	deadline := time.Now().Add(routeSwitchTimeout)
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if routed, err := s.traefikRoutesTo(ctx, serviceURL, serverPrefix); err != nil {
+			s.logger.Debug("Traefik route check failed", zap.Error(err), zap.String("app_id", appID))
+		} else if routed {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("traefik did not route to %s within %v", containerIP, routeSwitchTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// traefikRoutesTo reports whether the Traefik service has an UP server whose URL starts with serverPrefix
+func (s *DeploymentService) traefikRoutesTo(ctx context.Context, serviceURL, serverPrefix string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serviceURL, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil // Service not (yet) known to Traefik
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("traefik API returned status %d", resp.StatusCode)
+	}
+
+	var service traefikService
+	if err := json.NewDecoder(resp.Body).Decode(&service); err != nil {
+		return false, fmt.Errorf("failed to decode traefik service: %w", err)
+	}
+	for _, server := range service.LoadBalancer.Servers {
+		if !strings.HasPrefix(server.URL, serverPrefix) {
+			continue
+		}
+		// serverStatus is only populated once Traefik's own health check has run
+		if status, ok := service.ServerStatus[server.URL]; !ok || status == "UP" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // waitForContainerHealth waits for a container to pass its health check
 // This is used for zero-downtime deployments to ensure new container is ready before stopping old ones
 func (s *DeploymentService) waitForContainerHealth(ctx context.Context, containerID string, port int) error {
@@ -830,6 +1061,8 @@ func (s *DeploymentService) CleanupAppResources(ctx context.Context, appID strin
 		s.logger.Warn("Failed to find containers for cleanup", zap.Error(err), zap.String("app_id", appID))
 	} else {
 		for _, c := range containers {
+			s.retired.Store(c.ID, true)
+
 			// Stop container if running
 			if c.State == "running" {
 				stopCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
@@ -858,10 +1091,16 @@ func (s *DeploymentService) CleanupAppResources(ctx context.Context, appID strin
 					zap.String("container_id", c.ID),
 					zap.String("app_id", appID),
 				)
+				s.retired.Delete(c.ID) // Gone - its monitor exits on the next inspect
 			}
 		}
 	}
 
+	// Step 1.5: Remove the app's worker processes
+	if _, err := s.StopWorkers(ctx, appID, ""); err != nil {
+		s.logger.Warn("Failed to remove worker containers during cleanup", zap.Error(err), zap.String("app_id", appID))
+	}
+
 	// Step 2: Find and remove all images for this app
 	// Image format: stackyn-{appID}:{buildJobID} or stackyn-{appID}
 	imagePattern := fmt.Sprintf("stackyn-%s", appID)
@@ -1007,59 +1246,6 @@ func (s *DeploymentService) generateContainerName(appID, deploymentID string) st
 	return fmt.Sprintf("stackyn-%s-%s", appID, deploymentID)
 }
 
-// generateTraefikLabels generates Traefik labels for routing with HTTPS, subdomains, and health checks
-func (s *DeploymentService) generateTraefikLabels(subdomain string, port int, appID string) map[string]string {
-	routerName := fmt.Sprintf("app-%s", appID)
-	serviceName := fmt.Sprintf("app-%s", appID)
-	middlewareName := fmt.Sprintf("app-%s-redirect", appID)
-	
-	// Check if this is a .local domain (local development)
-	isLocalDomain := strings.HasSuffix(subdomain, ".local") || strings.HasSuffix(subdomain, ".localhost")
-	
-	labels := map[string]string{
-		// Enable Traefik
-		"traefik.enable": "true",
-		
-		// Service configuration
-		fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port", serviceName): strconv.Itoa(port),
-		fmt.Sprintf("traefik.http.services.%s.loadbalancer.healthcheck.path", serviceName): "/",
-		fmt.Sprintf("traefik.http.services.%s.loadbalancer.healthcheck.interval", serviceName): "10s",
-		fmt.Sprintf("traefik.http.services.%s.loadbalancer.healthcheck.timeout", serviceName): "10s", // Increased from 3s to allow app startup time
-		fmt.Sprintf("traefik.http.services.%s.loadbalancer.healthcheck.scheme", serviceName): "http", // Use HTTP for health checks
-		
-		// Use the configured network
-		"traefik.docker.network": s.networkName,
-		
-		// App ID label for container lookup
-		"app.id": appID,
-		"app.subdomain": subdomain,
-	}
-	
-	if isLocalDomain {
-		// For .local domains, use HTTP only (no HTTPS/TLS)
-		labels[fmt.Sprintf("traefik.http.routers.%s.rule", routerName)] = fmt.Sprintf("Host(`%s`)", subdomain)
-		labels[fmt.Sprintf("traefik.http.routers.%s.entrypoints", routerName)] = "web"
-	} else {
-		// For production domains, use HTTPS with redirect
-		// HTTP Router (redirects to HTTPS)
-		labels[fmt.Sprintf("traefik.http.routers.%s-http.rule", routerName)] = fmt.Sprintf("Host(`%s`)", subdomain)
-		labels[fmt.Sprintf("traefik.http.routers.%s-http.entrypoints", routerName)] = "web"
-		labels[fmt.Sprintf("traefik.http.routers.%s-http.middlewares", routerName)] = middlewareName
-		
-		// HTTPS Router (main router)
-		labels[fmt.Sprintf("traefik.http.routers.%s.rule", routerName)] = fmt.Sprintf("Host(`%s`)", subdomain)
-		labels[fmt.Sprintf("traefik.http.routers.%s.entrypoints", routerName)] = "websecure"
-		labels[fmt.Sprintf("traefik.http.routers.%s.tls", routerName)] = "true"
-		labels[fmt.Sprintf("traefik.http.routers.%s.tls.certresolver", routerName)] = "letsencrypt"
-		
-		// Redirect middleware (HTTP to HTTPS)
-		labels[fmt.Sprintf("traefik.http.middlewares.%s.redirectscheme.scheme", middlewareName)] = "https"
-		labels[fmt.Sprintf("traefik.http.middlewares.%s.redirectscheme.permanent", middlewareName)] = "true"
-	}
-
-	return labels
-}
-
 // streamAndPersistRuntimeLogs streams and persists runtime logs from a container
 func (s *DeploymentService) streamAndPersistRuntimeLogs(ctx context.Context, containerID, appID, deploymentID string) {
 	// Stream logs from container
@@ -1109,6 +1295,187 @@ func (s *DeploymentService) persistRuntimeLogStream(ctx context.Context, entry i
 	return nil
 }
 
+// healthCheckInterval returns the configured probe interval or the default
+func (s *DeploymentService) healthCheckInterval(opts DeploymentOptions) time.Duration {
+	if opts.HealthCheck.Interval > 0 {
+		return opts.HealthCheck.Interval
+	}
+	return defaultHealthCheckInterval
+}
+
+// healthCheckPath returns the configured health check path or "/"
+func healthCheckPath(opts DeploymentOptions) string {
+	if opts.HealthCheck.Path == "" || !strings.HasPrefix(opts.HealthCheck.Path, "/") {
+		return "/"
+	}
+	return opts.HealthCheck.Path
+}
+
+// healthConfig builds the Docker health check probing the app's health check path
+func (s *DeploymentService) healthConfig(opts DeploymentOptions) *container.HealthConfig {
+	path := healthCheckPath(opts)
+
+	return &container.HealthConfig{
+		Test:        []string{"CMD-SHELL", fmt.Sprintf("wget --no-verbose --tries=1 --spider 'http://localhost:%d%s' || exit 1", opts.Port, path)},
+		Interval:    s.healthCheckInterval(opts),
+		Timeout:     3 * time.Second,
+		Retries:     3,
+		StartPeriod: 10 * time.Second,
+	}
+}
+
+// monitorContainerHealth restarts a container when it turns unhealthy and reports restarts
+// Crashes are left to the crash watcher, except on containers created with Docker's on-failure policy
+// (before the watcher), whose restarts are reported here. Gives up (and reports a crash) once the
+// container stays unhealthy or Docker stops retrying
+func (s *DeploymentService) monitorContainerHealth(ctx context.Context, containerID, appID, deploymentID string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	monitorRestarts := 0     // Restarts issued here (Docker's RestartCount only counts policy restarts)
+	unhealthyRestarts := 0   // Restarts since the container was last healthy
+	reportedRestarts := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, retired := s.retired.Load(containerID); retired {
+				return // Replaced by a newer deployment or being cleaned up
+			}
+			if _, asleep := s.sleeping.Load(containerID); asleep {
+				continue // Stopped because the app is idle, not unhealthy
+			}
+
+			containerJSON, err := s.client.ContainerInspect(ctx, containerID)
+			if err != nil {
+				if client.IsErrNotFound(err) {
+					s.logger.Debug("Container removed, stopping health monitor",
+						zap.String("container_id", containerID),
+						zap.String("app_id", appID),
+					)
+					return
+				}
+				s.logger.Warn("Failed to inspect container for health monitoring", zap.Error(err), zap.String("container_id", containerID))
+				continue
+			}
+			state := containerJSON.State
+
+			// Report restarts made by Docker's on-failure policy
+			if total := containerJSON.RestartCount + monitorRestarts; total > reportedRestarts {
+				reportedRestarts = total
+				s.reportRestart(appID, deploymentID, containerID, total, fmt.Sprintf("Process exited (exit code %d)", state.ExitCode))
+			}
+
+			switch {
+			case state.Restarting:
+				continue
+
+			case state.Running && state.Health != nil && state.Health.Status == types.Unhealthy:
+				reason := "Health check failing"
+				if len(state.Health.Log) > 0 {
+					if output := strings.TrimSpace(state.Health.Log[len(state.Health.Log)-1].Output); output != "" {
+						reason += ": " + output
+					}
+				}
+
+				if unhealthyRestarts >= maxUnhealthyRestarts {
+					s.logger.Error("Container still unhealthy after restarts, giving up",
+						zap.String("container_id", containerID),
+						zap.String("app_id", appID),
+						zap.String("deployment_id", deploymentID),
+						zap.Int("restarts", unhealthyRestarts),
+						zap.String("reason", reason),
+					)
+					s.reportCrash(ContainerCrash{
+						AppID:        appID,
+						DeploymentID: deploymentID,
+						ContainerID:  containerID,
+						ExitCode:     state.ExitCode,
+						Reason:       fmt.Sprintf("Container remained unhealthy after %d restarts (%s)", unhealthyRestarts, reason),
+						Restarts:     unhealthyRestarts,
+						Logs:         s.crashLog(ctx, containerID),
+						Unhealthy:    true,
+					})
+					return
+				}
+
+				s.logger.Warn("Container unhealthy, restarting",
+					zap.String("container_id", containerID),
+					zap.String("app_id", appID),
+					zap.String("deployment_id", deploymentID),
+					zap.String("reason", reason),
+				)
+				timeout := 10
+				s.restarting.Store(containerID, true)
+				err := s.client.ContainerRestart(ctx, containerID, container.StopOptions{Timeout: &timeout})
+				s.restarting.Delete(containerID)
+				if err != nil {
+					s.logger.Error("Failed to restart unhealthy container", zap.Error(err), zap.String("container_id", containerID))
+					continue
+				}
+				monitorRestarts++
+				unhealthyRestarts++
+				reportedRestarts = containerJSON.RestartCount + monitorRestarts
+				s.reportRestart(appID, deploymentID, containerID, reportedRestarts, reason)
+
+			case state.Running:
+				if state.Health == nil || state.Health.Status == types.Healthy {
+					unhealthyRestarts = 0
+				}
+
+			default:
+				if !dockerRestarts(containerJSON) {
+					// Exited - the crash watcher restarts it or reports the crash
+					if _, crashed := s.crashed.Load(containerID); crashed {
+						return
+					}
+					continue
+				}
+
+				// Exited and Docker's restart policy has given up
+				errorMsg := state.Error
+				if errorMsg == "" {
+					errorMsg = fmt.Sprintf("Container exited with status %s (exit code %d) after %d restarts", state.Status, state.ExitCode, reportedRestarts)
+				}
+				s.logger.Error("Container crashed and was not restarted",
+					zap.String("container_id", containerID),
+					zap.String("app_id", appID),
+					zap.String("deployment_id", deploymentID),
+					zap.Int("exit_code", state.ExitCode),
+					zap.Int("restart_count", reportedRestarts),
+				)
+				if s.crashCallback != nil {
+					s.crashCallback(ContainerCrash{
+						AppID:        appID,
+						DeploymentID: deploymentID,
+						ContainerID:  containerID,
+						ExitCode:     state.ExitCode,
+						Reason:       errorMsg,
+						Restarts:     reportedRestarts,
+					})
+				}
+				return
+			}
+		}
+	}
+}
+
+// reportRestart calls the restart callback if set
+func (s *DeploymentService) reportRestart(appID, deploymentID, containerID string, restartCount int, reason string) {
+	s.logger.Info("Container restarted",
+		zap.String("container_id", containerID),
+		zap.String("app_id", appID),
+		zap.String("deployment_id", deploymentID),
+		zap.Int("restart_count", restartCount),
+		zap.String("reason", reason),
+	)
+	if s.restartCallback != nil {
+		s.restartCallback(appID, deploymentID, containerID, restartCount, reason)
+	}
+}
+
 // monitorContainerCrash monitors a container for crashes and logs errors
 func (s *DeploymentService) monitorContainerCrash(ctx context.Context, containerID, appID, deploymentID string) {
 	ticker := time.NewTicker(10 * time.Second) // Check every 10 seconds
@@ -1121,6 +1488,10 @@ func (s *DeploymentService) monitorContainerCrash(ctx context.Context, container
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			if _, asleep := s.sleeping.Load(containerID); asleep {
+				continue // Stopped because the app is idle, not crashed
+			}
+
 			// Inspect container
 			containerJSON, err := s.client.ContainerInspect(ctx, containerID)
 			if err != nil {
@@ -1184,7 +1555,14 @@ func (s *DeploymentService) monitorContainerCrash(ctx context.Context, container
 
 				// Call crash callback if set (to update database)
 				if s.crashCallback != nil {
-					s.crashCallback(appID, deploymentID, containerID, containerJSON.State.ExitCode, errorMsg)
+					s.crashCallback(ContainerCrash{
+						AppID:        appID,
+						DeploymentID: deploymentID,
+						ContainerID:  containerID,
+						ExitCode:     containerJSON.State.ExitCode,
+						Reason:       errorMsg,
+						Logs:         logs,
+					})
 				}
 
 				// Update last status to avoid duplicate logging
@@ -1346,3 +1724,193 @@ func (s *DeploymentService) VerifyDeployment(ctx context.Context, appID string)
 	return result, nil
 }
 
+
+// maxOneOffOutputBytes caps the output kept from a one-off container (the tail is kept)
+const maxOneOffOutputBytes = 64 * 1024
+
+// OneOffOptions describes a command run to completion in a throwaway container of an app image
+type OneOffOptions struct {
+	AppID     string
+	RunID     string // Labels the container so leftovers can be traced to their run
+	ImageRef  string // Full image reference ("name:tag")
+	Command   string // Run with /bin/sh -c
+	EnvVars   map[string]string
+	Limits    ResourceLimits
+	Timeout   time.Duration
+	Output    io.Writer      // Optional: receives stdout and stderr as the command produces them
+	Isolation IsolationLevel // Same as the app's containers
+}
+
+// OneOffResult is the outcome of a one-off container run
+type OneOffResult struct {
+	ExitCode int
+	Output   string // Combined stdout and stderr, truncated to the last 64 KB
+	TimedOut bool
+}
+
+// RunOneOffContainer runs a command in a new container of the app image and waits for it to exit
+// The container gets the app's env vars and limits but no Traefik labels, so it never receives
+// traffic. It is removed once its output has been collected
+func (s *DeploymentService) RunOneOffContainer(ctx context.Context, opts OneOffOptions) (*OneOffResult, error) {
+	if err := s.ensureNetworkExists(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ensure network exists: %w", err)
+	}
+	if err := s.pullImage(ctx, opts.ImageRef); err != nil {
+		return nil, fmt.Errorf("failed to pull image: %w", err)
+	}
+
+	envVars := make([]string, 0, len(opts.EnvVars))
+	for k, v := range opts.EnvVars {
+		envVars = append(envVars, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	containerConfig := &container.Config{
+		Image:      opts.ImageRef,
+		Env:        envVars,
+		Entrypoint: []string{"/bin/sh", "-c"},
+		Cmd:        []string{opts.Command},
+		Labels: map[string]string{
+			"stackyn.oneoff.app_id": opts.AppID,
+			"stackyn.oneoff.run_id": opts.RunID,
+		},
+	}
+	hostConfig := &container.HostConfig{
+		Resources: container.Resources{
+			Memory:     opts.Limits.MemoryMB * 1024 * 1024,
+			NanoCPUs:   int64(opts.Limits.CPU * 1e9),
+			MemorySwap: opts.Limits.MemoryMB * 1024 * 1024,
+		},
+		RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyDisabled},
+	}
+	s.applyIsolation(hostConfig, opts.Isolation)
+	networkConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			s.networkName: {},
+		},
+	}
+
+	createResp, err := s.client.ContainerCreate(ctx, containerConfig, hostConfig, networkConfig, nil, fmt.Sprintf("oneoff-%s", opts.RunID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container: %w", err)
+	}
+	containerID := createResp.ID
+	defer func() {
+		// Removal must happen even when ctx was cancelled by the timeout
+		removeCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := s.client.ContainerRemove(removeCtx, containerID, container.RemoveOptions{Force: true}); err != nil {
+			s.logger.Warn("Failed to remove one-off container", zap.Error(err), zap.String("container_id", containerID))
+		}
+	}()
+
+	s.logger.Info("Starting one-off container",
+		zap.String("app_id", opts.AppID),
+		zap.String("run_id", opts.RunID),
+		zap.String("container_id", containerID),
+		zap.String("image", opts.ImageRef),
+	)
+
+	waitCh, errCh := s.client.ContainerWait(ctx, containerID, container.WaitConditionNextExit)
+	if err := s.client.ContainerStart(ctx, containerID, container.StartOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to start container: %w", err)
+	}
+
+	// The followed log stream ends once the container exits, so its output is complete before it is removed
+	streamed := make(chan struct{})
+	if opts.Output != nil {
+		go func() {
+			defer close(streamed)
+			if err := s.followOutput(ctx, containerID, opts.Output); err != nil {
+				s.logger.Warn("Failed to stream one-off container output", zap.Error(err), zap.String("container_id", containerID))
+			}
+		}()
+	} else {
+		close(streamed)
+	}
+
+	result := &OneOffResult{}
+	timer := time.NewTimer(opts.Timeout)
+	defer timer.Stop()
+
+	select {
+	case status := <-waitCh:
+		result.ExitCode = int(status.StatusCode)
+		if status.Error != nil {
+			return nil, fmt.Errorf("failed waiting for container: %s", status.Error.Message)
+		}
+	case err := <-errCh:
+		return nil, fmt.Errorf("failed waiting for container: %w", err)
+	case <-timer.C:
+		result.TimedOut = true
+		result.ExitCode = -1
+		timeout := 10
+		if err := s.client.ContainerStop(ctx, containerID, container.StopOptions{Timeout: &timeout}); err != nil {
+			s.logger.Warn("Failed to stop timed out one-off container", zap.Error(err), zap.String("container_id", containerID))
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	<-streamed
+	output, err := s.collectOutput(ctx, containerID)
+	if err != nil {
+		s.logger.Warn("Failed to collect one-off container output", zap.Error(err), zap.String("container_id", containerID))
+	}
+	result.Output = output
+	return result, nil
+}
+
+// followOutput copies a running container's combined stdout and stderr to w until the container exits
+func (s *DeploymentService) followOutput(ctx context.Context, containerID string, w io.Writer) error {
+	reader, err := s.client.ContainerLogs(ctx, containerID, container.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: true})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	_, err = stdcopy.StdCopy(w, w, reader)
+	return err
+}
+
+// collectOutput reads a stopped container's combined stdout and stderr, keeping the last 64 KB
+func (s *DeploymentService) collectOutput(ctx context.Context, containerID string) (string, error) {
+	reader, err := s.client.ContainerLogs(ctx, containerID, container.LogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	out := &tailBuffer{max: maxOneOffOutputBytes}
+	if _, err := stdcopy.StdCopy(out, out, reader); err != nil {
+		return out.String(), err
+	}
+	return out.String(), nil
+}
+
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	max       int
+	buf       []byte
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > 2*b.max {
+		b.buf = append([]byte{}, b.buf[len(b.buf)-b.max:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	data := b.buf
+	if len(data) > b.max {
+		data = data[len(data)-b.max:]
+		b.truncated = true
+	}
+	if b.truncated {
+		return "[output truncated]\n" + string(data)
+	}
+	return string(data)
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types/image"
+	"go.uber.org/zap"
+)
+
+// DeploymentConfigSnapshot is the runtime configuration a deployment's container was started with
+// It is stored on the deployment next to the env snapshot so two deployments can be compared
+type DeploymentConfigSnapshot struct {
+	Port                       int      `json:"port"`
+	MemoryMB                   int64    `json:"memory_mb"`
+	CPU                        float64  `json:"cpu"`
+	HealthCheckPath            string   `json:"health_check_path"`
+	HealthCheckIntervalSeconds int      `json:"health_check_interval_seconds,omitempty"`
+	AutoRestart                bool     `json:"auto_restart"`
+	ZeroDowntime               bool     `json:"zero_downtime"`
+	DockerCompose              bool     `json:"docker_compose"`
+	RootDir                    string   `json:"root_dir,omitempty"`
+	CustomDomains              []string `json:"custom_domains,omitempty"`
+	WAFPreset                  string   `json:"waf_preset,omitempty"`
+	WAFMode                    string   `json:"waf_mode,omitempty"`
+	Isolation                  string   `json:"isolation,omitempty"`
+}
+
+// NewDeploymentConfigSnapshot captures the configuration of a deployment from its options
+func NewDeploymentConfigSnapshot(opts DeploymentOptions, rootDir string) DeploymentConfigSnapshot {
+	snapshot := DeploymentConfigSnapshot{
+		Port:                       opts.Port,
+		MemoryMB:                   opts.Limits.MemoryMB,
+		CPU:                        opts.Limits.CPU,
+		HealthCheckPath:            opts.HealthCheck.Path,
+		HealthCheckIntervalSeconds: int(opts.HealthCheck.Interval.Seconds()),
+		AutoRestart:                opts.HealthCheck.AutoRestart,
+		ZeroDowntime:               opts.ZeroDowntime,
+		DockerCompose:              opts.UseDockerCompose,
+		RootDir:                    rootDir,
+		CustomDomains:              opts.CustomDomains,
+		Isolation:                  string(opts.Isolation),
+	}
+	if opts.WAF != nil {
+		snapshot.WAFPreset = opts.WAF.Preset
+		snapshot.WAFMode = opts.WAF.Mode
+	}
+	return snapshot
+}
+
+// RemoveDeploymentImages removes the images of deployments pruned from the history
+// Images still used by a container are left alone. Returns the number removed and the space freed in MB
+func (s *CleanupService) RemoveDeploymentImages(ctx context.Context, imageNames []string) (int, int64) {
+	removed := 0
+	var totalSize int64
+	for _, name := range imageNames {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+
+		inspect, _, err := s.client.ImageInspectWithRaw(ctx, name)
+		if err != nil {
+			continue // Already gone (removed by hand or by an earlier cleanup)
+		}
+
+		if _, err := s.client.ImageRemove(ctx, name, image.RemoveOptions{
+			Force:         false,
+			PruneChildren: true,
+		}); err != nil {
+			s.logger.Warn("Failed to remove pruned deployment image",
+				zap.String("image", name),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		removed++
+		totalSize += inspect.Size
+	}
+	return removed, totalSize / (1024 * 1024)
+}
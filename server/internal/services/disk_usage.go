@@ -0,0 +1,26 @@
+package services
+
+// DiskUsage is the usage of the filesystem a path lives on, as df reports it
+type DiskUsage struct {
+	Volume         string // What cleanup keeps on it: work (clones, builds, logs) or docker (images, containers)
+	Path           string
+	TotalBytes     uint64
+	UsedBytes      uint64
+	AvailableBytes uint64  // Free space unprivileged processes may use
+	UsedPercent    float64 // Used / (used + available), so space reserved for root counts as full
+}
+
+// newDiskUsage computes usage from filesystem block counts
+func newDiskUsage(volume, path string, blockSize, blocks, free, available uint64) DiskUsage {
+	usage := DiskUsage{
+		Volume:         volume,
+		Path:           path,
+		TotalBytes:     blocks * blockSize,
+		UsedBytes:      (blocks - free) * blockSize,
+		AvailableBytes: available * blockSize,
+	}
+	if usable := usage.UsedBytes + usage.AvailableBytes; usable > 0 {
+		usage.UsedPercent = float64(usage.UsedBytes) / float64(usable) * 100
+	}
+	return usage
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package services
+
+import "fmt"
+
+// statDisk is not supported on this platform; cleanup then never enforces the disk usage limit
+func statDisk(volume, path string) (DiskUsage, error) {
+	return DiskUsage{}, fmt.Errorf("disk usage is not supported on this platform")
+}
@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd
+
+package services
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// statDisk measures the filesystem path lives on
+func statDisk(volume, path string) (DiskUsage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return DiskUsage{}, fmt.Errorf("statfs %s: %w", path, err)
+	}
+	return newDiskUsage(volume, path, uint64(stat.Bsize), uint64(stat.Blocks), uint64(stat.Bfree), uint64(stat.Bavail)), nil
+}
@@ -4,6 +4,7 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -45,22 +46,27 @@ func (s *DockerBuildService) Close() error {
 
 // BuildOptions represents options for building a Docker image
 type BuildOptions struct {
-	ContextPath string // Path to build context (repository)
-	ImageName   string // Name for the built image
-	Tag         string // Tag for the image (default: latest)
+	ContextPath string      // Path to build context (repository)
+	ImageName   string      // Name for the built image
+	Tag         string      // Tag for the image (default: latest)
+	PullParent  bool        // Pull the newest base image instead of using the one cached on the builder
+	Limits      BuildLimits // CPU, memory and time the build may use (the plan's build limits)
 }
 
 // BuildResult represents the result of a build operation
 type BuildResult struct {
-	ImageID   string
-	ImageName string
-	Logs      string
+	ImageID         string
+	ImageName       string
+	Logs            string
+	BaseImage       string // Base image of the final stage (see DockerfileBaseImage); empty when not tracked
+	BaseImageDigest string // Digest of the base image the build used
 }
 
 // BuildImage builds a Docker image with resource constraints
 func (s *DockerBuildService) BuildImage(ctx context.Context, opts BuildOptions, logWriter io.Writer) (*BuildResult, error) {
-	// Create context with timeout (15 minutes)
-	buildCtx, cancel := context.WithTimeout(ctx, 15*time.Minute)
+	// Create context with the plan's build timeout
+	limits := opts.Limits.withDefaults()
+	buildCtx, cancel := context.WithTimeout(ctx, limits.Timeout)
 	defer cancel()
 
 	// Prepare image tag
@@ -74,6 +80,9 @@ func (s *DockerBuildService) BuildImage(ctx context.Context, opts BuildOptions,
 	s.logger.Info("Building Docker image",
 		zap.String("context_path", opts.ContextPath),
 		zap.String("image_tag", imageTag),
+		zap.Int64("cpu_shares", limits.CPUShares),
+		zap.Int("memory_mb", limits.MemoryMB),
+		zap.Duration("timeout", limits.Timeout),
 	)
 
 	// Create tar archive of build context
@@ -83,25 +92,49 @@ func (s *DockerBuildService) BuildImage(ctx context.Context, opts BuildOptions,
 	}
 	defer tarReader.Close()
 
-	// Build image with resource constraints via build args
+	// Build image with the plan's resource constraints
+	buildID := strings.NewReplacer(":", "-", "/", "-").Replace(imageTag)
 	buildOptions := types.ImageBuildOptions{
+		BuildID:    buildID, // Lets a cancelled build be stopped on the daemon
 		Dockerfile: "Dockerfile",
 		Tags:       []string{imageTag},
 		Remove:     true, // Remove intermediate containers
-		PullParent: false,
+		PullParent: opts.PullParent,
 		BuildArgs: map[string]*string{
 			"BUILDKIT_INLINE_CACHE": stringPtr("1"),
 		},
-		// Note: Resource constraints are typically set at container runtime
-		// For build-time constraints, we rely on Docker daemon limits
+		// Applied to every RUN step's container, so a runaway step cannot starve the host
+		CPUShares:  limits.CPUShares,
+		Memory:     limits.memoryBytes(),
+		MemorySwap: limits.memoryBytes(), // No swap beyond the memory limit
 	}
 
+	// A cancelled task (POST /api/v1/deployments/{id}/cancel) stops the build on the daemon too -
+	// closing the connection only stops the classic builder, BuildKit needs an explicit cancel
+	stopCancelWatch := context.AfterFunc(ctx, func() {
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			return
+		}
+		cancelCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		// The classic builder has no session to cancel, so an error here is expected for it
+		if err := s.client.BuildCancel(cancelCtx, buildID); err != nil {
+			s.logger.Debug("Docker build cancel request failed", zap.Error(err), zap.String("build_id", buildID))
+			return
+		}
+		s.logger.Info("Cancelled Docker build", zap.String("image_tag", imageTag))
+	})
+	defer stopCancelWatch()
+
 	// Build the image
 	buildResponse, err := s.client.ImageBuild(buildCtx, tarReader, buildOptions)
 	if err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return nil, fmt.Errorf("image build cancelled: %w", ctx.Err())
+		}
 		// Check if error is due to timeout
 		if buildCtx.Err() == context.DeadlineExceeded {
-			return nil, fmt.Errorf("MVP constraint violation: build time exceeded maximum allowed time of 15 minutes. Please optimize your build process")
+			return nil, buildTimeoutError(limits.Timeout)
 		}
 		return nil, fmt.Errorf("failed to start image build: %w", err)
 	}
@@ -112,9 +145,22 @@ func (s *DockerBuildService) BuildImage(ctx context.Context, opts BuildOptions,
 	multiWriter := io.MultiWriter(logWriter, &buildLogs)
 
 	if err := s.streamBuildLogs(buildResponse.Body, multiWriter); err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return nil, fmt.Errorf("image build cancelled: %w", ctx.Err())
+		}
+		if buildCtx.Err() == context.DeadlineExceeded {
+			fmt.Fprintf(multiWriter, "ERROR: Build timed out after %s\n", formatBuildTimeout(limits.Timeout))
+			return nil, buildTimeoutError(limits.Timeout)
+		}
 		return nil, fmt.Errorf("failed to stream build logs: %w", err)
 	}
 
+	// The daemon may end the stream cleanly when the deadline stops the build
+	if buildCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		fmt.Fprintf(multiWriter, "ERROR: Build timed out after %s\n", formatBuildTimeout(limits.Timeout))
+		return nil, buildTimeoutError(limits.Timeout)
+	}
+
 	// Inspect the built image to get image ID
 	imageInspect, _, err := s.client.ImageInspectWithRaw(buildCtx, imageTag)
 	if err != nil {
@@ -126,11 +172,21 @@ func (s *DockerBuildService) BuildImage(ctx context.Context, opts BuildOptions,
 		zap.String("image_tag", imageTag),
 	)
 
-	return &BuildResult{
+	result := &BuildResult{
 		ImageID:   imageInspect.ID,
 		ImageName: imageTag,
 		Logs:      buildLogs.String(),
-	}, nil
+	}
+
+	// Remember which base image the build used, so its upstream updates can be detected
+	if baseImage, err := DockerfileBaseImage(opts.ContextPath); err != nil {
+		s.logger.Warn("Failed to read base image from Dockerfile", zap.Error(err), zap.String("image_tag", imageTag))
+	} else if baseImage != "" {
+		result.BaseImage = baseImage
+		result.BaseImageDigest = s.localImageDigest(buildCtx, baseImage)
+	}
+
+	return result, nil
 }
 
 // streamBuildLogs streams build logs from Docker build response
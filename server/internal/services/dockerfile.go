@@ -1,9 +1,11 @@
 package services
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"go.uber.org/zap"
@@ -42,13 +44,28 @@ func (g *DockerfileGenerator) GenerateDockerfile(repoPath string, runtime Runtim
 		content = g.generateGoDockerfile()
 	case RuntimeJava:
 		content = g.generateJavaDockerfile()
-	case RuntimeRuby, RuntimePHP, RuntimeStatic:
-		// These runtimes are not supported by Paketo Buildpacks
-		return fmt.Errorf("runtime '%s' is not supported by Paketo Buildpacks. Supported runtimes: Node.js, Python, Go, Java", runtime)
+	case RuntimeRuby:
+		content = g.generateRubyDockerfile(repoPath)
+	case RuntimePHP:
+		content = g.generatePHPDockerfile(repoPath)
+	case RuntimeRust:
+		content = g.generateRustDockerfile(repoPath)
+	case RuntimeElixir:
+		content = g.generateElixirDockerfile(repoPath)
+	case RuntimeDeno:
+		content = g.generateDenoDockerfile(repoPath)
+	case RuntimeBun:
+		content = g.generateBunDockerfile(repoPath)
+	case RuntimeStatic:
+		content = g.generateStaticDockerfile(repoPath)
 	case RuntimeUnknown:
-		return fmt.Errorf("could not detect runtime. Supported runtimes: Node.js, Python, Go, Java")
+		return fmt.Errorf("could not detect runtime. Supported runtimes: Node.js, Python, Go, Java, Ruby, PHP, Rust, Elixir, Deno, Bun, static sites")
 	default:
-		return fmt.Errorf("unsupported runtime: %s. Supported runtimes: Node.js, Python, Go, Java", runtime)
+		return fmt.Errorf("unsupported runtime: %s. Supported runtimes: Node.js, Python, Go, Java, Ruby, PHP, Rust, Elixir, Deno, Bun, static sites", runtime)
+	}
+
+	if err := ValidateGeneratedDockerfile(content); err != nil {
+		return fmt.Errorf("invalid generated Dockerfile for runtime %s: %w", runtime, err)
 	}
 
 	// Write Dockerfile
@@ -787,17 +804,474 @@ CMD ["/bin/sh", "/cnb/process/web-wrapper"]
 `
 }
 
+// generateRubyDockerfile generates a Dockerfile for Ruby (Rails or any Rack app)
+// Apps with puma in their bundle are served by puma bound to $PORT; otherwise Rails apps use
+// `rails server` and plain Rack apps use rackup. The Ruby version follows .ruby-version when present
+func (g *DockerfileGenerator) generateRubyDockerfile(repoPath string) string {
+	rubyVersion := "3.3"
+	if content := readRepoFile(repoPath, ".ruby-version"); content != "" {
+		if match := rubyVersionPattern.FindString(content); match != "" {
+			rubyVersion = match
+		}
+	}
+
+	gemfile := readRepoFile(repoPath, "Gemfile") + readRepoFile(repoPath, "Gemfile.lock")
+	isRails := fileExistsIn(repoPath, "bin/rails") || fileExistsIn(repoPath, "config/application.rb")
+	hasPuma := strings.Contains(gemfile, "puma")
+
+	var startCommand string
+	switch {
+	case hasPuma:
+		// -b overrides any bind/port in config/puma.rb, which puma still loads for threads and workers
+		startCommand = "bundle exec puma -b tcp://0.0.0.0:${PORT:-8080} -e ${RACK_ENV:-production}"
+	case isRails:
+		startCommand = "rm -f tmp/pids/server.pid && bundle exec rails server -b 0.0.0.0 -p ${PORT:-8080}"
+	default:
+		startCommand = "bundle exec rackup --host 0.0.0.0 --port ${PORT:-8080}"
+	}
+
+	assetsStep := ""
+	if isRails {
+		assetsStep = `
+# Precompile Rails assets (apps without an asset pipeline skip this)
+RUN if bundle exec rails -T 2>/dev/null | grep -q "assets:precompile"; then \
+      SECRET_KEY_BASE_DUMMY=1 bundle exec rails assets:precompile; \
+    fi
+`
+	}
+
+	return strings.NewReplacer(
+		"{{RUBY_VERSION}}", rubyVersion,
+		"{{ASSETS_STEP}}", assetsStep,
+		"{{START_COMMAND}}", startCommand,
+	).Replace(`# syntax=docker/dockerfile:1
+# Ruby (Rails / Rack) image served on $PORT
+
+FROM ruby:{{RUBY_VERSION}}-slim
+
+# Build tools and client libraries for common native gems (pg, mysql2, sqlite3, psych)
+# Install wget for Docker health checks
+RUN apt-get update && apt-get install -y --no-install-recommends \
+    build-essential git pkg-config libpq-dev default-libmysqlclient-dev libsqlite3-dev libyaml-dev wget \
+    && rm -rf /var/lib/apt/lists/*
+
+WORKDIR /app
+
+ENV RACK_ENV=production \
+    RAILS_ENV=production \
+    RAILS_LOG_TO_STDOUT=1 \
+    RAILS_SERVE_STATIC_FILES=1 \
+    BUNDLE_WITHOUT=development:test \
+    PORT=8080
+
+# Install gems before copying the source so they are cached between builds
+COPY Gemfile* ./
+RUN bundle install --jobs 4 --retry 3
+
+COPY . .
+{{ASSETS_STEP}}
+# The platform sets PORT=8080 at runtime
+EXPOSE 8080
+
+CMD ["/bin/sh", "-c", "{{START_COMMAND}}"]
+`)
+}
+
+// generatePHPDockerfile generates a Dockerfile for PHP served by PHP-FPM behind nginx on $PORT
+// The document root is public/ (Laravel, Symfony, Slim) or web/ when they hold the front controller,
+// otherwise the repository root
+func (g *DockerfileGenerator) generatePHPDockerfile(repoPath string) string {
+	documentRoot := "/var/www/html"
+	for _, dir := range []string{"public", "web"} {
+		if fileExistsIn(repoPath, filepath.Join(dir, "index.php")) {
+			documentRoot = "/var/www/html/" + dir
+			break
+		}
+	}
+
+	return strings.NewReplacer(
+		"{{DOCUMENT_ROOT}}", documentRoot,
+	).Replace(`# syntax=docker/dockerfile:1
+# PHP image: PHP-FPM behind nginx, served on $PORT
+
+FROM composer:2 AS composer
+
+FROM php:8.3-fpm
+
+# nginx, envsubst (gettext-base) for the listen port, and common extensions
+# Install wget for Docker health checks
+RUN apt-get update && apt-get install -y --no-install-recommends \
+    nginx gettext-base wget git unzip libzip-dev libpq-dev libicu-dev \
+    && docker-php-ext-install pdo_mysql pdo_pgsql zip intl opcache \
+    && rm -rf /var/lib/apt/lists/* \
+    && rm -f /etc/nginx/sites-enabled/default \
+    && ln -sf /dev/stdout /var/log/nginx/access.log \
+    && ln -sf /dev/stderr /var/log/nginx/error.log
+
+COPY --from=composer /usr/bin/composer /usr/bin/composer
+
+WORKDIR /var/www/html
+
+ENV APP_ENV=production \
+    COMPOSER_ALLOW_SUPERUSER=1 \
+    PORT=8080
+
+# Install dependencies before copying the source so they are cached between builds
+COPY composer.json composer.lock* ./
+RUN composer install --no-dev --no-scripts --no-autoloader --prefer-dist --no-interaction
+
+COPY . .
+RUN composer dump-autoload --optimize --no-dev --no-interaction \
+    && chown -R www-data:www-data /var/www/html
+
+# nginx site listening on ${PORT} (filled in by envsubst at startup), passing PHP to FPM on 9000
+RUN printf '%s\n' \
+    'server {' \
+    '    listen ${PORT};' \
+    '    root {{DOCUMENT_ROOT}};' \
+    '    index index.php index.html;' \
+    '    client_max_body_size 32m;' \
+    '    location / {' \
+    '        try_files $uri $uri/ /index.php?$query_string;' \
+    '    }' \
+    '    location ~ \.php$ {' \
+    '        fastcgi_pass 127.0.0.1:9000;' \
+    '        fastcgi_index index.php;' \
+    '        include fastcgi_params;' \
+    '        fastcgi_param SCRIPT_FILENAME $document_root$fastcgi_script_name;' \
+    '    }' \
+    '    location ~ /\.(?!well-known) {' \
+    '        deny all;' \
+    '    }' \
+    '}' > /etc/nginx/conf.d/stackyn.conf.template
+
+# The platform sets PORT=8080 at runtime
+EXPOSE 8080
+
+CMD ["/bin/sh", "-c", "envsubst '${PORT}' < /etc/nginx/conf.d/stackyn.conf.template > /etc/nginx/conf.d/default.conf && php-fpm -D && exec nginx -g 'daemon off;'"]
+`)
+}
+
+// generateRustDockerfile generates a multi-stage Dockerfile for Rust: a release build with cargo, run from
+// a slim Debian image. The binary is the package's (or its first [[bin]] target's) name; workspaces without
+// a root package ship the first executable cargo produces
+func (g *DockerfileGenerator) generateRustDockerfile(repoPath string) string {
+	copyBinary := "cp \"$(find target/release -maxdepth 1 -type f -perm -u+x | head -n 1)\" /app/server"
+	if name := cargoBinaryName(readRepoFile(repoPath, "Cargo.toml")); name != "" {
+		copyBinary = "cp target/release/" + name + " /app/server"
+	}
+
+	return strings.NewReplacer(
+		"{{COPY_BINARY}}", copyBinary,
+	).Replace(`# syntax=docker/dockerfile:1
+# Rust image: cargo release build, served on $PORT
+
+FROM rust:1-slim-bookworm AS build
+
+# OpenSSL headers for crates linking native TLS
+RUN apt-get update && apt-get install -y --no-install-recommends pkg-config libssl-dev \
+    && rm -rf /var/lib/apt/lists/*
+
+WORKDIR /app
+
+COPY . .
+RUN cargo build --release && {{COPY_BINARY}}
+
+FROM debian:bookworm-slim
+
+# Install wget for Docker health checks
+RUN apt-get update && apt-get install -y --no-install-recommends ca-certificates libssl3 wget \
+    && rm -rf /var/lib/apt/lists/*
+
+WORKDIR /app
+
+COPY --from=build /app/server /usr/local/bin/server
+
+ENV PORT=8080
+
+# The platform sets PORT=8080 at runtime
+EXPOSE 8080
+
+# Rocket reads its own port variables; other frameworks read PORT
+CMD ["/bin/sh", "-c", "ROCKET_ADDRESS=0.0.0.0 ROCKET_PORT=${PORT:-8080} exec /usr/local/bin/server"]
+`)
+}
+
+// generateElixirDockerfile generates a multi-stage Dockerfile for Elixir building a `mix release`
+// Phoenix apps get their assets deployed and PHX_SERVER set, so the release starts the endpoint on $PORT
+// (config/runtime.exs reads PORT, as generated by `mix phx.new`)
+func (g *DockerfileGenerator) generateElixirDockerfile(repoPath string) string {
+	mixfile := readRepoFile(repoPath, "mix.exs")
+
+	// Releases are named after the app; `bin/` may also hold scripts like migrate and server
+	release := "/app/release/bin/$(ls /app/release/bin | grep -v '\\\\.bat$' | head -n 1)"
+	if match := mixAppPattern.FindStringSubmatch(mixfile); match != nil {
+		release = "/app/release/bin/" + match[1]
+	}
+
+	assetsStep := ""
+	if strings.Contains(mixfile, "assets.deploy") {
+		assetsStep = `
+# Build and digest Phoenix assets
+RUN mix assets.deploy
+`
+	}
+
+	return strings.NewReplacer(
+		"{{ASSETS_STEP}}", assetsStep,
+		"{{RELEASE}}", release,
+	).Replace(`# syntax=docker/dockerfile:1
+# Elixir image: mix release, served on $PORT
+
+FROM elixir:1.17-slim AS build
+
+RUN apt-get update && apt-get install -y --no-install-recommends build-essential git \
+    && rm -rf /var/lib/apt/lists/*
+
+WORKDIR /app
+
+ENV MIX_ENV=prod
+
+RUN mix local.hex --force && mix local.rebar --force
+
+# Fetch dependencies before copying the source so they are cached between builds
+COPY mix.exs mix.lock* ./
+RUN mix deps.get --only prod
+
+COPY . .
+RUN mix compile
+{{ASSETS_STEP}}
+RUN mix release && mv _build/prod/rel/$(ls _build/prod/rel | head -n 1) /app/release
+
+FROM debian:bookworm-slim
+
+# Runtime libraries of the Erlang VM
+# Install wget for Docker health checks
+RUN apt-get update && apt-get install -y --no-install-recommends \
+    libstdc++6 openssl libncurses6 locales ca-certificates wget \
+    && rm -rf /var/lib/apt/lists/*
+
+WORKDIR /app
+
+COPY --from=build /app/release /app/release
+
+ENV LANG=C.UTF-8 \
+    MIX_ENV=prod \
+    PHX_SERVER=true \
+    PORT=8080
+
+# The platform sets PORT=8080 at runtime
+EXPOSE 8080
+
+CMD ["/bin/sh", "-c", "PORT=${PORT:-8080} exec {{RELEASE}} start"]
+`)
+}
+
+// generateDenoDockerfile generates a Dockerfile for Deno
+// The deno.json "start" task runs the app when there is one; otherwise the first conventional entrypoint
+// (main.ts, server.ts, ...) runs with network, env and read permissions
+func (g *DockerfileGenerator) generateDenoDockerfile(repoPath string) string {
+	config := readRepoFile(repoPath, "deno.json") + readRepoFile(repoPath, "deno.jsonc")
+
+	startCommand := "deno task start"
+	cacheStep := "RUN deno install || true"
+	if !denoStartTaskPattern.MatchString(config) {
+		entry := "main.ts"
+		for _, name := range []string{"main.ts", "main.js", "server.ts", "server.js", "mod.ts", "index.ts", "index.js", "src/main.ts"} {
+			if fileExistsIn(repoPath, name) {
+				entry = name
+				break
+			}
+		}
+		startCommand = "deno run --allow-net --allow-env --allow-read " + entry
+		cacheStep = "RUN deno cache " + entry
+	}
+
+	return strings.NewReplacer(
+		"{{CACHE_STEP}}", cacheStep,
+		"{{START_COMMAND}}", startCommand,
+	).Replace(`# syntax=docker/dockerfile:1
+# Deno image served on $PORT
+
+FROM denoland/deno:debian
+
+# Install wget for Docker health checks
+RUN apt-get update && apt-get install -y --no-install-recommends wget \
+    && rm -rf /var/lib/apt/lists/*
+
+WORKDIR /app
+
+COPY . .
+
+# Download and cache remote and npm modules at build time
+{{CACHE_STEP}}
+
+ENV PORT=8080
+
+# The platform sets PORT=8080 at runtime
+EXPOSE 8080
+
+# The app reads Deno.env.get("PORT")
+CMD ["/bin/sh", "-c", "PORT=${PORT:-8080} exec {{START_COMMAND}}"]
+`)
+}
+
+// generateBunDockerfile generates a Dockerfile for Bun
+// The package.json start script runs the app when there is one, otherwise its main/module file or a
+// conventional entrypoint; a build script runs at image build time
+func (g *DockerfileGenerator) generateBunDockerfile(repoPath string) string {
+	var pkg packageJSON
+	if data := readRepoFile(repoPath, "package.json"); data != "" {
+		_ = json.Unmarshal([]byte(data), &pkg)
+	}
+
+	var startCommand string
+	switch {
+	case pkg.Scripts["start"] != "":
+		startCommand = "bun run start"
+	case pkg.Module != "":
+		startCommand = "bun run " + pkg.Module
+	case pkg.Main != "":
+		startCommand = "bun run " + pkg.Main
+	default:
+		entry := "index.ts"
+		for _, name := range []string{"index.ts", "index.js", "src/index.ts", "server.ts", "src/server.ts"} {
+			if fileExistsIn(repoPath, name) {
+				entry = name
+				break
+			}
+		}
+		startCommand = "bun run " + entry
+	}
+
+	buildStep := ""
+	if pkg.Scripts["build"] != "" {
+		buildStep = "\nRUN bun run build\n"
+	}
+
+	return strings.NewReplacer(
+		"{{BUILD_STEP}}", buildStep,
+		"{{START_COMMAND}}", startCommand,
+	).Replace(`# syntax=docker/dockerfile:1
+# Bun image served on $PORT
+
+FROM oven/bun:1
+
+# Install wget for Docker health checks
+RUN apt-get update && apt-get install -y --no-install-recommends wget \
+    && rm -rf /var/lib/apt/lists/*
+
+WORKDIR /app
+
+# Install dependencies before copying the source so they are cached between builds
+COPY package.json bun.lockb* bun.lock* ./
+RUN bun install --frozen-lockfile
+
+COPY . .
+{{BUILD_STEP}}
+ENV NODE_ENV=production \
+    PORT=8080
+
+# The platform sets PORT=8080 at runtime
+EXPOSE 8080
+
+# The app reads Bun.env.PORT (or process.env.PORT)
+CMD ["/bin/sh", "-c", "PORT=${PORT:-8080} exec {{START_COMMAND}}"]
+`)
+}
+
+// ValidateGeneratedDockerfile checks that a generated Dockerfile will answer on the platform port
+// Deploys route to container port 8080 and set PORT=8080, so the image must expose that port
+// and its start command must either bind $PORT or forward 8080 to the app
+func ValidateGeneratedDockerfile(content string) error {
+	var exposes, starts, bindsPort bool
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		upper := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(upper, "EXPOSE "):
+			exposes = strings.Contains(line, "8080") || strings.Contains(line, "PORT")
+		case strings.HasPrefix(upper, "CMD ") || strings.HasPrefix(upper, "ENTRYPOINT "):
+			starts = true
+			bindsPort = bindsPort || strings.Contains(line, "PORT") || strings.Contains(line, "8080") || strings.Contains(line, "web-wrapper")
+		}
+	}
+
+	if !exposes {
+		return fmt.Errorf("generated Dockerfile does not expose port 8080")
+	}
+	if !starts {
+		return fmt.Errorf("generated Dockerfile has no CMD or ENTRYPOINT")
+	}
+	if !bindsPort {
+		return fmt.Errorf("generated Dockerfile's start command does not listen on $PORT")
+	}
+	return nil
+}
+
+// rubyVersionPattern extracts major.minor from .ruby-version ("3.2.2", "ruby-3.2.2")
+var rubyVersionPattern = regexp.MustCompile(`\d+\.\d+`)
+
+// mixAppPattern extracts the OTP app name from mix.exs (`app: :my_app`)
+var mixAppPattern = regexp.MustCompile(`app:\s*:(\w+)`)
+
+// denoStartTaskPattern matches a "start" task in deno.json
+var denoStartTaskPattern = regexp.MustCompile(`"tasks"\s*:\s*\{[^}]*"start"\s*:`)
+
+// cargoBinaryName returns the binary a Cargo.toml builds: its first [[bin]] name, else its [package] name
+// Empty for workspace manifests without a root package
+func cargoBinaryName(manifest string) string {
+	var section, packageName string
+	for _, line := range strings.Split(manifest, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			section = line
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) != "name" {
+			continue
+		}
+		name := strings.Trim(strings.TrimSpace(value), `"'`)
+		switch section {
+		case "[[bin]]":
+			return name
+		case "[package]":
+			if packageName == "" {
+				packageName = name
+			}
+		}
+	}
+	return packageName
+}
+
+// readRepoFile returns a repository file's normalized contents, or "" if it cannot be read
+func readRepoFile(repoPath, name string) string {
+	content, err := readTextFile(filepath.Join(repoPath, name))
+	if err != nil {
+		return ""
+	}
+	return content
+}
+
+// fileExistsIn reports whether a regular file exists at name inside the repository
+func fileExistsIn(repoPath, name string) bool {
+	info, err := os.Stat(filepath.Join(repoPath, name))
+	return err == nil && !info.IsDir()
+}
+
 // enhanceExistingDockerfile enhances a user-provided Dockerfile for Stackyn compatibility
 func (g *DockerfileGenerator) enhanceExistingDockerfile(dockerfilePath string, runtime Runtime) error {
 	// Read the existing Dockerfile
+	// Line-based edits below assume LF endings - a CRLF or BOM-prefixed Dockerfile is rewritten normalized
 	content, err := os.ReadFile(dockerfilePath)
 	if err != nil {
 		return fmt.Errorf("failed to read Dockerfile: %w", err)
 	}
 
-	originalContent := string(content)
+	originalContent := NormalizeText(content)
 	enhanced := originalContent
-	modified := false
+	modified := originalContent != string(content)
 
 	// 1. Add wget and socat to apt-get install commands (for health checks and port forwarding)
 	needsWget := strings.Contains(enhanced, "apt-get install") && !strings.Contains(enhanced, "wget")
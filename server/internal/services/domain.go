@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DomainVerificationPrefix is the DNS label that holds the ownership TXT record
+	// e.g. _stackyn-challenge.www.example.com TXT "stackyn-verification=<token>"
+	DomainVerificationPrefix = "_stackyn-challenge"
+
+	// domainVerificationValuePrefix prefixes the token in the TXT record value
+	domainVerificationValuePrefix = "stackyn-verification="
+)
+
+// hostnameRegex validates a fully-qualified hostname (at least one dot, no wildcard)
+var hostnameRegex = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// DomainVerificationService verifies ownership of custom domains via DNS
+type DomainVerificationService struct {
+	logger     *zap.Logger
+	resolver   *net.Resolver
+	baseDomain string // Platform base domain (e.g., "stackyn.com") - custom domains may not use it
+}
+
+// NewDomainVerificationService creates a new domain verification service
+func NewDomainVerificationService(logger *zap.Logger, baseDomain string) *DomainVerificationService {
+	return &DomainVerificationService{
+		logger:     logger,
+		resolver:   net.DefaultResolver,
+		baseDomain: strings.ToLower(strings.TrimSuffix(baseDomain, ".")),
+	}
+}
+
+// NormalizeDomain lowercases and validates a custom domain
+// Rejects hostnames under the platform base domain so users can't claim other apps' subdomains
+func (s *DomainVerificationService) NormalizeDomain(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimSuffix(domain, ".")
+
+	if len(domain) > 253 || !hostnameRegex.MatchString(domain) {
+		return "", fmt.Errorf("invalid domain: %q", domain)
+	}
+
+	if s.baseDomain != "" && (domain == s.baseDomain || strings.HasSuffix(domain, "."+s.baseDomain)) {
+		return "", fmt.Errorf("domains under %s cannot be added as custom domains", s.baseDomain)
+	}
+
+	return domain, nil
+}
+
+// GenerateVerificationToken generates a random token for the TXT ownership record
+func (s *DomainVerificationService) GenerateVerificationToken() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// VerificationRecord returns the TXT record name and value the user must create
+func (s *DomainVerificationService) VerificationRecord(domain, token string) (name, value string) {
+	return fmt.Sprintf("%s.%s", DomainVerificationPrefix, domain), domainVerificationValuePrefix + token
+}
+
+// VerifyDomain checks DNS for proof of ownership
+// Accepts either the TXT challenge record or a CNAME pointing at the app's platform hostname
+// Returns the method that succeeded ("txt" or "cname")
+func (s *DomainVerificationService) VerifyDomain(ctx context.Context, domain, token, cnameTarget string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	// Method 1: TXT record
+	recordName, expected := s.VerificationRecord(domain, token)
+	txtRecords, txtErr := s.resolver.LookupTXT(ctx, recordName)
+	if txtErr == nil {
+		for _, record := range txtRecords {
+			if strings.TrimSpace(record) == expected {
+				s.logger.Info("Custom domain verified via TXT record",
+					zap.String("domain", domain),
+					zap.String("record", recordName),
+				)
+				return "txt", nil
+			}
+		}
+	}
+
+	// Method 2: CNAME to the app's platform hostname
+	if cnameTarget != "" {
+		cname, cnameErr := s.resolver.LookupCNAME(ctx, domain)
+		if cnameErr == nil && strings.EqualFold(strings.TrimSuffix(cname, "."), strings.TrimSuffix(cnameTarget, ".")) {
+			s.logger.Info("Custom domain verified via CNAME record",
+				zap.String("domain", domain),
+				zap.String("cname", cname),
+			)
+			return "cname", nil
+		}
+	}
+
+	s.logger.Info("Custom domain verification failed",
+		zap.String("domain", domain),
+		zap.String("txt_record", recordName),
+		zap.String("cname_target", cnameTarget),
+		zap.Error(txtErr),
+	)
+
+	return "", fmt.Errorf("no TXT record %s with value %q and no CNAME to %s found", recordName, expected, cnameTarget)
+}
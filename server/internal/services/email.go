@@ -10,12 +10,19 @@ import (
 	"go.uber.org/zap"
 )
 
+// EmailService sends transactional emails through Resend, falling back to SMTP when Resend fails
+// Every email is rendered from the template registry in the recipient's locale. With a queue set
+// (SetQueue), emails are recorded in the email log and delivered by a worker with retries
 type EmailService struct {
 	logger    *zap.Logger
 	apiKey    string
 	fromEmail string
 	baseURL   string
 	client    *http.Client
+	templates *EmailTemplateRegistry
+	smtp      *smtpSender        // Optional: fallback provider
+	emailLog  EmailLogRepository // Optional: with enqueuer, makes delivery durable
+	enqueuer  EmailEnqueuer
 }
 
 type ResendEmailRequest struct {
@@ -23,6 +30,7 @@ type ResendEmailRequest struct {
 	To      []string `json:"to"`
 	Subject string   `json:"subject"`
 	HTML    string   `json:"html"`
+	Text    string   `json:"text,omitempty"`
 }
 
 type ResendEmailResponse struct {
@@ -35,6 +43,11 @@ type ResendErrorResponse struct {
 
 // NewEmailService creates a new email service using Resend API
 func NewEmailService(logger *zap.Logger, apiKey, fromEmail string) *EmailService {
+	templates, err := NewEmailTemplateRegistry()
+	if err != nil {
+		// Sends fail with this error until the templates are fixed
+		logger.Error("Failed to load email templates", zap.Error(err))
+	}
 	return &EmailService{
 		logger:    logger,
 		apiKey:    apiKey,
@@ -43,91 +56,85 @@ func NewEmailService(logger *zap.Logger, apiKey, fromEmail string) *EmailService
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		templates: templates,
 	}
 }
 
 // SendOTPEmail sends an OTP email to the user
-func (s *EmailService) SendOTPEmail(email, otp string) error {
-	subject := "Your Stackyn Verification Code"
-	htmlBody := fmt.Sprintf(`
-		<!DOCTYPE html>
-		<html>
-		<head>
-			<meta charset="utf-8">
-			<meta name="viewport" content="width=device-width, initial-scale=1.0">
-		</head>
-		<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
-			<div style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); padding: 30px; text-align: center; border-radius: 10px 10px 0 0;">
-				<h1 style="color: white; margin: 0; font-size: 28px;">Stackyn</h1>
-			</div>
-			<div style="background: #ffffff; padding: 40px; border: 1px solid #e0e0e0; border-top: none; border-radius: 0 0 10px 10px;">
-				<h2 style="color: #333; margin-top: 0;">Verify Your Email</h2>
-				<p style="color: #666; font-size: 16px;">Your verification code is:</p>
-				<div style="background: #f5f5f5; border: 2px dashed #667eea; border-radius: 8px; padding: 20px; text-align: center; margin: 30px 0;">
-					<code style="font-size: 32px; font-weight: bold; letter-spacing: 8px; color: #667eea; font-family: 'Courier New', monospace;">%s</code>
-				</div>
-				<p style="color: #666; font-size: 14px;">This code will expire in 10 minutes.</p>
-				<p style="color: #999; font-size: 12px; margin-top: 30px; border-top: 1px solid #e0e0e0; padding-top: 20px;">If you didn't request this code, you can safely ignore this email.</p>
-			</div>
-		</body>
-		</html>
-	`, otp)
-
-	return s.sendEmail(email, subject, htmlBody)
+func (s *EmailService) SendOTPEmail(email, locale, otp string) error {
+	return s.send(email, EmailOTP, locale, OTPEmailData{OTP: otp})
 }
 
 // SendPasswordResetOTPEmail sends a password reset OTP email to the user
-func (s *EmailService) SendPasswordResetOTPEmail(email, otp string) error {
-	subject := "Reset Your Stackyn Password"
-	htmlBody := fmt.Sprintf(`
-		<!DOCTYPE html>
-		<html>
-		<head>
-			<meta charset="utf-8">
-			<meta name="viewport" content="width=device-width, initial-scale=1.0">
-		</head>
-		<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
-			<div style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); padding: 30px; text-align: center; border-radius: 10px 10px 0 0;">
-				<h1 style="color: white; margin: 0; font-size: 28px;">Stackyn</h1>
-			</div>
-			<div style="background: #ffffff; padding: 40px; border: 1px solid #e0e0e0; border-top: none; border-radius: 0 0 10px 10px;">
-				<h2 style="color: #333; margin-top: 0;">Reset Your Password</h2>
-				<p style="color: #666; font-size: 16px;">You requested to reset your password. Use the following code to verify your identity:</p>
-				<div style="background: #f5f5f5; border: 2px dashed #667eea; border-radius: 8px; padding: 20px; text-align: center; margin: 30px 0;">
-					<code style="font-size: 32px; font-weight: bold; letter-spacing: 8px; color: #667eea; font-family: 'Courier New', monospace;">%s</code>
-				</div>
-				<p style="color: #666; font-size: 14px;">This code will expire in 10 minutes.</p>
-				<p style="color: #999; font-size: 12px; margin-top: 30px; border-top: 1px solid #e0e0e0; padding-top: 20px;">If you didn't request a password reset, you can safely ignore this email. Your password will remain unchanged.</p>
-			</div>
-		</body>
-		</html>
-	`, otp)
-
-	return s.sendEmail(email, subject, htmlBody)
+func (s *EmailService) SendPasswordResetOTPEmail(email, locale, otp string) error {
+	return s.send(email, EmailPasswordReset, locale, OTPEmailData{OTP: otp})
 }
 
-// sendEmail sends an email using Resend API
-func (s *EmailService) sendEmail(to, subject, htmlBody string) error {
+// send renders a message in the recipient's locale and sends it
+// data is the message's data struct (see emailMessageData)
+func (s *EmailService) send(to, message, locale string, data interface{}) error {
+	return s.sendOnce("", to, message, locale, data)
+}
+
+// sendOnce is send for emails that must go out at most once per idempotencyKey (empty = no limit)
+// The key is only honoured with a queue, whose email log remembers what was sent
+func (s *EmailService) sendOnce(idempotencyKey, to, message, locale string, data interface{}) error {
+	if s.templates == nil {
+		return fmt.Errorf("email templates not loaded")
+	}
+	email, err := s.templates.Render(message, locale, data)
+	if err != nil {
+		return err
+	}
+	if s.emailLog != nil && s.enqueuer != nil {
+		return s.queueEmail(idempotencyKey, to, email)
+	}
+	_, _, err = s.deliver(to, email)
+	return err
+}
+
+// deliver sends an email through Resend, then through the SMTP fallback if Resend fails
+// Returns the provider that took the email and its message ID (Resend only)
+func (s *EmailService) deliver(to string, email *RenderedEmail) (provider, messageID string, err error) {
+	messageID, err = s.sendResend(to, email)
+	if err == nil {
+		return "resend", messageID, nil
+	}
+	if s.smtp == nil {
+		return "", "", err
+	}
+
+	s.logger.Warn("Resend delivery failed - falling back to SMTP", zap.Error(err), zap.String("to", to))
+	if smtpErr := s.smtp.send(s.fromEmail, to, email); smtpErr != nil {
+		return "", "", fmt.Errorf("%v; smtp fallback: %w", err, smtpErr)
+	}
+	s.logger.Info("Email sent through SMTP fallback", zap.String("to", to))
+	return "smtp", "", nil
+}
+
+// sendResend sends an email using Resend API
+func (s *EmailService) sendResend(to string, email *RenderedEmail) (string, error) {
 	if s.apiKey == "" {
 		s.logger.Warn("Resend API key not configured, skipping email send", zap.String("to", to))
-		return fmt.Errorf("email service not configured")
+		return "", fmt.Errorf("email service not configured")
 	}
 
 	reqBody := ResendEmailRequest{
 		From:    s.fromEmail,
 		To:      []string{to},
-		Subject: subject,
-		HTML:    htmlBody,
+		Subject: email.Subject,
+		HTML:    email.HTML,
+		Text:    email.Text,
 	}
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return fmt.Errorf("failed to marshal email request: %w", err)
+		return "", fmt.Errorf("failed to marshal email request: %w", err)
 	}
 
 	req, err := http.NewRequest("POST", fmt.Sprintf("%s/emails", s.baseURL), bytes.NewBuffer(jsonData))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.apiKey))
@@ -135,16 +142,16 @@ func (s *EmailService) sendEmail(to, subject, htmlBody string) error {
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send email request: %w", err)
+		return "", fmt.Errorf("failed to send email request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		var errorResp ResendErrorResponse
 		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err == nil {
-			return fmt.Errorf("resend API error: %s", errorResp.Message)
+			return "", fmt.Errorf("resend API error: %s", errorResp.Message)
 		}
-		return fmt.Errorf("resend API returned status %d", resp.StatusCode)
+		return "", fmt.Errorf("resend API returned status %d", resp.StatusCode)
 	}
 
 	var emailResp ResendEmailResponse
@@ -153,266 +160,126 @@ func (s *EmailService) sendEmail(to, subject, htmlBody string) error {
 	}
 
 	s.logger.Info("Email sent successfully", zap.String("to", to), zap.String("email_id", emailResp.ID))
-	return nil
+	return emailResp.ID, nil
 }
 
 // SendTrialStartedEmail sends a welcome email when a trial starts
-func (s *EmailService) SendTrialStartedEmail(email string, trialEndsAt time.Time) error {
-	subject := "Your Stackyn 7-day trial has started"
-	trialEndDate := trialEndsAt.Format("January 2, 2006")
-	htmlBody := fmt.Sprintf(`
-		<!DOCTYPE html>
-		<html>
-		<head>
-			<meta charset="utf-8">
-			<meta name="viewport" content="width=device-width, initial-scale=1.0">
-		</head>
-		<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
-			<div style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); padding: 30px; text-align: center; border-radius: 10px 10px 0 0;">
-				<h1 style="color: white; margin: 0; font-size: 28px;">Welcome to Stackyn! 🎉</h1>
-			</div>
-			<div style="background: #ffffff; padding: 40px; border: 1px solid #e0e0e0; border-top: none; border-radius: 0 0 10px 10px;">
-				<h2 style="color: #333; margin-top: 0;">Your 7-Day Free Trial Has Started</h2>
-				<p style="color: #666; font-size: 16px;">Welcome to Stackyn! You now have full access to Pro features during your 7-day free trial.</p>
-				
-				<div style="background: #f5f5f5; border-left: 4px solid #667eea; padding: 20px; margin: 30px 0;">
-					<h3 style="color: #333; margin-top: 0;">Your Trial Details</h3>
-					<p style="color: #666; margin: 10px 0;"><strong>Trial End Date:</strong> %s</p>
-					<p style="color: #666; margin: 10px 0;"><strong>Resource Limits:</strong> 2GB RAM / 20GB Disk</p>
-					<p style="color: #666; margin: 10px 0;"><strong>Apps:</strong> Up to 3 apps</p>
-				</div>
-
-				<p style="color: #666; font-size: 16px;">No credit card required. Your trial expires automatically after 7 days.</p>
-				
-				<div style="text-align: center; margin: 30px 0;">
-					<a href="https://stackyn.com/apps/new" style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 15px 30px; text-decoration: none; border-radius: 5px; font-weight: bold; display: inline-block;">Deploy Your First App</a>
-				</div>
-
-				<p style="color: #999; font-size: 12px; margin-top: 30px; border-top: 1px solid #e0e0e0; padding-top: 20px;">If you have any questions, feel free to reach out to our support team.</p>
-			</div>
-		</body>
-		</html>
-	`, trialEndDate)
-
-	return s.sendEmail(email, subject, htmlBody)
+func (s *EmailService) SendTrialStartedEmail(email, locale string, trialEndsAt time.Time) error {
+	return s.send(email, EmailTrialStarted, locale, TrialEmailData{TrialEndsAt: trialEndsAt})
 }
 
-// SendTrialEndingEmail sends a reminder email when a trial is about to end
-func (s *EmailService) SendTrialEndingEmail(email string, trialEndsAt time.Time) error {
-	subject := "Your Stackyn trial ends tomorrow"
-	trialEndDate := trialEndsAt.Format("January 2, 2006")
-	htmlBody := fmt.Sprintf(`
-		<!DOCTYPE html>
-		<html>
-		<head>
-			<meta charset="utf-8">
-			<meta name="viewport" content="width=device-width, initial-scale=1.0">
-		</head>
-		<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
-			<div style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); padding: 30px; text-align: center; border-radius: 10px 10px 0 0;">
-				<h1 style="color: white; margin: 0; font-size: 28px;">Trial Ending Soon</h1>
-			</div>
-			<div style="background: #ffffff; padding: 40px; border: 1px solid #e0e0e0; border-top: none; border-radius: 0 0 10px 10px;">
-				<h2 style="color: #333; margin-top: 0;">Your Stackyn trial ends tomorrow</h2>
-				<p style="color: #666; font-size: 16px;">Your 7-day free trial ends on <strong>%s</strong>. Continue enjoying Stackyn by upgrading to a paid plan.</p>
-				
-				<div style="background: #f5f5f5; padding: 20px; margin: 30px 0; border-radius: 8px;">
-					<h3 style="color: #333; margin-top: 0;">Pricing Plans</h3>
-					
-					<div style="margin: 20px 0; padding: 15px; background: white; border-left: 4px solid #667eea; border-radius: 4px;">
-						<h4 style="margin: 0; color: #333;">Starter — $19/month</h4>
-						<ul style="color: #666; margin: 10px 0; padding-left: 20px;">
-							<li>1 app, 1 VPS</li>
-							<li>512 MB RAM</li>
-							<li>5 GB Disk</li>
-						</ul>
-					</div>
-					
-					<div style="margin: 20px 0; padding: 15px; background: white; border-left: 4px solid #764ba2; border-radius: 4px;">
-						<h4 style="margin: 0; color: #333;">Pro — $49/month</h4>
-						<ul style="color: #666; margin: 10px 0; padding-left: 20px;">
-							<li>Up to 3 apps, 1 VPS</li>
-							<li>2 GB RAM (shared)</li>
-							<li>20 GB Disk</li>
-						</ul>
-					</div>
-				</div>
-
-				<div style="text-align: center; margin: 30px 0;">
-					<a href="https://stackyn.com/upgrade" style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 15px 30px; text-decoration: none; border-radius: 5px; font-weight: bold; display: inline-block;">Upgrade Now</a>
-				</div>
-
-				<p style="color: #999; font-size: 12px; margin-top: 30px; border-top: 1px solid #e0e0e0; padding-top: 20px;">After your trial expires, existing apps will keep running, but new deployments will be blocked until you upgrade.</p>
-			</div>
-		</body>
-		</html>
-	`, trialEndDate)
-
-	return s.sendEmail(email, subject, htmlBody)
+// SendTrialEndingEmail sends a reminder email when a trial is about to end, once per trial
+func (s *EmailService) SendTrialEndingEmail(email, locale string, trialEndsAt time.Time) error {
+	return s.sendOnce(TrialEndingEmailKey(email, trialEndsAt), email, EmailTrialEnding, locale, TrialEmailData{TrialEndsAt: trialEndsAt})
 }
 
 // SendTrialExpiredEmail sends an email when a trial expires
-func (s *EmailService) SendTrialExpiredEmail(email string) error {
-	subject := "Your Stackyn trial has ended"
-	htmlBody := fmt.Sprintf(`
-		<!DOCTYPE html>
-		<html>
-		<head>
-			<meta charset="utf-8">
-			<meta name="viewport" content="width=device-width, initial-scale=1.0">
-		</head>
-		<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
-			<div style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); padding: 30px; text-align: center; border-radius: 10px 10px 0 0;">
-				<h1 style="color: white; margin: 0; font-size: 28px;">Trial Expired</h1>
-			</div>
-			<div style="background: #ffffff; padding: 40px; border: 1px solid #e0e0e0; border-top: none; border-radius: 0 0 10px 10px;">
-				<h2 style="color: #333; margin-top: 0;">Your Stackyn trial has ended</h2>
-				<p style="color: #666; font-size: 16px;">Your 7-day free trial has expired. Here's what happens next:</p>
-				
-				<div style="background: #f5f5f5; border-left: 4px solid #667eea; padding: 20px; margin: 30px 0;">
-					<ul style="color: #666; margin: 10px 0; padding-left: 20px;">
-						<li><strong>Existing apps</strong> will continue running</li>
-						<li><strong>New deploys</strong> will be blocked until you upgrade</li>
-						<li><strong>No data loss</strong> - all your apps and data are safe</li>
-					</ul>
-				</div>
-
-				<p style="color: #666; font-size: 16px;">Upgrade to a paid plan to continue deploying new apps and unlock all features.</p>
-				
-				<div style="text-align: center; margin: 30px 0;">
-					<a href="https://stackyn.com/upgrade" style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 15px 30px; text-decoration: none; border-radius: 5px; font-weight: bold; display: inline-block;">Upgrade Now</a>
-				</div>
-
-				<p style="color: #999; font-size: 12px; margin-top: 30px; border-top: 1px solid #e0e0e0; padding-top: 20px;">If you have any questions, feel free to reach out to our support team.</p>
-			</div>
-		</body>
-		</html>
-	`)
-
-	return s.sendEmail(email, subject, htmlBody)
+func (s *EmailService) SendTrialExpiredEmail(email, locale string) error {
+	return s.send(email, EmailTrialExpired, locale, NoEmailData{})
 }
 
 // SendSubscriptionActivatedEmail sends a welcome email when a subscription is activated
-func (s *EmailService) SendSubscriptionActivatedEmail(email, planName string, ramLimitMB, diskLimitGB int) error {
-	subject := "Welcome to Stackyn 🎉"
-	htmlBody := fmt.Sprintf(`
-		<!DOCTYPE html>
-		<html>
-		<head>
-			<meta charset="utf-8">
-			<meta name="viewport" content="width=device-width, initial-scale=1.0">
-		</head>
-		<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
-			<div style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); padding: 30px; text-align: center; border-radius: 10px 10px 0 0;">
-				<h1 style="color: white; margin: 0; font-size: 28px;">Welcome to Stackyn! 🎉</h1>
-			</div>
-			<div style="background: #ffffff; padding: 40px; border: 1px solid #e0e0e0; border-top: none; border-radius: 0 0 10px 10px;">
-				<h2 style="color: #333; margin-top: 0;">Your subscription is active</h2>
-				<p style="color: #666; font-size: 16px;">Thank you for upgrading to <strong>%s</strong>!</p>
-				
-				<div style="background: #f5f5f5; border-left: 4px solid #667eea; padding: 20px; margin: 30px 0;">
-					<h3 style="color: #333; margin-top: 0;">Your Plan Details</h3>
-					<p style="color: #666; margin: 10px 0;"><strong>Plan:</strong> %s</p>
-					<p style="color: #666; margin: 10px 0;"><strong>RAM Limit:</strong> %d MB</p>
-					<p style="color: #666; margin: 10px 0;"><strong>Disk Limit:</strong> %d GB</p>
-				</div>
-
-				<p style="color: #666; font-size: 16px;">You now have full access to all features. Start deploying your apps!</p>
-				
-				<div style="text-align: center; margin: 30px 0;">
-					<a href="https://stackyn.com/apps" style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 15px 30px; text-decoration: none; border-radius: 5px; font-weight: bold; display: inline-block;">View Your Apps</a>
-				</div>
-
-				<p style="color: #999; font-size: 12px; margin-top: 30px; border-top: 1px solid #e0e0e0; padding-top: 20px;">If you need any help, feel free to reach out to our support team. We're here to help!</p>
-			</div>
-		</body>
-		</html>
-	`, planName, planName, ramLimitMB, diskLimitGB)
-
-	return s.sendEmail(email, subject, htmlBody)
+func (s *EmailService) SendSubscriptionActivatedEmail(email, locale, planName string, ramLimitMB, diskLimitGB int) error {
+	return s.send(email, EmailSubscriptionActivated, locale, SubscriptionActivatedEmailData{
+		PlanName:    planName,
+		RAMLimitMB:  ramLimitMB,
+		DiskLimitGB: diskLimitGB,
+	})
 }
 
 // SendPaymentFailedEmail sends an email when payment fails
-func (s *EmailService) SendPaymentFailedEmail(email string) error {
-	subject := "Payment Failed - Action Required"
-	htmlBody := fmt.Sprintf(`
-		<!DOCTYPE html>
-		<html>
-		<head>
-			<meta charset="utf-8">
-			<meta name="viewport" content="width=device-width, initial-scale=1.0">
-		</head>
-		<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
-			<div style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); padding: 30px; text-align: center; border-radius: 10px 10px 0 0;">
-				<h1 style="color: white; margin: 0; font-size: 28px;">Payment Failed</h1>
-			</div>
-			<div style="background: #ffffff; padding: 40px; border: 1px solid #e0e0e0; border-top: none; border-radius: 0 0 10px 10px;">
-				<h2 style="color: #333; margin-top: 0;">We couldn't process your payment</h2>
-				<p style="color: #666; font-size: 16px;">Your recent payment attempt failed. Here's what happens next:</p>
-				
-				<div style="background: #fff3cd; border-left: 4px solid #ffc107; padding: 20px; margin: 30px 0;">
-					<h3 style="color: #333; margin-top: 0;">What happens now:</h3>
-					<ul style="color: #666; margin: 10px 0; padding-left: 20px;">
-						<li><strong>Your apps will be stopped</strong> until payment is resolved</li>
-						<li><strong>No data loss</strong> - all your apps and data are safe</li>
-						<li><strong>Update your payment method</strong> to restore service</li>
-					</ul>
-				</div>
-
-				<p style="color: #666; font-size: 16px;">Please update your payment method to continue using Stackyn.</p>
-				
-				<div style="text-align: center; margin: 30px 0;">
-					<a href="https://stackyn.com/billing" style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 15px 30px; text-decoration: none; border-radius: 5px; font-weight: bold; display: inline-block;">Update Payment Method</a>
-				</div>
-
-				<p style="color: #999; font-size: 12px; margin-top: 30px; border-top: 1px solid #e0e0e0; padding-top: 20px;">If you have any questions, feel free to reach out to our support team.</p>
-			</div>
-		</body>
-		</html>
-	`)
-
-	return s.sendEmail(email, subject, htmlBody)
+func (s *EmailService) SendPaymentFailedEmail(email, locale string) error {
+	return s.send(email, EmailPaymentFailed, locale, NoEmailData{})
+}
+
+// SendPaymentFailedGraceEmail sends an email when payment fails and the account enters read-only grace mode
+func (s *EmailService) SendPaymentFailedGraceEmail(email, locale string, graceEndsAt time.Time) error {
+	return s.send(email, EmailPaymentFailedGrace, locale, PaymentFailedGraceEmailData{GraceEndsAt: graceEndsAt})
 }
 
 // SendSubscriptionExpiredEmail sends an email when subscription expires
-func (s *EmailService) SendSubscriptionExpiredEmail(email string) error {
-	subject := "Your Stackyn subscription has expired"
-	htmlBody := fmt.Sprintf(`
-		<!DOCTYPE html>
-		<html>
-		<head>
-			<meta charset="utf-8">
-			<meta name="viewport" content="width=device-width, initial-scale=1.0">
-		</head>
-		<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
-			<div style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); padding: 30px; text-align: center; border-radius: 10px 10px 0 0;">
-				<h1 style="color: white; margin: 0; font-size: 28px;">Subscription Expired</h1>
-			</div>
-			<div style="background: #ffffff; padding: 40px; border: 1px solid #e0e0e0; border-top: none; border-radius: 0 0 10px 10px;">
-				<h2 style="color: #333; margin-top: 0;">Your subscription has expired</h2>
-				<p style="color: #666; font-size: 16px;">Your Stackyn subscription has expired. Here's what happens next:</p>
-				
-				<div style="background: #f5f5f5; border-left: 4px solid #667eea; padding: 20px; margin: 30px 0;">
-					<h3 style="color: #333; margin-top: 0;">What happens now:</h3>
-					<ul style="color: #666; margin: 10px 0; padding-left: 20px;">
-						<li><strong>All apps are stopped</strong> until you resubscribe</li>
-						<li><strong>No data loss</strong> - all your apps and data are safe</li>
-						<li><strong>Resubscribe anytime</strong> to restore service</li>
-					</ul>
-				</div>
-
-				<p style="color: #666; font-size: 16px;">Resubscribe to continue using Stackyn and restore your apps.</p>
-				
-				<div style="text-align: center; margin: 30px 0;">
-					<a href="https://stackyn.com/pricing" style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 15px 30px; text-decoration: none; border-radius: 5px; font-weight: bold; display: inline-block;">Resubscribe Now</a>
-				</div>
-
-				<p style="color: #999; font-size: 12px; margin-top: 30px; border-top: 1px solid #e0e0e0; padding-top: 20px;">If you have any questions, feel free to reach out to our support team.</p>
-			</div>
-		</body>
-		</html>
-	`)
-
-	return s.sendEmail(email, subject, htmlBody)
+func (s *EmailService) SendSubscriptionExpiredEmail(email, locale string) error {
+	return s.send(email, EmailSubscriptionExpired, locale, NoEmailData{})
+}
+
+// SendPlanLimitWarningEmail warns a user that apps exceed their plan limits and will be paused at the deadline
+func (s *EmailService) SendPlanLimitWarningEmail(email, locale, planName string, appNames []string, deadline time.Time) error {
+	return s.send(email, EmailPlanLimitWarning, locale, PlanLimitWarningEmailData{
+		PlanName: planName,
+		AppNames: appNames,
+		Deadline: deadline,
+	})
+}
+
+// SendAppsPausedEmail tells a user which apps were paused for exceeding their plan limits
+func (s *EmailService) SendAppsPausedEmail(email, locale, planName string, appNames []string) error {
+	return s.send(email, EmailAppsPaused, locale, AppsPausedEmailData{
+		PlanName: planName,
+		AppNames: appNames,
+	})
+}
+
+// SendDeployFailedEmail tells an app owner that a build or deployment failed
+// stage is "Build" or "Deployment"; translations word it in their own language
+func (s *EmailService) SendDeployFailedEmail(email, locale, appName, stage, reason string) error {
+	return s.send(email, EmailDeployFailed, locale, DeployFailedEmailData{
+		AppName: appName,
+		Stage:   stage,
+		Reason:  reason,
+	})
+}
+
+// SendFirstDeployEmail celebrates an app's first successful deployment with its live URL, next steps
+// and a summary of the deployment
+func (s *EmailService) SendFirstDeployEmail(email, locale string, summary FirstDeploySummary) error {
+	commit := summary.CommitSHA
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	return s.send(email, EmailFirstDeploy, locale, FirstDeployEmailData{
+		AppName:      summary.AppName,
+		URL:          summary.URL,
+		DeploymentID: summary.DeploymentID,
+		Image:        summary.Image,
+		Commit:       commit,
+		DeployedAt:   summary.DeployedAt,
+	})
+}
+
+// SendBaseImageUpdateEmail tells an app owner that the base image of their app was republished, and
+// whether the app is being rebuilt on it automatically
+func (s *EmailService) SendBaseImageUpdateEmail(email, locale string, update BaseImageUpdate) error {
+	return s.send(email, EmailBaseImageUpdate, locale, BaseImageUpdateEmailData{
+		AppName:     update.AppName,
+		BaseImage:   update.BaseImage,
+		AutoRebuild: update.AutoRebuild,
+	})
 }
 
+// SendMaintenanceScheduledEmail tells an app owner about upcoming maintenance, with the window in
+// their timezone (UTC when it is empty or unknown)
+func (s *EmailService) SendMaintenanceScheduledEmail(email, locale, timezone string, notice MaintenanceNotice) error {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "" {
+		loc, timezone = time.UTC, "UTC"
+	}
+	return s.send(email, EmailMaintenanceScheduled, locale, MaintenanceScheduledEmailData{
+		Title:       notice.Title,
+		Description: notice.Description,
+		StartsAt:    notice.StartsAt.In(loc),
+		EndsAt:      notice.EndsAt.In(loc),
+		Timezone:    timezone,
+		AppNames:    notice.AppNames,
+	})
+}
+
+// SendOrganizationInviteEmail invites someone to join an organization
+func (s *EmailService) SendOrganizationInviteEmail(email, locale, orgName, inviterEmail, role, acceptURL string, expiresAt time.Time) error {
+	return s.send(email, EmailOrganizationInvite, locale, OrganizationInviteEmailData{
+		OrgName:      orgName,
+		InviterEmail: inviterEmail,
+		Role:         role,
+		AcceptURL:    acceptURL,
+		ExpiresAt:    expiresAt,
+	})
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+)
+
+// QueuedEmail is an email in the email log, waiting for or past delivery
+type QueuedEmail struct {
+	ID        string
+	Recipient string
+	Subject   string
+	HTMLBody  string // Bodies are emptied once sent - they may hold one-time codes
+	TextBody  string
+	Status    string // queued | sent | dead
+	Attempts  int
+}
+
+// EmailLogRepository records every queued email and its delivery
+// Idempotency keys are unique, so an email with a key is only ever queued once
+type EmailLogRepository interface {
+	CreateQueuedEmail(ctx context.Context, idempotencyKey, recipient string, email *RenderedEmail) (id string, created bool, err error)
+	GetQueuedEmail(ctx context.Context, id string) (*QueuedEmail, error)
+	RecordEmailAttempt(ctx context.Context, id, provider, providerMessageID string, sendErr error, final bool) error
+	HasEmail(ctx context.Context, idempotencyKey string) (bool, error)
+}
+
+// EmailEnqueuer queues the delivery of a logged email for a worker
+type EmailEnqueuer interface {
+	EnqueueEmailTask(ctx context.Context, emailID string) (*asynq.TaskInfo, error)
+}
+
+// SetQueue makes sending durable: emails are recorded in the email log and delivered by the email task,
+// which retries with backoff and leaves emails that never went out in the dead state
+func (s *EmailService) SetQueue(emailLog EmailLogRepository, enqueuer EmailEnqueuer) {
+	s.emailLog = emailLog
+	s.enqueuer = enqueuer
+}
+
+// TrialEndingEmailKey is the idempotency key of the reminder that a trial ends at trialEndsAt
+func TrialEndingEmailKey(email string, trialEndsAt time.Time) string {
+	return "trial_ending:" + strings.ToLower(email) + ":" + trialEndsAt.UTC().Format(time.RFC3339)
+}
+
+// HasSentEmail reports whether an email with idempotencyKey was already queued or sent
+// Always false without a queue
+func (s *EmailService) HasSentEmail(ctx context.Context, idempotencyKey string) (bool, error) {
+	if s.emailLog == nil {
+		return false, nil
+	}
+	return s.emailLog.HasEmail(ctx, idempotencyKey)
+}
+
+// queueEmail records an email and queues its delivery
+// If the email can't be queued it is delivered right away, so queue trouble never loses an email
+func (s *EmailService) queueEmail(idempotencyKey, to string, email *RenderedEmail) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, created, err := s.emailLog.CreateQueuedEmail(ctx, idempotencyKey, to, email)
+	if err != nil {
+		s.logger.Warn("Failed to record email - sending it directly", zap.Error(err), zap.String("to", to))
+		_, _, err = s.deliver(to, email)
+		return err
+	}
+	if !created {
+		s.logger.Info("Email already sent, not sending it again",
+			zap.String("to", to),
+			zap.String("idempotency_key", idempotencyKey),
+		)
+		return nil
+	}
+
+	if _, err := s.enqueuer.EnqueueEmailTask(ctx, id); err != nil {
+		s.logger.Warn("Failed to queue email - sending it directly", zap.Error(err), zap.String("email_id", id))
+		provider, messageID, sendErr := s.deliver(to, email)
+		if err := s.emailLog.RecordEmailAttempt(ctx, id, provider, messageID, sendErr, true); err != nil {
+			s.logger.Warn("Failed to record email delivery", zap.Error(err), zap.String("email_id", id))
+		}
+		return sendErr
+	}
+	return nil
+}
+
+// DeliverQueuedEmail delivers a logged email; called by the email task
+// A failed attempt is returned so the task is retried; on the final attempt the email is left dead
+func (s *EmailService) DeliverQueuedEmail(ctx context.Context, emailID string, final bool) error {
+	if s.emailLog == nil {
+		return fmt.Errorf("email log not configured")
+	}
+	queued, err := s.emailLog.GetQueuedEmail(ctx, emailID)
+	if err != nil {
+		return fmt.Errorf("failed to get queued email: %w", err)
+	}
+	if queued.Status != "queued" {
+		// Sent by an earlier attempt whose outcome reached the log but not the queue
+		return nil
+	}
+
+	provider, messageID, sendErr := s.deliver(queued.Recipient, &RenderedEmail{
+		Subject: queued.Subject,
+		HTML:    queued.HTMLBody,
+		Text:    queued.TextBody,
+	})
+	if err := s.emailLog.RecordEmailAttempt(ctx, emailID, provider, messageID, sendErr, final); err != nil {
+		s.logger.Warn("Failed to record email delivery", zap.Error(err), zap.String("email_id", emailID))
+	}
+	if sendErr != nil && final {
+		s.logger.Error("Email could not be delivered - giving up",
+			zap.Error(sendErr),
+			zap.String("email_id", emailID),
+			zap.String("to", queued.Recipient),
+			zap.Int("attempts", queued.Attempts+1),
+		)
+	}
+	return sendErr
+}
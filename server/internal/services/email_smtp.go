@@ -0,0 +1,138 @@
+package services
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// smtpTimeout bounds a whole SMTP delivery, from dialing to QUIT
+const smtpTimeout = 30 * time.Second
+
+// smtpSender delivers emails through an SMTP relay (the fallback provider)
+// The connection is upgraded with STARTTLS when the server offers it
+type smtpSender struct {
+	host     string
+	port     int
+	username string
+	password string
+}
+
+// SetSMTPFallback sends emails through an SMTP relay when Resend fails; an empty host disables it
+func (s *EmailService) SetSMTPFallback(host string, port int, username, password string) {
+	if host == "" {
+		return
+	}
+	if port == 0 {
+		port = 587
+	}
+	s.smtp = &smtpSender{host: host, port: port, username: username, password: password}
+}
+
+// send delivers an email as multipart/alternative, the plaintext part first so clients prefer the HTML
+func (m *smtpSender) send(from, to string, email *RenderedEmail) error {
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(from, "\r\n") {
+		return fmt.Errorf("invalid address")
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(m.host, strconv.Itoa(m.port)), smtpTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("SMTP RCPT TO failed: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+
+	msg, err := smtpMessage(from, to, email)
+	if err != nil {
+		w.Close()
+		return fmt.Errorf("failed to build message: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected the message: %w", err)
+	}
+	return client.Quit()
+}
+
+// smtpMessage builds the MIME message of an email; both parts are quoted-printable so no line
+// exceeds the SMTP line limit
+func smtpMessage(from, to string, email *RenderedEmail) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", email.Text},
+		{"text/html; charset=UTF-8", email.HTML},
+	} {
+		if part.content == "" {
+			continue
+		}
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n", parts.Boundary())
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
@@ -0,0 +1,488 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html"
+	htmltemplate "html/template"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Transactional email messages. Each is registered once per locale
+const (
+	EmailOTP                   = "otp"
+	EmailPasswordReset         = "password_reset"
+	EmailTrialStarted          = "trial_started"
+	EmailTrialEnding           = "trial_ending"
+	EmailTrialExpired          = "trial_expired"
+	EmailSubscriptionActivated = "subscription_activated"
+	EmailPaymentFailed         = "payment_failed"
+	EmailPaymentFailedGrace    = "payment_failed_grace"
+	EmailSubscriptionExpired   = "subscription_expired"
+	EmailPlanLimitWarning      = "plan_limit_warning"
+	EmailAppsPaused            = "apps_paused"
+	EmailDeployFailed          = "deploy_failed"
+	EmailOrganizationInvite    = "organization_invite"
+	EmailMaintenanceScheduled  = "maintenance_scheduled"
+	EmailFirstDeploy           = "first_deploy"
+	EmailBaseImageUpdate       = "base_image_update"
+)
+
+// The data each message's template is rendered with. A template referring to a field its message's
+// data lacks fails when the registry loads, not when the email is sent
+
+// NoEmailData is the data of messages that say the same thing to everyone
+type NoEmailData struct{}
+
+// OTPEmailData is the data of the verification and password reset emails
+type OTPEmailData struct {
+	OTP string
+}
+
+// TrialEmailData is the data of the trial started and trial ending emails
+type TrialEmailData struct {
+	TrialEndsAt time.Time
+}
+
+// SubscriptionActivatedEmailData is the data of the subscription activated email
+type SubscriptionActivatedEmailData struct {
+	PlanName    string
+	RAMLimitMB  int
+	DiskLimitGB int
+}
+
+// PaymentFailedGraceEmailData is the data of the payment failed email sent when read-only grace mode starts
+type PaymentFailedGraceEmailData struct {
+	GraceEndsAt time.Time
+}
+
+// PlanLimitWarningEmailData is the data of the warning that apps will be paused at Deadline
+type PlanLimitWarningEmailData struct {
+	PlanName string
+	AppNames []string
+	Deadline time.Time
+}
+
+// AppsPausedEmailData is the data of the email listing apps paused for exceeding the plan
+type AppsPausedEmailData struct {
+	PlanName string
+	AppNames []string
+}
+
+// DeployFailedEmailData is the data of the build or deployment failure email
+type DeployFailedEmailData struct {
+	AppName string
+	Stage   string // "Build" or "Deployment"; translations word it in their own language
+	Reason  string
+}
+
+// OrganizationInviteEmailData is the data of the organization invitation email
+type OrganizationInviteEmailData struct {
+	OrgName      string
+	InviterEmail string
+	Role         string
+	AcceptURL    string
+	ExpiresAt    time.Time
+}
+
+// MaintenanceScheduledEmailData is the data of the maintenance notice, with times in Timezone
+type MaintenanceScheduledEmailData struct {
+	Title       string
+	Description string
+	StartsAt    time.Time
+	EndsAt      time.Time
+	Timezone    string
+	AppNames    []string
+}
+
+// FirstDeployEmailData is the data of the first successful deployment email
+type FirstDeployEmailData struct {
+	AppName      string
+	URL          string
+	DeploymentID string
+	Image        string
+	Commit       string // Short SHA; empty when not deployed from git
+	DeployedAt   time.Time
+}
+
+// BaseImageUpdateEmailData is the data of the base image update notice
+type BaseImageUpdateEmailData struct {
+	AppName     string
+	BaseImage   string
+	AutoRebuild bool
+}
+
+// emailMessageData holds the zero value of each message's data; Render only accepts that type
+var emailMessageData = map[string]interface{}{
+	EmailOTP:                   OTPEmailData{},
+	EmailPasswordReset:         OTPEmailData{},
+	EmailTrialStarted:          TrialEmailData{},
+	EmailTrialEnding:           TrialEmailData{},
+	EmailTrialExpired:          NoEmailData{},
+	EmailSubscriptionActivated: SubscriptionActivatedEmailData{},
+	EmailPaymentFailed:         NoEmailData{},
+	EmailPaymentFailedGrace:    PaymentFailedGraceEmailData{},
+	EmailSubscriptionExpired:   NoEmailData{},
+	EmailPlanLimitWarning:      PlanLimitWarningEmailData{},
+	EmailAppsPaused:            AppsPausedEmailData{},
+	EmailDeployFailed:          DeployFailedEmailData{},
+	EmailOrganizationInvite:    OrganizationInviteEmailData{},
+	EmailMaintenanceScheduled:  MaintenanceScheduledEmailData{},
+	EmailFirstDeploy:           FirstDeployEmailData{},
+	EmailBaseImageUpdate:       BaseImageUpdateEmailData{},
+}
+
+// DefaultLocale is used for users without a supported locale, and for any message a locale lacks
+const DefaultLocale = "en"
+
+// SupportedLocales are the locales transactional emails are translated into
+var SupportedLocales = []string{"en", "es", "de", "fr"}
+
+// NormalizeLocale reduces a language tag ("es-MX", "de_DE", "FR") to a supported locale,
+// returning "" when the language is not supported
+func NormalizeLocale(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	for _, locale := range SupportedLocales {
+		if tag == locale {
+			return locale
+		}
+	}
+	return ""
+}
+
+// LocaleFromAcceptLanguage picks the supported locale the client prefers most from an
+// Accept-Language header, falling back to DefaultLocale
+func LocaleFromAcceptLanguage(header string) string {
+	type candidate struct {
+		locale string
+		q      float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		locale := NormalizeLocale(tag)
+		if locale == "" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		candidates = append(candidates, candidate{locale: locale, q: q})
+	}
+	if len(candidates) == 0 {
+		return DefaultLocale
+	}
+	// Equal weights keep the client's order
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].locale
+}
+
+// emailTemplateFS holds the email templates: layout.html wraps every message in the Stackyn header
+// and card, and <locale>/<message>.html defines a message's "subject" (plain text), "title" (the
+// banner), "body" and "footer" blocks. Adding a message takes a template here, a constant, a data
+// struct and an entry in emailMessageData
+//
+//go:embed templates/email
+var emailTemplateFS embed.FS
+
+// RenderedEmail is a message rendered for one recipient
+type RenderedEmail struct {
+	Subject string
+	HTML    string
+	Text    string // Plaintext alternative of HTML
+}
+
+// emailTemplateKey identifies a registered template
+type emailTemplateKey struct {
+	message string
+	locale  string
+}
+
+// emailTemplate is one parsed message template
+// The file is parsed twice: as text for the subject and as HTML, inside the layout, for the rest
+type emailTemplate struct {
+	subject *texttemplate.Template
+	body    *htmltemplate.Template
+}
+
+// EmailTemplateRegistry holds the transactional email templates keyed by (message, locale)
+type EmailTemplateRegistry struct {
+	templates map[emailTemplateKey]*emailTemplate
+}
+
+// emailStyles are the inline styles message bodies apply with {{style "name"}}
+// (mail clients ignore <style> blocks, so every element carries its own)
+var emailStyles = map[string]string{
+	"h2":       "color: #333; margin-top: 0;",
+	"h3":       "color: #333; margin-top: 0;",
+	"h4":       "margin: 0; color: #333;",
+	"text":     "color: #666; font-size: 16px;",
+	"small":    "color: #666; font-size: 14px;",
+	"detail":   "color: #666; margin: 10px 0;",
+	"list":     "color: #666; margin: 10px 0; padding-left: 20px;",
+	"box":      "background: #f5f5f5; border-left: 4px solid #667eea; padding: 20px; margin: 30px 0;",
+	"panel":    "background: #f5f5f5; padding: 20px; margin: 30px 0; border-radius: 8px;",
+	"plan":     "margin: 20px 0; padding: 15px; background: white; border-left: 4px solid #667eea; border-radius: 4px;",
+	"planAlt":  "margin: 20px 0; padding: 15px; background: white; border-left: 4px solid #764ba2; border-radius: 4px;",
+	"warning":  "background: #fff3cd; border-left: 4px solid #ffc107; padding: 20px; margin: 30px 0;",
+	"warnText": "color: #856404; margin: 0 0 10px 0;",
+	"warnList": "color: #856404; margin: 10px 0; padding-left: 20px;",
+	"pre":      "color: #666; margin: 0; white-space: pre-wrap; word-break: break-word; font-size: 13px;",
+}
+
+// NewEmailTemplateRegistry parses the embedded templates. English must define every message; other
+// locales may leave some out. Each template is rendered once with empty data so a field its message
+// doesn't have is caught here. A template that fails either way is a programming error, so it is
+// reported rather than skipped
+func NewEmailTemplateRegistry() (*EmailTemplateRegistry, error) {
+	layout, err := emailTemplateFS.ReadFile("templates/email/layout.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email layout: %w", err)
+	}
+
+	registry := &EmailTemplateRegistry{templates: make(map[emailTemplateKey]*emailTemplate)}
+	for _, locale := range SupportedLocales {
+		entries, err := emailTemplateFS.ReadDir(path.Join("templates/email", locale))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s email templates: %w", locale, err)
+		}
+		for _, entry := range entries {
+			message, _ := strings.CutSuffix(entry.Name(), ".html")
+			zero, ok := emailMessageData[message]
+			if !ok {
+				return nil, fmt.Errorf("email template %s/%s is not a known message", locale, entry.Name())
+			}
+			source, err := emailTemplateFS.ReadFile(path.Join("templates/email", locale, entry.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s email template for locale %s: %w", message, locale, err)
+			}
+			tmpl, err := parseEmailTemplate(locale, string(layout), string(source))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s email template for locale %s: %w", message, locale, err)
+			}
+			if _, err := tmpl.render(zero); err != nil {
+				return nil, fmt.Errorf("%s email template for locale %s does not fit its data: %w", message, locale, err)
+			}
+			registry.templates[emailTemplateKey{message: message, locale: locale}] = tmpl
+		}
+	}
+	for message := range emailMessageData {
+		if _, ok := registry.templates[emailTemplateKey{message: message, locale: DefaultLocale}]; !ok {
+			return nil, fmt.Errorf("%s email has no %s template", message, DefaultLocale)
+		}
+	}
+	return registry, nil
+}
+
+// Render renders a message in the given locale, falling back to English when the locale is
+// unsupported or has no translation of the message. data must be the message's data struct
+func (r *EmailTemplateRegistry) Render(message, locale string, data interface{}) (*RenderedEmail, error) {
+	zero, ok := emailMessageData[message]
+	if !ok {
+		return nil, fmt.Errorf("unknown email message %q", message)
+	}
+	if reflect.TypeOf(data) != reflect.TypeOf(zero) {
+		return nil, fmt.Errorf("%s email is rendered with %T, not %T", message, zero, data)
+	}
+
+	tmpl, ok := r.templates[emailTemplateKey{message: message, locale: NormalizeLocale(locale)}]
+	if !ok {
+		tmpl = r.templates[emailTemplateKey{message: message, locale: DefaultLocale}]
+	}
+	email, err := tmpl.render(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s email: %w", message, err)
+	}
+	return email, nil
+}
+
+// render renders the subject, the HTML body in its layout and the plaintext alternative
+func (t *emailTemplate) render(data interface{}) (*RenderedEmail, error) {
+	var subject, body bytes.Buffer
+	if err := t.subject.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := t.body.ExecuteTemplate(&body, "layout", data); err != nil {
+		return nil, err
+	}
+
+	// The plaintext alternative is the title, body and footer without the layout around them
+	parts := make([]string, 0, 3)
+	for _, name := range []string{"title", "body", "footer"} {
+		var part bytes.Buffer
+		if err := t.body.ExecuteTemplate(&part, name, data); err != nil {
+			return nil, err
+		}
+		parts = append(parts, emailHTMLToText(part.String()))
+	}
+
+	return &RenderedEmail{
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    body.String(),
+		Text:    strings.Join(parts, "\n\n") + "\n",
+	}, nil
+}
+
+// parseEmailTemplate parses one message with the locale's formatting functions
+func parseEmailTemplate(locale, layout, source string) (*emailTemplate, error) {
+	funcs := map[string]interface{}{
+		"locale":   func() string { return locale },
+		"date":     func(t time.Time) string { return formatEmailDate(locale, t, false) },
+		"datetime": func(t time.Time) string { return formatEmailDate(locale, t, true) },
+		"lower":    strings.ToLower,
+		"style":    emailStyle,
+		"button":   emailButton,
+		"code":     emailCode,
+	}
+
+	subject, err := texttemplate.New("message").Funcs(funcs).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	if subject.Lookup("subject") == nil {
+		return nil, fmt.Errorf("no subject defined")
+	}
+
+	body, err := htmltemplate.New("email").Funcs(funcs).Option("missingkey=error").Parse(layout)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := body.New("message").Parse(source); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"title", "body", "footer"} {
+		if body.Lookup(name) == nil {
+			return nil, fmt.Errorf("no %s defined", name)
+		}
+	}
+	return &emailTemplate{subject: subject, body: body}, nil
+}
+
+// emailStyle returns a style attribute from emailStyles
+func emailStyle(name string) (htmltemplate.HTMLAttr, error) {
+	css, ok := emailStyles[name]
+	if !ok {
+		return "", fmt.Errorf("unknown email style %q", name)
+	}
+	return htmltemplate.HTMLAttr(`style="` + css + `"`), nil
+}
+
+// emailButton renders a call-to-action link
+func emailButton(label, url string) htmltemplate.HTML {
+	return htmltemplate.HTML(fmt.Sprintf(`<div style="text-align: center; margin: 30px 0;">
+			<a href="%s" style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 15px 30px; text-decoration: none; border-radius: 5px; font-weight: bold; display: inline-block;">%s</a>
+		</div>`, htmltemplate.HTMLEscapeString(url), htmltemplate.HTMLEscapeString(label)))
+}
+
+// emailCode renders a one-time code in a dashed box
+func emailCode(code string) htmltemplate.HTML {
+	return htmltemplate.HTML(fmt.Sprintf(`<div style="background: #f5f5f5; border: 2px dashed #667eea; border-radius: 8px; padding: 20px; text-align: center; margin: 30px 0;">
+			<code style="font-size: 32px; font-weight: bold; letter-spacing: 8px; color: #667eea; font-family: 'Courier New', monospace;">%s</code>
+		</div>`, htmltemplate.HTMLEscapeString(code)))
+}
+
+// emailMonths are the month names of each supported locale, January first
+var emailMonths = map[string][12]string{
+	"es": {"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+	"de": {"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+	"fr": {"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+}
+
+// formatEmailDate formats a date the way the locale writes it in prose, optionally with the time
+func formatEmailDate(locale string, t time.Time, withTime bool) string {
+	clock := t.Format("15:04 MST")
+	month := emailMonths[locale][t.Month()-1]
+	switch locale {
+	case "es":
+		date := fmt.Sprintf("%d de %s de %d", t.Day(), month, t.Year())
+		if withTime {
+			return date + " a las " + clock
+		}
+		return date
+	case "de":
+		date := fmt.Sprintf("%d. %s %d", t.Day(), month, t.Year())
+		if withTime {
+			return date + " um " + clock
+		}
+		return date
+	case "fr":
+		date := fmt.Sprintf("%d %s %d", t.Day(), month, t.Year())
+		if withTime {
+			return date + " à " + clock
+		}
+		return date
+	default:
+		if withTime {
+			return t.Format("January 2, 2006 at 15:04 MST")
+		}
+		return t.Format("January 2, 2006")
+	}
+}
+
+// Patterns emailHTMLToText turns markup into plain text with
+var (
+	emailPrePattern   = regexp.MustCompile(`(?is)<pre[^>]*>(.*?)</pre>`)
+	emailLinkPattern  = regexp.MustCompile(`(?is)<a\s[^>]*href="([^"]*)"[^>]*>(.*?)</a>`)
+	emailBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>`)
+	emailItemPattern  = regexp.MustCompile(`(?i)<li(\s[^>]*)?>`)
+	emailBlockPattern = regexp.MustCompile(`(?i)</?(p|div|h[1-6]|ul|ol|table|tr)(\s[^>]*)?>`)
+	emailTagPattern   = regexp.MustCompile(`<[^>]*>`)
+	emailSpacePattern = regexp.MustCompile(`\s+`)
+	emailLinePattern  = regexp.MustCompile(` *\n *`)
+	emailGapPattern   = regexp.MustCompile(`\n{3,}`)
+)
+
+// emailHTMLToText renders rendered template HTML as plain text: blocks become paragraphs, list items
+// dashes and links "label: url". Whitespace collapses as a browser would, except inside <pre>
+func emailHTMLToText(s string) string {
+	var text strings.Builder
+	for {
+		loc := emailPrePattern.FindStringSubmatchIndex(s)
+		if loc == nil {
+			text.WriteString(emailFlowToText(s))
+			break
+		}
+		text.WriteString(emailFlowToText(s[:loc[0]]))
+		text.WriteString("\n\n" + html.UnescapeString(emailTagPattern.ReplaceAllString(s[loc[2]:loc[3]], "")) + "\n\n")
+		s = s[loc[1]:]
+	}
+	return strings.TrimSpace(emailGapPattern.ReplaceAllString(text.String(), "\n\n"))
+}
+
+// emailFlowToText is emailHTMLToText for markup outside <pre>
+func emailFlowToText(s string) string {
+	s = emailSpacePattern.ReplaceAllString(s, " ")
+	s = emailLinkPattern.ReplaceAllStringFunc(s, func(link string) string {
+		match := emailLinkPattern.FindStringSubmatch(link)
+		url := strings.TrimSpace(match[1])
+		label := strings.TrimSpace(emailTagPattern.ReplaceAllString(match[2], ""))
+		if label == "" || label == url {
+			return url
+		}
+		return label + ": " + url
+	})
+	s = emailBreakPattern.ReplaceAllString(s, "\n")
+	s = emailItemPattern.ReplaceAllString(s, "\n- ")
+	s = emailBlockPattern.ReplaceAllString(s, "\n\n")
+	s = html.UnescapeString(emailTagPattern.ReplaceAllString(s, ""))
+	return emailLinePattern.ReplaceAllString(s, "\n")
+}
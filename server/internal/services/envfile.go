@@ -0,0 +1,114 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// envKeyRegex matches POSIX-style environment variable names
+var envKeyRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateEnvKey checks that an environment variable name is usable in a container
+func ValidateEnvKey(key string) error {
+	if !envKeyRegex.MatchString(key) {
+		return fmt.Errorf("invalid environment variable name %q: must start with a letter or underscore and contain only letters, digits and underscores", key)
+	}
+	return nil
+}
+
+// ParseEnvFile parses a .env payload into a key/value map
+// Supports comments (#), blank lines, an optional "export " prefix,
+// single-quoted values (literal) and double-quoted values (with \n, \t, \" and \\ escapes)
+// Later occurrences of a key override earlier ones, matching shell semantics
+func ParseEnvFile(content string) (map[string]string, error) {
+	vars := make(map[string]string)
+
+	// .env files saved on Windows often start with a BOM that would otherwise end up in the first key
+	scanner := bufio.NewScanner(strings.NewReader(NormalizeText([]byte(content))))
+	// Allow long values (certificates, JSON blobs)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip blank lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNum)
+		}
+
+		key := strings.TrimSpace(line[:eq])
+		if err := ValidateEnvKey(key); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		value, err := parseEnvValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		vars[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+
+	return vars, nil
+}
+
+// parseEnvValue unquotes a single .env value
+func parseEnvValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	switch raw[0] {
+	case '\'':
+		end := strings.LastIndex(raw, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated single-quoted value")
+		}
+		return raw[1:end], nil
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(raw); i++ {
+			c := raw[i]
+			if c == '"' {
+				return b.String(), nil
+			}
+			if c == '\\' && i+1 < len(raw) {
+				i++
+				switch raw[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case 'r':
+					b.WriteByte('\r')
+				default:
+					b.WriteByte(raw[i])
+				}
+				continue
+			}
+			b.WriteByte(c)
+		}
+		return "", fmt.Errorf("unterminated double-quoted value")
+	}
+
+	// Unquoted: strip trailing inline comments ("VALUE # comment")
+	if idx := strings.Index(raw, " #"); idx >= 0 {
+		raw = strings.TrimSpace(raw[:idx])
+	}
+	return raw, nil
+}
@@ -1,16 +1,22 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
 	"go.uber.org/zap"
 	stackynerrors "stackyn/server/internal/errors"
 )
@@ -36,25 +42,100 @@ type CloneOptions struct {
 	Shallow   bool   // Enable shallow clone
 	Depth     int    // Depth for shallow clone (default: 1)
 	UniqueID  string // Optional unique identifier for concurrent builds (e.g., build_job_id)
+	SparseDir string // Optional repository subdirectory - only it (and top-level files) is fetched and checked out
+	Tag       string // Check out this tag instead of a branch
+	Commit    string // Check out this commit (full SHA) instead of a branch head
 }
 
 // CloneResult represents the result of a clone operation
 type CloneResult struct {
-	Path      string // Path to cloned repository
-	CommitSHA string // SHA of the checked out commit
-	Branch    string // Branch that was checked out
+	Path          string // Path to cloned repository
+	CommitSHA     string // SHA of the checked out commit
+	Branch        string // Branch that was checked out
+	CommitAuthor  string // Author name of the checked out commit
+	CommitMessage string // Full message of the checked out commit
+}
+
+// Commit returns the checked out commit's metadata
+func (r *CloneResult) Commit() CommitInfo {
+	return CommitInfo{
+		SHA:     r.CommitSHA,
+		Author:  r.CommitAuthor,
+		Message: r.CommitMessage,
+		Branch:  r.Branch,
+	}
+}
+
+// CommitInfo is the commit a deployment's image was built from
+type CommitInfo struct {
+	SHA     string
+	Author  string
+	Message string
+	Branch  string
+}
+
+// ShortSHA returns the abbreviated SHA git shows (7 characters)
+func (c CommitInfo) ShortSHA() string {
+	if len(c.SHA) > 7 {
+		return c.SHA[:7]
+	}
+	return c.SHA
+}
+
+// Title returns the first line of the commit message
+func (c CommitInfo) Title() string {
+	title, _, _ := strings.Cut(strings.TrimSpace(c.Message), "\n")
+	return strings.TrimSpace(title)
+}
+
+// Summary describes the commit in one line, e.g. "abc1234: fix login bug"; empty without a SHA
+func (c CommitInfo) Summary() string {
+	if c.SHA == "" {
+		return ""
+	}
+	if title := c.Title(); title != "" {
+		return c.ShortSHA() + ": " + title
+	}
+	return c.ShortSHA()
+}
+
+// gitHosts are the Git hosts apps can be deployed from
+var gitHosts = []string{"github.com", "gitlab.com", "bitbucket.org"}
+
+// isSupportedGitHost reports whether repoURL points at one of gitHosts (in any URL form)
+func isSupportedGitHost(repoURL string) bool {
+	for _, host := range gitHosts {
+		if strings.Contains(repoURL, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasGitHostPrefix reports whether repoURL is an HTTPS URL of a repository on one of gitHosts
+func hasGitHostPrefix(repoURL string) bool {
+	for _, host := range gitHosts {
+		if strings.HasPrefix(repoURL, "https://"+host+"/") {
+			return true
+		}
+	}
+	return false
 }
 
 // ValidatePublicRepo validates that a repository is public and accessible
 func (s *GitService) ValidatePublicRepo(ctx context.Context, repoURL string) error {
-	// Parse GitHub URL
-	if !strings.Contains(repoURL, "github.com") {
-		return fmt.Errorf("only GitHub repositories are supported")
+	if !isSupportedGitHost(repoURL) {
+		return fmt.Errorf("only GitHub, GitLab and Bitbucket repositories are supported")
 	}
 
 	// Convert SSH URL to HTTPS if needed
 	httpsURL := s.normalizeGitHubURL(repoURL)
 
+	// GitLab and Bitbucket are checked with an anonymous ls-remote rather than their APIs
+	if !strings.Contains(httpsURL, "github.com") {
+		return s.validatePublicRemote(ctx, repoURL, httpsURL)
+	}
+
 	// Try to access the repository via GitHub API or HTTP
 	// For GitHub, we can check if the repo is public by trying to access it
 	apiURL := s.getGitHubAPIURL(httpsURL)
@@ -101,6 +182,29 @@ func (s *GitService) ValidatePublicRepo(ctx context.Context, repoURL string) err
 	return nil
 }
 
+// validatePublicRemote checks that a repository can be listed without credentials
+func (s *GitService) validatePublicRemote(ctx context.Context, repoURL, httpsURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: "origin", URLs: []string{httpsURL}})
+	if _, err := remote.ListContext(ctx, &git.ListOptions{}); err != nil {
+		switch {
+		case errors.Is(err, transport.ErrRepositoryNotFound):
+			return stackynerrors.New(stackynerrors.ErrorCodeRepoNotFound, fmt.Sprintf("Repository %s not found or branch doesn't exist", repoURL))
+		case errors.Is(err, transport.ErrAuthenticationRequired), errors.Is(err, transport.ErrAuthorizationFailed):
+			// GitLab and Bitbucket ask for credentials for private and missing repositories alike
+			return stackynerrors.New(stackynerrors.ErrorCodeRepoPrivateUnsupported, fmt.Sprintf("Repository %s appears to be private or does not exist", repoURL))
+		case errors.Is(err, transport.ErrEmptyRemoteRepository):
+			return stackynerrors.New(stackynerrors.ErrorCodeRepoNotFound, fmt.Sprintf("Repository %s is empty", repoURL))
+		}
+		return stackynerrors.New(stackynerrors.ErrorCodeRepoNotFound, fmt.Sprintf("Repository %s is not accessible", repoURL))
+	}
+
+	s.logger.Info("Repository validated as public", zap.String("repo_url", repoURL))
+	return nil
+}
+
 // Clone clones a repository to a temporary directory
 func (s *GitService) Clone(ctx context.Context, opts CloneOptions) (*CloneResult, error) {
 	// Validate repository is public
@@ -152,6 +256,10 @@ func (s *GitService) Clone(ctx context.Context, opts CloneOptions) (*CloneResult
 		gitCloneOpts.ReferenceName = plumbing.NewBranchReferenceName(opts.Branch)
 		gitCloneOpts.SingleBranch = true
 	}
+	if opts.Tag != "" {
+		gitCloneOpts.ReferenceName = plumbing.NewTagReferenceName(opts.Tag)
+		gitCloneOpts.SingleBranch = true
+	}
 
 	// Configure shallow clone
 	if opts.Shallow {
@@ -171,11 +279,39 @@ func (s *GitService) Clone(ctx context.Context, opts CloneOptions) (*CloneResult
 		zap.String("unique_id", opts.UniqueID),
 	)
 
+	// Pinned commits are fetched on their own; monorepo builds fetch only their subdirectory when the
+	// git CLI can do a partial clone
+	var repo *git.Repository
+	var err error
+	if opts.Commit != "" {
+		if repo, err = s.cloneCommit(ctx, httpsURL, clonePath, opts.Commit); err != nil {
+			return nil, stackynerrors.Wrap(stackynerrors.ErrorCodeRepoNotFound, err, fmt.Sprintf("Commit '%s' could not be fetched", opts.Commit))
+		}
+	} else if opts.SparseDir != "" {
+		if err := s.partialClone(ctx, httpsURL, clonePath, opts); err != nil {
+			s.logger.Warn("Partial clone failed, falling back to a full clone",
+				zap.Error(err),
+				zap.String("repo_url", httpsURL),
+				zap.String("sparse_dir", opts.SparseDir),
+			)
+			if err := os.RemoveAll(clonePath); err != nil {
+				return nil, fmt.Errorf("failed to remove partial clone: %w", err)
+			}
+		} else if repo, err = git.PlainOpen(clonePath); err != nil {
+			return nil, fmt.Errorf("failed to open partial clone: %w", err)
+		}
+	}
+
 	// Clone repository - PlainClone always fetches from remote, ensuring we get the latest code from the branch
-	repo, err := git.PlainClone(clonePath, false, gitCloneOpts)
+	if repo == nil {
+		repo, err = git.PlainClone(clonePath, false, gitCloneOpts)
+	}
 	if err != nil {
 		// Check for specific error types
 		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "does not exist") {
+			if opts.Tag != "" {
+				return nil, stackynerrors.New(stackynerrors.ErrorCodeRepoNotFound, fmt.Sprintf("Tag '%s' does not exist in repository", opts.Tag))
+			}
 			return nil, stackynerrors.New(stackynerrors.ErrorCodeRepoNotFound, fmt.Sprintf("Branch '%s' does not exist in repository", opts.Branch))
 		}
 		if strings.Contains(err.Error(), "authentication") || strings.Contains(err.Error(), "private") {
@@ -190,20 +326,135 @@ func (s *GitService) Clone(ctx context.Context, opts CloneOptions) (*CloneResult
 		return nil, fmt.Errorf("failed to get HEAD reference: %w", err)
 	}
 
-	commitSHA := ref.Hash().String()
-	branch := ref.Name().Short()
+	result := &CloneResult{
+		Path:      clonePath,
+		CommitSHA: ref.Hash().String(),
+		Branch:    ref.Name().Short(),
+	}
+	if !ref.Name().IsBranch() {
+		// Tags and pinned commits leave HEAD detached; the commit may be on any branch
+		result.Branch = opts.Branch
+	}
+
+	// Author and message are only shown on deployments, so a missing commit object does not fail the clone
+	if commit, err := repo.CommitObject(ref.Hash()); err == nil {
+		result.CommitAuthor = commit.Author.Name
+		result.CommitMessage = strings.TrimSpace(commit.Message)
+	} else {
+		s.logger.Warn("Failed to read checked out commit", zap.Error(err), zap.String("commit_sha", result.CommitSHA))
+	}
 
 	s.logger.Info("Repository cloned successfully",
 		zap.String("clone_path", clonePath),
-		zap.String("commit_sha", commitSHA),
-		zap.String("branch", branch),
+		zap.String("commit_sha", result.CommitSHA),
+		zap.String("branch", result.Branch),
 	)
 
-	return &CloneResult{
-		Path:      clonePath,
-		CommitSHA: commitSHA,
-		Branch:    branch,
-	}, nil
+	return result, nil
+}
+
+// partialClone clones with the git CLI as a blobless partial clone (--filter=blob:none) limited by
+// a cone-mode sparse checkout to opts.SparseDir, so only the blobs under that directory and the
+// top-level files are downloaded. go-git supports neither filters nor partial clones.
+// Servers without filter support make git fall back to a regular clone on its own; any other
+// failure (no git binary, git too old for sparse-checkout) is returned so the caller can fall back
+func (s *GitService) partialClone(ctx context.Context, repoURL, clonePath string, opts CloneOptions) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git CLI not available: %w", err)
+	}
+
+	args := []string{"clone", "--filter=blob:none", "--sparse", "--no-tags"}
+	if opts.Branch != "" {
+		args = append(args, "--branch", opts.Branch, "--single-branch")
+	}
+	if opts.Shallow {
+		depth := opts.Depth
+		if depth == 0 {
+			depth = 1
+		}
+		args = append(args, "--depth", fmt.Sprintf("%d", depth))
+	}
+	args = append(args, "--", repoURL, clonePath)
+
+	output, err := s.runGit(ctx, "", args...)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(output, "filtering not recognized by server") {
+		s.logger.Info("Git server does not support partial clone filters - fetched all blobs",
+			zap.String("repo_url", repoURL),
+		)
+	}
+
+	if _, err := s.runGit(ctx, clonePath, "sparse-checkout", "set", "--cone", "--", opts.SparseDir); err != nil {
+		return err
+	}
+
+	s.logger.Info("Partial clone completed",
+		zap.String("repo_url", repoURL),
+		zap.String("sparse_dir", opts.SparseDir),
+		zap.String("clone_path", clonePath),
+	)
+	return nil
+}
+
+// cloneCommit checks out a single commit into clonePath
+// The git CLI fetches just that commit (GitHub and most hosts allow fetching reachable commits by SHA);
+// without the CLI, or when the server refuses, go-git clones the full history and checks the commit out
+func (s *GitService) cloneCommit(ctx context.Context, repoURL, clonePath, commit string) (*git.Repository, error) {
+	if _, err := exec.LookPath("git"); err == nil {
+		fetchErr := func() error {
+			if _, err := s.runGit(ctx, "", "init", "--quiet", clonePath); err != nil {
+				return err
+			}
+			if _, err := s.runGit(ctx, clonePath, "remote", "add", "origin", repoURL); err != nil {
+				return err
+			}
+			if _, err := s.runGit(ctx, clonePath, "fetch", "--depth", "1", "--no-tags", "origin", commit); err != nil {
+				return err
+			}
+			_, err := s.runGit(ctx, clonePath, "checkout", "--quiet", "--detach", "FETCH_HEAD")
+			return err
+		}()
+		if fetchErr == nil {
+			return git.PlainOpen(clonePath)
+		}
+		s.logger.Warn("Fetching commit by SHA failed, falling back to a full clone",
+			zap.Error(fetchErr),
+			zap.String("repo_url", repoURL),
+			zap.String("commit", commit),
+		)
+		if err := os.RemoveAll(clonePath); err != nil {
+			return nil, fmt.Errorf("failed to remove partial fetch: %w", err)
+		}
+	}
+
+	repo, err := git.PlainCloneContext(ctx, clonePath, false, &git.CloneOptions{URL: repoURL})
+	if err != nil {
+		return nil, err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: plumbing.NewHash(commit)}); err != nil {
+		return nil, fmt.Errorf("commit %s not found in repository: %w", commit, err)
+	}
+	return repo, nil
+}
+
+// runGit runs a git CLI command without ever prompting for credentials and returns its combined output
+func (s *GitService) runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return output.String(), fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(output.String()))
+	}
+	return output.String(), nil
 }
 
 // Cleanup removes a cloned repository
@@ -261,11 +512,13 @@ func (s *GitService) CleanupAppRepos(ctx context.Context, repoURL string) error
 	return nil
 }
 
-// normalizeGitHubURL converts SSH URLs to HTTPS and normalizes GitHub URLs
+// normalizeGitHubURL converts SSH URLs to HTTPS and normalizes GitHub, GitLab and Bitbucket URLs
 func (s *GitService) normalizeGitHubURL(url string) string {
 	// Convert SSH URL to HTTPS
-	if strings.HasPrefix(url, "git@github.com:") {
-		url = strings.Replace(url, "git@github.com:", "https://github.com/", 1)
+	for _, host := range gitHosts {
+		if strings.HasPrefix(url, "git@"+host+":") {
+			url = strings.Replace(url, "git@"+host+":", "https://"+host+"/", 1)
+		}
 	}
 
 	// Remove .git suffix if present
@@ -273,8 +526,8 @@ func (s *GitService) normalizeGitHubURL(url string) string {
 
 	// Ensure it's an HTTPS URL
 	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
-		// Assume it's a GitHub repo and add https://
-		if strings.Contains(url, "github.com") {
+		// Assume it's a repo on a supported host and add https://
+		if isSupportedGitHost(url) {
 			url = "https://" + url
 		}
 	}
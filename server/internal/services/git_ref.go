@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"go.uber.org/zap"
+)
+
+// Kinds of git refs a deploy can be pinned to
+const (
+	RefKindBranch = "branch"
+	RefKindTag    = "tag"
+	RefKindCommit = "commit"
+)
+
+// ErrRefNotFound is returned by ResolveRef when the repository has no such branch, tag or commit
+var ErrRefNotFound = errors.New("ref not found in repository")
+
+// shaPattern matches full and abbreviated commit SHAs
+var shaPattern = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// ResolvedRef is a branch, tag or commit of a repository to build
+type ResolvedRef struct {
+	Kind string // RefKindBranch, RefKindTag or RefKindCommit
+	Name string // Branch or tag name; the full SHA for commits
+	SHA  string // Commit the ref points to (for tags, the tag object when the tag is annotated); empty when unknown
+}
+
+// ResolveRef looks ref up in the repository at repoURL: a branch or tag of that name, or otherwise a commit
+// Branches and tags are listed from the remote (like git ls-remote). Commits are checked with the GitHub API,
+// which also expands abbreviated SHAs; other hosts need the full 40-character SHA, checked when it is cloned
+func (s *GitService) ResolveRef(ctx context.Context, repoURL, ref string) (*ResolvedRef, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "-") || strings.ContainsAny(ref, " ~^:?*[\\") || strings.Contains(ref, "..") {
+		return nil, fmt.Errorf("%w: %q is not a valid branch, tag or commit", ErrRefNotFound, ref)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	httpsURL := s.normalizeGitHubURL(repoURL)
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: "origin", URLs: []string{httpsURL}})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repository refs: %w", err)
+	}
+
+	branchName := plumbing.NewBranchReferenceName(strings.TrimPrefix(ref, "refs/heads/"))
+	tagName := plumbing.NewTagReferenceName(strings.TrimPrefix(ref, "refs/tags/"))
+	for _, r := range refs {
+		switch r.Name() {
+		case branchName:
+			return &ResolvedRef{Kind: RefKindBranch, Name: branchName.Short(), SHA: r.Hash().String()}, nil
+		case tagName:
+			return &ResolvedRef{Kind: RefKindTag, Name: tagName.Short(), SHA: r.Hash().String()}, nil
+		}
+	}
+
+	if !shaPattern.MatchString(ref) {
+		return nil, fmt.Errorf("%w: no branch or tag named %q", ErrRefNotFound, ref)
+	}
+	sha := strings.ToLower(ref)
+
+	// A branch or tag tip needs no further lookup
+	for _, r := range refs {
+		if strings.HasPrefix(r.Hash().String(), sha) && (r.Name().IsBranch() || r.Name().IsTag()) {
+			return &ResolvedRef{Kind: RefKindCommit, Name: r.Hash().String(), SHA: r.Hash().String()}, nil
+		}
+	}
+
+	if apiURL := s.getGitHubAPIURL(httpsURL); apiURL != "" {
+		fullSHA, err := s.lookupGitHubCommit(ctx, apiURL, sha)
+		if err != nil {
+			return nil, err
+		}
+		return &ResolvedRef{Kind: RefKindCommit, Name: fullSHA, SHA: fullSHA}, nil
+	}
+
+	if len(sha) != 40 {
+		return nil, fmt.Errorf("%w: use the full 40-character SHA to deploy commit %q", ErrRefNotFound, ref)
+	}
+	return &ResolvedRef{Kind: RefKindCommit, Name: sha, SHA: sha}, nil
+}
+
+// lookupGitHubCommit returns the full SHA of a (possibly abbreviated) commit of a GitHub repository
+func (s *GitService) lookupGitHubCommit(ctx context.Context, apiURL, sha string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL+"/commits/"+sha, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up commit: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnprocessableEntity:
+		return "", fmt.Errorf("%w: no commit %q", ErrRefNotFound, sha)
+	case resp.StatusCode >= 400:
+		s.logger.Warn("GitHub commit lookup failed", zap.Int("status_code", resp.StatusCode), zap.String("commit", sha))
+		return "", fmt.Errorf("failed to look up commit (status: %d)", resp.StatusCode)
+	}
+
+	var commit struct {
+		SHA string `json:"sha"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&commit); err != nil || commit.SHA == "" {
+		return "", fmt.Errorf("failed to decode commit lookup response")
+	}
+	return commit.SHA, nil
+}
@@ -55,7 +55,7 @@ func (s *HealthCheckService) CheckAppAccessibility(ctx context.Context, appID, d
 	if err != nil {
 		errorMsg := fmt.Sprintf("Container not found or inaccessible: %v", err)
 		s.handleHealthCheckFailure(appID, deploymentID, errorMsg)
-		return fmt.Errorf(errorMsg)
+		return fmt.Errorf("%s", errorMsg)
 	}
 
 	if !containerJSON.State.Running {
@@ -66,7 +66,7 @@ func (s *HealthCheckService) CheckAppAccessibility(ctx context.Context, appID, d
 			errorMsg += fmt.Sprintf(" - %s", logs)
 		}
 		s.handleHealthCheckFailure(appID, deploymentID, errorMsg)
-		return fmt.Errorf(errorMsg)
+		return fmt.Errorf("%s", errorMsg)
 	}
 
 	// 2. Check container health status (if healthcheck is configured)
@@ -115,7 +115,7 @@ func (s *HealthCheckService) CheckAppAccessibility(ctx context.Context, appID, d
 	if len(errors) > 0 {
 		errorMsg := strings.Join(errors, "; ")
 		s.handleHealthCheckFailure(appID, deploymentID, errorMsg)
-		return fmt.Errorf(errorMsg)
+		return fmt.Errorf("%s", errorMsg)
 	}
 
 	return nil
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"go.uber.org/zap"
+)
+
+// HostCapacity is what the Docker host app containers run on has and how much of it apps reserve
+type HostCapacity struct {
+	DockerVersion       string
+	OperatingSystem     string
+	CPUs                int
+	MemoryBytes         int64
+	CPUsReserved        float64    // CPU limits of the running app containers
+	MemoryReservedBytes int64      // Memory limits of the running app containers
+	Disk                *DiskUsage // Filesystem of the Docker data root; nil when it is not mounted into the worker
+	Containers          int
+	ContainersRunning   int
+	AppContainers       int // Running app (web) containers
+	Images              int
+	ImagesBytes         int64
+}
+
+// HostCapacity measures the Docker host: its CPUs, memory and disk, the containers and images on it, and
+// the CPU and memory limits of the app containers running there
+func (s *DeploymentService) HostCapacity(ctx context.Context) (*HostCapacity, error) {
+	info, err := s.client.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Docker host info: %w", err)
+	}
+	capacity := &HostCapacity{
+		DockerVersion:     info.ServerVersion,
+		OperatingSystem:   info.OperatingSystem,
+		CPUs:              info.NCPU,
+		MemoryBytes:       info.MemTotal,
+		Containers:        info.Containers,
+		ContainersRunning: info.ContainersRunning,
+	}
+
+	if info.DockerRootDir != "" {
+		if disk, err := statDisk("docker", info.DockerRootDir); err != nil {
+			s.logger.Debug("Skipping disk in host capacity", zap.Error(err), zap.String("path", info.DockerRootDir))
+		} else {
+			capacity.Disk = &disk
+		}
+	}
+
+	images, err := s.client.ImageList(ctx, image.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	capacity.Images = len(images)
+	for _, img := range images {
+		capacity.ImagesBytes += img.Size
+	}
+
+	containers, err := s.client.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", "app.id")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list app containers: %w", err)
+	}
+	capacity.AppContainers = len(containers)
+	for _, c := range containers {
+		inspect, err := s.client.ContainerInspect(ctx, c.ID)
+		if err != nil || inspect.HostConfig == nil {
+			continue // Removed since it was listed
+		}
+		capacity.CPUsReserved += float64(inspect.HostConfig.NanoCPUs) / 1e9
+		capacity.MemoryReservedBytes += inspect.HostConfig.Memory
+	}
+
+	return capacity, nil
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+	"go.uber.org/zap"
+)
+
+// defaultDeployRAMMB is the memory a deploy task without requested_ram_mb starts its container with
+const defaultDeployRAMMB = 512
+
+// HostScheduler picks the Docker host a deploy goes to, and knows the host an app runs on (api.HostRepo)
+type HostScheduler interface {
+	ScheduleDeploy(ctx context.Context, appID string, ramMB, diskMB int) (string, error)
+	AppHost(ctx context.Context, appID string) (string, error)
+}
+
+// HostQueue is the queue of a deploy queue that only the deploy workers on host serve
+func HostQueue(queue, host string) string {
+	return queue + "@" + host
+}
+
+// SetHostScheduler places the deploys this service enqueues on a host and queues them for that host's
+// deploy workers. Without it (or with a single host) deploys go to the shared deploy queues
+func (s *TaskEnqueueService) SetHostScheduler(scheduler HostScheduler) {
+	s.hostScheduler = scheduler
+}
+
+// deployPlacement is the part of a deploy payload the scheduler places it by
+type deployPlacement struct {
+	AppID            string `json:"app_id"`
+	RequestedRAMMB   int    `json:"requested_ram_mb"`
+	UseDockerCompose bool   `json:"use_docker_compose"`
+	ImageHost        string `json:"image_host"`
+}
+
+// scheduleDeploy returns the host a deploy goes to, or "" to leave it on the shared queue
+// Compose deploys stay on the host that built them, which has the cloned repository they run from
+// Others need room for the RAM their container is started with and the disk their owner's plan allows
+func (s *TaskEnqueueService) scheduleDeploy(ctx context.Context, placement deployPlacement, userID string) string {
+	if s.hostScheduler == nil || placement.AppID == "" {
+		return ""
+	}
+	if placement.UseDockerCompose {
+		return placement.ImageHost
+	}
+
+	ramMB := placement.RequestedRAMMB
+	if ramMB <= 0 {
+		ramMB = defaultDeployRAMMB
+	}
+	var diskMB int
+	if s.planEnforcement != nil {
+		if limits, err := s.planEnforcement.GetPlanLimits(ctx, userID); err != nil {
+			s.logger.Warn("Failed to get plan limits, scheduling on memory alone", zap.Error(err), zap.String("user_id", userID))
+		} else {
+			diskMB = limits.MaxDiskMB
+		}
+	}
+
+	host, err := s.hostScheduler.ScheduleDeploy(ctx, placement.AppID, ramMB, diskMB)
+	if err != nil {
+		s.logger.Warn("Failed to schedule deploy, leaving it on the shared queue", zap.Error(err), zap.String("app_id", placement.AppID))
+		return ""
+	}
+	return host
+}
+
+// appQueue is the queue of a task run against an app's containers, volumes or image (cron runs, execs,
+// exports, wakes, stops and starts): the queue of the host the app runs on, or queue itself with a single host
+func (s *TaskEnqueueService) appQueue(ctx context.Context, queue string, payload []byte) string {
+	if s.hostScheduler == nil {
+		return queue
+	}
+	var key struct {
+		AppID string `json:"app_id"`
+	}
+	if err := json.Unmarshal(payload, &key); err != nil || key.AppID == "" {
+		return queue
+	}
+	host, err := s.hostScheduler.AppHost(ctx, key.AppID)
+	if err != nil {
+		s.logger.Warn("Failed to look up app host, leaving task on the shared queue", zap.Error(err), zap.String("app_id", key.AppID))
+		return queue
+	}
+	if host == "" {
+		return queue
+	}
+	return HostQueue(queue, host)
+}
+
+// SetRemoteDockerTLS sets the client certificate used to reach other hosts' Docker daemons
+// (DOCKER_TLS_ENABLED with DOCKER_CA_PATH, DOCKER_CERT_PATH and DOCKER_KEY_PATH)
+func (s *DeploymentService) SetRemoteDockerTLS(caPath, certPath, keyPath string) {
+	s.remoteTLS = &remoteDockerTLS{caPath: caPath, certPath: certPath, keyPath: keyPath}
+}
+
+// remoteDockerTLS is the client certificate of SetRemoteDockerTLS
+type remoteDockerTLS struct {
+	caPath   string
+	certPath string
+	keyPath  string
+}
+
+// CopyImage copies an image missing on this host from the Docker daemon at endpoint (another host's
+// NODE_DOCKER_ENDPOINT), for deploys placed on a different host than the one that built their image
+// Does nothing when the image is already here
+func (s *DeploymentService) CopyImage(ctx context.Context, endpoint, imageRef string) error {
+	if _, _, err := s.client.ImageInspectWithRaw(ctx, imageRef); err == nil {
+		return nil
+	} else if !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to inspect image %s: %w", imageRef, err)
+	}
+	if endpoint == "" {
+		return fmt.Errorf("image %s is not on this host and its host has no Docker endpoint", imageRef)
+	}
+
+	opts := []client.Opt{client.WithHost(endpoint), client.WithAPIVersionNegotiation()}
+	if s.remoteTLS != nil {
+		opts = append(opts, client.WithTLSClientConfig(s.remoteTLS.caPath, s.remoteTLS.certPath, s.remoteTLS.keyPath))
+	}
+	remote, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create Docker client for %s: %w", endpoint, err)
+	}
+	defer remote.Close()
+
+	startedAt := time.Now()
+	saved, err := remote.ImageSave(ctx, []string{imageRef})
+	if err != nil {
+		return fmt.Errorf("failed to export image %s from %s: %w", imageRef, endpoint, err)
+	}
+	defer saved.Close()
+
+	loaded, err := s.client.ImageLoad(ctx, saved, client.ImageLoadWithQuiet(true))
+	if err != nil {
+		return fmt.Errorf("failed to load image %s: %w", imageRef, err)
+	}
+	loaded.Body.Close()
+
+	if _, _, err := s.client.ImageInspectWithRaw(ctx, imageRef); err != nil {
+		return fmt.Errorf("image %s missing after copying it from %s: %w", imageRef, endpoint, err)
+	}
+	s.logger.Info("Copied image from another host",
+		zap.String("image", imageRef),
+		zap.String("endpoint", endpoint),
+		zap.Duration("duration", time.Since(startedAt)),
+	)
+	return nil
+}
+
+// RetireAppContainers stops and removes the app's containers on this host, for apps that moved to
+// another host. Returns the IDs of the containers stopped
+func (s *DeploymentService) RetireAppContainers(ctx context.Context, appID string) ([]string, error) {
+	return s.stopOldContainersForApp(ctx, appID, "")
+}
+
+// RemoteAppRoute is an app running on another host, which this host's Traefik forwards requests for
+type RemoteAppRoute struct {
+	AppID         string
+	Subdomain     string
+	CustomDomains []string
+	Host          string // Host the app runs on
+	Address       string // That host's Traefik (its NODE_ADDRESS)
+}
+
+// ForwardingConfig is the Traefik dynamic configuration (served to its HTTP provider) forwarding requests
+// for apps on other hosts to those hosts' Traefik, which route them to the app as usual
+// Routers get priority 2 - above the fallback page's catch-all, below the app routers of local containers -
+// so while an app moves, its container on this host keeps the traffic until it is retired. The other host's certificate is not verified: it cannot get a Let's Encrypt
+// certificate for hosts whose DNS points here, and the hop stays between the platform's own hosts
+func ForwardingConfig(routes []RemoteAppRoute) map[string]interface{} {
+	routers := map[string]interface{}{}
+	backends := map[string]interface{}{}
+	for _, route := range routes {
+		name := fmt.Sprintf("remote-%s", route.AppID)
+		hosts := make([]string, 0, len(route.CustomDomains)+1)
+		if route.Subdomain != "" {
+			hosts = append(hosts, fmt.Sprintf("Host(`%s`)", route.Subdomain))
+		}
+		for _, domain := range route.CustomDomains {
+			hosts = append(hosts, fmt.Sprintf("Host(`%s`)", domain))
+		}
+		if len(hosts) == 0 {
+			continue
+		}
+		rule := strings.Join(hosts, " || ")
+
+		routers[name+"-http"] = map[string]interface{}{
+			"rule":        rule,
+			"entryPoints": []string{"web"},
+			"service":     name,
+			"priority":    2,
+		}
+		routers[name] = map[string]interface{}{
+			"rule":        rule,
+			"entryPoints": []string{"websecure"},
+			"service":     name,
+			"priority":    2,
+			"tls":         map[string]interface{}{"certResolver": "letsencrypt"},
+		}
+		backends[name] = map[string]interface{}{
+			"loadBalancer": map[string]interface{}{
+				"servers":          []map[string]string{{"url": route.Address}},
+				"passHostHeader":   true,
+				"serversTransport": "stackyn-hosts",
+			},
+		}
+	}
+
+	httpConfig := map[string]interface{}{
+		"routers":  routers,
+		"services": backends,
+		"serversTransports": map[string]interface{}{
+			"stackyn-hosts": map[string]interface{}{"insecureSkipVerify": true},
+		},
+	}
+	return map[string]interface{}{"http": httpConfig}
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// idempotencyKeyPrefix namespaces the stored responses in Redis
+	idempotencyKeyPrefix = "stackyn:idempotency:"
+	// idempotencyClaimTTL frees the key of a request whose API instance died before it answered;
+	// requests are cut off after 70 seconds
+	idempotencyClaimTTL = 2 * time.Minute
+)
+
+// IdempotentResponse is what a request sent with an Idempotency-Key answered, replayed to its retries
+type IdempotentResponse struct {
+	Fingerprint string `json:"fingerprint"` // Hash of the request body; retries must send the same one
+	Status      int    `json:"status"`      // 0 while the first request is still running
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// IdempotencyStore keeps the responses of requests sent with an Idempotency-Key in Redis, so a retry
+// reaching any API instance gets the first response instead of repeating its effects
+type IdempotencyStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewIdempotencyStore keeps responses in Redis through client (see NewRedisClient) for ttl
+func NewIdempotencyStore(client *redis.Client, ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{client: client, ttl: ttl}
+}
+
+// IdempotencyKey scopes a client's Idempotency-Key to the user and the route it was sent to, so keys
+// of different users or endpoints never collide
+func IdempotencyKey(userID, route, key string) string {
+	sum := sha256.Sum256([]byte(userID + "\x00" + route + "\x00" + key))
+	return idempotencyKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// Claim reserves key for a request with fingerprint. It returns nil when the request is the first with
+// the key and must run, or what the key already holds: a finished response (Status set) to replay, or
+// a request still running (Status 0)
+func (s *IdempotencyStore) Claim(ctx context.Context, key, fingerprint string) (*IdempotentResponse, error) {
+	claim, err := json.Marshal(IdempotentResponse{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, err
+	}
+
+	// The stored response can expire between SETNX and GET; the second attempt then claims the key
+	for attempt := 0; attempt < 2; attempt++ {
+		claimed, err := s.client.SetNX(ctx, key, claim, idempotencyClaimTTL).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+		}
+		if claimed {
+			return nil, nil
+		}
+
+		raw, err := s.client.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get idempotent response: %w", err)
+		}
+		var existing IdempotentResponse
+		if err := json.Unmarshal(raw, &existing); err != nil {
+			return nil, fmt.Errorf("failed to decode idempotent response: %w", err)
+		}
+		return &existing, nil
+	}
+	return nil, fmt.Errorf("failed to claim idempotency key: it keeps expiring")
+}
+
+// Complete stores the response of the request that claimed key, replayed to retries until the TTL ends
+func (s *IdempotencyStore) Complete(ctx context.Context, key string, response IdempotentResponse) error {
+	raw, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	if err := s.client.Set(ctx, key, raw, s.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Release frees key without storing a response, so the next retry runs again
+func (s *IdempotencyStore) Release(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, key).Err(); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// InvoiceProvider lists a subscription's invoices at the payment provider
+type InvoiceProvider interface {
+	ListSubscriptionInvoices(ctx context.Context, subscriptionID string) ([]Invoice, error)
+}
+
+// invoiceCacheEntry is a cached billing history with its expiry
+type invoiceCacheEntry struct {
+	invoices  []Invoice
+	expiresAt time.Time
+}
+
+// InvoiceService serves users' billing history from the payment provider
+// Histories are cached per user - they only change when a billing webhook arrives, which invalidates them
+type InvoiceService struct {
+	logger              *zap.Logger
+	provider            InvoiceProvider
+	subscriptionService *SubscriptionService
+	cacheTTL            time.Duration
+
+	cache   map[string]invoiceCacheEntry // userID -> cached invoices
+	cacheMu sync.RWMutex
+}
+
+// NewInvoiceService creates a new invoice service
+func NewInvoiceService(logger *zap.Logger, provider InvoiceProvider, subscriptionService *SubscriptionService, cacheTTL time.Duration) *InvoiceService {
+	return &InvoiceService{
+		logger:              logger,
+		provider:            provider,
+		subscriptionService: subscriptionService,
+		cacheTTL:            cacheTTL,
+		cache:               make(map[string]invoiceCacheEntry),
+	}
+}
+
+// GetInvoices returns the invoices of the user's subscription, newest first, served from cache when fresh
+// Users without a paid subscription have no invoices
+func (s *InvoiceService) GetInvoices(ctx context.Context, userID string) ([]Invoice, error) {
+	s.cacheMu.RLock()
+	entry, ok := s.cache[userID]
+	s.cacheMu.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.invoices, nil
+	}
+
+	sub, err := s.subscriptionService.GetSubscriptionByUserID(ctx, userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+	invoices := []Invoice{}
+	if sub != nil && sub.LemonSubscriptionID != nil && *sub.LemonSubscriptionID != "" {
+		invoices, err = s.provider.ListSubscriptionInvoices(ctx, *sub.LemonSubscriptionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list invoices: %w", err)
+		}
+	}
+
+	s.cacheMu.Lock()
+	s.cache[userID] = invoiceCacheEntry{invoices: invoices, expiresAt: time.Now().Add(s.cacheTTL)}
+	s.cacheMu.Unlock()
+
+	return invoices, nil
+}
+
+// InvalidateUser drops a user's cached invoices (call when a billing event for the user arrives)
+func (s *InvoiceService) InvalidateUser(userID string) {
+	s.cacheMu.Lock()
+	delete(s.cache, userID)
+	s.cacheMu.Unlock()
+}
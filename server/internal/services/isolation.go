@@ -0,0 +1,121 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/docker/docker/api/types/container"
+	"go.uber.org/zap"
+)
+
+// IsolationLevel is how tightly an app's containers are confined on the host Docker daemon
+// Each plan sets a level (plans.isolation); an app may opt into a stricter one (apps.isolation)
+type IsolationLevel string
+
+const (
+	// IsolationStandard runs containers with Docker's defaults
+	IsolationStandard IsolationLevel = "standard"
+	// IsolationHardened adds no-new-privileges, the seccomp profile (ISOLATION_SECCOMP_PROFILE), a minimal
+	// capability set and a process limit
+	IsolationHardened IsolationLevel = "hardened"
+	// IsolationStrict is hardened with a read-only root filesystem (writable /tmp) and the sandbox runtime
+	// (ISOLATION_RUNTIME, e.g. gVisor's runsc) - for untrusted workloads such as trials and the free plan
+	IsolationStrict IsolationLevel = "strict"
+)
+
+// DefaultIsolationLevel is the level of plans that don't set one, and of the hardcoded default plan limits
+const DefaultIsolationLevel = IsolationStrict
+
+// isolationCapabilities are the capabilities hardened and strict containers keep - enough for images that
+// start as root to chown their files and drop to an unprivileged user
+var isolationCapabilities = []string{"CHOWN", "DAC_OVERRIDE", "FOWNER", "SETGID", "SETUID", "KILL", "NET_BIND_SERVICE"}
+
+// Process limits (pids cgroup) of hardened and strict containers
+const (
+	hardenedPidsLimit int64 = 1024
+	strictPidsLimit   int64 = 256
+)
+
+// strictTmpfs is the writable scratch space of strict containers, whose root filesystem is read-only
+const strictTmpfs = "rw,nosuid,nodev,size=256m"
+
+// ParseIsolationLevel validates an isolation level name
+func ParseIsolationLevel(name string) (IsolationLevel, error) {
+	switch level := IsolationLevel(name); level {
+	case IsolationStandard, IsolationHardened, IsolationStrict:
+		return level, nil
+	}
+	return "", fmt.Errorf("isolation must be one of %s, %s or %s", IsolationStandard, IsolationHardened, IsolationStrict)
+}
+
+// rank orders levels from the least (0) to the most confined; unknown levels count as strict
+func (l IsolationLevel) rank() int {
+	switch l {
+	case IsolationStandard:
+		return 0
+	case IsolationHardened:
+		return 1
+	}
+	return 2
+}
+
+// StricterIsolation returns the more confining of two levels; an empty level defers to the other
+func StricterIsolation(a, b IsolationLevel) IsolationLevel {
+	if a == "" {
+		return b
+	}
+	if b == "" || a.rank() >= b.rank() {
+		return a
+	}
+	return b
+}
+
+// SetIsolation configures what hardened and strict containers run with on this host
+// runtime is the OCI runtime strict containers use (e.g. "runsc" for gVisor, registered with the Docker
+// daemon); empty keeps the daemon's default runtime. seccompProfilePath is a seccomp profile (JSON, as
+// for docker run --security-opt seccomp=...) applied to hardened and strict containers; empty keeps Docker's
+// default profile. Rootless mode is a property of the daemon: point DOCKER_HOST at a rootless Docker
+func (s *DeploymentService) SetIsolation(runtime, seccompProfilePath string) error {
+	if seccompProfilePath != "" {
+		profile, err := os.ReadFile(seccompProfilePath)
+		if err != nil {
+			return fmt.Errorf("failed to read seccomp profile: %w", err)
+		}
+		if !json.Valid(profile) {
+			return fmt.Errorf("seccomp profile %s is not valid JSON", seccompProfilePath)
+		}
+		s.seccompProfile = string(profile)
+	}
+	s.isolationRuntime = runtime
+
+	s.logger.Info("Isolation configured",
+		zap.String("runtime", runtime),
+		zap.String("seccomp_profile", seccompProfilePath),
+	)
+	return nil
+}
+
+// applyIsolation confines a container about to be created to level
+// Containers whose level was never resolved ("") get the strictest settings
+func (s *DeploymentService) applyIsolation(hostConfig *container.HostConfig, level IsolationLevel) {
+	if level == IsolationStandard {
+		return
+	}
+
+	hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "no-new-privileges:true")
+	if s.seccompProfile != "" {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "seccomp="+s.seccompProfile)
+	}
+	hostConfig.CapDrop = []string{"ALL"}
+	hostConfig.CapAdd = isolationCapabilities
+
+	pidsLimit := hardenedPidsLimit
+	if level.rank() >= IsolationStrict.rank() {
+		pidsLimit = strictPidsLimit
+		hostConfig.ReadonlyRootfs = true
+		hostConfig.Tmpfs = map[string]string{"/tmp": strictTmpfs}
+		hostConfig.Runtime = s.isolationRuntime
+	}
+	hostConfig.Resources.PidsLimit = &pidsLimit
+}
@@ -16,6 +16,9 @@ type JWTService struct {
 type Claims struct {
 	UserID string `json:"user_id"`
 	Email  string `json:"email"`
+	// Set on impersonation tokens only - the admin acting as UserID and the session their actions are audited under
+	ImpersonatorEmail string `json:"impersonator_email,omitempty"`
+	ImpersonationID   string `json:"impersonation_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -50,6 +53,31 @@ func (s *JWTService) GenerateToken(userID, email string, expirationSeconds int)
 	return tokenString, nil
 }
 
+// GenerateImpersonationToken generates a token that acts as a user on behalf of an admin
+// The impersonation claims flag it, so only the impersonation middleware accepts it and every request is audited
+func (s *JWTService) GenerateImpersonationToken(userID, email, impersonatorEmail, impersonationID string, expiresAt time.Time) (string, error) {
+	claims := &Claims{
+		UserID:            userID,
+		Email:             email,
+		ImpersonatorEmail: impersonatorEmail,
+		ImpersonationID:   impersonationID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(s.secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign impersonation token: %w", err)
+	}
+
+	return tokenString, nil
+}
+
 // ValidateToken validates a JWT token and returns the claims
 func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
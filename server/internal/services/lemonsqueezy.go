@@ -0,0 +1,245 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LemonSqueezyClient is a minimal client for the Lemon Squeezy REST API
+type LemonSqueezyClient struct {
+	logger  *zap.Logger
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// lemonSqueezyCustomerResponse is the JSON:API response for GET /v1/customers/{id}
+type lemonSqueezyCustomerResponse struct {
+	Data struct {
+		ID         string `json:"id"`
+		Attributes struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// lemonSqueezySubscriptionUpdate is the JSON:API body for PATCH /v1/subscriptions/{id}
+type lemonSqueezySubscriptionUpdate struct {
+	Data struct {
+		Type       string `json:"type"`
+		ID         string `json:"id"`
+		Attributes struct {
+			VariantID          int  `json:"variant_id"`
+			InvoiceImmediately bool `json:"invoice_immediately"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// lemonSqueezyInvoicesResponse is the JSON:API response for GET /v1/subscription-invoices
+type lemonSqueezyInvoicesResponse struct {
+	Data []struct {
+		ID         string `json:"id"`
+		Attributes struct {
+			BillingReason  string    `json:"billing_reason"`
+			Status         string    `json:"status"`
+			Currency       string    `json:"currency"`
+			Total          int       `json:"total"`
+			TotalFormatted string    `json:"total_formatted"`
+			Refunded       bool      `json:"refunded"`
+			CreatedAt      time.Time `json:"created_at"`
+			URLs           struct {
+				InvoiceURL string `json:"invoice_url"`
+			} `json:"urls"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// Invoice is a billing history entry of a subscription
+type Invoice struct {
+	ID              string    `json:"id"`
+	Status          string    `json:"status"`         // pending | paid | void | refunded | partial_refund
+	BillingReason   string    `json:"billing_reason"` // initial | renewal | updated (plan changes)
+	Amount          int       `json:"amount"`         // In the smallest currency unit (cents)
+	AmountFormatted string    `json:"amount_formatted"`
+	Currency        string    `json:"currency"`
+	Date            time.Time `json:"date"`
+	InvoiceURL      string    `json:"invoice_url,omitempty"` // Hosted invoice page with the PDF
+}
+
+// NewLemonSqueezyClient creates a new Lemon Squeezy API client
+func NewLemonSqueezyClient(logger *zap.Logger, apiKey string) *LemonSqueezyClient {
+	return &LemonSqueezyClient{
+		logger:  logger,
+		apiKey:  apiKey,
+		baseURL: "https://api.lemonsqueezy.com/v1",
+		client: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+	}
+}
+
+// IsConfigured reports whether an API key is set
+func (c *LemonSqueezyClient) IsConfigured() bool {
+	return c != nil && c.apiKey != ""
+}
+
+// GetCustomerEmail retrieves a customer's email address by Lemon Squeezy customer ID
+func (c *LemonSqueezyClient) GetCustomerEmail(ctx context.Context, customerID string) (string, error) {
+	if !c.IsConfigured() {
+		return "", fmt.Errorf("lemon squeezy API key not configured")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/customers/%s", c.baseURL, url.PathEscape(customerID)), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.api+json")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to call Lemon Squeezy API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger.Warn("Lemon Squeezy customer lookup failed",
+			zap.String("customer_id", customerID),
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("body", string(body)),
+		)
+		return "", fmt.Errorf("lemon squeezy API returned status %d", resp.StatusCode)
+	}
+
+	var customer lemonSqueezyCustomerResponse
+	if err := json.Unmarshal(body, &customer); err != nil {
+		return "", fmt.Errorf("failed to parse customer response: %w", err)
+	}
+
+	if customer.Data.Attributes.Email == "" {
+		return "", fmt.Errorf("customer %s has no email", customerID)
+	}
+
+	return customer.Data.Attributes.Email, nil
+}
+
+// UpdateSubscriptionVariant switches a subscription to another variant (plan) in place, prorating the change
+// With invoiceImmediately the prorated amount is charged now; otherwise it is settled on the next renewal
+func (c *LemonSqueezyClient) UpdateSubscriptionVariant(ctx context.Context, subscriptionID string, variantID int, invoiceImmediately bool) error {
+	if !c.IsConfigured() {
+		return fmt.Errorf("lemon squeezy API key not configured")
+	}
+
+	var update lemonSqueezySubscriptionUpdate
+	update.Data.Type = "subscriptions"
+	update.Data.ID = subscriptionID
+	update.Data.Attributes.VariantID = variantID
+	update.Data.Attributes.InvoiceImmediately = invoiceImmediately
+	payload, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, fmt.Sprintf("%s/subscriptions/%s", c.baseURL, url.PathEscape(subscriptionID)), bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.api+json")
+	req.Header.Set("Content-Type", "application/vnd.api+json")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call Lemon Squeezy API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		c.logger.Warn("Lemon Squeezy subscription update failed",
+			zap.String("subscription_id", subscriptionID),
+			zap.Int("variant_id", variantID),
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("body", string(body)),
+		)
+		return fmt.Errorf("lemon squeezy API returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// ListSubscriptionInvoices retrieves a subscription's invoices, newest first (at most 100)
+func (c *LemonSqueezyClient) ListSubscriptionInvoices(ctx context.Context, subscriptionID string) ([]Invoice, error) {
+	if !c.IsConfigured() {
+		return nil, fmt.Errorf("lemon squeezy API key not configured")
+	}
+
+	query := url.Values{}
+	query.Set("filter[subscription_id]", subscriptionID)
+	query.Set("page[size]", "100")
+	query.Set("sort", "-created_at")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/subscription-invoices?%s", c.baseURL, query.Encode()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.api+json")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Lemon Squeezy API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger.Warn("Lemon Squeezy invoice lookup failed",
+			zap.String("subscription_id", subscriptionID),
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("body", string(body)),
+		)
+		return nil, fmt.Errorf("lemon squeezy API returned status %d", resp.StatusCode)
+	}
+
+	var list lemonSqueezyInvoicesResponse
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse invoices response: %w", err)
+	}
+
+	invoices := make([]Invoice, 0, len(list.Data))
+	for _, item := range list.Data {
+		status := item.Attributes.Status
+		if item.Attributes.Refunded {
+			status = "refunded"
+		}
+		invoices = append(invoices, Invoice{
+			ID:              item.ID,
+			Status:          status,
+			BillingReason:   item.Attributes.BillingReason,
+			Amount:          item.Attributes.Total,
+			AmountFormatted: item.Attributes.TotalFormatted,
+			Currency:        item.Attributes.Currency,
+			Date:            item.Attributes.CreatedAt,
+			InvoiceURL:      item.Attributes.URLs.InvoiceURL,
+		})
+	}
+	return invoices, nil
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// BuildLogDownloadTTL is how long a signed build log download URL stays valid
+const BuildLogDownloadTTL = 15 * time.Minute
+
+// LogDownloadSigner signs and verifies time-limited build log download URLs
+// The URL carries no credentials, so it can be opened by a browser download or passed to curl
+type LogDownloadSigner struct {
+	key []byte
+}
+
+// NewLogDownloadSigner creates a signer keyed from the server secret
+// The key is derived so download signatures can never be confused with other uses of the secret
+func NewLogDownloadSigner(secret string) *LogDownloadSigner {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("stackyn-build-log-download"))
+	return &LogDownloadSigner{key: mac.Sum(nil)}
+}
+
+// Sign returns the signature for downloading a deployment's build log until expires
+func (s *LogDownloadSigner) Sign(deploymentID string, expires time.Time) string {
+	return s.sign(deploymentID, expires.Unix())
+}
+
+// Verify checks a download signature and its expiry (a unix timestamp, as carried in the URL)
+func (s *LogDownloadSigner) Verify(deploymentID, expires, signature string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid expiry")
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign(deploymentID, expiresAt))) {
+		return fmt.Errorf("invalid signature")
+	}
+	if time.Now().Unix() > expiresAt {
+		return fmt.Errorf("download link has expired")
+	}
+	return nil
+}
+
+func (s *LogDownloadSigner) sign(deploymentID string, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(deploymentID))
+	mac.Write([]byte("."))
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLogDownloadSigner(t *testing.T) {
+	signer := NewLogDownloadSigner("server-secret")
+	expiresAt := time.Now().Add(BuildLogDownloadTTL)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	signature := signer.Sign("dep-1", expiresAt)
+
+	past := time.Now().Add(-time.Minute)
+	pastExpires := strconv.FormatInt(past.Unix(), 10)
+
+	tests := []struct {
+		name         string
+		signer       *LogDownloadSigner
+		deploymentID string
+		expires      string
+		signature    string
+		wantErr      string
+	}{
+		{"valid", signer, "dep-1", expires, signature, ""},
+		{"other deployment", signer, "dep-2", expires, signature, "invalid signature"},
+		{"extended expiry", signer, "dep-1", strconv.FormatInt(expiresAt.Add(time.Hour).Unix(), 10), signature, "invalid signature"},
+		{"malformed expiry", signer, "dep-1", "tomorrow", signature, "invalid expiry"},
+		{"missing signature", signer, "dep-1", expires, "", "invalid signature"},
+		{"truncated signature", signer, "dep-1", expires, signature[:len(signature)-1], "invalid signature"},
+		{"other secret", NewLogDownloadSigner("other-secret"), "dep-1", expires, signature, "invalid signature"},
+		{"expired", signer, "dep-1", pastExpires, signer.Sign("dep-1", past), "download link has expired"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.signer.Verify(tt.deploymentID, tt.expires, tt.signature)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Verify: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Verify err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLogDownloadSignerKeyIsDerived(t *testing.T) {
+	// The signature must not be a plain HMAC under the secret, which other features may compute
+	expiresAt := time.Unix(1900000000, 0)
+	plain := (&LogDownloadSigner{key: []byte("server-secret")}).Sign("dep-1", expiresAt)
+	if NewLogDownloadSigner("server-secret").Sign("dep-1", expiresAt) == plain {
+		t.Error("signature is keyed with the raw server secret")
+	}
+}
@@ -0,0 +1,576 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Kinds of log drain
+const (
+	LogDrainKindSyslog  = "syslog"  // RFC 5424 messages over TLS (syslog+tls://host:port), octet-counted
+	LogDrainKindHTTP    = "http"    // JSON arrays of lines POSTed to an https URL
+	LogDrainKindLoki    = "loki"    // Loki push API (.../loki/api/v1/push)
+	LogDrainKindDatadog = "datadog" // Datadog logs intake (v2), the token being the API key
+)
+
+// LogDrainKinds lists every kind of log drain
+var LogDrainKinds = []string{LogDrainKindSyslog, LogDrainKindHTTP, LogDrainKindLoki, LogDrainKindDatadog}
+
+// DefaultDatadogLogsURL is the intake of Datadog's US1 site, used when a Datadog drain names no URL
+const DefaultDatadogLogsURL = "https://http-intake.logs.datadoghq.com/api/v2/logs"
+
+// Health statuses of a log drain
+const (
+	LogDrainStatusPending = "pending" // Nothing shipped since the drain was created or changed
+	LogDrainStatusHealthy = "healthy"
+	LogDrainStatusFailing = "failing"
+)
+
+const (
+	// logDrainBufferLines is how many lines each drain buffers while its endpoint is slow or down
+	logDrainBufferLines = 10000
+	// logDrainBatchLines is how many lines are sent per request (or syslog write)
+	logDrainBatchLines = 500
+	// logDrainConfigTTL is how long an app's drains are used before being reloaded, so changes reach running apps
+	logDrainConfigTTL = 30 * time.Second
+	// logDrainIdleTimeout stops the drains of apps that have logged nothing for this long
+	logDrainIdleTimeout = time.Hour
+	// logDrainHealthInterval is how often a drain's health is recorded while it does not change
+	logDrainHealthInterval = time.Minute
+	// logDrainSendTimeout bounds each send
+	logDrainSendTimeout = 10 * time.Second
+	// Failed sends are retried after 1s, doubling up to 30s, until they succeed or the drain goes away
+	logDrainMinRetryDelay = time.Second
+	logDrainMaxRetryDelay = 30 * time.Second
+)
+
+// LogDrain is an endpoint an app's runtime logs are shipped to
+type LogDrain struct {
+	ID        string
+	AppID     string
+	AppName   string
+	Kind      string
+	URL       string
+	Token     string
+	UpdatedAt time.Time
+}
+
+// LogDrainStore loads the drains of an app and records their health (api.LogDrainRepo)
+type LogDrainStore interface {
+	GetEnabledLogDrains(ctx context.Context, appID string) ([]LogDrain, error)
+	// RecordLogDrainHealth marks the drain healthy (deliveryErr nil) or failing, adding dropped to its count
+	RecordLogDrainHealth(ctx context.Context, drainID string, deliveryErr error, dropped int64) error
+}
+
+// IsLogDrainKind reports whether kind is a kind of log drain
+func IsLogDrainKind(kind string) bool {
+	for _, k := range LogDrainKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateLogDrain checks that a drain's URL and token suit its kind. Syslog drains take a
+// syslog+tls://host:port URL and no token; the others an https URL, Datadog's requiring the API key
+// as token. Hostnames are resolved again when shipping, where private addresses are refused too
+func ValidateLogDrain(kind, rawURL, token string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("url must be an absolute URL")
+	}
+	if u.User != nil {
+		return fmt.Errorf("url must not contain credentials - use token")
+	}
+	switch kind {
+	case LogDrainKindSyslog:
+		if u.Scheme != "syslog+tls" || u.Port() == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			return fmt.Errorf("syslog drains need a syslog+tls://host:port url")
+		}
+		if token != "" {
+			return fmt.Errorf("syslog drains do not take a token")
+		}
+	case LogDrainKindHTTP, LogDrainKindLoki, LogDrainKindDatadog:
+		if u.Scheme != "https" {
+			return fmt.Errorf("url must be an https URL")
+		}
+		if kind == LogDrainKindDatadog && token == "" {
+			return fmt.Errorf("datadog drains need the Datadog API key as token")
+		}
+	default:
+		return fmt.Errorf("unknown kind %q (valid kinds: %s)", kind, strings.Join(LogDrainKinds, ", "))
+	}
+	return checkPublicHost(u.Hostname())
+}
+
+// LogDrainService ships runtime log lines to the apps' log drains. Every drain gets a buffer and a
+// goroutine sending from it, so a slow or unreachable endpoint never holds up log persistence: lines
+// wait in the buffer while sends are retried, and once it is full new lines are dropped and counted
+// in the drain's health
+type LogDrainService struct {
+	store  LogDrainStore
+	logger *zap.Logger
+	dialer *net.Dialer
+	client *http.Client
+
+	mu   sync.Mutex
+	apps map[string]*appLogDrains
+}
+
+// appLogDrains are the running drains of one app
+type appLogDrains struct {
+	loadedAt time.Time
+	usedAt   time.Time
+	shippers []*logDrainShipper
+}
+
+// NewLogDrainService creates a log drain service that never connects to private, loopback or
+// link-local addresses (drain URLs are user input) and does not follow redirects
+func NewLogDrainService(store LogDrainStore, logger *zap.Logger) *LogDrainService {
+	dialer := publicDialer("ship logs")
+	return &LogDrainService{
+		store:  store,
+		logger: logger,
+		dialer: dialer,
+		client: &http.Client{
+			Timeout: logDrainSendTimeout,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: 5 * time.Second,
+				MaxIdleConnsPerHost: 4,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		apps: make(map[string]*appLogDrains),
+	}
+}
+
+// Ship queues lines of a runtime log (sourceID being its container) for the app's drains.
+// It never waits for them to be sent
+func (s *LogDrainService) Ship(appID, sourceID string, lines []LogLine) {
+	for _, shipper := range s.drainsOf(appID) {
+		shipper.enqueue(sourceID, lines)
+	}
+}
+
+// drainsOf returns the shippers of the app's enabled drains, reloading them every logDrainConfigTTL
+func (s *LogDrainService) drainsOf(appID string) []*logDrainShipper {
+	now := time.Now()
+	s.mu.Lock()
+	if app := s.apps[appID]; app != nil && now.Sub(app.loadedAt) < logDrainConfigTTL {
+		app.usedAt = now
+		shippers := app.shippers
+		s.mu.Unlock()
+		return shippers
+	}
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), logDrainSendTimeout)
+	drains, err := s.store.GetEnabledLogDrains(ctx, appID)
+	cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	app := s.apps[appID]
+	if app == nil {
+		app = &appLogDrains{}
+		s.apps[appID] = app
+	}
+	// Failures are retried once the TTL passes, not on every flush
+	app.loadedAt, app.usedAt = now, now
+	if err != nil {
+		s.logger.Warn("Failed to load log drains, keeping the ones running", zap.Error(err), zap.String("app_id", appID))
+		return app.shippers
+	}
+	app.shippers = s.reconcile(app.shippers, drains)
+
+	for id, other := range s.apps {
+		if now.Sub(other.usedAt) > logDrainIdleTimeout {
+			for _, shipper := range other.shippers {
+				shipper.stop()
+			}
+			delete(s.apps, id)
+		}
+	}
+	return app.shippers
+}
+
+// reconcile keeps the shippers of unchanged drains, starting new ones for added or changed
+// drains and stopping those of drains that went away
+func (s *LogDrainService) reconcile(current []*logDrainShipper, drains []LogDrain) []*logDrainShipper {
+	existing := make(map[string]*logDrainShipper, len(current))
+	for _, shipper := range current {
+		existing[shipper.drain.ID] = shipper
+	}
+
+	shippers := make([]*logDrainShipper, 0, len(drains))
+	for _, drain := range drains {
+		if shipper, ok := existing[drain.ID]; ok && shipper.drain.UpdatedAt.Equal(drain.UpdatedAt) && shipper.drain.AppName == drain.AppName {
+			shippers = append(shippers, shipper)
+			delete(existing, drain.ID)
+			continue
+		}
+		shippers = append(shippers, s.startShipper(drain))
+	}
+	for _, shipper := range existing {
+		shipper.stop()
+	}
+	return shippers
+}
+
+// startShipper starts sending to a drain
+func (s *LogDrainService) startShipper(drain LogDrain) *logDrainShipper {
+	var sender logDrainSender
+	if drain.Kind == LogDrainKindSyslog {
+		sender = &syslogDrainSender{dialer: s.dialer, drain: drain}
+	} else {
+		sender = &httpDrainSender{client: s.client, drain: drain}
+	}
+	shipper := &logDrainShipper{
+		drain:  drain,
+		sender: sender,
+		store:  s.store,
+		logger: s.logger,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go shipper.run()
+	return shipper
+}
+
+// drainLine is a buffered line with the container it was logged by
+type drainLine struct {
+	LogLine
+	SourceID string
+}
+
+// logDrainShipper buffers the lines of one drain and sends them from its own goroutine
+type logDrainShipper struct {
+	drain  LogDrain
+	sender logDrainSender
+	store  LogDrainStore
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	buffer  []drainLine
+	dropped int64 // Lines dropped since the last health record
+
+	wake    chan struct{}
+	done    chan struct{}
+	stopped sync.Once
+
+	// Health last recorded (only used by run)
+	recordedAt time.Time
+	healthy    bool
+}
+
+// enqueue buffers lines, dropping those that do not fit
+func (sh *logDrainShipper) enqueue(sourceID string, lines []LogLine) {
+	sh.mu.Lock()
+	room := max(logDrainBufferLines-len(sh.buffer), 0)
+	if len(lines) > room {
+		sh.dropped += int64(len(lines) - room)
+		lines = lines[:room]
+	}
+	for _, line := range lines {
+		sh.buffer = append(sh.buffer, drainLine{LogLine: line, SourceID: sourceID})
+	}
+	sh.mu.Unlock()
+
+	select {
+	case sh.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stop ends the shipper; lines still buffered are dropped
+func (sh *logDrainShipper) stop() {
+	sh.stopped.Do(func() { close(sh.done) })
+}
+
+// run sends buffered lines in batches until stop, retrying a failed batch with backoff
+func (sh *logDrainShipper) run() {
+	defer sh.sender.close()
+
+	var retryDelay time.Duration
+	for {
+		select {
+		case <-sh.done:
+			return
+		case <-sh.wake:
+		}
+
+		for {
+			sh.mu.Lock()
+			n := min(len(sh.buffer), logDrainBatchLines)
+			batch := append([]drainLine(nil), sh.buffer[:n]...)
+			sh.mu.Unlock()
+			if n == 0 {
+				break
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), logDrainSendTimeout)
+			err := sh.sender.send(ctx, batch)
+			cancel()
+			sh.recordHealth(err)
+
+			if err != nil {
+				retryDelay = min(max(2*retryDelay, logDrainMinRetryDelay), logDrainMaxRetryDelay)
+				select {
+				case <-sh.done:
+					return
+				case <-time.After(retryDelay):
+				}
+				continue
+			}
+			retryDelay = 0
+
+			sh.mu.Lock()
+			sh.buffer = sh.buffer[n:]
+			if len(sh.buffer) == 0 {
+				sh.buffer = nil // Let the drained backing array go
+			}
+			sh.mu.Unlock()
+		}
+	}
+}
+
+// recordHealth records the outcome of a send when the drain's health changed or logDrainHealthInterval
+// passed, along with the lines dropped meanwhile
+func (sh *logDrainShipper) recordHealth(sendErr error) {
+	healthy := sendErr == nil
+	now := time.Now()
+	if !sh.recordedAt.IsZero() && healthy == sh.healthy && now.Sub(sh.recordedAt) < logDrainHealthInterval {
+		return
+	}
+
+	sh.mu.Lock()
+	dropped := sh.dropped
+	sh.dropped = 0
+	sh.mu.Unlock()
+
+	if !healthy && (sh.recordedAt.IsZero() || sh.healthy) {
+		sh.logger.Warn("Log drain is failing",
+			zap.Error(sendErr),
+			zap.String("drain_id", sh.drain.ID),
+			zap.String("app_id", sh.drain.AppID),
+			zap.String("kind", sh.drain.Kind),
+		)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), logDrainSendTimeout)
+	defer cancel()
+	if err := sh.store.RecordLogDrainHealth(ctx, sh.drain.ID, sendErr, dropped); err != nil {
+		sh.logger.Warn("Failed to record log drain health", zap.Error(err), zap.String("drain_id", sh.drain.ID))
+		sh.mu.Lock()
+		sh.dropped += dropped
+		sh.mu.Unlock()
+		return
+	}
+	sh.recordedAt, sh.healthy = now, healthy
+}
+
+// logDrainSender sends batches of lines to one drain
+type logDrainSender interface {
+	send(ctx context.Context, lines []drainLine) error
+	close()
+}
+
+// syslogDrainSender writes RFC 5424 messages with octet-counting framing (RFC 6587) over a TLS
+// connection it keeps open, redialing after a failed write
+type syslogDrainSender struct {
+	dialer *net.Dialer
+	drain  LogDrain
+	conn   net.Conn
+}
+
+func (s *syslogDrainSender) send(ctx context.Context, lines []drainLine) error {
+	if s.conn == nil {
+		u, err := url.Parse(s.drain.URL)
+		if err != nil {
+			return err
+		}
+		dialer := &tls.Dialer{NetDialer: s.dialer, Config: &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}}
+		conn, err := dialer.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		msg := formatSyslogMessage(s.drain.AppName, line)
+		buf.WriteString(strconv.Itoa(len(msg)))
+		buf.WriteByte(' ')
+		buf.WriteString(msg)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+	}
+	if _, err := s.conn.Write(buf.Bytes()); err != nil {
+		s.close()
+		return err
+	}
+	return nil
+}
+
+func (s *syslogDrainSender) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// formatSyslogMessage formats a line as an RFC 5424 message of the user facility, the app's name
+// being the APP-NAME and the container the PROCID
+func formatSyslogMessage(appName string, line drainLine) string {
+	severity := 6 // Informational
+	switch line.Level {
+	case LogLevelError:
+		severity = 3
+	case LogLevelWarn:
+		severity = 4
+	case LogLevelDebug:
+		severity = 7
+	}
+	return fmt.Sprintf("<%d>1 %s stackyn %s %s runtime - %s",
+		8+severity,
+		line.Timestamp.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(appName, 48),
+		syslogHeaderField(line.SourceID, 128),
+		line.Line,
+	)
+}
+
+// syslogHeaderField makes value a valid header field: printable ASCII without spaces, at most maxLen long
+func syslogHeaderField(value string, maxLen int) string {
+	field := strings.Map(func(r rune) rune {
+		if r < '!' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(field) > maxLen {
+		field = field[:maxLen]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
+
+// httpDrainSender POSTs batches in the format of the drain's kind
+type httpDrainSender struct {
+	client *http.Client
+	drain  LogDrain
+}
+
+func (s *httpDrainSender) send(ctx context.Context, lines []drainLine) error {
+	body, err := s.encode(lines)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.drain.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid drain request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Stackyn-LogDrains/1.0")
+	switch {
+	case s.drain.Token == "":
+	case s.drain.Kind == LogDrainKindDatadog:
+		req.Header.Set("DD-API-KEY", s.drain.Token)
+	case s.drain.Kind == LogDrainKindLoki && strings.Contains(s.drain.Token, ":"):
+		// Grafana Cloud and most hosted Lokis take the tenant ID and an access token as basic auth
+		user, password, _ := strings.Cut(s.drain.Token, ":")
+		req.SetBasicAuth(user, password)
+	default:
+		req.Header.Set("Authorization", "Bearer "+s.drain.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err // The URL is in the drain already
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("endpoint returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024)) // Let the connection be reused
+	return nil
+}
+
+func (s *httpDrainSender) close() {}
+
+// encode builds the request body: a Loki push request, a Datadog intake array or, for plain HTTP
+// drains, an array of {timestamp, level, message, app_id, app_name, container_id} objects
+func (s *httpDrainSender) encode(lines []drainLine) ([]byte, error) {
+	switch s.drain.Kind {
+	case LogDrainKindLoki:
+		values := make([][2]string, len(lines))
+		for i, line := range lines {
+			values[i] = [2]string{strconv.FormatInt(line.Timestamp.UnixNano(), 10), line.Line}
+		}
+		return json.Marshal(map[string]interface{}{
+			"streams": []map[string]interface{}{{
+				"stream": map[string]string{"source": "stackyn", "app": s.drain.AppName, "app_id": s.drain.AppID},
+				"values": values,
+			}},
+		})
+	case LogDrainKindDatadog:
+		entries := make([]map[string]interface{}, len(lines))
+		for i, line := range lines {
+			status := line.Level
+			if status == "" {
+				status = LogLevelInfo
+			}
+			entries[i] = map[string]interface{}{
+				"ddsource":  "stackyn",
+				"ddtags":    "app_id:" + s.drain.AppID + ",container_id:" + line.SourceID,
+				"service":   s.drain.AppName,
+				"hostname":  "stackyn",
+				"status":    status,
+				"timestamp": line.Timestamp.UnixMilli(),
+				"message":   line.Line,
+			}
+		}
+		return json.Marshal(entries)
+	default:
+		entries := make([]map[string]interface{}, len(lines))
+		for i, line := range lines {
+			entries[i] = map[string]interface{}{
+				"timestamp":    line.Timestamp.UTC().Format(time.RFC3339Nano),
+				"level":        line.Level,
+				"message":      line.Line,
+				"app_id":       s.drain.AppID,
+				"app_name":     s.drain.AppName,
+				"container_id": line.SourceID,
+			}
+		}
+		return json.Marshal(entries)
+	}
+}
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// Levels log lines are indexed with ("" when a line names none)
+const (
+	LogLevelError = "error"
+	LogLevelWarn  = "warn"
+	LogLevelInfo  = "info"
+	LogLevelDebug = "debug"
+)
+
+const (
+	// logIndexBatchLines is how many lines are indexed per insert
+	logIndexBatchLines = 500
+	// logIndexFlushInterval bounds how long a line of a quiet runtime log waits to become searchable
+	logIndexFlushInterval = 2 * time.Second
+	// logIndexMaxLineBytes truncates very long lines (minified output, base64 blobs) before indexing
+	logIndexMaxLineBytes = 4096
+	// logIndexMaxJSONLineBytes is the longest line parsed as JSON; longer ones are indexed as plain text
+	logIndexMaxJSONLineBytes = 64 << 10
+	// logIndexTimeout bounds each insert, so a slow database never holds up log persistence
+	logIndexTimeout = 10 * time.Second
+)
+
+// LogLine is one line of an app's log as indexed for search
+type LogLine struct {
+	Timestamp time.Time
+	Level     string
+	Line      string
+	// Lines that are JSON objects are also split into their message and the rest of their fields
+	Message string
+	Fields  map[string]interface{}
+}
+
+// LogLineIndexer stores log lines for search (api.LogSearchRepo)
+type LogLineIndexer interface {
+	IndexLogLines(ctx context.Context, appID, logType, sourceID string, lines []LogLine) error
+}
+
+// logLevelPattern finds the first level word in a lowercased line
+var logLevelPattern = regexp.MustCompile(`\b(fatal|panic|critical|crit|error|err|warning|warn|notice|info|debug|trace)\b`)
+
+// detectLogLevel guesses a line's level from the first level word in it
+func detectLogLevel(line string) string {
+	if len(line) > 200 {
+		line = line[:200]
+	}
+	switch logLevelPattern.FindString(strings.ToLower(line)) {
+	case "fatal", "panic", "critical", "crit", "error", "err":
+		return LogLevelError
+	case "warning", "warn":
+		return LogLevelWarn
+	case "notice", "info":
+		return LogLevelInfo
+	case "debug", "trace":
+		return LogLevelDebug
+	}
+	return ""
+}
+
+// parseLogLine splits the timestamp Docker prefixes runtime log lines with (ContainerLogs with Timestamps)
+// off a line, falling back to fallback for lines without one. JSON lines take their level from their level
+// field, plain text ones from the first level word in them. The line is made safe to store in Postgres
+func parseLogLine(raw string, fallback time.Time) LogLine {
+	raw = strings.TrimRight(raw, "\r")
+	timestamp := fallback
+	if prefix, rest, ok := strings.Cut(raw, " "); ok && len(prefix) >= len("2006-01-02T15:04:05Z") && prefix[4] == '-' {
+		if parsed, err := time.Parse(time.RFC3339Nano, prefix); err == nil {
+			timestamp = parsed
+			raw = rest
+		}
+	}
+
+	raw = strings.ReplaceAll(strings.ToValidUTF8(raw, "�"), "\x00", "")
+	if len(raw) <= logIndexMaxJSONLineBytes {
+		if level, message, fields, ok := parseJSONLogLine(raw); ok {
+			return LogLine{
+				Timestamp: timestamp.UTC(),
+				Level:     level,
+				Line:      truncateLogLine(raw),
+				Message:   truncateLogLine(message),
+				Fields:    fields,
+			}
+		}
+	}
+	raw = truncateLogLine(raw)
+	return LogLine{Timestamp: timestamp.UTC(), Level: detectLogLevel(raw), Line: raw}
+}
+
+// truncateLogLine cuts a line to logIndexMaxLineBytes on a character boundary
+func truncateLogLine(line string) string {
+	if len(line) <= logIndexMaxLineBytes {
+		return line
+	}
+	cut := logIndexMaxLineBytes
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut]
+}
+
+// Streams a runtime log line was written to
+const (
+	LogStreamStdout = "stdout"
+	LogStreamStderr = "stderr"
+)
+
+// logDemuxer splits a log into lines, demultiplexing Docker's stdout/stderr frames when the log is a raw
+// container stream. Lines of plain text logs (build logs, containers with a TTY) count as stdout
+type logDemuxer struct {
+	line func(stream, raw string) // Called with every complete line
+
+	muxed     *bool  // Whether the log is a multiplexed container stream, decided by its first bytes
+	header    []byte // Frame header read so far
+	frameLeft int    // Payload bytes left in the current frame
+	stream    string // Stream of the current frame
+	partial   []byte // Text of the line being written
+}
+
+// feed splits p into frames (multiplexed streams) and lines
+func (d *logDemuxer) feed(p []byte) {
+	if d.muxed == nil {
+		// Frames start with the stream (0-2) and three zero bytes, which plain text never does
+		d.header = append(d.header, p...)
+		if len(d.header) < 4 {
+			return
+		}
+		muxed := d.header[0] <= 2 && d.header[1] == 0 && d.header[2] == 0 && d.header[3] == 0
+		d.muxed = &muxed
+		d.stream = LogStreamStdout
+		p, d.header = d.header, nil
+	}
+	if !*d.muxed {
+		d.addText(p)
+		return
+	}
+
+	for len(p) > 0 {
+		if d.frameLeft == 0 {
+			need := 8 - len(d.header)
+			if len(p) < need {
+				d.header = append(d.header, p...)
+				return
+			}
+			d.header = append(d.header, p[:need]...)
+			p = p[need:]
+			d.frameLeft = int(binary.BigEndian.Uint32(d.header[4:8]))
+			d.stream = LogStreamStdout
+			if d.header[0] == 2 {
+				d.stream = LogStreamStderr
+			}
+			d.header = d.header[:0]
+			continue
+		}
+		n := min(d.frameLeft, len(p))
+		d.addText(p[:n])
+		d.frameLeft -= n
+		p = p[n:]
+	}
+}
+
+// flush hands on the last line when the log did not end with a newline
+func (d *logDemuxer) flush() {
+	if d.muxed == nil {
+		d.partial, d.header = d.header, nil // Fewer than 4 bytes were written
+		d.stream = LogStreamStdout
+	}
+	if len(d.partial) > 0 {
+		d.line(d.stream, string(d.partial))
+		d.partial = nil
+	}
+}
+
+// addText hands on the complete lines in text and keeps the rest for the next write
+func (d *logDemuxer) addText(text []byte) {
+	for {
+		i := bytes.IndexByte(text, '\n')
+		if i < 0 {
+			d.partial = append(d.partial, text...)
+			if len(d.partial) > 4*logIndexMaxLineBytes {
+				// A line this long is cut at the index limit anyway; don't buffer the rest of it
+				d.line(d.stream, string(d.partial))
+				d.partial = nil
+			}
+			return
+		}
+		d.partial = append(d.partial, text[:i]...)
+		d.line(d.stream, string(d.partial))
+		d.partial = d.partial[:0]
+		text = text[i+1:]
+	}
+}
+
+// logLineWriter indexes what is written to it line by line and ships runtime lines to the app's log drains,
+// demultiplexing Docker's stdout/stderr frames when the log is a raw container stream. Lines are handed
+// on in batches, and at least every logIndexFlushInterval while the log stays open. Indexing failures are
+// logged and the lines dropped: search is a copy, the log file stays complete
+type logLineWriter struct {
+	indexer  LogLineIndexer   // nil without log search
+	drains   *LogDrainService // nil without log drains and for build and release logs
+	logger   *zap.Logger
+	appID    string
+	logType  string
+	sourceID string
+	fallback time.Time // Timestamp of lines Docker did not stamp (zero uses the time they are written)
+
+	mu    sync.Mutex
+	demux logDemuxer
+	batch []LogLine
+
+	flushMu sync.Mutex // Keeps batches in order when the ticker and a full batch flush at once
+	done    chan struct{}
+	closed  sync.Once
+}
+
+// newLogLineWriter starts handing on lines of entry's log
+func (s *LogPersistenceService) newLogLineWriter(entry LogEntry) *logLineWriter {
+	sourceID := entry.DeploymentID
+	if LogType(entry.LogType) == LogTypeBuild {
+		sourceID = entry.BuildJobID
+	}
+	w := &logLineWriter{
+		indexer:  s.lineIndex,
+		logger:   s.logger,
+		appID:    entry.AppID,
+		logType:  entry.LogType,
+		sourceID: sourceID,
+		done:     make(chan struct{}),
+	}
+	w.demux.line = func(_ string, raw string) { w.addLine(raw) }
+	if LogType(entry.LogType) == LogTypeRuntime {
+		w.drains = s.drains
+	}
+	// Build logs are persisted in one piece once the build ends, so their lines share its timestamp
+	if LogType(entry.LogType) == LogTypeBuild {
+		w.fallback = entry.Timestamp
+	}
+	go w.flushPeriodically()
+	return w
+}
+
+// Write takes p in; it never fails, so it can sit behind an io.TeeReader
+func (w *logLineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.demux.feed(p)
+	full := len(w.batch) >= logIndexBatchLines
+	w.mu.Unlock()
+
+	if full {
+		w.flush()
+	}
+	return len(p), nil
+}
+
+// Close hands on the last line and what is still batched
+func (w *logLineWriter) Close() error {
+	w.closed.Do(func() {
+		close(w.done)
+		w.mu.Lock()
+		w.demux.flush()
+		w.mu.Unlock()
+		w.flush()
+	})
+	return nil
+}
+
+// addLine batches a complete line, skipping blank ones
+func (w *logLineWriter) addLine(raw string) {
+	fallback := w.fallback
+	if fallback.IsZero() {
+		fallback = time.Now()
+	}
+	line := parseLogLine(raw, fallback)
+	if strings.TrimSpace(line.Line) == "" {
+		return
+	}
+	w.batch = append(w.batch, line)
+}
+
+// flushPeriodically hands on batched lines of logs that stay open (followed runtime logs) until Close
+func (w *logLineWriter) flushPeriodically() {
+	ticker := time.NewTicker(logIndexFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.flush()
+		}
+	}
+}
+
+// flush indexes the batched lines and ships them to the drains
+func (w *logLineWriter) flush() {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	lines := w.batch
+	w.batch = nil
+	w.mu.Unlock()
+	if len(lines) == 0 {
+		return
+	}
+
+	if w.drains != nil {
+		w.drains.Ship(w.appID, w.sourceID, lines)
+	}
+	if w.indexer == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), logIndexTimeout)
+	defer cancel()
+	if err := w.indexer.IndexLogLines(ctx, w.appID, w.logType, w.sourceID, lines); err != nil {
+		w.logger.Warn("Failed to index log lines",
+			zap.Error(err),
+			zap.String("app_id", w.appID),
+			zap.String("log_type", w.logType),
+			zap.Int("lines", len(lines)),
+		)
+	}
+}
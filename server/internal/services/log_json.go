@@ -0,0 +1,82 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Keys structured loggers name a JSON line's level and message with, in order of preference (zap, logrus,
+// pino, bunyan, winston, structlog, python-json-logger, ECS)
+var (
+	jsonLogLevelKeys   = []string{"level", "lvl", "severity", "log.level", "levelname", "loglevel"}
+	jsonLogMessageKeys = []string{"msg", "message", "@message", "event", "text"}
+)
+
+// parseJSONLogLine splits a line that is a JSON object into its level, its message and the rest of its
+// fields. ok is false for lines that are not JSON objects, which are indexed as plain text
+func parseJSONLogLine(line string) (level, message string, fields map[string]interface{}, ok bool) {
+	trimmed := strings.TrimSpace(line)
+	if len(trimmed) < 2 || trimmed[0] != '{' || trimmed[len(trimmed)-1] != '}' {
+		return "", "", nil, false
+	}
+	// Postgres text and jsonb cannot hold NUL characters
+	if strings.Contains(trimmed, `\u0000`) {
+		return "", "", nil, false
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(trimmed))
+	decoder.UseNumber() // Keep large integers (IDs, nanosecond timestamps) exact
+	if err := decoder.Decode(&fields); err != nil || decoder.More() {
+		return "", "", nil, false
+	}
+
+	for _, key := range jsonLogLevelKeys {
+		value, found := fields[key]
+		if !found {
+			continue
+		}
+		if level = jsonLogLevel(value); level != "" {
+			delete(fields, key)
+			break
+		}
+	}
+	for _, key := range jsonLogMessageKeys {
+		if value, found := fields[key].(string); found {
+			message = value
+			delete(fields, key)
+			break
+		}
+	}
+	if level == "" {
+		level = detectLogLevel(message)
+	}
+	if len(fields) == 0 {
+		fields = nil
+	}
+	return level, message, fields, true
+}
+
+// jsonLogLevel reads a level field: a name (any case, e.g. "ERROR", "Warning") or a number, either a
+// pino/bunyan level (10 trace to 60 fatal) or a syslog severity (0 emergency to 7 debug)
+func jsonLogLevel(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return detectLogLevel(v)
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return ""
+		}
+		switch {
+		case n >= 50 || (n >= 0 && n <= 3):
+			return LogLevelError
+		case n >= 40 || n == 4:
+			return LogLevelWarn
+		case n >= 30 || n == 5 || n == 6:
+			return LogLevelInfo
+		case n >= 10 || n == 7:
+			return LogLevelDebug
+		}
+	}
+	return ""
+}
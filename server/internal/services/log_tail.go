@@ -0,0 +1,161 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	// runtimeLogTailWindow is how far back from its end a runtime log is read for its last lines
+	runtimeLogTailWindow = 8 << 20
+	// runtimeLogReadChunk is how much of a runtime log is read at a time
+	runtimeLogReadChunk = 64 << 10
+)
+
+// RuntimeLogLine is one line of a container's persisted runtime log
+type RuntimeLogLine struct {
+	Stream string // stdout or stderr
+	LogLine
+}
+
+// RuntimeLogReader reads the lines of a container's runtime log as the deploy worker appends them
+type RuntimeLogReader struct {
+	file  *os.File
+	demux logDemuxer
+	lines []RuntimeLogLine // Lines read but not returned yet
+	buf   []byte
+}
+
+// OpenRuntimeLog opens the runtime log the deploy worker persists for a container (an error wrapping
+// os.ErrNotExist until it has written to it)
+func (s *LogPersistenceService) OpenRuntimeLog(ctx context.Context, appID, containerID string) (*RuntimeLogReader, error) {
+	if s.usePostgres {
+		return nil, fmt.Errorf("Postgres runtime log tailing not yet implemented")
+	}
+	logPath := filepath.Join(s.storageDir, appID, string(LogTypeRuntime), fmt.Sprintf("%s.log", filepath.Base(containerID)))
+	file, err := os.Open(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open runtime log file: %w", err)
+	}
+	r := &RuntimeLogReader{file: file, buf: make([]byte, runtimeLogReadChunk)}
+	r.demux.line = func(stream, raw string) {
+		r.lines = append(r.lines, RuntimeLogLine{Stream: stream, LogLine: parseLogLine(raw, time.Now())})
+	}
+	return r, nil
+}
+
+// Selected reports whether the line was logged at or after since (unless it is zero) with one of levels
+// (unless there are none)
+func (l RuntimeLogLine) Selected(since time.Time, levels []string) bool {
+	if !since.IsZero() && l.Timestamp.Before(since) {
+		return false
+	}
+	return len(levels) == 0 || slices.Contains(levels, l.Level)
+}
+
+// Tail reads the log up to its current end and returns its last n lines selected by since and levels.
+// Only the last runtimeLogTailWindow bytes of long logs are read
+func (r *RuntimeLogReader) Tail(n int, since time.Time, levels []string) ([]RuntimeLogLine, error) {
+	info, err := r.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if start := info.Size() - runtimeLogTailWindow; start > 0 {
+		if err := r.seekToLine(start); err != nil {
+			return nil, err
+		}
+	}
+
+	var tail []RuntimeLogLine
+	for {
+		lines, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if len(lines) == 0 {
+			break
+		}
+		for _, line := range lines {
+			if line.Selected(since, levels) {
+				tail = append(tail, line)
+			}
+		}
+		if len(tail) > 2*n {
+			tail = append(tail[:0], tail[len(tail)-n:]...)
+		}
+	}
+	if len(tail) > n {
+		tail = tail[len(tail)-n:]
+	}
+	return tail, nil
+}
+
+// Next returns the complete lines appended since the last call, none at the end of the log
+func (r *RuntimeLogReader) Next() ([]RuntimeLogLine, error) {
+	for len(r.lines) == 0 {
+		n, err := r.file.Read(r.buf)
+		if n > 0 {
+			r.demux.feed(r.buf[:n])
+		}
+		if err == io.EOF || n == 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	lines := r.lines
+	r.lines = nil
+	return lines, nil
+}
+
+// Close closes the log
+func (r *RuntimeLogReader) Close() error {
+	return r.file.Close()
+}
+
+// seekToLine moves to the first line starting at or after offset: the next frame header of multiplexed
+// logs (a stream byte, three zero bytes, a size and a Docker timestamp), the next newline of plain ones
+func (r *RuntimeLogReader) seekToLine(offset int64) error {
+	first := make([]byte, 4)
+	if _, err := r.file.ReadAt(first, 0); err != nil {
+		return err
+	}
+	muxed := first[0] <= 2 && first[1] == 0 && first[2] == 0 && first[3] == 0
+
+	window := make([]byte, runtimeLogReadChunk)
+	n, err := r.file.ReadAt(window, offset)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	window = window[:n]
+
+	skip := -1
+	if muxed {
+		for i := 0; i+9 <= len(window); i++ {
+			if window[i] >= 1 && window[i] <= 2 && window[i+1] == 0 && window[i+2] == 0 && window[i+3] == 0 &&
+				binary.BigEndian.Uint32(window[i+4:i+8]) < 1<<20 && window[i+8] >= '0' && window[i+8] <= '9' {
+				skip = i
+				break
+			}
+		}
+	} else if i := bytes.IndexByte(window, '\n'); i >= 0 {
+		skip = i + 1
+	}
+	if skip < 0 {
+		skip = len(window) // No line starts in the window: read on from its end
+	}
+
+	muxedState := muxed
+	r.demux.muxed = &muxedState
+	r.demux.stream = LogStreamStdout
+	_, err = r.file.Seek(offset+int64(skip), io.SeekStart)
+	return err
+}
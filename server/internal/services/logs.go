@@ -18,6 +18,7 @@ type LogType string
 const (
 	LogTypeBuild   LogType = "build"
 	LogTypeRuntime LogType = "runtime"
+	LogTypeRelease LogType = "release" // Release command output, one file per deploy attempt
 )
 
 // LogPersistenceService handles log persistence
@@ -27,6 +28,8 @@ type LogPersistenceService struct {
 	usePostgres bool
 	// TODO: Add Postgres client when DB is ready
 	maxStoragePerAppMB int64 // Maximum storage per app in MB
+	lineIndex LogLineIndexer // Optional: indexes persisted lines for log search
+	drains *LogDrainService // Optional: ships runtime lines to the apps' log drains
 }
 
 // NewLogPersistenceService creates a new log persistence service
@@ -44,6 +47,21 @@ func NewLogPersistenceService(logger *zap.Logger, storageDir string, usePostgres
 	}
 }
 
+// SetLineIndex indexes every line persisted from now on for log search
+func (s *LogPersistenceService) SetLineIndex(lineIndex LogLineIndexer) {
+	s.lineIndex = lineIndex
+}
+
+// SetLogDrains ships every runtime line persisted from now on to the app's log drains
+func (s *LogPersistenceService) SetLogDrains(drains *LogDrainService) {
+	s.drains = drains
+}
+
+// splitsLines reports whether entry's lines are indexed for search or shipped to log drains
+func (s *LogPersistenceService) splitsLines(entry LogEntry) bool {
+	return s.lineIndex != nil || (s.drains != nil && LogType(entry.LogType) == LogTypeRuntime)
+}
+
 // LogEntry represents a log entry
 type LogEntry struct {
 	AppID        string
@@ -65,7 +83,16 @@ func (s *LogPersistenceService) PersistLog(ctx context.Context, entry LogEntry)
 	if s.usePostgres {
 		return s.persistToPostgres(ctx, entry)
 	}
-	return s.persistToFilesystem(ctx, entry)
+	if err := s.persistToFilesystem(ctx, entry); err != nil {
+		return err
+	}
+
+	if s.splitsLines(entry) {
+		lines := s.newLogLineWriter(entry)
+		lines.Write([]byte(entry.Content))
+		lines.Close()
+	}
+	return nil
 }
 
 // PersistLogStream persists logs from a stream
@@ -106,6 +133,13 @@ func (s *LogPersistenceService) PersistLogStream(ctx context.Context, entry inte
 	if s.usePostgres {
 		return s.persistStreamToPostgres(ctx, logEntry, reader)
 	}
+
+	// Lines are indexed and drained as they reach the file
+	if s.splitsLines(logEntry) {
+		lines := s.newLogLineWriter(logEntry)
+		defer lines.Close()
+		reader = io.TeeReader(reader, lines)
+	}
 	return s.persistStreamToFilesystem(ctx, logEntry, reader)
 }
 
@@ -122,7 +156,7 @@ func (s *LogPersistenceService) persistToFilesystem(ctx context.Context, entry L
 	switch LogType(entry.LogType) {
 	case LogTypeBuild:
 		filename = fmt.Sprintf("%s.log", entry.BuildJobID)
-	case LogTypeRuntime:
+	case LogTypeRuntime, LogTypeRelease:
 		filename = fmt.Sprintf("%s.log", entry.DeploymentID)
 	default:
 		filename = fmt.Sprintf("%s.log", time.Now().Format("20060102-150405"))
@@ -163,7 +197,7 @@ func (s *LogPersistenceService) persistStreamToFilesystem(ctx context.Context, e
 	switch LogType(entry.LogType) {
 	case LogTypeBuild:
 		filename = fmt.Sprintf("%s.log", entry.BuildJobID)
-	case LogTypeRuntime:
+	case LogTypeRuntime, LogTypeRelease:
 		filename = fmt.Sprintf("%s.log", entry.DeploymentID)
 	default:
 		filename = fmt.Sprintf("%s.log", time.Now().Format("20060102-150405"))
@@ -436,6 +470,20 @@ func (s *LogPersistenceService) getLogsByBuildJobIDFromFilesystem(ctx context.Co
 	return string(content), nil
 }
 
+// OpenBuildLog opens the complete build log of a build job for streaming
+// Returns an error wrapping os.ErrNotExist when no log was persisted for the build
+func (s *LogPersistenceService) OpenBuildLog(ctx context.Context, appID string, buildJobID string) (io.ReadCloser, error) {
+	if s.usePostgres {
+		return nil, fmt.Errorf("Postgres build log streaming not yet implemented")
+	}
+	logPath := filepath.Join(s.storageDir, appID, string(LogTypeBuild), fmt.Sprintf("%s.log", buildJobID))
+	file, err := os.Open(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open build log file: %w", err)
+	}
+	return file, nil
+}
+
 // GetLatestBuildLogs retrieves the most recent build log file for an app (fallback when build_job_id is NULL)
 func (s *LogPersistenceService) GetLatestBuildLogs(ctx context.Context, appID string) (string, error) {
 	if s.usePostgres {
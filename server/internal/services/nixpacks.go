@@ -0,0 +1,137 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// NixpacksBuilder builds images with the nixpacks CLI instead of a Dockerfile
+// Nixpacks generates a build plan from the source and builds it with the docker CLI against the same
+// daemon as the DockerBuildService it is created from, so the worker needs both binaries
+type NixpacksBuilder struct {
+	docker *DockerBuildService
+	binary string
+	logger *zap.Logger
+}
+
+// NewNixpacksBuilder creates a nixpacks builder running binary (looked up in PATH when it has no slash)
+func NewNixpacksBuilder(docker *DockerBuildService, binary string, logger *zap.Logger) *NixpacksBuilder {
+	if binary == "" {
+		binary = "nixpacks"
+	}
+	return &NixpacksBuilder{
+		docker: docker,
+		binary: binary,
+		logger: logger,
+	}
+}
+
+// Available reports whether the nixpacks CLI can be run on this worker
+func (n *NixpacksBuilder) Available() bool {
+	_, err := exec.LookPath(n.binary)
+	return err == nil
+}
+
+// Close is a no-op; the Docker client belongs to the DockerBuildService
+func (n *NixpacksBuilder) Close() error {
+	return nil
+}
+
+// Detect returns the nixpacks providers (e.g. node, python) that match the source in path
+// None means nixpacks cannot plan a build for it
+func (n *NixpacksBuilder) Detect(ctx context.Context, path string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, n.binary, "detect", path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("nixpacks detect failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	providers := strings.FieldsFunc(stdout.String(), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\t'
+	})
+	return providers, nil
+}
+
+// BuildImage builds opts.ContextPath with nixpacks and tags the result like a Dockerfile build
+// The CLI's output goes to logWriter as it is produced, under the same time limit as Dockerfile builds
+func (n *NixpacksBuilder) BuildImage(ctx context.Context, opts BuildOptions, logWriter io.Writer) (*BuildResult, error) {
+	limits := opts.Limits.withDefaults()
+	buildCtx, cancel := context.WithTimeout(ctx, limits.Timeout)
+	defer cancel()
+
+	imageTag := opts.ImageName
+	if opts.Tag != "" {
+		imageTag = fmt.Sprintf("%s:%s", opts.ImageName, opts.Tag)
+	} else {
+		imageTag = fmt.Sprintf("%s:latest", opts.ImageName)
+	}
+
+	n.logger.Info("Building image with nixpacks",
+		zap.String("context_path", opts.ContextPath),
+		zap.String("image_tag", imageTag),
+	)
+
+	// nixpacks has no CPU shares option; memory and the timeout still bound the build
+	args := []string{"build", opts.ContextPath, "--name", imageTag, "--memory", fmt.Sprintf("%dm", limits.MemoryMB)}
+	if opts.PullParent {
+		// Rebuild every layer so nothing built on the outdated base image is reused
+		args = append(args, "--no-cache")
+	}
+
+	var buildLogs strings.Builder
+	output := io.MultiWriter(logWriter, &buildLogs)
+	cmd := exec.CommandContext(buildCtx, n.binary, args...)
+	cmd.Env = append(os.Environ(), "DOCKER_HOST="+n.docker.client.DaemonHost(), "DOCKER_BUILDKIT=1")
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// An interrupt lets the docker CLI cancel the build on the daemon before it exits
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = 10 * time.Second
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return nil, fmt.Errorf("image build cancelled: %w", ctx.Err())
+		}
+		if buildCtx.Err() == context.DeadlineExceeded {
+			fmt.Fprintf(output, "ERROR: Build timed out after %s\n", formatBuildTimeout(limits.Timeout))
+			return nil, buildTimeoutError(limits.Timeout)
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			fmt.Fprintf(output, "ERROR: Nixpacks build failed (exit code %d)\n", exitErr.ExitCode())
+			return nil, fmt.Errorf("nixpacks build failed with exit code %d", exitErr.ExitCode())
+		}
+		return nil, fmt.Errorf("failed to run nixpacks: %w", err)
+	}
+
+	imageInspect, _, err := n.docker.client.ImageInspectWithRaw(buildCtx, imageTag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect built image: %w", err)
+	}
+
+	n.logger.Info("Image built with nixpacks",
+		zap.String("image_id", imageInspect.ID),
+		zap.String("image_tag", imageTag),
+	)
+
+	// The base image comes from the nixpacks version's plan, so it is not tracked for security rebuilds
+	return &BuildResult{
+		ImageID:   imageInspect.ID,
+		ImageName: imageTag,
+		Logs:      buildLogs.String(),
+	}, nil
+}
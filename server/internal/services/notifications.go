@@ -0,0 +1,328 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Notification categories a user can set preferences for
+const (
+	NotificationDeployFailures = "deploy_failures" // A build or deployment failed
+	NotificationWeeklyDigest   = "weekly_digest"   // Weekly summary of deployments and usage
+	NotificationMarketing      = "marketing"       // Product news and offers
+	NotificationBilling        = "billing"         // Trial, payment and plan limit notices (email cannot be disabled)
+	NotificationMaintenance    = "maintenance"     // Scheduled platform maintenance affecting the user's apps
+	NotificationFirstDeploy    = "first_deploy"    // An app's first successful deployment is live
+	NotificationBaseImage      = "base_image"      // An app's base image has a newer upstream build (usually security fixes)
+)
+
+// ChannelPreferences selects which channels a notification category is delivered on
+type ChannelPreferences struct {
+	Email bool `json:"email"`
+	Slack bool `json:"slack"`
+}
+
+// UnmarshalJSON also accepts a bare boolean (the original email-only format) as the email toggle
+func (c *ChannelPreferences) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*c = ChannelPreferences{Email: enabled}
+		return nil
+	}
+	type channelPreferences ChannelPreferences
+	return json.Unmarshal(data, (*channelPreferences)(c))
+}
+
+// NotificationPreferences are a user's per-category channel choices
+// Security emails (OTP, password reset) and invitations are transactional and always sent
+type NotificationPreferences struct {
+	DeployFailures ChannelPreferences `json:"deploy_failures"`
+	WeeklyDigest   ChannelPreferences `json:"weekly_digest"`
+	Marketing      ChannelPreferences `json:"marketing"`
+	Billing        ChannelPreferences `json:"billing"`
+	Maintenance    ChannelPreferences `json:"maintenance"`
+	FirstDeploy    ChannelPreferences `json:"first_deploy"`
+	BaseImage      ChannelPreferences `json:"base_image"`
+}
+
+// DefaultNotificationPreferences returns the preferences a new user starts with
+func DefaultNotificationPreferences() NotificationPreferences {
+	return NotificationPreferences{
+		DeployFailures: ChannelPreferences{Email: true, Slack: true},
+		WeeklyDigest:   ChannelPreferences{Email: true},
+		Marketing:      ChannelPreferences{},
+		Billing:        ChannelPreferences{Email: true},
+		Maintenance:    ChannelPreferences{Email: true, Slack: true},
+		FirstDeploy:    ChannelPreferences{Email: true},
+		BaseImage:      ChannelPreferences{Email: true, Slack: true},
+	}
+}
+
+// ParseNotificationPreferences decodes stored preferences, keeping defaults for keys that were never set
+func ParseNotificationPreferences(raw []byte) NotificationPreferences {
+	prefs := DefaultNotificationPreferences()
+	if len(raw) > 0 {
+		// Stored values are written by us; on a decode error keep whatever was decoded plus defaults
+		_ = json.Unmarshal(raw, &prefs)
+	}
+	prefs.Billing.Email = true
+	return prefs
+}
+
+// Channels returns the channels enabled for a category (unknown categories are delivered nowhere)
+func (p NotificationPreferences) Channels(category string) ChannelPreferences {
+	switch category {
+	case NotificationDeployFailures:
+		return p.DeployFailures
+	case NotificationWeeklyDigest:
+		return p.WeeklyDigest
+	case NotificationMarketing:
+		return p.Marketing
+	case NotificationBilling:
+		channels := p.Billing
+		channels.Email = true
+		return channels
+	case NotificationMaintenance:
+		return p.Maintenance
+	case NotificationFirstDeploy:
+		return p.FirstDeploy
+	case NotificationBaseImage:
+		return p.BaseImage
+	default:
+		return ChannelPreferences{}
+	}
+}
+
+// NotificationRecipient is who a notification is delivered to and how they want it
+type NotificationRecipient struct {
+	UserID          string
+	Email           string
+	Locale          string // Language emails are rendered in
+	SlackWebhookURL string // Empty when Slack is not connected
+	Preferences     NotificationPreferences
+}
+
+// NotificationRecipientRepository loads a user's contact details and preferences
+type NotificationRecipientRepository interface {
+	GetNotificationRecipient(ctx context.Context, userID string) (*NotificationRecipient, error)
+}
+
+// Notification is one message for one user
+type Notification struct {
+	UserID    string
+	Email     string // Fallback address for billing notices when the user cannot be loaded
+	Category  string
+	Summary   string                        // Plain-text message for chat channels (Slack)
+	SendEmail func(to, locale string) error // Sends the templated email in the recipient's locale; nil when the category has no email
+}
+
+// Notifier delivers notifications on the channels each user has enabled
+// Every user-facing notification goes through Notify so preferences are always consulted
+type Notifier struct {
+	logger       *zap.Logger
+	recipients   NotificationRecipientRepository
+	emailService *EmailService
+	client       *http.Client
+}
+
+// NewNotifier creates a new notifier
+func NewNotifier(logger *zap.Logger, recipients NotificationRecipientRepository, emailService *EmailService) *Notifier {
+	return &Notifier{
+		logger:       logger,
+		recipients:   recipients,
+		emailService: emailService,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Notify delivers a notification on the recipient's enabled channels
+// Returns the joined channel errors; a skipped channel is not an error
+func (n *Notifier) Notify(ctx context.Context, notification Notification) error {
+	recipient, err := n.recipients.GetNotificationRecipient(ctx, notification.UserID)
+	if err != nil {
+		// Billing notices must still reach the user; optional categories are dropped
+		// rather than sent without knowing whether the user opted out
+		if notification.Category != NotificationBilling || notification.Email == "" {
+			return fmt.Errorf("failed to load notification recipient: %w", err)
+		}
+		n.logger.Warn("Failed to load notification recipient, sending billing email to fallback address",
+			zap.Error(err),
+			zap.String("user_id", notification.UserID),
+		)
+		recipient = &NotificationRecipient{
+			UserID:      notification.UserID,
+			Email:       notification.Email,
+			Locale:      DefaultLocale,
+			Preferences: DefaultNotificationPreferences(),
+		}
+	}
+
+	channels := recipient.Preferences.Channels(notification.Category)
+	var errs []error
+
+	if channels.Email && notification.SendEmail != nil {
+		to := recipient.Email
+		if to == "" {
+			to = notification.Email
+		}
+		if to != "" {
+			if err := notification.SendEmail(to, recipient.Locale); err != nil {
+				errs = append(errs, fmt.Errorf("email: %w", err))
+			}
+		}
+	}
+
+	if channels.Slack && recipient.SlackWebhookURL != "" && notification.Summary != "" {
+		if err := n.postSlack(ctx, recipient.SlackWebhookURL, notification.Summary); err != nil {
+			errs = append(errs, fmt.Errorf("slack: %w", err))
+		}
+	}
+
+	n.logger.Debug("Notification processed",
+		zap.String("user_id", notification.UserID),
+		zap.String("category", notification.Category),
+		zap.Bool("email", channels.Email),
+		zap.Bool("slack", channels.Slack && recipient.SlackWebhookURL != ""),
+	)
+
+	return errors.Join(errs...)
+}
+
+// NotifyDeployFailed tells an app owner that a build or deployment failed
+// stage is "Build" or "Deployment"
+func (n *Notifier) NotifyDeployFailed(ctx context.Context, userID, appName, stage, reason string) error {
+	return n.Notify(ctx, Notification{
+		UserID:   userID,
+		Category: NotificationDeployFailures,
+		Summary:  fmt.Sprintf(":x: %s of *%s* failed: %s", stage, appName, truncateNotificationText(reason, 300)),
+		SendEmail: func(to, locale string) error {
+			return n.emailService.SendDeployFailedEmail(to, locale, appName, stage, reason)
+		},
+	})
+}
+
+// FirstDeploySummary describes the deployment that first put an app live
+type FirstDeploySummary struct {
+	AppName      string
+	URL          string
+	DeploymentID string
+	Image        string
+	CommitSHA    string // Empty when the build did not record one
+	DeployedAt   time.Time
+}
+
+// NotifyFirstDeploy congratulates an app owner on the app's first successful deployment
+func (n *Notifier) NotifyFirstDeploy(ctx context.Context, userID string, summary FirstDeploySummary) error {
+	return n.Notify(ctx, Notification{
+		UserID:   userID,
+		Category: NotificationFirstDeploy,
+		Summary:  fmt.Sprintf(":tada: *%s* is live at %s", summary.AppName, summary.URL),
+		SendEmail: func(to, locale string) error {
+			return n.emailService.SendFirstDeployEmail(to, locale, summary)
+		},
+	})
+}
+
+// BaseImageUpdate is a newer upstream build of the base image an app was last built from
+type BaseImageUpdate struct {
+	AppName     string
+	BaseImage   string // e.g. "docker.io/library/node:20-alpine"
+	AutoRebuild bool   // The app is being rebuilt on the new base now
+}
+
+// NotifyBaseImageUpdate tells an app owner that the base image of their app was republished upstream
+func (n *Notifier) NotifyBaseImageUpdate(ctx context.Context, userID string, update BaseImageUpdate) error {
+	summary := fmt.Sprintf(":shield: A new build of `%s`, the base image of *%s*, is available - redeploy to pick up its security fixes", update.BaseImage, update.AppName)
+	if update.AutoRebuild {
+		summary = fmt.Sprintf(":shield: A new build of `%s`, the base image of *%s*, is available - rebuilding the app on it now", update.BaseImage, update.AppName)
+	}
+	return n.Notify(ctx, Notification{
+		UserID:   userID,
+		Category: NotificationBaseImage,
+		Summary:  summary,
+		SendEmail: func(to, locale string) error {
+			return n.emailService.SendBaseImageUpdateEmail(to, locale, update)
+		},
+	})
+}
+
+// MaintenanceNotice is a scheduled maintenance window as told to one app owner
+type MaintenanceNotice struct {
+	Title       string
+	Description string
+	StartsAt    time.Time
+	EndsAt      time.Time
+	AppNames    []string // The owner's apps running on the affected nodes
+}
+
+// NotifyMaintenance tells an app owner about maintenance that will affect their apps
+// The email shows the window in timezone (the owner's IANA zone); Slack renders it in each reader's own time
+func (n *Notifier) NotifyMaintenance(ctx context.Context, userID, timezone string, notice MaintenanceNotice) error {
+	return n.Notify(ctx, Notification{
+		UserID:   userID,
+		Category: NotificationMaintenance,
+		Summary: fmt.Sprintf(":wrench: Scheduled maintenance *%s* from %s to %s may affect %s",
+			notice.Title,
+			slackDate(notice.StartsAt),
+			slackDate(notice.EndsAt),
+			strings.Join(notice.AppNames, ", "),
+		),
+		SendEmail: func(to, locale string) error {
+			return n.emailService.SendMaintenanceScheduledEmail(to, locale, timezone, notice)
+		},
+	})
+}
+
+// slackDate formats a time with Slack's date syntax, which Slack shows in the reader's timezone
+func slackDate(t time.Time) string {
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", t.Unix(), t.UTC().Format("Jan 2, 2006 15:04 UTC"))
+}
+
+// postSlack sends a message to a Slack incoming webhook
+func (n *Notifier) postSlack(ctx context.Context, webhookURL, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("slack returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+// IsSlackWebhookURL reports whether url looks like a Slack incoming webhook
+func IsSlackWebhookURL(url string) bool {
+	return strings.HasPrefix(url, "https://hooks.slack.com/")
+}
+
+// truncateNotificationText shortens text for chat messages
+func truncateNotificationText(text string, max int) string {
+	text = strings.TrimSpace(text)
+	if len(text) <= max {
+		return text
+	}
+	return text[:max] + "…"
+}
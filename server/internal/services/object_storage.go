@@ -0,0 +1,276 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Object storage drivers
+const (
+	StorageDriverLocal = "local" // Files on the API server's disk, served under /uploads
+	StorageDriverS3    = "s3"    // Any S3-compatible bucket (AWS S3, R2, MinIO)
+)
+
+// ObjectStorage stores user uploads such as avatars and returns their public URLs
+type ObjectStorage interface {
+	Put(ctx context.Context, key, contentType string, data []byte) (string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// ObjectStorageConfig configures NewObjectStorage
+type ObjectStorageConfig struct {
+	Driver      string // local | s3
+	LocalDir    string // Root directory for the local driver
+	PublicURL   string // Base URL objects are served from (key is appended)
+	S3Endpoint  string // e.g. https://s3.us-east-1.amazonaws.com or https://<account>.r2.cloudflarestorage.com
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+}
+
+// NewObjectStorage creates the object storage backend selected by cfg.Driver
+func NewObjectStorage(logger *zap.Logger, cfg ObjectStorageConfig) (ObjectStorage, error) {
+	switch cfg.Driver {
+	case StorageDriverS3:
+		if cfg.S3Endpoint == "" || cfg.S3Bucket == "" || cfg.S3AccessKey == "" || cfg.S3SecretKey == "" {
+			return nil, fmt.Errorf("s3 storage requires endpoint, bucket, access key and secret key")
+		}
+		endpoint, err := url.Parse(strings.TrimSuffix(cfg.S3Endpoint, "/"))
+		if err != nil || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid s3 endpoint %q", cfg.S3Endpoint)
+		}
+		region := cfg.S3Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		publicURL := strings.TrimSuffix(cfg.PublicURL, "/")
+		if publicURL == "" {
+			publicURL = endpoint.String() + "/" + cfg.S3Bucket
+		}
+		return &S3ObjectStorage{
+			logger:    logger,
+			endpoint:  endpoint,
+			region:    region,
+			bucket:    cfg.S3Bucket,
+			accessKey: cfg.S3AccessKey,
+			secretKey: cfg.S3SecretKey,
+			publicURL: publicURL,
+			client: &http.Client{
+				Timeout: 30 * time.Second,
+			},
+		}, nil
+	case StorageDriverLocal, "":
+		dir := cfg.LocalDir
+		if dir == "" {
+			dir = "./uploads"
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory: %w", err)
+		}
+		publicURL := strings.TrimSuffix(cfg.PublicURL, "/")
+		if publicURL == "" {
+			publicURL = "/uploads"
+		}
+		return &LocalObjectStorage{logger: logger, dir: dir, publicURL: publicURL}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
+
+// LocalObjectStorage writes objects below a directory on local disk
+type LocalObjectStorage struct {
+	logger    *zap.Logger
+	dir       string
+	publicURL string
+}
+
+// Dir returns the directory objects are written to (for serving them over HTTP)
+func (s *LocalObjectStorage) Dir() string {
+	return s.dir
+}
+
+// Put writes an object and returns its public URL
+func (s *LocalObjectStorage) Put(ctx context.Context, key, contentType string, data []byte) (string, error) {
+	path, err := s.pathForKey(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create object directory: %w", err)
+	}
+	// Write to a temp file and rename so readers never see a partial object
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write object: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to store object: %w", err)
+	}
+	s.logger.Debug("Stored object", zap.String("key", key), zap.Int("size", len(data)))
+	return s.publicURL + "/" + key, nil
+}
+
+// Delete removes an object (missing objects are not an error)
+func (s *LocalObjectStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.pathForKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
+// pathForKey maps a key to a path, rejecting keys that would escape the storage directory
+func (s *LocalObjectStorage) pathForKey(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(s.dir, clean), nil
+}
+
+// S3ObjectStorage stores objects in an S3-compatible bucket using path-style requests signed with SigV4
+type S3ObjectStorage struct {
+	logger    *zap.Logger
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	publicURL string
+	client    *http.Client
+}
+
+// Put uploads an object and returns its public URL
+func (s *S3ObjectStorage) Put(ctx context.Context, key, contentType string, data []byte) (string, error) {
+	req, err := s.newRequest(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, data, time.Now().UTC())
+
+	if err := s.do(req); err != nil {
+		return "", fmt.Errorf("failed to upload object: %w", err)
+	}
+	s.logger.Debug("Uploaded object", zap.String("bucket", s.bucket), zap.String("key", key), zap.Int("size", len(data)))
+	return s.publicURL + "/" + key, nil
+}
+
+// Delete removes an object (S3 treats deleting a missing key as success)
+func (s *S3ObjectStorage) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	s.sign(req, nil, time.Now().UTC())
+	if err := s.do(req); err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
+func (s *S3ObjectStorage) newRequest(ctx context.Context, method, key string, data []byte) (*http.Request, error) {
+	u := *s.endpoint
+	u.Path = "/" + s.bucket + "/" + strings.TrimPrefix(key, "/")
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage request: %w", err)
+	}
+	req.ContentLength = int64(len(data))
+	return req, nil
+}
+
+func (s *S3ObjectStorage) do(req *http.Request) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("storage returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header
+func (s *S3ObjectStorage) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	headerValues := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		signedHeaders = []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+		headerValues["content-type"] = ct
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(headerValues[h]) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	signingKey = hmacSHA256(signingKey, s.region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -2,25 +2,66 @@ package services
 
 import (
 	"crypto/rand"
-	"database/sql"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"golang.org/x/crypto/bcrypt"
 	"go.uber.org/zap"
 )
 
+// One-time code purposes. A code only verifies the flow it was issued for, so e.g. a password
+// reset code can't be used to sign in
+const (
+	OTPPurposeLogin         = "login"
+	OTPPurposeSignup        = "signup"
+	OTPPurposePasswordReset = "password_reset"
+)
+
+// Codes expire after otpTTL, and MaxOTPAttempts wrong guesses use a code up
+const (
+	otpTTL         = 10 * time.Minute
+	MaxOTPAttempts = 5
+)
+
+// Errors CheckOTP returns when a code is not accepted
+var (
+	ErrOTPNotFound         = errors.New("no valid code") // None issued, or expired or used up
+	ErrOTPInvalid          = errors.New("invalid code")
+	ErrOTPAttemptsExceeded = errors.New("too many attempts")
+)
+
 type OTPService struct {
 	logger       *zap.Logger
 	db           OTPRepository
 	emailService *EmailService
 }
 
+// OTPRecord is an issued code
+type OTPRecord struct {
+	ID        string
+	Email     string
+	Purpose   string
+	Hash      string
+	ExpiresAt time.Time
+	Attempts  int
+
+	// Signup codes carry the account to create once the address is verified
+	FullName     string
+	PasswordHash string
+}
+
 type OTPRepository interface {
-	CreateOTP(email, otpHash string, expiresAt time.Time) error
-	GetOTPByEmail(email string) (otpID, otpHash string, expiresAt time.Time, err error)
-	MarkOTPAsUsed(otpID string) error
+	// CreateOTP stores a code, retiring the email's earlier unused codes for the same purpose
+	CreateOTP(record OTPRecord) error
+	// GetLatestOTP returns the email's most recent unused, unexpired code for any of purposes (pgx.ErrNoRows if none)
+	GetLatestOTP(email string, purposes []string) (*OTPRecord, error)
+	// RecordFailedOTPAttempt counts a wrong guess, using the code up at maxAttempts
+	RecordFailedOTPAttempt(otpID string, maxAttempts int) (attempts int, err error)
+	// ConsumeOTP marks a code used; false when a concurrent request used it first
+	ConsumeOTP(otpID string) (bool, error)
 }
 
 // NewOTPService creates a new OTP service
@@ -40,22 +81,22 @@ func (s *OTPService) GenerateOTP() (string, error) {
 	if _, err := rand.Read(bytes); err != nil {
 		return "", fmt.Errorf("failed to generate random bytes: %w", err)
 	}
-	
+
 	// Combine 3 bytes to get a number in 0-16777215 range
 	// Then use modulo to get 0-999999 range
 	randomNum := int(bytes[0])<<16 | int(bytes[1])<<8 | int(bytes[2])
 	randomNum = randomNum % 1000000 // Ensure 6 digits (0-999999)
-	
+
 	// Format as 6-digit string with leading zeros if needed
 	// This ensures we always get exactly 6 digits
 	otp := fmt.Sprintf("%06d", randomNum)
-	
+
 	// Safety check: ensure it's exactly 6 digits
 	if len(otp) != 6 {
 		// This should never happen, but if it does, regenerate
 		return "", fmt.Errorf("generated OTP has invalid length: %d", len(otp))
 	}
-	
+
 	return otp, nil
 }
 
@@ -77,122 +118,95 @@ func (s *OTPService) VerifyOTP(otp, hash string) bool {
 	return bcrypt.CompareHashAndPassword(decodedHash, []byte(otp)) == nil
 }
 
-// SendOTP generates, hashes, and stores an OTP for the given email
-func (s *OTPService) SendOTP(email string) (string, error) {
-	// Generate OTP
-	otp, err := s.GenerateOTP()
-	if err != nil {
-		return "", fmt.Errorf("failed to generate OTP: %w", err)
-	}
-
-	// Hash OTP
-	otpHash, err := s.HashOTP(otp)
-	if err != nil {
-		return "", fmt.Errorf("failed to hash OTP: %w", err)
-	}
-
-	// Set expiry to 10 minutes from now
-	expiresAt := time.Now().Add(10 * time.Minute)
-
-	// Store in database
-	if err := s.db.CreateOTP(email, otpHash, expiresAt); err != nil {
-		return "", fmt.Errorf("failed to store OTP: %w", err)
-	}
-
-	s.logger.Info("OTP generated and stored",
-		zap.String("email", email),
-		zap.Time("expires_at", expiresAt),
-	)
-
-	// Send OTP via email service
-	if s.emailService != nil {
-		if err := s.emailService.SendOTPEmail(email, otp); err != nil {
-			s.logger.Error("Failed to send OTP email", zap.Error(err), zap.String("email", email))
-			// Don't fail the entire operation if email fails - OTP is still stored
-			// In development, we might want to return the OTP in the response
-		}
-	} else {
-		s.logger.Warn("Email service not configured, OTP not sent", zap.String("email", email))
-	}
+// SendOTP generates, hashes, and stores a sign-in code for the given email and emails it
+// The email is written in locale (see NormalizeLocale)
+func (s *OTPService) SendOTP(email, locale string) (string, error) {
+	return s.issue(OTPRecord{Email: email, Purpose: OTPPurposeLogin}, locale)
+}
 
-	// Return plain OTP for sending via email (in production, send via email service)
-	return otp, nil
+// SendSignupOTP emails a code verifying the address of a new account
+// The account (fullName, passwordHash) is created when the code is verified
+func (s *OTPService) SendSignupOTP(email, locale, fullName, passwordHash string) (string, error) {
+	return s.issue(OTPRecord{Email: email, Purpose: OTPPurposeSignup, FullName: fullName, PasswordHash: passwordHash}, locale)
 }
 
 // SendPasswordResetOTP generates, hashes, and stores an OTP for password reset
-func (s *OTPService) SendPasswordResetOTP(email string) (string, error) {
-	// Generate OTP
+// The email is written in locale (see NormalizeLocale)
+func (s *OTPService) SendPasswordResetOTP(email, locale string) (string, error) {
+	return s.issue(OTPRecord{Email: email, Purpose: OTPPurposePasswordReset}, locale)
+}
+
+// issue stores a new code for record's email and purpose and emails it
+// Returns the plain code (handlers only reveal it in dev mode)
+func (s *OTPService) issue(record OTPRecord, locale string) (string, error) {
 	otp, err := s.GenerateOTP()
 	if err != nil {
 		return "", fmt.Errorf("failed to generate OTP: %w", err)
 	}
-
-	// Hash OTP
-	otpHash, err := s.HashOTP(otp)
+	record.Hash, err = s.HashOTP(otp)
 	if err != nil {
 		return "", fmt.Errorf("failed to hash OTP: %w", err)
 	}
+	record.ExpiresAt = time.Now().Add(otpTTL)
 
-	// Set expiry to 10 minutes from now
-	expiresAt := time.Now().Add(10 * time.Minute)
-
-	// Store in database
-	if err := s.db.CreateOTP(email, otpHash, expiresAt); err != nil {
+	if err := s.db.CreateOTP(record); err != nil {
 		return "", fmt.Errorf("failed to store OTP: %w", err)
 	}
 
-	s.logger.Info("Password reset OTP generated and stored",
-		zap.String("email", email),
-		zap.Time("expires_at", expiresAt),
+	s.logger.Info("OTP generated and stored",
+		zap.String("email", record.Email),
+		zap.String("purpose", record.Purpose),
+		zap.Time("expires_at", record.ExpiresAt),
 	)
 
-	// Send OTP via email service
-	if s.emailService != nil {
-		if err := s.emailService.SendPasswordResetOTPEmail(email, otp); err != nil {
-			s.logger.Error("Failed to send password reset OTP email", zap.Error(err), zap.String("email", email))
-			// Don't fail the entire operation if email fails - OTP is still stored
-		}
-	} else {
-		s.logger.Warn("Email service not configured, password reset OTP not sent", zap.String("email", email))
+	if s.emailService == nil {
+		s.logger.Warn("Email service not configured, OTP not sent", zap.String("email", record.Email))
+		return otp, nil
+	}
+	send := s.emailService.SendOTPEmail
+	if record.Purpose == OTPPurposePasswordReset {
+		send = s.emailService.SendPasswordResetOTPEmail
+	}
+	if err := send(record.Email, locale, otp); err != nil {
+		// Don't fail the entire operation if email fails - OTP is still stored
+		s.logger.Error("Failed to send OTP email", zap.Error(err), zap.String("email", record.Email), zap.String("purpose", record.Purpose))
 	}
-
-	// Return plain OTP (for development/debugging)
 	return otp, nil
 }
 
-// VerifyOTP verifies an OTP for the given email
-func (s *OTPService) VerifyOTPForEmail(email, otp string) (bool, error) {
-	// Get OTP from database
-	_, otpHash, expiresAt, err := s.db.GetOTPByEmail(email)
+// CheckOTP verifies a code for email issued for one of purposes and uses it up, returning its record
+// A wrong code counts against the code's attempts; at MaxOTPAttempts it can no longer be used and a
+// new one must be requested
+func (s *OTPService) CheckOTP(email, otp string, purposes ...string) (*OTPRecord, error) {
+	record, err := s.db.GetLatestOTP(email, purposes)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return false, fmt.Errorf("no valid OTP found for email")
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrOTPNotFound
 		}
-		return false, fmt.Errorf("failed to get OTP: %w", err)
+		return nil, fmt.Errorf("failed to get OTP: %w", err)
 	}
-
-	// Check if expired
-	if time.Now().After(expiresAt) {
-		return false, fmt.Errorf("OTP has expired")
+	if time.Now().After(record.ExpiresAt) {
+		return nil, ErrOTPNotFound
 	}
 
-	// Verify OTP
-	if !s.VerifyOTP(otp, otpHash) {
-		return false, fmt.Errorf("invalid OTP")
+	if !s.VerifyOTP(otp, record.Hash) {
+		attempts, err := s.db.RecordFailedOTPAttempt(record.ID, MaxOTPAttempts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record OTP attempt: %w", err)
+		}
+		if attempts >= MaxOTPAttempts {
+			s.logger.Warn("OTP used up by failed attempts", zap.String("email", email), zap.String("purpose", record.Purpose))
+			return nil, ErrOTPAttemptsExceeded
+		}
+		return nil, ErrOTPInvalid
 	}
 
-	return true, nil
-}
-
-// MarkOTPAsUsed marks an OTP as used
-func (s *OTPService) MarkOTPAsUsed(email string) error {
-	// Get OTP ID from database
-	otpID, _, _, err := s.db.GetOTPByEmail(email)
+	consumed, err := s.db.ConsumeOTP(record.ID)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to mark OTP as used: %w", err)
 	}
-
-	// Mark as used using OTP ID
-	return s.db.MarkOTPAsUsed(otpID)
+	if !consumed {
+		return nil, ErrOTPNotFound
+	}
+	return record, nil
 }
-
@@ -0,0 +1,445 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// planCounterPrefix namespaces the plan counters in Redis
+	planCounterPrefix = "stackyn:plan:"
+	// buildCountTTL expires a user's build counter when no build touched it for this long, so a
+	// counter leaked by a dead worker heals itself even without reconciliation (builds time out after at most 25 minutes)
+	buildCountTTL = 2 * time.Hour
+	// ramUsageTTL expires the RAM counters when neither deploys nor reconciliation touched them for this
+	// long; the next reconciliation rebuilds them from the running containers
+	ramUsageTTL = 1 * time.Hour
+)
+
+// PlanCounters tracks the usage that plan limits are checked against: concurrent builds per user and
+// the RAM each app's containers hold against its owner's plan
+type PlanCounters interface {
+	BuildCount(ctx context.Context, userID string) (int, error)
+	// AdjustBuildCount adds delta to the user's build count (never below zero) and returns the new count
+	AdjustBuildCount(ctx context.Context, userID string, delta int) (int, error)
+	// ReconcileBuildCounts replaces all build counts with counts (users not in it have no builds)
+	ReconcileBuildCounts(ctx context.Context, counts map[string]int) error
+
+	RAMUsage(ctx context.Context, userID string) (int, error)
+	// AdjustRAMUsage adds deltaMB to the user's RAM usage (never below zero) and returns the new total
+	AdjustRAMUsage(ctx context.Context, userID string, deltaMB int) (int, error)
+	ReserveAppRAM(ctx context.Context, userID, appID string, ramMB int) (previousMB, totalMB int, err error)
+	SettleAppRAM(ctx context.Context, appID string, deployed bool, previousMB int) error
+	ReleaseAppRAM(ctx context.Context, appID string) error
+	// ReconcileRAMUsage replaces the app reservations with running, keeping deploys still in flight,
+	// and returns how many apps were corrected
+	ReconcileRAMUsage(ctx context.Context, running map[string]AppRAMUsage) (int, error)
+}
+
+// appRAMReservation is the RAM one app holds against its owner's plan
+type appRAMReservation struct {
+	userID   string
+	ramMB    int
+	inFlight bool // Deploy still running - reconciliation must not drop it before the container exists
+}
+
+// memoryPlanCounters keeps the counters in process memory
+// Only correct when a single process handles every build and deploy - the default for local development
+type memoryPlanCounters struct {
+	mu          sync.Mutex
+	buildCounts map[string]int                // userID -> concurrent build count
+	ramUsage    map[string]int                // userID -> RAM usage in MB
+	appRAM      map[string]*appRAMReservation // appID -> RAM reserved by the app's container
+}
+
+func newMemoryPlanCounters() *memoryPlanCounters {
+	return &memoryPlanCounters{
+		buildCounts: make(map[string]int),
+		ramUsage:    make(map[string]int),
+		appRAM:      make(map[string]*appRAMReservation),
+	}
+}
+
+func (c *memoryPlanCounters) BuildCount(ctx context.Context, userID string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buildCounts[userID], nil
+}
+
+func (c *memoryPlanCounters) AdjustBuildCount(ctx context.Context, userID string, delta int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return adjustCounter(c.buildCounts, userID, delta), nil
+}
+
+func (c *memoryPlanCounters) ReconcileBuildCounts(ctx context.Context, counts map[string]int) error {
+	buildCounts := make(map[string]int, len(counts))
+	for userID, count := range counts {
+		if count > 0 {
+			buildCounts[userID] = count
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buildCounts = buildCounts
+	return nil
+}
+
+func (c *memoryPlanCounters) RAMUsage(ctx context.Context, userID string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ramUsage[userID], nil
+}
+
+func (c *memoryPlanCounters) AdjustRAMUsage(ctx context.Context, userID string, deltaMB int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return adjustCounter(c.ramUsage, userID, deltaMB), nil
+}
+
+func (c *memoryPlanCounters) ReserveAppRAM(ctx context.Context, userID, appID string, ramMB int) (int, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previousMB := 0
+	if prev, ok := c.appRAM[appID]; ok {
+		previousMB = prev.ramMB
+		adjustCounter(c.ramUsage, prev.userID, -prev.ramMB)
+	}
+	c.appRAM[appID] = &appRAMReservation{userID: userID, ramMB: ramMB, inFlight: true}
+	return previousMB, adjustCounter(c.ramUsage, userID, ramMB), nil
+}
+
+func (c *memoryPlanCounters) SettleAppRAM(ctx context.Context, appID string, deployed bool, previousMB int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res, ok := c.appRAM[appID]
+	if !ok {
+		return nil
+	}
+	res.inFlight = false
+	if deployed {
+		return nil
+	}
+
+	adjustCounter(c.ramUsage, res.userID, previousMB-res.ramMB)
+	if previousMB > 0 {
+		res.ramMB = previousMB
+	} else {
+		delete(c.appRAM, appID)
+	}
+	return nil
+}
+
+func (c *memoryPlanCounters) ReleaseAppRAM(ctx context.Context, appID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res, ok := c.appRAM[appID]
+	if !ok {
+		return nil
+	}
+	delete(c.appRAM, appID)
+	adjustCounter(c.ramUsage, res.userID, -res.ramMB)
+	return nil
+}
+
+func (c *memoryPlanCounters) ReconcileRAMUsage(ctx context.Context, running map[string]AppRAMUsage) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	corrected := 0
+	appRAM := make(map[string]*appRAMReservation, len(running))
+	for appID, usage := range running {
+		prev, ok := c.appRAM[appID]
+		if ok && prev.inFlight {
+			continue // Added below with the in-flight reservations
+		}
+		if !ok || prev.userID != usage.UserID || prev.ramMB != usage.RAMMB {
+			corrected++
+		}
+		appRAM[appID] = &appRAMReservation{userID: usage.UserID, ramMB: usage.RAMMB}
+	}
+	for appID, prev := range c.appRAM {
+		if prev.inFlight {
+			appRAM[appID] = prev
+		} else if _, ok := running[appID]; !ok {
+			corrected++ // Tracked but no longer running
+		}
+	}
+
+	ramUsage := make(map[string]int)
+	for _, res := range appRAM {
+		ramUsage[res.userID] += res.ramMB
+	}
+	c.appRAM = appRAM
+	c.ramUsage = ramUsage
+	return corrected, nil
+}
+
+// adjustCounter adds delta to counters[key], deleting it once it drops to zero, and returns the new value
+func adjustCounter(counters map[string]int, key string, delta int) int {
+	total := counters[key] + delta
+	if total <= 0 {
+		delete(counters, key)
+		return 0
+	}
+	counters[key] = total
+	return total
+}
+
+// Redis layout:
+//
+//	stackyn:plan:builds:{userID} - concurrent build count, expires after buildCountTTL
+//	stackyn:plan:app_ram          - hash appID -> "userID|ramMB|inFlight" (inFlight is 0 or 1)
+//	stackyn:plan:ram              - hash userID -> total RAM of the user's reservations
+//
+// Both hashes are written together and share ramUsageTTL. Every multi-key change runs as a Lua script,
+// so concurrent API instances and workers never see a reservation without its total
+var (
+	redisPlanBuildsKeyPrefix = planCounterPrefix + "builds:"
+	redisPlanAppRAMKey       = planCounterPrefix + "app_ram"
+	redisPlanRAMKey          = planCounterPrefix + "ram"
+)
+
+// redisAdjustBuildCount: KEYS[1] = builds key, ARGV = delta, ttl seconds
+var redisAdjustBuildCount = redis.NewScript(`
+local n = tonumber(redis.call('GET', KEYS[1]) or '0') + tonumber(ARGV[1])
+if n <= 0 then
+	redis.call('DEL', KEYS[1])
+	return 0
+end
+redis.call('SET', KEYS[1], n, 'EX', ARGV[2])
+return n
+`)
+
+// redisAdjustRAMUsage: KEYS = app_ram, ram; ARGV = userID, delta, ttl seconds
+var redisAdjustRAMUsage = redis.NewScript(`
+local total = redis.call('HINCRBY', KEYS[2], ARGV[1], ARGV[2])
+if total <= 0 then
+	redis.call('HDEL', KEYS[2], ARGV[1])
+	total = 0
+end
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+redis.call('EXPIRE', KEYS[2], ARGV[3])
+return total
+`)
+
+// redisReserveAppRAM: KEYS = app_ram, ram; ARGV = appID, userID, ramMB, ttl seconds
+// Returns {previousMB, totalMB}
+var redisReserveAppRAM = redis.NewScript(`
+local previous = 0
+local prev = redis.call('HGET', KEYS[1], ARGV[1])
+if prev then
+	local user, mb = string.match(prev, '^(.*)|(%d+)|%d$')
+	previous = tonumber(mb)
+	if redis.call('HINCRBY', KEYS[2], user, -previous) <= 0 then
+		redis.call('HDEL', KEYS[2], user)
+	end
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2] .. '|' .. ARGV[3] .. '|1')
+local total = redis.call('HINCRBY', KEYS[2], ARGV[2], ARGV[3])
+if total <= 0 then
+	redis.call('HDEL', KEYS[2], ARGV[2])
+	total = 0
+end
+redis.call('EXPIRE', KEYS[1], ARGV[4])
+redis.call('EXPIRE', KEYS[2], ARGV[4])
+return {previous, total}
+`)
+
+// redisSettleAppRAM: KEYS = app_ram, ram; ARGV = appID, deployed (0/1), previousMB, ttl seconds
+var redisSettleAppRAM = redis.NewScript(`
+local res = redis.call('HGET', KEYS[1], ARGV[1])
+if not res then
+	return 0
+end
+local user, mb = string.match(res, '^(.*)|(%d+)|%d$')
+if ARGV[2] == '1' then
+	redis.call('HSET', KEYS[1], ARGV[1], user .. '|' .. mb .. '|0')
+else
+	local previous = tonumber(ARGV[3])
+	if redis.call('HINCRBY', KEYS[2], user, previous - tonumber(mb)) <= 0 then
+		redis.call('HDEL', KEYS[2], user)
+	end
+	if previous > 0 then
+		redis.call('HSET', KEYS[1], ARGV[1], user .. '|' .. previous .. '|0')
+	else
+		redis.call('HDEL', KEYS[1], ARGV[1])
+	end
+end
+redis.call('EXPIRE', KEYS[1], ARGV[4])
+redis.call('EXPIRE', KEYS[2], ARGV[4])
+return 1
+`)
+
+// redisReleaseAppRAM: KEYS = app_ram, ram; ARGV = appID
+var redisReleaseAppRAM = redis.NewScript(`
+local res = redis.call('HGET', KEYS[1], ARGV[1])
+if not res then
+	return 0
+end
+local user, mb = string.match(res, '^(.*)|(%d+)|%d$')
+redis.call('HDEL', KEYS[1], ARGV[1])
+if redis.call('HINCRBY', KEYS[2], user, -tonumber(mb)) <= 0 then
+	redis.call('HDEL', KEYS[2], user)
+end
+return 1
+`)
+
+// redisReconcileRAMUsage: KEYS = app_ram, ram; ARGV = ttl seconds, then appID, userID, ramMB per running app
+// Returns how many apps were corrected
+var redisReconcileRAMUsage = redis.NewScript(`
+local running = {}
+for i = 2, #ARGV, 3 do
+	running[ARGV[i]] = ARGV[i + 1] .. '|' .. ARGV[i + 2] .. '|0'
+end
+
+local corrected = 0
+local current = {}
+local kept = {}
+local entries = redis.call('HGETALL', KEYS[1])
+for i = 1, #entries, 2 do
+	local appID, value = entries[i], entries[i + 1]
+	current[appID] = value
+	if string.sub(value, -2) == '|1' then
+		kept[appID] = value
+	elseif running[appID] == nil then
+		corrected = corrected + 1
+	end
+end
+for appID, value in pairs(running) do
+	if kept[appID] == nil then
+		if current[appID] ~= value then
+			corrected = corrected + 1
+		end
+		kept[appID] = value
+	end
+end
+
+redis.call('DEL', KEYS[1], KEYS[2])
+local totals = {}
+for appID, value in pairs(kept) do
+	redis.call('HSET', KEYS[1], appID, value)
+	local user, mb = string.match(value, '^(.*)|(%d+)|%d$')
+	totals[user] = (totals[user] or 0) + tonumber(mb)
+end
+for user, mb in pairs(totals) do
+	if mb > 0 then
+		redis.call('HSET', KEYS[2], user, mb)
+	end
+end
+redis.call('EXPIRE', KEYS[1], ARGV[1])
+redis.call('EXPIRE', KEYS[2], ARGV[1])
+return corrected
+`)
+
+// redisPlanCounters keeps the counters in Redis, shared by the API and every worker
+type redisPlanCounters struct {
+	client *redis.Client
+}
+
+// NewRedisPlanCounters keeps the plan counters in Redis through client (see NewRedisClient), so every
+// process enforces the same limits
+func NewRedisPlanCounters(client *redis.Client) PlanCounters {
+	return &redisPlanCounters{client: client}
+}
+
+func (c *redisPlanCounters) BuildCount(ctx context.Context, userID string) (int, error) {
+	count, err := c.client.Get(ctx, redisPlanBuildsKeyPrefix+userID).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return count, err
+}
+
+func (c *redisPlanCounters) AdjustBuildCount(ctx context.Context, userID string, delta int) (int, error) {
+	return redisAdjustBuildCount.Run(ctx, c.client, []string{redisPlanBuildsKeyPrefix + userID},
+		delta, int(buildCountTTL.Seconds())).Int()
+}
+
+func (c *redisPlanCounters) ReconcileBuildCounts(ctx context.Context, counts map[string]int) error {
+	var stale []string
+	iter := c.client.Scan(ctx, 0, redisPlanBuildsKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		if counts[strings.TrimPrefix(iter.Val(), redisPlanBuildsKeyPrefix)] <= 0 {
+			stale = append(stale, iter.Val())
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to scan build counters: %w", err)
+	}
+
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(stale) > 0 {
+			pipe.Del(ctx, stale...)
+		}
+		for userID, count := range counts {
+			if count > 0 {
+				pipe.Set(ctx, redisPlanBuildsKeyPrefix+userID, count, buildCountTTL)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (c *redisPlanCounters) RAMUsage(ctx context.Context, userID string) (int, error) {
+	total, err := c.client.HGet(ctx, redisPlanRAMKey, userID).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return total, err
+}
+
+func (c *redisPlanCounters) AdjustRAMUsage(ctx context.Context, userID string, deltaMB int) (int, error) {
+	return redisAdjustRAMUsage.Run(ctx, c.client, []string{redisPlanAppRAMKey, redisPlanRAMKey},
+		userID, deltaMB, int(ramUsageTTL.Seconds())).Int()
+}
+
+func (c *redisPlanCounters) ReserveAppRAM(ctx context.Context, userID, appID string, ramMB int) (int, int, error) {
+	result, err := redisReserveAppRAM.Run(ctx, c.client, []string{redisPlanAppRAMKey, redisPlanRAMKey},
+		appID, userID, ramMB, int(ramUsageTTL.Seconds())).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(result) != 2 {
+		return 0, 0, fmt.Errorf("unexpected reserve result %v", result)
+	}
+	return int(result[0]), int(result[1]), nil
+}
+
+func (c *redisPlanCounters) SettleAppRAM(ctx context.Context, appID string, deployed bool, previousMB int) error {
+	return redisSettleAppRAM.Run(ctx, c.client, []string{redisPlanAppRAMKey, redisPlanRAMKey},
+		appID, boolFlag(deployed), previousMB, int(ramUsageTTL.Seconds())).Err()
+}
+
+func (c *redisPlanCounters) ReleaseAppRAM(ctx context.Context, appID string) error {
+	return redisReleaseAppRAM.Run(ctx, c.client, []string{redisPlanAppRAMKey, redisPlanRAMKey}, appID).Err()
+}
+
+func (c *redisPlanCounters) ReconcileRAMUsage(ctx context.Context, running map[string]AppRAMUsage) (int, error) {
+	args := make([]interface{}, 0, 1+3*len(running))
+	args = append(args, int(ramUsageTTL.Seconds()))
+	for appID, usage := range running {
+		args = append(args, appID, usage.UserID, strconv.Itoa(usage.RAMMB))
+	}
+	return redisReconcileRAMUsage.Run(ctx, c.client, []string{redisPlanAppRAMKey, redisPlanRAMKey}, args...).Int()
+}
+
+// boolFlag encodes a bool as the "0"/"1" the Lua scripts expect
+func boolFlag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
@@ -3,11 +3,14 @@ package services
 import (
 	"context"
 	"fmt"
-	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+// defaultExecTimeout is how long one-off exec commands may run on plans without their own limit
+const defaultExecTimeout = 5 * time.Minute
+
 // PlanRepository interface for plan data access
 type PlanRepository interface {
 	GetPlanByID(ctx context.Context, planID string) (*PlanData, error)
@@ -25,13 +28,40 @@ type UserPlanRepository interface {
 	GetUserPlanID(ctx context.Context, userID string) (string, error)
 }
 
+// BuildUsageRepository interface for reading metered build time
+type BuildUsageRepository interface {
+	SumUsage(ctx context.Context, userID, metric string, since, until time.Time) (int64, error)
+}
+
+// Queue priorities (PlanLimits.QueuePriority); automated builds go to the build queue of their tier
+const (
+	QueuePriorityFree    = 1  // Trials and accounts without a paid plan
+	QueuePriorityDefault = 5  // Paid plans
+	QueuePriorityPro     = 10 // Plans with priority_builds
+)
+
 // PlanData represents plan information for plan enforcement
 type PlanData struct {
 	ID             string
 	Name           string
 	MaxRAMMB       int
+	MaxDiskMB      int
 	MaxApps        int
 	PriorityBuilds bool
+	CustomDomains  bool
+	BuildMinutes   int // Monthly allowance, 0 = unlimited
+	TeamMembers    int // Organization seats including the owner
+	HealthChecks   bool
+	ZeroDowntime   bool
+	AlwaysOn       bool
+	Workers        bool
+	AutoDeploy     bool
+	AccessRules    bool
+	ExecTimeoutSeconds int // Longest a one-off exec command may run
+	BuildCPUShares      int // 0 = DefaultBuildCPUShares
+	BuildMemoryMB       int // 0 = DefaultBuildMemoryMB
+	BuildTimeoutMinutes int // 0 = DefaultBuildTimeout
+	Isolation           string // "" = DefaultIsolationLevel
 }
 
 // SubscriptionData represents subscription information
@@ -46,21 +76,23 @@ type PlanEnforcementService struct {
 	planRepo          PlanRepository
 	subscriptionRepo  SubscriptionRepository
 	userPlanRepo      UserPlanRepository
+	usageRepo         BuildUsageRepository // Optional: enables monthly build minutes enforcement
 	
-	// In-memory tracking for concurrent builds and RAM usage
-	// In production, this should be in Redis or database
-	buildCounts   map[string]int           // userID -> concurrent build count
-	ramUsage      map[string]int           // userID -> RAM usage in MB
-	buildCountsMu sync.RWMutex
-	ramUsageMu    sync.RWMutex
+	// Concurrent builds and RAM usage - in process memory until SetCounters shares them through Redis
+	counters PlanCounters
+}
+
+// AppRAMUsage is the RAM a running app container actually uses, as seen by reconciliation
+type AppRAMUsage struct {
+	UserID string
+	RAMMB  int
 }
 
 // NewPlanEnforcementService creates a new plan enforcement service
 func NewPlanEnforcementService(logger *zap.Logger) *PlanEnforcementService {
 	return &PlanEnforcementService{
-		logger:     logger,
-		buildCounts: make(map[string]int),
-		ramUsage:    make(map[string]int),
+		logger:   logger,
+		counters: newMemoryPlanCounters(),
 	}
 }
 
@@ -71,8 +103,7 @@ func NewPlanEnforcementServiceWithRepos(logger *zap.Logger, planRepo PlanReposit
 		planRepo:        planRepo,
 		subscriptionRepo: subscriptionRepo,
 		userPlanRepo:    userPlanRepo,
-		buildCounts:     make(map[string]int),
-		ramUsage:        make(map[string]int),
+		counters:        newMemoryPlanCounters(),
 	}
 }
 
@@ -83,12 +114,37 @@ func (s *PlanEnforcementService) SetRepositories(planRepo PlanRepository, subscr
 	s.userPlanRepo = userPlanRepo
 }
 
+// SetUsageRepo sets the usage repository used for build minutes enforcement
+func (s *PlanEnforcementService) SetUsageRepo(usageRepo BuildUsageRepository) {
+	s.usageRepo = usageRepo
+}
+
+// SetCounters replaces the in-memory counters, e.g. with NewRedisPlanCounters so the API and all
+// workers count builds and RAM against the same totals
+func (s *PlanEnforcementService) SetCounters(counters PlanCounters) {
+	s.counters = counters
+}
+
 // PlanLimits represents the limits for a plan
 type PlanLimits struct {
+	PlanName           string // Empty when falling back to hardcoded defaults
 	MaxApps            int
 	MaxRAMMB           int
+	MaxDiskMB          int
 	MaxConcurrentBuilds int
 	QueuePriority      int // Higher number = higher priority
+	CustomDomains      bool
+	BuildMinutes       int // Monthly build minutes allowance, 0 = unlimited
+	MaxTeamMembers     int // Organization seats including the owner
+	HealthChecks       bool // Custom HTTP health checks with automatic restarts
+	ZeroDowntime       bool // Health-gated start-new-then-swap deploys with automatic rollback
+	AlwaysOn           bool // Apps keep running while idle (otherwise they are put to sleep)
+	Workers            bool // Background Procfile processes (worker, cron, ...) next to the web process
+	AutoDeploy         bool // Git host push webhooks build and deploy the pushed branch
+	AccessRules        bool // Apps can be restricted to IP ranges or put behind a shared password
+	ExecTimeout        time.Duration // Longest a one-off exec command may run
+	Build              BuildLimits   // CPU, memory and time each build may use
+	Isolation          IsolationLevel // How tightly app containers are confined on the host
 }
 
 // GetPlanLimits gets the limits for a user's plan
@@ -99,17 +155,24 @@ func (s *PlanEnforcementService) GetPlanLimits(ctx context.Context, userID strin
 		return &PlanLimits{
 			MaxApps:            3,
 			MaxRAMMB:           1024, // 1 GB
+			MaxDiskMB:          5120, // 5 GB
 			MaxConcurrentBuilds: 1,
-			QueuePriority:      1, // Low priority
+			QueuePriority:      QueuePriorityFree,
+			BuildMinutes:       300,
+			MaxTeamMembers:     1,
+			ExecTimeout:        defaultExecTimeout,
+			Build:              DefaultBuildLimits(),
+			Isolation:          DefaultIsolationLevel,
 		}, nil
 	}
 
 	// Try to get plan from subscription first
 	// Check both "active" and "trial" subscriptions (trial users should have plan limits enforced)
+	// "grace" (failed payment, read-only) keeps the paid plan's limits so running apps aren't treated as over-limit
 	var plan *PlanData
 	if s.subscriptionRepo != nil {
 		sub, err := s.subscriptionRepo.GetSubscriptionByUserID(ctx, userID)
-		if err == nil && sub != nil && (sub.Status == "active" || sub.Status == "trial") {
+		if err == nil && sub != nil && (sub.Status == "active" || sub.Status == "trial" || sub.Status == "grace") {
 			// TRIAL USERS: Always limit to Starter plan regardless of subscription plan name
 			if sub.Status == "trial" {
 				s.logger.Debug("Trial user - forcing Starter plan limits",
@@ -123,7 +186,9 @@ func (s *PlanEnforcementService) GetPlanLimits(ctx context.Context, userID strin
 						zap.String("user_id", userID),
 						zap.String("plan_name", plan.Name),
 					)
-					return s.planDataToLimits(plan), nil
+					limits := s.planDataToLimits(plan)
+					limits.QueuePriority = QueuePriorityFree
+					return limits, nil
 				}
 			} else {
 				// Active subscriptions use their assigned plan
@@ -165,7 +230,9 @@ func (s *PlanEnforcementService) GetPlanLimits(ctx context.Context, userID strin
 				zap.String("user_id", userID),
 				zap.String("plan_name", plan.Name),
 			)
-			return s.planDataToLimits(plan), nil
+			limits := s.planDataToLimits(plan)
+			limits.QueuePriority = QueuePriorityFree
+			return limits, nil
 		}
 	}
 
@@ -174,16 +241,22 @@ func (s *PlanEnforcementService) GetPlanLimits(ctx context.Context, userID strin
 	return &PlanLimits{
 		MaxApps:            3,
 		MaxRAMMB:           1024, // 1 GB
+		MaxDiskMB:          5120, // 5 GB
 		MaxConcurrentBuilds: 1,
-		QueuePriority:      1, // Low priority
+		QueuePriority:      QueuePriorityFree,
+		BuildMinutes:       300,
+		MaxTeamMembers:     1,
+		ExecTimeout:        defaultExecTimeout,
+		Build:              DefaultBuildLimits(),
+		Isolation:          DefaultIsolationLevel,
 	}, nil
 }
 
 // planDataToLimits converts PlanData to PlanLimits
 func (s *PlanEnforcementService) planDataToLimits(plan *PlanData) *PlanLimits {
-	queuePriority := 1 // Default low priority
+	queuePriority := QueuePriorityDefault
 	if plan.PriorityBuilds {
-		queuePriority = 10 // High priority
+		queuePriority = QueuePriorityPro
 	}
 
 	maxApps := plan.MaxApps
@@ -196,11 +269,49 @@ func (s *PlanEnforcementService) planDataToLimits(plan *PlanData) *PlanLimits {
 		maxRAMMB = 1024 // Default 1 GB
 	}
 
+	maxTeamMembers := plan.TeamMembers
+	if maxTeamMembers == 0 {
+		maxTeamMembers = 1 // Default: owner only
+	}
+
+	maxDiskMB := plan.MaxDiskMB
+	if maxDiskMB == 0 {
+		maxDiskMB = 5120 // Default 5 GB
+	}
+
+	execTimeout := time.Duration(plan.ExecTimeoutSeconds) * time.Second
+	if execTimeout <= 0 {
+		execTimeout = defaultExecTimeout
+	}
+
+	isolation, err := ParseIsolationLevel(plan.Isolation)
+	if err != nil {
+		isolation = DefaultIsolationLevel
+	}
+
 	return &PlanLimits{
+		PlanName:           plan.Name,
 		MaxApps:            maxApps,
 		MaxRAMMB:           maxRAMMB,
+		MaxDiskMB:          maxDiskMB,
 		MaxConcurrentBuilds: 1, // Can be made configurable per plan later
 		QueuePriority:      queuePriority,
+		CustomDomains:      plan.CustomDomains,
+		BuildMinutes:       plan.BuildMinutes,
+		MaxTeamMembers:     maxTeamMembers,
+		HealthChecks:       plan.HealthChecks,
+		ZeroDowntime:       plan.ZeroDowntime,
+		AlwaysOn:           plan.AlwaysOn,
+		Workers:            plan.Workers,
+		AutoDeploy:         plan.AutoDeploy,
+		AccessRules:        plan.AccessRules,
+		ExecTimeout:        execTimeout,
+		Isolation:          isolation,
+		Build: BuildLimits{
+			CPUShares: int64(plan.BuildCPUShares),
+			MemoryMB:  plan.BuildMemoryMB,
+			Timeout:   time.Duration(plan.BuildTimeoutMinutes) * time.Minute,
+		}.withDefaults(),
 	}
 }
 
@@ -255,9 +366,10 @@ func (s *PlanEnforcementService) CheckMaxRAM(ctx context.Context, userID string,
 		return fmt.Errorf("failed to get plan limits: %w", err)
 	}
 
-	s.ramUsageMu.RLock()
-	currentRAM := s.ramUsage[userID]
-	s.ramUsageMu.RUnlock()
+	currentRAM, err := s.counters.RAMUsage(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get RAM usage: %w", err)
+	}
 
 	if currentRAM+requestedRAMMB > limits.MaxRAMMB {
 		return &PlanLimitError{
@@ -280,9 +392,10 @@ func (s *PlanEnforcementService) CheckMaxConcurrentBuilds(ctx context.Context, u
 		return fmt.Errorf("failed to get plan limits: %w", err)
 	}
 
-	s.buildCountsMu.RLock()
-	currentBuilds := s.buildCounts[userID]
-	s.buildCountsMu.RUnlock()
+	currentBuilds, err := s.counters.BuildCount(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get build count: %w", err)
+	}
 
 	if currentBuilds >= limits.MaxConcurrentBuilds {
 		return &PlanLimitError{
@@ -297,6 +410,230 @@ func (s *PlanEnforcementService) CheckMaxConcurrentBuilds(ctx context.Context, u
 	return nil
 }
 
+// CheckCustomDomains checks if the user's plan includes the custom_domains feature
+func (s *PlanEnforcementService) CheckCustomDomains(ctx context.Context, userID string) error {
+	limits, err := s.GetPlanLimits(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get plan limits: %w", err)
+	}
+
+	if !limits.CustomDomains {
+		return &PlanLimitError{
+			Limit:   "custom_domains",
+			UserID:  userID,
+			Message: "Custom domains are not available on your plan. Please upgrade your plan to add custom domains.",
+		}
+	}
+
+	return nil
+}
+
+// CheckHealthChecks checks if the user's plan includes the health_checks feature
+func (s *PlanEnforcementService) CheckHealthChecks(ctx context.Context, userID string) error {
+	limits, err := s.GetPlanLimits(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get plan limits: %w", err)
+	}
+
+	if !limits.HealthChecks {
+		return &PlanLimitError{
+			Limit:   "health_checks",
+			UserID:  userID,
+			Message: "Custom health checks are not available on your plan. Please upgrade your plan to configure health checks and automatic restarts.",
+		}
+	}
+
+	return nil
+}
+
+// CheckWorkers checks if the user's plan includes the workers feature
+func (s *PlanEnforcementService) CheckWorkers(ctx context.Context, userID string) error {
+	limits, err := s.GetPlanLimits(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get plan limits: %w", err)
+	}
+
+	if !limits.Workers {
+		return &PlanLimitError{
+			Limit:   "workers",
+			UserID:  userID,
+			Message: "Worker processes are not available on your plan. Please upgrade your plan to run background workers.",
+		}
+	}
+
+	return nil
+}
+
+// CheckAutoDeploy checks if the user's plan deploys apps on pushes to their branch
+func (s *PlanEnforcementService) CheckAutoDeploy(ctx context.Context, userID string) error {
+	limits, err := s.GetPlanLimits(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get plan limits: %w", err)
+	}
+
+	if !limits.AutoDeploy {
+		return &PlanLimitError{
+			Limit:   "auto_deploy",
+			UserID:  userID,
+			Message: "Auto-deploy on push is not available on your plan. Please upgrade your plan to deploy from Git webhooks.",
+		}
+	}
+
+	return nil
+}
+
+// CheckAccessRules checks if the user's plan can restrict who reaches apps (IP allowlists, shared passwords)
+func (s *PlanEnforcementService) CheckAccessRules(ctx context.Context, userID string) error {
+	limits, err := s.GetPlanLimits(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get plan limits: %w", err)
+	}
+
+	if !limits.AccessRules {
+		return &PlanLimitError{
+			Limit:   "access_rules",
+			UserID:  userID,
+			Message: "Access rules are not available on your plan. Please upgrade your plan to restrict apps to IP ranges or protect them with a password.",
+		}
+	}
+
+	return nil
+}
+
+// CheckPlanChange checks that the user's enabled apps (appCount using ramMB in total) fit within plan
+// Returns the new plan's limits, or a PlanLimitError naming the first limit that would be exceeded
+func (s *PlanEnforcementService) CheckPlanChange(ctx context.Context, userID, plan string, appCount, ramMB int) (*PlanLimits, error) {
+	if s.planRepo == nil {
+		return nil, fmt.Errorf("plan repository not configured")
+	}
+	planData, err := s.planRepo.GetPlanByName(ctx, plan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan %s: %w", plan, err)
+	}
+	limits := s.planDataToLimits(planData)
+
+	if appCount > limits.MaxApps {
+		return limits, &PlanLimitError{
+			Limit:   "max_apps",
+			Current: appCount,
+			Max:     limits.MaxApps,
+			UserID:  userID,
+			Message: fmt.Sprintf("The %s plan allows %d apps and you have %d running. Delete or disable %d app(s) before switching.", plan, limits.MaxApps, appCount, appCount-limits.MaxApps),
+		}
+	}
+	if ramMB > limits.MaxRAMMB {
+		return limits, &PlanLimitError{
+			Limit:   "max_ram",
+			Current: ramMB,
+			Max:     limits.MaxRAMMB,
+			UserID:  userID,
+			Message: fmt.Sprintf("The %s plan allows %d MB of RAM and your apps use %d MB. Free up %d MB before switching.", plan, limits.MaxRAMMB, ramMB, ramMB-limits.MaxRAMMB),
+		}
+	}
+
+	return limits, nil
+}
+
+// GetExecTimeout gets how long a one-off exec command may run on the user's plan
+func (s *PlanEnforcementService) GetExecTimeout(ctx context.Context, userID string) (time.Duration, error) {
+	limits, err := s.GetPlanLimits(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get plan limits: %w", err)
+	}
+	return limits.ExecTimeout, nil
+}
+
+// GetIsolationLevel gets how tightly the user's app containers are confined on their plan
+func (s *PlanEnforcementService) GetIsolationLevel(ctx context.Context, userID string) (IsolationLevel, error) {
+	limits, err := s.GetPlanLimits(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get plan limits: %w", err)
+	}
+	return limits.Isolation, nil
+}
+
+// GetBuildLimits gets the CPU shares, memory and timeout builds run with on the user's plan
+func (s *PlanEnforcementService) GetBuildLimits(ctx context.Context, userID string) (BuildLimits, error) {
+	limits, err := s.GetPlanLimits(ctx, userID)
+	if err != nil {
+		return BuildLimits{}, fmt.Errorf("failed to get plan limits: %w", err)
+	}
+	return limits.Build, nil
+}
+
+// CheckZeroDowntime checks if the user's plan includes the zero_downtime feature
+func (s *PlanEnforcementService) CheckZeroDowntime(ctx context.Context, userID string) error {
+	limits, err := s.GetPlanLimits(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get plan limits: %w", err)
+	}
+
+	if !limits.ZeroDowntime {
+		return &PlanLimitError{
+			Limit:   "zero_downtime",
+			UserID:  userID,
+			Message: "Zero-downtime deploys are not available on your plan. Please upgrade your plan to enable health-gated deploys with automatic rollback.",
+		}
+	}
+
+	return nil
+}
+
+// CheckTeamMembers checks if an organization owned by the user can add another seat
+// currentSeats counts existing members (including the owner) plus pending invitations
+func (s *PlanEnforcementService) CheckTeamMembers(ctx context.Context, userID string, currentSeats int) error {
+	limits, err := s.GetPlanLimits(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get plan limits: %w", err)
+	}
+
+	if currentSeats >= limits.MaxTeamMembers {
+		return &PlanLimitError{
+			Limit:   "team_members",
+			Current: currentSeats,
+			Max:     limits.MaxTeamMembers,
+			UserID:  userID,
+			Message: fmt.Sprintf("This organization has used all %d team seats (members and pending invitations) included in the owner's plan. Please upgrade the plan to add more members.", limits.MaxTeamMembers),
+		}
+	}
+
+	return nil
+}
+
+// CheckBuildMinutes checks if user has build minutes left in the current monthly period
+func (s *PlanEnforcementService) CheckBuildMinutes(ctx context.Context, userID string) error {
+	if s.usageRepo == nil {
+		return nil
+	}
+
+	limits, err := s.GetPlanLimits(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get plan limits: %w", err)
+	}
+
+	if limits.BuildMinutes <= 0 {
+		return nil // Unlimited
+	}
+
+	periodStart, periodEnd := CurrentUsagePeriod(time.Now())
+	usedSeconds, err := s.usageRepo.SumUsage(ctx, userID, UsageMetricBuildSeconds, periodStart, periodEnd)
+	if err != nil {
+		return fmt.Errorf("failed to get build usage: %w", err)
+	}
+
+	if usedSeconds >= int64(limits.BuildMinutes)*60 {
+		return &PlanLimitError{
+			Limit:   "build_minutes",
+			Current: int(usedSeconds / 60),
+			Max:     limits.BuildMinutes,
+			UserID:  userID,
+			Message: fmt.Sprintf("You have used all %d build minutes included in your plan this month. Build minutes reset on %s. Please upgrade your plan to keep building.", limits.BuildMinutes, periodEnd.Format("January 2")),
+		}
+	}
+
+	return nil
+}
+
 // GetQueuePriority gets the queue priority for a user based on their plan
 func (s *PlanEnforcementService) GetQueuePriority(ctx context.Context, userID string) (int, error) {
 	limits, err := s.GetPlanLimits(ctx, userID)
@@ -309,14 +646,15 @@ func (s *PlanEnforcementService) GetQueuePriority(ctx context.Context, userID st
 
 // IncrementBuildCount increments the concurrent build count for a user
 func (s *PlanEnforcementService) IncrementBuildCount(ctx context.Context, userID string) error {
-	s.buildCountsMu.Lock()
-	defer s.buildCountsMu.Unlock()
+	count, err := s.counters.AdjustBuildCount(ctx, userID, 1)
+	if err != nil {
+		s.logger.Error("Failed to increment build count", zap.Error(err), zap.String("user_id", userID))
+		return err
+	}
 
-	s.buildCounts[userID]++
-	
 	s.logger.Debug("Incremented build count",
 		zap.String("user_id", userID),
-		zap.Int("current_builds", s.buildCounts[userID]),
+		zap.Int("current_builds", count),
 	)
 
 	return nil
@@ -324,32 +662,38 @@ func (s *PlanEnforcementService) IncrementBuildCount(ctx context.Context, userID
 
 // DecrementBuildCount decrements the concurrent build count for a user
 func (s *PlanEnforcementService) DecrementBuildCount(ctx context.Context, userID string) error {
-	s.buildCountsMu.Lock()
-	defer s.buildCountsMu.Unlock()
-
-	if s.buildCounts[userID] > 0 {
-		s.buildCounts[userID]--
+	count, err := s.counters.AdjustBuildCount(ctx, userID, -1)
+	if err != nil {
+		s.logger.Error("Failed to decrement build count", zap.Error(err), zap.String("user_id", userID))
+		return err
 	}
 
 	s.logger.Debug("Decremented build count",
 		zap.String("user_id", userID),
-		zap.Int("current_builds", s.buildCounts[userID]),
+		zap.Int("current_builds", count),
 	)
 
 	return nil
 }
 
+// ReconcileBuildCounts replaces the tracked build counts with counts (userID -> builds actually running)
+// Users missing from counts have no builds
+func (s *PlanEnforcementService) ReconcileBuildCounts(ctx context.Context, counts map[string]int) error {
+	return s.counters.ReconcileBuildCounts(ctx, counts)
+}
+
 // IncrementRAMUsage increments the RAM usage for a user
 func (s *PlanEnforcementService) IncrementRAMUsage(ctx context.Context, userID string, ramMB int) error {
-	s.ramUsageMu.Lock()
-	defer s.ramUsageMu.Unlock()
-
-	s.ramUsage[userID] += ramMB
+	total, err := s.counters.AdjustRAMUsage(ctx, userID, ramMB)
+	if err != nil {
+		s.logger.Error("Failed to increment RAM usage", zap.Error(err), zap.String("user_id", userID))
+		return err
+	}
 
 	s.logger.Debug("Incremented RAM usage",
 		zap.String("user_id", userID),
 		zap.Int("ram_mb", ramMB),
-		zap.Int("total_ram_mb", s.ramUsage[userID]),
+		zap.Int("total_ram_mb", total),
 	)
 
 	return nil
@@ -357,34 +701,89 @@ func (s *PlanEnforcementService) IncrementRAMUsage(ctx context.Context, userID s
 
 // DecrementRAMUsage decrements the RAM usage for a user
 func (s *PlanEnforcementService) DecrementRAMUsage(ctx context.Context, userID string, ramMB int) error {
-	s.ramUsageMu.Lock()
-	defer s.ramUsageMu.Unlock()
-
-	if s.ramUsage[userID] >= ramMB {
-		s.ramUsage[userID] -= ramMB
-	} else {
-		s.ramUsage[userID] = 0
+	total, err := s.counters.AdjustRAMUsage(ctx, userID, -ramMB)
+	if err != nil {
+		s.logger.Error("Failed to decrement RAM usage", zap.Error(err), zap.String("user_id", userID))
+		return err
 	}
 
 	s.logger.Debug("Decremented RAM usage",
 		zap.String("user_id", userID),
 		zap.Int("ram_mb", ramMB),
-		zap.Int("total_ram_mb", s.ramUsage[userID]),
+		zap.Int("total_ram_mb", total),
 	)
 
 	return nil
 }
 
-// GetCurrentUsage gets the current usage for a user
-func (s *PlanEnforcementService) GetCurrentUsage(ctx context.Context, userID string) (currentBuilds int, currentRAMMB int, err error) {
-	s.buildCountsMu.RLock()
-	currentBuilds = s.buildCounts[userID]
-	s.buildCountsMu.RUnlock()
+// ReserveAppRAM reserves ramMB for a deploy of appID, replacing whatever the app held before
+// (a redeploy replaces the old container, so it must not count twice)
+// Returns the previous reservation so a failed deploy can hand it back via SettleAppRAM
+func (s *PlanEnforcementService) ReserveAppRAM(ctx context.Context, userID, appID string, ramMB int) (previousMB int) {
+	previousMB, total, err := s.counters.ReserveAppRAM(ctx, userID, appID, ramMB)
+	if err != nil {
+		// Reconciliation picks the container up once it runs
+		s.logger.Error("Failed to reserve app RAM", zap.Error(err), zap.String("app_id", appID))
+		return 0
+	}
+
+	s.logger.Debug("Reserved app RAM",
+		zap.String("user_id", userID),
+		zap.String("app_id", appID),
+		zap.Int("ram_mb", ramMB),
+		zap.Int("previous_ram_mb", previousMB),
+		zap.Int("total_ram_mb", total),
+	)
+	return previousMB
+}
+
+// SettleAppRAM finishes the reservation made by ReserveAppRAM
+// A successful deploy keeps it; a failed one restores previousMB (the old container keeps
+// running after a rollback) or releases the app entirely when there was none
+func (s *PlanEnforcementService) SettleAppRAM(ctx context.Context, appID string, deployed bool, previousMB int) {
+	if err := s.counters.SettleAppRAM(ctx, appID, deployed, previousMB); err != nil {
+		s.logger.Error("Failed to settle app RAM", zap.Error(err), zap.String("app_id", appID))
+		return
+	}
+
+	if !deployed {
+		s.logger.Debug("Released RAM of failed deploy",
+			zap.String("app_id", appID),
+			zap.Int("restored_ram_mb", previousMB),
+		)
+	}
+}
+
+// ReleaseAppRAM releases everything appID holds (app stopped, crashed or deleted)
+func (s *PlanEnforcementService) ReleaseAppRAM(ctx context.Context, appID string) {
+	if err := s.counters.ReleaseAppRAM(ctx, appID); err != nil {
+		s.logger.Error("Failed to release app RAM", zap.Error(err), zap.String("app_id", appID))
+		return
+	}
 
-	s.ramUsageMu.RLock()
-	currentRAMMB = s.ramUsage[userID]
-	s.ramUsageMu.RUnlock()
+	s.logger.Debug("Released app RAM", zap.String("app_id", appID))
+}
+
+// ReconcileRAMUsage replaces the tracked RAM usage with what the running containers actually use
+// running maps appID to its container's usage. Deploys still in flight keep their reservation.
+// Returns how many apps were corrected
+func (s *PlanEnforcementService) ReconcileRAMUsage(ctx context.Context, running map[string]AppRAMUsage) int {
+	corrected, err := s.counters.ReconcileRAMUsage(ctx, running)
+	if err != nil {
+		s.logger.Error("Failed to reconcile RAM usage", zap.Error(err))
+		return 0
+	}
+	return corrected
+}
 
+// GetCurrentUsage gets the current usage for a user
+func (s *PlanEnforcementService) GetCurrentUsage(ctx context.Context, userID string) (currentBuilds int, currentRAMMB int, err error) {
+	if currentBuilds, err = s.counters.BuildCount(ctx, userID); err != nil {
+		return 0, 0, err
+	}
+	if currentRAMMB, err = s.counters.RAMUsage(ctx, userID); err != nil {
+		return 0, 0, err
+	}
 	return currentBuilds, currentRAMMB, nil
 }
 
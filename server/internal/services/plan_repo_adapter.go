@@ -84,12 +84,57 @@ func (a *PlanRepoAdapter) convertToPlanData(plan interface{}) (*PlanData, error)
 	if f := v.FieldByName("MaxRAMMB"); f.IsValid() && f.Kind() == reflect.Int {
 		planData.MaxRAMMB = int(f.Int())
 	}
+	if f := v.FieldByName("MaxDiskMB"); f.IsValid() && f.Kind() == reflect.Int {
+		planData.MaxDiskMB = int(f.Int())
+	}
 	if f := v.FieldByName("MaxApps"); f.IsValid() && f.Kind() == reflect.Int {
 		planData.MaxApps = int(f.Int())
 	}
 	if f := v.FieldByName("PriorityBuilds"); f.IsValid() && f.Kind() == reflect.Bool {
 		planData.PriorityBuilds = f.Bool()
 	}
+	if f := v.FieldByName("CustomDomains"); f.IsValid() && f.Kind() == reflect.Bool {
+		planData.CustomDomains = f.Bool()
+	}
+	if f := v.FieldByName("BuildMinutes"); f.IsValid() && f.Kind() == reflect.Int {
+		planData.BuildMinutes = int(f.Int())
+	}
+	if f := v.FieldByName("TeamMembers"); f.IsValid() && f.Kind() == reflect.Int {
+		planData.TeamMembers = int(f.Int())
+	}
+	if f := v.FieldByName("HealthChecks"); f.IsValid() && f.Kind() == reflect.Bool {
+		planData.HealthChecks = f.Bool()
+	}
+	if f := v.FieldByName("ZeroDowntime"); f.IsValid() && f.Kind() == reflect.Bool {
+		planData.ZeroDowntime = f.Bool()
+	}
+	if f := v.FieldByName("AlwaysOn"); f.IsValid() && f.Kind() == reflect.Bool {
+		planData.AlwaysOn = f.Bool()
+	}
+	if f := v.FieldByName("Workers"); f.IsValid() && f.Kind() == reflect.Bool {
+		planData.Workers = f.Bool()
+	}
+	if f := v.FieldByName("AutoDeploy"); f.IsValid() && f.Kind() == reflect.Bool {
+		planData.AutoDeploy = f.Bool()
+	}
+	if f := v.FieldByName("AccessRules"); f.IsValid() && f.Kind() == reflect.Bool {
+		planData.AccessRules = f.Bool()
+	}
+	if f := v.FieldByName("ExecTimeoutSeconds"); f.IsValid() && f.Kind() == reflect.Int {
+		planData.ExecTimeoutSeconds = int(f.Int())
+	}
+	if f := v.FieldByName("BuildCPUShares"); f.IsValid() && f.Kind() == reflect.Int {
+		planData.BuildCPUShares = int(f.Int())
+	}
+	if f := v.FieldByName("BuildMemoryMB"); f.IsValid() && f.Kind() == reflect.Int {
+		planData.BuildMemoryMB = int(f.Int())
+	}
+	if f := v.FieldByName("BuildTimeoutMinutes"); f.IsValid() && f.Kind() == reflect.Int {
+		planData.BuildTimeoutMinutes = int(f.Int())
+	}
+	if f := v.FieldByName("Isolation"); f.IsValid() && f.Kind() == reflect.String {
+		planData.Isolation = f.String()
+	}
 
 	if planData.Name == "" {
 		return nil, fmt.Errorf("failed to extract plan name from %T", plan)
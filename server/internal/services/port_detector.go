@@ -131,6 +131,29 @@ func (d *PortDetector) scanForPorts(repoPath string, runtime Runtime) []int {
 		}
 		filePatterns = []string{"*.properties", "*.yml", "*.yaml"}
 		
+	case RuntimeRust:
+		// Rust patterns: TcpListener::bind("0.0.0.0:3000"), SocketAddr::from(([0, 0, 0, 0], 3000))
+		patterns = []*regexp.Regexp{
+			regexp.MustCompile(`bind\s*\(\s*"[^"]*:(\d+)"`),                  // bind("0.0.0.0:3000")
+			regexp.MustCompile(`\[\s*\d+\s*,\s*\d+\s*,\s*\d+\s*,\s*\d+\s*\]\s*,\s*(\d+)\s*\)`), // ([0, 0, 0, 0], 3000)
+		}
+		filePatterns = []string{"*.rs"}
+
+	case RuntimeElixir:
+		// Elixir patterns: http: [port: 4000], port: 4000
+		patterns = []*regexp.Regexp{
+			regexp.MustCompile(`port:\s*(\d+)`), // port: 4000
+		}
+		filePatterns = []string{"*.ex", "*.exs"}
+
+	case RuntimeDeno, RuntimeBun:
+		// Deno/Bun patterns: Deno.serve({ port: 8000 }), Bun.serve({ port: 3000 }), app.listen(3000)
+		patterns = []*regexp.Regexp{
+			regexp.MustCompile(`\.listen\s*\(\s*(\d+)\s*[,)]`), // app.listen(3000)
+			regexp.MustCompile(`port:\s*(\d+)`),                // serve({ port: 8000 })
+		}
+		filePatterns = []string{"*.js", "*.jsx", "*.ts", "*.tsx", "*.mjs"}
+
 	default:
 		// For other runtimes, use generic patterns
 		patterns = []*regexp.Regexp{
@@ -180,13 +203,11 @@ func (d *PortDetector) scanForPorts(repoPath string, runtime Runtime) []int {
 		}
 
 		// Read file content
-		content, err := os.ReadFile(path)
+		contentStr, err := readTextFile(path)
 		if err != nil {
 			return nil // Skip files that can't be read
 		}
 
-		contentStr := string(content)
-
 		// Check for environment variable usage (good practice)
 		// If file uses process.env.PORT or similar, skip hardcoded detection for this file
 		envPatterns := []string{
@@ -196,6 +217,10 @@ func (d *PortDetector) scanForPorts(repoPath string, runtime Runtime) []int {
 			"os.Getenv(\"PORT\"",
 			"ENV['PORT']",
 			"ENV[\"PORT\"]",
+			"Deno.env.get(\"PORT\"",
+			"Bun.env.PORT",
+			"env::var(\"PORT\"",
+			"System.get_env(\"PORT\"",
 		}
 		usesEnvPort := false
 		for _, envPattern := range envPatterns {
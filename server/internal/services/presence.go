@@ -0,0 +1,220 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/google/uuid"
+)
+
+// traefikRequestsMetric is Traefik's per-service request counter (--metrics.prometheus.addServicesLabels)
+const traefikRequestsMetric = "traefik_service_requests_total"
+
+// AppIDFromTraefikService extracts the app ID from the Traefik service name of an app container
+// (see RoutingService.Labels); other services such as the API or the fallback page are ignored
+func AppIDFromTraefikService(serviceName string) (string, bool) {
+	name, _, _ := strings.Cut(serviceName, "@")
+	appID, ok := strings.CutPrefix(name, "app-")
+	if !ok {
+		return "", false
+	}
+	if _, err := uuid.Parse(appID); err != nil {
+		return "", false
+	}
+	return appID, true
+}
+
+// TraefikAppRequests returns the number of requests Traefik has routed to each app since it started,
+// summed over status codes, methods and protocols. Read from Traefik's Prometheus metrics on its API
+// entrypoint; apps nobody requested since Traefik started are missing
+func (s *DeploymentService) TraefikAppRequests(ctx context.Context) (map[string]float64, error) {
+	if s.traefikAPIURL == "" {
+		return nil, fmt.Errorf("traefik API URL is not configured")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.traefikAPIURL+"/metrics", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scrape Traefik metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("traefik metrics returned status %d (is --metrics.prometheus enabled?)", resp.StatusCode)
+	}
+	return parseTraefikAppRequests(resp.Body)
+}
+
+// parseTraefikAppRequests sums traefikRequestsMetric per app in a Prometheus text exposition
+func parseTraefikAppRequests(r io.Reader) (map[string]float64, error) {
+	requests := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		labels, ok := strings.CutPrefix(line, traefikRequestsMetric+"{")
+		if !ok {
+			continue
+		}
+		labels, value, ok := strings.Cut(labels, "} ")
+		if !ok {
+			continue
+		}
+		appID, ok := AppIDFromTraefikService(promLabel(labels, "service"))
+		if !ok {
+			continue
+		}
+		value, _, _ = strings.Cut(value, " ") // Drop the optional timestamp
+		count, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		requests[appID] += count
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read Traefik metrics: %w", err)
+	}
+	return requests, nil
+}
+
+// promLabel returns the value of a label in a Prometheus label set. Traefik's label values (service
+// names, methods, codes) contain no commas or escaped quotes, so splitting on commas is enough
+func promLabel(labels, name string) string {
+	for _, pair := range strings.Split(labels, ",") {
+		if value, ok := strings.CutPrefix(pair, name+`="`); ok {
+			return strings.TrimSuffix(value, `"`)
+		}
+	}
+	return ""
+}
+
+// AppUpstreamConnections counts the established TCP connections from the Traefik container to each app's
+// running containers: open WebSockets and streams, plus idle keep-alive connections Traefik pools.
+// Read from the kernel's socket tables inside traefikContainer; apps without connections are missing
+func (s *DeploymentService) AppUpstreamConnections(ctx context.Context, traefikContainer string) (map[string]int, error) {
+	filter := filters.NewArgs()
+	filter.Add("label", "app.id")
+	containers, err := s.client.ContainerList(ctx, container.ListOptions{Filters: filter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list app containers: %w", err)
+	}
+
+	// Traefik dials the container's address on the app network at the port in its service label
+	upstreams := make(map[netip.AddrPort]string)
+	for _, c := range containers {
+		appID := c.Labels["app.id"]
+		port, err := strconv.ParseUint(c.Labels[fmt.Sprintf("traefik.http.services.app-%s.loadbalancer.server.port", appID)], 10, 16)
+		if err != nil || c.NetworkSettings == nil {
+			continue
+		}
+		networkInfo, ok := c.NetworkSettings.Networks[s.networkName]
+		if !ok {
+			continue
+		}
+		addr, err := netip.ParseAddr(networkInfo.IPAddress)
+		if err != nil {
+			continue
+		}
+		upstreams[netip.AddrPortFrom(addr, uint16(port))] = appID
+	}
+	if len(upstreams) == 0 {
+		return map[string]int{}, nil
+	}
+
+	tables, err := s.execOutput(ctx, traefikContainer, []string{"cat", "/proc/net/tcp", "/proc/net/tcp6"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Traefik's sockets: %w", err)
+	}
+
+	connections := make(map[string]int)
+	for _, remote := range establishedRemotes(tables) {
+		if appID, ok := upstreams[remote]; ok {
+			connections[appID]++
+		}
+	}
+	return connections, nil
+}
+
+// execOutput runs cmd in a container and returns its stdout
+func (s *DeploymentService) execOutput(ctx context.Context, containerID string, cmd []string) ([]byte, error) {
+	execResp, err := s.client.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec: %w", err)
+	}
+	attach, err := s.client.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to exec: %w", err)
+	}
+	defer attach.Close()
+
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, attach.Reader); err != nil {
+		return nil, fmt.Errorf("failed to read exec output: %w", err)
+	}
+	inspect, err := s.client.ContainerExecInspect(ctx, execResp.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect exec: %w", err)
+	}
+	if inspect.ExitCode != 0 {
+		return nil, fmt.Errorf("%s exited with code %d: %s", cmd[0], inspect.ExitCode, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// establishedRemotes returns the remote address of every ESTABLISHED socket in /proc/net/tcp{,6} output
+func establishedRemotes(tables []byte) []netip.AddrPort {
+	var remotes []netip.AddrPort
+	for _, line := range strings.Split(string(tables), "\n") {
+		// sl local_address rem_address st ...
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[3] != "01" {
+			continue
+		}
+		if remote, ok := parseProcNetAddr(fields[2]); ok {
+			remotes = append(remotes, remote)
+		}
+	}
+	return remotes
+}
+
+// parseProcNetAddr parses an address from /proc/net/tcp{,6}: hex IP in host (little-endian) 32-bit
+// words, a colon and the hex port. IPv4-mapped IPv6 addresses are returned as IPv4
+func parseProcNetAddr(s string) (netip.AddrPort, bool) {
+	hexIP, hexPort, ok := strings.Cut(s, ":")
+	if !ok {
+		return netip.AddrPort{}, false
+	}
+	raw, err := hex.DecodeString(hexIP)
+	if err != nil || (len(raw) != 4 && len(raw) != 16) {
+		return netip.AddrPort{}, false
+	}
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return netip.AddrPort{}, false
+	}
+	for i := 0; i < len(raw); i += 4 {
+		raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	addr, ok := netip.AddrFromSlice(raw)
+	if !ok {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(addr.Unmap(), uint16(port)), true
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// WebProcess is the Procfile process served by the app's routed container
+const WebProcess = "web"
+
+// procfileLine matches "name: command"; names become part of container names, so they stay DNS-safe
+var procfileLine = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9_-]{0,62})\s*:\s*(.*)$`)
+
+// ProcessType is a process declared in an app's Procfile
+type ProcessType struct {
+	Name    string
+	Command string // Run with /bin/sh -c in the app image
+}
+
+// ParseProcfile reads the Procfile in an app's root directory and returns its background processes
+// (every entry but web: worker, cron, clock, ...). The web entry is started by the generated image
+// itself. Returns nil without error when the app has no Procfile. Names are lowercased; a repeated
+// name keeps its last command, like Heroku
+func ParseProcfile(appPath string) ([]ProcessType, error) {
+	content, err := readTextFile(filepath.Join(appPath, "Procfile"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read Procfile: %w", err)
+	}
+
+	var processes []ProcessType
+	index := make(map[string]int)
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		match := procfileLine.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("Procfile line %d is not \"name: command\": %q", i+1, line)
+		}
+		name, command := strings.ToLower(match[1]), strings.TrimSpace(match[2])
+		if command == "" {
+			return nil, fmt.Errorf("Procfile process %q has no command", name)
+		}
+		if name == WebProcess {
+			continue
+		}
+
+		if j, ok := index[name]; ok {
+			processes[j].Command = command
+			continue
+		}
+		index[name] = len(processes)
+		processes = append(processes, ProcessType{Name: name, Command: command})
+	}
+	return processes, nil
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Git hosts whose push webhooks deploy apps (POST /api/v1/hooks/{provider})
+const (
+	PushProviderGitLab    = "gitlab"
+	PushProviderBitbucket = "bitbucket"
+)
+
+// zeroSHA is the "after" commit of a push that deleted the branch
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// PushEvent is a branch push reported by a Git host's webhook, in the same shape for every provider
+type PushEvent struct {
+	Provider  string   // PushProviderGitLab or PushProviderBitbucket
+	RepoURLs  []string // URLs of the pushed repository (web and HTTPS clone URL), matched against app repo URLs
+	Branch    string
+	CommitSHA string // Head of the branch after the push
+	Author    string // Author of the head commit
+	Message   string // Message of the head commit
+	// Repository paths the push added, modified or removed; empty when the provider does not report
+	// them or listed only some of the commits, in which case every app of the repository is affected
+	ChangedPaths []string
+}
+
+// GenerateDeployHookSecret returns a new secret for an app's push webhooks
+// GitLab sends it as-is in X-Gitlab-Token; Bitbucket signs deliveries with it
+func GenerateDeployHookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate deploy hook secret: %w", err)
+	}
+	return "dhsec_" + hex.EncodeToString(b), nil
+}
+
+// VerifyGitLabToken reports whether the X-Gitlab-Token header of a delivery is the app's secret
+func VerifyGitLabToken(secret, token string) bool {
+	if secret == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(token)) == 1
+}
+
+// VerifyBitbucketSignature reports whether the X-Hub-Signature header of a delivery ("sha256=<hex>")
+// is the HMAC-SHA256 of the raw body keyed with the app's secret
+func VerifyBitbucketSignature(secret string, body []byte, signature string) bool {
+	if secret == "" {
+		return false
+	}
+	sig, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal([]byte(strings.ToLower(sig)), []byte(hex.EncodeToString(mac.Sum(nil))))
+}
+
+// gitLabPush is the part of a GitLab "Push Hook" payload a deploy needs
+type gitLabPush struct {
+	Ref               string `json:"ref"`
+	After             string `json:"after"`
+	CheckoutSHA       string `json:"checkout_sha"`
+	TotalCommitsCount int    `json:"total_commits_count"`
+	Project           struct {
+		WebURL     string `json:"web_url"`
+		GitHTTPURL string `json:"git_http_url"`
+	} `json:"project"`
+	Commits []struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+		Author  struct {
+			Name string `json:"name"`
+		} `json:"author"`
+		Added    []string `json:"added"`
+		Modified []string `json:"modified"`
+		Removed  []string `json:"removed"`
+	} `json:"commits"`
+}
+
+// ParseGitLabPush parses a GitLab webhook delivery (event is its X-Gitlab-Event header)
+// Anything but a push to a branch (tag pushes, branch deletions, other events) yields no push events
+func ParseGitLabPush(event string, body []byte) ([]PushEvent, error) {
+	if event != "Push Hook" {
+		return nil, nil
+	}
+	var payload gitLabPush
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid GitLab push payload: %w", err)
+	}
+
+	branch, ok := strings.CutPrefix(payload.Ref, "refs/heads/")
+	head := payload.CheckoutSHA
+	if head == "" {
+		head = payload.After
+	}
+	if !ok || head == "" || head == zeroSHA {
+		return nil, nil
+	}
+
+	push := PushEvent{
+		Provider:  PushProviderGitLab,
+		RepoURLs:  nonEmpty(payload.Project.WebURL, payload.Project.GitHTTPURL),
+		Branch:    branch,
+		CommitSHA: head,
+	}
+	// Commits are listed oldest first; the head is usually the last one
+	for i := len(payload.Commits) - 1; i >= 0; i-- {
+		if c := payload.Commits[i]; c.ID == head {
+			push.Author = c.Author.Name
+			push.Message = strings.TrimSpace(c.Message)
+			break
+		}
+	}
+	// GitLab lists at most 20 commits; the paths of a longer push are incomplete
+	if len(payload.Commits) > 0 && payload.TotalCommitsCount <= len(payload.Commits) {
+		seen := make(map[string]bool)
+		for _, c := range payload.Commits {
+			for _, paths := range [][]string{c.Added, c.Modified, c.Removed} {
+				for _, p := range paths {
+					if !seen[p] {
+						seen[p] = true
+						push.ChangedPaths = append(push.ChangedPaths, p)
+					}
+				}
+			}
+		}
+	}
+	return []PushEvent{push}, nil
+}
+
+// bitbucketPush is the part of a Bitbucket Cloud "repo:push" payload a deploy needs
+type bitbucketPush struct {
+	Repository struct {
+		Links struct {
+			HTML struct {
+				Href string `json:"href"`
+			} `json:"html"`
+		} `json:"links"`
+	} `json:"repository"`
+	Push struct {
+		Changes []struct {
+			New *struct {
+				Type   string `json:"type"`
+				Name   string `json:"name"`
+				Target struct {
+					Hash    string `json:"hash"`
+					Message string `json:"message"`
+					Author  struct {
+						Raw  string `json:"raw"`
+						User *struct {
+							DisplayName string `json:"display_name"`
+						} `json:"user"`
+					} `json:"author"`
+				} `json:"target"`
+			} `json:"new"`
+		} `json:"changes"`
+	} `json:"push"`
+}
+
+// ParseBitbucketPush parses a Bitbucket Cloud webhook delivery (eventKey is its X-Event-Key header)
+// One push can update several branches, so it can yield several push events; tag pushes and branch
+// deletions (changes without a new branch) yield none
+func ParseBitbucketPush(eventKey string, body []byte) ([]PushEvent, error) {
+	if eventKey != "repo:push" {
+		return nil, nil
+	}
+	var payload bitbucketPush
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid Bitbucket push payload: %w", err)
+	}
+
+	var pushes []PushEvent
+	for _, change := range payload.Push.Changes {
+		if change.New == nil || change.New.Type != "branch" || change.New.Target.Hash == "" {
+			continue
+		}
+		target := change.New.Target
+		author := target.Author.Raw
+		if target.Author.User != nil && target.Author.User.DisplayName != "" {
+			author = target.Author.User.DisplayName
+		}
+		pushes = append(pushes, PushEvent{
+			Provider:  PushProviderBitbucket,
+			RepoURLs:  nonEmpty(payload.Repository.Links.HTML.Href),
+			Branch:    change.New.Name,
+			CommitSHA: target.Hash,
+			Author:    author,
+			Message:   strings.TrimSpace(target.Message),
+		})
+	}
+	return pushes, nil
+}
+
+// nonEmpty returns the non-empty strings of values
+func nonEmpty(values ...string) []string {
+	var out []string
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGitLabPushChangedPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "paths of every commit, once each",
+			body: `{"ref":"refs/heads/main","checkout_sha":"b2","total_commits_count":2,"commits":[
+				{"id":"a1","added":["apps/api/main.go"],"modified":["README.md"]},
+				{"id":"b2","modified":["apps/api/main.go"],"removed":["apps/web/old.js"]}]}`,
+			want: []string{"apps/api/main.go", "README.md", "apps/web/old.js"},
+		},
+		{
+			name: "truncated commit list",
+			body: `{"ref":"refs/heads/main","checkout_sha":"b2","total_commits_count":25,"commits":[
+				{"id":"b2","modified":["apps/api/main.go"]}]}`,
+			want: nil,
+		},
+		{
+			name: "no commits listed",
+			body: `{"ref":"refs/heads/main","checkout_sha":"b2","total_commits_count":0,"commits":[]}`,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pushes, err := ParseGitLabPush("Push Hook", []byte(tt.body))
+			if err != nil || len(pushes) != 1 {
+				t.Fatalf("ParseGitLabPush = %v, %v; want one push", pushes, err)
+			}
+			if got := pushes[0].ChangedPaths; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChangedPaths = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRootDirAffected(t *testing.T) {
+	tests := []struct {
+		name    string
+		rootDir string
+		changed []string
+		want    bool
+	}{
+		{"repository root", "", []string{"apps/web/index.js"}, true},
+		{"unknown paths", "apps/api", nil, true},
+		{"file under root dir", "apps/api", []string{"apps/web/index.js", "apps/api/main.go"}, true},
+		{"root dir with ./ prefix", "./apps/api/", []string{"apps/api/go.mod"}, true},
+		{"other app only", "apps/api", []string{"apps/web/index.js", "README.md"}, false},
+		{"sibling with the same prefix", "apps/api", []string{"apps/api-docs/index.md"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RootDirAffected(tt.rootDir, tt.changed); got != tt.want {
+				t.Errorf("RootDirAffected(%q, %q) = %v, want %v", tt.rootDir, tt.changed, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"stackyn/server/internal/metrics"
+)
+
+const (
+	// readCachePrefix namespaces the cached reads in Redis
+	readCachePrefix = "stackyn:cache:"
+	// readCacheTimeout bounds each cache call, so a slow Redis costs a request little more than a miss
+	readCacheTimeout = 250 * time.Millisecond
+)
+
+// ReadCache keeps hot database reads (user profiles, subscriptions, app lists) in Redis for a short TTL.
+// Repositories read through it and drop the entries their writes change; writes made elsewhere show up
+// once the entry expires. Entries are gob-encoded so fields hidden from JSON survive.
+// The database stays the source of truth: Redis errors count as misses, and every method does nothing
+// on a nil cache
+type ReadCache struct {
+	client *redis.Client
+	ttl    time.Duration
+	logger *zap.Logger
+}
+
+// NewReadCache keeps entries in Redis through client (see NewRedisClient) for ttl
+func NewReadCache(client *redis.Client, ttl time.Duration, logger *zap.Logger) *ReadCache {
+	return &ReadCache{client: client, ttl: ttl, logger: logger}
+}
+
+// Get decodes the entry under key into dest and reports whether there was one
+func (c *ReadCache) Get(ctx context.Context, key string, dest interface{}) bool {
+	if c == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, readCacheTimeout)
+	defer cancel()
+
+	kind, _, _ := strings.Cut(key, ":")
+	raw, err := c.client.Get(ctx, readCachePrefix+key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			c.logger.Warn("Failed to read cache", zap.Error(err), zap.String("key", key))
+		}
+		metrics.CacheRequestsTotal.Inc(kind, "miss")
+		return false
+	}
+	if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(dest); err != nil {
+		// Written by a version with a different type - the next Set replaces it
+		c.logger.Warn("Failed to decode cache entry", zap.Error(err), zap.String("key", key))
+		metrics.CacheRequestsTotal.Inc(kind, "miss")
+		return false
+	}
+	metrics.CacheRequestsTotal.Inc(kind, "hit")
+	return true
+}
+
+// Set stores value under key for the cache TTL
+func (c *ReadCache) Set(ctx context.Context, key string, value interface{}) {
+	if c == nil {
+		return
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		c.logger.Warn("Failed to encode cache entry", zap.Error(err), zap.String("key", key))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), readCacheTimeout)
+	defer cancel()
+	if err := c.client.Set(ctx, readCachePrefix+key, buf.Bytes(), c.ttl).Err(); err != nil {
+		c.logger.Warn("Failed to write cache", zap.Error(err), zap.String("key", key))
+	}
+}
+
+// Invalidate drops the entries under keys after a write changed what they hold
+func (c *ReadCache) Invalidate(ctx context.Context, keys ...string) {
+	if c == nil || len(keys) == 0 {
+		return
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = readCachePrefix + key
+	}
+
+	// The write already happened, so the entry must go even if the client went away
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), readCacheTimeout)
+	defer cancel()
+	if err := c.client.Del(ctx, prefixed...).Err(); err != nil {
+		// The stale entry is served until it expires
+		c.logger.Warn("Failed to invalidate cache", zap.Error(err), zap.Strings("keys", keys))
+	}
+}
+
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NewRedisClient connects to Redis. Each process builds one client in main and hands it to the
+// services that keep state in Redis, so they share one connection pool
+func NewRedisClient(redisAddr, redisPassword string) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     redisAddr,
+		Password: redisPassword,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	return client, nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	stackynerrors "stackyn/server/internal/errors"
+)
+
+// maxRootDirLength matches the apps.root_dir column
+const maxRootDirLength = 255
+
+// NormalizeRootDir validates an app's root directory and returns it in canonical form
+// ("apps/api", no leading "./" or slashes). Empty, "." and "/" mean the repository root and
+// normalize to "". Paths that leave the repository (absolute or containing "..") are rejected
+func NormalizeRootDir(rootDir string) (string, error) {
+	rootDir = strings.TrimSpace(strings.ReplaceAll(rootDir, "\\", "/"))
+	if len(rootDir) > maxRootDirLength {
+		return "", fmt.Errorf("root directory must be at most %d characters", maxRootDirLength)
+	}
+	for _, part := range strings.Split(rootDir, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("root directory must not contain '..'")
+		}
+	}
+
+	cleaned := strings.Trim(path.Clean("/"+rootDir), "/")
+	if strings.HasPrefix(cleaned, ".git") && (len(cleaned) == 4 || cleaned[4] == '/') {
+		return "", fmt.Errorf("root directory must not be inside .git")
+	}
+	return cleaned, nil
+}
+
+// ResolveRootDir returns the directory inside a clone that an app builds from
+// Symlinks are resolved so a root_dir that points outside the clone is rejected
+func ResolveRootDir(clonePath, rootDir string) (string, error) {
+	rootDir, err := NormalizeRootDir(rootDir)
+	if err != nil {
+		return "", stackynerrors.Wrap(stackynerrors.ErrorCodeRootDirNotFound, err, err.Error())
+	}
+	if rootDir == "" {
+		return clonePath, nil
+	}
+
+	buildPath := filepath.Join(clonePath, filepath.FromSlash(rootDir))
+	info, err := os.Stat(buildPath)
+	if err != nil || !info.IsDir() {
+		return "", stackynerrors.New(stackynerrors.ErrorCodeRootDirNotFound,
+			fmt.Sprintf("Root directory '%s' not found in the repository", rootDir))
+	}
+
+	realClone, err := filepath.EvalSymlinks(clonePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve clone path: %w", err)
+	}
+	realBuild, err := filepath.EvalSymlinks(buildPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve root directory: %w", err)
+	}
+	if rel, err := filepath.Rel(realClone, realBuild); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", stackynerrors.New(stackynerrors.ErrorCodeRootDirNotFound,
+			fmt.Sprintf("Root directory '%s' points outside the repository", rootDir))
+	}
+	return buildPath, nil
+}
+
+// RootDirAffected reports whether a push that changed the given repository paths touches an
+// app's root directory, so webhook deploys can skip pushes that only change other apps of a monorepo
+// Apps built from the repository root are affected by every change. A push whose changed
+// paths are unknown (empty list, e.g. a truncated webhook payload) is treated as affecting the app
+func RootDirAffected(rootDir string, changedPaths []string) bool {
+	rootDir, err := NormalizeRootDir(rootDir)
+	if err != nil || rootDir == "" || len(changedPaths) == 0 {
+		return true
+	}
+	for _, changed := range changedPaths {
+		changed = strings.TrimPrefix(path.Clean("/"+changed), "/")
+		if changed == rootDir || strings.HasPrefix(changed, rootDir+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"fmt"
+	"net/netip"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Limits on per-app routing options
+const (
+	MinRequestBodyBytes = 1 << 10 // 1 KB
+	MaxRequestBodyBytes = 1 << 30 // 1 GB
+	maxRoutingHeaders   = 20
+	maxIPAllowlist      = 50
+	maxHeaderValueLen   = 1024
+)
+
+// headerNamePattern matches HTTP header field names (RFC 9110 tokens)
+var headerNamePattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// reservedHeaders are managed by Traefik or the HTTP stack and cannot be set per app
+var reservedHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Content-Encoding":  true,
+	"Host":              true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+// RoutingConfig is an app's edge options, applied as Traefik middlewares on its routers
+type RoutingConfig struct {
+	ForceHTTPS          bool              // Redirect HTTP to HTTPS; otherwise the app is served on both
+	Compression         bool              // Compress responses with brotli or gzip, as the client accepts
+	MaxRequestBodyBytes int64             // Larger request bodies are rejected with 413; 0 for no limit
+	Headers             map[string]string // Headers added to every response
+	BasicAuthUser       string            // htpasswd entry (user:bcrypt hash) requests must authenticate as; empty for none
+	IPAllowlist         []string          // CIDRs requests must come from; empty allows every address
+}
+
+// HasAccessRules reports whether the config restricts who can reach the app (IP allowlist or basic auth)
+func (cfg RoutingConfig) HasAccessRules() bool {
+	return len(cfg.IPAllowlist) > 0 || cfg.BasicAuthUser != ""
+}
+
+// DefaultRoutingConfig is how apps without routing settings are served
+func DefaultRoutingConfig() RoutingConfig {
+	return RoutingConfig{ForceHTTPS: true}
+}
+
+// ValidateRoutingConfig checks the body limit, response headers and IP allowlist of a routing config
+func ValidateRoutingConfig(cfg RoutingConfig) error {
+	if len(cfg.IPAllowlist) > maxIPAllowlist {
+		return fmt.Errorf("at most %d IP ranges can be allowed", maxIPAllowlist)
+	}
+	for _, cidr := range cfg.IPAllowlist {
+		if prefix, err := netip.ParsePrefix(cidr); err != nil || prefix != prefix.Masked() {
+			return fmt.Errorf("invalid IP range %q", cidr)
+		}
+	}
+	if cfg.MaxRequestBodyBytes != 0 && (cfg.MaxRequestBodyBytes < MinRequestBodyBytes || cfg.MaxRequestBodyBytes > MaxRequestBodyBytes) {
+		return fmt.Errorf("max_request_body_bytes must be 0 (no limit) or between %d and %d", MinRequestBodyBytes, MaxRequestBodyBytes)
+	}
+	if len(cfg.Headers) > maxRoutingHeaders {
+		return fmt.Errorf("at most %d custom headers can be set", maxRoutingHeaders)
+	}
+	for name, value := range cfg.Headers {
+		if !headerNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if reservedHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+			return fmt.Errorf("header %s cannot be set", name)
+		}
+		if len(value) > maxHeaderValueLen || strings.ContainsAny(value, "\r\n\x00") {
+			return fmt.Errorf("invalid value for header %s", name)
+		}
+	}
+	return nil
+}
+
+// NormalizeIPAllowlist turns addresses and CIDRs into the canonical CIDRs of their networks, without duplicates
+// (a bare address becomes a single-address range, "10.1.2.3/8" becomes "10.0.0.0/8")
+func NormalizeIPAllowlist(entries []string) ([]string, error) {
+	seen := make(map[string]bool, len(entries))
+	cidrs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		var prefix netip.Prefix
+		if strings.Contains(entry, "/") {
+			parsed, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP range %q", entry)
+			}
+			prefix = parsed.Masked()
+		} else {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP address %q", entry)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		if cidr := prefix.String(); !seen[cidr] {
+			seen[cidr] = true
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	return cidrs, nil
+}
+
+// HashBasicAuthUser returns the htpasswd entry Traefik's basicauth middleware checks credentials against
+func HashBasicAuthUser(username, password string) (string, error) {
+	if username == "" || strings.ContainsAny(username, ":,") || len(username) > 100 {
+		return "", fmt.Errorf("username must be 1-100 characters without ':' or ','")
+	}
+	if len(password) < 8 || len(password) > 72 {
+		return "", fmt.Errorf("password must be between 8 and 72 characters")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return username + ":" + string(hash), nil
+}
+
+// AppRoute is everything that decides how Traefik routes to an app's container
+type AppRoute struct {
+	AppID         string
+	Subdomain     string
+	Port          int
+	HealthPath    string
+	CustomDomains []string       // Verified custom domains the container also answers on
+	WAF           *WAFConfig     // nil when the app has no WAF
+	Routing       *RoutingConfig // nil for DefaultRoutingConfig
+}
+
+// RoutingService owns the Traefik configuration of apps, declared as labels on their containers
+type RoutingService struct {
+	networkName string // Docker network Traefik reaches app containers on
+}
+
+// NewRoutingService creates a routing service for containers on networkName
+func NewRoutingService(networkName string) *RoutingService {
+	return &RoutingService{networkName: networkName}
+}
+
+// Labels generates the Traefik labels of an app container: routers with HTTPS, the subdomain, verified
+// custom domains and health checks
+// Verified custom domains get their own router so certificates are issued per host by the ACME resolver
+// Traefik probes the same health path as Docker so both agree on when the container can take traffic
+// Every router serving the app (not the HTTPS redirects) passes requests through the app's middlewares
+// (IP allowlist, basic auth, WAF, body limit, compression, headers) first
+func (s *RoutingService) Labels(route AppRoute) map[string]string {
+	routing := DefaultRoutingConfig()
+	if route.Routing != nil {
+		routing = *route.Routing
+	}
+
+	appID := route.AppID
+	routerName := fmt.Sprintf("app-%s", appID)
+	serviceName := fmt.Sprintf("app-%s", appID)
+	redirectName := fmt.Sprintf("app-%s-redirect", appID)
+	middlewares := strings.Join(appMiddlewares(appID, route.WAF, routing), ",")
+
+	// Check if this is a .local domain (local development)
+	isLocalDomain := strings.HasSuffix(route.Subdomain, ".local") || strings.HasSuffix(route.Subdomain, ".localhost")
+
+	labels := map[string]string{
+		// Enable Traefik
+		"traefik.enable": "true",
+
+		// Service configuration
+		fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port", serviceName):          strconv.Itoa(route.Port),
+		fmt.Sprintf("traefik.http.services.%s.loadbalancer.healthcheck.path", serviceName):     route.HealthPath,
+		fmt.Sprintf("traefik.http.services.%s.loadbalancer.healthcheck.interval", serviceName): "10s",
+		fmt.Sprintf("traefik.http.services.%s.loadbalancer.healthcheck.timeout", serviceName):  "10s",  // Increased from 3s to allow app startup time
+		fmt.Sprintf("traefik.http.services.%s.loadbalancer.healthcheck.scheme", serviceName):   "http", // Use HTTP for health checks
+
+		// Use the configured network
+		"traefik.docker.network": s.networkName,
+
+		// App ID label for container lookup
+		"app.id":        appID,
+		"app.subdomain": route.Subdomain,
+	}
+
+	// httpRouter declares the plain HTTP router for rule: a redirect to HTTPS, or the app itself when HTTPS is not forced
+	httpRouter := func(name, rule string) {
+		labels[fmt.Sprintf("traefik.http.routers.%s.rule", name)] = rule
+		labels[fmt.Sprintf("traefik.http.routers.%s.entrypoints", name)] = "web"
+		if routing.ForceHTTPS {
+			labels[fmt.Sprintf("traefik.http.routers.%s.middlewares", name)] = redirectName
+		} else if middlewares != "" {
+			labels[fmt.Sprintf("traefik.http.routers.%s.middlewares", name)] = middlewares
+		}
+	}
+	// httpsRouter declares the HTTPS router for rule, with a Let's Encrypt certificate (issued and renewed by Traefik)
+	httpsRouter := func(name, rule string) {
+		labels[fmt.Sprintf("traefik.http.routers.%s.rule", name)] = rule
+		labels[fmt.Sprintf("traefik.http.routers.%s.entrypoints", name)] = "websecure"
+		labels[fmt.Sprintf("traefik.http.routers.%s.tls", name)] = "true"
+		labels[fmt.Sprintf("traefik.http.routers.%s.tls.certresolver", name)] = "letsencrypt"
+		if middlewares != "" {
+			labels[fmt.Sprintf("traefik.http.routers.%s.middlewares", name)] = middlewares
+		}
+	}
+
+	subdomainRule := fmt.Sprintf("Host(`%s`)", route.Subdomain)
+	if isLocalDomain {
+		// For .local domains, use HTTP only (no HTTPS/TLS)
+		labels[fmt.Sprintf("traefik.http.routers.%s.rule", routerName)] = subdomainRule
+		labels[fmt.Sprintf("traefik.http.routers.%s.entrypoints", routerName)] = "web"
+		if middlewares != "" {
+			labels[fmt.Sprintf("traefik.http.routers.%s.middlewares", routerName)] = middlewares
+		}
+	} else {
+		httpRouter(routerName+"-http", subdomainRule)
+		httpsRouter(routerName, subdomainRule)
+	}
+
+	// Custom domains always get HTTPS - the HTTP router also serves ACME HTTP-01 challenges via Traefik
+	if len(route.CustomDomains) > 0 {
+		customRouterName := fmt.Sprintf("%s-custom", routerName)
+		hostRules := make([]string, 0, len(route.CustomDomains))
+		for _, domain := range route.CustomDomains {
+			hostRules = append(hostRules, fmt.Sprintf("Host(`%s`)", domain))
+		}
+		customRule := strings.Join(hostRules, " || ")
+
+		httpRouter(customRouterName+"-http", customRule)
+		httpsRouter(customRouterName, customRule)
+		// Custom domain routers name the app's service explicitly
+		labels[fmt.Sprintf("traefik.http.routers.%s-http.service", customRouterName)] = serviceName
+		labels[fmt.Sprintf("traefik.http.routers.%s.service", customRouterName)] = serviceName
+
+		labels["app.custom_domains"] = strings.Join(route.CustomDomains, ",")
+	}
+
+	// Redirect middleware (HTTP to HTTPS) for the HTTP routers above; .local apps without custom domains have none
+	if routing.ForceHTTPS && (!isLocalDomain || len(route.CustomDomains) > 0) {
+		labels[fmt.Sprintf("traefik.http.middlewares.%s.redirectscheme.scheme", redirectName)] = "https"
+		labels[fmt.Sprintf("traefik.http.middlewares.%s.redirectscheme.permanent", redirectName)] = "true"
+	}
+
+	if route.WAF != nil {
+		for key, value := range wafLabels(appID, *route.WAF) {
+			labels[key] = value
+		}
+	}
+	for key, value := range routingMiddlewareLabels(appID, routing) {
+		labels[key] = value
+	}
+
+	return labels
+}
+
+// routingMiddlewareName is the name of one of an app's routing middlewares
+func routingMiddlewareName(appID, kind string) string {
+	return fmt.Sprintf("app-%s-%s", appID, kind)
+}
+
+// appMiddlewares lists the middlewares of the routers serving an app, in the order requests pass them:
+// requests from outside the allowlist and unauthenticated ones are rejected before the WAF inspects them,
+// and responses are compressed before the custom headers are added
+func appMiddlewares(appID string, waf *WAFConfig, routing RoutingConfig) []string {
+	var names []string
+	if len(routing.IPAllowlist) > 0 {
+		names = append(names, routingMiddlewareName(appID, "ipallowlist"))
+	}
+	if routing.BasicAuthUser != "" {
+		names = append(names, routingMiddlewareName(appID, "auth"))
+	}
+	if waf != nil {
+		names = append(names, WAFMiddlewareName(appID))
+	}
+	if routing.MaxRequestBodyBytes > 0 {
+		names = append(names, routingMiddlewareName(appID, "buffering"))
+	}
+	if routing.Compression {
+		names = append(names, routingMiddlewareName(appID, "compress"))
+	}
+	if len(routing.Headers) > 0 {
+		names = append(names, routingMiddlewareName(appID, "headers"))
+	}
+	return names
+}
+
+// routingMiddlewareLabels declares the middlewares appMiddlewares lists, except the WAF (see wafLabels)
+func routingMiddlewareLabels(appID string, routing RoutingConfig) map[string]string {
+	labels := make(map[string]string)
+	if len(routing.IPAllowlist) > 0 {
+		name := routingMiddlewareName(appID, "ipallowlist")
+		labels[fmt.Sprintf("traefik.http.middlewares.%s.ipallowlist.sourcerange", name)] = strings.Join(routing.IPAllowlist, ",")
+	}
+	if routing.BasicAuthUser != "" {
+		name := routingMiddlewareName(appID, "auth")
+		labels[fmt.Sprintf("traefik.http.middlewares.%s.basicauth.users", name)] = routing.BasicAuthUser
+		labels[fmt.Sprintf("traefik.http.middlewares.%s.basicauth.removeheader", name)] = "true" // Apps never see the shared credentials
+	}
+	if routing.MaxRequestBodyBytes > 0 {
+		name := routingMiddlewareName(appID, "buffering")
+		labels[fmt.Sprintf("traefik.http.middlewares.%s.buffering.maxRequestBodyBytes", name)] = strconv.FormatInt(routing.MaxRequestBodyBytes, 10)
+	}
+	if routing.Compression {
+		name := routingMiddlewareName(appID, "compress")
+		labels[fmt.Sprintf("traefik.http.middlewares.%s.compress.encodings", name)] = "br,gzip"
+	}
+	if len(routing.Headers) > 0 {
+		name := routingMiddlewareName(appID, "headers")
+		headerNames := make([]string, 0, len(routing.Headers))
+		for header := range routing.Headers {
+			headerNames = append(headerNames, header)
+		}
+		sort.Strings(headerNames)
+		for _, header := range headerNames {
+			labels[fmt.Sprintf("traefik.http.middlewares.%s.headers.customResponseHeaders.%s", name, header)] = routing.Headers[header]
+		}
+	}
+	return labels
+}
@@ -19,6 +19,10 @@ const (
 	RuntimeRuby     Runtime = "ruby"
 	RuntimeJava     Runtime = "java"
 	RuntimePHP      Runtime = "php"
+	RuntimeRust     Runtime = "rust"
+	RuntimeElixir   Runtime = "elixir"
+	RuntimeDeno     Runtime = "deno"
+	RuntimeBun      Runtime = "bun"
 	RuntimeStatic   Runtime = "static"
 	RuntimeUnknown  Runtime = "unknown"
 )
@@ -37,12 +41,54 @@ func NewRuntimeDetector(logger *zap.Logger) *RuntimeDetector {
 
 // DetectRuntime detects the runtime by examining files in the repository
 func (d *RuntimeDetector) DetectRuntime(repoPath string) (Runtime, error) {
+	// Rack/Rails and PHP framework apps often ship a package.json for frontend assets -
+	// their own manifest decides the runtime when the app entrypoint is there too
+	if d.fileExists(repoPath, "Gemfile") && d.fileExists(repoPath, "config.ru") {
+		d.logger.Info("Detected Ruby runtime (Rack app)", zap.String("path", repoPath))
+		return RuntimeRuby, nil
+	}
+	if d.fileExists(repoPath, "composer.json") &&
+		(d.fileExists(repoPath, "artisan") || d.fileExists(repoPath, "index.php") || d.fileExists(repoPath, "public/index.php")) {
+		d.logger.Info("Detected PHP runtime", zap.String("path", repoPath))
+		return RuntimePHP, nil
+	}
+
+	// Frontends that build to static files (Vite, CRA, Astro) are served by nginx, not run with Node
+	if site, ok := DetectStaticSite(repoPath); ok {
+		d.logger.Info("Detected static site",
+			zap.String("path", repoPath),
+			zap.String("framework", site.Framework),
+			zap.String("output_dir", site.OutputDir),
+		)
+		return RuntimeStatic, nil
+	}
+
+	// Deno and Bun projects often carry a package.json too - their own config or lockfile decides
+	if d.fileExists(repoPath, "deno.json") || d.fileExists(repoPath, "deno.jsonc") {
+		d.logger.Info("Detected Deno runtime", zap.String("path", repoPath))
+		return RuntimeDeno, nil
+	}
+	if d.fileExists(repoPath, "bun.lockb") || d.fileExists(repoPath, "bun.lock") {
+		d.logger.Info("Detected Bun runtime", zap.String("path", repoPath))
+		return RuntimeBun, nil
+	}
+
 	// Check for package.json (Node.js)
 	if d.fileExists(repoPath, "package.json") {
 		d.logger.Info("Detected Node.js runtime", zap.String("path", repoPath))
 		return RuntimeNodeJS, nil
 	}
 
+	// Cargo and Mix manifests before the Python check, which also matches stray helper scripts
+	if d.fileExists(repoPath, "Cargo.toml") {
+		d.logger.Info("Detected Rust runtime", zap.String("path", repoPath))
+		return RuntimeRust, nil
+	}
+	if d.fileExists(repoPath, "mix.exs") {
+		d.logger.Info("Detected Elixir runtime", zap.String("path", repoPath))
+		return RuntimeElixir, nil
+	}
+
 	// Check for Python files (requirements.txt, setup.py, Pipfile, pyproject.toml, or .py files)
 	if d.fileExists(repoPath, "requirements.txt") || 
 		d.fileExists(repoPath, "setup.py") || 
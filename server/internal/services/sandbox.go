@@ -0,0 +1,418 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"stackyn/server/internal/deploystate"
+)
+
+// Sandbox lifecycle timings, measured from when a deployment is requested
+// pending -> building -> deploying -> running (or failed), mirroring the real build/deploy workers
+const (
+	sandboxPendingFor   = 2 * time.Second
+	sandboxBuildingFor  = 8 * time.Second
+	sandboxDeployingFor = 5 * time.Second
+)
+
+// Sandbox resource bounds - state lives in API server memory only
+const (
+	sandboxMaxAppsPerUser     = 10
+	sandboxMaxDeploymentsKept = 20
+	sandboxIdleTTL            = 24 * time.Hour
+)
+
+// Branches that make sandbox deployments fail, so clients can exercise their error handling
+const (
+	SandboxFailBuildBranch  = "sandbox-fail-build"
+	SandboxFailDeployBranch = "sandbox-fail-deploy"
+)
+
+// Sandbox errors
+var (
+	ErrSandboxNotFound     = errors.New("sandbox resource not found")
+	ErrSandboxSlugTaken    = errors.New("an app with this slug already exists")
+	ErrSandboxAppLimit     = fmt.Errorf("sandbox is limited to %d apps", sandboxMaxAppsPerUser)
+	ErrSandboxDeployActive = errors.New("a deployment is already in progress")
+)
+
+// SandboxApp is a simulated app as seen at a point in time
+type SandboxApp struct {
+	ID        string
+	Name      string
+	Slug      string
+	Status    string
+	URL       string // Set once a deployment has gone live
+	RepoURL   string
+	Branch    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Latest    *SandboxDeployment // Most recent deployment
+	Active    *SandboxDeployment // Deployment currently serving traffic, if any
+}
+
+// SandboxDeployment is a simulated deployment as seen at a point in time
+type SandboxDeployment struct {
+	ID           string
+	AppID        string
+	BuildJobID   string
+	Status       string // pending | building | deploying | running | failed | stopped
+	ImageName    string // Set once the simulated build finished
+	ErrorMessage string
+	BuildLog     string // Log lines emitted so far
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type sandboxApp struct {
+	id, name, slug, repoURL, branch string
+	createdAt                       time.Time
+	deployments                     []*sandboxDeployment // Oldest first
+}
+
+type sandboxDeployment struct {
+	id, buildJobID, branch string
+	requestedAt            time.Time
+}
+
+type sandboxUser struct {
+	apps     map[string]*sandboxApp
+	lastSeen time.Time
+}
+
+// SandboxService simulates apps, builds and deployments for sandbox API tokens
+// Nothing is cloned, built or run: lifecycle states are derived from elapsed time, so
+// clients polling the API see the same transitions a real deploy goes through
+type SandboxService struct {
+	logger     *zap.Logger
+	baseDomain string
+	now        func() time.Time
+
+	mu        sync.Mutex
+	users     map[string]*sandboxUser
+	lastPrune time.Time
+}
+
+// NewSandboxService creates a new sandbox simulator
+// baseDomain is used for the (non-routable) URLs of simulated apps
+func NewSandboxService(logger *zap.Logger, baseDomain string) *SandboxService {
+	return &SandboxService{
+		logger:     logger,
+		baseDomain: baseDomain,
+		now:        time.Now,
+		users:      make(map[string]*sandboxUser),
+	}
+}
+
+// CreateApp creates a simulated app and starts its first deployment
+func (s *SandboxService) CreateApp(userID, name, slug, repoURL, branch string) (*SandboxApp, *SandboxDeployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	user := s.user(userID, now)
+	if len(user.apps) >= sandboxMaxAppsPerUser {
+		return nil, nil, ErrSandboxAppLimit
+	}
+	for _, app := range user.apps {
+		if app.slug == slug {
+			return nil, nil, ErrSandboxSlugTaken
+		}
+	}
+
+	app := &sandboxApp{
+		id:        uuid.New().String(),
+		name:      name,
+		slug:      slug,
+		repoURL:   repoURL,
+		branch:    branch,
+		createdAt: now,
+	}
+	deployment := app.startDeployment(now)
+	user.apps[app.id] = app
+
+	s.logger.Debug("Sandbox app created", zap.String("user_id", userID), zap.String("app_id", app.id))
+	return s.appView(app, now), s.status(app, deployment, now), nil
+}
+
+// ListApps lists the user's simulated apps, newest first
+func (s *SandboxService) ListApps(userID string) []*SandboxApp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	user := s.user(userID, now)
+	apps := make([]*SandboxApp, 0, len(user.apps))
+	for _, app := range user.apps {
+		apps = append(apps, s.appView(app, now))
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].CreatedAt.After(apps[j].CreatedAt) })
+	return apps
+}
+
+// GetApp returns one simulated app
+func (s *SandboxService) GetApp(userID, appID string) (*SandboxApp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	app, ok := s.user(userID, now).apps[appID]
+	if !ok {
+		return nil, ErrSandboxNotFound
+	}
+	return s.appView(app, now), nil
+}
+
+// DeleteApp removes a simulated app and its deployments
+func (s *SandboxService) DeleteApp(userID, appID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.user(userID, s.now())
+	if _, ok := user.apps[appID]; !ok {
+		return ErrSandboxNotFound
+	}
+	delete(user.apps, appID)
+	return nil
+}
+
+// Redeploy starts a new simulated deployment of the app's branch
+// Like the real API, only one deployment per app can be in progress
+func (s *SandboxService) Redeploy(userID, appID string) (*SandboxApp, *SandboxDeployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	app, ok := s.user(userID, now).apps[appID]
+	if !ok {
+		return nil, nil, ErrSandboxNotFound
+	}
+	if latest := app.latest(); latest != nil && !isTerminalSandboxStatus(s.status(app, latest, now).Status) {
+		return nil, nil, ErrSandboxDeployActive
+	}
+	deployment := app.startDeployment(now)
+	return s.appView(app, now), s.status(app, deployment, now), nil
+}
+
+// ListDeployments lists an app's simulated deployments, newest first
+func (s *SandboxService) ListDeployments(userID, appID string) ([]*SandboxDeployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	app, ok := s.user(userID, now).apps[appID]
+	if !ok {
+		return nil, ErrSandboxNotFound
+	}
+	deployments := make([]*SandboxDeployment, 0, len(app.deployments))
+	for i := len(app.deployments) - 1; i >= 0; i-- {
+		deployments = append(deployments, s.status(app, app.deployments[i], now))
+	}
+	return deployments, nil
+}
+
+// GetDeployment returns one simulated deployment of any of the user's apps
+func (s *SandboxService) GetDeployment(userID, deploymentID string) (*SandboxDeployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for _, app := range s.user(userID, now).apps {
+		for _, d := range app.deployments {
+			if d.id == deploymentID {
+				return s.status(app, d, now), nil
+			}
+		}
+	}
+	return nil, ErrSandboxNotFound
+}
+
+// user returns the user's sandbox, creating it on first use and pruning idle sandboxes
+// Caller must hold s.mu
+func (s *SandboxService) user(userID string, now time.Time) *sandboxUser {
+	if now.Sub(s.lastPrune) > time.Hour {
+		for id, u := range s.users {
+			if now.Sub(u.lastSeen) > sandboxIdleTTL {
+				delete(s.users, id)
+			}
+		}
+		s.lastPrune = now
+	}
+
+	user, ok := s.users[userID]
+	if !ok {
+		user = &sandboxUser{apps: make(map[string]*sandboxApp)}
+		s.users[userID] = user
+	}
+	user.lastSeen = now
+	return user
+}
+
+func (a *sandboxApp) startDeployment(now time.Time) *sandboxDeployment {
+	d := &sandboxDeployment{
+		id:          uuid.New().String(),
+		buildJobID:  uuid.New().String(),
+		branch:      a.branch,
+		requestedAt: now,
+	}
+	a.deployments = append(a.deployments, d)
+	if len(a.deployments) > sandboxMaxDeploymentsKept {
+		a.deployments = a.deployments[len(a.deployments)-sandboxMaxDeploymentsKept:]
+	}
+	return d
+}
+
+func (a *sandboxApp) latest() *sandboxDeployment {
+	if len(a.deployments) == 0 {
+		return nil
+	}
+	return a.deployments[len(a.deployments)-1]
+}
+
+// liveAt returns when a deployment goes live, or false if it is simulated to fail
+func (d *sandboxDeployment) liveAt() (time.Time, bool) {
+	if d.branch == SandboxFailBuildBranch || d.branch == SandboxFailDeployBranch {
+		return time.Time{}, false
+	}
+	return d.requestedAt.Add(sandboxPendingFor + sandboxBuildingFor + sandboxDeployingFor), true
+}
+
+// status derives a deployment's state at now
+// A running deployment is stopped once a newer one goes live, as the deploy worker does
+func (s *SandboxService) status(app *sandboxApp, d *sandboxDeployment, now time.Time) *SandboxDeployment {
+	view := &SandboxDeployment{
+		ID:         d.id,
+		AppID:      app.id,
+		BuildJobID: d.buildJobID,
+		CreatedAt:  d.requestedAt,
+	}
+	elapsed := now.Sub(d.requestedAt)
+	buildStart := sandboxPendingFor
+	deployStart := buildStart + sandboxBuildingFor
+	liveAt := deployStart + sandboxDeployingFor
+
+	switch {
+	case elapsed < buildStart:
+		view.Status, view.UpdatedAt = string(deploystate.Pending), d.requestedAt
+	case elapsed < deployStart:
+		view.Status, view.UpdatedAt = string(deploystate.Building), d.requestedAt.Add(buildStart)
+	case d.branch == SandboxFailBuildBranch:
+		view.Status, view.UpdatedAt = string(deploystate.Failed), d.requestedAt.Add(deployStart)
+		view.ErrorMessage = fmt.Sprintf("Build failed: simulated build failure (branch %q)", d.branch)
+	case elapsed < liveAt:
+		view.Status, view.UpdatedAt = string(deploystate.Deploying), d.requestedAt.Add(deployStart)
+	case d.branch == SandboxFailDeployBranch:
+		view.Status, view.UpdatedAt = string(deploystate.Failed), d.requestedAt.Add(liveAt)
+		view.ErrorMessage = fmt.Sprintf("Deployment failed: simulated health check failure (branch %q)", d.branch)
+	default:
+		view.Status, view.UpdatedAt = string(deploystate.Running), d.requestedAt.Add(liveAt)
+		if stoppedAt, ok := app.supersededAt(d, now); ok {
+			view.Status, view.UpdatedAt = string(deploystate.Stopped), stoppedAt
+		}
+	}
+
+	if elapsed >= deployStart && d.branch != SandboxFailBuildBranch {
+		view.ImageName = fmt.Sprintf("stackyn-sandbox/%s:%s", app.slug, d.buildJobID)
+	}
+	view.BuildLog = sandboxBuildLog(app, d, view, elapsed)
+	return view
+}
+
+// supersededAt returns when a later deployment of the app went live, if one has by now
+func (a *sandboxApp) supersededAt(d *sandboxDeployment, now time.Time) (time.Time, bool) {
+	found := false
+	for _, other := range a.deployments {
+		if other == d {
+			found = true
+			continue
+		}
+		if !found {
+			continue
+		}
+		if live, ok := other.liveAt(); ok && !live.After(now) {
+			return live, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (s *SandboxService) appView(app *sandboxApp, now time.Time) *SandboxApp {
+	view := &SandboxApp{
+		ID:        app.id,
+		Name:      app.name,
+		Slug:      app.slug,
+		Status:    "pending",
+		RepoURL:   app.repoURL,
+		Branch:    app.branch,
+		CreatedAt: app.createdAt,
+		UpdatedAt: app.createdAt,
+	}
+	for i := len(app.deployments) - 1; i >= 0; i-- {
+		d := s.status(app, app.deployments[i], now)
+		if view.Latest == nil {
+			view.Latest = d
+			view.Status = d.Status
+			view.UpdatedAt = d.UpdatedAt
+		}
+		if d.Status == "running" {
+			view.Active = d
+			view.URL = fmt.Sprintf("https://%s.sandbox.%s", app.slug, s.baseDomain)
+			break
+		}
+	}
+	return view
+}
+
+// sandboxBuildLog returns the simulated log lines emitted by elapsed
+func sandboxBuildLog(app *sandboxApp, d *sandboxDeployment, view *SandboxDeployment, elapsed time.Duration) string {
+	type line struct {
+		at   time.Duration
+		text string
+	}
+	buildStart := sandboxPendingFor
+	deployStart := buildStart + sandboxBuildingFor
+	liveAt := deployStart + sandboxDeployingFor
+
+	lines := []line{
+		{0, "[sandbox] Build queued - no code is cloned, built or run in sandbox mode"},
+		{buildStart, fmt.Sprintf("Cloning %s (branch %s)", app.repoURL, d.branch)},
+		{buildStart + time.Second, "Detecting runtime and generating Dockerfile"},
+		{buildStart + 2*time.Second, "Building image"},
+	}
+	if d.branch == SandboxFailBuildBranch {
+		lines = append(lines, line{deployStart, view.ErrorMessage})
+	} else {
+		lines = append(lines,
+			line{deployStart, "Successfully built image " + fmt.Sprintf("stackyn-sandbox/%s:%s", app.slug, d.buildJobID)},
+			line{deployStart + time.Second, "Starting container"},
+			line{deployStart + 2*time.Second, "Waiting for health check"},
+		)
+		if d.branch == SandboxFailDeployBranch {
+			lines = append(lines, line{liveAt, view.ErrorMessage})
+		} else {
+			lines = append(lines, line{liveAt, "Deployment is live"})
+		}
+	}
+
+	var b strings.Builder
+	for _, l := range lines {
+		if l.at > elapsed {
+			break
+		}
+		b.WriteString(d.requestedAt.Add(l.at).UTC().Format(time.RFC3339))
+		b.WriteString(" ")
+		b.WriteString(l.text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func isTerminalSandboxStatus(status string) bool {
+	return status == string(deploystate.Running) || status == string(deploystate.Failed) || status == string(deploystate.Stopped)
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Secret scan modes an app can choose between (apps.secret_scan)
+const (
+	SecretScanOff   = "off"
+	SecretScanWarn  = "warn"  // Findings are written to the build log and the build goes on (default)
+	SecretScanBlock = "block" // Findings fail the build before the image is built
+)
+
+// ValidSecretScanMode reports whether mode is one apps can choose
+func ValidSecretScanMode(mode string) bool {
+	switch mode {
+	case SecretScanOff, SecretScanWarn, SecretScanBlock:
+		return true
+	}
+	return false
+}
+
+// ErrSecretsDetected is wrapped by the error of builds failed for credentials committed to their repository
+var ErrSecretsDetected = errors.New("secrets detected in repository")
+
+// secretScanAllowMarker on a line (usually in a comment) keeps what the line holds out of the findings,
+// for test fixtures and example values the rules mistake for credentials
+const secretScanAllowMarker = "stackyn:allow-secret"
+
+// Limits of a scan - big files are generated or binary, and a repo with this many findings has made its point
+const (
+	maxSecretScanFileSize = 1 << 20
+	maxSecretFindings     = 100
+)
+
+// secretScanSkipDirs are not part of the app's own source (or are not shipped from the checkout)
+var secretScanSkipDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+	".venv":        true,
+	"__pycache__":  true,
+}
+
+// secretRule matches one kind of credential; group 1, when the pattern has one, is the credential itself
+type secretRule struct {
+	name       string
+	pattern    *regexp.Regexp
+	minEntropy float64 // Shannon entropy (bits per character) the credential needs; 0 accepts any match
+}
+
+// secretRules are the credentials scans look for, specific ones first so a line is reported under the
+// most precise rule that matches it
+var secretRules = []secretRule{
+	{name: "private-key", pattern: regexp.MustCompile(`-----BEGIN (?:(?:RSA|DSA|EC|OPENSSH|PGP|ENCRYPTED) )?PRIVATE KEY(?: BLOCK)?-----`)},
+	{name: "aws-access-key-id", pattern: regexp.MustCompile(`\b((?:AKIA|ASIA)[0-9A-Z]{16})\b`)},
+	{name: "aws-secret-access-key", pattern: regexp.MustCompile(`(?i)aws_?secret_?access_?key\W{0,4}[:=]\W{0,3}([A-Za-z0-9/+]{40})\b`), minEntropy: 3.5},
+	{name: "github-token", pattern: regexp.MustCompile(`\b((?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{82})\b`)},
+	{name: "slack-token", pattern: regexp.MustCompile(`\b(xox[abprs]-[0-9A-Za-z-]{10,})\b`)},
+	{name: "stripe-secret-key", pattern: regexp.MustCompile(`\b((?:sk|rk)_live_[0-9A-Za-z]{24,})\b`)},
+	{name: "generic-secret", pattern: regexp.MustCompile(`(?i)(?:secret|token|passw(?:or)?d|api_?key|access_?key|private_?key|client_?secret)[A-Za-z0-9_-]*["']?\s*[:=]\s*["']([A-Za-z0-9/+_=.\-]{20,})["']`), minEntropy: 4.0},
+}
+
+// SecretFinding is a credential found in a repository. The credential itself is never kept - only a
+// redacted prefix - so findings are safe to put in build logs
+type SecretFinding struct {
+	Rule     string `json:"rule"` // e.g. aws-access-key-id
+	File     string `json:"file"` // Relative to the scanned directory
+	Line     int    `json:"line"`
+	Redacted string `json:"redacted"` // e.g. AKIA****************
+}
+
+// SecretScanner looks for credentials committed to a cloned repository before it is built, so they do
+// not end up in images and build logs
+type SecretScanner struct{}
+
+// NewSecretScanner creates a secret scanner
+func NewSecretScanner() *SecretScanner {
+	return &SecretScanner{}
+}
+
+// ScanDirectory scans the text files under root and returns what looks like credentials, up to
+// maxSecretFindings. Dependency directories, binary files and files over 1MB are skipped
+func (s *SecretScanner) ScanDirectory(ctx context.Context, root string) ([]SecretFinding, error) {
+	var findings []SecretFinding
+	errEnough := errors.New("enough findings")
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Unreadable entries can't be built either
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if d.IsDir() {
+			if path != root && secretScanSkipDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() > maxSecretScanFileSize {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			rel = path
+		}
+		for _, finding := range scanFileForSecrets(path) {
+			finding.File = filepath.ToSlash(rel)
+			findings = append(findings, finding)
+			if len(findings) >= maxSecretFindings {
+				return errEnough
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errEnough) {
+		return findings, err
+	}
+	return findings, nil
+}
+
+// scanFileForSecrets returns the findings of one file, one per line at most; binary files have none
+func scanFileForSecrets(path string) []SecretFinding {
+	content, err := os.ReadFile(path)
+	if err != nil || bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0 {
+		return nil
+	}
+
+	var findings []SecretFinding
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), maxSecretScanFileSize)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if strings.Contains(line, secretScanAllowMarker) {
+			continue
+		}
+		for _, rule := range secretRules {
+			if secret, ok := rule.match(line); ok {
+				findings = append(findings, SecretFinding{Rule: rule.name, Line: lineNumber, Redacted: redactSecret(secret)})
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// match returns the credential rule finds in line
+func (r secretRule) match(line string) (string, bool) {
+	for _, m := range r.pattern.FindAllStringSubmatch(line, -1) {
+		secret := m[0]
+		if len(m) > 1 && m[1] != "" {
+			secret = m[1]
+		}
+		if looksLikePlaceholder(secret) || (r.minEntropy > 0 && shannonEntropy(secret) < r.minEntropy) {
+			continue
+		}
+		return secret, true
+	}
+	return "", false
+}
+
+// shannonEntropy is the entropy of s in bits per character - random tokens score well above words
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	var entropy float64
+	n := float64(len([]rune(s)))
+	for _, count := range counts {
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// looksLikePlaceholder recognizes the example values of .env templates and docs
+func looksLikePlaceholder(s string) bool {
+	lower := strings.ToLower(s)
+	for _, word := range []string{"example", "placeholder", "changeme", "your_", "your-", "xxxx", "dummy", "sample"} {
+		if strings.Contains(lower, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactSecret keeps enough of a credential to recognize it (its first 4 characters) and masks the rest
+func redactSecret(secret string) string {
+	if strings.HasPrefix(secret, "-----BEGIN") {
+		return secret // The header names the kind of key and holds nothing of it
+	}
+	runes := []rune(secret)
+	if len(runes) <= 4 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:4]) + strings.Repeat("*", min(len(runes)-4, 16))
+}
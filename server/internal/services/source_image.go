@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/registry"
+	"go.uber.org/zap"
+)
+
+// App sources
+const (
+	AppSourceGit   = "git"   // Built from a Git repository
+	AppSourceImage = "image" // Runs an existing image from a container registry, without a build
+)
+
+// RegistryAuth is a login for the private registry an image app pulls from
+type RegistryAuth struct {
+	Username string
+	Password string
+}
+
+// ParseSourceImage validates an image reference supplied by a user and returns it fully qualified
+// ("nginx" becomes "docker.io/library/nginx:latest"). References may pin a digest themselves
+func ParseSourceImage(ref string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(strings.TrimSpace(ref))
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %q: %w", ref, err)
+	}
+	return reference.TagNameOnly(named).String(), nil
+}
+
+// SourceImageRegistry returns the registry host of a reference returned by ParseSourceImage
+func SourceImageRegistry(ref string) string {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return ""
+	}
+	return reference.Domain(named)
+}
+
+// SourceImageDigest returns the digest the registry currently serves for ref. For multi-platform
+// images this is the digest of the image index
+func (s *DeploymentService) SourceImageDigest(ctx context.Context, ref string, auth *RegistryAuth) (string, error) {
+	encodedAuth, err := encodeRegistryAuth(ref, auth)
+	if err != nil {
+		return "", err
+	}
+	inspect, err := s.client.DistributionInspect(ctx, ref, encodedAuth)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up %s in its registry: %w", ref, err)
+	}
+	return inspect.Descriptor.Digest.String(), nil
+}
+
+// PullSourceImage pulls an image app's image pinned by digest and tags it localName:localTag, the name
+// the deployment runs (and later restarts and rollbacks reuse). The digest is resolved once and pulled by
+// digest, so a tag moved during the pull cannot change what is deployed. Returns the digest
+func (s *DeploymentService) PullSourceImage(ctx context.Context, ref string, auth *RegistryAuth, localName, localTag string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %q: %w", ref, err)
+	}
+
+	var digest string
+	if canonical, ok := named.(reference.Canonical); ok {
+		digest = canonical.Digest().String()
+	} else if digest, err = s.SourceImageDigest(ctx, ref, auth); err != nil {
+		return "", err
+	}
+	pinned := reference.TrimNamed(named).String() + "@" + digest
+
+	encodedAuth, err := encodeRegistryAuth(ref, auth)
+	if err != nil {
+		return "", err
+	}
+	s.logger.Info("Pulling source image", zap.String("image", ref), zap.String("digest", digest))
+	reader, err := s.client.ImagePull(ctx, pinned, image.PullOptions{RegistryAuth: encodedAuth})
+	if err != nil {
+		return "", fmt.Errorf("failed to pull %s: %w", ref, err)
+	}
+	defer reader.Close()
+	if err := drainPullStream(reader); err != nil {
+		return "", fmt.Errorf("failed to pull %s: %w", ref, err)
+	}
+
+	if err := s.client.ImageTag(ctx, pinned, localName+":"+localTag); err != nil {
+		return "", fmt.Errorf("failed to tag %s: %w", ref, err)
+	}
+	return digest, nil
+}
+
+// encodeRegistryAuth encodes a login for the registry of ref; no login pulls anonymously
+func encodeRegistryAuth(ref string, auth *RegistryAuth) (string, error) {
+	if auth == nil || auth.Username == "" {
+		return "", nil
+	}
+	encoded, err := registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      auth.Username,
+		Password:      auth.Password,
+		ServerAddress: SourceImageRegistry(ref),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode registry credentials: %w", err)
+	}
+	return encoded, nil
+}
+
+// pullMessage is the part of a line of Docker's pull progress stream that reports failures
+type pullMessage struct {
+	Error string `json:"error"`
+}
+
+// drainPullStream reads a pull progress stream to the end - the pull only completes once it is read -
+// and returns the error the daemon reported in it, if any
+func drainPullStream(reader io.Reader) error {
+	decoder := json.NewDecoder(reader)
+	for {
+		var msg pullMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if msg.Error != "" {
+			return errors.New(msg.Error)
+		}
+	}
+}
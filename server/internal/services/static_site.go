@@ -0,0 +1,195 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StaticSiteLabel marks images that serve a static site with nginx rather than run an app server
+// Deploys of such images have no worker processes and probe StaticSiteHealthPath
+const StaticSiteLabel = "stackyn.static-site"
+
+// StaticSiteHealthPath is answered by the nginx of static site images, so health checks pass whatever
+// pages the site has
+const StaticSiteHealthPath = "/.stackyn/health"
+
+// StaticSite describes how a static site is built and served
+type StaticSite struct {
+	Framework string // vite, create-react-app or astro; empty for plain HTML served as-is
+	OutputDir string // Directory the build writes the site to (relative to the repo)
+	SPA       bool   // Unknown paths serve index.html, for client-side routers
+}
+
+// staticFrameworks are the frontend build tools whose `npm run build` output is a static site
+// keyed by the package that identifies them
+var staticFrameworks = []struct {
+	pkg, name, outputDir string
+	spa                  bool
+}{
+	{"astro", "astro", "dist", false},
+	{"react-scripts", "create-react-app", "build", true},
+	{"vite", "vite", "dist", true},
+}
+
+// serverPackages turn a frontend project into an app server (SSR or an API next to the assets)
+var serverPackages = []string{
+	"next", "nuxt", "@sveltejs/kit", "@remix-run/serve", "@remix-run/node", "@astrojs/node",
+	"express", "fastify", "koa", "hono", "@nestjs/core",
+}
+
+type packageJSON struct {
+	Main            string            `json:"main"`
+	Module          string            `json:"module"`
+	Scripts         map[string]string `json:"scripts"`
+	Dependencies    map[string]string `json:"dependencies"`
+	DevDependencies map[string]string `json:"devDependencies"`
+}
+
+// DetectStaticSite reports whether the Node.js project in repoPath is a frontend that builds to static
+// files (Vite, Create React App, Astro) or plain HTML that only uses package.json for tooling
+// Projects with a server framework or a start script running their own server are apps, not sites
+func DetectStaticSite(repoPath string) (StaticSite, bool) {
+	data, err := os.ReadFile(filepath.Join(repoPath, "package.json"))
+	if err != nil {
+		return StaticSite{}, false
+	}
+	var pkg packageJSON
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return StaticSite{}, false
+	}
+	hasPackage := func(name string) bool {
+		_, dep := pkg.Dependencies[name]
+		_, devDep := pkg.DevDependencies[name]
+		return dep || devDep
+	}
+
+	for _, name := range serverPackages {
+		if hasPackage(name) {
+			return StaticSite{}, false
+		}
+	}
+
+	start := pkg.Scripts["start"]
+	if pkg.Scripts["build"] != "" {
+		for _, fw := range staticFrameworks {
+			if !hasPackage(fw.pkg) {
+				continue
+			}
+			// The framework's dev/preview server is not a reason to run the project as an app
+			if start != "" && !strings.Contains(start, fw.pkg) && !strings.Contains(start, fw.name) {
+				return StaticSite{}, false
+			}
+			return StaticSite{Framework: fw.name, OutputDir: fw.outputDir, SPA: fw.spa}, true
+		}
+		return StaticSite{}, false
+	}
+
+	// Nothing to build or run: package.json only carries tooling for hand-written pages
+	if start == "" && pkg.Main == "" && fileExistsIn(repoPath, "index.html") {
+		return StaticSite{OutputDir: "."}, true
+	}
+	return StaticSite{}, false
+}
+
+// generateStaticDockerfile builds a static site's assets with Node (when it has a build step) and serves
+// them with nginx on $PORT
+func (g *DockerfileGenerator) generateStaticDockerfile(repoPath string) string {
+	site, ok := DetectStaticSite(repoPath)
+	if !ok {
+		// Hand-written pages without a package.json
+		site = StaticSite{OutputDir: "."}
+	}
+
+	fallback := "=404"
+	if site.SPA {
+		fallback = "/index.html"
+	}
+
+	var build, source string
+	if site.Framework == "" {
+		source = "COPY . /usr/share/nginx/html\nRUN rm -f /usr/share/nginx/html/Dockerfile"
+	} else {
+		install, run := "npm install", "npm run build"
+		switch {
+		case fileExistsIn(repoPath, "pnpm-lock.yaml"):
+			install, run = "corepack enable && pnpm install --frozen-lockfile", "pnpm run build"
+		case fileExistsIn(repoPath, "yarn.lock"):
+			install, run = "yarn install --frozen-lockfile", "yarn build"
+		case fileExistsIn(repoPath, "package-lock.json"):
+			install = "npm ci"
+		}
+		build = strings.NewReplacer(
+			"{{INSTALL}}", install,
+			"{{BUILD}}", run,
+		).Replace(`FROM node:22-alpine AS build
+
+WORKDIR /app
+
+# Install dependencies before copying the source so they are cached between builds
+COPY package.json package-lock.json* yarn.lock* pnpm-lock.yaml* ./
+RUN {{INSTALL}}
+
+COPY . .
+RUN {{BUILD}}
+
+`)
+		source = "COPY --from=build /app/" + site.OutputDir + " /usr/share/nginx/html"
+	}
+
+	framework := site.Framework
+	if framework == "" {
+		framework = "plain HTML"
+	}
+
+	return strings.NewReplacer(
+		"{{FRAMEWORK}}", framework,
+		"{{BUILD_STAGE}}", build,
+		"{{FALLBACK}}", fallback,
+		"{{HEALTH_PATH}}", StaticSiteHealthPath,
+		"{{LABEL}}", StaticSiteLabel,
+		"{{SOURCE}}", source,
+	).Replace(`# syntax=docker/dockerfile:1
+# Static site ({{FRAMEWORK}}): served by nginx on $PORT
+
+{{BUILD_STAGE}}FROM nginx:alpine
+
+LABEL {{LABEL}}="true"
+
+ENV PORT=8080
+
+# nginx site listening on ${PORT} (filled in by envsubst at startup)
+# {{HEALTH_PATH}} answers health checks; unknown paths get {{FALLBACK}}
+RUN rm -f /etc/nginx/conf.d/default.conf && printf '%s\n' \
+    'server {' \
+    '    listen ${PORT};' \
+    '    root /usr/share/nginx/html;' \
+    '    index index.html index.htm;' \
+    '    error_page 404 /404.html;' \
+    '    gzip on;' \
+    '    gzip_types text/css application/javascript application/json image/svg+xml;' \
+    '    location = {{HEALTH_PATH}} {' \
+    '        access_log off;' \
+    '        return 200 "ok";' \
+    '    }' \
+    '    location / {' \
+    '        try_files $uri $uri/ {{FALLBACK}};' \
+    '    }' \
+    '    location ~* \.(?:css|js|mjs|woff2?|ttf|png|jpe?g|gif|svg|ico|webp|avif)$ {' \
+    '        expires 7d;' \
+    '        try_files $uri =404;' \
+    '    }' \
+    '    location ~ /\.(?!well-known) {' \
+    '        deny all;' \
+    '    }' \
+    '}' > /etc/nginx/stackyn.conf.template
+
+{{SOURCE}}
+
+# The platform sets PORT=8080 at runtime
+EXPOSE 8080
+
+CMD ["/bin/sh", "-c", "envsubst '${PORT}' < /etc/nginx/stackyn.conf.template > /etc/nginx/conf.d/default.conf && exec nginx -g 'daemon off;'"]
+`)
+}
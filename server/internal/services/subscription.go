@@ -20,6 +20,8 @@ type SubscriptionService struct {
 	userRepo         UserRepository
 	billingUpdater   UserBillingUpdater // Optional - for syncing billing fields to users table
 	appStopper       AppStopper         // Optional - for stopping apps when trial expires
+	gracePeriod      time.Duration      // Read-only window after a failed payment before apps stop (0 = stop immediately)
+	notifier         *Notifier          // Optional - applies notification preferences (Slack) to billing emails
 	logger           *zap.Logger
 }
 
@@ -29,9 +31,13 @@ type Subscription struct {
 	UserID             string
 	LemonSubscriptionID *string    // nullable
 	Plan               string      // starter | pro
-	Status             string      // trial | active | expired | cancelled
+	Status             string      // trial | active | grace | expired | cancelled
 	TrialStartedAt     *time.Time  // nullable
 	TrialEndsAt        *time.Time  // nullable
+	GraceEndsAt        *time.Time  // nullable - set while status is grace
+	CurrentPeriodStart *time.Time  // nullable - start of the paid billing period
+	CurrentPeriodEnd   *time.Time  // nullable - when the period renews (or ends, once cancelled)
+	CancelAtPeriodEnd  bool        // Cancelled but paid up - stays active until CurrentPeriodEnd
 	RAMLimitMB         int
 	DiskLimitGB        int
 	CreatedAt          time.Time
@@ -50,6 +56,9 @@ type SubscriptionRepo interface {
 	CreateSubscription(ctx context.Context, userID, lemonSubscriptionID, plan, status string, trialStartedAt, trialEndsAt *time.Time, ramLimitMB, diskLimitGB int) (*Subscription, error)
 	UpdateSubscriptionByUserID(ctx context.Context, userID, plan, status string, ramLimitMB, diskLimitGB *int, lemonSubID *string) error
 	GetTrialSubscriptions(ctx context.Context) ([]*Subscription, error)
+	StartGracePeriod(ctx context.Context, userID string, graceEndsAt time.Time) error
+	SetSubscriptionPeriod(ctx context.Context, userID string, periodEnd time.Time, startedAt *time.Time) error
+	SetCancelAtPeriodEnd(ctx context.Context, userID string) error
 }
 
 // UserRepository interface for user operations
@@ -62,6 +71,7 @@ type UserRepository interface {
 // This allows the subscription service to sync billing status to users table
 type UserBillingUpdater interface {
 	UpdateUserBilling(ctx context.Context, userID, billingStatus, plan, subscriptionID string, trialStartedAt, trialEndsAt *time.Time) error
+	UpdateUserGracePeriod(ctx context.Context, userID string, graceEndsAt time.Time) error
 }
 
 // NewSubscriptionService creates a new subscription service
@@ -91,6 +101,32 @@ func (s *SubscriptionService) SetAppStopper(appStopper AppStopper) {
 	s.appStopper = appStopper
 }
 
+// SetNotifier routes billing emails through the notifier so users also get them on their enabled channels
+// Without a notifier the emails are sent directly
+func (s *SubscriptionService) SetNotifier(notifier *Notifier) {
+	s.notifier = notifier
+}
+
+// notifyBilling delivers a billing notice; summary is the plain-text version for chat channels
+func (s *SubscriptionService) notifyBilling(userID, userEmail, summary string, sendEmail func(to, locale string) error) error {
+	if s.notifier == nil {
+		return sendEmail(userEmail, DefaultLocale)
+	}
+	return s.notifier.Notify(context.Background(), Notification{
+		UserID:    userID,
+		Email:     userEmail,
+		Category:  NotificationBilling,
+		Summary:   summary,
+		SendEmail: sendEmail,
+	})
+}
+
+// SetGracePeriod sets how long apps keep running in read-only mode after a failed payment
+// A zero duration stops apps immediately when the subscription expires
+func (s *SubscriptionService) SetGracePeriod(gracePeriod time.Duration) {
+	s.gracePeriod = gracePeriod
+}
+
 // CreateTrial creates a 7-day free trial for a new user
 // Trial defaults to Pro plan limits (2GB RAM / 20GB Disk)
 func (s *SubscriptionService) CreateTrial(ctx context.Context, userID, userEmail string) error {
@@ -136,7 +172,9 @@ func (s *SubscriptionService) CreateTrial(ctx context.Context, userID, userEmail
 
 	// Send trial started email (non-blocking - don't fail signup if email fails)
 	go func() {
-		if err := s.emailService.SendTrialStartedEmail(userEmail, trialEndsAt); err != nil {
+		if err := s.notifyBilling(userID, userEmail, "Your Stackyn Pro trial has started and runs until "+trialEndsAt.Format("January 2, 2006")+".", func(to, locale string) error {
+			return s.emailService.SendTrialStartedEmail(to, locale, trialEndsAt)
+		}); err != nil {
 			s.logger.Warn("Failed to send trial started email",
 				zap.Error(err),
 				zap.String("user_email", userEmail),
@@ -158,14 +196,27 @@ func (s *SubscriptionService) GetSubscriptionByUserID(ctx context.Context, userI
 }
 
 // IsSubscriptionActive checks if a subscription allows deployments
-// Returns true if status is "trial" or "active"
+// Returns true if status is "trial" or "active", unless a cancelled subscription's paid period is over
+// (the billing worker may not have ended it yet)
 func (s *SubscriptionService) IsSubscriptionActive(sub *Subscription) bool {
 	if sub == nil {
 		return false
 	}
+	if sub.CancelAtPeriodEnd && sub.CurrentPeriodEnd != nil && !time.Now().Before(*sub.CurrentPeriodEnd) {
+		return false
+	}
 	return sub.Status == "trial" || sub.Status == "active"
 }
 
+// RecordBillingPeriod stores the end of a subscription's current billing period as the billing provider reports it
+// startedAt is when the provider's subscription was created, used as the start of the first period
+func (s *SubscriptionService) RecordBillingPeriod(ctx context.Context, userID string, periodEnd time.Time, startedAt *time.Time) error {
+	if err := s.subscriptionRepo.SetSubscriptionPeriod(ctx, userID, periodEnd, startedAt); err != nil {
+		return fmt.Errorf("failed to record billing period: %w", err)
+	}
+	return nil
+}
+
 // GetPlanLimits returns RAM and disk limits for a plan
 func GetPlanLimits(planName string) (ramLimitMB, diskLimitGB int) {
 	switch planName {
@@ -219,7 +270,9 @@ func (s *SubscriptionService) ActivateSubscription(ctx context.Context, userID,
 	// Send subscription activated email (non-blocking)
 	if userEmail != "" {
 		go func() {
-			if err := s.emailService.SendSubscriptionActivatedEmail(userEmail, plan, ramLimitMB, diskLimitGB); err != nil {
+			if err := s.notifyBilling(userID, userEmail, "Your Stackyn "+plan+" subscription is active.", func(to, locale string) error {
+				return s.emailService.SendSubscriptionActivatedEmail(to, locale, plan, ramLimitMB, diskLimitGB)
+			}); err != nil {
 				s.logger.Warn("Failed to send subscription activated email",
 					zap.Error(err),
 					zap.String("user_email", userEmail),
@@ -235,6 +288,36 @@ func (s *SubscriptionService) ActivateSubscription(ctx context.Context, userID,
 	return nil
 }
 
+// ChangePlan switches an active subscription to another plan with immediate effect
+// The billing side (proration) is up to the caller; status and billing period are left as they are
+func (s *SubscriptionService) ChangePlan(ctx context.Context, userID, plan string) error {
+	ramLimitMB, diskLimitGB := GetPlanLimits(plan)
+	if err := s.subscriptionRepo.UpdateSubscriptionByUserID(ctx, userID, plan, "", &ramLimitMB, &diskLimitGB, nil); err != nil {
+		return fmt.Errorf("failed to change plan: %w", err)
+	}
+
+	s.logger.Info("Subscription plan changed",
+		zap.String("user_id", userID),
+		zap.String("plan", plan),
+	)
+
+	// Sync billing fields to users table (non-blocking)
+	if s.billingUpdater != nil {
+		sub, err := s.subscriptionRepo.GetSubscriptionByUserID(ctx, userID)
+		if err == nil && sub.LemonSubscriptionID != nil {
+			if err := s.billingUpdater.UpdateUserBilling(ctx, userID, sub.Status, plan, *sub.LemonSubscriptionID, nil, nil); err != nil {
+				s.logger.Warn("Failed to sync billing fields to users table",
+					zap.Error(err),
+					zap.String("user_id", userID),
+				)
+				// Non-critical - subscription table is source of truth
+			}
+		}
+	}
+
+	return nil
+}
+
 // ExpireTrial expires a trial subscription
 func (s *SubscriptionService) ExpireTrial(ctx context.Context, userID, userEmail string) error {
 	err := s.subscriptionRepo.UpdateSubscriptionByUserID(
@@ -297,7 +380,9 @@ func (s *SubscriptionService) ExpireTrial(ctx context.Context, userID, userEmail
 	// Send trial expired email (non-blocking)
 	if userEmail != "" {
 		go func() {
-			if err := s.emailService.SendTrialExpiredEmail(userEmail); err != nil {
+			if err := s.notifyBilling(userID, userEmail, "Your Stackyn trial has ended and your apps have been stopped. Subscribe to bring them back.", func(to, locale string) error {
+				return s.emailService.SendTrialExpiredEmail(to, locale)
+			}); err != nil {
 				s.logger.Warn("Failed to send trial expired email",
 					zap.Error(err),
 					zap.String("user_email", userEmail),
@@ -313,6 +398,28 @@ func (s *SubscriptionService) ExpireTrial(ctx context.Context, userID, userEmail
 	return nil
 }
 
+// CancelAtPeriodEnd cancels a subscription when the period the user has paid for ends
+// Subscriptions without a recorded period still ahead (or not active) are cancelled immediately
+func (s *SubscriptionService) CancelAtPeriodEnd(ctx context.Context, userID string) error {
+	sub, err := s.subscriptionRepo.GetSubscriptionByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get subscription: %w", err)
+	}
+	if sub.Status != "active" || sub.CurrentPeriodEnd == nil || !time.Now().Before(*sub.CurrentPeriodEnd) {
+		return s.CancelSubscription(ctx, userID)
+	}
+
+	if err := s.subscriptionRepo.SetCancelAtPeriodEnd(ctx, userID); err != nil {
+		return fmt.Errorf("failed to schedule cancellation: %w", err)
+	}
+
+	s.logger.Info("Subscription cancels at period end",
+		zap.String("user_id", userID),
+		zap.Time("current_period_end", *sub.CurrentPeriodEnd),
+	)
+	return nil
+}
+
 // CancelSubscription cancels a subscription
 func (s *SubscriptionService) CancelSubscription(ctx context.Context, userID string) error {
 	err := s.subscriptionRepo.UpdateSubscriptionByUserID(
@@ -336,12 +443,110 @@ func (s *SubscriptionService) CancelSubscription(ctx context.Context, userID str
 		zap.String("user_id", userID),
 	)
 
+	// Sync billing fields to users table - BillingMiddleware blocks deploys from these
+	if s.billingUpdater != nil {
+		sub, err := s.subscriptionRepo.GetSubscriptionByUserID(ctx, userID)
+		plan := ""
+		subscriptionID := ""
+		if err == nil && sub != nil {
+			plan = sub.Plan
+			if sub.LemonSubscriptionID != nil {
+				subscriptionID = *sub.LemonSubscriptionID
+			}
+		}
+		if err := s.billingUpdater.UpdateUserBilling(ctx, userID, "cancelled", plan, subscriptionID, nil, nil); err != nil {
+			s.logger.Warn("Failed to sync billing fields to users table",
+				zap.Error(err),
+				zap.String("user_id", userID),
+			)
+			// Non-critical - subscription table is source of truth
+		}
+	}
+
 	return nil
 }
 
-// ExpireSubscription expires a subscription (payment failed or subscription expired)
-// Stops all apps and sends email notification
+// ExpireSubscription handles a failed payment or expired subscription
+// With a grace period configured, apps keep running in read-only mode until it ends (see StartGracePeriod)
+// Otherwise the subscription expires immediately and all apps are stopped
 func (s *SubscriptionService) ExpireSubscription(ctx context.Context, userID, userEmail string) error {
+	if s.gracePeriod > 0 {
+		sub, err := s.subscriptionRepo.GetSubscriptionByUserID(ctx, userID)
+		if err == nil && sub != nil && sub.Status == "grace" {
+			// Already in grace (e.g. repeated invoice_failed retries) - keep the original deadline
+			s.logger.Info("Subscription already in grace period",
+				zap.String("user_id", userID),
+			)
+			return nil
+		}
+		if err == nil && sub != nil && sub.Status == "active" {
+			return s.StartGracePeriod(ctx, userID, userEmail)
+		}
+	}
+
+	return s.EndSubscription(ctx, userID, userEmail)
+}
+
+// StartGracePeriod puts an active subscription into read-only grace mode
+// Apps keep running, but deploys and configuration changes are blocked until payment succeeds
+// The billing worker calls EndSubscription once the grace period has passed
+func (s *SubscriptionService) StartGracePeriod(ctx context.Context, userID, userEmail string) error {
+	graceEndsAt := time.Now().Add(s.gracePeriod)
+
+	if err := s.subscriptionRepo.StartGracePeriod(ctx, userID, graceEndsAt); err != nil {
+		s.logger.Error("Failed to start grace period",
+			zap.Error(err),
+			zap.String("user_id", userID),
+		)
+		return fmt.Errorf("failed to start grace period: %w", err)
+	}
+
+	s.logger.Info("Subscription entered grace period",
+		zap.String("user_id", userID),
+		zap.Time("grace_ends_at", graceEndsAt),
+	)
+
+	// Sync billing fields to users table - BillingMiddleware enforces read-only mode from these
+	if s.billingUpdater != nil {
+		if err := s.billingUpdater.UpdateUserGracePeriod(ctx, userID, graceEndsAt); err != nil {
+			s.logger.Warn("Failed to sync grace period to users table",
+				zap.Error(err),
+				zap.String("user_id", userID),
+			)
+			// Non-critical - subscription table is source of truth
+		}
+	}
+
+	// Send payment failed email with the grace deadline (non-blocking)
+	if userEmail != "" {
+		go func() {
+			if err := s.notifyBilling(userID, userEmail, "Your Stackyn payment failed. Apps keep running read-only until "+graceEndsAt.Format("January 2, 2006 15:04 MST")+" - update your payment method to avoid interruption.", func(to, locale string) error {
+				return s.emailService.SendPaymentFailedGraceEmail(to, locale, graceEndsAt)
+			}); err != nil {
+				s.logger.Warn("Failed to send payment failed email",
+					zap.Error(err),
+					zap.String("user_email", userEmail),
+				)
+			} else {
+				s.logger.Info("Payment failed email sent",
+					zap.String("user_email", userEmail),
+				)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// EndSubscription expires a subscription immediately
+// Stops all apps and sends email notification
+func (s *SubscriptionService) EndSubscription(ctx context.Context, userID, userEmail string) error {
+	// Subscriptions coming out of grace already had the payment failed email
+	wasInGrace := false
+	if sub, err := s.subscriptionRepo.GetSubscriptionByUserID(ctx, userID); err == nil && sub != nil {
+		wasInGrace = sub.Status == "grace"
+	}
+
 	err := s.subscriptionRepo.UpdateSubscriptionByUserID(
 		ctx,
 		userID,
@@ -403,10 +608,27 @@ func (s *SubscriptionService) ExpireSubscription(ctx context.Context, userID, us
 		)
 	}
 
-	// Send payment failed email (non-blocking)
-	if userEmail != "" {
+	// Send payment failed email, or subscription expired email after a grace period (non-blocking)
+	if userEmail != "" && wasInGrace {
 		go func() {
-			if err := s.emailService.SendPaymentFailedEmail(userEmail); err != nil {
+			if err := s.notifyBilling(userID, userEmail, "Your Stackyn subscription has expired and your apps have been stopped.", func(to, locale string) error {
+				return s.emailService.SendSubscriptionExpiredEmail(to, locale)
+			}); err != nil {
+				s.logger.Warn("Failed to send subscription expired email",
+					zap.Error(err),
+					zap.String("user_email", userEmail),
+				)
+			} else {
+				s.logger.Info("Subscription expired email sent",
+					zap.String("user_email", userEmail),
+				)
+			}
+		}()
+	} else if userEmail != "" {
+		go func() {
+			if err := s.notifyBilling(userID, userEmail, "Your Stackyn payment failed and your apps have been stopped. Update your payment method to restore them.", func(to, locale string) error {
+				return s.emailService.SendPaymentFailedEmail(to, locale)
+			}); err != nil {
 				s.logger.Warn("Failed to send payment failed email",
 					zap.Error(err),
 					zap.String("user_email", userEmail),
@@ -601,12 +823,22 @@ func (s *SubscriptionService) ProcessTrialLifecycle(ctx context.Context) error {
 				zap.String("subscription_id", sub.ID),
 			)
 		} else if sub.TrialEndsAt.Before(trialEndingThreshold) && sub.TrialEndsAt.After(now) {
-			// Trial ending soon (within 24 hours) - send reminder
-			// Note: Email idempotency is handled by checking if email was already sent
-			// For MVP, we send reminder daily until trial expires
-			// TODO: Add email_sent flag to subscriptions table for better idempotency
-			go func(email string, endsAt time.Time) {
-				if err := s.emailService.SendTrialEndingEmail(email, endsAt); err != nil {
+			// Trial ending soon (within 24 hours) - send reminder once
+			// The email log remembers the reminder by its idempotency key; without an email queue
+			// the reminder is repeated on every run until the trial expires
+			if sent, err := s.emailService.HasSentEmail(ctx, TrialEndingEmailKey(user.Email, *sub.TrialEndsAt)); err != nil {
+				s.logger.Warn("Failed to check for a sent trial ending email",
+					zap.Error(err),
+					zap.String("user_id", sub.UserID),
+				)
+				continue
+			} else if sent {
+				continue
+			}
+			go func(userID, email string, endsAt time.Time) {
+				if err := s.notifyBilling(userID, email, "Your Stackyn trial ends on "+endsAt.Format("January 2, 2006 15:04 MST")+". Subscribe to keep your apps running.", func(to, locale string) error {
+					return s.emailService.SendTrialEndingEmail(to, locale, endsAt)
+				}); err != nil {
 					s.logger.Warn("Failed to send trial ending email",
 						zap.Error(err),
 						zap.String("user_email", email),
@@ -616,7 +848,7 @@ func (s *SubscriptionService) ProcessTrialLifecycle(ctx context.Context) error {
 						zap.String("user_email", email),
 					)
 				}
-			}(user.Email, *sub.TrialEndsAt)
+			}(sub.UserID, user.Email, *sub.TrialEndsAt)
 		}
 	}
 
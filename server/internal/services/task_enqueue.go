@@ -1,19 +1,52 @@
 package services
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/hibiken/asynq"
 	"go.uber.org/zap"
+	"stackyn/server/internal/deploystate"
+	"stackyn/server/internal/metrics"
 )
 
+// Queues build and deploy tasks are routed to (mirrors tasks.Queue*)
+// Interactive tasks (deploystate.InteractiveTrigger) go to the *_interactive queues, which workers serve
+// with reserved capacity on top of the general pool
+const (
+	queueBuild             = "build"
+	queueBuildInteractive  = "build_interactive"
+	queueBuildCritical     = "build_critical"
+	queueBuildPro          = "build_pro"
+	queueBuildFree         = "build_free"
+	queueDeploy            = "deploy"
+	queueDeployInteractive = "deploy_interactive"
+	queueEmail             = "email"
+	queueCleanup           = "cleanup"
+)
+
+// maxEmailRetries is how often a failed email delivery is retried (about 2 hours with the email backoff)
+const maxEmailRetries = 8
+
 // TaskEnqueueService handles enqueueing tasks with plan-based priority
 type TaskEnqueueService struct {
 	client          *asynq.Client
+	inspector       *asynq.Inspector // Looks up the existing task when a deduplicated enqueue conflicts
 	logger          *zap.Logger
 	planEnforcement *PlanEnforcementService
+	stateRecorder   TaskStateRecorder // Optional: records enqueued builds and deploys as pending
+	deployEvents    DeployEventRecorder // Optional: records queued builds on the app's events timeline
+	hostScheduler   HostScheduler       // Optional: places deploys on a host (see SetHostScheduler)
+}
+
+// TaskStateRecorder records an enqueued task as pending in the task state table (api.TaskStateRepo)
+// Workers record the rest of the task's life, so a deployment waiting in a queue shows as such
+type TaskStateRecorder interface {
+	RecordTaskEnqueued(ctx context.Context, taskID, taskType, queue string, payload []byte, maxRetries int) error
 }
 
 // NewTaskEnqueueService creates a new task enqueue service
@@ -27,23 +60,134 @@ func NewTaskEnqueueService(redisAddr string, redisPassword string, logger *zap.L
 
 	return &TaskEnqueueService{
 		client:          client,
+		inspector:       asynq.NewInspector(redisOpt),
 		logger:          logger,
 		planEnforcement: planEnforcement,
 	}, nil
 }
 
+// SetTaskStateRecorder records the build and deploy tasks this service enqueues as pending
+func (s *TaskEnqueueService) SetTaskStateRecorder(recorder TaskStateRecorder) {
+	s.stateRecorder = recorder
+}
+
+// SetDeployEventRecorder records the builds this service enqueues on their app's events timeline
+func (s *TaskEnqueueService) SetDeployEventRecorder(recorder DeployEventRecorder) {
+	s.deployEvents = recorder
+}
+
+// recordBuildQueued records a newly queued build on its app's events timeline; a failure is only logged
+func (s *TaskEnqueueService) recordBuildQueued(ctx context.Context, appID, buildJobID, queue, trigger string) {
+	if s.deployEvents == nil || buildJobID == "" {
+		return
+	}
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	err := s.deployEvents.RecordDeployEvent(recordCtx, DeployEvent{
+		AppID:      appID,
+		BuildJobID: buildJobID,
+		Type:       DeployEventBuildQueued,
+		Message:    "Build queued",
+		Data:       map[string]interface{}{"queue": queue, "trigger": trigger},
+	})
+	if err != nil {
+		s.logger.Warn("Failed to record queued build", zap.Error(err), zap.String("build_job_id", buildJobID))
+	}
+}
+
+// recordEnqueued records an enqueued task as pending; a failure is logged and the task still runs
+// A deduplicated enqueue returns a task that is already recorded, which the recorder leaves alone
+func (s *TaskEnqueueService) recordEnqueued(ctx context.Context, info *asynq.TaskInfo) {
+	if s.stateRecorder == nil {
+		return
+	}
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := s.stateRecorder.RecordTaskEnqueued(recordCtx, info.ID, info.Type, info.Queue, info.Payload, info.MaxRetry); err != nil {
+		s.logger.Warn("Failed to record enqueued task", zap.Error(err), zap.String("task_id", info.ID))
+	}
+}
+
 // Close closes the Asynq client
 func (s *TaskEnqueueService) Close() error {
+	s.inspector.Close()
 	return s.client.Close()
 }
 
+// buildDedupKey is the part of a build payload that identifies the work being built
+type buildDedupKey struct {
+	AppID     string `json:"app_id"`
+	Branch    string `json:"branch"`
+	Tag       string `json:"tag"`
+	CommitSHA string `json:"commit_sha"`
+	Trigger   string `json:"trigger"`
+}
+
+// queueFor returns the interactive queue for interactive triggers and the general queue otherwise
+func queueFor(general, interactive, trigger string) string {
+	if deploystate.InteractiveTrigger(trigger) {
+		return interactive
+	}
+	return general
+}
+
+// buildQueueFor returns the queue of a build: the interactive queue when someone is waiting on it, the
+// critical queue for security rebuilds and recoveries, and otherwise the queue of the owner's plan tier
+func buildQueueFor(trigger string, priority int) string {
+	switch {
+	case deploystate.InteractiveTrigger(trigger):
+		return queueBuildInteractive
+	case trigger == deploystate.TriggerSecurityRebuild || trigger == deploystate.TriggerSystem:
+		return queueBuildCritical
+	case priority >= QueuePriorityPro:
+		return queueBuildPro
+	case priority >= QueuePriorityDefault:
+		return queueBuild
+	default:
+		return queueBuildFree
+	}
+}
+
+// stampQueuedAt sets queued_at on a JSON task payload, which workers measure the queue wait from
+func stampQueuedAt(payload []byte) ([]byte, error) {
+	return stampField(payload, "queued_at", time.Now().UTC())
+}
+
+// stampField sets one field of a JSON task payload
+func stampField(payload []byte, field string, value interface{}) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	fields[field] = encoded
+	return json.Marshal(fields)
+}
+
+// BuildTaskID returns the task ID builds of the same app and commit share, so double-clicked
+// redeploys collapse into one task. Without a known commit the tag or branch head is what gets built
+func BuildTaskID(appID, branch, tag, commitSHA string) string {
+	if commitSHA != "" {
+		return fmt.Sprintf("build:%s:%s", appID, commitSHA)
+	}
+	if tag != "" {
+		return fmt.Sprintf("build:%s:tag:%s", appID, tag)
+	}
+	return fmt.Sprintf("build:%s:branch:%s", appID, branch)
+}
+
 // EnqueueBuildTask enqueues a build task with plan-based priority
+// While a build of the same app and commit is still queued or running, that task is returned
+// instead of a new one - compare the returned payload's build_job_id to detect this
 func (s *TaskEnqueueService) EnqueueBuildTask(ctx context.Context, payload interface{}, userID string) (*asynq.TaskInfo, error) {
 	// Get queue priority based on user's plan
 	priority, err := s.planEnforcement.GetQueuePriority(ctx, userID)
 	if err != nil {
 		s.logger.Warn("Failed to get queue priority, using default", zap.Error(err))
-		priority = 1 // Default priority
+		priority = QueuePriorityFree
 	}
 
 	// Serialize payload
@@ -52,22 +196,62 @@ func (s *TaskEnqueueService) EnqueueBuildTask(ctx context.Context, payload inter
 		return nil, fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
+	var key buildDedupKey
+	if err := json.Unmarshal(payloadBytes, &key); err != nil || key.AppID == "" {
+		return nil, fmt.Errorf("build task payload must include app_id")
+	}
+	taskID := BuildTaskID(key.AppID, key.Branch, key.Tag, key.CommitSHA)
+	if payloadBytes, err = stampQueuedAt(payloadBytes); err != nil {
+		return nil, fmt.Errorf("failed to stamp payload: %w", err)
+	}
+
+	// Task IDs are unique per queue, so a build of the same commit queued with another kind of
+	// trigger (or before a plan change) is looked up first
+	queue := buildQueueFor(key.Trigger, priority)
+	for _, otherQueue := range buildQueuesByPriority {
+		if otherQueue == queue {
+			continue
+		}
+		existing, err := s.inspector.GetTaskInfo(otherQueue, taskID)
+		if err != nil {
+			continue
+		}
+		switch existing.State {
+		case asynq.TaskStatePending, asynq.TaskStateActive, asynq.TaskStateScheduled, asynq.TaskStateRetry:
+			s.logger.Info("Build already in flight on another queue, not enqueueing a duplicate",
+				zap.String("task_id", taskID),
+				zap.String("queue", otherQueue),
+				zap.String("state", existing.State.String()),
+			)
+			return existing, nil
+		}
+	}
+
 	// Create task
 	task := asynq.NewTask("build_task", payloadBytes)
 
-	// Use build-specific queue to ensure only build-worker processes it
-	// Builds should only start when explicitly triggered by user (CreateApp or RedeployApp)
-	info, err := s.client.Enqueue(task, 
-		asynq.Queue("build"), // Use build-specific queue
-		asynq.MaxRetry(0),    // No automatic retries - user must manually trigger redeploy
+	// Use build-specific queues to ensure only build-worker processes it
+	info, err := s.enqueueDeduplicated(task, queue, taskID,
+		asynq.MaxRetry(0), // No automatic retries - user must manually trigger redeploy
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to enqueue build task: %w", err)
 	}
+	metrics.ObserveTaskEnqueued("build_task", queue, key.Trigger)
+	s.recordEnqueued(ctx, info)
+
+	// A deduplicated enqueue returns the build already in flight, which was recorded when it was queued
+	var enqueued struct {
+		BuildJobID string `json:"build_job_id"`
+	}
+	if err := json.Unmarshal(info.Payload, &enqueued); err == nil && bytes.Equal(info.Payload, payloadBytes) {
+		s.recordBuildQueued(ctx, key.AppID, enqueued.BuildJobID, queue, key.Trigger)
+	}
 
 	s.logger.Info("Enqueued build task",
 		zap.String("task_id", info.ID),
-		zap.String("queue", "build"),
+		zap.String("queue", queue),
+		zap.String("trigger", key.Trigger),
 		zap.Int("priority", priority),
 		zap.String("user_id", userID),
 	)
@@ -81,7 +265,7 @@ func (s *TaskEnqueueService) EnqueueDeployTask(ctx context.Context, payload inte
 	priority, err := s.planEnforcement.GetQueuePriority(ctx, userID)
 	if err != nil {
 		s.logger.Warn("Failed to get queue priority, using default", zap.Error(err))
-		priority = 1 // Default priority
+		priority = QueuePriorityFree
 	}
 
 	// Serialize payload
@@ -90,18 +274,43 @@ func (s *TaskEnqueueService) EnqueueDeployTask(ctx context.Context, payload inte
 		return nil, fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
+	var key struct {
+		deployPlacement
+		Trigger string `json:"trigger"`
+	}
+	if err := json.Unmarshal(payloadBytes, &key); err != nil {
+		return nil, fmt.Errorf("failed to read deploy task payload: %w", err)
+	}
+	if payloadBytes, err = stampQueuedAt(payloadBytes); err != nil {
+		return nil, fmt.Errorf("failed to stamp payload: %w", err)
+	}
+
+	// Use deploy-specific queues to ensure only deploy-worker processes it
+	// With several hosts the deploy is placed on one, and only that host's deploy workers serve its queue
+	queue := queueFor(queueDeploy, queueDeployInteractive, key.Trigger)
+	host := s.scheduleDeploy(ctx, key.deployPlacement, userID)
+	if host != "" {
+		queue = HostQueue(queue, host)
+	}
+	if payloadBytes, err = stampField(payloadBytes, "host", host); err != nil {
+		return nil, fmt.Errorf("failed to stamp payload: %w", err)
+	}
+
 	// Create task
 	task := asynq.NewTask("deploy_task", payloadBytes)
 
-	// Use deploy-specific queue to ensure only deploy-worker processes it
-	info, err := s.client.Enqueue(task, asynq.Queue("deploy"))
+	info, err := s.client.Enqueue(task, asynq.Queue(queue))
 	if err != nil {
 		return nil, fmt.Errorf("failed to enqueue deploy task: %w", err)
 	}
+	metrics.ObserveTaskEnqueued("deploy_task", queue, key.Trigger)
+	s.recordEnqueued(ctx, info)
 
 	s.logger.Info("Enqueued deploy task",
 		zap.String("task_id", info.ID),
-		zap.String("queue", "deploy"),
+		zap.String("queue", queue),
+		zap.String("host", host),
+		zap.String("trigger", key.Trigger),
 		zap.Int("priority", priority),
 		zap.String("user_id", userID),
 	)
@@ -109,3 +318,396 @@ func (s *TaskEnqueueService) EnqueueDeployTask(ctx context.Context, payload inte
 	return info, nil
 }
 
+// EnqueueCronRunTask enqueues one run of a cron job on the deploy queue (the deploy worker owns app containers)
+// The run ID is the task ID, so a run is never started twice
+func (s *TaskEnqueueService) EnqueueCronRunTask(ctx context.Context, runID string, timeoutSeconds int, payload interface{}) (*asynq.TaskInfo, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask("cron_run_task", payloadBytes)
+	queue := s.appQueue(ctx, queueDeploy, payloadBytes)
+	info, err := s.client.Enqueue(task,
+		asynq.Queue(queue),
+		asynq.TaskID("cron:"+runID),
+		asynq.MaxRetry(0), // Commands are not assumed to be safe to repeat
+		asynq.Timeout(time.Duration(timeoutSeconds)*time.Second+time.Minute), // Room to pull the image and collect output
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue cron run task: %w", err)
+	}
+
+	s.logger.Info("Enqueued cron run task",
+		zap.String("task_id", info.ID),
+		zap.String("run_id", runID),
+		zap.String("queue", queue),
+	)
+
+	return info, nil
+}
+
+// EnqueueExecTask enqueues a one-off command on the interactive deploy queue - its caller is waiting on the output
+// The run ID is the task ID, so a command is never run twice
+func (s *TaskEnqueueService) EnqueueExecTask(ctx context.Context, runID string, timeoutSeconds int, payload interface{}) (*asynq.TaskInfo, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask("exec_task", payloadBytes)
+	queue := s.appQueue(ctx, queueDeployInteractive, payloadBytes)
+	info, err := s.client.Enqueue(task,
+		asynq.Queue(queue),
+		asynq.TaskID("exec:"+runID),
+		asynq.MaxRetry(0), // Commands such as migrations are not assumed to be safe to repeat
+		asynq.Timeout(time.Duration(timeoutSeconds)*time.Second+time.Minute), // Room to pull the image and flush output
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue exec task: %w", err)
+	}
+
+	s.logger.Info("Enqueued exec task",
+		zap.String("task_id", info.ID),
+		zap.String("run_id", runID),
+		zap.String("queue", queue),
+	)
+
+	return info, nil
+}
+
+// EnqueueAppExportTask enqueues writing an app's export bundle on the deploy queue (the deploy worker can read app volumes)
+// The export ID is the task ID, so a bundle is never written twice
+func (s *TaskEnqueueService) EnqueueAppExportTask(ctx context.Context, exportID string, payload interface{}) (*asynq.TaskInfo, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask("app_export_task", payloadBytes)
+	queue := s.appQueue(ctx, queueDeploy, payloadBytes)
+	info, err := s.client.Enqueue(task,
+		asynq.Queue(queue),
+		asynq.TaskID("export:"+exportID),
+		asynq.MaxRetry(0), // A failed export is recorded on the export; the user can request a new one
+		asynq.Timeout(time.Hour), // Volumes can be large
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue app export task: %w", err)
+	}
+
+	s.logger.Info("Enqueued app export task",
+		zap.String("task_id", info.ID),
+		zap.String("export_id", exportID),
+		zap.String("queue", queue),
+	)
+
+	return info, nil
+}
+
+// EnqueueAppPowerTask enqueues stopping or starting an app's containers on the deploy queue (the deploy worker owns
+// app containers). Repeated requests for the same action share the task while it is queued or running
+func (s *TaskEnqueueService) EnqueueAppPowerTask(ctx context.Context, appID, action string, payload interface{}) (*asynq.TaskInfo, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask("app_power_task", payloadBytes)
+	info, err := s.enqueueDeduplicated(task, s.appQueue(ctx, queueDeploy, payloadBytes), action+":"+appID,
+		asynq.MaxRetry(3),
+		asynq.Timeout(2*time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue app power task: %w", err)
+	}
+
+	s.logger.Info("Enqueued app power task",
+		zap.String("task_id", info.ID),
+		zap.String("app_id", appID),
+		zap.String("action", action),
+		zap.String("queue", info.Queue),
+	)
+
+	return info, nil
+}
+
+// EnqueueAppWakeTask enqueues starting a sleeping app's containers on the deploy queue (the deploy worker owns app containers)
+// Every request to a sleeping app asks for a wake, so requests arriving while one is queued or running share it
+func (s *TaskEnqueueService) EnqueueAppWakeTask(ctx context.Context, appID string, payload interface{}) (*asynq.TaskInfo, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask("app_wake_task", payloadBytes)
+	info, err := s.enqueueDeduplicated(task, s.appQueue(ctx, queueDeploy, payloadBytes), "wake:"+appID,
+		asynq.MaxRetry(3),
+		asynq.Timeout(2*time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue app wake task: %w", err)
+	}
+
+	s.logger.Info("Enqueued app wake task",
+		zap.String("task_id", info.ID),
+		zap.String("app_id", appID),
+		zap.String("queue", info.Queue),
+	)
+
+	return info, nil
+}
+
+// EnqueueCleanupTask enqueues an immediate cleanup run on the cleanup workers
+// Requests made while a run is queued or running share it. Runs are not retried - the scheduler
+// runs cleanup again within its interval anyway
+func (s *TaskEnqueueService) EnqueueCleanupTask(ctx context.Context, payload interface{}) (*asynq.TaskInfo, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask("cleanup_task", payloadBytes)
+	info, err := s.enqueueDeduplicated(task, queueCleanup, "cleanup:admin",
+		asynq.MaxRetry(0),
+		asynq.Timeout(10*time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue cleanup task: %w", err)
+	}
+
+	s.logger.Info("Enqueued cleanup task",
+		zap.String("task_id", info.ID),
+		zap.String("queue", queueCleanup),
+	)
+
+	return info, nil
+}
+
+// EnqueueEmailTask enqueues the delivery of an email recorded in the email log
+// The email ID is the task ID, so an email is never delivered twice
+func (s *TaskEnqueueService) EnqueueEmailTask(ctx context.Context, emailID string) (*asynq.TaskInfo, error) {
+	payloadBytes, err := json.Marshal(struct {
+		EmailID string `json:"email_id"`
+	}{EmailID: emailID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask("email_task", payloadBytes)
+	info, err := s.enqueueDeduplicated(task, queueEmail, "email:"+emailID,
+		asynq.MaxRetry(maxEmailRetries),
+		asynq.Timeout(2*time.Minute), // Resend, then the SMTP fallback
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue email task: %w", err)
+	}
+
+	s.logger.Info("Enqueued email task",
+		zap.String("task_id", info.ID),
+		zap.String("email_id", emailID),
+		zap.String("queue", queueEmail),
+	)
+
+	return info, nil
+}
+
+// BuildCancellation describes what cancelling a build task did
+type BuildCancellation string
+
+const (
+	BuildCancellationDequeued  BuildCancellation = "dequeued"  // Removed from the queue before a worker picked it up
+	BuildCancellationSignalled BuildCancellation = "signalled" // The worker running it was told to cancel its context
+)
+
+// FindBuildTask returns the queued or running build task of a build job, or nil when there is none
+// Build task IDs are keyed by app and commit, so tasks are matched on the build_job_id in their payload
+func (s *TaskEnqueueService) FindBuildTask(ctx context.Context, buildJobID string) (*asynq.TaskInfo, error) {
+	listers := []func(string, ...asynq.ListOption) ([]*asynq.TaskInfo, error){
+		s.inspector.ListActiveTasks,
+		s.inspector.ListPendingTasks,
+		s.inspector.ListScheduledTasks,
+		s.inspector.ListRetryTasks,
+	}
+	for _, queue := range buildQueuesByPriority {
+		info, err := s.findBuildTaskIn(queue, listers, buildJobID)
+		if err != nil || info != nil {
+			return info, err
+		}
+	}
+	return nil, nil
+}
+
+// buildQueuesByPriority lists the build queues in the order workers favour them (by weight): a build is
+// taken to wait for every build queued ahead of it in its own queue and in the queues listed before it
+var buildQueuesByPriority = []string{queueBuildInteractive, queueBuildCritical, queueBuildPro, queueBuild, queueBuildFree}
+
+// BuildQueuePosition is where a build stands in the build queues
+type BuildQueuePosition struct {
+	Task     *asynq.TaskInfo
+	Building bool // A worker is running it; the counts below are then about the builds around it
+	Position int  // 1-based place among the builds waiting for a worker
+	Ahead    int  // Builds that start before it
+	Running  int  // Builds running now
+	Workers  int  // Build worker slots serving its queue (0 when no build worker is up)
+}
+
+// GetBuildQueuePosition finds the build task of a build job and works out where it stands in the queues
+// Returns nil when the build is not in the queues (not enqueued, or already finished)
+func (s *TaskEnqueueService) GetBuildQueuePosition(ctx context.Context, buildJobID string) (*BuildQueuePosition, error) {
+	task, err := s.FindBuildTask(ctx, buildJobID)
+	if err != nil || task == nil {
+		return nil, err
+	}
+	pos := &BuildQueuePosition{Task: task, Building: task.State == asynq.TaskStateActive}
+
+	for _, queue := range buildQueuesByPriority {
+		info, err := s.inspector.GetQueueInfo(queue)
+		if err != nil {
+			if errors.Is(err, asynq.ErrQueueNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to inspect queue %s: %w", queue, err)
+		}
+		pos.Running += info.Active
+		if pos.Building || pos.Position > 0 {
+			continue
+		}
+		if queue != task.Queue {
+			pos.Ahead += info.Pending
+			continue
+		}
+		// Retried and scheduled builds join the end of the queue when their time comes
+		index := info.Pending
+		if task.State == asynq.TaskStatePending {
+			if index, err = s.pendingIndex(queue, task.ID); err != nil {
+				return nil, err
+			}
+		}
+		pos.Ahead += index
+		pos.Position = pos.Ahead + 1
+	}
+
+	servers, err := s.inspector.Servers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workers: %w", err)
+	}
+	for _, server := range servers {
+		if _, ok := server.Queues[task.Queue]; ok {
+			pos.Workers += server.Concurrency
+		}
+	}
+	return pos, nil
+}
+
+// pendingIndex returns how many pending tasks of a queue are ahead of taskID
+func (s *TaskEnqueueService) pendingIndex(queue, taskID string) (int, error) {
+	index := 0
+	for page := 1; ; page++ {
+		infos, err := s.inspector.ListPendingTasks(queue, asynq.PageSize(100), asynq.Page(page))
+		if err != nil {
+			return 0, fmt.Errorf("failed to list pending tasks: %w", err)
+		}
+		for _, info := range infos {
+			if info.ID == taskID {
+				return index, nil
+			}
+			index++
+		}
+		if len(infos) < 100 {
+			return index, nil
+		}
+	}
+}
+
+// findBuildTaskIn looks for the build task of a build job in one build queue
+func (s *TaskEnqueueService) findBuildTaskIn(queue string, listers []func(string, ...asynq.ListOption) ([]*asynq.TaskInfo, error), buildJobID string) (*asynq.TaskInfo, error) {
+	for _, list := range listers {
+		for page := 1; ; page++ {
+			infos, err := list(queue, asynq.PageSize(100), asynq.Page(page))
+			if err != nil {
+				if errors.Is(err, asynq.ErrQueueNotFound) {
+					return nil, nil // Nothing has been enqueued yet
+				}
+				return nil, fmt.Errorf("failed to list build tasks: %w", err)
+			}
+			for _, info := range infos {
+				var payload struct {
+					BuildJobID string `json:"build_job_id"`
+				}
+				if err := json.Unmarshal(info.Payload, &payload); err == nil && payload.BuildJobID == buildJobID {
+					return info, nil
+				}
+			}
+			if len(infos) < 100 {
+				break
+			}
+		}
+	}
+	return nil, nil
+}
+
+// CancelBuildTask stops a build task found by FindBuildTask
+// Waiting tasks are deleted; a running task (or one picked up while deleting) has its context
+// cancelled on the build worker, which aborts the clone or docker build in progress
+func (s *TaskEnqueueService) CancelBuildTask(ctx context.Context, info *asynq.TaskInfo) (BuildCancellation, error) {
+	if info.State != asynq.TaskStateActive {
+		err := s.inspector.DeleteTask(info.Queue, info.ID)
+		if err == nil {
+			s.logger.Info("Removed queued build task", zap.String("task_id", info.ID))
+			return BuildCancellationDequeued, nil
+		}
+
+		// Deleting fails once a worker has picked the task up
+		current, lookupErr := s.inspector.GetTaskInfo(info.Queue, info.ID)
+		if lookupErr != nil || current.State != asynq.TaskStateActive {
+			return "", fmt.Errorf("failed to delete build task %s: %w", info.ID, err)
+		}
+	}
+
+	if err := s.inspector.CancelProcessing(info.ID); err != nil {
+		return "", fmt.Errorf("failed to cancel build task %s: %w", info.ID, err)
+	}
+	s.logger.Info("Signalled running build task to cancel", zap.String("task_id", info.ID))
+	return BuildCancellationSignalled, nil
+}
+
+// enqueueDeduplicated enqueues task under taskID, returning the existing task while it is still
+// queued or running. Finished and archived tasks keep their ID in Redis, so they are deleted to
+// make room for the new run
+func (s *TaskEnqueueService) enqueueDeduplicated(task *asynq.Task, queue, taskID string, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	opts = append(opts, asynq.Queue(queue), asynq.TaskID(taskID))
+
+	// Two attempts: a concurrent enqueue can claim the ID again right after a stale task is deleted
+	for attempt := 0; attempt < 2; attempt++ {
+		info, err := s.client.Enqueue(task, opts...)
+		if err == nil {
+			return info, nil
+		}
+		if !errors.Is(err, asynq.ErrTaskIDConflict) {
+			return nil, err
+		}
+
+		existing, err := s.inspector.GetTaskInfo(queue, taskID)
+		if err != nil {
+			if errors.Is(err, asynq.ErrTaskNotFound) {
+				continue // Finished between the conflict and the lookup
+			}
+			return nil, fmt.Errorf("failed to look up existing task %s: %w", taskID, err)
+		}
+
+		switch existing.State {
+		case asynq.TaskStatePending, asynq.TaskStateActive, asynq.TaskStateScheduled, asynq.TaskStateRetry, asynq.TaskStateAggregating:
+			s.logger.Info("Task already in flight, not enqueueing a duplicate",
+				zap.String("task_id", taskID),
+				zap.String("state", existing.State.String()),
+			)
+			return existing, nil
+		default:
+			if err := s.inspector.DeleteTask(queue, taskID); err != nil && !errors.Is(err, asynq.ErrTaskNotFound) {
+				return nil, fmt.Errorf("failed to delete finished task %s: %w", taskID, err)
+			}
+		}
+	}
+	return nil, fmt.Errorf("task %s: %w", taskID, asynq.ErrTaskIDConflict)
+}
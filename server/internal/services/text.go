@@ -0,0 +1,58 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// NormalizeText decodes a text file the way repo analysis expects it: UTF-8 without a byte order
+// mark and with "\n" line endings. Windows editors commonly save files with a BOM (Notepad,
+// PowerShell's Out-File writes UTF-16) and CRLF line endings, which otherwise leak "\r" into
+// parsed Procfile commands, Dockerfile instructions and port numbers
+func NormalizeText(content []byte) string {
+	switch {
+	case bytes.HasPrefix(content, utf8BOM):
+		content = content[len(utf8BOM):]
+	case bytes.HasPrefix(content, utf16LEBOM):
+		content = decodeUTF16(content[len(utf16LEBOM):], false)
+	case bytes.HasPrefix(content, utf16BEBOM):
+		content = decodeUTF16(content[len(utf16BEBOM):], true)
+	}
+
+	text := string(content)
+	if strings.Contains(text, "\r") {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+		text = strings.ReplaceAll(text, "\r", "\n") // Classic Mac line endings
+	}
+	return text
+}
+
+// readTextFile reads a repository file and normalizes its encoding and line endings
+func readTextFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return NormalizeText(content), nil
+}
+
+// decodeUTF16 converts UTF-16 text (without its BOM) to UTF-8. A trailing odd byte is dropped
+func decodeUTF16(content []byte, bigEndian bool) []byte {
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(content[2*i])<<8 | uint16(content[2*i+1])
+		} else {
+			units[i] = uint16(content[2*i+1])<<8 | uint16(content[2*i])
+		}
+	}
+	return []byte(string(utf16.Decode(units)))
+}
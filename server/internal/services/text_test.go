@@ -0,0 +1,78 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+// utf16Bytes encodes s as UTF-16 with a byte order mark, as Notepad and PowerShell save it
+func utf16Bytes(s string, bigEndian bool) []byte {
+	out := []byte{0xFF, 0xFE}
+	if bigEndian {
+		out = []byte{0xFE, 0xFF}
+	}
+	for _, unit := range utf16.Encode([]rune(s)) {
+		if bigEndian {
+			out = append(out, byte(unit>>8), byte(unit))
+		} else {
+			out = append(out, byte(unit), byte(unit>>8))
+		}
+	}
+	return out
+}
+
+var normalizeTextTests = []struct {
+	name    string
+	content []byte
+	want    string
+}{
+	{"plain", []byte("web: node server.js\n"), "web: node server.js\n"},
+	{"empty", nil, ""},
+	{"UTF-8 BOM", []byte("\xEF\xBB\xBFFROM node:20\n"), "FROM node:20\n"},
+	{"BOM only", []byte("\xEF\xBB\xBF"), ""},
+	{"CRLF", []byte("web: node server.js\r\nworker: node jobs.js\r\n"), "web: node server.js\nworker: node jobs.js\n"},
+	{"lone CR", []byte("FROM node:20\rEXPOSE 3000\r"), "FROM node:20\nEXPOSE 3000\n"},
+	{"mixed line endings", []byte("a\r\nb\rc\n"), "a\nb\nc\n"},
+	{"BOM and CRLF", []byte("\xEF\xBB\xBFPORT=8080\r\n"), "PORT=8080\n"},
+	{"BOM not at start", []byte("a\xEF\xBB\xBFb"), "a\xEF\xBB\xBFb"},
+	{"UTF-16LE", utf16Bytes("web: python app.py\r\n", false), "web: python app.py\n"},
+	{"UTF-16BE", utf16Bytes("web: python app.py\r\n", true), "web: python app.py\n"},
+	{"UTF-16LE non-ASCII", utf16Bytes("# café 🚀\n", false), "# café 🚀\n"},
+	{"UTF-16BE non-ASCII", utf16Bytes("# café 🚀\n", true), "# café 🚀\n"},
+	{"UTF-16LE trailing odd byte", append(utf16Bytes("ok", false), 'x'), "ok"},
+}
+
+func TestNormalizeText(t *testing.T) {
+	for _, tt := range normalizeTextTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeText(tt.content); got != tt.want {
+				t.Errorf("NormalizeText(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadTextFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range normalizeTextTests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "Procfile")
+			if err := os.WriteFile(path, tt.content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readTextFile(path)
+			if err != nil {
+				t.Fatalf("readTextFile: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("readTextFile = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := readTextFile(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("readTextFile of a missing file: err = %v, want not exist", err)
+	}
+}
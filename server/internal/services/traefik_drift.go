@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultAppPort is the port deploys expose when a container carries no port label
+const defaultAppPort = 8080
+
+// traefikRouter is the part of a Traefik API router that drift detection compares
+type traefikRouter struct {
+	Rule        string   `json:"rule"`
+	Service     string   `json:"service"`
+	Middlewares []string `json:"middlewares"`
+	Status      string   `json:"status"`
+	TLS         *struct {
+		CertResolver string `json:"certResolver"`
+	} `json:"tls"`
+}
+
+// TraefikLabelDrift compares a container's Traefik labels with the ones a deploy would generate for
+// the subdomain, verified custom domains, WAF and routing settings on record, and describes each difference
+// The port and health check path are taken from the container itself - they are not routing state
+func (s *DeploymentService) TraefikLabelDrift(containerLabels map[string]string, subdomain, appID string, customDomains []string, waf *WAFConfig, routing *RoutingConfig) []string {
+	serviceName := fmt.Sprintf("app-%s", appID)
+	port := defaultAppPort
+	if p, err := strconv.Atoi(containerLabels[fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port", serviceName)]); err == nil && p > 0 {
+		port = p
+	}
+	healthPath := containerLabels[fmt.Sprintf("traefik.http.services.%s.loadbalancer.healthcheck.path", serviceName)]
+	if healthPath == "" {
+		healthPath = "/"
+	}
+
+	expected := s.routing.Labels(AppRoute{
+		AppID:         appID,
+		Subdomain:     subdomain,
+		Port:          port,
+		HealthPath:    healthPath,
+		CustomDomains: customDomains,
+		WAF:           waf,
+		Routing:       routing,
+	})
+
+	var drift []string
+	for _, key := range sortedLabelKeys(expected) {
+		actual, ok := containerLabels[key]
+		switch {
+		case !ok:
+			drift = append(drift, fmt.Sprintf("missing label %s", key))
+		case actual != expected[key]:
+			drift = append(drift, fmt.Sprintf("label %s is %q, expected %q", key, actual, expected[key]))
+		}
+	}
+	for _, key := range sortedLabelKeys(containerLabels) {
+		if _, ok := expected[key]; !ok && strings.HasPrefix(key, "traefik.") {
+			drift = append(drift, fmt.Sprintf("unexpected label %s", key))
+		}
+	}
+	return drift
+}
+
+// TraefikRouterDrift checks that Traefik actually serves the routers the app's labels declare,
+// with the expected rule, TLS and middlewares. Returns nothing without a Traefik API
+func (s *DeploymentService) TraefikRouterDrift(ctx context.Context, subdomain, appID string, customDomains []string, waf *WAFConfig, routing *RoutingConfig) ([]string, error) {
+	if s.traefikAPIURL == "" {
+		return nil, nil
+	}
+
+	// Port and health path do not affect routers
+	expected := s.routing.Labels(AppRoute{
+		AppID:         appID,
+		Subdomain:     subdomain,
+		Port:          defaultAppPort,
+		HealthPath:    "/",
+		CustomDomains: customDomains,
+		WAF:           waf,
+		Routing:       routing,
+	})
+	routerNames := []string{fmt.Sprintf("app-%s", appID)}
+	for _, suffix := range []string{"-http", "-custom", "-custom-http"} {
+		name := fmt.Sprintf("app-%s%s", appID, suffix)
+		if _, ok := expected[fmt.Sprintf("traefik.http.routers.%s.rule", name)]; ok {
+			routerNames = append(routerNames, name)
+		}
+	}
+
+	var drift []string
+	for _, name := range routerNames {
+		router, err := s.getTraefikRouter(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if router == nil {
+			drift = append(drift, fmt.Sprintf("router %s not loaded by Traefik", name))
+			continue
+		}
+
+		prefix := fmt.Sprintf("traefik.http.routers.%s.", name)
+		if router.Status != "" && router.Status != "enabled" {
+			drift = append(drift, fmt.Sprintf("router %s is %s", name, router.Status))
+		}
+		if rule := expected[prefix+"rule"]; router.Rule != rule {
+			drift = append(drift, fmt.Sprintf("router %s rule is %q, expected %q", name, router.Rule, rule))
+		}
+		if expected[prefix+"tls"] == "true" && router.TLS == nil {
+			drift = append(drift, fmt.Sprintf("router %s has no TLS", name))
+		}
+		if middlewares := expected[prefix+"middlewares"]; middlewares != "" {
+			for _, middleware := range strings.Split(middlewares, ",") {
+				if !hasTraefikMiddleware(router.Middlewares, middleware) {
+					drift = append(drift, fmt.Sprintf("router %s is missing middleware %s", name, middleware))
+				}
+			}
+		}
+	}
+	return drift, nil
+}
+
+// getTraefikRouter fetches a Docker-provider router from the Traefik API, or nil if Traefik does not have it
+func (s *DeploymentService) getTraefikRouter(ctx context.Context, name string) (*traefikRouter, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/http/routers/%s@docker", s.traefikAPIURL, name), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Traefik API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("traefik API returned status %d for router %s", resp.StatusCode, name)
+	}
+
+	var router traefikRouter
+	if err := json.NewDecoder(resp.Body).Decode(&router); err != nil {
+		return nil, fmt.Errorf("failed to decode Traefik router %s: %w", name, err)
+	}
+	return &router, nil
+}
+
+// hasTraefikMiddleware reports whether a router uses the middleware, with or without a provider suffix
+func hasTraefikMiddleware(middlewares []string, name string) bool {
+	for _, m := range middlewares {
+		if m == name || strings.TrimSuffix(m, "@docker") == name {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,69 @@
+package services
+
+import "time"
+
+// TrafficBucketSize is the time span one row of app traffic covers
+const TrafficBucketSize = time.Minute
+
+// TrafficLatencyBoundsMs are the upper bounds of the latency histogram kept per traffic bucket; the
+// histogram has one more slot for requests slower than the last bound. Histograms of any number of
+// buckets add up, so percentiles over a whole window are computed from their sum
+var TrafficLatencyBoundsMs = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// NewLatencyHistogram returns an empty latency histogram
+func NewLatencyHistogram() []int64 {
+	return make([]int64, len(TrafficLatencyBoundsMs)+1)
+}
+
+// ObserveLatency counts a request that took d in a latency histogram
+func ObserveLatency(histogram []int64, d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	for i, bound := range TrafficLatencyBoundsMs {
+		if ms <= bound {
+			histogram[i]++
+			return
+		}
+	}
+	histogram[len(TrafficLatencyBoundsMs)]++
+}
+
+// AddLatencyHistograms adds histogram to sum
+func AddLatencyHistograms(sum, histogram []int64) {
+	for i := range sum {
+		if i < len(histogram) {
+			sum[i] += histogram[i]
+		}
+	}
+}
+
+// LatencyPercentile estimates the p-th percentile (0-1) of a latency histogram in milliseconds,
+// interpolating within the slot it falls in. Returns 0 for an empty histogram and the last bound
+// when it falls among the slowest requests
+func LatencyPercentile(histogram []int64, p float64) float64 {
+	var total int64
+	for _, count := range histogram {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := p * float64(total)
+	var seen int64
+	for i, count := range histogram {
+		if count == 0 || float64(seen+count) < rank {
+			seen += count
+			continue
+		}
+		if i >= len(TrafficLatencyBoundsMs) {
+			break
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = TrafficLatencyBoundsMs[i-1]
+		}
+		upper := TrafficLatencyBoundsMs[i]
+		return lower + (upper-lower)*(rank-float64(seen))/float64(count)
+	}
+	return TrafficLatencyBoundsMs[len(TrafficLatencyBoundsMs)-1]
+}
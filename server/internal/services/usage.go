@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Metered usage metrics recorded in usage_records
+const (
+	UsageMetricBuildSeconds = "build_seconds"
+	UsageMetricEgressBytes  = "egress_bytes"
+)
+
+// UsageRepository interface for usage metering data access
+type UsageRepository interface {
+	GetAllocatedResources(ctx context.Context, userID string) (*AllocatedResources, error)
+	SumUsage(ctx context.Context, userID, metric string, since, until time.Time) (int64, error)
+	GetUsageByApp(ctx context.Context, userID, metric string, since, until time.Time) ([]AppUsage, error)
+}
+
+// AllocatedResources is what a user's enabled apps have reserved
+type AllocatedResources struct {
+	AppCount int
+	RAMMB    int
+	DiskGB   int
+}
+
+// AppUsage is the total of one metric for one app over a period
+type AppUsage struct {
+	AppID    string // Empty when the app has since been deleted
+	AppName  string
+	Quantity int64
+	Records  int
+}
+
+// UsageQuota is one usage line: how much is used against the plan limit
+type UsageQuota struct {
+	Used    float64 `json:"used"`
+	Limit   float64 `json:"limit"`   // 0 = unlimited or not metered on this plan
+	Percent float64 `json:"percent"` // Used as a percentage of Limit (0 when unlimited)
+	Unit    string  `json:"unit"`
+}
+
+// UsageSummary aggregates a user's quota usage for the current period
+type UsageSummary struct {
+	Plan         string     `json:"plan"`
+	PeriodStart  time.Time  `json:"period_start"`
+	PeriodEnd    time.Time  `json:"period_end"`
+	Apps         UsageQuota `json:"apps"`
+	RAM          UsageQuota `json:"ram"`
+	Disk         UsageQuota `json:"disk"`
+	BuildMinutes UsageQuota `json:"build_minutes"`
+	Egress       UsageQuota `json:"egress"`
+	GeneratedAt  time.Time  `json:"generated_at"`
+}
+
+// AppBuildMinutes is one app's share of a user's build minutes
+type AppBuildMinutes struct {
+	AppID   string  `json:"app_id,omitempty"`
+	AppName string  `json:"app_name"`
+	Minutes float64 `json:"minutes"`
+	Builds  int     `json:"builds"`
+}
+
+// BuildMinutesUsage details build minutes consumed in the current period
+type BuildMinutesUsage struct {
+	PeriodStart      time.Time         `json:"period_start"`
+	PeriodEnd        time.Time         `json:"period_end"`
+	UsedMinutes      float64           `json:"used_minutes"`
+	LimitMinutes     int               `json:"limit_minutes"`     // 0 = unlimited
+	RemainingMinutes float64           `json:"remaining_minutes"` // 0 when unlimited or exhausted
+	Exhausted        bool              `json:"exhausted"`
+	Apps             []AppBuildMinutes `json:"apps"`
+}
+
+// usageCacheEntry is a cached summary with its expiry
+type usageCacheEntry struct {
+	summary   *UsageSummary
+	expiresAt time.Time
+}
+
+// UsageService computes usage summaries from the metering tables
+// Summaries are cached per user for a short TTL - usage dashboards poll frequently
+type UsageService struct {
+	logger          *zap.Logger
+	usageRepo       UsageRepository
+	planEnforcement *PlanEnforcementService
+	cacheTTL        time.Duration
+
+	cache   map[string]usageCacheEntry // userID -> cached summary
+	cacheMu sync.RWMutex
+}
+
+// NewUsageService creates a new usage service
+func NewUsageService(logger *zap.Logger, usageRepo UsageRepository, planEnforcement *PlanEnforcementService, cacheTTL time.Duration) *UsageService {
+	return &UsageService{
+		logger:          logger,
+		usageRepo:       usageRepo,
+		planEnforcement: planEnforcement,
+		cacheTTL:        cacheTTL,
+		cache:           make(map[string]usageCacheEntry),
+	}
+}
+
+// CurrentUsagePeriod returns the metering period containing now (calendar month, UTC)
+func CurrentUsagePeriod(now time.Time) (start, end time.Time) {
+	now = now.UTC()
+	start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end = start.AddDate(0, 1, 0)
+	return start, end
+}
+
+// GetUsageSummary returns the user's usage for the current period, served from cache when fresh
+func (s *UsageService) GetUsageSummary(ctx context.Context, userID string) (*UsageSummary, error) {
+	s.cacheMu.RLock()
+	entry, ok := s.cache[userID]
+	s.cacheMu.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.summary, nil
+	}
+
+	summary, err := s.computeUsageSummary(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cacheMu.Lock()
+	s.cache[userID] = usageCacheEntry{summary: summary, expiresAt: time.Now().Add(s.cacheTTL)}
+	s.cacheMu.Unlock()
+
+	return summary, nil
+}
+
+// InvalidateUser drops a user's cached summary (call after recording usage or changing apps)
+func (s *UsageService) InvalidateUser(userID string) {
+	s.cacheMu.Lock()
+	delete(s.cache, userID)
+	s.cacheMu.Unlock()
+}
+
+// computeUsageSummary aggregates allocations, metered usage and plan limits
+func (s *UsageService) computeUsageSummary(ctx context.Context, userID string) (*UsageSummary, error) {
+	limits, err := s.planEnforcement.GetPlanLimits(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan limits: %w", err)
+	}
+
+	allocated, err := s.usageRepo.GetAllocatedResources(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get allocated resources: %w", err)
+	}
+
+	now := time.Now()
+	periodStart, periodEnd := CurrentUsagePeriod(now)
+
+	buildSeconds, err := s.usageRepo.SumUsage(ctx, userID, UsageMetricBuildSeconds, periodStart, periodEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum build usage: %w", err)
+	}
+
+	egressBytes, err := s.usageRepo.SumUsage(ctx, userID, UsageMetricEgressBytes, periodStart, periodEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum egress usage: %w", err)
+	}
+
+	summary := &UsageSummary{
+		Plan:         limits.PlanName,
+		PeriodStart:  periodStart,
+		PeriodEnd:    periodEnd,
+		Apps:         newUsageQuota(float64(allocated.AppCount), float64(limits.MaxApps), "apps"),
+		RAM:          newUsageQuota(float64(allocated.RAMMB), float64(limits.MaxRAMMB), "MB"),
+		Disk:         newUsageQuota(float64(allocated.DiskGB), float64(limits.MaxDiskMB)/1024, "GB"),
+		BuildMinutes: newUsageQuota(float64(buildSeconds)/60, float64(limits.BuildMinutes), "minutes"),
+		Egress:       newUsageQuota(float64(egressBytes)/(1024*1024*1024), 0, "GB"),
+		GeneratedAt:  now,
+	}
+
+	s.logger.Debug("Computed usage summary",
+		zap.String("user_id", userID),
+		zap.Int("app_count", allocated.AppCount),
+		zap.Int("ram_mb", allocated.RAMMB),
+		zap.Int64("build_seconds", buildSeconds),
+		zap.Int64("egress_bytes", egressBytes),
+	)
+
+	return summary, nil
+}
+
+// GetBuildMinutesUsage returns build minutes used this period against the plan allowance, broken down by app
+func (s *UsageService) GetBuildMinutesUsage(ctx context.Context, userID string) (*BuildMinutesUsage, error) {
+	limits, err := s.planEnforcement.GetPlanLimits(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan limits: %w", err)
+	}
+
+	periodStart, periodEnd := CurrentUsagePeriod(time.Now())
+
+	byApp, err := s.usageRepo.GetUsageByApp(ctx, userID, UsageMetricBuildSeconds, periodStart, periodEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get build usage by app: %w", err)
+	}
+
+	usage := &BuildMinutesUsage{
+		PeriodStart:  periodStart,
+		PeriodEnd:    periodEnd,
+		LimitMinutes: limits.BuildMinutes,
+		Apps:         make([]AppBuildMinutes, 0, len(byApp)),
+	}
+
+	var totalSeconds int64
+	for _, app := range byApp {
+		totalSeconds += app.Quantity
+		usage.Apps = append(usage.Apps, AppBuildMinutes{
+			AppID:   app.AppID,
+			AppName: app.AppName,
+			Minutes: roundUsage(float64(app.Quantity) / 60),
+			Builds:  app.Records,
+		})
+	}
+
+	usage.UsedMinutes = roundUsage(float64(totalSeconds) / 60)
+	if limits.BuildMinutes > 0 {
+		limitSeconds := int64(limits.BuildMinutes) * 60
+		usage.Exhausted = totalSeconds >= limitSeconds
+		if !usage.Exhausted {
+			usage.RemainingMinutes = roundUsage(float64(limitSeconds-totalSeconds) / 60)
+		}
+	}
+
+	return usage, nil
+}
+
+// newUsageQuota builds a quota line, computing the percentage used
+func newUsageQuota(used, limit float64, unit string) UsageQuota {
+	quota := UsageQuota{
+		Used:  roundUsage(used),
+		Limit: roundUsage(limit),
+		Unit:  unit,
+	}
+	if limit > 0 {
+		quota.Percent = roundUsage(used / limit * 100)
+	}
+	return quota
+}
+
+// roundUsage rounds to two decimal places for display
+func roundUsage(v float64) float64 {
+	return float64(int64(v*100+0.5)) / 100
+}
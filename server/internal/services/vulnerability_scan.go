@@ -0,0 +1,223 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Image scan statuses (image_scans.status)
+const (
+	ImageScanCompleted = "completed"
+	ImageScanFailed    = "failed" // The scanner could not run or its report could not be read; no findings
+)
+
+// Vulnerability severities, as reported by Trivy
+const (
+	SeverityCritical = "CRITICAL"
+	SeverityHigh     = "HIGH"
+	SeverityMedium   = "MEDIUM"
+	SeverityLow      = "LOW"
+	SeverityUnknown  = "UNKNOWN"
+)
+
+// defaultScanTimeout applies when the scanner is created without a timeout
+const defaultScanTimeout = 10 * time.Minute
+
+// Vulnerability is one CVE (or other advisory) found in a package of an image
+type Vulnerability struct {
+	ID               string `json:"id"` // e.g. CVE-2024-3094
+	Package          string `json:"package"`
+	InstalledVersion string `json:"installed_version"`
+	FixedVersion     string `json:"fixed_version,omitempty"` // Empty when no fix is available yet
+	Severity         string `json:"severity"`
+	Title            string `json:"title,omitempty"`
+	URL              string `json:"url,omitempty"`
+	Target           string `json:"target,omitempty"` // OS packages or the lock file the package came from
+}
+
+// VulnerabilityCounts is the number of findings of a scan per severity
+type VulnerabilityCounts struct {
+	Critical int `json:"critical"`
+	High     int `json:"high"`
+	Medium   int `json:"medium"`
+	Low      int `json:"low"`
+	Unknown  int `json:"unknown"`
+}
+
+// ImageScan is the vulnerability scan of the image a build produced
+type ImageScan struct {
+	BuildJobID      string
+	AppID           string
+	ImageName       string // "name:tag"
+	Scanner         string
+	Status          string // ImageScanCompleted or ImageScanFailed
+	Counts          VulnerabilityCounts
+	Vulnerabilities []Vulnerability // Most severe first
+	Error           string          // Why a failed scan failed
+	ScannedAt       time.Time
+}
+
+// VulnerabilityScanner scans built images for known vulnerabilities with the Trivy CLI
+// Trivy reads the image from the same Docker daemon the build used (DOCKER_HOST) and keeps its
+// vulnerability database in its cache directory, refreshing it as needed
+type VulnerabilityScanner struct {
+	binary  string
+	timeout time.Duration
+	logger  *zap.Logger
+}
+
+// NewVulnerabilityScanner creates a scanner running binary (looked up in PATH when it has no slash)
+func NewVulnerabilityScanner(binary string, timeout time.Duration, logger *zap.Logger) *VulnerabilityScanner {
+	if binary == "" {
+		binary = "trivy"
+	}
+	if timeout <= 0 {
+		timeout = defaultScanTimeout
+	}
+	return &VulnerabilityScanner{
+		binary:  binary,
+		timeout: timeout,
+		logger:  logger,
+	}
+}
+
+// Available reports whether the scanner CLI can be run on this worker
+func (s *VulnerabilityScanner) Available() bool {
+	_, err := exec.LookPath(s.binary)
+	return err == nil
+}
+
+// Name is the scanner recorded on scans
+func (s *VulnerabilityScanner) Name() string {
+	return "trivy"
+}
+
+// trivyReport is the part of Trivy's JSON report (trivy image --format json) scans are read from
+type trivyReport struct {
+	Results []struct {
+		Target          string `json:"Target"`
+		Vulnerabilities []struct {
+			VulnerabilityID  string `json:"VulnerabilityID"`
+			PkgName          string `json:"PkgName"`
+			InstalledVersion string `json:"InstalledVersion"`
+			FixedVersion     string `json:"FixedVersion"`
+			Severity         string `json:"Severity"`
+			Title            string `json:"Title"`
+			PrimaryURL       string `json:"PrimaryURL"`
+		} `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+// ScanImage scans imageRef ("name:tag") and returns its vulnerabilities, most severe first
+func (s *VulnerabilityScanner) ScanImage(ctx context.Context, imageRef string) ([]Vulnerability, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.binary, "image",
+		"--quiet",
+		"--format", "json",
+		"--scanners", "vuln",
+		"--timeout", s.timeout.String(),
+		imageRef,
+	)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	startedAt := time.Now()
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("trivy timed out after %s", s.timeout)
+		}
+		return nil, fmt.Errorf("trivy failed: %w: %s", err, lastLine(stderr.String()))
+	}
+
+	var report trivyReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		return nil, fmt.Errorf("failed to parse trivy report: %w", err)
+	}
+
+	var vulnerabilities []Vulnerability
+	for _, result := range report.Results {
+		for _, v := range result.Vulnerabilities {
+			vulnerabilities = append(vulnerabilities, Vulnerability{
+				ID:               v.VulnerabilityID,
+				Package:          v.PkgName,
+				InstalledVersion: v.InstalledVersion,
+				FixedVersion:     v.FixedVersion,
+				Severity:         normalizeSeverity(v.Severity),
+				Title:            v.Title,
+				URL:              v.PrimaryURL,
+				Target:           result.Target,
+			})
+		}
+	}
+	sort.SliceStable(vulnerabilities, func(i, j int) bool {
+		return severityRank(vulnerabilities[i].Severity) > severityRank(vulnerabilities[j].Severity)
+	})
+
+	s.logger.Info("Scanned image for vulnerabilities",
+		zap.String("image", imageRef),
+		zap.Int("vulnerabilities", len(vulnerabilities)),
+		zap.Duration("duration", time.Since(startedAt)),
+	)
+	return vulnerabilities, nil
+}
+
+// CountVulnerabilities counts vulnerabilities per severity
+func CountVulnerabilities(vulnerabilities []Vulnerability) VulnerabilityCounts {
+	var counts VulnerabilityCounts
+	for _, v := range vulnerabilities {
+		switch v.Severity {
+		case SeverityCritical:
+			counts.Critical++
+		case SeverityHigh:
+			counts.High++
+		case SeverityMedium:
+			counts.Medium++
+		case SeverityLow:
+			counts.Low++
+		default:
+			counts.Unknown++
+		}
+	}
+	return counts
+}
+
+// normalizeSeverity maps the severities scanners report onto the Severity* constants
+func normalizeSeverity(severity string) string {
+	switch severity = strings.ToUpper(strings.TrimSpace(severity)); severity {
+	case SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow:
+		return severity
+	}
+	return SeverityUnknown
+}
+
+// severityRank orders severities from unknown (0) to critical (4)
+func severityRank(severity string) int {
+	switch severity {
+	case SeverityCritical:
+		return 4
+	case SeverityHigh:
+		return 3
+	case SeverityMedium:
+		return 2
+	case SeverityLow:
+		return 1
+	}
+	return 0
+}
+
+// lastLine returns the last non-empty line of a command's output, which usually says why it failed
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/google/uuid"
+)
+
+// WAF modes
+const (
+	WAFModeMonitor = "monitor" // Matches are logged, requests pass (SecRuleEngine DetectionOnly)
+	WAFModeBlock   = "block"   // Requests over the anomaly threshold are rejected with 403
+)
+
+// wafPluginName is the Traefik plugin the WAF middleware uses (Coraza compiled to http-wasm, see
+// --experimental.plugins.coraza in docker-compose.yml). It ships the OWASP Core Rule Set
+const wafPluginName = "coraza"
+
+// WAFConfig is an app's WAF settings, applied as a Traefik middleware on its routers
+type WAFConfig struct {
+	Preset string
+	Mode   string
+}
+
+// WAFPreset is a subset of the OWASP Core Rule Set (paranoia level 1, anomaly scoring)
+type WAFPreset struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	RuleFiles   []string `json:"rule_files"`
+}
+
+// wafPresets are the rule sets apps can opt into, from the least to the most likely to need tuning
+var wafPresets = map[string]WAFPreset{
+	"scanners": {
+		Name:        "scanners",
+		Description: "Rejects known vulnerability scanners and malformed or smuggled requests",
+		RuleFiles: []string{
+			"REQUEST-913-SCANNER-DETECTION.conf",
+			"REQUEST-920-PROTOCOL-ENFORCEMENT.conf",
+			"REQUEST-921-PROTOCOL-ATTACK.conf",
+		},
+	},
+	"common-exploits": {
+		Name:        "common-exploits",
+		Description: "Scanners plus path traversal, remote file inclusion, shell command and PHP injection",
+		RuleFiles: []string{
+			"REQUEST-913-SCANNER-DETECTION.conf",
+			"REQUEST-920-PROTOCOL-ENFORCEMENT.conf",
+			"REQUEST-921-PROTOCOL-ATTACK.conf",
+			"REQUEST-930-APPLICATION-ATTACK-LFI.conf",
+			"REQUEST-931-APPLICATION-ATTACK-RFI.conf",
+			"REQUEST-932-APPLICATION-ATTACK-RCE.conf",
+			"REQUEST-933-APPLICATION-ATTACK-PHP.conf",
+		},
+	},
+	"owasp-core": {
+		Name:        "owasp-core",
+		Description: "Common exploits plus SQL injection and cross-site scripting - start in monitor mode to check for false positives",
+		RuleFiles: []string{
+			"REQUEST-911-METHOD-ENFORCEMENT.conf",
+			"REQUEST-913-SCANNER-DETECTION.conf",
+			"REQUEST-920-PROTOCOL-ENFORCEMENT.conf",
+			"REQUEST-921-PROTOCOL-ATTACK.conf",
+			"REQUEST-930-APPLICATION-ATTACK-LFI.conf",
+			"REQUEST-931-APPLICATION-ATTACK-RFI.conf",
+			"REQUEST-932-APPLICATION-ATTACK-RCE.conf",
+			"REQUEST-933-APPLICATION-ATTACK-PHP.conf",
+			"REQUEST-941-APPLICATION-ATTACK-XSS.conf",
+			"REQUEST-942-APPLICATION-ATTACK-SQLI.conf",
+		},
+	},
+}
+
+// WAFPresets returns the available presets sorted by name
+func WAFPresets() []WAFPreset {
+	presets := make([]WAFPreset, 0, len(wafPresets))
+	for _, preset := range wafPresets {
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	return presets
+}
+
+// ValidateWAFConfig checks that the preset exists and the mode is known
+func ValidateWAFConfig(cfg WAFConfig) error {
+	if _, ok := wafPresets[cfg.Preset]; !ok {
+		names := make([]string, 0, len(wafPresets))
+		for _, preset := range WAFPresets() {
+			names = append(names, preset.Name)
+		}
+		return fmt.Errorf("unknown WAF preset %q (available: %s)", cfg.Preset, strings.Join(names, ", "))
+	}
+	if cfg.Mode != WAFModeMonitor && cfg.Mode != WAFModeBlock {
+		return fmt.Errorf("invalid WAF mode %q: must be %q or %q", cfg.Mode, WAFModeMonitor, WAFModeBlock)
+	}
+	return nil
+}
+
+// WAFMiddlewareName is the name of an app's WAF middleware; hits logged by Traefik carry it
+func WAFMiddlewareName(appID string) string {
+	return fmt.Sprintf("app-%s-waf", appID)
+}
+
+// wafDirectives builds the Coraza directives for a preset: the CRS setup and initialization, the
+// preset's rule files, and the anomaly score evaluation that blocks in block mode
+func wafDirectives(cfg WAFConfig) []string {
+	engine := "DetectionOnly"
+	if cfg.Mode == WAFModeBlock {
+		engine = "On"
+	}
+
+	directives := []string{
+		"SecRuleEngine " + engine,
+		"SecRequestBodyAccess On",
+		"Include @crs-setup.conf.example",
+		"Include @owasp_crs/REQUEST-901-INITIALIZATION.conf",
+	}
+	for _, file := range wafPresets[cfg.Preset].RuleFiles {
+		directives = append(directives, "Include @owasp_crs/"+file)
+	}
+	return append(directives, "Include @owasp_crs/REQUEST-949-BLOCKING-EVALUATION.conf")
+}
+
+// wafLabels returns the Traefik labels declaring an app's WAF middleware
+func wafLabels(appID string, cfg WAFConfig) map[string]string {
+	labels := make(map[string]string)
+	for i, directive := range wafDirectives(cfg) {
+		labels[fmt.Sprintf("traefik.http.middlewares.%s.plugin.%s.directives[%d]", WAFMiddlewareName(appID), wafPluginName, i)] = directive
+	}
+	return labels
+}
+
+// WAFHit is a rule match Coraza logged for an app
+type WAFHit struct {
+	RuleID   string
+	Message  string
+	Severity string
+	Action   string // detected | blocked
+	ClientIP string
+	URI      string
+}
+
+// corazaLogField matches the [name "value"] fields of a Coraza error log line
+var corazaLogField = regexp.MustCompile(`\[(client|id|msg|severity|uri) "((?:[^"\\]|\\.)*)"\]`)
+
+// ParseWAFLogMessage parses a Coraza rule match out of a log message. Returns false for other messages
+// and for matches without a rule ID (Coraza's own notices)
+func ParseWAFLogMessage(message string) (*WAFHit, bool) {
+	idx := strings.Index(message, "Coraza: ")
+	if idx < 0 {
+		return nil, false
+	}
+
+	hit := &WAFHit{Action: "detected"}
+	if strings.HasPrefix(message[idx:], "Coraza: Access denied") {
+		hit.Action = "blocked"
+	}
+	for _, field := range corazaLogField.FindAllStringSubmatch(message, -1) {
+		value := strings.ReplaceAll(field[2], `\"`, `"`)
+		switch field[1] {
+		case "client":
+			hit.ClientIP = value
+		case "id":
+			hit.RuleID = value
+		case "msg":
+			hit.Message = value
+		case "severity":
+			hit.Severity = value
+		case "uri":
+			hit.URI = value
+		}
+	}
+	if hit.RuleID == "" {
+		return nil, false
+	}
+	return hit, true
+}
+
+// traefikLogLine is the part of a Traefik JSON log line (--log.format=json) the WAF hit collector needs
+type traefikLogLine struct {
+	MiddlewareName string `json:"middlewareName"` // "app-<app id>-waf@docker" for app WAF middlewares
+	Message        string `json:"message"`
+	Msg            string `json:"msg"`
+}
+
+// FollowWAFHits follows the Traefik container's logs from since and calls onHit for every WAF rule
+// match logged by an app's WAF middleware, with the app ID and the time Docker recorded the line.
+// Returns when the log stream ends (Traefik restarted) or ctx is done
+func (s *DeploymentService) FollowWAFHits(ctx context.Context, traefikContainer string, since time.Time, onHit func(appID string, hit *WAFHit, at time.Time)) error {
+	reader, err := s.client.ContainerLogs(ctx, traefikContainer, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Timestamps: true,
+		Since:      strconv.FormatInt(since.Unix(), 10),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to follow Traefik logs: %w", err)
+	}
+	defer reader.Close()
+
+	// Traefik runs without a TTY, so stdout and stderr arrive multiplexed
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(pipeWriter, pipeWriter, reader)
+		pipeWriter.CloseWithError(err)
+	}()
+	defer pipeReader.Close()
+
+	scanner := bufio.NewScanner(pipeReader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		stamp, line, ok := strings.Cut(scanner.Text(), " ")
+		if !ok || !strings.Contains(line, "Coraza") {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339Nano, stamp)
+		if err != nil {
+			at = time.Now()
+		}
+
+		var entry traefikLogLine
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			continue
+		}
+		appID, ok := appIDFromWAFMiddleware(entry.MiddlewareName)
+		if !ok {
+			continue
+		}
+		message := entry.Message
+		if message == "" {
+			message = entry.Msg
+		}
+		if hit, ok := ParseWAFLogMessage(message); ok {
+			onHit(appID, hit, at.UTC())
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to read Traefik logs: %w", err)
+	}
+	return nil
+}
+
+// appIDFromWAFMiddleware extracts the app ID from a WAF middleware name (see WAFMiddlewareName)
+func appIDFromWAFMiddleware(middlewareName string) (string, bool) {
+	name, _, _ := strings.Cut(middlewareName, "@")
+	appID, ok := strings.CutPrefix(name, "app-")
+	if !ok {
+		return "", false
+	}
+	appID, ok = strings.CutSuffix(appID, "-waf")
+	if !ok {
+		return "", false
+	}
+	if _, err := uuid.Parse(appID); err != nil {
+		return "", false
+	}
+	return appID, true
+}
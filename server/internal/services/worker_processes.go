@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"go.uber.org/zap"
+)
+
+// Worker containers carry their own labels instead of app.id, so routing, health checks, sleep and
+// the web container's replacement never see them
+const (
+	workerAppLabel        = "stackyn.worker.app_id"
+	workerProcessLabel    = "stackyn.worker.process"
+	workerDeploymentLabel = "stackyn.worker.deployment_id"
+)
+
+// WorkerOptions describes the background processes started next to a deployment's web container
+type WorkerOptions struct {
+	AppID        string
+	DeploymentID string
+	ImageRef     string // Full image reference ("name:tag") the web container runs
+	Processes    []ProcessType
+	EnvVars      map[string]string
+	Limits       ResourceLimits // Per worker container
+	Isolation    IsolationLevel // Same as the web container
+}
+
+// DeployWorkers starts one container per process from the deployment's image and then removes the
+// app's workers from earlier deployments. Workers get the app's env vars and limits but no PORT,
+// Traefik labels or health check - they serve no traffic. Crashed workers are restarted by Docker.
+// With no processes, the app's workers are only removed. Returns the started container IDs; on error
+// the containers started so far are removed and the previous workers keep running
+func (s *DeploymentService) DeployWorkers(ctx context.Context, opts WorkerOptions) ([]string, error) {
+	if len(opts.Processes) == 0 {
+		_, err := s.StopWorkers(ctx, opts.AppID, "")
+		return nil, err
+	}
+
+	if err := s.ensureNetworkExists(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ensure network exists: %w", err)
+	}
+	if err := s.pullImage(ctx, opts.ImageRef); err != nil {
+		return nil, fmt.Errorf("failed to pull image: %w", err)
+	}
+
+	// A retried deploy task finds the workers of its earlier attempt under the same names
+	existing, err := s.findWorkerContainers(ctx, opts.AppID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range existing {
+		if c.Labels[workerDeploymentLabel] == opts.DeploymentID {
+			s.removeWorker(c.ID, opts.AppID)
+		}
+	}
+
+	envVars := make([]string, 0, len(opts.EnvVars))
+	for k, v := range opts.EnvVars {
+		envVars = append(envVars, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	started := make([]string, 0, len(opts.Processes))
+	for _, process := range opts.Processes {
+		containerID, err := s.startWorker(ctx, opts, process, envVars)
+		if err != nil {
+			for _, id := range started {
+				s.removeWorker(id, opts.AppID)
+			}
+			return nil, fmt.Errorf("failed to start %s process: %w", process.Name, err)
+		}
+		started = append(started, containerID)
+	}
+
+	if _, err := s.StopWorkers(ctx, opts.AppID, opts.DeploymentID); err != nil {
+		s.logger.Warn("Failed to remove workers of previous deployments",
+			zap.Error(err),
+			zap.String("app_id", opts.AppID),
+		)
+	}
+	return started, nil
+}
+
+// startWorker creates and starts the container of one background process
+func (s *DeploymentService) startWorker(ctx context.Context, opts WorkerOptions, process ProcessType, envVars []string) (string, error) {
+	containerConfig := &container.Config{
+		Image:      opts.ImageRef,
+		Env:        envVars,
+		Entrypoint: []string{"/bin/sh", "-c"},
+		Cmd:        []string{process.Command},
+		Labels: map[string]string{
+			workerAppLabel:        opts.AppID,
+			workerProcessLabel:    process.Name,
+			workerDeploymentLabel: opts.DeploymentID,
+		},
+	}
+	hostConfig := &container.HostConfig{
+		Resources: container.Resources{
+			Memory:     opts.Limits.MemoryMB * 1024 * 1024,
+			NanoCPUs:   int64(opts.Limits.CPU * 1e9),
+			MemorySwap: opts.Limits.MemoryMB * 1024 * 1024,
+		},
+		RestartPolicy: container.RestartPolicy{
+			Name:              container.RestartPolicyOnFailure,
+			MaximumRetryCount: onFailureRestartRetries,
+		},
+	}
+	s.applyIsolation(hostConfig, opts.Isolation)
+	networkConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			s.networkName: {},
+		},
+	}
+
+	containerName := fmt.Sprintf("%s-%s", s.generateContainerName(opts.AppID, opts.DeploymentID), process.Name)
+	createResp, err := s.client.ContainerCreate(ctx, containerConfig, hostConfig, networkConfig, nil, containerName)
+	if err != nil {
+		return "", fmt.Errorf("failed to create container: %w", err)
+	}
+
+	startCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := s.client.ContainerStart(startCtx, createResp.ID, container.StartOptions{}); err != nil {
+		s.removeWorker(createResp.ID, opts.AppID)
+		return "", fmt.Errorf("failed to start container: %w", err)
+	}
+
+	s.logger.Info("Worker container started",
+		zap.String("app_id", opts.AppID),
+		zap.String("deployment_id", opts.DeploymentID),
+		zap.String("process", process.Name),
+		zap.String("container_id", createResp.ID),
+	)
+
+	// Worker output shows up in the app's runtime logs next to the web container's
+	if s.logPersistence != nil {
+		go s.streamAndPersistRuntimeLogs(context.Background(), createResp.ID, opts.AppID, opts.DeploymentID)
+	}
+	return createResp.ID, nil
+}
+
+// StopWorkers removes an app's worker containers except those of keepDeploymentID ("" removes all)
+// Returns how many were removed
+func (s *DeploymentService) StopWorkers(ctx context.Context, appID, keepDeploymentID string) (int, error) {
+	containers, err := s.findWorkerContainers(ctx, appID)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, c := range containers {
+		if keepDeploymentID != "" && c.Labels[workerDeploymentLabel] == keepDeploymentID {
+			continue
+		}
+		if s.removeWorker(c.ID, appID) {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// removeWorker stops a worker with a grace period so in-flight jobs can finish, then removes it
+// Runs on its own context so cleanup after a cancelled deploy still happens
+func (s *DeploymentService) removeWorker(containerID, appID string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 45*time.Second)
+	defer cancel()
+
+	timeout := 30
+	if err := s.client.ContainerStop(ctx, containerID, container.StopOptions{Timeout: &timeout}); err != nil {
+		s.logger.Warn("Failed to stop worker container", zap.Error(err), zap.String("container_id", containerID), zap.String("app_id", appID))
+	}
+	if err := s.client.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true}); err != nil {
+		s.logger.Warn("Failed to remove worker container", zap.Error(err), zap.String("container_id", containerID), zap.String("app_id", appID))
+		return false
+	}
+
+	s.logger.Info("Removed worker container", zap.String("container_id", containerID), zap.String("app_id", appID))
+	return true
+}
+
+// findWorkerContainers lists an app's worker containers, stopped ones included
+func (s *DeploymentService) findWorkerContainers(ctx context.Context, appID string) ([]types.Container, error) {
+	filter := filters.NewArgs()
+	filter.Add("label", fmt.Sprintf("%s=%s", workerAppLabel, appID))
+
+	containers, err := s.client.ContainerList(ctx, container.ListOptions{
+		Filters: filter,
+		All:     true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worker containers: %w", err)
+	}
+	return containers, nil
+}
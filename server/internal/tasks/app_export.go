@@ -0,0 +1,147 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// AppExportRepository tracks export bundles and deletes apps that were exported before deletion
+type AppExportRepository interface {
+	StartAppExport(ctx context.Context, exportID string) (*services.AppExportManifest, error)
+	FinishAppExport(ctx context.Context, exportID, status string, sizeBytes int64, errorMsg string) error
+	DeleteExportedApp(ctx context.Context, appID, userID string) error
+}
+
+// SetAppExportRepo enables app exports on this worker
+func (h *TaskHandler) SetAppExportRepo(appExportRepo AppExportRepository) {
+	h.appExportRepo = appExportRepo
+}
+
+// HandleAppExportTask writes an app's export bundle and, when requested, deletes the app afterwards
+// The app is only deleted once its bundle has been written, so a failed export never loses data
+func (h *TaskHandler) HandleAppExportTask(ctx context.Context, t *asynq.Task) error {
+	var payload AppExportTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal app export task payload: %w", err)
+	}
+	if h.appExportRepo == nil {
+		return fmt.Errorf("app export repository not configured")
+	}
+
+	h.logger.Info("Processing app export task",
+		zap.String("app_id", payload.AppID),
+		zap.String("export_id", payload.ExportID),
+		zap.Bool("delete_app", payload.DeleteApp),
+	)
+
+	manifest, err := h.appExportRepo.StartAppExport(ctx, payload.ExportID)
+	if err != nil {
+		return fmt.Errorf("failed to mark app export as running: %w", err)
+	}
+
+	size, err := h.writeAppExport(ctx, payload.ExportID, manifest)
+	if err != nil {
+		h.logger.Error("App export failed",
+			zap.Error(err),
+			zap.String("app_id", payload.AppID),
+			zap.String("export_id", payload.ExportID),
+		)
+		h.finishAppExport(payload.ExportID, "failed", 0, err.Error())
+		return nil
+	}
+	h.finishAppExport(payload.ExportID, "ready", size, "")
+
+	h.logger.Info("App export ready",
+		zap.String("app_id", payload.AppID),
+		zap.String("export_id", payload.ExportID),
+		zap.Int64("size_bytes", size),
+		zap.Strings("volumes", manifest.Volumes),
+	)
+
+	if payload.DeleteApp {
+		h.deleteExportedApp(ctx, payload)
+	}
+	return nil
+}
+
+// writeAppExport writes the bundle next to its final path and renames it into place, so a
+// download never sees a partial bundle. Returns the bundle's size
+func (h *TaskHandler) writeAppExport(ctx context.Context, exportID string, manifest *services.AppExportManifest) (int64, error) {
+	if h.deploymentService == nil {
+		return 0, fmt.Errorf("deployment service not configured")
+	}
+	if err := os.MkdirAll(services.AppExportDir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	bundlePath := services.AppExportPath(exportID)
+	tmpPath := bundlePath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create export bundle: %w", err)
+	}
+	if err := h.deploymentService.WriteAppExport(ctx, file, manifest); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return 0, fmt.Errorf("failed to write export bundle: %w", err)
+	}
+	if err := os.Rename(tmpPath, bundlePath); err != nil {
+		os.Remove(tmpPath)
+		return 0, fmt.Errorf("failed to store export bundle: %w", err)
+	}
+
+	info, err := os.Stat(bundlePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat export bundle: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// deleteExportedApp removes the app's containers and images, then the app itself
+func (h *TaskHandler) deleteExportedApp(ctx context.Context, payload AppExportTaskPayload) {
+	if err := h.deploymentService.CleanupAppResources(ctx, payload.AppID); err != nil {
+		h.logger.Warn("Failed to cleanup Docker resources after app export",
+			zap.Error(err),
+			zap.String("app_id", payload.AppID),
+		)
+		// Continue with deletion even if cleanup fails
+	}
+	if h.planEnforcement != nil {
+		h.planEnforcement.ReleaseAppRAM(ctx, payload.AppID)
+	}
+	if err := h.appExportRepo.DeleteExportedApp(ctx, payload.AppID, payload.UserID); err != nil {
+		h.logger.Error("Failed to delete app after export",
+			zap.Error(err),
+			zap.String("app_id", payload.AppID),
+			zap.String("export_id", payload.ExportID),
+		)
+		return
+	}
+	h.logger.Info("App deleted after export",
+		zap.String("app_id", payload.AppID),
+		zap.String("export_id", payload.ExportID),
+	)
+}
+
+// finishAppExport records an export's outcome, even when the task context has already expired
+func (h *TaskHandler) finishAppExport(exportID, status string, sizeBytes int64, errorMsg string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := h.appExportRepo.FinishAppExport(ctx, exportID, status, sizeBytes, errorMsg); err != nil {
+		h.logger.Error("Failed to record app export outcome",
+			zap.Error(err),
+			zap.String("export_id", exportID),
+		)
+	}
+}
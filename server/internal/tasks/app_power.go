@@ -0,0 +1,122 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// AppPowerRepository records apps stopped and started by their owners
+type AppPowerRepository interface {
+	MarkAppStopped(ctx context.Context, appID string) error
+	MarkAppStarted(ctx context.Context, appID string) error
+	MarkAppPowerFailed(ctx context.Context, appID, reason string) error
+}
+
+// SetAppPowerRepo enables stopping and starting apps on this worker
+func (h *TaskHandler) SetAppPowerRepo(appPowerRepo AppPowerRepository) {
+	h.appPowerRepo = appPowerRepo
+}
+
+// HandleAppPowerTask stops or starts an app's containers at its owner's request
+// Stopped containers are kept, so a start brings the app back with the image and env it was stopped with.
+// The API has already moved the app to stopping or starting; Docker errors are retried and the app is
+// marked failed once they run out
+func (h *TaskHandler) HandleAppPowerTask(ctx context.Context, t *asynq.Task) error {
+	var payload AppPowerTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal app power task payload: %w", err)
+	}
+	if h.appPowerRepo == nil {
+		return fmt.Errorf("app power repository not configured")
+	}
+	if h.deploymentService == nil {
+		return fmt.Errorf("deployment service not configured")
+	}
+
+	h.logger.Info("Processing app power task", zap.String("app_id", payload.AppID), zap.String("action", payload.Action))
+
+	var err error
+	switch payload.Action {
+	case AppPowerStop:
+		err = h.stopApp(ctx, payload)
+	case AppPowerStart:
+		err = h.startApp(ctx, payload)
+	default:
+		return fmt.Errorf("unknown app power action %q", payload.Action)
+	}
+	if err != nil && isFinalAttempt(ctx) {
+		reason := "The app could not be stopped - try again or redeploy it"
+		if payload.Action == AppPowerStart {
+			reason = "The app could not be started - try again or redeploy it"
+		}
+		if markErr := h.appPowerRepo.MarkAppPowerFailed(ctx, payload.AppID, reason); markErr != nil {
+			h.logger.Error("Failed to mark app as failed", zap.Error(markErr), zap.String("app_id", payload.AppID))
+		}
+	}
+	return err
+}
+
+// stopApp stops the app's containers and hands their RAM back to the owner's plan
+func (h *TaskHandler) stopApp(ctx context.Context, payload AppPowerTaskPayload) error {
+	stopped, err := h.deploymentService.StopAppContainers(ctx, payload.AppID)
+	if err != nil {
+		return fmt.Errorf("failed to stop app: %w", err)
+	}
+
+	// Stopped containers no longer hold RAM against the owner's plan
+	if h.planEnforcement != nil {
+		h.planEnforcement.ReleaseAppRAM(ctx, payload.AppID)
+	}
+
+	if err := h.appPowerRepo.MarkAppStopped(ctx, payload.AppID); err != nil {
+		return fmt.Errorf("failed to mark app as stopped: %w", err)
+	}
+	h.recordDeployEvent(ctx, services.DeployEvent{
+		AppID:   payload.AppID,
+		Type:    services.DeployEventStopped,
+		Message: "App stopped",
+		Data:    map[string]interface{}{"containers": stopped, "triggered_by": payload.TriggeredBy},
+	})
+
+	h.logger.Info("App stopped", zap.String("app_id", payload.AppID), zap.Int("containers", stopped))
+	return nil
+}
+
+// startApp starts the containers stopApp stopped and counts their RAM against the owner's plan again
+func (h *TaskHandler) startApp(ctx context.Context, payload AppPowerTaskPayload) error {
+	ramMB, err := h.deploymentService.WakeAppContainers(ctx, payload.AppID)
+	if errors.Is(err, services.ErrNoAppContainer) {
+		h.logger.Warn("Stopped app has no container to start", zap.String("app_id", payload.AppID))
+		if err := h.appPowerRepo.MarkAppPowerFailed(ctx, payload.AppID, "The app's container no longer exists - redeploy the app to start it again"); err != nil {
+			return fmt.Errorf("failed to mark app start as failed: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to start app: %w", err)
+	}
+
+	if h.planEnforcement != nil && ramMB > 0 {
+		previousRAMMB := h.planEnforcement.ReserveAppRAM(ctx, payload.UserID, payload.AppID, ramMB)
+		h.planEnforcement.SettleAppRAM(ctx, payload.AppID, true, previousRAMMB)
+	}
+
+	if err := h.appPowerRepo.MarkAppStarted(ctx, payload.AppID); err != nil {
+		return fmt.Errorf("failed to mark app as running: %w", err)
+	}
+	h.recordDeployEvent(ctx, services.DeployEvent{
+		AppID:   payload.AppID,
+		Type:    services.DeployEventStarted,
+		Message: "App started",
+		Data:    map[string]interface{}{"ram_mb": ramMB, "triggered_by": payload.TriggeredBy},
+	})
+
+	h.logger.Info("App started", zap.String("app_id", payload.AppID), zap.Int("ram_mb", ramMB))
+	return nil
+}
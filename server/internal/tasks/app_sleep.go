@@ -0,0 +1,66 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// AppSleepRepository records apps waking up from sleep
+type AppSleepRepository interface {
+	MarkAppAwake(ctx context.Context, appID string) error
+	MarkAppWakeFailed(ctx context.Context, appID, reason string) error
+}
+
+// SetAppSleepRepo enables waking sleeping apps on this worker
+func (h *TaskHandler) SetAppSleepRepo(appSleepRepo AppSleepRepository) {
+	h.appSleepRepo = appSleepRepo
+}
+
+// HandleAppWakeTask starts the containers of an app that was put to sleep for being idle
+// The containers were only stopped, so the app comes back with the same image and env it slept with.
+// Docker errors are retried; an app whose container is gone is marked failed so its owner redeploys it
+func (h *TaskHandler) HandleAppWakeTask(ctx context.Context, t *asynq.Task) error {
+	var payload AppWakeTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal app wake task payload: %w", err)
+	}
+	if h.appSleepRepo == nil {
+		return fmt.Errorf("app sleep repository not configured")
+	}
+	if h.deploymentService == nil {
+		return fmt.Errorf("deployment service not configured")
+	}
+
+	h.logger.Info("Processing app wake task", zap.String("app_id", payload.AppID))
+
+	ramMB, err := h.deploymentService.WakeAppContainers(ctx, payload.AppID)
+	if errors.Is(err, services.ErrNoAppContainer) {
+		h.logger.Warn("Sleeping app has no container to wake", zap.String("app_id", payload.AppID))
+		if err := h.appSleepRepo.MarkAppWakeFailed(ctx, payload.AppID, "The app's container no longer exists - redeploy the app to start it again"); err != nil {
+			return fmt.Errorf("failed to mark app wake as failed: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to wake app: %w", err)
+	}
+
+	// The containers hold RAM against the owner's plan again
+	if h.planEnforcement != nil && ramMB > 0 {
+		previousRAMMB := h.planEnforcement.ReserveAppRAM(ctx, payload.UserID, payload.AppID, ramMB)
+		h.planEnforcement.SettleAppRAM(ctx, payload.AppID, true, previousRAMMB)
+	}
+
+	if err := h.appSleepRepo.MarkAppAwake(ctx, payload.AppID); err != nil {
+		return fmt.Errorf("failed to mark app as running: %w", err)
+	}
+
+	h.logger.Info("App woken from sleep", zap.String("app_id", payload.AppID), zap.Int("ram_mb", ramMB))
+	return nil
+}
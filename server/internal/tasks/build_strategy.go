@@ -0,0 +1,93 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// BuildStrategyRepository looks up how apps want their source built into an image
+type BuildStrategyRepository interface {
+	GetBuildStrategy(ctx context.Context, appID string) (string, error)
+}
+
+// NixpacksBuilder builds images with nixpacks and tells whether it can plan a build for a source tree
+type NixpacksBuilder interface {
+	DockerBuildService
+	Detect(ctx context.Context, path string) ([]string, error)
+}
+
+// SetBuildStrategyRepo lets apps choose their build strategy; without it every app is built from a Dockerfile
+func (h *TaskHandler) SetBuildStrategyRepo(strategies BuildStrategyRepository) {
+	h.buildStrategyRepo = strategies
+}
+
+// SetBuildpacksBuilder builds apps that chose the buildpacks strategy on this worker
+func (h *TaskHandler) SetBuildpacksBuilder(builder DockerBuildService) {
+	h.buildpacksBuilder = builder
+}
+
+// SetNixpacksBuilder builds apps that chose the nixpacks strategy on this worker
+func (h *TaskHandler) SetNixpacksBuilder(builder NixpacksBuilder) {
+	h.nixpacksBuilder = builder
+}
+
+// buildStrategy returns the strategy to build an app with, falling back to a Dockerfile build when the
+// app's choice cannot be read or this worker cannot build with it
+func (h *TaskHandler) buildStrategy(ctx context.Context, appID string) string {
+	if h.buildStrategyRepo == nil {
+		return services.BuildStrategyDockerfile
+	}
+	strategy, err := h.buildStrategyRepo.GetBuildStrategy(ctx, appID)
+	if err != nil {
+		h.logger.Warn("Failed to get build strategy - building from a Dockerfile", zap.Error(err), zap.String("app_id", appID))
+		return services.BuildStrategyDockerfile
+	}
+	switch {
+	case strategy == services.BuildStrategyBuildpacks && h.buildpacksBuilder == nil,
+		strategy == services.BuildStrategyNixpacks && h.nixpacksBuilder == nil:
+		h.logger.Warn("This worker cannot build with the app's build strategy - building from a Dockerfile",
+			zap.String("app_id", appID),
+			zap.String("build_strategy", strategy),
+		)
+		return services.BuildStrategyDockerfile
+	case !services.ValidBuildStrategy(strategy):
+		return services.BuildStrategyDockerfile
+	}
+	return strategy
+}
+
+// nixpacksFallback returns the strategy for a nixpacks app: nixpacks when it has a provider for the
+// source, otherwise a Dockerfile build when the repo has a Dockerfile or a runtime one can be generated
+// for. The outcome of detection is written to the build log
+func (h *TaskHandler) nixpacksFallback(ctx context.Context, buildPath string, logWriter io.Writer) (string, error) {
+	providers, err := h.nixpacksBuilder.Detect(ctx, buildPath)
+	if err == nil && len(providers) > 0 {
+		fmt.Fprintf(logWriter, "Nixpacks providers: %s\n", strings.Join(providers, ", "))
+		return services.BuildStrategyNixpacks, nil
+	}
+	if err != nil {
+		h.logger.Warn("Nixpacks detection failed", zap.Error(err), zap.String("build_path", buildPath))
+	}
+
+	if _, statErr := os.Stat(filepath.Join(buildPath, "Dockerfile")); statErr == nil {
+		fmt.Fprintln(logWriter, "Nixpacks found nothing to build - building the repository's Dockerfile instead")
+		return services.BuildStrategyDockerfile, nil
+	}
+	if h.runtimeDetector != nil {
+		if runtime, detectErr := h.runtimeDetector.DetectRuntime(buildPath); detectErr == nil && runtime != services.RuntimeUnknown {
+			fmt.Fprintf(logWriter, "Nixpacks found nothing to build - building with a generated %s Dockerfile instead\n", runtime)
+			return services.BuildStrategyDockerfile, nil
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("nixpacks could not plan a build: %w", err)
+	}
+	return "", fmt.Errorf("nixpacks found no supported language or framework in the source")
+}
@@ -0,0 +1,87 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"stackyn/server/internal/metrics"
+)
+
+// Cleanup triggers (CleanupTaskPayload.Trigger)
+const (
+	CleanupTriggerSchedule = "schedule"
+	CleanupTriggerAdmin    = "admin"
+)
+
+// CleanupLock keeps cleanup runs on different workers from overlapping (see services.CleanupLock)
+type CleanupLock interface {
+	Acquire(ctx context.Context, force bool) (token string, ok bool, err error)
+	Release(ctx context.Context, token string, cooldown time.Duration) error
+}
+
+// SetCleanupLock makes cleanup runs take lock first; after a run, scheduled runs are skipped for cooldown
+func (h *TaskHandler) SetCleanupLock(lock CleanupLock, cooldown time.Duration) {
+	h.cleanupLock = lock
+	h.cleanupCooldown = cooldown
+}
+
+// RunScheduledCleanup runs a cleanup for the cleanup scheduler
+func (h *TaskHandler) RunScheduledCleanup(ctx context.Context) error {
+	return h.runCleanup(ctx, CleanupTriggerSchedule)
+}
+
+// runCleanup runs a cleanup and prunes deployment history, recording the run in the metrics
+// With a lock set, the run is skipped when another worker is cleaning up - or, unless an admin
+// asked for it, when one finished within the cooldown
+func (h *TaskHandler) runCleanup(ctx context.Context, trigger string) error {
+	if h.cleanupService == nil {
+		return fmt.Errorf("cleanup service not configured")
+	}
+
+	if h.cleanupLock != nil {
+		token, ok, err := h.cleanupLock.Acquire(ctx, trigger == CleanupTriggerAdmin)
+		if err != nil {
+			metrics.ObserveCleanup(0, 0, 0, 0, 0, 0, err)
+			return err
+		}
+		if !ok {
+			h.logger.Info("Cleanup already running or recently done - skipping", zap.String("trigger", trigger))
+			metrics.ObserveCleanupSkipped()
+			return nil
+		}
+		defer func() {
+			releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := h.cleanupLock.Release(releaseCtx, token, h.cleanupCooldown); err != nil {
+				h.logger.Warn("Failed to release cleanup lock", zap.Error(err))
+			}
+		}()
+	}
+
+	startedAt := time.Now()
+	result, err := h.cleanupService.RunCleanup(ctx)
+	if err != nil {
+		metrics.ObserveCleanup(0, 0, 0, 0, 0, time.Since(startedAt), err)
+		return fmt.Errorf("cleanup operation failed: %w", err)
+	}
+	metrics.ObserveCleanup(result.ContainersRemoved, result.ImagesRemoved, result.TempDirsPruned, result.SpaceFreedMB, len(result.Errors), time.Since(startedAt), nil)
+
+	h.logger.Info("Cleanup completed",
+		zap.String("trigger", trigger),
+		zap.Int("containers_removed", result.ContainersRemoved),
+		zap.Int("images_removed", result.ImagesRemoved),
+		zap.Int64("space_freed_mb", result.SpaceFreedMB),
+		zap.Int("temp_dirs_pruned", result.TempDirsPruned),
+		zap.Int("errors", len(result.Errors)),
+		zap.Duration("duration", time.Since(startedAt)),
+	)
+	for _, errMsg := range result.Errors {
+		h.logger.Warn("Cleanup error", zap.String("error", errMsg))
+	}
+
+	h.pruneDeploymentHistory(ctx)
+	h.pruneLogSearch(ctx)
+	return nil
+}
@@ -0,0 +1,109 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// cronRunRAMMB is the memory limit of a cron job container (the app's default deploy size)
+const cronRunRAMMB = 512
+
+// CronRunRepository records the progress and outcome of cron job runs
+type CronRunRepository interface {
+	StartCronRun(ctx context.Context, runID string) error
+	FinishCronRun(ctx context.Context, runID, status string, exitCode *int, output, errorMsg string) error
+}
+
+// SetCronRunRepo enables cron job runs on this worker
+func (h *TaskHandler) SetCronRunRepo(cronRunRepo CronRunRepository) {
+	h.cronRunRepo = cronRunRepo
+}
+
+// HandleCronRunTask runs a cron job's command in a one-off container of the app's running image
+// The run's outcome is recorded on the run row rather than returned, so a failing command does not
+// count as a failed task (and is never retried)
+func (h *TaskHandler) HandleCronRunTask(ctx context.Context, t *asynq.Task) error {
+	var payload CronRunTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal cron run task payload: %w", err)
+	}
+	if h.cronRunRepo == nil {
+		return fmt.Errorf("cron run repository not configured")
+	}
+
+	h.logger.Info("Processing cron run task",
+		zap.String("app_id", payload.AppID),
+		zap.String("cron_job_id", payload.CronJobID),
+		zap.String("run_id", payload.RunID),
+	)
+
+	if err := h.cronRunRepo.StartCronRun(ctx, payload.RunID); err != nil {
+		return fmt.Errorf("failed to mark cron run as running: %w", err)
+	}
+
+	if h.deploymentService == nil {
+		h.finishCronRun(payload, "failed", nil, "", "Deployment service not configured")
+		return fmt.Errorf("deployment service not configured")
+	}
+
+	// Same environment the app's running container was started with
+	envVars, _ := h.deploymentEnvVars(ctx, payload.AppID, payload.DeploymentID)
+
+	result, err := h.deploymentService.RunOneOffContainer(ctx, services.OneOffOptions{
+		AppID:     payload.AppID,
+		RunID:     payload.RunID,
+		ImageRef:  payload.ImageName,
+		Command:   payload.Command,
+		EnvVars:   envVars,
+		Limits:    services.ResourceLimits{MemoryMB: cronRunRAMMB, CPU: 0.5},
+		Timeout:   time.Duration(payload.TimeoutSeconds) * time.Second,
+		Isolation: h.isolationLevel(ctx, payload.AppID, payload.UserID),
+	})
+	if err != nil {
+		h.logger.Error("Cron run failed to execute",
+			zap.Error(err),
+			zap.String("app_id", payload.AppID),
+			zap.String("run_id", payload.RunID),
+		)
+		h.finishCronRun(payload, "failed", nil, "", err.Error())
+		return nil
+	}
+
+	status, errorMsg := "succeeded", ""
+	switch {
+	case result.TimedOut:
+		status, errorMsg = "failed", fmt.Sprintf("Command timed out after %d seconds", payload.TimeoutSeconds)
+	case result.ExitCode != 0:
+		status, errorMsg = "failed", fmt.Sprintf("Command exited with code %d", result.ExitCode)
+	}
+	h.finishCronRun(payload, status, &result.ExitCode, result.Output, errorMsg)
+
+	h.logger.Info("Cron run finished",
+		zap.String("app_id", payload.AppID),
+		zap.String("run_id", payload.RunID),
+		zap.String("status", status),
+		zap.Int("exit_code", result.ExitCode),
+	)
+	return nil
+}
+
+// finishCronRun records a run's outcome, even when the task context has already expired
+func (h *TaskHandler) finishCronRun(payload CronRunTaskPayload, status string, exitCode *int, output, errorMsg string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// Postgres text columns reject NUL bytes and invalid UTF-8, both common in raw command output
+	output = strings.ReplaceAll(strings.ToValidUTF8(output, "\uFFFD"), "\x00", "")
+	if err := h.cronRunRepo.FinishCronRun(ctx, payload.RunID, status, exitCode, output, errorMsg); err != nil {
+		h.logger.Error("Failed to record cron run outcome",
+			zap.Error(err),
+			zap.String("run_id", payload.RunID),
+		)
+	}
+}
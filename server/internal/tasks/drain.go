@@ -0,0 +1,113 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrBuildInterrupted is returned by a build its worker's drain window cut off
+// Asynq has already pushed the task back onto the queue, so the build is checkpointed for the next worker
+// rather than failed
+var ErrBuildInterrupted = errors.New("build interrupted by worker shutdown")
+
+// buildDrain tracks the builds running on this worker so a shutdown can let them finish
+type buildDrain struct {
+	draining atomic.Bool
+	mu       sync.Mutex
+	builds   map[string]BuildTaskPayload // In-flight builds by build job ID
+	running  sync.WaitGroup
+}
+
+// trackBuild registers a running build until the returned function is called
+func (h *TaskHandler) trackBuild(payload BuildTaskPayload) func() {
+	h.drain.mu.Lock()
+	if h.drain.builds == nil {
+		h.drain.builds = make(map[string]BuildTaskPayload)
+	}
+	h.drain.builds[payload.BuildJobID] = payload
+	h.drain.running.Add(1)
+	h.drain.mu.Unlock()
+
+	return func() {
+		h.drain.mu.Lock()
+		delete(h.drain.builds, payload.BuildJobID)
+		h.drain.mu.Unlock()
+		h.drain.running.Done()
+	}
+}
+
+// StartDraining marks the builds running on this worker as draining. Called when the worker starts
+// shutting down: they may still finish, and any stopped by the end of the drain window are requeued
+func (h *TaskHandler) StartDraining(ctx context.Context) {
+	h.drain.draining.Store(true)
+
+	h.drain.mu.Lock()
+	builds := make([]BuildTaskPayload, 0, len(h.drain.builds))
+	for _, payload := range h.drain.builds {
+		builds = append(builds, payload)
+	}
+	h.drain.mu.Unlock()
+
+	if len(builds) == 0 {
+		return
+	}
+	h.logger.Info("Draining builds", zap.Int("in_flight", len(builds)))
+	if h.buildJobRepo == nil {
+		return
+	}
+	for _, payload := range builds {
+		if err := h.buildJobRepo.MarkBuildJobDraining(ctx, payload.BuildJobID); err != nil {
+			h.logger.Warn("Failed to mark build as draining", zap.Error(err), zap.String("build_job_id", payload.BuildJobID))
+		}
+	}
+}
+
+// WaitForBuilds waits until every build handler has returned - after the drain window, interrupted
+// builds still checkpoint themselves - or until ctx is done
+func (h *TaskHandler) WaitForBuilds(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		h.drain.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		h.logger.Warn("Gave up waiting for interrupted builds to checkpoint")
+	}
+}
+
+// buildInterrupted reports whether a build's context was cancelled by the worker shutting down
+func (h *TaskHandler) buildInterrupted(ctx context.Context) bool {
+	return ctx.Err() != nil && h.drain.draining.Load()
+}
+
+// interruptBuild checkpoints a build the drain window cut off: the build job and app go back to pending
+// while the task waits on the queue for another worker. Nothing is recorded as failed
+func (h *TaskHandler) interruptBuild(payload BuildTaskPayload) error {
+	// The task context is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if h.buildJobRepo != nil {
+		if err := h.buildJobRepo.RequeueBuildJob(ctx, payload.BuildJobID); err != nil {
+			h.logger.Warn("Failed to checkpoint interrupted build", zap.Error(err), zap.String("build_job_id", payload.BuildJobID))
+		}
+	}
+	if h.appRepo != nil {
+		if err := h.appRepo.UpdateApp(payload.AppID, "pending", ""); err != nil {
+			h.logger.Warn("Failed to update app status to pending", zap.Error(err), zap.String("app_id", payload.AppID))
+		}
+	}
+
+	h.logger.Info("Build interrupted by worker shutdown - requeued",
+		zap.String("app_id", payload.AppID),
+		zap.String("build_job_id", payload.BuildJobID),
+	)
+	return ErrBuildInterrupted
+}
@@ -0,0 +1,36 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+)
+
+// EmailDeliverer delivers an email recorded in the email log
+type EmailDeliverer interface {
+	DeliverQueuedEmail(ctx context.Context, emailID string, final bool) error
+}
+
+// SetEmailDeliverer enables delivering queued emails on this worker
+func (h *TaskHandler) SetEmailDeliverer(emailDeliverer EmailDeliverer) {
+	h.emailDeliverer = emailDeliverer
+}
+
+// HandleEmailTask delivers a queued email
+// Failures are returned so Asynq retries them with the email backoff; the last attempt leaves the
+// email dead in the email log and the task archived
+func (h *TaskHandler) HandleEmailTask(ctx context.Context, t *asynq.Task) error {
+	var payload EmailTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal email task payload: %w", err)
+	}
+	if h.emailDeliverer == nil {
+		return fmt.Errorf("email deliverer not configured")
+	}
+
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	return h.emailDeliverer.DeliverQueuedEmail(ctx, payload.EmailID, retried >= maxRetry)
+}
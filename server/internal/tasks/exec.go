@@ -0,0 +1,223 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// execRAMMB is the memory limit of an exec container (the app's default deploy size)
+const execRAMMB = 512
+
+// Exec output is appended to the run in batches for the API to stream; at most maxExecOutputBytes are kept
+const (
+	execOutputFlushInterval = 500 * time.Millisecond
+	maxExecOutputBytes      = 1024 * 1024
+)
+
+// ExecRunRepository records one-off exec runs and their output as it is produced
+type ExecRunRepository interface {
+	StartExecRun(ctx context.Context, runID string) error
+	AppendExecOutput(ctx context.Context, runID, output string) error
+	FinishExecRun(ctx context.Context, runID, status string, exitCode *int, errorMsg string) error
+}
+
+// SetExecRunRepo enables one-off exec runs on this worker
+func (h *TaskHandler) SetExecRunRepo(execRunRepo ExecRunRepository) {
+	h.execRunRepo = execRunRepo
+}
+
+// HandleExecTask runs a one-off command in a container of the app's running image
+// Like cron runs, the outcome is recorded on the run rather than returned, so a failing command is
+// never retried. Output reaches the run while the command is still running
+func (h *TaskHandler) HandleExecTask(ctx context.Context, t *asynq.Task) error {
+	var payload ExecTaskPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal exec task payload: %w", err)
+	}
+	if h.execRunRepo == nil {
+		return fmt.Errorf("exec run repository not configured")
+	}
+
+	h.logger.Info("Processing exec task",
+		zap.String("app_id", payload.AppID),
+		zap.String("run_id", payload.RunID),
+	)
+
+	if err := h.execRunRepo.StartExecRun(ctx, payload.RunID); err != nil {
+		return fmt.Errorf("failed to mark exec run as running: %w", err)
+	}
+
+	if h.deploymentService == nil {
+		h.finishExecRun(payload.RunID, "failed", nil, "Deployment service not configured")
+		return fmt.Errorf("deployment service not configured")
+	}
+
+	// Same environment the app's running container was started with
+	envVars, _ := h.deploymentEnvVars(ctx, payload.AppID, payload.DeploymentID)
+
+	output := newExecOutput(h, payload.RunID)
+	result, err := h.deploymentService.RunOneOffContainer(ctx, services.OneOffOptions{
+		AppID:     payload.AppID,
+		RunID:     payload.RunID,
+		ImageRef:  payload.ImageName,
+		Command:   payload.Command,
+		EnvVars:   envVars,
+		Limits:    services.ResourceLimits{MemoryMB: execRAMMB, CPU: 0.5},
+		Timeout:   time.Duration(payload.TimeoutSeconds) * time.Second,
+		Output:    output,
+		Isolation: h.isolationLevel(ctx, payload.AppID, payload.UserID),
+	})
+	output.Close()
+	if err != nil {
+		h.logger.Error("Exec run failed to execute",
+			zap.Error(err),
+			zap.String("app_id", payload.AppID),
+			zap.String("run_id", payload.RunID),
+		)
+		h.finishExecRun(payload.RunID, "failed", nil, err.Error())
+		return nil
+	}
+
+	status, errorMsg := "succeeded", ""
+	switch {
+	case result.TimedOut:
+		status, errorMsg = "failed", fmt.Sprintf("Command timed out after %d seconds", payload.TimeoutSeconds)
+	case result.ExitCode != 0:
+		status, errorMsg = "failed", fmt.Sprintf("Command exited with code %d", result.ExitCode)
+	}
+	h.finishExecRun(payload.RunID, status, &result.ExitCode, errorMsg)
+
+	h.logger.Info("Exec run finished",
+		zap.String("app_id", payload.AppID),
+		zap.String("run_id", payload.RunID),
+		zap.String("status", status),
+		zap.Int("exit_code", result.ExitCode),
+	)
+	return nil
+}
+
+// finishExecRun records a run's outcome, even when the task context has already expired
+func (h *TaskHandler) finishExecRun(runID, status string, exitCode *int, errorMsg string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := h.execRunRepo.FinishExecRun(ctx, runID, status, exitCode, errorMsg); err != nil {
+		h.logger.Error("Failed to record exec run outcome",
+			zap.Error(err),
+			zap.String("run_id", runID),
+		)
+	}
+}
+
+// execOutput buffers a command's output and appends it to its run every execOutputFlushInterval
+type execOutput struct {
+	h       *TaskHandler
+	runID   string
+	mu      sync.Mutex
+	buf     []byte
+	written int // Bytes handed to the repository so far
+	closed  bool
+	done    chan struct{}
+	flushed chan struct{}
+}
+
+func newExecOutput(h *TaskHandler, runID string) *execOutput {
+	o := &execOutput{h: h, runID: runID, done: make(chan struct{}), flushed: make(chan struct{})}
+	go o.run()
+	return o
+}
+
+// Write buffers p; output past maxExecOutputBytes is dropped and noted once
+func (o *execOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return len(p), nil
+	}
+	room := maxExecOutputBytes - o.written - len(o.buf)
+	switch {
+	case room <= 0:
+	case len(p) > room:
+		o.buf = append(o.buf, p[:room]...)
+		o.buf = append(o.buf, "\n[output truncated]\n"...)
+	default:
+		o.buf = append(o.buf, p...)
+	}
+	return len(p), nil
+}
+
+// Close flushes what is left and stops the flush loop; later writes are dropped
+func (o *execOutput) Close() {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return
+	}
+	o.closed = true
+	o.mu.Unlock()
+
+	close(o.done)
+	<-o.flushed
+}
+
+func (o *execOutput) run() {
+	defer close(o.flushed)
+	ticker := time.NewTicker(execOutputFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.done:
+			o.flush(true)
+			return
+		case <-ticker.C:
+			o.flush(false)
+		}
+	}
+}
+
+// flush appends the buffered output to the run. A rune split across writes waits for its remaining
+// bytes unless this is the final flush
+func (o *execOutput) flush(final bool) {
+	o.mu.Lock()
+	cut := len(o.buf)
+	if !final {
+		cut = completeUTF8Prefix(o.buf)
+	}
+	chunk := string(o.buf[:cut])
+	o.buf = append(o.buf[:0], o.buf[cut:]...)
+	o.written += cut
+	o.mu.Unlock()
+
+	if chunk == "" {
+		return
+	}
+	// Postgres text columns reject NUL bytes and invalid UTF-8, both common in raw command output
+	chunk = strings.ReplaceAll(strings.ToValidUTF8(chunk, "\uFFFD"), "\x00", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := o.h.execRunRepo.AppendExecOutput(ctx, o.runID, chunk); err != nil {
+		o.h.logger.Warn("Failed to append exec output", zap.Error(err), zap.String("run_id", o.runID))
+	}
+}
+
+// completeUTF8Prefix returns the length of b without a trailing incomplete UTF-8 sequence
+func completeUTF8Prefix(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(b)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -16,6 +17,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
 	"go.uber.org/zap"
+	"stackyn/server/internal/deploystate"
 	stackynerrors "stackyn/server/internal/errors"
 	"stackyn/server/internal/services"
 )
@@ -43,6 +45,54 @@ type TaskHandler struct {
 	appRepo          AppRepository        // For updating app status and URL
 	buildJobRepo     BuildJobRepository  // For creating build_job records in DB
 	envVarRepo       EnvVarRepository    // For retrieving environment variables
+	domainRepo       DomainRepository    // Optional: for routing verified custom domains
+	usageRecorder    UsageRecorder       // Optional: for metering build minutes
+	healthCheckRepo  HealthCheckRepository // Optional: for per-app health check settings
+	notifier         Notifier              // Optional: for alerting app owners about failures
+	faultInjector    FaultInjector         // Optional: injected failures for chaos testing (never set in production)
+	cronRunRepo      CronRunRepository     // Optional: records the outcome of cron job runs
+	appEvents        AppEventRecorder      // Optional: records build and deploy events for app webhooks
+	deployEvents     services.DeployEventRecorder // Optional: records the steps of deploys on the app's events timeline
+	appExportRepo    AppExportRepository   // Optional: tracks app export bundles
+	appSleepRepo     AppSleepRepository    // Optional: records apps waking up from sleep
+	appPowerRepo     AppPowerRepository    // Optional: records apps stopped and started by their owners
+	imageAppRepo     ImageAppRepository    // Optional: registry logins and digests of image apps
+	wafRepo          WAFRepository         // Optional: per-app WAF settings applied to routes
+	routingRepo      RoutingRepository     // Optional: per-app routing settings applied to routes
+	processRepo      ProcessRepository     // Optional: Procfile processes and which run as workers
+	execRunRepo      ExecRunRepository     // Optional: records one-off exec runs and their output
+	releaseRepo      ReleaseCommandRepository // Optional: release commands run before deployments take traffic
+	isolationRepo    AppIsolationRepository   // Optional: apps confining their containers more than their plan does
+	imageScanner     ImageScanner             // Optional: scans built images for vulnerabilities
+	imageScanRepo    ImageScanRepository      // Optional: image scans and the vulnerability policy of deploys
+	secretScanner    SecretScanner            // Optional: scans sources for committed credentials before they are built
+	secretScanRepo   SecretScanRepository     // Optional: per-app secret scan mode (off, warn, block)
+	buildpacksBuilder DockerBuildService      // Optional: builds apps that chose the buildpacks strategy
+	nixpacksBuilder   NixpacksBuilder         // Optional: builds apps that chose the nixpacks strategy
+	buildStrategyRepo BuildStrategyRepository // Optional: per-app build strategy
+	emailDeliverer   EmailDeliverer           // Optional: delivers queued emails
+	retentionRepo    DeploymentRetentionRepository // Optional: prunes old deployments during cleanup
+	retentionKeep    int                   // Deployments always kept per app
+	retentionMaxAge  time.Duration         // Older deployments beyond those are pruned
+	logSearchRepo    LogSearchRetentionRepository // Optional: prunes indexed log lines during cleanup
+	logSearchMaxAge  time.Duration         // Indexed log lines older than this are pruned
+	cleanupLock      CleanupLock           // Optional: keeps cleanup runs on different workers apart
+	cleanupCooldown  time.Duration         // Scheduled runs are skipped this long after a run
+	nodeName         string                // Optional: node app containers run on, recorded on deployments
+	nodeRegion       string                // Optional: region of that node
+	hostRepo         HostRepository        // Optional: whether an admin drained this worker's node
+	drain            buildDrain            // Builds in flight, for draining on shutdown
+}
+
+// AppEventRecorder records build and deploy events for delivery to the app's outgoing webhooks
+type AppEventRecorder interface {
+	RecordAppEvent(ctx context.Context, appID, event string, data map[string]interface{}) error
+}
+
+// Notifier delivers user notifications, honouring each user's preferences
+type Notifier interface {
+	NotifyDeployFailed(ctx context.Context, userID, appName, stage, reason string) error
+	NotifyFirstDeploy(ctx context.Context, userID string, summary services.FirstDeploySummary) error
 }
 
 // ConstraintsService interface for constraint enforcement
@@ -58,8 +108,15 @@ type PlanEnforcementService interface {
 	GetQueuePriority(ctx context.Context, userID string) (int, error)
 	IncrementBuildCount(ctx context.Context, userID string) error
 	DecrementBuildCount(ctx context.Context, userID string) error
-	IncrementRAMUsage(ctx context.Context, userID string, ramMB int) error
-	DecrementRAMUsage(ctx context.Context, userID string, ramMB int) error
+	ReserveAppRAM(ctx context.Context, userID, appID string, ramMB int) (previousMB int)
+	SettleAppRAM(ctx context.Context, appID string, deployed bool, previousMB int)
+	ReleaseAppRAM(ctx context.Context, appID string)
+	CheckHealthChecks(ctx context.Context, userID string) error
+	CheckWorkers(ctx context.Context, userID string) error
+	CheckZeroDowntime(ctx context.Context, userID string) error
+	GetExecTimeout(ctx context.Context, userID string) (time.Duration, error)
+	GetIsolationLevel(ctx context.Context, userID string) (services.IsolationLevel, error)
+	GetBuildLimits(ctx context.Context, userID string) (services.BuildLimits, error)
 }
 
 // DockerBuildService interface for building Docker images
@@ -91,29 +148,68 @@ type LogPersister interface {
 type DeploymentService interface {
 	DeployContainer(ctx context.Context, opts services.DeploymentOptions) (*services.DeploymentResult, error)
 	DeployWithDockerCompose(ctx context.Context, opts services.DeploymentOptions) (*services.DeploymentResult, error)
+	RunOneOffContainer(ctx context.Context, opts services.OneOffOptions) (*services.OneOffResult, error)
+	WriteAppExport(ctx context.Context, w io.Writer, manifest *services.AppExportManifest) error
+	WakeAppContainers(ctx context.Context, appID string) (int, error)
+	StopAppContainers(ctx context.Context, appID string) (int, error)
+	CleanupAppResources(ctx context.Context, appID string) error
+	PullSourceImage(ctx context.Context, ref string, auth *services.RegistryAuth, localName, localTag string) (string, error)
+	DeployWorkers(ctx context.Context, opts services.WorkerOptions) ([]string, error)
+	ReplayContainerCrash(containerID string) bool
+	CopyImage(ctx context.Context, endpoint, imageRef string) error
 	GetDockerClient() *client.Client
 	Close() error
 }
 
 // DeploymentRepository interface for deployment database operations
 type DeploymentRepository interface {
-	CreateDeployment(appID, buildJobID, status, imageName, containerID, subdomain string) (string, error)
-	UpdateDeployment(deploymentID, status, imageName, containerID, subdomain, errorMsg string) error
-	UpdateDeploymentsByContainerIDs(ctx context.Context, containerIDs []string, status string) error
+	CreateDeployment(appID, buildJobID string, status deploystate.Status, imageName, containerID, subdomain string, change deploystate.Change) (string, error)
+	TransitionDeployment(ctx context.Context, deploymentID string, to deploystate.Status, change deploystate.Change) error
+	StopDeploymentsByContainerIDs(ctx context.Context, containerIDs []string, change deploystate.Change) error
 	GetDeploymentsByAppID(appID string) ([]map[string]interface{}, error)
 	GetDeploymentByID(deploymentID string) (map[string]interface{}, error)
+	MarkDeploymentAsRollback(deploymentID, rollbackFromDeploymentID string) error
+	SetEnvSnapshot(ctx context.Context, deploymentID string, envVars map[string]string, fromDeploymentID string) error
+	GetEnvSnapshot(ctx context.Context, deploymentID string) (map[string]string, error)
+	SetDeploymentNode(ctx context.Context, deploymentID, node, region string) error
+	SetDeploymentHistory(ctx context.Context, deploymentID string, commit services.CommitInfo, config services.DeploymentConfigSnapshot) error
+	SetDeploymentCommit(ctx context.Context, deploymentID string, commit services.CommitInfo) error // Empty commit SHA takes the commit of the redeployed build
+	SetDeploymentTrigger(ctx context.Context, deploymentID, trigger, triggeredBy string) error // Empty triggeredBy for platform-started deployments
 }
 
 // AppRepository interface for app database operations
 type AppRepository interface {
 	UpdateApp(appID, status, url string) error
 	GetAppSlug(appID string) (string, error) // Get app slug for subdomain generation
+	MarkFirstDeployed(ctx context.Context, appID string) (bool, error) // True only for the app's first successful deployment
 }
 
 // BuildJobRepository interface for build_job database operations
 type BuildJobRepository interface {
 	CreateBuildJob(ctx context.Context, buildJobID, appID, status string) error
 	UpdateBuildJob(ctx context.Context, buildJobID, status, buildLog, errorMsg string) error
+	GetBuildJobStatus(ctx context.Context, buildJobID string) (string, error)
+	SetBuildJobBaseImage(ctx context.Context, buildJobID, image, digest string) error
+	SetBuildJobRuntime(ctx context.Context, buildJobID, runtime string) error
+	SetBuildJobStrategy(ctx context.Context, buildJobID, strategy string) error
+	MarkBuildJobDraining(ctx context.Context, buildJobID string) error
+	RequeueBuildJob(ctx context.Context, buildJobID string) error
+}
+
+// ErrBuildCancelled is returned by a build task that was cancelled through the API
+// The API has already recorded the cancellation, so the task leaves app and deployment status alone
+var ErrBuildCancelled = errors.New("build cancelled")
+
+// ErrHostDraining is returned by a deploy task picked up on a node an admin drained
+// The task goes back to the queue (without using up a retry) for a worker on another node
+var ErrHostDraining = errors.New("host is draining")
+
+// HostRepository reports whether an admin drained a node (POST /admin/hosts/{id}/drain) and where deploys
+// placed on another node than the one that built their image copy it from
+type HostRepository interface {
+	IsHostDraining(ctx context.Context, name string) (bool, error)
+	HostDockerEndpoint(ctx context.Context, name string) (string, error)
+	ImageHost(ctx context.Context, appID, imageName string) (string, error)
 }
 
 // EnvVarRepository interface for environment variable database operations
@@ -121,6 +217,53 @@ type EnvVarRepository interface {
 	GetEnvVarsByAppID(ctx context.Context, appID string) ([]*EnvVar, error)
 }
 
+// DomainRepository interface for custom domain database operations
+type DomainRepository interface {
+	GetVerifiedDomainsByAppID(ctx context.Context, appID string) ([]string, error)
+}
+
+// WAFRepository interface for per-app WAF settings
+type WAFRepository interface {
+	GetAppWAF(ctx context.Context, appID string) (*services.WAFConfig, error) // nil when the app has no WAF
+}
+
+// RoutingRepository interface for per-app routing settings
+type RoutingRepository interface {
+	GetAppRouting(ctx context.Context, appID string) (*services.RoutingConfig, error) // nil when the app has no routing settings
+}
+
+// DeploymentRetentionRepository interface for pruning old deployment history
+type DeploymentRetentionRepository interface {
+	PruneDeployments(ctx context.Context, keepPerApp int, olderThan time.Time) (int, []string, error) // Returns the images no longer used
+}
+
+// LogSearchRetentionRepository prunes log lines indexed for search
+type LogSearchRetentionRepository interface {
+	PruneLogLines(ctx context.Context, before time.Time) (int64, error)
+}
+
+// HealthCheckRepository interface for per-app health check settings
+type HealthCheckRepository interface {
+	GetHealthCheckConfig(ctx context.Context, appID string) (*HealthCheckConfig, error)
+}
+
+// HealthCheckConfig is an app's HTTP health check settings
+type HealthCheckConfig struct {
+	Path            string
+	IntervalSeconds int
+}
+
+// FaultInjector decides when builds and deploys should fail or stall on purpose (chaos testing)
+type FaultInjector interface {
+	ShouldFailBuild(ctx context.Context, appID string) bool
+	DeployDelay(ctx context.Context, appID string) time.Duration
+}
+
+// UsageRecorder interface for metering usage (build minutes)
+type UsageRecorder interface {
+	RecordUsage(ctx context.Context, userID, appID, metric string, quantity int64) error
+}
+
 // EnvVar represents an environment variable
 type EnvVar struct {
 	Key   string
@@ -130,6 +273,7 @@ type EnvVar struct {
 // CleanupService interface for cleanup operations
 type CleanupService interface {
 	RunCleanup(ctx context.Context) (*services.CleanupResult, error)
+	RemoveDeploymentImages(ctx context.Context, imageNames []string) (int, int64)
 	Close() error
 }
 
@@ -180,13 +324,456 @@ func NewTaskHandler(
 	}
 }
 
+// SetDomainRepo sets the custom domain repository used when generating routes
+func (h *TaskHandler) SetDomainRepo(domainRepo DomainRepository) {
+	h.domainRepo = domainRepo
+}
+
+// SetWAFRepo sets the repository used to look up the WAF settings applied to routes
+func (h *TaskHandler) SetWAFRepo(wafRepo WAFRepository) {
+	h.wafRepo = wafRepo
+}
+
+// SetRoutingRepo sets the repository used to look up the routing settings applied to routes
+func (h *TaskHandler) SetRoutingRepo(routingRepo RoutingRepository) {
+	h.routingRepo = routingRepo
+}
+
+// SetHealthCheckRepo sets the repository used to look up per-app health check settings
+func (h *TaskHandler) SetHealthCheckRepo(healthCheckRepo HealthCheckRepository) {
+	h.healthCheckRepo = healthCheckRepo
+}
+
+// SetNotifier sets the notifier used to alert app owners about failed builds and deployments
+func (h *TaskHandler) SetNotifier(notifier Notifier) {
+	h.notifier = notifier
+}
+
+// SetAppEventRecorder sets the recorder that queues build and deploy events for app webhooks
+func (h *TaskHandler) SetAppEventRecorder(appEvents AppEventRecorder) {
+	h.appEvents = appEvents
+}
+
+// SetDeployEventRecorder sets the recorder that persists the steps of deploys for the app's events timeline
+func (h *TaskHandler) SetDeployEventRecorder(deployEvents services.DeployEventRecorder) {
+	h.deployEvents = deployEvents
+}
+
+// recordDeployEvent records a step of a deploy on the app's events timeline; failures are logged and never fail the task
+func (h *TaskHandler) recordDeployEvent(ctx context.Context, event services.DeployEvent) {
+	if h.deployEvents == nil || event.AppID == "" {
+		return
+	}
+	if err := h.deployEvents.RecordDeployEvent(context.WithoutCancel(ctx), event); err != nil {
+		h.logger.Warn("Failed to record deploy event",
+			zap.Error(err),
+			zap.String("app_id", event.AppID),
+			zap.String("type", event.Type),
+		)
+	}
+}
+
+// recordAppEvent queues an event for the app's webhooks; failures are logged and never fail the task
+func (h *TaskHandler) recordAppEvent(ctx context.Context, appID, event string, data map[string]interface{}) {
+	if h.appEvents == nil || appID == "" {
+		return
+	}
+	if err := h.appEvents.RecordAppEvent(ctx, appID, event, data); err != nil {
+		h.logger.Warn("Failed to record app event",
+			zap.Error(err),
+			zap.String("app_id", appID),
+			zap.String("event", event),
+		)
+	}
+}
+
+// deploymentURL returns the public URL of a deployment's subdomain
+// Use HTTP for .local domains, HTTPS for production domains
+func deploymentURL(subdomain string) string {
+	if strings.HasSuffix(subdomain, ".local") || strings.HasSuffix(subdomain, ".localhost") {
+		return fmt.Sprintf("http://%s", subdomain)
+	}
+	return fmt.Sprintf("https://%s", subdomain)
+}
+
+// isFinalAttempt reports whether a failing task will not be retried
+func isFinalAttempt(ctx context.Context) bool {
+	if retried, ok := asynq.GetRetryCount(ctx); ok {
+		if maxRetry, ok := asynq.GetMaxRetry(ctx); ok && retried < maxRetry {
+			return false
+		}
+	}
+	return true
+}
+
+// recordDeploymentTrigger records what started a deployment and who; tasks queued without a trigger
+// (before triggers were recorded) leave both NULL
+func (h *TaskHandler) recordDeploymentTrigger(ctx context.Context, deploymentID, trigger, triggeredBy string) {
+	if trigger == "" || h.deploymentRepo == nil {
+		return
+	}
+	if err := h.deploymentRepo.SetDeploymentTrigger(ctx, deploymentID, trigger, triggeredBy); err != nil {
+		h.logger.Warn("Failed to record deployment trigger",
+			zap.Error(err),
+			zap.String("deployment_id", deploymentID),
+			zap.String("trigger", trigger),
+		)
+	}
+}
+
+// recordDeploymentCommit records the commit a deployment's image was built from, so it can be shown
+// as e.g. "abc1234: fix login bug"
+func (h *TaskHandler) recordDeploymentCommit(ctx context.Context, deploymentID string, commit services.CommitInfo) {
+	if h.deploymentRepo == nil {
+		return
+	}
+	if err := h.deploymentRepo.SetDeploymentCommit(ctx, deploymentID, commit); err != nil {
+		h.logger.Warn("Failed to record deployment commit",
+			zap.Error(err),
+			zap.String("deployment_id", deploymentID),
+			zap.String("commit_sha", commit.SHA),
+		)
+	}
+}
+
+// commit returns the commit the payload's image was built from (empty SHA for redeploys of earlier images)
+func (p DeployTaskPayload) commit() services.CommitInfo {
+	return services.CommitInfo{
+		SHA:     p.CommitSHA,
+		Author:  p.CommitAuthor,
+		Message: p.CommitMessage,
+		Branch:  p.CommitBranch,
+	}
+}
+
+// notifyDeployFailed alerts the app owner that a build or deployment failed
+// Tasks are retried, so only the final failed attempt notifies
+func (h *TaskHandler) notifyDeployFailed(ctx context.Context, appID, userID, stage, reason string) {
+	if h.notifier == nil || userID == "" {
+		return
+	}
+	if !isFinalAttempt(ctx) {
+		return
+	}
+
+	appName := appID
+	if h.appRepo != nil {
+		slug, err := h.appRepo.GetAppSlug(appID)
+		if err != nil {
+			// App was deleted while building - nobody to tell
+			h.logger.Debug("Skipping failure notification for missing app", zap.String("app_id", appID), zap.Error(err))
+			return
+		}
+		appName = slug
+	}
+
+	// Deliver in the background so email/Slack latency doesn't hold the worker
+	go func() {
+		notifyCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := h.notifier.NotifyDeployFailed(notifyCtx, userID, appName, stage, reason); err != nil {
+			h.logger.Warn("Failed to send deploy failure notification",
+				zap.Error(err),
+				zap.String("app_id", appID),
+				zap.String("user_id", userID),
+			)
+		}
+	}()
+}
+
+// notifyFirstDeploy records the app's first successful deployment and congratulates the owner
+// first_deployed_at is only set once, so redeploys and retried tasks never send it again
+func (h *TaskHandler) notifyFirstDeploy(ctx context.Context, appID, userID string, summary services.FirstDeploySummary) {
+	first, err := h.appRepo.MarkFirstDeployed(ctx, appID)
+	if err != nil {
+		h.logger.Warn("Failed to record first deployment", zap.Error(err), zap.String("app_id", appID))
+		return
+	}
+	if !first || h.notifier == nil || userID == "" {
+		return
+	}
+
+	summary.AppName = appID
+	if slug, err := h.appRepo.GetAppSlug(appID); err == nil {
+		summary.AppName = slug
+	}
+
+	// Deliver in the background so email/Slack latency doesn't hold the worker
+	go func() {
+		notifyCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := h.notifier.NotifyFirstDeploy(notifyCtx, userID, summary); err != nil {
+			h.logger.Warn("Failed to send first deployment notification",
+				zap.Error(err),
+				zap.String("app_id", appID),
+				zap.String("user_id", userID),
+			)
+		}
+	}()
+}
+
+// deploymentEnvVars resolves the env vars a deployment starts its container with
+// With fromDeploymentID set, that deployment's snapshot is reused so the container runs with exactly the
+// env it ran with before; deployments made before snapshots fall back to the app's current env vars.
+// Returns the deployment whose snapshot was used (empty when the current env vars were used)
+func (h *TaskHandler) deploymentEnvVars(ctx context.Context, appID, fromDeploymentID string) (map[string]string, string) {
+	if fromDeploymentID != "" && h.deploymentRepo != nil {
+		snapshot, err := h.deploymentRepo.GetEnvSnapshot(ctx, fromDeploymentID)
+		if err != nil {
+			h.logger.Warn("Failed to get env snapshot, using current environment variables",
+				zap.Error(err),
+				zap.String("app_id", appID),
+				zap.String("env_from_deployment_id", fromDeploymentID),
+			)
+		} else if snapshot != nil {
+			h.logger.Info("Reusing environment snapshot for deployment",
+				zap.String("app_id", appID),
+				zap.String("env_from_deployment_id", fromDeploymentID),
+				zap.Int("count", len(snapshot)),
+			)
+			return snapshot, fromDeploymentID
+		} else {
+			h.logger.Info("Deployment has no env snapshot, using current environment variables",
+				zap.String("app_id", appID),
+				zap.String("env_from_deployment_id", fromDeploymentID),
+			)
+		}
+	}
+
+	envVars := make(map[string]string)
+	if h.envVarRepo == nil {
+		h.logger.Warn("EnvVarRepo not available - deploying without environment variables",
+			zap.String("app_id", appID),
+		)
+		return envVars, ""
+	}
+
+	envVarList, err := h.envVarRepo.GetEnvVarsByAppID(ctx, appID)
+	if err != nil {
+		h.logger.Warn("Failed to retrieve environment variables from database",
+			zap.Error(err),
+			zap.String("app_id", appID),
+		)
+		// Continue with empty env vars rather than failing deployment
+		return envVars, ""
+	}
+	for _, envVar := range envVarList {
+		if envVar != nil && envVar.Key != "" {
+			envVars[envVar.Key] = envVar.Value
+		}
+	}
+	if len(envVars) > 0 {
+		h.logger.Info("Retrieved environment variables for deployment",
+			zap.String("app_id", appID),
+			zap.Int("count", len(envVars)),
+		)
+	}
+	return envVars, ""
+}
+
+// healthCheckOptions resolves the container health check for a deployment
+// Plans with health_checks probe the app's configured path and restart unhealthy containers;
+// other plans keep the default probe on "/" without automatic restarts
+func (h *TaskHandler) healthCheckOptions(ctx context.Context, appID, userID string) services.HealthCheckOptions {
+	opts := services.HealthCheckOptions{Path: "/"}
+	if h.planEnforcement == nil || h.planEnforcement.CheckHealthChecks(ctx, userID) != nil {
+		return opts
+	}
+	opts.AutoRestart = true
+
+	if h.healthCheckRepo != nil {
+		cfg, err := h.healthCheckRepo.GetHealthCheckConfig(ctx, appID)
+		if err != nil {
+			h.logger.Warn("Failed to get health check config, using defaults",
+				zap.Error(err),
+				zap.String("app_id", appID),
+			)
+			return opts
+		}
+		if cfg.Path != "" {
+			opts.Path = cfg.Path
+		}
+		opts.Interval = time.Duration(cfg.IntervalSeconds) * time.Second
+	}
+
+	h.logger.Info("Health checks enabled for deployment",
+		zap.String("app_id", appID),
+		zap.String("path", opts.Path),
+		zap.Duration("interval", opts.Interval),
+	)
+	return opts
+}
+
+// SetFaultInjector enables chaos fault injection for builds and deploys
+func (h *TaskHandler) SetFaultInjector(faultInjector FaultInjector) {
+	h.faultInjector = faultInjector
+}
+
+// SetNode sets the node (and region) deployments are recorded as running on, so maintenance
+// windows for a node or region reach the owners of the apps on it. On build workers it is the node
+// deploys copy the built image from when they are placed on another one
+func (h *TaskHandler) SetNode(name, region string) {
+	h.nodeName = name
+	h.nodeRegion = region
+}
+
+// SetHostRepo makes deploy tasks leave this worker's node alone once an admin drains it (requires SetNode)
+func (h *TaskHandler) SetHostRepo(hostRepo HostRepository) {
+	h.hostRepo = hostRepo
+}
+
+// hostDraining reports whether this worker's node is drained; a failed check lets the deploy go ahead
+func (h *TaskHandler) hostDraining(ctx context.Context) bool {
+	if h.hostRepo == nil || h.nodeName == "" {
+		return false
+	}
+	draining, err := h.hostRepo.IsHostDraining(ctx, h.nodeName)
+	if err != nil {
+		h.logger.Warn("Failed to check whether host is draining", zap.Error(err), zap.String("host", h.nodeName))
+		return false
+	}
+	return draining
+}
+
+// SetTaskEnqueue sets the task enqueue service; deploy workers use it to hand deploys placed on their
+// drained node back to the scheduler
+func (h *TaskHandler) SetTaskEnqueue(taskEnqueue TaskEnqueueService) {
+	h.taskEnqueue = taskEnqueue
+}
+
+// rescheduleDeploy hands a deploy placed on this drained node back to the scheduler, which places it on
+// another host. Returns false when it cannot, leaving the deploy to wait for the node to be undrained
+func (h *TaskHandler) rescheduleDeploy(ctx context.Context, payload DeployTaskPayload) bool {
+	if h.taskEnqueue == nil || payload.Host == "" {
+		return false
+	}
+	payload.Host = ""
+	if _, err := h.taskEnqueue.EnqueueDeployTask(ctx, payload, payload.UserID); err != nil {
+		h.logger.Warn("Failed to reschedule deploy from drained host", zap.Error(err), zap.String("app_id", payload.AppID))
+		return false
+	}
+	return true
+}
+
+// ensureImage copies the image of a deploy from the node that built it when it is not on this one
+// The build worker records its node on the deploy; redeploys of earlier builds copy from the node that
+// last ran the image
+func (h *TaskHandler) ensureImage(ctx context.Context, payload DeployTaskPayload, imageRef string) error {
+	if h.hostRepo == nil {
+		return nil
+	}
+	source := payload.ImageHost
+	if source == "" {
+		node, err := h.hostRepo.ImageHost(ctx, payload.AppID, imageRef)
+		if err != nil {
+			return nil // The deploy reports the image as missing if it is
+		}
+		source = node
+	}
+	if source == "" || source == h.nodeName {
+		return nil
+	}
+	endpoint, err := h.hostRepo.HostDockerEndpoint(ctx, source)
+	if err != nil {
+		return fmt.Errorf("failed to look up Docker endpoint of host %s: %w", source, err)
+	}
+	return h.deploymentService.CopyImage(ctx, endpoint, imageRef)
+}
+
+// SetUsageRecorder sets the usage recorder used to meter build minutes
+func (h *TaskHandler) SetUsageRecorder(usageRecorder UsageRecorder) {
+	h.usageRecorder = usageRecorder
+}
+
+// recordBuildTime meters the wall-clock time of a build against the app owner's build minutes
+// Failed builds count too - they consumed builder time
+func (h *TaskHandler) recordBuildTime(payload BuildTaskPayload, startedAt time.Time) {
+	if h.usageRecorder == nil || payload.UserID == "" {
+		return
+	}
+
+	seconds := int64(time.Since(startedAt).Round(time.Second) / time.Second)
+	if seconds < 1 {
+		seconds = 1 // Every build is billed at least one second
+	}
+
+	// Use a fresh context - the task context may already be cancelled (e.g. timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.usageRecorder.RecordUsage(ctx, payload.UserID, payload.AppID, services.UsageMetricBuildSeconds, seconds); err != nil {
+		h.logger.Warn("Failed to record build minutes",
+			zap.Error(err),
+			zap.String("app_id", payload.AppID),
+			zap.String("build_job_id", payload.BuildJobID),
+			zap.Int64("build_seconds", seconds),
+		)
+		return
+	}
+
+	h.logger.Info("Recorded build minutes",
+		zap.String("app_id", payload.AppID),
+		zap.String("user_id", payload.UserID),
+		zap.String("build_job_id", payload.BuildJobID),
+		zap.Int64("build_seconds", seconds),
+	)
+}
+
+// buildCancelled reports whether the API cancelled a build job
+// Uses a fresh context - the task context is cancelled when the API signals a running build
+func (h *TaskHandler) buildCancelled(buildJobID string) bool {
+	if h.buildJobRepo == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	status, err := h.buildJobRepo.GetBuildJobStatus(ctx, buildJobID)
+	if err != nil {
+		h.logger.Warn("Failed to check build job for cancellation", zap.Error(err), zap.String("build_job_id", buildJobID))
+		return false
+	}
+	return status == "cancelled"
+}
+
 // HandleBuildTask processes build tasks
-func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error {
+func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) (err error) {
 	var payload BuildTaskPayload
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
 		return fmt.Errorf("failed to unmarshal build task payload: %w", err)
 	}
 
+	defer h.trackBuild(payload)()
+
+	// Meter build wall-clock time (clone through image build) regardless of outcome
+	// Builds interrupted by a worker shutdown are not the owner's doing and start over, so they are not billed
+	buildStartedAt := time.Now()
+	defer func() {
+		if !errors.Is(err, ErrBuildInterrupted) {
+			h.recordBuildTime(payload, buildStartedAt)
+		}
+	}()
+
+	// Every way a build can fail ends here - builds are not retried, so each failure is final
+	defer func() {
+		if err != nil && !errors.Is(err, ErrBuildCancelled) && !errors.Is(err, ErrBuildInterrupted) {
+			h.recordAppEvent(ctx, payload.AppID, services.AppEventBuildFailed, map[string]interface{}{
+				"build_job_id": payload.BuildJobID,
+				"branch":       payload.Branch,
+				"commit_sha":   payload.CommitSHA,
+				"error":        err.Error(),
+			})
+			h.recordDeployEvent(ctx, services.DeployEvent{
+				AppID:      payload.AppID,
+				BuildJobID: payload.BuildJobID,
+				Type:       services.DeployEventBuildFailed,
+				Message:    "Build failed",
+				Data:       map[string]interface{}{"error": err.Error()},
+			})
+		}
+	}()
+
 	h.logger.Info("Processing build task",
 		zap.String("app_id", payload.AppID),
 		zap.String("build_job_id", payload.BuildJobID),
@@ -212,6 +799,22 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 		)
 	}
 
+	// Cancelled between being picked up and starting - the API already recorded it
+	if h.buildCancelled(payload.BuildJobID) {
+		h.logger.Info("Build was cancelled before it started",
+			zap.String("app_id", payload.AppID),
+			zap.String("build_job_id", payload.BuildJobID),
+		)
+		return ErrBuildCancelled
+	}
+
+	// Hold one of the owner's concurrent build slots until the build task returns
+	if h.planEnforcement != nil && payload.UserID != "" {
+		if err := h.planEnforcement.IncrementBuildCount(ctx, payload.UserID); err == nil {
+			defer h.planEnforcement.DecrementBuildCount(context.WithoutCancel(ctx), payload.UserID)
+		}
+	}
+
 	// Update app status to "building" when build starts
 	if h.appRepo != nil {
 		if err := h.appRepo.UpdateApp(payload.AppID, "building", ""); err != nil {
@@ -222,6 +825,26 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 		}
 	}
 
+	h.recordAppEvent(ctx, payload.AppID, services.AppEventBuildStarted, map[string]interface{}{
+		"build_job_id": payload.BuildJobID,
+		"repo_url":     payload.RepoURL,
+		"branch":       payload.Branch,
+		"tag":          payload.Tag,
+		"commit_sha":   payload.CommitSHA,
+	})
+	h.recordDeployEvent(ctx, services.DeployEvent{
+		AppID:      payload.AppID,
+		BuildJobID: payload.BuildJobID,
+		Type:       services.DeployEventBuildStarted,
+		Message:    "Build started",
+		Data: map[string]interface{}{
+			"repo_url":   payload.RepoURL,
+			"branch":     payload.Branch,
+			"tag":        payload.Tag,
+			"commit_sha": payload.CommitSHA,
+		},
+	})
+
 	// Step 1: Clone repository with shallow clone
 	// This always fetches the latest code from the remote repository for the specified branch.
 	// Each build gets a unique clone directory (based on BuildJobID) ensuring fresh code every time.
@@ -237,9 +860,30 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 		Depth:    1,                // Only clone the latest commit from the branch
 		UniqueID: payload.BuildJobID, // Use build job ID to create unique directory (ensures fresh clone every time)
 	}
+	// Redeploys pinned to a tag or commit check it out instead of the branch head
+	if payload.Tag != "" || payload.CommitSHA != "" {
+		cloneOpts.Branch = ""
+		cloneOpts.Tag = payload.Tag
+		cloneOpts.Commit = payload.CommitSHA
+	}
+	// Monorepo apps only fetch their root directory; an invalid root_dir fails below with ROOT_DIR_NOT_FOUND
+	if rootDir, err := services.NormalizeRootDir(payload.RootDir); err == nil {
+		cloneOpts.SparseDir = rootDir
+	}
 
 	cloneResult, err := h.gitService.Clone(ctx, cloneOpts)
 	if err != nil {
+		if ctx.Err() != nil && h.buildCancelled(payload.BuildJobID) {
+			h.logger.Info("Build cancelled during clone",
+				zap.String("app_id", payload.AppID),
+				zap.String("build_job_id", payload.BuildJobID),
+			)
+			return ErrBuildCancelled
+		}
+		if h.buildInterrupted(ctx) {
+			return h.interruptBuild(payload)
+		}
+
 		// Check if it's a StackynError and log it properly
 		var errorMsg string
 		if stackynErr, ok := stackynerrors.AsStackynError(err); ok {
@@ -284,26 +928,19 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 			deploymentID, createErr := h.deploymentRepo.CreateDeployment(
 				payload.AppID,
 				payload.BuildJobID,
-				"failed",
+				deploystate.Failed,
 				"",
 				"",
 				"",
+				deploystate.Change{Actor: deploystate.ActorDeployWorker, Reason: errorMsg},
 			)
 			if createErr == nil && deploymentID != "" {
-				// Update the deployment with error message
-				if updateErr := h.deploymentRepo.UpdateDeployment(deploymentID, "", "", "", "", errorMsg); updateErr != nil {
-					h.logger.Warn("Failed to update deployment error message",
-						zap.Error(updateErr),
-						zap.String("app_id", payload.AppID),
-						zap.String("deployment_id", deploymentID),
-					)
-				} else {
-					h.logger.Info("Created failed deployment with error message",
-						zap.String("app_id", payload.AppID),
-						zap.String("deployment_id", deploymentID),
-						zap.String("error", errorMsg),
-					)
-				}
+				h.recordDeploymentTrigger(ctx, deploymentID, payload.Trigger, payload.TriggeredBy)
+				h.logger.Info("Created failed deployment with error message",
+					zap.String("app_id", payload.AppID),
+					zap.String("deployment_id", deploymentID),
+					zap.String("error", errorMsg),
+				)
 			} else {
 				// Check if error is due to app being deleted (foreign key constraint)
 				if createErr != nil && strings.Contains(createErr.Error(), "foreign key constraint") {
@@ -325,6 +962,8 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 			)
 		}
 		
+		h.notifyDeployFailed(ctx, payload.AppID, payload.UserID, "Build", errorMsg)
+
 		return fmt.Errorf("failed to clone repository: %w", err)
 	}
 
@@ -332,18 +971,50 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 		zap.String("path", cloneResult.Path),
 		zap.String("commit_sha", cloneResult.CommitSHA),
 	)
+	h.recordDeployEvent(ctx, services.DeployEvent{
+		AppID:      payload.AppID,
+		BuildJobID: payload.BuildJobID,
+		Type:       services.DeployEventCloneFinished,
+		Message:    "Repository cloned",
+		Data: map[string]interface{}{
+			"commit_sha":     cloneResult.CommitSHA,
+			"commit_message": cloneResult.CommitMessage,
+			"branch":         cloneResult.Branch,
+		},
+	})
 
 	// Repository cloned - status will be stored in DB
 
 	// MVP constraints validation removed - allowing all repository types
 
+	// Monorepo apps are detected and built from their root directory; the rest of the clone is ignored
+	buildPath, err := services.ResolveRootDir(cloneResult.Path, payload.RootDir)
+	if err != nil {
+		h.logger.Error("Root directory not usable",
+			zap.String("app_id", payload.AppID),
+			zap.String("build_job_id", payload.BuildJobID),
+			zap.String("root_dir", payload.RootDir),
+			zap.Error(err),
+		)
+		if cleanupErr := h.gitService.Cleanup(cloneResult.Path); cleanupErr != nil {
+			h.logger.Warn("Failed to cleanup clone directory", zap.Error(cleanupErr))
+		}
+		return err
+	}
+	if buildPath != cloneResult.Path {
+		h.logger.Info("Building from repository subdirectory",
+			zap.String("app_id", payload.AppID),
+			zap.String("root_dir", payload.RootDir),
+		)
+	}
+
 	// Check for docker-compose.yml file (must be before defer to be in scope)
-	hasDockerCompose := h.hasDockerComposeFile(cloneResult.Path)
+	hasDockerCompose := h.hasDockerComposeFile(buildPath)
 	h.logger.Info("Docker Compose detection",
 		zap.String("app_id", payload.AppID),
 		zap.String("build_job_id", payload.BuildJobID),
 		zap.Bool("has_docker_compose", hasDockerCompose),
-		zap.String("repo_path", cloneResult.Path),
+		zap.String("repo_path", buildPath),
 	)
 
 	// Ensure cleanup happens even if build fails
@@ -363,12 +1034,29 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 		}
 	}()
 
+	// Create log buffer for streaming and persistence
+	var logBuffer bytes.Buffer
+	logWriter := io.MultiWriter(&logBuffer, os.Stdout) // Stream to both buffer and stdout
+
+	// Buildpacks and nixpacks detect what to build on their own, so only Dockerfile builds need a supported runtime
+	strategy := h.buildStrategy(ctx, payload.AppID)
+	if strategy == services.BuildStrategyNixpacks {
+		if strategy, err = h.nixpacksFallback(ctx, buildPath, logWriter); err != nil {
+			h.logger.Error("Nixpacks cannot build the app",
+				zap.String("app_id", payload.AppID),
+				zap.String("build_job_id", payload.BuildJobID),
+				zap.Error(err),
+			)
+			return stackynerrors.Wrap(stackynerrors.ErrorCodeRuntimeNotDetected, err, "Nixpacks could not detect how to build the app")
+		}
+	}
+
 	// Step 2: Detect runtime
 	if h.runtimeDetector == nil {
 		return fmt.Errorf("runtime detector not configured")
 	}
 
-	runtime, err := h.runtimeDetector.DetectRuntime(cloneResult.Path)
+	runtime, err := h.runtimeDetector.DetectRuntime(buildPath)
 	if err != nil {
 		h.logger.Error("Runtime detection failed",
 			zap.String("app_id", payload.AppID),
@@ -378,7 +1066,7 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 		return stackynerrors.Wrap(stackynerrors.ErrorCodeRuntimeNotDetected, err, "Failed to detect runtime")
 	}
 
-	if runtime == services.RuntimeUnknown {
+	if runtime == services.RuntimeUnknown && strategy == services.BuildStrategyDockerfile {
 		h.logger.Error("Runtime not detected",
 			zap.String("app_id", payload.AppID),
 			zap.String("build_job_id", payload.BuildJobID),
@@ -388,8 +1076,13 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 	
 	// Check for unsupported runtimes (if any)
 	// This would be handled by the runtime detector, but we can add explicit checks here
-	if runtime != services.RuntimeNodeJS && runtime != services.RuntimePython && 
-		runtime != services.RuntimeGo && runtime != services.RuntimeJava {
+	if strategy == services.BuildStrategyDockerfile &&
+		runtime != services.RuntimeNodeJS && runtime != services.RuntimePython && 
+		runtime != services.RuntimeGo && runtime != services.RuntimeJava &&
+		runtime != services.RuntimeRuby && runtime != services.RuntimePHP &&
+		runtime != services.RuntimeRust && runtime != services.RuntimeElixir &&
+		runtime != services.RuntimeDeno && runtime != services.RuntimeBun &&
+		runtime != services.RuntimeStatic {
 		h.logger.Error("Unsupported runtime detected",
 			zap.String("app_id", payload.AppID),
 			zap.String("build_job_id", payload.BuildJobID),
@@ -400,41 +1093,103 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 
 	h.logger.Info("Runtime detected",
 		zap.String("runtime", string(runtime)),
+		zap.String("build_strategy", strategy),
 	)
 
-	// Runtime detected - status will be stored in DB
-
-	// Step 3: Generate Dockerfile if missing
-	if h.dockerfileGen == nil {
-		return fmt.Errorf("dockerfile generator not configured")
+	// Recent builds of the same runtime give queued builds their ETA
+	if h.buildJobRepo != nil {
+		if err := h.buildJobRepo.SetBuildJobRuntime(ctx, payload.BuildJobID, string(runtime)); err != nil {
+			h.logger.Warn("Failed to record build runtime", zap.Error(err), zap.String("build_job_id", payload.BuildJobID))
+		}
 	}
 
-	if err := h.dockerfileGen.GenerateDockerfile(cloneResult.Path, services.Runtime(runtime)); err != nil {
-		return fmt.Errorf("failed to generate Dockerfile: %w", err)
+	// Step 3: Generate Dockerfile if missing (buildpacks and nixpacks ignore it)
+	var builder DockerBuildService
+	switch strategy {
+	case services.BuildStrategyBuildpacks:
+		builder = h.buildpacksBuilder
+	case services.BuildStrategyNixpacks:
+		builder = h.nixpacksBuilder
+	default:
+		builder = h.dockerBuild
+		if h.dockerfileGen == nil {
+			return fmt.Errorf("dockerfile generator not configured")
+		}
+
+		if err := h.dockerfileGen.GenerateDockerfile(buildPath, services.Runtime(runtime)); err != nil {
+			return fmt.Errorf("failed to generate Dockerfile: %w", err)
+		}
 	}
 
 	// Step 4: Build Docker image with resource constraints
-	if h.dockerBuild == nil {
+	if builder == nil {
 		return fmt.Errorf("docker build service not configured")
 	}
 
-	// Create log buffer for streaming and persistence
-	var logBuffer bytes.Buffer
-	logWriter := io.MultiWriter(&logBuffer, os.Stdout) // Stream to both buffer and stdout
+	// Deployments show which strategy produced their image
+	if h.buildJobRepo != nil {
+		if err := h.buildJobRepo.SetBuildJobStrategy(ctx, payload.BuildJobID, strategy); err != nil {
+			h.logger.Warn("Failed to record build strategy", zap.Error(err), zap.String("build_job_id", payload.BuildJobID))
+		}
+	}
 
 	// Generate image name
 	imageName := fmt.Sprintf("stackyn-%s", payload.AppID)
 	imageTag := payload.BuildJobID
 
 	buildOpts := services.BuildOptions{
-		ContextPath: cloneResult.Path,
+		ContextPath: buildPath,
 		ImageName:   imageName,
 		Tag:         imageTag,
+		PullParent:  payload.Trigger == deploystate.TriggerSecurityRebuild, // The cached base is the outdated one
+		Limits:      services.DefaultBuildLimits(),
+	}
+	if h.planEnforcement != nil && payload.UserID != "" {
+		if limits, err := h.planEnforcement.GetBuildLimits(ctx, payload.UserID); err == nil {
+			buildOpts.Limits = limits
+		} else {
+			h.logger.Warn("Failed to get build limits from plan - using the defaults", zap.Error(err), zap.String("app_id", payload.AppID))
+		}
 	}
 
 	// Building Docker image - status will be stored in DB
 
-	buildResult, err := h.dockerBuild.BuildImage(ctx, buildOpts, logWriter)
+	// Committed credentials (when the app blocks them) and chaos faults fail the build here so they take the
+	// same failure path as a real one
+	var buildResult *services.BuildResult
+	if err = h.scanSecrets(ctx, payload, buildPath, logWriter); err == nil {
+		if h.faultInjector != nil && h.faultInjector.ShouldFailBuild(ctx, payload.AppID) {
+			fmt.Fprintln(logWriter, "[chaos] Build failed by injected fault")
+			err = fmt.Errorf("build failed: injected chaos fault")
+		} else {
+			buildResult, err = builder.BuildImage(ctx, buildOpts, logWriter)
+		}
+	}
+	if err != nil && ctx.Err() != nil && h.buildCancelled(payload.BuildJobID) {
+		// Keep what the build printed before it was stopped
+		fmt.Fprintln(logWriter, "Build cancelled")
+		if h.logPersister != nil {
+			logEntry := services.LogEntry{
+				AppID:      payload.AppID,
+				BuildJobID: payload.BuildJobID,
+				LogType:    string(services.LogTypeBuild),
+				Timestamp:  time.Now(),
+				Content:    logBuffer.String(),
+				Size:       int64(logBuffer.Len()),
+			}
+			if persistErr := h.logPersister.PersistLog(context.Background(), logEntry); persistErr != nil {
+				h.logger.Warn("Failed to persist build logs", zap.Error(persistErr))
+			}
+		}
+		h.logger.Info("Build cancelled during image build",
+			zap.String("app_id", payload.AppID),
+			zap.String("build_job_id", payload.BuildJobID),
+		)
+		return ErrBuildCancelled
+	}
+	if err != nil && h.buildInterrupted(ctx) {
+		return h.interruptBuild(payload)
+	}
 	if err != nil {
 		// Persist logs even on failure
 		if h.logPersister != nil {
@@ -456,7 +1211,15 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 		
 		// Determine error code based on error type
 		var errorCode stackynerrors.ErrorCode = stackynerrors.ErrorCodeBuildFailed
-		if strings.Contains(err.Error(), "timeout") || strings.Contains(err.Error(), "deadline exceeded") {
+		if errors.Is(err, services.ErrSecretsDetected) {
+			// The image was never built, so the logs hold the findings rather than a build error
+			errorCode = stackynerrors.ErrorCodeSecretsDetected
+			errorMsg = err.Error()
+		} else if errors.Is(err, services.ErrBuildTimeout) {
+			// Whatever the logs last printed, the build was stopped for running past the plan's timeout
+			errorCode = stackynerrors.ErrorCodeBuildTimeout
+			errorMsg = err.Error()
+		} else if strings.Contains(err.Error(), "timeout") || strings.Contains(err.Error(), "deadline exceeded") {
 			errorCode = stackynerrors.ErrorCodeBuildTimeout
 		}
 		
@@ -503,33 +1266,24 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 				zap.String("app_id", payload.AppID),
 				zap.String("build_job_id", payload.BuildJobID),
 			)
+			// The error message includes the error code
 			deploymentID, createErr := h.deploymentRepo.CreateDeployment(
 				payload.AppID,
 				payload.BuildJobID,
-				"failed",
+				deploystate.Failed,
 				"",
 				"",
 				"",
+				deploystate.Change{Actor: deploystate.ActorDeployWorker, Reason: errorMsgForDB},
 			)
 			if createErr == nil && deploymentID != "" {
-				h.logger.Info("Deployment created, updating with error message",
+				h.recordDeploymentTrigger(ctx, deploymentID, payload.Trigger, payload.TriggeredBy)
+				h.recordDeploymentCommit(ctx, deploymentID, cloneResult.Commit())
+				h.logger.Info("Created failed deployment with error message",
 					zap.String("app_id", payload.AppID),
 					zap.String("deployment_id", deploymentID),
+					zap.String("error", errorMsg),
 				)
-				// Update the deployment with error message (include error code)
-				if updateErr := h.deploymentRepo.UpdateDeployment(deploymentID, "", "", "", "", errorMsgForDB); updateErr != nil {
-					h.logger.Warn("Failed to update deployment error message",
-						zap.Error(updateErr),
-						zap.String("app_id", payload.AppID),
-						zap.String("deployment_id", deploymentID),
-					)
-				} else {
-					h.logger.Info("Created failed deployment with error message",
-						zap.String("app_id", payload.AppID),
-						zap.String("deployment_id", deploymentID),
-						zap.String("error", errorMsg),
-					)
-				}
 			} else {
 				// Check if error is due to app being deleted (foreign key constraint)
 				if createErr != nil && strings.Contains(createErr.Error(), "foreign key constraint") {
@@ -560,6 +1314,8 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 			}
 		}
 
+		h.notifyDeployFailed(ctx, payload.AppID, payload.UserID, "Build", errorMsg)
+
 		// Return clear error message - will be stored in DB by task persistence
 		// Return StackynError for proper error handling
 		return stackynErr
@@ -580,6 +1336,15 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 		}
 	}
 
+	// A build cancelled just as the image finished is not deployed
+	if h.buildCancelled(payload.BuildJobID) {
+		h.logger.Info("Build cancelled after the image was built - not deploying",
+			zap.String("app_id", payload.AppID),
+			zap.String("build_job_id", payload.BuildJobID),
+		)
+		return ErrBuildCancelled
+	}
+
 	// Update build_job status to "completed"
 	if h.buildJobRepo != nil {
 		if err := h.buildJobRepo.UpdateBuildJob(ctx, payload.BuildJobID, "completed", logBuffer.String(), ""); err != nil {
@@ -588,6 +1353,17 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 				zap.String("build_job_id", payload.BuildJobID),
 			)
 		}
+
+		// The deploy worker watches this base image for security updates
+		if buildResult.BaseImage != "" {
+			if err := h.buildJobRepo.SetBuildJobBaseImage(ctx, payload.BuildJobID, buildResult.BaseImage, buildResult.BaseImageDigest); err != nil {
+				h.logger.Warn("Failed to record build base image",
+					zap.Error(err),
+					zap.String("build_job_id", payload.BuildJobID),
+					zap.String("base_image", buildResult.BaseImage),
+				)
+			}
+		}
 	}
 
 	h.logger.Info("Build task completed",
@@ -597,9 +1373,25 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 		zap.String("image_id", buildResult.ImageID),
 		zap.String("image_name", buildResult.ImageName),
 	)
+	h.recordDeployEvent(ctx, services.DeployEvent{
+		AppID:      payload.AppID,
+		BuildJobID: payload.BuildJobID,
+		Type:       services.DeployEventImageBuilt,
+		Message:    "Image built",
+		Data: map[string]interface{}{
+			"image":            buildResult.ImageName,
+			"duration_seconds": int(time.Since(buildStartedAt).Seconds()),
+		},
+	})
 
 	// Build completed - status will be stored in DB
 
+	// Record the Procfile's worker processes so the deploy can run the enabled ones
+	h.recordProcesses(ctx, payload.AppID, buildPath)
+
+	// Scan the image before it is deployed, so the deploy can be held to the organization's policy
+	h.scanImage(ctx, payload, buildResult.ImageName)
+
 	// Step 6: Enqueue deploy task after successful build
 	if h.taskEnqueue != nil {
 		// Generate deployment ID
@@ -623,6 +1415,14 @@ func (h *TaskHandler) HandleBuildTask(ctx context.Context, t *asynq.Task) error
 			RequestedRAMMB: 512,
 			UseDockerCompose: hasDockerCompose,
 			RepoPath:      cloneResult.Path, // Pass repo path for docker-compose deployment
+			RootDir:       payload.RootDir,
+			CommitSHA:     cloneResult.CommitSHA,
+			CommitAuthor:  cloneResult.CommitAuthor,
+			CommitMessage: cloneResult.CommitMessage,
+			CommitBranch:  cloneResult.Branch,
+			Trigger:       payload.Trigger,
+			TriggeredBy:   payload.TriggeredBy,
+			ImageHost:     h.nodeName,
 		}
 
 		// Enqueue deploy task
@@ -673,6 +1473,23 @@ func (h *TaskHandler) HandleDeployTask(ctx context.Context, t *asynq.Task) error
 		zap.String("build_job_id", payload.BuildJobID),
 	)
 
+	// A drained node takes no new containers - leave the deploy to a worker on another node
+	// Deploys placed on this node are placed again; the others go back onto the shared queue
+	if h.hostDraining(ctx) {
+		if h.rescheduleDeploy(ctx, payload) {
+			h.logger.Info("Host is draining, rescheduled deploy task",
+				zap.String("app_id", payload.AppID),
+				zap.String("host", h.nodeName),
+			)
+			return nil
+		}
+		h.logger.Info("Host is draining, returning deploy task to the queue",
+			zap.String("app_id", payload.AppID),
+			zap.String("host", h.nodeName),
+		)
+		return ErrHostDraining
+	}
+
 	// Update app status to "deploying" when deployment starts
 	if h.appRepo != nil {
 		if err := h.appRepo.UpdateApp(payload.AppID, "deploying", ""); err != nil {
@@ -683,6 +1500,21 @@ func (h *TaskHandler) HandleDeployTask(ctx context.Context, t *asynq.Task) error
 		}
 	}
 
+	// Chaos: stall the deploy while the app shows as deploying
+	if h.faultInjector != nil {
+		if delay := h.faultInjector.DeployDelay(ctx, payload.AppID); delay > 0 {
+			h.logger.Warn("Delaying deployment (chaos fault)",
+				zap.String("app_id", payload.AppID),
+				zap.Duration("delay", delay),
+			)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
 	// Extract user ID from payload
 	userID := payload.UserID
 	if userID == "" {
@@ -745,6 +1577,9 @@ func (h *TaskHandler) HandleDeployTask(ctx context.Context, t *asynq.Task) error
 	// Default port (can be overridden via env vars)
 	port := 8080
 
+	// Set once the container is up, so the deferred RAM settlement knows whether to release
+	deployed := false
+
 	// Plan-based resource limits
 	// Default values, will be overridden by plan limits if plan enforcement is enabled
 	memoryMB := 512 // Default: 512 MB
@@ -760,15 +1595,13 @@ func (h *TaskHandler) HandleDeployTask(ctx context.Context, t *asynq.Task) error
 		// 	return fmt.Errorf("plan limit exceeded: %w", err)
 		// }
 
-		// Increment RAM usage (still track usage, but don't enforce limits)
-		if err := h.planEnforcement.IncrementRAMUsage(ctx, userID, memoryMB); err != nil {
-			h.logger.Warn("Failed to increment RAM usage", zap.Error(err))
-		}
+		// Reserve RAM for the app (still track usage, but don't enforce limits)
+		// A redeploy replaces the app's previous reservation rather than adding to it
+		previousRAMMB := h.planEnforcement.ReserveAppRAM(ctx, userID, payload.AppID, memoryMB)
 
-		// Decrement RAM usage on exit (if deployment fails)
+		// Hand the RAM back if the deployment fails - the previous container (if any) keeps its share
 		defer func() {
-			// Only decrement if deployment failed
-			// Successful deployments should keep RAM usage tracked
+			h.planEnforcement.SettleAppRAM(ctx, payload.AppID, deployed, previousRAMMB)
 		}()
 	}
 
@@ -777,38 +1610,67 @@ func (h *TaskHandler) HandleDeployTask(ctx context.Context, t *asynq.Task) error
 		CPU:      0.5, // Default: 0.5 CPU
 	}
 
-	// Retrieve environment variables from database
-	envVars := make(map[string]string)
-	if h.envVarRepo != nil {
-		envVarList, err := h.envVarRepo.GetEnvVarsByAppID(ctx, payload.AppID)
+	// Environment variables: an earlier deployment's snapshot when asked for, otherwise the app's current ones
+	envVars, envFromDeploymentID := h.deploymentEnvVars(ctx, payload.AppID, payload.EnvFromDeploymentID)
+
+	// Retrieve verified custom domains so the container also answers on them
+	var customDomains []string
+	if h.domainRepo != nil {
+		domains, err := h.domainRepo.GetVerifiedDomainsByAppID(ctx, payload.AppID)
 		if err != nil {
-			h.logger.Warn("Failed to retrieve environment variables from database",
+			h.logger.Warn("Failed to retrieve custom domains - deploying without them",
 				zap.Error(err),
 				zap.String("app_id", payload.AppID),
 			)
-			// Continue with empty env vars rather than failing deployment
 		} else {
-			// Convert []*EnvVar to map[string]string
-			for _, envVar := range envVarList {
-				if envVar != nil && envVar.Key != "" {
-					envVars[envVar.Key] = envVar.Value
-				}
-			}
-			if len(envVars) > 0 {
-				h.logger.Info("Retrieved environment variables for deployment",
-					zap.String("app_id", payload.AppID),
-					zap.Int("count", len(envVars)),
-				)
-			}
+			customDomains = domains
+		}
+	}
+
+	// WAF middleware the app opted into (the drift detector re-applies it if this lookup fails)
+	var waf *services.WAFConfig
+	if h.wafRepo != nil {
+		cfg, err := h.wafRepo.GetAppWAF(ctx, payload.AppID)
+		if err != nil {
+			h.logger.Warn("Failed to retrieve WAF settings - deploying without WAF",
+				zap.Error(err),
+				zap.String("app_id", payload.AppID),
+			)
+		} else {
+			waf = cfg
+		}
+	}
+
+	// Routing options the app configured (the drift detector re-applies them if this lookup fails)
+	var routing *services.RoutingConfig
+	if h.routingRepo != nil {
+		cfg, err := h.routingRepo.GetAppRouting(ctx, payload.AppID)
+		if err != nil {
+			h.logger.Warn("Failed to retrieve routing settings - deploying with the defaults",
+				zap.Error(err),
+				zap.String("app_id", payload.AppID),
+			)
+		} else {
+			routing = cfg
 		}
-	} else {
-		h.logger.Warn("EnvVarRepo not available - deploying without environment variables",
-			zap.String("app_id", payload.AppID),
-		)
+	}
+
+	// Deploys placed on another node than the one that built their image copy it from there first
+	var imageErr error
+	if payload.SourceImage == "" && !payload.UseDockerCompose {
+		imageErr = h.ensureImage(ctx, payload, fmt.Sprintf("%s:%s", imageName, imageTag))
+	}
+
+	// Static sites answer health checks on their own path, whatever pages the site has
+	staticSite := h.isStaticSiteImage(ctx, fmt.Sprintf("%s:%s", imageName, imageTag))
+	healthCheck := h.healthCheckOptions(ctx, payload.AppID, userID)
+	if staticSite && healthCheck.Path == "/" {
+		healthCheck.Path = services.StaticSiteHealthPath
 	}
 
 	// Prepare deployment options
 	deployOpts := services.DeploymentOptions{
+		HealthCheck:  healthCheck,
 		AppID:        payload.AppID,
 		DeploymentID: payload.DeploymentID,
 		ImageName:    imageName,
@@ -819,13 +1681,37 @@ func (h *TaskHandler) HandleDeployTask(ctx context.Context, t *asynq.Task) error
 		EnvVars:      envVars, // Environment variables from database
 		UseDockerCompose: payload.UseDockerCompose,
 		ComposeFilePath: payload.RepoPath, // Path to repository containing docker-compose.yml
+		CustomDomains:   customDomains,
+		ZeroDowntime:    h.planEnforcement != nil && h.planEnforcement.CheckZeroDowntime(ctx, userID) == nil,
+		WAF:             waf,
+		Routing:         routing,
+		Isolation:       h.isolationLevel(ctx, payload.AppID, userID),
 	}
 
 	// Deploy container (using docker-compose if detected)
 	var deployResult *services.DeploymentResult
-	var err error
+	err := imageErr
+
+	// Image apps skip the build: their registry image is pulled here under the name the deployment runs
+	var sourceDigest string
+	if payload.SourceImage != "" {
+		sourceDigest, err = h.pullSourceImage(ctx, payload, imageName, imageTag)
+	}
+
+	// Organizations can refuse images whose scan found critical vulnerabilities
+	if err == nil {
+		err = h.checkVulnerabilityPolicy(ctx, payload)
+	}
 	
-	if payload.UseDockerCompose {
+	// Release phase: runs before any traffic moves, so if it fails the previous deployment stays live
+	// Compose deployments have no single app image to run it in
+	if err == nil && !payload.UseDockerCompose {
+		err = h.runReleasePhase(ctx, payload, fmt.Sprintf("%s:%s", imageName, imageTag), envVars, limits)
+	}
+
+	if err != nil {
+		// The copy, the pull, the vulnerability policy or the release command failed - recorded as a failed deployment below
+	} else if payload.UseDockerCompose {
 		// If docker-compose is needed, ensure we have the repo path
 		repoPath := payload.RepoPath
 		if repoPath == "" || !h.pathExists(repoPath) {
@@ -841,7 +1727,8 @@ func (h *TaskHandler) HandleDeployTask(ctx context.Context, t *asynq.Task) error
 			zap.String("app_id", payload.AppID),
 			zap.String("repo_path", repoPath),
 		)
-		deployOpts.ComposeFilePath = repoPath
+		// The whole clone is cleaned up below; the compose file lives in the app's root directory
+		deployOpts.ComposeFilePath = filepath.Join(repoPath, filepath.FromSlash(payload.RootDir))
 		deployResult, err = h.deploymentService.DeployWithDockerCompose(ctx, deployOpts)
 		
 		// Cleanup repo path after docker-compose deployment completes (success or failure)
@@ -871,25 +1758,33 @@ func (h *TaskHandler) HandleDeployTask(ctx context.Context, t *asynq.Task) error
 			deploymentID, createErr := h.deploymentRepo.CreateDeployment(
 				payload.AppID,
 				payload.BuildJobID,
-				"failed",
+				deploystate.Failed,
 				fullImageName,
 				"",
 				subdomain,
+				deploystate.Change{Actor: deploystate.ActorDeployWorker, Reason: errorMsg},
 			)
-		if createErr == nil && deploymentID != "" {
-			// Update with error message
-			updateErr := h.deploymentRepo.UpdateDeployment(deploymentID, "", "", "", "", errorMsg)
-				if updateErr != nil {
-					h.logger.Warn("Failed to update deployment error message", zap.Error(updateErr))
-				} else {
+			if createErr == nil && deploymentID != "" {
+				h.recordDeploymentTrigger(ctx, deploymentID, payload.Trigger, payload.TriggeredBy)
+				h.recordDeploymentCommit(ctx, deploymentID, payload.commit())
 				h.logger.Debug("Failed deployment recorded in database",
 					zap.String("app_id", payload.AppID),
 					zap.String("deployment_id", deploymentID),
 				)
-				}
 			} else {
 				h.logger.Warn("Failed to store failed deployment in database", zap.Error(createErr))
 			}
+			h.recordDeployEvent(ctx, services.DeployEvent{
+				AppID:        payload.AppID,
+				BuildJobID:   payload.BuildJobID,
+				DeploymentID: deploymentID,
+				Type:         services.DeployEventDeployFailed,
+				Message:      "Deployment failed",
+				Data: map[string]interface{}{
+					"image": fullImageName,
+					"error": errorMsg,
+				},
+			})
 		}
 		
 		h.logger.Error("Deployment failed",
@@ -898,6 +1793,15 @@ func (h *TaskHandler) HandleDeployTask(ctx context.Context, t *asynq.Task) error
 			zap.Error(err),
 		)
 		
+		h.notifyDeployFailed(ctx, payload.AppID, payload.UserID, "Deployment", err.Error())
+		if isFinalAttempt(ctx) {
+			h.recordAppEvent(ctx, payload.AppID, services.AppEventDeployFailed, map[string]interface{}{
+				"build_job_id": payload.BuildJobID,
+				"image":        fmt.Sprintf("%s:%s", imageName, imageTag),
+				"error":        err.Error(),
+			})
+		}
+
 		return fmt.Errorf("failed to deploy container: %w", err)
 	}
 
@@ -911,7 +1815,8 @@ func (h *TaskHandler) HandleDeployTask(ctx context.Context, t *asynq.Task) error
 
 	// Mark old deployments as "stopped" if containers were stopped
 	if len(deployResult.StoppedContainerIDs) > 0 && h.deploymentRepo != nil {
-		if err := h.deploymentRepo.UpdateDeploymentsByContainerIDs(ctx, deployResult.StoppedContainerIDs, "stopped"); err != nil {
+		change := deploystate.Change{Actor: deploystate.ActorDeployWorker, Reason: "Replaced by a new deployment"}
+		if err := h.deploymentRepo.StopDeploymentsByContainerIDs(ctx, deployResult.StoppedContainerIDs, change); err != nil {
 			h.logger.Warn("Failed to update old deployments to stopped status",
 				zap.Error(err),
 				zap.String("app_id", payload.AppID),
@@ -942,10 +1847,11 @@ func (h *TaskHandler) HandleDeployTask(ctx context.Context, t *asynq.Task) error
 		dbDeploymentID, err = h.deploymentRepo.CreateDeployment(
 			payload.AppID,
 			payload.BuildJobID,
-			deployResult.Status,
+			deploystate.Status(deployResult.Status),
 			fullImageName,
 			deployResult.ContainerID,
 			deployOpts.Subdomain,
+			deploystate.Change{Actor: deploystate.ActorDeployWorker},
 		)
 		if err != nil {
 			// If creation fails (e.g., duplicate), try to update by finding existing deployment
@@ -961,21 +1867,91 @@ func (h *TaskHandler) HandleDeployTask(ctx context.Context, t *asynq.Task) error
 				zap.String("app_id", payload.AppID),
 				zap.String("deployment_id", payload.DeploymentID),
 			)
+
+			if h.nodeName != "" {
+				if err := h.deploymentRepo.SetDeploymentNode(ctx, dbDeploymentID, h.nodeName, h.nodeRegion); err != nil {
+					h.logger.Warn("Failed to record deployment node",
+						zap.Error(err),
+						zap.String("db_deployment_id", dbDeploymentID),
+					)
+				}
+			}
+
+			// Snapshot the exact env the container was started with
+			if err := h.deploymentRepo.SetEnvSnapshot(ctx, dbDeploymentID, envVars, envFromDeploymentID); err != nil {
+				h.logger.Warn("Failed to store env snapshot on deployment",
+					zap.Error(err),
+					zap.String("db_deployment_id", dbDeploymentID),
+				)
+			}
+
+			// Record the commit and runtime config so deployments can be compared
+			if err := h.deploymentRepo.SetDeploymentHistory(ctx, dbDeploymentID, payload.commit(), services.NewDeploymentConfigSnapshot(deployOpts, payload.RootDir)); err != nil {
+				h.logger.Warn("Failed to store commit and config on deployment",
+					zap.Error(err),
+					zap.String("db_deployment_id", dbDeploymentID),
+				)
+			}
+
+			h.recordDeploymentTrigger(ctx, dbDeploymentID, payload.Trigger, payload.TriggeredBy)
+
+			// Record rollback in deployment history
+			if payload.RollbackFromDeploymentID != "" {
+				if err := h.deploymentRepo.MarkDeploymentAsRollback(dbDeploymentID, payload.RollbackFromDeploymentID); err != nil {
+					h.logger.Warn("Failed to record rollback source on deployment",
+						zap.Error(err),
+						zap.String("db_deployment_id", dbDeploymentID),
+						zap.String("rollback_from_deployment_id", payload.RollbackFromDeploymentID),
+					)
+				}
+			}
 		}
 	} else {
 		h.logger.Warn("Deployment repository not available - deployment not stored in DB")
 	}
 
+	h.recordDeployEvent(ctx, services.DeployEvent{
+		AppID:        payload.AppID,
+		BuildJobID:   payload.BuildJobID,
+		DeploymentID: dbDeploymentID,
+		Type:         services.DeployEventContainerStarted,
+		Message:      "Container started",
+		Data: map[string]interface{}{
+			"container_id": deployResult.ContainerID,
+			"image":        fmt.Sprintf("%s:%s", imageName, imageTag),
+			"status":       deployResult.Status,
+		},
+	})
+	// The new container only gets traffic once it is running; containers it replaced are stopped after that
+	if deployResult.Status == "running" {
+		h.recordDeployEvent(ctx, services.DeployEvent{
+			AppID:        payload.AppID,
+			BuildJobID:   payload.BuildJobID,
+			DeploymentID: dbDeploymentID,
+			Type:         services.DeployEventRouteSwitched,
+			Message:      fmt.Sprintf("Traffic routed to the new container at %s", deploymentURL(deployOpts.Subdomain)),
+			Data: map[string]interface{}{
+				"url":                 deploymentURL(deployOpts.Subdomain),
+				"replaced_containers": len(deployResult.StoppedContainerIDs),
+			},
+		})
+	}
+
+	// The app now runs this digest; image update checks compare against it
+	if sourceDigest != "" {
+		if err := h.imageAppRepo.SetImageDigest(ctx, payload.AppID, sourceDigest); err != nil {
+			h.logger.Warn("Failed to record deployed image digest",
+				zap.Error(err),
+				zap.String("app_id", payload.AppID),
+				zap.String("digest", sourceDigest),
+			)
+		}
+	}
+
 	// Update app status and URL after successful deployment
 	if h.appRepo != nil && deployResult.Status == "running" {
 		// Generate URL from subdomain
-		// Use HTTP for .local domains, HTTPS for production domains
-		var appURL string
-		if strings.HasSuffix(deployOpts.Subdomain, ".local") || strings.HasSuffix(deployOpts.Subdomain, ".localhost") {
-			appURL = fmt.Sprintf("http://%s", deployOpts.Subdomain)
-		} else {
-			appURL = fmt.Sprintf("https://%s", deployOpts.Subdomain)
-		}
+		appURL := deploymentURL(deployOpts.Subdomain)
 		
 		// First, set status to "running" (will be updated to "error" if health check fails)
 		if err := h.appRepo.UpdateApp(payload.AppID, "running", appURL); err != nil {
@@ -992,6 +1968,14 @@ func (h *TaskHandler) HandleDeployTask(ctx context.Context, t *asynq.Task) error
 				zap.String("url", appURL),
 			)
 
+			h.notifyFirstDeploy(ctx, payload.AppID, payload.UserID, services.FirstDeploySummary{
+				URL:          appURL,
+				DeploymentID: dbDeploymentID,
+				Image:        deployedImage(payload, imageName, imageTag, sourceDigest),
+				CommitSHA:    payload.CommitSHA,
+				DeployedAt:   time.Now().UTC(),
+			})
+
 			// Wait a bit for container to fully start and Traefik to configure
 			// Then run initial health check (use DB deployment ID for health check)
 			// Give extra time for SSL certificate issuance (Let's Encrypt can take 1-2 minutes)
@@ -1006,6 +1990,31 @@ func (h *TaskHandler) HandleDeployTask(ctx context.Context, t *asynq.Task) error
 		h.logger.Warn("App repository not available - app status not updated")
 	}
 
+	// A container that crashed straight away was reported before its deployment existed; report it again
+	// now so the deployment is marked crashed instead of staying running
+	if dbDeploymentID != "" && h.deploymentService.ReplayContainerCrash(deployResult.ContainerID) {
+		h.logger.Warn("Container crashed during deploy",
+			zap.String("app_id", payload.AppID),
+			zap.String("container_id", deployResult.ContainerID),
+			zap.String("db_deployment_id", dbDeploymentID),
+		)
+	}
+
+	deployed = true
+	if deployResult.Status == "running" {
+		// Compose apps declare their own services; everything else runs its enabled Procfile workers
+		if !payload.UseDockerCompose {
+			h.deployWorkers(ctx, payload, fmt.Sprintf("%s:%s", imageName, imageTag), envVars, limits, staticSite)
+		}
+
+		h.recordAppEvent(ctx, payload.AppID, services.AppEventDeploySucceeded, map[string]interface{}{
+			"deployment_id": dbDeploymentID,
+			"build_job_id":  payload.BuildJobID,
+			"image":         fmt.Sprintf("%s:%s", imageName, imageTag),
+			"url":           deploymentURL(deployOpts.Subdomain),
+			"rollback":      payload.RollbackFromDeploymentID != "",
+		})
+	}
 	return nil
 }
 
@@ -1018,38 +2027,67 @@ func (h *TaskHandler) HandleCleanupTask(ctx context.Context, t *asynq.Task) erro
 
 	h.logger.Info("Processing cleanup task",
 		zap.String("app_id", payload.AppID),
+		zap.String("trigger", payload.Trigger),
 		zap.Strings("container_ids", payload.ContainerIDs),
 		zap.Strings("image_names", payload.ImageNames),
 	)
 
-	if h.cleanupService == nil {
-		return fmt.Errorf("cleanup service not configured")
+	return h.runCleanup(ctx, payload.Trigger)
+}
+
+// SetDeploymentRetention enables pruning deployment history during cleanup
+// Each app keeps its newest keepPerApp deployments; finished ones beyond those older than maxAge are
+// deleted, and their images removed once no remaining deployment uses them
+func (h *TaskHandler) SetDeploymentRetention(retentionRepo DeploymentRetentionRepository, keepPerApp int, maxAge time.Duration) {
+	h.retentionRepo = retentionRepo
+	h.retentionKeep = keepPerApp
+	h.retentionMaxAge = maxAge
+}
+
+// SetLogSearchRetention enables pruning log lines indexed for search during cleanup
+func (h *TaskHandler) SetLogSearchRetention(logSearchRepo LogSearchRetentionRepository, maxAge time.Duration) {
+	h.logSearchRepo = logSearchRepo
+	h.logSearchMaxAge = maxAge
+}
+
+// pruneLogSearch deletes indexed log lines past the retention; the log files themselves are kept
+func (h *TaskHandler) pruneLogSearch(ctx context.Context) {
+	if h.logSearchRepo == nil {
+		return
 	}
 
-	// Run cleanup operation
-	result, err := h.cleanupService.RunCleanup(ctx)
+	pruned, err := h.logSearchRepo.PruneLogLines(ctx, time.Now().UTC().Add(-h.logSearchMaxAge))
 	if err != nil {
-		return fmt.Errorf("cleanup operation failed: %w", err)
+		h.logger.Warn("Failed to prune indexed log lines", zap.Error(err), zap.Int64("lines_pruned", pruned))
+		return
 	}
+	if pruned > 0 {
+		h.logger.Info("Pruned indexed log lines", zap.Int64("lines_pruned", pruned))
+	}
+}
 
-	// Log results
-	h.logger.Info("Cleanup task completed",
-		zap.String("app_id", payload.AppID),
-		zap.Int("containers_removed", result.ContainersRemoved),
-		zap.Int("images_removed", result.ImagesRemoved),
-		zap.Int64("space_freed_mb", result.SpaceFreedMB),
-		zap.Int("temp_dirs_pruned", result.TempDirsPruned),
-		zap.Int("errors", len(result.Errors)),
-	)
+// pruneDeploymentHistory deletes deployments past the retention settings and removes their images
+// Failures are logged only - the next cleanup picks up where this one stopped
+func (h *TaskHandler) pruneDeploymentHistory(ctx context.Context) {
+	if h.retentionRepo == nil {
+		return
+	}
 
-	// Log any errors that occurred
-	if len(result.Errors) > 0 {
-		for _, errMsg := range result.Errors {
-			h.logger.Warn("Cleanup error", zap.String("error", errMsg))
-		}
+	pruned, images, err := h.retentionRepo.PruneDeployments(ctx, h.retentionKeep, time.Now().UTC().Add(-h.retentionMaxAge))
+	if err != nil {
+		h.logger.Warn("Failed to prune deployment history", zap.Error(err))
+		return
+	}
+	if pruned == 0 {
+		return
 	}
 
-	return nil
+	imagesRemoved, spaceFreedMB := h.cleanupService.RemoveDeploymentImages(ctx, images)
+	h.logger.Info("Pruned deployment history",
+		zap.Int("deployments_pruned", pruned),
+		zap.Int("images_removed", imagesRemoved),
+		zap.Int64("space_freed_mb", spaceFreedMB),
+	)
 }
 
 // extractBuildError extracts meaningful, user-friendly error messages from build logs
@@ -1098,6 +2136,11 @@ func (h *TaskHandler) extractSpecificError(lines []string) string {
 	logsText := strings.Join(lines, "\n")
 	lowerLogs := strings.ToLower(logsText)
 	
+	// A build step killed at the plan's build memory limit exits with 137
+	if strings.Contains(lowerLogs, "build ran out of memory") || strings.Contains(lowerLogs, "returned a non-zero code: 137") {
+		return "Build ran out of memory. Reduce the memory your build steps use (e.g. fewer parallel jobs) or upgrade your plan for a higher build memory limit."
+	}
+	
 	// Poetry errors
 	if strings.Contains(lowerLogs, "poetry") {
 		if strings.Contains(lowerLogs, "group(s) not found") {
@@ -1162,10 +2205,13 @@ func (h *TaskHandler) extractSpecificError(lines []string) string {
 	if strings.Contains(lowerLogs, "paketo buildpacks build failed") {
 		return "Buildpack build failed. Please ensure your application has the required configuration files (package.json for Node.js, requirements.txt or pyproject.toml for Python, go.mod for Go, pom.xml for Java)."
 	}
+	if strings.Contains(lowerLogs, "nixpacks build failed") {
+		return "Nixpacks build failed. Check the build logs above, or add a nixpacks.toml to configure the build and start commands."
+	}
 	
 	// Docker errors
 	if strings.Contains(lowerLogs, "dockerfile") && strings.Contains(lowerLogs, "not found") {
-		return "Dockerfile not found. Please ensure your repository contains a Dockerfile, or use a supported runtime (Node.js, Python, Go, Java) with the required configuration files."
+		return "Dockerfile not found. Please ensure your repository contains a Dockerfile, or use a supported runtime (Node.js, Python, Go, Java, Ruby, PHP, Rust, Elixir, Deno, Bun) with the required configuration files."
 	}
 	
 	return ""
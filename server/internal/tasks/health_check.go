@@ -2,9 +2,11 @@ package tasks
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"go.uber.org/zap"
+	"stackyn/server/internal/deploystate"
 	"stackyn/server/internal/services"
 )
 
@@ -34,24 +36,22 @@ func (h *TaskHandler) performHealthCheck(ctx context.Context, appID, deploymentI
 			zap.String("error", errorMsg),
 		)
 
-		// Check if deployment is stopped - if so, don't set error messages
-		// This prevents "container not found" errors from appearing for stopped deployments
-		if h.deploymentRepo != nil {
-			deployment, err := h.deploymentRepo.GetDeploymentByID(deploymentID)
-			if err == nil && deployment != nil {
-				if status, ok := deployment["status"].(string); ok && status == "stopped" {
-					h.logger.Info("Skipping health check error for stopped deployment",
-						zap.String("deployment_id", deploymentID),
-						zap.String("error", errorMsg),
-					)
-					return // Don't update error message for stopped deployments
-				}
-			}
-		}
-
 		// Update deployment status to error (always update the specific deployment)
+		// The state machine refuses it for stopped or failed deployments, so "container not found"
+		// errors never appear on deployments that were replaced
 		if h.deploymentRepo != nil {
-			err := h.deploymentRepo.UpdateDeployment(deploymentID, "error", "", containerID, "", errorMsg)
+			// Monitoring outlives the deploy task, so its context may be done by now
+			err := h.deploymentRepo.TransitionDeployment(context.Background(), deploymentID, deploystate.Error, deploystate.Change{
+				Actor:  deploystate.ActorHealthCheck,
+				Reason: errorMsg,
+			})
+			if errors.Is(err, deploystate.ErrIllegalTransition) {
+				h.logger.Info("Skipping health check error for inactive deployment",
+					zap.String("deployment_id", deploymentID),
+					zap.String("error", errorMsg),
+				)
+				return
+			}
 			if err != nil {
 				h.logger.Error("Failed to update deployment status to error",
 					zap.Error(err),
@@ -127,11 +127,25 @@ func (h *TaskHandler) performHealthCheck(ctx context.Context, appID, deploymentI
 				zap.String("deployment_id", deploymentID),
 				zap.Error(err),
 			)
+			h.recordDeployEvent(ctx, services.DeployEvent{
+				AppID:        appID,
+				DeploymentID: deploymentID,
+				Type:         services.DeployEventHealthCheckFailed,
+				Message:      "Health check failed",
+				Data:         map[string]interface{}{"url": url, "error": err.Error()},
+			})
 		} else {
 			h.logger.Info("Initial health check passed",
 				zap.String("app_id", appID),
 				zap.String("deployment_id", deploymentID),
 			)
+			h.recordDeployEvent(ctx, services.DeployEvent{
+				AppID:        appID,
+				DeploymentID: deploymentID,
+				Type:         services.DeployEventHealthCheckPassed,
+				Message:      "Health check passed",
+				Data:         map[string]interface{}{"url": url},
+			})
 		}
 		
 		// Start continuous monitoring
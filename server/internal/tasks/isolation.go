@@ -0,0 +1,42 @@
+package tasks
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// AppIsolationRepository looks up the isolation level apps opted into on top of their plan's
+type AppIsolationRepository interface {
+	GetIsolation(ctx context.Context, appID string) (string, error)
+}
+
+// SetAppIsolationRepo lets apps confine their containers more tightly than their owner's plan requires
+func (h *TaskHandler) SetAppIsolationRepo(isolationRepo AppIsolationRepository) {
+	h.isolationRepo = isolationRepo
+}
+
+// isolationLevel returns how tightly the app's containers are confined: the stricter of the owner's plan
+// level and the level the app opted into. When the plan can't be looked up the strictest level applies
+func (h *TaskHandler) isolationLevel(ctx context.Context, appID, userID string) services.IsolationLevel {
+	level := services.DefaultIsolationLevel
+	if h.planEnforcement != nil {
+		planLevel, err := h.planEnforcement.GetIsolationLevel(ctx, userID)
+		if err != nil {
+			h.logger.Warn("Failed to get isolation level from plan - using the strictest", zap.Error(err), zap.String("app_id", appID))
+		} else {
+			level = planLevel
+		}
+	}
+
+	if h.isolationRepo != nil {
+		appLevel, err := h.isolationRepo.GetIsolation(ctx, appID)
+		if err != nil {
+			h.logger.Warn("Failed to get app isolation level - using the plan's", zap.Error(err), zap.String("app_id", appID))
+		} else {
+			level = services.StricterIsolation(level, services.IsolationLevel(appLevel))
+		}
+	}
+	return level
+}
@@ -3,40 +3,67 @@ package tasks
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/hibiken/asynq"
 	"go.uber.org/zap"
 )
 
+// Task states recorded in task_states
+const (
+	TaskStatusPending    = "pending"    // Enqueued, not picked up by a worker yet
+	TaskStatusProcessing = "processing" // A worker is running it
+	TaskStatusRetrying   = "retrying"   // The last attempt failed; Asynq runs it again after a delay
+	TaskStatusCompleted  = "completed"
+	TaskStatusFailed     = "failed" // The last attempt failed and no retries are left
+)
+
+// Finished task states are pruned after taskStateRetention, checked at most every taskStatePruneInterval
+const (
+	taskStateRetention     = 30 * 24 * time.Hour
+	taskStatePruneInterval = time.Hour
+)
+
 // TaskStateRepository handles task state persistence
 type TaskStateRepository interface {
-	CreateTaskState(ctx context.Context, taskID, taskType, queueName string, payload interface{}, maxRetries int) error
-	UpdateTaskState(ctx context.Context, taskID, status string, retryCount int, errorMsg string) error
-	GetTaskState(ctx context.Context, taskID string) (*TaskState, error)
+	// StartTaskState marks a task as processing, creating its row if it was not recorded when enqueued
+	StartTaskState(ctx context.Context, state *TaskState) error
+	// FinishTaskState records the outcome of a task's attempt
+	FinishTaskState(ctx context.Context, taskID, status, errorMsg string) error
+	// PruneTaskStates deletes finished task states last updated before the given time
+	PruneTaskStates(ctx context.Context, before time.Time) (int64, error)
 }
 
 // TaskState represents a task state in the database
+// App, deployment and build job IDs are taken from the payload's app_id, deployment_id and build_job_id
 type TaskState struct {
-	ID          string
-	TaskID      string
-	TaskType    string
-	QueueName   string
-	Payload     json.RawMessage
-	Status      string
-	RetryCount  int
-	MaxRetries  int
+	ID           string
+	TaskID       string
+	TaskType     string
+	QueueName    string
+	Payload      json.RawMessage
+	Status       string
+	RetryCount   int
+	MaxRetries   int
 	ErrorMessage string
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	CompletedAt *time.Time
-	FailedAt    *time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	StartedAt    *time.Time
+	CompletedAt  *time.Time
+	FailedAt     *time.Time
 }
 
-// TaskStatePersistence handles persisting task states
+// TaskStatePersistence records the tasks a worker runs, so users can see where their deployment is
+// Recording is best effort: a failure is logged and never fails the task
 type TaskStatePersistence struct {
 	repo   TaskStateRepository
 	logger *zap.Logger
+
+	pruneMu   sync.Mutex
+	lastPrune time.Time
 }
 
 // NewTaskStatePersistence creates a new task state persistence handler
@@ -47,57 +74,80 @@ func NewTaskStatePersistence(repo TaskStateRepository, logger *zap.Logger) *Task
 	}
 }
 
-// OnTaskEnqueued persists task state when task is enqueued
-func (p *TaskStatePersistence) OnTaskEnqueued(ctx context.Context, taskID, taskType, queueName string, payload interface{}, maxRetries int) error {
-	if err := p.repo.CreateTaskState(ctx, taskID, taskType, queueName, payload, maxRetries); err != nil {
+// OnTaskStarted records that a worker started an attempt of t
+func (p *TaskStatePersistence) OnTaskStarted(ctx context.Context, t *asynq.Task) error {
+	taskID, ok := asynq.GetTaskID(ctx)
+	if !ok {
+		return fmt.Errorf("task ID not found in context")
+	}
+	retryCount, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	queue, _ := asynq.GetQueueName(ctx)
+
+	state := &TaskState{
+		TaskID:     taskID,
+		TaskType:   t.Type(),
+		QueueName:  queue,
+		Payload:    t.Payload(),
+		Status:     TaskStatusProcessing,
+		RetryCount: retryCount,
+		MaxRetries: maxRetry,
+	}
+	if err := p.repo.StartTaskState(ctx, state); err != nil {
 		return fmt.Errorf("failed to persist task state: %w", err)
 	}
-	p.logger.Info("Task state persisted",
-		zap.String("task_id", taskID),
-		zap.String("task_type", taskType),
-		zap.String("status", "pending"),
-	)
 	return nil
 }
 
-// OnTaskStarted updates task state when task starts processing
-func (p *TaskStatePersistence) OnTaskStarted(ctx context.Context, taskID string) error {
-	if err := p.repo.UpdateTaskState(ctx, taskID, "processing", 0, ""); err != nil {
-		return fmt.Errorf("failed to update task state: %w", err)
+// OnTaskFinished records the outcome of an attempt of t; taskErr is what the handler returned
+// A failed attempt is "retrying" while Asynq will run it again and "failed" once it will not
+func (p *TaskStatePersistence) OnTaskFinished(ctx context.Context, t *asynq.Task, taskErr error) error {
+	taskID, ok := asynq.GetTaskID(ctx)
+	if !ok {
+		return fmt.Errorf("task ID not found in context")
+	}
+
+	status, errorMsg := TaskStatusCompleted, ""
+	if taskErr != nil {
+		retryCount, _ := asynq.GetRetryCount(ctx)
+		maxRetry, _ := asynq.GetMaxRetry(ctx)
+		status, errorMsg = TaskStatusFailed, taskErr.Error()
+		if retryCount < maxRetry && !errors.Is(taskErr, asynq.SkipRetry) {
+			status = TaskStatusRetrying
+		}
 	}
-	return nil
-}
 
-// OnTaskCompleted updates task state when task completes successfully
-func (p *TaskStatePersistence) OnTaskCompleted(ctx context.Context, taskID string) error {
-	if err := p.repo.UpdateTaskState(ctx, taskID, "completed", 0, ""); err != nil {
+	if err := p.repo.FinishTaskState(ctx, taskID, status, errorMsg); err != nil {
 		return fmt.Errorf("failed to update task state: %w", err)
 	}
-	p.logger.Info("Task completed",
-		zap.String("task_id", taskID),
-	)
+	if status == TaskStatusFailed {
+		p.logger.Warn("Task failed",
+			zap.String("task_id", taskID),
+			zap.String("task_type", t.Type()),
+			zap.Error(taskErr),
+		)
+	}
+
+	p.prune(ctx)
 	return nil
 }
 
-// OnTaskFailed updates task state when task fails
-func (p *TaskStatePersistence) OnTaskFailed(ctx context.Context, taskID string, retryCount int, err error) error {
-	// Always mark as failed - no retries
-	status := "failed"
-	
-	errorMsg := ""
+// prune deletes old finished task states, at most once per taskStatePruneInterval per worker
+func (p *TaskStatePersistence) prune(ctx context.Context) {
+	p.pruneMu.Lock()
+	if time.Since(p.lastPrune) < taskStatePruneInterval {
+		p.pruneMu.Unlock()
+		return
+	}
+	p.lastPrune = time.Now()
+	p.pruneMu.Unlock()
+
+	pruned, err := p.repo.PruneTaskStates(ctx, time.Now().Add(-taskStateRetention))
 	if err != nil {
-		errorMsg = err.Error()
+		p.logger.Warn("Failed to prune task states", zap.Error(err))
+		return
 	}
-	
-	if updateErr := p.repo.UpdateTaskState(ctx, taskID, status, retryCount, errorMsg); updateErr != nil {
-		return fmt.Errorf("failed to update task state: %w", updateErr)
+	if pruned > 0 {
+		p.logger.Info("Pruned old task states", zap.Int64("count", pruned))
 	}
-	
-	p.logger.Warn("Task failed",
-		zap.String("task_id", taskID),
-		zap.Int("retry_count", retryCount),
-		zap.Error(err),
-	)
-	return nil
 }
-
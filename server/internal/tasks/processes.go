@@ -0,0 +1,98 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// ProcessRepository stores the Procfile processes of apps and which of them run as workers
+type ProcessRepository interface {
+	SyncAppProcesses(ctx context.Context, appID string, processes []services.ProcessType) error
+	GetEnabledProcesses(ctx context.Context, appID string) ([]services.ProcessType, error)
+}
+
+// SetProcessRepo enables recording Procfile processes (build worker) and running worker processes (deploy worker)
+func (h *TaskHandler) SetProcessRepo(processRepo ProcessRepository) {
+	h.processRepo = processRepo
+}
+
+// recordProcesses stores the background processes of the Procfile a build was made from
+// A Procfile that can't be parsed leaves the recorded processes as they were; the build goes on
+func (h *TaskHandler) recordProcesses(ctx context.Context, appID, buildPath string) {
+	if h.processRepo == nil {
+		return
+	}
+
+	processes, err := services.ParseProcfile(buildPath)
+	if err != nil {
+		h.logger.Warn("Failed to parse Procfile - keeping the previous processes", zap.Error(err), zap.String("app_id", appID))
+		return
+	}
+	if err := h.processRepo.SyncAppProcesses(ctx, appID, processes); err != nil {
+		h.logger.Warn("Failed to record Procfile processes", zap.Error(err), zap.String("app_id", appID))
+		return
+	}
+	if len(processes) > 0 {
+		h.logger.Info("Recorded Procfile processes", zap.String("app_id", appID), zap.Int("processes", len(processes)))
+	}
+}
+
+// deployWorkers runs the app's enabled worker processes from the image its web container just started with
+// and removes the previous deployment's. Apps whose owner's plan has no workers and static sites (an
+// nginx image cannot run the Procfile's commands) run none. Failures are logged only - the web deployment
+// already succeeded and the next deploy tries again
+func (h *TaskHandler) deployWorkers(ctx context.Context, payload DeployTaskPayload, imageRef string, envVars map[string]string, limits services.ResourceLimits, staticSite bool) {
+	if h.processRepo == nil {
+		return
+	}
+
+	processes, err := h.processRepo.GetEnabledProcesses(ctx, payload.AppID)
+	if err != nil {
+		h.logger.Warn("Failed to retrieve worker processes - keeping the running workers", zap.Error(err), zap.String("app_id", payload.AppID))
+		return
+	}
+	if staticSite && len(processes) > 0 {
+		h.logger.Info("Static site - not running worker processes",
+			zap.String("app_id", payload.AppID),
+			zap.Int("enabled_processes", len(processes)),
+		)
+		processes = nil
+	}
+	if len(processes) > 0 && h.planEnforcement != nil {
+		var planErr *services.PlanLimitError
+		if err := h.planEnforcement.CheckWorkers(ctx, payload.UserID); errors.As(err, &planErr) {
+			h.logger.Info("Plan does not include workers - not running worker processes",
+				zap.String("app_id", payload.AppID),
+				zap.Int("enabled_processes", len(processes)),
+			)
+			processes = nil
+		} else if err != nil {
+			h.logger.Warn("Failed to check plan for workers - keeping the running workers", zap.Error(err), zap.String("app_id", payload.AppID))
+			return
+		}
+	}
+
+	containerIDs, err := h.deploymentService.DeployWorkers(ctx, services.WorkerOptions{
+		AppID:        payload.AppID,
+		DeploymentID: payload.DeploymentID,
+		ImageRef:     imageRef,
+		Processes:    processes,
+		EnvVars:      envVars,
+		Limits:       limits,
+		Isolation:    h.isolationLevel(ctx, payload.AppID, payload.UserID),
+	})
+	if err != nil {
+		h.logger.Error("Failed to deploy worker processes", zap.Error(err), zap.String("app_id", payload.AppID))
+		return
+	}
+	if len(containerIDs) > 0 {
+		h.logger.Info("Worker processes deployed",
+			zap.String("app_id", payload.AppID),
+			zap.String("deployment_id", payload.DeploymentID),
+			zap.Int("workers", len(containerIDs)),
+		)
+	}
+}
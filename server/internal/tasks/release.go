@@ -0,0 +1,146 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// defaultReleaseTimeout applies when the worker has no plan enforcement to take the plan's exec timeout from
+const defaultReleaseTimeout = 5 * time.Minute
+
+// ReleaseCommandRepository looks up the command apps run before a new deployment takes traffic
+type ReleaseCommandRepository interface {
+	GetReleaseCommand(ctx context.Context, appID string) (string, error)
+}
+
+// SetReleaseCommandRepo enables the release phase on this worker
+func (h *TaskHandler) SetReleaseCommandRepo(releaseRepo ReleaseCommandRepository) {
+	h.releaseRepo = releaseRepo
+}
+
+// runReleasePhase runs the app's release command (e.g. database migrations) in a one-off container of
+// the image about to be deployed, with the env vars and limits the deployment gets. It may run as long
+// as the owner's plan allows one-off commands. A non-zero exit, a timeout or a failure to run it at all
+// is returned as an error so the deployment fails before any traffic moves. Output is persisted as
+// release logs keyed by the deployment
+func (h *TaskHandler) runReleasePhase(ctx context.Context, payload DeployTaskPayload, imageRef string, envVars map[string]string, limits services.ResourceLimits) error {
+	if h.releaseRepo == nil {
+		return nil
+	}
+
+	command, err := h.releaseRepo.GetReleaseCommand(ctx, payload.AppID)
+	if err != nil {
+		// Deploying without knowing whether e.g. migrations must run first could break the app
+		return fmt.Errorf("failed to get release command: %w", err)
+	}
+	if command == "" {
+		return nil
+	}
+
+	timeout := defaultReleaseTimeout
+	if h.planEnforcement != nil {
+		if planTimeout, err := h.planEnforcement.GetExecTimeout(ctx, payload.UserID); err == nil {
+			timeout = planTimeout
+		} else {
+			h.logger.Warn("Failed to get exec timeout from plan - using the default", zap.Error(err), zap.String("app_id", payload.AppID))
+		}
+	}
+
+	h.logger.Info("Running release command",
+		zap.String("app_id", payload.AppID),
+		zap.String("deployment_id", payload.DeploymentID),
+		zap.Duration("timeout", timeout),
+	)
+
+	output := h.releaseLog(payload)
+	fmt.Fprintf(output, "Running release command: %s\n", command)
+	result, err := h.deploymentService.RunOneOffContainer(ctx, services.OneOffOptions{
+		AppID:     payload.AppID,
+		RunID:     "release-" + payload.DeploymentID,
+		ImageRef:  imageRef,
+		Command:   command,
+		EnvVars:   envVars,
+		Limits:    limits,
+		Timeout:   timeout,
+		Output:    output,
+		Isolation: h.isolationLevel(ctx, payload.AppID, payload.UserID),
+	})
+
+	switch {
+	case err != nil:
+		err = fmt.Errorf("release command failed to run: %w", err)
+	case result.TimedOut:
+		err = fmt.Errorf("release command timed out after %s", timeout)
+	case result.ExitCode != 0:
+		err = fmt.Errorf("release command exited with code %d", result.ExitCode)
+	}
+	if err != nil {
+		fmt.Fprintf(output, "%s - not deploying; the previous deployment stays live\n", err)
+	} else {
+		fmt.Fprintln(output, "Release command succeeded")
+	}
+	output.Close()
+
+	if err != nil {
+		h.logger.Warn("Release phase failed",
+			zap.Error(err),
+			zap.String("app_id", payload.AppID),
+			zap.String("deployment_id", payload.DeploymentID),
+		)
+		return err
+	}
+	h.logger.Info("Release phase succeeded",
+		zap.String("app_id", payload.AppID),
+		zap.String("deployment_id", payload.DeploymentID),
+	)
+	return nil
+}
+
+// releaseLog returns a writer that persists what is written to it as the deployment's release log
+// Close waits until everything written has been persisted
+func (h *TaskHandler) releaseLog(payload DeployTaskPayload) io.WriteCloser {
+	if h.logPersister == nil {
+		return nopWriteCloser{io.Discard}
+	}
+
+	reader, writer := io.Pipe()
+	persisted := make(chan struct{})
+	go func() {
+		defer close(persisted)
+		entry := services.LogEntry{
+			AppID:        payload.AppID,
+			DeploymentID: payload.DeploymentID,
+			LogType:      string(services.LogTypeRelease),
+			Timestamp:    time.Now(),
+		}
+		if err := h.logPersister.PersistLogStream(context.Background(), entry, reader); err != nil {
+			h.logger.Warn("Failed to persist release logs", zap.Error(err), zap.String("app_id", payload.AppID))
+		}
+		// Keep draining so a failed log never blocks the command's output
+		io.Copy(io.Discard, reader)
+	}()
+	return &releaseLogWriter{PipeWriter: writer, persisted: persisted}
+}
+
+// releaseLogWriter is the write end of a release log whose Close waits for the log to be persisted
+type releaseLogWriter struct {
+	*io.PipeWriter
+	persisted chan struct{}
+}
+
+func (w *releaseLogWriter) Close() error {
+	err := w.PipeWriter.Close()
+	<-w.persisted
+	return err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,99 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// SecretScanner finds credentials committed to a cloned repository (services.SecretScanner)
+type SecretScanner interface {
+	ScanDirectory(ctx context.Context, root string) ([]services.SecretFinding, error)
+}
+
+// SecretScanRepository looks up what each app does about committed credentials (services.SecretScan*)
+type SecretScanRepository interface {
+	GetSecretScanMode(ctx context.Context, appID string) (string, error)
+}
+
+// SetSecretScanner scans the source of each build on this worker for committed credentials
+func (h *TaskHandler) SetSecretScanner(scanner SecretScanner) {
+	h.secretScanner = scanner
+}
+
+// SetSecretScanRepo lets apps turn secret scanning off or fail their builds on findings; without it
+// findings are warnings
+func (h *TaskHandler) SetSecretScanRepo(secretScanRepo SecretScanRepository) {
+	h.secretScanRepo = secretScanRepo
+}
+
+// secretScanMode returns what the app does about committed credentials, warning when it cannot be read
+func (h *TaskHandler) secretScanMode(ctx context.Context, appID string) string {
+	if h.secretScanRepo == nil {
+		return services.SecretScanWarn
+	}
+	mode, err := h.secretScanRepo.GetSecretScanMode(ctx, appID)
+	if err != nil || !services.ValidSecretScanMode(mode) {
+		if err != nil {
+			h.logger.Warn("Failed to get secret scan mode - warning about findings", zap.Error(err), zap.String("app_id", appID))
+		}
+		return services.SecretScanWarn
+	}
+	return mode
+}
+
+// scanSecrets scans the build context for committed credentials before the image is built and writes the
+// findings (redacted) to the build log. Apps that block them get an error wrapping services.ErrSecretsDetected
+// and the build fails; a scan that cannot run never fails a build
+func (h *TaskHandler) scanSecrets(ctx context.Context, payload BuildTaskPayload, buildPath string, logWriter io.Writer) error {
+	if h.secretScanner == nil {
+		return nil
+	}
+	mode := h.secretScanMode(ctx, payload.AppID)
+	if mode == services.SecretScanOff {
+		return nil
+	}
+
+	findings, err := h.secretScanner.ScanDirectory(ctx, buildPath)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		h.logger.Warn("Secret scan failed", zap.Error(err), zap.String("app_id", payload.AppID))
+		return nil
+	}
+	if len(findings) == 0 {
+		fmt.Fprintln(logWriter, "Secret scan: no credentials found in the repository")
+		return nil
+	}
+
+	for _, finding := range findings {
+		fmt.Fprintf(logWriter, "WARNING: possible %s committed in %s:%d (%s)\n", finding.Rule, finding.File, finding.Line, finding.Redacted)
+	}
+	fmt.Fprintln(logWriter, "Remove committed credentials and rotate them - they end up in the image. Add stackyn:allow-secret to a line to ignore a false positive")
+
+	h.logger.Warn("Credentials found in repository",
+		zap.String("app_id", payload.AppID),
+		zap.String("build_job_id", payload.BuildJobID),
+		zap.Int("findings", len(findings)),
+		zap.String("mode", mode),
+	)
+	h.recordDeployEvent(ctx, services.DeployEvent{
+		AppID:      payload.AppID,
+		BuildJobID: payload.BuildJobID,
+		Type:       services.DeployEventSecretsDetected,
+		Message:    "Possible credentials found in the repository",
+		Data: map[string]interface{}{
+			"findings": len(findings),
+			"mode":     mode,
+		},
+	})
+
+	if mode == services.SecretScanBlock {
+		return fmt.Errorf("%w: %d possible credentials committed (see the build log)", services.ErrSecretsDetected, len(findings))
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// ImageAppRepository looks up registry logins for image apps and records the digests they deploy
+type ImageAppRepository interface {
+	GetRegistryAuth(ctx context.Context, appID string) (*services.RegistryAuth, error)
+	SetImageDigest(ctx context.Context, appID, digest string) error
+}
+
+// SetImageAppRepo enables deploying image apps on this worker
+func (h *TaskHandler) SetImageAppRepo(imageAppRepo ImageAppRepository) {
+	h.imageAppRepo = imageAppRepo
+}
+
+// pullSourceImage pulls an image app's registry image, pinned to the digest the registry serves now,
+// and tags it imageName:imageTag for the deployment. Returns the digest
+func (h *TaskHandler) pullSourceImage(ctx context.Context, payload DeployTaskPayload, imageName, imageTag string) (string, error) {
+	if h.imageAppRepo == nil {
+		return "", fmt.Errorf("image apps are not supported by this worker")
+	}
+	auth, err := h.imageAppRepo.GetRegistryAuth(ctx, payload.AppID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get registry credentials: %w", err)
+	}
+
+	digest, err := h.deploymentService.PullSourceImage(ctx, payload.SourceImage, auth, imageName, imageTag)
+	if err != nil {
+		return "", err
+	}
+	h.logger.Info("Pulled source image",
+		zap.String("app_id", payload.AppID),
+		zap.String("image", payload.SourceImage),
+		zap.String("digest", digest),
+	)
+	return digest, nil
+}
+
+// deployedImage names the image a deployment runs as its owner knows it: the registry reference and
+// digest for image apps, the built image otherwise
+func deployedImage(payload DeployTaskPayload, imageName, imageTag, sourceDigest string) string {
+	if payload.SourceImage != "" && sourceDigest != "" {
+		return payload.SourceImage + "@" + sourceDigest
+	}
+	return fmt.Sprintf("%s:%s", imageName, imageTag)
+}
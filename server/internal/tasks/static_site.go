@@ -0,0 +1,24 @@
+package tasks
+
+import (
+	"context"
+
+	"stackyn/server/internal/services"
+)
+
+// isStaticSiteImage reports whether imageRef serves a static site with nginx (services.StaticSiteLabel)
+// Such deployments run no worker processes and are health checked on services.StaticSiteHealthPath
+func (h *TaskHandler) isStaticSiteImage(ctx context.Context, imageRef string) bool {
+	if h.deploymentService == nil {
+		return false
+	}
+	dockerClient := h.deploymentService.GetDockerClient()
+	if dockerClient == nil {
+		return false
+	}
+	inspect, _, err := dockerClient.ImageInspectWithRaw(ctx, imageRef)
+	if err != nil || inspect.Config == nil {
+		return false
+	}
+	return inspect.Config.Labels[services.StaticSiteLabel] == "true"
+}
@@ -1,10 +1,18 @@
 package tasks
 
+import "time"
+
 // Task type constants
 const (
-	TypeBuildTask   = "build_task"
-	TypeDeployTask  = "deploy_task"
-	TypeCleanupTask = "cleanup_task"
+	TypeBuildTask     = "build_task"
+	TypeDeployTask    = "deploy_task"
+	TypeCleanupTask   = "cleanup_task"
+	TypeCronRunTask   = "cron_run_task"
+	TypeAppExportTask = "app_export_task"
+	TypeAppWakeTask   = "app_wake_task"
+	TypeAppPowerTask  = "app_power_task"
+	TypeExecTask      = "exec_task"
+	TypeEmailTask     = "email_task"
 )
 
 // Task queue names
@@ -16,6 +24,16 @@ const (
 	QueueBuild   = "build"
 	QueueDeploy  = "deploy"
 	QueueCleanup = "cleanup"
+	// Builds and deploys someone is waiting on (deploystate.InteractiveTrigger), with reserved worker capacity
+	QueueBuildInteractive  = "build_interactive"
+	QueueDeployInteractive = "deploy_interactive"
+	// Automated builds by tier (QueueBuild is the default tier): security rebuilds and recoveries, then
+	// plans with priority_builds, other paid plans and trials/accounts without a paid plan
+	QueueBuildCritical = "build_critical"
+	QueueBuildPro      = "build_pro"
+	QueueBuildFree     = "build_free"
+	// Transactional emails, delivered with retries from the email log
+	QueueEmail = "email"
 )
 
 // BuildTaskPayload represents the payload for a build task
@@ -24,8 +42,13 @@ type BuildTaskPayload struct {
 	BuildJobID   string `json:"build_job_id"`
 	RepoURL      string `json:"repo_url"`
 	Branch       string `json:"branch"`
-	CommitSHA    string `json:"commit_sha,omitempty"`
+	Tag          string `json:"tag,omitempty"` // Build this tag instead of the branch head (pinned redeploys)
+	CommitSHA    string `json:"commit_sha,omitempty"` // Build this commit (full SHA) instead of the branch head (pinned redeploys)
+	RootDir      string `json:"root_dir,omitempty"` // Repository subdirectory to build from (monorepos)
 	UserID       string `json:"user_id"` // User who owns the app
+	Trigger      string `json:"trigger,omitempty"` // What started the build, recorded on its deployment (deploystate.Trigger*)
+	TriggeredBy  string `json:"triggered_by,omitempty"` // User who started it; empty when the platform did
+	QueuedAt     time.Time `json:"queued_at,omitempty"` // Set by TaskEnqueueService; the queue wait is measured from it
 }
 
 // DeployTaskPayload represents the payload for a deploy task
@@ -39,6 +62,19 @@ type DeployTaskPayload struct {
 	RequestedRAMMB int   `json:"requested_ram_mb,omitempty"` // RAM requested for deployment
 	UseDockerCompose bool `json:"use_docker_compose,omitempty"` // Whether to deploy using docker-compose
 	RepoPath      string `json:"repo_path,omitempty"` // Path to cloned repository (for docker-compose)
+	RootDir       string `json:"root_dir,omitempty"` // Subdirectory of RepoPath holding the compose file (monorepos)
+	RollbackFromDeploymentID string `json:"rollback_from_deployment_id,omitempty"` // Set when redeploying an earlier deployment's image
+	EnvFromDeploymentID string `json:"env_from_deployment_id,omitempty"` // Reuse this deployment's env snapshot instead of the app's current env vars
+	CommitSHA     string `json:"commit_sha,omitempty"` // Commit the image was built from (empty when redeploying an earlier build's image)
+	CommitAuthor  string `json:"commit_author,omitempty"`
+	CommitMessage string `json:"commit_message,omitempty"`
+	CommitBranch  string `json:"commit_branch,omitempty"`
+	SourceImage   string `json:"source_image,omitempty"` // Image apps: registry reference pulled (by digest) and tagged ImageName:BuildJobID before deploying
+	Trigger       string `json:"trigger,omitempty"` // What started the deployment (deploystate.Trigger*)
+	TriggeredBy   string `json:"triggered_by,omitempty"` // User who started it; empty when the platform did
+	QueuedAt      time.Time `json:"queued_at,omitempty"` // Set by TaskEnqueueService; the queue wait is measured from it
+	Host          string `json:"host,omitempty"` // Node the scheduler placed the deploy on (set by TaskEnqueueService; empty on the shared queue)
+	ImageHost     string `json:"image_host,omitempty"` // Node whose Docker has the built image (the build worker's NODE_NAME)
 }
 
 // CleanupTaskPayload represents the payload for a cleanup task
@@ -47,5 +83,61 @@ type CleanupTaskPayload struct {
 	DeploymentID string   `json:"deployment_id,omitempty"`
 	ContainerIDs []string `json:"container_ids,omitempty"`
 	ImageNames   []string `json:"image_names,omitempty"`
+	Trigger      string   `json:"trigger,omitempty"` // "admin" runs even within the cooldown of the last run
+}
+
+// CronRunTaskPayload represents the payload for one run of an app's cron job
+type CronRunTaskPayload struct {
+	RunID          string `json:"run_id"`
+	CronJobID      string `json:"cron_job_id"`
+	AppID          string `json:"app_id"`
+	UserID         string `json:"user_id"`    // User who owns the app
+	DeploymentID   string `json:"deployment_id,omitempty"` // The app's running deployment, whose env snapshot the command runs with
+	ImageName      string `json:"image_name"` // Image of the app's running deployment ("name:tag")
+	Command        string `json:"command"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// ExecTaskPayload represents the payload for a one-off command run in an app's image
+type ExecTaskPayload struct {
+	RunID          string `json:"run_id"`
+	AppID          string `json:"app_id"`
+	UserID         string `json:"user_id"`                 // User who owns the app
+	DeploymentID   string `json:"deployment_id,omitempty"` // The app's running deployment, whose env snapshot the command runs with
+	ImageName      string `json:"image_name"`              // Image of the app's running deployment ("name:tag")
+	Command        string `json:"command"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// AppExportTaskPayload represents the payload for writing an app's export bundle
+type AppExportTaskPayload struct {
+	ExportID  string `json:"export_id"`
+	AppID     string `json:"app_id"`
+	UserID    string `json:"user_id"`    // User who owns the app
+	DeleteApp bool   `json:"delete_app"` // Delete the app once the bundle is written
 }
 
+// AppWakeTaskPayload represents the payload for starting a sleeping app's containers
+type AppWakeTaskPayload struct {
+	AppID  string `json:"app_id"`
+	UserID string `json:"user_id"` // User who owns the app
+}
+
+// App power actions
+const (
+	AppPowerStop  = "stop"
+	AppPowerStart = "start"
+)
+
+// AppPowerTaskPayload represents the payload for stopping or starting an app's containers at its owner's request
+type AppPowerTaskPayload struct {
+	AppID       string `json:"app_id"`
+	UserID      string `json:"user_id"`      // User who owns the app
+	Action      string `json:"action"`       // AppPowerStop or AppPowerStart
+	TriggeredBy string `json:"triggered_by"` // User who asked for it (an org member or an admin)
+}
+
+// EmailTaskPayload represents the payload for delivering an email recorded in the email log
+type EmailTaskPayload struct {
+	EmailID string `json:"email_id"`
+}
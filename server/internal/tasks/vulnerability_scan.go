@@ -0,0 +1,111 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// ImageScanner scans built images for known vulnerabilities (services.VulnerabilityScanner)
+type ImageScanner interface {
+	Name() string
+	ScanImage(ctx context.Context, imageRef string) ([]services.Vulnerability, error)
+}
+
+// ImageScanRepository stores the vulnerability scans of builds and the organization policy deploys are held to
+type ImageScanRepository interface {
+	SaveImageScan(ctx context.Context, scan services.ImageScan) error
+	GetImageScan(ctx context.Context, buildJobID string) (*services.ImageScan, error) // nil when the build was not scanned
+	BlocksCriticalVulnerabilities(ctx context.Context, appID string) (bool, error)
+}
+
+// SetImageScanner scans the image of each successful build on this worker before it is deployed
+func (h *TaskHandler) SetImageScanner(scanner ImageScanner) {
+	h.imageScanner = scanner
+}
+
+// SetImageScanRepo records image scans (build worker) and holds deploys to their organization's
+// vulnerability policy (deploy worker)
+func (h *TaskHandler) SetImageScanRepo(imageScanRepo ImageScanRepository) {
+	h.imageScanRepo = imageScanRepo
+}
+
+// scanImage scans the image a build produced and records the findings against the build job, where the
+// deployments of that build find them. A scan that fails is recorded as failed; the build goes on either way
+func (h *TaskHandler) scanImage(ctx context.Context, payload BuildTaskPayload, imageRef string) {
+	if h.imageScanner == nil || h.imageScanRepo == nil {
+		return
+	}
+
+	scan := services.ImageScan{
+		BuildJobID: payload.BuildJobID,
+		AppID:      payload.AppID,
+		ImageName:  imageRef,
+		Scanner:    h.imageScanner.Name(),
+		Status:     services.ImageScanCompleted,
+	}
+	vulnerabilities, err := h.imageScanner.ScanImage(ctx, imageRef)
+	if err != nil {
+		h.logger.Warn("Failed to scan image for vulnerabilities",
+			zap.Error(err),
+			zap.String("app_id", payload.AppID),
+			zap.String("image", imageRef),
+		)
+		scan.Status = services.ImageScanFailed
+		scan.Error = err.Error()
+	}
+	scan.Vulnerabilities = vulnerabilities
+	scan.Counts = services.CountVulnerabilities(vulnerabilities)
+	scan.ScannedAt = time.Now()
+
+	if err := h.imageScanRepo.SaveImageScan(context.WithoutCancel(ctx), scan); err != nil {
+		h.logger.Warn("Failed to record image scan", zap.Error(err), zap.String("build_job_id", payload.BuildJobID))
+		return
+	}
+	if scan.Status != services.ImageScanCompleted {
+		return
+	}
+	h.recordDeployEvent(ctx, services.DeployEvent{
+		AppID:      payload.AppID,
+		BuildJobID: payload.BuildJobID,
+		Type:       services.DeployEventImageScanned,
+		Message:    "Image scanned for vulnerabilities",
+		Data: map[string]interface{}{
+			"scanner":  scan.Scanner,
+			"critical": scan.Counts.Critical,
+			"high":     scan.Counts.High,
+			"medium":   scan.Counts.Medium,
+			"low":      scan.Counts.Low,
+		},
+	})
+}
+
+// checkVulnerabilityPolicy fails a deploy whose image has critical vulnerabilities when the app's organization
+// blocks them. Only completed scans block: builds that were not scanned, or whose scan failed, deploy as usual
+func (h *TaskHandler) checkVulnerabilityPolicy(ctx context.Context, payload DeployTaskPayload) error {
+	if h.imageScanRepo == nil || payload.BuildJobID == "" {
+		return nil
+	}
+
+	blocks, err := h.imageScanRepo.BlocksCriticalVulnerabilities(ctx, payload.AppID)
+	if err != nil {
+		h.logger.Warn("Failed to get vulnerability policy - deploying", zap.Error(err), zap.String("app_id", payload.AppID))
+		return nil
+	}
+	if !blocks {
+		return nil
+	}
+
+	scan, err := h.imageScanRepo.GetImageScan(ctx, payload.BuildJobID)
+	if err != nil {
+		h.logger.Warn("Failed to get image scan - deploying", zap.Error(err), zap.String("app_id", payload.AppID))
+		return nil
+	}
+	if scan == nil || scan.Status != services.ImageScanCompleted || scan.Counts.Critical == 0 {
+		return nil
+	}
+	return fmt.Errorf("image has %d critical vulnerabilities and the organization blocks deploying them (see the deployment's vulnerabilities)", scan.Counts.Critical)
+}
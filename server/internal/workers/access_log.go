@@ -0,0 +1,71 @@
+package workers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// traefikAccessLogEntry is the part of a Traefik JSON access log line the workers reading it need
+type traefikAccessLogEntry struct {
+	ServiceName           string    `json:"ServiceName"` // "app-<app id>@docker" for app containers
+	StartUTC              time.Time `json:"StartUTC"`
+	Duration              int64     `json:"Duration"`              // Nanoseconds from request to response
+	DownstreamStatus      int       `json:"DownstreamStatus"`      // Status code sent to the client
+	DownstreamContentSize int64     `json:"DownstreamContentSize"` // Response body bytes sent to the client
+}
+
+// accessLogTail reads the lines appended to Traefik's JSON access log between passes
+// Each reader keeps its own position, so several workers can follow the same log
+type accessLogTail struct {
+	path    string
+	logFile os.FileInfo // Access log read last pass (detects rotation)
+	offset  int64       // Bytes of the access log already read
+}
+
+// read calls fn with the complete lines appended since the last read
+// A rotated or truncated log is read from its start; the first read only skips to the end
+func (t *accessLogTail) read(fn func(entry *traefikAccessLogEntry)) error {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat access log: %w", err)
+	}
+	if t.logFile == nil {
+		t.logFile = info
+		t.offset = info.Size()
+		return nil
+	}
+	if !os.SameFile(t.logFile, info) || info.Size() < t.offset {
+		t.offset = 0
+	}
+	t.logFile = info
+
+	if _, err := file.Seek(t.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek access log: %w", err)
+	}
+
+	reader := bufio.NewReader(io.LimitReader(file, info.Size()-t.offset))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break // A line Traefik is still writing is read whole next pass
+		}
+		t.offset += int64(len(line))
+
+		var entry traefikAccessLogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		fn(&entry)
+	}
+	return nil
+}
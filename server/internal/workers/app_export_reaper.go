@@ -0,0 +1,71 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// AppExportExpirer marks export bundles past their retention as expired
+type AppExportExpirer interface {
+	ExpireAppExports(ctx context.Context) ([]string, error)
+}
+
+// AppExportReaper removes export bundles once they are no longer downloadable
+// Runs in the API server, which serves the bundles from the shared export directory
+type AppExportReaper struct {
+	repo     AppExportExpirer
+	logger   *zap.Logger
+	interval time.Duration
+}
+
+// NewAppExportReaper creates a new app export reaper
+func NewAppExportReaper(repo AppExportExpirer, logger *zap.Logger) *AppExportReaper {
+	return &AppExportReaper{
+		repo:     repo,
+		logger:   logger,
+		interval: time.Hour, // Bundles are kept for days, so hourly precision is plenty
+	}
+}
+
+// Start starts the reaper loop
+func (r *AppExportReaper) Start(ctx context.Context) error {
+	r.logger.Info("Starting app export reaper", zap.Duration("interval", r.interval))
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("App export reaper stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			if err := r.reap(ctx); err != nil {
+				r.logger.Error("Failed to reap expired app exports", zap.Error(err))
+				// Continue - don't stop reaper on error
+			}
+		}
+	}
+}
+
+// reap expires due exports and deletes their bundles
+func (r *AppExportReaper) reap(ctx context.Context) error {
+	ids, err := r.repo.ExpireAppExports(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := os.Remove(services.AppExportPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			r.logger.Warn("Failed to remove expired export bundle", zap.Error(err), zap.String("export_id", id))
+			continue
+		}
+		r.logger.Info("Removed expired export bundle", zap.String("export_id", id))
+	}
+	return nil
+}
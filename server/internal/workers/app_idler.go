@@ -0,0 +1,241 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// AppIdler puts running apps to sleep once nobody has requested them for a while
+// Runs in the deploy worker, which owns the app containers and can read Traefik's access log. Request
+// times are taken from the log and stored on the app; apps on plans without always_on that stay idle
+// past the timeout have their containers stopped (not removed) and are marked sleeping. Traefik then
+// sends their requests to the fallback page server, which wakes them
+type AppIdler struct {
+	pool            *pgxpool.Pool
+	deployments     *services.DeploymentService
+	planEnforcement *services.PlanEnforcementService
+	appLists        AppListCache // Optional - drops the owners' cached app lists
+	logger          *zap.Logger
+	accessLog       *accessLogTail
+	node            string // Only apps whose containers run on this node are put to sleep
+	timeout         time.Duration
+	interval        time.Duration
+
+	startedAt time.Time
+}
+
+// NewAppIdler creates a new app idler reading Traefik's JSON access log at accessLogPath
+func NewAppIdler(pool *pgxpool.Pool, deployments *services.DeploymentService, planEnforcement *services.PlanEnforcementService, accessLogPath, node string, timeout time.Duration, logger *zap.Logger) *AppIdler {
+	return &AppIdler{
+		pool:            pool,
+		deployments:     deployments,
+		planEnforcement: planEnforcement,
+		logger:          logger,
+		accessLog:       &accessLogTail{path: accessLogPath},
+		node:            node,
+		timeout:         timeout,
+		interval:        1 * time.Minute,
+	}
+}
+
+// SetAppListCache makes apps put to sleep show up as sleeping in their owners' cached app lists right away
+func (w *AppIdler) SetAppListCache(appLists AppListCache) {
+	w.appLists = appLists
+}
+
+// Start starts the idling loop
+// Reading starts at the end of the access log, so nothing is put to sleep until the idler has watched
+// requests for a full timeout - requests made while the worker was down are not in what it has read
+func (w *AppIdler) Start(ctx context.Context) error {
+	w.logger.Info("Starting app idler",
+		zap.Duration("interval", w.interval),
+		zap.Duration("timeout", w.timeout),
+		zap.String("access_log", w.accessLog.path),
+	)
+	w.startedAt = time.Now()
+
+	if err := w.recordRequests(ctx); err != nil {
+		w.logger.Error("Failed to read access log", zap.Error(err))
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("App idler stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			// Without request times every app would look idle, so nothing sleeps while the log is unreadable
+			if err := w.recordRequests(ctx); err != nil {
+				w.logger.Error("Failed to read access log", zap.Error(err))
+				continue
+			}
+			if time.Since(w.startedAt) < w.timeout {
+				continue
+			}
+			if err := w.sleepIdleApps(ctx); err != nil {
+				w.logger.Error("Failed to put idle apps to sleep", zap.Error(err))
+				// Continue - don't stop idler on error
+			}
+		}
+	}
+}
+
+// recordRequests reads the access log lines written since the last pass and stores each app's latest request time
+func (w *AppIdler) recordRequests(ctx context.Context) error {
+	lastRequests, err := w.readAccessLog()
+	if err != nil {
+		return err
+	}
+	if len(lastRequests) == 0 {
+		return nil
+	}
+
+	appIDs := make([]string, 0, len(lastRequests))
+	times := make([]time.Time, 0, len(lastRequests))
+	for appID, at := range lastRequests {
+		appIDs = append(appIDs, appID)
+		times = append(times, at)
+	}
+
+	if _, err := w.pool.Exec(ctx,
+		`UPDATE apps a
+		 SET last_request_at = GREATEST(COALESCE(a.last_request_at, r.at), r.at)
+		 FROM unnest($1::text[], $2::timestamp[]) AS r(app_id, at)
+		 WHERE a.id = r.app_id::uuid`,
+		appIDs, times,
+	); err != nil {
+		return fmt.Errorf("failed to record request times: %w", err)
+	}
+
+	w.logger.Debug("Recorded app request times", zap.Int("apps", len(appIDs)))
+	return nil
+}
+
+// readAccessLog returns the latest request time per app in the complete lines appended since the last read
+func (w *AppIdler) readAccessLog() (map[string]time.Time, error) {
+	lastRequests := make(map[string]time.Time)
+	err := w.accessLog.read(func(entry *traefikAccessLogEntry) {
+		appID, ok := services.AppIDFromTraefikService(entry.ServiceName)
+		if !ok {
+			return
+		}
+		at := entry.StartUTC.UTC()
+		if entry.StartUTC.IsZero() {
+			at = time.Now().UTC()
+		}
+		if at.After(lastRequests[appID]) {
+			lastRequests[appID] = at
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lastRequests, nil
+}
+
+// sleepIdleApps puts running apps on this node to sleep when their owner's plan is not always-on and
+// they have not been requested (or deployed) for longer than the timeout
+func (w *AppIdler) sleepIdleApps(ctx context.Context) error {
+	rows, err := w.pool.Query(ctx,
+		`SELECT a.id, a.user_id
+		 FROM apps a
+		 WHERE a.status = 'running'
+		   AND GREATEST(COALESCE(a.last_request_at, a.updated_at), a.updated_at) < NOW() - make_interval(mins => $1)
+		   AND EXISTS (
+		       SELECT 1 FROM deployments d
+		       WHERE d.app_id = a.id AND d.status = 'running' AND COALESCE(d.node, $2) = $2
+		   )`,
+		int(w.timeout/time.Minute), w.node,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to find idle apps: %w", err)
+	}
+
+	type idleApp struct {
+		ID, UserID string
+	}
+	var apps []idleApp
+	for rows.Next() {
+		var app idleApp
+		if err := rows.Scan(&app.ID, &app.UserID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan idle app: %w", err)
+		}
+		apps = append(apps, app)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to find idle apps: %w", err)
+	}
+
+	alwaysOn := make(map[string]bool)
+	slept := 0
+	for _, app := range apps {
+		exempt, ok := alwaysOn[app.UserID]
+		if !ok {
+			limits, err := w.planEnforcement.GetPlanLimits(ctx, app.UserID)
+			// Hardcoded fallback limits (no plan name) mean the plan could not be looked up - never
+			// sleep a paying user's app because of that
+			exempt = err != nil || limits.PlanName == "" || limits.AlwaysOn
+			alwaysOn[app.UserID] = exempt
+		}
+		if exempt {
+			continue
+		}
+
+		if w.sleepApp(ctx, app.ID) {
+			slept++
+		}
+	}
+
+	if slept > 0 {
+		w.logger.Info("Put idle apps to sleep", zap.Int("apps", slept), zap.Int("idle", len(apps)))
+	}
+	return nil
+}
+
+// sleepApp marks an app sleeping and stops its containers, restoring the running status if they cannot be stopped
+// The status changes first so a deploy that started meanwhile is never put to sleep
+func (w *AppIdler) sleepApp(ctx context.Context, appID string) bool {
+	var ownerID string
+	err := w.pool.QueryRow(ctx,
+		`UPDATE apps SET status = 'sleeping', slept_at = NOW(), updated_at = NOW() WHERE id = $1 AND status = 'running'
+		 RETURNING user_id`,
+		appID,
+	).Scan(&ownerID)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			w.logger.Error("Failed to mark app sleeping", zap.Error(err), zap.String("app_id", appID))
+		}
+		return false
+	}
+	// Both the sleep and a restore below change the status the owner's app list shows
+	if w.appLists != nil {
+		defer w.appLists.InvalidateAppLists(ctx, ownerID)
+	}
+
+	if err := w.deployments.SleepAppContainers(ctx, appID); err != nil {
+		w.logger.Warn("Failed to put app to sleep", zap.Error(err), zap.String("app_id", appID))
+		if _, err := w.pool.Exec(ctx,
+			`UPDATE apps SET status = 'running', updated_at = NOW() WHERE id = $1 AND status = 'sleeping'`,
+			appID,
+		); err != nil {
+			w.logger.Error("Failed to restore running status", zap.Error(err), zap.String("app_id", appID))
+		}
+		return false
+	}
+
+	// Stopped containers no longer hold RAM against the owner's plan
+	w.planEnforcement.ReleaseAppRAM(ctx, appID)
+	return true
+}
@@ -0,0 +1,183 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"stackyn/server/internal/metrics"
+	"stackyn/server/internal/services"
+)
+
+const (
+	// appWebhookClaimBatch bounds how many deliveries one dispatcher pass sends
+	appWebhookClaimBatch = 50
+	// appWebhookLease is how long a claimed delivery is hidden from other dispatchers; a dispatcher that
+	// dies mid-send leaves the delivery pending, and it is retried once the lease runs out
+	appWebhookLease = 2 * time.Minute
+)
+
+// AppWebhookDispatcher sends the signed events workers record for app webhooks
+// Runs in the API server. Due deliveries are claimed with SKIP LOCKED by pushing next_attempt_at past
+// a lease, so concurrent API instances never send the same attempt twice. Failed attempts are retried
+// with exponential backoff until services.MaxAppWebhookAttempts, then the delivery is marked failed
+type AppWebhookDispatcher struct {
+	pool     *pgxpool.Pool
+	sender   *services.AppWebhookSender
+	logger   *zap.Logger
+	interval time.Duration
+}
+
+// dueAppWebhookDelivery is a delivery claimed by the dispatcher
+type dueAppWebhookDelivery struct {
+	ID       string
+	Event    string
+	Payload  []byte
+	Attempts int
+	URL      string
+	Secret   string
+}
+
+// NewAppWebhookDispatcher creates a new app webhook dispatcher
+func NewAppWebhookDispatcher(pool *pgxpool.Pool, sender *services.AppWebhookSender, logger *zap.Logger) *AppWebhookDispatcher {
+	return &AppWebhookDispatcher{
+		pool:     pool,
+		sender:   sender,
+		logger:   logger,
+		interval: 10 * time.Second, // Events should arrive while the user is still watching the deploy
+	}
+}
+
+// Start starts the dispatch loop
+func (d *AppWebhookDispatcher) Start(ctx context.Context) error {
+	d.logger.Info("Starting app webhook dispatcher", zap.Duration("interval", d.interval))
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.logger.Info("App webhook dispatcher stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			if err := d.dispatch(ctx); err != nil {
+				d.logger.Error("Failed to dispatch app webhooks", zap.Error(err))
+				// Continue - don't stop dispatcher on error
+			}
+		}
+	}
+}
+
+// dispatch claims the due deliveries and sends them
+func (d *AppWebhookDispatcher) dispatch(ctx context.Context) error {
+	deliveries, err := d.claimDue(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		d.send(ctx, delivery)
+	}
+	return nil
+}
+
+// send makes one delivery attempt and records its outcome
+func (d *AppWebhookDispatcher) send(ctx context.Context, delivery *dueAppWebhookDelivery) {
+	attempt := delivery.Attempts + 1
+	responseStatus, sendErr := d.sender.Send(ctx, delivery.URL, delivery.Secret, delivery.Event, delivery.ID, delivery.Payload)
+
+	var responseStatusArg *int
+	if responseStatus != 0 {
+		responseStatusArg = &responseStatus
+	}
+
+	var err error
+	result := "succeeded"
+	switch {
+	case sendErr == nil:
+		_, err = d.pool.Exec(ctx,
+			`UPDATE app_webhook_deliveries
+			 SET status = 'succeeded', attempts = $2, response_status = $3, last_error = NULL, delivered_at = NOW()
+			 WHERE id = $1`,
+			delivery.ID, attempt, responseStatusArg,
+		)
+	case attempt >= services.MaxAppWebhookAttempts:
+		result = "failed"
+		_, err = d.pool.Exec(ctx,
+			`UPDATE app_webhook_deliveries
+			 SET status = 'failed', attempts = $2, response_status = $3, last_error = $4
+			 WHERE id = $1`,
+			delivery.ID, attempt, responseStatusArg, sendErr.Error(),
+		)
+	default:
+		result = "retrying"
+		_, err = d.pool.Exec(ctx,
+			`UPDATE app_webhook_deliveries
+			 SET attempts = $2, response_status = $3, last_error = $4, next_attempt_at = $5
+			 WHERE id = $1`,
+			delivery.ID, attempt, responseStatusArg, sendErr.Error(), time.Now().Add(services.AppWebhookRetryDelay(attempt)),
+		)
+	}
+	if err != nil {
+		d.logger.Warn("Failed to record app webhook delivery attempt", zap.Error(err), zap.String("delivery_id", delivery.ID))
+	}
+
+	metrics.AppWebhookDeliveriesTotal.Inc(result)
+	if sendErr != nil {
+		d.logger.Info("App webhook delivery attempt failed",
+			zap.String("delivery_id", delivery.ID),
+			zap.String("event", delivery.Event),
+			zap.Int("attempt", attempt),
+			zap.String("result", result),
+			zap.Error(sendErr),
+		)
+	}
+}
+
+// claimDue leases the due pending deliveries of enabled webhooks
+// Deliveries of a webhook that was disabled after the event are failed instead of sent
+func (d *AppWebhookDispatcher) claimDue(ctx context.Context) ([]*dueAppWebhookDelivery, error) {
+	if _, err := d.pool.Exec(ctx,
+		`UPDATE app_webhook_deliveries dl
+		 SET status = 'failed', last_error = 'Webhook was disabled before the event was delivered'
+		 FROM app_webhooks w
+		 WHERE w.id = dl.webhook_id AND dl.status = 'pending' AND NOT w.enabled`,
+	); err != nil {
+		return nil, fmt.Errorf("failed to fail deliveries of disabled webhooks: %w", err)
+	}
+
+	rows, err := d.pool.Query(ctx,
+		`WITH due AS (
+			SELECT id FROM app_webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		 )
+		 UPDATE app_webhook_deliveries dl SET next_attempt_at = $2
+		 FROM due, app_webhooks w
+		 WHERE dl.id = due.id AND w.id = dl.webhook_id
+		 RETURNING dl.id, dl.event, dl.payload, dl.attempts, w.url, w.secret`,
+		appWebhookClaimBatch, time.Now().Add(appWebhookLease),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim due app webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []*dueAppWebhookDelivery
+	for rows.Next() {
+		var delivery dueAppWebhookDelivery
+		if err := rows.Scan(&delivery.ID, &delivery.Event, &delivery.Payload, &delivery.Attempts, &delivery.URL, &delivery.Secret); err != nil {
+			return nil, fmt.Errorf("failed to scan due app webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim due app webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
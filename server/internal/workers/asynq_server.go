@@ -2,28 +2,37 @@ package workers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hibiken/asynq"
 	"go.uber.org/zap"
+	"stackyn/server/internal/metrics"
 	"stackyn/server/internal/tasks"
 )
 
 // AsynqServer wraps Asynq server for task processing
 type AsynqServer struct {
 	server   *asynq.Server
+	reserved *asynq.Server // Optional - serves only the interactive queues (see ReserveQueues)
 	mux      *asynq.ServeMux
 	logger   *zap.Logger
 	handler  *tasks.TaskHandler
 	persist  *tasks.TaskStatePersistence
+	redisOpt asynq.RedisClientOpt
+	shutdownTimeout time.Duration
 }
 
 // NewAsynqServer creates a new Asynq server
 // queues specifies which queues this worker should listen to (map of queue name to weight)
 // If nil, defaults to all task-specific queues
-func NewAsynqServer(redisAddr string, redisPassword string, logger *zap.Logger, handler *tasks.TaskHandler, persist *tasks.TaskStatePersistence, queues map[string]int) *AsynqServer {
+// shutdownTimeout is how long Stop lets running tasks finish before Asynq pushes them back onto their
+// queue (0 uses Asynq's default of 8 seconds)
+func NewAsynqServer(redisAddr string, redisPassword string, logger *zap.Logger, handler *tasks.TaskHandler, persist *tasks.TaskStatePersistence, queues map[string]int, shutdownTimeout time.Duration) *AsynqServer {
 	redisOpt := asynq.RedisClientOpt{
 		Addr:     redisAddr,
 		Password: redisPassword,
@@ -32,16 +41,59 @@ func NewAsynqServer(redisAddr string, redisPassword string, logger *zap.Logger,
 	// Default queues if not specified
 	if queues == nil {
 		queues = map[string]int{
-			tasks.QueueBuild:   10, // Build tasks
-			tasks.QueueDeploy:  10, // Deploy tasks
-			tasks.QueueCleanup: 5,  // Cleanup tasks
+			tasks.QueueBuildInteractive:  20, // Builds someone is waiting on
+			tasks.QueueBuildCritical:     8,  // Security rebuilds and recoveries
+			tasks.QueueBuildPro:          6,  // Automated builds on plans with priority builds
+			tasks.QueueBuild:             3,  // Automated builds on other paid plans
+			tasks.QueueBuildFree:         1,  // Automated builds of trials and free accounts
+			tasks.QueueDeployInteractive: 20, // Deploys someone is waiting on
+			tasks.QueueDeploy:            10, // Deploy tasks
+			tasks.QueueCleanup:           5,  // Cleanup tasks
+			tasks.QueueEmail:             5,  // Queued emails
 		}
 	}
 
+	server := asynq.NewServer(redisOpt, serverConfig(logger, queues, 10, shutdownTimeout)) // Process 10 tasks concurrently
+	mux := asynq.NewServeMux()
+
+	asynqServer := &AsynqServer{
+		server:  server,
+		mux:     mux,
+		logger:  logger,
+		handler: handler,
+		persist: persist,
+		redisOpt: redisOpt,
+		shutdownTimeout: shutdownTimeout,
+	}
+
+	// Setup dead-letter queue monitoring
+	SetupDeadLetterQueue(redisAddr, redisPassword, logger)
+
+	return asynqServer
+}
+
+// ReserveQueues dedicates concurrency extra workers to queues, on top of the general pool that also serves them
+// Used for the interactive build/deploy queues: however deep the general queues get, that many tasks
+// someone is waiting on can always run. Call before Start; concurrency 0 reserves nothing
+func (s *AsynqServer) ReserveQueues(concurrency int, queues ...string) {
+	if concurrency <= 0 || len(queues) == 0 {
+		return
+	}
+	weights := make(map[string]int, len(queues))
+	for _, queue := range queues {
+		weights[queue] = 1
+	}
+	s.reserved = asynq.NewServer(s.redisOpt, serverConfig(s.logger, weights, concurrency, s.shutdownTimeout))
+	s.logger.Info("Reserved workers for queues", zap.Strings("queues", queues), zap.Int("concurrency", concurrency))
+}
+
+// serverConfig is the Asynq configuration of a server processing queues with concurrency workers
+func serverConfig(logger *zap.Logger, queues map[string]int, concurrency int, shutdownTimeout time.Duration) asynq.Config {
 	// Configure server with dead-letter queue
-	config := asynq.Config{
-		Concurrency: 10, // Process 10 tasks concurrently
+	return asynq.Config{
+		Concurrency: concurrency,
 		Queues:      queues,
+		ShutdownTimeout: shutdownTimeout,
 		StrictPriority: false, // No strict priority needed with task-specific queues
 		ErrorHandler: asynq.ErrorHandlerFunc(func(ctx context.Context, task *asynq.Task, err error) {
 			// Check if error is "handler not found" - this shouldn't happen with task-specific queues
@@ -60,6 +112,12 @@ func NewAsynqServer(redisAddr string, redisPassword string, logger *zap.Logger,
 			}
 		}),
 		RetryDelayFunc: func(n int, err error, task *asynq.Task) time.Duration {
+			if task.Type() == tasks.TypeEmailTask {
+				return emailRetryDelay(n)
+			}
+			if errors.Is(err, tasks.ErrHostDraining) {
+				return hostDrainingRetryDelay
+			}
 			// Exponential backoff with jitter
 			baseDelay := time.Duration(n) * time.Second
 			if baseDelay > 30*time.Second {
@@ -69,26 +127,10 @@ func NewAsynqServer(redisAddr string, redisPassword string, logger *zap.Logger,
 		},
 		// Dead-letter queue configuration
 		IsFailure: func(err error) bool {
-			// Consider all errors as failures (can be customized)
-			return err != nil
+			// Deploys handed back by a drained host are not failures - they don't use up retries
+			return err != nil && !errors.Is(err, tasks.ErrHostDraining)
 		},
 	}
-
-	server := asynq.NewServer(redisOpt, config)
-	mux := asynq.NewServeMux()
-
-	asynqServer := &AsynqServer{
-		server:  server,
-		mux:     mux,
-		logger:  logger,
-		handler: handler,
-		persist: persist,
-	}
-
-	// Setup dead-letter queue monitoring
-	SetupDeadLetterQueue(redisAddr, redisPassword, logger)
-
-	return asynqServer
 }
 
 // RegisterHandlers registers all task handlers with middleware
@@ -97,6 +139,12 @@ func (s *AsynqServer) RegisterHandlers() {
 	s.RegisterBuildHandler()
 	s.RegisterDeployHandler()
 	s.RegisterCleanupHandler()
+	s.RegisterCronRunHandler()
+	s.RegisterAppExportHandler()
+	s.RegisterAppWakeHandler()
+	s.RegisterAppPowerHandler()
+	s.RegisterExecHandler()
+	s.RegisterEmailHandler()
 }
 
 // RegisterBuildHandler registers only the build task handler
@@ -114,23 +162,102 @@ func (s *AsynqServer) RegisterCleanupHandler() {
 	s.mux.HandleFunc(tasks.TypeCleanupTask, s.withPersistence(s.handler.HandleCleanupTask))
 }
 
-// withPersistence wraps a task handler with state persistence
+// RegisterCronRunHandler registers the cron job run handler (deploy worker, which owns app containers)
+func (s *AsynqServer) RegisterCronRunHandler() {
+	s.mux.HandleFunc(tasks.TypeCronRunTask, s.withPersistence(s.handler.HandleCronRunTask))
+}
+
+// RegisterAppExportHandler registers the app export handler (deploy worker, which can read app volumes)
+func (s *AsynqServer) RegisterAppExportHandler() {
+	s.mux.HandleFunc(tasks.TypeAppExportTask, s.withPersistence(s.handler.HandleAppExportTask))
+}
+
+// RegisterAppWakeHandler registers the handler that wakes sleeping apps (deploy worker, which owns app containers)
+func (s *AsynqServer) RegisterAppWakeHandler() {
+	s.mux.HandleFunc(tasks.TypeAppWakeTask, s.withPersistence(s.handler.HandleAppWakeTask))
+}
+
+// RegisterAppPowerHandler registers the handler that stops and starts apps for their owners (deploy worker, which owns app containers)
+func (s *AsynqServer) RegisterAppPowerHandler() {
+	s.mux.HandleFunc(tasks.TypeAppPowerTask, s.withPersistence(s.handler.HandleAppPowerTask))
+}
+
+// RegisterExecHandler registers the one-off exec handler (deploy worker, which owns app containers)
+func (s *AsynqServer) RegisterExecHandler() {
+	s.mux.HandleFunc(tasks.TypeExecTask, s.withPersistence(s.handler.HandleExecTask))
+}
+
+// RegisterEmailHandler registers the queued email delivery handler
+func (s *AsynqServer) RegisterEmailHandler() {
+	s.mux.HandleFunc(tasks.TypeEmailTask, s.withPersistence(s.handler.HandleEmailTask))
+}
+
+// hostDrainingRetryDelay is the wait before a deploy handed back by a drained host is picked up again
+const hostDrainingRetryDelay = 15 * time.Second
+
+// emailRetryDelay is the wait before retry n (1-based) of an email: 30s doubling up to an hour, so
+// a provider outage of up to about two hours delays emails rather than losing them
+func emailRetryDelay(n int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < n && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
+
+// withPersistence wraps a task handler with state persistence (when configured) and task metrics
 func (s *AsynqServer) withPersistence(handler func(context.Context, *asynq.Task) error) asynq.HandlerFunc {
 	return func(ctx context.Context, t *asynq.Task) error {
-		// Task ID is not directly available in handler context
-		// We'll track it via task payload or use a different approach
-		// For now, skip persistence tracking in handler (can be added via middleware)
-		
+		observeQueueWait(ctx, t)
+		s.persistState(ctx, t, func(ctx context.Context) error {
+			return s.persist.OnTaskStarted(ctx, t)
+		})
+
 		// Execute handler
+		startedAt := time.Now()
 		err := handler(ctx, t)
+		metrics.ObserveTask(t.Type(), time.Since(startedAt), err)
 
-		// TODO: Track task state via database queries using task payload
-		// This requires extracting task ID from payload or using a different tracking mechanism
-
+		s.persistState(ctx, t, func(ctx context.Context) error {
+			return s.persist.OnTaskFinished(ctx, t, err)
+		})
 		return err
 	}
 }
 
+// persistState runs a task state update, even when the task's context has expired
+// Failures are logged; the task's outcome never depends on its state being recorded
+func (s *AsynqServer) persistState(ctx context.Context, t *asynq.Task, update func(context.Context) error) {
+	if s.persist == nil {
+		return
+	}
+	persistCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := update(persistCtx); err != nil {
+		s.logger.Warn("Failed to persist task state", zap.Error(err), zap.String("task_type", t.Type()))
+	}
+}
+
+// observeQueueWait records how long a build or deploy task waited, by queue and trigger
+// Tasks enqueued before queued_at was stamped are skipped
+func observeQueueWait(ctx context.Context, t *asynq.Task) {
+	if t.Type() != tasks.TypeBuildTask && t.Type() != tasks.TypeDeployTask {
+		return
+	}
+	var payload struct {
+		Trigger  string    `json:"trigger"`
+		QueuedAt time.Time `json:"queued_at"`
+	}
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil || payload.QueuedAt.IsZero() {
+		return
+	}
+	queue, _ := asynq.GetQueueName(ctx)
+	metrics.ObserveTaskWait(t.Type(), queue, payload.Trigger, time.Since(payload.QueuedAt))
+}
+
 // Start starts the Asynq server
 func (s *AsynqServer) Start(ctx context.Context) error {
 	s.logger.Info("Starting Asynq server")
@@ -138,6 +265,11 @@ func (s *AsynqServer) Start(ctx context.Context) error {
 	if err := s.server.Start(s.mux); err != nil {
 		return fmt.Errorf("failed to start Asynq server: %w", err)
 	}
+	if s.reserved != nil {
+		if err := s.reserved.Start(s.mux); err != nil {
+			return fmt.Errorf("failed to start reserved Asynq server: %w", err)
+		}
+	}
 
 	// Wait for context cancellation
 	<-ctx.Done()
@@ -145,9 +277,24 @@ func (s *AsynqServer) Start(ctx context.Context) error {
 }
 
 // Stop gracefully stops the Asynq server
+// No new tasks are picked up; running tasks get the shutdown timeout to finish, and the rest go back onto
+// their queue. Interrupted builds then checkpoint themselves, which ctx bounds
 func (s *AsynqServer) Stop(ctx context.Context) error {
 	s.logger.Info("Stopping Asynq server")
-	s.server.Shutdown()
+	s.handler.StartDraining(ctx)
+	var wg sync.WaitGroup
+	for _, server := range []*asynq.Server{s.server, s.reserved} {
+		if server == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(server *asynq.Server) {
+			defer wg.Done()
+			server.Shutdown()
+		}(server)
+	}
+	wg.Wait()
+	s.handler.WaitForBuilds(ctx)
 	return nil
 }
 
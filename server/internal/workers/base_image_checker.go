@@ -0,0 +1,231 @@
+package workers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"stackyn/server/internal/deploystate"
+	"stackyn/server/internal/services"
+	"stackyn/server/internal/tasks"
+)
+
+// baseImageApp is a built app and the base image its latest build used
+type baseImageApp struct {
+	id            string
+	name          string
+	userID        string
+	status        string
+	repoURL       string
+	branch        string
+	rootDir       string
+	baseImage     string
+	digest        sql.NullString
+	handledDigest sql.NullString
+	autoRebuild   bool
+}
+
+// BaseImageChecker watches the base images apps are built from for new upstream builds
+// Runs in the deploy worker. Every pass asks the registry which digest each base image tag (node:20-alpine,
+// python:3.12-slim, ...) points to now. When it moved past the digest an app was last built with, the owner
+// is told once per new digest and apps with auto_security_rebuild are rebuilt on it, pulling the new base,
+// and redeployed with the "security_rebuild" trigger. A build whose base digest could not be read is
+// assumed to have used the digest current at the first check
+type BaseImageChecker struct {
+	pool        *pgxpool.Pool
+	deployments *services.DeploymentService
+	taskEnqueue BuildEnqueuer
+	notifier    *services.Notifier
+	logger      *zap.Logger
+	interval    time.Duration
+}
+
+// NewBaseImageChecker creates a new base image checker
+func NewBaseImageChecker(pool *pgxpool.Pool, deployments *services.DeploymentService, taskEnqueue BuildEnqueuer, notifier *services.Notifier, interval time.Duration, logger *zap.Logger) *BaseImageChecker {
+	return &BaseImageChecker{
+		pool:        pool,
+		deployments: deployments,
+		taskEnqueue: taskEnqueue,
+		notifier:    notifier,
+		logger:      logger,
+		interval:    interval,
+	}
+}
+
+// Start starts the checking loop
+func (w *BaseImageChecker) Start(ctx context.Context) error {
+	w.logger.Info("Starting base image checker", zap.Duration("interval", w.interval))
+
+	w.check(ctx)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Base image checker stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			w.check(ctx)
+		}
+	}
+}
+
+// check looks up each base image in use once and handles the apps built from it
+// Failed lookups are logged and retried next pass
+func (w *BaseImageChecker) check(ctx context.Context) {
+	apps, err := w.listApps(ctx)
+	if err != nil {
+		w.logger.Error("Failed to list apps with base images", zap.Error(err))
+		return
+	}
+
+	byImage := make(map[string][]baseImageApp)
+	for _, app := range apps {
+		byImage[app.baseImage] = append(byImage[app.baseImage], app)
+	}
+
+	updates := 0
+	for baseImage, imageApps := range byImage {
+		// Base images are public; registry rate limits are why each one is looked up once per pass
+		lookupCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		latest, err := w.deployments.SourceImageDigest(lookupCtx, baseImage, nil)
+		cancel()
+		if err != nil {
+			w.logger.Warn("Failed to check base image for updates", zap.Error(err), zap.String("base_image", baseImage))
+			continue
+		}
+
+		for _, app := range imageApps {
+			if w.checkApp(ctx, app, latest) {
+				updates++
+			}
+		}
+	}
+
+	w.logger.Debug("Checked base images for updates",
+		zap.Int("base_images", len(byImage)),
+		zap.Int("apps", len(apps)),
+		zap.Int("updates", updates),
+	)
+}
+
+// checkApp stores the latest digest of an app's base image and acts on a new one
+// Returns true when the app was told about (and possibly rebuilt for) a new digest
+func (w *BaseImageChecker) checkApp(ctx context.Context, app baseImageApp, latest string) bool {
+	if _, err := w.pool.Exec(ctx,
+		`UPDATE apps SET
+		     base_image_latest_digest = $2,
+		     base_image_digest = COALESCE(base_image_digest, $2),
+		     base_image_checked_at = NOW()
+		 WHERE id = $1 AND base_image = $3`,
+		app.id, latest, app.baseImage,
+	); err != nil {
+		w.logger.Error("Failed to store latest base image digest", zap.Error(err), zap.String("app_id", app.id))
+		return false
+	}
+
+	if !app.digest.Valid || latest == app.digest.String || latest == app.handledDigest.String {
+		return false
+	}
+
+	// Claim the digest first so a failing notification or enqueue is not repeated every pass
+	tag, err := w.pool.Exec(ctx,
+		`UPDATE apps SET base_image_handled_digest = $2
+		 WHERE id = $1 AND base_image = $3 AND base_image_handled_digest IS DISTINCT FROM $2`,
+		app.id, latest, app.baseImage,
+	)
+	if err != nil {
+		w.logger.Error("Failed to record handled base image digest", zap.Error(err), zap.String("app_id", app.id))
+		return false
+	}
+	if tag.RowsAffected() == 0 {
+		return false
+	}
+
+	w.logger.Info("Base image update available",
+		zap.String("app_id", app.id),
+		zap.String("base_image", app.baseImage),
+		zap.String("built_digest", app.digest.String),
+		zap.String("latest_digest", latest),
+	)
+
+	rebuilding := false
+	if app.autoRebuild {
+		rebuilding = w.rebuild(ctx, app)
+	}
+
+	if w.notifier != nil {
+		notifyCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		if err := w.notifier.NotifyBaseImageUpdate(notifyCtx, app.userID, services.BaseImageUpdate{
+			AppName:     app.name,
+			BaseImage:   app.baseImage,
+			AutoRebuild: rebuilding,
+		}); err != nil {
+			w.logger.Warn("Failed to send base image update notification", zap.Error(err), zap.String("app_id", app.id))
+		}
+	}
+	return true
+}
+
+// rebuild enqueues a security rebuild of an app; returns false when the app is busy or the enqueue failed
+// A build that is already running picks up the same base image tag, so there is nothing to add to it
+func (w *BaseImageChecker) rebuild(ctx context.Context, app baseImageApp) bool {
+	if app.status == "building" || app.status == "deploying" {
+		w.logger.Info("Skipping security rebuild - app is already building", zap.String("app_id", app.id))
+		return false
+	}
+
+	payload := tasks.BuildTaskPayload{
+		AppID:      app.id,
+		BuildJobID: uuid.New().String(),
+		RepoURL:    app.repoURL,
+		Branch:     app.branch,
+		RootDir:    app.rootDir,
+		UserID:     app.userID,
+		Trigger:    deploystate.TriggerSecurityRebuild,
+	}
+	if _, err := w.taskEnqueue.EnqueueBuildTask(ctx, payload, app.userID); err != nil {
+		w.logger.Warn("Failed to enqueue security rebuild", zap.Error(err), zap.String("app_id", app.id))
+		return false
+	}
+
+	w.logger.Info("Security rebuild enqueued",
+		zap.String("app_id", app.id),
+		zap.String("build_job_id", payload.BuildJobID),
+		zap.String("base_image", app.baseImage),
+	)
+	return true
+}
+
+// listApps lists git apps whose latest build recorded a base image
+// Disabled apps are skipped; sleeping apps are still told (and rebuilt, which wakes them)
+func (w *BaseImageChecker) listApps(ctx context.Context) ([]baseImageApp, error) {
+	rows, err := w.pool.Query(ctx,
+		`SELECT id, name, user_id, status, COALESCE(repo_url, ''), COALESCE(branch, ''), COALESCE(root_dir, ''),
+		        base_image, base_image_digest, base_image_handled_digest, auto_security_rebuild
+		 FROM apps
+		 WHERE base_image IS NOT NULL AND source_type = 'git' AND status <> 'disabled'`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query apps with base images: %w", err)
+	}
+	defer rows.Close()
+
+	var apps []baseImageApp
+	for rows.Next() {
+		var app baseImageApp
+		if err := rows.Scan(&app.id, &app.name, &app.userID, &app.status, &app.repoURL, &app.branch, &app.rootDir,
+			&app.baseImage, &app.digest, &app.handledDigest, &app.autoRebuild); err != nil {
+			return nil, fmt.Errorf("failed to scan app with base image: %w", err)
+		}
+		apps = append(apps, app)
+	}
+	return apps, rows.Err()
+}
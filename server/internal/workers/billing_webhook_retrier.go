@@ -0,0 +1,57 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// BillingWebhookInbox applies stored billing webhook events whose retry is due
+type BillingWebhookInbox interface {
+	RetryDueWebhookEvents(ctx context.Context) (int, error)
+}
+
+// BillingWebhookRetrier retries billing webhook events that failed to apply when they arrived
+// Runs in the API server, which owns the webhook handlers; events are claimed with a lease so
+// several API instances can run it side by side
+type BillingWebhookRetrier struct {
+	inbox    BillingWebhookInbox
+	logger   *zap.Logger
+	interval time.Duration
+}
+
+// NewBillingWebhookRetrier creates a new billing webhook retrier
+func NewBillingWebhookRetrier(inbox BillingWebhookInbox, logger *zap.Logger) *BillingWebhookRetrier {
+	return &BillingWebhookRetrier{
+		inbox:    inbox,
+		logger:   logger,
+		interval: time.Minute, // The shortest retry delay
+	}
+}
+
+// Start starts the retrier loop
+func (r *BillingWebhookRetrier) Start(ctx context.Context) error {
+	r.logger.Info("Starting billing webhook retrier", zap.Duration("interval", r.interval))
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Billing webhook retrier stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			n, err := r.inbox.RetryDueWebhookEvents(ctx)
+			if err != nil {
+				r.logger.Error("Failed to retry billing webhook events", zap.Error(err))
+				// Continue - don't stop retrier on error
+				continue
+			}
+			if n > 0 {
+				r.logger.Info("Retried billing webhook events", zap.Int("events", n))
+			}
+		}
+	}
+}
@@ -12,7 +12,8 @@ import (
 )
 
 // BillingWorker handles trial expiration and billing lifecycle
-// Runs every 30 minutes to check for expired trials
+// Runs every 30 minutes to check for expired trials, ended payment grace periods and the period ends
+// of cancelled subscriptions
 type BillingWorker struct {
 	pool                *pgxpool.Pool
 	subscriptionService *services.SubscriptionService
@@ -40,6 +41,14 @@ func (w *BillingWorker) Start(ctx context.Context) error {
 		w.logger.Error("Failed to process expired trials on startup", zap.Error(err))
 		// Continue anyway - don't fail startup
 	}
+	if err := w.processExpiredGracePeriods(ctx); err != nil {
+		w.logger.Error("Failed to process expired grace periods on startup", zap.Error(err))
+		// Continue anyway - don't fail startup
+	}
+	if err := w.processEndedPeriods(ctx); err != nil {
+		w.logger.Error("Failed to process ended billing periods on startup", zap.Error(err))
+		// Continue anyway - don't fail startup
+	}
 
 	ticker := time.NewTicker(w.interval)
 	defer ticker.Stop()
@@ -54,6 +63,14 @@ func (w *BillingWorker) Start(ctx context.Context) error {
 				w.logger.Error("Failed to process expired trials", zap.Error(err))
 				// Continue - don't stop worker on error
 			}
+			if err := w.processExpiredGracePeriods(ctx); err != nil {
+				w.logger.Error("Failed to process expired grace periods", zap.Error(err))
+				// Continue - don't stop worker on error
+			}
+			if err := w.processEndedPeriods(ctx); err != nil {
+				w.logger.Error("Failed to process ended billing periods", zap.Error(err))
+				// Continue - don't stop worker on error
+			}
 		}
 	}
 }
@@ -140,3 +157,109 @@ func (w *BillingWorker) processExpiredTrials(ctx context.Context) error {
 	return nil
 }
 
+
+// processExpiredGracePeriods stops apps for users whose payment grace period has ended
+func (w *BillingWorker) processExpiredGracePeriods(ctx context.Context) error {
+	rows, err := w.pool.Query(ctx,
+		`SELECT id, email 
+		 FROM users 
+		 WHERE billing_status = 'grace' 
+		   AND grace_ends_at IS NOT NULL 
+		   AND grace_ends_at < NOW()`,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to query expired grace periods: %w", err)
+	}
+	defer rows.Close()
+
+	type graceUser struct {
+		ID    string
+		Email string
+	}
+	var expiredUsers []graceUser
+	for rows.Next() {
+		var user graceUser
+		if err := rows.Scan(&user.ID, &user.Email); err != nil {
+			w.logger.Error("Failed to scan grace period user", zap.Error(err))
+			continue
+		}
+		expiredUsers = append(expiredUsers, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating grace period users: %w", err)
+	}
+
+	for _, user := range expiredUsers {
+		// Grace period is over - expire the subscription and stop all apps
+		if err := w.subscriptionService.EndSubscription(ctx, user.ID, user.Email); err != nil {
+			w.logger.Error("Failed to end subscription after grace period",
+				zap.Error(err),
+				zap.String("user_id", user.ID),
+				zap.String("user_email", user.Email),
+			)
+			// Continue processing other users
+			continue
+		}
+
+		w.logger.Info("Grace period ended - subscription expired and apps stopped",
+			zap.String("user_id", user.ID),
+			zap.String("user_email", user.Email),
+		)
+	}
+
+	if len(expiredUsers) > 0 {
+		w.logger.Info("Grace period processing completed", zap.Int("processed", len(expiredUsers)))
+	}
+	return nil
+}
+
+// processEndedPeriods cancels subscriptions that were cancelled at period end once the period is over
+// Lemon Squeezy sends subscription_expired then too; whichever comes first cancels the subscription
+func (w *BillingWorker) processEndedPeriods(ctx context.Context) error {
+	rows, err := w.pool.Query(ctx,
+		`SELECT DISTINCT user_id
+		 FROM subscriptions
+		 WHERE status = 'active'
+		   AND cancel_at_period_end = true
+		   AND current_period_end < NOW()`,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to query ended billing periods: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			w.logger.Error("Failed to scan ended billing period", zap.Error(err))
+			continue
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating ended billing periods: %w", err)
+	}
+
+	for _, userID := range userIDs {
+		if err := w.subscriptionService.CancelSubscription(ctx, userID); err != nil {
+			w.logger.Error("Failed to cancel subscription at period end",
+				zap.Error(err),
+				zap.String("user_id", userID),
+			)
+			// Continue processing other users
+			continue
+		}
+
+		w.logger.Info("Billing period ended - cancelled subscription",
+			zap.String("user_id", userID),
+		)
+	}
+
+	if len(userIDs) > 0 {
+		w.logger.Info("Billing period processing completed", zap.Int("processed", len(userIDs)))
+	}
+	return nil
+}
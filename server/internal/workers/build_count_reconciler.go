@@ -0,0 +1,89 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// BuildCountReconciler resets the concurrent build counters to the builds the database says are running
+// Runs in the API server. Build tasks hold a slot from start to finish, so a worker killed mid-build
+// leaks one; the counters also expire on their own, but reconciling keeps a busy user from being
+// blocked by a leaked slot until then
+type BuildCountReconciler struct {
+	pool            *pgxpool.Pool
+	planEnforcement *services.PlanEnforcementService
+	logger          *zap.Logger
+	interval        time.Duration
+}
+
+// NewBuildCountReconciler creates a new build count reconciler
+func NewBuildCountReconciler(pool *pgxpool.Pool, planEnforcement *services.PlanEnforcementService, logger *zap.Logger) *BuildCountReconciler {
+	return &BuildCountReconciler{
+		pool:            pool,
+		planEnforcement: planEnforcement,
+		logger:          logger,
+		interval:        5 * time.Minute, // Run every 5 minutes
+	}
+}
+
+// Start starts the reconciliation loop
+// The first pass runs immediately so counters left over from before a restart are corrected
+func (w *BuildCountReconciler) Start(ctx context.Context) error {
+	w.logger.Info("Starting build count reconciler", zap.Duration("interval", w.interval))
+
+	if err := w.reconcile(ctx); err != nil {
+		w.logger.Error("Failed to reconcile build counts", zap.Error(err))
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Build count reconciler stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			if err := w.reconcile(ctx); err != nil {
+				w.logger.Error("Failed to reconcile build counts", zap.Error(err))
+				// Continue - don't stop reconciler on error
+			}
+		}
+	}
+}
+
+// reconcile counts the apps each owner has building and replaces the tracked counts with them
+func (w *BuildCountReconciler) reconcile(ctx context.Context) error {
+	rows, err := w.pool.Query(ctx,
+		`SELECT user_id::text, COUNT(*) FROM apps WHERE status = 'building' GROUP BY user_id`,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to count running builds: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var userID string
+		var count int
+		if err := rows.Scan(&userID, &count); err != nil {
+			return fmt.Errorf("failed to scan build count: %w", err)
+		}
+		counts[userID] = count
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to count running builds: %w", err)
+	}
+
+	if err := w.planEnforcement.ReconcileBuildCounts(ctx, counts); err != nil {
+		return fmt.Errorf("failed to store build counts: %w", err)
+	}
+
+	w.logger.Debug("Reconciled build counts", zap.Int("users_building", len(counts)))
+	return nil
+}
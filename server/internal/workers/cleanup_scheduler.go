@@ -0,0 +1,76 @@
+package workers
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// cleanupRunTimeout bounds one scheduled run, well inside the cleanup lock's TTL
+const cleanupRunTimeout = 10 * time.Minute
+
+// CleanupRunner runs one cleanup (tasks.TaskHandler)
+type CleanupRunner interface {
+	RunScheduledCleanup(ctx context.Context) error
+}
+
+// CleanupScheduler runs cleanup every interval plus a random jitter
+// Every cleanup worker runs a scheduler; the jitter spreads their runs out and the cleanup lock
+// makes the others skip while one is running or has just run. Admins trigger a run at any time
+// through the cleanup queue
+type CleanupScheduler struct {
+	runner   CleanupRunner
+	interval time.Duration
+	jitter   time.Duration
+	logger   *zap.Logger
+}
+
+// NewCleanupScheduler creates a new cleanup scheduler
+func NewCleanupScheduler(runner CleanupRunner, interval, jitter time.Duration, logger *zap.Logger) *CleanupScheduler {
+	return &CleanupScheduler{
+		runner:   runner,
+		interval: interval,
+		jitter:   jitter,
+		logger:   logger,
+	}
+}
+
+// Start starts the scheduling loop; the first run is within one jitter of starting
+func (s *CleanupScheduler) Start(ctx context.Context) error {
+	s.logger.Info("Starting cleanup scheduler",
+		zap.Duration("interval", s.interval),
+		zap.Duration("jitter", s.jitter),
+	)
+
+	timer := time.NewTimer(s.randomJitter())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Cleanup scheduler stopped")
+			return ctx.Err()
+		case <-timer.C:
+			s.run(ctx)
+			timer.Reset(s.interval + s.randomJitter())
+		}
+	}
+}
+
+// run runs one cleanup; failures are logged (and counted by the runner) and retried next interval
+func (s *CleanupScheduler) run(ctx context.Context) {
+	runCtx, cancel := context.WithTimeout(ctx, cleanupRunTimeout)
+	defer cancel()
+	if err := s.runner.RunScheduledCleanup(runCtx); err != nil {
+		s.logger.Error("Scheduled cleanup failed", zap.Error(err))
+	}
+}
+
+func (s *CleanupScheduler) randomJitter() time.Duration {
+	if s.jitter <= 0 {
+		return 0
+	}
+	return rand.N(s.jitter)
+}
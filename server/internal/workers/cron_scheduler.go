@@ -0,0 +1,227 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+	"stackyn/server/internal/tasks"
+)
+
+// cronClaimBatch bounds how many due jobs one scheduler pass claims
+const cronClaimBatch = 100
+
+// CronRunEnqueuer enqueues cron job runs
+type CronRunEnqueuer interface {
+	EnqueueCronRunTask(ctx context.Context, runID string, timeoutSeconds int, payload interface{}) (*asynq.TaskInfo, error)
+}
+
+// CronScheduler enqueues cron job runs when they are due
+// Runs in the API server. Due jobs are claimed with SKIP LOCKED and moved to their next run in the
+// same transaction, so concurrent API instances never start the same run twice. Runs missed while
+// no scheduler was up are not caught up - the job simply runs at its next scheduled time
+type CronScheduler struct {
+	pool     *pgxpool.Pool
+	enqueuer CronRunEnqueuer
+	logger   *zap.Logger
+	interval time.Duration
+}
+
+// dueCronJob is a cron job claimed by the scheduler
+type dueCronJob struct {
+	ID             string
+	AppID          string
+	UserID         string
+	Schedule       string
+	Command        string
+	TimeoutSeconds int
+	ScheduledFor   time.Time
+	RunID          string // Set when a run was queued
+	DeploymentID   string
+	ImageName      string
+}
+
+// NewCronScheduler creates a new cron scheduler
+func NewCronScheduler(pool *pgxpool.Pool, enqueuer CronRunEnqueuer, logger *zap.Logger) *CronScheduler {
+	return &CronScheduler{
+		pool:     pool,
+		enqueuer: enqueuer,
+		logger:   logger,
+		interval: 30 * time.Second, // Well under the one-minute schedule resolution
+	}
+}
+
+// Start starts the scheduler loop
+func (s *CronScheduler) Start(ctx context.Context) error {
+	s.logger.Info("Starting cron scheduler", zap.Duration("interval", s.interval))
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Cron scheduler stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			if err := s.runDue(ctx); err != nil {
+				s.logger.Error("Failed to run due cron jobs", zap.Error(err))
+				// Continue - don't stop scheduler on error
+			}
+		}
+	}
+}
+
+// runDue claims the due jobs, records their runs and enqueues them
+func (s *CronScheduler) runDue(ctx context.Context) error {
+	jobs, err := s.claimDue(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if job.RunID == "" {
+			continue
+		}
+		payload := tasks.CronRunTaskPayload{
+			RunID:          job.RunID,
+			CronJobID:      job.ID,
+			AppID:          job.AppID,
+			UserID:         job.UserID,
+			DeploymentID:   job.DeploymentID,
+			ImageName:      job.ImageName,
+			Command:        job.Command,
+			TimeoutSeconds: job.TimeoutSeconds,
+		}
+		if _, err := s.enqueuer.EnqueueCronRunTask(ctx, job.RunID, job.TimeoutSeconds, payload); err != nil {
+			s.logger.Error("Failed to enqueue cron run",
+				zap.Error(err),
+				zap.String("cron_job_id", job.ID),
+				zap.String("run_id", job.RunID),
+			)
+			if _, err := s.pool.Exec(ctx,
+				`UPDATE cron_job_runs SET status = 'failed', error_message = $2, finished_at = NOW()
+				 WHERE id = $1 AND status = 'queued'`,
+				job.RunID, "Failed to queue the run",
+			); err != nil {
+				s.logger.Warn("Failed to mark cron run as failed", zap.Error(err), zap.String("run_id", job.RunID))
+			}
+		}
+	}
+
+	if len(jobs) > 0 {
+		s.logger.Info("Ran due cron jobs", zap.Int("jobs", len(jobs)))
+	}
+	return nil
+}
+
+// claimDue locks the due jobs, advances each to its next run and records a run row for it
+// A job whose previous run is still queued or running is skipped for this slot (runs never overlap)
+func (s *CronScheduler) claimDue(ctx context.Context) ([]*dueCronJob, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`SELECT c.id, c.app_id, a.user_id, c.schedule, c.command, c.timeout_seconds, c.next_run_at
+		 FROM cron_jobs c
+		 JOIN apps a ON a.id = c.app_id
+		 WHERE c.enabled AND c.next_run_at <= NOW() AND a.status <> 'disabled'
+		 ORDER BY c.next_run_at
+		 LIMIT $1
+		 FOR UPDATE OF c SKIP LOCKED`,
+		cronClaimBatch,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim due cron jobs: %w", err)
+	}
+	var jobs []*dueCronJob
+	for rows.Next() {
+		var job dueCronJob
+		if err := rows.Scan(&job.ID, &job.AppID, &job.UserID, &job.Schedule, &job.Command, &job.TimeoutSeconds, &job.ScheduledFor); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan due cron job: %w", err)
+		}
+		jobs = append(jobs, &job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim due cron jobs: %w", err)
+	}
+
+	now := time.Now().UTC()
+	for _, job := range jobs {
+		// Advance first so a job that cannot run this time is not retried every pass
+		var nextRunAt *time.Time
+		if schedule, err := services.ParseCronSchedule(job.Schedule); err != nil {
+			s.logger.Warn("Disabling cron job with invalid schedule", zap.Error(err), zap.String("cron_job_id", job.ID))
+		} else if next := schedule.Next(now); !next.IsZero() {
+			nextRunAt = &next
+		}
+		if _, err := tx.Exec(ctx,
+			`UPDATE cron_jobs SET next_run_at = $2, last_run_at = NOW(), enabled = enabled AND $2::timestamp IS NOT NULL
+			 WHERE id = $1`,
+			job.ID, nextRunAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to advance cron job %s: %w", job.ID, err)
+		}
+
+		var overlapping bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS (
+				SELECT 1 FROM cron_job_runs
+				WHERE cron_job_id = $1 AND status IN ('queued', 'running')
+				  AND created_at > NOW() - make_interval(secs => $2)
+			 )`,
+			job.ID, job.TimeoutSeconds+600, // Runs older than their timeout plus slack were lost with their worker
+		).Scan(&overlapping); err != nil {
+			return nil, fmt.Errorf("failed to check running cron runs: %w", err)
+		}
+		if overlapping {
+			s.logger.Info("Skipping cron run - previous run still in progress", zap.String("cron_job_id", job.ID))
+			continue
+		}
+
+		status, errorMsg := "queued", ""
+		err := tx.QueryRow(ctx,
+			`SELECT id, image_name FROM deployments
+			 WHERE app_id = $1 AND status = 'running'
+			   AND image_name IS NOT NULL AND image_name <> ''
+			 ORDER BY created_at DESC
+			 LIMIT 1`,
+			job.AppID,
+		).Scan(&job.DeploymentID, &job.ImageName)
+		if err != nil {
+			if !errors.Is(err, pgx.ErrNoRows) {
+				return nil, fmt.Errorf("failed to get current image for app %s: %w", job.AppID, err)
+			}
+			status, errorMsg = "failed", "App has no running deployment to run the command in"
+		}
+
+		var runID string
+		if err := tx.QueryRow(ctx,
+			`INSERT INTO cron_job_runs (cron_job_id, app_id, trigger, status, image_name, error_message, scheduled_for, finished_at)
+			 VALUES ($1, $2, 'schedule', $3, NULLIF($4, ''), NULLIF($5, ''), $6, CASE WHEN $3 = 'failed' THEN NOW() END)
+			 RETURNING id`,
+			job.ID, job.AppID, status, job.ImageName, errorMsg, job.ScheduledFor,
+		).Scan(&runID); err != nil {
+			return nil, fmt.Errorf("failed to record cron run: %w", err)
+		}
+		if status == "queued" {
+			job.RunID = runID
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit claimed cron jobs: %w", err)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,365 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// AppPauser pauses a single app with a user-visible reason
+type AppPauser interface {
+	PauseApp(ctx context.Context, appID, reason string) error
+}
+
+// DowngradeReconciler enforces plan limits after a downgrade or expiry
+// Runs periodically and, for each user over their plan limits:
+// 1. Records a pending downgrade and emails the user a deadline
+// 2. Resolves it if the user upgrades or frees capacity before the deadline
+// 3. Pauses the excess apps (largest first) once the deadline passes
+type DowngradeReconciler struct {
+	pool            *pgxpool.Pool
+	planEnforcement *services.PlanEnforcementService
+	emailService    *services.EmailService
+	notifier        *services.Notifier // Optional - applies notification preferences (Slack) to the emails
+	appPauser       AppPauser
+	logger          *zap.Logger
+	interval        time.Duration
+	gracePeriod     time.Duration
+}
+
+// reconcileApp is an enabled app considered for pausing
+type reconcileApp struct {
+	ID    string
+	Name  string
+	RAMMB int
+}
+
+// pendingDowngrade is an open plan_downgrades row
+type pendingDowngrade struct {
+	ID       string
+	Deadline time.Time
+}
+
+// NewDowngradeReconciler creates a new downgrade reconciler
+func NewDowngradeReconciler(pool *pgxpool.Pool, planEnforcement *services.PlanEnforcementService, emailService *services.EmailService, appPauser AppPauser, gracePeriod time.Duration, logger *zap.Logger) *DowngradeReconciler {
+	return &DowngradeReconciler{
+		pool:            pool,
+		planEnforcement: planEnforcement,
+		emailService:    emailService,
+		appPauser:       appPauser,
+		logger:          logger,
+		interval:        30 * time.Minute, // Run every 30 minutes
+		gracePeriod:     gracePeriod,
+	}
+}
+
+// SetNotifier routes plan limit emails through the notifier
+func (w *DowngradeReconciler) SetNotifier(notifier *services.Notifier) {
+	w.notifier = notifier
+}
+
+// notify delivers a plan limit notice, directly by email when no notifier is set
+func (w *DowngradeReconciler) notify(ctx context.Context, userID, email, summary string, sendEmail func(to, locale string) error) error {
+	if w.notifier == nil {
+		return sendEmail(email, services.DefaultLocale)
+	}
+	return w.notifier.Notify(ctx, services.Notification{
+		UserID:    userID,
+		Email:     email,
+		Category:  services.NotificationBilling,
+		Summary:   summary,
+		SendEmail: sendEmail,
+	})
+}
+
+// Start starts the downgrade reconciler loop
+func (w *DowngradeReconciler) Start(ctx context.Context) error {
+	w.logger.Info("Starting downgrade reconciler",
+		zap.Duration("interval", w.interval),
+		zap.Duration("grace_period", w.gracePeriod),
+	)
+
+	// Run immediately on startup, then every interval
+	if err := w.reconcile(ctx); err != nil {
+		w.logger.Error("Failed to reconcile plan downgrades on startup", zap.Error(err))
+		// Continue anyway - don't fail startup
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Downgrade reconciler stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			if err := w.reconcile(ctx); err != nil {
+				w.logger.Error("Failed to reconcile plan downgrades", zap.Error(err))
+				// Continue - don't stop worker on error
+			}
+		}
+	}
+}
+
+// reconcile checks every user with enabled apps or an open downgrade
+func (w *DowngradeReconciler) reconcile(ctx context.Context) error {
+	rows, err := w.pool.Query(ctx,
+		`SELECT u.id, u.email 
+		 FROM users u 
+		 WHERE EXISTS (SELECT 1 FROM apps a WHERE a.user_id = u.id AND a.status <> 'disabled')
+		    OR EXISTS (SELECT 1 FROM plan_downgrades d WHERE d.user_id = u.id AND d.status = 'pending')`,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to query users for downgrade reconciliation: %w", err)
+	}
+
+	type candidate struct {
+		ID    string
+		Email string
+	}
+	var users []candidate
+	for rows.Next() {
+		var user candidate
+		if err := rows.Scan(&user.ID, &user.Email); err != nil {
+			w.logger.Error("Failed to scan user for downgrade reconciliation", zap.Error(err))
+			continue
+		}
+		users = append(users, user)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating users for downgrade reconciliation: %w", err)
+	}
+
+	for _, user := range users {
+		if err := w.reconcileUser(ctx, user.ID, user.Email); err != nil {
+			w.logger.Error("Failed to reconcile plan limits for user",
+				zap.Error(err),
+				zap.String("user_id", user.ID),
+			)
+			// Continue processing other users
+		}
+	}
+
+	return nil
+}
+
+// reconcileUser compares a user's enabled apps against their current plan limits
+func (w *DowngradeReconciler) reconcileUser(ctx context.Context, userID, email string) error {
+	limits, err := w.planEnforcement.GetPlanLimits(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get plan limits: %w", err)
+	}
+	planName := limits.PlanName
+	if planName == "" {
+		planName = "current"
+	}
+
+	apps, err := w.getEnabledApps(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	pending, err := w.getPendingDowngrade(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	excess := selectExcessApps(apps, limits.MaxApps, limits.MaxRAMMB)
+
+	// Within limits - close any open downgrade (user upgraded or removed apps)
+	if len(excess) == 0 {
+		if pending != nil {
+			if _, err := w.pool.Exec(ctx,
+				`UPDATE plan_downgrades SET status = 'resolved', resolved_at = NOW() WHERE id = $1`,
+				pending.ID,
+			); err != nil {
+				return fmt.Errorf("failed to resolve plan downgrade: %w", err)
+			}
+			w.logger.Info("Plan downgrade resolved - user is within limits",
+				zap.String("user_id", userID),
+				zap.String("plan", planName),
+			)
+		}
+		return nil
+	}
+
+	// Newly over limits - record the downgrade and warn the user
+	if pending == nil {
+		totalRAMMB := 0
+		for _, app := range apps {
+			totalRAMMB += app.RAMMB
+		}
+		deadline := time.Now().Add(w.gracePeriod)
+
+		if _, err := w.pool.Exec(ctx,
+			`INSERT INTO plan_downgrades (user_id, plan, max_apps, max_ram_mb, app_count, total_ram_mb, deadline, notified_at) 
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+			 ON CONFLICT (user_id) WHERE status = 'pending' DO NOTHING`,
+			userID, planName, limits.MaxApps, limits.MaxRAMMB, len(apps), totalRAMMB, deadline,
+		); err != nil {
+			return fmt.Errorf("failed to record plan downgrade: %w", err)
+		}
+
+		w.logger.Warn("User exceeds plan limits - excess apps will be paused at deadline",
+			zap.String("user_id", userID),
+			zap.String("plan", planName),
+			zap.Int("app_count", len(apps)),
+			zap.Int("max_apps", limits.MaxApps),
+			zap.Int("total_ram_mb", totalRAMMB),
+			zap.Int("max_ram_mb", limits.MaxRAMMB),
+			zap.Int("excess_apps", len(excess)),
+			zap.Time("deadline", deadline),
+		)
+
+		if w.emailService != nil && email != "" {
+			summary := fmt.Sprintf("Your apps exceed the Stackyn %s plan limits. %d app(s) will be paused on %s unless you upgrade or free up capacity.",
+				planName, len(excess), deadline.Format("January 2, 2006 15:04 MST"))
+			if err := w.notify(ctx, userID, email, summary, func(to, locale string) error {
+				return w.emailService.SendPlanLimitWarningEmail(to, locale, planName, appNames(excess), deadline)
+			}); err != nil {
+				w.logger.Warn("Failed to send plan limit warning email",
+					zap.Error(err),
+					zap.String("user_id", userID),
+				)
+			}
+		}
+		return nil
+	}
+
+	// Still within the grace period
+	if time.Now().Before(pending.Deadline) {
+		return nil
+	}
+
+	// Deadline passed - pause excess apps, largest first
+	if w.appPauser == nil {
+		return fmt.Errorf("app pauser not configured")
+	}
+
+	reason := fmt.Sprintf("Paused: exceeds %s plan limits (%d apps, %d MB RAM). Upgrade your plan or delete other apps, then redeploy to re-enable.", planName, limits.MaxApps, limits.MaxRAMMB)
+	var paused []reconcileApp
+	for _, app := range excess {
+		if err := w.appPauser.PauseApp(ctx, app.ID, reason); err != nil {
+			w.logger.Error("Failed to pause app over plan limits",
+				zap.Error(err),
+				zap.String("user_id", userID),
+				zap.String("app_id", app.ID),
+			)
+			// Continue pausing other apps - the next run retries any that failed
+			continue
+		}
+		paused = append(paused, app)
+	}
+
+	if len(paused) < len(excess) {
+		return fmt.Errorf("paused %d of %d excess apps", len(paused), len(excess))
+	}
+
+	if _, err := w.pool.Exec(ctx,
+		`UPDATE plan_downgrades SET status = 'enforced', enforced_at = NOW() WHERE id = $1`,
+		pending.ID,
+	); err != nil {
+		return fmt.Errorf("failed to mark plan downgrade enforced: %w", err)
+	}
+
+	w.logger.Info("Paused apps exceeding plan limits",
+		zap.String("user_id", userID),
+		zap.String("plan", planName),
+		zap.Int("paused", len(paused)),
+	)
+
+	if w.emailService != nil && email != "" {
+		summary := fmt.Sprintf("%d Stackyn app(s) were paused to fit the %s plan limits.", len(paused), planName)
+		if err := w.notify(ctx, userID, email, summary, func(to, locale string) error {
+			return w.emailService.SendAppsPausedEmail(to, locale, planName, appNames(paused))
+		}); err != nil {
+			w.logger.Warn("Failed to send apps paused email",
+				zap.Error(err),
+				zap.String("user_id", userID),
+			)
+		}
+	}
+
+	return nil
+}
+
+// getEnabledApps returns a user's apps that are not disabled, largest RAM first
+// Newer apps sort first among equal sizes so long-running apps are kept
+func (w *DowngradeReconciler) getEnabledApps(ctx context.Context, userID string) ([]reconcileApp, error) {
+	rows, err := w.pool.Query(ctx,
+		`SELECT id, name, ram_mb 
+		 FROM apps 
+		 WHERE user_id = $1 AND status <> 'disabled' 
+		 ORDER BY ram_mb DESC, created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query apps: %w", err)
+	}
+	defer rows.Close()
+
+	var apps []reconcileApp
+	for rows.Next() {
+		var app reconcileApp
+		if err := rows.Scan(&app.ID, &app.Name, &app.RAMMB); err != nil {
+			return nil, fmt.Errorf("failed to scan app: %w", err)
+		}
+		apps = append(apps, app)
+	}
+
+	return apps, rows.Err()
+}
+
+// getPendingDowngrade returns the user's open downgrade, or nil if none
+func (w *DowngradeReconciler) getPendingDowngrade(ctx context.Context, userID string) (*pendingDowngrade, error) {
+	var pending pendingDowngrade
+	err := w.pool.QueryRow(ctx,
+		`SELECT id, deadline FROM plan_downgrades WHERE user_id = $1 AND status = 'pending'`,
+		userID,
+	).Scan(&pending.ID, &pending.Deadline)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query pending plan downgrade: %w", err)
+	}
+	return &pending, nil
+}
+
+// selectExcessApps picks apps to pause so the rest fit within maxApps and maxRAMMB
+// apps must be sorted largest first - pausing the largest apps frees the most RAM per app
+func selectExcessApps(apps []reconcileApp, maxApps, maxRAMMB int) []reconcileApp {
+	count := len(apps)
+	totalRAMMB := 0
+	for _, app := range apps {
+		totalRAMMB += app.RAMMB
+	}
+
+	var excess []reconcileApp
+	for _, app := range apps {
+		if count <= maxApps && totalRAMMB <= maxRAMMB {
+			break
+		}
+		excess = append(excess, app)
+		count--
+		totalRAMMB -= app.RAMMB
+	}
+	return excess
+}
+
+// appNames returns the names of the given apps
+func appNames(apps []reconcileApp) []string {
+	names := make([]string, len(apps))
+	for i, app := range apps {
+		names[i] = app.Name
+	}
+	return names
+}
@@ -0,0 +1,117 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// HostReporter records the capacity of the Docker host this deploy worker runs app containers on
+// Runs in the deploy worker; each pass upserts the host's row in hosts (served by GET /admin/hosts),
+// leaving whether an admin drained it alone
+type HostReporter struct {
+	pool           *pgxpool.Pool
+	deployments    *services.DeploymentService
+	logger         *zap.Logger
+	name           string // Node name (deployments.node)
+	region         string
+	address        string // Optional: where other hosts' Traefik forwards this host's apps' requests
+	dockerEndpoint string // Optional: where other deploy workers copy images built here from
+	interval       time.Duration
+}
+
+// NewHostReporter creates a new host reporter
+func NewHostReporter(pool *pgxpool.Pool, deployments *services.DeploymentService, name, region string, logger *zap.Logger) *HostReporter {
+	return &HostReporter{
+		pool:        pool,
+		deployments: deployments,
+		logger:      logger,
+		name:        name,
+		region:      region,
+		interval:    30 * time.Second,
+	}
+}
+
+// SetAddresses advertises how other hosts reach this one: its Traefik (address), which the others forward
+// requests for the apps placed here to, and its Docker daemon (dockerEndpoint), which they copy images built
+// here from
+func (w *HostReporter) SetAddresses(address, dockerEndpoint string) {
+	w.address = address
+	w.dockerEndpoint = dockerEndpoint
+}
+
+// Start starts the reporting loop, reporting once straight away
+func (w *HostReporter) Start(ctx context.Context) error {
+	w.logger.Info("Starting host reporter",
+		zap.String("host", w.name),
+		zap.Duration("interval", w.interval),
+	)
+
+	w.report(ctx)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Host reporter stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			w.report(ctx)
+		}
+	}
+}
+
+// report measures the host and stores it; failures are logged and retried next pass
+func (w *HostReporter) report(ctx context.Context) {
+	measureCtx, cancel := context.WithTimeout(ctx, w.interval)
+	defer cancel()
+
+	capacity, err := w.deployments.HostCapacity(measureCtx)
+	if err != nil {
+		w.logger.Warn("Failed to measure host capacity", zap.Error(err))
+		return
+	}
+
+	var diskTotal, diskUsed *int64
+	if capacity.Disk != nil {
+		total, used := int64(capacity.Disk.TotalBytes), int64(capacity.Disk.UsedBytes)
+		diskTotal, diskUsed = &total, &used
+	}
+
+	if _, err := w.pool.Exec(ctx,
+		`INSERT INTO hosts (name, region, docker_version, operating_system, cpus, memory_bytes, cpus_reserved,
+		                    memory_reserved_bytes, disk_total_bytes, disk_used_bytes, containers, containers_running,
+		                    app_containers, images, images_bytes, address, docker_endpoint, reported_at)
+		 VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15,
+		         NULLIF($16, ''), NULLIF($17, ''), NOW())
+		 ON CONFLICT (name) DO UPDATE SET
+		     region = EXCLUDED.region,
+		     docker_version = EXCLUDED.docker_version,
+		     operating_system = EXCLUDED.operating_system,
+		     cpus = EXCLUDED.cpus,
+		     memory_bytes = EXCLUDED.memory_bytes,
+		     cpus_reserved = EXCLUDED.cpus_reserved,
+		     memory_reserved_bytes = EXCLUDED.memory_reserved_bytes,
+		     disk_total_bytes = EXCLUDED.disk_total_bytes,
+		     disk_used_bytes = EXCLUDED.disk_used_bytes,
+		     containers = EXCLUDED.containers,
+		     containers_running = EXCLUDED.containers_running,
+		     app_containers = EXCLUDED.app_containers,
+		     images = EXCLUDED.images,
+		     images_bytes = EXCLUDED.images_bytes,
+		     address = EXCLUDED.address,
+		     docker_endpoint = EXCLUDED.docker_endpoint,
+		     reported_at = EXCLUDED.reported_at`,
+		w.name, w.region, capacity.DockerVersion, capacity.OperatingSystem, capacity.CPUs, capacity.MemoryBytes,
+		capacity.CPUsReserved, capacity.MemoryReservedBytes, diskTotal, diskUsed, capacity.Containers,
+		capacity.ContainersRunning, capacity.AppContainers, capacity.Images, capacity.ImagesBytes,
+		w.address, w.dockerEndpoint,
+	); err != nil {
+		w.logger.Error("Failed to store host capacity", zap.Error(err))
+	}
+}
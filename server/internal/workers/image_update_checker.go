@@ -0,0 +1,153 @@
+package workers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// imageApp is a deployed image app whose image reference can move
+type imageApp struct {
+	id       string
+	userID   string
+	ref      string
+	digest   string
+	latest   string // Digest found by the last check ("" before the first)
+	username sql.NullString
+	password sql.NullString
+}
+
+// ImageUpdateChecker flags image apps whose registry now serves a newer image
+// Runs in the deploy worker, which holds the registry access image deploys pull with. Every pass asks
+// the registry which digest each deployed image app's reference points to now and stores it in
+// image_latest_digest; apps report image_update_available until they are redeployed. Nothing is
+// redeployed automatically. References pinned to a digest never move and are not checked
+type ImageUpdateChecker struct {
+	pool        *pgxpool.Pool
+	deployments *services.DeploymentService
+	appLists    AppListCache // Optional - drops the owners' cached app lists
+	logger      *zap.Logger
+	interval    time.Duration
+}
+
+// NewImageUpdateChecker creates a new image update checker
+func NewImageUpdateChecker(pool *pgxpool.Pool, deployments *services.DeploymentService, logger *zap.Logger) *ImageUpdateChecker {
+	return &ImageUpdateChecker{
+		pool:        pool,
+		deployments: deployments,
+		logger:      logger,
+		interval:    1 * time.Hour,
+	}
+}
+
+// SetAppListCache makes new image updates show up in owners' cached app lists right away
+func (w *ImageUpdateChecker) SetAppListCache(appLists AppListCache) {
+	w.appLists = appLists
+}
+
+// Start starts the checking loop
+func (w *ImageUpdateChecker) Start(ctx context.Context) error {
+	w.logger.Info("Starting image update checker", zap.Duration("interval", w.interval))
+
+	w.check(ctx)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Image update checker stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			w.check(ctx)
+		}
+	}
+}
+
+// check looks up the current digest of every deployed image app; failures are logged and retried next pass
+func (w *ImageUpdateChecker) check(ctx context.Context) {
+	apps, err := w.listImageApps(ctx)
+	if err != nil {
+		w.logger.Error("Failed to list image apps", zap.Error(err))
+		return
+	}
+
+	updates := 0
+	var changedOwners []string
+	for _, app := range apps {
+		if strings.Contains(app.ref, "@") {
+			continue
+		}
+		var auth *services.RegistryAuth
+		if app.username.Valid {
+			auth = &services.RegistryAuth{Username: app.username.String, Password: app.password.String}
+		}
+
+		lookupCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		latest, err := w.deployments.SourceImageDigest(lookupCtx, app.ref, auth)
+		cancel()
+		if err != nil {
+			w.logger.Warn("Failed to check image for updates", zap.Error(err), zap.String("app_id", app.id), zap.String("image", app.ref))
+			continue
+		}
+
+		tag, err := w.pool.Exec(ctx,
+			`UPDATE apps SET image_latest_digest = $2, image_checked_at = NOW() WHERE id = $1 AND image_ref = $3`,
+			app.id, latest, app.ref,
+		)
+		if err != nil {
+			w.logger.Error("Failed to store latest image digest", zap.Error(err), zap.String("app_id", app.id))
+			continue
+		}
+		// Cached app lists carry image_update_available, which changes with the latest digest
+		if latest != app.latest && tag.RowsAffected() > 0 {
+			changedOwners = append(changedOwners, app.userID)
+		}
+		if latest != app.digest {
+			updates++
+			w.logger.Info("Image update available",
+				zap.String("app_id", app.id),
+				zap.String("image", app.ref),
+				zap.String("deployed_digest", app.digest),
+				zap.String("latest_digest", latest),
+			)
+		}
+	}
+
+	if w.appLists != nil && len(changedOwners) > 0 {
+		w.appLists.InvalidateAppLists(ctx, changedOwners...)
+	}
+
+	w.logger.Debug("Checked image apps for updates", zap.Int("apps", len(apps)), zap.Int("updates", updates))
+}
+
+// listImageApps lists image apps that have been deployed, with their registry logins
+func (w *ImageUpdateChecker) listImageApps(ctx context.Context) ([]imageApp, error) {
+	rows, err := w.pool.Query(ctx,
+		`SELECT a.id, a.user_id, a.image_ref, a.image_digest, COALESCE(a.image_latest_digest, ''), c.username, c.password
+		 FROM apps a
+		 LEFT JOIN app_registry_credentials c ON c.app_id = a.id
+		 WHERE a.source_type = 'image' AND a.image_ref IS NOT NULL AND a.image_digest IS NOT NULL`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query image apps: %w", err)
+	}
+	defer rows.Close()
+
+	var apps []imageApp
+	for rows.Next() {
+		var app imageApp
+		if err := rows.Scan(&app.id, &app.userID, &app.ref, &app.digest, &app.latest, &app.username, &app.password); err != nil {
+			return nil, fmt.Errorf("failed to scan image app: %w", err)
+		}
+		apps = append(apps, app)
+	}
+	return apps, rows.Err()
+}
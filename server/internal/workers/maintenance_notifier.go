@@ -0,0 +1,212 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// maintenanceClaimBatch bounds how many maintenance windows one notifier pass handles
+const maintenanceClaimBatch = 10
+
+// MaintenanceNotifier tells owners of apps on nodes/regions under scheduled maintenance about it
+// Runs in the API server. New windows are claimed with SKIP LOCKED by setting notified_at, so concurrent
+// API instances never notify the same window twice. Each affected app's activity feed is annotated with
+// the window, and each owner gets one notification listing their affected apps in their own timezone
+type MaintenanceNotifier struct {
+	pool     *pgxpool.Pool
+	notifier *services.Notifier
+	logger   *zap.Logger
+	interval time.Duration
+}
+
+// pendingMaintenanceWindow is a window claimed by the notifier
+type pendingMaintenanceWindow struct {
+	ID          string
+	Title       string
+	Description string
+	Nodes       []string
+	Regions     []string
+	StartsAt    time.Time
+	EndsAt      time.Time
+}
+
+// maintenanceOwner is the owner of apps affected by a maintenance window
+type maintenanceOwner struct {
+	Timezone string
+	AppNames []string
+}
+
+// NewMaintenanceNotifier creates a new maintenance notifier
+func NewMaintenanceNotifier(pool *pgxpool.Pool, notifier *services.Notifier, logger *zap.Logger) *MaintenanceNotifier {
+	return &MaintenanceNotifier{
+		pool:     pool,
+		notifier: notifier,
+		logger:   logger,
+		interval: 1 * time.Minute,
+	}
+}
+
+// Start starts the notification loop
+func (m *MaintenanceNotifier) Start(ctx context.Context) error {
+	m.logger.Info("Starting maintenance notifier", zap.Duration("interval", m.interval))
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.logger.Info("Maintenance notifier stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			if err := m.notifyPending(ctx); err != nil {
+				m.logger.Error("Failed to notify maintenance windows", zap.Error(err))
+				// Continue - don't stop notifier on error
+			}
+		}
+	}
+}
+
+// notifyPending claims newly scheduled windows and notifies the owners of affected apps
+func (m *MaintenanceNotifier) notifyPending(ctx context.Context) error {
+	windows, err := m.claimPending(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, window := range windows {
+		if err := m.notifyWindow(ctx, window); err != nil {
+			m.logger.Error("Failed to notify maintenance window", zap.Error(err), zap.String("maintenance_id", window.ID))
+		}
+	}
+	return nil
+}
+
+// claimPending marks windows that were not notified yet (and are not over) as notified and returns them
+func (m *MaintenanceNotifier) claimPending(ctx context.Context) ([]*pendingMaintenanceWindow, error) {
+	rows, err := m.pool.Query(ctx,
+		`UPDATE maintenance_windows
+		 SET notified_at = NOW()
+		 WHERE id IN (
+			SELECT id FROM maintenance_windows
+			WHERE notified_at IS NULL AND ends_at > NOW()
+			ORDER BY created_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING id, title, description, nodes, regions, starts_at, ends_at`,
+		maintenanceClaimBatch,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim maintenance windows: %w", err)
+	}
+	defer rows.Close()
+
+	var windows []*pendingMaintenanceWindow
+	for rows.Next() {
+		var window pendingMaintenanceWindow
+		if err := rows.Scan(&window.ID, &window.Title, &window.Description, &window.Nodes, &window.Regions,
+			&window.StartsAt, &window.EndsAt); err != nil {
+			return nil, fmt.Errorf("failed to scan maintenance window: %w", err)
+		}
+		windows = append(windows, &window)
+	}
+	return windows, rows.Err()
+}
+
+// notifyWindow annotates the affected apps' activity feeds and notifies their owners
+func (m *MaintenanceNotifier) notifyWindow(ctx context.Context, window *pendingMaintenanceWindow) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"starts_at": window.StartsAt.UTC().Format(time.RFC3339),
+		"ends_at":   window.EndsAt.UTC().Format(time.RFC3339),
+		"nodes":     window.Nodes,
+		"regions":   window.Regions,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal maintenance activity: %w", err)
+	}
+
+	// Apps are affected if their running deployment was started on one of the nodes or regions
+	rows, err := m.pool.Query(ctx,
+		`SELECT DISTINCT a.id, a.name, u.id, u.timezone
+		 FROM apps a
+		 JOIN deployments d ON d.app_id = a.id AND d.status = 'running'
+		 JOIN users u ON u.id = a.user_id
+		 WHERE d.node = ANY($1) OR d.region = ANY($2)`,
+		window.Nodes, window.Regions,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to find affected apps: %w", err)
+	}
+
+	type affectedApp struct {
+		ID, Name, UserID, Timezone string
+	}
+	var apps []affectedApp
+	for rows.Next() {
+		var app affectedApp
+		if err := rows.Scan(&app.ID, &app.Name, &app.UserID, &app.Timezone); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan affected app: %w", err)
+		}
+		apps = append(apps, app)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to find affected apps: %w", err)
+	}
+
+	owners := make(map[string]*maintenanceOwner)
+	for _, app := range apps {
+		if _, err := m.pool.Exec(ctx,
+			`INSERT INTO app_activity (app_id, kind, title, message, data, maintenance_window_id)
+			 VALUES ($1, 'maintenance', $2, $3, $4, $5)
+			 ON CONFLICT (app_id, maintenance_window_id) WHERE maintenance_window_id IS NOT NULL DO NOTHING`,
+			app.ID, "Scheduled maintenance: "+window.Title, window.Description, data, window.ID,
+		); err != nil {
+			m.logger.Error("Failed to record maintenance activity", zap.Error(err), zap.String("app_id", app.ID))
+		}
+
+		owner, ok := owners[app.UserID]
+		if !ok {
+			owner = &maintenanceOwner{Timezone: app.Timezone}
+			owners[app.UserID] = owner
+		}
+		owner.AppNames = append(owner.AppNames, app.Name)
+	}
+
+	if m.notifier != nil {
+		for userID, owner := range owners {
+			notice := services.MaintenanceNotice{
+				Title:       window.Title,
+				Description: window.Description,
+				StartsAt:    window.StartsAt,
+				EndsAt:      window.EndsAt,
+				AppNames:    owner.AppNames,
+			}
+			if err := m.notifier.NotifyMaintenance(ctx, userID, owner.Timezone, notice); err != nil {
+				m.logger.Error("Failed to notify owner of maintenance", zap.Error(err), zap.String("user_id", userID))
+			}
+		}
+	}
+
+	if _, err := m.pool.Exec(ctx,
+		`UPDATE maintenance_windows SET affected_apps = $2 WHERE id = $1`,
+		window.ID, len(apps),
+	); err != nil {
+		return fmt.Errorf("failed to record affected apps: %w", err)
+	}
+
+	m.logger.Info("Notified owners of scheduled maintenance",
+		zap.String("maintenance_id", window.ID),
+		zap.Int("affected_apps", len(apps)),
+		zap.Int("owners", len(owners)),
+	)
+	return nil
+}
@@ -0,0 +1,257 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// Disk usage needs the container's writable layer size, which Docker computes by walking the
+// filesystem - measure it on every Nth sample and carry the last value over in between
+const metricsDiskSampleEvery = 20
+
+// metricsSampleConcurrency bounds parallel docker stats calls (each blocks ~1s for a CPU delta)
+const metricsSampleConcurrency = 8
+
+// MetricsCollector samples docker stats for every running app container and stores the samples
+// Runs in the deploy worker, which owns the Docker connection for app containers
+type MetricsCollector struct {
+	pool      *pgxpool.Pool
+	client    *client.Client
+	logger    *zap.Logger
+	interval  time.Duration
+	retention time.Duration
+
+	mu       sync.Mutex
+	ticks    int
+	diskSize map[string]int64 // Last measured writable layer size per container
+}
+
+// metricSample is one resource usage sample of an app container
+type metricSample struct {
+	appID            string
+	containerID      string
+	sampledAt        time.Time
+	cpuPercent       float64
+	cpuLimit         float64
+	memoryUsageBytes int64
+	memoryLimitBytes int64
+	diskUsageBytes   *int64
+	networkRxBytes   int64
+	networkTxBytes   int64
+	restartCount     int
+}
+
+// NewMetricsCollector creates a new metrics collector
+func NewMetricsCollector(pool *pgxpool.Pool, dockerClient *client.Client, interval, retention time.Duration, logger *zap.Logger) *MetricsCollector {
+	return &MetricsCollector{
+		pool:      pool,
+		client:    dockerClient,
+		logger:    logger,
+		interval:  interval,
+		retention: retention,
+		diskSize:  make(map[string]int64),
+	}
+}
+
+// Start starts the metrics collector
+// It samples every interval and prunes samples older than the retention period
+func (c *MetricsCollector) Start(ctx context.Context) error {
+	c.logger.Info("Starting metrics collector",
+		zap.Duration("interval", c.interval),
+		zap.Duration("retention", c.retention),
+	)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.logger.Info("Metrics collector stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			if err := c.collect(ctx); err != nil {
+				c.logger.Error("Failed to collect container metrics", zap.Error(err))
+				// Continue - don't stop collector on error
+			}
+		}
+	}
+}
+
+// collect samples all running app containers once and stores the samples
+func (c *MetricsCollector) collect(ctx context.Context) error {
+	filter := filters.NewArgs()
+	filter.Add("label", "app.id")
+	containers, err := c.client.ContainerList(ctx, container.ListOptions{Filters: filter})
+	if err != nil {
+		return fmt.Errorf("failed to list app containers: %w", err)
+	}
+
+	c.mu.Lock()
+	c.ticks++
+	withDisk := c.ticks%metricsDiskSampleEvery == 1
+	c.mu.Unlock()
+
+	samples := make([]*metricSample, len(containers))
+	sem := make(chan struct{}, metricsSampleConcurrency)
+	var wg sync.WaitGroup
+	for i, ctr := range containers {
+		wg.Add(1)
+		go func(i int, containerID, appID string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			sample, err := c.sampleContainer(ctx, containerID, appID, withDisk)
+			if err != nil {
+				c.logger.Debug("Failed to sample container", zap.Error(err), zap.String("container_id", containerID))
+				return
+			}
+			samples[i] = sample
+		}(i, ctr.ID, ctr.Labels["app.id"])
+	}
+	wg.Wait()
+
+	// Forget disk sizes of containers that are gone
+	live := make(map[string]bool, len(containers))
+	for _, ctr := range containers {
+		live[ctr.ID] = true
+	}
+	c.mu.Lock()
+	for id := range c.diskSize {
+		if !live[id] {
+			delete(c.diskSize, id)
+		}
+	}
+	c.mu.Unlock()
+
+	batch := &pgx.Batch{}
+	for _, s := range samples {
+		if s == nil {
+			continue
+		}
+		batch.Queue(
+			`INSERT INTO app_metric_samples
+			 (app_id, container_id, sampled_at, cpu_percent, cpu_limit, memory_usage_bytes, memory_limit_bytes,
+			  disk_usage_bytes, network_rx_bytes, network_tx_bytes, restart_count)
+			 SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+			 WHERE EXISTS (SELECT 1 FROM apps WHERE id = $1)`,
+			s.appID, s.containerID, s.sampledAt, s.cpuPercent, s.cpuLimit, s.memoryUsageBytes, s.memoryLimitBytes,
+			s.diskUsageBytes, s.networkRxBytes, s.networkTxBytes, s.restartCount,
+		)
+	}
+	if batch.Len() > 0 {
+		if err := c.pool.SendBatch(ctx, batch).Close(); err != nil {
+			return fmt.Errorf("failed to store metric samples: %w", err)
+		}
+	}
+
+	result, err := c.pool.Exec(ctx,
+		`DELETE FROM app_metric_samples WHERE sampled_at < $1`,
+		time.Now().Add(-c.retention),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to prune metric samples: %w", err)
+	}
+
+	c.logger.Debug("Collected container metrics",
+		zap.Int("containers", len(containers)),
+		zap.Int("samples", batch.Len()),
+		zap.Int64("pruned", result.RowsAffected()),
+	)
+	return nil
+}
+
+// sampleContainer reads one docker stats snapshot (with a CPU delta) and the container's restart count
+func (c *MetricsCollector) sampleContainer(ctx context.Context, containerID, appID string, withDisk bool) (*metricSample, error) {
+	statsCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	// stream=false waits for a second reading so precpu_stats is filled in
+	reader, err := c.client.ContainerStats(statsCtx, containerID, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stats: %w", err)
+	}
+	defer reader.Body.Close()
+
+	var stats container.StatsResponse
+	if err := json.NewDecoder(reader.Body).Decode(&stats); err != nil {
+		return nil, fmt.Errorf("failed to decode stats: %w", err)
+	}
+
+	inspect, _, err := c.client.ContainerInspectWithRaw(statsCtx, containerID, withDisk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	sample := &metricSample{
+		appID:            appID,
+		containerID:      containerID,
+		sampledAt:        time.Now().UTC(),
+		cpuPercent:       cpuPercent(stats),
+		memoryUsageBytes: int64(memoryUsage(stats.MemoryStats)),
+		memoryLimitBytes: int64(stats.MemoryStats.Limit),
+		restartCount:     inspect.RestartCount,
+	}
+	if inspect.HostConfig != nil {
+		sample.cpuLimit = float64(inspect.HostConfig.NanoCPUs) / 1e9
+		if inspect.HostConfig.Memory > 0 {
+			sample.memoryLimitBytes = inspect.HostConfig.Memory
+		}
+	}
+	for _, network := range stats.Networks {
+		sample.networkRxBytes += int64(network.RxBytes)
+		sample.networkTxBytes += int64(network.TxBytes)
+	}
+
+	c.mu.Lock()
+	if withDisk && inspect.SizeRw != nil {
+		c.diskSize[containerID] = *inspect.SizeRw
+	}
+	if size, ok := c.diskSize[containerID]; ok {
+		sample.diskUsageBytes = &size
+	}
+	c.mu.Unlock()
+
+	return sample, nil
+}
+
+// cpuPercent computes CPU usage the way `docker stats` does (100% = one full core)
+func cpuPercent(stats container.StatsResponse) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if onlineCPUs == 0 {
+		onlineCPUs = 1
+	}
+	return cpuDelta / systemDelta * onlineCPUs * 100
+}
+
+// memoryUsage excludes reclaimable page cache, matching `docker stats`
+// cgroup v2 reports it as inactive_file, cgroup v1 as total_inactive_file
+func memoryUsage(mem container.MemoryStats) uint64 {
+	cache := mem.Stats["inactive_file"]
+	if v, ok := mem.Stats["total_inactive_file"]; ok {
+		cache = v
+	}
+	if cache < mem.Usage {
+		return mem.Usage - cache
+	}
+	return mem.Usage
+}
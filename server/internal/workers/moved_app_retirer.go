@@ -0,0 +1,127 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"stackyn/server/internal/deploystate"
+	"stackyn/server/internal/services"
+)
+
+// MovedAppRetirer stops the containers of apps that were deployed to another host since
+// Runs in the deploy worker; a deploy only replaces the app's containers on the host it was placed on, so
+// once the app's latest running deployment is elsewhere, the host it left retires its containers here and
+// marks their deployments stopped. Until then this host's Traefik keeps routing the app locally
+type MovedAppRetirer struct {
+	pool        *pgxpool.Pool
+	deployments *services.DeploymentService
+	logger      *zap.Logger
+	node        string // Node name (deployments.node)
+	interval    time.Duration
+}
+
+// movedApp is an app with running deployments on this node whose latest running deployment is elsewhere
+type movedApp struct {
+	AppID         string
+	Host          string // Host it moved to
+	DeploymentIDs []string
+}
+
+// NewMovedAppRetirer creates a new moved app retirer
+func NewMovedAppRetirer(pool *pgxpool.Pool, deployments *services.DeploymentService, node string, logger *zap.Logger) *MovedAppRetirer {
+	return &MovedAppRetirer{
+		pool:        pool,
+		deployments: deployments,
+		logger:      logger,
+		node:        node,
+		interval:    30 * time.Second,
+	}
+}
+
+// Start starts the retirement loop
+func (w *MovedAppRetirer) Start(ctx context.Context) error {
+	w.logger.Info("Starting moved app retirer",
+		zap.String("host", w.node),
+		zap.Duration("interval", w.interval),
+	)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Moved app retirer stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			w.retireMovedApps(ctx)
+		}
+	}
+}
+
+// retireMovedApps retires the containers of every app that moved off this node; failures are logged and
+// retried next pass
+func (w *MovedAppRetirer) retireMovedApps(ctx context.Context) {
+	apps, err := w.findMovedApps(ctx)
+	if err != nil {
+		w.logger.Error("Failed to find apps moved to other hosts", zap.Error(err))
+		return
+	}
+
+	for _, app := range apps {
+		stopped, err := w.deployments.RetireAppContainers(ctx, app.AppID)
+		if err != nil {
+			w.logger.Warn("Failed to retire containers of moved app", zap.Error(err), zap.String("app_id", app.AppID))
+			continue
+		}
+
+		change := deploystate.Change{Actor: deploystate.ActorDeployWorker, Reason: "Moved to host " + app.Host}
+		for _, deploymentID := range app.DeploymentIDs {
+			_, err := deploystate.Transition(ctx, w.pool, deploymentID, deploystate.Stopped, change)
+			if err != nil && !errors.Is(err, deploystate.ErrIllegalTransition) {
+				w.logger.Warn("Failed to stop deployment of moved app", zap.Error(err), zap.String("deployment_id", deploymentID))
+			}
+		}
+
+		w.logger.Info("Retired containers of app moved to another host",
+			zap.String("app_id", app.AppID),
+			zap.String("host", app.Host),
+			zap.Int("containers", len(stopped)),
+		)
+	}
+}
+
+// findMovedApps returns the apps with running deployments on this node whose latest running deployment
+// is on another node
+func (w *MovedAppRetirer) findMovedApps(ctx context.Context) ([]movedApp, error) {
+	rows, err := w.pool.Query(ctx,
+		`SELECT d.app_id, latest.node, array_agg(d.id::text)
+		 FROM deployments d
+		 JOIN LATERAL (
+		     SELECT node FROM deployments l
+		     WHERE l.app_id = d.app_id AND l.status = 'running' AND l.node IS NOT NULL
+		     ORDER BY l.created_at DESC
+		     LIMIT 1
+		 ) latest ON TRUE
+		 WHERE d.node = $1 AND d.status = 'running' AND latest.node <> $1
+		 GROUP BY d.app_id, latest.node`,
+		w.node,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var apps []movedApp
+	for rows.Next() {
+		var app movedApp
+		if err := rows.Scan(&app.AppID, &app.Host, &app.DeploymentIDs); err != nil {
+			return nil, err
+		}
+		apps = append(apps, app)
+	}
+	return apps, rows.Err()
+}
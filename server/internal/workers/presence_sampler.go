@@ -0,0 +1,166 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// presenceWindow is the span app presence counts requests over
+const presenceWindow = 60 * time.Second
+
+// presenceSample is Traefik's cumulative request count per app at one point in time
+type presenceSample struct {
+	at       time.Time
+	requests map[string]float64
+}
+
+// PresenceSampler records whether apps are receiving traffic right now
+// Runs in the deploy worker, which can reach Traefik's API and the Docker daemon Traefik runs on. Every
+// pass scrapes Traefik's per-service request counters and, when the Traefik container is known, counts
+// the connections it holds open to app containers; the request count over the last minute is the
+// counter's growth since the sample closest to a minute ago. Snapshots are stored in app_presence
+type PresenceSampler struct {
+	pool             *pgxpool.Pool
+	deployments      *services.DeploymentService
+	logger           *zap.Logger
+	traefikContainer string // Empty skips connection counting
+	interval         time.Duration
+
+	samples []presenceSample // Oldest first, covering at most presenceWindow
+}
+
+// NewPresenceSampler creates a new presence sampler
+func NewPresenceSampler(pool *pgxpool.Pool, deployments *services.DeploymentService, traefikContainer string, logger *zap.Logger) *PresenceSampler {
+	return &PresenceSampler{
+		pool:             pool,
+		deployments:      deployments,
+		logger:           logger,
+		traefikContainer: traefikContainer,
+		interval:         10 * time.Second,
+	}
+}
+
+// Start starts the sampling loop
+// Counts are first written one interval after start, once there is a sample to measure growth from
+func (w *PresenceSampler) Start(ctx context.Context) error {
+	w.logger.Info("Starting presence sampler",
+		zap.Duration("interval", w.interval),
+		zap.Bool("connections", w.traefikContainer != ""),
+	)
+
+	w.sample(ctx)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Presence sampler stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			w.sample(ctx)
+		}
+	}
+}
+
+// sample takes one sample and stores the snapshot it yields; failures are logged and retried next pass
+func (w *PresenceSampler) sample(ctx context.Context) {
+	scrapeCtx, cancel := context.WithTimeout(ctx, w.interval)
+	defer cancel()
+
+	requests, err := w.deployments.TraefikAppRequests(scrapeCtx)
+	if err != nil {
+		w.logger.Warn("Failed to sample app requests", zap.Error(err))
+		return
+	}
+	now := time.Now()
+
+	var connections map[string]int
+	if w.traefikContainer != "" {
+		if connections, err = w.deployments.AppUpstreamConnections(scrapeCtx, w.traefikContainer); err != nil {
+			w.logger.Warn("Failed to count app connections", zap.Error(err))
+		}
+	}
+
+	// The baseline is the oldest sample still inside the window
+	for len(w.samples) > 0 && now.Sub(w.samples[0].at) > presenceWindow {
+		w.samples = w.samples[1:]
+	}
+	baseline := presenceSample{}
+	if len(w.samples) > 0 {
+		baseline = w.samples[0]
+	}
+	w.samples = append(w.samples, presenceSample{at: now, requests: requests})
+	if baseline.at.IsZero() {
+		return
+	}
+
+	if err := w.store(ctx, requests, baseline, connections, now.Sub(baseline.at)); err != nil {
+		w.logger.Error("Failed to store app presence", zap.Error(err))
+	}
+}
+
+// store upserts the snapshot of every app Traefik knows about or holds connections to, and a zero
+// snapshot for the other running apps and earlier snapshots - Traefik has not routed to them since it started
+func (w *PresenceSampler) store(ctx context.Context, requests map[string]float64, baseline presenceSample, connections map[string]int, window time.Duration) error {
+	apps := make(map[string]bool, len(requests)+len(connections))
+	for appID := range requests {
+		apps[appID] = true
+	}
+	for appID := range connections {
+		apps[appID] = true
+	}
+
+	appIDs := make([]string, 0, len(apps))
+	recent := make([]int64, 0, len(apps))
+	open := make([]int32, 0, len(apps))
+	for appID := range apps {
+		// Apps missing from the baseline started receiving requests within the window, and a counter
+		// that went down means Traefik restarted - either way every request counted is recent
+		delta := requests[appID] - baseline.requests[appID]
+		if delta < 0 {
+			delta = requests[appID]
+		}
+		appIDs = append(appIDs, appID)
+		recent = append(recent, int64(math.Round(delta)))
+		open = append(open, int32(connections[appID]))
+	}
+
+	if _, err := w.pool.Exec(ctx,
+		`WITH sampled AS (
+		     INSERT INTO app_presence (app_id, requests_last_minute, open_connections, window_seconds, sampled_at)
+		     SELECT a.id, r.requests, CASE WHEN $4 THEN r.connections END, $5, NOW()
+		     FROM unnest($1::text[], $2::bigint[], $3::int[]) AS r(app_id, requests, connections)
+		     JOIN apps a ON a.id = r.app_id::uuid
+		     ON CONFLICT (app_id) DO UPDATE SET
+		         requests_last_minute = EXCLUDED.requests_last_minute,
+		         open_connections = EXCLUDED.open_connections,
+		         window_seconds = EXCLUDED.window_seconds,
+		         sampled_at = EXCLUDED.sampled_at
+		     RETURNING app_id
+		 )
+		 INSERT INTO app_presence (app_id, requests_last_minute, open_connections, window_seconds, sampled_at)
+		 SELECT a.id, 0, CASE WHEN $4 THEN 0 END, $5, NOW()
+		 FROM apps a
+		 WHERE a.id NOT IN (SELECT app_id FROM sampled)
+		   AND (a.status = 'running' OR EXISTS (SELECT 1 FROM app_presence p WHERE p.app_id = a.id))
+		 ON CONFLICT (app_id) DO UPDATE SET
+		     requests_last_minute = 0,
+		     open_connections = EXCLUDED.open_connections,
+		     window_seconds = EXCLUDED.window_seconds,
+		     sampled_at = EXCLUDED.sampled_at`,
+		appIDs, recent, open, connections != nil, int(window.Round(time.Second)/time.Second),
+	); err != nil {
+		return fmt.Errorf("failed to upsert app presence: %w", err)
+	}
+
+	w.logger.Debug("Sampled app presence", zap.Int("apps", len(appIDs)), zap.Duration("window", window))
+	return nil
+}
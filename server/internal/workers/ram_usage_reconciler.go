@@ -0,0 +1,154 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// unlimitedContainerRAMMB is what a container without a memory limit counts against the plan
+// (the deploy default, since compose services may not set one)
+const unlimitedContainerRAMMB = 512
+
+// composeProjectPrefix names the compose project of an app's docker-compose deployment
+const composeProjectPrefix = "stackyn-"
+
+// RAMUsageReconciler corrects the plan RAM counters against the containers that are actually running
+// Runs in the deploy worker, which owns the Docker connection; the counters it corrects are shared with
+// the API through Redis. Containers that crashed, were stopped or were removed outside the deploy task
+// stop counting on the next pass, and expired counters are rebuilt from the running containers
+type RAMUsageReconciler struct {
+	pool            *pgxpool.Pool
+	client          *client.Client
+	planEnforcement *services.PlanEnforcementService
+	logger          *zap.Logger
+	interval        time.Duration
+}
+
+// NewRAMUsageReconciler creates a new RAM usage reconciler
+func NewRAMUsageReconciler(pool *pgxpool.Pool, dockerClient *client.Client, planEnforcement *services.PlanEnforcementService, logger *zap.Logger) *RAMUsageReconciler {
+	return &RAMUsageReconciler{
+		pool:            pool,
+		client:          dockerClient,
+		planEnforcement: planEnforcement,
+		logger:          logger,
+		interval:        5 * time.Minute, // Run every 5 minutes
+	}
+}
+
+// Start starts the reconciliation loop
+// The first pass runs immediately so a freshly started worker does not begin with empty counters
+func (w *RAMUsageReconciler) Start(ctx context.Context) error {
+	w.logger.Info("Starting RAM usage reconciler", zap.Duration("interval", w.interval))
+
+	if err := w.reconcile(ctx); err != nil {
+		w.logger.Error("Failed to reconcile RAM usage", zap.Error(err))
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("RAM usage reconciler stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			if err := w.reconcile(ctx); err != nil {
+				w.logger.Error("Failed to reconcile RAM usage", zap.Error(err))
+				// Continue - don't stop reconciler on error
+			}
+		}
+	}
+}
+
+// reconcile sums the memory limits of running app containers and replaces the tracked usage with them
+func (w *RAMUsageReconciler) reconcile(ctx context.Context) error {
+	containers, err := w.client.ContainerList(ctx, container.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	ramByApp := make(map[string]int)
+	for _, ctr := range containers {
+		appID := ctr.Labels["app.id"]
+		if appID == "" {
+			appID = strings.TrimPrefix(ctr.Labels["com.docker.compose.project"], composeProjectPrefix)
+			if appID == ctr.Labels["com.docker.compose.project"] {
+				continue // Not an app container
+			}
+		}
+
+		ramMB := unlimitedContainerRAMMB
+		inspect, err := w.client.ContainerInspect(ctx, ctr.ID)
+		if err != nil {
+			// Gone between list and inspect - it no longer uses anything
+			w.logger.Debug("Failed to inspect container for RAM usage", zap.Error(err), zap.String("container_id", ctr.ID))
+			continue
+		}
+		if inspect.HostConfig != nil && inspect.HostConfig.Memory > 0 {
+			ramMB = int(inspect.HostConfig.Memory / (1024 * 1024))
+		}
+		ramByApp[appID] += ramMB
+	}
+
+	owners, err := w.appOwners(ctx, ramByApp)
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]services.AppRAMUsage, len(ramByApp))
+	for appID, ramMB := range ramByApp {
+		userID, ok := owners[appID]
+		if !ok {
+			continue // Container of a deleted app - cleanup removes it
+		}
+		running[appID] = services.AppRAMUsage{UserID: userID, RAMMB: ramMB}
+	}
+
+	if corrected := w.planEnforcement.ReconcileRAMUsage(ctx, running); corrected > 0 {
+		w.logger.Info("Reconciled RAM usage with running containers",
+			zap.Int("running_apps", len(running)),
+			zap.Int("corrected_apps", corrected),
+		)
+	}
+	return nil
+}
+
+// appOwners maps each app ID to the user whose plan its RAM counts against
+func (w *RAMUsageReconciler) appOwners(ctx context.Context, ramByApp map[string]int) (map[string]string, error) {
+	owners := make(map[string]string, len(ramByApp))
+	if len(ramByApp) == 0 {
+		return owners, nil
+	}
+
+	appIDs := make([]string, 0, len(ramByApp))
+	for appID := range ramByApp {
+		appIDs = append(appIDs, appID)
+	}
+
+	rows, err := w.pool.Query(ctx, `SELECT id::text, user_id::text FROM apps WHERE id::text = ANY($1)`, appIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app owners: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var appID, userID string
+		if err := rows.Scan(&appID, &userID); err != nil {
+			return nil, fmt.Errorf("failed to scan app owner: %w", err)
+		}
+		owners[appID] = userID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get app owners: %w", err)
+	}
+	return owners, nil
+}
@@ -0,0 +1,301 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"stackyn/server/internal/deploystate"
+	stackynerrors "stackyn/server/internal/errors"
+	"stackyn/server/internal/services"
+	"stackyn/server/internal/tasks"
+)
+
+// staleDeployRAMMB is the RAM a deploy task reserves against the plan (its RequestedRAMMB)
+const staleDeployRAMMB = 512
+
+// BuildEnqueuer enqueues build tasks
+type BuildEnqueuer interface {
+	EnqueueBuildTask(ctx context.Context, payload interface{}, userID string) (*asynq.TaskInfo, error)
+}
+
+// AppListCache drops users' cached app lists after workers change their apps' status (api.AppRepo)
+type AppListCache interface {
+	InvalidateAppLists(ctx context.Context, userIDs ...string)
+}
+
+// StaleDeploymentWatchdog recovers apps left building or deploying by a worker that died mid-task
+// Runs periodically and, for each app stuck longer than the threshold:
+// 1. Marks the app, its running build job and a deployment record as failed
+// 2. Releases the plan counters (concurrent builds / RAM) the task was holding
+// 3. Optionally re-enqueues the build - once, so a task that kills its worker cannot loop forever
+type StaleDeploymentWatchdog struct {
+	pool            *pgxpool.Pool
+	planEnforcement *services.PlanEnforcementService
+	taskEnqueue     BuildEnqueuer      // Optional - nil disables re-enqueueing
+	notifier        *services.Notifier // Optional - tells owners when a stuck deployment is failed
+	appLists        AppListCache       // Optional - drops the owners' cached app lists
+	logger          *zap.Logger
+	interval        time.Duration
+	threshold       time.Duration
+	requeue         bool
+}
+
+// staleApp is an app claimed by the watchdog
+type staleApp struct {
+	ID          string
+	Name        string
+	UserID      string
+	RepoURL     string
+	Branch      string
+	RootDir     string
+	StuckStatus string
+	StuckSince  time.Time
+}
+
+// NewStaleDeploymentWatchdog creates a new stale deployment watchdog
+func NewStaleDeploymentWatchdog(pool *pgxpool.Pool, planEnforcement *services.PlanEnforcementService, taskEnqueue BuildEnqueuer, threshold time.Duration, requeue bool, logger *zap.Logger) *StaleDeploymentWatchdog {
+	return &StaleDeploymentWatchdog{
+		pool:            pool,
+		planEnforcement: planEnforcement,
+		taskEnqueue:     taskEnqueue,
+		logger:          logger,
+		interval:        time.Minute, // Run every minute
+		threshold:       threshold,
+		requeue:         requeue,
+	}
+}
+
+// SetNotifier enables failure notifications for recovered apps that are not retried
+func (w *StaleDeploymentWatchdog) SetNotifier(notifier *services.Notifier) {
+	w.notifier = notifier
+}
+
+// SetAppListCache makes the watchdog's status changes show up in owners' cached app lists right away
+func (w *StaleDeploymentWatchdog) SetAppListCache(appLists AppListCache) {
+	w.appLists = appLists
+}
+
+func (w *StaleDeploymentWatchdog) invalidateAppLists(ctx context.Context, userIDs ...string) {
+	if w.appLists != nil && len(userIDs) > 0 {
+		w.appLists.InvalidateAppLists(ctx, userIDs...)
+	}
+}
+
+// Start starts the watchdog loop
+func (w *StaleDeploymentWatchdog) Start(ctx context.Context) error {
+	w.logger.Info("Starting stale deployment watchdog",
+		zap.Duration("interval", w.interval),
+		zap.Duration("threshold", w.threshold),
+		zap.Bool("requeue", w.requeue),
+	)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Stale deployment watchdog stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			if err := w.recoverStale(ctx); err != nil {
+				w.logger.Error("Failed to recover stale deployments", zap.Error(err))
+				// Continue - don't stop watchdog on error
+			}
+		}
+	}
+}
+
+// recoverStale claims every stuck app and recovers it
+// The claim flips the app to failed in one statement, so concurrent API instances never recover
+// the same app twice
+func (w *StaleDeploymentWatchdog) recoverStale(ctx context.Context) error {
+	reason := stackynerrors.GetMessage(stackynerrors.ErrorCodeDeployStalled)
+	rows, err := w.pool.Query(ctx,
+		`WITH stuck AS (
+			SELECT id, status, updated_at FROM apps
+			WHERE status IN ('building', 'deploying') AND updated_at < $1
+			FOR UPDATE SKIP LOCKED
+		 )
+		 UPDATE apps a SET status = 'failed', status_reason = $2, updated_at = NOW()
+		 FROM stuck
+		 WHERE a.id = stuck.id
+		 RETURNING a.id, a.name, a.user_id, a.repo_url, a.branch, a.root_dir, stuck.status, stuck.updated_at`,
+		time.Now().Add(-w.threshold), reason,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to claim stale apps: %w", err)
+	}
+
+	var apps []staleApp
+	var owners []string
+	for rows.Next() {
+		var app staleApp
+		if err := rows.Scan(&app.ID, &app.Name, &app.UserID, &app.RepoURL, &app.Branch, &app.RootDir, &app.StuckStatus, &app.StuckSince); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan stale app: %w", err)
+		}
+		apps = append(apps, app)
+		owners = append(owners, app.UserID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to claim stale apps: %w", err)
+	}
+	w.invalidateAppLists(ctx, owners...)
+
+	for _, app := range apps {
+		if err := w.recoverApp(ctx, app); err != nil {
+			// The app is already marked failed; the user can redeploy manually
+			w.logger.Error("Failed to finish recovering stale app",
+				zap.Error(err),
+				zap.String("app_id", app.ID),
+			)
+		}
+	}
+
+	if len(apps) > 0 {
+		w.logger.Warn("Recovered stale deployments", zap.Int("apps", len(apps)))
+	}
+	return nil
+}
+
+// recoverApp fails the stuck work of a claimed app, releases its plan counters and optionally retries it
+func (w *StaleDeploymentWatchdog) recoverApp(ctx context.Context, app staleApp) error {
+	stage := "Build"
+	if app.StuckStatus == "deploying" {
+		stage = "Deployment"
+	}
+	errorMsg := fmt.Sprintf("[%s] %s (stuck %s for over %s)",
+		stackynerrors.ErrorCodeDeployStalled,
+		stackynerrors.GetMessage(stackynerrors.ErrorCodeDeployStalled),
+		app.StuckStatus,
+		w.threshold,
+	)
+
+	// The latest build job is the one that was running (or whose deploy was running)
+	var buildJobID *string
+	err := w.pool.QueryRow(ctx,
+		`SELECT id FROM build_jobs WHERE app_id = $1 ORDER BY created_at DESC LIMIT 1`,
+		app.ID,
+	).Scan(&buildJobID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to get latest build job: %w", err)
+	}
+
+	if buildJobID != nil {
+		if _, err := w.pool.Exec(ctx,
+			`UPDATE build_jobs SET status = 'failed', error_message = $1, updated_at = NOW()
+			 WHERE id = $2 AND status = 'building'`,
+			errorMsg, *buildJobID,
+		); err != nil {
+			return fmt.Errorf("failed to fail build job: %w", err)
+		}
+	}
+
+	// Deployment history shows the stalled attempt like any other failure
+	if _, err := deploystate.Insert(ctx, w.pool, deploystate.NewDeployment{
+		AppID:      app.ID,
+		BuildJobID: buildJobID,
+		Status:     deploystate.Failed,
+	}, deploystate.Change{Actor: deploystate.ActorWatchdog, Reason: errorMsg}); err != nil {
+		return fmt.Errorf("failed to record failed deployment: %w", err)
+	}
+
+	// Release what the dead task was holding against the plan
+	if w.planEnforcement != nil {
+		if app.StuckStatus == "building" {
+			w.planEnforcement.DecrementBuildCount(ctx, app.UserID)
+		} else {
+			w.planEnforcement.DecrementRAMUsage(ctx, app.UserID, staleDeployRAMMB)
+		}
+	}
+
+	requeuedBuildJobID, err := w.requeueBuild(ctx, app, buildJobID)
+	if err != nil {
+		w.logger.Error("Failed to re-enqueue stale app", zap.Error(err), zap.String("app_id", app.ID))
+	}
+
+	if _, err := w.pool.Exec(ctx,
+		`INSERT INTO stale_deployment_recoveries (app_id, build_job_id, stuck_status, stuck_since, requeued_build_job_id)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		app.ID, buildJobID, app.StuckStatus, app.StuckSince, requeuedBuildJobID,
+	); err != nil {
+		return fmt.Errorf("failed to record stale deployment recovery: %w", err)
+	}
+
+	w.logger.Warn("Recovered stale app",
+		zap.String("app_id", app.ID),
+		zap.String("user_id", app.UserID),
+		zap.String("stuck_status", app.StuckStatus),
+		zap.Time("stuck_since", app.StuckSince),
+		zap.Bool("requeued", requeuedBuildJobID != nil),
+	)
+
+	// Only alert when the user has to act - a retried app alerts on its own if it fails again
+	if requeuedBuildJobID == nil && w.notifier != nil {
+		if err := w.notifier.NotifyDeployFailed(ctx, app.UserID, app.Name, stage, errorMsg); err != nil {
+			w.logger.Warn("Failed to notify user about stale deployment", zap.Error(err), zap.String("app_id", app.ID))
+		}
+	}
+	return nil
+}
+
+// requeueBuild enqueues a fresh build for a recovered app unless requeueing is off or the stuck
+// build was itself a retry. Returns the new build job ID, or nil when nothing was enqueued
+func (w *StaleDeploymentWatchdog) requeueBuild(ctx context.Context, app staleApp, stuckBuildJobID *string) (*string, error) {
+	if !w.requeue || w.taskEnqueue == nil {
+		return nil, nil
+	}
+
+	// Image apps have no repository to build; their owner redeploys them
+	if app.RepoURL == "" {
+		return nil, nil
+	}
+
+	if stuckBuildJobID != nil {
+		var alreadyRetried bool
+		if err := w.pool.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM stale_deployment_recoveries WHERE requeued_build_job_id = $1)`,
+			*stuckBuildJobID,
+		).Scan(&alreadyRetried); err != nil {
+			return nil, fmt.Errorf("failed to check previous recoveries: %w", err)
+		}
+		if alreadyRetried {
+			w.logger.Info("Not re-enqueueing stale app - its build was already a retry", zap.String("app_id", app.ID))
+			return nil, nil
+		}
+	}
+
+	buildJobID := uuid.New().String()
+	payload := tasks.BuildTaskPayload{
+		AppID:      app.ID,
+		BuildJobID: buildJobID,
+		RepoURL:    app.RepoURL,
+		Branch:     app.Branch,
+		RootDir:    app.RootDir,
+		UserID:     app.UserID,
+		Trigger:    deploystate.TriggerSystem,
+	}
+	if _, err := w.taskEnqueue.EnqueueBuildTask(ctx, payload, app.UserID); err != nil {
+		return nil, fmt.Errorf("failed to enqueue build task: %w", err)
+	}
+
+	// Back to pending until the build worker picks the retry up
+	if _, err := w.pool.Exec(ctx,
+		`UPDATE apps SET status = 'pending', status_reason = $1, updated_at = NOW() WHERE id = $2 AND status = 'failed'`,
+		"Retrying after the previous build or deployment stopped responding", app.ID,
+	); err != nil {
+		w.logger.Warn("Failed to mark re-enqueued app as pending", zap.Error(err), zap.String("app_id", app.ID))
+	}
+	w.invalidateAppLists(ctx, app.UserID)
+
+	return &buildJobID, nil
+}
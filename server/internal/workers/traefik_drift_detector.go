@@ -0,0 +1,296 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"stackyn/server/internal/deploystate"
+	"stackyn/server/internal/metrics"
+	"stackyn/server/internal/services"
+	"stackyn/server/internal/tasks"
+)
+
+// traefikRepairCooldown is how long after a repair the same app is left alone, so a redeploy
+// has time to land and drift that keeps coming back does not redeploy the app every pass
+const traefikRepairCooldown = time.Hour
+
+// DeployEnqueuer enqueues deploy tasks
+type DeployEnqueuer interface {
+	EnqueueDeployTask(ctx context.Context, payload interface{}, userID string) (*asynq.TaskInfo, error)
+}
+
+// TraefikDriftDetector checks that every running deployment is routed the way Postgres says it should be
+// Routing is configured only through container labels, which are easy to break by hand (a container
+// recreated outside Stackyn, a label edited in a compose override, Traefik restarted with a different
+// provider config). Each pass compares the container's labels - and, when the Traefik API is configured,
+// the routers Traefik actually loaded - with the deployment's subdomain and the app's verified domains.
+// Drift is repaired by redeploying the current image (labels cannot be changed on a running container)
+// and every repair is logged, counted in stackyn_traefik_drift_repairs_total and recorded in traefik_drift_repairs
+type TraefikDriftDetector struct {
+	pool              *pgxpool.Pool
+	client            *client.Client
+	deploymentService *services.DeploymentService
+	taskEnqueue       DeployEnqueuer
+	logger            *zap.Logger
+	interval          time.Duration
+}
+
+// routedDeployment is a running deployment with the routing state on record for it
+type routedDeployment struct {
+	ID            string
+	AppID         string
+	UserID        string
+	ContainerID   string
+	ImageName     string
+	Subdomain     string
+	CustomDomains []string
+	WAF           *services.WAFConfig     // nil when the app has no WAF
+	Routing       *services.RoutingConfig // nil when the app has no routing settings
+}
+
+// NewTraefikDriftDetector creates a new Traefik drift detector
+func NewTraefikDriftDetector(pool *pgxpool.Pool, dockerClient *client.Client, deploymentService *services.DeploymentService, taskEnqueue DeployEnqueuer, logger *zap.Logger) *TraefikDriftDetector {
+	return &TraefikDriftDetector{
+		pool:              pool,
+		client:            dockerClient,
+		deploymentService: deploymentService,
+		taskEnqueue:       taskEnqueue,
+		logger:            logger,
+		interval:          5 * time.Minute, // Run every 5 minutes
+	}
+}
+
+// Start starts the detection loop
+func (d *TraefikDriftDetector) Start(ctx context.Context) error {
+	d.logger.Info("Starting Traefik drift detector", zap.Duration("interval", d.interval))
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.logger.Info("Traefik drift detector stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			if err := d.check(ctx); err != nil {
+				d.logger.Error("Failed to check Traefik drift", zap.Error(err))
+				// Continue - don't stop detector on error
+			}
+		}
+	}
+}
+
+// check compares every running deployment with its routing and repairs the ones that drifted
+func (d *TraefikDriftDetector) check(ctx context.Context) error {
+	deployments, err := d.runningDeployments(ctx)
+	if err != nil {
+		return err
+	}
+
+	repaired := 0
+	for _, dep := range deployments {
+		drift, ramMB, err := d.detect(ctx, dep)
+		if err != nil {
+			d.logger.Warn("Failed to check deployment routing",
+				zap.Error(err),
+				zap.String("app_id", dep.AppID),
+				zap.String("deployment_id", dep.ID),
+			)
+			continue
+		}
+		if len(drift) == 0 {
+			continue
+		}
+
+		if d.repair(ctx, dep, drift, ramMB) {
+			repaired++
+		}
+	}
+
+	if repaired > 0 {
+		d.logger.Info("Repaired Traefik drift",
+			zap.Int("checked", len(deployments)),
+			zap.Int("repaired", repaired),
+		)
+	}
+	return nil
+}
+
+// detect returns the routing differences of one deployment and the memory limit its container runs with
+// A container that is gone or stopped is not drift - crash handling and cleanup deal with it
+func (d *TraefikDriftDetector) detect(ctx context.Context, dep *routedDeployment) ([]string, int, error) {
+	inspect, err := d.client.ContainerInspect(ctx, dep.ContainerID)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, 0, nil
+		}
+		return nil, 0, fmt.Errorf("failed to inspect container: %w", err)
+	}
+	if inspect.State == nil || !inspect.State.Running || inspect.Config == nil {
+		return nil, 0, nil
+	}
+	if _, ok := inspect.Config.Labels["com.docker.compose.project"]; ok {
+		return nil, 0, nil // Compose services carry their own labels
+	}
+
+	ramMB := unlimitedContainerRAMMB
+	if inspect.HostConfig != nil && inspect.HostConfig.Memory > 0 {
+		ramMB = int(inspect.HostConfig.Memory / (1024 * 1024))
+	}
+
+	drift := d.deploymentService.TraefikLabelDrift(inspect.Config.Labels, dep.Subdomain, dep.AppID, dep.CustomDomains, dep.WAF, dep.Routing)
+	if len(drift) > 0 {
+		return drift, ramMB, nil
+	}
+
+	// Labels are right - make sure Traefik picked them up
+	routerDrift, err := d.deploymentService.TraefikRouterDrift(ctx, dep.Subdomain, dep.AppID, dep.CustomDomains, dep.WAF, dep.Routing)
+	if err != nil {
+		return nil, 0, err
+	}
+	return routerDrift, ramMB, nil
+}
+
+// repair redeploys the current image so the container is recreated with the labels on record
+// Returns false when the app was repaired recently or the redeploy could not be enqueued
+func (d *TraefikDriftDetector) repair(ctx context.Context, dep *routedDeployment, drift []string, ramMB int) bool {
+	var recent bool
+	if err := d.pool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM traefik_drift_repairs WHERE app_id = $1 AND created_at > $2)`,
+		dep.AppID, time.Now().Add(-traefikRepairCooldown),
+	).Scan(&recent); err != nil {
+		d.logger.Warn("Failed to check recent Traefik drift repairs", zap.Error(err), zap.String("app_id", dep.AppID))
+		return false
+	}
+	if recent {
+		d.logger.Warn("Traefik drift persists after a recent repair - leaving it for an operator",
+			zap.String("app_id", dep.AppID),
+			zap.String("deployment_id", dep.ID),
+			zap.Strings("drift", drift),
+		)
+		metrics.TraefikDriftRepairsTotal.Inc("skipped")
+		return false
+	}
+
+	// Image is stored as "imageName:tag" where tag is the build job ID
+	imageName, imageTag := dep.ImageName, ""
+	if idx := strings.LastIndex(dep.ImageName, ":"); idx > 0 {
+		imageName = dep.ImageName[:idx]
+		imageTag = dep.ImageName[idx+1:]
+	}
+
+	payload := tasks.DeployTaskPayload{
+		AppID:               dep.AppID,
+		DeploymentID:        uuid.New().String(),
+		BuildJobID:          imageTag,
+		ImageName:           imageName,
+		Subdomain:           dep.Subdomain,
+		UserID:              dep.UserID,
+		RequestedRAMMB:      ramMB,
+		EnvFromDeploymentID: dep.ID, // Only the routing is repaired - keep the env the container runs with
+		Trigger:             deploystate.TriggerSystem,
+	}
+	var repairDeploymentID *string
+	result := "repaired"
+	if _, err := d.taskEnqueue.EnqueueDeployTask(ctx, payload, dep.UserID); err != nil {
+		d.logger.Error("Failed to enqueue redeploy to repair Traefik drift",
+			zap.Error(err),
+			zap.String("app_id", dep.AppID),
+			zap.String("deployment_id", dep.ID),
+		)
+		result = "failed"
+	} else {
+		repairDeploymentID = &payload.DeploymentID
+	}
+
+	// Recorded even when enqueueing failed, so a broken queue does not retry every pass
+	if _, err := d.pool.Exec(ctx,
+		`INSERT INTO traefik_drift_repairs (app_id, deployment_id, container_id, drift, repair_deployment_id)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		dep.AppID, dep.ID, dep.ContainerID, drift, repairDeploymentID,
+	); err != nil {
+		d.logger.Warn("Failed to record Traefik drift repair", zap.Error(err), zap.String("app_id", dep.AppID))
+	}
+
+	metrics.TraefikDriftRepairsTotal.Inc(result)
+	if result == "failed" {
+		return false
+	}
+
+	d.logger.Warn("Traefik configuration drifted from the database - redeploying to repair",
+		zap.String("app_id", dep.AppID),
+		zap.String("deployment_id", dep.ID),
+		zap.String("container_id", dep.ContainerID),
+		zap.Strings("drift", drift),
+		zap.String("repair_deployment_id", payload.DeploymentID),
+	)
+	return true
+}
+
+// runningDeployments returns the latest running deployment of every enabled app, with its verified domains, WAF
+// and routing settings
+// Apps with a build or deploy in progress are skipped - their routing is about to change anyway
+// Sleeping apps are skipped too - their stopped containers have no route on purpose
+func (d *TraefikDriftDetector) runningDeployments(ctx context.Context) ([]*routedDeployment, error) {
+	rows, err := d.pool.Query(ctx,
+		`SELECT DISTINCT ON (d.app_id) d.id, d.app_id, a.user_id, d.container_id, d.image_name, d.subdomain,
+		        COALESCE((SELECT array_agg(ad.domain ORDER BY ad.created_at)
+		                  FROM app_domains ad
+		                  WHERE ad.app_id = d.app_id AND ad.status = 'verified'), '{}'),
+		        w.preset, w.mode,
+		        rs.app_id IS NOT NULL, COALESCE(rs.force_https, TRUE), COALESCE(rs.compression, FALSE),
+		        COALESCE(rs.max_request_body_bytes, 0), COALESCE(rs.headers, '{}'::jsonb), COALESCE(rs.basic_auth_user, ''),
+		        COALESCE(rs.ip_allowlist, '{}')
+		 FROM deployments d
+		 JOIN apps a ON a.id = d.app_id
+		 LEFT JOIN app_waf_settings w ON w.app_id = d.app_id
+		 LEFT JOIN app_routing_settings rs ON rs.app_id = d.app_id
+		 WHERE d.status = 'running'
+		   AND d.container_id IS NOT NULL AND d.container_id <> ''
+		   AND d.image_name IS NOT NULL AND d.image_name <> ''
+		   AND d.subdomain IS NOT NULL AND d.subdomain <> ''
+		   AND a.status NOT IN ('disabled', 'building', 'deploying', 'sleeping', 'waking', 'stopping', 'stopped', 'starting')
+		   AND NOT EXISTS (
+		       SELECT 1 FROM deployments p
+		       WHERE p.app_id = d.app_id AND p.status IN ('pending', 'building', 'deploying')
+		   )
+		 ORDER BY d.app_id, d.created_at DESC`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get running deployments: %w", err)
+	}
+	defer rows.Close()
+
+	var deployments []*routedDeployment
+	for rows.Next() {
+		var dep routedDeployment
+		var wafPreset, wafMode *string
+		var hasRouting bool
+		var routing services.RoutingConfig
+		if err := rows.Scan(&dep.ID, &dep.AppID, &dep.UserID, &dep.ContainerID, &dep.ImageName, &dep.Subdomain, &dep.CustomDomains,
+			&wafPreset, &wafMode,
+			&hasRouting, &routing.ForceHTTPS, &routing.Compression, &routing.MaxRequestBodyBytes, &routing.Headers, &routing.BasicAuthUser,
+			&routing.IPAllowlist); err != nil {
+			return nil, fmt.Errorf("failed to scan running deployment: %w", err)
+		}
+		if wafPreset != nil && wafMode != nil {
+			dep.WAF = &services.WAFConfig{Preset: *wafPreset, Mode: *wafMode}
+		}
+		if hasRouting {
+			dep.Routing = &routing
+		}
+		deployments = append(deployments, &dep)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get running deployments: %w", err)
+	}
+	return deployments, nil
+}
@@ -0,0 +1,156 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// trafficBucket is one app's traffic in one TrafficBucketSize span, as read from the access log
+type trafficBucket struct {
+	requests    int64
+	status      [4]int64 // 2xx, 3xx, 4xx, 5xx
+	egressBytes int64
+	latency     []int64 // services.NewLatencyHistogram
+}
+
+// trafficKey identifies a traffic bucket
+type trafficKey struct {
+	appID string
+	start time.Time
+}
+
+// TrafficCollector records per-app request counts, status codes, latency and egress from Traefik's access log
+// Runs in the deploy worker, which can read Traefik's access log. Every pass the lines written since the last
+// one are added into per-minute buckets in app_traffic, served by GET /api/v1/apps/{id}/traffic and kept
+// for bandwidth accounting until the retention period ends
+type TrafficCollector struct {
+	pool          *pgxpool.Pool
+	logger        *zap.Logger
+	accessLog     *accessLogTail
+	retention     time.Duration
+	interval      time.Duration
+	purgeInterval time.Duration
+}
+
+// NewTrafficCollector creates a new traffic collector reading Traefik's JSON access log at accessLogPath
+func NewTrafficCollector(pool *pgxpool.Pool, accessLogPath string, retention time.Duration, logger *zap.Logger) *TrafficCollector {
+	return &TrafficCollector{
+		pool:          pool,
+		logger:        logger,
+		accessLog:     &accessLogTail{path: accessLogPath},
+		retention:     retention,
+		interval:      30 * time.Second,
+		purgeInterval: 1 * time.Hour,
+	}
+}
+
+// Start starts the collection loop
+// Reading starts at the end of the access log - requests made while the worker was down are not counted
+func (w *TrafficCollector) Start(ctx context.Context) error {
+	w.logger.Info("Starting traffic collector",
+		zap.Duration("interval", w.interval),
+		zap.Duration("retention", w.retention),
+		zap.String("access_log", w.accessLog.path),
+	)
+
+	if err := w.collect(ctx); err != nil {
+		w.logger.Error("Failed to collect app traffic", zap.Error(err))
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	purgeTicker := time.NewTicker(w.purgeInterval)
+	defer purgeTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Traffic collector stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			if err := w.collect(ctx); err != nil {
+				w.logger.Error("Failed to collect app traffic", zap.Error(err))
+			}
+		case <-purgeTicker.C:
+			w.purge(ctx)
+		}
+	}
+}
+
+// collect reads the access log lines written since the last pass and adds them to the apps' traffic buckets
+func (w *TrafficCollector) collect(ctx context.Context) error {
+	buckets := make(map[trafficKey]*trafficBucket)
+	err := w.accessLog.read(func(entry *traefikAccessLogEntry) {
+		appID, ok := services.AppIDFromTraefikService(entry.ServiceName)
+		if !ok {
+			return
+		}
+		at := entry.StartUTC.UTC()
+		if entry.StartUTC.IsZero() {
+			at = time.Now().UTC()
+		}
+
+		key := trafficKey{appID: appID, start: at.Truncate(services.TrafficBucketSize)}
+		bucket := buckets[key]
+		if bucket == nil {
+			bucket = &trafficBucket{latency: services.NewLatencyHistogram()}
+			buckets[key] = bucket
+		}
+		bucket.requests++
+		if class := entry.DownstreamStatus/100 - 2; class >= 0 && class < len(bucket.status) {
+			bucket.status[class]++
+		}
+		bucket.egressBytes += entry.DownstreamContentSize
+		services.ObserveLatency(bucket.latency, time.Duration(entry.Duration))
+	})
+	if err != nil {
+		return err
+	}
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	for key, bucket := range buckets {
+		// Buckets of apps deleted since the request are skipped by the join
+		if _, err := w.pool.Exec(ctx,
+			`INSERT INTO app_traffic (app_id, bucket_start, requests, status_2xx, status_3xx, status_4xx, status_5xx,
+			                          egress_bytes, latency_histogram)
+			 SELECT id, $2, $3, $4, $5, $6, $7, $8, $9 FROM apps WHERE id = $1
+			 ON CONFLICT (app_id, bucket_start) DO UPDATE SET
+			   requests = app_traffic.requests + EXCLUDED.requests,
+			   status_2xx = app_traffic.status_2xx + EXCLUDED.status_2xx,
+			   status_3xx = app_traffic.status_3xx + EXCLUDED.status_3xx,
+			   status_4xx = app_traffic.status_4xx + EXCLUDED.status_4xx,
+			   status_5xx = app_traffic.status_5xx + EXCLUDED.status_5xx,
+			   egress_bytes = app_traffic.egress_bytes + EXCLUDED.egress_bytes,
+			   latency_histogram = (
+			       SELECT array_agg(COALESCE(a, 0) + COALESCE(b, 0) ORDER BY i)
+			       FROM unnest(app_traffic.latency_histogram, EXCLUDED.latency_histogram) WITH ORDINALITY AS h(a, b, i)
+			   )`,
+			key.appID, key.start, bucket.requests, bucket.status[0], bucket.status[1], bucket.status[2], bucket.status[3],
+			bucket.egressBytes, bucket.latency,
+		); err != nil {
+			return fmt.Errorf("failed to record traffic of app %s: %w", key.appID, err)
+		}
+	}
+
+	w.logger.Debug("Recorded app traffic", zap.Int("buckets", len(buckets)))
+	return nil
+}
+
+// purge deletes traffic buckets older than the retention period
+func (w *TrafficCollector) purge(ctx context.Context) {
+	tag, err := w.pool.Exec(ctx, `DELETE FROM app_traffic WHERE bucket_start < $1`, time.Now().UTC().Add(-w.retention))
+	if err != nil {
+		w.logger.Error("Failed to purge app traffic", zap.Error(err))
+		return
+	}
+	if tag.RowsAffected() > 0 {
+		w.logger.Info("Purged old app traffic", zap.Int64("buckets", tag.RowsAffected()))
+	}
+}
@@ -0,0 +1,103 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"stackyn/server/internal/services"
+)
+
+// wafHitRetention is how long WAF hits are kept for the hits log
+const wafHitRetention = 7 * 24 * time.Hour
+
+// WAFHitCollector records the rule matches app WAF middlewares log through Traefik
+// Runs in the deploy worker, which can reach the Docker daemon Traefik runs on. The Traefik container's
+// logs are followed and each Coraza match is stored against the app whose middleware logged it
+type WAFHitCollector struct {
+	pool             *pgxpool.Pool
+	deployments      *services.DeploymentService
+	logger           *zap.Logger
+	traefikContainer string
+	retryDelay       time.Duration
+	purgeInterval    time.Duration
+
+	lastSeen time.Time // Time of the last log line handled, so reconnecting does not record hits twice
+}
+
+// NewWAFHitCollector creates a new WAF hit collector following the logs of traefikContainer
+func NewWAFHitCollector(pool *pgxpool.Pool, deployments *services.DeploymentService, traefikContainer string, logger *zap.Logger) *WAFHitCollector {
+	return &WAFHitCollector{
+		pool:             pool,
+		deployments:      deployments,
+		logger:           logger,
+		traefikContainer: traefikContainer,
+		retryDelay:       10 * time.Second,
+		purgeInterval:    1 * time.Hour,
+	}
+}
+
+// Start follows Traefik's logs until ctx is done, reconnecting when the stream ends (Traefik restarts)
+func (w *WAFHitCollector) Start(ctx context.Context) error {
+	w.logger.Info("Starting WAF hit collector", zap.String("traefik_container", w.traefikContainer))
+	w.lastSeen = time.Now()
+
+	go w.purgeLoop(ctx)
+
+	for {
+		if err := w.deployments.FollowWAFHits(ctx, w.traefikContainer, w.lastSeen, w.recordHit); err != nil {
+			w.logger.Warn("WAF hit collection interrupted", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			w.logger.Info("WAF hit collector stopped")
+			return ctx.Err()
+		case <-time.After(w.retryDelay):
+		}
+	}
+}
+
+// recordHit stores a hit with the app's current WAF mode; hits of apps that turned the WAF off are dropped
+func (w *WAFHitCollector) recordHit(appID string, hit *services.WAFHit, at time.Time) {
+	// Docker's since filter has second precision, so lines from the last second are sent again
+	if !at.After(w.lastSeen) {
+		return
+	}
+	w.lastSeen = at
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := w.pool.Exec(ctx,
+		`INSERT INTO waf_hits (app_id, rule_id, message, severity, action, mode, client_ip, uri, created_at)
+		 SELECT app_id, $2, $3, $4, $5, mode, $6, $7, $8
+		 FROM app_waf_settings WHERE app_id = $1`,
+		appID, hit.RuleID, hit.Message, hit.Severity, hit.Action, hit.ClientIP, hit.URI, at,
+	); err != nil {
+		w.logger.Error("Failed to record WAF hit", zap.Error(err), zap.String("app_id", appID), zap.String("rule_id", hit.RuleID))
+	}
+}
+
+// purgeLoop deletes hits older than the retention period
+func (w *WAFHitCollector) purgeLoop(ctx context.Context) {
+	ticker := time.NewTicker(w.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tag, err := w.pool.Exec(ctx, `DELETE FROM waf_hits WHERE created_at < $1`, time.Now().UTC().Add(-wafHitRetention))
+			if err != nil {
+				w.logger.Error("Failed to purge WAF hits", zap.Error(err))
+				continue
+			}
+			if tag.RowsAffected() > 0 {
+				w.logger.Info("Purged old WAF hits", zap.Int64("hits", tag.RowsAffected()))
+			}
+		}
+	}
+}